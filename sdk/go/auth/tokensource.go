@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// refreshMargin renews tokens this long before they expire so requests in flight
+// do not race the expiry
+const refreshMargin = time.Minute
+
+// TokenSource issues tokens from the authentication service and caches them until
+// shortly before they expire. It implements transport.TokenSource and
+// transport.TokenInvalidator, so a rejected token is replaced on the next request.
+type TokenSource struct {
+	client  *Client
+	request TokenRequest
+	now     func() time.Time
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// NewTokenSource creates a token source that requests tokens for the given identity
+func NewTokenSource(client *Client, request TokenRequest) *TokenSource {
+	return &TokenSource{client: client, request: request, now: time.Now}
+}
+
+// Token returns the cached token, issuing a new one when it is missing or about to expire
+func (s *TokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && s.now().Add(refreshMargin).Before(s.expiresAt) {
+		return s.token, nil
+	}
+
+	resp, err := s.client.GenerateToken(ctx, s.request)
+	if err != nil {
+		return "", fmt.Errorf("generating token for %s: %w", s.request.UserID, err)
+	}
+	s.token = resp.Token
+	s.expiresAt = time.Unix(resp.ExpiresAt, 0)
+	return s.token, nil
+}
+
+// Invalidate drops the cached token
+func (s *TokenSource) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = ""
+	s.expiresAt = time.Time{}
+}
@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/healthcare-gitops/sdk/go/transport"
+)
+
+func TestTokenSourceCachesUntilExpiry(t *testing.T) {
+	var issued int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/token" || r.Method != http.MethodPost {
+			t.Errorf("unexpected %s %s", r.Method, r.URL.Path)
+		}
+		n := atomic.AddInt32(&issued, 1)
+		json.NewEncoder(w).Encode(TokenResponse{
+			Token:     "token-" + strconv.Itoa(int(n)),
+			ExpiresAt: time.Now().Add(15 * time.Minute).Unix(),
+			TokenType: "Bearer",
+		})
+	}))
+	defer server.Close()
+
+	source := NewTokenSource(NewClient(transport.New(server.URL, nil)), TokenRequest{UserID: "dev@example.com", Role: TokenRequestRoleDeveloper})
+	ctx := context.Background()
+
+	first, err := source.Token(ctx)
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	second, _ := source.Token(ctx)
+	if first != "token-1" || second != "token-1" {
+		t.Fatalf("got %q then %q, want the cached token-1", first, second)
+	}
+
+	// Inside the refresh margin a new token is issued
+	source.now = func() time.Time { return time.Now().Add(15 * time.Minute) }
+	if renewed, _ := source.Token(ctx); renewed != "token-2" {
+		t.Fatalf("got %q, want token-2 near expiry", renewed)
+	}
+
+	source.Invalidate()
+	if replaced, _ := source.Token(ctx); replaced != "token-3" {
+		t.Fatalf("got %q, want token-3 after Invalidate", replaced)
+	}
+}
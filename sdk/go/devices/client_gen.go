@@ -0,0 +1,928 @@
+// Code generated by openapigen from services/medical-device/openapi.yaml. DO NOT EDIT.
+
+// Package devices is the client for the medical device service (Medical Device Service API 1.11.0).
+package devices
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/healthcare-gitops/sdk/go/transport"
+)
+
+// APIVersion is the version of the API description this package was generated from
+const APIVersion = "1.11.0"
+
+// Client calls the medical device service
+type Client struct {
+	t *transport.Transport
+}
+
+// NewClient creates a client that sends requests through t
+func NewClient(t *transport.Transport) *Client {
+	return &Client{t: t}
+}
+
+// GetSelfScan calls GET /admin/selfscan (Security misconfiguration self-scan).
+//
+// Checks the running service for common security misconfigurations by probing its
+// own router in-process, without credentials: CORS answering a foreign origin with
+// a wildcard or echoed Access-Control-Allow-Origin, admin routes answering
+// anonymous GET requests, secrets that are published defaults, placeholders or
+// short, and exposed Go debug endpoints (pprof, expvar). Findings are more severe
+// in production. The risk score feeds the commit risk scorer
+// (`tools/git_intel/risk_scorer.py --selfscan`). Requires the SELFSCAN_TOKEN admin
+// token.
+func (c *Client) GetSelfScan(ctx context.Context) (*SelfScanReport, error) {
+	req := transport.Request{Method: http.MethodGet, Path: "/admin/selfscan"}
+	var out SelfScanReport
+	if err := c.t.Do(ctx, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetUsageStatsPreview calls GET /admin/usage-stats (Preview anonymous usage stats).
+//
+// Returns the exact report this service sends to the platform team when the
+// operator opts in with USAGE_STATS_ENABLED and USAGE_STATS_ENDPOINT, and the
+// reporter's state. Reports carry only the fields listed in `fields`: the service,
+// its API version, the Go runtime, uptime, which features are on and how many
+// requests each has served. No request data, and so no PHI, is included. The
+// preview is served whether or not reporting is enabled.
+func (c *Client) GetUsageStatsPreview(ctx context.Context) (*UsageStatsPreview, error) {
+	req := transport.Request{Method: http.MethodGet, Path: "/admin/usage-stats"}
+	var out UsageStatsPreview
+	if err := c.t.Do(ctx, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListAlertsParams holds the optional query and header parameters of ListAlerts
+type ListAlertsParams struct {
+	Priority string
+}
+
+// ListAlerts calls GET /api/v1/alerts (List active alerts)
+func (c *Client) ListAlerts(ctx context.Context, params *ListAlertsParams) (*AlertList, error) {
+	req := transport.Request{Method: http.MethodGet, Path: "/api/v1/alerts"}
+	if params != nil {
+		if params.Priority != "" {
+			req.SetQuery("priority", params.Priority)
+		}
+	}
+	var out AlertList
+	if err := c.t.Do(ctx, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetAlert calls GET /api/v1/alerts/{alertID} (Get an alert)
+func (c *Client) GetAlert(ctx context.Context, alertID string) (*Alert, error) {
+	req := transport.Request{Method: http.MethodGet, Path: "/api/v1/alerts/" + url.PathEscape(alertID)}
+	var out Alert
+	if err := c.t.Do(ctx, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AcknowledgeAlertParams holds the optional query and header parameters of AcknowledgeAlert
+type AcknowledgeAlertParams struct {
+	XUserID string
+}
+
+// AcknowledgeAlert calls POST /api/v1/alerts/{alertID}/acknowledge (Acknowledge an alert).
+//
+// The acknowledging user comes from `X-User-ID`, or `user` in the body.
+func (c *Client) AcknowledgeAlert(ctx context.Context, alertID string, params *AcknowledgeAlertParams, body *AcknowledgeRequest) (*Alert, error) {
+	req := transport.Request{Method: http.MethodPost, Path: "/api/v1/alerts/" + url.PathEscape(alertID) + "/acknowledge"}
+	if body != nil {
+		req.Body = body
+	}
+	if params != nil {
+		if params.XUserID != "" {
+			req.SetHeader("X-User-ID", params.XUserID)
+		}
+	}
+	var out Alert
+	if err := c.t.Do(ctx, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListCalendars calls GET /api/v1/calendars (List business calendars).
+//
+// Tenants' business hours and holidays, ordered by tenant. Calendars come from
+// `CALENDARS_FILE`, which every service reads, so they are read-only here. The
+// `default` calendar applies to tenants without their own; with no calendars at
+// all, every moment counts as business hours.
+func (c *Client) ListCalendars(ctx context.Context) (*CalendarList, error) {
+	req := transport.Request{Method: http.MethodGet, Path: "/api/v1/calendars"}
+	var out CalendarList
+	if err := c.t.Do(ctx, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetCalendar calls GET /api/v1/calendars/{tenant} (Get a tenant's calendar)
+func (c *Client) GetCalendar(ctx context.Context, tenant string) (*Calendar, error) {
+	req := transport.Request{Method: http.MethodGet, Path: "/api/v1/calendars/" + url.PathEscape(tenant)}
+	var out Calendar
+	if err := c.t.Do(ctx, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// QueryCalendarParams holds the optional query and header parameters of QueryCalendar
+type QueryCalendarParams struct {
+	// RFC 3339 time to ask about; defaults to now
+	At           string
+	BusinessDays *int
+}
+
+// QueryCalendar calls GET /api/v1/calendars/{tenant}/query (Query business hours).
+//
+// Whether the tenant is open at a moment, when the current business hours end and
+// when it next opens, using the `default` calendar for tenants without their own.
+// `business_days` also asks for the opening of that many business days later.
+func (c *Client) QueryCalendar(ctx context.Context, tenant string, params *QueryCalendarParams) (*CalendarStatus, error) {
+	req := transport.Request{Method: http.MethodGet, Path: "/api/v1/calendars/" + url.PathEscape(tenant) + "/query"}
+	if params != nil {
+		if params.At != "" {
+			req.SetQuery("at", params.At)
+		}
+		if params.BusinessDays != nil {
+			req.SetQuery("business_days", strconv.Itoa(*params.BusinessDays))
+		}
+	}
+	var out CalendarStatus
+	if err := c.t.Do(ctx, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DecommissionDevices calls POST /api/v1/decommissions (Decommission a fleet of devices).
+//
+// Retires every device listed in `device_ids`, plus every active device at
+// `location` or of `model`. For each device, in order:
+//
+// 1. Its history (record, metrics, alerts, calibrations, maintenance, contracts
+// and snapshots) is exported as gzipped JSON to cold storage (DEVICE_ARCHIVE_DIR).
+// 2. The auth-service API keys it owns are revoked, using the caller's token. 3.
+// It is retired and archived like a single decommission. 4. A plain-text
+// decommissioning certificate is written next to the export.
+//
+// A device whose export or key revocation fails stays in service and is reported
+// as failed. The batch can then be run again. Telemetry readings are patient data,
+// so they are not exported.
+func (c *Client) DecommissionDevices(ctx context.Context, body DecommissionRequest) (*DecommissionBatch, error) {
+	req := transport.Request{Method: http.MethodPost, Path: "/api/v1/decommissions", Body: body}
+	var out DecommissionBatch
+	if err := c.t.Do(ctx, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetDecommissionBatch calls GET /api/v1/decommissions/{batchID} (Get a decommissioning batch)
+func (c *Client) GetDecommissionBatch(ctx context.Context, batchID string) (*DecommissionBatch, error) {
+	req := transport.Request{Method: http.MethodGet, Path: "/api/v1/decommissions/" + url.PathEscape(batchID)}
+	var out DecommissionBatch
+	if err := c.t.Do(ctx, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListDevicesParams holds the optional query and header parameters of ListDevices
+type ListDevicesParams struct {
+	Limit                 *int
+	Offset                *int
+	IncludeDecommissioned *bool
+}
+
+// ListDevices calls GET /api/v1/devices (List devices).
+//
+// Lists devices ordered by ID. Without `limit` every device is returned; with it,
+// `next_offset` is set while more devices remain.
+func (c *Client) ListDevices(ctx context.Context, params *ListDevicesParams) (*DeviceList, error) {
+	req := transport.Request{Method: http.MethodGet, Path: "/api/v1/devices"}
+	if params != nil {
+		if params.Limit != nil {
+			req.SetQuery("limit", strconv.Itoa(*params.Limit))
+		}
+		if params.Offset != nil {
+			req.SetQuery("offset", strconv.Itoa(*params.Offset))
+		}
+		if params.IncludeDecommissioned != nil {
+			req.SetQuery("include_decommissioned", strconv.FormatBool(*params.IncludeDecommissioned))
+		}
+	}
+	var out DeviceList
+	if err := c.t.Do(ctx, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RegisterDeviceParams holds the optional query and header parameters of RegisterDevice
+type RegisterDeviceParams struct {
+	// Set to true to mark the records created as synthetic test data
+	XSyntheticData *bool
+	// How long synthetic records are kept, as a Go duration such as 6h. Defaults to 24 hours; the maximum is the synthetic_ttl_max_seconds capability limit.
+	XSyntheticTTL string
+	// What created the synthetic records, such as a test suite name
+	XSyntheticOrigin string
+}
+
+// RegisterDevice calls POST /api/v1/devices (Register a device).
+//
+// Registers a device. Test suites and demos should send `X-Synthetic-Data: true`;
+// the device is then marked synthetic and purged with its history once its TTL
+// passes. The synthetic fields in the body are ignored.
+func (c *Client) RegisterDevice(ctx context.Context, params *RegisterDeviceParams, body Device) (*Device, error) {
+	req := transport.Request{Method: http.MethodPost, Path: "/api/v1/devices", Body: body}
+	if params != nil {
+		if params.XSyntheticData != nil {
+			req.SetHeader("X-Synthetic-Data", strconv.FormatBool(*params.XSyntheticData))
+		}
+		if params.XSyntheticTTL != "" {
+			req.SetHeader("X-Synthetic-TTL", params.XSyntheticTTL)
+		}
+		if params.XSyntheticOrigin != "" {
+			req.SetHeader("X-Synthetic-Origin", params.XSyntheticOrigin)
+		}
+	}
+	var out Device
+	if err := c.t.Do(ctx, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetDevice calls GET /api/v1/devices/{deviceID} (Get a device).
+//
+// Decommissioned devices remain readable until purged.
+func (c *Client) GetDevice(ctx context.Context, deviceID string) (*Device, error) {
+	req := transport.Request{Method: http.MethodGet, Path: "/api/v1/devices/" + url.PathEscape(deviceID)}
+	var out Device
+	if err := c.t.Do(ctx, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateDevice calls PUT /api/v1/devices/{deviceID} (Replace device details)
+func (c *Client) UpdateDevice(ctx context.Context, deviceID string, body Device) (*Device, error) {
+	req := transport.Request{Method: http.MethodPut, Path: "/api/v1/devices/" + url.PathEscape(deviceID), Body: body}
+	var out Device
+	if err := c.t.Do(ctx, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PatchDevice calls PATCH /api/v1/devices/{deviceID} (Partially update a device).
+//
+// Applies a JSON merge patch (RFC 7396). Only the listed fields may be changed.
+func (c *Client) PatchDevice(ctx context.Context, deviceID string, body DevicePatch) (*Device, error) {
+	req := transport.Request{Method: http.MethodPatch, Path: "/api/v1/devices/" + url.PathEscape(deviceID), Body: body}
+	var out Device
+	if err := c.t.Do(ctx, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeregisterDevice calls DELETE /api/v1/devices/{deviceID} (Decommission a device).
+//
+// Archives the device; it is purged after the retention period.
+func (c *Client) DeregisterDevice(ctx context.Context, deviceID string) error {
+	req := transport.Request{Method: http.MethodDelete, Path: "/api/v1/devices/" + url.PathEscape(deviceID)}
+	return c.t.Do(ctx, req, nil)
+}
+
+// RecordHeartbeat calls POST /api/v1/devices/{deviceID}/heartbeat (Record a heartbeat)
+func (c *Client) RecordHeartbeat(ctx context.Context, deviceID string) (*HeartbeatResponse, error) {
+	req := transport.Request{Method: http.MethodPost, Path: "/api/v1/devices/" + url.PathEscape(deviceID) + "/heartbeat"}
+	var out HeartbeatResponse
+	if err := c.t.Do(ctx, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetDeviceMetrics calls GET /api/v1/devices/{deviceID}/metrics (Get device metrics)
+func (c *Client) GetDeviceMetrics(ctx context.Context, deviceID string) (*DeviceMetrics, error) {
+	req := transport.Request{Method: http.MethodGet, Path: "/api/v1/devices/" + url.PathEscape(deviceID) + "/metrics"}
+	var out DeviceMetrics
+	if err := c.t.Do(ctx, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateDeviceMetrics calls POST /api/v1/devices/{deviceID}/metrics (Report device metrics)
+func (c *Client) UpdateDeviceMetrics(ctx context.Context, deviceID string, body DeviceMetrics) (*DeviceMetrics, error) {
+	req := transport.Request{Method: http.MethodPost, Path: "/api/v1/devices/" + url.PathEscape(deviceID) + "/metrics", Body: body}
+	var out DeviceMetrics
+	if err := c.t.Do(ctx, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetSummary calls GET /api/v1/summary (Fleet summary for dashboards).
+//
+// Device counts by status and type, today's failures and alerts, and active alerts
+// by priority. The counts are kept up to date as devices and alerts change, so the
+// summary is cheap to poll. A failure is a device entering `error` or `offline`;
+// "today" is the current UTC day. Counts cover active devices on the instance that
+// serves the request.
+func (c *Client) GetSummary(ctx context.Context) (*DeviceSummary, error) {
+	req := transport.Request{Method: http.MethodGet, Path: "/api/v1/summary"}
+	var out DeviceSummary
+	if err := c.t.Do(ctx, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetCapabilities calls GET /capabilities (Discover deployment capabilities).
+//
+// Lists the features enabled on this deployment, the API versions served and the
+// limits clients should stay within. Features are controlled by feature flags
+// (`FEATURE_<NAME>`); a feature whose flag is on but which lacks required
+// configuration is reported as disabled with a reason.
+func (c *Client) GetCapabilities(ctx context.Context) (*Capabilities, error) {
+	req := transport.Request{Method: http.MethodGet, Path: "/capabilities"}
+	var out Capabilities
+	if err := c.t.Do(ctx, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetChangelogParams holds the optional query and header parameters of GetChangelog
+type GetChangelogParams struct {
+	// Only changes after this spec version, e.g. the version a client was built against
+	Since string
+	// Only changes of this kind
+	Kind string
+}
+
+// GetChangelog calls GET /changelog (List API changes).
+//
+// The machine-readable changelog of this API: endpoints and fields added, changed,
+// deprecated or removed, newest first, each with the spec version it took effect
+// in. Deprecated entries name their replacement and, where one is set, the sunset
+// date. The SDK reads it to warn when a caller uses a deprecated endpoint.
+func (c *Client) GetChangelog(ctx context.Context, params *GetChangelogParams) (*Changelog, error) {
+	req := transport.Request{Method: http.MethodGet, Path: "/changelog"}
+	if params != nil {
+		if params.Since != "" {
+			req.SetQuery("since", params.Since)
+		}
+		if params.Kind != "" {
+			req.SetQuery("kind", params.Kind)
+		}
+	}
+	var out Changelog
+	if err := c.t.Do(ctx, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetComplianceStatus calls GET /compliance/status (Compliance status report).
+//
+// The service's FDA 21 CFR Part 11 and Part 820 controls, checked live:
+// authentication, audit bus delivery, the calibration signing key, every
+// calibration certificate's signature and overdue maintenance across the devices
+// in service. Each control links to its evidence. The compliance-report command
+// combines this with every other service's status.
+func (c *Client) GetComplianceStatus(ctx context.Context) (*ComplianceReport, error) {
+	req := transport.Request{Method: http.MethodGet, Path: "/compliance/status"}
+	var out ComplianceReport
+	if err := c.t.Do(ctx, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetOpenAPIDocument calls GET /openapi.json (OpenAPI document).
+//
+// This document as JSON, converted from the service's openapi.yaml when it starts;
+// its info.version is the API version the service implements.
+func (c *Client) GetOpenAPIDocument(ctx context.Context) (map[string]interface{}, error) {
+	req := transport.Request{Method: http.MethodGet, Path: "/openapi.json"}
+	var out map[string]interface{}
+	if err := c.t.Do(ctx, req, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AcknowledgeRequest is defined by the API description
+type AcknowledgeRequest struct {
+	Note string `json:"note,omitempty"`
+	User string `json:"user,omitempty"`
+}
+
+// Alert is defined by the API description
+type Alert struct {
+	AckDeadline    time.Time   `json:"ack_deadline"`
+	AcknowledgedAt *time.Time  `json:"acknowledged_at,omitempty"`
+	AcknowledgedBy string      `json:"acknowledged_by,omitempty"`
+	AlertLevel     string      `json:"alert_level"`
+	BreachedAt     *time.Time  `json:"breached_at,omitempty"`
+	Condition      string      `json:"condition"`
+	DeviceID       string      `json:"device_id"`
+	DeviceType     string      `json:"device_type"`
+	ID             string      `json:"id"`
+	Location       string      `json:"location"`
+	Message        string      `json:"message"`
+	Notes          []AlertNote `json:"notes,omitempty"`
+	Priority       string      `json:"priority"`
+	RaisedAt       time.Time   `json:"raised_at"`
+	ResolvedAt     *time.Time  `json:"resolved_at,omitempty"`
+	SLABreached    bool        `json:"sla_breached"`
+}
+
+// Allowed values for enumerated Alert fields
+const (
+	AlertConditionHeartbeatLost    = "heartbeat_lost"
+	AlertConditionDeviceError      = "device_error"
+	AlertConditionDeviceOffline    = "device_offline"
+	AlertConditionDeviceDegraded   = "device_degraded"
+	AlertConditionContractExpiring = "contract_expiring"
+	AlertPriorityHigh              = "high"
+	AlertPriorityMedium            = "medium"
+	AlertPriorityLow               = "low"
+)
+
+// AlertList is defined by the API description
+type AlertList struct {
+	Alerts []Alert `json:"alerts"`
+	Count  int     `json:"count"`
+}
+
+// AlertNote is defined by the API description
+type AlertNote struct {
+	Author    string    `json:"author"`
+	CreatedAt time.Time `json:"created_at"`
+	ID        string    `json:"id"`
+	Text      string    `json:"text"`
+}
+
+// Calendar is defined by the API description
+type Calendar struct {
+	Holidays []CalendarHoliday `json:"holidays,omitempty"`
+	// Business hours by lower-case weekday; days without hours are closed
+	Hours  map[string][]CalendarInterval `json:"hours"`
+	Tenant string                        `json:"tenant"`
+	// IANA time zone the hours and holidays are in
+	TimeZone string `json:"time_zone"`
+}
+
+// CalendarHoliday is defined by the API description
+type CalendarHoliday struct {
+	// YYYY-MM-DD, or MM-DD for a holiday every year
+	Date string `json:"date"`
+	Name string `json:"name,omitempty"`
+}
+
+// CalendarInterval is defined by the API description
+type CalendarInterval struct {
+	// HH:MM, up to 24:00
+	End string `json:"end"`
+	// HH:MM
+	Start string `json:"start"`
+}
+
+// CalendarList is defined by the API description
+type CalendarList struct {
+	Calendars []Calendar `json:"calendars"`
+	Count     int        `json:"count"`
+}
+
+// CalendarStatus is defined by the API description
+type CalendarStatus struct {
+	// Opening of the business_days-th business day after at, when asked for
+	AfterBusinessDays *time.Time `json:"after_business_days,omitempty"`
+	At                time.Time  `json:"at"`
+	// Whether the day has business hours and is not a holiday
+	BusinessDay bool `json:"business_day"`
+	// The calendar that applied, `default` for tenants without their own
+	Calendar string `json:"calendar"`
+	// When the current business hours end, while open
+	ClosesAt *time.Time       `json:"closes_at,omitempty"`
+	Holiday  *CalendarHoliday `json:"holiday,omitempty"`
+	// The queried time when open, otherwise the start of the next business hours
+	NextOpen time.Time `json:"next_open"`
+	Open     bool      `json:"open"`
+	Tenant   string    `json:"tenant"`
+}
+
+// Capabilities is defined by the API description
+type Capabilities struct {
+	APIVersions []string           `json:"api_versions"`
+	Features    map[string]Feature `json:"features"`
+	// Numeric limits by name, e.g. request_timeout_seconds
+	Limits  map[string]int64 `json:"limits"`
+	Service string           `json:"service"`
+	// Version of this OpenAPI document the deployment implements
+	SpecVersion string `json:"spec_version"`
+}
+
+// Changelog is defined by the API description
+type Changelog struct {
+	// Changes, newest first
+	Entries []ChangelogEntry `json:"entries"`
+	Service string           `json:"service"`
+	// Version of this OpenAPI document the deployment implements
+	Version string `json:"version"`
+}
+
+// ChangelogEntry is defined by the API description
+type ChangelogEntry struct {
+	Description string `json:"description"`
+	// Request or response field changed, dotted for nested fields, when the change is not to the whole endpoint
+	Field  string `json:"field,omitempty"`
+	Kind   string `json:"kind"`
+	Method string `json:"method"`
+	// Endpoint path as documented here, with `{param}` templates
+	Path string `json:"path"`
+	// What to use instead of a deprecated or removed endpoint or field
+	Replacement string `json:"replacement,omitempty"`
+	// When a deprecated endpoint or field stops being served
+	Sunset string `json:"sunset,omitempty"`
+	// Spec version the change took effect in
+	Version string `json:"version"`
+}
+
+// Allowed values for enumerated ChangelogEntry fields
+const (
+	ChangelogEntryKindAdded      = "added"
+	ChangelogEntryKindChanged    = "changed"
+	ChangelogEntryKindDeprecated = "deprecated"
+	ChangelogEntryKindRemoved    = "removed"
+)
+
+// ComplianceReport: The service's compliance posture, from live checks of its controls. status is
+// non_compliant when any control failed and at_risk when any warned.
+type ComplianceReport struct {
+	Audit       AuditBusStats       `json:"audit"`
+	Controls    []ComplianceControl `json:"controls"`
+	Frameworks  []string            `json:"frameworks"`
+	GeneratedAt time.Time           `json:"generated_at"`
+	Service     string              `json:"service"`
+	Status      string              `json:"status"`
+	// The service's API spec version
+	Version string `json:"version"`
+	// Counters on /metrics that count compliance violations, optionally with a label selector
+	ViolationMetrics []string `json:"violation_metrics,omitempty"`
+}
+
+// Allowed values for enumerated ComplianceReport fields
+const (
+	ComplianceReportFrameworkHIPAA     = "HIPAA"
+	ComplianceReportFrameworkSOX       = "SOX"
+	ComplianceReportFrameworkFDA       = "FDA"
+	ComplianceReportStatusCompliant    = "compliant"
+	ComplianceReportStatusAtRisk       = "at_risk"
+	ComplianceReportStatusNonCompliant = "non_compliant"
+)
+
+// AuditBusStats: Audit events emitted to the shared audit bus since the service started
+type AuditBusStats struct {
+	Emitted int64 `json:"emitted"`
+	// Events written to stderr because the sink failed or the queue was full
+	Fallback int64 `json:"fallback"`
+	Written  int64 `json:"written"`
+}
+
+// ComplianceControl is defined by the API description
+type ComplianceControl struct {
+	Detail    string               `json:"detail"`
+	Evidence  []ComplianceEvidence `json:"evidence,omitempty"`
+	Framework string               `json:"framework"`
+	ID        string               `json:"id"`
+	// The regulation the control meets
+	Requirement string `json:"requirement"`
+	Status      string `json:"status"`
+	Title       string `json:"title"`
+}
+
+// Allowed values for enumerated ComplianceControl fields
+const (
+	ComplianceControlFrameworkHIPAA = "HIPAA"
+	ComplianceControlFrameworkSOX   = "SOX"
+	ComplianceControlFrameworkFDA   = "FDA"
+	ComplianceControlStatusPass     = "pass"
+	ComplianceControlStatusWarning  = "warning"
+	ComplianceControlStatusFail     = "fail"
+)
+
+// ComplianceEvidence is defined by the API description
+type ComplianceEvidence struct {
+	Title string `json:"title"`
+	// Path on this service, or an absolute URL, where the evidence can be inspected
+	URL string `json:"url"`
+}
+
+// DecommissionBatch is defined by the API description
+type DecommissionBatch struct {
+	CreatedAt time.Time `json:"created_at"`
+	// not_configured when AUTH_APIKEYS_URL is unset and no keys were revoked
+	CredentialRevocation string               `json:"credential_revocation"`
+	Devices              []DecommissionResult `json:"devices"`
+	Disposition          string               `json:"disposition,omitempty"`
+	Failed               int                  `json:"failed"`
+	ID                   string               `json:"id"`
+	Reason               string               `json:"reason"`
+	// From X-User-ID
+	RequestedBy string `json:"requested_by,omitempty"`
+	Retired     int    `json:"retired"`
+}
+
+// Allowed values for enumerated DecommissionBatch fields
+const (
+	DecommissionBatchCredentialRevocationAuthService   = "auth-service"
+	DecommissionBatchCredentialRevocationNotConfigured = "not_configured"
+)
+
+// DecommissionRequest is defined by the API description
+type DecommissionRequest struct {
+	DeviceIds []string `json:"device_ids,omitempty"`
+	// What happens to the hardware
+	Disposition string `json:"disposition,omitempty"`
+	// Adds every active device at this location
+	Location string `json:"location,omitempty"`
+	// Adds every active device of this model
+	Model  string `json:"model,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// DecommissionResult is defined by the API description
+type DecommissionResult struct {
+	Archive          *ArchiveRef `json:"archive,omitempty"`
+	Certificate      *ArchiveRef `json:"certificate,omitempty"`
+	DecommissionedAt *time.Time  `json:"decommissioned_at,omitempty"`
+	DeviceID         string      `json:"device_id"`
+	// Why the device was not retired, or what failed after it was
+	Error          string   `json:"error,omitempty"`
+	RevokedAPIKeys []string `json:"revoked_api_keys,omitempty"`
+	Status         string   `json:"status"`
+}
+
+// Allowed values for enumerated DecommissionResult fields
+const (
+	DecommissionResultStatusRetired = "retired"
+	DecommissionResultStatusFailed  = "failed"
+)
+
+// ArchiveRef is defined by the API description
+type ArchiveRef struct {
+	// Object key in the archive store
+	Key    string `json:"key"`
+	Sha256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// Device is defined by the API description
+type Device struct {
+	AlertLevel       string     `json:"alert_level"`
+	DecommissionedAt *time.Time `json:"decommissioned_at,omitempty"`
+	ErrorCount       int        `json:"error_count"`
+	FirmwareVersion  string     `json:"firmware_version"`
+	// Overrides the default heartbeat interval for the device type
+	HeartbeatIntervalSeconds *int      `json:"heartbeat_interval_seconds,omitempty"`
+	ID                       string    `json:"id"`
+	LastCalibration          time.Time `json:"last_calibration"`
+	LastHeartbeat            time.Time `json:"last_heartbeat"`
+	Location                 string    `json:"location"`
+	Manufacturer             string    `json:"manufacturer"`
+	Model                    string    `json:"model"`
+	NextMaintenance          time.Time `json:"next_maintenance"`
+	SerialNumber             string    `json:"serial_number"`
+	// retired is set on decommissioning and cannot be set by clients
+	Status string `json:"status"`
+	// Set for test and demo devices; read-only
+	Synthetic *bool `json:"synthetic,omitempty"`
+	// When a synthetic device will be purged; unset for simulator devices
+	SyntheticExpiresAt *time.Time `json:"synthetic_expires_at,omitempty"`
+	// What created a synthetic device, e.g. simulator
+	SyntheticOrigin string `json:"synthetic_origin,omitempty"`
+	Type            string `json:"type"`
+	UptimeSeconds   int64  `json:"uptime_seconds"`
+}
+
+// Allowed values for enumerated Device fields
+const (
+	DeviceStatusOperational = "operational"
+	DeviceStatusDegraded    = "degraded"
+	DeviceStatusOffline     = "offline"
+	DeviceStatusMaintenance = "maintenance"
+	DeviceStatusError       = "error"
+	DeviceStatusRetired     = "retired"
+	DeviceTypeMRI           = "MRI"
+	DeviceTypeCTScanner     = "CT_Scanner"
+	DeviceTypeXRay          = "X-Ray"
+	DeviceTypeECG           = "ECG"
+	DeviceTypeVentilator    = "Ventilator"
+	DeviceTypeInfusionPump  = "Infusion_Pump"
+)
+
+// DeviceList is defined by the API description
+type DeviceList struct {
+	// Devices in this page
+	Count   int      `json:"count"`
+	Devices []Device `json:"devices"`
+	// Offset of the next page; absent on the last page
+	NextOffset *int `json:"next_offset,omitempty"`
+	// Devices across all pages
+	Total int `json:"total"`
+}
+
+// DeviceMetrics is defined by the API description
+type DeviceMetrics struct {
+	CPUUtilizationPercent float64    `json:"cpu_utilization_percent"`
+	LastUpdated           *time.Time `json:"last_updated,omitempty"`
+	MemoryUsagePercent    float64    `json:"memory_usage_percent"`
+	NetworkLatencyMs      float64    `json:"network_latency_ms"`
+	PowerConsumptionWatts float64    `json:"power_consumption_watts"`
+	TemperatureCelsius    float64    `json:"temperature_celsius"`
+}
+
+// DevicePatch: Fields to change; omitted fields are left untouched
+type DevicePatch struct {
+	ErrorCount               *int       `json:"error_count,omitempty"`
+	FirmwareVersion          string     `json:"firmware_version,omitempty"`
+	HeartbeatIntervalSeconds *int       `json:"heartbeat_interval_seconds,omitempty"`
+	LastCalibration          *time.Time `json:"last_calibration,omitempty"`
+	Location                 string     `json:"location,omitempty"`
+	Manufacturer             string     `json:"manufacturer,omitempty"`
+	Model                    string     `json:"model,omitempty"`
+	NextMaintenance          *time.Time `json:"next_maintenance,omitempty"`
+	SerialNumber             string     `json:"serial_number,omitempty"`
+	Status                   string     `json:"status,omitempty"`
+	Type                     string     `json:"type,omitempty"`
+}
+
+// Allowed values for enumerated DevicePatch fields
+const (
+	DevicePatchStatusOperational = "operational"
+	DevicePatchStatusDegraded    = "degraded"
+	DevicePatchStatusOffline     = "offline"
+	DevicePatchStatusMaintenance = "maintenance"
+	DevicePatchStatusError       = "error"
+	DevicePatchTypeMRI           = "MRI"
+	DevicePatchTypeCTScanner     = "CT_Scanner"
+	DevicePatchTypeXRay          = "X-Ray"
+	DevicePatchTypeECG           = "ECG"
+	DevicePatchTypeVentilator    = "Ventilator"
+	DevicePatchTypeInfusionPump  = "Infusion_Pump"
+)
+
+// DeviceSummary is defined by the API description
+type DeviceSummary struct {
+	ActiveAlerts DeviceSummaryActiveAlerts `json:"active_alerts"`
+	// UTC date the daily counts cover
+	Day         string               `json:"day"`
+	Devices     DeviceSummaryDevices `json:"devices"`
+	GeneratedAt time.Time            `json:"generated_at"`
+	Today       DeviceSummaryToday   `json:"today"`
+}
+
+// DeviceSummaryActiveAlerts is defined by the API description
+type DeviceSummaryActiveAlerts struct {
+	// Unresolved alerts per priority; every priority is listed
+	ByPriority map[string]int `json:"by_priority"`
+	Total      int            `json:"total"`
+}
+
+// DeviceSummaryDevices is defined by the API description
+type DeviceSummaryDevices struct {
+	// Active devices per status; every status is listed
+	ByStatus map[string]int `json:"by_status"`
+	// Active devices per device type
+	ByType map[string]int `json:"by_type"`
+	Total  int            `json:"total"`
+}
+
+// DeviceSummaryToday is defined by the API description
+type DeviceSummaryToday struct {
+	AlertsRaised int `json:"alerts_raised"`
+	// Times a device entered error or offline today
+	Failures       int            `json:"failures"`
+	FailuresByType map[string]int `json:"failures_by_type"`
+}
+
+// Feature is defined by the API description
+type Feature struct {
+	Description string `json:"description,omitempty"`
+	Enabled     bool   `json:"enabled"`
+	// Why the feature is off, when it is
+	Reason string `json:"reason,omitempty"`
+}
+
+// HeartbeatResponse is defined by the API description
+type HeartbeatResponse struct {
+	DeviceID      string    `json:"device_id"`
+	LastHeartbeat time.Time `json:"last_heartbeat"`
+	Status        string    `json:"status"`
+}
+
+// SelfScanReport is defined by the API description
+type SelfScanReport struct {
+	Checks []string `json:"checks,omitempty"`
+	// Findings per severity
+	Counts map[string]int `json:"counts,omitempty"`
+	// From ENV or ENVIRONMENT; production when neither is set
+	Environment string `json:"environment,omitempty"`
+	// Most severe first
+	Findings []SelfScanFinding `json:"findings,omitempty"`
+	// Findings are more severe in production
+	Production *bool `json:"production,omitempty"`
+	// The commit risk scorer's bands, medium from 40 and high from 70
+	RiskLevel string `json:"risk_level,omitempty"`
+	// Findings weighted by severity (critical 40, high 20, medium 10, low 3), capped at 100
+	RiskScore *int       `json:"risk_score,omitempty"`
+	ScannedAt *time.Time `json:"scanned_at,omitempty"`
+	Service   string     `json:"service,omitempty"`
+}
+
+// Allowed values for enumerated SelfScanReport fields
+const (
+	SelfScanReportRiskLevelLow    = "low"
+	SelfScanReportRiskLevelMedium = "medium"
+	SelfScanReportRiskLevelHigh   = "high"
+)
+
+// SelfScanFinding is defined by the API description
+type SelfScanFinding struct {
+	Check string `json:"check,omitempty"`
+	// What was observed. Secret values are never included.
+	Detail      string `json:"detail,omitempty"`
+	Remediation string `json:"remediation,omitempty"`
+	Severity    string `json:"severity,omitempty"`
+	Title       string `json:"title,omitempty"`
+}
+
+// Allowed values for enumerated SelfScanFinding fields
+const (
+	SelfScanFindingCheckCors           = "cors"
+	SelfScanFindingCheckAdminAuth      = "admin_auth"
+	SelfScanFindingCheckDefaultSecrets = "default_secrets"
+	SelfScanFindingCheckDebugEndpoints = "debug_endpoints"
+	SelfScanFindingSeverityCritical    = "critical"
+	SelfScanFindingSeverityHigh        = "high"
+	SelfScanFindingSeverityMedium      = "medium"
+	SelfScanFindingSeverityLow         = "low"
+)
+
+// UsageStatsPreview is defined by the API description
+type UsageStatsPreview struct {
+	// Whether reports are sent
+	Enabled bool `json:"enabled"`
+	// Where reports are sent (USAGE_STATS_ENDPOINT)
+	Endpoint string `json:"endpoint,omitempty"`
+	// The allowlist of fields a report can carry
+	Fields          []string `json:"fields"`
+	IntervalSeconds int      `json:"interval_seconds"`
+	// Why the last send failed, if it did
+	LastError  string           `json:"last_error,omitempty"`
+	LastSentAt *time.Time       `json:"last_sent_at,omitempty"`
+	Payload    UsageStatsReport `json:"payload"`
+}
+
+// UsageStatsReport is defined by the API description
+type UsageStatsReport struct {
+	Arch string `json:"arch"`
+	// Requests each feature has served since startup, by flag name
+	FeatureUsage map[string]int64 `json:"feature_usage"`
+	// Whether each feature is on, by flag name
+	Features map[string]bool `json:"features"`
+	// Truncated to the hour
+	GeneratedAt time.Time `json:"generated_at"`
+	GoVersion   string    `json:"go_version"`
+	// USAGE_STATS_INSTALL_ID, or random per process; never derived from the host
+	InstallID   string `json:"install_id"`
+	Os          string `json:"os"`
+	Schema      int    `json:"schema"`
+	Service     string `json:"service"`
+	UptimeHours int    `json:"uptime_hours"`
+	// The service's API spec version
+	Version string `json:"version,omitempty"`
+}
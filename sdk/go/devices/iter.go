@@ -0,0 +1,44 @@
+package devices
+
+import (
+	"context"
+	"iter"
+
+	"github.com/healthcare-gitops/sdk/go/transport"
+)
+
+// DefaultPageSize is the page size AllDevices requests when params leave Limit unset
+const DefaultPageSize = 100
+
+// AllDevices iterates over every device, fetching pages of params.Limit devices as
+// the loop advances. params.Offset, if set, is where iteration starts.
+//
+//	for device, err := range client.AllDevices(ctx, nil) {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+func (c *Client) AllDevices(ctx context.Context, params *ListDevicesParams) iter.Seq2[Device, error] {
+	page := ListDevicesParams{}
+	if params != nil {
+		page = *params
+	}
+	if page.Limit == nil {
+		limit := DefaultPageSize
+		page.Limit = &limit
+	}
+	start := 0
+	if page.Offset != nil {
+		start = *page.Offset
+	}
+
+	return transport.Paginate(ctx, start, func(ctx context.Context, offset int) ([]Device, *int, error) {
+		page.Offset = &offset
+		list, err := c.ListDevices(ctx, &page)
+		if err != nil {
+			return nil, nil, err
+		}
+		return list.Devices, list.NextOffset, nil
+	})
+}
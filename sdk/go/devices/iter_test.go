@@ -0,0 +1,83 @@
+package devices
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/healthcare-gitops/sdk/go/transport"
+)
+
+// fakeDevices serves /api/v1/devices with the service's limit/offset semantics
+func fakeDevices(t *testing.T, total int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+
+		list := DeviceList{Total: total, Devices: []Device{}}
+		for i := offset; i < total && i < offset+limit; i++ {
+			list.Devices = append(list.Devices, Device{ID: fmt.Sprintf("DEV-%03d", i)})
+		}
+		list.Count = len(list.Devices)
+		if next := offset + limit; next < total {
+			list.NextOffset = &next
+		}
+		if err := json.NewEncoder(w).Encode(list); err != nil {
+			t.Errorf("encoding page: %v", err)
+		}
+	}))
+}
+
+func TestAllDevicesFollowsPages(t *testing.T) {
+	server := fakeDevices(t, 7)
+	defer server.Close()
+	client := NewClient(transport.New(server.URL, nil))
+
+	limit := 3
+	var ids []string
+	for device, err := range client.AllDevices(context.Background(), &ListDevicesParams{Limit: &limit}) {
+		if err != nil {
+			t.Fatalf("AllDevices: %v", err)
+		}
+		ids = append(ids, device.ID)
+	}
+	if len(ids) != 7 || ids[0] != "DEV-000" || ids[6] != "DEV-006" {
+		t.Fatalf("got %v, want DEV-000..DEV-006", ids)
+	}
+}
+
+func TestAllDevicesStartsAtOffset(t *testing.T) {
+	server := fakeDevices(t, 5)
+	defer server.Close()
+	client := NewClient(transport.New(server.URL, nil))
+
+	offset := 3
+	var ids []string
+	for device, err := range client.AllDevices(context.Background(), &ListDevicesParams{Offset: &offset}) {
+		if err != nil {
+			t.Fatalf("AllDevices: %v", err)
+		}
+		ids = append(ids, device.ID)
+	}
+	if len(ids) != 2 || ids[0] != "DEV-003" {
+		t.Fatalf("got %v, want DEV-003 and DEV-004", ids)
+	}
+}
+
+func TestAllDevicesYieldsErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "limit must be between 1 and 500", http.StatusBadRequest)
+	}))
+	defer server.Close()
+	client := NewClient(transport.New(server.URL, nil))
+
+	for _, err := range client.AllDevices(context.Background(), nil) {
+		if transport.StatusCode(err) != http.StatusBadRequest {
+			t.Fatalf("got %v, want 400 APIError", err)
+		}
+	}
+}
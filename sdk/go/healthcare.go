@@ -0,0 +1,145 @@
+// Package healthcare is the Go SDK for the platform's partner APIs. It bundles typed
+// clients for the authentication, PHI, medical device and payment services, generated
+// from each service's openapi.yaml, behind one configuration:
+//
+//	client, err := healthcare.New(healthcare.Config{
+//		AuthURL:    "https://auth.example.com",
+//		DevicesURL: "https://devices.example.com",
+//		Credentials: &auth.TokenRequest{
+//			UserID: "integration@example.com",
+//			Role:   auth.TokenRequestRoleDeveloper,
+//			Scopes: []string{auth.TokenRequestScopePHIRead},
+//		},
+//	})
+//
+// Tokens are issued by the authentication service and refreshed before they expire.
+// Transient failures of idempotent requests are retried with backoff, calls carry the
+// caller's trace context when Config.Propagate is set, and calls to operations a
+// service has deprecated log a warning naming the replacement.
+package healthcare
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/healthcare-gitops/sdk/go/auth"
+	"github.com/healthcare-gitops/sdk/go/devices"
+	"github.com/healthcare-gitops/sdk/go/payments"
+	"github.com/healthcare-gitops/sdk/go/phi"
+	"github.com/healthcare-gitops/sdk/go/transport"
+)
+
+//go:generate go run ./internal/openapigen -root ../.. -out .
+
+// Version is the SDK release
+const Version = transport.Version
+
+// Config selects the services to connect to and how to authenticate. A client is
+// only created for services whose URL is set.
+type Config struct {
+	AuthURL     string
+	PHIURL      string
+	DevicesURL  string
+	PaymentsURL string
+
+	// Credentials, when set, are exchanged with the authentication service for bearer
+	// tokens. It requires AuthURL. Token, when set instead, is sent as is.
+	Credentials *auth.TokenRequest
+	Token       string
+
+	// PHIAdminToken is sent as X-Admin-Token for the PHI key management and masking operations
+	PHIAdminToken string
+
+	// PaymentsAPIKey is sent as X-API-Key to the payment gateway
+	PaymentsAPIKey string
+
+	// HTTPClient defaults to a client with a 30 second timeout
+	HTTPClient *http.Client
+
+	// Retry defaults to transport.DefaultRetryPolicy
+	Retry *transport.RetryPolicy
+
+	// UserAgent is prepended to the SDK's User-Agent
+	UserAgent string
+
+	// Propagate adds trace context to every request, as transport.Transport.Propagate
+	Propagate func(ctx context.Context, header http.Header)
+
+	// OnDeprecation is called once for each deprecated operation a client calls, as
+	// listed in the service's /changelog. It defaults to logging a warning with the
+	// standard log package; set a no-op function to silence the warnings.
+	OnDeprecation func(transport.Deprecation)
+}
+
+// Client holds one typed client per configured service. Clients for services without
+// a URL are nil.
+type Client struct {
+	Auth     *auth.Client
+	PHI      *phi.Client
+	Devices  *devices.Client
+	Payments *payments.Client
+}
+
+// New creates the service clients described by cfg
+func New(cfg Config) (*Client, error) {
+	if cfg.Credentials != nil && cfg.AuthURL == "" {
+		return nil, errors.New("healthcare: Credentials require AuthURL")
+	}
+	if cfg.Credentials != nil && cfg.Token != "" {
+		return nil, errors.New("healthcare: set Credentials or Token, not both")
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	if cfg.OnDeprecation == nil {
+		cfg.OnDeprecation = func(d transport.Deprecation) {
+			log.Printf("healthcare: %s", d)
+		}
+	}
+
+	newTransport := func(baseURL string, tokens transport.TokenSource) *transport.Transport {
+		t := transport.New(baseURL, tokens)
+		t.HTTPClient = cfg.HTTPClient
+		t.Retry = cfg.Retry
+		t.OnDeprecation = cfg.OnDeprecation
+		t.Propagate = cfg.Propagate
+		if cfg.UserAgent != "" {
+			t.UserAgent = cfg.UserAgent + " " + transport.DefaultUserAgent
+		}
+		return t
+	}
+
+	client := &Client{}
+	var tokens transport.TokenSource
+	if cfg.Token != "" {
+		tokens = transport.StaticToken(cfg.Token)
+	}
+	if cfg.AuthURL != "" {
+		client.Auth = auth.NewClient(newTransport(cfg.AuthURL, nil))
+		if cfg.Credentials != nil {
+			tokens = auth.NewTokenSource(client.Auth, *cfg.Credentials)
+		}
+	}
+
+	if cfg.PHIURL != "" {
+		t := newTransport(cfg.PHIURL, tokens)
+		if cfg.PHIAdminToken != "" {
+			t.Header.Set("X-Admin-Token", cfg.PHIAdminToken)
+		}
+		client.PHI = phi.NewClient(t)
+	}
+	if cfg.DevicesURL != "" {
+		client.Devices = devices.NewClient(newTransport(cfg.DevicesURL, tokens))
+	}
+	if cfg.PaymentsURL != "" {
+		t := newTransport(cfg.PaymentsURL, tokens)
+		if cfg.PaymentsAPIKey != "" {
+			t.Header.Set("X-API-Key", cfg.PaymentsAPIKey)
+		}
+		client.Payments = payments.NewClient(t)
+	}
+	return client, nil
+}
@@ -0,0 +1,746 @@
+// Command openapigen generates the typed service clients under sdk/go from the
+// services' OpenAPI specs. Run it through go generate in sdk/go; with -check it fails
+// instead of writing when the committed output is stale.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// service maps one OpenAPI spec onto an SDK package
+type service struct {
+	Spec    string // relative to the repository root
+	Package string // package directory and name under sdk/go
+	Name    string // human-readable service name for doc comments
+}
+
+var services = []service{
+	{Spec: "services/auth-service/openapi.yaml", Package: "auth", Name: "authentication service"},
+	{Spec: "services/phi-service/openapi.yaml", Package: "phi", Name: "PHI service"},
+	{Spec: "services/medical-device/openapi.yaml", Package: "devices", Name: "medical device service"},
+	{Spec: "services/payment-gateway/openapi.yaml", Package: "payments", Name: "payment gateway"},
+}
+
+func main() {
+	root := flag.String("root", "../..", "repository root containing services/")
+	out := flag.String("out", ".", "sdk/go directory to write packages into")
+	check := flag.Bool("check", false, "fail if generated files are out of date instead of writing them")
+	flag.Parse()
+
+	stale := false
+	for _, svc := range services {
+		data, err := os.ReadFile(filepath.Join(*root, svc.Spec))
+		if err != nil {
+			fail("reading %s: %v", svc.Spec, err)
+		}
+		var doc spec
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			fail("parsing %s: %v", svc.Spec, err)
+		}
+
+		source, err := generate(svc, &doc)
+		if err != nil {
+			fail("generating %s: %v", svc.Package, err)
+		}
+
+		name := filepath.Join(*out, svc.Package, "client_gen.go")
+		if *check {
+			current, err := os.ReadFile(name)
+			if err != nil || !bytes.Equal(current, source) {
+				fmt.Fprintf(os.Stderr, "%s is out of date; run go generate ./...\n", name)
+				stale = true
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			fail("creating %s: %v", filepath.Dir(name), err)
+		}
+		if err := os.WriteFile(name, source, 0o644); err != nil {
+			fail("writing %s: %v", name, err)
+		}
+	}
+	if stale {
+		os.Exit(1)
+	}
+}
+
+func fail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "openapigen: "+format+"\n", args...)
+	os.Exit(1)
+}
+
+// spec is the subset of OpenAPI 3.0 the generator understands
+type spec struct {
+	Info struct {
+		Title   string `yaml:"title"`
+		Version string `yaml:"version"`
+	} `yaml:"info"`
+	Paths      map[string]map[string]*operation `yaml:"paths"`
+	Components struct {
+		Schemas    map[string]*schema    `yaml:"schemas"`
+		Parameters map[string]*parameter `yaml:"parameters"`
+	} `yaml:"components"`
+}
+
+type operation struct {
+	OperationID string                 `yaml:"operationId"`
+	Summary     string                 `yaml:"summary"`
+	Description string                 `yaml:"description"`
+	Parameters  []*parameter           `yaml:"parameters"`
+	RequestBody *requestBody           `yaml:"requestBody"`
+	Responses   map[string]*response   `yaml:"responses"`
+	Security    *[]map[string][]string `yaml:"security"`
+	Deprecated  bool                   `yaml:"deprecated"`
+}
+
+type parameter struct {
+	Ref         string  `yaml:"$ref"`
+	Name        string  `yaml:"name"`
+	In          string  `yaml:"in"`
+	Required    bool    `yaml:"required"`
+	Description string  `yaml:"description"`
+	Schema      *schema `yaml:"schema"`
+}
+
+type requestBody struct {
+	Required bool                  `yaml:"required"`
+	Content  map[string]*mediaType `yaml:"content"`
+}
+
+type response struct {
+	Description string                `yaml:"description"`
+	Content     map[string]*mediaType `yaml:"content"`
+}
+
+type mediaType struct {
+	Schema *schema `yaml:"schema"`
+}
+
+type schema struct {
+	Ref                  string             `yaml:"$ref"`
+	Type                 string             `yaml:"type"`
+	Format               string             `yaml:"format"`
+	Description          string             `yaml:"description"`
+	Enum                 []interface{}      `yaml:"enum"`
+	Required             []string           `yaml:"required"`
+	Properties           map[string]*schema `yaml:"properties"`
+	Items                *schema            `yaml:"items"`
+	AdditionalProperties *schema            `yaml:"additionalProperties"`
+}
+
+// returnsJSON reports whether an operation's successful responses are JSON or empty.
+// Text endpoints such as /metrics are scraped, not called through the SDK.
+func (op *operation) returnsJSON() bool {
+	for code, resp := range op.Responses {
+		if !strings.HasPrefix(code, "2") || len(resp.Content) == 0 {
+			continue
+		}
+		if resp.Content["application/json"] == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// generator accumulates Go source for one package
+type generator struct {
+	doc      *spec
+	buf      bytes.Buffer
+	emitted  map[string]bool
+	pending  []namedSchema
+	usesTime bool
+	usesURL  bool
+	usesConv bool
+}
+
+type namedSchema struct {
+	name   string
+	doc    string
+	schema *schema
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+var httpMethods = []string{"get", "put", "post", "patch", "delete"}
+
+// generate emits the client, one method per operation with an operationId, and the
+// types those operations use
+func generate(svc service, doc *spec) ([]byte, error) {
+	g := &generator{doc: doc, emitted: make(map[string]bool)}
+
+	paths := make([]string, 0, len(doc.Paths))
+	for path := range doc.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		for _, method := range httpMethods {
+			op := doc.Paths[path][method]
+			if op == nil || op.OperationID == "" || !op.returnsJSON() {
+				continue
+			}
+			if err := g.emitOperation(path, method, op); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", strings.ToUpper(method), path, err)
+			}
+		}
+	}
+
+	// Component schemas are emitted in name order once referenced
+	for len(g.pending) > 0 {
+		sort.Slice(g.pending, func(i, j int) bool { return g.pending[i].name < g.pending[j].name })
+		next := g.pending[0]
+		g.pending = g.pending[1:]
+		g.emitType(next.name, next.doc, next.schema)
+	}
+
+	var header bytes.Buffer
+	fmt.Fprintf(&header, "// Code generated by openapigen from %s. DO NOT EDIT.\n\n", svc.Spec)
+	fmt.Fprintf(&header, "// Package %s is the client for the %s (%s %s).\n", svc.Package, svc.Name, doc.Info.Title, doc.Info.Version)
+	fmt.Fprintf(&header, "package %s\n\nimport (\n\t\"context\"\n\t\"net/http\"\n", svc.Package)
+	if g.usesURL {
+		header.WriteString("\t\"net/url\"\n")
+	}
+	if g.usesConv {
+		header.WriteString("\t\"strconv\"\n")
+	}
+	if g.usesTime {
+		header.WriteString("\t\"time\"\n")
+	}
+	header.WriteString("\n\t\"github.com/healthcare-gitops/sdk/go/transport\"\n)\n\n")
+	fmt.Fprintf(&header, "// APIVersion is the version of the API description this package was generated from\n")
+	fmt.Fprintf(&header, "const APIVersion = %q\n\n", doc.Info.Version)
+	fmt.Fprintf(&header, "// Client calls the %s\n", svc.Name)
+	header.WriteString("type Client struct {\n\tt *transport.Transport\n}\n\n")
+	header.WriteString("// NewClient creates a client that sends requests through t\n")
+	header.WriteString("func NewClient(t *transport.Transport) *Client {\n\treturn &Client{t: t}\n}\n")
+
+	return format.Source(append(header.Bytes(), g.buf.Bytes()...))
+}
+
+// resolveParameter follows a components/parameters reference
+func (g *generator) resolveParameter(p *parameter) (*parameter, error) {
+	if p.Ref == "" {
+		return p, nil
+	}
+	name := strings.TrimPrefix(p.Ref, "#/components/parameters/")
+	resolved, ok := g.doc.Components.Parameters[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown parameter %s", p.Ref)
+	}
+	return resolved, nil
+}
+
+// emitOperation writes a client method and its params type
+func (g *generator) emitOperation(path, method string, op *operation) error {
+	name := exportedName(op.OperationID)
+
+	// Path and required parameters are positional; the rest go in a params struct
+	var pathParams, requiredParams, optionParams []*parameter
+	for _, p := range op.Parameters {
+		p, err := g.resolveParameter(p)
+		if err != nil {
+			return err
+		}
+		switch {
+		case p.In == "path":
+			pathParams = append(pathParams, p)
+		case (p.In == "query" || p.In == "header") && p.Required:
+			requiredParams = append(requiredParams, p)
+		case p.In == "query" || p.In == "header":
+			optionParams = append(optionParams, p)
+		}
+	}
+
+	// Request body
+	var bodyType string
+	bodyRequired := false
+	if op.RequestBody != nil {
+		if media := op.RequestBody.Content["application/json"]; media != nil && media.Schema != nil {
+			bodyType = g.typeFor(name+"Request", media.Schema, true)
+			bodyRequired = op.RequestBody.Required
+			if !bodyRequired && !strings.HasPrefix(bodyType, "*") && !strings.HasPrefix(bodyType, "[]") && !strings.HasPrefix(bodyType, "map[") {
+				bodyType = "*" + bodyType
+			}
+		}
+	}
+
+	// First successful JSON response
+	var resultType string
+	codes := make([]string, 0, len(op.Responses))
+	for code := range op.Responses {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		if !strings.HasPrefix(code, "2") {
+			continue
+		}
+		if media := op.Responses[code].Content["application/json"]; media != nil && media.Schema != nil {
+			resultType = g.typeFor(name+"Response", media.Schema, true)
+			break
+		}
+	}
+
+	// Params type for query and header parameters
+	paramsType := ""
+	if len(optionParams) > 0 {
+		paramsType = name + "Params"
+		g.printf("\n// %s holds the optional query and header parameters of %s\n", paramsType, name)
+		g.printf("type %s struct {\n", paramsType)
+		for _, p := range optionParams {
+			if p.Description != "" {
+				g.printf("\t// %s\n", oneLine(p.Description))
+			}
+			g.printf("\t%s %s\n", exportedName(p.Name), g.paramType(p))
+		}
+		g.printf("}\n")
+	}
+
+	// Method doc
+	g.printf("\n// %s calls %s %s", name, strings.ToUpper(method), path)
+	if op.Summary != "" {
+		g.printf(" (%s)", strings.TrimSuffix(oneLine(op.Summary), "."))
+	}
+	if op.Description != "" {
+		g.printf(".\n//\n// %s\n", wrapComment(op.Description))
+	} else {
+		g.printf("\n")
+	}
+	if op.Deprecated {
+		g.printf("//\n// Deprecated: the service has deprecated this operation; see its description for the replacement.\n")
+	}
+
+	args := []string{"ctx context.Context"}
+	for _, p := range pathParams {
+		args = append(args, lowerName(p.Name)+" string")
+	}
+	for _, p := range requiredParams {
+		args = append(args, lowerName(p.Name)+" "+g.paramType(p))
+	}
+	if paramsType != "" {
+		args = append(args, "params *"+paramsType)
+	}
+	if bodyType != "" {
+		args = append(args, "body "+bodyType)
+	}
+
+	returns := "error"
+	if resultType != "" {
+		returns = "(" + resultValueType(resultType) + ", error)"
+	}
+	g.printf("func (c *Client) %s(%s) %s {\n", name, strings.Join(args, ", "), returns)
+
+	// Path
+	pathExpr := g.pathExpression(path, pathParams)
+	g.printf("\treq := transport.Request{Method: http.Method%s, Path: %s", exportedName(method), pathExpr)
+	if bodyType != "" {
+		if bodyRequired || strings.HasPrefix(bodyType, "[]") || strings.HasPrefix(bodyType, "map[") {
+			g.printf(", Body: body")
+		}
+	}
+	if op.Security != nil && len(*op.Security) == 0 {
+		g.printf(", NoAuth: true")
+	}
+	g.printf("}\n")
+	if bodyType != "" && !bodyRequired && strings.HasPrefix(bodyType, "*") {
+		g.printf("\tif body != nil {\n\t\treq.Body = body\n\t}\n")
+	}
+
+	for _, p := range requiredParams {
+		g.emitParamEncoding(p, lowerName(p.Name), "\t")
+	}
+	if paramsType != "" {
+		g.printf("\tif params != nil {\n")
+		for _, p := range optionParams {
+			g.emitParamEncoding(p, "params."+exportedName(p.Name), "\t\t")
+		}
+		g.printf("\t}\n")
+	}
+
+	if resultType == "" {
+		g.printf("\treturn c.t.Do(ctx, req, nil)\n}\n")
+		return nil
+	}
+	valueType := strings.TrimPrefix(resultType, "*")
+	g.printf("\tvar out %s\n", valueType)
+	g.printf("\tif err := c.t.Do(ctx, req, &out); err != nil {\n\t\treturn nil, err\n\t}\n")
+	if strings.HasPrefix(resultValueType(resultType), "*") {
+		g.printf("\treturn &out, nil\n}\n")
+	} else {
+		g.printf("\treturn out, nil\n}\n")
+	}
+	return nil
+}
+
+// resultValueType returns structs by pointer and slices and maps by value
+func resultValueType(t string) string {
+	if strings.HasPrefix(t, "[]") || strings.HasPrefix(t, "map[") || strings.HasPrefix(t, "*") {
+		return t
+	}
+	return "*" + t
+}
+
+// pathExpression builds a Go string expression for a templated path
+func (g *generator) pathExpression(path string, params []*parameter) string {
+	if len(params) == 0 {
+		return fmt.Sprintf("%q", path)
+	}
+	g.usesURL = true
+	parts := make([]string, 0)
+	rest := path
+	for {
+		open := strings.Index(rest, "{")
+		if open < 0 {
+			break
+		}
+		close := strings.Index(rest, "}")
+		if open > 0 {
+			parts = append(parts, fmt.Sprintf("%q", rest[:open]))
+		}
+		parts = append(parts, fmt.Sprintf("url.PathEscape(%s)", lowerName(rest[open+1:close])))
+		rest = rest[close+1:]
+	}
+	if rest != "" {
+		parts = append(parts, fmt.Sprintf("%q", rest))
+	}
+	return strings.Join(parts, " + ")
+}
+
+// paramType maps a query or header parameter to a Go type. Optional non-string
+// values are pointers so unset is distinguishable from the zero value. Arrays are
+// repeated query parameters and are always strings.
+func (g *generator) paramType(p *parameter) string {
+	t := "string"
+	if p.Schema != nil {
+		switch p.Schema.Type {
+		case "array":
+			return "[]string"
+		case "integer":
+			t = "int"
+		case "number":
+			t = "float64"
+		case "boolean":
+			t = "bool"
+		}
+	}
+	if t != "string" && !p.Required {
+		return "*" + t
+	}
+	return t
+}
+
+// emitParamEncoding writes the code that copies one parameter, held in field, into
+// the request. Unset optional values are skipped.
+func (g *generator) emitParamEncoding(p *parameter, field, indent string) {
+	t := g.paramType(p)
+	if t == "[]string" {
+		g.printf("%[1]sfor _, v := range %[2]s {\n%[1]s\treq.AddQuery(%[3]q, v)\n%[1]s}\n", indent, field, p.Name)
+		return
+	}
+
+	var value, cond string
+	switch strings.TrimPrefix(t, "*") {
+	case "string":
+		value = field
+		if !p.Required {
+			cond = field + ` != ""`
+		}
+	case "int":
+		g.usesConv = true
+		value = "strconv.Itoa(" + deref(t, field) + ")"
+	case "float64":
+		g.usesConv = true
+		value = "strconv.FormatFloat(" + deref(t, field) + ", 'f', -1, 64)"
+	case "bool":
+		g.usesConv = true
+		value = "strconv.FormatBool(" + deref(t, field) + ")"
+	}
+	if cond == "" {
+		if strings.HasPrefix(t, "*") {
+			cond = field + " != nil"
+		} else {
+			cond = "true"
+		}
+	}
+
+	setter := fmt.Sprintf("req.SetQuery(%q, %s)", p.Name, value)
+	if p.In == "header" {
+		setter = fmt.Sprintf("req.SetHeader(%q, %s)", p.Name, value)
+	}
+	if cond == "true" {
+		g.printf("%s%s\n", indent, setter)
+		return
+	}
+	g.printf("%[1]sif %[2]s {\n%[1]s\t%[3]s\n%[1]s}\n", indent, cond, setter)
+}
+
+func deref(t, field string) string {
+	if strings.HasPrefix(t, "*") {
+		return "*" + field
+	}
+	return field
+}
+
+// typeFor returns the Go type for a schema, queueing named types for emission.
+// Inline objects are named after their context.
+func (g *generator) typeFor(contextName string, s *schema, required bool) string {
+	if s.Ref != "" {
+		name := exportedName(strings.TrimPrefix(s.Ref, "#/components/schemas/"))
+		target := g.doc.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+		g.queue(name, "", target)
+		if !required && target != nil && target.Type == "object" {
+			return "*" + name
+		}
+		return name
+	}
+
+	switch s.Type {
+	case "string":
+		if s.Format == "date-time" {
+			g.usesTime = true
+			if required {
+				return "time.Time"
+			}
+			return "*time.Time"
+		}
+		return "string"
+	case "integer":
+		t := "int"
+		if s.Format == "int64" {
+			t = "int64"
+		}
+		return optional(t, required)
+	case "number":
+		return optional("float64", required)
+	case "boolean":
+		return optional("bool", required)
+	case "array":
+		if s.Items == nil {
+			return "[]interface{}"
+		}
+		return "[]" + g.typeFor(singular(contextName), s.Items, true)
+	case "object", "":
+		if s.Type == "" && len(s.Properties) == 0 && s.AdditionalProperties == nil {
+			// An empty schema accepts any JSON value
+			return "interface{}"
+		}
+		if len(s.Properties) == 0 {
+			if s.AdditionalProperties != nil {
+				return "map[string]" + g.typeFor(contextName+"Value", s.AdditionalProperties, true)
+			}
+			return "map[string]interface{}"
+		}
+		g.queue(contextName, "", s)
+		if !required {
+			return "*" + contextName
+		}
+		return contextName
+	}
+	return "interface{}"
+}
+
+func optional(t string, required bool) string {
+	if required {
+		return t
+	}
+	return "*" + t
+}
+
+func (g *generator) queue(name, doc string, s *schema) {
+	if g.emitted[name] || s == nil {
+		return
+	}
+	g.emitted[name] = true
+	g.pending = append(g.pending, namedSchema{name: name, doc: doc, schema: s})
+}
+
+// emitType writes a struct for an object schema, plus constants for its enums
+func (g *generator) emitType(name, doc string, s *schema) {
+	if s.Type != "object" && len(s.Properties) == 0 {
+		g.printf("\n// %s is a %s value\ntype %s = %s\n", name, s.Type, name, g.typeFor(name+"Item", s, true))
+		return
+	}
+
+	required := make(map[string]bool, len(s.Required))
+	for _, field := range s.Required {
+		required[field] = true
+	}
+	names := make([]string, 0, len(s.Properties))
+	for field := range s.Properties {
+		names = append(names, field)
+	}
+	sort.Strings(names)
+
+	if doc == "" && s.Description != "" {
+		doc = name + ": " + wrapComment(s.Description)
+	}
+	if doc == "" {
+		doc = name + " is defined by the API description"
+	}
+	g.printf("\n// %s\ntype %s struct {\n", doc, name)
+
+	var enums []string
+	for _, field := range names {
+		prop := s.Properties[field]
+		goField := exportedName(field)
+		goType := g.typeFor(name+goField, prop, required[field])
+
+		tag := field
+		if !required[field] {
+			tag += ",omitempty"
+		}
+		if prop.Description != "" {
+			g.printf("\t// %s\n", oneLine(prop.Description))
+		}
+		g.printf("\t%s %s `json:%q`\n", goField, goType, tag)
+
+		// Array enums are named for one element: TokenRequestScopeAdmin
+		enumSource, enumField := prop, goField
+		if prop.Type == "array" && prop.Items != nil {
+			enumSource, enumField = prop.Items, singular(goField)
+		}
+		if enumSource.Type == "string" {
+			for _, value := range enumSource.Enum {
+				enums = append(enums, fmt.Sprintf("\t%s%s%s = %q\n", name, enumField, exportedName(fmt.Sprint(value)), fmt.Sprint(value)))
+			}
+		}
+	}
+	g.printf("}\n")
+
+	if len(enums) > 0 {
+		g.printf("\n// Allowed values for enumerated %s fields\nconst (\n%s)\n", name, strings.Join(enums, ""))
+	}
+}
+
+// exportedName turns an operation, schema or field name into an exported Go
+// identifier: "encryptData" -> "EncryptData", "device_id" -> "DeviceID",
+// "payment:read" -> "PaymentRead"
+func exportedName(name string) string {
+	parts := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var b strings.Builder
+	for _, part := range parts {
+		for _, word := range splitCamel(part) {
+			if upper := strings.ToUpper(word); initialisms[upper] {
+				b.WriteString(upper)
+				continue
+			}
+			b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+	result := b.String()
+	if result != "" && unicode.IsDigit(rune(result[0])) {
+		result = "N" + result
+	}
+	return result
+}
+
+// splitCamel splits "deviceID" into ["device", "ID"]
+func splitCamel(s string) []string {
+	var words []string
+	start := 0
+	runes := []rune(s)
+	for i := 1; i < len(runes); i++ {
+		if unicode.IsUpper(runes[i]) && !unicode.IsUpper(runes[i-1]) {
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+	return append(words, string(runes[start:]))
+}
+
+// lowerName turns a parameter name into an unexported Go identifier
+func lowerName(name string) string {
+	exported := exportedName(name)
+	for prefix := range initialisms {
+		if strings.HasPrefix(exported, prefix) && exported == prefix {
+			return strings.ToLower(prefix)
+		}
+	}
+	return strings.ToLower(exported[:1]) + exported[1:]
+}
+
+// initialisms are kept upper case in generated identifiers
+var initialisms = map[string]bool{
+	"ID": true, "URL": true, "API": true, "HTTP": true, "SLA": true, "SOX": true,
+	"PCI": true, "PHI": true, "HIPAA": true, "SSN": true, "MRN": true, "JSON": true, "NDJSON": true, "CSV": true, "FPE": true, "FF1": true, "FF3": true, "IP": true, "FDA": true, "CPU": true, "MRI": true, "ECG": true, "CT": true,
+}
+
+// singular names the element type of a plural field ("Keys" -> "Key")
+func singular(name string) string {
+	switch {
+	case strings.HasSuffix(name, "ies"):
+		return strings.TrimSuffix(name, "ies") + "y"
+	case strings.HasSuffix(name, "ses"):
+		return strings.TrimSuffix(name, "es")
+	case strings.HasSuffix(name, "s") && !strings.HasSuffix(name, "ss"):
+		return strings.TrimSuffix(name, "s")
+	}
+	return name
+}
+
+func oneLine(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// wrapComment wraps text to comment lines of about 80 columns. Paragraphs are kept,
+// and Markdown list items become Go doc list items.
+func wrapComment(text string) string {
+	var out []string
+	for _, paragraph := range strings.Split(strings.TrimSpace(text), "\n\n") {
+		var lines, prose []string
+		flush := func() {
+			if len(prose) > 0 {
+				lines = append(lines, wrap(strings.Join(prose, " "))...)
+				prose = nil
+			}
+		}
+		for _, line := range strings.Split(paragraph, "\n") {
+			line = strings.TrimSpace(line)
+			if strings.HasPrefix(line, "- ") {
+				flush()
+				lines = append(lines, "  - "+strings.TrimPrefix(line, "- "))
+				continue
+			}
+			prose = append(prose, line)
+		}
+		flush()
+		out = append(out, strings.Join(lines, "\n// "))
+	}
+	return strings.Join(out, "\n//\n// ")
+}
+
+// wrap splits text into lines of about 80 columns
+func wrap(text string) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		if line != "" && len(line)+1+len(word) > 80 {
+			lines = append(lines, line)
+			line = word
+			continue
+		}
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
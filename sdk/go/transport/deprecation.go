@@ -0,0 +1,166 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// changelogPath is where every service lists its API changes
+const changelogPath = "/changelog"
+
+// Deprecation warns that an operation the client called is deprecated
+type Deprecation struct {
+	Method string
+	// Path is the documented path, with {param} templates, when the service's changelog
+	// lists the operation, otherwise the path called
+	Path string
+	// Version is the service's API version the operation was deprecated in, when known
+	Version     string
+	Description string
+	// Replacement is the operation to use instead, e.g. "POST /api/v2/payments"
+	Replacement string
+	// Sunset is when the operation stops being served: a YYYY-MM-DD date from the
+	// changelog or the HTTP date of the Sunset header
+	Sunset string
+}
+
+func (d Deprecation) String() string {
+	msg := d.Method + " " + d.Path + " is deprecated"
+	if d.Version != "" {
+		msg += " since API " + d.Version
+	}
+	if d.Sunset != "" {
+		msg += " and stops being served " + d.Sunset
+	}
+	if d.Replacement != "" {
+		msg += "; use " + d.Replacement
+	}
+	return msg
+}
+
+// changelogEntry is the part of a /changelog entry the transport uses
+type changelogEntry struct {
+	Version     string `json:"version"`
+	Kind        string `json:"kind"`
+	Method      string `json:"method"`
+	Path        string `json:"path"`
+	Field       string `json:"field"`
+	Description string `json:"description"`
+	Replacement string `json:"replacement"`
+	Sunset      string `json:"sunset"`
+}
+
+// deprecations holds a transport's deprecated operations, read once from the
+// service's changelog, and the operations already warned about
+type deprecations struct {
+	mu      sync.Mutex
+	loaded  bool
+	entries []changelogEntry
+	warned  map[string]bool
+}
+
+// checkDeprecated warns when req calls an operation the service's changelog lists as
+// deprecated. The changelog is fetched on the first request; a service too old to
+// serve one is not asked again, a service that could not be reached is.
+func (t *Transport) checkDeprecated(ctx context.Context, req Request) {
+	if t.OnDeprecation == nil || req.Path == changelogPath {
+		return
+	}
+	d := &t.deprecations
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.loaded {
+		d.entries, d.loaded = t.fetchDeprecations(ctx)
+	}
+	if e, ok := d.lookup(req); ok {
+		t.warnLocked(Deprecation{Method: req.Method, Path: e.Path, Version: e.Version, Description: e.Description, Replacement: e.Replacement, Sunset: e.Sunset})
+	}
+}
+
+// lookup finds the changelog entry deprecating the operation req calls. Deprecated
+// fields are not reported, since the transport does not see which fields are set.
+func (d *deprecations) lookup(req Request) (changelogEntry, bool) {
+	for _, e := range d.entries {
+		if e.Kind == "deprecated" && e.Field == "" && strings.EqualFold(e.Method, req.Method) && matchPath(e.Path, req.Path) {
+			return e, true
+		}
+	}
+	return changelogEntry{}, false
+}
+
+// fetchDeprecations reads the deprecated operations from the service's changelog. It
+// reports whether the service answered, so a network failure is retried.
+func (t *Transport) fetchDeprecations(ctx context.Context) ([]changelogEntry, bool) {
+	resp, err := t.send(ctx, Request{Method: http.MethodGet, Path: changelogPath, Query: url.Values{"kind": {"deprecated"}}, NoAuth: true}, nil)
+	if err != nil {
+		return nil, false
+	}
+	defer drain(resp)
+	if resp.StatusCode != http.StatusOK {
+		return nil, true
+	}
+	var doc struct {
+		Entries []changelogEntry `json:"entries"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, true
+	}
+	return doc.Entries, true
+}
+
+// checkDeprecationHeaders warns about an operation whose response carries a
+// Deprecation header (RFC 9745) but that the changelog did not list
+func (t *Transport) checkDeprecationHeaders(req Request, resp *http.Response) {
+	if t.OnDeprecation == nil || resp.Header.Get("Deprecation") == "" {
+		return
+	}
+	d := Deprecation{Method: req.Method, Path: req.Path, Sunset: resp.Header.Get("Sunset")}
+	for _, link := range resp.Header.Values("Link") {
+		if target, ok := strings.CutPrefix(link, "<"); ok && strings.Contains(link, `rel="successor-version"`) {
+			d.Replacement, _, _ = strings.Cut(target, ">")
+		}
+	}
+	t.deprecations.mu.Lock()
+	defer t.deprecations.mu.Unlock()
+	if _, ok := t.deprecations.lookup(req); !ok {
+		t.warnLocked(d)
+	}
+}
+
+// warnLocked calls OnDeprecation once per operation
+func (t *Transport) warnLocked(d Deprecation) {
+	key := d.Method + " " + d.Path
+	if t.deprecations.warned[key] {
+		return
+	}
+	if t.deprecations.warned == nil {
+		t.deprecations.warned = make(map[string]bool)
+	}
+	t.deprecations.warned[key] = true
+	t.OnDeprecation(d)
+}
+
+// matchPath reports whether path is an instance of the documented template, whose
+// {param} segments match any one segment
+func matchPath(template, path string) bool {
+	want, got := strings.Split(template, "/"), strings.Split(path, "/")
+	if len(want) != len(got) {
+		return false
+	}
+	for i := range want {
+		if strings.HasPrefix(want[i], "{") && strings.HasSuffix(want[i], "}") {
+			if got[i] == "" {
+				return false
+			}
+			continue
+		}
+		if want[i] != got[i] {
+			return false
+		}
+	}
+	return true
+}
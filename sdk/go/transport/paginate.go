@@ -0,0 +1,35 @@
+package transport
+
+import (
+	"context"
+	"iter"
+)
+
+// PageFunc fetches the page starting at offset. It returns the items and the offset
+// of the next page, or nil on the last page.
+type PageFunc[T any] func(ctx context.Context, offset int) (items []T, next *int, err error)
+
+// Paginate iterates over every item of an offset-paginated list from start, fetching
+// pages as the loop advances. Iteration stops at the first error, which is yielded once.
+func Paginate[T any](ctx context.Context, start int, fetch PageFunc[T]) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		offset := start
+		for {
+			items, next, err := fetch(ctx, offset)
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+			for _, item := range items {
+				if !yield(item, nil) {
+					return
+				}
+			}
+			if next == nil || *next <= offset || len(items) == 0 {
+				return
+			}
+			offset = *next
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package transport
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls retries of network errors and transient statuses
+// (429, 502, 503, 504). Only idempotent methods are retried unless
+// RetryNonIdempotent is set, so a payment is never submitted twice by the SDK.
+type RetryPolicy struct {
+	// MaxAttempts includes the first attempt; 1 disables retries
+	MaxAttempts int
+	// BaseDelay is doubled on each attempt, with jitter, up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// RetryNonIdempotent also retries POST and PATCH requests
+	RetryNonIdempotent bool
+}
+
+// DefaultRetryPolicy makes up to three attempts over roughly a second
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   200 * time.Millisecond,
+	MaxDelay:    5 * time.Second,
+}
+
+// NoRetry makes exactly one attempt
+var NoRetry = RetryPolicy{MaxAttempts: 1}
+
+// retryable reports whether another attempt should follow attempt. status is 0 for
+// network errors.
+func (p RetryPolicy) retryable(method string, status, attempt int) bool {
+	if attempt >= p.MaxAttempts {
+		return false
+	}
+	if !p.RetryNonIdempotent && !idempotent(method) {
+		return false
+	}
+	switch status {
+	case 0, http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// wait sleeps before the next attempt, honouring Retry-After when the response has one
+func (p RetryPolicy) wait(ctx context.Context, attempt int, resp *http.Response) error {
+	delay := p.backoff(attempt)
+	if resp != nil {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			delay = time.Duration(seconds) * time.Second
+			if p.MaxDelay > 0 && delay > p.MaxDelay {
+				delay = p.MaxDelay
+			}
+		}
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// backoff is BaseDelay * 2^(attempt-1) with up to 50% jitter, capped at MaxDelay
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay << (attempt - 1)
+	if p.MaxDelay > 0 && (delay > p.MaxDelay || delay <= 0) {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
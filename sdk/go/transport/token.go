@@ -0,0 +1,22 @@
+package transport
+
+import "context"
+
+// TokenSource supplies bearer tokens for authenticated requests
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// TokenInvalidator is implemented by caching token sources. The transport calls
+// Invalidate when a service rejects a token, then retries the request once.
+type TokenInvalidator interface {
+	Invalidate()
+}
+
+// StaticToken is a fixed bearer token, e.g. one issued out of band
+type StaticToken string
+
+// Token returns the token unchanged
+func (t StaticToken) Token(context.Context) (string, error) {
+	return string(t), nil
+}
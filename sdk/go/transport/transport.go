@@ -0,0 +1,311 @@
+// Package transport is the HTTP layer shared by the generated service clients. It
+// attaches credentials, encodes requests, decodes responses into typed values and
+// retries transient failures.
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Version is the SDK release, reported in the User-Agent header
+const Version = "0.1.0"
+
+// DefaultUserAgent identifies SDK requests in service logs
+const DefaultUserAgent = "healthcare-gitops-sdk-go/" + Version
+
+// maxErrorBodyBytes bounds how much of an error response is kept on APIError
+const maxErrorBodyBytes = 64 << 10
+
+// Transport sends requests to one service
+type Transport struct {
+	// BaseURL is the service root, e.g. "http://localhost:8081"
+	BaseURL string
+
+	// HTTPClient defaults to a client with a 30 second timeout
+	HTTPClient *http.Client
+
+	// Tokens supplies the bearer token for authenticated operations. Nil sends no
+	// Authorization header.
+	Tokens TokenSource
+
+	// Retry controls retries of transient failures; the zero value uses DefaultRetryPolicy
+	Retry *RetryPolicy
+
+	// Header is sent with every request, e.g. X-Admin-Token or X-API-Key
+	Header http.Header
+
+	// UserAgent defaults to DefaultUserAgent
+	UserAgent string
+
+	// Propagate adds the trace context carried by a call's context to the headers of
+	// each request sent for it, so the service's spans join the caller's trace. Nil
+	// sends none. With OpenTelemetry:
+	//
+	//	t.Propagate = func(ctx context.Context, header http.Header) {
+	//		otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+	//	}
+	Propagate func(ctx context.Context, header http.Header)
+
+	// OnDeprecation is called once for each deprecated operation the transport calls,
+	// as listed in the service's /changelog or announced by a Deprecation response
+	// header. Nil skips the check and does not fetch the changelog.
+	OnDeprecation func(Deprecation)
+
+	deprecations deprecations
+}
+
+// New creates a transport for the service at baseURL
+func New(baseURL string, tokens TokenSource) *Transport {
+	return &Transport{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+		Tokens:     tokens,
+		Header:     make(http.Header),
+	}
+}
+
+// Request describes one API call
+type Request struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Header http.Header
+	// Body is encoded as JSON when non-nil
+	Body interface{}
+	// NoAuth skips the token source, for operations that issue or inspect tokens
+	NoAuth bool
+}
+
+// SetQuery sets a query parameter
+func (r *Request) SetQuery(key, value string) {
+	if r.Query == nil {
+		r.Query = make(url.Values)
+	}
+	r.Query.Set(key, value)
+}
+
+// AddQuery adds a value to a query parameter, for parameters that repeat
+func (r *Request) AddQuery(key, value string) {
+	if r.Query == nil {
+		r.Query = make(url.Values)
+	}
+	r.Query.Add(key, value)
+}
+
+// SetHeader sets a request header
+func (r *Request) SetHeader(key, value string) {
+	if r.Header == nil {
+		r.Header = make(http.Header)
+	}
+	r.Header.Set(key, value)
+}
+
+// APIError is returned for non-2xx responses
+type APIError struct {
+	StatusCode int
+	// Message is the service's error message, from an {"error": ...} body, an
+	// {"error": {"code": ..., "message": ...}} envelope or the plain text body
+	Message string
+	// Code is the machine-readable error code, when the service sends one
+	Code string
+	// RequestID echoes X-Request-ID when the service sets it
+	RequestID string
+	Body      []byte
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("api error: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("api error: %d %s", e.StatusCode, e.Message)
+}
+
+// IsNotFound reports whether err is an APIError with status 404
+func IsNotFound(err error) bool {
+	return StatusCode(err) == http.StatusNotFound
+}
+
+// StatusCode returns the HTTP status of an APIError, or 0 for other errors
+func StatusCode(err error) int {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+// Do sends req and decodes a JSON response into out. out may be nil for operations
+// without a response body. Transient failures are retried per the retry policy; a 401
+// on an authenticated request invalidates the cached token and is retried once.
+func (t *Transport) Do(ctx context.Context, req Request, out interface{}) error {
+	var body []byte
+	if req.Body != nil {
+		encoded, err := json.Marshal(req.Body)
+		if err != nil {
+			return fmt.Errorf("encoding request body: %w", err)
+		}
+		body = encoded
+	}
+
+	t.checkDeprecated(ctx, req)
+
+	policy := t.retryPolicy()
+	refreshed := false
+	for attempt := 1; ; attempt++ {
+		resp, err := t.send(ctx, req, body)
+		if err != nil {
+			if ctx.Err() != nil || !policy.retryable(req.Method, 0, attempt) {
+				return err
+			}
+			if err := policy.wait(ctx, attempt, nil); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if resp.StatusCode == http.StatusUnauthorized && !req.NoAuth && !refreshed {
+			if invalidator, ok := t.Tokens.(TokenInvalidator); ok {
+				drain(resp)
+				invalidator.Invalidate()
+				refreshed = true
+				attempt--
+				continue
+			}
+		}
+
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			t.checkDeprecationHeaders(req, resp)
+			return decode(resp, out)
+		}
+
+		if policy.retryable(req.Method, resp.StatusCode, attempt) {
+			drain(resp)
+			if err := policy.wait(ctx, attempt, resp); err != nil {
+				return err
+			}
+			continue
+		}
+		return readError(resp)
+	}
+}
+
+// send performs one HTTP round trip
+func (t *Transport) send(ctx context.Context, req Request, body []byte) (*http.Response, error) {
+	target := t.BaseURL + req.Path
+	if len(req.Query) > 0 {
+		target += "?" + req.Query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.Method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, values := range t.Header {
+		httpReq.Header[key] = values
+	}
+	for key, values := range req.Header {
+		httpReq.Header[key] = values
+	}
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	userAgent := t.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+	httpReq.Header.Set("User-Agent", userAgent)
+	if t.Propagate != nil {
+		t.Propagate(ctx, httpReq.Header)
+	}
+
+	if !req.NoAuth && t.Tokens != nil {
+		token, err := t.Tokens.Token(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("obtaining access token: %w", err)
+		}
+		httpReq.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	client := t.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(httpReq)
+}
+
+func (t *Transport) retryPolicy() RetryPolicy {
+	if t.Retry == nil {
+		return DefaultRetryPolicy
+	}
+	return *t.Retry
+}
+
+// decode reads a successful response into out
+func decode(resp *http.Response, out interface{}) error {
+	defer resp.Body.Close()
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding %d response: %w", resp.StatusCode, err)
+	}
+	return nil
+}
+
+// readError turns a failed response into an APIError. Services reply either with
+// {"error": "..."} or with plain text from http.Error.
+func readError(resp *http.Response) error {
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		RequestID:  resp.Header.Get("X-Request-ID"),
+		Body:       body,
+	}
+	var payload struct {
+		Error json.RawMessage `json:"error"`
+		Code  string          `json:"code"`
+	}
+	var envelope struct {
+		Code      string `json:"code"`
+		Message   string `json:"message"`
+		RequestID string `json:"request_id"`
+	}
+	switch {
+	case json.Unmarshal(body, &payload) != nil || len(payload.Error) == 0:
+		apiErr.Message = strings.TrimSpace(string(body))
+	case json.Unmarshal(payload.Error, &apiErr.Message) == nil:
+		apiErr.Code = payload.Code
+	case json.Unmarshal(payload.Error, &envelope) == nil:
+		apiErr.Message, apiErr.Code = envelope.Message, envelope.Code
+		if apiErr.RequestID == "" {
+			apiErr.RequestID = envelope.RequestID
+		}
+	default:
+		apiErr.Message = strings.TrimSpace(string(body))
+	}
+	return apiErr
+}
+
+// drain discards a response so its connection can be reused
+func drain(resp *http.Response) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxErrorBodyBytes))
+	resp.Body.Close()
+}
@@ -0,0 +1,236 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var fastRetry = &RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+
+func TestDoRetriesIdempotentRequests(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer server.Close()
+
+	tr := New(server.URL, nil)
+	tr.Retry = fastRetry
+
+	var out struct{ Status string }
+	if err := tr.Do(context.Background(), Request{Method: http.MethodGet, Path: "/health"}, &out); err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	if out.Status != "ok" || calls != 3 {
+		t.Fatalf("got status %q after %d calls, want ok after 3", out.Status, calls)
+	}
+}
+
+func TestDoDoesNotRetryPost(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	tr := New(server.URL, nil)
+	tr.Retry = fastRetry
+
+	err := tr.Do(context.Background(), Request{Method: http.MethodPost, Path: "/process", Body: map[string]int{"amount_cents": 100}}, nil)
+	if StatusCode(err) != http.StatusServiceUnavailable {
+		t.Fatalf("got %v, want 503 APIError", err)
+	}
+	if calls != 1 {
+		t.Fatalf("POST sent %d times, want 1", calls)
+	}
+}
+
+func TestDoParsesErrors(t *testing.T) {
+	tests := []struct {
+		name, body, want, code string
+	}{
+		{"json", `{"error":"data field is required"}`, "data field is required", ""},
+		{"json with code", `{"error":"PHI has been erased","code":"erased"}`, "PHI has been erased", "erased"},
+		{"envelope", `{"error":{"code":"invalid_amount","message":"amount must be positive","request_id":"req-2"}}`, "amount must be positive", "invalid_amount"},
+		{"text", "Device not found\n", "Device not found", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Request-ID", "req-1")
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			err := New(server.URL, nil).Do(context.Background(), Request{Method: http.MethodGet, Path: "/x"}, nil)
+			apiErr, ok := err.(*APIError)
+			if !ok {
+				t.Fatalf("got %T, want *APIError", err)
+			}
+			if apiErr.Message != tt.want || apiErr.Code != tt.code || apiErr.RequestID != "req-1" || !IsNotFound(err) {
+				t.Fatalf("got %+v", apiErr)
+			}
+		})
+	}
+}
+
+type countingTokens struct {
+	issued      int32
+	invalidated int32
+}
+
+func (c *countingTokens) Token(context.Context) (string, error) {
+	if atomic.AddInt32(&c.issued, 1) == 1 {
+		return "stale", nil
+	}
+	return "fresh", nil
+}
+
+func (c *countingTokens) Invalidate() { atomic.AddInt32(&c.invalidated, 1) }
+
+func TestDoRefreshesRejectedToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer fresh" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	tokens := &countingTokens{}
+	tr := New(server.URL, tokens)
+	if err := tr.Do(context.Background(), Request{Method: http.MethodPost, Path: "/api/v1/encrypt"}, nil); err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	if tokens.invalidated != 1 || tokens.issued != 2 {
+		t.Fatalf("invalidated %d, issued %d; want 1 and 2", tokens.invalidated, tokens.issued)
+	}
+}
+
+func TestDoSkipsAuthWhenRequested(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			t.Errorf("unexpected Authorization header %q", r.Header.Get("Authorization"))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	tr := New(server.URL, StaticToken("secret"))
+	if err := tr.Do(context.Background(), Request{Method: http.MethodPost, Path: "/token", NoAuth: true}, nil); err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+}
+
+func TestDoPropagatesTraceContext(t *testing.T) {
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("traceparent") != traceparent {
+			t.Errorf("attempt %d sent traceparent %q, want %q", atomic.LoadInt32(&calls)+1, r.Header.Get("traceparent"), traceparent)
+		}
+		if atomic.AddInt32(&calls, 1) < 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	type traceKey struct{}
+	tr := New(server.URL, nil)
+	tr.Retry = fastRetry
+	tr.Propagate = func(ctx context.Context, header http.Header) {
+		if tp, ok := ctx.Value(traceKey{}).(string); ok {
+			header.Set("traceparent", tp)
+		}
+	}
+
+	ctx := context.WithValue(context.Background(), traceKey{}, traceparent)
+	if err := tr.Do(ctx, Request{Method: http.MethodGet, Path: "/health"}, nil); err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("sent %d requests, want 2", calls)
+	}
+}
+
+func TestDoWarnsOnceAboutDeprecatedOperations(t *testing.T) {
+	var changelogs int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/changelog":
+			atomic.AddInt32(&changelogs, 1)
+			if r.URL.Query().Get("kind") != "deprecated" {
+				t.Errorf("unexpected changelog query %q", r.URL.RawQuery)
+			}
+			w.Write([]byte(`{"service":"payment-gateway","version":"1.15.0","entries":[
+				{"version":"1.3.0","kind":"deprecated","method":"POST","path":"/charge","description":"v1 payment charge","replacement":"POST /api/v2/payments","sunset":"2027-04-01"},
+				{"version":"1.9.0","kind":"deprecated","method":"GET","path":"/api/v1/templates/{templateID}","field":"variables","description":"a field"}]}`))
+		case "/api/v1/legacy":
+			w.Header().Set("Deprecation", "@1790812800")
+			w.Header().Set("Sunset", "Thu, 01 Apr 2027 00:00:00 GMT")
+			w.Header().Add("Link", `</api/v2/payments>; rel="successor-version"`)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	var warnings []Deprecation
+	tr := New(server.URL, nil)
+	tr.OnDeprecation = func(d Deprecation) { warnings = append(warnings, d) }
+	ctx := context.Background()
+	for _, req := range []Request{
+		{Method: http.MethodPost, Path: "/charge"},
+		{Method: http.MethodPost, Path: "/charge"},
+		{Method: http.MethodGet, Path: "/api/v1/templates/appointment-reminder"},
+		{Method: http.MethodGet, Path: "/api/v1/legacy"},
+	} {
+		if err := tr.Do(ctx, req, nil); err != nil {
+			t.Fatalf("Do: %v", err)
+		}
+	}
+	if changelogs != 1 {
+		t.Fatalf("changelog fetched %d times, want 1", changelogs)
+	}
+	if len(warnings) != 2 {
+		t.Fatalf("got warnings %+v, want one for /charge and one for /api/v1/legacy", warnings)
+	}
+	if w := warnings[0]; w.Path != "/charge" || w.Version != "1.3.0" || w.Replacement != "POST /api/v2/payments" || w.Sunset != "2027-04-01" {
+		t.Fatalf("got %+v", w)
+	}
+	if w := warnings[1]; w.Path != "/api/v1/legacy" || w.Replacement != "/api/v2/payments" || w.Sunset == "" {
+		t.Fatalf("got %+v", w)
+	}
+}
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		template, path string
+		want           bool
+	}{
+		{"/charge", "/charge", true},
+		{"/api/v1/devices/{deviceID}", "/api/v1/devices/pump-1", true},
+		{"/api/v1/devices/{deviceID}", "/api/v1/devices/", false},
+		{"/api/v1/devices/{deviceID}", "/api/v1/devices/pump-1/metrics", false},
+		{"/api/v1/devices", "/api/v1/alerts", false},
+	}
+	for _, tt := range tests {
+		if got := matchPath(tt.template, tt.path); got != tt.want {
+			t.Errorf("matchPath(%q, %q) = %v, want %v", tt.template, tt.path, got, tt.want)
+		}
+	}
+}
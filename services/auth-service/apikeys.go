@@ -0,0 +1,561 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/healthcare-gitops/common/audit"
+	"github.com/healthcare-gitops/common/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// apiKeyPrefix starts every API key, so leaked keys are easy to recognise in logs and
+// secret scanners. A key is hck_<key ID>_<secret>.
+const apiKeyPrefix = "hck_"
+
+// API key limits
+const (
+	maxAPIKeyTTL         = 365 * 24 * time.Hour
+	maxAPIKeyRotateGrace = 7 * 24 * time.Hour
+	defaultAPIKeyGrace   = 24 * time.Hour
+)
+
+// apiKeyIntrospectPath is where services check the API keys their callers present
+const apiKeyIntrospectPath = "/apikey/introspect"
+
+var apiKeyNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+
+var (
+	errAPIKeyNotFound = errors.New("API key not found")
+	errAPIKeyRevoked  = errors.New("API key is revoked")
+	errAPIKeyInvalid  = errors.New("invalid API key")
+)
+
+var apiKeyIntrospections = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "auth_api_key_introspections_total",
+	Help: "API key introspections by result",
+}, []string{"result"})
+
+// APIKey is a long-lived credential for callers that cannot obtain JWTs, such as
+// device gateways. Only hashes of its secrets are kept; the key itself is returned
+// once, when it is created or rotated.
+type APIKey struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Owner string `json:"owner"`
+	// Role and Scopes are what introspection reports for the key
+	Role       string     `json:"role"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	RotatedAt  *time.Time `json:"rotated_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	// PreviousExpiresAt is when the secret replaced by the last rotation stops working
+	PreviousExpiresAt *time.Time `json:"previous_expires_at,omitempty"`
+}
+
+// IssuedAPIKey is an API key with its secret, as returned on creation and rotation
+type IssuedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// CreateAPIKeyRequest is the body of POST /api/v1/apikeys
+type CreateAPIKeyRequest struct {
+	Name             string   `json:"name"`
+	Owner            string   `json:"owner"`
+	Role             string   `json:"role,omitempty"`
+	Scopes           []string `json:"scopes"`
+	ExpiresInSeconds int64    `json:"expires_in_seconds,omitempty"`
+}
+
+// RotateAPIKeyRequest is the body of POST /api/v1/apikeys/{id}/rotate
+type RotateAPIKeyRequest struct {
+	// GraceSeconds keeps the replaced secret working while callers switch over;
+	// defaults to a day, and 0 retires it at once when given explicitly
+	GraceSeconds *int64 `json:"grace_seconds,omitempty"`
+}
+
+// apiKeySecret is the hash of one of a key's secrets. A key has two during a rotation
+// grace period.
+type apiKeySecret struct {
+	hash      [sha256.Size]byte
+	expiresAt time.Time // zero for the current secret
+}
+
+type storedAPIKey struct {
+	APIKey
+	secrets []apiKeySecret
+}
+
+// APIKeyStore holds API keys by ID
+type APIKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]*storedAPIKey
+	now  func() time.Time
+}
+
+// NewAPIKeyStore creates an empty store
+func NewAPIKeyStore() *APIKeyStore {
+	return &APIKeyStore{keys: make(map[string]*storedAPIKey), now: time.Now}
+}
+
+// apiKeyStore holds the service's API keys
+var apiKeyStore = NewAPIKeyStore()
+
+// ProvisionedAPIKey is an entry of API_KEYS_FILE: a key whose secret was generated
+// elsewhere, given by the hex SHA-256 of its secret part. Every replica loading the
+// file accepts the same keys.
+type ProvisionedAPIKey struct {
+	ID           string     `json:"id"`
+	Name         string     `json:"name"`
+	Owner        string     `json:"owner"`
+	Role         string     `json:"role,omitempty"`
+	Scopes       []string   `json:"scopes"`
+	SecretSHA256 string     `json:"secret_sha256"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+}
+
+var apiKeyIDPattern = regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+// Load adds provisioned keys to the store
+func (s *APIKeyStore) Load(keys []ProvisionedAPIKey) error {
+	loaded := make(map[string]*storedAPIKey, len(keys))
+	for _, p := range keys {
+		if !apiKeyIDPattern.MatchString(p.ID) {
+			return fmt.Errorf("API key %q: id must be 16 lowercase hex digits", p.ID)
+		}
+		if _, dup := loaded[p.ID]; dup {
+			return fmt.Errorf("API key %q is listed twice", p.ID)
+		}
+		if err := validateAPIKeyBinding(p.Name, p.Owner, p.Scopes); err != nil {
+			return fmt.Errorf("API key %q: %w", p.ID, err)
+		}
+		hash, err := hex.DecodeString(p.SecretSHA256)
+		if err != nil || len(hash) != sha256.Size {
+			return fmt.Errorf("API key %q: secret_sha256 must be a hex SHA-256 digest", p.ID)
+		}
+		if p.Role == "" {
+			p.Role = "service"
+		}
+		k := &storedAPIKey{APIKey: APIKey{
+			ID:        p.ID,
+			Name:      p.Name,
+			Owner:     p.Owner,
+			Role:      p.Role,
+			Scopes:    append([]string{}, p.Scopes...),
+			CreatedAt: s.now().UTC(),
+			ExpiresAt: p.ExpiresAt,
+		}}
+		k.secrets = []apiKeySecret{{}}
+		copy(k.secrets[0].hash[:], hash)
+		loaded[p.ID] = k
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, k := range loaded {
+		s.keys[id] = k
+	}
+	return nil
+}
+
+// configureAPIKeys loads API_KEYS_FILE, a JSON array of provisioned keys
+func configureAPIKeys() error {
+	file := config.GetEnv("API_KEYS_FILE", "")
+	if file == "" {
+		return nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var keys []ProvisionedAPIKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	if err := apiKeyStore.Load(keys); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	logger.Info().Str("file", file).Int("keys", len(keys)).Msg("API keys loaded")
+	return nil
+}
+
+// validateAPIKeyBinding checks what a key identifies and may do
+func validateAPIKeyBinding(name, owner string, scopes []string) error {
+	if !apiKeyNamePattern.MatchString(name) {
+		return errors.New("name must be 1-64 lowercase letters, digits, '.', '_' or '-'")
+	}
+	if owner == "" {
+		return errors.New("owner is required")
+	}
+	if len(scopes) == 0 {
+		return errors.New("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !isPlatformScope(scope) {
+			return fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+	return nil
+}
+
+// newAPIKeySecret returns a fresh key for id and the hash stored for it
+func newAPIKeySecret(id string) (string, [sha256.Size]byte, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", [sha256.Size]byte{}, err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(secret)
+	return apiKeyPrefix + id + "_" + encoded, sha256.Sum256([]byte(encoded)), nil
+}
+
+// parseAPIKey splits a key into its ID and secret
+func parseAPIKey(key string) (id, secret string, ok bool) {
+	rest, found := strings.CutPrefix(key, apiKeyPrefix)
+	if !found {
+		return "", "", false
+	}
+	id, secret, found = strings.Cut(rest, "_")
+	return id, secret, found && apiKeyIDPattern.MatchString(id) && secret != ""
+}
+
+// Create issues a key bound to the request's role and scopes
+func (s *APIKeyStore) Create(req CreateAPIKeyRequest) (IssuedAPIKey, error) {
+	if err := validateAPIKeyBinding(req.Name, req.Owner, req.Scopes); err != nil {
+		return IssuedAPIKey{}, err
+	}
+	if req.ExpiresInSeconds < 0 || time.Duration(req.ExpiresInSeconds)*time.Second > maxAPIKeyTTL {
+		return IssuedAPIKey{}, fmt.Errorf("expires_in_seconds must be between 0 and %d", int64(maxAPIKeyTTL.Seconds()))
+	}
+	if req.Role == "" {
+		req.Role = "service"
+	}
+
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		return IssuedAPIKey{}, err
+	}
+	id := hex.EncodeToString(idBytes)
+	key, hash, err := newAPIKeySecret(id)
+	if err != nil {
+		return IssuedAPIKey{}, err
+	}
+	now := s.now().UTC()
+	stored := &storedAPIKey{
+		APIKey: APIKey{
+			ID:        id,
+			Name:      req.Name,
+			Owner:     req.Owner,
+			Role:      req.Role,
+			Scopes:    append([]string{}, req.Scopes...),
+			CreatedAt: now,
+		},
+		secrets: []apiKeySecret{{hash: hash}},
+	}
+	if req.ExpiresInSeconds > 0 {
+		expires := now.Add(time.Duration(req.ExpiresInSeconds) * time.Second)
+		stored.ExpiresAt = &expires
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[id] = stored
+	return IssuedAPIKey{APIKey: stored.APIKey, Key: key}, nil
+}
+
+// List returns every key, revoked ones included, by creation time
+func (s *APIKeyStore) List() []APIKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]APIKey, 0, len(s.keys))
+	for _, k := range s.keys {
+		out = append(out, k.APIKey)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].ID < out[j].ID
+		}
+		return out[i].CreatedAt.Before(out[j].CreatedAt)
+	})
+	return out
+}
+
+// Get returns one key
+func (s *APIKeyStore) Get(id string) (APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	k, ok := s.keys[id]
+	if !ok {
+		return APIKey{}, errAPIKeyNotFound
+	}
+	return k.APIKey, nil
+}
+
+// Rotate issues a new secret for a key. The previous secret keeps working for grace,
+// and any older one stops at once.
+func (s *APIKeyStore) Rotate(id string, grace time.Duration) (IssuedAPIKey, error) {
+	if grace < 0 || grace > maxAPIKeyRotateGrace {
+		return IssuedAPIKey{}, fmt.Errorf("grace_seconds must be between 0 and %d", int64(maxAPIKeyRotateGrace.Seconds()))
+	}
+	key, hash, err := newAPIKeySecret(id)
+	if err != nil {
+		return IssuedAPIKey{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.keys[id]
+	if !ok {
+		return IssuedAPIKey{}, errAPIKeyNotFound
+	}
+	if k.RevokedAt != nil {
+		return IssuedAPIKey{}, errAPIKeyRevoked
+	}
+	now := s.now().UTC()
+	current := k.secrets[len(k.secrets)-1]
+	k.secrets = []apiKeySecret{{hash: hash}}
+	k.PreviousExpiresAt = nil
+	if grace > 0 {
+		current.expiresAt = now.Add(grace)
+		k.secrets = append([]apiKeySecret{current}, k.secrets...)
+		k.PreviousExpiresAt = &current.expiresAt
+	}
+	k.RotatedAt = &now
+	return IssuedAPIKey{APIKey: k.APIKey, Key: key}, nil
+}
+
+// Revoke disables a key and every secret it has. Revoked keys stay listed.
+func (s *APIKeyStore) Revoke(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.keys[id]
+	if !ok {
+		return errAPIKeyNotFound
+	}
+	if k.RevokedAt == nil {
+		now := s.now().UTC()
+		k.RevokedAt = &now
+		k.secrets = nil
+		k.PreviousExpiresAt = nil
+	}
+	return nil
+}
+
+// Verify returns the key a presented secret belongs to, or errAPIKeyInvalid for
+// unknown, wrong, retired, expired and revoked keys alike
+func (s *APIKeyStore) Verify(presented string) (APIKey, error) {
+	id, secret, ok := parseAPIKey(presented)
+	if !ok {
+		return APIKey{}, errAPIKeyInvalid
+	}
+	hash := sha256.Sum256([]byte(secret))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.keys[id]
+	if !ok || k.RevokedAt != nil {
+		return APIKey{}, errAPIKeyInvalid
+	}
+	now := s.now().UTC()
+	if k.ExpiresAt != nil && !now.Before(*k.ExpiresAt) {
+		return APIKey{}, errAPIKeyInvalid
+	}
+	matched := false
+	for _, candidate := range k.secrets {
+		if subtle.ConstantTimeCompare(candidate.hash[:], hash[:]) == 1 &&
+			(candidate.expiresAt.IsZero() || now.Before(candidate.expiresAt)) {
+			matched = true
+		}
+	}
+	if !matched {
+		return APIKey{}, errAPIKeyInvalid
+	}
+	k.LastUsedAt = &now
+	return k.APIKey, nil
+}
+
+// presentedAPIKey reads the key from X-API-Key, or from an "ApiKey" Authorization header
+func presentedAPIKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "ApiKey "); ok {
+		return key
+	}
+	return ""
+}
+
+// APIKeyIntrospectResponse is an API key introspection result. Active keys carry the
+// owner as user_id, so services treat them like token subjects.
+type APIKeyIntrospectResponse struct {
+	Active    bool     `json:"active"`
+	KeyID     string   `json:"key_id,omitempty"`
+	Name      string   `json:"name,omitempty"`
+	UserID    string   `json:"user_id,omitempty"`
+	Role      string   `json:"role,omitempty"`
+	Scopes    []string `json:"scopes,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+}
+
+// IntrospectAPIKey handles /apikey/introspect: whether the API key the caller forwards
+// in X-API-Key is valid, and what it may do. It is a map lookup and one hash, cheap
+// enough for services to call per request. Calling services should forward their
+// client's address in X-Forwarded-For, since failures count towards the IP's lockout.
+func (h AuthHandler) IntrospectAPIKey(w http.ResponseWriter, r *http.Request) {
+	SecurityHeaders(w, r)
+	_, span := tracer.Start(r.Context(), "validate_api_key")
+	defer span.End()
+
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if err := checkLockout(r, "", false); err != nil {
+		apiKeyIntrospections.WithLabelValues("locked_out").Inc()
+		recordTokenEvent(r, TokenAuditEvent{Event: TokenEventAPIKeyIntrospected, Result: TokenResultLockedOut})
+		writeLockoutError(w, err)
+		return
+	}
+	presented := presentedAPIKey(r)
+	if presented == "" {
+		apiKeyIntrospections.WithLabelValues("missing").Inc()
+		recordTokenEvent(r, TokenAuditEvent{Event: TokenEventAPIKeyIntrospected, Result: TokenResultMissing})
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(APIKeyIntrospectResponse{Active: false})
+		return
+	}
+	key, err := apiKeyStore.Verify(presented)
+	if err != nil {
+		apiKeyIntrospections.WithLabelValues("invalid").Inc()
+		recordSecurityEvent(r, "api_key_invalid", "warning", "")
+		recordAuthFailure(r, "")
+		logger.Warn().Str("client_ip", clientIP(r)).Msg("API key validation failed")
+		keyID, _, _ := parseAPIKey(presented)
+		if !apiKeyIDPattern.MatchString(keyID) {
+			keyID = ""
+		}
+		recordTokenEvent(r, TokenAuditEvent{Event: TokenEventAPIKeyIntrospected, KeyID: keyID, Result: TokenResultInvalid})
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(APIKeyIntrospectResponse{Active: false})
+		return
+	}
+
+	apiKeyIntrospections.WithLabelValues("valid").Inc()
+	recordTokenEvent(r, TokenAuditEvent{Event: TokenEventAPIKeyIntrospected, UserID: key.Owner, Role: key.Role, Scopes: key.Scopes, KeyID: key.ID, Result: TokenResultSuccess})
+	span.SetAttributes(
+		attribute.String("api_key.id", key.ID),
+		attribute.String("user.id", key.Owner),
+		attribute.StringSlice("user.scopes", key.Scopes),
+	)
+	response := APIKeyIntrospectResponse{
+		Active: true,
+		KeyID:  key.ID,
+		Name:   key.Name,
+		UserID: key.Owner,
+		Role:   key.Role,
+		Scopes: key.Scopes,
+	}
+	if key.ExpiresAt != nil {
+		response.ExpiresAt = key.ExpiresAt.Unix()
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// ListAPIKeys handles GET /api/v1/apikeys
+func (h AuthHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys := apiKeyStore.List()
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"api_keys": keys, "count": len(keys)})
+}
+
+// GetAPIKey handles GET /api/v1/apikeys/{id}
+func (h AuthHandler) GetAPIKey(w http.ResponseWriter, r *http.Request) {
+	key, err := apiKeyStore.Get(r.PathValue("id"))
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(key)
+}
+
+// CreateAPIKey handles POST /api/v1/apikeys. The response is the only time the key is
+// shown.
+func (h AuthHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req CreateAPIKeyRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPolicyBody)).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	issued, err := apiKeyStore.Create(req)
+	if err != nil {
+		writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	recordSecurityEvent(r, "api_key_created", "info", issued.Owner)
+	logger.Info().Str("key_id", issued.ID).Str("name", issued.Name).Str("owner", issued.Owner).Strs("scopes", issued.Scopes).Msg("API key created")
+	audit.SetResource(r.Context(), "/api/v1/apikeys/"+issued.ID)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(issued)
+}
+
+// RotateAPIKey handles POST /api/v1/apikeys/{id}/rotate
+func (h AuthHandler) RotateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req RotateAPIKeyRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPolicyBody)).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+	grace := defaultAPIKeyGrace
+	if req.GraceSeconds != nil {
+		grace = time.Duration(*req.GraceSeconds) * time.Second
+	}
+	issued, err := apiKeyStore.Rotate(r.PathValue("id"), grace)
+	switch {
+	case errors.Is(err, errAPIKeyNotFound):
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	case errors.Is(err, errAPIKeyRevoked):
+		writeJSONError(w, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	recordSecurityEvent(r, "api_key_rotated", "info", "")
+	logger.Info().Str("key_id", issued.ID).Dur("grace", grace).Msg("API key rotated")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(issued)
+}
+
+// RevokeAPIKey handles DELETE /api/v1/apikeys/{id}
+func (h AuthHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := apiKeyStore.Revoke(id); err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	recordSecurityEvent(r, "api_key_revoked", "info", "")
+	logger.Info().Str("key_id", id).Msg("API key revoked")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/healthcare-gitops/common/clientip"
+	"github.com/healthcare-gitops/common/middleware"
+)
+
+// useAPIKeyStore gives the test an empty key store on a controllable clock
+func useAPIKeyStore(t *testing.T) (*APIKeyStore, *time.Time) {
+	t.Helper()
+	previous := apiKeyStore
+	now := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	apiKeyStore = NewAPIKeyStore()
+	apiKeyStore.now = func() time.Time { return now }
+	t.Cleanup(func() { apiKeyStore = previous })
+	return apiKeyStore, &now
+}
+
+// TestAPIKeyLifecycle verifies keys verify until they expire, rotation keeps the old
+// secret for its grace period only, and revocation disables every secret
+func TestAPIKeyLifecycle(t *testing.T) {
+	store, now := useAPIKeyStore(t)
+
+	invalid := []CreateAPIKeyRequest{
+		{Name: "Gateway 1", Owner: "icu-gateway", Scopes: []string{"phi:write"}},
+		{Name: "gw-1", Scopes: []string{"phi:write"}},
+		{Name: "gw-1", Owner: "icu-gateway"},
+		{Name: "gw-1", Owner: "icu-gateway", Scopes: []string{"phi:delete"}},
+		{Name: "gw-1", Owner: "icu-gateway", Scopes: []string{"phi:write"}, ExpiresInSeconds: 400 * 24 * 3600},
+	}
+	for _, req := range invalid {
+		if _, err := store.Create(req); err == nil {
+			t.Errorf("expected %+v to be refused", req)
+		}
+	}
+
+	issued, err := store.Create(CreateAPIKeyRequest{Name: "gw-1", Owner: "icu-gateway", Scopes: []string{"phi:write"}, ExpiresInSeconds: 30 * 24 * 3600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(issued.Key, apiKeyPrefix+issued.ID+"_") || issued.Role != "service" {
+		t.Fatalf("unexpected key: %+v", issued)
+	}
+	key, err := store.Verify(issued.Key)
+	if err != nil || key.Owner != "icu-gateway" || key.LastUsedAt == nil {
+		t.Fatalf("expected key to verify, got %+v %v", key, err)
+	}
+	for _, wrong := range []string{"", "hck_", issued.Key + "x", strings.Replace(issued.Key, issued.ID, "0000000000000000", 1)} {
+		if _, err := store.Verify(wrong); err != errAPIKeyInvalid {
+			t.Errorf("expected %q to be invalid, got %v", wrong, err)
+		}
+	}
+
+	rotated, err := store.Rotate(issued.ID, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.ID != issued.ID || rotated.Key == issued.Key || rotated.PreviousExpiresAt == nil {
+		t.Fatalf("unexpected rotation: %+v", rotated)
+	}
+	if _, err := store.Verify(issued.Key); err != nil {
+		t.Fatalf("expected the old secret to work during the grace period, got %v", err)
+	}
+	*now = now.Add(time.Hour)
+	if _, err := store.Verify(issued.Key); err != errAPIKeyInvalid {
+		t.Fatalf("expected the old secret to stop after the grace period, got %v", err)
+	}
+	if _, err := store.Verify(rotated.Key); err != nil {
+		t.Fatal(err)
+	}
+
+	// A second rotation without grace retires the current secret at once
+	again, err := store.Rotate(issued.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Verify(rotated.Key); err != errAPIKeyInvalid {
+		t.Fatalf("expected the replaced secret to stop, got %v", err)
+	}
+
+	*now = now.Add(30 * 24 * time.Hour)
+	if _, err := store.Verify(again.Key); err != errAPIKeyInvalid {
+		t.Fatalf("expected the key to expire, got %v", err)
+	}
+
+	other, _ := store.Create(CreateAPIKeyRequest{Name: "gw-2", Owner: "er-gateway", Scopes: []string{"phi:write"}})
+	if err := store.Revoke(other.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Verify(other.Key); err != errAPIKeyInvalid {
+		t.Fatalf("expected a revoked key to be invalid, got %v", err)
+	}
+	if _, err := store.Rotate(other.ID, 0); err != errAPIKeyRevoked {
+		t.Fatalf("expected rotating a revoked key to fail, got %v", err)
+	}
+	if keys := store.List(); len(keys) != 2 || keys[1].RevokedAt == nil {
+		t.Fatalf("expected both keys listed, the second revoked, got %+v", keys)
+	}
+}
+
+// TestAPIKeyLoad verifies provisioned keys verify by their secret's hash and that a
+// malformed file is refused whole
+func TestAPIKeyLoad(t *testing.T) {
+	store, _ := useAPIKeyStore(t)
+	sum := sha256.Sum256([]byte("provisioned-secret"))
+	key := ProvisionedAPIKey{ID: "00112233aabbccdd", Name: "gw-3", Owner: "lab-gateway", Scopes: []string{"phi:read"}, SecretSHA256: hex.EncodeToString(sum[:])}
+
+	bad := key
+	bad.SecretSHA256 = "abc"
+	if err := store.Load([]ProvisionedAPIKey{key, bad}); err == nil || len(store.List()) != 0 {
+		t.Fatalf("expected the file to be refused, got %v", err)
+	}
+	if err := store.Load([]ProvisionedAPIKey{key}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Verify("hck_00112233aabbccdd_provisioned-secret")
+	if err != nil || got.Owner != "lab-gateway" || got.Role != "service" {
+		t.Fatalf("expected the provisioned key to verify, got %+v %v", got, err)
+	}
+	if _, err := store.Verify("hck_00112233aabbccdd_other"); err != errAPIKeyInvalid {
+		t.Fatalf("expected a wrong secret to be invalid, got %v", err)
+	}
+}
+
+// TestAPIKeyEndpoints verifies management requires admin and that a key works through
+// the introspection path and the shared middleware until it is revoked
+func TestAPIKeyEndpoints(t *testing.T) {
+	useAPIKeyStore(t)
+	useLoginGuard(t, LockoutConfig{Threshold: 5, IPThreshold: 3, Window: time.Hour, Duration: time.Minute, MaxDuration: time.Hour, BackoffBase: 0})
+	admin := testToken(t, "root", "admin", "admin")
+
+	if rr := serve(t, http.MethodPost, "/api/v1/apikeys", testToken(t, "u1", "user", "phi:read"), `{}`); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for non-admin, got %d", rr.Code)
+	}
+	if rr := serve(t, http.MethodPost, "/api/v1/apikeys", admin, `{"name":"gw-1","owner":"icu-gateway","scopes":["bogus"]}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for unknown scope, got %d", rr.Code)
+	}
+	rr := serve(t, http.MethodPost, "/api/v1/apikeys", admin, `{"name":"gw-1","owner":"icu-gateway","scopes":["phi:write"]}`)
+	if rr.Code != http.StatusCreated || rr.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("expected 201 with no-store, got %d: %s", rr.Code, rr.Body)
+	}
+	var issued IssuedAPIKey
+	if err := json.Unmarshal(rr.Body.Bytes(), &issued); err != nil {
+		t.Fatal(err)
+	}
+	if rr := serve(t, http.MethodGet, "/api/v1/apikeys/"+issued.ID, admin, ""); rr.Code != http.StatusOK || strings.Contains(rr.Body.String(), issued.Key) {
+		t.Fatalf("expected the key without its secret, got %d: %s", rr.Code, rr.Body)
+	}
+
+	// A service protects a route with the shared middleware, and auth-service trusts
+	// it to name its callers
+	previousProxies := trustedProxies
+	t.Cleanup(func() { trustedProxies = previousProxies })
+	var err error
+	if trustedProxies, err = clientip.Parse([]string{"127.0.0.1", "::1"}); err != nil {
+		t.Fatal(err)
+	}
+	auth := httptest.NewServer(StartAuthServer(":0").Handler)
+	defer auth.Close()
+	protected := middleware.APIKeyAuth(middleware.APIKeyConfig{IntrospectURL: auth.URL + apiKeyIntrospectPath, Scope: "phi:write", CacheTTL: time.Nanosecond})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, _ := middleware.APIKeyFromContext(r.Context())
+			w.Write([]byte(id.UserID))
+		}))
+	call := func(key, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/readings", nil)
+		req.RemoteAddr = ip + ":5000"
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		rr := httptest.NewRecorder()
+		protected.ServeHTTP(rr, req)
+		return rr
+	}
+	if rr := call(issued.Key, "10.0.0.1"); rr.Code != http.StatusOK || rr.Body.String() != "icu-gateway" {
+		t.Fatalf("expected the key to be accepted, got %d: %s", rr.Code, rr.Body)
+	}
+	if rr := call("", "10.0.0.1"); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without a key, got %d", rr.Code)
+	}
+
+	// Guessing keys locks the guessing IP out, not other callers
+	for i := 0; i < 3; i++ {
+		if rr := call(apiKeyPrefix+issued.ID+"_guess", "10.0.0.9"); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("expected 401 for a wrong secret, got %d", rr.Code)
+		}
+	}
+	if rr := call(issued.Key, "10.0.0.9"); rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the guessing IP to be locked out, got %d", rr.Code)
+	}
+	if rr := call(issued.Key, "10.0.0.1"); rr.Code != http.StatusOK {
+		t.Fatalf("expected other IPs to be unaffected, got %d", rr.Code)
+	}
+
+	if rr := serve(t, http.MethodPost, "/api/v1/apikeys/"+issued.ID+"/rotate", admin, `{"grace_seconds":0}`); rr.Code != http.StatusOK {
+		t.Fatalf("expected rotation, got %d: %s", rr.Code, rr.Body)
+	}
+	if rr := call(issued.Key, "10.0.0.1"); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the rotated-out key to be refused, got %d", rr.Code)
+	}
+	if rr := serve(t, http.MethodDelete, "/api/v1/apikeys/"+issued.ID, admin, ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 from revoke, got %d", rr.Code)
+	}
+	if rr := serve(t, http.MethodPost, "/api/v1/apikeys/"+issued.ID+"/rotate", admin, ""); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 rotating a revoked key, got %d", rr.Code)
+	}
+}
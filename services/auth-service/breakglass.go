@@ -0,0 +1,525 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/healthcare-gitops/common/audit"
+	"github.com/healthcare-gitops/common/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// breakGlassPath is where clinicians request emergency access
+const breakGlassPath = "/api/v1/break-glass"
+
+// breakGlassScope is the scope a break-glass token adds to its holder's own
+const breakGlassScope = "phi:read"
+
+// Break-glass limits
+const (
+	minBreakGlassReason     = 20
+	maxBreakGlassReason     = 1000
+	breakGlassSweepInterval = 30 * time.Second
+)
+
+// Break-glass grant states
+const (
+	BreakGlassActive  = "active"
+	BreakGlassExpired = "expired"
+	BreakGlassRevoked = "revoked"
+)
+
+var (
+	errBreakGlassNotFound  = errors.New("break-glass grant not found")
+	errBreakGlassEnded     = errors.New("break-glass grant has ended")
+	errBreakGlassActive    = errors.New("an emergency access grant is already active for this user")
+	errBreakGlassForbidden = errors.New("role may not request emergency access")
+	errBreakGlassChained   = errors.New("break-glass tokens cannot request further emergency access")
+)
+
+var breakGlassEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "auth_break_glass_events_total",
+	Help: "Break-glass grants by event",
+}, []string{"event"})
+
+// BreakGlassConfig tunes emergency access. Users whose role is in Roles may grant
+// themselves phi:read for DefaultDuration, or any duration up to MaxDuration, by
+// stating a reason. Every grant, revocation and expiry is posted to WebhookURL.
+type BreakGlassConfig struct {
+	Roles           []string
+	DefaultDuration time.Duration
+	MaxDuration     time.Duration
+	WebhookURL      string
+}
+
+var defaultBreakGlassConfig = BreakGlassConfig{
+	Roles:           []string{"clinician", "physician", "nurse"},
+	DefaultDuration: 30 * time.Minute,
+	MaxDuration:     time.Hour,
+}
+
+// Validate checks the settings are usable together
+func (c BreakGlassConfig) Validate() error {
+	switch {
+	case len(c.Roles) == 0:
+		return errors.New("at least one role must be allowed emergency access")
+	case c.DefaultDuration <= 0 || c.MaxDuration <= 0:
+		return errors.New("break-glass durations must be positive")
+	case c.DefaultDuration > c.MaxDuration:
+		return errors.New("default break-glass duration must not exceed the maximum")
+	}
+	return nil
+}
+
+// BreakGlassGrant is one emergency access grant. Grants stay listed after they end,
+// for review.
+type BreakGlassGrant struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"user_id"`
+	Role      string     `json:"role"`
+	Scopes    []string   `json:"scopes"`
+	Reason    string     `json:"reason"`
+	SourceIP  string     `json:"source_ip,omitempty"`
+	Status    string     `json:"status"`
+	GrantedAt time.Time  `json:"granted_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+	RevokedBy string     `json:"revoked_by,omitempty"`
+}
+
+// BreakGlassRequest is the body of POST /api/v1/break-glass
+type BreakGlassRequest struct {
+	Reason string `json:"reason"`
+	// DurationSeconds defaults to the configured default duration
+	DurationSeconds int64 `json:"duration_seconds,omitempty"`
+}
+
+// BreakGlassStore makes and ends grants under its settings, keeping them in grants
+type BreakGlassStore struct {
+	cfg    BreakGlassConfig
+	grants BreakGlassGrants
+	now    func() time.Time
+}
+
+// NewBreakGlassStore creates a store keeping its grants in grants
+func NewBreakGlassStore(cfg BreakGlassConfig, grants BreakGlassGrants) *BreakGlassStore {
+	return &BreakGlassStore{cfg: cfg, grants: grants, now: time.Now}
+}
+
+// Config returns the store's settings
+func (s *BreakGlassStore) Config() BreakGlassConfig {
+	return s.cfg
+}
+
+// breakGlass holds the running service's grants
+var breakGlass = NewBreakGlassStore(defaultBreakGlassConfig, NewMemoryBreakGlassGrants())
+
+// configureBreakGlass reads BREAK_GLASS_ROLES, BREAK_GLASS_DEFAULT_DURATION,
+// BREAK_GLASS_MAX_DURATION, BREAK_GLASS_ALERT_WEBHOOK_URL, which defaults to
+// SOC_ALERT_WEBHOOK_URL, and BREAK_GLASS_REDIS_URL, where the grants are shared by
+// all replicas; durations are Go duration strings
+func configureBreakGlass() error {
+	cfg := defaultBreakGlassConfig
+	cfg.Roles = config.GetEnvList("BREAK_GLASS_ROLES", cfg.Roles)
+	cfg.WebhookURL = config.GetEnv("BREAK_GLASS_ALERT_WEBHOOK_URL", config.GetEnv("SOC_ALERT_WEBHOOK_URL", ""))
+	for _, setting := range []struct {
+		env   string
+		value *time.Duration
+	}{
+		{"BREAK_GLASS_DEFAULT_DURATION", &cfg.DefaultDuration},
+		{"BREAK_GLASS_MAX_DURATION", &cfg.MaxDuration},
+	} {
+		raw := config.GetEnv(setting.env, "")
+		if raw == "" {
+			continue
+		}
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %w", setting.env, err)
+		}
+		*setting.value = d
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	grants := NewMemoryBreakGlassGrants()
+	redisURL := config.GetEnv("BREAK_GLASS_REDIS_URL", "")
+	if redisURL != "" {
+		shared, err := NewRedisBreakGlassGrants(redisURL)
+		if err != nil {
+			return fmt.Errorf("BREAK_GLASS_REDIS_URL: %w", err)
+		}
+		grants = shared
+	} else {
+		logger.Warn().Msg("BREAK_GLASS_REDIS_URL not set, break-glass grants are kept per replica")
+	}
+	breakGlass = NewBreakGlassStore(cfg, grants)
+	logger.Info().
+		Strs("roles", cfg.Roles).
+		Dur("default_duration", cfg.DefaultDuration).
+		Dur("max_duration", cfg.MaxDuration).
+		Bool("alert_webhook", cfg.WebhookURL != "").
+		Bool("shared", redisURL != "").
+		Msg("Break-glass access configured")
+	return nil
+}
+
+// Grant gives the token holder phi:read for the requested duration. A user holds at
+// most one active grant, and break-glass tokens cannot be used to extend themselves.
+func (s *BreakGlassStore) Grant(ctx context.Context, claims *TokenClaims, req BreakGlassRequest, ip string) (BreakGlassGrant, error) {
+	if claims.BreakGlass != "" {
+		return BreakGlassGrant{}, errBreakGlassChained
+	}
+	if !contains(s.cfg.Roles, claims.Role) {
+		return BreakGlassGrant{}, errBreakGlassForbidden
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if len(reason) < minBreakGlassReason || len(reason) > maxBreakGlassReason {
+		return BreakGlassGrant{}, fmt.Errorf("reason must be %d-%d characters", minBreakGlassReason, maxBreakGlassReason)
+	}
+	duration := s.cfg.DefaultDuration
+	if req.DurationSeconds != 0 {
+		duration = time.Duration(req.DurationSeconds) * time.Second
+	}
+	if duration <= 0 || duration > s.cfg.MaxDuration {
+		return BreakGlassGrant{}, fmt.Errorf("duration_seconds must be between 1 and %d", int64(s.cfg.MaxDuration.Seconds()))
+	}
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		return BreakGlassGrant{}, err
+	}
+	scopes := append([]string{}, claims.Scopes...)
+	if !contains(scopes, breakGlassScope) {
+		scopes = append(scopes, breakGlassScope)
+	}
+
+	now := s.now().UTC()
+	grant := BreakGlassGrant{
+		ID:        "bg_" + hex.EncodeToString(idBytes),
+		UserID:    claims.UserID,
+		Role:      claims.Role,
+		Scopes:    scopes,
+		Reason:    reason,
+		SourceIP:  ip,
+		Status:    BreakGlassActive,
+		GrantedAt: now,
+		// Whole seconds, as the token's exp is
+		ExpiresAt: now.Add(duration).Truncate(time.Second),
+	}
+	if err := s.grants.Add(ctx, grant, now); err != nil {
+		return BreakGlassGrant{}, err
+	}
+	return grant, nil
+}
+
+// Revoke ends an active grant early
+func (s *BreakGlassStore) Revoke(ctx context.Context, id, by string) (BreakGlassGrant, error) {
+	return s.grants.Revoke(ctx, id, by, s.now().UTC())
+}
+
+// Expire ends the active grants whose time is up and returns them
+func (s *BreakGlassStore) Expire(ctx context.Context) ([]BreakGlassGrant, error) {
+	return s.grants.Expire(ctx, s.now().UTC())
+}
+
+// Ended reports whether a grant has been revoked or has expired. Grants the store does
+// not know, made before it was shared, end with their tokens.
+func (s *BreakGlassStore) Ended(ctx context.Context, id string) (bool, error) {
+	g, err := s.grants.Get(ctx, id)
+	if errors.Is(err, errBreakGlassNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return g.Status != BreakGlassActive || !s.now().Before(g.ExpiresAt), nil
+}
+
+// Get returns one grant
+func (s *BreakGlassStore) Get(ctx context.Context, id string) (BreakGlassGrant, error) {
+	return s.grants.Get(ctx, id)
+}
+
+// List returns every grant, ended ones included, newest first
+func (s *BreakGlassStore) List(ctx context.Context) ([]BreakGlassGrant, error) {
+	return s.grants.List(ctx)
+}
+
+// BreakGlassResponse is a grant with the token issued under it
+type BreakGlassResponse struct {
+	BreakGlassGrant
+	Token     string `json:"token"`
+	TokenType string `json:"token_type"`
+}
+
+// RequestBreakGlass handles POST /api/v1/break-glass: the bearer grants themselves
+// time-boxed phi:read, stating why. The grant is audited as critical and alerted on.
+func (h AuthHandler) RequestBreakGlass(w http.ResponseWriter, r *http.Request) {
+	SecurityHeaders(w, r)
+	claims, err := bearerClaims(r)
+	if writeLockoutError(w, err) {
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusUnauthorized, "Invalid or missing token")
+		return
+	}
+	audit.SetActor(r.Context(), claims.UserID)
+	var req BreakGlassRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPolicyBody)).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	grant, err := breakGlass.Grant(r.Context(), claims, req, clientIP(r))
+	if errors.Is(err, errBreakGlassStore) {
+		logger.Error().Err(err).Str("user_id", claims.UserID).Msg("Break-glass grants unavailable")
+		writeJSONError(w, http.StatusServiceUnavailable, "Emergency access grants are unavailable")
+		return
+	}
+	if err != nil {
+		breakGlassEvents.WithLabelValues("refused").Inc()
+		recordSecurityEvent(r, "break_glass_refused", "warning", claims.UserID)
+		logger.Warn().Err(err).Str("user_id", claims.UserID).Str("role", claims.Role).Msg("Break-glass access refused")
+		switch {
+		case errors.Is(err, errBreakGlassForbidden), errors.Is(err, errBreakGlassChained):
+			writeJSONError(w, http.StatusForbidden, err.Error())
+		case errors.Is(err, errBreakGlassActive):
+			writeJSONError(w, http.StatusConflict, err.Error())
+		default:
+			writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+		}
+		return
+	}
+
+	token := TokenClaims{
+		UserID:     grant.UserID,
+		Scopes:     grant.Scopes,
+		Role:       grant.Role,
+		BreakGlass: grant.ID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        grant.ID,
+			ExpiresAt: jwt.NewNumericDate(grant.ExpiresAt),
+			IssuedAt:  jwt.NewNumericDate(grant.GrantedAt),
+			Issuer:    "auth-service",
+		},
+	}
+	tokenString, err := signToken(token)
+	if err != nil {
+		breakGlass.Revoke(r.Context(), grant.ID, "auth-service")
+		logger.Error().Err(err).Msg("Failed to sign break-glass token")
+		writeJSONError(w, http.StatusInternalServerError, "Token generation failed")
+		return
+	}
+
+	breakGlassEvents.WithLabelValues("granted").Inc()
+	recordSecurityEvent(r, "break_glass_granted", "critical", grant.UserID)
+	emitBreakGlass(r, "granted", grant)
+	notifyBreakGlass("granted", grant)
+	logger.Warn().
+		Str("grant_id", grant.ID).
+		Str("user_id", grant.UserID).
+		Str("role", grant.Role).
+		Time("expires_at", grant.ExpiresAt).
+		Str("reason", grant.Reason).
+		Msg("Break-glass access granted")
+	recordTokenEvent(r, TokenAuditEvent{Event: TokenEventIssued, UserID: grant.UserID, Role: grant.Role, Scopes: grant.Scopes, Issuer: token.Issuer, Result: TokenResultSuccess})
+	streamTokenIssued(r, token)
+	audit.SetResource(r.Context(), breakGlassPath+"/"+grant.ID)
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(BreakGlassResponse{BreakGlassGrant: grant, Token: tokenString, TokenType: "Bearer"})
+}
+
+// ListBreakGlass handles GET /api/v1/break-glass, for review of emergency access
+func (h AuthHandler) ListBreakGlass(w http.ResponseWriter, r *http.Request) {
+	grants, err := breakGlass.List(r.Context())
+	if err != nil {
+		logger.Error().Err(err).Msg("Break-glass grants unavailable")
+		writeJSONError(w, http.StatusServiceUnavailable, "Emergency access grants are unavailable")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"grants": grants, "count": len(grants)})
+}
+
+// RevokeBreakGlass handles DELETE /api/v1/break-glass/{id}. Admins may end any grant
+// early and holders their own; the grant's token is refused from then on.
+func (h AuthHandler) RevokeBreakGlass(w http.ResponseWriter, r *http.Request) {
+	SecurityHeaders(w, r)
+	claims, err := bearerClaims(r)
+	if writeLockoutError(w, err) {
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusUnauthorized, "Invalid or missing token")
+		return
+	}
+	audit.SetActor(r.Context(), claims.UserID)
+	id := r.PathValue("id")
+	grant, err := breakGlass.Get(r.Context(), id)
+	if errors.Is(err, errBreakGlassNotFound) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		logger.Error().Err(err).Str("grant_id", id).Msg("Break-glass grants unavailable")
+		writeJSONError(w, http.StatusServiceUnavailable, "Emergency access grants are unavailable")
+		return
+	}
+	if grant.UserID != claims.UserID && !contains(claims.Scopes, "admin") {
+		recordSecurityEvent(r, "break_glass_revoke_forbidden", "warning", claims.UserID)
+		writeJSONError(w, http.StatusForbidden, "admin scope required")
+		return
+	}
+	grant, err = breakGlass.Revoke(r.Context(), id, claims.UserID)
+	if errors.Is(err, errBreakGlassStore) {
+		logger.Error().Err(err).Str("grant_id", id).Msg("Break-glass grants unavailable")
+		writeJSONError(w, http.StatusServiceUnavailable, "Emergency access grants are unavailable")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusConflict, err.Error())
+		return
+	}
+	breakGlassEvents.WithLabelValues("revoked").Inc()
+	recordSecurityEvent(r, "break_glass_revoked", "warning", grant.UserID)
+	emitBreakGlass(r, "revoked", grant)
+	notifyBreakGlass("revoked", grant)
+	logger.Warn().Str("grant_id", grant.ID).Str("user_id", grant.UserID).Str("revoked_by", claims.UserID).Msg("Break-glass access revoked")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sweepBreakGlass expires grants whose time is up, so their end is audited and
+// alerted on as it happens rather than when someone next looks. Replicas sharing
+// grants each sweep, and each expiry is reported by the one that ends it.
+func sweepBreakGlass(ctx context.Context) {
+	expired, err := breakGlass.Expire(ctx)
+	if err != nil {
+		logger.Error().Err(err).Msg("Break-glass grants not swept")
+	}
+	for _, grant := range expired {
+		breakGlassEvents.WithLabelValues("expired").Inc()
+		recordSecurityEvent(nil, "break_glass_expired", "warning", grant.UserID)
+		emitBreakGlass(nil, "expired", grant)
+		notifyBreakGlass("expired", grant)
+		logger.Info().Str("grant_id", grant.ID).Str("user_id", grant.UserID).Msg("Break-glass access expired")
+	}
+}
+
+// runBreakGlassSweeper sweeps expired grants until ctx ends
+func runBreakGlassSweeper(ctx context.Context) {
+	ticker := time.NewTicker(breakGlassSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sweepBreakGlass(ctx)
+		}
+	}
+}
+
+// emitBreakGlass emits a grant's change to the audit bus, marked critical so reviews
+// and alerting rules can pick emergency access out. r is nil for expiries.
+func emitBreakGlass(r *http.Request, event string, grant BreakGlassGrant) {
+	ctx, actor, sourceIP := context.Background(), grant.UserID, grant.SourceIP
+	if r != nil {
+		ctx, sourceIP = r.Context(), clientIP(r)
+		if grant.RevokedBy != "" {
+			actor = grant.RevokedBy
+		}
+	}
+	auditEvents.Emit(ctx, audit.Event{
+		Actor:    actor,
+		Action:   "auth.break_glass_" + event,
+		Resource: breakGlassPath + "/" + grant.ID,
+		Outcome:  audit.OutcomeSuccess,
+		SourceIP: sourceIP,
+		Details: map[string]string{
+			"severity":   "critical",
+			"user_id":    grant.UserID,
+			"reason":     grant.Reason,
+			"scopes":     strings.Join(grant.Scopes, " "),
+			"expires_at": grant.ExpiresAt.Format(time.RFC3339),
+		},
+	})
+}
+
+// BreakGlassAlert is what the alert webhook receives for every grant, revocation and
+// expiry
+type BreakGlassAlert struct {
+	Event    string          `json:"event"`
+	Service  string          `json:"service"`
+	Severity string          `json:"severity"`
+	At       time.Time       `json:"at"`
+	Grant    BreakGlassGrant `json:"grant"`
+}
+
+var (
+	breakGlassAlertClient = &http.Client{Timeout: 10 * time.Second}
+	// breakGlassAlertsPending counts alerts still being posted, so shutdown can wait
+	// for them
+	breakGlassAlertsPending sync.WaitGroup
+)
+
+// notifyBreakGlass posts an alert to the configured webhook in the background
+func notifyBreakGlass(event string, grant BreakGlassGrant) {
+	url := breakGlass.Config().WebhookURL
+	if url == "" {
+		return
+	}
+	alert := BreakGlassAlert{Event: event, Service: "auth-service", Severity: "critical", At: time.Now().UTC(), Grant: grant}
+	breakGlassAlertsPending.Add(1)
+	go func() {
+		defer breakGlassAlertsPending.Done()
+		if err := postBreakGlassAlert(url, alert); err != nil {
+			breakGlassEvents.WithLabelValues("alert_failed").Inc()
+			logger.Error().Err(err).Str("grant_id", grant.ID).Str("event", event).Msg("Break-glass alert not delivered")
+		}
+	}()
+}
+
+func postBreakGlassAlert(url string, alert BreakGlassAlert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	resp, err := breakGlassAlertClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("alert webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// flushBreakGlassAlerts waits for alerts still being posted, until ctx ends
+func flushBreakGlassAlerts(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		breakGlassAlertsPending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("break-glass alerts not delivered: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// errBreakGlassStore is returned when the grants cannot be read or changed
+var errBreakGlassStore = errors.New("break-glass grants unavailable")
+
+// breakGlassRedisTimeout bounds each round trip to the shared grant store
+const breakGlassRedisTimeout = time.Second
+
+// BreakGlassGrants keeps emergency access grants. Every replica must see the same
+// grants for the one-active-grant rule and early revocation to hold, so a service with
+// several replicas keeps them in Redis.
+type BreakGlassGrants interface {
+	// Add records an active grant unless its user already holds one, returning
+	// errBreakGlassActive
+	Add(ctx context.Context, grant BreakGlassGrant, now time.Time) error
+	// Revoke ends an active grant early, returning errBreakGlassEnded for one that has
+	// already ended
+	Revoke(ctx context.Context, id, by string, now time.Time) (BreakGlassGrant, error)
+	// Expire ends the active grants whose time is up and returns them. Each grant is
+	// returned once, by whichever replica ends it.
+	Expire(ctx context.Context, now time.Time) ([]BreakGlassGrant, error)
+	// Get returns one grant, or errBreakGlassNotFound
+	Get(ctx context.Context, id string) (BreakGlassGrant, error)
+	// List returns every grant, ended ones included, newest first
+	List(ctx context.Context) ([]BreakGlassGrant, error)
+}
+
+// memoryBreakGlassGrants keeps grants in the replica's memory, for a single replica
+type memoryBreakGlassGrants struct {
+	mu     sync.Mutex
+	grants map[string]*BreakGlassGrant
+}
+
+// NewMemoryBreakGlassGrants keeps grants in this replica's memory. Other replicas do not
+// see them, so it only suits a service running one replica.
+func NewMemoryBreakGlassGrants() BreakGlassGrants {
+	return &memoryBreakGlassGrants{grants: make(map[string]*BreakGlassGrant)}
+}
+
+func (m *memoryBreakGlassGrants) Add(_ context.Context, grant BreakGlassGrant, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, g := range m.grants {
+		if g.UserID == grant.UserID && g.Status == BreakGlassActive && now.Before(g.ExpiresAt) {
+			return errBreakGlassActive
+		}
+	}
+	m.grants[grant.ID] = &grant
+	return nil
+}
+
+func (m *memoryBreakGlassGrants) Revoke(_ context.Context, id, by string, now time.Time) (BreakGlassGrant, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	g, ok := m.grants[id]
+	if !ok {
+		return BreakGlassGrant{}, errBreakGlassNotFound
+	}
+	if g.Status != BreakGlassActive || !now.Before(g.ExpiresAt) {
+		return BreakGlassGrant{}, errBreakGlassEnded
+	}
+	g.Status, g.EndedAt, g.RevokedBy = BreakGlassRevoked, &now, by
+	return *g, nil
+}
+
+func (m *memoryBreakGlassGrants) Expire(_ context.Context, now time.Time) ([]BreakGlassGrant, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var expired []BreakGlassGrant
+	for _, g := range m.grants {
+		if g.Status == BreakGlassActive && !now.Before(g.ExpiresAt) {
+			ended := g.ExpiresAt
+			g.Status, g.EndedAt = BreakGlassExpired, &ended
+			expired = append(expired, *g)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool { return expired[i].ID < expired[j].ID })
+	return expired, nil
+}
+
+func (m *memoryBreakGlassGrants) Get(_ context.Context, id string) (BreakGlassGrant, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	g, ok := m.grants[id]
+	if !ok {
+		return BreakGlassGrant{}, errBreakGlassNotFound
+	}
+	return *g, nil
+}
+
+func (m *memoryBreakGlassGrants) List(context.Context) ([]BreakGlassGrant, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]BreakGlassGrant, 0, len(m.grants))
+	for _, g := range m.grants {
+		out = append(out, *g)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].GrantedAt.Equal(out[j].GrantedAt) {
+			return out[i].ID > out[j].ID
+		}
+		return out[i].GrantedAt.After(out[j].GrantedAt)
+	})
+	return out, nil
+}
+
+// Redis keys of the shared grants. Each grant is a hash of the grant as made and its
+// status; a user's active grant is named by a key expiring with it, and grants are
+// indexed by when they were made and by when they expire.
+const (
+	breakGlassGrantKey    = "breakglass:grant:"
+	breakGlassActiveKey   = "breakglass:active:"
+	breakGlassGrantedKey  = "breakglass:granted"
+	breakGlassExpiringKey = "breakglass:expiring"
+)
+
+// addGrantScript records a grant unless its user already holds an active one
+var addGrantScript = redis.NewScript(`
+if not redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[6]) then
+  return 0
+end
+redis.call('HSET', KEYS[2], 'grant', ARGV[2], 'status', 'active', 'expires', ARGV[3], 'expires_at', ARGV[4])
+redis.call('ZADD', KEYS[3], ARGV[5], ARGV[1])
+redis.call('ZADD', KEYS[4], ARGV[3], ARGV[1])
+return 1
+`)
+
+// revokeGrantScript ends a grant that is still active, freeing its user to ask again
+var revokeGrantScript = redis.NewScript(`
+local grant = redis.call('HMGET', KEYS[1], 'status', 'expires')
+if not grant[1] then
+  return 'not_found'
+end
+if grant[1] ~= 'active' or tonumber(grant[2]) <= tonumber(ARGV[2]) then
+  return 'ended'
+end
+redis.call('HSET', KEYS[1], 'status', 'revoked', 'ended_at', ARGV[3], 'revoked_by', ARGV[4])
+redis.call('ZREM', KEYS[2], ARGV[1])
+if redis.call('GET', KEYS[3]) == ARGV[1] then
+  redis.call('DEL', KEYS[3])
+end
+return 'revoked'
+`)
+
+// expireGrantsScript ends the active grants whose time is up, returning their IDs
+var expireGrantsScript = redis.NewScript(`
+local expired = {}
+for _, id in ipairs(redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])) do
+  local key = ARGV[2] .. id
+  if redis.call('HGET', key, 'status') == 'active' then
+    redis.call('HSET', key, 'status', 'expired', 'ended_at', redis.call('HGET', key, 'expires_at'))
+    table.insert(expired, id)
+  end
+  redis.call('ZREM', KEYS[1], id)
+end
+return expired
+`)
+
+// listGrantsScript returns every grant's hash, newest first
+var listGrantsScript = redis.NewScript(`
+local grants = {}
+for i, id in ipairs(redis.call('ZREVRANGE', KEYS[1], 0, -1)) do
+  grants[i] = redis.call('HGETALL', ARGV[1] .. id)
+end
+return grants
+`)
+
+// redisBreakGlassGrants keeps grants in Redis, shared by every replica
+type redisBreakGlassGrants struct {
+	client *redis.Client
+}
+
+// NewRedisBreakGlassGrants keeps grants in the Redis at rawURL:
+// redis://[user:password@]host:port[/db], or rediss:// to require TLS
+func NewRedisBreakGlassGrants(rawURL string) (BreakGlassGrants, error) {
+	opts, err := redis.ParseURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	opts.DialTimeout, opts.ReadTimeout, opts.WriteTimeout = breakGlassRedisTimeout, breakGlassRedisTimeout, breakGlassRedisTimeout
+	return &redisBreakGlassGrants{client: redis.NewClient(opts)}, nil
+}
+
+func (s *redisBreakGlassGrants) Add(ctx context.Context, grant BreakGlassGrant, now time.Time) error {
+	encoded, err := json.Marshal(grant)
+	if err != nil {
+		return err
+	}
+	ttl := grant.ExpiresAt.Sub(now).Milliseconds()
+	if ttl < 1 {
+		ttl = 1
+	}
+	added, err := addGrantScript.Run(ctx, s.client,
+		[]string{breakGlassActiveKey + grant.UserID, breakGlassGrantKey + grant.ID, breakGlassGrantedKey, breakGlassExpiringKey},
+		grant.ID,
+		string(encoded),
+		strconv.FormatInt(grant.ExpiresAt.UnixMilli(), 10),
+		grant.ExpiresAt.Format(time.RFC3339Nano),
+		strconv.FormatInt(grant.GrantedAt.UnixMilli(), 10),
+		strconv.FormatInt(ttl, 10),
+	).Int()
+	if err != nil {
+		return fmt.Errorf("%w: %v", errBreakGlassStore, err)
+	}
+	if added != 1 {
+		return errBreakGlassActive
+	}
+	return nil
+}
+
+func (s *redisBreakGlassGrants) Revoke(ctx context.Context, id, by string, now time.Time) (BreakGlassGrant, error) {
+	grant, err := s.Get(ctx, id)
+	if err != nil {
+		return BreakGlassGrant{}, err
+	}
+	reply, err := revokeGrantScript.Run(ctx, s.client,
+		[]string{breakGlassGrantKey + id, breakGlassExpiringKey, breakGlassActiveKey + grant.UserID},
+		id,
+		strconv.FormatInt(now.UnixMilli(), 10),
+		now.Format(time.RFC3339Nano),
+		by,
+	).Text()
+	if err != nil {
+		return BreakGlassGrant{}, fmt.Errorf("%w: %v", errBreakGlassStore, err)
+	}
+	switch reply {
+	case "revoked":
+		grant.Status, grant.EndedAt, grant.RevokedBy = BreakGlassRevoked, &now, by
+		return grant, nil
+	case "not_found":
+		return BreakGlassGrant{}, errBreakGlassNotFound
+	default:
+		return BreakGlassGrant{}, errBreakGlassEnded
+	}
+}
+
+func (s *redisBreakGlassGrants) Expire(ctx context.Context, now time.Time) ([]BreakGlassGrant, error) {
+	ids, err := expireGrantsScript.Run(ctx, s.client, []string{breakGlassExpiringKey},
+		strconv.FormatInt(now.UnixMilli(), 10),
+		breakGlassGrantKey,
+	).StringSlice()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errBreakGlassStore, err)
+	}
+	expired := make([]BreakGlassGrant, 0, len(ids))
+	for _, id := range ids {
+		grant, err := s.Get(ctx, id)
+		if err != nil {
+			return expired, err
+		}
+		expired = append(expired, grant)
+	}
+	sort.Slice(expired, func(i, j int) bool { return expired[i].ID < expired[j].ID })
+	return expired, nil
+}
+
+func (s *redisBreakGlassGrants) Get(ctx context.Context, id string) (BreakGlassGrant, error) {
+	hash, err := s.client.HGetAll(ctx, breakGlassGrantKey+id).Result()
+	if err != nil {
+		return BreakGlassGrant{}, fmt.Errorf("%w: %v", errBreakGlassStore, err)
+	}
+	if len(hash) == 0 {
+		return BreakGlassGrant{}, errBreakGlassNotFound
+	}
+	return decodeBreakGlassGrant(hash)
+}
+
+func (s *redisBreakGlassGrants) List(ctx context.Context) ([]BreakGlassGrant, error) {
+	reply, err := listGrantsScript.Run(ctx, s.client, []string{breakGlassGrantedKey}, breakGlassGrantKey).Slice()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errBreakGlassStore, err)
+	}
+	grants := make([]BreakGlassGrant, 0, len(reply))
+	for _, fields := range reply {
+		// HGETALL replies to scripts as a flat list of names and values
+		fields, _ := fields.([]interface{})
+		if len(fields) == 0 {
+			continue
+		}
+		hash := make(map[string]string, len(fields)/2)
+		for i := 0; i+1 < len(fields); i += 2 {
+			name, _ := fields[i].(string)
+			value, _ := fields[i+1].(string)
+			hash[name] = value
+		}
+		grant, err := decodeBreakGlassGrant(hash)
+		if err != nil {
+			return nil, err
+		}
+		grants = append(grants, grant)
+	}
+	return grants, nil
+}
+
+// decodeBreakGlassGrant reads a grant's hash: the grant as made, with its status since
+func decodeBreakGlassGrant(hash map[string]string) (BreakGlassGrant, error) {
+	var grant BreakGlassGrant
+	if err := json.Unmarshal([]byte(hash["grant"]), &grant); err != nil {
+		return BreakGlassGrant{}, fmt.Errorf("%w: undecodable grant: %v", errBreakGlassStore, err)
+	}
+	grant.Status, grant.RevokedBy = hash["status"], hash["revoked_by"]
+	if hash["ended_at"] != "" {
+		ended, err := time.Parse(time.RFC3339Nano, hash["ended_at"])
+		if err != nil {
+			return BreakGlassGrant{}, fmt.Errorf("%w: undecodable end: %v", errBreakGlassStore, err)
+		}
+		grant.EndedAt = &ended
+	}
+	return grant, nil
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/healthcare-gitops/common/audit"
+)
+
+// useBreakGlass gives the test an empty grant store on a controllable clock, alerting
+// the returned channel
+func useBreakGlass(t *testing.T) (*BreakGlassStore, *time.Time, chan BreakGlassAlert) {
+	t.Helper()
+	alerts := make(chan BreakGlassAlert, 8)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert BreakGlassAlert
+		if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+			t.Errorf("undecodable alert: %v", err)
+		}
+		alerts <- alert
+	}))
+	t.Cleanup(webhook.Close)
+
+	previous := breakGlass
+	now := time.Now().UTC()
+	cfg := defaultBreakGlassConfig
+	cfg.WebhookURL = webhook.URL
+	breakGlass = NewBreakGlassStore(cfg, NewMemoryBreakGlassGrants())
+	breakGlass.now = func() time.Time { return now }
+	t.Cleanup(func() { breakGlass = previous })
+	return breakGlass, &now, alerts
+}
+
+func nextAlert(t *testing.T, alerts chan BreakGlassAlert) BreakGlassAlert {
+	t.Helper()
+	select {
+	case alert := <-alerts:
+		return alert
+	case <-time.After(5 * time.Second):
+		t.Fatal("no alert posted")
+		return BreakGlassAlert{}
+	}
+}
+
+// TestBreakGlassLifecycle verifies only allowed roles with a reason get a time-boxed
+// phi:read token, that revocation and expiry end it, and that each step is audited
+// as critical and alerted on
+func TestBreakGlassLifecycle(t *testing.T) {
+	useTokenAudit(t)
+	useLoginGuard(t, defaultLockoutConfig)
+	_, now, alerts := useBreakGlass(t)
+	sink := &memorySink{}
+	previousAudit := auditEvents
+	auditEvents = audit.NewEmitter("auth-service", sink, audit.Config{})
+	t.Cleanup(func() { auditEvents = previousAudit })
+
+	clinician := testToken(t, "dr-grey", "clinician", "device:read")
+	reason := `{"reason":"Unconscious patient in ED bay 4, attending unavailable","duration_seconds":1200}`
+	refused := []struct {
+		token, body string
+		status      int
+	}{
+		{testToken(t, "mallory", "user"), reason, http.StatusForbidden},
+		{clinician, `{"reason":"need it"}`, http.StatusUnprocessableEntity},
+		{clinician, `{"reason":"Unconscious patient in ED bay 4, attending unavailable","duration_seconds":7200}`, http.StatusUnprocessableEntity},
+		{"", reason, http.StatusUnauthorized},
+	}
+	for _, tc := range refused {
+		if rr := serve(t, http.MethodPost, breakGlassPath, tc.token, tc.body); rr.Code != tc.status {
+			t.Errorf("expected %d for %s, got %d: %s", tc.status, tc.body, rr.Code, rr.Body)
+		}
+	}
+
+	rr := serve(t, http.MethodPost, breakGlassPath, clinician, reason)
+	if rr.Code != http.StatusCreated || rr.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("expected 201 no-store, got %d: %s", rr.Code, rr.Body)
+	}
+	var granted BreakGlassResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &granted); err != nil {
+		t.Fatal(err)
+	}
+	if granted.Status != BreakGlassActive || granted.ExpiresAt.Sub(granted.GrantedAt) > 20*time.Minute ||
+		len(granted.Scopes) != 2 || granted.Scopes[1] != "phi:read" {
+		t.Fatalf("unexpected grant %+v", granted.BreakGlassGrant)
+	}
+	if alert := nextAlert(t, alerts); alert.Event != "granted" || alert.Severity != "critical" || alert.Grant.ID != granted.ID {
+		t.Errorf("unexpected alert %+v", alert)
+	}
+
+	code, introspected := introspect(t, granted.Token)
+	if code != http.StatusOK || introspected.BreakGlass != granted.ID || !contains(introspected.Scopes, "phi:read") {
+		t.Fatalf("expected the break-glass token to introspect, got %d %+v", code, introspected)
+	}
+	if rr := serve(t, http.MethodPost, breakGlassPath, clinician, reason); rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 for a second grant, got %d", rr.Code)
+	}
+	if rr := serve(t, http.MethodPost, breakGlassPath, granted.Token, reason); rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a break-glass token, got %d", rr.Code)
+	}
+
+	// Only the holder or an admin may end it, and its token stops working at once
+	if rr := serve(t, http.MethodDelete, breakGlassPath+"/"+granted.ID, testToken(t, "dr-house", "clinician"), ""); rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for another clinician, got %d", rr.Code)
+	}
+	if rr := serve(t, http.MethodDelete, breakGlassPath+"/"+granted.ID, clinician, ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", rr.Code, rr.Body)
+	}
+	if code, _ := introspect(t, granted.Token); code != http.StatusUnauthorized {
+		t.Errorf("expected the revoked token to be refused, got %d", code)
+	}
+	if alert := nextAlert(t, alerts); alert.Event != "revoked" || alert.Grant.RevokedBy != "dr-grey" {
+		t.Errorf("unexpected alert %+v", alert)
+	}
+
+	// A second grant runs out and is swept
+	*now = now.Add(time.Minute)
+	rr = serve(t, http.MethodPost, breakGlassPath, clinician, reason)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201 after revocation, got %d: %s", rr.Code, rr.Body)
+	}
+	json.Unmarshal(rr.Body.Bytes(), &granted)
+	nextAlert(t, alerts)
+	*now = now.Add(21 * time.Minute)
+	sweepBreakGlass(context.Background())
+	if alert := nextAlert(t, alerts); alert.Event != "expired" || alert.Grant.Status != BreakGlassExpired {
+		t.Errorf("unexpected alert %+v", alert)
+	}
+	if code, _ := introspect(t, granted.Token); code != http.StatusUnauthorized {
+		t.Errorf("expected the expired grant's token to be refused, got %d", code)
+	}
+
+	rr = serve(t, http.MethodGet, breakGlassPath, testToken(t, "root", "admin", "admin"), "")
+	var list struct {
+		Grants []BreakGlassGrant `json:"grants"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &list)
+	if rr.Code != http.StatusOK || len(list.Grants) != 2 || list.Grants[0].Status != BreakGlassExpired || list.Grants[1].Status != BreakGlassRevoked {
+		t.Fatalf("unexpected grant list %d: %s", rr.Code, rr.Body)
+	}
+
+	if err := auditEvents.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var critical []string
+	for _, ev := range sink.events {
+		if ev.Details["severity"] == "critical" {
+			critical = append(critical, ev.Action)
+			if ev.Details["reason"] == "" || ev.Details["user_id"] != "dr-grey" {
+				t.Errorf("unexpected audit event %+v", ev)
+			}
+		}
+	}
+	want := []string{"auth.break_glass_granted", "auth.break_glass_revoked", "auth.break_glass_granted", "auth.break_glass_expired"}
+	if len(critical) != len(want) {
+		t.Fatalf("expected critical audit events %v, got %v", want, critical)
+	}
+	for i := range want {
+		if critical[i] != want[i] {
+			t.Errorf("expected critical audit events %v, got %v", want, critical)
+		}
+	}
+}
+
+// TestBreakGlassSharedByReplicas verifies replicas sharing grants hold a user to one
+// active grant between them, and refuse a grant's token once any of them revokes it
+func TestBreakGlassSharedByReplicas(t *testing.T) {
+	ctx := context.Background()
+	grants := NewMemoryBreakGlassGrants()
+	first, second := NewBreakGlassStore(defaultBreakGlassConfig, grants), NewBreakGlassStore(defaultBreakGlassConfig, grants)
+	claims := &TokenClaims{UserID: "dr-grey", Role: "clinician"}
+	req := BreakGlassRequest{Reason: "Unconscious patient in ED bay 4, attending unavailable"}
+
+	grant, err := first.Grant(ctx, claims, req, "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := second.Grant(ctx, claims, req, "10.0.0.2"); !errors.Is(err, errBreakGlassActive) {
+		t.Fatalf("expected the other replica to refuse a second grant, got %v", err)
+	}
+	if _, err := second.Revoke(ctx, grant.ID, "root"); err != nil {
+		t.Fatal(err)
+	}
+	if ended, err := first.Ended(ctx, grant.ID); err != nil || !ended {
+		t.Fatalf("expected the grant revoked elsewhere to have ended, got %v %v", ended, err)
+	}
+}
+
+// unavailableBreakGlassGrants fails every call, as an unreachable shared store would
+type unavailableBreakGlassGrants struct{}
+
+func (unavailableBreakGlassGrants) Add(context.Context, BreakGlassGrant, time.Time) error {
+	return errBreakGlassStore
+}
+
+func (unavailableBreakGlassGrants) Revoke(context.Context, string, string, time.Time) (BreakGlassGrant, error) {
+	return BreakGlassGrant{}, errBreakGlassStore
+}
+
+func (unavailableBreakGlassGrants) Expire(context.Context, time.Time) ([]BreakGlassGrant, error) {
+	return nil, errBreakGlassStore
+}
+
+func (unavailableBreakGlassGrants) Get(context.Context, string) (BreakGlassGrant, error) {
+	return BreakGlassGrant{}, errBreakGlassStore
+}
+
+func (unavailableBreakGlassGrants) List(context.Context) ([]BreakGlassGrant, error) {
+	return nil, errBreakGlassStore
+}
+
+// TestBreakGlassStoreUnavailable verifies that without the shared grants no access is
+// granted, and break-glass tokens are refused since they may have been revoked
+func TestBreakGlassStoreUnavailable(t *testing.T) {
+	useTokenAudit(t)
+	useLoginGuard(t, defaultLockoutConfig)
+	store, _, _ := useBreakGlass(t)
+	granted, err := store.Grant(context.Background(), &TokenClaims{UserID: "dr-grey", Role: "clinician"},
+		BreakGlassRequest{Reason: "Unconscious patient in ED bay 4, attending unavailable"}, "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := signToken(TokenClaims{
+		UserID:     granted.UserID,
+		Role:       granted.Role,
+		Scopes:     granted.Scopes,
+		BreakGlass: granted.ID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(granted.ExpiresAt),
+			IssuedAt:  jwt.NewNumericDate(granted.GrantedAt),
+			Issuer:    "auth-service",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := introspect(t, token); code != http.StatusOK {
+		t.Fatalf("expected the break-glass token to introspect, got %d", code)
+	}
+
+	store.grants = unavailableBreakGlassGrants{}
+	reason := `{"reason":"Unconscious patient in ED bay 4, attending unavailable"}`
+	if rr := serve(t, http.MethodPost, breakGlassPath, testToken(t, "dr-house", "clinician"), reason); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 while grants are unavailable, got %d: %s", rr.Code, rr.Body)
+	}
+	if rr := serve(t, http.MethodGet, breakGlassPath, testToken(t, "root", "admin", "admin"), ""); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 listing unavailable grants, got %d", rr.Code)
+	}
+	if code, _ := introspect(t, token); code != http.StatusUnauthorized {
+		t.Errorf("expected the break-glass token to be refused, got %d", code)
+	}
+}
+
+func TestConfigureBreakGlass(t *testing.T) {
+	previous := breakGlass
+	t.Cleanup(func() { breakGlass = previous })
+
+	t.Setenv("BREAK_GLASS_ROLES", "er_physician, charge_nurse")
+	t.Setenv("BREAK_GLASS_MAX_DURATION", "2h")
+	t.Setenv("SOC_ALERT_WEBHOOK_URL", "https://soc.example.com/alerts")
+	if err := configureBreakGlass(); err != nil {
+		t.Fatal(err)
+	}
+	cfg := breakGlass.Config()
+	if len(cfg.Roles) != 2 || cfg.Roles[1] != "charge_nurse" || cfg.MaxDuration != 2*time.Hour || cfg.WebhookURL != "https://soc.example.com/alerts" {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+
+	t.Setenv("BREAK_GLASS_DEFAULT_DURATION", "3h")
+	if err := configureBreakGlass(); err == nil {
+		t.Error("expected a default beyond the maximum to be refused")
+	}
+	t.Setenv("BREAK_GLASS_DEFAULT_DURATION", "soon")
+	if err := configureBreakGlass(); err == nil {
+		t.Error("expected an unparseable duration to be refused")
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+	"time"
+
+	"github.com/healthcare-gitops/common/features"
+)
+
+// apiSpecVersion is the version of openapi.yaml this build implements
+const apiSpecVersion = "2.19.0"
+
+// openAPISpec is openapi.yaml, served as JSON at /openapi.json
+//
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+// tokenTTL is the lifetime of tokens issued by /token
+const tokenTTL = 15 * time.Minute
+
+// Feature flags, each overridable with FEATURE_<NAME>
+const (
+	FeatureTokenIssuance = "token_issuance"
+	FeatureIntrospection = "introspection"
+	FeatureOIDC          = "oidc_federation"
+	FeaturePolicies      = "policy_engine"
+	FeatureAPIKeys       = "api_keys"
+	FeatureTokenAudit    = "token_audit"
+	FeatureBreakGlass    = "break_glass"
+
+	FeatureBruteForceProtection = "brute_force_protection"
+)
+
+// newFeatureFlags declares the service's features with their defaults
+func newFeatureFlags() *features.Flags {
+	return features.New(
+		features.Flag{Name: FeatureTokenIssuance, Description: "JWT issuance at /token", Default: true},
+		features.Flag{Name: FeatureIntrospection, Description: "Token validation at /introspect for downstream services", Default: true},
+		features.Flag{Name: FeatureOIDC, Description: "Acceptance of RS256 tokens from an external OpenID Connect identity provider", Default: true},
+		features.Flag{Name: FeaturePolicies, Description: "Authorization decisions at /authorize and policy management at /api/v1/policies", Default: true},
+		features.Flag{Name: FeatureAPIKeys, Description: "Scoped API keys for service-to-service callers and their introspection at /apikey/introspect", Default: true},
+		features.Flag{Name: FeatureTokenAudit, Description: "Audit trail of token issuance and introspection at /api/v1/audit/tokens", Default: true},
+		features.Flag{Name: FeatureBreakGlass, Description: "Time-boxed, audited emergency phi:read access at /api/v1/break-glass", Default: true},
+		features.Flag{Name: FeatureBruteForceProtection, Description: "Backoff and temporary lockout of users and IPs after failed authentications", Default: true},
+	)
+}
+
+// featureFlags holds the running service's feature states
+var featureFlags = newFeatureFlags()
+
+// Capabilities lists enabled features, API versions and limits
+func (h AuthHandler) Capabilities(w http.ResponseWriter, r *http.Request) {
+	SecurityHeaders(w, r)
+	features.Handler(func() features.Capabilities {
+		return featureFlags.Capabilities("auth-service", apiSpecVersion, []string{"v1"}, map[string]int64{
+			"token_ttl_seconds":         int64(tokenTTL.Seconds()),
+			"lockout_threshold":         int64(loginGuard.Config().Threshold),
+			"lockout_duration_seconds":  int64(loginGuard.Config().Duration.Seconds()),
+			"api_key_ttl_max_seconds":   int64(maxAPIKeyTTL.Seconds()),
+			"api_key_grace_max_seconds": int64(maxAPIKeyRotateGrace.Seconds()),
+			"token_audit_page_max":      maxTokenAuditPage,
+			"break_glass_max_seconds":   int64(breakGlass.Config().MaxDuration.Seconds()),
+		})
+	})(w, r)
+}
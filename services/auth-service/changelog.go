@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/healthcare-gitops/common/changelog"
+)
+
+// newChangelog lists the service's API changes since 2.0.0
+func newChangelog() (*changelog.Changelog, error) {
+	return changelog.New("auth-service", apiSpecVersion, []changelog.Entry{
+		{Version: "2.1.0", Kind: changelog.Added, Method: "GET", Path: "/capabilities", Description: "Feature, API version and limit discovery"},
+		{Version: "2.2.0", Kind: changelog.Added, Method: "GET", Path: "/introspect", Field: "iss", Description: "Issuer of the token, for tokens federated from an external OIDC identity provider"},
+		{Version: "2.3.0", Kind: changelog.Added, Method: "GET", Path: jwksPath, Description: "Keys RS256 and EdDSA tokens are signed with"},
+		{Version: "2.4.0", Kind: changelog.Added, Method: "POST", Path: "/authorize", Description: "Policy decisions"},
+		{Version: "2.4.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/policies", Description: "List authorization policies"},
+		{Version: "2.4.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/policies", Description: "Create an authorization policy"},
+		{Version: "2.4.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/policies/{id}", Description: "Get an authorization policy"},
+		{Version: "2.4.0", Kind: changelog.Added, Method: "PUT", Path: "/api/v1/policies/{id}", Description: "Replace an authorization policy"},
+		{Version: "2.4.0", Kind: changelog.Added, Method: "DELETE", Path: "/api/v1/policies/{id}", Description: "Delete an authorization policy"},
+		{Version: "2.4.0", Kind: changelog.Added, Method: "PUT", Path: "/api/v1/roles/{role}", Description: "Set a role's scopes"},
+		{Version: "2.5.0", Kind: changelog.Added, Method: "GET", Path: "/admin/observability/{artifact}", Description: "Generated alerting rules and dashboards"},
+		{Version: "2.6.0", Kind: changelog.Changed, Method: "POST", Path: "/token", Description: "429 with Retry-After while the user or client IP is locked out"},
+		{Version: "2.6.0", Kind: changelog.Changed, Method: "GET", Path: "/introspect", Description: "429 with Retry-After while the client IP is locked out"},
+		{Version: "2.6.0", Kind: changelog.Changed, Method: "POST", Path: "/authorize", Description: "429 with Retry-After while the client IP is locked out"},
+		{Version: "2.7.0", Kind: changelog.Added, Method: "GET", Path: apiKeyIntrospectPath, Description: "API key validation"},
+		{Version: "2.7.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/apikeys", Description: "List API keys"},
+		{Version: "2.7.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/apikeys", Description: "Create an API key"},
+		{Version: "2.7.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/apikeys/{id}", Description: "Get an API key"},
+		{Version: "2.7.0", Kind: changelog.Added, Method: "DELETE", Path: "/api/v1/apikeys/{id}", Description: "Revoke an API key"},
+		{Version: "2.7.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/apikeys/{id}/rotate", Description: "Rotate an API key"},
+		{Version: "2.8.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/audit/tokens", Description: "Token issuance and introspection audit trail"},
+		{Version: "2.9.0", Kind: changelog.Added, Method: "GET", Path: "/admin/selfscan", Description: "Security misconfiguration self-scan"},
+		{Version: "2.10.0", Kind: changelog.Added, Method: "POST", Path: "/token", Field: "scopes", Description: "The device:read and device:write scopes"},
+		{Version: "2.11.0", Kind: changelog.Added, Method: "GET", Path: "/admin/usage-stats", Description: "Preview of the opt-in anonymous usage stats report"},
+		{Version: "2.12.0", Kind: changelog.Added, Method: "GET", Path: "/changelog", Description: "This changelog"},
+		{Version: "2.13.0", Kind: changelog.Added, Method: "GET", Path: "/openapi.json", Description: "This OpenAPI document as JSON"},
+		{Version: "2.13.0", Kind: changelog.Added, Method: "GET", Path: "/docs", Description: "Swagger UI for the OpenAPI document"},
+		{Version: "2.14.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/break-glass", Description: "Request time-boxed emergency phi:read access"},
+		{Version: "2.14.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/break-glass", Description: "List emergency access grants"},
+		{Version: "2.14.0", Kind: changelog.Added, Method: "DELETE", Path: "/api/v1/break-glass/{id}", Description: "End an emergency access grant early"},
+		{Version: "2.14.0", Kind: changelog.Added, Method: "GET", Path: "/introspect", Field: "break_glass", Description: "Emergency access grant a break-glass token was issued under"},
+		{Version: "2.15.0", Kind: changelog.Added, Method: "GET", Path: "/compliance/status", Description: "Live status of the service's HIPAA controls"},
+		{Version: "2.16.0", Kind: changelog.Changed, Method: "GET", Path: "/readiness", Description: "Reports each dependency check as up, degraded or down; only a critical check down answers 503"},
+		{Version: "2.17.0", Kind: changelog.Changed, Method: "GET", Path: "/api/v1/break-glass", Description: "Lists the grants made by every replica; 503 while the shared grant store is unreachable"},
+		{Version: "2.17.0", Kind: changelog.Changed, Method: "POST", Path: "/api/v1/break-glass", Description: "503 while the shared grant store is unreachable"},
+		{Version: "2.17.0", Kind: changelog.Changed, Method: "DELETE", Path: "/api/v1/break-glass/{id}", Description: "Revocation takes effect on every replica; 503 while the shared grant store is unreachable"},
+		{Version: "2.18.0", Kind: changelog.Changed, Method: "GET", Path: "/introspect", Field: "scopes", Description: "Federated tokens get only the scopes the claim mapping's rules grant, not those in their own scope or scp claims"},
+		{Version: "2.19.0", Kind: changelog.Changed, Method: "GET", Path: "/admin/observability/{artifact}", Description: "Requires the admin scope"},
+	})
+}
+
+// Changelog serves the API changelog with the service's security headers
+func (h AuthHandler) Changelog(changes *changelog.Changelog) http.HandlerFunc {
+	serve := changelog.Handler(changes)
+	return func(w http.ResponseWriter, r *http.Request) {
+		SecurityHeaders(w, r)
+		serve(w, r)
+	}
+}
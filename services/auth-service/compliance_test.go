@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/healthcare-gitops/common/audit"
+	"github.com/healthcare-gitops/common/compliance"
+)
+
+// TestComplianceStatusChecksHIPAAControls verifies the status reflects the running
+// configuration: brute-force protection off fails login monitoring, an in-memory token
+// audit trail is a warning, and an alerting break-glass procedure passes
+func TestComplianceStatusChecksHIPAAControls(t *testing.T) {
+	useTokenAudit(t)
+	useBreakGlass(t)
+	previous := auditEvents
+	auditEvents = audit.NewEmitter("auth-service", &memorySink{}, audit.Config{})
+	t.Cleanup(func() { auditEvents = previous })
+
+	rr := serve(t, http.MethodGet, "/compliance/status", testToken(t, "ops", "admin", "read"), "")
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 without the admin scope, got %d", rr.Code)
+	}
+	rr = serve(t, http.MethodGet, "/compliance/status", testToken(t, "ops", "admin", "admin"), "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body)
+	}
+	var status compliance.Status
+	if err := json.Unmarshal(rr.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Service != "auth-service" || status.Version != apiSpecVersion || len(status.ViolationMetrics) != 2 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	want := map[string]compliance.ControlStatus{
+		"hipaa.login_monitoring": compliance.Fail,
+		"hipaa.emergency_access": compliance.Pass,
+		"hipaa.audit_controls":   compliance.Warning,
+		"hipaa.audit_bus":        compliance.Pass,
+	}
+	if len(status.Controls) != len(want) {
+		t.Fatalf("expected %d controls, got %+v", len(want), status.Controls)
+	}
+	for _, c := range status.Controls {
+		if c.Status != want[c.ID] {
+			t.Errorf("expected %s to be %s, got %s: %s", c.ID, want[c.ID], c.Status, c.Detail)
+		}
+	}
+	if status.Status != compliance.NonCompliant {
+		t.Errorf("expected non_compliant, got %s", status.Status)
+	}
+
+	// With lockouts on, the failing control passes and only the warning remains
+	useLoginGuard(t, defaultLockoutConfig)
+	status = complianceStatus()
+	if status.Status != compliance.AtRisk || status.Controls[0].Detail != "5 failed logins within 15m0s lock a user out for 15m0s" {
+		t.Fatalf("expected at_risk with lockouts on, got %s: %+v", status.Status, status.Controls[0])
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/healthcare-gitops/common/health"
+	"github.com/healthcare-gitops/common/resilience"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// dependencyVault names Vault in circuit breaker metrics
+const dependencyVault = "vault"
+
+var circuitBreakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "auth_circuit_breaker_state",
+	Help: "State of the circuit breaker guarding calls to a dependency: 0 closed, 1 half-open, 2 open",
+}, []string{"dependency"})
+
+// recordBreakerState exports a breaker's state
+func recordBreakerState(dependency string, state resilience.State) {
+	circuitBreakerState.WithLabelValues(dependency).Set(float64(state))
+}
+
+// dependencyChecks are the readiness checks of the dependencies configured at startup
+var dependencyChecks []health.Check
+
+// exporterHealth follows span exports to the OTLP collector, for readiness
+var exporterHealth health.Tracker
+
+// readiness checks the service has keys to sign and validate tokens with, and the
+// configured dependencies. Vault and the OTLP collector only degrade the service:
+// its keys are already loaded, and traces are not needed to serve tokens.
+func readiness() health.Checker {
+	checks := append([]health.Check{
+		{
+			Name:     "signing_keys",
+			Critical: true,
+			Probe: func(context.Context) error {
+				if signingSecret() == nil && currentSigningKey() == nil {
+					return errors.New("no JWT secret or signing key loaded")
+				}
+				return nil
+			},
+		},
+		{Name: "otlp_exporter", Probe: exporterHealth.Probe},
+	}, dependencyChecks...)
+	return health.Checker{Service: "auth-service", Checks: checks, OnFailure: health.LogFailure}
+}
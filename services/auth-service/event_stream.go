@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/healthcare-gitops/common/events"
+)
+
+// eventStream is the broker token.issued events are streamed to, so SIEM pipelines
+// can follow who was granted what without polling the token audit trail
+var eventStream *events.Stream
+
+// configureEventStream opens the Kafka or NATS broker EVENT_BROKER selects
+func configureEventStream() error {
+	cfg := events.StreamConfigFromEnv()
+	cfg.OnPublish = func(n int, err error) {
+		if err != nil {
+			logger.Warn().Err(err).Int("events", n).Msg("Event broker unavailable, streamed events dropped")
+		}
+	}
+	stream, err := events.OpenStream("auth-service", cfg)
+	if err != nil {
+		return err
+	}
+	eventStream = stream
+	return nil
+}
+
+// streamTokenIssued publishes the grant a token was issued with. The token itself is
+// never part of the event.
+func streamTokenIssued(r *http.Request, claims TokenClaims) {
+	scopes := claims.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+	event := events.TokenIssuedV1{
+		UserID:    claims.UserID,
+		Role:      claims.Role,
+		Scopes:    scopes,
+		Issuer:    claims.Issuer,
+		SourceIP:  clientIP(r),
+		IssuedAt:  claims.IssuedAt.Time.UTC(),
+		ExpiresAt: claims.ExpiresAt.Time.UTC(),
+	}
+	if err := eventStream.Publish(events.EventTokenIssued, "user/"+claims.UserID, event); err != nil {
+		logger.Error().Err(err).Str("event_type", events.EventTokenIssued).Str("user_id", claims.UserID).Msg("Event not streamed")
+	}
+}
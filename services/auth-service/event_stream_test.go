@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/healthcare-gitops/common/events"
+)
+
+// natsMessage is one message a fakeNATS server received
+type natsMessage struct {
+	Subject string
+	Header  string
+	Payload []byte
+}
+
+// fakeNATS accepts NATS connections, answers PINGs and reports the CONNECT options
+// and messages it receives
+func fakeNATS(t *testing.T, token string) (url string, connects chan string, messages chan natsMessage) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	connects, messages = make(chan string, 4), make(chan natsMessage, 16)
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				fmt.Fprint(conn, "INFO {\"server_id\":\"test\",\"proto\":1,\"headers\":true,\"max_payload\":1048576,\"auth_required\":true}\r\n")
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					op, args, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+					switch op {
+					case "CONNECT":
+						connects <- args
+						if !strings.Contains(args, `"auth_token":"`+token+`"`) {
+							fmt.Fprint(conn, "-ERR 'Authorization Violation'\r\n")
+							return
+						}
+					case "PING":
+						fmt.Fprint(conn, "PONG\r\n")
+					case "HPUB":
+						fields := strings.Fields(args)
+						headerSize, _ := strconv.Atoi(fields[1])
+						size, _ := strconv.Atoi(fields[2])
+						buf := make([]byte, size+2)
+						if _, err := io.ReadFull(r, buf); err != nil {
+							return
+						}
+						messages <- natsMessage{Subject: fields[0], Header: string(buf[:headerSize]), Payload: buf[headerSize:size]}
+					}
+				}
+			}(conn)
+		}
+	}()
+	return "nats://" + token + "@" + ln.Addr().String(), connects, messages
+}
+
+func TestTokenIssuanceIsStreamedToNATS(t *testing.T) {
+	useTokenAudit(t)
+	useLoginGuard(t, defaultLockoutConfig)
+	url, connects, messages := fakeNATS(t, "s3cret")
+	t.Setenv("EVENT_BROKER", events.BrokerNATS)
+	t.Setenv("EVENT_NATS_URL", url)
+	t.Setenv("EVENT_TOPIC_PREFIX", "prod.")
+	t.Setenv("EVENT_STREAM_FLUSH_INTERVAL", "10ms")
+	previous := eventStream
+	if err := configureEventStream(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { eventStream = previous })
+
+	if rr := serve(t, http.MethodPost, "/token", "", `{"user_id":"nurse-7","role":"user","scopes":["phi:read"]}`); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 from /token, got %d: %s", rr.Code, rr.Body)
+	}
+	if err := eventStream.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if connect := <-connects; !strings.Contains(connect, `"name":"auth-service"`) || !strings.Contains(connect, `"headers":true`) {
+		t.Errorf("unexpected CONNECT %s", connect)
+	}
+	var msg natsMessage
+	select {
+	case msg = <-messages:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message published")
+	}
+	if msg.Subject != "prod.auth.token.issued" {
+		t.Errorf("published on %q", msg.Subject)
+	}
+
+	var envelope events.Envelope
+	if err := json.Unmarshal(msg.Payload, &envelope); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(msg.Header, "Nats-Msg-Id: "+envelope.ID) {
+		t.Errorf("message ID header missing from %q", msg.Header)
+	}
+	var issued events.TokenIssuedV1
+	if err := json.Unmarshal(envelope.Data, &issued); err != nil {
+		t.Fatal(err)
+	}
+	if issued.UserID != "nurse-7" || issued.Role != "user" || len(issued.Scopes) != 1 || issued.Issuer != "auth-service" ||
+		!issued.ExpiresAt.After(issued.IssuedAt) {
+		t.Errorf("unexpected payload %+v", issued)
+	}
+	if strings.Contains(string(msg.Payload), "eyJ") {
+		t.Error("the token itself was streamed")
+	}
+}
+
+func TestEventStreamRejectsWrongNATSToken(t *testing.T) {
+	url, _, _ := fakeNATS(t, "s3cret")
+	publisher, err := events.NewNATSPublisher(strings.Replace(url, "s3cret", "guess", 1), "auth-service")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer publisher.Close()
+	err = publisher.Publish(context.Background(), []events.Message{{Topic: "auth", Type: events.EventTokenIssued, ID: "EVT-1", Value: []byte(`{}`)}})
+	if err == nil || !strings.Contains(err.Error(), "Authorization Violation") {
+		t.Fatalf("expected the server's authorization error, got %v", err)
+	}
+}
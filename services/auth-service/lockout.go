@@ -0,0 +1,379 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/healthcare-gitops/common/clientip"
+	"github.com/healthcare-gitops/common/config"
+)
+
+// LockoutConfig tunes brute-force protection. Every failed authentication after the
+// first backs the user off for BackoffBase, doubling with each further failure;
+// Threshold failures within Window lock the user out for Duration, doubling with each
+// consecutive lockout up to MaxDuration. Client IPs are locked out the same way after
+// IPThreshold failures but never backed off, so one mistyped token does not block
+// everyone behind a proxy. A user or IP is forgiven once it has been quiet for a Window.
+type LockoutConfig struct {
+	Threshold   int
+	IPThreshold int
+	Window      time.Duration
+	Duration    time.Duration
+	MaxDuration time.Duration
+	BackoffBase time.Duration
+}
+
+var defaultLockoutConfig = LockoutConfig{
+	Threshold:   5,
+	IPThreshold: 20,
+	Window:      15 * time.Minute,
+	Duration:    15 * time.Minute,
+	MaxDuration: 24 * time.Hour,
+	BackoffBase: time.Second,
+}
+
+// Validate checks the settings are usable together
+func (c LockoutConfig) Validate() error {
+	switch {
+	case c.Threshold < 1 || c.IPThreshold < 1:
+		return errors.New("lockout thresholds must be at least 1")
+	case c.Window <= 0 || c.Duration <= 0:
+		return errors.New("lockout window and duration must be positive")
+	case c.MaxDuration < c.Duration:
+		return errors.New("maximum lockout duration must not be shorter than the lockout duration")
+	case c.BackoffBase < 0:
+		return errors.New("backoff base must not be negative")
+	}
+	return nil
+}
+
+// LockoutError is returned while a user or IP is backing off or locked out
+type LockoutError struct {
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+func (e *LockoutError) Error() string {
+	if e.Locked {
+		return fmt.Sprintf("locked out after repeated failed authentications; retry in %s", e.RetryAfter.Round(time.Second))
+	}
+	return fmt.Sprintf("backing off after failed authentication; retry in %s", e.RetryAfter.Round(time.Second))
+}
+
+// failureRecord tracks one user's or IP's failed authentications
+type failureRecord struct {
+	failures     int // within the current window
+	windowStart  time.Time
+	lastFailure  time.Time
+	lockouts     int // consecutive lockouts, each doubling the next
+	blockedUntil time.Time
+	locked       bool // whether blockedUntil ends a lockout rather than a backoff
+}
+
+// LoginGuard counts failed authentications per user and per client IP
+type LoginGuard struct {
+	cfg LockoutConfig
+	now func() time.Time
+
+	mu        sync.Mutex
+	records   map[string]*failureRecord
+	lastSweep time.Time
+}
+
+// NewLoginGuard returns a guard with no recorded failures
+func NewLoginGuard(cfg LockoutConfig) *LoginGuard {
+	return &LoginGuard{cfg: cfg, now: time.Now, records: make(map[string]*failureRecord)}
+}
+
+// Config returns the guard's settings
+func (g *LoginGuard) Config() LockoutConfig {
+	return g.cfg
+}
+
+// guardKey is a tracked user or IP and the failures that lock it out
+type guardKey struct {
+	key       string
+	threshold int
+	backoff   bool
+}
+
+func (g *LoginGuard) keys(userID, ip string) []guardKey {
+	keys := []guardKey{{key: "ip:" + ip, threshold: g.cfg.IPThreshold}}
+	if userID != "" {
+		keys = append(keys, guardKey{key: "user:" + userID, threshold: g.cfg.Threshold, backoff: true})
+	}
+	return keys
+}
+
+// Check returns a LockoutError when the user or the IP may not attempt to authenticate
+// yet; with lockoutsOnly a backoff does not count
+func (g *LoginGuard) Check(userID, ip string, lockoutsOnly bool) *LockoutError {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := g.now()
+	var blocked *LockoutError
+	for _, k := range g.keys(userID, ip) {
+		rec, ok := g.records[k.key]
+		if !ok || !rec.blockedUntil.After(now) || (lockoutsOnly && !rec.locked) {
+			continue
+		}
+		retryAfter := rec.blockedUntil.Sub(now)
+		if blocked == nil || retryAfter > blocked.RetryAfter {
+			blocked = &LockoutError{RetryAfter: retryAfter, Locked: rec.locked}
+		}
+	}
+	return blocked
+}
+
+// Failure records a failed authentication by the user from the IP and returns the
+// length of the lockout it started, or zero when it only extended the backoff
+func (g *LoginGuard) Failure(userID, ip string) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := g.now()
+	g.sweepLocked(now)
+
+	var lockout time.Duration
+	for _, k := range g.keys(userID, ip) {
+		rec, ok := g.records[k.key]
+		if !ok {
+			rec = &failureRecord{windowStart: now}
+			g.records[k.key] = rec
+		}
+		if now.Sub(rec.blockedUntil) > g.cfg.Window {
+			rec.lockouts = 0
+		}
+		if now.Sub(rec.windowStart) > g.cfg.Window {
+			rec.failures = 0
+			rec.windowStart = now
+		}
+		rec.failures++
+		rec.lastFailure = now
+
+		if rec.failures >= k.threshold {
+			rec.lockouts++
+			d := doubled(g.cfg.Duration, rec.lockouts-1, g.cfg.MaxDuration)
+			rec.blockedUntil = now.Add(d)
+			rec.locked = true
+			rec.failures = 0
+			rec.windowStart = now
+			if d > lockout {
+				lockout = d
+			}
+			continue
+		}
+		if k.backoff && rec.failures > 1 && g.cfg.BackoffBase > 0 && !(rec.locked && rec.blockedUntil.After(now)) {
+			rec.blockedUntil = now.Add(doubled(g.cfg.BackoffBase, rec.failures-2, g.cfg.Duration))
+			rec.locked = false
+		}
+	}
+	return lockout
+}
+
+// Success clears the user's failed authentications. The IP's are left to expire so an
+// attacker holding one valid token cannot reset its count while guessing others.
+func (g *LoginGuard) Success(userID string) {
+	if userID == "" {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.records, "user:"+userID)
+}
+
+// sweepLocked forgets keys that have been quiet for a window, at most once a window
+func (g *LoginGuard) sweepLocked(now time.Time) {
+	if now.Sub(g.lastSweep) < g.cfg.Window {
+		return
+	}
+	g.lastSweep = now
+	for key, rec := range g.records {
+		if now.Sub(rec.lastFailure) > g.cfg.Window && now.Sub(rec.blockedUntil) > g.cfg.Window {
+			delete(g.records, key)
+		}
+	}
+}
+
+// doubled returns base doubled n times, capped at max
+func doubled(base time.Duration, n int, max time.Duration) time.Duration {
+	d := base
+	for i := 0; i < n && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// loginGuard tracks failed authentications for the running service
+var loginGuard = NewLoginGuard(defaultLockoutConfig)
+
+// configureLockout reads LOCKOUT_THRESHOLD, LOCKOUT_IP_THRESHOLD, LOCKOUT_WINDOW,
+// LOCKOUT_DURATION, LOCKOUT_MAX_DURATION and LOGIN_BACKOFF_BASE; durations are Go
+// duration strings
+func configureLockout() error {
+	cfg := defaultLockoutConfig
+	cfg.Threshold = config.GetEnvInt("LOCKOUT_THRESHOLD", cfg.Threshold)
+	cfg.IPThreshold = config.GetEnvInt("LOCKOUT_IP_THRESHOLD", cfg.IPThreshold)
+	for _, setting := range []struct {
+		env   string
+		value *time.Duration
+	}{
+		{"LOCKOUT_WINDOW", &cfg.Window},
+		{"LOCKOUT_DURATION", &cfg.Duration},
+		{"LOCKOUT_MAX_DURATION", &cfg.MaxDuration},
+		{"LOGIN_BACKOFF_BASE", &cfg.BackoffBase},
+	} {
+		raw := config.GetEnv(setting.env, "")
+		if raw == "" {
+			continue
+		}
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %w", setting.env, err)
+		}
+		*setting.value = d
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	loginGuard = NewLoginGuard(cfg)
+	logger.Info().
+		Int("threshold", cfg.Threshold).
+		Int("ip_threshold", cfg.IPThreshold).
+		Dur("window", cfg.Window).
+		Dur("duration", cfg.Duration).
+		Dur("max_duration", cfg.MaxDuration).
+		Dur("backoff_base", cfg.BackoffBase).
+		Msg("Brute-force protection configured")
+	return nil
+}
+
+// trustedProxies are the proxies and calling services whose X-Forwarded-For hops
+// name the client, from TRUSTED_PROXIES
+var trustedProxies clientip.TrustedProxies
+
+// configureTrustedProxies reads TRUSTED_PROXIES
+func configureTrustedProxies() error {
+	proxies, err := clientip.FromEnv()
+	if err != nil {
+		return err
+	}
+	trustedProxies = proxies
+	return nil
+}
+
+// clientIP is the address the request came from: the connection's address, or the
+// client a trusted proxy or calling service named in X-Forwarded-For. Hops a client
+// wrote itself are ignored, so it can neither dodge its own lockout nor lock out
+// someone else's address.
+func clientIP(r *http.Request) string {
+	return trustedProxies.ClientIP(r)
+}
+
+// unverifiedUserID reads the user a token claims to be for, without checking it, for
+// the audit trail
+func unverifiedUserID(tokenString string) string {
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, claims); err != nil {
+		return ""
+	}
+	for _, name := range []string{"user_id", "sub"} {
+		if id, ok := claims[name].(string); ok && id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// rejectedUserID is the user a rejected token was issued to, when its signature
+// verified and it failed only on its claims, such as an expired or revoked token. A
+// forged token names no one: counting failures against the user it claims would let
+// anyone lock a victim out.
+func rejectedUserID(tokenString string, err error) string {
+	if !errors.Is(err, jwt.ErrTokenInvalidClaims) && !errors.Is(err, errBreakGlassEnded) {
+		return ""
+	}
+	if oidcProvider != nil && featureFlags.Enabled(FeatureOIDC) && oidcProvider.Handles(tokenString) {
+		claims := jwt.MapClaims{}
+		if _, _, err := jwt.NewParser().ParseUnverified(tokenString, claims); err != nil {
+			return ""
+		}
+		userID, _, _ := oidcProvider.Mapping.Apply(claims)
+		return userID
+	}
+	return unverifiedUserID(tokenString)
+}
+
+// checkLockout returns a *LockoutError when the request's user or IP is blocked; with
+// lockoutsOnly a user who is only backing off is let through
+func checkLockout(r *http.Request, userID string, lockoutsOnly bool) error {
+	if !featureFlags.Enabled(FeatureBruteForceProtection) {
+		return nil
+	}
+	blocked := loginGuard.Check(userID, clientIP(r), lockoutsOnly)
+	if blocked == nil {
+		return nil
+	}
+	if blocked.Locked {
+		recordSecurityEvent(r, "locked_out_attempt", "warning", userID)
+	} else {
+		recordSecurityEvent(r, "authentication_backoff", "info", userID)
+	}
+	logger.Warn().
+		Str("user_id", userID).
+		Str("client_ip", clientIP(r)).
+		Bool("locked", blocked.Locked).
+		Dur("retry_after", blocked.RetryAfter).
+		Msg("Authentication attempt blocked")
+	return blocked
+}
+
+// recordAuthFailure counts a failed authentication against the user and IP
+func recordAuthFailure(r *http.Request, userID string) {
+	if !featureFlags.Enabled(FeatureBruteForceProtection) {
+		return
+	}
+	ip := clientIP(r)
+	if lockout := loginGuard.Failure(userID, ip); lockout > 0 {
+		recordSecurityEvent(r, "account_locked", "critical", userID)
+		logger.Warn().
+			Str("user_id", userID).
+			Str("client_ip", ip).
+			Dur("lockout", lockout).
+			Msg("Locked out after repeated failed authentications")
+	}
+}
+
+// recordAuthSuccess clears the user's failed authentications
+func recordAuthSuccess(userID string) {
+	if featureFlags.Enabled(FeatureBruteForceProtection) {
+		loginGuard.Success(userID)
+	}
+}
+
+// writeLockoutError answers a blocked request with 429 and Retry-After, reporting
+// whether err was a lockout
+func writeLockoutError(w http.ResponseWriter, err error) bool {
+	var blocked *LockoutError
+	if !errors.As(err, &blocked) {
+		return false
+	}
+	retryAfter := int64(math.Ceil(blocked.RetryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":               "Too many failed authentication attempts",
+		"locked":              blocked.Locked,
+		"retry_after_seconds": retryAfter,
+	})
+	return true
+}
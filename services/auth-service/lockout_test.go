@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/healthcare-gitops/common/clientip"
+)
+
+// TestMain turns brute-force protection off: many tests present invalid tokens from the
+// same address on purpose. useLoginGuard turns it back on for the tests that cover it.
+func TestMain(m *testing.M) {
+	os.Setenv("FEATURE_BRUTE_FORCE_PROTECTION", "false")
+	featureFlags = newFeatureFlags()
+	os.Exit(m.Run())
+}
+
+// useLoginGuard enables brute-force protection with a fresh guard on a fake clock
+func useLoginGuard(t *testing.T, cfg LockoutConfig) (*LoginGuard, *time.Time) {
+	t.Helper()
+	t.Setenv("FEATURE_BRUTE_FORCE_PROTECTION", "true")
+	previousFlags, previousGuard := featureFlags, loginGuard
+	featureFlags = newFeatureFlags()
+	now := time.Now()
+	loginGuard = NewLoginGuard(cfg)
+	loginGuard.now = func() time.Time { return now }
+	t.Cleanup(func() { featureFlags, loginGuard = previousFlags, previousGuard })
+	return loginGuard, &now
+}
+
+func forgedToken(t *testing.T, userID string) string {
+	t.Helper()
+	tokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, TokenClaims{
+		UserID: userID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(tokenTTL)),
+		},
+	}).SignedString([]byte("not-the-signing-secret-not-the-signing-secret"))
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return tokenString
+}
+
+func introspectFrom(t *testing.T, handler http.Handler, ip, tokenString string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/introspect", nil)
+	req.RemoteAddr = ip + ":40000"
+	req.Header.Set("Authorization", "Bearer "+tokenString)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+// TestLoginGuardBackoffAndLockout verifies failures back a user off exponentially, lock
+// them out at the threshold and double each consecutive lockout
+func TestLoginGuardBackoffAndLockout(t *testing.T) {
+	cfg := LockoutConfig{Threshold: 4, IPThreshold: 100, Window: 10 * time.Minute, Duration: 5 * time.Minute, MaxDuration: 15 * time.Minute, BackoffBase: time.Second}
+	guard, now := useLoginGuard(t, cfg)
+
+	// The first failure is free; each further one doubles the backoff
+	guard.Failure("alice", "10.0.0.1")
+	if blocked := guard.Check("alice", "10.0.0.1", false); blocked != nil {
+		t.Fatalf("expected no backoff after one failure, got %v", blocked)
+	}
+	for i, want := range []time.Duration{time.Second, 2 * time.Second} {
+		guard.Failure("alice", "10.0.0.1")
+		blocked := guard.Check("alice", "10.0.0.1", false)
+		if blocked == nil || blocked.Locked || blocked.RetryAfter != want {
+			t.Fatalf("failure %d: expected %s backoff, got %+v", i+2, want, blocked)
+		}
+		if guard.Check("alice", "10.0.0.1", true) != nil {
+			t.Fatalf("failure %d: a backoff must not count as a lockout", i+2)
+		}
+		if guard.Check("bob", "10.0.0.1", false) != nil {
+			t.Fatalf("failure %d: the IP must not be backed off", i+2)
+		}
+		*now = now.Add(want)
+	}
+
+	guard.Failure("alice", "10.0.0.2")
+	blocked := guard.Check("alice", "10.0.0.3", true)
+	if blocked == nil || !blocked.Locked || blocked.RetryAfter != 5*time.Minute {
+		t.Fatalf("expected a 5m lockout at the threshold, got %+v", blocked)
+	}
+
+	// Consecutive lockouts double, capped at the maximum
+	for _, want := range []time.Duration{10 * time.Minute, 15 * time.Minute} {
+		*now = now.Add(blocked.RetryAfter)
+		var lockout time.Duration
+		for i := 0; i < cfg.Threshold; i++ {
+			lockout = guard.Failure("alice", "10.0.0.1")
+		}
+		if lockout != want {
+			t.Fatalf("expected a %s lockout, got %s", want, lockout)
+		}
+		blocked = guard.Check("alice", "10.0.0.1", false)
+	}
+
+	// A window of quiet after the lockout forgives it
+	*now = now.Add(blocked.RetryAfter + cfg.Window + time.Second)
+	for i := 0; i < cfg.Threshold-1; i++ {
+		guard.Failure("alice", "10.0.0.1")
+	}
+	if lockout := guard.Failure("alice", "10.0.0.1"); lockout != cfg.Duration {
+		t.Fatalf("expected the lockout to reset to %s, got %s", cfg.Duration, lockout)
+	}
+}
+
+// TestLoginGuardIPLockout verifies an IP guessing tokens for many users is locked out
+// and that a success clears only the user's failures
+func TestLoginGuardIPLockout(t *testing.T) {
+	cfg := LockoutConfig{Threshold: 3, IPThreshold: 5, Window: time.Minute, Duration: time.Minute, MaxDuration: time.Hour, BackoffBase: time.Second}
+	guard, _ := useLoginGuard(t, cfg)
+
+	for i := 0; i < cfg.IPThreshold-1; i++ {
+		guard.Failure("user-"+strconv.Itoa(i), "10.0.0.9")
+	}
+	guard.Success("user-0")
+	if guard.Check("someone-else", "10.0.0.9", true) != nil {
+		t.Fatal("expected the IP to be allowed below its threshold")
+	}
+	if lockout := guard.Failure("user-9", "10.0.0.9"); lockout != cfg.Duration {
+		t.Fatalf("expected the IP to be locked out, got %s", lockout)
+	}
+	if blocked := guard.Check("someone-else", "10.0.0.9", true); blocked == nil || !blocked.Locked {
+		t.Fatalf("expected every user from the IP to be locked out, got %+v", blocked)
+	}
+	if guard.Check("someone-else", "10.0.0.10", false) != nil {
+		t.Fatal("expected other IPs to be unaffected")
+	}
+}
+
+func expiredToken(t *testing.T, userID string) string {
+	t.Helper()
+	tokenString, err := signToken(TokenClaims{
+		UserID: userID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+			IssuedAt:  jwt.NewNumericDate(time.Now().Add(-time.Hour)),
+			Issuer:    "auth-service",
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return tokenString
+}
+
+// TestIntrospectLockout verifies /introspect answers 429 with Retry-After once a user is
+// locked out by failures of tokens genuinely issued to them, even for a valid token,
+// and /token stops issuing tokens to them
+func TestIntrospectLockout(t *testing.T) {
+	setJWTSecret([]byte("test-secret-key-for-lockout-tests-only"))
+	useLoginGuard(t, LockoutConfig{Threshold: 3, IPThreshold: 100, Window: time.Minute, Duration: 2 * time.Minute, MaxDuration: time.Hour})
+	handler := StartAuthServer("").Handler
+
+	for i := 0; i < 3; i++ {
+		if rr := introspectFrom(t, handler, "192.0.2.10", expiredToken(t, "carol")); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected 401, got %d", i+1, rr.Code)
+		}
+	}
+
+	valid := testToken(t, "carol", "user")
+	rr := introspectFrom(t, handler, "192.0.2.11", valid)
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 while locked out, got %d", rr.Code)
+	}
+	if got := rr.Header().Get("Retry-After"); got != "120" {
+		t.Errorf("expected Retry-After 120, got %q", got)
+	}
+	var body struct {
+		Locked            bool  `json:"locked"`
+		RetryAfterSeconds int64 `json:"retry_after_seconds"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil || !body.Locked || body.RetryAfterSeconds != 120 {
+		t.Errorf("unexpected lockout body %+v (%v)", body, err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/token", bytes.NewBufferString(`{"user_id":"carol","role":"user"}`))
+	req.RemoteAddr = "192.0.2.12:40000"
+	tokenRR := httptest.NewRecorder()
+	handler.ServeHTTP(tokenRR, req)
+	if tokenRR.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected /token to refuse a locked-out user, got %d", tokenRR.Code)
+	}
+
+	if rr := introspectFrom(t, handler, "192.0.2.11", testToken(t, "dave", "user")); rr.Code != http.StatusOK {
+		t.Fatalf("expected other users to be unaffected, got %d", rr.Code)
+	}
+}
+
+// TestForgedTokensDoNotLockOutTheirUser verifies tokens whose signature does not verify
+// count only against the IP sending them, never against the user they name
+func TestForgedTokensDoNotLockOutTheirUser(t *testing.T) {
+	setJWTSecret([]byte("test-secret-key-for-lockout-tests-only"))
+	useLoginGuard(t, LockoutConfig{Threshold: 3, IPThreshold: 5, Window: time.Minute, Duration: 2 * time.Minute, MaxDuration: time.Hour, BackoffBase: time.Second})
+	handler := StartAuthServer("").Handler
+
+	for i := 0; i < 5; i++ {
+		if rr := introspectFrom(t, handler, "192.0.2.30", forgedToken(t, "frank")); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected 401, got %d", i+1, rr.Code)
+		}
+	}
+	if rr := introspectFrom(t, handler, "192.0.2.31", testToken(t, "frank", "user")); rr.Code != http.StatusOK {
+		t.Fatalf("expected the named user's valid token to be accepted, got %d", rr.Code)
+	}
+	if rr := introspectFrom(t, handler, "192.0.2.30", testToken(t, "frank", "user")); rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the forging IP to be locked out, got %d", rr.Code)
+	}
+}
+
+// TestClientIPTrustedProxies verifies X-Forwarded-For is only believed from trusted
+// proxies, so a client can neither dodge its IP lockout nor lock out another address
+func TestClientIPTrustedProxies(t *testing.T) {
+	previous := trustedProxies
+	t.Cleanup(func() { trustedProxies = previous })
+
+	req := httptest.NewRequest(http.MethodGet, "/introspect", nil)
+	req.RemoteAddr = "198.51.100.7:40000"
+	req.Header.Set("X-Forwarded-For", "203.0.113.50")
+	trustedProxies = clientip.TrustedProxies{}
+	if got := clientIP(req); got != "198.51.100.7" {
+		t.Fatalf("expected an untrusted peer's own address, got %q", got)
+	}
+
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8")
+	if err := configureTrustedProxies(); err != nil {
+		t.Fatalf("configureTrustedProxies failed: %v", err)
+	}
+	req.RemoteAddr = "10.1.2.3:40000"
+	req.Header.Set("X-Forwarded-For", "203.0.113.50, 198.51.100.7, 10.4.5.6")
+	if got := clientIP(req); got != "198.51.100.7" {
+		t.Fatalf("expected the hop before the trusted proxies, got %q", got)
+	}
+
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/33")
+	if err := configureTrustedProxies(); err == nil {
+		t.Fatal("expected an invalid CIDR range to be rejected")
+	}
+}
+
+// TestLockoutDisabled verifies the feature flag turns brute-force protection off
+func TestLockoutDisabled(t *testing.T) {
+	setJWTSecret([]byte("test-secret-key-for-lockout-tests-only"))
+	useLoginGuard(t, LockoutConfig{Threshold: 1, IPThreshold: 1, Window: time.Minute, Duration: time.Minute, MaxDuration: time.Hour})
+	t.Setenv("FEATURE_BRUTE_FORCE_PROTECTION", "false")
+	featureFlags = newFeatureFlags()
+	handler := StartAuthServer("").Handler
+
+	for i := 0; i < 3; i++ {
+		if rr := introspectFrom(t, handler, "192.0.2.20", forgedToken(t, "erin")); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected 401 with protection off, got %d", i+1, rr.Code)
+		}
+	}
+}
+
+// TestConfigureLockout verifies the settings are read from the environment and validated
+func TestConfigureLockout(t *testing.T) {
+	previous := loginGuard
+	t.Cleanup(func() { loginGuard = previous })
+
+	t.Setenv("LOCKOUT_THRESHOLD", "7")
+	t.Setenv("LOCKOUT_WINDOW", "30m")
+	t.Setenv("LOCKOUT_DURATION", "1h")
+	t.Setenv("LOGIN_BACKOFF_BASE", "500ms")
+	if err := configureLockout(); err != nil {
+		t.Fatalf("configureLockout failed: %v", err)
+	}
+	cfg := loginGuard.Config()
+	if cfg.Threshold != 7 || cfg.IPThreshold != defaultLockoutConfig.IPThreshold || cfg.Window != 30*time.Minute || cfg.Duration != time.Hour || cfg.BackoffBase != 500*time.Millisecond {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+
+	t.Setenv("LOCKOUT_MAX_DURATION", "10m")
+	if err := configureLockout(); err == nil {
+		t.Fatal("expected a maximum shorter than the lockout duration to be rejected")
+	}
+	t.Setenv("LOCKOUT_MAX_DURATION", "soon")
+	if err := configureLockout(); err == nil {
+		t.Fatal("expected an unparseable duration to be rejected")
+	}
+}
@@ -7,6 +7,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -16,10 +17,22 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/healthcare-gitops/common/apidocs"
+	"github.com/healthcare-gitops/common/audit"
+	"github.com/healthcare-gitops/common/compliance"
+	"github.com/healthcare-gitops/common/config"
+	"github.com/healthcare-gitops/common/health"
+	"github.com/healthcare-gitops/common/middleware"
+	"github.com/healthcare-gitops/common/observability"
+	"github.com/healthcare-gitops/common/resilience"
+	"github.com/healthcare-gitops/common/secrets"
+	"github.com/healthcare-gitops/common/selfscan"
+	"github.com/healthcare-gitops/common/tlsconfig"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
@@ -55,15 +68,30 @@ var (
 
 var (
 	logger    zerolog.Logger
-	tracer    trace.Tracer
+	tracer    trace.Tracer = otel.Tracer("auth-service") // no-op until main installs the OTLP provider
 	jwtSecret []byte
 )
 
+// platformScopes are the scopes services authorize against
+var platformScopes = []string{
+	"payment:read",
+	"payment:write",
+	"phi:read",
+	"phi:write",
+	"device:read",
+	"device:write",
+	"events:keys",
+	"admin",
+}
+
 // TokenClaims represents JWT token claims
 type TokenClaims struct {
 	UserID string   `json:"user_id"`
 	Scopes []string `json:"scopes"`
 	Role   string   `json:"role"`
+	// BreakGlass is the ID of the emergency access grant a break-glass token was
+	// issued under
+	BreakGlass string `json:"break_glass,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -75,6 +103,10 @@ type IntrospectResponse struct {
 	Role     string   `json:"role,omitempty"`
 	Exp      int64    `json:"exp,omitempty"`
 	IssuedAt int64    `json:"iat,omitempty"`
+	Issuer   string   `json:"iss,omitempty"`
+	// BreakGlass is set for emergency access tokens, so services can flag what they
+	// release under them
+	BreakGlass string `json:"break_glass,omitempty"`
 }
 
 type AuthHandler struct{}
@@ -103,6 +135,9 @@ func TracingMiddleware(endpoint string, next http.HandlerFunc) http.HandlerFunc
 		)
 
 		r = r.WithContext(ctx)
+		if sc := span.SpanContext(); sc.HasTraceID() {
+			audit.SetTraceID(ctx, sc.TraceID().String())
+		}
 
 		activeRequests.Inc()
 		defer activeRequests.Dec()
@@ -122,13 +157,16 @@ func TracingMiddleware(endpoint string, next http.HandlerFunc) http.HandlerFunc
 			attribute.Float64("http.duration_seconds", duration),
 		)
 
-		logger.Info().
+		event := logger.Info().
 			Str("method", r.Method).
 			Str("path", r.URL.Path).
 			Int("status", statusRecorder.statusCode).
 			Float64("duration_seconds", duration).
-			Str("trace_id", span.SpanContext().TraceID().String()).
-			Msg("HTTP request completed")
+			Str("trace_id", span.SpanContext().TraceID().String())
+		if id, ok := tlsconfig.FromContext(r.Context()); ok {
+			event = event.Str("client_cert", id.Name())
+		}
+		event.Msg("HTTP request completed")
 	}
 }
 
@@ -159,20 +197,7 @@ func (h AuthHandler) Health(w http.ResponseWriter, r *http.Request) {
 
 func (h AuthHandler) Readiness(w http.ResponseWriter, r *http.Request) {
 	SecurityHeaders(w, r)
-
-	ready := map[string]interface{}{
-		"ready":   true,
-		"service": "auth-service",
-		"checks": map[string]string{
-			"jwt_validator": "ready",
-			"metrics":       "ready",
-			"tracing":       "ready",
-		},
-		"timestamp": time.Now().Format(time.RFC3339),
-	}
-
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(ready)
+	health.Write(w, readiness().Run(r.Context()))
 }
 
 func (h AuthHandler) Introspect(w http.ResponseWriter, r *http.Request) {
@@ -185,12 +210,13 @@ func (h AuthHandler) Introspect(w http.ResponseWriter, r *http.Request) {
 	// Extract token from Authorization header
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" {
-		securityEvents.WithLabelValues("missing_token", "warning").Inc()
+		recordSecurityEvent(r, "missing_token", "warning", "")
 		tokensValidated.WithLabelValues("invalid", "none").Inc()
 
 		logger.Warn().
 			Str("remote_addr", r.RemoteAddr).
 			Msg("Missing authorization header")
+		recordTokenEvent(r, TokenAuditEvent{Event: TokenEventIntrospected, Result: TokenResultMissing})
 
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(IntrospectResponse{Active: false})
@@ -200,29 +226,37 @@ func (h AuthHandler) Introspect(w http.ResponseWriter, r *http.Request) {
 	// Extract Bearer token
 	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 	if tokenString == authHeader {
-		securityEvents.WithLabelValues("invalid_token_format", "warning").Inc()
+		recordSecurityEvent(r, "invalid_token_format", "warning", "")
 		tokensValidated.WithLabelValues("invalid", "none").Inc()
 
 		logger.Warn().
 			Str("remote_addr", r.RemoteAddr).
 			Msg("Invalid token format")
+		recordTokenEvent(r, TokenAuditEvent{Event: TokenEventIntrospected, Result: TokenResultInvalid})
 
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(IntrospectResponse{Active: false})
 		return
 	}
 
-	// Parse and validate JWT
-	token, err := jwt.ParseWithClaims(tokenString, &TokenClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return jwtSecret, nil
-	})
+	// Refuse IPs locked out after failed authentications. The user a token names is
+	// not trusted until its signature is checked.
+	if err := checkLockout(r, "", false); err != nil {
+		tokensValidated.WithLabelValues("locked_out", "none").Inc()
+		recordTokenEvent(r, TokenAuditEvent{Event: TokenEventIntrospected, Result: TokenResultLockedOut})
+		writeLockoutError(w, err)
+		return
+	}
 
-	if err != nil || !token.Valid {
-		securityEvents.WithLabelValues("token_validation_failed", "warning").Inc()
+	// Parse and validate JWT, issued here or by the federated identity provider
+	claims, err := validateToken(tokenString)
+	if err != nil {
+		// The audit trail names the user the token claims; only a user it was
+		// genuinely issued to is charged with the failure
+		claimedUserID := unverifiedUserID(tokenString)
+		recordSecurityEvent(r, "token_validation_failed", "warning", claimedUserID)
 		tokensValidated.WithLabelValues("invalid", "none").Inc()
+		recordAuthFailure(r, rejectedUserID(tokenString, err))
 
 		span.SetAttributes(attribute.String("error", "token_invalid"))
 
@@ -230,20 +264,7 @@ func (h AuthHandler) Introspect(w http.ResponseWriter, r *http.Request) {
 			Err(err).
 			Str("remote_addr", r.RemoteAddr).
 			Msg("Token validation failed")
-
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(IntrospectResponse{Active: false})
-		return
-	}
-
-	claims, ok := token.Claims.(*TokenClaims)
-	if !ok {
-		securityEvents.WithLabelValues("claims_parse_failed", "error").Inc()
-		tokensValidated.WithLabelValues("invalid", "none").Inc()
-
-		logger.Error().
-			Str("remote_addr", r.RemoteAddr).
-			Msg("Failed to parse token claims")
+		recordTokenEvent(r, TokenAuditEvent{Event: TokenEventIntrospected, UserID: claimedUserID, Result: TokenResultInvalid})
 
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(IntrospectResponse{Active: false})
@@ -252,26 +273,38 @@ func (h AuthHandler) Introspect(w http.ResponseWriter, r *http.Request) {
 
 	// Check expiration
 	if claims.ExpiresAt != nil && claims.ExpiresAt.Before(time.Now()) {
-		securityEvents.WithLabelValues("token_expired", "info").Inc()
+		recordSecurityEvent(r, "token_expired", "info", claims.UserID)
 		tokensValidated.WithLabelValues("expired", strings.Join(claims.Scopes, ",")).Inc()
 
 		logger.Info().
 			Str("user_id", claims.UserID).
 			Time("expired_at", claims.ExpiresAt.Time).
 			Msg("Token expired")
+		recordTokenEvent(r, TokenAuditEvent{Event: TokenEventIntrospected, UserID: claims.UserID, Role: claims.Role, Scopes: claims.Scopes, Issuer: claims.Issuer, Result: TokenResultExpired})
 
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(IntrospectResponse{Active: false})
 		return
 	}
 
+	// Refuse users backing off or locked out after failures of tokens genuinely
+	// issued to them
+	if err := checkLockout(r, claims.UserID, false); err != nil {
+		tokensValidated.WithLabelValues("locked_out", "none").Inc()
+		recordTokenEvent(r, TokenAuditEvent{Event: TokenEventIntrospected, UserID: claims.UserID, Result: TokenResultLockedOut})
+		writeLockoutError(w, err)
+		return
+	}
+
 	// Token is valid
+	recordAuthSuccess(claims.UserID)
 	tokensValidated.WithLabelValues("valid", strings.Join(claims.Scopes, ",")).Inc()
-	securityEvents.WithLabelValues("successful_authentication", "info").Inc()
+	recordSecurityEvent(r, "successful_authentication", "info", claims.UserID)
 
 	span.SetAttributes(
 		attribute.String("user.id", claims.UserID),
 		attribute.String("user.role", claims.Role),
+		attribute.String("token.issuer", claims.Issuer),
 		attribute.StringSlice("user.scopes", claims.Scopes),
 	)
 
@@ -280,14 +313,17 @@ func (h AuthHandler) Introspect(w http.ResponseWriter, r *http.Request) {
 		Str("role", claims.Role).
 		Strs("scopes", claims.Scopes).
 		Msg("Token validated successfully")
+	recordTokenEvent(r, TokenAuditEvent{Event: TokenEventIntrospected, UserID: claims.UserID, Role: claims.Role, Scopes: claims.Scopes, Issuer: claims.Issuer, Result: TokenResultSuccess})
 
 	response := IntrospectResponse{
-		Active:   true,
-		UserID:   claims.UserID,
-		Scopes:   claims.Scopes,
-		Role:     claims.Role,
-		Exp:      claims.ExpiresAt.Unix(),
-		IssuedAt: claims.IssuedAt.Unix(),
+		Active:     true,
+		UserID:     claims.UserID,
+		Scopes:     claims.Scopes,
+		Role:       claims.Role,
+		Exp:        claims.ExpiresAt.Unix(),
+		IssuedAt:   claims.IssuedAt.Unix(),
+		Issuer:     claims.Issuer,
+		BreakGlass: claims.BreakGlass,
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -321,20 +357,26 @@ func (h AuthHandler) GenerateToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Locked-out users and IPs get no new tokens until the lockout ends
+	if err := checkLockout(r, req.UserID, true); err != nil {
+		recordTokenEvent(r, TokenAuditEvent{Event: TokenEventIssued, UserID: req.UserID, Role: req.Role, Scopes: req.Scopes, Result: TokenResultLockedOut})
+		writeLockoutError(w, err)
+		return
+	}
+
 	// Create token
 	claims := TokenClaims{
 		UserID: req.UserID,
 		Scopes: req.Scopes,
 		Role:   req.Role,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(15 * time.Minute)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(tokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Issuer:    "auth-service",
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtSecret)
+	tokenString, err := signToken(claims)
 	if err != nil {
 		logger.Error().Err(err).Msg("Failed to sign token")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -342,13 +384,17 @@ func (h AuthHandler) GenerateToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	securityEvents.WithLabelValues("token_generated", "info").Inc()
+	recordSecurityEvent(r, "token_generated", "info", req.UserID)
+	audit.SetResource(r.Context(), "user/"+req.UserID)
+	audit.Annotate(r.Context(), "role", req.Role)
 
 	logger.Info().
 		Str("user_id", req.UserID).
 		Str("role", req.Role).
 		Strs("scopes", req.Scopes).
 		Msg("Token generated")
+	recordTokenEvent(r, TokenAuditEvent{Event: TokenEventIssued, UserID: req.UserID, Role: req.Role, Scopes: req.Scopes, Issuer: claims.Issuer, Result: TokenResultSuccess})
+	streamTokenIssued(r, claims)
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -358,20 +404,84 @@ func (h AuthHandler) GenerateToken(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// authRateLimits hold each caller to few token and emergency access requests, and
+// let services introspect API keys, which all arrive from the service's address,
+// faster than other requests
+var authRateLimits = []string{
+	"POST /token=5:20",
+	"POST " + breakGlassPath + "=1:5",
+	apiKeyIntrospectPath + "=500:1000",
+}
+
 // StartAuthServer constructs an HTTP server with routes for health and introspection.
 // WHY: Improves testability and allows coverage of server wiring.
 func StartAuthServer(addr string) *http.Server {
 	mux := http.NewServeMux()
 	h := AuthHandler{}
+	changes, err := newChangelog()
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Invalid API changelog")
+	}
+	docs, err := apidocs.New(openAPISpec, apiSpecVersion)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Invalid OpenAPI document")
+	}
 
 	// Health and monitoring endpoints
 	mux.HandleFunc("/health", TracingMiddleware("/health", h.Health))
 	mux.HandleFunc("/readiness", TracingMiddleware("/readiness", h.Readiness))
+	mux.HandleFunc("/capabilities", TracingMiddleware("/capabilities", h.Capabilities))
+	mux.HandleFunc("GET /changelog", TracingMiddleware("/changelog", h.Changelog(changes)))
+	mux.HandleFunc("GET /openapi.json", TracingMiddleware("/openapi.json", docs.SpecHandler))
+	mux.HandleFunc("GET /docs", TracingMiddleware("/docs", docs.DocsHandler))
 	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("GET /admin/observability/", TracingMiddleware("/admin/observability", requireAdmin(observability.Handler(observabilitySpec).ServeHTTP)))
+	mux.HandleFunc("GET /admin/selfscan", TracingMiddleware("/admin/selfscan", requireAdmin(selfscan.Handler(func() selfscan.Target {
+		return selfScanTarget(mux)
+	}))))
+	mux.HandleFunc("GET /admin/usage-stats", TracingMiddleware("/admin/usage-stats", requireAdmin(usageStats.Handler())))
+	mux.HandleFunc("GET /compliance/status", TracingMiddleware("/compliance/status", requireAdmin(compliance.Handler(func(*http.Request) compliance.Status {
+		return complianceStatus()
+	}))))
 
 	// Auth endpoints
-	mux.HandleFunc("/introspect", TracingMiddleware("/introspect", h.Introspect))
-	mux.HandleFunc("/token", TracingMiddleware("/token", h.GenerateToken))
+	mux.HandleFunc("/introspect", TracingMiddleware("/introspect", featureFlags.Require(FeatureIntrospection, h.Introspect)))
+	mux.HandleFunc("/token", TracingMiddleware("/token", featureFlags.Require(FeatureTokenIssuance, h.GenerateToken)))
+	mux.HandleFunc(jwksPath, TracingMiddleware(jwksPath, h.JWKS))
+
+	// API keys for callers that cannot use JWTs
+	apiKeys := func(next http.HandlerFunc) http.HandlerFunc {
+		return featureFlags.Require(FeatureAPIKeys, next)
+	}
+	mux.HandleFunc(apiKeyIntrospectPath, TracingMiddleware(apiKeyIntrospectPath, apiKeys(h.IntrospectAPIKey)))
+	mux.HandleFunc("GET /api/v1/apikeys", TracingMiddleware("/api/v1/apikeys", apiKeys(requireAdmin(h.ListAPIKeys))))
+	mux.HandleFunc("POST /api/v1/apikeys", TracingMiddleware("/api/v1/apikeys", apiKeys(requireAdmin(h.CreateAPIKey))))
+	mux.HandleFunc("GET /api/v1/apikeys/{id}", TracingMiddleware("/api/v1/apikeys/{id}", apiKeys(requireAdmin(h.GetAPIKey))))
+	mux.HandleFunc("DELETE /api/v1/apikeys/{id}", TracingMiddleware("/api/v1/apikeys/{id}", apiKeys(requireAdmin(h.RevokeAPIKey))))
+	mux.HandleFunc("POST /api/v1/apikeys/{id}/rotate", TracingMiddleware("/api/v1/apikeys/{id}/rotate", apiKeys(requireAdmin(h.RotateAPIKey))))
+
+	// Who held which token when, for incident response
+	mux.HandleFunc("GET /api/v1/audit/tokens", TracingMiddleware("/api/v1/audit/tokens", featureFlags.Require(FeatureTokenAudit, requireAdmin(h.ListTokenAudit))))
+
+	// Authorization decisions and policy management
+	policies := func(next http.HandlerFunc) http.HandlerFunc {
+		return featureFlags.Require(FeaturePolicies, next)
+	}
+	mux.HandleFunc("POST /authorize", TracingMiddleware("/authorize", policies(h.Authorize)))
+	mux.HandleFunc("GET /api/v1/policies", TracingMiddleware("/api/v1/policies", policies(requireAdmin(h.ListPolicies))))
+	mux.HandleFunc("POST /api/v1/policies", TracingMiddleware("/api/v1/policies", policies(requireAdmin(h.CreatePolicy))))
+	mux.HandleFunc("GET /api/v1/policies/{id}", TracingMiddleware("/api/v1/policies/{id}", policies(requireAdmin(h.GetPolicy))))
+	mux.HandleFunc("PUT /api/v1/policies/{id}", TracingMiddleware("/api/v1/policies/{id}", policies(requireAdmin(h.ReplacePolicy))))
+	mux.HandleFunc("DELETE /api/v1/policies/{id}", TracingMiddleware("/api/v1/policies/{id}", policies(requireAdmin(h.DeletePolicy))))
+	mux.HandleFunc("PUT /api/v1/roles/{role}", TracingMiddleware("/api/v1/roles/{role}", policies(requireAdmin(h.SetRole))))
+
+	// Audited, time-boxed emergency access to PHI
+	emergency := func(next http.HandlerFunc) http.HandlerFunc {
+		return featureFlags.Require(FeatureBreakGlass, next)
+	}
+	mux.HandleFunc("POST "+breakGlassPath, TracingMiddleware(breakGlassPath, emergency(h.RequestBreakGlass)))
+	mux.HandleFunc("GET "+breakGlassPath, TracingMiddleware(breakGlassPath, emergency(requireAdmin(h.ListBreakGlass))))
+	mux.HandleFunc("DELETE "+breakGlassPath+"/{id}", TracingMiddleware(breakGlassPath+"/{id}", emergency(h.RevokeBreakGlass)))
 
 	// Root endpoint with service info
 	mux.HandleFunc("/", TracingMiddleware("/", func(w http.ResponseWriter, r *http.Request) {
@@ -382,22 +492,34 @@ func StartAuthServer(addr string) *http.Server {
 			"description": "Production-grade authentication and authorization service",
 			"version":     "1.0.0",
 			"endpoints": map[string]string{
-				"/health":     "Service health status",
-				"/readiness":  "Service readiness status",
-				"/introspect": "Token validation (GET with Authorization header)",
-				"/token":      "Token generation (POST with user_id, scopes, role)",
-				"/metrics":    "Prometheus metrics",
+				"/health":               "Service health status",
+				"/readiness":            "Service readiness status",
+				"/capabilities":         "Enabled features, API versions and limits",
+				"/changelog":            "API changes by version, with deprecations and sunsets",
+				"/openapi.json":         "OpenAPI document for this API",
+				"/docs":                 "Swagger UI for the OpenAPI document",
+				"/introspect":           "Token validation (GET with Authorization header)",
+				"/token":                "Token generation (POST with user_id, scopes, role)",
+				jwksPath:                "Public keys tokens are signed with (JWKS)",
+				"/authorize":            "Policy decision (POST with action, resource and context)",
+				"/api/v1/policies":      "Authorization policy management (admin scope)",
+				"/api/v1/apikeys":       "API key creation, rotation and revocation (admin scope)",
+				"/api/v1/audit/tokens":  "Token issuance and introspection audit trail (admin scope)",
+				"/api/v1/break-glass":   "Time-boxed emergency phi:read access with a stated reason",
+				apiKeyIntrospectPath:    "API key validation (X-API-Key header)",
+				"/metrics":              "Prometheus metrics",
+				"/admin/observability/": "Declared metrics and SLOs (spec), generated alerting rules (rules) and Grafana dashboard (dashboard) (admin scope)",
+				"/admin/selfscan":       "Security misconfiguration self-scan (admin scope)",
+				"/admin/usage-stats":    "Preview of the opt-in anonymous usage stats (admin scope)",
+				"/compliance/status":    "Live status of the service's HIPAA controls (admin scope)",
 			},
 			"security": map[string]interface{}{
-				"jwt_enabled":  true,
-				"rbac_enabled": true,
-				"scopes_supported": []string{
-					"payment:read",
-					"payment:write",
-					"phi:read",
-					"phi:write",
-					"admin",
-				},
+				"jwt_enabled":       true,
+				"signing_algorithm": signingAlgorithm(),
+				"jwks_uri":          jwksPath,
+				"rbac_enabled":      true,
+				"scopes_supported":  platformScopes,
+				"oidc_issuer":       oidcIssuer(),
 			},
 		}
 
@@ -405,9 +527,24 @@ func StartAuthServer(addr string) *http.Server {
 		json.NewEncoder(w).Encode(info)
 	}))
 
+	rateLimits := middleware.RateLimitConfigFromEnv("auth-service", authRateLimits...)
+	rateLimits.OnStoreError = func(err error) {
+		logger.Warn().Err(err).Msg("Rate limit store unavailable, limiting per replica")
+	}
+	// Callers are limited by client IP: verifying their tokens here would cost as much
+	// as the requests being limited
+	rateLimits.TrustedProxies = trustedProxies
+	limiter, err := middleware.NewRateLimiter(rateLimits)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Invalid rate limit configuration")
+	}
+
 	return &http.Server{
-		Addr:              addr,
-		Handler:           mux,
+		Addr: addr,
+		// Under mutual TLS, requests carry the verified client certificate's identity;
+		// the client a trusted proxy names replaces the peer; mutations are emitted to
+		// the audit bus; callers are rate limited
+		Handler:           tlsconfig.Middleware(trustedProxies.Middleware(auditMiddleware(auditEvents)(limiter.Middleware(mux)))),
 		ReadHeaderTimeout: 2 * time.Second,
 		ReadTimeout:       5 * time.Second,
 		WriteTimeout:      10 * time.Second,
@@ -418,27 +555,136 @@ func StartAuthServer(addr string) *http.Server {
 func main() {
 	// Initialize logger
 	logger = zerolog.New(os.Stdout).With().Timestamp().Logger()
+	// The shared packages log through zerolog's global logger
+	log.Logger = logger
 
-	// Validate JWT secret from environment
-	secretEnv := os.Getenv("JWT_SECRET")
-	if secretEnv == "" {
-		logger.Fatal().Msg("JWT_SECRET environment variable is required (minimum 32 characters)")
+	// Settings not in the environment fall back to the config file, read as the
+	// config package initialized; refuse to start when it cannot be read
+	if err := config.Load(); err != nil {
+		logger.Fatal().Err(err).Msg("Failed to read config file")
 	}
-	if len(secretEnv) < 32 {
-		logger.Fatal().Int("length", len(secretEnv)).Msg("JWT_SECRET must be at least 32 characters")
+
+	// Load signing keys from Vault, a file or the environment
+	ctx := context.Background()
+	var vaultClient *http.Client
+	if config.GetEnv("VAULT_ADDR", "") != "" {
+		vaultClient = resilience.ClientFromEnv(dependencyVault, nil, 10*time.Second, recordBreakerState)
+	}
+	provider, err := secrets.FromEnv("auth-service", vaultClient)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Invalid secret provider configuration")
+	}
+	if pinger, ok := provider.(secrets.Pinger); ok && vaultClient != nil {
+		dependencyChecks = append(dependencyChecks, health.Check{Name: "kms", Probe: pinger.Ping})
+	}
+	// Tokens are signed with an asymmetric key unless JWT_SIGNING_ALGORITHM is HS256.
+	// JWT_SECRET is then optional and, when set, keeps HS256 tokens issued before the
+	// switch valid.
+	algorithm := config.GetEnv("JWT_SIGNING_ALGORITHM", AlgorithmRS256)
+	if algorithm != AlgorithmRS256 && algorithm != AlgorithmEdDSA && algorithm != AlgorithmHS256 {
+		logger.Fatal().Str("algorithm", algorithm).Msg("JWT_SIGNING_ALGORITHM must be RS256, EdDSA or HS256")
+	}
+	secret, err := provider.Get(ctx, "JWT_SECRET")
+	hasSecret := err == nil
+	if errors.Is(err, secrets.ErrNotFound) {
+		if algorithm == AlgorithmHS256 {
+			logger.Fatal().Msg("JWT_SECRET is required (minimum 32 characters), from Vault, a file or the environment")
+		}
+		err = nil
+	}
+	if hasSecret {
+		err = validateJWTSecret(secret)
+	}
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to load JWT_SECRET")
+	}
+	if hasSecret {
+		setJWTSecret([]byte(secret.Value))
+		logger.Info().Str("source", secret.Source).Msg("JWT secret loaded")
+	}
+	var signingKeySecret *secrets.Secret
+	if algorithm != AlgorithmHS256 {
+		signingKeySecret, err = loadSigningKey(ctx, provider, algorithm)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Failed to load JWT_SIGNING_KEY")
+		}
+	}
+
+	// Keep the Vault token alive and pick up rotated keys without a restart
+	secretsCtx, stopSecrets := context.WithCancel(ctx)
+	defer stopSecrets()
+	go secrets.KeepAlive(secretsCtx, provider, 30*time.Second, func(err error) {
+		logger.Error().Err(err).Msg("Vault token renewal failed")
+	})
+	interval, err := time.ParseDuration(config.GetEnv("SECRETS_RELOAD_INTERVAL", defaultSecretReloadInterval.String()))
+	if err != nil || interval < 0 {
+		logger.Warn().Msg("Invalid SECRETS_RELOAD_INTERVAL, using the default")
+		interval = defaultSecretReloadInterval
+	}
+	if interval > 0 && hasSecret && secret.Source != secrets.SourceEnv {
+		go watchJWTSecret(provider, interval).Run(secretsCtx, secret)
+	}
+	if interval > 0 && signingKeySecret != nil && signingKeySecret.Source != secrets.SourceEnv {
+		go watchSigningKey(provider, interval, algorithm).Run(secretsCtx, *signingKeySecret)
+	}
+
+	// Accept tokens from an external identity provider alongside our own
+	if err := configureOIDC(); err != nil {
+		logger.Fatal().Err(err).Msg("Invalid OIDC federation configuration")
+	}
+
+	// Backoff and lockout after failed authentications
+	if err := configureLockout(); err != nil {
+		logger.Fatal().Err(err).Msg("Invalid brute-force protection configuration")
+	}
+	if err := configureTrustedProxies(); err != nil {
+		logger.Fatal().Err(err).Msg("Invalid TRUSTED_PROXIES")
+	}
+
+	// Roles and policies behind /authorize
+	if err := configurePolicies(); err != nil {
+		logger.Fatal().Err(err).Msg("Invalid authorization policy configuration")
+	}
+
+	// Emergency access: who may break the glass, for how long, and who is alerted
+	if err := configureBreakGlass(); err != nil {
+		logger.Fatal().Err(err).Msg("Invalid break-glass configuration")
+	}
+	go runBreakGlassSweeper(context.Background())
+
+	// API keys provisioned ahead of time, shared by every replica
+	if err := configureAPIKeys(); err != nil {
+		logger.Fatal().Err(err).Msg("Invalid API key configuration")
+	}
+
+	// Token issuance and introspection audit trail
+	if err := configureTokenAudit(); err != nil {
+		logger.Fatal().Err(err).Msg("Failed to open token audit trail")
+	}
+
+	// Security and audit events are exported to the SIEM, when one is configured
+	if err := configureSIEM(); err != nil {
+		logger.Fatal().Err(err).Msg("Invalid SIEM configuration")
+	}
+
+	// Shared audit bus for token, API key and policy changes
+	if err := configureAuditEvents(ctx); err != nil {
+		logger.Fatal().Err(err).Msg("Failed to open audit sink")
+	}
+
+	// Token issuance is streamed to the event broker, when one is configured
+	if err := configureEventStream(); err != nil {
+		logger.Fatal().Err(err).Msg("Failed to open event broker")
 	}
-	jwtSecret = []byte(secretEnv)
-	logger.Info().Msg("JWT secret loaded from environment")
 
 	// Initialize OpenTelemetry
-	ctx := context.Background()
 	exporter, err := otlptracegrpc.New(ctx)
 	if err != nil {
 		logger.Fatal().Err(err).Msg("Failed to create OTLP trace exporter")
 	}
 
 	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exporter),
+		sdktrace.WithBatcher(health.TrackedExporter[sdktrace.ReadOnlySpan]{SpanExporter: exporter, Tracker: &exporterHealth}),
 		sdktrace.WithResource(resource.NewWithAttributes(
 			semconv.SchemaURL,
 			semconv.ServiceNameKey.String("auth-service"),
@@ -450,15 +696,27 @@ func main() {
 
 	port := "8090"
 	logger.Info().Msgf("🔐 GitOps 2.0 Auth Service starting on port %s", port)
-	logger.Info().Msg("📊 Endpoints: /health, /readiness, /introspect, /token")
-	logger.Info().Msg("🔒 JWT validation enabled")
+	logger.Info().Msg("📊 Endpoints: /health, /readiness, /capabilities, /openapi.json, /docs, /introspect, /token, /authorize, /api/v1/policies, /api/v1/apikeys, /api/v1/audit/tokens, " + breakGlassPath + ", " + apiKeyIntrospectPath + ", " + jwksPath)
+	logger.Info().Str("algorithm", signingAlgorithm()).Msg("🔒 JWT validation enabled")
 	logger.Info().Msg("✅ RBAC & scope-based authorization active")
 
+	// Optional TLS; with TLS_CLIENT_CA_FILE set, clients must present a certificate
+	// from the internal CA
+	tlsCfg := tlsconfig.FromEnv()
+	if tlsCfg.MutualTLS() {
+		logger.Info().Str("client_auth", tlsCfg.ClientAuth).Strs("allowed_clients", tlsCfg.AllowedClients).Msg("🔒 Mutual TLS enabled")
+	} else if tlsCfg.Enabled() {
+		logger.Info().Msg("🔒 TLS enabled")
+	}
+
 	srv := StartAuthServer(":" + port)
 
+	// Opt-in anonymous usage stats for the platform team
+	go startUsageStats(context.Background())
+
 	// Graceful shutdown
 	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := tlsconfig.ListenAndServe(srv, tlsCfg); err != nil && err != http.ErrServerClosed {
 			logger.Fatal().Err(err).Msg("Server failed to start")
 		}
 	}()
@@ -475,6 +733,18 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		logger.Fatal().Err(err).Msg("Server forced to shutdown")
 	}
+	if err := auditEvents.Close(ctx); err != nil {
+		logger.Error().Err(err).Msg("Failed to flush audit events")
+	}
+	if err := eventStream.Close(ctx); err != nil {
+		logger.Error().Err(err).Msg("Failed to flush streamed events")
+	}
+	if err := flushBreakGlassAlerts(ctx); err != nil {
+		logger.Error().Err(err).Msg("Failed to deliver break-glass alerts")
+	}
+	if err := siemExporter.Close(ctx); err != nil {
+		logger.Error().Err(err).Msg("Failed to flush SIEM events")
+	}
 
 	logger.Info().Msg("Server exiting")
 }
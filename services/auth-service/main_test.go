@@ -5,11 +5,16 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"regexp"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/healthcare-gitops/common/changelog"
+	"github.com/healthcare-gitops/common/features"
+	"github.com/healthcare-gitops/common/secrets"
 )
 
 // TestHealth verifies the health endpoint returns correct status
@@ -44,6 +49,9 @@ func TestHealth(t *testing.T) {
 
 // TestReadiness verifies the readiness endpoint
 func TestReadiness(t *testing.T) {
+	previous := signingSecret()
+	setJWTSecret([]byte("test-secret-key-for-readiness-tests-only"))
+	t.Cleanup(func() { setJWTSecret(previous) })
 	h := AuthHandler{}
 	req := httptest.NewRequest(http.MethodGet, "/readiness", nil)
 	rr := httptest.NewRecorder()
@@ -61,6 +69,10 @@ func TestReadiness(t *testing.T) {
 	if ready, ok := body["ready"].(bool); !ok || !ready {
 		t.Fatalf("expected ready=true, got %v", body["ready"])
 	}
+	checks, _ := body["checks"].(map[string]interface{})
+	if check, _ := checks["signing_keys"].(map[string]interface{}); check["status"] != "up" {
+		t.Fatalf("expected the signing keys check to be up, got %v", checks)
+	}
 }
 
 // TestGenerateToken verifies token generation
@@ -294,6 +306,9 @@ func TestIntrospect_ExpiredToken(t *testing.T) {
 
 // TestStartAuthServer_Routes verifies all routes are registered
 func TestStartAuthServer_Routes(t *testing.T) {
+	previous := signingSecret()
+	setJWTSecret([]byte("test-secret-key-for-readiness-tests-only"))
+	t.Cleanup(func() { setJWTSecret(previous) })
 	srv := StartAuthServer(":0")
 	h := srv.Handler
 
@@ -305,6 +320,8 @@ func TestStartAuthServer_Routes(t *testing.T) {
 	}{
 		{"Health", "/health", "GET", http.StatusOK},
 		{"Readiness", "/readiness", "GET", http.StatusOK},
+		{"Capabilities", "/capabilities", "GET", http.StatusOK},
+		{"Changelog", "/changelog", "GET", http.StatusOK},
 		{"Root", "/", "GET", http.StatusOK},
 		{"Metrics", "/metrics", "GET", http.StatusOK},
 		{"Token POST", "/token", "POST", http.StatusBadRequest}, // Missing body
@@ -330,6 +347,151 @@ func TestStartAuthServer_Routes(t *testing.T) {
 	}
 }
 
+// TestCapabilities verifies features and limits are reported and disabled features are refused
+func TestCapabilities(t *testing.T) {
+	t.Setenv("FEATURE_TOKEN_ISSUANCE", "false")
+	previous := featureFlags
+	featureFlags = newFeatureFlags()
+	defer func() { featureFlags = previous }()
+
+	h := StartAuthServer(":0").Handler
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/capabilities", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d", rr.Code)
+	}
+
+	var caps features.Capabilities
+	if err := json.Unmarshal(rr.Body.Bytes(), &caps); err != nil {
+		t.Fatalf("failed to parse body: %v", err)
+	}
+	if caps.Service != "auth-service" || caps.SpecVersion != apiSpecVersion {
+		t.Fatalf("unexpected capabilities %+v", caps)
+	}
+	if caps.Features[FeatureTokenIssuance].Enabled || !caps.Features[FeatureIntrospection].Enabled {
+		t.Fatalf("unexpected features %+v", caps.Features)
+	}
+	if caps.Limits["token_ttl_seconds"] != 900 {
+		t.Fatalf("unexpected token TTL %d", caps.Limits["token_ttl_seconds"])
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(`{"user_id":"u1"}`)))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for disabled token issuance got %d", rr.Code)
+	}
+}
+
+// TestChangelogMatchesOpenAPI verifies every changed endpoint is documented and the
+// newest change is in the spec version this build implements
+func TestChangelogMatchesOpenAPI(t *testing.T) {
+	spec, err := os.ReadFile("openapi.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version := regexp.MustCompile(`(?m)^  version: (\S+)$`).FindSubmatch(spec); version == nil || string(version[1]) != apiSpecVersion {
+		t.Fatalf("expected openapi.yaml version %s, got %q", apiSpecVersion, version)
+	}
+	changes, err := newChangelog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes.Entries[0].Version != apiSpecVersion {
+		t.Fatalf("expected the newest change in %s, got %s", apiSpecVersion, changes.Entries[0].Version)
+	}
+	for _, e := range changes.Entries {
+		if e.Kind == changelog.Removed {
+			continue
+		}
+		if !regexp.MustCompile(`(?m)^  ` + regexp.QuoteMeta(e.Path) + `:$`).Match(spec) {
+			t.Errorf("%s %s is in the changelog but not in openapi.yaml", e.Method, e.Path)
+		}
+	}
+}
+
+// TestOpenAPIDocumentServed verifies openapi.yaml is served as JSON without a token,
+// and its Swagger UI alongside it
+func TestOpenAPIDocumentServed(t *testing.T) {
+	handler := StartAuthServer("").Handler
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d", rr.Code)
+	}
+	var doc struct {
+		Info struct {
+			Title   string `json:"title"`
+			Version string `json:"version"`
+		} `json:"info"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Info.Version != apiSpecVersion || doc.Info.Title == "" {
+		t.Fatalf("expected the %s document, got %+v", apiSpecVersion, doc.Info)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "swagger-ui-bundle.js") {
+		t.Fatalf("expected the Swagger UI page, got %d", rr.Code)
+	}
+	if csp := rr.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "'nonce-") {
+		t.Fatalf("expected the page's own content security policy, got %q", csp)
+	}
+}
+
+// TestJWTSecretReload verifies tokens signed with the replaced secret stay valid for one token lifetime
+func TestJWTSecretReload(t *testing.T) {
+	defer func() {
+		jwtSecret, previousJWTSecret, previousJWTSecretUntil = nil, nil, time.Time{}
+	}()
+	h := AuthHandler{}
+	introspect := func(tokenString string) int {
+		req := httptest.NewRequest(http.MethodGet, "/introspect", nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		rr := httptest.NewRecorder()
+		h.Introspect(rr, req)
+		return rr.Code
+	}
+	sign := func() string {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, TokenClaims{
+			UserID: "rotation-user",
+			RegisteredClaims: jwt.RegisteredClaims{
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(tokenTTL)),
+				IssuedAt:  jwt.NewNumericDate(time.Now()),
+			},
+		})
+		tokenString, err := token.SignedString(signingSecret())
+		if err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+		return tokenString
+	}
+
+	setJWTSecret([]byte("first-secret-for-reload-tests-0001"))
+	before := sign()
+	watcher := watchJWTSecret(nil, time.Minute)
+	if err := watcher.OnChange(secrets.Secret{Value: "too-short", Source: secrets.SourceVault}); err == nil {
+		t.Fatal("expected a short secret to be rejected")
+	}
+	if err := watcher.OnChange(secrets.Secret{Value: "second-secret-for-reload-tests-002", Source: secrets.SourceVault}); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+
+	if code := introspect(sign()); code != http.StatusOK {
+		t.Fatalf("expected token signed with the new secret to validate, got %d", code)
+	}
+	if code := introspect(before); code != http.StatusOK {
+		t.Fatalf("expected token signed before the reload to validate during the grace period, got %d", code)
+	}
+	previousJWTSecretUntil = time.Now().Add(-time.Second)
+	if code := introspect(before); code != http.StatusUnauthorized {
+		t.Fatalf("expected token signed with the retired secret to be rejected, got %d", code)
+	}
+}
+
 // TestSecurityHeaders verifies security headers are set
 func TestSecurityHeaders(t *testing.T) {
 	h := AuthHandler{}
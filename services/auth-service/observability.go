@@ -0,0 +1,44 @@
+package main
+
+import (
+	"github.com/healthcare-gitops/common/observability"
+)
+
+// observabilitySpec declares the metrics this service exports and its SLOs. Alerting
+// rules and the Grafana dashboard are generated from it (see observability/generated);
+// TestObservabilitySpec fails when it disagrees with the registered metrics or the
+// committed output.
+var observabilitySpec = observability.Spec{
+	Service: "auth-service",
+	Team:    "engineering",
+	Metrics: []observability.Metric{
+		{Name: "auth_tokens_validated_total", Type: observability.Counter, Help: "Total number of tokens validated", Labels: []string{"result", "scope"}, GroupBy: "result"},
+		{Name: "auth_request_duration_seconds", Type: observability.Histogram, Help: "Request duration in seconds", Labels: []string{"endpoint", "method", "status"}, GroupBy: "endpoint"},
+		{Name: "auth_active_requests", Type: observability.Gauge, Help: "Number of active requests"},
+		{Name: "auth_security_events_total", Type: observability.Counter, Help: "Total security events", Labels: []string{"event_type", "severity"}, GroupBy: "event_type"},
+		{Name: "auth_authorization_decisions_total", Type: observability.Counter, Help: "Authorization decisions by outcome and action", Labels: []string{"decision", "action"}, GroupBy: "decision"},
+		{Name: "auth_api_key_introspections_total", Type: observability.Counter, Help: "API key introspections by result", Labels: []string{"result"}, GroupBy: "result"},
+		{Name: "auth_break_glass_events_total", Type: observability.Counter, Help: "Break-glass grants by event", Labels: []string{"event"}, GroupBy: "event"},
+		{Name: "auth_siem_events_total", Type: observability.Counter, Help: "Security and audit events exported to the SIEM collector by result", Labels: []string{"result"}, GroupBy: "result"},
+		{Name: "auth_token_audit_write_failures_total", Type: observability.Counter, Help: "Token audit events that could not be written to TOKEN_AUDIT_PATH"},
+		{Name: "auth_circuit_breaker_state", Type: observability.Gauge, Help: "State of the circuit breaker guarding calls to a dependency: 0 closed, 1 half-open, 2 open", Labels: []string{"dependency"}, GroupBy: "dependency"},
+	},
+	SLOs: []observability.SLO{
+		{
+			Name:        "availability",
+			Description: "Token, introspection and authorization requests served without a server error",
+			Objective:   0.999,
+			Metric:      "auth_request_duration_seconds",
+			Filter:      `endpoint=~"/token|/introspect|/authorize|/apikey/introspect"`,
+			ErrorFilter: `status=~"5.."`,
+		},
+		{
+			Name:             "introspection-latency",
+			Description:      "Token introspections answered within 100ms",
+			Objective:        0.99,
+			Metric:           "auth_request_duration_seconds",
+			Filter:           `endpoint="/introspect"`,
+			LatencyThreshold: 0.1,
+		},
+	},
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/healthcare-gitops/common/observability"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var updateObservability = flag.Bool("update", false, "rewrite observability/generated/auth-service from observabilitySpec")
+
+const generatedObservabilityDir = "../../observability/generated/auth-service"
+
+// describeRegistered reports whether m is registered with the default registry under the
+// same help and labels: registering an identical collector fails with
+// AlreadyRegisteredError, any other difference fails with a descriptor conflict
+func describeRegistered(m observability.Metric) error {
+	var c prometheus.Collector
+	switch m.Type {
+	case observability.Counter:
+		c = prometheus.NewCounterVec(prometheus.CounterOpts{Name: m.Name, Help: m.Help}, m.Labels)
+	case observability.Gauge:
+		c = prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: m.Name, Help: m.Help}, m.Labels)
+	case observability.Histogram:
+		c = prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: m.Name, Help: m.Help}, m.Labels)
+	}
+	err := prometheus.Register(c)
+	if err == nil {
+		prometheus.Unregister(c)
+		return errors.New("declared but not registered")
+	}
+	var already prometheus.AlreadyRegisteredError
+	if errors.As(err, &already) {
+		return nil
+	}
+	return err
+}
+
+// exportedMetrics lists the service's metric families and fails on any whose type
+// differs from the declared one
+func exportedMetrics(t *testing.T, prefix string) []string {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather metrics: %v", err)
+	}
+	var names []string
+	for _, family := range families {
+		if !strings.HasPrefix(family.GetName(), prefix) {
+			continue
+		}
+		names = append(names, family.GetName())
+		registered := strings.ToLower(family.GetType().String())
+		if m, ok := observabilitySpec.Metric(family.GetName()); ok && registered != m.Type {
+			t.Errorf("%s is declared as a %s but registered as a %s", m.Name, m.Type, registered)
+		}
+	}
+	return names
+}
+
+// TestObservabilitySpec verifies the declared metrics match the registered ones and the
+// committed rules and dashboard are generated from the current spec. Run
+// go test -run TestObservabilitySpec -update to regenerate them.
+func TestObservabilitySpec(t *testing.T) {
+	// Observe every labelled metric so it shows up in the gathered families
+	requestDuration.WithLabelValues("/test", "GET", "200").Observe(0)
+	tokensValidated.WithLabelValues("valid", "test").Add(0)
+	securityEvents.WithLabelValues("test", "info").Add(0)
+	authorizationDecisions.WithLabelValues("allow", "test").Add(0)
+
+	if err := observabilitySpec.Validate(); err != nil {
+		t.Fatalf("invalid spec: %v", err)
+	}
+	if err := observabilitySpec.CheckRegistered(describeRegistered, exportedMetrics(t, "auth_")); err != nil {
+		t.Errorf("spec does not match registered metrics: %v", err)
+	}
+
+	if *updateObservability {
+		if err := observability.Write(generatedObservabilityDir, observabilitySpec); err != nil {
+			t.Fatalf("failed to write generated files: %v", err)
+		}
+	}
+	if err := observability.Check(generatedObservabilityDir, observabilitySpec); err != nil {
+		t.Errorf("%v; run go test -run TestObservabilitySpec -update", err)
+	}
+}
+
+// TestObservabilityEndpoint verifies the admin endpoint serves the spec and its output
+// to admins only
+func TestObservabilityEndpoint(t *testing.T) {
+	if rr := serve(t, http.MethodGet, "/admin/observability/spec", "", ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous request returned %d, want 401", rr.Code)
+	}
+	if rr := serve(t, http.MethodGet, "/admin/observability/spec", testToken(t, "nurse-7", "user", "phi:read"), ""); rr.Code != http.StatusForbidden {
+		t.Errorf("non-admin request returned %d, want 403", rr.Code)
+	}
+
+	admin := testToken(t, "root", "admin", "admin")
+	for _, tc := range []struct {
+		path        string
+		contentType string
+		contains    string
+	}{
+		{"/admin/observability/spec", "application/json", `"service":"auth-service"`},
+		{"/admin/observability/rules", "application/yaml", "AuthServiceAvailabilityErrorBudgetBurn"},
+		{"/admin/observability/dashboard", "application/json", `"uid": "auth-service-generated"`},
+	} {
+		rr := serve(t, http.MethodGet, tc.path, admin, "")
+		if rr.Code != http.StatusOK {
+			t.Errorf("GET %s returned %d", tc.path, rr.Code)
+		}
+		if got := rr.Header().Get("Content-Type"); got != tc.contentType {
+			t.Errorf("GET %s content type = %q, want %q", tc.path, got, tc.contentType)
+		}
+		if !strings.Contains(rr.Body.String(), tc.contains) {
+			t.Errorf("GET %s does not contain %s", tc.path, tc.contains)
+		}
+	}
+
+	if rr := serve(t, http.MethodGet, "/admin/observability/unknown", admin, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("unknown artifact returned %d, want 404", rr.Code)
+	}
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/healthcare-gitops/common/config"
+)
+
+// oidcMinRefetch stops tokens with unknown key IDs from hammering the JWKS endpoint
+const oidcMinRefetch = 30 * time.Second
+
+// oidcLeeway absorbs clock skew between the identity provider and this service
+const oidcLeeway = 30 * time.Second
+
+var errNoPlatformScopes = errors.New("token grants no platform scopes")
+
+// oidcProvider validates federated tokens; nil when OIDC_ISSUER is unset
+var oidcProvider *OIDCProvider
+
+// ClaimRule grants scopes, and optionally a role, to tokens whose claim contains value.
+// Claim may be a dotted path into nested claims, e.g. realm_access.roles for Keycloak.
+type ClaimRule struct {
+	Claim  string   `json:"claim"`
+	Value  string   `json:"value"`
+	Scopes []string `json:"scopes,omitempty"`
+	Role   string   `json:"role,omitempty"`
+}
+
+// ClaimMapping turns an identity provider's claims into platform scopes and a role
+type ClaimMapping struct {
+	// UserClaim is the claim used as user_id: sub by default, oid or email for some
+	// Azure AD setups
+	UserClaim string `json:"user_claim"`
+	// ScopeClaims, when a mapping opts in, are read for platform scope names as-is:
+	// scope is space-separated (Okta, Keycloak), scp is an array (Azure AD). Only
+	// suits an IdP that issues platform scopes to no one but those who hold them.
+	ScopeClaims []string `json:"scope_claims"`
+	// Rules are applied in order; the first matching rule with a role sets it
+	Rules []ClaimRule `json:"rules"`
+	// DefaultRole is used when no rule sets a role
+	DefaultRole string `json:"default_role"`
+}
+
+// defaultClaimMapping grants scopes only through explicit rules. An IdP's scope
+// claims name what a client asked for, which any client registered with it may do,
+// so they are not read unless a mapping opts in.
+var defaultClaimMapping = ClaimMapping{
+	UserClaim:   "sub",
+	DefaultRole: "user",
+}
+
+// loadClaimMapping reads a ClaimMapping from a JSON file, filling unset fields from
+// the default
+func loadClaimMapping(path string) (ClaimMapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ClaimMapping{}, err
+	}
+	mapping := defaultClaimMapping
+	if err := json.Unmarshal(data, &mapping); err != nil {
+		return ClaimMapping{}, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if mapping.UserClaim == "" {
+		mapping.UserClaim = defaultClaimMapping.UserClaim
+	}
+	for i, rule := range mapping.Rules {
+		if rule.Claim == "" || rule.Value == "" {
+			return ClaimMapping{}, fmt.Errorf("rule %d: claim and value are required", i)
+		}
+		for _, scope := range rule.Scopes {
+			if !isPlatformScope(scope) {
+				return ClaimMapping{}, fmt.Errorf("rule %d: unknown scope %q", i, scope)
+			}
+		}
+	}
+	return mapping, nil
+}
+
+func isPlatformScope(scope string) bool {
+	for _, s := range platformScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// claimValues returns the string values of a claim at a dotted path. Strings are split
+// on spaces, so both "a b" and ["a", "b"] give a and b.
+func claimValues(claims jwt.MapClaims, path string) []string {
+	var value interface{} = map[string]interface{}(claims)
+	for _, part := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[part]
+	}
+	switch v := value.(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// Apply maps claims to a user ID, platform scopes and a role
+func (m ClaimMapping) Apply(claims jwt.MapClaims) (userID string, scopes []string, role string) {
+	if values := claimValues(claims, m.UserClaim); len(values) > 0 {
+		userID = values[0]
+	}
+
+	granted := make(map[string]bool)
+	for _, claim := range m.ScopeClaims {
+		for _, scope := range claimValues(claims, claim) {
+			if isPlatformScope(scope) {
+				granted[scope] = true
+			}
+		}
+	}
+	for _, rule := range m.Rules {
+		matched := false
+		for _, value := range claimValues(claims, rule.Claim) {
+			if value == rule.Value {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		for _, scope := range rule.Scopes {
+			granted[scope] = true
+		}
+		if role == "" {
+			role = rule.Role
+		}
+	}
+	if role == "" {
+		role = m.DefaultRole
+	}
+
+	// Keep the platform's scope order so equal grants look the same
+	for _, scope := range platformScopes {
+		if granted[scope] {
+			scopes = append(scopes, scope)
+		}
+	}
+	return userID, scopes, role
+}
+
+// OIDCProvider validates RS256 tokens from an external OpenID Connect identity
+// provider (Okta, Keycloak, Azure AD) against its published signing keys and maps
+// their claims onto platform scopes and roles
+type OIDCProvider struct {
+	Issuer   string
+	Audience string
+	Mapping  ClaimMapping
+
+	// jwksURL is discovered from the issuer's metadata when not configured
+	jwksURL         string
+	refreshInterval time.Duration
+	client          *http.Client
+	now             func() time.Time
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+// NewOIDCProvider creates a provider for issuer. jwksURL may be empty to discover it.
+func NewOIDCProvider(issuer, audience, jwksURL string, mapping ClaimMapping, refreshInterval time.Duration) *OIDCProvider {
+	return &OIDCProvider{
+		Issuer:          strings.TrimSuffix(issuer, "/"),
+		Audience:        audience,
+		Mapping:         mapping,
+		jwksURL:         jwksURL,
+		refreshInterval: refreshInterval,
+		client:          &http.Client{Timeout: 10 * time.Second},
+		now:             time.Now,
+		keys:            make(map[string]*rsa.PublicKey),
+	}
+}
+
+// Handles reports whether a token claims to come from this provider, judged from its
+// unverified header and issuer. Validate does the actual checks.
+func (p *OIDCProvider) Handles(tokenString string) bool {
+	token, _, err := jwt.NewParser().ParseUnverified(tokenString, jwt.MapClaims{})
+	if err != nil || token.Method.Alg() != jwt.SigningMethodRS256.Alg() {
+		return false
+	}
+	issuer, _ := token.Claims.GetIssuer()
+	return strings.TrimSuffix(issuer, "/") == p.Issuer
+}
+
+// Validate verifies a federated token's signature, issuer, audience and lifetime and
+// returns its claims mapped onto the platform's
+func (p *OIDCProvider) Validate(tokenString string) (*TokenClaims, error) {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(oidcLeeway),
+		jwt.WithTimeFunc(p.now),
+		jwt.WithAudience(p.Audience),
+	}
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(tokenString, claims, p.keyFunc, options...); err != nil {
+		return nil, err
+	}
+	// The issuer is compared without a trailing slash, which IdPs are inconsistent about
+	issuer, _ := claims.GetIssuer()
+	if strings.TrimSuffix(issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", jwt.ErrTokenInvalidIssuer, issuer)
+	}
+
+	userID, scopes, role := p.Mapping.Apply(claims)
+	if userID == "" {
+		return nil, fmt.Errorf("token has no %s claim", p.Mapping.UserClaim)
+	}
+	if len(scopes) == 0 {
+		return nil, errNoPlatformScopes
+	}
+	expiresAt, _ := claims.GetExpirationTime()
+	issuedAt, _ := claims.GetIssuedAt()
+	if issuedAt == nil {
+		issuedAt = jwt.NewNumericDate(p.now())
+	}
+	return &TokenClaims{
+		UserID: userID,
+		Scopes: scopes,
+		Role:   role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			ExpiresAt: expiresAt,
+			IssuedAt:  issuedAt,
+		},
+	}, nil
+}
+
+// keyFunc returns the provider's key for a token's kid, refetching the key set when
+// the kid is unknown (the IdP has rotated keys) or the set is due for refresh
+func (p *OIDCProvider) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key, ok := p.keys[kid]
+	stale := p.now().Sub(p.fetchedAt) > p.refreshInterval
+	if (!ok && p.now().Sub(p.fetchedAt) > oidcMinRefetch) || stale {
+		if err := p.refreshLocked(); err != nil {
+			recordSecurityEvent(nil, "oidc_jwks_refresh_failed", "error", "")
+			logger.Error().Err(err).Str("issuer", p.Issuer).Msg("Failed to refresh identity provider signing keys")
+			if !ok {
+				return nil, err
+			}
+		}
+		key, ok = p.keys[kid]
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// refreshLocked fetches the JWKS, discovering its URL first if needed. Callers hold p.mu.
+func (p *OIDCProvider) refreshLocked() error {
+	if p.jwksURL == "" {
+		var metadata struct {
+			Issuer  string `json:"issuer"`
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := p.getJSON(p.Issuer+"/.well-known/openid-configuration", &metadata); err != nil {
+			return fmt.Errorf("discover %s: %w", p.Issuer, err)
+		}
+		if strings.TrimSuffix(metadata.Issuer, "/") != p.Issuer || metadata.JWKSURI == "" {
+			return fmt.Errorf("discovery document for %s names issuer %q and jwks_uri %q", p.Issuer, metadata.Issuer, metadata.JWKSURI)
+		}
+		p.jwksURL = metadata.JWKSURI
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(p.jwksURL, &set); err != nil {
+		return fmt.Errorf("fetch JWKS: %w", err)
+	}
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+		e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+		if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+			logger.Warn().Str("kid", jwk.Kid).Msg("Skipping malformed key in identity provider JWKS")
+			continue
+		}
+		keys[jwk.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("JWKS at %s has no RSA signing keys", p.jwksURL)
+	}
+	p.keys, p.fetchedAt = keys, p.now()
+	logger.Info().Str("issuer", p.Issuer).Int("keys", len(keys)).Msg("Identity provider signing keys loaded")
+	return nil
+}
+
+func (p *OIDCProvider) getJSON(url string, out interface{}) error {
+	resp, err := p.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// configureOIDC sets up federation from OIDC_ISSUER, OIDC_AUDIENCE, OIDC_JWKS_URL,
+// OIDC_CLAIM_MAPPING_PATH and OIDC_JWKS_REFRESH_MINUTES. Without OIDC_ISSUER the
+// federation feature is unavailable and only tokens issued by /token are accepted.
+func configureOIDC() error {
+	issuer := config.GetEnv("OIDC_ISSUER", "")
+	if issuer == "" {
+		featureFlags.Unavailable(FeatureOIDC, "OIDC_ISSUER is not set")
+		return nil
+	}
+	// Without an audience, tokens the IdP issued to any of its applications would do
+	audience := config.GetEnv("OIDC_AUDIENCE", "")
+	if audience == "" {
+		return errors.New("OIDC_AUDIENCE must be set with OIDC_ISSUER")
+	}
+	mapping := defaultClaimMapping
+	if path := config.GetEnv("OIDC_CLAIM_MAPPING_PATH", ""); path != "" {
+		loaded, err := loadClaimMapping(path)
+		if err != nil {
+			return fmt.Errorf("claim mapping: %w", err)
+		}
+		mapping = loaded
+	}
+	if len(mapping.Rules) == 0 && len(mapping.ScopeClaims) == 0 {
+		return errors.New("OIDC_CLAIM_MAPPING_PATH must name a mapping whose rules grant platform scopes")
+	}
+	refresh := time.Duration(config.GetEnvInt("OIDC_JWKS_REFRESH_MINUTES", 60)) * time.Minute
+	if refresh <= 0 {
+		refresh = time.Hour
+	}
+
+	oidcProvider = NewOIDCProvider(issuer, audience, config.GetEnv("OIDC_JWKS_URL", ""), mapping, refresh)
+	// Load keys up front so a misconfigured issuer shows in the logs at startup; a
+	// failure here is retried when the first federated token arrives
+	oidcProvider.mu.Lock()
+	if err := oidcProvider.refreshLocked(); err != nil {
+		logger.Warn().Err(err).Str("issuer", issuer).Msg("Identity provider signing keys not loaded yet")
+	}
+	oidcProvider.mu.Unlock()
+	logger.Info().Str("issuer", oidcProvider.Issuer).Int("rules", len(mapping.Rules)).Msg("OIDC federation enabled")
+	return nil
+}
+
+// oidcIssuer returns the federated issuer, or an empty string when federation is off
+func oidcIssuer() string {
+	if oidcProvider == nil || !featureFlags.Enabled(FeatureOIDC) {
+		return ""
+	}
+	return oidcProvider.Issuer
+}
+
+// validateToken checks a bearer token: RS256 tokens from the federated identity
+// provider when one is configured, otherwise HS256 tokens issued by /token
+func validateToken(tokenString string) (*TokenClaims, error) {
+	if oidcProvider != nil && featureFlags.Enabled(FeatureOIDC) && oidcProvider.Handles(tokenString) {
+		return oidcProvider.Validate(tokenString)
+	}
+	token, err := parseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(*TokenClaims)
+	if !token.Valid || !ok {
+		return nil, errors.New("invalid token claims")
+	}
+	// Break-glass tokens stop working when their grant is revoked, not only at exp;
+	// while the grants cannot be read they are refused, as they may have been revoked
+	if claims.BreakGlass != "" {
+		ended, err := breakGlass.Ended(context.Background(), claims.BreakGlass)
+		if err != nil {
+			return nil, err
+		}
+		if ended {
+			return nil, errBreakGlassEnded
+		}
+	}
+	return claims, nil
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testIdP serves OpenID discovery and a JWKS for a set of RSA keys
+type testIdP struct {
+	server     *httptest.Server
+	mu         sync.Mutex
+	keys       map[string]*rsa.PrivateKey
+	jwksServed atomic.Int32
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+	idp := &testIdP{keys: make(map[string]*rsa.PrivateKey)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   idp.server.URL,
+			"jwks_uri": idp.server.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		idp.jwksServed.Add(1)
+		idp.mu.Lock()
+		defer idp.mu.Unlock()
+		keys := make([]map[string]string, 0, len(idp.keys))
+		for kid, key := range idp.keys {
+			keys = append(keys, map[string]string{
+				"kty": "RSA",
+				"use": "sig",
+				"kid": kid,
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	idp.addKey(t, "key-1")
+	return idp
+}
+
+func (idp *testIdP) addKey(t *testing.T, kid string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	idp.mu.Lock()
+	idp.keys[kid] = key
+	idp.mu.Unlock()
+}
+
+func (idp *testIdP) sign(t *testing.T, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	idp.mu.Lock()
+	key := idp.keys[kid]
+	idp.mu.Unlock()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return signed
+}
+
+func (idp *testIdP) claims(extra jwt.MapClaims) jwt.MapClaims {
+	claims := jwt.MapClaims{
+		"iss": idp.server.URL,
+		"aud": "healthcare-platform",
+		"sub": "00u1abcd",
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(10 * time.Minute).Unix(),
+	}
+	for k, v := range extra {
+		claims[k] = v
+	}
+	return claims
+}
+
+// clinicianMapping grants phi:read to the IdP's clinicians group
+var clinicianMapping = ClaimMapping{
+	UserClaim:   "sub",
+	DefaultRole: "user",
+	Rules:       []ClaimRule{{Claim: "groups", Value: "clinicians", Scopes: []string{"phi:read"}}},
+}
+
+// useOIDCProvider installs a provider for the test and restores the previous one after
+func useOIDCProvider(t *testing.T, provider *OIDCProvider) {
+	t.Helper()
+	previous := oidcProvider
+	oidcProvider = provider
+	t.Cleanup(func() { oidcProvider = previous })
+}
+
+func introspect(t *testing.T, tokenString string) (int, IntrospectResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/introspect", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenString)
+	rr := httptest.NewRecorder()
+	AuthHandler{}.Introspect(rr, req)
+
+	var response IntrospectResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	return rr.Code, response
+}
+
+// TestOIDCFederatedToken verifies an IdP token is accepted with its claims mapped onto platform scopes and roles
+func TestOIDCFederatedToken(t *testing.T) {
+	idp := newTestIdP(t)
+	mapping := defaultClaimMapping
+	mapping.Rules = []ClaimRule{
+		{Claim: "realm_access.roles", Value: "clinician", Scopes: []string{"phi:read", "phi:write"}, Role: "clinician"},
+		{Claim: "groups", Value: "billing", Scopes: []string{"payment:read"}},
+	}
+	useOIDCProvider(t, NewOIDCProvider(idp.server.URL+"/", "healthcare-platform", "", mapping, time.Hour))
+
+	tokenString := idp.sign(t, "key-1", idp.claims(jwt.MapClaims{
+		"scope":        "openid profile payment:write unknown:scope",
+		"realm_access": map[string]interface{}{"roles": []string{"offline_access", "clinician"}},
+		"groups":       []string{"billing"},
+	}))
+	code, response := introspect(t, tokenString)
+	if code != http.StatusOK || !response.Active {
+		t.Fatalf("expected active token, got %d %+v", code, response)
+	}
+	if response.UserID != "00u1abcd" || response.Role != "clinician" || response.Issuer != idp.server.URL {
+		t.Fatalf("unexpected identity %+v", response)
+	}
+	// The token's own scope claim is not read without a mapping opting in
+	want := []string{"payment:read", "phi:read", "phi:write"}
+	if len(response.Scopes) != len(want) {
+		t.Fatalf("expected scopes %v, got %v", want, response.Scopes)
+	}
+	for i := range want {
+		if response.Scopes[i] != want[i] {
+			t.Fatalf("expected scopes %v, got %v", want, response.Scopes)
+		}
+	}
+}
+
+// TestOIDCRejectsInvalidTokens verifies wrong audiences, unknown issuers, expired tokens and tokens without platform scopes are rejected
+func TestOIDCRejectsInvalidTokens(t *testing.T) {
+	idp := newTestIdP(t)
+	useOIDCProvider(t, NewOIDCProvider(idp.server.URL, "healthcare-platform", "", clinicianMapping, time.Hour))
+
+	cases := map[string]jwt.MapClaims{
+		"wrong audience":  idp.claims(jwt.MapClaims{"aud": "other-app", "groups": "clinicians"}),
+		"other issuer":    idp.claims(jwt.MapClaims{"iss": "https://evil.example.com", "groups": "clinicians"}),
+		"expired":         idp.claims(jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix(), "groups": "clinicians"}),
+		"no exp":          idp.claims(jwt.MapClaims{"exp": nil, "groups": "clinicians"}),
+		"no scopes":       idp.claims(jwt.MapClaims{"groups": "billing"}),
+		"requested scope": idp.claims(jwt.MapClaims{"scope": "openid phi:read", "scp": []string{"phi:read"}}),
+	}
+	for name, claims := range cases {
+		if claims["exp"] == nil {
+			delete(claims, "exp")
+		}
+		if code, response := introspect(t, idp.sign(t, "key-1", claims)); code != http.StatusUnauthorized || response.Active {
+			t.Errorf("%s: expected 401 inactive, got %d %+v", name, code, response)
+		}
+	}
+
+	// A token signed by a key the IdP does not publish
+	stranger, _ := rsa.GenerateKey(rand.Reader, 2048)
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, idp.claims(jwt.MapClaims{"groups": "clinicians"}))
+	token.Header["kid"] = "key-1"
+	forged, _ := token.SignedString(stranger)
+	if code, _ := introspect(t, forged); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for forged signature, got %d", code)
+	}
+}
+
+// TestOIDCKeyRotation verifies an unknown key ID refetches the JWKS, at most once per minimum interval
+func TestOIDCKeyRotation(t *testing.T) {
+	idp := newTestIdP(t)
+	provider := NewOIDCProvider(idp.server.URL, "healthcare-platform", idp.server.URL+"/keys", clinicianMapping, time.Hour)
+	now := time.Now()
+	provider.now = func() time.Time { return now }
+	useOIDCProvider(t, provider)
+
+	if _, err := provider.Validate(idp.sign(t, "key-1", idp.claims(jwt.MapClaims{"groups": "clinicians"}))); err != nil {
+		t.Fatalf("expected valid token: %v", err)
+	}
+	idp.addKey(t, "key-2")
+	rotated := idp.sign(t, "key-2", idp.claims(jwt.MapClaims{"groups": "clinicians"}))
+
+	// Within the minimum refetch interval the new key is not looked up
+	if _, err := provider.Validate(rotated); err == nil {
+		t.Fatal("expected unknown key to be rejected before the refetch interval")
+	}
+	if served := idp.jwksServed.Load(); served != 1 {
+		t.Fatalf("expected 1 JWKS fetch, got %d", served)
+	}
+
+	now = now.Add(oidcMinRefetch + time.Second)
+	if _, err := provider.Validate(rotated); err != nil {
+		t.Fatalf("expected rotated key to be picked up: %v", err)
+	}
+	if served := idp.jwksServed.Load(); served != 2 {
+		t.Fatalf("expected 2 JWKS fetches, got %d", served)
+	}
+}
+
+// TestOIDCKeepsHS256Tokens verifies tokens from /token are still accepted while federation is on
+func TestOIDCKeepsHS256Tokens(t *testing.T) {
+	idp := newTestIdP(t)
+	useOIDCProvider(t, NewOIDCProvider(idp.server.URL, "healthcare-platform", "", clinicianMapping, time.Hour))
+
+	claims := TokenClaims{
+		UserID: "local-user",
+		Scopes: []string{"admin"},
+		Role:   "admin",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(tokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    "auth-service",
+		},
+	}
+	tokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(signingSecret())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+	code, response := introspect(t, tokenString)
+	if code != http.StatusOK || response.UserID != "local-user" || response.Issuer != "auth-service" {
+		t.Fatalf("expected HS256 token to stay valid, got %d %+v", code, response)
+	}
+
+	// An HS256 token claiming the IdP's issuer still goes through HS256 validation
+	claims.Issuer = idp.server.URL
+	tokenString, _ = jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("not-the-platform-secret-000000000"))
+	if code, _ := introspect(t, tokenString); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for HS256 token with foreign secret, got %d", code)
+	}
+}
+
+// TestLoadClaimMapping verifies mapping files are validated and defaults filled in
+func TestLoadClaimMapping(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mapping.json")
+	os.WriteFile(path, []byte(`{"user_claim":"oid","rules":[{"claim":"roles","value":"Platform.Admin","scopes":["admin"],"role":"admin"}]}`), 0o600)
+	mapping, err := loadClaimMapping(path)
+	if err != nil {
+		t.Fatalf("failed to load mapping: %v", err)
+	}
+	if mapping.UserClaim != "oid" || len(mapping.ScopeClaims) != 0 || mapping.DefaultRole != "user" || len(mapping.Rules) != 1 {
+		t.Fatalf("unexpected mapping %+v", mapping)
+	}
+
+	// Scope claims are only read when the mapping opts in
+	os.WriteFile(path, []byte(`{"scope_claims":["scp"]}`), 0o600)
+	if mapping, err := loadClaimMapping(path); err != nil || len(mapping.ScopeClaims) != 1 || mapping.ScopeClaims[0] != "scp" {
+		t.Fatalf("expected the opted-in scope claim, got %+v %v", mapping, err)
+	}
+
+	os.WriteFile(path, []byte(`{"rules":[{"claim":"roles","value":"x","scopes":["superuser"]}]}`), 0o600)
+	if _, err := loadClaimMapping(path); err == nil {
+		t.Fatal("expected unknown scope to be rejected")
+	}
+}
+
+// TestConfigureOIDCRequiresAudienceAndRules verifies federation is refused at startup
+// without an audience, or without a mapping that can grant scopes
+func TestConfigureOIDCRequiresAudienceAndRules(t *testing.T) {
+	idp := newTestIdP(t)
+	useOIDCProvider(t, nil)
+	t.Setenv("OIDC_ISSUER", idp.server.URL)
+	if err := configureOIDC(); err == nil || !strings.Contains(err.Error(), "OIDC_AUDIENCE") {
+		t.Fatalf("expected OIDC_AUDIENCE to be required, got %v", err)
+	}
+
+	t.Setenv("OIDC_AUDIENCE", "healthcare-platform")
+	if err := configureOIDC(); err == nil || !strings.Contains(err.Error(), "OIDC_CLAIM_MAPPING_PATH") {
+		t.Fatalf("expected a mapping granting scopes to be required, got %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "mapping.json")
+	os.WriteFile(path, []byte(`{"rules":[{"claim":"groups","value":"clinicians","scopes":["phi:read"]}]}`), 0o600)
+	t.Setenv("OIDC_CLAIM_MAPPING_PATH", path)
+	if err := configureOIDC(); err != nil {
+		t.Fatal(err)
+	}
+	if oidcProvider == nil || oidcProvider.Audience != "healthcare-platform" {
+		t.Fatalf("unexpected provider %+v", oidcProvider)
+	}
+}
@@ -0,0 +1,770 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/healthcare-gitops/common/audit"
+	"github.com/healthcare-gitops/common/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Policy effects
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// Condition operators
+const (
+	OperatorEquals    = "equals"
+	OperatorNotEquals = "not_equals"
+	OperatorIn        = "in"
+)
+
+// maxPolicyBody bounds policy and authorization request bodies
+const maxPolicyBody = 64 << 10
+
+var policyIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+
+var (
+	errPolicyNotFound = errors.New("policy not found")
+	errPolicyExists   = errors.New("policy already exists")
+)
+
+var authorizationDecisions = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "auth_authorization_decisions_total",
+	Help: "Authorization decisions by outcome and action",
+}, []string{"decision", "action"})
+
+// Condition compares a request attribute with a literal value, or with the attribute
+// named by Ref. Attributes are subject.user_id, subject.role, subject.issuer,
+// resource.type, resource.id, resource.<attribute> and context.<attribute>. A
+// condition on a missing attribute never matches.
+type Condition struct {
+	Attribute string   `json:"attribute"`
+	Operator  string   `json:"operator"`
+	Value     string   `json:"value,omitempty"`
+	Values    []string `json:"values,omitempty"`
+	Ref       string   `json:"ref,omitempty"`
+}
+
+// Policy allows or denies actions on resources to subjects holding its roles and scopes
+// when all its conditions hold. Resources are <type>/<id> patterns, e.g.
+// phi/* or payment/TXN-*; "*" matches every resource and action.
+type Policy struct {
+	ID          string `json:"id"`
+	Description string `json:"description,omitempty"`
+	Effect      string `json:"effect"`
+	// Roles the subject must have one of; any role when empty
+	Roles []string `json:"roles,omitempty"`
+	// Scopes the subject must hold all of, directly or through its role
+	Scopes     []string    `json:"scopes,omitempty"`
+	Actions    []string    `json:"actions"`
+	Resources  []string    `json:"resources"`
+	Conditions []Condition `json:"conditions,omitempty"`
+	CreatedAt  time.Time   `json:"created_at"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+}
+
+// Resource is what an action is requested on
+type Resource struct {
+	Type       string            `json:"type"`
+	ID         string            `json:"id"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// Subject is who is asking, from their token
+type Subject struct {
+	UserID string   `json:"user_id"`
+	Role   string   `json:"role"`
+	Scopes []string `json:"scopes"`
+	Issuer string   `json:"issuer,omitempty"`
+}
+
+// AuthorizeRequest is the body of POST /authorize
+type AuthorizeRequest struct {
+	Action   string            `json:"action"`
+	Resource Resource          `json:"resource"`
+	Context  map[string]string `json:"context,omitempty"`
+}
+
+// Decision is the outcome of an authorization request
+type Decision struct {
+	Allowed  bool   `json:"allowed"`
+	Decision string `json:"decision"`
+	PolicyID string `json:"policy_id,omitempty"`
+	Reason   string `json:"reason"`
+}
+
+// Decider makes authorization decisions
+type Decider interface {
+	Decide(ctx context.Context, subject Subject, req AuthorizeRequest) (Decision, error)
+}
+
+// defaultRoles are the scope bundles each platform role carries
+var defaultRoles = map[string][]string{
+	"admin":             platformScopes,
+	"payment_processor": {"payment:read", "payment:write"},
+	"phi_analyst":       {"phi:read"},
+	"phi_manager":       {"phi:read", "phi:write"},
+	"device_technician": {"device:read", "device:write"},
+	"user":              {},
+}
+
+// defaultPolicies let admin do anything and each <domain>:<action> scope perform that
+// action on <domain> resources, matching how services check scopes today
+func defaultPolicies() []Policy {
+	policies := []Policy{{
+		ID:          "admin",
+		Description: "The admin scope allows every action on every resource",
+		Effect:      EffectAllow,
+		Scopes:      []string{"admin"},
+		Actions:     []string{"*"},
+		Resources:   []string{"*"},
+	}}
+	for _, scope := range platformScopes {
+		domain, action, ok := strings.Cut(scope, ":")
+		if !ok {
+			continue
+		}
+		policies = append(policies, Policy{
+			ID:          "scope." + domain + "." + action,
+			Description: fmt.Sprintf("The %s scope allows %s on %s resources", scope, action, domain),
+			Effect:      EffectAllow,
+			Scopes:      []string{scope},
+			Actions:     []string{action},
+			Resources:   []string{domain + "/*"},
+		})
+	}
+	return policies
+}
+
+// validate checks a policy before it is stored
+func (p Policy) validate() error {
+	if !policyIDPattern.MatchString(p.ID) {
+		return errors.New("id must be 1-64 lowercase letters, digits, '.', '_' or '-'")
+	}
+	if p.Effect != EffectAllow && p.Effect != EffectDeny {
+		return fmt.Errorf("effect must be %q or %q", EffectAllow, EffectDeny)
+	}
+	if len(p.Actions) == 0 || len(p.Resources) == 0 {
+		return errors.New("actions and resources are required")
+	}
+	for _, scope := range p.Scopes {
+		if !isPlatformScope(scope) {
+			return fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+	for _, pattern := range p.Resources {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid resource pattern %q", pattern)
+		}
+	}
+	for _, c := range p.Conditions {
+		if !isAttributeName(c.Attribute) || (c.Ref != "" && !isAttributeName(c.Ref)) {
+			return fmt.Errorf("condition attributes must start with subject., resource. or context. (got %q)", c.Attribute)
+		}
+		switch c.Operator {
+		case OperatorEquals, OperatorNotEquals:
+			if (c.Value == "") == (c.Ref == "") {
+				return fmt.Errorf("%s condition on %s needs exactly one of value or ref", c.Operator, c.Attribute)
+			}
+		case OperatorIn:
+			if len(c.Values) == 0 {
+				return fmt.Errorf("in condition on %s needs values", c.Attribute)
+			}
+		default:
+			return fmt.Errorf("unknown operator %q", c.Operator)
+		}
+	}
+	return nil
+}
+
+func isAttributeName(name string) bool {
+	for _, prefix := range []string{"subject.", "resource.", "context."} {
+		if strings.HasPrefix(name, prefix) && len(name) > len(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// PolicyStore holds role bundles and policies and evaluates them locally
+type PolicyStore struct {
+	mu       sync.RWMutex
+	roles    map[string][]string
+	policies map[string]Policy
+	now      func() time.Time
+}
+
+// NewPolicyStore creates a store with the default roles and policies
+func NewPolicyStore() *PolicyStore {
+	s := &PolicyStore{roles: make(map[string][]string), policies: make(map[string]Policy), now: time.Now}
+	for role, scopes := range defaultRoles {
+		s.roles[role] = append([]string(nil), scopes...)
+	}
+	for _, p := range defaultPolicies() {
+		p.CreatedAt, p.UpdatedAt = s.now().UTC(), s.now().UTC()
+		s.policies[p.ID] = p
+	}
+	return s
+}
+
+// PolicyDocument is the policy file format and the body of the policy list
+type PolicyDocument struct {
+	Roles    map[string][]string `json:"roles"`
+	Policies []Policy            `json:"policies"`
+}
+
+// Load replaces the roles and policies with the document's
+func (s *PolicyStore) Load(doc PolicyDocument) error {
+	policies := make(map[string]Policy, len(doc.Policies))
+	for _, p := range doc.Policies {
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("policy %q: %w", p.ID, err)
+		}
+		if _, dup := policies[p.ID]; dup {
+			return fmt.Errorf("policy %q: %w", p.ID, errPolicyExists)
+		}
+		p.CreatedAt, p.UpdatedAt = s.now().UTC(), s.now().UTC()
+		policies[p.ID] = p
+	}
+	for role, scopes := range doc.Roles {
+		for _, scope := range scopes {
+			if !isPlatformScope(scope) {
+				return fmt.Errorf("role %q: unknown scope %q", role, scope)
+			}
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.roles = doc.Roles
+	if s.roles == nil {
+		s.roles = make(map[string][]string)
+	}
+	s.policies = policies
+	return nil
+}
+
+// List returns the policies ordered by ID
+func (s *PolicyStore) List() []Policy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]Policy, 0, len(s.policies))
+	for _, p := range s.policies {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// Get returns one policy
+func (s *PolicyStore) Get(id string) (Policy, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, ok := s.policies[id]
+	if !ok {
+		return Policy{}, errPolicyNotFound
+	}
+	return p, nil
+}
+
+// Put stores p. With create set an existing policy is an error; otherwise it is
+// replaced, keeping its creation time.
+func (s *PolicyStore) Put(p Policy, create bool) (Policy, error) {
+	if err := p.validate(); err != nil {
+		return Policy{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now().UTC()
+	p.CreatedAt, p.UpdatedAt = now, now
+	if existing, ok := s.policies[p.ID]; ok {
+		if create {
+			return Policy{}, errPolicyExists
+		}
+		p.CreatedAt = existing.CreatedAt
+	}
+	s.policies[p.ID] = p
+	return p, nil
+}
+
+// Delete removes a policy
+func (s *PolicyStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.policies[id]; !ok {
+		return errPolicyNotFound
+	}
+	delete(s.policies, id)
+	return nil
+}
+
+// Roles returns the role bundles
+func (s *PolicyStore) Roles() map[string][]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make(map[string][]string, len(s.roles))
+	for role, scopes := range s.roles {
+		out[role] = append([]string(nil), scopes...)
+	}
+	return out
+}
+
+// SetRole defines or replaces a role's scope bundle
+func (s *PolicyStore) SetRole(role string, scopes []string) error {
+	if !policyIDPattern.MatchString(role) {
+		return errors.New("role must be 1-64 lowercase letters, digits, '.', '_' or '-'")
+	}
+	for _, scope := range scopes {
+		if !isPlatformScope(scope) {
+			return fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.roles[role] = append([]string{}, scopes...)
+	return nil
+}
+
+// EffectiveScopes returns the subject's token scopes plus its role's bundle
+func (s *PolicyStore) EffectiveScopes(subject Subject) []string {
+	s.mu.RLock()
+	bundle := s.roles[subject.Role]
+	s.mu.RUnlock()
+	held := make(map[string]bool)
+	for _, scope := range append(append([]string(nil), subject.Scopes...), bundle...) {
+		held[scope] = true
+	}
+	out := make([]string, 0, len(held))
+	for _, scope := range platformScopes {
+		if held[scope] {
+			out = append(out, scope)
+		}
+	}
+	return out
+}
+
+// Decide evaluates the policies: any matching deny wins, otherwise the first matching
+// allow by policy ID, otherwise the request is denied
+func (s *PolicyStore) Decide(_ context.Context, subject Subject, req AuthorizeRequest) (Decision, error) {
+	subject.Scopes = s.EffectiveScopes(subject)
+	allowedBy := ""
+	for _, p := range s.List() {
+		if !p.matches(subject, req) {
+			continue
+		}
+		if p.Effect == EffectDeny {
+			return Decision{Decision: EffectDeny, PolicyID: p.ID, Reason: "denied by policy " + p.ID}, nil
+		}
+		if allowedBy == "" {
+			allowedBy = p.ID
+		}
+	}
+	if allowedBy != "" {
+		return Decision{Allowed: true, Decision: EffectAllow, PolicyID: allowedBy, Reason: "allowed by policy " + allowedBy}, nil
+	}
+	return Decision{Decision: EffectDeny, Reason: fmt.Sprintf("no policy allows %s on %s/%s", req.Action, req.Resource.Type, req.Resource.ID)}, nil
+}
+
+// matches reports whether the policy applies to the request
+func (p Policy) matches(subject Subject, req AuthorizeRequest) bool {
+	if len(p.Roles) > 0 && !contains(p.Roles, subject.Role) {
+		return false
+	}
+	for _, scope := range p.Scopes {
+		if !contains(subject.Scopes, scope) {
+			return false
+		}
+	}
+	if !contains(p.Actions, "*") && !contains(p.Actions, req.Action) {
+		return false
+	}
+	resource := req.Resource.Type + "/" + req.Resource.ID
+	matched := false
+	for _, pattern := range p.Resources {
+		if ok, _ := path.Match(pattern, resource); ok || pattern == "*" {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return false
+	}
+	for _, c := range p.Conditions {
+		if !c.holds(subject, req) {
+			return false
+		}
+	}
+	return true
+}
+
+// holds evaluates the condition against the request's attributes
+func (c Condition) holds(subject Subject, req AuthorizeRequest) bool {
+	value, ok := attributeValue(c.Attribute, subject, req)
+	if !ok {
+		return false
+	}
+	want := c.Value
+	if c.Ref != "" {
+		if want, ok = attributeValue(c.Ref, subject, req); !ok {
+			return false
+		}
+	}
+	switch c.Operator {
+	case OperatorEquals:
+		return value == want
+	case OperatorNotEquals:
+		return value != want
+	case OperatorIn:
+		return contains(c.Values, value)
+	}
+	return false
+}
+
+func attributeValue(name string, subject Subject, req AuthorizeRequest) (string, bool) {
+	scope, key, _ := strings.Cut(name, ".")
+	var value string
+	switch scope {
+	case "subject":
+		switch key {
+		case "user_id":
+			value = subject.UserID
+		case "role":
+			value = subject.Role
+		case "issuer":
+			value = subject.Issuer
+		}
+	case "resource":
+		switch key {
+		case "type":
+			value = req.Resource.Type
+		case "id":
+			value = req.Resource.ID
+		default:
+			value = req.Resource.Attributes[key]
+		}
+	case "context":
+		value = req.Context[key]
+	}
+	return value, value != ""
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// OPADecider delegates decisions to an Open Policy Agent server. The input is the
+// subject, with its role's scopes added, and the request; the rule at Path must
+// return a boolean or an object with allow and, optionally, reason.
+type OPADecider struct {
+	URL    string
+	Path   string
+	Store  *PolicyStore
+	client *http.Client
+}
+
+// NewOPADecider creates a decider querying <url>/v1/data/<policyPath>
+func NewOPADecider(url, policyPath string, store *PolicyStore) *OPADecider {
+	return &OPADecider{
+		URL:    strings.TrimRight(url, "/"),
+		Path:   strings.Trim(policyPath, "/"),
+		Store:  store,
+		client: &http.Client{Timeout: 2 * time.Second},
+	}
+}
+
+// Decide asks OPA; an unreachable or malformed answer is an error, never an allow
+func (o *OPADecider) Decide(ctx context.Context, subject Subject, req AuthorizeRequest) (Decision, error) {
+	subject.Scopes = o.Store.EffectiveScopes(subject)
+	input := map[string]interface{}{
+		"subject":  subject,
+		"action":   req.Action,
+		"resource": req.Resource,
+		"context":  req.Context,
+	}
+	body, _ := json.Marshal(map[string]interface{}{"input": input})
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, o.URL+"/v1/data/"+o.Path, bytes.NewReader(body))
+	if err != nil {
+		return Decision{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	resp, err := o.client.Do(httpReq)
+	if err != nil {
+		return Decision{}, fmt.Errorf("opa: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Decision{}, fmt.Errorf("opa: status %d", resp.StatusCode)
+	}
+	var out struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return Decision{}, fmt.Errorf("opa: %w", err)
+	}
+	var result struct {
+		Allow  bool   `json:"allow"`
+		Reason string `json:"reason"`
+	}
+	if err := json.Unmarshal(out.Result, &result.Allow); err != nil {
+		if err := json.Unmarshal(out.Result, &result); err != nil || len(out.Result) == 0 {
+			return Decision{}, fmt.Errorf("opa: %s returned no allow decision", o.Path)
+		}
+	}
+	decision := Decision{Allowed: result.Allow, Decision: EffectDeny, Reason: result.Reason}
+	if result.Allow {
+		decision.Decision = EffectAllow
+	}
+	if decision.Reason == "" {
+		decision.Reason = fmt.Sprintf("%s by OPA %s", decision.Decision, o.Path)
+	}
+	return decision, nil
+}
+
+var (
+	// policyStore holds the local roles and policies
+	policyStore = NewPolicyStore()
+	// policyDecider makes decisions: policyStore, or OPA when OPA_URL is set
+	policyDecider Decider = policyStore
+)
+
+// configurePolicies loads POLICY_FILE over the defaults and switches decisions to
+// OPA when OPA_URL is set
+func configurePolicies() error {
+	if file := config.GetEnv("POLICY_FILE", ""); file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		var doc PolicyDocument
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		if err := policyStore.Load(doc); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		logger.Info().Str("file", file).Int("policies", len(doc.Policies)).Int("roles", len(doc.Roles)).Msg("Authorization policies loaded")
+	}
+	if url := config.GetEnv("OPA_URL", ""); url != "" {
+		opa := NewOPADecider(url, config.GetEnv("OPA_POLICY_PATH", "healthcare/authz"), policyStore)
+		policyDecider = opa
+		logger.Info().Str("url", opa.URL).Str("path", opa.Path).Msg("Authorization decisions delegated to OPA")
+	}
+	return nil
+}
+
+// bearerClaims validates the request's bearer token. Invalid tokens count towards the
+// IP's lockout, and towards the user's only when they were genuinely issued to them;
+// while the IP or the token's user is locked out the error is a *LockoutError.
+func bearerClaims(r *http.Request) (*TokenClaims, error) {
+	authHeader := r.Header.Get("Authorization")
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	if authHeader == "" || tokenString == authHeader {
+		return nil, errors.New("missing bearer token")
+	}
+	if err := checkLockout(r, "", false); err != nil {
+		return nil, err
+	}
+	claims, err := validateToken(tokenString)
+	if err != nil {
+		recordAuthFailure(r, rejectedUserID(tokenString, err))
+		return nil, err
+	}
+	if claims.ExpiresAt != nil && claims.ExpiresAt.Before(time.Now()) {
+		return nil, errors.New("token expired")
+	}
+	if err := checkLockout(r, claims.UserID, false); err != nil {
+		return nil, err
+	}
+	recordAuthSuccess(claims.UserID)
+	return claims, nil
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+// Authorize handles POST /authorize: a decision on whether the bearer of the token may
+// perform the action on the resource. Services forward their caller's token. A denial
+// is a 200 response with allowed false.
+func (h AuthHandler) Authorize(w http.ResponseWriter, r *http.Request) {
+	SecurityHeaders(w, r)
+	ctx, span := tracer.Start(r.Context(), "authorize")
+	defer span.End()
+
+	claims, err := bearerClaims(r)
+	if writeLockoutError(w, err) {
+		return
+	}
+	if err != nil {
+		recordSecurityEvent(r, "authorization_token_invalid", "warning", "")
+		writeJSONError(w, http.StatusUnauthorized, "Invalid or missing token")
+		return
+	}
+	var req AuthorizeRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPolicyBody)).Decode(&req); err != nil || req.Action == "" || req.Resource.Type == "" {
+		writeJSONError(w, http.StatusBadRequest, "action and resource.type are required")
+		return
+	}
+
+	subject := Subject{UserID: claims.UserID, Role: claims.Role, Scopes: claims.Scopes, Issuer: claims.Issuer}
+	decision, err := policyDecider.Decide(ctx, subject, req)
+	if err != nil {
+		authorizationDecisions.WithLabelValues("error", req.Action).Inc()
+		logger.Error().Err(err).Str("user_id", subject.UserID).Str("action", req.Action).Msg("Authorization decision failed")
+		writeJSONError(w, http.StatusBadGateway, "Authorization decision unavailable")
+		return
+	}
+
+	authorizationDecisions.WithLabelValues(decision.Decision, req.Action).Inc()
+	span.SetAttributes(
+		attribute.String("user.id", subject.UserID),
+		attribute.String("authz.action", req.Action),
+		attribute.String("authz.resource", req.Resource.Type+"/"+req.Resource.ID),
+		attribute.String("authz.decision", decision.Decision),
+		attribute.String("authz.policy", decision.PolicyID),
+	)
+	if !decision.Allowed {
+		recordSecurityEvent(r, "authorization_denied", "info", subject.UserID)
+		logger.Info().
+			Str("user_id", subject.UserID).
+			Str("action", req.Action).
+			Str("resource", req.Resource.Type+"/"+req.Resource.ID).
+			Str("policy_id", decision.PolicyID).
+			Msg("Authorization denied")
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(decision)
+}
+
+// requireAdmin lets only callers holding the admin scope through
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		SecurityHeaders(w, r)
+		claims, err := bearerClaims(r)
+		if writeLockoutError(w, err) {
+			return
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusUnauthorized, "Invalid or missing token")
+			return
+		}
+		audit.SetActor(r.Context(), claims.UserID)
+		if !contains(claims.Scopes, "admin") {
+			recordSecurityEvent(r, "policy_admin_forbidden", "warning", claims.UserID)
+			writeJSONError(w, http.StatusForbidden, "admin scope required")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// ListPolicies handles GET /api/v1/policies: the role bundles and policies
+func (h AuthHandler) ListPolicies(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(PolicyDocument{Roles: policyStore.Roles(), Policies: policyStore.List()})
+}
+
+// GetPolicy handles GET /api/v1/policies/{id}
+func (h AuthHandler) GetPolicy(w http.ResponseWriter, r *http.Request) {
+	p, err := policyStore.Get(r.PathValue("id"))
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(p)
+}
+
+// CreatePolicy handles POST /api/v1/policies
+func (h AuthHandler) CreatePolicy(w http.ResponseWriter, r *http.Request) {
+	h.putPolicy(w, r, "", true)
+}
+
+// ReplacePolicy handles PUT /api/v1/policies/{id}, creating the policy if it is new
+func (h AuthHandler) ReplacePolicy(w http.ResponseWriter, r *http.Request) {
+	h.putPolicy(w, r, r.PathValue("id"), false)
+}
+
+func (h AuthHandler) putPolicy(w http.ResponseWriter, r *http.Request, id string, create bool) {
+	var p Policy
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPolicyBody)).Decode(&p); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if id != "" {
+		p.ID = id
+	}
+	stored, err := policyStore.Put(p, create)
+	switch {
+	case errors.Is(err, errPolicyExists):
+		writeJSONError(w, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	recordSecurityEvent(r, "policy_changed", "info", "")
+	logger.Info().Str("policy_id", stored.ID).Str("effect", stored.Effect).Msg("Authorization policy stored")
+
+	status := http.StatusOK
+	if create {
+		status = http.StatusCreated
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(stored)
+}
+
+// DeletePolicy handles DELETE /api/v1/policies/{id}
+func (h AuthHandler) DeletePolicy(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := policyStore.Delete(id); err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	recordSecurityEvent(r, "policy_changed", "info", "")
+	logger.Info().Str("policy_id", id).Msg("Authorization policy deleted")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetRole handles PUT /api/v1/roles/{role}: the scopes the role carries
+func (h AuthHandler) SetRole(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Scopes []string `json:"scopes"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPolicyBody)).Decode(&body); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	role := r.PathValue("role")
+	if err := policyStore.SetRole(role, body.Scopes); err != nil {
+		writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	recordSecurityEvent(r, "policy_changed", "info", "")
+	logger.Info().Str("role", role).Strs("scopes", body.Scopes).Msg("Role scopes updated")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"role": role, "scopes": policyStore.Roles()[role]})
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// usePolicyStore gives the test fresh default policies and restores the previous ones after
+func usePolicyStore(t *testing.T) *PolicyStore {
+	t.Helper()
+	previousStore, previousDecider := policyStore, policyDecider
+	policyStore = NewPolicyStore()
+	policyDecider = policyStore
+	t.Cleanup(func() { policyStore, policyDecider = previousStore, previousDecider })
+	return policyStore
+}
+
+func testToken(t *testing.T, userID, role string, scopes ...string) string {
+	t.Helper()
+	tokenString, err := signToken(TokenClaims{
+		UserID: userID,
+		Role:   role,
+		Scopes: scopes,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(tokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    "auth-service",
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return tokenString
+}
+
+func serve(t *testing.T, method, target, token, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	StartAuthServer(":0").Handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func decide(t *testing.T, token, body string) Decision {
+	t.Helper()
+	rr := serve(t, http.MethodPost, "/authorize", token, body)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 from /authorize got %d: %s", rr.Code, rr.Body)
+	}
+	var decision Decision
+	if err := json.Unmarshal(rr.Body.Bytes(), &decision); err != nil {
+		t.Fatalf("failed to parse decision: %v", err)
+	}
+	return decision
+}
+
+// TestDefaultPolicies verifies scopes, directly or through a role bundle, allow their action on their domain's resources
+func TestDefaultPolicies(t *testing.T) {
+	store := usePolicyStore(t)
+	read := AuthorizeRequest{Action: "read", Resource: Resource{Type: "phi", ID: "patient-1"}}
+	write := AuthorizeRequest{Action: "write", Resource: Resource{Type: "phi", ID: "patient-1"}}
+
+	cases := []struct {
+		name    string
+		subject Subject
+		req     AuthorizeRequest
+		allowed bool
+	}{
+		{"scope allows its action", Subject{Role: "user", Scopes: []string{"phi:read"}}, read, true},
+		{"scope does not allow another action", Subject{Role: "user", Scopes: []string{"phi:read"}}, write, false},
+		{"scope does not reach another domain", Subject{Role: "user", Scopes: []string{"payment:write"}}, write, false},
+		{"role bundle grants scopes", Subject{Role: "phi_manager"}, write, true},
+		{"admin allows everything", Subject{Role: "user", Scopes: []string{"admin"}}, AuthorizeRequest{Action: "purge", Resource: Resource{Type: "device", ID: "d-1"}}, true},
+		{"nothing held", Subject{Role: "user"}, read, false},
+	}
+	for _, tc := range cases {
+		decision, err := store.Decide(context.Background(), tc.subject, tc.req)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if decision.Allowed != tc.allowed {
+			t.Errorf("%s: expected allowed=%v, got %+v", tc.name, tc.allowed, decision)
+		}
+	}
+}
+
+// TestPolicyConditions verifies attribute conditions and that a matching deny overrides any allow
+func TestPolicyConditions(t *testing.T) {
+	store := usePolicyStore(t)
+	mustPut := func(p Policy) {
+		t.Helper()
+		if _, err := store.Put(p, true); err != nil {
+			t.Fatalf("failed to store %s: %v", p.ID, err)
+		}
+	}
+	mustPut(Policy{
+		ID: "own-records", Effect: EffectAllow, Actions: []string{"read"}, Resources: []string{"record/*"},
+		Conditions: []Condition{{Attribute: "resource.owner", Operator: OperatorEquals, Ref: "subject.user_id"}},
+	})
+	mustPut(Policy{
+		ID: "no-research-export", Effect: EffectDeny, Actions: []string{"*"}, Resources: []string{"*"},
+		Conditions: []Condition{{Attribute: "context.purpose", Operator: OperatorIn, Values: []string{"research", "marketing"}}},
+	})
+
+	subject := Subject{UserID: "u1", Role: "user"}
+	own := AuthorizeRequest{Action: "read", Resource: Resource{Type: "record", ID: "r1", Attributes: map[string]string{"owner": "u1"}}}
+	if d, _ := store.Decide(context.Background(), subject, own); !d.Allowed || d.PolicyID != "own-records" {
+		t.Fatalf("expected owner to read own record, got %+v", d)
+	}
+	other := own
+	other.Resource.Attributes = map[string]string{"owner": "u2"}
+	if d, _ := store.Decide(context.Background(), subject, other); d.Allowed {
+		t.Fatalf("expected another user's record to be denied, got %+v", d)
+	}
+	noOwner := own
+	noOwner.Resource.Attributes = nil
+	if d, _ := store.Decide(context.Background(), subject, noOwner); d.Allowed {
+		t.Fatalf("expected a missing attribute not to match, got %+v", d)
+	}
+
+	research := own
+	research.Context = map[string]string{"purpose": "research"}
+	if d, _ := store.Decide(context.Background(), Subject{UserID: "u1", Scopes: []string{"admin"}}, research); d.Allowed || d.PolicyID != "no-research-export" {
+		t.Fatalf("expected deny to override admin, got %+v", d)
+	}
+
+	invalid := []Policy{
+		{ID: "Bad ID", Effect: EffectAllow, Actions: []string{"read"}, Resources: []string{"*"}},
+		{ID: "p", Effect: "maybe", Actions: []string{"read"}, Resources: []string{"*"}},
+		{ID: "p", Effect: EffectAllow, Resources: []string{"*"}},
+		{ID: "p", Effect: EffectAllow, Actions: []string{"read"}, Resources: []string{"["}},
+		{ID: "p", Effect: EffectAllow, Actions: []string{"read"}, Resources: []string{"*"}, Scopes: []string{"superuser"}},
+		{ID: "p", Effect: EffectAllow, Actions: []string{"read"}, Resources: []string{"*"}, Conditions: []Condition{{Attribute: "owner", Operator: OperatorEquals, Value: "x"}}},
+		{ID: "p", Effect: EffectAllow, Actions: []string{"read"}, Resources: []string{"*"}, Conditions: []Condition{{Attribute: "resource.owner", Operator: OperatorEquals}}},
+		{ID: "p", Effect: EffectAllow, Actions: []string{"read"}, Resources: []string{"*"}, Conditions: []Condition{{Attribute: "resource.owner", Operator: "matches", Value: "x"}}},
+	}
+	for _, p := range invalid {
+		if err := p.validate(); err == nil {
+			t.Errorf("expected %+v to be rejected", p)
+		}
+	}
+}
+
+// TestAuthorizeEndpoint verifies decisions are made for the bearer of the forwarded token
+func TestAuthorizeEndpoint(t *testing.T) {
+	usePolicyStore(t)
+	body := `{"action":"read","resource":{"type":"payment","id":"TXN-1"}}`
+
+	if d := decide(t, testToken(t, "u1", "payment_processor"), body); !d.Allowed || d.PolicyID != "scope.payment.read" {
+		t.Fatalf("expected payment_processor to read payments, got %+v", d)
+	}
+	if d := decide(t, testToken(t, "u2", "phi_analyst"), body); d.Allowed || d.Decision != EffectDeny || d.Reason == "" {
+		t.Fatalf("expected phi_analyst to be denied, got %+v", d)
+	}
+	if rr := serve(t, http.MethodPost, "/authorize", "", body); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without a token, got %d", rr.Code)
+	}
+	if rr := serve(t, http.MethodPost, "/authorize", testToken(t, "u1", "admin"), `{"resource":{"type":"payment"}}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without an action, got %d", rr.Code)
+	}
+}
+
+// TestPolicyManagementAPI verifies admins can manage policies and roles and others cannot
+func TestPolicyManagementAPI(t *testing.T) {
+	usePolicyStore(t)
+	admin := testToken(t, "root", "admin", "admin")
+	policy := `{"id":"billing-export","effect":"allow","roles":["auditor"],"actions":["export"],"resources":["payment/*"]}`
+
+	if rr := serve(t, http.MethodPost, "/api/v1/policies", testToken(t, "u1", "user", "payment:write"), policy); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 without admin scope, got %d", rr.Code)
+	}
+	if rr := serve(t, http.MethodPost, "/api/v1/policies", admin, policy); rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body)
+	}
+	if rr := serve(t, http.MethodPost, "/api/v1/policies", admin, policy); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for a duplicate, got %d", rr.Code)
+	}
+	if rr := serve(t, http.MethodPost, "/api/v1/policies", admin, `{"id":"x","effect":"allow"}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for an invalid policy, got %d", rr.Code)
+	}
+
+	exportReq := `{"action":"export","resource":{"type":"payment","id":"TXN-9"}}`
+	auditor := testToken(t, "a1", "auditor")
+	if d := decide(t, auditor, exportReq); !d.Allowed || d.PolicyID != "billing-export" {
+		t.Fatalf("expected new policy to apply, got %+v", d)
+	}
+
+	// Replacing the policy with a narrower resource pattern takes effect at once
+	if rr := serve(t, http.MethodPut, "/api/v1/policies/billing-export", admin, `{"effect":"allow","roles":["auditor"],"actions":["export"],"resources":["payment/ARCHIVE-*"]}`); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 for replace, got %d: %s", rr.Code, rr.Body)
+	}
+	if d := decide(t, auditor, exportReq); d.Allowed {
+		t.Fatalf("expected replaced policy not to match, got %+v", d)
+	}
+
+	// Giving the role a scope bundle grants what the scope's policy allows
+	if rr := serve(t, http.MethodPut, "/api/v1/roles/auditor", admin, `{"scopes":["payment:read"]}`); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 for role update, got %d: %s", rr.Code, rr.Body)
+	}
+	if d := decide(t, auditor, `{"action":"read","resource":{"type":"payment","id":"TXN-9"}}`); !d.Allowed {
+		t.Fatalf("expected role bundle to grant payment:read, got %+v", d)
+	}
+
+	rr := serve(t, http.MethodGet, "/api/v1/policies", admin, "")
+	var doc PolicyDocument
+	if err := json.Unmarshal(rr.Body.Bytes(), &doc); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("expected policy list, got %d: %v", rr.Code, err)
+	}
+	if len(doc.Policies) != len(defaultPolicies())+1 || len(doc.Roles["auditor"]) != 1 {
+		t.Fatalf("unexpected policy document %+v", doc)
+	}
+
+	if rr := serve(t, http.MethodDelete, "/api/v1/policies/billing-export", admin, ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rr.Code)
+	}
+	if rr := serve(t, http.MethodGet, "/api/v1/policies/billing-export", admin, ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 after delete, got %d", rr.Code)
+	}
+}
+
+// TestOPADecider verifies decisions are delegated to OPA with the role's scopes in the input, failing closed
+func TestOPADecider(t *testing.T) {
+	store := usePolicyStore(t)
+	var input map[string]interface{}
+	opa := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/data/healthcare/authz" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var body struct {
+			Input map[string]interface{} `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		input = body.Input
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": map[string]interface{}{"allow": true, "reason": "on-call clinician"}})
+	}))
+	defer opa.Close()
+
+	decider := NewOPADecider(opa.URL+"/", "/healthcare/authz/", store)
+	decision, err := decider.Decide(context.Background(), Subject{UserID: "u1", Role: "phi_analyst"}, AuthorizeRequest{Action: "read", Resource: Resource{Type: "phi", ID: "p1"}})
+	if err != nil || !decision.Allowed || decision.Reason != "on-call clinician" {
+		t.Fatalf("unexpected OPA decision %+v, %v", decision, err)
+	}
+	subject, _ := input["subject"].(map[string]interface{})
+	if scopes, _ := subject["scopes"].([]interface{}); len(scopes) != 1 || scopes[0] != "phi:read" {
+		t.Fatalf("expected role scopes in the OPA input, got %v", input)
+	}
+
+	opa.Close()
+	if decision, err := decider.Decide(context.Background(), Subject{UserID: "u1"}, AuthorizeRequest{Action: "read"}); err == nil || decision.Allowed {
+		t.Fatalf("expected an unreachable OPA to fail closed, got %+v", decision)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestRateLimits verifies callers are limited per route with the limit headers on
+// every response, and that RATE_LIMIT_ROUTES overrides the service's own route limits
+func TestRateLimits(t *testing.T) {
+	t.Setenv("RATE_LIMIT_RPS", "0.01")
+	t.Setenv("RATE_LIMIT_BURST", "2")
+	t.Setenv("RATE_LIMIT_ROUTES", "POST /token=0.01:1")
+	h := StartAuthServer(":0").Handler
+	send := func(method, path, token string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(`{"user_id":"u1","role":"user","scopes":["read"]}`))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for i := 0; i < 2; i++ {
+		if rr := send(http.MethodGet, "/capabilities", ""); rr.Code != http.StatusOK || rr.Header().Get("X-RateLimit-Limit") != "2" {
+			t.Fatalf("request %d: expected 200 with a limit of 2, got %d %v", i+1, rr.Code, rr.Header())
+		}
+	}
+	rr := send(http.MethodGet, "/capabilities", "")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" || rr.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Fatalf("expected 429 with Retry-After, got %d %v", rr.Code, rr.Header())
+	}
+	if rr := send(http.MethodGet, "/health", ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected /health to be exempt, got %d", rr.Code)
+	}
+
+	// Callers are limited by address, whatever token they present
+	if rr := send(http.MethodGet, "/capabilities", testToken(t, "dr-grey", "clinician", "read")); rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected a token not to buy a bucket of its own, got %d", rr.Code)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/capabilities", nil)
+	req.RemoteAddr = "198.51.100.7:40000"
+	req.Header.Set("X-Forwarded-For", "192.0.2.1")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected another address to have its own bucket, got %d", rr.Code)
+	}
+
+	// The environment's /token limit replaces the built-in one
+	admin := testToken(t, "ops", "admin", "admin")
+	if rr := send(http.MethodPost, "/token", admin); rr.Header().Get("X-RateLimit-Limit") != "1" || rr.Code == http.StatusTooManyRequests {
+		t.Fatalf("expected the overridden /token limit of 1, got %d %v", rr.Code, rr.Header())
+	}
+	if rr := send(http.MethodPost, "/token", admin); rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the second token request to be limited, got %d", rr.Code)
+	}
+}
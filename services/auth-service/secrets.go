@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/healthcare-gitops/common/secrets"
+)
+
+// minJWTSecretLength is the shortest JWT_SECRET accepted
+const minJWTSecretLength = 32
+
+// defaultSecretReloadInterval is how often a rotated JWT_SECRET is looked for
+const defaultSecretReloadInterval = time.Minute
+
+var (
+	// previousJWTSecret keeps validating tokens signed before the last reload until
+	// previousJWTSecretUntil, when the last of them has expired
+	previousJWTSecret      []byte
+	previousJWTSecretUntil time.Time
+	jwtSecretMu            sync.RWMutex
+)
+
+// validateJWTSecret checks a JWT_SECRET value
+func validateJWTSecret(secret secrets.Secret) error {
+	if len(secret.Value) < minJWTSecretLength {
+		return fmt.Errorf("JWT_SECRET from %s must be at least %d characters (got %d)", secret.Source, minJWTSecretLength, len(secret.Value))
+	}
+	return nil
+}
+
+// setJWTSecret makes secret the signing key. The key it replaces is still accepted
+// for one token lifetime, so tokens issued before a reload stay valid until they
+// expire.
+func setJWTSecret(secret []byte) {
+	jwtSecretMu.Lock()
+	defer jwtSecretMu.Unlock()
+	if jwtSecret != nil {
+		previousJWTSecret, previousJWTSecretUntil = jwtSecret, time.Now().Add(tokenTTL)
+	}
+	jwtSecret = secret
+}
+
+// signingSecret returns the key new tokens are signed with
+func signingSecret() []byte {
+	jwtSecretMu.RLock()
+	defer jwtSecretMu.RUnlock()
+	return jwtSecret
+}
+
+// verificationSecrets returns the secrets an HMAC token may be signed with, current
+// first. When tokens are signed with an asymmetric key and no JWT_SECRET is kept for
+// tokens issued before the switch, there are none.
+func verificationSecrets() [][]byte {
+	jwtSecretMu.RLock()
+	defer jwtSecretMu.RUnlock()
+	if jwtSecret == nil && currentSigningKey() != nil {
+		return nil
+	}
+	keys := [][]byte{jwtSecret}
+	if previousJWTSecret != nil && time.Now().Before(previousJWTSecretUntil) {
+		keys = append(keys, previousJWTSecret)
+	}
+	return keys
+}
+
+// watchJWTSecret returns a watcher that swaps in a rotated JWT_SECRET
+func watchJWTSecret(provider secrets.Provider, interval time.Duration) *secrets.Watcher {
+	return &secrets.Watcher{
+		Provider: provider,
+		Name:     "JWT_SECRET",
+		Interval: interval,
+		OnChange: func(secret secrets.Secret) error {
+			if err := validateJWTSecret(secret); err != nil {
+				recordSecurityEvent(nil, "jwt_secret_reload_failed", "error", "")
+				return err
+			}
+			setJWTSecret([]byte(secret.Value))
+			recordSecurityEvent(nil, "jwt_secret_reloaded", "info", "")
+			logger.Info().Str("source", secret.Source).Str("version", secret.Version).Msg("JWT secret reloaded")
+			return nil
+		},
+		OnError: func(err error) {
+			logger.Error().Err(err).Msg("JWT secret reload failed")
+		},
+	}
+}
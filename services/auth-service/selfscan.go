@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/healthcare-gitops/common/selfscan"
+)
+
+// selfScanTarget describes this service to the security misconfiguration self-scan
+// served at /admin/selfscan
+func selfScanTarget(handler http.Handler) selfscan.Target {
+	return selfscan.Target{
+		Service: "auth-service",
+		Handler: handler,
+		// Every GET route only admins may call; TestSelfScanCoversAdminRoutes fails
+		// when one is missing
+		AdminRoutes: []string{
+			"/admin/observability/spec",
+			"/admin/selfscan",
+			"/admin/usage-stats",
+			"/api/v1/apikeys",
+			"/api/v1/apikeys/{id}",
+			"/api/v1/policies",
+			"/api/v1/policies/{id}",
+			"/api/v1/audit/tokens",
+			breakGlassPath,
+			"/compliance/status",
+		},
+		Secrets: map[string]string{"JWT_SECRET": string(signingSecret())},
+	}
+}
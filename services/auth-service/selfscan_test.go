@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/healthcare-gitops/common/selfscan"
+)
+
+// TestSelfScan verifies the scan is admin only, finds the admin routes protected and
+// reports a published default JWT_SECRET without revealing it
+func TestSelfScan(t *testing.T) {
+	t.Setenv("ENV", "production")
+	previous := signingSecret()
+	setJWTSecret([]byte("super-secret-key-change-in-production-please"))
+	t.Cleanup(func() { setJWTSecret(previous) })
+
+	if rr := serve(t, http.MethodGet, "/admin/selfscan", "", ""); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without a token, got %d", rr.Code)
+	}
+	if rr := serve(t, http.MethodGet, "/admin/selfscan", testToken(t, "nurse-7", "user", "phi:read"), ""); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for non-admin, got %d", rr.Code)
+	}
+
+	rr := serve(t, http.MethodGet, "/admin/selfscan", testToken(t, "root", "admin", "admin"), "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 from the self-scan, got %d: %s", rr.Code, rr.Body)
+	}
+	var report selfscan.Report
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Service != "auth-service" || !report.Production {
+		t.Fatalf("expected a production scan of auth-service, got %+v", report)
+	}
+	if len(report.Findings) != 1 || report.Findings[0].Check != selfscan.CheckSecrets || report.Findings[0].Severity != selfscan.Critical {
+		t.Fatalf("expected only the default JWT_SECRET to be reported, got %+v", report.Findings)
+	}
+	if report.RiskScore != 40 || report.RiskLevel != "medium" {
+		t.Fatalf("expected a medium risk score of 40, got %d %s", report.RiskScore, report.RiskLevel)
+	}
+	if strings.Contains(rr.Body.String(), "super-secret") {
+		t.Fatal("the report must not contain the secret")
+	}
+}
+
+// TestSelfScanCoversAdminRoutes verifies every GET route in openapi.yaml that serves an
+// admin token but refuses one with every other scope is among the routes the self-scan
+// probes
+func TestSelfScanCoversAdminRoutes(t *testing.T) {
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(serve(t, http.MethodGet, "/openapi.json", "", "").Body.Bytes(), &spec); err != nil {
+		t.Fatal(err)
+	}
+	admin := testToken(t, "root", "admin", "admin")
+	others := testToken(t, "ops", "user", "payment:read", "payment:write", "phi:read", "phi:write")
+	refused := func(route, token string) bool {
+		code := serve(t, http.MethodGet, route, token, "").Code
+		return code == http.StatusUnauthorized || code == http.StatusForbidden
+	}
+	listed := selfScanTarget(nil).AdminRoutes
+
+	for route, operations := range spec.Paths {
+		if _, ok := operations["get"]; !ok {
+			continue
+		}
+		if !refused(route, others) || refused(route, admin) {
+			continue
+		}
+		covered := false
+		for _, path := range listed {
+			covered = covered || routeMatches(route, path)
+		}
+		if !covered {
+			t.Errorf("GET %s is admin-only but not among the self-scan's admin routes", route)
+		}
+	}
+}
+
+// routeMatches reports whether path is served by the OpenAPI route template
+func routeMatches(route, path string) bool {
+	routeSegments, pathSegments := strings.Split(route, "/"), strings.Split(path, "/")
+	if len(routeSegments) != len(pathSegments) {
+		return false
+	}
+	for i, segment := range routeSegments {
+		if segment != pathSegments[i] && !strings.HasPrefix(segment, "{") {
+			return false
+		}
+	}
+	return true
+}
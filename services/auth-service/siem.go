@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/healthcare-gitops/common/siem"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var siemEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "auth_siem_events_total",
+	Help: "Security and audit events exported to the SIEM collector by result",
+}, []string{"result"})
+
+// siemExporter forwards security events and audit bus events to the SIEM collector
+// SIEM_ENDPOINT names; nil, which discards them, when it is unset
+var siemExporter *siem.Exporter
+
+// configureSIEM starts the exporter SIEM_ENDPOINT configures
+func configureSIEM() error {
+	cfg := siem.ConfigFromEnv("auth-service", apiSpecVersion)
+	cfg.OnDeliver = func(_, result string) {
+		siemEvents.WithLabelValues(result).Inc()
+	}
+	cfg.OnError = func(err error) {
+		logger.Warn().Err(err).Msg("SIEM collector unavailable, security event dropped")
+	}
+	exporter, err := siem.New(cfg)
+	if err != nil {
+		return err
+	}
+	siemExporter = exporter
+	return nil
+}
+
+// recordSecurityEvent counts a security event and exports it to the SIEM. r is nil for
+// events raised outside a request, such as secret reloads; actor is the user the
+// event concerns, when known.
+func recordSecurityEvent(r *http.Request, eventType, severity, actor string) {
+	securityEvents.WithLabelValues(eventType, severity).Inc()
+	if siemExporter == nil {
+		return
+	}
+	ev := siem.Event{Name: eventType, Severity: severity, Actor: actor}
+	if r != nil {
+		ev.SourceIP = clientIP(r)
+		ev.Resource = r.URL.Path
+		ev.TraceID = traceIDFromContext(r.Context())
+	}
+	siemExporter.Send(ev)
+}
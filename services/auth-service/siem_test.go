@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/healthcare-gitops/common/siem"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// fakeCollector accepts syslog over TCP and reports the octet-counted messages it
+// receives
+func fakeCollector(t *testing.T) (endpoint string, messages chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	messages = make(chan string, 16)
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					length, err := r.ReadString(' ')
+					if err != nil {
+						return
+					}
+					size, err := strconv.Atoi(strings.TrimSpace(length))
+					if err != nil {
+						t.Errorf("message not octet-counted: %q", length)
+						return
+					}
+					buf := make([]byte, size)
+					if _, err := io.ReadFull(r, buf); err != nil {
+						return
+					}
+					messages <- string(buf)
+				}
+			}(conn)
+		}
+	}()
+	return ln.Addr().String(), messages
+}
+
+func useSIEM(t *testing.T, endpoint string) {
+	t.Helper()
+	t.Setenv("SIEM_ENDPOINT", endpoint)
+	t.Setenv("SIEM_TRANSPORT", siem.TransportTCP)
+	t.Setenv("SIEM_FORMAT", siem.FormatCEF)
+	t.Setenv("SIEM_RATE_LIMIT", "0.001")
+	t.Setenv("SIEM_BURST", "2")
+	previous := siemExporter
+	if err := configureSIEM(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { siemExporter = previous })
+}
+
+func TestSecurityEventsAreExportedToSIEM(t *testing.T) {
+	useTokenAudit(t)
+	useLoginGuard(t, defaultLockoutConfig)
+	endpoint, messages := fakeCollector(t)
+	useSIEM(t, endpoint)
+	sent := testutil.ToFloat64(siemEvents.WithLabelValues(siem.ResultSent))
+	limited := testutil.ToFloat64(siemEvents.WithLabelValues(siem.ResultRateLimited))
+
+	// Five refused introspections against a burst of two
+	for i := 0; i < 5; i++ {
+		req, _ := http.NewRequest(http.MethodGet, "/introspect", nil)
+		req.RemoteAddr = "203.0.113.9:4711"
+		StartAuthServer(":0").Handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if err := siemExporter.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		var msg string
+		select {
+		case msg = <-messages:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only %d events reached the collector", i)
+		}
+		// <authpriv.warning>1 TIMESTAMP HOST APP - MSGID - CEF
+		if !strings.HasPrefix(msg, "<84>1 ") {
+			t.Errorf("unexpected syslog header in %q", msg)
+		}
+		for _, want := range []string{
+			" auth-service - missing_token - CEF:0|healthcare-gitops|auth-service|" + apiSpecVersion + "|missing_token|missing_token|6|",
+			" src=203.0.113.9", " request=/introspect",
+		} {
+			if !strings.Contains(msg, want) {
+				t.Errorf("%q missing from %q", want, msg)
+			}
+		}
+	}
+
+	if stats := siemExporter.Stats(); stats.Sent != 2 || stats.RateLimited != 3 {
+		t.Errorf("expected 2 sent and 3 rate limited, got %+v", stats)
+	}
+	if got := testutil.ToFloat64(siemEvents.WithLabelValues(siem.ResultSent)) - sent; got != 2 {
+		t.Errorf("auth_siem_events_total{result=\"sent\"} rose by %v", got)
+	}
+	if got := testutil.ToFloat64(siemEvents.WithLabelValues(siem.ResultRateLimited)) - limited; got != 3 {
+		t.Errorf("auth_siem_events_total{result=\"rate_limited\"} rose by %v", got)
+	}
+}
+
+func TestAuditEventsAreForwardedToSIEM(t *testing.T) {
+	endpoint, messages := fakeCollector(t)
+	useSIEM(t, endpoint)
+	t.Setenv("AUDIT_SINK", "stdout")
+	previous := auditEvents
+	if err := configureAuditEvents(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { auditEvents = previous })
+
+	req, _ := http.NewRequest(http.MethodGet, "/introspect", nil)
+	req.RemoteAddr = "198.51.100.4:1000"
+	emitRefusedCredential(req, TokenAuditEvent{Time: time.Now(), Event: TokenEventIntrospected, UserID: "mallory", Result: TokenResultInvalid, IP: "198.51.100.4"})
+	if err := auditEvents.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := siemExporter.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case msg := <-messages:
+		for _, want := range []string{"|auth." + TokenEventIntrospected + "|", " outcome=denied", " suser=mallory", " result=" + TokenResultInvalid} {
+			if !strings.Contains(msg, want) {
+				t.Errorf("%q missing from %q", want, msg)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("audit event not forwarded")
+	}
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/healthcare-gitops/common/secrets"
+)
+
+// minRSAKeyBits is the smallest RSA signing key accepted
+const minRSAKeyBits = 2048
+
+// Signing algorithms selectable with JWT_SIGNING_ALGORITHM
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+	AlgorithmHS256 = "HS256"
+)
+
+// jwksPath is where the public signing keys are published
+const jwksPath = "/.well-known/jwks.json"
+
+// SigningKey is a private key tokens are signed with. Its ID is the RFC 7638
+// thumbprint of the public key, so every replica loading the same key agrees on it.
+type SigningKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	private crypto.Signer
+}
+
+// retiredSigningKey is a replaced key still published and accepted until the last
+// token it signed has expired
+type retiredSigningKey struct {
+	key   *SigningKey
+	until time.Time
+}
+
+var (
+	// signingKey signs new tokens; nil when tokens are HS256-signed with the JWT secret
+	signingKey         *SigningKey
+	retiredSigningKeys []retiredSigningKey
+	signingKeyMu       sync.RWMutex
+)
+
+// newSigningKey wraps an RSA or Ed25519 private key
+func newSigningKey(key interface{}) (*SigningKey, error) {
+	var signer crypto.Signer
+	var method jwt.SigningMethod
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA signing key must be at least %d bits (got %d)", minRSAKeyBits, k.N.BitLen())
+		}
+		signer, method = k, jwt.SigningMethodRS256
+	case ed25519.PrivateKey:
+		signer, method = k, jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported signing key type %T; use RSA or Ed25519", key)
+	}
+	jwk := publicJWK(signer.Public(), method.Alg(), "")
+	return &SigningKey{ID: jwk.thumbprint(), Method: method, private: signer}, nil
+}
+
+// parseSigningKey reads a PEM-encoded PKCS#8 or PKCS#1 private key
+func parseSigningKey(value string) (*SigningKey, error) {
+	block, _ := pem.Decode([]byte(value))
+	if block == nil {
+		return nil, errors.New("signing key is not PEM-encoded")
+	}
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q; expected PRIVATE KEY or RSA PRIVATE KEY", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("signing key: %w", err)
+	}
+	return newSigningKey(key)
+}
+
+// generateSigningKey creates a key for algorithm, for when none is configured
+func generateSigningKey(algorithm string) (*SigningKey, error) {
+	switch algorithm {
+	case AlgorithmRS256:
+		key, err := rsa.GenerateKey(rand.Reader, minRSAKeyBits)
+		if err != nil {
+			return nil, err
+		}
+		return newSigningKey(key)
+	case AlgorithmEdDSA:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return newSigningKey(key)
+	}
+	return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+}
+
+// setSigningKey makes key the one new tokens are signed with. The key it replaces
+// stays published and accepted for one token lifetime.
+func setSigningKey(key *SigningKey) {
+	signingKeyMu.Lock()
+	defer signingKeyMu.Unlock()
+	now := time.Now()
+	kept := retiredSigningKeys[:0]
+	for _, retired := range retiredSigningKeys {
+		if now.Before(retired.until) && retired.key.ID != key.ID {
+			kept = append(kept, retired)
+		}
+	}
+	if signingKey != nil && signingKey.ID != key.ID {
+		kept = append(kept, retiredSigningKey{key: signingKey, until: now.Add(tokenTTL)})
+	}
+	retiredSigningKeys = kept
+	signingKey = key
+}
+
+// currentSigningKey returns the key new tokens are signed with, or nil for HS256
+func currentSigningKey() *SigningKey {
+	signingKeyMu.RLock()
+	defer signingKeyMu.RUnlock()
+	return signingKey
+}
+
+// publishedSigningKeys returns the current key and the retired keys still in their
+// grace period, current first
+func publishedSigningKeys() []*SigningKey {
+	signingKeyMu.RLock()
+	defer signingKeyMu.RUnlock()
+	if signingKey == nil {
+		return nil
+	}
+	keys := []*SigningKey{signingKey}
+	now := time.Now()
+	for _, retired := range retiredSigningKeys {
+		if now.Before(retired.until) {
+			keys = append(keys, retired.key)
+		}
+	}
+	return keys
+}
+
+// verificationKey returns the published key with the given ID, or nil
+func verificationKey(kid string) *SigningKey {
+	for _, key := range publishedSigningKeys() {
+		if key.ID == kid {
+			return key
+		}
+	}
+	return nil
+}
+
+// signingAlgorithm returns the algorithm new tokens are signed with
+func signingAlgorithm() string {
+	if key := currentSigningKey(); key != nil {
+		return key.Method.Alg()
+	}
+	return AlgorithmHS256
+}
+
+// signToken signs claims with the current key, naming it in the kid header, or
+// with the JWT secret when no asymmetric key is configured
+func signToken(claims TokenClaims) (string, error) {
+	key := currentSigningKey()
+	if key == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(signingSecret())
+	}
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.private)
+}
+
+// parseToken validates a token issued by this service: RS256 and EdDSA tokens
+// against the published key their kid names, HMAC tokens against the current JWT
+// secret and, during a reload's grace period, the previous one
+func parseToken(tokenString string) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, &TokenClaims{}, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodHMAC:
+			hmacSecrets := verificationSecrets()
+			if len(hmacSecrets) == 0 {
+				return nil, errors.New("HMAC-signed tokens are not accepted")
+			}
+			set := jwt.VerificationKeySet{}
+			for _, secret := range hmacSecrets {
+				set.Keys = append(set.Keys, secret)
+			}
+			return set, nil
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodEd25519:
+			kid, _ := token.Header["kid"].(string)
+			key := verificationKey(kid)
+			if key == nil || key.Method.Alg() != token.Method.Alg() {
+				return nil, fmt.Errorf("unknown signing key %q", kid)
+			}
+			return key.private.Public(), nil
+		}
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	})
+}
+
+// JWK is a public key in JSON Web Key form
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	// RSA modulus and exponent
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519 curve and public key
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// publicJWK describes an RSA or Ed25519 public key
+func publicJWK(public crypto.PublicKey, algorithm, kid string) JWK {
+	jwk := JWK{Use: "sig", Algorithm: algorithm, KeyID: kid}
+	switch k := public.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(k.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(k)
+	}
+	return jwk
+}
+
+// thumbprint is the RFC 7638 SHA-256 thumbprint of the key: the hash of its
+// required members in lexicographic order
+func (k JWK) thumbprint() string {
+	members := map[string]string{"kty": k.KeyType}
+	if k.KeyType == "RSA" {
+		members["n"], members["e"] = k.N, k.E
+	} else {
+		members["crv"], members["x"] = k.Curve, k.X
+	}
+	// encoding/json writes map keys sorted, which is the order RFC 7638 requires
+	canonical, _ := json.Marshal(members)
+	sum := sha256.Sum256(canonical)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// JWKS handles GET /.well-known/jwks.json: the public keys tokens are signed with, so
+// resource services can verify them without the signing key or a call to
+// /introspect. Retired keys are listed until the tokens they signed have expired.
+func (h AuthHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	SecurityHeaders(w, r)
+	keys := []JWK{}
+	for _, key := range publishedSigningKeys() {
+		keys = append(keys, publicJWK(key.private.Public(), key.Method.Alg(), key.ID))
+	}
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+}
+
+// loadSigningKey installs the JWT_SIGNING_KEY for algorithm and returns it for
+// watching, or generates a key when none is configured and returns nil
+func loadSigningKey(ctx context.Context, provider secrets.Provider, algorithm string) (*secrets.Secret, error) {
+	secret, err := provider.Get(ctx, "JWT_SIGNING_KEY")
+	if errors.Is(err, secrets.ErrNotFound) {
+		key, err := generateSigningKey(algorithm)
+		if err != nil {
+			return nil, err
+		}
+		setSigningKey(key)
+		logger.Warn().Str("kid", key.ID).Msg("JWT_SIGNING_KEY is not set; signing with a generated key that is lost on restart and not shared between replicas")
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	key, err := parseSigningKey(secret.Value)
+	if err == nil && key.Method.Alg() != algorithm {
+		err = fmt.Errorf("JWT_SIGNING_KEY is a %s key but JWT_SIGNING_ALGORITHM is %s", key.Method.Alg(), algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+	setSigningKey(key)
+	logger.Info().Str("source", secret.Source).Str("kid", key.ID).Str("algorithm", algorithm).Msg("JWT signing key loaded")
+	return &secret, nil
+}
+
+// watchSigningKey returns a watcher that swaps in a rotated JWT_SIGNING_KEY
+func watchSigningKey(provider secrets.Provider, interval time.Duration, algorithm string) *secrets.Watcher {
+	return &secrets.Watcher{
+		Provider: provider,
+		Name:     "JWT_SIGNING_KEY",
+		Interval: interval,
+		OnChange: func(secret secrets.Secret) error {
+			key, err := parseSigningKey(secret.Value)
+			if err == nil && key.Method.Alg() != algorithm {
+				err = fmt.Errorf("rotated JWT_SIGNING_KEY is a %s key but JWT_SIGNING_ALGORITHM is %s", key.Method.Alg(), algorithm)
+			}
+			if err != nil {
+				recordSecurityEvent(nil, "signing_key_reload_failed", "error", "")
+				return err
+			}
+			setSigningKey(key)
+			recordSecurityEvent(nil, "signing_key_rotated", "info", "")
+			logger.Info().Str("source", secret.Source).Str("version", secret.Version).Str("kid", key.ID).Msg("JWT signing key rotated")
+			return nil
+		},
+		OnError: func(err error) {
+			logger.Error().Err(err).Msg("JWT signing key reload failed")
+		},
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/healthcare-gitops/common/secrets"
+)
+
+// useSigningKey installs key for the test and restores HS256 signing after
+func useSigningKey(t *testing.T, key *SigningKey) {
+	t.Helper()
+	setSigningKey(key)
+	t.Cleanup(func() {
+		signingKeyMu.Lock()
+		signingKey, retiredSigningKeys = nil, nil
+		signingKeyMu.Unlock()
+	})
+}
+
+func issueToken(t *testing.T) string {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	AuthHandler{}.GenerateToken(rr, httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(`{"user_id":"u1","scopes":["phi:read"],"role":"user"}`)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 from /token got %d", rr.Code)
+	}
+	var body struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	return body.Token
+}
+
+func fetchJWKS(t *testing.T) []JWK {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	StartAuthServer(":0").Handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, jwksPath, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 from JWKS got %d", rr.Code)
+	}
+	var body struct {
+		Keys []JWK `json:"keys"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to parse JWKS: %v", err)
+	}
+	return body.Keys
+}
+
+// publicKeyFromJWK rebuilds a published key the way a resource service would
+func publicKeyFromJWK(t *testing.T, jwk JWK) interface{} {
+	t.Helper()
+	decode := func(s string) []byte {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			t.Fatalf("bad JWK member: %v", err)
+		}
+		return b
+	}
+	if jwk.KeyType == "OKP" {
+		return ed25519.PublicKey(decode(jwk.X))
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(decode(jwk.N)), E: int(new(big.Int).SetBytes(decode(jwk.E)).Int64())}
+}
+
+func pemEncode(t *testing.T, key interface{}) string {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to encode key: %v", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+// TestAsymmetricTokens verifies RS256 and EdDSA tokens carry a kid that resolves to a JWKS key resource services can verify with
+func TestAsymmetricTokens(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmRS256, AlgorithmEdDSA} {
+		t.Run(algorithm, func(t *testing.T) {
+			key, err := generateSigningKey(algorithm)
+			if err != nil {
+				t.Fatalf("failed to generate key: %v", err)
+			}
+			useSigningKey(t, key)
+
+			tokenString := issueToken(t)
+			if code, response := introspect(t, tokenString); code != http.StatusOK || response.UserID != "u1" {
+				t.Fatalf("expected token to introspect, got %d %+v", code, response)
+			}
+
+			keys := fetchJWKS(t)
+			if len(keys) != 1 || keys[0].KeyID != key.ID || keys[0].Algorithm != algorithm || keys[0].Use != "sig" {
+				t.Fatalf("unexpected JWKS %+v", keys)
+			}
+			// Verify locally with only the published key
+			token, err := jwt.ParseWithClaims(tokenString, &TokenClaims{}, func(token *jwt.Token) (interface{}, error) {
+				if token.Header["kid"] != keys[0].KeyID {
+					t.Fatalf("token kid %v does not match the JWKS", token.Header["kid"])
+				}
+				return publicKeyFromJWK(t, keys[0]), nil
+			}, jwt.WithValidMethods([]string{algorithm}))
+			if err != nil || !token.Valid {
+				t.Fatalf("expected token to verify against the JWKS: %v", err)
+			}
+		})
+	}
+}
+
+// TestAsymmetricSigningRejectsHS256 verifies HMAC tokens are refused once signing is asymmetric and no JWT_SECRET is kept
+func TestAsymmetricSigningRejectsHS256(t *testing.T) {
+	key, err := generateSigningKey(AlgorithmEdDSA)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	useSigningKey(t, key)
+
+	forged, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, TokenClaims{
+		UserID: "attacker",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(tokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}).SignedString([]byte(nil))
+	if code, _ := introspect(t, forged); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for HS256 token, got %d", code)
+	}
+
+	// A token signed by a key that is not published is rejected even with a known kid
+	stranger, _ := generateSigningKey(AlgorithmEdDSA)
+	stranger.ID = key.ID
+	token := jwt.NewWithClaims(stranger.Method, TokenClaims{UserID: "attacker"})
+	token.Header["kid"] = key.ID
+	tokenString, _ := token.SignedString(stranger.private)
+	if code, _ := introspect(t, tokenString); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for unpublished key, got %d", code)
+	}
+}
+
+// TestSigningKeyRotation verifies a rotated key signs new tokens while the old one stays published and accepted for one token lifetime
+func TestSigningKeyRotation(t *testing.T) {
+	first, _ := rsa.GenerateKey(rand.Reader, 2048)
+	firstKey, err := newSigningKey(first)
+	if err != nil {
+		t.Fatalf("failed to wrap key: %v", err)
+	}
+	useSigningKey(t, firstKey)
+	before := issueToken(t)
+
+	watcher := watchSigningKey(nil, time.Minute, AlgorithmRS256)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	if err := watcher.OnChange(secrets.Secret{Value: pemEncode(t, edKey), Source: secrets.SourceVault}); err == nil {
+		t.Fatal("expected a key for another algorithm to be rejected")
+	}
+	if err := watcher.OnChange(secrets.Secret{Value: "not a key", Source: secrets.SourceVault}); err == nil {
+		t.Fatal("expected a malformed key to be rejected")
+	}
+	second, _ := rsa.GenerateKey(rand.Reader, 2048)
+	if err := watcher.OnChange(secrets.Secret{Value: pemEncode(t, second), Source: secrets.SourceVault}); err != nil {
+		t.Fatalf("rotation failed: %v", err)
+	}
+
+	if currentSigningKey().ID == firstKey.ID {
+		t.Fatal("expected the rotated key to sign new tokens")
+	}
+	if code, _ := introspect(t, issueToken(t)); code != http.StatusOK {
+		t.Fatalf("expected token signed with the new key to validate, got %d", code)
+	}
+	if code, _ := introspect(t, before); code != http.StatusOK {
+		t.Fatalf("expected token signed before the rotation to validate during the grace period, got %d", code)
+	}
+	if keys := fetchJWKS(t); len(keys) != 2 || keys[0].KeyID != currentSigningKey().ID || keys[1].KeyID != firstKey.ID {
+		t.Fatalf("expected current and retired keys to be published, got %+v", keys)
+	}
+
+	signingKeyMu.Lock()
+	retiredSigningKeys[0].until = time.Now().Add(-time.Second)
+	signingKeyMu.Unlock()
+	if code, _ := introspect(t, before); code != http.StatusUnauthorized {
+		t.Fatalf("expected token signed with the retired key to be rejected, got %d", code)
+	}
+	if keys := fetchJWKS(t); len(keys) != 1 {
+		t.Fatalf("expected the retired key to be unpublished, got %+v", keys)
+	}
+}
+
+// TestParseSigningKey verifies PKCS#1 and PKCS#8 keys load with stable thumbprint IDs and weak keys are refused
+func TestParseSigningKey(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	pkcs1 := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}))
+	fromPKCS1, err := parseSigningKey(pkcs1)
+	if err != nil {
+		t.Fatalf("failed to parse PKCS#1 key: %v", err)
+	}
+	fromPKCS8, err := parseSigningKey(pemEncode(t, rsaKey))
+	if err != nil {
+		t.Fatalf("failed to parse PKCS#8 key: %v", err)
+	}
+	if fromPKCS1.ID != fromPKCS8.ID || fromPKCS1.Method != jwt.SigningMethodRS256 {
+		t.Fatalf("expected the same RS256 key ID from both encodings, got %q and %q", fromPKCS1.ID, fromPKCS8.ID)
+	}
+
+	// RFC 7638 section 3.1 example key
+	jwk := JWK{
+		KeyType: "RSA",
+		E:       "AQAB",
+		N:       "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+	}
+	if got := jwk.thumbprint(); got != "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs" {
+		t.Fatalf("unexpected thumbprint %q", got)
+	}
+
+	weak, _ := rsa.GenerateKey(rand.Reader, 1024)
+	if _, err := parseSigningKey(pemEncode(t, weak)); err == nil {
+		t.Fatal("expected a 1024-bit key to be rejected")
+	}
+	if _, err := parseSigningKey("-----BEGIN CERTIFICATE-----\nAAAA\n-----END CERTIFICATE-----\n"); err == nil {
+		t.Fatal("expected a certificate to be rejected")
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/healthcare-gitops/common/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Token audit events
+const (
+	TokenEventIssued             = "token_issued"
+	TokenEventIntrospected       = "token_introspected"
+	TokenEventAPIKeyIntrospected = "api_key_introspected"
+)
+
+// Token audit results
+const (
+	TokenResultSuccess   = "success"
+	TokenResultMissing   = "missing"
+	TokenResultInvalid   = "invalid"
+	TokenResultExpired   = "expired"
+	TokenResultLockedOut = "locked_out"
+)
+
+const (
+	defaultTokenAuditPage = 100
+	maxTokenAuditPage     = 500
+	// defaultTokenAuditEvents is how many recent events are kept queryable
+	defaultTokenAuditEvents = 100000
+)
+
+var tokenAuditWriteFailures = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "auth_token_audit_write_failures_total",
+	Help: "Token audit events that could not be written to TOKEN_AUDIT_PATH",
+})
+
+// TokenAuditEvent records a token being issued or checked, answering who had access
+// when. For failed checks UserID is the user the token claimed, unverified.
+type TokenAuditEvent struct {
+	Seq    int64     `json:"seq"`
+	Time   time.Time `json:"time"`
+	Event  string    `json:"event"`
+	UserID string    `json:"user_id,omitempty"`
+	Role   string    `json:"role,omitempty"`
+	Scopes []string  `json:"scopes,omitempty"`
+	Issuer string    `json:"issuer,omitempty"`
+	KeyID  string    `json:"key_id,omitempty"`
+	IP     string    `json:"ip,omitempty"`
+	Result string    `json:"result"`
+}
+
+// TokenAuditFilter selects events; zero fields match everything. From is inclusive,
+// To exclusive.
+type TokenAuditFilter struct {
+	UserID string
+	Event  string
+	Result string
+	From   time.Time
+	To     time.Time
+}
+
+func (f TokenAuditFilter) matches(e TokenAuditEvent) bool {
+	return (f.UserID == "" || e.UserID == f.UserID) &&
+		(f.Event == "" || e.Event == f.Event) &&
+		(f.Result == "" || e.Result == f.Result) &&
+		(f.From.IsZero() || !e.Time.Before(f.From)) &&
+		(f.To.IsZero() || e.Time.Before(f.To))
+}
+
+// TokenAuditPage is one page of matching events, newest first
+type TokenAuditPage struct {
+	Events     []TokenAuditEvent `json:"events"`
+	Count      int               `json:"count"`
+	Total      int               `json:"total"`
+	NextOffset *int              `json:"next_offset,omitempty"`
+}
+
+// TokenAuditLog keeps the most recent token events queryable in memory and, with
+// TOKEN_AUDIT_PATH, appends every event to a JSON lines file that survives restarts
+// and is the complete record
+type TokenAuditLog struct {
+	mu     sync.RWMutex
+	events []TokenAuditEvent // oldest first
+	max    int
+	seq    int64
+	file   *os.File
+	now    func() time.Time
+}
+
+// NewTokenAuditLog creates an in-memory log keeping up to max events
+func NewTokenAuditLog(max int) *TokenAuditLog {
+	if max <= 0 {
+		max = defaultTokenAuditEvents
+	}
+	return &TokenAuditLog{max: max, now: time.Now}
+}
+
+// tokenAudit records token events for GET /api/v1/audit/tokens
+var tokenAudit = NewTokenAuditLog(defaultTokenAuditEvents)
+
+// OpenTokenAuditLog reloads the most recent max events from path and appends new
+// ones to it
+func OpenTokenAuditLog(path string, max int) (*TokenAuditLog, error) {
+	l := NewTokenAuditLog(max)
+	if existing, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(existing)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			if len(scanner.Bytes()) == 0 {
+				continue
+			}
+			var e TokenAuditEvent
+			if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+				existing.Close()
+				return nil, fmt.Errorf("%s line %d: %w", path, line, err)
+			}
+			l.keep(e)
+			l.seq = e.Seq
+		}
+		existing.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	l.file = file
+	return l, nil
+}
+
+// keep adds an event to memory, dropping the oldest beyond max
+func (l *TokenAuditLog) keep(e TokenAuditEvent) {
+	l.events = append(l.events, e)
+	if over := len(l.events) - l.max; over > 0 {
+		l.events = append(l.events[:0], l.events[over:]...)
+	}
+}
+
+// Record stamps the event with its sequence number and time and stores it. A failed
+// file write is logged and counted but does not fail the authentication it records.
+func (l *TokenAuditLog) Record(e TokenAuditEvent) TokenAuditEvent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.seq++
+	e.Seq = l.seq
+	e.Time = l.now().UTC()
+	l.keep(e)
+	if l.file != nil {
+		line, _ := json.Marshal(e)
+		if _, err := l.file.Write(append(line, '\n')); err != nil {
+			tokenAuditWriteFailures.Inc()
+			logger.Error().Err(err).Int64("seq", e.Seq).Msg("Failed to write token audit event")
+		}
+	}
+	return e
+}
+
+// Query returns a page of the events matching f, newest first
+func (l *TokenAuditLog) Query(f TokenAuditFilter, offset, limit int) TokenAuditPage {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	page := TokenAuditPage{Events: []TokenAuditEvent{}}
+	for i := len(l.events) - 1; i >= 0; i-- {
+		if !f.matches(l.events[i]) {
+			continue
+		}
+		if page.Total >= offset && len(page.Events) < limit {
+			page.Events = append(page.Events, l.events[i])
+		}
+		page.Total++
+	}
+	page.Count = len(page.Events)
+	if next := offset + limit; next < page.Total {
+		page.NextOffset = &next
+	}
+	return page
+}
+
+// configureTokenAudit persists token events to TOKEN_AUDIT_PATH when it is set,
+// keeping TOKEN_AUDIT_MAX_EVENTS of them queryable
+func configureTokenAudit() error {
+	max := config.GetEnvInt("TOKEN_AUDIT_MAX_EVENTS", defaultTokenAuditEvents)
+	if max <= 0 {
+		return fmt.Errorf("TOKEN_AUDIT_MAX_EVENTS must be positive")
+	}
+	path := config.GetEnv("TOKEN_AUDIT_PATH", "")
+	if path == "" {
+		tokenAudit = NewTokenAuditLog(max)
+		logger.Warn().Msg("TOKEN_AUDIT_PATH not set, the token audit trail will not survive a restart")
+		return nil
+	}
+	l, err := OpenTokenAuditLog(path, max)
+	if err != nil {
+		return err
+	}
+	tokenAudit = l
+	logger.Info().Str("path", path).Int64("events", l.seq).Msg("Token audit trail opened")
+	return nil
+}
+
+// recordTokenEvent adds the request's client address and records the event. Refused
+// checks are emitted to the audit bus whether or not the trail is enabled.
+func recordTokenEvent(r *http.Request, e TokenAuditEvent) {
+	e.IP = clientIP(r)
+	if e.Event != TokenEventIssued && e.Result != TokenResultSuccess {
+		emitRefusedCredential(r, e)
+	}
+	if !featureFlags.Enabled(FeatureTokenAudit) {
+		return
+	}
+	tokenAudit.Record(e)
+}
+
+// ListTokenAudit handles GET /api/v1/audit/tokens: token issuance and introspection
+// events newest first, filtered by ?user_id, ?event, ?result and the ?from/?to time
+// range (RFC 3339), paged with ?limit and ?offset
+func (h AuthHandler) ListTokenAudit(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := TokenAuditFilter{UserID: query.Get("user_id"), Event: query.Get("event"), Result: query.Get("result")}
+	for name, dst := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := query.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				writeJSONError(w, http.StatusBadRequest, name+" must be an RFC 3339 timestamp")
+				return
+			}
+			*dst = t
+		}
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		writeJSONError(w, http.StatusBadRequest, "from must be before to")
+		return
+	}
+	limit, offset := defaultTokenAuditPage, 0
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxTokenAuditPage {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxTokenAuditPage))
+			return
+		}
+		limit = n
+	}
+	if value := query.Get("offset"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			writeJSONError(w, http.StatusBadRequest, "offset must be a non-negative integer")
+			return
+		}
+		offset = n
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(tokenAudit.Query(filter, offset, limit))
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/healthcare-gitops/common/audit"
+)
+
+// useTokenAudit gives the test an empty in-memory audit trail on a controllable clock
+func useTokenAudit(t *testing.T) (*TokenAuditLog, *time.Time) {
+	t.Helper()
+	previous := tokenAudit
+	now := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	tokenAudit = NewTokenAuditLog(100)
+	tokenAudit.now = func() time.Time { return now }
+	t.Cleanup(func() { tokenAudit = previous })
+	return tokenAudit, &now
+}
+
+func auditPage(t *testing.T, query, token string) TokenAuditPage {
+	t.Helper()
+	rr := serve(t, http.MethodGet, "/api/v1/audit/tokens"+query, token, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 from the audit trail, got %d: %s", rr.Code, rr.Body)
+	}
+	var page TokenAuditPage
+	if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	return page
+}
+
+// TestTokenAuditTrail verifies issuance and introspection are recorded with their
+// outcome and can be queried by user and time range, a page at a time
+func TestTokenAuditTrail(t *testing.T) {
+	_, now := useTokenAudit(t)
+	useLoginGuard(t, defaultLockoutConfig)
+	admin := testToken(t, "root", "admin", "admin")
+
+	if rr := serve(t, http.MethodPost, "/token", "", `{"user_id":"nurse-7","role":"user","scopes":["phi:read"]}`); rr.Code != http.StatusOK {
+		t.Fatalf("expected a token, got %d: %s", rr.Code, rr.Body)
+	}
+	*now = now.Add(time.Hour)
+	if rr := serve(t, http.MethodGet, "/introspect", testToken(t, "nurse-7", "user", "phi:read"), ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected introspection to succeed, got %d", rr.Code)
+	}
+	*now = now.Add(time.Hour)
+	if rr := serve(t, http.MethodGet, "/introspect", forgedToken(t, "nurse-7"), ""); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a forged token to be refused, got %d", rr.Code)
+	}
+	serve(t, http.MethodGet, "/introspect", "", "")
+
+	if rr := serve(t, http.MethodGet, "/api/v1/audit/tokens", testToken(t, "nurse-7", "user", "phi:read"), ""); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for non-admin, got %d", rr.Code)
+	}
+
+	page := auditPage(t, "?user_id=nurse-7", admin)
+	if page.Total != 3 || page.NextOffset != nil {
+		t.Fatalf("expected three events for nurse-7, got %+v", page)
+	}
+	newest, oldest := page.Events[0], page.Events[2]
+	if newest.Event != TokenEventIntrospected || newest.Result != TokenResultInvalid {
+		t.Fatalf("expected the forged introspection first, got %+v", newest)
+	}
+	if oldest.Event != TokenEventIssued || oldest.Result != TokenResultSuccess || oldest.IP == "" || len(oldest.Scopes) != 1 {
+		t.Fatalf("expected the issuance last, got %+v", oldest)
+	}
+
+	// The second hour holds only the successful introspection
+	page = auditPage(t, "?user_id=nurse-7&from=2026-10-16T10:00:00Z&to=2026-10-16T11:00:00Z", admin)
+	if page.Total != 1 || page.Events[0].Result != TokenResultSuccess || page.Events[0].Issuer != "auth-service" {
+		t.Fatalf("expected one successful introspection, got %+v", page)
+	}
+
+	page = auditPage(t, "?limit=2", admin)
+	if page.Count != 2 || page.NextOffset == nil || *page.NextOffset != 2 {
+		t.Fatalf("expected a first page of two, got %+v", page)
+	}
+	page = auditPage(t, "?limit=2&offset=2", admin)
+	if page.Count != page.Total-2 || page.NextOffset != nil {
+		t.Fatalf("expected the rest on the second page, got %+v", page)
+	}
+
+	for _, query := range []string{"?from=yesterday", "?from=2026-10-16T11:00:00Z&to=2026-10-16T10:00:00Z", "?limit=0", "?offset=-1"} {
+		if rr := serve(t, http.MethodGet, "/api/v1/audit/tokens"+query, admin, ""); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for %s, got %d", query, rr.Code)
+		}
+	}
+}
+
+// TestTokenAuditPersistence verifies events survive a reopen, numbering continues and
+// only the most recent events stay queryable
+func TestTokenAuditPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.jsonl")
+	l, err := OpenTokenAuditLog(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range []string{"a", "b", "c"} {
+		l.Record(TokenAuditEvent{Event: TokenEventIssued, UserID: user, Result: TokenResultSuccess})
+	}
+	l.file.Close()
+
+	reopened, err := OpenTokenAuditLog(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.file.Close()
+	if page := reopened.Query(TokenAuditFilter{}, 0, 10); page.Total != 2 || page.Events[0].UserID != "c" || page.Events[1].UserID != "b" {
+		t.Fatalf("expected the two most recent events, got %+v", page)
+	}
+	if e := reopened.Record(TokenAuditEvent{Event: TokenEventIssued, UserID: "d", Result: TokenResultSuccess}); e.Seq != 4 {
+		t.Fatalf("expected numbering to continue at 4, got %d", e.Seq)
+	}
+}
+
+// memorySink keeps the audit events written to it
+type memorySink struct {
+	events []audit.Event
+}
+
+func (s *memorySink) Write(_ context.Context, events []audit.Event) error {
+	s.events = append(s.events, events...)
+	return nil
+}
+
+func (s *memorySink) Close() error { return nil }
+
+// TestAuditBusEvents verifies issuance, admin changes and refused tokens reach the
+// audit bus with their actor and outcome, and successful introspections do not
+func TestAuditBusEvents(t *testing.T) {
+	useTokenAudit(t)
+	useLoginGuard(t, defaultLockoutConfig)
+	sink := &memorySink{}
+	previous := auditEvents
+	auditEvents = audit.NewEmitter("auth-service", sink, audit.Config{FlushInterval: 10 * time.Millisecond})
+	t.Cleanup(func() { auditEvents = previous })
+
+	serve(t, http.MethodPost, "/token", "", `{"user_id":"nurse-7","role":"user","scopes":["phi:read"]}`)
+	serve(t, http.MethodGet, "/introspect", testToken(t, "nurse-7", "user", "phi:read"), "")
+	serve(t, http.MethodGet, "/introspect", forgedToken(t, "nurse-7"), "")
+	serve(t, http.MethodPut, "/api/v1/roles/auditor", testToken(t, "nurse-7", "user", "phi:read"), `{"allow":["phi:read"]}`)
+	if err := auditEvents.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sink.events) != 3 {
+		t.Fatalf("expected issuance, the forged token and the refused role change, got %+v", sink.events)
+	}
+	issued, forged, denied := sink.events[0], sink.events[1], sink.events[2]
+	if issued.Action != "POST /token" || issued.Resource != "user/nurse-7" || issued.Outcome != audit.OutcomeSuccess || issued.Details["role"] != "user" {
+		t.Errorf("unexpected issuance event %+v", issued)
+	}
+	if forged.Action != "auth.token_introspected" || forged.Outcome != audit.OutcomeDenied || forged.Details["result"] != TokenResultInvalid {
+		t.Errorf("unexpected refused token event %+v", forged)
+	}
+	if denied.Action != "PUT /api/v1/roles/{role}" || denied.Actor != "nurse-7" || denied.Outcome != audit.OutcomeDenied {
+		t.Errorf("unexpected role change event %+v", denied)
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+
+	"github.com/healthcare-gitops/common/usagestats"
+)
+
+// usageStats sends anonymous usage telemetry when USAGE_STATS_ENABLED opts in, and
+// previews it at /admin/usage-stats either way
+var usageStats = newUsageStats()
+
+func newUsageStats() *usagestats.Reporter {
+	cfg := usagestats.ConfigFromEnv()
+	cfg.OnSend = func(err error) {
+		if err != nil {
+			logger.Warn().Err(err).Msg("Failed to send usage stats")
+			return
+		}
+		logger.Debug().Msg("Usage stats sent")
+	}
+	return usagestats.NewReporter(cfg, usagestats.Source{Service: "auth-service", Version: apiSpecVersion, Flags: featureFlags})
+}
+
+// startUsageStats sends usage stats every USAGE_STATS_INTERVAL_HOURS while enabled
+func startUsageStats(ctx context.Context) {
+	if !usageStats.Enabled() {
+		return
+	}
+	logger.Info().Msg("Anonymous usage stats reporting enabled; preview at /admin/usage-stats")
+	usageStats.Run(ctx)
+}
@@ -0,0 +1,208 @@
+// Package apidocs serves a service's OpenAPI document at /openapi.json and a Swagger
+// UI for it at /docs. Each service keeps its spec as a hand-maintained openapi.yaml
+// beside its handlers and embeds it; the document is checked and converted to JSON
+// once, at startup, keeping the order it was written in.
+package apidocs
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/healthcare-gitops/common/config"
+)
+
+// DefaultSwaggerUIURL is where the /docs page loads Swagger UI from unless
+// SWAGGER_UI_URL names a mirror, such as one served by the cluster's ingress
+const DefaultSwaggerUIURL = "https://unpkg.com/swagger-ui-dist@5.17.14"
+
+// Docs is a service's OpenAPI document, ready to serve
+type Docs struct {
+	// Title and Version are the spec's info.title and info.version
+	Title   string
+	Version string
+	doc     []byte
+	uiURL   string
+}
+
+// New checks an OpenAPI 3 document in YAML and converts it to JSON. A document whose
+// info.version is not the version the service implements is an error, so a spec that
+// has fallen behind the handlers stops the service at startup instead of being served.
+func New(spec []byte, version string) (*Docs, error) {
+	var head struct {
+		OpenAPI string `yaml:"openapi"`
+		Info    struct {
+			Title   string `yaml:"title"`
+			Version string `yaml:"version"`
+		} `yaml:"info"`
+	}
+	if err := yaml.Unmarshal(spec, &head); err != nil {
+		return nil, fmt.Errorf("parse OpenAPI document: %w", err)
+	}
+	switch {
+	case !strings.HasPrefix(head.OpenAPI, "3."):
+		return nil, fmt.Errorf("OpenAPI document is version %q, not 3.x", head.OpenAPI)
+	case head.Info.Title == "":
+		return nil, errors.New("OpenAPI document has no info.title")
+	case head.Info.Version != version:
+		return nil, fmt.Errorf("OpenAPI document is version %q, the API is %s", head.Info.Version, version)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(spec, &root); err != nil {
+		return nil, fmt.Errorf("parse OpenAPI document: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, &root); err != nil {
+		return nil, fmt.Errorf("convert OpenAPI document: %w", err)
+	}
+	var doc bytes.Buffer
+	if err := json.Indent(&doc, buf.Bytes(), "", "  "); err != nil {
+		return nil, fmt.Errorf("convert OpenAPI document: %w", err)
+	}
+
+	return &Docs{
+		Title:   head.Info.Title,
+		Version: head.Info.Version,
+		doc:     doc.Bytes(),
+		uiURL:   strings.TrimSuffix(config.GetEnv("SWAGGER_UI_URL", DefaultSwaggerUIURL), "/"),
+	}, nil
+}
+
+// JSON returns the document as served at /openapi.json
+func (d *Docs) JSON() []byte {
+	return d.doc
+}
+
+// writeJSON writes a YAML node as JSON, mapping keys in document order
+func writeJSON(buf *bytes.Buffer, n *yaml.Node) error {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			return errors.New("empty document")
+		}
+		return writeJSON(buf, n.Content[0])
+	case yaml.AliasNode:
+		return writeJSON(buf, n.Alias)
+	case yaml.MappingNode:
+		buf.WriteByte('{')
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			// Keys are written as their text, so a response code of 200 is "200"
+			writeString(buf, n.Content[i].Value)
+			buf.WriteByte(':')
+			if err := writeJSON(buf, n.Content[i+1]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case yaml.SequenceNode:
+		buf.WriteByte('[')
+		for i, item := range n.Content {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSON(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case yaml.ScalarNode:
+		switch n.ShortTag() {
+		case "!!null":
+			buf.WriteString("null")
+		case "!!bool", "!!int", "!!float":
+			var v interface{}
+			if err := n.Decode(&v); err != nil {
+				return err
+			}
+			b, err := json.Marshal(v)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", n.Line, err)
+			}
+			buf.Write(b)
+		default:
+			// Strings, and dates such as an example sunset, as written
+			writeString(buf, n.Value)
+		}
+	default:
+		return fmt.Errorf("line %d: unsupported YAML node", n.Line)
+	}
+	return nil
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s)
+	// Encode ends the value with a newline
+	buf.Truncate(buf.Len() - 1)
+}
+
+// SpecHandler serves the document at /openapi.json
+func (d *Docs) SpecHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "no-cache")
+	_, _ = w.Write(d.doc)
+}
+
+var page = template.Must(template.New("docs").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <title>{{.Title}} {{.Version}}</title>
+  <link rel="stylesheet" href="{{.UI}}/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="{{.UI}}/swagger-ui-bundle.js"></script>
+  <script nonce="{{.Nonce}}">
+    window.ui = SwaggerUIBundle({
+      url: "openapi.json",
+      dom_id: "#swagger-ui",
+      deepLinking: true,
+      validatorUrl: null
+    });
+  </script>
+</body>
+</html>
+`))
+
+// DocsHandler serves a Swagger UI page for the document at /docs. The page replaces
+// the service's content security policy with one that admits Swagger UI's assets and,
+// by nonce, only its own inline script.
+func (d *Docs) DocsHandler(w http.ResponseWriter, r *http.Request) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	nonce := base64.RawURLEncoding.EncodeToString(b)
+
+	// A mirror on the service's own host is covered by 'self'
+	source := d.uiURL + "/"
+	if strings.HasPrefix(d.uiURL, "/") {
+		source = "'self'"
+	}
+	w.Header().Set("Content-Security-Policy", fmt.Sprintf(
+		"default-src 'none'; script-src %s 'nonce-%s'; style-src %s 'unsafe-inline'; img-src 'self' data: %s; connect-src 'self'; frame-ancestors 'none'",
+		source, nonce, source, source))
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = page.Execute(w, struct {
+		Title, Version, UI, Nonce string
+	}{d.Title, d.Version, d.uiURL, nonce})
+}
@@ -0,0 +1,360 @@
+// Package audit emits structured audit events, in one schema shared by every service,
+// to a pluggable sink: stdout, Kafka or Postgres. Events are queued and written in
+// batches off the request path; when the sink fails or the queue is full they are
+// written to stderr instead, so an event is never silently lost. Events carry who did
+// what to which resource and how it ended, never request bodies, so no PHI reaches
+// the sink.
+package audit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/healthcare-gitops/common/config"
+)
+
+// Outcomes of an audited action
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	// OutcomeDenied means authentication or authorization refused the action
+	OutcomeDenied = "denied"
+)
+
+// Sinks ConfigFromEnv selects with AUDIT_SINK
+const (
+	SinkStdout   = "stdout"
+	SinkKafka    = "kafka"
+	SinkPostgres = "postgres"
+	SinkNone     = "none"
+)
+
+// SchemaVersion is bumped whenever a field is added to Event
+const SchemaVersion = 1
+
+const (
+	// DefaultBufferSize is how many events can wait for the sink
+	DefaultBufferSize = 4096
+	// DefaultBatchSize is the most events written to the sink at once
+	DefaultBatchSize = 100
+	// DefaultFlushInterval is the longest an event waits to be batched
+	DefaultFlushInterval = time.Second
+	// writeAttempts is how often a batch is offered to the sink before it falls back
+	// to stderr
+	writeAttempts = 3
+)
+
+// Event is one audited action
+type Event struct {
+	Schema  int       `json:"schema"`
+	ID      string    `json:"id"`
+	Time    time.Time `json:"time"`
+	Service string    `json:"service"`
+	// Actor is who acted: a user ID, client certificate name or API key ID
+	Actor string `json:"actor"`
+	// Action is what was done, such as phi.decrypt or POST /api/v1/payments
+	Action string `json:"action"`
+	// Resource is what it was done to, such as a path or key ID
+	Resource  string `json:"resource,omitempty"`
+	Outcome   string `json:"outcome"`
+	TraceID   string `json:"trace_id,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	SourceIP  string `json:"source_ip,omitempty"`
+	// Details adds action-specific context; it must never carry PHI
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// Sink is where events are written. Write is given batches in the order they were
+// emitted; it is retried with the same events after an error, so it should be
+// idempotent on Event.ID.
+type Sink interface {
+	Write(ctx context.Context, events []Event) error
+	Close() error
+}
+
+// Config configures an Emitter and its sink
+type Config struct {
+	// Sink is stdout, kafka, postgres or none; empty is none
+	Sink string
+	// KafkaRESTURL is the Kafka REST Proxy events are produced through, to KafkaTopic
+	KafkaRESTURL string
+	KafkaTopic   string
+	// DatabaseURL and DatabaseDriver open the Postgres sink; the driver is registered
+	// by the build, as pgx's stdlib package registers "pgx"
+	DatabaseURL    string
+	DatabaseDriver string
+	// BufferSize caps the events waiting for the sink. Defaults to DefaultBufferSize.
+	BufferSize int
+	// FlushInterval is the longest an event waits to be batched. Defaults to
+	// DefaultFlushInterval.
+	FlushInterval time.Duration
+	// TraceID, if set, returns the trace ID of a context, for events emitted without one
+	TraceID func(ctx context.Context) string
+	// OnWrite, if set, is called after every batch with how many events it held and
+	// the sink's error, for logging and metrics
+	OnWrite func(events int, err error)
+	// Forward, if set, is given every event as it is emitted, whatever the sink, as
+	// siem.Exporter.SendAudit exports them to a SIEM. It must not block.
+	Forward func(ev Event)
+}
+
+// ConfigFromEnv reads AUDIT_SINK, AUDIT_KAFKA_REST_URL, AUDIT_KAFKA_TOPIC,
+// AUDIT_DATABASE_URL, AUDIT_DATABASE_DRIVER, AUDIT_BUFFER_SIZE and
+// AUDIT_FLUSH_INTERVAL
+func ConfigFromEnv() Config {
+	return Config{
+		Sink:           config.GetEnv("AUDIT_SINK", SinkStdout),
+		KafkaRESTURL:   config.GetEnv("AUDIT_KAFKA_REST_URL", ""),
+		KafkaTopic:     config.GetEnv("AUDIT_KAFKA_TOPIC", "audit-events"),
+		DatabaseURL:    config.GetEnv("AUDIT_DATABASE_URL", ""),
+		DatabaseDriver: config.GetEnv("AUDIT_DATABASE_DRIVER", "pgx"),
+		BufferSize:     config.GetEnvInt("AUDIT_BUFFER_SIZE", DefaultBufferSize),
+		FlushInterval:  config.GetEnvDuration("AUDIT_FLUSH_INTERVAL", DefaultFlushInterval),
+	}
+}
+
+// ValidateEnv checks the AUDIT_* settings, for services' startup validation
+func ValidateEnv(v *config.Validator) {
+	v.OneOf("AUDIT_SINK", SinkStdout, SinkKafka, SinkPostgres, SinkNone)
+	v.IntRange("AUDIT_BUFFER_SIZE", 1, 1_000_000)
+	v.DurationRange("AUDIT_FLUSH_INTERVAL", 10*time.Millisecond, time.Minute)
+	switch config.GetEnv("AUDIT_SINK", SinkStdout) {
+	case SinkKafka:
+		v.Required("AUDIT_KAFKA_REST_URL")
+	case SinkPostgres:
+		v.Required("AUDIT_DATABASE_URL")
+	}
+}
+
+// Stats counts what an Emitter has done with its events
+type Stats struct {
+	Emitted int64 `json:"emitted"`
+	Written int64 `json:"written"`
+	// Fallback counts events written to stderr because the sink failed or the queue
+	// was full
+	Fallback int64 `json:"fallback"`
+}
+
+// Emitter queues events and writes them to its sink in batches. A nil Emitter
+// discards events, so code paths can emit whether or not auditing is set up.
+type Emitter struct {
+	service  string
+	sink     Sink
+	interval time.Duration
+	traceID  func(ctx context.Context) string
+	onWrite  func(events int, err error)
+	forward  func(ev Event)
+	fallback io.Writer
+
+	queue chan Event
+	done  chan struct{}
+	once  sync.Once
+	// mu is held to enqueue and to close the queue, so Emit never sends on it closed
+	mu     sync.RWMutex
+	closed bool
+
+	emitted, written, fellBack atomic.Int64
+}
+
+// Open creates an emitter for a service with the sink cfg selects. The none sink
+// returns a nil Emitter, which discards events.
+func Open(ctx context.Context, service string, cfg Config) (*Emitter, error) {
+	var sink Sink
+	switch cfg.Sink {
+	case SinkStdout:
+		sink = NewWriterSink(os.Stdout)
+	case SinkKafka:
+		if cfg.KafkaRESTURL == "" {
+			return nil, fmt.Errorf("audit sink kafka requires AUDIT_KAFKA_REST_URL")
+		}
+		sink = NewKafkaSink(cfg.KafkaRESTURL, cfg.KafkaTopic, nil)
+	case SinkPostgres:
+		if cfg.DatabaseURL == "" {
+			return nil, fmt.Errorf("audit sink postgres requires AUDIT_DATABASE_URL")
+		}
+		pg, err := OpenPostgresSink(ctx, cfg.DatabaseDriver, cfg.DatabaseURL)
+		if err != nil {
+			return nil, err
+		}
+		sink = pg
+	case SinkNone, "":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown audit sink %q: use stdout, kafka, postgres or none", cfg.Sink)
+	}
+	return NewEmitter(service, sink, cfg), nil
+}
+
+// NewEmitter creates an emitter writing a service's events to sink and starts its
+// writer
+func NewEmitter(service string, sink Sink, cfg Config) *Emitter {
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = DefaultBufferSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = DefaultFlushInterval
+	}
+	e := &Emitter{
+		service:  service,
+		sink:     sink,
+		interval: cfg.FlushInterval,
+		traceID:  cfg.TraceID,
+		onWrite:  cfg.OnWrite,
+		forward:  cfg.Forward,
+		fallback: os.Stderr,
+		queue:    make(chan Event, cfg.BufferSize),
+		done:     make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// newEventID returns a random event ID
+func newEventID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Emit queues an event, filling in its ID, time, service, outcome (success), actor
+// (anonymous) and, from ctx, its trace ID when they are empty. It never blocks: when
+// the queue is full the event is written to stderr.
+func (e *Emitter) Emit(ctx context.Context, ev Event) {
+	if e == nil {
+		return
+	}
+	ev.Schema = SchemaVersion
+	if ev.ID == "" {
+		ev.ID = newEventID()
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now().UTC()
+	}
+	if ev.Service == "" {
+		ev.Service = e.service
+	}
+	if ev.Outcome == "" {
+		ev.Outcome = OutcomeSuccess
+	}
+	if ev.Actor == "" {
+		ev.Actor = "anonymous"
+	}
+	if ev.TraceID == "" && e.traceID != nil && ctx != nil {
+		ev.TraceID = e.traceID(ctx)
+	}
+	e.emitted.Add(1)
+	if e.forward != nil {
+		e.forward(ev)
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if !e.closed {
+		select {
+		case e.queue <- ev:
+			return
+		default:
+		}
+	}
+	e.writeFallback([]Event{ev})
+}
+
+// run batches queued events until the queue is closed
+func (e *Emitter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	batch := make([]Event, 0, DefaultBatchSize)
+	for {
+		select {
+		case ev, ok := <-e.queue:
+			if !ok {
+				e.write(batch)
+				return
+			}
+			batch = append(batch, ev)
+			if len(batch) < DefaultBatchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+		e.write(batch)
+		batch = batch[:0]
+	}
+}
+
+// write offers a batch to the sink, retrying with backoff, and falls back to stderr
+// if every attempt fails
+func (e *Emitter) write(batch []Event) {
+	if len(batch) == 0 {
+		return
+	}
+	var err error
+	for attempt := 0; attempt < writeAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * 200 * time.Millisecond)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err = e.sink.Write(ctx, batch)
+		cancel()
+		if err == nil {
+			break
+		}
+	}
+	if e.onWrite != nil {
+		e.onWrite(len(batch), err)
+	}
+	if err != nil {
+		e.writeFallback(batch)
+		return
+	}
+	e.written.Add(int64(len(batch)))
+}
+
+// writeFallback writes events to stderr as JSON lines, where the platform's log
+// collection still keeps them
+func (e *Emitter) writeFallback(events []Event) {
+	enc := json.NewEncoder(e.fallback)
+	for _, ev := range events {
+		_ = enc.Encode(ev)
+	}
+	e.fellBack.Add(int64(len(events)))
+}
+
+// Stats returns the emitter's counts
+func (e *Emitter) Stats() Stats {
+	if e == nil {
+		return Stats{}
+	}
+	return Stats{Emitted: e.emitted.Load(), Written: e.written.Load(), Fallback: e.fellBack.Load()}
+}
+
+// Close writes the queued events and closes the sink. Events emitted after Close go
+// to stderr. If ctx ends first, Close returns and the writer carries on with the
+// events still queued.
+func (e *Emitter) Close(ctx context.Context) error {
+	if e == nil {
+		return nil
+	}
+	e.once.Do(func() {
+		e.mu.Lock()
+		e.closed = true
+		close(e.queue)
+		e.mu.Unlock()
+	})
+	select {
+	case <-e.done:
+	case <-ctx.Done():
+		return fmt.Errorf("audit events not flushed: %w", ctx.Err())
+	}
+	return e.sink.Close()
+}
@@ -0,0 +1,176 @@
+package audit
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/healthcare-gitops/common/clientip"
+)
+
+// MiddlewareOptions configures how Middleware describes a request
+type MiddlewareOptions struct {
+	// Action names a served request's action, such as its method and route pattern.
+	// Defaults to the method and path.
+	Action func(r *http.Request) string
+	// Actor identifies the caller when no handler named one with SetActor, such as
+	// from a client certificate. Defaults to anonymous.
+	Actor func(r *http.Request) string
+	// RequestID returns a request's ID, such as one a request ID middleware put in
+	// its context. Defaults to the X-Request-ID header.
+	RequestID func(r *http.Request) string
+}
+
+// requestAudit is what handlers add to a request's event while it is served
+type requestAudit struct {
+	actor    string
+	resource string
+	traceID  string
+	details  map[string]string
+}
+
+type requestAuditKey struct{}
+
+// SetActor names the caller of a request being audited by Middleware, such as the
+// user an authentication middleware identified. It does nothing outside Middleware.
+func SetActor(ctx context.Context, actor string) {
+	if ra, ok := ctx.Value(requestAuditKey{}).(*requestAudit); ok {
+		ra.actor = actor
+	}
+}
+
+// SetResource names what a request being audited by Middleware acted on, in place of
+// its path
+func SetResource(ctx context.Context, resource string) {
+	if ra, ok := ctx.Value(requestAuditKey{}).(*requestAudit); ok {
+		ra.resource = resource
+	}
+}
+
+// SetTraceID names the trace of a request being audited by Middleware, for services
+// whose spans start inside it, per route
+func SetTraceID(ctx context.Context, traceID string) {
+	if ra, ok := ctx.Value(requestAuditKey{}).(*requestAudit); ok {
+		ra.traceID = traceID
+	}
+}
+
+// Annotate adds a detail to the event of a request being audited by Middleware. The
+// value must never carry PHI.
+func Annotate(ctx context.Context, key, value string) {
+	if ra, ok := ctx.Value(requestAuditKey{}).(*requestAudit); ok {
+		if ra.details == nil {
+			ra.details = make(map[string]string)
+		}
+		ra.details[key] = value
+	}
+}
+
+// statusRecorder captures the status a handler wrote
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// Flush passes flushes through to writers that support them, for middleware that
+// asserts http.Flusher rather than using http.ResponseController
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController, so streaming
+// handlers can still flush and extend deadlines
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// outcomeOf maps a response status to an outcome
+func outcomeOf(status int) string {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return OutcomeDenied
+	case status >= 400:
+		return OutcomeFailure
+	default:
+		return OutcomeSuccess
+	}
+}
+
+// sourceIP is the request's peer. X-Forwarded-For is written by the caller, so it is
+// not read here: services put clientip.TrustedProxies.Middleware in front, which
+// replaces the peer with the client its trusted proxies name.
+func sourceIP(r *http.Request) string {
+	return clientip.Peer(r)
+}
+
+// Middleware emits an event for every mutating request (POST, PUT, PATCH and DELETE)
+// once it has been served, with its outcome taken from the response status: 401 and
+// 403 are denied, other 4xx and 5xx failures. Reads are not audited here; services
+// emit their own events for sensitive reads. Nothing from the body is recorded.
+func (e *Emitter) Middleware(opts MiddlewareOptions) func(http.Handler) http.Handler {
+	if opts.RequestID == nil {
+		opts.RequestID = func(r *http.Request) string { return r.Header.Get("X-Request-ID") }
+	}
+	return func(next http.Handler) http.Handler {
+		if e == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+			default:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// The served request is what routers annotate with its route pattern
+			ra := &requestAudit{}
+			rec := &statusRecorder{ResponseWriter: w}
+			r = r.WithContext(context.WithValue(r.Context(), requestAuditKey{}, ra))
+			next.ServeHTTP(rec, r)
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+
+			ev := Event{
+				Actor:     ra.actor,
+				Action:    r.Method + " " + r.URL.Path,
+				Resource:  ra.resource,
+				TraceID:   ra.traceID,
+				Outcome:   outcomeOf(rec.status),
+				RequestID: opts.RequestID(r),
+				SourceIP:  sourceIP(r),
+				Details:   map[string]string{"status": strconv.Itoa(rec.status)},
+			}
+			if opts.Action != nil {
+				ev.Action = opts.Action(r)
+			}
+			if ev.Actor == "" && opts.Actor != nil {
+				ev.Actor = opts.Actor(r)
+			}
+			if ev.Resource == "" {
+				ev.Resource = r.URL.Path
+			}
+			for k, v := range ra.details {
+				ev.Details[k] = v
+			}
+			e.Emit(r.Context(), ev)
+		})
+	}
+}
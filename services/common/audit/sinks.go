@@ -0,0 +1,194 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WriterSink writes events as JSON lines, to stdout for the platform's log collection
+type WriterSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewWriterSink creates a sink writing to w
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{enc: json.NewEncoder(w)}
+}
+
+func (s *WriterSink) Write(_ context.Context, events []Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ev := range events {
+		if err := s.enc.Encode(ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *WriterSink) Close() error {
+	return nil
+}
+
+// KafkaSink produces events to a topic through a Kafka REST Proxy (v2 API), keyed by
+// resource so one resource's events stay in order on a partition
+type KafkaSink struct {
+	endpoint string
+	client   *http.Client
+}
+
+// NewKafkaSink creates a sink producing to topic through the REST Proxy at restURL.
+// A nil client uses one with a 10 second timeout.
+func NewKafkaSink(restURL, topic string, client *http.Client) *KafkaSink {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &KafkaSink{
+		endpoint: strings.TrimRight(restURL, "/") + "/topics/" + url.PathEscape(topic),
+		client:   client,
+	}
+}
+
+type kafkaRecord struct {
+	Key   string `json:"key"`
+	Value Event  `json:"value"`
+}
+
+type kafkaProduceResponse struct {
+	Offsets []struct {
+		ErrorCode *int   `json:"error_code"`
+		Error     string `json:"error"`
+	} `json:"offsets"`
+}
+
+func (s *KafkaSink) Write(ctx context.Context, events []Event) error {
+	records := make([]kafkaRecord, len(events))
+	for i, ev := range events {
+		key := ev.Resource
+		if key == "" {
+			key = ev.Service
+		}
+		records[i] = kafkaRecord{Key: key, Value: ev}
+	}
+	body, err := json.Marshal(map[string]interface{}{"records": records})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("kafka rest proxy returned %s", resp.Status)
+	}
+
+	// The proxy answers 200 even when some records were not produced
+	var produced kafkaProduceResponse
+	if err := json.NewDecoder(resp.Body).Decode(&produced); err != nil {
+		return fmt.Errorf("decode kafka rest proxy response: %w", err)
+	}
+	for _, o := range produced.Offsets {
+		if o.ErrorCode != nil {
+			return fmt.Errorf("kafka rest proxy: %s (code %d)", o.Error, *o.ErrorCode)
+		}
+	}
+	return nil
+}
+
+func (s *KafkaSink) Close() error {
+	return nil
+}
+
+// postgresSchema creates the audit table. The full event is kept as JSON; the
+// columns investigations filter on are broken out and indexed.
+const postgresSchema = `
+CREATE TABLE IF NOT EXISTS audit_events (
+	id          TEXT PRIMARY KEY,
+	occurred_at TIMESTAMPTZ NOT NULL,
+	service     TEXT NOT NULL,
+	actor       TEXT NOT NULL DEFAULT '',
+	action      TEXT NOT NULL,
+	resource    TEXT NOT NULL DEFAULT '',
+	outcome     TEXT NOT NULL,
+	trace_id    TEXT NOT NULL DEFAULT '',
+	event       JSONB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS audit_events_occurred_idx ON audit_events (occurred_at DESC);
+CREATE INDEX IF NOT EXISTS audit_events_actor_idx ON audit_events (actor, occurred_at DESC);
+CREATE INDEX IF NOT EXISTS audit_events_resource_idx ON audit_events (resource, occurred_at DESC);
+`
+
+// PostgresSink inserts events into the audit_events table through database/sql
+type PostgresSink struct {
+	db *sql.DB
+}
+
+// OpenPostgresSink connects and creates the audit table if it is missing. The driver
+// is registered under driver by the build.
+func OpenPostgresSink(ctx context.Context, driver, dsn string) (*PostgresSink, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open audit database: %w", err)
+	}
+	db.SetMaxOpenConns(4)
+	db.SetConnMaxIdleTime(5 * time.Minute)
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connect to audit database: %w", err)
+	}
+	if _, err := db.ExecContext(ctx, postgresSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create audit schema: %w", err)
+	}
+	return &PostgresSink{db: db}, nil
+}
+
+// Write inserts a batch in one transaction. Events already stored by an earlier
+// attempt are skipped.
+func (s *PostgresSink) Write(ctx context.Context, events []Event) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, ev := range events {
+		record, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO audit_events (id, occurred_at, service, actor, action, resource, outcome, trace_id, event)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			ON CONFLICT (id) DO NOTHING`,
+			ev.ID, ev.Time, ev.Service, ev.Actor, ev.Action, ev.Resource, ev.Outcome, ev.TraceID, record,
+		); err != nil {
+			return fmt.Errorf("insert audit event: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *PostgresSink) Close() error {
+	return s.db.Close()
+}
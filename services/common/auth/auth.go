@@ -0,0 +1,363 @@
+// Package auth authenticates requests by their bearer token, checked against
+// auth-service's /introspect endpoint, and enforces the scopes each route requires.
+// Introspection results are cached briefly in a bounded LRU, so a revoked or expired
+// token stops working within CacheTTL, and the caller's identity is put in the request
+// context.
+package auth
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/healthcare-gitops/common/audit"
+	"github.com/healthcare-gitops/common/clientip"
+	"github.com/healthcare-gitops/common/config"
+)
+
+const (
+	// DefaultCacheTTL bounds how long a token's introspection is reused
+	DefaultCacheTTL = 30 * time.Second
+	// DefaultNegativeCacheTTL bounds how long an inactive token stays refused without
+	// asking auth-service again
+	DefaultNegativeCacheTTL = 5 * time.Second
+	// DefaultCacheSize is how many tokens' introspections are kept
+	DefaultCacheSize = 10000
+)
+
+// Cache lookup results passed to Config.OnCacheLookup
+const (
+	CacheHit  = "hit"
+	CacheMiss = "miss"
+)
+
+// ErrThrottled means auth-service is refusing the user or client address after
+// failed authentications
+var ErrThrottled = errors.New("authentication attempts throttled")
+
+// Introspection is auth-service's view of a bearer token
+type Introspection struct {
+	Active bool     `json:"active"`
+	UserID string   `json:"user_id,omitempty"`
+	Scopes []string `json:"scopes,omitempty"`
+	Role   string   `json:"role,omitempty"`
+	Exp    int64    `json:"exp,omitempty"`
+}
+
+// HasScope reports whether the token grants scope
+func (i *Introspection) HasScope(scope string) bool {
+	for _, s := range i.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Identity is the authenticated caller of a request
+type Identity struct {
+	UserID    string
+	Role      string
+	Scopes    []string
+	ExpiresAt time.Time
+}
+
+// HasScope reports whether the caller holds scope
+func (id Identity) HasScope(scope string) bool {
+	for _, s := range id.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// AdminScope satisfies every scope Require asks for, as auth-service's admin policy
+// allows every action
+const AdminScope = "admin"
+
+type identityContextKey struct{}
+
+// WithIdentity returns a copy of ctx carrying id
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityContextKey{}, id)
+}
+
+// FromContext returns the identity Require stored for the request
+func FromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityContextKey{}).(Identity)
+	return id, ok
+}
+
+// Config configures an Introspector
+type Config struct {
+	// IntrospectURL is auth-service's /introspect endpoint
+	IntrospectURL string
+	// CacheTTL is how long an introspection is reused, never beyond the token's
+	// expiry. Defaults to DefaultCacheTTL.
+	CacheTTL time.Duration
+	// NegativeCacheTTL is how long an inactive token's introspection is reused.
+	// Defaults to DefaultNegativeCacheTTL.
+	NegativeCacheTTL time.Duration
+	// CacheSize caps the cached introspections; the least recently used are evicted
+	// first. Defaults to DefaultCacheSize.
+	CacheSize int
+	// Timeout bounds each call to auth-service. Defaults to 5 seconds.
+	Timeout    time.Duration
+	HTTPClient *http.Client
+	// OnCacheLookup, if set, is called with CacheHit or CacheMiss for every
+	// introspection, for metrics
+	OnCacheLookup func(result string)
+}
+
+// ConfigFromEnv reads AUTH_INTROSPECT_URL, AUTH_CACHE_TTL_SECONDS,
+// AUTH_NEGATIVE_CACHE_TTL_SECONDS and AUTH_CACHE_SIZE
+func ConfigFromEnv() Config {
+	return Config{
+		IntrospectURL:    config.GetEnv("AUTH_INTROSPECT_URL", ""),
+		CacheTTL:         time.Duration(config.GetEnvInt("AUTH_CACHE_TTL_SECONDS", int(DefaultCacheTTL/time.Second))) * time.Second,
+		NegativeCacheTTL: time.Duration(config.GetEnvInt("AUTH_NEGATIVE_CACHE_TTL_SECONDS", int(DefaultNegativeCacheTTL/time.Second))) * time.Second,
+		CacheSize:        config.GetEnvInt("AUTH_CACHE_SIZE", DefaultCacheSize),
+	}
+}
+
+type cachedIntrospection struct {
+	key     [sha256.Size]byte
+	result  *Introspection
+	expires time.Time
+}
+
+// Introspector validates bearer tokens against auth-service
+type Introspector struct {
+	url         string
+	ttl         time.Duration
+	negativeTTL time.Duration
+	size        int
+	client      *http.Client
+	onLookup    func(result string)
+	now         func() time.Time
+
+	mu sync.Mutex
+	// lru holds *cachedIntrospection, most recently used first
+	lru   *list.List
+	cache map[[sha256.Size]byte]*list.Element
+}
+
+// NewIntrospector creates an introspector for cfg.IntrospectURL
+func NewIntrospector(cfg Config) *Introspector {
+	if cfg.CacheTTL <= 0 {
+		cfg.CacheTTL = DefaultCacheTTL
+	}
+	if cfg.NegativeCacheTTL <= 0 {
+		cfg.NegativeCacheTTL = DefaultNegativeCacheTTL
+	}
+	if cfg.CacheSize <= 0 {
+		cfg.CacheSize = DefaultCacheSize
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: cfg.Timeout}
+	}
+	return &Introspector{
+		url:         cfg.IntrospectURL,
+		ttl:         cfg.CacheTTL,
+		negativeTTL: cfg.NegativeCacheTTL,
+		size:        cfg.CacheSize,
+		client:      client,
+		onLookup:    cfg.OnCacheLookup,
+		now:         time.Now,
+		lru:         list.New(),
+		cache:       make(map[[sha256.Size]byte]*list.Element),
+	}
+}
+
+// SetClock replaces the clock cache expiry is measured with, for tests
+func (ti *Introspector) SetClock(now func() time.Time) {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	ti.now = now
+}
+
+// Introspect returns the status of the token r presents, forwarding r's client so
+// auth-service counts failed attempts against it rather than this service. An error
+// means auth-service could not be asked or is throttling the caller; an invalid token
+// is an inactive result, not an error.
+func (ti *Introspector) Introspect(r *http.Request, token string) (*Introspection, error) {
+	return ti.introspect(r.Context(), token, clientIP(r))
+}
+
+// Verified returns the user r's bearer token was already found active for, or "" when
+// there is none or its result is not cached. It never calls auth-service, so it suits
+// middleware, such as rate limiting, that runs before a route authenticates.
+func (ti *Introspector) Verified(r *http.Request) string {
+	if ti == nil {
+		return ""
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return ""
+	}
+	_, result, ok := ti.lookup(sha256.Sum256([]byte(token)))
+	if !ok || !result.Active {
+		return ""
+	}
+	return result.UserID
+}
+
+// introspect asks auth-service about token on behalf of the client at clientIP, so
+// auth-service counts failed attempts against the client rather than this service
+func (ti *Introspector) introspect(ctx context.Context, token, clientIP string) (*Introspection, error) {
+	key := sha256.Sum256([]byte(token))
+	now, result, ok := ti.lookup(key)
+	if ti.onLookup != nil {
+		if ok {
+			ti.onLookup(CacheHit)
+		} else {
+			ti.onLookup(CacheMiss)
+		}
+	}
+	if ok {
+		return result, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ti.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if clientIP != "" {
+		req.Header.Set("X-Forwarded-For", clientIP)
+	}
+	resp, err := ti.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result = &Introspection{}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			return nil, fmt.Errorf("decode introspection response: %w", err)
+		}
+	case http.StatusUnauthorized:
+		// auth-service answers 401 for tokens that are malformed, forged or expired
+	case http.StatusTooManyRequests:
+		return nil, fmt.Errorf("%w: retry after %s seconds", ErrThrottled, resp.Header.Get("Retry-After"))
+	default:
+		return nil, fmt.Errorf("introspection returned %s", resp.Status)
+	}
+
+	expires := now.Add(ti.ttl)
+	if !result.Active {
+		expires = now.Add(ti.negativeTTL)
+	}
+	if result.Exp > 0 && time.Unix(result.Exp, 0).Before(expires) {
+		expires = time.Unix(result.Exp, 0)
+	}
+	ti.store(key, result, expires)
+	return result, nil
+}
+
+// lookup returns the current time and the token's cached introspection, if it has
+// not expired, marking it most recently used
+func (ti *Introspector) lookup(key [sha256.Size]byte) (time.Time, *Introspection, bool) {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	now := ti.now()
+	el, ok := ti.cache[key]
+	if !ok {
+		return now, nil, false
+	}
+	cached := el.Value.(*cachedIntrospection)
+	if !now.Before(cached.expires) {
+		ti.lru.Remove(el)
+		delete(ti.cache, key)
+		return now, nil, false
+	}
+	ti.lru.MoveToFront(el)
+	return now, cached.result, true
+}
+
+// store caches an introspection until expires, evicting the least recently used
+// entries beyond the cache size
+func (ti *Introspector) store(key [sha256.Size]byte, result *Introspection, expires time.Time) {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	if el, ok := ti.cache[key]; ok {
+		el.Value = &cachedIntrospection{key: key, result: result, expires: expires}
+		ti.lru.MoveToFront(el)
+		return
+	}
+	ti.cache[key] = ti.lru.PushFront(&cachedIntrospection{key: key, result: result, expires: expires})
+	for ti.lru.Len() > ti.size {
+		oldest := ti.lru.Back()
+		ti.lru.Remove(oldest)
+		delete(ti.cache, oldest.Value.(*cachedIntrospection).key)
+	}
+}
+
+// clientIP names the client auth-service should hold responsible for the request: the
+// X-Forwarded-For hops it arrived with and its peer, for auth-service to resolve
+// through the proxies it trusts
+func clientIP(r *http.Request) string {
+	return clientip.ForwardedFor(r)
+}
+
+// Require admits requests whose bearer token is active and holds every one of scopes,
+// or the admin scope, and passes them on with the caller's Identity in the context
+// and named as the actor of the request's audit event.
+// Requests without a token or with an invalid one get 401, tokens lacking a scope 403,
+// throttled callers 429 and requests auth-service cannot answer 503.
+//
+// A nil Introspector admits every request unchanged, for deployments without
+// auth-service; services warn about it at startup.
+func (ti *Introspector) Require(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if ti == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || token == "" {
+				http.Error(w, "Bearer token required", http.StatusUnauthorized)
+				return
+			}
+			info, err := ti.introspect(r.Context(), token, clientIP(r))
+			if errors.Is(err, ErrThrottled) {
+				http.Error(w, "Too many failed authentication attempts", http.StatusTooManyRequests)
+				return
+			}
+			if err != nil {
+				http.Error(w, "Authorization service unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			if !info.Active {
+				http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+				return
+			}
+			id := Identity{UserID: info.UserID, Role: info.Role, Scopes: info.Scopes}
+			if info.Exp > 0 {
+				id.ExpiresAt = time.Unix(info.Exp, 0)
+			}
+			for _, scope := range scopes {
+				if !id.HasScope(scope) && !id.HasScope(AdminScope) {
+					http.Error(w, "Token lacks the "+scope+" scope", http.StatusForbidden)
+					return
+				}
+			}
+			audit.SetActor(r.Context(), id.UserID)
+			next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), id)))
+		})
+	}
+}
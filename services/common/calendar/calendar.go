@@ -0,0 +1,322 @@
+// Package calendar provides per-tenant business hours and holiday calendars, so
+// schedulers can keep maintenance, billing and patient messaging inside the hours a
+// hospital is staffed. Calendars are loaded from CALENDARS_FILE, which every service
+// and replica reads alike, and a service with none treats every moment as open.
+package calendar
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	// Calendars name IANA time zones, which minimal images do not ship
+	_ "time/tzdata"
+)
+
+// DefaultTenant is the calendar used for tenants without one of their own
+const DefaultTenant = "default"
+
+// searchDays bounds how far ahead NextOpen and AddBusinessDays look for an opening
+const searchDays = 400
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday,
+	"wednesday": time.Wednesday, "thursday": time.Thursday, "friday": time.Friday,
+	"saturday": time.Saturday,
+}
+
+// Interval is a span of business hours within a day, from Start up to End, both
+// "HH:MM" in the calendar's time zone. End may be "24:00"; hours past midnight are a
+// separate interval on the next day.
+type Interval struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// Holiday is a day the tenant is closed. Date is "2006-01-02" for a single day or
+// "01-02" for one that recurs every year.
+type Holiday struct {
+	Date string `json:"date"`
+	Name string `json:"name"`
+}
+
+// Calendar is a tenant's weekly business hours and holidays. A nil *Calendar is
+// always open.
+type Calendar struct {
+	Tenant   string                `json:"tenant"`
+	TimeZone string                `json:"time_zone"`
+	Hours    map[string][]Interval `json:"hours"`
+	Holidays []Holiday             `json:"holidays,omitempty"`
+
+	loc      *time.Location
+	week     [7][]span // by weekday, in seconds since midnight
+	holidays map[string]Holiday
+}
+
+type span struct{ start, end int }
+
+// parseClock parses "HH:MM" into seconds since midnight
+func parseClock(value string) (int, error) {
+	var h, m int
+	if len(value) != 5 || value[2] != ':' {
+		return 0, fmt.Errorf("invalid time %q, want HH:MM", value)
+	}
+	if _, err := fmt.Sscanf(value, "%02d:%02d", &h, &m); err != nil || h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("invalid time %q, want HH:MM", value)
+	}
+	return h*3600 + m*60, nil
+}
+
+// compile validates the calendar and prepares it for queries
+func (c *Calendar) compile() error {
+	if c.Tenant == "" {
+		return errors.New("tenant is required")
+	}
+	if c.TimeZone == "" {
+		c.TimeZone = "UTC"
+	}
+	loc, err := time.LoadLocation(c.TimeZone)
+	if err != nil {
+		return fmt.Errorf("calendar %s: unknown time_zone %q", c.Tenant, c.TimeZone)
+	}
+	c.loc = loc
+
+	open := false
+	for day, intervals := range c.Hours {
+		weekday, ok := weekdays[strings.ToLower(day)]
+		if !ok {
+			return fmt.Errorf("calendar %s: unknown day %q", c.Tenant, day)
+		}
+		spans := make([]span, 0, len(intervals))
+		for _, iv := range intervals {
+			start, err := parseClock(iv.Start)
+			if err != nil {
+				return fmt.Errorf("calendar %s %s: %w", c.Tenant, day, err)
+			}
+			end, err := parseClock(iv.End)
+			if err != nil {
+				return fmt.Errorf("calendar %s %s: %w", c.Tenant, day, err)
+			}
+			if start >= end {
+				return fmt.Errorf("calendar %s %s: %s-%s ends before it starts", c.Tenant, day, iv.Start, iv.End)
+			}
+			spans = append(spans, span{start, end})
+		}
+		sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+		for i := 1; i < len(spans); i++ {
+			if spans[i].start < spans[i-1].end {
+				return fmt.Errorf("calendar %s %s: intervals overlap", c.Tenant, day)
+			}
+		}
+		c.week[weekday] = spans
+		open = open || len(spans) > 0
+	}
+	if !open {
+		return fmt.Errorf("calendar %s: no business hours", c.Tenant)
+	}
+
+	c.holidays = make(map[string]Holiday, len(c.Holidays))
+	for _, h := range c.Holidays {
+		layout := "2006-01-02"
+		if len(h.Date) == len("01-02") {
+			layout = "01-02"
+		}
+		if _, err := time.Parse(layout, h.Date); err != nil {
+			return fmt.Errorf("calendar %s: invalid holiday date %q, want YYYY-MM-DD or MM-DD", c.Tenant, h.Date)
+		}
+		c.holidays[h.Date] = h
+	}
+	return nil
+}
+
+// Location returns the calendar's time zone
+func (c *Calendar) Location() *time.Location {
+	if c == nil {
+		return time.UTC
+	}
+	return c.loc
+}
+
+// Holiday returns the holiday t falls on, if any
+func (c *Calendar) Holiday(t time.Time) (Holiday, bool) {
+	if c == nil {
+		return Holiday{}, false
+	}
+	local := t.In(c.loc)
+	if h, ok := c.holidays[local.Format("2006-01-02")]; ok {
+		return h, true
+	}
+	h, ok := c.holidays[local.Format("01-02")]
+	return h, ok
+}
+
+// BusinessDay reports whether t falls on a day with business hours that is not a
+// holiday
+func (c *Calendar) BusinessDay(t time.Time) bool {
+	if c == nil {
+		return true
+	}
+	_, holiday := c.Holiday(t)
+	return !holiday && len(c.week[t.In(c.loc).Weekday()]) > 0
+}
+
+// at returns the instant seconds after midnight on the local day of t
+func (c *Calendar) at(t time.Time, seconds int) time.Time {
+	local := t.In(c.loc)
+	return time.Date(local.Year(), local.Month(), local.Day(), seconds/3600, seconds%3600/60, 0, 0, c.loc)
+}
+
+// interval returns the business-hours interval t falls in
+func (c *Calendar) interval(t time.Time) (span, bool) {
+	if !c.BusinessDay(t) {
+		return span{}, false
+	}
+	local := t.In(c.loc)
+	seconds := local.Hour()*3600 + local.Minute()*60 + local.Second()
+	for _, s := range c.week[local.Weekday()] {
+		if seconds >= s.start && seconds < s.end {
+			return s, true
+		}
+	}
+	return span{}, false
+}
+
+// IsOpen reports whether t is within business hours
+func (c *Calendar) IsOpen(t time.Time) bool {
+	if c == nil {
+		return true
+	}
+	_, open := c.interval(t)
+	return open
+}
+
+// ClosesAt returns when the business hours t falls in end. It reports false when the
+// calendar is closed at t or is nil.
+func (c *Calendar) ClosesAt(t time.Time) (time.Time, bool) {
+	if c == nil {
+		return time.Time{}, false
+	}
+	s, open := c.interval(t)
+	if !open {
+		return time.Time{}, false
+	}
+	return c.at(t, s.end), true
+}
+
+// NextOpen returns t when the calendar is open then, and otherwise the start of the
+// next business hours. This is the hook schedulers use to hold work until the tenant
+// is staffed. A calendar with no opening within searchDays returns t.
+func (c *Calendar) NextOpen(t time.Time) time.Time {
+	if c == nil || c.IsOpen(t) {
+		return t
+	}
+	day := t
+	for i := 0; i < searchDays; i++ {
+		if c.BusinessDay(day) {
+			for _, s := range c.week[day.In(c.loc).Weekday()] {
+				if start := c.at(day, s.start); start.After(t) {
+					return start
+				}
+			}
+		}
+		day = c.at(day, 0).AddDate(0, 0, 1)
+	}
+	return t
+}
+
+// AddBusinessDays returns the opening of the nth business day after t's day, for
+// follow-ups counted in business days such as statement reminders. n <= 0 gives
+// NextOpen(t).
+func (c *Calendar) AddBusinessDays(t time.Time, n int) time.Time {
+	if n <= 0 {
+		return c.NextOpen(t)
+	}
+	if c == nil {
+		return t.AddDate(0, 0, n)
+	}
+	day := c.at(t, 0)
+	for i := 0; i < searchDays && n > 0; i++ {
+		day = day.AddDate(0, 0, 1)
+		if c.BusinessDay(day) {
+			n--
+		}
+	}
+	return c.NextOpen(day)
+}
+
+// Registry holds tenants' calendars. A nil *Registry has no calendars.
+type Registry struct {
+	calendars map[string]*Calendar
+}
+
+// NewRegistry validates calendars and indexes them by tenant
+func NewRegistry(calendars ...Calendar) (*Registry, error) {
+	r := &Registry{calendars: make(map[string]*Calendar, len(calendars))}
+	for i := range calendars {
+		c := calendars[i]
+		if err := c.compile(); err != nil {
+			return nil, err
+		}
+		if _, dup := r.calendars[c.Tenant]; dup {
+			return nil, fmt.Errorf("calendar %s is defined twice", c.Tenant)
+		}
+		r.calendars[c.Tenant] = &c
+	}
+	return r, nil
+}
+
+// LoadFile reads a JSON array of calendars. An empty path gives an empty registry.
+func LoadFile(path string) (*Registry, error) {
+	if path == "" {
+		return NewRegistry()
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var calendars []Calendar
+	if err := json.Unmarshal(data, &calendars); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	r, err := NewRegistry(calendars...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return r, nil
+}
+
+// Get returns the tenant's own calendar
+func (r *Registry) Get(tenant string) (*Calendar, bool) {
+	if r == nil {
+		return nil, false
+	}
+	c, ok := r.calendars[tenant]
+	return c, ok
+}
+
+// For returns the calendar that applies to a tenant: its own, else the default one,
+// else nil, which is always open
+func (r *Registry) For(tenant string) *Calendar {
+	if c, ok := r.Get(tenant); ok {
+		return c
+	}
+	c, _ := r.Get(DefaultTenant)
+	return c
+}
+
+// List returns the calendars ordered by tenant
+func (r *Registry) List() []*Calendar {
+	if r == nil {
+		return []*Calendar{}
+	}
+	out := make([]*Calendar, 0, len(r.calendars))
+	for _, c := range r.calendars {
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Tenant < out[j].Tenant })
+	return out
+}
@@ -0,0 +1,121 @@
+package calendar
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Status is the answer to a calendar query: whether a tenant is open at a moment and
+// when it next opens
+type Status struct {
+	Tenant string `json:"tenant"`
+	// Calendar is the calendar that applied, the default one for tenants without
+	// their own
+	Calendar    string     `json:"calendar"`
+	At          time.Time  `json:"at"`
+	Open        bool       `json:"open"`
+	BusinessDay bool       `json:"business_day"`
+	Holiday     *Holiday   `json:"holiday,omitempty"`
+	ClosesAt    *time.Time `json:"closes_at,omitempty"`
+	NextOpen    time.Time  `json:"next_open"`
+	// AfterBusinessDays is the opening of the business_days-th business day after At,
+	// when asked for
+	AfterBusinessDays *time.Time `json:"after_business_days,omitempty"`
+}
+
+// Query describes a tenant's calendar at t. business days <= 0 leaves
+// AfterBusinessDays unset.
+func (r *Registry) Query(tenant string, t time.Time, businessDays int) (Status, bool) {
+	c := r.For(tenant)
+	if c == nil {
+		return Status{}, false
+	}
+	local := t.In(c.loc)
+	status := Status{
+		Tenant:      tenant,
+		Calendar:    c.Tenant,
+		At:          local,
+		Open:        c.IsOpen(t),
+		BusinessDay: c.BusinessDay(t),
+		NextOpen:    c.NextOpen(t),
+	}
+	if h, ok := c.Holiday(t); ok {
+		status.Holiday = &h
+	}
+	if closes, ok := c.ClosesAt(t); ok {
+		status.ClosesAt = &closes
+	}
+	if businessDays > 0 {
+		after := c.AddBusinessDays(t, businessDays)
+		status.AfterBusinessDays = &after
+	}
+	return status, true
+}
+
+// Handler serves the calendar query API wherever it is mounted:
+//
+//	GET .../calendars                  every calendar
+//	GET .../calendars/{tenant}         the tenant's own calendar
+//	GET .../calendars/{tenant}/query   Status at ?at= (RFC 3339, default now), with
+//	                                   ?business_days=n for AfterBusinessDays
+//
+// Queries for tenants without a calendar use the default one. Calendars are read-only
+// here; they change with CALENDARS_FILE.
+func Handler(r *Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		_, rest, _ := strings.Cut(req.URL.Path, "/calendars")
+		parts := strings.Split(strings.Trim(rest, "/"), "/")
+
+		switch {
+		case len(parts) == 1 && parts[0] == "":
+			calendars := r.List()
+			writeJSON(w, map[string]interface{}{"calendars": calendars, "count": len(calendars)})
+		case len(parts) == 1:
+			c, ok := r.Get(parts[0])
+			if !ok {
+				http.Error(w, "No calendar for tenant "+parts[0], http.StatusNotFound)
+				return
+			}
+			writeJSON(w, c)
+		case len(parts) == 2 && parts[1] == "query":
+			at := time.Now()
+			if v := req.URL.Query().Get("at"); v != "" {
+				parsed, err := time.Parse(time.RFC3339, v)
+				if err != nil {
+					http.Error(w, "at must be an RFC 3339 time", http.StatusBadRequest)
+					return
+				}
+				at = parsed
+			}
+			days := 0
+			if v := req.URL.Query().Get("business_days"); v != "" {
+				n, err := strconv.Atoi(v)
+				if err != nil || n < 0 || n > 365 {
+					http.Error(w, "business_days must be between 0 and 365", http.StatusBadRequest)
+					return
+				}
+				days = n
+			}
+			status, ok := r.Query(parts[0], at, days)
+			if !ok {
+				http.Error(w, "No calendar for tenant "+parts[0]+" and no default calendar", http.StatusNotFound)
+				return
+			}
+			writeJSON(w, status)
+		default:
+			http.NotFound(w, req)
+		}
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
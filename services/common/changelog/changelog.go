@@ -0,0 +1,164 @@
+// Package changelog provides the machine-readable API changelog every service serves at
+// /changelog. Services declare their changes as entries in code; integrators see what
+// was added or deprecated in each release, and the SDK warns when it calls a
+// deprecated endpoint.
+package changelog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Change kinds
+const (
+	Added      = "added"
+	Changed    = "changed"
+	Deprecated = "deprecated"
+	Removed    = "removed"
+)
+
+var kinds = map[string]bool{Added: true, Changed: true, Deprecated: true, Removed: true}
+
+// Entry is one change to an endpoint, or to one of its fields
+type Entry struct {
+	// Version is the API spec version the change took effect in
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+	// Method and Path name the endpoint as documented, e.g. GET /api/v1/devices/{deviceID}
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	// Field is the request or response field changed, dotted for nested fields, when
+	// the change is not to the whole endpoint
+	Field       string `json:"field,omitempty"`
+	Description string `json:"description"`
+	// Replacement is what to use instead of a deprecated or removed endpoint or field
+	Replacement string `json:"replacement,omitempty"`
+	// Sunset is the date, YYYY-MM-DD, a deprecated endpoint or field stops being served
+	Sunset string `json:"sunset,omitempty"`
+}
+
+// Changelog is the document served at /changelog
+type Changelog struct {
+	Service string `json:"service"`
+	// Version is the API spec version the service implements
+	Version string `json:"version"`
+	// Entries are newest first
+	Entries []Entry `json:"entries"`
+}
+
+// parseVersion splits a MAJOR.MINOR.PATCH version
+func parseVersion(v string) ([3]int, error) {
+	var parts [3]int
+	fields := strings.Split(v, ".")
+	if len(fields) != 3 {
+		return parts, fmt.Errorf("version %q is not MAJOR.MINOR.PATCH", v)
+	}
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return parts, fmt.Errorf("version %q is not MAJOR.MINOR.PATCH", v)
+		}
+		parts[i] = n
+	}
+	return parts, nil
+}
+
+// Compare orders two MAJOR.MINOR.PATCH versions, returning -1, 0 or 1. Malformed
+// versions sort first.
+func Compare(a, b string) int {
+	va, errA := parseVersion(a)
+	vb, errB := parseVersion(b)
+	switch {
+	case errA != nil && errB != nil:
+		return 0
+	case errA != nil:
+		return -1
+	case errB != nil:
+		return 1
+	}
+	for i := range va {
+		if va[i] != vb[i] {
+			if va[i] < vb[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// New validates a service's entries and orders them newest first. An unknown kind, a
+// malformed version or sunset, or an entry newer than the service's version is an
+// error, so a bad entry stops the service at startup instead of being served.
+func New(service, version string, entries []Entry) (*Changelog, error) {
+	if _, err := parseVersion(version); err != nil {
+		return nil, err
+	}
+	sorted := make([]Entry, len(entries))
+	copy(sorted, entries)
+	for i, e := range sorted {
+		if _, err := parseVersion(e.Version); err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i, err)
+		}
+		if Compare(e.Version, version) > 0 {
+			return nil, fmt.Errorf("entry %d: version %s is newer than the API's %s", i, e.Version, version)
+		}
+		if !kinds[e.Kind] {
+			return nil, fmt.Errorf("entry %d: unknown kind %q", i, e.Kind)
+		}
+		if e.Method == "" || !strings.HasPrefix(e.Path, "/") {
+			return nil, fmt.Errorf("entry %d: method and path are required", i)
+		}
+		sorted[i].Method = strings.ToUpper(e.Method)
+		if e.Sunset != "" {
+			if _, err := time.Parse(time.DateOnly, e.Sunset); err != nil {
+				return nil, fmt.Errorf("entry %d: sunset %q is not YYYY-MM-DD", i, e.Sunset)
+			}
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return Compare(sorted[i].Version, sorted[j].Version) > 0 })
+	return &Changelog{Service: service, Version: version, Entries: sorted}, nil
+}
+
+// Filter returns the entries newer than since, when set, and of kind, when set
+func (c *Changelog) Filter(since, kind string) []Entry {
+	entries := make([]Entry, 0, len(c.Entries))
+	for _, e := range c.Entries {
+		if since != "" && Compare(e.Version, since) <= 0 {
+			continue
+		}
+		if kind != "" && e.Kind != kind {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// Handler serves the changelog. ?since=VERSION keeps the changes after a version the
+// client knows, and ?kind= one kind of change.
+func Handler(c *Changelog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		since, kind := r.URL.Query().Get("since"), r.URL.Query().Get("kind")
+		if since != "" {
+			if _, err := parseVersion(since); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if kind != "" && !kinds[kind] {
+			http.Error(w, "kind must be added, changed, deprecated or removed", http.StatusBadRequest)
+			return
+		}
+		doc := *c
+		doc.Entries = c.Filter(since, kind)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		json.NewEncoder(w).Encode(doc)
+	}
+}
@@ -0,0 +1,127 @@
+// Package clientip finds the client a request came from. X-Forwarded-For is set by
+// whoever sent the request, so it is only believed for the hops added by proxies the
+// deployment trusts; without trusted proxies the client is the connection's peer.
+package clientip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/healthcare-gitops/common/config"
+)
+
+// TrustedProxies are the proxies, such as the ingress and the platform's own services,
+// whose X-Forwarded-For hops are believed. The zero value trusts no proxy.
+type TrustedProxies struct {
+	prefixes []netip.Prefix
+}
+
+// Parse reads trusted proxies, each an IP address or a CIDR range
+func Parse(specs []string) (TrustedProxies, error) {
+	var t TrustedProxies
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(spec); err == nil {
+			t.prefixes = append(t.prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(spec)
+		if err != nil {
+			return TrustedProxies{}, fmt.Errorf("trusted proxy %q is neither an IP address nor a CIDR range", spec)
+		}
+		addr = addr.Unmap()
+		t.prefixes = append(t.prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return t, nil
+}
+
+// FromEnv reads TRUSTED_PROXIES, a comma-separated list of IP addresses and CIDR ranges
+func FromEnv() (TrustedProxies, error) {
+	return Parse(config.GetEnvList("TRUSTED_PROXIES", nil))
+}
+
+// ValidateEnv checks TRUSTED_PROXIES, for services' startup validation
+func ValidateEnv(v *config.Validator) {
+	_, err := FromEnv()
+	v.Check(err)
+}
+
+// Trusts reports whether ip is a trusted proxy
+func (t TrustedProxies) Trusts(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range t.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP is the address the request came from. When the peer is a trusted proxy,
+// X-Forwarded-For is walked from the nearest hop back, and the first hop not added by a
+// trusted proxy is the client; hops further back were written by the client itself.
+func (t TrustedProxies) ClientIP(r *http.Request) string {
+	client := Peer(r)
+	if !t.Trusts(client) {
+		return client
+	}
+	hops := forwardedHops(r)
+	for i := len(hops) - 1; i >= 0; i-- {
+		client = hops[i]
+		if !t.Trusts(client) {
+			break
+		}
+	}
+	return client
+}
+
+// Middleware replaces each request's RemoteAddr with its ClientIP, for the handlers
+// after it. Unlike chi's RealIP it ignores forwarding headers from untrusted peers.
+func (t TrustedProxies) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if client := t.ClientIP(r); client != Peer(r) {
+			r.RemoteAddr = client
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Peer is the address of the connection the request arrived on
+func Peer(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ForwardedFor is the X-Forwarded-For to send on when calling another service on the
+// request's behalf: the hops the request arrived with and its peer. The service called
+// decides which of them to believe.
+func ForwardedFor(r *http.Request) string {
+	hops := append(forwardedHops(r), Peer(r))
+	return strings.Join(hops, ", ")
+}
+
+// forwardedHops are the request's X-Forwarded-For hops, nearest last
+func forwardedHops(r *http.Request) []string {
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(header, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	return hops
+}
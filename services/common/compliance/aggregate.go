@@ -0,0 +1,409 @@
+package compliance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/healthcare-gitops/common/audit"
+)
+
+// Unreachable is the posture of a service whose status could not be collected
+const Unreachable = "unreachable"
+
+// frameworkOrder is the order frameworks are reported in; others follow by name
+var frameworkOrder = map[Framework]int{HIPAA: 0, SOX: 1, FDA: 2}
+
+// maxStatusBody bounds the status and metrics responses read from a service
+const maxStatusBody = 16 << 20
+
+// Source is a service to collect from, by name and base URL
+type Source struct {
+	Name string
+	URL  string
+}
+
+// ParseSources parses comma-separated name=url pairs, as in COMPLIANCE_SOURCES
+func ParseSources(value string) ([]Source, error) {
+	var sources []Source
+	seen := make(map[string]bool)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, raw, ok := strings.Cut(pair, "=")
+		name, raw = strings.TrimSpace(name), strings.TrimSpace(raw)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%q is not a name=url pair", pair)
+		}
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("%s: %q is not an http(s) URL", name, raw)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%s is listed twice", name)
+		}
+		seen[name] = true
+		sources = append(sources, Source{Name: name, URL: strings.TrimRight(raw, "/")})
+	}
+	if len(sources) == 0 {
+		return nil, errors.New("no sources")
+	}
+	return sources, nil
+}
+
+// ServiceControl is a control as reported by one service
+type ServiceControl struct {
+	Service string `json:"service"`
+	Control
+}
+
+// FrameworkReport is every service's controls under one framework
+type FrameworkReport struct {
+	Framework Framework        `json:"framework"`
+	Status    string           `json:"status"`
+	Passed    int              `json:"passed"`
+	Warnings  int              `json:"warnings"`
+	Failed    int              `json:"failed"`
+	Controls  []ServiceControl `json:"controls"`
+}
+
+// ServiceReport is what was collected from one service
+type ServiceReport struct {
+	Name    string `json:"name"`
+	URL     string `json:"url"`
+	Service string `json:"service,omitempty"`
+	Version string `json:"version,omitempty"`
+	// Status is the service's posture, at_risk when its violation counters are not
+	// zero, or unreachable
+	Status string       `json:"status"`
+	Error  string       `json:"error,omitempty"`
+	Audit  *audit.Stats `json:"audit,omitempty"`
+	// Violations are the service's violation counters, by the metric selector it named
+	Violations     map[string]float64 `json:"violations,omitempty"`
+	ViolationTotal float64            `json:"violation_total"`
+}
+
+// Report is the combined compliance posture of every service. Its status is the worst
+// of its services': a service that cannot be reached leaves the posture at_risk,
+// since its controls are unverified.
+type Report struct {
+	GeneratedAt time.Time         `json:"generated_at"`
+	Status      string            `json:"status"`
+	Frameworks  []FrameworkReport `json:"frameworks"`
+	Services    []ServiceReport   `json:"services"`
+}
+
+// Collector pulls services' compliance statuses and violation counters
+type Collector struct {
+	Client *http.Client
+	// BearerToken is sent as a bearer token, for services whose admin routes check
+	// auth-service tokens with the admin scope
+	BearerToken string
+	// AdminToken is sent in X-Admin-Token, for services guarded by a shared admin token
+	AdminToken string
+}
+
+// Collect pulls every source concurrently and combines them into a report
+func (c *Collector) Collect(ctx context.Context, sources []Source) Report {
+	collected := make([]collectedService, len(sources))
+	var wg sync.WaitGroup
+	for i, source := range sources {
+		wg.Add(1)
+		go func(i int, source Source) {
+			defer wg.Done()
+			collected[i] = c.collect(ctx, source)
+		}(i, source)
+	}
+	wg.Wait()
+	return combine(collected, time.Now().UTC())
+}
+
+// collectedService is one source's report and, when it was reached, its status
+type collectedService struct {
+	report ServiceReport
+	status *Status
+}
+
+func (c *Collector) collect(ctx context.Context, source Source) collectedService {
+	out := collectedService{report: ServiceReport{Name: source.Name, URL: source.URL, Status: Unreachable}}
+	body, err := c.get(ctx, source.URL+"/compliance/status")
+	if err != nil {
+		out.report.Error = err.Error()
+		return out
+	}
+	var status Status
+	if err := json.Unmarshal(body, &status); err != nil || status.Service == "" {
+		out.report.Error = "/compliance/status did not return a compliance status"
+		return out
+	}
+	for i := range status.Controls {
+		status.Controls[i].Evidence = resolveEvidence(source.URL, status.Controls[i].Evidence)
+	}
+	out.status = &status
+	out.report.Service, out.report.Version = status.Service, status.Version
+	out.report.Status = status.Status
+	out.report.Audit = &status.Audit
+
+	if len(status.ViolationMetrics) == 0 {
+		return out
+	}
+	exposition, err := c.get(ctx, source.URL+"/metrics")
+	if err != nil {
+		// Violations that cannot be counted are not known to be zero
+		out.report.Error = "violation metrics: " + err.Error()
+		out.report.Status = worse(out.report.Status, AtRisk)
+		return out
+	}
+	out.report.Violations = make(map[string]float64, len(status.ViolationMetrics))
+	for _, selector := range status.ViolationMetrics {
+		name, labels, err := parseSelector(selector)
+		if err != nil {
+			out.report.Error = fmt.Sprintf("violation metric %s: %v", selector, err)
+			continue
+		}
+		count := sumSamples(exposition, name, labels)
+		out.report.Violations[selector] = count
+		out.report.ViolationTotal += count
+	}
+	if out.report.ViolationTotal > 0 {
+		out.report.Status = worse(out.report.Status, AtRisk)
+	}
+	return out
+}
+
+func (c *Collector) get(ctx context.Context, target string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.BearerToken)
+	}
+	if c.AdminToken != "" {
+		req.Header.Set("X-Admin-Token", c.AdminToken)
+	}
+	client := c.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxStatusBody))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s returned %s", req.URL.Path, resp.Status)
+	}
+	return body, nil
+}
+
+// resolveEvidence makes evidence paths absolute against the service's base URL
+func resolveEvidence(base string, evidence []Evidence) []Evidence {
+	baseURL, err := url.Parse(base + "/")
+	if err != nil {
+		return evidence
+	}
+	out := make([]Evidence, len(evidence))
+	for i, e := range evidence {
+		out[i] = e
+		if ref, err := url.Parse(e.URL); err == nil && !ref.IsAbs() {
+			out[i].URL = baseURL.ResolveReference(&url.URL{Path: strings.TrimPrefix(ref.Path, "/"), RawQuery: ref.RawQuery}).String()
+		}
+	}
+	return out
+}
+
+// combine groups the collected controls by framework and derives the overall posture
+func combine(collected []collectedService, now time.Time) Report {
+	report := Report{GeneratedAt: now, Status: Compliant, Frameworks: []FrameworkReport{}, Services: []ServiceReport{}}
+	byFramework := make(map[Framework]*FrameworkReport)
+	for _, svc := range collected {
+		report.Services = append(report.Services, svc.report)
+		report.Status = worse(report.Status, svc.report.Status)
+		if svc.status == nil {
+			continue
+		}
+		for _, control := range svc.status.Controls {
+			fw := byFramework[control.Framework]
+			if fw == nil {
+				fw = &FrameworkReport{Framework: control.Framework, Controls: []ServiceControl{}}
+				byFramework[control.Framework] = fw
+			}
+			fw.Controls = append(fw.Controls, ServiceControl{Service: svc.report.Name, Control: control})
+			switch control.Status {
+			case Pass:
+				fw.Passed++
+			case Warning:
+				fw.Warnings++
+			default:
+				fw.Failed++
+			}
+		}
+	}
+	for _, fw := range byFramework {
+		controls := make([]Control, len(fw.Controls))
+		for i, sc := range fw.Controls {
+			controls[i] = sc.Control
+		}
+		fw.Status = Posture(controls)
+		report.Frameworks = append(report.Frameworks, *fw)
+	}
+	sort.Slice(report.Frameworks, func(i, j int) bool {
+		a, b := report.Frameworks[i].Framework, report.Frameworks[j].Framework
+		ra, oka := frameworkOrder[a]
+		rb, okb := frameworkOrder[b]
+		switch {
+		case oka && okb:
+			return ra < rb
+		case oka != okb:
+			return oka
+		}
+		return a < b
+	})
+	return report
+}
+
+// postureRank orders postures from best to worst
+var postureRank = map[string]int{Compliant: 0, AtRisk: 1, NonCompliant: 2}
+
+// worse returns the worse of two postures. Anything else, such as unreachable, counts
+// as at_risk.
+func worse(a, b string) string {
+	a, b = knownPosture(a), knownPosture(b)
+	if postureRank[b] > postureRank[a] {
+		return b
+	}
+	return a
+}
+
+func knownPosture(p string) string {
+	if _, ok := postureRank[p]; ok {
+		return p
+	}
+	return AtRisk
+}
+
+// Handler collects a fresh report for every request
+func (c *Collector) Handler(sources []Source) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(c.Collect(r.Context(), sources))
+	}
+}
+
+// parseSelector splits a metric selector such as
+// auth_security_events_total{severity="critical"} into its name and labels
+func parseSelector(selector string) (string, map[string]string, error) {
+	name, rest, hasLabels := strings.Cut(strings.TrimSpace(selector), "{")
+	if name == "" {
+		return "", nil, errors.New("no metric name")
+	}
+	if !hasLabels {
+		return name, nil, nil
+	}
+	labels, rest, err := parseLabels(rest)
+	if err != nil {
+		return "", nil, err
+	}
+	if strings.TrimSpace(rest) != "" {
+		return "", nil, fmt.Errorf("unexpected %q after the labels", rest)
+	}
+	return name, labels, nil
+}
+
+// parseLabels reads label="value" pairs up to the closing brace, returning what
+// follows it
+func parseLabels(s string) (map[string]string, string, error) {
+	labels := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " ,")
+		if strings.HasPrefix(s, "}") {
+			return labels, s[1:], nil
+		}
+		name, rest, ok := strings.Cut(s, "=")
+		name = strings.TrimSpace(name)
+		rest = strings.TrimSpace(rest)
+		if !ok || name == "" || !strings.HasPrefix(rest, `"`) {
+			return nil, "", errors.New("malformed labels")
+		}
+		var value strings.Builder
+		i := 1
+		for ; i < len(rest) && rest[i] != '"'; i++ {
+			if rest[i] == '\\' && i+1 < len(rest) {
+				i++
+				switch rest[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(rest[i])
+				}
+				continue
+			}
+			value.WriteByte(rest[i])
+		}
+		if i >= len(rest) {
+			return nil, "", errors.New("unterminated label value")
+		}
+		labels[name] = value.String()
+		s = rest[i+1:]
+	}
+}
+
+// sumSamples adds up the samples of a metric in Prometheus text exposition whose
+// labels include every label given
+func sumSamples(exposition []byte, name string, labels map[string]string) float64 {
+	var sum float64
+	for _, line := range strings.Split(string(exposition), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || !strings.HasPrefix(line, name) {
+			continue
+		}
+		rest := line[len(name):]
+		sample := map[string]string{}
+		switch {
+		case strings.HasPrefix(rest, "{"):
+			var err error
+			if sample, rest, err = parseLabels(rest[1:]); err != nil {
+				continue
+			}
+		case !strings.HasPrefix(rest, " "):
+			// Another metric sharing the name as a prefix
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+		value, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			continue
+		}
+		matched := true
+		for k, v := range labels {
+			if sample[k] != v {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			sum += value
+		}
+	}
+	return sum
+}
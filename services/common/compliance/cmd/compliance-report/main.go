@@ -0,0 +1,74 @@
+// Command compliance-report pulls /compliance/status and the violation counters from
+// every service and prints the combined HIPAA/SOX/FDA posture report as JSON. Services
+// are name=url pairs, from -sources or COMPLIANCE_SOURCES. COMPLIANCE_BEARER_TOKEN, an
+// auth-service token with the admin scope, and COMPLIANCE_ADMIN_TOKEN, for services
+// guarded by a shared admin token, are sent to every service. It exits 2 when the
+// posture is non_compliant, so it can gate a pipeline. With -serve it serves a fresh
+// report at /compliance/report instead.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/healthcare-gitops/common/compliance"
+	"github.com/healthcare-gitops/common/config"
+)
+
+func main() {
+	sourcesFlag := flag.String("sources", config.GetEnv("COMPLIANCE_SOURCES", ""), "comma-separated name=url pairs of the services to collect from")
+	timeout := flag.Duration("timeout", 10*time.Second, "timeout for each request to a service")
+	serve := flag.String("serve", "", "address to serve the report on instead of printing it, e.g. :8090")
+	flag.Parse()
+
+	sources, err := compliance.ParseSources(*sourcesFlag)
+	if err != nil {
+		fail("sources: %v", err)
+	}
+	collector := &compliance.Collector{
+		Client:      &http.Client{Timeout: *timeout},
+		BearerToken: config.GetEnv("COMPLIANCE_BEARER_TOKEN", ""),
+		AdminToken:  config.GetEnv("COMPLIANCE_ADMIN_TOKEN", ""),
+	}
+
+	if *serve != "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /compliance/report", collector.Handler(sources))
+		mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+		server := &http.Server{Addr: *serve, Handler: mux, ReadTimeout: 15 * time.Second, WriteTimeout: 2 * *timeout}
+		fmt.Fprintf(os.Stderr, "compliance-report: serving /compliance/report on %s\n", *serve)
+		if err := server.ListenAndServe(); err != nil {
+			fail("%v", err)
+		}
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2**timeout)
+	defer cancel()
+	report := collector.Collect(ctx, sources)
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		fail("writing report: %v", err)
+	}
+	for _, svc := range report.Services {
+		if svc.Error != "" {
+			fmt.Fprintf(os.Stderr, "compliance-report: %s: %s\n", svc.Name, svc.Error)
+		}
+	}
+	if report.Status == compliance.NonCompliant {
+		os.Exit(2)
+	}
+}
+
+func fail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "compliance-report: "+format+"\n", args...)
+	os.Exit(1)
+}
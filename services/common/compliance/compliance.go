@@ -0,0 +1,162 @@
+// Package compliance is the shape of a service's compliance posture and the aggregator
+// that combines the posture of every service into one report. Each service serves a
+// Status at /compliance/status, behind its own admin authentication, built from live
+// checks of its controls — audit chain verification, encryption, access control —
+// rather than fixed claims. Each control cites the HIPAA, SOX or FDA requirement it
+// meets and links to the endpoints holding its evidence. The compliance-report
+// command pulls every service's status and the violation counters it names from its
+// /metrics, and produces the combined posture report.
+package compliance
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/healthcare-gitops/common/audit"
+)
+
+// Framework is a regulatory framework controls are assessed against
+type Framework string
+
+// Frameworks
+const (
+	HIPAA Framework = "HIPAA"
+	SOX   Framework = "SOX"
+	FDA   Framework = "FDA"
+)
+
+// ControlStatus is the outcome of a control's check
+type ControlStatus string
+
+// Control statuses. A warning is a control that is met but weakly, such as an audit
+// trail that does not survive a restart.
+const (
+	Pass    ControlStatus = "pass"
+	Warning ControlStatus = "warning"
+	Fail    ControlStatus = "fail"
+)
+
+// Postures of a service or report, from its controls: non_compliant when any failed,
+// at_risk when any warned
+const (
+	Compliant    = "compliant"
+	AtRisk       = "at_risk"
+	NonCompliant = "non_compliant"
+)
+
+// Evidence points at where a control's evidence can be inspected. URL is a path on
+// the reporting service, or an absolute URL; the aggregator resolves paths against the
+// service's base URL.
+type Evidence struct {
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+// Control is one control and the outcome of checking it
+type Control struct {
+	// ID is stable across releases, e.g. hipaa.audit_controls
+	ID        string    `json:"id"`
+	Framework Framework `json:"framework"`
+	// Requirement cites the regulation, e.g. 45 CFR 164.312(b)
+	Requirement string        `json:"requirement"`
+	Title       string        `json:"title"`
+	Status      ControlStatus `json:"status"`
+	Detail      string        `json:"detail"`
+	Evidence    []Evidence    `json:"evidence,omitempty"`
+}
+
+// Status is a service's compliance posture
+type Status struct {
+	Service string `json:"service"`
+	// Version is the service's OpenAPI spec version
+	Version     string      `json:"version"`
+	GeneratedAt time.Time   `json:"generated_at"`
+	Status      string      `json:"status"`
+	Frameworks  []Framework `json:"frameworks"`
+	Controls    []Control   `json:"controls"`
+	// Audit is the service's audit bus delivery since it started
+	Audit audit.Stats `json:"audit"`
+	// ViolationMetrics name the counters on the service's /metrics that count
+	// compliance violations, optionally with a label selector such as
+	// auth_security_events_total{severity="critical"}
+	ViolationMetrics []string `json:"violation_metrics,omitempty"`
+}
+
+// NewStatus assembles a service's status from its checked controls, deriving its
+// frameworks and posture
+func NewStatus(service, version string, controls []Control, events *audit.Emitter, violationMetrics ...string) Status {
+	s := Status{
+		Service:          service,
+		Version:          version,
+		GeneratedAt:      time.Now().UTC(),
+		Frameworks:       []Framework{},
+		Controls:         controls,
+		Audit:            events.Stats(),
+		ViolationMetrics: violationMetrics,
+	}
+	if s.Controls == nil {
+		s.Controls = []Control{}
+	}
+	seen := make(map[Framework]bool)
+	for _, c := range s.Controls {
+		if !seen[c.Framework] {
+			seen[c.Framework] = true
+			s.Frameworks = append(s.Frameworks, c.Framework)
+		}
+	}
+	sort.Slice(s.Frameworks, func(i, j int) bool { return s.Frameworks[i] < s.Frameworks[j] })
+	s.Status = Posture(s.Controls)
+	return s
+}
+
+// Posture is the posture of a set of controls
+func Posture(controls []Control) string {
+	posture := Compliant
+	for _, c := range controls {
+		switch c.Status {
+		case Fail:
+			return NonCompliant
+		case Warning:
+			posture = AtRisk
+		}
+	}
+	return posture
+}
+
+// AuditBusControl checks that a service's audit events reach the shared audit bus. A
+// nil emitter (AUDIT_SINK=none) leaves the service's actions unrecorded; events that
+// fell back to stderr are recorded only in its logs.
+func AuditBusControl(framework Framework, requirement string, events *audit.Emitter) Control {
+	c := Control{
+		ID:          strings.ToLower(string(framework)) + ".audit_bus",
+		Framework:   framework,
+		Requirement: requirement,
+		Title:       "Audit events are delivered to the shared audit bus",
+		Status:      Pass,
+	}
+	stats := events.Stats()
+	switch {
+	case events == nil:
+		c.Status, c.Detail = Fail, "the audit bus is disabled (AUDIT_SINK=none)"
+	case stats.Fallback > 0:
+		c.Status = Warning
+		c.Detail = fmt.Sprintf("%d of %d audit events fell back to stderr because the sink was unavailable", stats.Fallback, stats.Emitted)
+	default:
+		c.Detail = fmt.Sprintf("%d of %d audit events written to the sink", stats.Written, stats.Emitted)
+	}
+	return c
+}
+
+// Handler serves the status built on every request. Mount it at /compliance/status
+// behind the service's admin authentication.
+func Handler(status func(r *http.Request) Status) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(status(r))
+	}
+}
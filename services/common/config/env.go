@@ -1,26 +1,41 @@
-// Package config provides common configuration utilities for all services
+// Package config reads service settings. Every setting is named by its environment
+// variable; one that is not set in the environment falls back to the config file
+// loaded with Load, and then to the caller's default. Secrets belong in the
+// environment or the secrets package rather than the config file, which is usually
+// kept with the deployment manifests.
 package config
 
 import (
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
-// GetEnv retrieves an environment variable with a default fallback value.
+// Lookup returns a setting from the environment or, when it is unset or empty there,
+// from the config file
+func Lookup(key string) (string, bool) {
+	if value := os.Getenv(key); value != "" {
+		return value, true
+	}
+	return fileValue(key)
+}
+
+// GetEnv retrieves a setting with a default fallback value.
 // This is the canonical implementation used across all services.
 func GetEnv(key, defaultValue string) string {
-	value := os.Getenv(key)
-	if value == "" {
+	value, ok := Lookup(key)
+	if !ok {
 		return defaultValue
 	}
 	return value
 }
 
-// GetEnvInt retrieves an environment variable as an integer with a default fallback.
-// Returns defaultValue if the environment variable is not set or cannot be parsed.
+// GetEnvInt retrieves a setting as an integer with a default fallback.
+// Returns defaultValue if the setting is not set or cannot be parsed.
 func GetEnvInt(key string, defaultValue int) int {
-	valueStr := os.Getenv(key)
-	if valueStr == "" {
+	valueStr, ok := Lookup(key)
+	if !ok {
 		return defaultValue
 	}
 
@@ -31,11 +46,11 @@ func GetEnvInt(key string, defaultValue int) int {
 	return value
 }
 
-// GetEnvBool retrieves an environment variable as a boolean with a default fallback.
-// Returns defaultValue if the environment variable is not set or cannot be parsed.
+// GetEnvBool retrieves a setting as a boolean with a default fallback.
+// Returns defaultValue if the setting is not set or cannot be parsed.
 func GetEnvBool(key string, defaultValue bool) bool {
-	valueStr := os.Getenv(key)
-	if valueStr == "" {
+	valueStr, ok := Lookup(key)
+	if !ok {
 		return defaultValue
 	}
 
@@ -45,3 +60,50 @@ func GetEnvBool(key string, defaultValue bool) bool {
 	}
 	return value
 }
+
+// GetEnvFloat retrieves a setting as a float with a default fallback.
+// Returns defaultValue if the setting is not set or cannot be parsed.
+func GetEnvFloat(key string, defaultValue float64) float64 {
+	valueStr, ok := Lookup(key)
+	if !ok {
+		return defaultValue
+	}
+
+	value, err := strconv.ParseFloat(valueStr, 64)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// GetEnvDuration retrieves a setting as a duration such as 90s or 15m with a default
+// fallback. Returns defaultValue if the setting is not set or cannot be parsed.
+func GetEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	valueStr, ok := Lookup(key)
+	if !ok {
+		return defaultValue
+	}
+
+	value, err := time.ParseDuration(valueStr)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// GetEnvList retrieves a comma-separated setting as a list, without empty entries.
+// Returns defaultValue if the setting is not set.
+func GetEnvList(key string, defaultValue []string) []string {
+	valueStr, ok := Lookup(key)
+	if !ok {
+		return defaultValue
+	}
+
+	var values []string
+	for _, value := range strings.Split(valueStr, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrUnknownFormat is returned for a config file that is neither YAML nor JSON
+var ErrUnknownFormat = errors.New("config file must be .yaml, .yml or .json")
+
+var (
+	fileMu       sync.RWMutex
+	fileSettings map[string]string
+	filePath     string
+)
+
+// The file is first read as the package is initialized, before the package-level
+// settings of the services importing it, such as their feature flags; an error is
+// left for Load to report
+func init() {
+	_ = Load()
+}
+
+// Load reads the config file named by CONFIG_FILE, if it is set. Services call it
+// first thing in main to report a file that cannot be read.
+func Load() error {
+	return LoadFile(os.Getenv("CONFIG_FILE"))
+}
+
+// LoadFile reads a YAML or JSON config file into the settings GetEnv and friends fall
+// back to, replacing any file read before; an empty path clears them. Nested keys are
+// joined with underscores and upper-cased, so
+//
+//	risk:
+//	  deny_score: 80
+//	  blocked_countries: [KP, IR]
+//
+// sets RISK_DENY_SCORE to 80 and RISK_BLOCKED_COUNTRIES to KP,IR.
+func LoadFile(path string) error {
+	settings := make(map[string]string)
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("read config file: %w", err)
+		}
+		var doc map[string]interface{}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".yaml", ".yml":
+			err = yaml.Unmarshal(data, &doc)
+		case ".json":
+			err = json.Unmarshal(data, &doc)
+		default:
+			return fmt.Errorf("%s: %w", path, ErrUnknownFormat)
+		}
+		if err != nil {
+			return fmt.Errorf("parse config file %s: %w", path, err)
+		}
+		if err := flatten(settings, "", doc); err != nil {
+			return fmt.Errorf("config file %s: %w", path, err)
+		}
+	}
+
+	fileMu.Lock()
+	defer fileMu.Unlock()
+	fileSettings, filePath = settings, path
+	return nil
+}
+
+// File returns the path of the loaded config file, or "" when there is none
+func File() string {
+	fileMu.RLock()
+	defer fileMu.RUnlock()
+	return filePath
+}
+
+// fileValue returns a setting from the config file
+func fileValue(key string) (string, bool) {
+	fileMu.RLock()
+	defer fileMu.RUnlock()
+	value, ok := fileSettings[key]
+	return value, ok && value != ""
+}
+
+// flatten copies a parsed document into settings under its upper-cased key paths
+func flatten(settings map[string]string, prefix string, doc map[string]interface{}) error {
+	for name, value := range doc {
+		key := strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+		if prefix != "" {
+			key = prefix + "_" + key
+		}
+		switch v := value.(type) {
+		case nil:
+		case map[string]interface{}:
+			if err := flatten(settings, key, v); err != nil {
+				return err
+			}
+		case []interface{}:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				s, ok := scalar(item)
+				if !ok {
+					return fmt.Errorf("%s: lists may only hold strings, numbers and booleans", key)
+				}
+				items = append(items, s)
+			}
+			settings[key] = strings.Join(items, ",")
+		default:
+			s, ok := scalar(v)
+			if !ok {
+				return fmt.Errorf("%s: unsupported value %v", key, v)
+			}
+			settings[key] = s
+		}
+	}
+	return nil
+}
+
+// scalar formats a string, number or boolean the way it would be written in the
+// environment
+func scalar(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case bool:
+		return strconv.FormatBool(v), true
+	case int:
+		return strconv.Itoa(v), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case uint64:
+		return strconv.FormatUint(v, 10), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case time.Time:
+		// Unquoted YAML dates, such as a sunset date
+		if v.Equal(v.Truncate(24 * time.Hour)) {
+			return v.Format(time.DateOnly), true
+		}
+		return v.Format(time.RFC3339), true
+	}
+	return "", false
+}
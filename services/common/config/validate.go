@@ -0,0 +1,92 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Validator checks settings as a service starts and reports every problem at once,
+// so a misconfigured deployment is fixed in one pass rather than one restart per
+// mistake
+type Validator struct {
+	problems []string
+}
+
+func (v *Validator) problem(format string, args ...interface{}) {
+	v.problems = append(v.problems, fmt.Sprintf(format, args...))
+}
+
+// Required reports each key that is set neither in the environment nor the config file
+func (v *Validator) Required(keys ...string) {
+	for _, key := range keys {
+		if _, ok := Lookup(key); !ok {
+			v.problem("%s is required", key)
+		}
+	}
+}
+
+// IntRange reports a key that is set but is not an integer from min to max
+func (v *Validator) IntRange(key string, min, max int) {
+	if value, ok := Lookup(key); ok {
+		if n, err := strconv.Atoi(value); err != nil || n < min || n > max {
+			v.problem("%s must be an integer from %d to %d, got %q", key, min, max, value)
+		}
+	}
+}
+
+// FloatRange reports a key that is set but is not a number from min to max
+func (v *Validator) FloatRange(key string, min, max float64) {
+	if value, ok := Lookup(key); ok {
+		if f, err := strconv.ParseFloat(value, 64); err != nil || f < min || f > max {
+			v.problem("%s must be a number from %g to %g, got %q", key, min, max, value)
+		}
+	}
+}
+
+// DurationRange reports a key that is set but is not a duration from min to max
+func (v *Validator) DurationRange(key string, min, max time.Duration) {
+	if value, ok := Lookup(key); ok {
+		if d, err := time.ParseDuration(value); err != nil || d < min || d > max {
+			v.problem("%s must be a duration from %s to %s, got %q", key, min, max, value)
+		}
+	}
+}
+
+// Bool reports a key that is set but is not a boolean
+func (v *Validator) Bool(key string) {
+	if value, ok := Lookup(key); ok {
+		if _, err := strconv.ParseBool(value); err != nil {
+			v.problem("%s must be true or false, got %q", key, value)
+		}
+	}
+}
+
+// OneOf reports a key that is set to none of allowed
+func (v *Validator) OneOf(key string, allowed ...string) {
+	if value, ok := Lookup(key); ok {
+		for _, a := range allowed {
+			if value == a {
+				return
+			}
+		}
+		v.problem("%s must be one of %s, got %q", key, strings.Join(allowed, ", "), value)
+	}
+}
+
+// Check reports err, which a service's own validation returned, unless it is nil
+func (v *Validator) Check(err error) {
+	if err != nil {
+		v.problems = append(v.problems, err.Error())
+	}
+}
+
+// Err returns every problem found, or nil when there were none
+func (v *Validator) Err() error {
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return errors.New("invalid configuration: " + strings.Join(v.problems, "; "))
+}
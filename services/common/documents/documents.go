@@ -0,0 +1,333 @@
+// Package documents stores file attachments, such as maintenance photos, calibration
+// certificates and dispute evidence, against the records they belong to. Uploads are
+// checked for size and content type, passed through an optional malware scanner, and
+// indexed by owner, type, tag and uploader for search.
+package documents
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Upload errors
+var (
+	ErrNotFound        = errors.New("document not found")
+	ErrEmpty           = errors.New("document is empty")
+	ErrTooLarge        = errors.New("document exceeds the maximum size")
+	ErrUnsupportedType = errors.New("document type is not allowed")
+	ErrInfected        = errors.New("document failed malware scanning")
+	ErrScanFailed      = errors.New("document could not be scanned")
+)
+
+// Scan statuses recorded on a document
+const (
+	ScanClean   = "clean"
+	ScanSkipped = "skipped"
+)
+
+// DefaultMaxSize is the largest upload accepted by DefaultPolicy
+const DefaultMaxSize = 20 << 20
+
+// Policy limits what may be uploaded
+type Policy struct {
+	MaxSize int64
+	// AllowedTypes are media types as sniffed from the content, e.g. image/jpeg
+	AllowedTypes []string
+}
+
+// DefaultPolicy accepts photos, PDFs and plain text up to DefaultMaxSize
+var DefaultPolicy = Policy{
+	MaxSize:      DefaultMaxSize,
+	AllowedTypes: []string{"image/jpeg", "image/png", "image/gif", "image/webp", "application/pdf", "text/plain"},
+}
+
+func (p Policy) allows(mediaType string) bool {
+	for _, t := range p.AllowedTypes {
+		if t == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// ScanResult is the outcome of scanning a stored document
+type ScanResult struct {
+	Status    string    `json:"status"`
+	Scanner   string    `json:"scanner,omitempty"`
+	ScannedAt time.Time `json:"scanned_at,omitempty"`
+}
+
+// Document is the metadata of a stored attachment
+type Document struct {
+	ID string `json:"id"`
+	// OwnerType and OwnerID name the record the document is attached to, e.g.
+	// work_order MAINT-000012
+	OwnerType string `json:"owner_type"`
+	OwnerID   string `json:"owner_id"`
+	Filename  string `json:"filename"`
+	// ContentType is sniffed from the content; the client's declaration is not trusted
+	ContentType string     `json:"content_type"`
+	Size        int64      `json:"size"`
+	SHA256      string     `json:"sha256"`
+	Description string     `json:"description,omitempty"`
+	Tags        []string   `json:"tags,omitempty"`
+	UploadedBy  string     `json:"uploaded_by,omitempty"`
+	UploadedAt  time.Time  `json:"uploaded_at"`
+	Scan        ScanResult `json:"scan"`
+}
+
+// Upload describes a document being attached
+type Upload struct {
+	OwnerType   string
+	OwnerID     string
+	Filename    string
+	Description string
+	Tags        []string
+	UploadedBy  string
+}
+
+// Query filters a search. Empty fields match everything.
+type Query struct {
+	OwnerType string
+	OwnerID   string
+	// ContentType matches a media type exactly, or a family when it ends in a slash,
+	// e.g. image/
+	ContentType string
+	Tag         string
+	UploadedBy  string
+	// Text matches the filename or description, case-insensitively
+	Text  string
+	Since time.Time
+	Until time.Time
+	Limit int
+}
+
+func (q Query) matches(d Document) bool {
+	switch {
+	case q.OwnerType != "" && d.OwnerType != q.OwnerType,
+		q.OwnerID != "" && d.OwnerID != q.OwnerID,
+		q.UploadedBy != "" && d.UploadedBy != q.UploadedBy,
+		!q.Since.IsZero() && d.UploadedAt.Before(q.Since),
+		!q.Until.IsZero() && !d.UploadedAt.Before(q.Until):
+		return false
+	}
+	if q.ContentType != "" {
+		if strings.HasSuffix(q.ContentType, "/") {
+			if !strings.HasPrefix(d.ContentType, q.ContentType) {
+				return false
+			}
+		} else if d.ContentType != q.ContentType {
+			return false
+		}
+	}
+	if q.Tag != "" && !containsFold(d.Tags, q.Tag) {
+		return false
+	}
+	if q.Text != "" {
+		text := strings.ToLower(q.Text)
+		if !strings.Contains(strings.ToLower(d.Filename), text) && !strings.Contains(strings.ToLower(d.Description), text) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Library stores documents and their metadata in a Store and keeps a search index in
+// memory, rebuilt from the store's metadata when the library is opened
+type Library struct {
+	store   Store
+	policy  Policy
+	scanner Scanner
+	now     func() time.Time
+
+	docs map[string]Document
+	mu   sync.RWMutex
+}
+
+// Open loads a library from store. scanner may be nil, in which case documents are
+// stored with scan status skipped.
+func Open(ctx context.Context, store Store, policy Policy, scanner Scanner) (*Library, error) {
+	lib := &Library{
+		store:   store,
+		policy:  policy,
+		scanner: scanner,
+		now:     time.Now,
+		docs:    make(map[string]Document),
+	}
+	keys, err := store.List(ctx, "meta/")
+	if err != nil {
+		return nil, fmt.Errorf("list document metadata: %w", err)
+	}
+	for _, key := range keys {
+		body, err := store.Get(ctx, key)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", key, err)
+		}
+		var doc Document
+		err = json.NewDecoder(body).Decode(&doc)
+		body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decode %s: %w", key, err)
+		}
+		lib.docs[doc.ID] = doc
+	}
+	return lib, nil
+}
+
+// Policy returns the upload limits in force
+func (l *Library) Policy() Policy {
+	return l.policy
+}
+
+func blobKey(id string) string { return "blobs/" + id }
+func metaKey(id string) string { return "meta/" + id + ".json" }
+
+// Add validates, scans and stores a document
+func (l *Library) Add(ctx context.Context, upload Upload, body io.Reader) (Document, error) {
+	content, err := io.ReadAll(io.LimitReader(body, l.policy.MaxSize+1))
+	if err != nil {
+		return Document{}, err
+	}
+	if len(content) == 0 {
+		return Document{}, ErrEmpty
+	}
+	if int64(len(content)) > l.policy.MaxSize {
+		return Document{}, fmt.Errorf("%w of %d bytes", ErrTooLarge, l.policy.MaxSize)
+	}
+	mediaType, _, _ := mime.ParseMediaType(http.DetectContentType(content))
+	if !l.policy.allows(mediaType) {
+		return Document{}, fmt.Errorf("%w: %s", ErrUnsupportedType, mediaType)
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return Document{}, err
+	}
+	sum := sha256.Sum256(content)
+	doc := Document{
+		ID:          "DOC-" + hex.EncodeToString(id),
+		OwnerType:   upload.OwnerType,
+		OwnerID:     upload.OwnerID,
+		Filename:    path.Base(strings.ReplaceAll(upload.Filename, `\`, "/")),
+		ContentType: mediaType,
+		Size:        int64(len(content)),
+		SHA256:      hex.EncodeToString(sum[:]),
+		Description: upload.Description,
+		Tags:        upload.Tags,
+		UploadedBy:  upload.UploadedBy,
+		UploadedAt:  l.now().UTC(),
+		Scan:        ScanResult{Status: ScanSkipped},
+	}
+	if doc.Filename == "." || doc.Filename == "/" {
+		doc.Filename = doc.ID
+	}
+
+	if l.scanner != nil {
+		verdict, err := l.scanner.Scan(ctx, doc.Filename, bytes.NewReader(content))
+		if err != nil {
+			return Document{}, fmt.Errorf("%w: %v", ErrScanFailed, err)
+		}
+		if !verdict.Clean {
+			return Document{}, fmt.Errorf("%w: %s", ErrInfected, verdict.Threat)
+		}
+		doc.Scan = ScanResult{Status: ScanClean, Scanner: l.scanner.Name(), ScannedAt: l.now().UTC()}
+	}
+
+	if err := l.store.Put(ctx, blobKey(doc.ID), bytes.NewReader(content)); err != nil {
+		return Document{}, err
+	}
+	meta, _ := json.Marshal(doc)
+	if err := l.store.Put(ctx, metaKey(doc.ID), bytes.NewReader(meta)); err != nil {
+		l.store.Delete(ctx, blobKey(doc.ID))
+		return Document{}, err
+	}
+
+	l.mu.Lock()
+	l.docs[doc.ID] = doc
+	l.mu.Unlock()
+	return doc, nil
+}
+
+// Get returns a document's metadata
+func (l *Library) Get(id string) (Document, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	doc, ok := l.docs[id]
+	if !ok {
+		return Document{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return doc, nil
+}
+
+// Content opens a document's content
+func (l *Library) Content(ctx context.Context, id string) (Document, io.ReadCloser, error) {
+	doc, err := l.Get(id)
+	if err != nil {
+		return Document{}, nil, err
+	}
+	body, err := l.store.Get(ctx, blobKey(id))
+	if err != nil {
+		return Document{}, nil, err
+	}
+	return doc, body, nil
+}
+
+// Delete removes a document and its content
+func (l *Library) Delete(ctx context.Context, id string) error {
+	if _, err := l.Get(id); err != nil {
+		return err
+	}
+	if err := l.store.Delete(ctx, metaKey(id)); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	delete(l.docs, id)
+	l.mu.Unlock()
+	return l.store.Delete(ctx, blobKey(id))
+}
+
+// Search returns matching documents, newest first
+func (l *Library) Search(q Query) []Document {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	out := make([]Document, 0)
+	for _, doc := range l.docs {
+		if q.matches(doc) {
+			out = append(out, doc)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].UploadedAt.Equal(out[j].UploadedAt) {
+			return out[i].UploadedAt.After(out[j].UploadedAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	if q.Limit > 0 && len(out) > q.Limit {
+		out = out[:q.Limit]
+	}
+	return out
+}
@@ -0,0 +1,65 @@
+package documents
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Verdict is a scanner's judgement of one file
+type Verdict struct {
+	Clean bool `json:"clean"`
+	// Threat names what was found in an unclean file
+	Threat string `json:"threat,omitempty"`
+}
+
+// Scanner checks uploads for malware before they are stored. An error means the file
+// could not be scanned, and the upload is refused.
+type Scanner interface {
+	Name() string
+	Scan(ctx context.Context, filename string, content io.Reader) (Verdict, error)
+}
+
+// HTTPScanner sends each upload to a scanning service, such as a ClamAV REST wrapper.
+// The file is POSTed as the request body with its name in X-Filename, and the service
+// answers 200 with a Verdict as JSON.
+type HTTPScanner struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewHTTPScanner creates a scanner for the service at url
+func NewHTTPScanner(url string, timeout time.Duration) *HTTPScanner {
+	return &HTTPScanner{URL: url, Client: &http.Client{Timeout: timeout}}
+}
+
+// Name identifies the scanner in scan results
+func (s *HTTPScanner) Name() string {
+	return "http"
+}
+
+// Scan submits content to the scanning service
+func (s *HTTPScanner) Scan(ctx context.Context, filename string, content io.Reader) (Verdict, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, content)
+	if err != nil {
+		return Verdict{}, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("X-Filename", filename)
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return Verdict{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Verdict{}, fmt.Errorf("scanner returned %s", resp.Status)
+	}
+	var verdict Verdict
+	if err := json.NewDecoder(resp.Body).Decode(&verdict); err != nil {
+		return Verdict{}, fmt.Errorf("decode scanner response: %w", err)
+	}
+	return verdict, nil
+}
@@ -0,0 +1,195 @@
+package events
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// AsyncAPISpecVersion is the AsyncAPI specification version the document follows
+const AsyncAPISpecVersion = "2.6.0"
+
+// AsyncAPIDocument is an AsyncAPI description of every topic and event in a registry.
+// Events are pushed to subscribers as signed HTTP POSTs, so channels only declare
+// subscribe operations.
+type AsyncAPIDocument struct {
+	AsyncAPI           string                      `json:"asyncapi"`
+	ID                 string                      `json:"id"`
+	Info               AsyncAPIInfo                `json:"info"`
+	DefaultContentType string                      `json:"defaultContentType"`
+	Channels           map[string]*AsyncAPIChannel `json:"channels"`
+	Components         AsyncAPIComponents          `json:"components"`
+}
+
+// AsyncAPIInfo is the document's title block
+type AsyncAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// AsyncAPIChannel is one topic
+type AsyncAPIChannel struct {
+	Description string             `json:"description,omitempty"`
+	Subscribe   *AsyncAPIOperation `json:"subscribe"`
+}
+
+// AsyncAPIOperation lists the messages a subscriber to a channel may receive
+type AsyncAPIOperation struct {
+	OperationID string                 `json:"operationId"`
+	Summary     string                 `json:"summary,omitempty"`
+	Bindings    map[string]interface{} `json:"bindings,omitempty"`
+	Message     AsyncAPIMessageRefs    `json:"message"`
+}
+
+// AsyncAPIMessageRefs references the messages carried by an operation
+type AsyncAPIMessageRefs struct {
+	OneOf []AsyncAPIRef `json:"oneOf"`
+}
+
+// AsyncAPIRef is a JSON reference into the document's components
+type AsyncAPIRef struct {
+	Ref string `json:"$ref"`
+}
+
+// AsyncAPIComponents holds reusable message definitions
+type AsyncAPIComponents struct {
+	Messages map[string]*AsyncAPIMessage `json:"messages"`
+}
+
+// AsyncAPIMessage is one version of one event type
+type AsyncAPIMessage struct {
+	Name          string  `json:"name"`
+	Title         string  `json:"title,omitempty"`
+	Summary       string  `json:"summary,omitempty"`
+	ContentType   string  `json:"contentType"`
+	SchemaVersion int     `json:"x-schema-version"`
+	Headers       *Schema `json:"headers"`
+	Payload       *Schema `json:"payload"`
+}
+
+// AsyncAPI builds the AsyncAPI document for every registered schema version. It is
+// derived from the same schemas used for publish-time validation, so the published
+// contract cannot drift from what producers actually enforce.
+func (r *Registry) AsyncAPI(info AsyncAPIInfo) *AsyncAPIDocument {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	doc := &AsyncAPIDocument{
+		AsyncAPI:           AsyncAPISpecVersion,
+		ID:                 "urn:healthcare-gitops:events",
+		Info:               info,
+		DefaultContentType: "application/json",
+		Channels:           make(map[string]*AsyncAPIChannel),
+		Components:         AsyncAPIComponents{Messages: make(map[string]*AsyncAPIMessage)},
+	}
+
+	eventTypes := make([]string, 0, len(r.schemas))
+	for eventType := range r.schemas {
+		eventTypes = append(eventTypes, eventType)
+	}
+	sort.Strings(eventTypes)
+
+	topicEvents := make(map[string][]string)
+	for _, eventType := range eventTypes {
+		versions := r.schemas[eventType]
+		numbers := make([]int, 0, len(versions))
+		for v := range versions {
+			numbers = append(numbers, v)
+		}
+		sort.Ints(numbers)
+
+		topic := versions[latestVersion(versions)].Topic
+		channel := doc.Channels[topic]
+		if channel == nil {
+			channel = &AsyncAPIChannel{Subscribe: &AsyncAPIOperation{
+				OperationID: "receive" + ExportedName(topic),
+				Bindings: map[string]interface{}{
+					"http": map[string]string{"type": "request", "method": "POST", "bindingVersion": "0.2.0"},
+				},
+			}}
+			doc.Channels[topic] = channel
+		}
+		topicEvents[topic] = append(topicEvents[topic], eventType)
+
+		for _, v := range numbers {
+			schema := versions[v]
+			key := fmt.Sprintf("%s.v%d", eventType, v)
+			doc.Components.Messages[key] = &AsyncAPIMessage{
+				Name:          eventType,
+				Title:         schema.Title,
+				Summary:       schema.Description,
+				ContentType:   "application/json",
+				SchemaVersion: v,
+				Headers:       deliveryHeaders(),
+				Payload:       messagePayload(schema),
+			}
+			channel.Subscribe.Message.OneOf = append(channel.Subscribe.Message.OneOf,
+				AsyncAPIRef{Ref: "#/components/messages/" + key})
+		}
+	}
+
+	for topic, types := range topicEvents {
+		doc.Channels[topic].Description = "Events: " + strings.Join(types, ", ")
+		doc.Channels[topic].Subscribe.Summary = "Receive " + topic + " events at a registered webhook URL"
+	}
+	return doc
+}
+
+// messagePayload wraps a schema in the delivery envelope when the event uses one
+func messagePayload(schema *Schema) *Schema {
+	data := *schema
+	data.SchemaURI = ""
+	if !schema.Enveloped() {
+		return &data
+	}
+
+	return &Schema{
+		Type:     SchemaTypes{"object"},
+		Required: []string{"id", "type", "schema_version", "occurred_at", "data"},
+		Properties: map[string]*Schema{
+			"id":             {Type: SchemaTypes{"string"}},
+			"type":           {Type: SchemaTypes{"string"}, Enum: []interface{}{schema.EventType}},
+			"schema_version": {Type: SchemaTypes{"integer"}, Enum: []interface{}{schema.Version}},
+			"occurred_at":    {Type: SchemaTypes{"string"}, Format: "date-time"},
+			"data":           &data,
+		},
+	}
+}
+
+// deliveryHeaders describes the headers sent with every webhook delivery
+func deliveryHeaders() *Schema {
+	return &Schema{
+		Type:     SchemaTypes{"object"},
+		Required: []string{HeaderEvent, HeaderID, HeaderTimestamp, HeaderSignature},
+		Properties: map[string]*Schema{
+			HeaderEvent:     {Type: SchemaTypes{"string"}, Description: "Event type"},
+			HeaderID:        {Type: SchemaTypes{"string"}, Description: "Event ID, stable across retries"},
+			HeaderTimestamp: {Type: SchemaTypes{"string"}, Description: "Unix seconds when the delivery was signed"},
+			HeaderSignature: {Type: SchemaTypes{"string"}, Description: "sha256=<hex HMAC-SHA256 of \"<timestamp>.<body>\">"},
+		},
+	}
+}
+
+// ExportedName turns "device.status_changed" or "vendor-notifications" into an
+// exported Go-style identifier ("DeviceStatusChanged", "VendorNotifications")
+func ExportedName(name string) string {
+	parts := strings.FieldsFunc(name, func(r rune) bool {
+		return r == '.' || r == '_' || r == '-'
+	})
+	var b strings.Builder
+	for _, part := range parts {
+		if initialism := strings.ToUpper(part); commonInitialisms[initialism] {
+			b.WriteString(initialism)
+			continue
+		}
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+// commonInitialisms are kept upper case in generated identifiers
+var commonInitialisms = map[string]bool{
+	"ID": true, "URL": true, "SLA": true, "API": true, "HTTP": true, "MRN": true,
+	"IP": true, "PHI": true, "FPE": true,
+}
@@ -0,0 +1,249 @@
+package events
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Headers sent with every webhook delivery
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderID        = "X-Webhook-ID"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// maxDeliveryBytes bounds the request bodies a consumer will read
+const maxDeliveryBytes = 1 << 20
+
+var (
+	// ErrInvalidSignature is returned when a delivery's signature or timestamp fails verification
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+
+	// ErrNoHandler is returned when no handler is registered for an event type
+	ErrNoHandler = errors.New("no handler registered for event")
+)
+
+// Envelope wraps enveloped event payloads on delivery
+type Envelope struct {
+	ID            string          `json:"id"`
+	Type          string          `json:"type"`
+	SchemaVersion int             `json:"schema_version"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+	Data          json.RawMessage `json:"data"`
+}
+
+// Metadata describes a delivered event apart from its payload. OccurredAt is zero for
+// bare-payload events, which carry their own timestamp fields.
+type Metadata struct {
+	ID            string
+	Type          string
+	Topic         string
+	SchemaVersion int
+	OccurredAt    time.Time
+}
+
+// payloadHandler decodes and handles one schema version of an event
+type payloadHandler func(ctx context.Context, meta Metadata, data json.RawMessage) error
+
+// Consumer receives signed event deliveries, validates them against the schema
+// registry and dispatches them to typed handlers. Handlers are registered with the
+// generated On<Event>V<n> methods.
+type Consumer struct {
+	registry  *Registry
+	secret    string
+	tolerance time.Duration
+	keys      KeyProvider
+	handlers  map[string]map[int]payloadHandler
+	mu        sync.RWMutex
+}
+
+// NewConsumer creates a consumer that verifies deliveries with the subscription
+// secret. An empty secret disables signature checks, which is only suitable for tests.
+func NewConsumer(secret string) *Consumer {
+	return &Consumer{
+		registry:  Default(),
+		secret:    secret,
+		tolerance: 5 * time.Minute,
+		handlers:  make(map[string]map[int]payloadHandler),
+	}
+}
+
+// WithTolerance sets how far a delivery's signed timestamp may be from now
+func (c *Consumer) WithTolerance(tolerance time.Duration) *Consumer {
+	c.tolerance = tolerance
+	return c
+}
+
+// WithDecryption lets the consumer accept encrypted payloads, opening them with keys
+// from the provider. Plaintext payloads are still accepted, so producers can turn
+// encryption on after their consumers.
+func (c *Consumer) WithDecryption(keys KeyProvider) *Consumer {
+	c.keys = keys
+	return c
+}
+
+// handle registers the handler for one schema version of an event type
+func (c *Consumer) handle(eventType string, version int, fn payloadHandler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.handlers[eventType] == nil {
+		c.handlers[eventType] = make(map[int]payloadHandler)
+	}
+	c.handlers[eventType][version] = fn
+}
+
+// handlerFor picks the handler for a delivered version: an exact match, else the
+// newest handler for an older version. Schema versions only add optional fields, so
+// older handlers can still decode newer payloads.
+func (c *Consumer) handlerFor(eventType string, version int) (payloadHandler, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	handlers := c.handlers[eventType]
+	if fn, ok := handlers[version]; ok {
+		return fn, true
+	}
+	versions := make([]int, 0, len(handlers))
+	for v := range handlers {
+		if v < version {
+			versions = append(versions, v)
+		}
+	}
+	if len(versions) == 0 {
+		return nil, false
+	}
+	sort.Ints(versions)
+	return handlers[versions[len(versions)-1]], true
+}
+
+// Handle validates a delivery body and dispatches it. eventType and eventID come from
+// the delivery headers; enveloped events carry their own and must agree. Encrypted
+// payloads are decrypted first.
+func (c *Consumer) Handle(ctx context.Context, eventType, eventID string, body []byte) error {
+	latest, err := c.registry.Latest(eventType)
+	if err != nil {
+		return err
+	}
+
+	if payload, ok := encryptedPayload(body); ok {
+		if c.keys == nil {
+			return fmt.Errorf("%w: %s", ErrEncrypted, eventType)
+		}
+		if payload.Topic != latest.Topic {
+			return fmt.Errorf("%w: %s is published on %s, not %s", ErrUndecryptable, eventType, latest.Topic, payload.Topic)
+		}
+		if body, err = payload.decrypt(ctx, c.keys, eventType, eventID); err != nil {
+			return err
+		}
+	}
+
+	meta := Metadata{ID: eventID, Type: eventType, Topic: latest.Topic, SchemaVersion: latest.Version}
+	data := json.RawMessage(body)
+	if latest.Enveloped() {
+		var env Envelope
+		if err := json.Unmarshal(body, &env); err != nil {
+			return fmt.Errorf("invalid event envelope: %w", err)
+		}
+		if env.Type != eventType {
+			return fmt.Errorf("envelope type %q does not match %s header %q", env.Type, HeaderEvent, eventType)
+		}
+		meta.ID, meta.SchemaVersion, meta.OccurredAt = env.ID, env.SchemaVersion, env.OccurredAt
+		data = env.Data
+	}
+
+	// Payloads from a newer producer are only decoded: they stay compatible with the
+	// newest schema known here but may carry fields it does not list
+	if meta.SchemaVersion <= latest.Version {
+		schema, err := c.registry.Lookup(eventType, meta.SchemaVersion)
+		if err != nil {
+			return err
+		}
+		var value interface{}
+		if err := json.Unmarshal(data, &value); err != nil {
+			return fmt.Errorf("invalid event payload: %w", err)
+		}
+		if violations := schema.Validate(value); len(violations) > 0 {
+			return &ValidationError{EventType: eventType, Version: schema.Version, Violations: violations}
+		}
+	}
+
+	fn, ok := c.handlerFor(eventType, meta.SchemaVersion)
+	if !ok {
+		return fmt.Errorf("%w: %s v%d", ErrNoHandler, eventType, meta.SchemaVersion)
+	}
+	return fn(ctx, meta, data)
+}
+
+// ServeHTTP makes the consumer a webhook endpoint. Deliveries that are handled, or
+// that carry events this consumer does not handle, are acknowledged with 204 so the
+// producer does not retry them. Invalid and undecryptable payloads return 422. Handler
+// and key service errors return 500, which triggers a retry.
+func (c *Consumer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxDeliveryBytes+1))
+	if err != nil || len(body) > maxDeliveryBytes {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if c.secret != "" {
+		err := VerifySignature(c.secret, r.Header.Get(HeaderTimestamp), r.Header.Get(HeaderSignature), body, c.tolerance, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+
+	err = c.Handle(r.Context(), r.Header.Get(HeaderEvent), r.Header.Get(HeaderID), body)
+	var validationErr *ValidationError
+	switch {
+	case err == nil, errors.Is(err, ErrNoHandler), errors.Is(err, ErrUnknownEvent):
+		w.WriteHeader(http.StatusNoContent)
+	case errors.As(err, &validationErr), errors.Is(err, ErrUndecryptable):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// VerifySignature checks a delivery's "sha256=<hex>" HMAC over "<timestamp>.<body>"
+// and rejects timestamps further than tolerance from now
+func VerifySignature(secret, timestamp, signature string, body []byte, tolerance time.Duration, now time.Time) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: missing or invalid timestamp", ErrInvalidSignature)
+	}
+	if skew := now.Sub(time.Unix(ts, 0)); skew > tolerance || skew < -tolerance {
+		return fmt.Errorf("%w: timestamp outside tolerance", ErrInvalidSignature)
+	}
+
+	provided, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	if !hmac.Equal(provided, mac.Sum(nil)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,388 @@
+// Code generated by eventgen from schemas/*.json. DO NOT EDIT.
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Event types
+const (
+	EventAlertRaised         = "alert.raised"
+	EventDeviceError         = "device.error"
+	EventDeviceRegistered    = "device.registered"
+	EventDeviceStatusChanged = "device.status_changed"
+	EventPaymentCaptured     = "payment.captured"
+	EventPaymentFailed       = "payment.failed"
+	EventPaymentSucceeded    = "payment.succeeded"
+	EventPHIDecrypted        = "phi.decrypted"
+	EventRefundIssued        = "refund.issued"
+	EventTokenIssued         = "token.issued"
+)
+
+// Topics
+const (
+	TopicAlerts              = "alerts"
+	TopicAuth                = "auth"
+	TopicDevices             = "devices"
+	TopicPayments            = "payments"
+	TopicPHIAccess           = "phi-access"
+	TopicVendorNotifications = "vendor-notifications"
+)
+
+// AlertRaisedV1 is the payload of alert.raised v1 events.
+//
+// A device alert was raised and is awaiting acknowledgment.
+type AlertRaisedV1 struct {
+	AckDeadline    time.Time           `json:"ack_deadline"`
+	AcknowledgedAt *time.Time          `json:"acknowledged_at,omitempty"`
+	AcknowledgedBy string              `json:"acknowledged_by,omitempty"`
+	AlertLevel     string              `json:"alert_level"`
+	BreachedAt     *time.Time          `json:"breached_at,omitempty"`
+	Condition      string              `json:"condition"`
+	DeviceID       string              `json:"device_id"`
+	DeviceType     string              `json:"device_type"`
+	ID             string              `json:"id"`
+	Location       string              `json:"location,omitempty"`
+	Message        string              `json:"message"`
+	Notes          []AlertRaisedV1Note `json:"notes,omitempty"`
+	Priority       string              `json:"priority"`
+	RaisedAt       time.Time           `json:"raised_at"`
+	ResolvedAt     *time.Time          `json:"resolved_at,omitempty"`
+	SLABreached    bool                `json:"sla_breached,omitempty"`
+}
+
+// Allowed values for enumerated AlertRaisedV1 fields
+const (
+	AlertRaisedV1AlertLevelNone            = "none"
+	AlertRaisedV1AlertLevelInfo            = "info"
+	AlertRaisedV1AlertLevelWarning         = "warning"
+	AlertRaisedV1AlertLevelCritical        = "critical"
+	AlertRaisedV1ConditionHeartbeatLost    = "heartbeat_lost"
+	AlertRaisedV1ConditionDeviceError      = "device_error"
+	AlertRaisedV1ConditionDeviceOffline    = "device_offline"
+	AlertRaisedV1ConditionDeviceDegraded   = "device_degraded"
+	AlertRaisedV1ConditionContractExpiring = "contract_expiring"
+	AlertRaisedV1PriorityHigh              = "high"
+	AlertRaisedV1PriorityMedium            = "medium"
+	AlertRaisedV1PriorityLow               = "low"
+)
+
+// AlertRaisedV1Note is a nested object of AlertRaisedV1
+type AlertRaisedV1Note struct {
+	Author    string    `json:"author"`
+	CreatedAt time.Time `json:"created_at"`
+	ID        string    `json:"id"`
+	Text      string    `json:"text"`
+}
+
+// OnAlertRaisedV1 registers the handler for alert.raised events. It also receives newer
+// versions of the event when no handler for them is registered.
+func (c *Consumer) OnAlertRaisedV1(fn func(ctx context.Context, meta Metadata, event AlertRaisedV1) error) {
+	c.handle("alert.raised", 1, func(ctx context.Context, meta Metadata, data json.RawMessage) error {
+		var event AlertRaisedV1
+		if err := json.Unmarshal(data, &event); err != nil {
+			return err
+		}
+		return fn(ctx, meta, event)
+	})
+}
+
+// DeviceErrorV1 is the payload of device.error v1 events.
+//
+// Sent to manufacturer service portals when one of their devices enters an error
+// state. Closed to additional properties so no location, patient or free-text data
+// can be added.
+type DeviceErrorV1 struct {
+	Condition       string    `json:"condition"`
+	DeviceID        string    `json:"device_id"`
+	DeviceType      string    `json:"device_type"`
+	ErrorCount      int64     `json:"error_count,omitempty"`
+	Event           string    `json:"event"`
+	EventID         string    `json:"event_id"`
+	FirmwareVersion string    `json:"firmware_version,omitempty"`
+	Manufacturer    string    `json:"manufacturer"`
+	Model           string    `json:"model,omitempty"`
+	OccurredAt      time.Time `json:"occurred_at"`
+	Priority        string    `json:"priority"`
+	SerialNumber    string    `json:"serial_number,omitempty"`
+	Status          string    `json:"status"`
+}
+
+// Allowed values for enumerated DeviceErrorV1 fields
+const (
+	DeviceErrorV1EventDeviceError = "device.error"
+	DeviceErrorV1PriorityHigh     = "high"
+	DeviceErrorV1PriorityMedium   = "medium"
+	DeviceErrorV1PriorityLow      = "low"
+)
+
+// OnDeviceErrorV1 registers the handler for device.error events. It also receives newer
+// versions of the event when no handler for them is registered.
+func (c *Consumer) OnDeviceErrorV1(fn func(ctx context.Context, meta Metadata, event DeviceErrorV1) error) {
+	c.handle("device.error", 1, func(ctx context.Context, meta Metadata, data json.RawMessage) error {
+		var event DeviceErrorV1
+		if err := json.Unmarshal(data, &event); err != nil {
+			return err
+		}
+		return fn(ctx, meta, event)
+	})
+}
+
+// DeviceRegisteredV1 is the payload of device.registered v1 events.
+//
+// A medical device was added to the registry.
+type DeviceRegisteredV1 struct {
+	AlertLevel               string     `json:"alert_level"`
+	DecommissionedAt         *time.Time `json:"decommissioned_at,omitempty"`
+	ErrorCount               int64      `json:"error_count"`
+	FirmwareVersion          string     `json:"firmware_version,omitempty"`
+	HeartbeatIntervalSeconds int64      `json:"heartbeat_interval_seconds,omitempty"`
+	// Device identifier
+	ID              string     `json:"id"`
+	LastCalibration *time.Time `json:"last_calibration,omitempty"`
+	LastHeartbeat   *time.Time `json:"last_heartbeat,omitempty"`
+	// Care unit and room, e.g. "ICU - Room 305"
+	Location        string     `json:"location"`
+	Manufacturer    string     `json:"manufacturer,omitempty"`
+	Model           string     `json:"model,omitempty"`
+	NextMaintenance *time.Time `json:"next_maintenance,omitempty"`
+	SerialNumber    string     `json:"serial_number,omitempty"`
+	// Operational status
+	Status string `json:"status"`
+	// Device type, e.g. MRI, ECG, Ventilator
+	Type          string `json:"type"`
+	UptimeSeconds int64  `json:"uptime_seconds,omitempty"`
+}
+
+// OnDeviceRegisteredV1 registers the handler for device.registered events. It also receives newer
+// versions of the event when no handler for them is registered.
+func (c *Consumer) OnDeviceRegisteredV1(fn func(ctx context.Context, meta Metadata, event DeviceRegisteredV1) error) {
+	c.handle("device.registered", 1, func(ctx context.Context, meta Metadata, data json.RawMessage) error {
+		var event DeviceRegisteredV1
+		if err := json.Unmarshal(data, &event); err != nil {
+			return err
+		}
+		return fn(ctx, meta, event)
+	})
+}
+
+// DeviceStatusChangedV1 is the payload of device.status_changed v1 events.
+//
+// A device moved from one operational status to another.
+type DeviceStatusChangedV1 struct {
+	DeviceID       string `json:"device_id"`
+	DeviceType     string `json:"device_type"`
+	Location       string `json:"location"`
+	PreviousStatus string `json:"previous_status"`
+	Status         string `json:"status"`
+}
+
+// OnDeviceStatusChangedV1 registers the handler for device.status_changed events. It also receives newer
+// versions of the event when no handler for them is registered.
+func (c *Consumer) OnDeviceStatusChangedV1(fn func(ctx context.Context, meta Metadata, event DeviceStatusChangedV1) error) {
+	c.handle("device.status_changed", 1, func(ctx context.Context, meta Metadata, data json.RawMessage) error {
+		var event DeviceStatusChangedV1
+		if err := json.Unmarshal(data, &event); err != nil {
+			return err
+		}
+		return fn(ctx, meta, event)
+	})
+}
+
+// PaymentCapturedV1 is the payload of payment.captured v1 events.
+//
+// An authorized payment was captured and will settle with its processor.
+type PaymentCapturedV1 struct {
+	AmountMinor  int64      `json:"amount_minor"`
+	AuditID      string     `json:"audit_id,omitempty"`
+	AuthorizedAt *time.Time `json:"authorized_at,omitempty"`
+	CapturedAt   time.Time  `json:"captured_at"`
+	// User who captured the payment
+	CapturedBy    string `json:"captured_by"`
+	Currency      string `json:"currency"`
+	CustomerID    string `json:"customer_id"`
+	DeviceID      string `json:"device_id,omitempty"`
+	HighValue     bool   `json:"high_value,omitempty"`
+	Method        string `json:"method"`
+	PatientID     string `json:"patient_id,omitempty"`
+	Processor     string `json:"processor"`
+	TransactionID string `json:"transaction_id"`
+}
+
+// OnPaymentCapturedV1 registers the handler for payment.captured events. It also receives newer
+// versions of the event when no handler for them is registered.
+func (c *Consumer) OnPaymentCapturedV1(fn func(ctx context.Context, meta Metadata, event PaymentCapturedV1) error) {
+	c.handle("payment.captured", 1, func(ctx context.Context, meta Metadata, data json.RawMessage) error {
+		var event PaymentCapturedV1
+		if err := json.Unmarshal(data, &event); err != nil {
+			return err
+		}
+		return fn(ctx, meta, event)
+	})
+}
+
+// PaymentFailedV1 is the payload of payment.failed v1 events.
+//
+// A valid payment request was declined, its processor was unavailable, or the
+// authorized payment could not be recorded and was not charged.
+type PaymentFailedV1 struct {
+	AmountMinor   int64     `json:"amount_minor"`
+	Currency      string    `json:"currency"`
+	CustomerID    string    `json:"customer_id"`
+	DeviceID      string    `json:"device_id,omitempty"`
+	FailedAt      time.Time `json:"failed_at"`
+	Message       string    `json:"message"`
+	Method        string    `json:"method"`
+	PatientID     string    `json:"patient_id,omitempty"`
+	Processor     string    `json:"processor"`
+	Reason        string    `json:"reason"`
+	TransactionID string    `json:"transaction_id"`
+}
+
+// Allowed values for enumerated PaymentFailedV1 fields
+const (
+	PaymentFailedV1ReasonDeclined             = "declined"
+	PaymentFailedV1ReasonProcessorUnavailable = "processor_unavailable"
+	PaymentFailedV1ReasonNotRecorded          = "not_recorded"
+)
+
+// OnPaymentFailedV1 registers the handler for payment.failed events. It also receives newer
+// versions of the event when no handler for them is registered.
+func (c *Consumer) OnPaymentFailedV1(fn func(ctx context.Context, meta Metadata, event PaymentFailedV1) error) {
+	c.handle("payment.failed", 1, func(ctx context.Context, meta Metadata, data json.RawMessage) error {
+		var event PaymentFailedV1
+		if err := json.Unmarshal(data, &event); err != nil {
+			return err
+		}
+		return fn(ctx, meta, event)
+	})
+}
+
+// PaymentSucceededV1 is the payload of payment.succeeded v1 events.
+//
+// A payment was authorized by its processor, or an insurance payment was settled
+// from a remittance advice.
+type PaymentSucceededV1 struct {
+	AmountMinor   int64     `json:"amount_minor"`
+	AuditID       string    `json:"audit_id,omitempty"`
+	ClaimID       string    `json:"claim_id,omitempty"`
+	Currency      string    `json:"currency"`
+	CustomerID    string    `json:"customer_id"`
+	DeviceID      string    `json:"device_id,omitempty"`
+	HighValue     bool      `json:"high_value,omitempty"`
+	Method        string    `json:"method"`
+	PatientID     string    `json:"patient_id,omitempty"`
+	ProcessedAt   time.Time `json:"processed_at"`
+	Processor     string    `json:"processor"`
+	Status        string    `json:"status"`
+	TransactionID string    `json:"transaction_id"`
+}
+
+// OnPaymentSucceededV1 registers the handler for payment.succeeded events. It also receives newer
+// versions of the event when no handler for them is registered.
+func (c *Consumer) OnPaymentSucceededV1(fn func(ctx context.Context, meta Metadata, event PaymentSucceededV1) error) {
+	c.handle("payment.succeeded", 1, func(ctx context.Context, meta Metadata, data json.RawMessage) error {
+		var event PaymentSucceededV1
+		if err := json.Unmarshal(data, &event); err != nil {
+			return err
+		}
+		return fn(ctx, meta, event)
+	})
+}
+
+// PHIDecryptedV1 is the payload of phi.decrypted v1 events.
+//
+// Protected health information was released in the clear. Carries who decrypted
+// what kind of value under which key and why, never the value itself.
+type PHIDecryptedV1 struct {
+	// Authorized user, or the client certificate name
+	Actor string `json:"actor"`
+	// FPE format of the value, or text for standard encryption
+	DataType    string    `json:"data_type"`
+	DecryptedAt time.Time `json:"decrypted_at"`
+	// Key the value was encrypted under
+	KeyID string `json:"key_id"`
+	Mode  string `json:"mode"`
+	// HL7 purpose of use, e.g. TREAT
+	PurposeOfUse string `json:"purpose_of_use,omitempty"`
+	RequestID    string `json:"request_id,omitempty"`
+	Role         string `json:"role,omitempty"`
+	SourceIP     string `json:"source_ip,omitempty"`
+}
+
+// Allowed values for enumerated PHIDecryptedV1 fields
+const (
+	PHIDecryptedV1ModeStandard = "standard"
+	PHIDecryptedV1ModeFPE      = "fpe"
+)
+
+// OnPHIDecryptedV1 registers the handler for phi.decrypted events. It also receives newer
+// versions of the event when no handler for them is registered.
+func (c *Consumer) OnPHIDecryptedV1(fn func(ctx context.Context, meta Metadata, event PHIDecryptedV1) error) {
+	c.handle("phi.decrypted", 1, func(ctx context.Context, meta Metadata, data json.RawMessage) error {
+		var event PHIDecryptedV1
+		if err := json.Unmarshal(data, &event); err != nil {
+			return err
+		}
+		return fn(ctx, meta, event)
+	})
+}
+
+// RefundIssuedV1 is the payload of refund.issued v1 events.
+//
+// Part or all of a captured payment was refunded, through the payment API or by a
+// payer's claim reversal.
+type RefundIssuedV1 struct {
+	AmountMinor        int64     `json:"amount_minor"`
+	ClaimID            string    `json:"claim_id,omitempty"`
+	Currency           string    `json:"currency"`
+	CustomerID         string    `json:"customer_id,omitempty"`
+	Full               bool      `json:"full"`
+	PatientID          string    `json:"patient_id,omitempty"`
+	Processor          string    `json:"processor"`
+	Reason             string    `json:"reason,omitempty"`
+	RefundID           string    `json:"refund_id"`
+	RefundedAt         time.Time `json:"refunded_at"`
+	RefundedTotalMinor int64     `json:"refunded_total_minor"`
+	TransactionID      string    `json:"transaction_id"`
+}
+
+// OnRefundIssuedV1 registers the handler for refund.issued events. It also receives newer
+// versions of the event when no handler for them is registered.
+func (c *Consumer) OnRefundIssuedV1(fn func(ctx context.Context, meta Metadata, event RefundIssuedV1) error) {
+	c.handle("refund.issued", 1, func(ctx context.Context, meta Metadata, data json.RawMessage) error {
+		var event RefundIssuedV1
+		if err := json.Unmarshal(data, &event); err != nil {
+			return err
+		}
+		return fn(ctx, meta, event)
+	})
+}
+
+// TokenIssuedV1 is the payload of token.issued v1 events.
+//
+// An access token was issued. Carries the grant, never the token.
+type TokenIssuedV1 struct {
+	ExpiresAt time.Time `json:"expires_at"`
+	IssuedAt  time.Time `json:"issued_at"`
+	Issuer    string    `json:"issuer"`
+	Role      string    `json:"role,omitempty"`
+	Scopes    []string  `json:"scopes"`
+	SourceIP  string    `json:"source_ip,omitempty"`
+	UserID    string    `json:"user_id"`
+}
+
+// OnTokenIssuedV1 registers the handler for token.issued events. It also receives newer
+// versions of the event when no handler for them is registered.
+func (c *Consumer) OnTokenIssuedV1(fn func(ctx context.Context, meta Metadata, event TokenIssuedV1) error) {
+	c.handle("token.issued", 1, func(ctx context.Context, meta Metadata, data json.RawMessage) error {
+		var event TokenIssuedV1
+		if err := json.Unmarshal(data, &event); err != nil {
+			return err
+		}
+		return fn(ctx, meta, event)
+	})
+}
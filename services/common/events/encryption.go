@@ -0,0 +1,257 @@
+package events
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EncryptionAlgorithm is the cipher encrypted event payloads use
+const EncryptionAlgorithm = "A256GCM"
+
+var (
+	// ErrEncrypted is returned when a consumer without a key provider receives an
+	// encrypted payload
+	ErrEncrypted = errors.New("event payload is encrypted and no key provider is configured")
+
+	// ErrUndecryptable is returned when an encrypted payload fails authentication
+	// under the key it names, or names a key for another topic
+	ErrUndecryptable = errors.New("event payload cannot be decrypted")
+)
+
+// EncryptedPayload replaces the delivery body of an encrypted event. The ciphertext
+// is the body that would otherwise have been sent, so consumers validate and
+// dispatch it as usual once decrypted. The event type and ID are authenticated with
+// it, so a payload cannot be replayed as a different event.
+type EncryptedPayload struct {
+	Algorithm  string `json:"alg"`
+	Topic      string `json:"topic"`
+	KeyID      string `json:"key_id"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// TopicKey is a key event payloads on one topic are encrypted with
+type TopicKey struct {
+	Topic  string
+	ID     string
+	Key    []byte
+	Active bool
+}
+
+// KeyProvider supplies topic keys. Producers ask for the active key with an empty
+// keyID; consumers ask for the key an event names.
+type KeyProvider interface {
+	TopicKey(ctx context.Context, topic, keyID string) (TopicKey, error)
+}
+
+// Encrypt seals a delivery body under the topic's active key and returns the
+// EncryptedPayload to send instead
+func Encrypt(ctx context.Context, keys KeyProvider, topic, eventType, eventID string, body []byte) ([]byte, error) {
+	key, err := keys.TopicKey(ctx, topic, "")
+	if err != nil {
+		return nil, fmt.Errorf("topic key for %s: %w", topic, err)
+	}
+	aead, err := newTopicAEAD(key.Key)
+	if err != nil {
+		return nil, err
+	}
+	payload := EncryptedPayload{Algorithm: EncryptionAlgorithm, Topic: topic, KeyID: key.ID, Nonce: make([]byte, aead.NonceSize())}
+	if _, err := rand.Read(payload.Nonce); err != nil {
+		return nil, err
+	}
+	payload.Ciphertext = aead.Seal(nil, payload.Nonce, body, payloadAAD(eventType, eventID))
+	return json.Marshal(payload)
+}
+
+// encryptedPayload reports whether a delivery body is an EncryptedPayload
+func encryptedPayload(body []byte) (*EncryptedPayload, bool) {
+	var payload EncryptedPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, false
+	}
+	if payload.Algorithm == "" || payload.KeyID == "" || len(payload.Ciphertext) == 0 {
+		return nil, false
+	}
+	return &payload, true
+}
+
+// decrypt opens the payload with the key it names, which the provider fetches when it
+// has not seen it before, e.g. after the producer rotated keys
+func (p *EncryptedPayload) decrypt(ctx context.Context, keys KeyProvider, eventType, eventID string) ([]byte, error) {
+	if p.Algorithm != EncryptionAlgorithm {
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrUndecryptable, p.Algorithm)
+	}
+	key, err := keys.TopicKey(ctx, p.Topic, p.KeyID)
+	if err != nil {
+		return nil, fmt.Errorf("topic key %s/%s: %w", p.Topic, p.KeyID, err)
+	}
+	aead, err := newTopicAEAD(key.Key)
+	if err != nil {
+		return nil, err
+	}
+	if len(p.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("%w: invalid nonce", ErrUndecryptable)
+	}
+	body, err := aead.Open(nil, p.Nonce, p.Ciphertext, payloadAAD(eventType, eventID))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s under key %s", ErrUndecryptable, eventType, p.KeyID)
+	}
+	return body, nil
+}
+
+func newTopicAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("topic key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// payloadAAD binds a ciphertext to the event it was published as
+func payloadAAD(eventType, eventID string) []byte {
+	return []byte(eventType + "\x00" + eventID)
+}
+
+// KeyServiceConfig configures fetching topic keys from phi-service
+type KeyServiceConfig struct {
+	// URL is phi-service's base URL, e.g. https://phi-service.healthcare.svc.cluster.local
+	URL string
+	// Token is a bearer token with the events:keys scope
+	Token string
+	// ActiveTTL is how long a producer keeps encrypting with the active key before
+	// asking again, which bounds how long it takes to pick up a rotation. Defaults to
+	// five minutes.
+	ActiveTTL  time.Duration
+	HTTPClient *http.Client
+}
+
+// KeyService is a KeyProvider backed by phi-service's topic key endpoints. Keys are
+// immutable, so every key fetched by ID is cached for good; only the choice of active
+// key expires. After a rotation, consumers fetch the new key the first time an event
+// names it and keep the old one for events still in flight, so neither side has to
+// restart.
+type KeyService struct {
+	cfg    KeyServiceConfig
+	client *http.Client
+	now    func() time.Time
+
+	mu     sync.Mutex
+	keys   map[string]TopicKey // by topic and key ID
+	active map[string]activeTopicKey
+}
+
+type activeTopicKey struct {
+	key     TopicKey
+	expires time.Time
+}
+
+// NewKeyService creates a key provider for the phi-service at cfg.URL
+func NewKeyService(cfg KeyServiceConfig) (*KeyService, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("events: key service URL is required")
+	}
+	if cfg.Token == "" {
+		return nil, errors.New("events: key service token is required")
+	}
+	if cfg.ActiveTTL <= 0 {
+		cfg.ActiveTTL = 5 * time.Minute
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	cfg.URL = strings.TrimRight(cfg.URL, "/")
+	return &KeyService{
+		cfg:    cfg,
+		client: client,
+		now:    time.Now,
+		keys:   make(map[string]TopicKey),
+		active: make(map[string]activeTopicKey),
+	}, nil
+}
+
+// TopicKey returns the topic's key with the given ID, or its active key when keyID is
+// empty
+func (s *KeyService) TopicKey(ctx context.Context, topic, keyID string) (TopicKey, error) {
+	s.mu.Lock()
+	if keyID == "" {
+		if cached, ok := s.active[topic]; ok && s.now().Before(cached.expires) {
+			s.mu.Unlock()
+			return cached.key, nil
+		}
+	} else if key, ok := s.keys[topic+"\x00"+keyID]; ok {
+		s.mu.Unlock()
+		return key, nil
+	}
+	s.mu.Unlock()
+
+	path := "/api/v1/topic-keys/" + url.PathEscape(topic)
+	if keyID != "" {
+		path += "/" + url.PathEscape(keyID)
+	}
+	key, err := s.fetch(ctx, path)
+	if err != nil {
+		return TopicKey{}, err
+	}
+	if key.Topic != topic || (keyID != "" && key.ID != keyID) {
+		return TopicKey{}, fmt.Errorf("events: key service returned %s/%s for %s/%s", key.Topic, key.ID, topic, keyID)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[topic+"\x00"+key.ID] = key
+	if keyID == "" {
+		s.active[topic] = activeTopicKey{key: key, expires: s.now().Add(s.cfg.ActiveTTL)}
+	}
+	return key, nil
+}
+
+// fetch requests one topic key from phi-service
+func (s *KeyService) fetch(ctx context.Context, path string) (TopicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.cfg.URL+path, nil)
+	if err != nil {
+		return TopicKey{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.cfg.Token)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return TopicKey{}, fmt.Errorf("events: key service: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return TopicKey{}, fmt.Errorf("events: key service returned %s for %s", resp.Status, path)
+	}
+
+	var body struct {
+		Topic     string `json:"topic"`
+		KeyID     string `json:"key_id"`
+		Algorithm string `json:"algorithm"`
+		Key       string `json:"key"`
+		Active    bool   `json:"active"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return TopicKey{}, fmt.Errorf("events: decode topic key: %w", err)
+	}
+	if body.Algorithm != EncryptionAlgorithm {
+		return TopicKey{}, fmt.Errorf("events: unsupported topic key algorithm %q", body.Algorithm)
+	}
+	key, err := base64.StdEncoding.DecodeString(body.Key)
+	if err != nil || len(key) != 32 {
+		return TopicKey{}, errors.New("events: key service returned an invalid key")
+	}
+	return TopicKey{Topic: body.Topic, ID: body.KeyID, Key: key, Active: body.Active}, nil
+}
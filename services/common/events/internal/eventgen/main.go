@@ -0,0 +1,286 @@
+// Command eventgen generates the AsyncAPI document and the typed Go consumer SDK
+// from the event schema bundle. Run it through go generate in services/common/events;
+// with -check it fails instead of writing when the committed output is stale.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/healthcare-gitops/common/events"
+)
+
+func main() {
+	dir := flag.String("dir", ".", "events package directory containing schemas/")
+	version := flag.String("version", "1.0.0", "version recorded in the AsyncAPI document")
+	check := flag.Bool("check", false, "fail if generated files are out of date instead of writing them")
+	flag.Parse()
+
+	registry := events.NewRegistry()
+	if err := registry.LoadFS(os.DirFS(*dir), "schemas"); err != nil {
+		fail("loading schemas: %v", err)
+	}
+
+	doc := registry.AsyncAPI(events.AsyncAPIInfo{
+		Title:   "Healthcare platform events",
+		Version: *version,
+		Description: "Events published by platform services to webhook subscribers and, when " +
+			"EVENT_BROKER is set, to the Kafka topic each channel names or to NATS subjects " +
+			"<channel>.<event type>. " +
+			"Producers may encrypt a delivery body as {alg, topic, key_id, nonce, ciphertext} " +
+			"under the topic's key from phi-service (GET /api/v1/topic-keys/{topic}/{key_id}); " +
+			"the events SDK decrypts it before validation. " +
+			"Generated from services/common/events/schemas; do not edit by hand.",
+	})
+	asyncapi, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		fail("encoding AsyncAPI document: %v", err)
+	}
+	asyncapi = append(asyncapi, '\n')
+
+	source, err := generateConsumer(registry)
+	if err != nil {
+		fail("generating consumer: %v", err)
+	}
+
+	outputs := map[string][]byte{
+		filepath.Join(*dir, "asyncapi.json"):   asyncapi,
+		filepath.Join(*dir, "consumer_gen.go"): source,
+	}
+	names := make([]string, 0, len(outputs))
+	for name := range outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	stale := false
+	for _, name := range names {
+		if *check {
+			current, err := os.ReadFile(name)
+			if err != nil || !bytes.Equal(current, outputs[name]) {
+				fmt.Fprintf(os.Stderr, "%s is out of date; run go generate ./events\n", name)
+				stale = true
+			}
+			continue
+		}
+		if err := os.WriteFile(name, outputs[name], 0o644); err != nil {
+			fail("writing %s: %v", name, err)
+		}
+	}
+	if stale {
+		os.Exit(1)
+	}
+}
+
+func fail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "eventgen: "+format+"\n", args...)
+	os.Exit(1)
+}
+
+// generator accumulates Go source for the consumer SDK
+type generator struct {
+	buf bytes.Buffer
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+// generateConsumer emits event type and topic constants, one payload struct per
+// schema version, and a typed handler registration method for each
+func generateConsumer(registry *events.Registry) ([]byte, error) {
+	g := &generator{}
+	infos := registry.List()
+
+	g.printf("// Event types\nconst (\n")
+	for _, info := range infos {
+		g.printf("\tEvent%s = %q\n", events.ExportedName(info.EventType), info.EventType)
+	}
+	g.printf(")\n\n")
+
+	topics := make(map[string]bool)
+	for _, info := range infos {
+		topics[info.Topic] = true
+	}
+	topicNames := make([]string, 0, len(topics))
+	for topic := range topics {
+		topicNames = append(topicNames, topic)
+	}
+	sort.Strings(topicNames)
+	g.printf("// Topics\nconst (\n")
+	for _, topic := range topicNames {
+		g.printf("\tTopic%s = %q\n", events.ExportedName(topic), topic)
+	}
+	g.printf(")\n")
+
+	for _, info := range infos {
+		for _, version := range info.Versions {
+			schema, err := registry.Lookup(info.EventType, version)
+			if err != nil {
+				return nil, err
+			}
+			typeName := fmt.Sprintf("%sV%d", events.ExportedName(info.EventType), version)
+			doc := fmt.Sprintf("%s is the payload of %s v%d events", typeName, info.EventType, version)
+			if schema.Description != "" {
+				doc += ".\n//\n// " + wrapComment(schema.Description)
+			}
+			g.emitStruct(typeName, doc, schema)
+			g.emitHandler(typeName, info.EventType, version)
+		}
+	}
+
+	imports := "\t\"context\"\n\t\"encoding/json\"\n"
+	if bytes.Contains(g.buf.Bytes(), []byte("time.Time")) {
+		imports += "\t\"time\"\n"
+	}
+	header := "// Code generated by eventgen from schemas/*.json. DO NOT EDIT.\n\n" +
+		"package events\n\nimport (\n" + imports + ")\n\n"
+	return format.Source(append([]byte(header), g.buf.Bytes()...))
+}
+
+// emitStruct writes a struct for an object schema, then any nested types and enums
+func (g *generator) emitStruct(typeName, doc string, schema *events.Schema) {
+	required := make(map[string]bool, len(schema.Required))
+	for _, name := range schema.Required {
+		required[name] = true
+	}
+	names := make([]string, 0, len(schema.Properties))
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	type nested struct {
+		name   string
+		schema *events.Schema
+	}
+	var nestedTypes []nested
+	var enums []string
+
+	g.printf("\n// %s\ntype %s struct {\n", doc, typeName)
+	for _, name := range names {
+		prop := schema.Properties[name]
+		field := events.ExportedName(name)
+		goType := goType(prop, required[name])
+
+		switch {
+		case is(prop, "object") && len(prop.Properties) > 0:
+			goType = typeName + field
+			if !required[name] {
+				goType = "*" + goType
+			}
+			nestedTypes = append(nestedTypes, nested{typeName + field, prop})
+		case is(prop, "array") && prop.Items != nil && is(prop.Items, "object") && len(prop.Items.Properties) > 0:
+			item := typeName + singular(field)
+			goType = "[]" + item
+			nestedTypes = append(nestedTypes, nested{item, prop.Items})
+		}
+
+		tag := name
+		if !required[name] {
+			tag += ",omitempty"
+		}
+		if prop.Description != "" {
+			g.printf("\t// %s\n", prop.Description)
+		}
+		g.printf("\t%s %s `json:%q`\n", field, goType, tag)
+
+		if is(prop, "string") && len(prop.Enum) > 0 {
+			for _, value := range prop.Enum {
+				enums = append(enums, fmt.Sprintf("\t%s%s%s = %q\n", typeName, field, events.ExportedName(fmt.Sprint(value)), fmt.Sprint(value)))
+			}
+		}
+	}
+	g.printf("}\n")
+
+	if len(enums) > 0 {
+		g.printf("\n// Allowed values for enumerated %s fields\nconst (\n%s)\n", typeName, strings.Join(enums, ""))
+	}
+	for _, n := range nestedTypes {
+		g.emitStruct(n.name, fmt.Sprintf("%s is a nested object of %s", n.name, typeName), n.schema)
+	}
+}
+
+// emitHandler writes the typed handler registration method for one schema version
+func (g *generator) emitHandler(typeName, eventType string, version int) {
+	g.printf(`
+// On%[1]s registers the handler for %[2]s events. It also receives newer
+// versions of the event when no handler for them is registered.
+func (c *Consumer) On%[1]s(fn func(ctx context.Context, meta Metadata, event %[1]s) error) {
+	c.handle(%[2]q, %[3]d, func(ctx context.Context, meta Metadata, data json.RawMessage) error {
+		var event %[1]s
+		if err := json.Unmarshal(data, &event); err != nil {
+			return err
+		}
+		return fn(ctx, meta, event)
+	})
+}
+`, typeName, eventType, version)
+}
+
+// goType maps a property schema to a Go type. Optional timestamps are pointers so an
+// absent value is distinguishable from the zero time.
+func goType(prop *events.Schema, required bool) string {
+	switch {
+	case is(prop, "string") && prop.Format == "date-time":
+		if required {
+			return "time.Time"
+		}
+		return "*time.Time"
+	case is(prop, "string"):
+		return "string"
+	case is(prop, "integer"):
+		return "int64"
+	case is(prop, "number"):
+		return "float64"
+	case is(prop, "boolean"):
+		return "bool"
+	case is(prop, "array") && prop.Items != nil:
+		return "[]" + goType(prop.Items, true)
+	case is(prop, "object") && len(prop.Properties) == 0:
+		return "map[string]interface{}"
+	default:
+		return "json.RawMessage"
+	}
+}
+
+// is reports whether a schema's single declared type is name
+func is(schema *events.Schema, name string) bool {
+	return len(schema.Type) == 1 && schema.Type[0] == name
+}
+
+// singular names the element type of a plural field ("Notes" -> "Note")
+func singular(field string) string {
+	if strings.HasSuffix(field, "s") && len(field) > 1 {
+		return strings.TrimSuffix(field, "s")
+	}
+	return field + "Item"
+}
+
+// wrapComment wraps text to comment lines of about 80 columns
+func wrapComment(text string) string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		if line != "" && len(line)+1+len(word) > 80 {
+			lines = append(lines, line)
+			line = word
+			continue
+		}
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n// ")
+}
@@ -0,0 +1,104 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// natsDialTimeout bounds connecting, and publishing when the publish context has no
+// deadline
+const natsDialTimeout = 10 * time.Second
+
+// NATSPublisher publishes events to a NATS server on subjects named topic.event_type,
+// e.g. payments.payment.captured, so consumers can subscribe to a topic with
+// payments.> or to one event type. It flushes after every batch, so a batch is only
+// reported published once the server has processed it. With JetStream capturing the
+// subjects, the Nats-Msg-Id header lets it discard batches retried after a lost flush.
+//
+// The connection is opened on first use and reopened after any error. The client's
+// own reconnection is off: it would buffer a batch while disconnected and report it
+// published.
+type NATSPublisher struct {
+	url  string
+	opts []nats.Option
+
+	mu   sync.Mutex
+	conn *nats.Conn
+}
+
+// NewNATSPublisher creates a publisher for the server at rawURL: nats://host:port, or
+// tls://host:port to require TLS. Credentials come from the URL's user info, as
+// user:password or a bare token. name identifies the connection to the server.
+func NewNATSPublisher(rawURL, name string) (*NATSPublisher, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse EVENT_NATS_URL: %w", err)
+	}
+	if u.Scheme != "nats" && u.Scheme != "tls" {
+		return nil, fmt.Errorf("EVENT_NATS_URL must use nats:// or tls://, not %q", u.Scheme)
+	}
+	return &NATSPublisher{
+		url:  rawURL,
+		opts: []nats.Option{nats.Name(name), nats.NoEcho(), nats.NoReconnect(), nats.Timeout(natsDialTimeout)},
+	}, nil
+}
+
+// Publish sends a batch and waits for the server to acknowledge it
+func (p *NATSPublisher) Publish(ctx context.Context, messages []Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.publish(ctx, messages); err != nil {
+		p.closeLocked()
+		return err
+	}
+	return nil
+}
+
+func (p *NATSPublisher) publish(ctx context.Context, messages []Message) error {
+	if p.conn == nil {
+		conn, err := nats.Connect(p.url, p.opts...)
+		if err != nil {
+			return fmt.Errorf("connect to nats: %w", err)
+		}
+		p.conn = conn
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, natsDialTimeout)
+		defer cancel()
+	}
+
+	for _, msg := range messages {
+		out := &nats.Msg{Subject: msg.Topic + "." + msg.Type, Data: msg.Value}
+		if p.conn.HeadersSupported() {
+			out.Header = nats.Header{nats.MsgIdHdr: []string{msg.ID}}
+		}
+		if err := p.conn.PublishMsg(out); err != nil {
+			return fmt.Errorf("nats publish event %s: %w", msg.ID, err)
+		}
+	}
+	if err := p.conn.FlushWithContext(ctx); err != nil {
+		return fmt.Errorf("nats publish: %w", err)
+	}
+	return nil
+}
+
+func (p *NATSPublisher) closeLocked() {
+	if p.conn != nil {
+		p.conn.Close()
+		p.conn = nil
+	}
+}
+
+// Close closes the connection
+func (p *NATSPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closeLocked()
+	return nil
+}
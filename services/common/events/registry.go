@@ -0,0 +1,229 @@
+// Package events holds the versioned JSON Schemas for every event the platform
+// publishes, and the registry services use to validate payloads before publishing.
+// Stream publishes validated events to Kafka or NATS, for analytics and SIEM
+// pipelines that consume them without registering webhooks.
+//
+// The AsyncAPI document (asyncapi.json) and the typed consumer SDK (consumer_gen.go)
+// are generated from the same schemas; run go generate after changing schemas/.
+package events
+
+//go:generate go run ./internal/eventgen -dir .
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//go:embed schemas/*.json
+var bundledSchemas embed.FS
+
+var (
+	// ErrUnknownEvent is returned for event types with no registered schema
+	ErrUnknownEvent = errors.New("unknown event type")
+
+	// ErrIncompatibleSchema is returned when a new schema version would break consumers
+	ErrIncompatibleSchema = errors.New("schema is not backward compatible")
+)
+
+// ValidationError lists the ways a payload violates its event schema
+type ValidationError struct {
+	EventType  string
+	Version    int
+	Violations []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s v%d payload does not match schema: %s", e.EventType, e.Version, strings.Join(e.Violations, "; "))
+}
+
+// SchemaInfo summarises the registered versions of one event type
+type SchemaInfo struct {
+	EventType   string `json:"event_type"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Topic       string `json:"topic"`
+	Latest      int    `json:"latest_version"`
+	Versions    []int  `json:"versions"`
+}
+
+// Registry maps event types to their schema versions
+type Registry struct {
+	schemas map[string]map[int]*Schema
+	mu      sync.RWMutex
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{schemas: make(map[string]map[int]*Schema)}
+}
+
+var (
+	defaultRegistry     *Registry
+	defaultRegistryOnce sync.Once
+)
+
+// Default returns the registry loaded from the embedded schema bundle. The bundle is
+// compiled into every service, so producers and consumers agree on the same versions.
+func Default() *Registry {
+	defaultRegistryOnce.Do(func() {
+		defaultRegistry = NewRegistry()
+		if err := defaultRegistry.LoadFS(bundledSchemas, "schemas"); err != nil {
+			panic(fmt.Sprintf("events: invalid embedded schema bundle: %v", err))
+		}
+	})
+	return defaultRegistry
+}
+
+// LoadFS registers every *.json schema in dir, oldest version first
+func (r *Registry) LoadFS(fsys fs.FS, dir string) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return err
+	}
+
+	loaded := make([]*Schema, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		var schema Schema
+		if err := json.Unmarshal(data, &schema); err != nil {
+			return fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+		loaded = append(loaded, &schema)
+	}
+
+	sort.Slice(loaded, func(i, j int) bool {
+		if loaded[i].EventType != loaded[j].EventType {
+			return loaded[i].EventType < loaded[j].EventType
+		}
+		return loaded[i].Version < loaded[j].Version
+	})
+	for _, schema := range loaded {
+		if err := r.Register(schema); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Register adds a schema version. Versions must increase, and each new version must
+// be backward compatible with the previous one.
+func (r *Registry) Register(schema *Schema) error {
+	if schema.EventType == "" || schema.Version < 1 || schema.Topic == "" {
+		return fmt.Errorf("schema must declare x-event-type, x-topic and a positive x-version")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	versions := r.schemas[schema.EventType]
+	if versions == nil {
+		versions = make(map[int]*Schema)
+		r.schemas[schema.EventType] = versions
+	}
+	if _, exists := versions[schema.Version]; exists {
+		return fmt.Errorf("%s v%d is already registered", schema.EventType, schema.Version)
+	}
+
+	if latest := latestVersion(versions); latest > 0 {
+		if schema.Version < latest {
+			return fmt.Errorf("%s v%d is older than the registered v%d", schema.EventType, schema.Version, latest)
+		}
+		if problems := CheckCompatibility(versions[latest], schema); len(problems) > 0 {
+			return fmt.Errorf("%w: %s v%d -> v%d: %s", ErrIncompatibleSchema,
+				schema.EventType, latest, schema.Version, strings.Join(problems, "; "))
+		}
+	}
+
+	versions[schema.Version] = schema
+	return nil
+}
+
+func latestVersion(versions map[int]*Schema) int {
+	latest := 0
+	for v := range versions {
+		if v > latest {
+			latest = v
+		}
+	}
+	return latest
+}
+
+// Lookup returns a specific schema version
+func (r *Registry) Lookup(eventType string, version int) (*Schema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	schema, ok := r.schemas[eventType][version]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s v%d", ErrUnknownEvent, eventType, version)
+	}
+	return schema, nil
+}
+
+// Latest returns the newest schema version for an event type
+func (r *Registry) Latest(eventType string) (*Schema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	versions := r.schemas[eventType]
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEvent, eventType)
+	}
+	return versions[latestVersion(versions)], nil
+}
+
+// List summarises every registered event type, ordered by name
+func (r *Registry) List() []SchemaInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	infos := make([]SchemaInfo, 0, len(r.schemas))
+	for eventType, versions := range r.schemas {
+		latest := latestVersion(versions)
+		info := SchemaInfo{
+			EventType:   eventType,
+			Title:       versions[latest].Title,
+			Description: versions[latest].Description,
+			Topic:       versions[latest].Topic,
+			Latest:      latest,
+			Versions:    make([]int, 0, len(versions)),
+		}
+		for v := range versions {
+			info.Versions = append(info.Versions, v)
+		}
+		sort.Ints(info.Versions)
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].EventType < infos[j].EventType })
+	return infos
+}
+
+// Validate checks a payload against the latest schema for its event type and returns
+// the version it was validated against. Violations are returned as *ValidationError.
+func (r *Registry) Validate(eventType string, payload interface{}) (int, error) {
+	schema, err := r.Latest(eventType)
+	if err != nil {
+		return 0, err
+	}
+	violations, err := schema.ValidatePayload(payload)
+	if err != nil {
+		return schema.Version, err
+	}
+	if len(violations) > 0 {
+		return schema.Version, &ValidationError{EventType: eventType, Version: schema.Version, Violations: violations}
+	}
+	return schema.Version, nil
+}
@@ -0,0 +1,240 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// SchemaTypes holds a JSON Schema "type", which may be a single name or a list
+type SchemaTypes []string
+
+// UnmarshalJSON accepts both "string" and ["string", "null"]
+func (t *SchemaTypes) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = SchemaTypes{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("type must be a string or array of strings")
+	}
+	*t = list
+	return nil
+}
+
+// MarshalJSON writes single types as a plain string
+func (t SchemaTypes) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+func (t SchemaTypes) allows(name string) bool {
+	for _, allowed := range t {
+		if allowed == name || (allowed == "number" && name == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// Schema is the subset of JSON Schema (draft 2020-12) used for event payloads:
+// type, properties, required, enum, items, format "date-time" and additionalProperties
+type Schema struct {
+	SchemaURI            string             `json:"$schema,omitempty"`
+	ID                   string             `json:"$id,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	EventType            string             `json:"x-event-type,omitempty"`
+	Version              int                `json:"x-version,omitempty"`
+	Topic                string             `json:"x-topic,omitempty"`
+	Envelope             *bool              `json:"x-envelope,omitempty"`
+	Type                 SchemaTypes        `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+}
+
+// Enveloped reports whether the event is delivered inside the standard envelope
+// ({id, type, schema_version, occurred_at, data}) rather than as a bare payload
+func (s *Schema) Enveloped() bool {
+	return s.Envelope == nil || *s.Envelope
+}
+
+// Validate checks a decoded JSON value (as produced by encoding/json into
+// interface{}) against the schema and returns one message per violation
+func (s *Schema) Validate(value interface{}) []string {
+	errs := make([]string, 0)
+	s.validate("$", value, &errs)
+	return errs
+}
+
+// ValidatePayload marshals a Go value to JSON and validates the result
+func (s *Schema) ValidatePayload(payload interface{}) ([]string, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return nil, err
+	}
+	return s.Validate(value), nil
+}
+
+func (s *Schema) validate(path string, value interface{}, errs *[]string) {
+	if len(s.Type) > 0 {
+		actual := jsonType(value)
+		if !s.Type.allows(actual) {
+			*errs = append(*errs, fmt.Sprintf("%s: expected %v, got %s", path, []string(s.Type), actual))
+			return
+		}
+	}
+
+	if len(s.Enum) > 0 && !inEnum(s.Enum, value) {
+		*errs = append(*errs, fmt.Sprintf("%s: value %v is not one of %v", path, value, s.Enum))
+	}
+
+	switch v := value.(type) {
+	case string:
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, v); err != nil {
+				*errs = append(*errs, fmt.Sprintf("%s: %q is not an RFC 3339 date-time", path, v))
+			}
+		}
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				*errs = append(*errs, fmt.Sprintf("%s: missing required property %q", path, name))
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			prop, known := s.Properties[name]
+			if !known {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					*errs = append(*errs, fmt.Sprintf("%s: unexpected property %q", path, name))
+				}
+				continue
+			}
+			prop.validate(path+"."+name, v[name], errs)
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, errs)
+			}
+		}
+	}
+}
+
+// jsonType names the JSON type of a decoded value
+func jsonType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == float64(int64(v)) {
+			return "integer"
+		}
+		return "number"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func inEnum(enum []interface{}, value interface{}) bool {
+	for _, allowed := range enum {
+		if fmt.Sprint(allowed) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckCompatibility reports changes in next that would break consumers written
+// against previous: a different topic or delivery format, removed properties,
+// properties no longer required, changed types, and narrowed enums. Adding optional
+// properties or enum values is allowed.
+func CheckCompatibility(previous, next *Schema) []string {
+	problems := make([]string, 0)
+	if previous.Topic != next.Topic {
+		problems = append(problems, fmt.Sprintf("$: topic changed from %q to %q", previous.Topic, next.Topic))
+	}
+	if previous.Enveloped() != next.Enveloped() {
+		problems = append(problems, "$: delivery format changed between enveloped and bare payload")
+	}
+	checkCompatibility("$", previous, next, &problems)
+	return problems
+}
+
+func checkCompatibility(path string, previous, next *Schema, problems *[]string) {
+	for _, t := range previous.Type {
+		if !next.Type.allows(t) {
+			*problems = append(*problems, fmt.Sprintf("%s: type %s is no longer allowed", path, t))
+		}
+	}
+
+	if len(next.Enum) > 0 {
+		for _, value := range previous.Enum {
+			if !inEnum(next.Enum, value) {
+				*problems = append(*problems, fmt.Sprintf("%s: enum value %v was removed", path, value))
+			}
+		}
+		if len(previous.Enum) == 0 {
+			*problems = append(*problems, fmt.Sprintf("%s: values are now restricted to an enum", path))
+		}
+	}
+
+	required := make(map[string]bool, len(next.Required))
+	for _, name := range next.Required {
+		required[name] = true
+	}
+	for _, name := range previous.Required {
+		if !required[name] {
+			*problems = append(*problems, fmt.Sprintf("%s: property %q is no longer required", path, name))
+		}
+	}
+
+	names := make([]string, 0, len(previous.Properties))
+	for name := range previous.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		nextProp, ok := next.Properties[name]
+		if !ok {
+			*problems = append(*problems, fmt.Sprintf("%s: property %q was removed", path, name))
+			continue
+		}
+		checkCompatibility(path+"."+name, previous.Properties[name], nextProp, problems)
+	}
+
+	if previous.Items != nil && next.Items != nil {
+		checkCompatibility(path+"[]", previous.Items, next.Items, problems)
+	}
+}
@@ -0,0 +1,164 @@
+// Package features provides feature flags and the capability document every service
+// serves at /capabilities, so clients can discover what a deployment supports
+// instead of probing for it.
+package features
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/healthcare-gitops/common/config"
+)
+
+// Flag declares a feature a service can turn on or off
+type Flag struct {
+	Name        string
+	Description string
+	Default     bool
+}
+
+// Feature is a flag's state in the capability document. Reason explains why a
+// feature is off when that is not simply its flag.
+type Feature struct {
+	Enabled     bool   `json:"enabled"`
+	Description string `json:"description,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+// Flags holds a service's feature flags
+type Flags struct {
+	mu       sync.RWMutex
+	features map[string]*Feature
+	// uses counts requests admitted by Require, by feature
+	uses map[string]*atomic.Int64
+}
+
+// EnvVar returns the environment variable that overrides a flag: FEATURE_ followed by
+// the name upper-cased, with dots and dashes as underscores (fpe -> FEATURE_FPE)
+func EnvVar(name string) string {
+	return "FEATURE_" + strings.NewReplacer(".", "_", "-", "_").Replace(strings.ToUpper(name))
+}
+
+// New creates a flag set from declarations, applying FEATURE_* overrides from the
+// environment
+func New(flags ...Flag) *Flags {
+	f := &Flags{features: make(map[string]*Feature, len(flags)), uses: make(map[string]*atomic.Int64, len(flags))}
+	for _, flag := range flags {
+		feature := &Feature{
+			Enabled:     config.GetEnvBool(EnvVar(flag.Name), flag.Default),
+			Description: flag.Description,
+		}
+		switch {
+		case !feature.Enabled && flag.Default:
+			feature.Reason = "disabled by " + EnvVar(flag.Name)
+		case !feature.Enabled:
+			feature.Reason = "off by default; set " + EnvVar(flag.Name) + "=true to enable"
+		}
+		f.features[flag.Name] = feature
+		f.uses[flag.Name] = new(atomic.Int64)
+	}
+	return f
+}
+
+// Enabled reports whether a feature is on. Undeclared features are off.
+func (f *Flags) Enabled(name string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	feature, ok := f.features[name]
+	return ok && feature.Enabled
+}
+
+// Unavailable turns off a feature whose flag is on but which cannot run, such as
+// one missing required configuration
+func (f *Flags) Unavailable(name, reason string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if feature, ok := f.features[name]; ok && feature.Enabled {
+		feature.Enabled, feature.Reason = false, reason
+	}
+}
+
+// Features returns a copy of every feature's state
+func (f *Flags) Features() map[string]Feature {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	out := make(map[string]Feature, len(f.features))
+	for name, feature := range f.features {
+		out[name] = *feature
+	}
+	return out
+}
+
+// Usage returns how many requests each declared feature has served since startup
+func (f *Flags) Usage() map[string]int64 {
+	out := make(map[string]int64, len(f.uses))
+	for name, n := range f.uses {
+		out[name] = n.Load()
+	}
+	return out
+}
+
+// Require guards a handler behind a feature, answering 404 while it is off so a
+// disabled feature looks the same as one the deployment never had. Requests it
+// admits are counted in Usage.
+func (f *Flags) Require(name string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !f.Enabled(name) {
+			http.Error(w, name+" is not enabled on this deployment", http.StatusNotFound)
+			return
+		}
+		if n, ok := f.uses[name]; ok {
+			n.Add(1)
+		}
+		next(w, r)
+	}
+}
+
+// Middleware is Require for routers that guard groups of routes
+func (f *Flags) Middleware(name string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return f.Require(name, next.ServeHTTP)
+	}
+}
+
+// Capabilities describes what a running service supports
+type Capabilities struct {
+	Service string `json:"service"`
+	// APIVersions lists the API versions served, e.g. v1
+	APIVersions []string `json:"api_versions"`
+	// SpecVersion is the version of the service's OpenAPI document
+	SpecVersion string             `json:"spec_version"`
+	Features    map[string]Feature `json:"features"`
+	// Limits are the numeric limits clients should stay within, by name
+	Limits map[string]int64 `json:"limits"`
+}
+
+// Capabilities builds the capability document from the current flag states
+func (f *Flags) Capabilities(service, specVersion string, apiVersions []string, limits map[string]int64) Capabilities {
+	versions := append([]string(nil), apiVersions...)
+	sort.Strings(versions)
+	if limits == nil {
+		limits = map[string]int64{}
+	}
+	return Capabilities{
+		Service:     service,
+		APIVersions: versions,
+		SpecVersion: specVersion,
+		Features:    f.Features(),
+		Limits:      limits,
+	}
+}
+
+// Handler serves the document returned by build. It is built per request, so
+// features turned off at runtime are reported immediately.
+func Handler(build func() Capabilities) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		json.NewEncoder(w).Encode(build())
+	}
+}
@@ -0,0 +1,282 @@
+// Package health answers readiness probes from checks of the dependencies a service
+// needs, such as its database, key store and the services it calls. Each check is
+// reported on its own, and a failing dependency either takes the service out of
+// rotation or only degrades it, so a probe says more than ready or not.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultTimeout bounds each check when the Check sets none
+const DefaultTimeout = 2 * time.Second
+
+// Status is a check's outcome
+type Status string
+
+const (
+	// StatusUp is a dependency that is working
+	StatusUp Status = "up"
+	// StatusDegraded is a dependency that is failing in a way the service can work
+	// around, with reduced function
+	StatusDegraded Status = "degraded"
+	// StatusDown is a dependency that is failing
+	StatusDown Status = "down"
+)
+
+// Overall statuses in a Report
+const (
+	Ready    = "ready"
+	Degraded = "degraded"
+	NotReady = "not ready"
+)
+
+// Check probes one dependency
+type Check struct {
+	Name string
+	// Critical checks take the service out of rotation when they fail. A failing
+	// check that is not critical only degrades the service: downstream services are
+	// usually not critical, so one outage does not cascade through every caller.
+	Critical bool
+	// Timeout bounds the probe. Defaults to DefaultTimeout.
+	Timeout time.Duration
+	// Probe returns nil when the dependency is working. An error marked by
+	// Degradation reports the check degraded even when it is critical.
+	Probe func(ctx context.Context) error
+}
+
+// degradedError marks a failure the service can work around
+type degradedError struct{ err error }
+
+func (e degradedError) Error() string { return e.err.Error() }
+func (e degradedError) Unwrap() error { return e.err }
+
+// Degradation marks err as a failure the service can work around, such as a key
+// store that is unreachable while the keys it served are still loaded
+func Degradation(err error) error {
+	if err == nil {
+		return nil
+	}
+	return degradedError{err}
+}
+
+// IsDegradation reports whether err was marked by Degradation
+func IsDegradation(err error) bool {
+	var d degradedError
+	return errors.As(err, &d)
+}
+
+// Result is one check's outcome in a Report
+type Result struct {
+	Status     Status  `json:"status"`
+	Critical   bool    `json:"critical"`
+	Error      string  `json:"error,omitempty"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+// Report is the answer to a readiness probe. Status is ready, degraded or not ready;
+// only not ready, when a critical check is down, sets Ready false.
+type Report struct {
+	Status    string            `json:"status"`
+	Ready     bool              `json:"ready"`
+	Service   string            `json:"service"`
+	Checks    map[string]Result `json:"checks"`
+	Timestamp time.Time         `json:"timestamp"`
+	// Details are service-specific facts reported alongside the checks
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// Checker runs a service's readiness checks
+type Checker struct {
+	Service string
+	Checks  []Check
+	// OnFailure, if set, is called with each check that is not up, for logs
+	OnFailure func(name string, status Status, err error)
+}
+
+// LogFailure logs a check that is not up, as a Checker's OnFailure
+func LogFailure(name string, status Status, err error) {
+	log.Warn().Err(err).Str("check", name).Str("status", string(status)).Msg("Readiness check failing")
+}
+
+// Run runs every check at once and reports their outcomes
+func (c Checker) Run(ctx context.Context) Report {
+	report := Report{
+		Status:    Ready,
+		Ready:     true,
+		Service:   c.Service,
+		Checks:    make(map[string]Result, len(c.Checks)),
+		Timestamp: time.Now().UTC(),
+	}
+	results := make([]Result, len(c.Checks))
+	errs := make([]error, len(c.Checks))
+	var wg sync.WaitGroup
+	for i, check := range c.Checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i], errs[i] = run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	for i, check := range c.Checks {
+		result := results[i]
+		report.Checks[check.Name] = result
+		switch result.Status {
+		case StatusDown:
+			report.Status, report.Ready = NotReady, false
+		case StatusDegraded:
+			if report.Ready {
+				report.Status = Degraded
+			}
+		}
+		if result.Status != StatusUp && c.OnFailure != nil {
+			c.OnFailure(check.Name, result.Status, errs[i])
+		}
+	}
+	return report
+}
+
+// run probes one dependency under its timeout
+func run(ctx context.Context, check Check) (Result, error) {
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Probe(ctx)
+	result := Result{
+		Status:     StatusUp,
+		Critical:   check.Critical,
+		DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	switch {
+	case err == nil:
+	case check.Critical && !IsDegradation(err):
+		result.Status, result.Error = StatusDown, err.Error()
+	default:
+		result.Status, result.Error = StatusDegraded, err.Error()
+	}
+	return result, err
+}
+
+// Write writes report as the response to a readiness probe: 200 while the service is
+// ready or degraded and 503 when it is not ready
+func Write(w http.ResponseWriter, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	if report.Ready {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(report)
+}
+
+// Handler serves the checker's report to readiness probes
+func (c Checker) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		Write(w, c.Run(r.Context()))
+	}
+}
+
+// HTTP probes a service's health endpoint at url, which is up when it answers 2xx
+func HTTP(client *http.Client, url string) func(ctx context.Context) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("%s answered %d", url, resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+// Endpoint returns the /health endpoint of the service serving serviceURL, e.g.
+// http://auth-service:8090/health for http://auth-service:8090/introspect
+func Endpoint(serviceURL string) (string, error) {
+	u, err := url.Parse(serviceURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("%q is not an absolute URL", serviceURL)
+	}
+	return u.Scheme + "://" + u.Host + "/health", nil
+}
+
+// Tracker follows work done in the background, such as exporting spans, whose
+// failures would otherwise only show up in logs. It reports degraded while the most
+// recent attempt failed. The zero value is ready to use.
+type Tracker struct {
+	mu       sync.Mutex
+	err      error
+	failedAt time.Time
+}
+
+// Record records an attempt's outcome
+func (t *Tracker) Record(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err != nil && t.err == nil {
+		t.failedAt = time.Now()
+	}
+	t.err = err
+}
+
+// Probe reports the last attempt's error, as a Degradation
+func (t *Tracker) Probe(context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err == nil {
+		return nil
+	}
+	return Degradation(fmt.Errorf("failing since %s: %w", t.failedAt.UTC().Format(time.RFC3339), t.err))
+}
+
+// SpanExporter exports batches of spans of type S; with S an OpenTelemetry
+// sdktrace.ReadOnlySpan it is an sdktrace.SpanExporter
+type SpanExporter[S any] interface {
+	ExportSpans(ctx context.Context, spans []S) error
+	Shutdown(ctx context.Context) error
+}
+
+// TrackedExporter records each span export's outcome in Tracker, so readiness
+// reports a collector that stopped taking spans. A TrackedExporter of
+// sdktrace.ReadOnlySpan is itself an sdktrace.SpanExporter.
+type TrackedExporter[S any] struct {
+	SpanExporter[S]
+	Tracker *Tracker
+}
+
+// ExportSpans exports spans and records the outcome
+func (e TrackedExporter[S]) ExportSpans(ctx context.Context, spans []S) error {
+	err := e.SpanExporter.ExportSpans(ctx, spans)
+	e.Tracker.Record(err)
+	return err
+}
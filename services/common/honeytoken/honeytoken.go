@@ -0,0 +1,383 @@
+// Package honeytoken plants decoy records whose access raises a critical security
+// alert. Decoys look like real identifiers but are never issued to anyone, so reading
+// one means a store has been enumerated or exfiltrated. Services register decoy values,
+// check the values their read paths return, and the registry routes alerts to the SOC.
+// Decoys are excluded from reports by checking IsDecoy before counting a record.
+package honeytoken
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/healthcare-gitops/common/config"
+)
+
+// Severity of every honeytoken alert; no legitimate caller reads a decoy
+const Severity = "critical"
+
+// Decoy kinds Generate produces
+const (
+	KindSSN       = "ssn"
+	KindPatientID = "patient_id"
+	KindMRN       = "mrn"
+	KindEmail     = "email"
+	KindName      = "name"
+)
+
+// Kinds lists the kinds Generate produces
+var Kinds = []string{KindSSN, KindPatientID, KindMRN, KindEmail, KindName}
+
+// maxAlerts bounds the alerts kept for querying; the SOC webhook receives every one
+const maxAlerts = 1000
+
+// ErrUnknownKind is returned by Generate for kinds it cannot produce
+var ErrUnknownKind = errors.New("unknown honeytoken kind")
+
+// Token is a registered decoy
+type Token struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	Value     string    `json:"value"`
+	Label     string    `json:"label,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Access describes the read that touched a decoy
+type Access struct {
+	Action    string `json:"action"`
+	Resource  string `json:"resource,omitempty"`
+	UserID    string `json:"user_id,omitempty"`
+	ClientIP  string `json:"client_ip,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Alert reports a decoy being read
+type Alert struct {
+	ID       string `json:"id"`
+	Service  string `json:"service"`
+	Severity string `json:"severity"`
+	TokenID  string `json:"token_id"`
+	Kind     string `json:"kind"`
+	Access
+	At time.Time `json:"at"`
+}
+
+// Config configures a Registry
+type Config struct {
+	Service string
+	// Path persists tokens as JSON so decoys stay detectable across restarts; empty
+	// keeps them in memory
+	Path string
+	// SOCWebhookURL receives each alert as a JSON POST; empty keeps alerts local
+	SOCWebhookURL string
+	// OnAlert, if set, is called for every alert, for logging and metrics
+	OnAlert func(Alert)
+	// OnNotifyError, if set, is called when an alert could not be sent to the SOC
+	OnNotifyError func(Alert, error)
+}
+
+// ConfigFromEnv reads HONEYTOKEN_PATH and SOC_ALERT_WEBHOOK_URL
+func ConfigFromEnv(service string) Config {
+	return Config{
+		Service:       service,
+		Path:          config.GetEnv("HONEYTOKEN_PATH", ""),
+		SOCWebhookURL: config.GetEnv("SOC_ALERT_WEBHOOK_URL", ""),
+	}
+}
+
+// Registry holds a service's decoys and the alerts raised for them. A nil Registry
+// holds no decoys, so stores built without one keep working.
+type Registry struct {
+	cfg    Config
+	client *http.Client
+	now    func() time.Time
+
+	mu      sync.RWMutex
+	tokens  map[string]Token // by value
+	order   []string         // values in creation order
+	alerts  []Alert
+	alertID int64
+	pending sync.WaitGroup
+}
+
+// Open creates a registry, loading the tokens persisted at cfg.Path
+func Open(cfg Config) (*Registry, error) {
+	r := &Registry{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 5 * time.Second},
+		now:    time.Now,
+		tokens: make(map[string]Token),
+	}
+	if cfg.Path == "" {
+		return r, nil
+	}
+	data, err := os.ReadFile(cfg.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read honeytokens: %w", err)
+	}
+	var tokens []Token
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("parse honeytokens %s: %w", cfg.Path, err)
+	}
+	for _, t := range tokens {
+		r.tokens[t.Value] = t
+		r.order = append(r.order, t.Value)
+	}
+	return r, nil
+}
+
+// Generate returns a fresh decoy value of kind. Decoy SSNs use area numbers 900-999,
+// which are never issued, and emails the reserved example.org domain, so a decoy
+// cannot collide with a real person.
+func Generate(kind string) (string, error) {
+	switch kind {
+	case KindSSN:
+		return fmt.Sprintf("9%s-%s-%s", digits(2), digits(2), digits(4)), nil
+	case KindPatientID:
+		return "PT-" + digits(8), nil
+	case KindMRN:
+		return "MRN" + digits(8), nil
+	case KindEmail:
+		first, last := pick(firstNames), pick(lastNames)
+		return fmt.Sprintf("%s.%s%s@example.org", strings.ToLower(first), strings.ToLower(last), digits(3)), nil
+	case KindName:
+		return pick(firstNames) + " " + pick(lastNames), nil
+	}
+	return "", fmt.Errorf("%w %q", ErrUnknownKind, kind)
+}
+
+var (
+	firstNames = []string{"Avery", "Jordan", "Morgan", "Riley", "Casey", "Quinn", "Harper", "Rowan", "Emerson", "Hayden"}
+	lastNames  = []string{"Whitfield", "Calloway", "Prescott", "Lindqvist", "Okafor", "Marchetti", "Delacroix", "Haverford", "Nakamura", "Ashby"}
+)
+
+func digits(n int) string {
+	var b []byte
+	for i := 0; i < n; i++ {
+		d, _ := rand.Int(rand.Reader, big.NewInt(10))
+		b = append(b, byte('0'+d.Int64()))
+	}
+	return string(b)
+}
+
+func pick(options []string) string {
+	i, _ := rand.Int(rand.Reader, big.NewInt(int64(len(options))))
+	return options[i.Int64()]
+}
+
+// Create generates and registers a decoy of kind
+func (r *Registry) Create(kind, label string) (Token, error) {
+	for {
+		value, err := Generate(kind)
+		if err != nil {
+			return Token{}, err
+		}
+		if _, taken := r.Match(value); taken {
+			continue
+		}
+		return r.Add(kind, value, label)
+	}
+}
+
+// Add registers value, created by the service itself, as a decoy of kind
+func (r *Registry) Add(kind, value, label string) (Token, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if t, ok := r.tokens[value]; ok {
+		return t, nil
+	}
+	t := Token{
+		ID:        "ht-" + digits(12),
+		Kind:      kind,
+		Value:     value,
+		Label:     label,
+		CreatedAt: r.now().UTC(),
+	}
+	r.tokens[value] = t
+	r.order = append(r.order, value)
+	if err := r.persistLocked(); err != nil {
+		delete(r.tokens, value)
+		r.order = r.order[:len(r.order)-1]
+		return Token{}, err
+	}
+	return t, nil
+}
+
+// persistLocked rewrites the token file
+func (r *Registry) persistLocked() error {
+	if r.cfg.Path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(r.tokensLocked(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(r.cfg.Path), "."+filepath.Base(r.cfg.Path)+".tmp")
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("write honeytokens: %w", err)
+	}
+	if err := os.Rename(tmp, r.cfg.Path); err != nil {
+		return fmt.Errorf("write honeytokens: %w", err)
+	}
+	return nil
+}
+
+func (r *Registry) tokensLocked() []Token {
+	tokens := make([]Token, 0, len(r.order))
+	for _, value := range r.order {
+		tokens = append(tokens, r.tokens[value])
+	}
+	return tokens
+}
+
+// Tokens returns every decoy, oldest first
+func (r *Registry) Tokens() []Token {
+	if r == nil {
+		return []Token{}
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.tokensLocked()
+}
+
+// Match returns the decoy registered for value
+func (r *Registry) Match(value string) (Token, bool) {
+	if r == nil || value == "" {
+		return Token{}, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.tokens[value]
+	return t, ok
+}
+
+// IsDecoy reports whether value is a decoy, for leaving decoys out of reports
+func (r *Registry) IsDecoy(value string) bool {
+	_, ok := r.Match(value)
+	return ok
+}
+
+// Check raises an alert if value is a decoy and reports whether it was
+func (r *Registry) Check(value string, access Access) bool {
+	t, ok := r.Match(value)
+	if ok {
+		r.Trip(t, access)
+	}
+	return ok
+}
+
+// Trip records an alert for an access to t and sends it to the SOC. The webhook is
+// called in the background so the caller sees no difference in latency.
+func (r *Registry) Trip(t Token, access Access) Alert {
+	r.mu.Lock()
+	r.alertID++
+	alert := Alert{
+		ID:       "hta-" + strconv.FormatInt(r.alertID, 10),
+		Service:  r.cfg.Service,
+		Severity: Severity,
+		TokenID:  t.ID,
+		Kind:     t.Kind,
+		Access:   access,
+		At:       r.now().UTC(),
+	}
+	r.alerts = append(r.alerts, alert)
+	if len(r.alerts) > maxAlerts {
+		r.alerts = r.alerts[len(r.alerts)-maxAlerts:]
+	}
+	r.mu.Unlock()
+
+	if r.cfg.OnAlert != nil {
+		r.cfg.OnAlert(alert)
+	}
+	if r.cfg.SOCWebhookURL != "" {
+		r.pending.Add(1)
+		go func() {
+			defer r.pending.Done()
+			if err := r.notify(alert); err != nil && r.cfg.OnNotifyError != nil {
+				r.cfg.OnNotifyError(alert, err)
+			}
+		}()
+	}
+	return alert
+}
+
+// notify posts alert to the SOC webhook
+func (r *Registry) notify(alert Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.cfg.SOCWebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("SOC webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Wait blocks until alerts being sent to the SOC are delivered or have failed
+func (r *Registry) Wait() {
+	if r != nil {
+		r.pending.Wait()
+	}
+}
+
+// Alerts returns up to limit alerts, newest first
+func (r *Registry) Alerts(limit int) []Alert {
+	if r == nil {
+		return []Alert{}
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	alerts := make([]Alert, 0, min(limit, len(r.alerts)))
+	for i := len(r.alerts) - 1; i >= 0 && len(alerts) < limit; i-- {
+		alerts = append(alerts, r.alerts[i])
+	}
+	return alerts
+}
+
+// AlertsHandler lists recent alerts, newest first, up to ?limit= (default 100)
+func (r *Registry) AlertsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		limit := 100
+		if value := req.URL.Query().Get("limit"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > maxAlerts {
+				http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxAlerts), http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		alerts := r.Alerts(limit)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"alerts": alerts,
+			"count":  len(alerts),
+		})
+	}
+}
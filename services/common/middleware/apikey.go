@@ -0,0 +1,167 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/healthcare-gitops/common/audit"
+	"github.com/healthcare-gitops/common/clientip"
+)
+
+// APIKeyIdentity is the caller an API key belongs to, as reported by auth-service
+type APIKeyIdentity struct {
+	KeyID  string   `json:"key_id"`
+	Name   string   `json:"name"`
+	UserID string   `json:"user_id"`
+	Role   string   `json:"role"`
+	Scopes []string `json:"scopes"`
+}
+
+// HasScope reports whether the key carries scope
+func (id APIKeyIdentity) HasScope(scope string) bool {
+	for _, s := range id.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type apiKeyContextKey struct{}
+
+// APIKeyFromContext returns the identity APIKeyAuth stored for the request
+func APIKeyFromContext(ctx context.Context) (APIKeyIdentity, bool) {
+	id, ok := ctx.Value(apiKeyContextKey{}).(APIKeyIdentity)
+	return id, ok
+}
+
+// APIKeyConfig configures APIKeyAuth
+type APIKeyConfig struct {
+	// IntrospectURL is auth-service's /apikey/introspect endpoint
+	IntrospectURL string
+	// Scope, when set, is required of every key
+	Scope string
+	// CacheTTL is how long a valid key's identity is reused without asking
+	// auth-service again, which bounds how long a revoked key keeps working. Defaults
+	// to 30 seconds; invalid keys are never cached.
+	CacheTTL   time.Duration
+	HTTPClient *http.Client
+}
+
+var (
+	// errAPIKeyRejected means auth-service reported the key inactive
+	errAPIKeyRejected = errors.New("API key rejected")
+	// errAPIKeyThrottled means auth-service is refusing the client after failed attempts
+	errAPIKeyThrottled = errors.New("API key attempts throttled")
+)
+
+type cachedAPIKey struct {
+	identity APIKeyIdentity
+	expires  time.Time
+}
+
+// APIKeyAuth authenticates callers by the key in their X-API-Key header, checked
+// against auth-service. Requests without a valid key get 401, keys lacking
+// cfg.Scope 403, and everything else reaches next with the key's identity in the
+// context and its ID as the actor of the request's audit event. The client's
+// address is forwarded so auth-service can lock out IPs that guess keys.
+func APIKeyAuth(cfg APIKeyConfig) func(http.Handler) http.Handler {
+	if cfg.CacheTTL <= 0 {
+		cfg.CacheTTL = 30 * time.Second
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Second}
+	}
+	var mu sync.Mutex
+	cache := make(map[string]cachedAPIKey)
+
+	lookup := func(r *http.Request, key string) (APIKeyIdentity, error) {
+		mu.Lock()
+		if cached, ok := cache[key]; ok && time.Now().Before(cached.expires) {
+			mu.Unlock()
+			return cached.identity, nil
+		}
+		mu.Unlock()
+
+		req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, cfg.IntrospectURL, nil)
+		if err != nil {
+			return APIKeyIdentity{}, err
+		}
+		req.Header.Set("X-API-Key", key)
+		req.Header.Set("X-Forwarded-For", clientip.ForwardedFor(r))
+		resp, err := client.Do(req)
+		if err != nil {
+			return APIKeyIdentity{}, fmt.Errorf("api key introspection: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusUnauthorized {
+			return APIKeyIdentity{}, errAPIKeyRejected
+		}
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return APIKeyIdentity{}, fmt.Errorf("%w: retry after %s seconds", errAPIKeyThrottled, resp.Header.Get("Retry-After"))
+		}
+		if resp.StatusCode != http.StatusOK {
+			return APIKeyIdentity{}, fmt.Errorf("api key introspection returned %s", resp.Status)
+		}
+		var body struct {
+			Active bool `json:"active"`
+			APIKeyIdentity
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			return APIKeyIdentity{}, fmt.Errorf("api key introspection: %w", err)
+		}
+		if !body.Active {
+			return APIKeyIdentity{}, errAPIKeyRejected
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		now := time.Now()
+		for k, cached := range cache {
+			if !now.Before(cached.expires) {
+				delete(cache, k)
+			}
+		}
+		cache[key] = cachedAPIKey{identity: body.APIKeyIdentity, expires: now.Add(cfg.CacheTTL)}
+		return body.APIKeyIdentity, nil
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get("X-API-Key")
+			if key == "" {
+				key, _ = strings.CutPrefix(r.Header.Get("Authorization"), "ApiKey ")
+			}
+			if key == "" {
+				http.Error(w, "API key required", http.StatusUnauthorized)
+				return
+			}
+			identity, err := lookup(r, key)
+			if errors.Is(err, errAPIKeyRejected) {
+				http.Error(w, "Invalid API key", http.StatusUnauthorized)
+				return
+			}
+			if errors.Is(err, errAPIKeyThrottled) {
+				http.Error(w, "Too many failed authentication attempts", http.StatusTooManyRequests)
+				return
+			}
+			if err != nil {
+				http.Error(w, "Authorization service unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			if cfg.Scope != "" && !identity.HasScope(cfg.Scope) {
+				http.Error(w, "API key lacks the "+cfg.Scope+" scope", http.StatusForbidden)
+				return
+			}
+			audit.SetActor(r.Context(), "apikey:"+identity.KeyID)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, identity)))
+		})
+	}
+}
@@ -5,8 +5,9 @@ package middleware
 
 import (
 	"net/http"
-	"os"
 	"strings"
+
+	"github.com/healthcare-gitops/common/config"
 )
 
 // CORSConfig holds CORS configuration
@@ -38,16 +39,19 @@ func DefaultCORSConfig() *CORSConfig {
 		},
 		ExposedHeaders: []string{
 			"X-Request-ID",
+			"X-RateLimit-Limit",
 			"X-RateLimit-Remaining",
+			"X-RateLimit-Reset",
+			"Retry-After",
 		},
 		AllowCredentials: false, // HIPAA: Don't send credentials cross-origin
 		MaxAge:           86400, // 24 hours
 	}
 }
 
-// getAllowedOrigins reads allowed origins from environment
+// getAllowedOrigins reads allowed origins from configuration
 func getAllowedOrigins() []string {
-	originsEnv := os.Getenv("CORS_ALLOWED_ORIGINS")
+	originsEnv := config.GetEnv("CORS_ALLOWED_ORIGINS", "")
 	if originsEnv == "" {
 		// Default: localhost only for development
 		return []string{
@@ -0,0 +1,385 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/healthcare-gitops/common/clientip"
+	"github.com/healthcare-gitops/common/config"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// DefaultRateLimitRPS is the sustained requests a second each caller may make
+	DefaultRateLimitRPS = 50
+	// DefaultRateLimitBurst is how many requests above the sustained rate a caller
+	// may make at once
+	DefaultRateLimitBurst = 100
+)
+
+// DefaultRateLimitExempt are paths never limited: probes and metrics scrapes
+var DefaultRateLimitExempt = []string{"/health", "/readiness", "/ready", "/metrics"}
+
+// DefaultRateLimitRedisTimeout bounds each Redis round trip, so a slow Redis delays
+// requests by little before limits fall back to memory
+const DefaultRateLimitRedisTimeout = 100 * time.Millisecond
+
+// rateLimitStoreRetry is how long a failed store is left alone before it is tried again
+const rateLimitStoreRetry = 5 * time.Second
+
+// RateLimitConfig configures a RateLimiter. Each caller gets a token bucket refilled
+// at RPS a second and holding up to Burst requests; an RPS of 0 turns limiting off.
+// Routes give matching requests their own bucket and limit, each written as
+// "[METHOD ]PATH=RPS:BURST", e.g. "POST /api/v1/decrypt=20:50". PATH matches the
+// request path segment by segment, as a prefix, and a * segment matches any one
+// segment. The longest matching route wins; of two routes with the same method and
+// path the later one.
+type RateLimitConfig struct {
+	RPS    float64
+	Burst  int
+	Routes []string
+	// Exempt paths are never limited
+	Exempt []string
+	// Service names the service in shared bucket keys, so services sharing a Redis
+	// keep their own limits
+	Service string
+	// RedisURL, if set, keeps buckets in Redis so every replica enforces the same
+	// limits: redis://[user:password@]host:port[/db], or rediss:// for TLS
+	RedisURL string
+	// RedisTimeout bounds each Redis round trip. Defaults to
+	// DefaultRateLimitRedisTimeout.
+	RedisTimeout time.Duration
+	// OnStoreError, if set, is called when Redis fails and limits fall back to each
+	// replica's memory; it is called again only after Redis has been used successfully
+	OnStoreError func(err error)
+	// Identify, if set, returns the user a request has been verified as, or "" when
+	// it has not, without calling out to auth-service. Verified users get their own
+	// buckets; other requests share their client IP's.
+	Identify func(r *http.Request) string
+	// TrustedProxies are the proxies whose X-Forwarded-For names the client IP
+	TrustedProxies clientip.TrustedProxies
+}
+
+// RateLimitConfigFromEnv reads RATE_LIMIT_RPS, RATE_LIMIT_BURST, RATE_LIMIT_ROUTES,
+// RATE_LIMIT_REDIS_URL and RATE_LIMIT_REDIS_TIMEOUT for service. routes are the
+// service's own route limits; RATE_LIMIT_ROUTES entries are added after them, so they
+// override a route with the same method and path.
+func RateLimitConfigFromEnv(service string, routes ...string) RateLimitConfig {
+	return RateLimitConfig{
+		RPS:          config.GetEnvFloat("RATE_LIMIT_RPS", DefaultRateLimitRPS),
+		Burst:        config.GetEnvInt("RATE_LIMIT_BURST", DefaultRateLimitBurst),
+		Routes:       append(append([]string(nil), routes...), config.GetEnvList("RATE_LIMIT_ROUTES", nil)...),
+		Exempt:       DefaultRateLimitExempt,
+		Service:      service,
+		RedisURL:     config.GetEnv("RATE_LIMIT_REDIS_URL", ""),
+		RedisTimeout: config.GetEnvDuration("RATE_LIMIT_REDIS_TIMEOUT", DefaultRateLimitRedisTimeout),
+	}
+}
+
+// ValidateRateLimitEnv checks the RATE_LIMIT_* settings, for services' startup
+// validation
+func ValidateRateLimitEnv(v *config.Validator) {
+	v.FloatRange("RATE_LIMIT_RPS", 0, 1_000_000)
+	v.IntRange("RATE_LIMIT_BURST", 1, 1_000_000)
+	v.DurationRange("RATE_LIMIT_REDIS_TIMEOUT", time.Millisecond, 10*time.Second)
+	for _, spec := range config.GetEnvList("RATE_LIMIT_ROUTES", nil) {
+		if _, err := parseRouteLimit(spec); err != nil {
+			v.Check(err)
+		}
+	}
+	if redisURL := config.GetEnv("RATE_LIMIT_REDIS_URL", ""); redisURL != "" {
+		if _, err := NewRedisRateLimitStore(redisURL, 0); err != nil {
+			v.Check(err)
+		}
+	}
+}
+
+// RateLimitStore keeps callers' token buckets
+type RateLimitStore interface {
+	// Take spends a token from the bucket key, which refills at rps tokens a second
+	// and holds up to burst, reporting whether there was one and how many remain
+	Take(ctx context.Context, key string, rps float64, burst int, now time.Time) (allowed bool, tokens float64, err error)
+}
+
+// routeLimit is a parsed RateLimitConfig route
+type routeLimit struct {
+	// name is the route's method and path, naming its buckets
+	name     string
+	method   string
+	segments []string
+	rps      float64
+	burst    int
+}
+
+func (rl routeLimit) matches(method string, segments []string) bool {
+	if rl.method != "" && rl.method != method || len(segments) < len(rl.segments) {
+		return false
+	}
+	for i, segment := range rl.segments {
+		if segment != "*" && segment != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// parseRouteLimit parses "[METHOD ]PATH=RPS:BURST"
+func parseRouteLimit(spec string) (routeLimit, error) {
+	route, limits, ok := strings.Cut(spec, "=")
+	rps, burst, hasBurst := strings.Cut(limits, ":")
+	if !ok || !hasBurst {
+		return routeLimit{}, fmt.Errorf("rate limit route %q: want [METHOD ]PATH=RPS:BURST", spec)
+	}
+	var rl routeLimit
+	route = strings.TrimSpace(route)
+	if method, path, hasMethod := strings.Cut(route, " "); hasMethod {
+		rl.method, route = strings.ToUpper(method), strings.TrimSpace(path)
+	}
+	if !strings.HasPrefix(route, "/") {
+		return routeLimit{}, fmt.Errorf("rate limit route %q: path must start with /", spec)
+	}
+	rl.segments = pathSegments(route)
+	perSecond, err := strconv.ParseFloat(strings.TrimSpace(rps), 64)
+	if err != nil || perSecond <= 0 {
+		return routeLimit{}, fmt.Errorf("rate limit route %q: requests per second must be a number above 0", spec)
+	}
+	if rl.burst, err = strconv.Atoi(strings.TrimSpace(burst)); err != nil || rl.burst < 1 {
+		return routeLimit{}, fmt.Errorf("rate limit route %q: burst must be a whole number above 0", spec)
+	}
+	rl.rps = perSecond
+	rl.name = strings.TrimSpace(rl.method + " /" + strings.Join(rl.segments, "/"))
+	return rl, nil
+}
+
+func pathSegments(path string) []string {
+	trimmed := strings.Trim(path, "/")
+	if trimmed == "" {
+		return nil
+	}
+	return strings.Split(trimmed, "/")
+}
+
+// visitor is one caller's bucket for the default limit or a route
+type visitor struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+	// refill is how long the bucket takes to fill from empty, after which forgetting
+	// the caller loses nothing
+	refill time.Duration
+}
+
+// memoryStore keeps buckets in the replica's memory, forgetting callers idle long
+// enough for their bucket to have refilled
+type memoryStore struct {
+	mu         sync.Mutex
+	visitors   map[string]*visitor
+	sweepEvery time.Duration
+	lastSweep  time.Time
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{visitors: make(map[string]*visitor), sweepEvery: time.Minute}
+}
+
+// Take spends a token from the bucket key, sweeping idle callers now and then
+func (s *memoryStore) Take(_ context.Context, key string, rps float64, burst int, now time.Time) (bool, float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastSweep) > s.sweepEvery {
+		for k, v := range s.visitors {
+			if now.Sub(v.lastSeen) > v.refill {
+				delete(s.visitors, k)
+			}
+		}
+		s.lastSweep = now
+	}
+	v, ok := s.visitors[key]
+	if !ok {
+		v = &visitor{
+			limiter: rate.NewLimiter(rate.Limit(rps), burst),
+			refill:  time.Duration(float64(burst) / rps * float64(time.Second)),
+		}
+		s.visitors[key] = v
+	}
+	v.lastSeen = now
+	allowed := v.limiter.AllowN(now, 1)
+	return allowed, v.limiter.TokensAt(now), nil
+}
+
+// RateLimiter limits each caller to a token bucket per route. Callers are told their
+// limit on every response in X-RateLimit-Limit, X-RateLimit-Remaining and
+// X-RateLimit-Reset, and refused requests get 429 with Retry-After.
+//
+// Buckets are kept in the replica's memory, or in Redis so limits hold across
+// replicas. While Redis is unavailable each replica falls back to its own buckets:
+// callers are still limited, though by each replica separately.
+type RateLimiter struct {
+	service string
+	rps     float64
+	burst   int
+	routes  []routeLimit
+	exempt  map[string]bool
+	now     func() time.Time
+
+	// store is the shared store, nil when buckets are only kept in memory
+	store        RateLimitStore
+	memory       *memoryStore
+	onStoreError func(err error)
+	identify     func(r *http.Request) string
+	proxies      clientip.TrustedProxies
+
+	mu sync.Mutex
+	// storeRetry is when the store is tried again after failing; zero while it works
+	storeRetry time.Time
+}
+
+// NewRateLimiter creates a limiter for cfg. It returns nil, which limits nothing,
+// when cfg.RPS is 0.
+func NewRateLimiter(cfg RateLimitConfig) (*RateLimiter, error) {
+	switch {
+	case cfg.RPS < 0:
+		return nil, fmt.Errorf("rate limit must not be negative, got %g", cfg.RPS)
+	case cfg.RPS == 0:
+		return nil, nil
+	case cfg.Burst < 1:
+		return nil, fmt.Errorf("rate limit burst must be at least 1, got %d", cfg.Burst)
+	}
+	rl := &RateLimiter{
+		service:      cfg.Service,
+		rps:          cfg.RPS,
+		burst:        cfg.Burst,
+		exempt:       make(map[string]bool),
+		now:          time.Now,
+		memory:       newMemoryStore(),
+		onStoreError: cfg.OnStoreError,
+		identify:     cfg.Identify,
+		proxies:      cfg.TrustedProxies,
+	}
+	if cfg.RedisURL != "" {
+		store, err := NewRedisRateLimitStore(cfg.RedisURL, cfg.RedisTimeout)
+		if err != nil {
+			return nil, err
+		}
+		rl.store = store
+	}
+	for _, spec := range cfg.Routes {
+		route, err := parseRouteLimit(spec)
+		if err != nil {
+			return nil, err
+		}
+		// A later route replaces an earlier one for the same method and path
+		replaced := false
+		for i, existing := range rl.routes {
+			if existing.name == route.name {
+				rl.routes[i], replaced = route, true
+			}
+		}
+		if !replaced {
+			rl.routes = append(rl.routes, route)
+		}
+	}
+	for _, path := range cfg.Exempt {
+		rl.exempt[path] = true
+	}
+	return rl, nil
+}
+
+// route returns the most specific route r matches, or nil for the default limit
+func (rl *RateLimiter) route(r *http.Request) *routeLimit {
+	segments := pathSegments(r.URL.Path)
+	best := -1
+	for i, route := range rl.routes {
+		if !route.matches(r.Method, segments) {
+			continue
+		}
+		if best < 0 || len(route.segments) > len(rl.routes[best].segments) ||
+			len(route.segments) == len(rl.routes[best].segments) && route.method != "" && rl.routes[best].method == "" {
+			best = i
+		}
+	}
+	if best < 0 {
+		return nil
+	}
+	return &rl.routes[best]
+}
+
+// take spends a token from the caller's bucket: in the shared store unless it failed
+// in the last few seconds, else in memory
+func (rl *RateLimiter) take(ctx context.Context, key string, rps float64, burst int, now time.Time) (bool, float64) {
+	if rl.store != nil {
+		rl.mu.Lock()
+		retry := rl.storeRetry
+		rl.mu.Unlock()
+		if !now.Before(retry) {
+			allowed, tokens, err := rl.store.Take(ctx, key, rps, burst, now)
+			rl.mu.Lock()
+			failing := !rl.storeRetry.IsZero()
+			if err != nil {
+				rl.storeRetry = now.Add(rateLimitStoreRetry)
+			} else {
+				rl.storeRetry = time.Time{}
+			}
+			rl.mu.Unlock()
+			if err == nil {
+				return allowed, tokens
+			}
+			if !failing && rl.onStoreError != nil {
+				rl.onStoreError(err)
+			}
+		}
+	}
+	allowed, tokens, _ := rl.memory.Take(ctx, key, rps, burst, now)
+	return allowed, tokens
+}
+
+// Middleware limits requests to next. A nil RateLimiter passes every request through.
+func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
+	if rl == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rl.exempt[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		now := rl.now()
+		name, limit, burst := "default", rl.rps, rl.burst
+		if route := rl.route(r); route != nil {
+			name, limit, burst = route.name, route.rps, route.burst
+		}
+		key := "ratelimit:" + rl.service + ":" + name + ":" + rl.identity(r)
+		allowed, tokens := rl.take(r.Context(), key, limit, burst, now)
+		refill := time.Duration((float64(burst) - tokens) / limit * float64(time.Second))
+
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(burst))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(int(math.Max(0, math.Floor(tokens)))))
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(now.Add(refill).Unix(), 10))
+		if !allowed {
+			wait := math.Ceil((1 - tokens) / limit)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Max(1, wait))))
+			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// identity names the caller a request is counted against: the user it has been
+// verified as, else its client IP. Claims a request makes about itself, such as the
+// subject of an unchecked token or X-Forwarded-For from an untrusted peer, are never
+// used, so a caller can neither buy fresh buckets nor drain someone else's.
+func (rl *RateLimiter) identity(r *http.Request) string {
+	if rl.identify != nil {
+		if user := rl.identify(r); user != "" {
+			return "user:" + user
+		}
+	}
+	return "ip:" + rl.proxies.ClientIP(r)
+}
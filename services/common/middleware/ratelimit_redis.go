@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// tokenBucketScript refills and spends a bucket atomically, so replicas sharing a
+// bucket never both spend its last token. The bucket is a hash of its tokens and when
+// they were counted, expiring once it would be full again. Tokens are returned as a
+// string because Redis truncates Lua numbers to integers.
+const tokenBucketScript = `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'at')
+local tokens = tonumber(bucket[1]) or burst
+local at = tonumber(bucket[2]) or now
+if now > at then
+  tokens = math.min(burst, tokens + (now - at) / 1000 * rate)
+  at = now
+end
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+redis.call('HMSET', KEYS[1], 'tokens', tostring(tokens), 'at', tostring(at))
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) / rate * 1000) + 1000)
+return {allowed, tostring(tokens)}
+`
+
+// tokenBucket is the bucket script, sent by its SHA1 once the server has it
+var tokenBucket = redis.NewScript(tokenBucketScript)
+
+// RedisRateLimitStore keeps token buckets in Redis, so every replica of a service
+// spends from the same buckets. Replicas pass their own clock to the bucket script,
+// so their clocks should agree to within a fraction of a second.
+type RedisRateLimitStore struct {
+	client *redis.Client
+}
+
+// NewRedisRateLimitStore creates a store for the server at rawURL:
+// redis://[user:password@]host:port[/db], or rediss:// to require TLS. timeout bounds
+// each round trip; 0 uses DefaultRateLimitRedisTimeout. Connections are opened on
+// first use.
+func NewRedisRateLimitStore(rawURL string, timeout time.Duration) (*RedisRateLimitStore, error) {
+	if timeout <= 0 {
+		timeout = DefaultRateLimitRedisTimeout
+	}
+	opts, err := redis.ParseURL(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("RATE_LIMIT_REDIS_URL: %w", err)
+	}
+	// A failed round trip falls back to memory at once rather than being retried
+	opts.DialTimeout, opts.ReadTimeout, opts.WriteTimeout = timeout, timeout, timeout
+	opts.MaxRetries = -1
+	return &RedisRateLimitStore{client: redis.NewClient(opts)}, nil
+}
+
+// Take spends a token from the bucket key in Redis. A caller hanging up does not cut
+// the round trip short, so it is not mistaken for Redis failing.
+func (s *RedisRateLimitStore) Take(ctx context.Context, key string, rps float64, burst int, now time.Time) (bool, float64, error) {
+	reply, err := tokenBucket.Run(context.WithoutCancel(ctx), s.client, []string{key},
+		strconv.FormatFloat(rps, 'g', -1, 64),
+		strconv.Itoa(burst),
+		strconv.FormatInt(now.UnixMilli(), 10),
+	).Result()
+	if err != nil {
+		return false, 0, fmt.Errorf("redis rate limit: %w", err)
+	}
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 2 {
+		return false, 0, fmt.Errorf("redis rate limit: unexpected reply %v", reply)
+	}
+	allowed, _ := values[0].(int64)
+	remaining, _ := values[1].(string)
+	tokens, err := strconv.ParseFloat(remaining, 64)
+	if err != nil {
+		return false, 0, fmt.Errorf("redis rate limit: unexpected token count %q", remaining)
+	}
+	return allowed == 1, tokens, nil
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestMemoryStoreKeepsSlowBuckets verifies a caller limited to one request every ten
+// minutes is not forgotten, and so refilled, before its bucket has refilled
+func TestMemoryStoreKeepsSlowBuckets(t *testing.T) {
+	store := newMemoryStore()
+	ctx, start := context.Background(), time.Now()
+	take := func(after time.Duration) bool {
+		allowed, _, _ := store.Take(ctx, "ratelimit:test:default:ip:192.0.2.1", 1.0/600, 1, start.Add(after))
+		return allowed
+	}
+
+	if !take(0) {
+		t.Fatal("first request refused")
+	}
+	if take(6 * time.Minute) {
+		t.Fatal("request allowed before the bucket refilled")
+	}
+	if !take(16 * time.Minute) {
+		t.Fatal("request refused after the bucket refilled")
+	}
+
+	store.Take(ctx, "ratelimit:test:default:ip:192.0.2.2", 1.0/600, 1, start.Add(40*time.Minute))
+	if _, ok := store.visitors["ratelimit:test:default:ip:192.0.2.1"]; ok {
+		t.Fatal("caller idle past its refill time was not forgotten")
+	}
+}
@@ -7,10 +7,7 @@ import (
 	"context"
 	"io"
 	"net/http"
-	"sync"
 	"time"
-
-	"golang.org/x/time/rate"
 )
 
 // MaxRequestSize limits the maximum size of request bodies (10MB default)
@@ -58,82 +55,6 @@ func ContentTypeValidator(allowedTypes ...string) func(http.Handler) http.Handle
 	}
 }
 
-// RateLimiter implements token bucket rate limiting per IP address
-type RateLimiter struct {
-	visitors map[string]*rate.Limiter
-	mu       sync.RWMutex
-	rate     rate.Limit
-	burst    int
-	cleanup  time.Duration
-}
-
-// NewRateLimiter creates a new rate limiter
-// rps: requests per second allowed
-// burst: maximum burst size
-func NewRateLimiter(rps int, burst int) *RateLimiter {
-	rl := &RateLimiter{
-		visitors: make(map[string]*rate.Limiter),
-		rate:     rate.Limit(rps),
-		burst:    burst,
-		cleanup:  5 * time.Minute,
-	}
-
-	// Start cleanup goroutine
-	go rl.cleanupVisitors()
-
-	return rl
-}
-
-// getVisitor returns the rate limiter for the given IP
-func (rl *RateLimiter) getVisitor(ip string) *rate.Limiter {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-
-	limiter, exists := rl.visitors[ip]
-	if !exists {
-		limiter = rate.NewLimiter(rl.rate, rl.burst)
-		rl.visitors[ip] = limiter
-	}
-
-	return limiter
-}
-
-// cleanupVisitors removes old entries to prevent memory leaks
-func (rl *RateLimiter) cleanupVisitors() {
-	ticker := time.NewTicker(rl.cleanup)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		rl.mu.Lock()
-		for ip, limiter := range rl.visitors {
-			// Remove if no tokens consumed in last cleanup period
-			if limiter.Tokens() >= float64(rl.burst) {
-				delete(rl.visitors, ip)
-			}
-		}
-		rl.mu.Unlock()
-	}
-}
-
-// Middleware returns a rate limiting middleware
-func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Extract IP (consider X-Forwarded-For for load balancers)
-		ip := r.RemoteAddr
-		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
-			ip = forwarded
-		}
-
-		limiter := rl.getVisitor(ip)
-		if !limiter.Allow() {
-			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
-			return
-		}
-
-		next.ServeHTTP(w, r)
-	})
-}
-
 // TimeoutMiddleware adds context timeout to all requests
 func TimeoutMiddleware(timeout time.Duration) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -0,0 +1,101 @@
+// Command obsgen writes Prometheus alerting rules and Grafana dashboards generated from
+// service observability specs. Each argument is a spec file or the URL of a running
+// service's /admin/observability/spec, fetched with the admin bearer token in
+// OBSGEN_TOKEN; with no arguments it regenerates every spec already committed under
+// -out. With -check it fails instead of writing when the committed output is stale.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/healthcare-gitops/common/config"
+	"github.com/healthcare-gitops/common/observability"
+)
+
+func main() {
+	out := flag.String("out", "observability/generated", "directory the per-service output is written under")
+	check := flag.Bool("check", false, "fail if generated files are out of date instead of writing them")
+	flag.Parse()
+
+	sources := flag.Args()
+	if len(sources) == 0 {
+		committed, err := filepath.Glob(filepath.Join(*out, "*", "spec.json"))
+		if err != nil {
+			fail("listing specs: %v", err)
+		}
+		if len(committed) == 0 {
+			fail("no specs under %s; pass spec files or URLs", *out)
+		}
+		sources = committed
+	}
+
+	stale := false
+	for _, source := range sources {
+		spec, err := loadSpec(source)
+		if err != nil {
+			fail("loading %s: %v", source, err)
+		}
+		dir := filepath.Join(*out, spec.Service)
+		if *check {
+			if err := observability.Check(dir, spec); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v; run obsgen\n", spec.Service, err)
+				stale = true
+			}
+			continue
+		}
+		if err := observability.Write(dir, spec); err != nil {
+			fail("writing %s: %v", dir, err)
+		}
+	}
+	if stale {
+		os.Exit(1)
+	}
+}
+
+func loadSpec(source string) (observability.Spec, error) {
+	var spec observability.Spec
+	var data []byte
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		req, err := http.NewRequest(http.MethodGet, source, nil)
+		if err != nil {
+			return spec, err
+		}
+		if token := config.GetEnv("OBSGEN_TOKEN", ""); token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		client := &http.Client{Timeout: 10 * time.Second}
+		resp, err := client.Do(req)
+		if err != nil {
+			return spec, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return spec, fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		if data, err = io.ReadAll(resp.Body); err != nil {
+			return spec, err
+		}
+	} else {
+		var err error
+		if data, err = os.ReadFile(source); err != nil {
+			return spec, err
+		}
+	}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return spec, err
+	}
+	return spec, spec.Validate()
+}
+
+func fail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "obsgen: "+format+"\n", args...)
+	os.Exit(1)
+}
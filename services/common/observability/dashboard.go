@@ -0,0 +1,201 @@
+package observability
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// object is a JSON object in the dashboard model; maps marshal with sorted keys, which
+// keeps the output stable
+type object = map[string]any
+
+const (
+	panelWidth  = 12
+	panelHeight = 8
+)
+
+// dashboardLayout places panels two to a row under collapsible row headers
+type dashboardLayout struct {
+	panels []object
+	nextID int
+	x, y   int
+}
+
+func (l *dashboardLayout) row(title string) {
+	if l.x != 0 {
+		l.y += panelHeight
+		l.x = 0
+	}
+	l.nextID++
+	l.panels = append(l.panels, object{
+		"collapsed": false,
+		"gridPos":   object{"h": 1, "w": 24, "x": 0, "y": l.y},
+		"id":        l.nextID,
+		"panels":    []object{},
+		"title":     title,
+		"type":      "row",
+	})
+	l.y++
+}
+
+func (l *dashboardLayout) add(panel object) {
+	l.nextID++
+	panel["id"] = l.nextID
+	panel["datasource"] = "Prometheus"
+	panel["gridPos"] = object{"h": panelHeight, "w": panelWidth, "x": l.x, "y": l.y}
+	l.panels = append(l.panels, panel)
+	l.x += panelWidth
+	if l.x >= 24 {
+		l.x = 0
+		l.y += panelHeight
+	}
+}
+
+// Dashboard renders the spec as a Grafana dashboard: one row with the SLIs and burn
+// rates of each SLO, and one with a panel per declared metric
+func Dashboard(spec Spec) ([]byte, error) {
+	var layout dashboardLayout
+
+	if len(spec.SLOs) > 0 {
+		layout.row("Service Level Objectives")
+		for _, slo := range spec.SLOs {
+			selector := sloSelector(spec, slo)
+			layout.add(object{
+				"title":       fmt.Sprintf("%s SLI (1d)", slo.Name),
+				"description": fmt.Sprintf("%s. Objective: %s.", slo.Description, formatPercent(slo.Objective)),
+				"type":        "stat",
+				"fieldConfig": object{
+					"defaults": object{
+						"unit":     "percentunit",
+						"decimals": 3,
+						"thresholds": object{
+							"mode": "absolute",
+							"steps": []object{
+								{"color": "red", "value": nil},
+								{"color": "green", "value": slo.Objective},
+							},
+						},
+					},
+					"overrides": []object{},
+				},
+				"targets": []object{
+					target("1 - "+sliRecord("1d")+selector, "SLI", "A"),
+				},
+			})
+			budget := "(1 - " + formatFloat(slo.Objective) + ")"
+			layout.add(object{
+				"title":       fmt.Sprintf("%s error budget burn rate", slo.Name),
+				"description": "How many times faster than allowed the error budget is being spent; 1 spends it exactly over 30 days.",
+				"type":        "timeseries",
+				"fieldConfig": object{
+					"defaults":  object{"unit": "short"},
+					"overrides": []object{},
+				},
+				"targets": []object{
+					target(sliRecord("1h")+selector+" / "+budget, "1h", "A"),
+					target(sliRecord("6h")+selector+" / "+budget, "6h", "B"),
+					target(sliRecord("3d")+selector+" / "+budget, "3d", "C"),
+				},
+			})
+		}
+	}
+
+	layout.row("Metrics")
+	for _, m := range spec.Metrics {
+		layout.add(metricPanel(m))
+	}
+
+	dashboard := object{
+		"annotations":   object{"list": []object{}},
+		"editable":      false,
+		"graphTooltip":  0,
+		"id":            nil,
+		"links":         []object{},
+		"panels":        layout.panels,
+		"refresh":       "30s",
+		"schemaVersion": 27,
+		"style":         "dark",
+		"tags":          []string{"healthcare-gitops", spec.Service, "generated"},
+		"templating":    object{"list": []object{}},
+		"time":          object{"from": "now-6h", "to": "now"},
+		"timezone":      "",
+		"title":         fmt.Sprintf("%s (generated)", spec.Service),
+		"uid":           spec.Service + "-generated",
+		"version":       1,
+	}
+	data, err := json.MarshalIndent(dashboard, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// metricPanel graphs a metric the way its type is usually read: counters as rates,
+// gauges as values and histograms as quantiles, split by GroupBy when set
+func metricPanel(m Metric) object {
+	by := ""
+	legend := ""
+	if m.GroupBy != "" {
+		by = " by (" + m.GroupBy + ")"
+		legend = "{{" + m.GroupBy + "}}"
+	}
+	unit := "short"
+	if strings.HasSuffix(m.Name, "_seconds") {
+		unit = "s"
+	}
+
+	var targets []object
+	switch m.Type {
+	case Counter:
+		unit = "ops"
+		targets = append(targets, target(fmt.Sprintf("sum%s (rate(%s[$__rate_interval]))", by, m.Name), legendOr(legend, "rate"), "A"))
+	case Gauge:
+		// Gauges are only summed when grouped; otherwise each series is plotted as is
+		expr := m.Name
+		if m.GroupBy != "" {
+			expr = fmt.Sprintf("sum%s (%s)", by, m.Name)
+		}
+		targets = append(targets, target(expr, legend, "A"))
+	case Histogram:
+		le := "le"
+		if m.GroupBy != "" {
+			le = "le, " + m.GroupBy
+		}
+		for i, q := range []struct{ quantile, name string }{{"0.5", "p50"}, {"0.95", "p95"}, {"0.99", "p99"}} {
+			name := q.name
+			if legend != "" {
+				name = legend + " " + name
+			}
+			targets = append(targets, target(
+				fmt.Sprintf("histogram_quantile(%s, sum by (%s) (rate(%s_bucket[$__rate_interval])))", q.quantile, le, m.Name),
+				name, string(rune('A'+i))))
+		}
+	}
+
+	return object{
+		"title":       m.Name,
+		"description": m.Help,
+		"type":        "timeseries",
+		"fieldConfig": object{
+			"defaults":  object{"unit": unit},
+			"overrides": []object{},
+		},
+		"targets": targets,
+	}
+}
+
+func target(expr, legend, refID string) object {
+	return object{
+		"expr":         expr,
+		"legendFormat": legend,
+		"refId":        refID,
+	}
+}
+
+func legendOr(legend, fallback string) string {
+	if legend != "" {
+		return legend
+	}
+	return fallback
+}
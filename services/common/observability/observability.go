@@ -0,0 +1,240 @@
+// Package observability generates Prometheus alerting rules and Grafana dashboards from
+// the metrics and SLOs a service declares, so they cannot drift from the code. Each
+// service serves its spec and the generated output under /admin/observability/, and
+// cmd/obsgen writes the output to observability/generated for deployment.
+package observability
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Metric types
+const (
+	Counter   = "counter"
+	Gauge     = "gauge"
+	Histogram = "histogram"
+)
+
+var (
+	metricNamePattern = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	sloNamePattern    = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+)
+
+// Metric declares a metric the service exports
+type Metric struct {
+	Name   string   `json:"name"`
+	Type   string   `json:"type"`
+	Help   string   `json:"help"`
+	Labels []string `json:"labels,omitempty"`
+	// GroupBy is the label the dashboard panel aggregates by; when empty counters and
+	// histograms are aggregated into one series and gauges are plotted per series
+	GroupBy string `json:"group_by,omitempty"`
+}
+
+// SLO declares a service level objective over one of the service's metrics. An
+// availability SLO counts events matching ErrorFilter as bad; a latency SLO counts
+// events slower than LatencyThreshold, which must be one of the histogram's bucket
+// bounds.
+type SLO struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Objective   float64 `json:"objective"`
+	Metric      string  `json:"metric"`
+	// Filter selects the events the SLO covers, as PromQL label matchers
+	Filter           string  `json:"filter,omitempty"`
+	ErrorFilter      string  `json:"error_filter,omitempty"`
+	LatencyThreshold float64 `json:"latency_threshold_seconds,omitempty"`
+}
+
+// Spec is everything a service declares about its telemetry
+type Spec struct {
+	Service string   `json:"service"`
+	Team    string   `json:"team,omitempty"`
+	Metrics []Metric `json:"metrics"`
+	SLOs    []SLO    `json:"slos,omitempty"`
+}
+
+// Metric returns the declared metric with the given name
+func (s Spec) Metric(name string) (Metric, bool) {
+	for _, m := range s.Metrics {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return Metric{}, false
+}
+
+// Validate checks the spec is complete and its SLOs refer to suitable metrics
+func (s Spec) Validate() error {
+	if s.Service == "" {
+		return errors.New("service is required")
+	}
+	seen := make(map[string]bool)
+	for _, m := range s.Metrics {
+		if !metricNamePattern.MatchString(m.Name) {
+			return fmt.Errorf("metric %q: invalid name", m.Name)
+		}
+		if seen[m.Name] {
+			return fmt.Errorf("metric %q: declared twice", m.Name)
+		}
+		seen[m.Name] = true
+		if m.Type != Counter && m.Type != Gauge && m.Type != Histogram {
+			return fmt.Errorf("metric %q: type must be counter, gauge or histogram", m.Name)
+		}
+		if m.Help == "" {
+			return fmt.Errorf("metric %q: help is required", m.Name)
+		}
+		if m.GroupBy != "" && !contains(m.Labels, m.GroupBy) {
+			return fmt.Errorf("metric %q: group_by %q is not one of its labels", m.Name, m.GroupBy)
+		}
+	}
+	seenSLOs := make(map[string]bool)
+	for _, slo := range s.SLOs {
+		if !sloNamePattern.MatchString(slo.Name) {
+			return fmt.Errorf("slo %q: invalid name", slo.Name)
+		}
+		if seenSLOs[slo.Name] {
+			return fmt.Errorf("slo %q: declared twice", slo.Name)
+		}
+		seenSLOs[slo.Name] = true
+		if slo.Objective <= 0 || slo.Objective >= 1 {
+			return fmt.Errorf("slo %q: objective must be between 0 and 1", slo.Name)
+		}
+		m, ok := s.Metric(slo.Metric)
+		if !ok {
+			return fmt.Errorf("slo %q: metric %q is not declared", slo.Name, slo.Metric)
+		}
+		switch {
+		case (slo.ErrorFilter == "") == (slo.LatencyThreshold == 0):
+			return fmt.Errorf("slo %q: set exactly one of error_filter and latency_threshold_seconds", slo.Name)
+		case slo.LatencyThreshold > 0 && m.Type != Histogram:
+			return fmt.Errorf("slo %q: latency SLOs need a histogram", slo.Name)
+		case m.Type == Gauge:
+			return fmt.Errorf("slo %q: availability SLOs need a counter or histogram", slo.Name)
+		}
+	}
+	return nil
+}
+
+// CheckRegistered compares the spec with the service's registered metrics: describe
+// reports whether a declared metric is registered with the same type, help and labels,
+// and registered lists the names of metrics the service exports
+func (s Spec) CheckRegistered(describe func(Metric) error, registered []string) error {
+	var problems []string
+	for _, m := range s.Metrics {
+		if err := describe(m); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", m.Name, err))
+		}
+	}
+	for _, name := range registered {
+		if _, ok := s.Metric(name); !ok {
+			problems = append(problems, fmt.Sprintf("%s: exported but not declared", name))
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Files renders the spec into the files cmd/obsgen writes, by file name. The spec itself
+// is included so the output can be regenerated without the service running.
+func Files(spec Spec) (map[string][]byte, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", spec.Service, err)
+	}
+	dashboard, err := Dashboard(spec)
+	if err != nil {
+		return nil, err
+	}
+	specJSON, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return map[string][]byte{
+		"spec.json":      append(specJSON, '\n'),
+		"rules.yaml":     Rules(spec),
+		"dashboard.json": dashboard,
+	}, nil
+}
+
+// Write renders the spec into dir
+func Write(dir string, spec Spec) error {
+	files, err := Files(spec)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Check reports which files in dir differ from what the spec renders to
+func Check(dir string, spec Spec) error {
+	files, err := Files(spec)
+	if err != nil {
+		return err
+	}
+	var stale []string
+	for name, data := range files {
+		current, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || !bytes.Equal(current, data) {
+			stale = append(stale, filepath.Join(dir, name))
+		}
+	}
+	if len(stale) > 0 {
+		sort.Strings(stale)
+		return fmt.Errorf("out of date: %s", strings.Join(stale, ", "))
+	}
+	return nil
+}
+
+// Handler serves the spec and its generated output at <prefix>/spec, <prefix>/rules
+// and <prefix>/dashboard, whatever prefix it is mounted under
+func Handler(spec Spec) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		files, err := Files(spec)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		switch path.Base(r.URL.Path) {
+		case "spec":
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(spec)
+		case "rules":
+			w.Header().Set("Content-Type", "application/yaml")
+			w.Write(files["rules.yaml"])
+		case "dashboard":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(files["dashboard.json"])
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,165 @@
+package observability
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// header marks generated files so they are not edited by hand
+const header = "# Code generated by obsgen from the %s observability spec; DO NOT EDIT.\n"
+
+// windows are the rate windows the error-ratio recording rules cover
+var windows = []string{"5m", "30m", "1h", "2h", "6h", "1d", "3d"}
+
+// burnRateAlert pages when the error budget burns burnRate times faster than the SLO
+// allows over both windows; the short window makes the alert reset quickly once the
+// burn stops
+type burnRateAlert struct {
+	burnRate    float64
+	long, short string
+	forDuration string
+	severity    string
+}
+
+// burnRateAlerts are the multiwindow alerts from the SRE workbook: 2% of a 30-day
+// budget in an hour and 5% in six hours page, 10% in a day and 10% in three days open
+// a ticket
+var burnRateAlerts = []burnRateAlert{
+	{burnRate: 14.4, long: "1h", short: "5m", forDuration: "2m", severity: "critical"},
+	{burnRate: 6, long: "6h", short: "30m", forDuration: "15m", severity: "critical"},
+	{burnRate: 3, long: "1d", short: "2h", forDuration: "1h", severity: "warning"},
+	{burnRate: 1, long: "3d", short: "6h", forDuration: "3h", severity: "warning"},
+}
+
+// Rules renders the spec's SLOs as Prometheus recording and alerting rules
+func Rules(spec Spec) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, header, spec.Service)
+	if len(spec.SLOs) == 0 {
+		b.WriteString("groups: []\n")
+		return []byte(b.String())
+	}
+
+	b.WriteString("groups:\n")
+	fmt.Fprintf(&b, "  - name: %s-slo-recording\n", spec.Service)
+	b.WriteString("    rules:\n")
+	for _, slo := range spec.SLOs {
+		for _, window := range windows {
+			fmt.Fprintf(&b, "      - record: %s\n", sliRecord(window))
+			fmt.Fprintf(&b, "        expr: %s\n", quote(errorRatio(spec, slo, window)))
+			b.WriteString("        labels:\n")
+			fmt.Fprintf(&b, "          service: %s\n", quote(spec.Service))
+			fmt.Fprintf(&b, "          slo: %s\n", quote(slo.Name))
+		}
+	}
+
+	fmt.Fprintf(&b, "  - name: %s-slo-alerts\n", spec.Service)
+	b.WriteString("    rules:\n")
+	for _, slo := range spec.SLOs {
+		selector := sloSelector(spec, slo)
+		budget := "(1 - " + formatFloat(slo.Objective) + ")"
+		for _, alert := range burnRateAlerts {
+			threshold := fmt.Sprintf("(%s * %s)", formatFloat(alert.burnRate), budget)
+			fmt.Fprintf(&b, "      - alert: %s\n", alertName(spec.Service, slo.Name))
+			b.WriteString("        expr: |\n")
+			fmt.Fprintf(&b, "          %s%s > %s\n", sliRecord(alert.long), selector, threshold)
+			b.WriteString("          and\n")
+			fmt.Fprintf(&b, "          %s%s > %s\n", sliRecord(alert.short), selector, threshold)
+			fmt.Fprintf(&b, "        for: %s\n", alert.forDuration)
+			b.WriteString("        labels:\n")
+			fmt.Fprintf(&b, "          severity: %s\n", alert.severity)
+			fmt.Fprintf(&b, "          team: %s\n", quote(team(spec)))
+			fmt.Fprintf(&b, "          service: %s\n", quote(spec.Service))
+			fmt.Fprintf(&b, "          slo: %s\n", quote(slo.Name))
+			fmt.Fprintf(&b, "          window: %s\n", quote(alert.long))
+			b.WriteString("        annotations:\n")
+			fmt.Fprintf(&b, "          summary: %s\n", quote(fmt.Sprintf("%s %s SLO is burning its error budget", spec.Service, slo.Name)))
+			fmt.Fprintf(&b, "          description: %s\n", quote(fmt.Sprintf(
+				"%s (objective %s) has burned error budget %sx faster than allowed over the last %s and %s.",
+				slo.Description, formatPercent(slo.Objective), formatFloat(alert.burnRate), alert.long, alert.short)))
+		}
+	}
+	return []byte(b.String())
+}
+
+// errorRatio is the PromQL for the fraction of the SLO's events that were bad over window
+func errorRatio(spec Spec, slo SLO, window string) string {
+	m, _ := spec.Metric(slo.Metric)
+	total := slo.Metric
+	if m.Type == Histogram {
+		total += "_count"
+	}
+	all := fmt.Sprintf("sum(rate(%s%s[%s]))", total, matchers(slo.Filter), window)
+	if slo.LatencyThreshold > 0 {
+		fast := fmt.Sprintf("sum(rate(%s_bucket%s[%s]))", slo.Metric,
+			matchers(slo.Filter, fmt.Sprintf("le=%q", formatFloat(slo.LatencyThreshold))), window)
+		return fmt.Sprintf("1 - (%s / %s)", fast, all)
+	}
+	bad := fmt.Sprintf("sum(rate(%s%s[%s]))", total, matchers(slo.Filter, slo.ErrorFilter), window)
+	return fmt.Sprintf("%s / %s", bad, all)
+}
+
+func sliRecord(window string) string {
+	return "slo:sli_error:ratio_rate" + window
+}
+
+func sloSelector(spec Spec, slo SLO) string {
+	return fmt.Sprintf("{service=%q,slo=%q}", spec.Service, slo.Name)
+}
+
+func matchers(parts ...string) string {
+	var nonEmpty []string
+	for _, p := range parts {
+		if p != "" {
+			nonEmpty = append(nonEmpty, p)
+		}
+	}
+	if len(nonEmpty) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(nonEmpty, ",") + "}"
+}
+
+// alertName joins the service and SLO names in CamelCase, as the hand-written rules do
+func alertName(service, slo string) string {
+	return camel(service) + camel(slo) + "ErrorBudgetBurn"
+}
+
+func camel(s string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range s {
+		if r == '-' || r == '_' || r == ' ' {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func team(spec Spec) string {
+	if spec.Team != "" {
+		return spec.Team
+	}
+	return "sre"
+}
+
+// quote renders s as a YAML double-quoted scalar
+func quote(s string) string {
+	return strconv.Quote(s)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func formatPercent(v float64) string {
+	return strconv.FormatFloat(v*100, 'f', -1, 64) + "%"
+}
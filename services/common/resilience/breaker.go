@@ -0,0 +1,196 @@
+package resilience
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultFailureThreshold is how many failures in a row open a breaker
+	DefaultFailureThreshold = 5
+	// DefaultOpenTimeout is how long an open breaker refuses calls before letting one
+	// through to test the dependency
+	DefaultOpenTimeout = 30 * time.Second
+)
+
+// ErrOpen is returned for calls an open breaker refuses without making
+var ErrOpen = errors.New("circuit breaker open")
+
+// State is a breaker's state. Its value is what breaker state gauges report.
+type State int
+
+const (
+	// Closed lets calls through and counts their failures
+	Closed State = iota
+	// HalfOpen lets one trial call through; its result closes or reopens the breaker
+	HalfOpen
+	// Open refuses calls until its timeout has passed
+	Open
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case HalfOpen:
+		return "half_open"
+	case Open:
+		return "open"
+	}
+	return "unknown"
+}
+
+// BreakerConfig configures a Breaker
+type BreakerConfig struct {
+	// FailureThreshold is how many failures in a row open the breaker. Defaults to
+	// DefaultFailureThreshold.
+	FailureThreshold int
+	// OpenTimeout is how long the breaker stays open. Defaults to DefaultOpenTimeout.
+	OpenTimeout time.Duration
+	// OnStateChange, if set, is called with the breaker's name and state when it is
+	// created and whenever its state changes, for metrics and logs
+	OnStateChange func(name string, state State)
+}
+
+// Breaker stops calls to a dependency that keeps failing, so callers fail fast
+// instead of queueing behind timeouts and the dependency gets room to recover. After
+// FailureThreshold failures in a row it opens and refuses calls with ErrOpen; after
+// OpenTimeout it lets a single trial call through, closing again if that succeeds.
+// A nil Breaker lets every call through.
+type Breaker struct {
+	name      string
+	threshold int
+	timeout   time.Duration
+	onChange  func(name string, state State)
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	// trial is whether a half-open breaker's trial call is in flight
+	trial bool
+}
+
+// NewBreaker creates a closed breaker for the dependency name
+func NewBreaker(name string, cfg BreakerConfig) *Breaker {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = DefaultFailureThreshold
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = DefaultOpenTimeout
+	}
+	b := &Breaker{
+		name:      name,
+		threshold: cfg.FailureThreshold,
+		timeout:   cfg.OpenTimeout,
+		onChange:  cfg.OnStateChange,
+		now:       time.Now,
+	}
+	if b.onChange != nil {
+		b.onChange(name, Closed)
+	}
+	return b
+}
+
+// SetClock replaces the clock the open timeout is measured with, for tests
+func (b *Breaker) SetClock(now func() time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.now = now
+}
+
+// Name returns the dependency the breaker guards
+func (b *Breaker) Name() string {
+	if b == nil {
+		return ""
+	}
+	return b.name
+}
+
+// State returns the breaker's state, reporting an open breaker whose timeout has
+// passed as half-open
+func (b *Breaker) State() State {
+	if b == nil {
+		return Closed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == Open && !b.now().Before(b.openedAt.Add(b.timeout)) {
+		return HalfOpen
+	}
+	return b.state
+}
+
+// Allow reports whether a call may be made, returning ErrOpen if not. Every allowed
+// call must be followed by Success, Failure or Release.
+func (b *Breaker) Allow() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case Open:
+		if b.now().Before(b.openedAt.Add(b.timeout)) {
+			return ErrOpen
+		}
+		b.setState(HalfOpen)
+		b.trial = true
+		return nil
+	case HalfOpen:
+		if b.trial {
+			return ErrOpen
+		}
+		b.trial = true
+	}
+	return nil
+}
+
+// Success records a call the dependency answered, closing a half-open breaker
+func (b *Breaker) Success() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures, b.trial = 0, false
+	b.setState(Closed)
+}
+
+// Failure records a call the dependency failed, opening the breaker at the threshold
+// or when a half-open trial fails
+func (b *Breaker) Failure() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.state == HalfOpen || b.failures >= b.threshold {
+		b.openedAt, b.trial = b.now(), false
+		b.setState(Open)
+	}
+}
+
+// Release records an allowed call that was abandoned before the dependency answered,
+// such as one its caller cancelled, leaving the breaker's state as it is
+func (b *Breaker) Release() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
+
+func (b *Breaker) setState(state State) {
+	if b.state == state {
+		return
+	}
+	b.state = state
+	if b.onChange != nil {
+		b.onChange(b.name, state)
+	}
+}
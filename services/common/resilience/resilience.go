@@ -0,0 +1,176 @@
+// Package resilience guards calls from one service to another. A circuit breaker
+// stops calling a dependency that keeps failing, bounded retries with jittered
+// backoff ride out brief failures, and each attempt has its own timeout. Client wraps
+// an http.Client in all three, so the code making the calls is unchanged.
+package resilience
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/healthcare-gitops/common/config"
+)
+
+const (
+	// DefaultAttempts is how many times a call is made before its error is returned
+	DefaultAttempts = 3
+	// DefaultBaseDelay is the longest wait before the first retry
+	DefaultBaseDelay = 100 * time.Millisecond
+	// DefaultMaxDelay caps the wait before any retry
+	DefaultMaxDelay = 2 * time.Second
+)
+
+// RetryConfig bounds retries of a failed call
+type RetryConfig struct {
+	// Attempts is the most times a call is made, the first included; 1 disables
+	// retries. Defaults to DefaultAttempts.
+	Attempts int
+	// BaseDelay is the longest wait before the first retry, doubling for each retry
+	// after it. Defaults to DefaultBaseDelay.
+	BaseDelay time.Duration
+	// MaxDelay caps the wait. Defaults to DefaultMaxDelay.
+	MaxDelay time.Duration
+}
+
+func (c RetryConfig) withDefaults() RetryConfig {
+	if c.Attempts <= 0 {
+		c.Attempts = DefaultAttempts
+	}
+	if c.BaseDelay <= 0 {
+		c.BaseDelay = DefaultBaseDelay
+	}
+	if c.MaxDelay <= 0 {
+		c.MaxDelay = DefaultMaxDelay
+	}
+	return c
+}
+
+// Backoff returns how long to wait before retry n, counting from 1: a random
+// duration up to BaseDelay doubled n-1 times and capped at MaxDelay. The jitter keeps
+// callers that failed together from retrying together.
+func (c RetryConfig) Backoff(n int) time.Duration {
+	c = c.withDefaults()
+	ceiling := c.MaxDelay
+	if n < 32 {
+		if d := c.BaseDelay << (n - 1); d > 0 && d < ceiling {
+			ceiling = d
+		}
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// permanentError marks an error retrying cannot fix
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as one retrying cannot fix, such as a request the dependency
+// rejected, so Retry and Policy.Do return it at once. It does not count against a
+// breaker.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+// IsPermanent reports whether err was marked by Permanent
+func IsPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
+
+// Retry calls fn until it succeeds, returns a Permanent error or has been called
+// cfg.Attempts times, waiting Backoff between calls. It returns fn's last error, or
+// ctx's if ctx ends while waiting.
+func Retry(ctx context.Context, cfg RetryConfig, fn func(ctx context.Context) error) error {
+	cfg = cfg.withDefaults()
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || IsPermanent(err) || attempt >= cfg.Attempts {
+			return err
+		}
+		if waitErr := sleep(ctx, cfg.Backoff(attempt)); waitErr != nil {
+			return err
+		}
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Policy is how calls to one dependency are guarded
+type Policy struct {
+	// Breaker, if set, fails calls fast while the dependency keeps failing
+	Breaker *Breaker
+	Retry   RetryConfig
+	// Timeout bounds each attempt; 0 leaves attempts to the caller's context
+	Timeout time.Duration
+}
+
+// Do calls fn under the policy: each attempt through the breaker and with its own
+// timeout, retried as Retry does. A breaker that is open ends the retries with
+// ErrOpen.
+func (p Policy) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	return Retry(ctx, p.Retry, func(ctx context.Context) error {
+		if err := p.Breaker.Allow(); err != nil {
+			return Permanent(err)
+		}
+		if p.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+			defer cancel()
+		}
+		err := fn(ctx)
+		switch {
+		case err == nil || IsPermanent(err):
+			p.Breaker.Success()
+		case errors.Is(err, context.Canceled):
+			// The caller gave up, which says nothing about the dependency
+			p.Breaker.Release()
+		default:
+			p.Breaker.Failure()
+		}
+		return err
+	})
+}
+
+// PolicyFromEnv builds the policy for calls to the dependency name from
+// CIRCUIT_BREAKER_FAILURES, CIRCUIT_BREAKER_OPEN_TIMEOUT, RETRY_ATTEMPTS,
+// RETRY_BASE_DELAY and RETRY_MAX_DELAY. onStateChange is the breaker's
+// OnStateChange.
+func PolicyFromEnv(name string, onStateChange func(name string, state State)) Policy {
+	return Policy{
+		Breaker: NewBreaker(name, BreakerConfig{
+			FailureThreshold: config.GetEnvInt("CIRCUIT_BREAKER_FAILURES", DefaultFailureThreshold),
+			OpenTimeout:      config.GetEnvDuration("CIRCUIT_BREAKER_OPEN_TIMEOUT", DefaultOpenTimeout),
+			OnStateChange:    onStateChange,
+		}),
+		Retry: RetryConfig{
+			Attempts:  config.GetEnvInt("RETRY_ATTEMPTS", DefaultAttempts),
+			BaseDelay: config.GetEnvDuration("RETRY_BASE_DELAY", DefaultBaseDelay),
+			MaxDelay:  config.GetEnvDuration("RETRY_MAX_DELAY", DefaultMaxDelay),
+		},
+	}
+}
+
+// ValidateEnv checks the circuit breaker and retry settings, for services' startup
+// validation
+func ValidateEnv(v *config.Validator) {
+	v.IntRange("CIRCUIT_BREAKER_FAILURES", 1, 1000)
+	v.DurationRange("CIRCUIT_BREAKER_OPEN_TIMEOUT", time.Second, time.Hour)
+	v.IntRange("RETRY_ATTEMPTS", 1, 10)
+	v.DurationRange("RETRY_BASE_DELAY", time.Millisecond, time.Minute)
+	v.DurationRange("RETRY_MAX_DELAY", time.Millisecond, time.Minute)
+}
@@ -0,0 +1,183 @@
+package resilience
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Transport makes HTTP requests under a Policy. Connection errors and 502, 503 and
+// 504 responses are retried, for requests that are safe to repeat: GET, HEAD,
+// OPTIONS, PUT and DELETE, and any request with an Idempotency-Key header. Those
+// errors and any other 5xx response count against the breaker; other responses,
+// 429 included, are the dependency answering. The last response is returned as it
+// is, so callers see the status they always did.
+type Transport struct {
+	// Base makes each attempt; nil uses http.DefaultTransport
+	Base   http.RoundTripper
+	Policy Policy
+}
+
+// Client returns a copy of client, or of a plain client when it is nil, whose
+// requests are made under policy. A Timeout set on client becomes the timeout of each
+// attempt when policy has none, so retries are not cut short by it.
+func Client(client *http.Client, policy Policy) *http.Client {
+	wrapped := &http.Client{}
+	if client != nil {
+		*wrapped = *client
+	}
+	if policy.Timeout <= 0 {
+		policy.Timeout = wrapped.Timeout
+	}
+	wrapped.Timeout = 0
+	wrapped.Transport = &Transport{Base: wrapped.Transport, Policy: policy}
+	return wrapped
+}
+
+// policies hold one policy, and so one breaker, per dependency ClientFromEnv has
+// wrapped a client for
+var (
+	policiesMu sync.Mutex
+	policies   = make(map[string]Policy)
+)
+
+// ClientFromEnv wraps client, or a plain client timing out after timeout when it is
+// nil, so its calls to the dependency name are retried when they fail and stop for a
+// while when the dependency keeps failing, under the policy PolicyFromEnv reads. The
+// client's timeout bounds each attempt. Clients for the same dependency share its
+// breaker, whose opening and trial calls are logged. onChange, if set, is called with
+// each state the breaker enters, for metrics.
+func ClientFromEnv(name string, client *http.Client, timeout time.Duration, onChange func(name string, state State)) *http.Client {
+	policiesMu.Lock()
+	policy, ok := policies[name]
+	if !ok {
+		policy = PolicyFromEnv(name, func(name string, state State) {
+			if onChange != nil {
+				onChange(name, state)
+			}
+			logStateChange(name, state)
+		})
+		policies[name] = policy
+	}
+	policiesMu.Unlock()
+	if client == nil {
+		client = &http.Client{Timeout: timeout}
+	}
+	return Client(client, policy)
+}
+
+// logStateChange logs a breaker opening and letting a trial call through
+func logStateChange(name string, state State) {
+	switch state {
+	case Open:
+		log.Warn().Str("dependency", name).Msg("Circuit breaker open, failing calls fast")
+	case HalfOpen:
+		log.Info().Str("dependency", name).Msg("Circuit breaker half-open, trying a call")
+	}
+}
+
+// RoundTrip makes the request, retrying it when it failed and may be repeated
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	retry := t.Policy.Retry.withDefaults()
+	if !repeatable(req) {
+		retry.Attempts = 1
+	}
+	breaker := t.Policy.Breaker
+	for attempt := 1; ; attempt++ {
+		if err := breaker.Allow(); err != nil {
+			return nil, fmt.Errorf("%s: %w", breaker.Name(), err)
+		}
+		resp, err := t.attempt(base, req, attempt)
+		switch {
+		case err != nil && req.Context().Err() != nil:
+			breaker.Release()
+			return nil, err
+		case err != nil || resp.StatusCode >= http.StatusInternalServerError:
+			breaker.Failure()
+		default:
+			breaker.Success()
+			return resp, nil
+		}
+		if attempt >= retry.Attempts || !retryable(resp) {
+			return resp, err
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if waitErr := sleep(req.Context(), retry.Backoff(attempt)); waitErr != nil {
+			return nil, waitErr
+		}
+	}
+}
+
+// attempt makes one attempt at req, with a fresh body for retries and its own
+// timeout, which ends when the response body is closed
+func (t *Transport) attempt(base http.RoundTripper, req *http.Request, n int) (*http.Response, error) {
+	ctx, cancel := req.Context(), context.CancelFunc(func() {})
+	if t.Policy.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, t.Policy.Timeout)
+	}
+	attempt := req.WithContext(ctx)
+	if n > 1 && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		attempt.Body = body
+	}
+	resp, err := base.RoundTrip(attempt)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnClose ends an attempt's timeout once its response has been read
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// repeatable reports whether req may be sent again after a failure
+func repeatable(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+// retryable reports whether a failed attempt may succeed if made again: a connection
+// error, or a gateway or dependency that is briefly unavailable
+func retryable(resp *http.Response) bool {
+	if resp == nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
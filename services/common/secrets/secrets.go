@@ -0,0 +1,241 @@
+// Package secrets resolves long-lived service secrets such as encryption and signing
+// keys from HashiCorp Vault, mounted files or the environment, and watches them so a
+// rotated secret can be reloaded without restarting the service.
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/healthcare-gitops/common/config"
+)
+
+// Sources reported in Secret.Source
+const (
+	SourceVault = "vault"
+	SourceFile  = "file"
+	SourceEnv   = "env"
+)
+
+// ErrNotFound is returned when a provider has no value for a secret
+var ErrNotFound = errors.New("secret not found")
+
+// Secret is a resolved secret value
+type Secret struct {
+	Name  string
+	Value string
+	// Source is the provider that resolved the secret: vault, file or env
+	Source string
+	// Version identifies the value within its source, e.g. the Vault KV version
+	Version string
+}
+
+// Provider resolves secrets by name, e.g. MASTER_KEY
+type Provider interface {
+	Get(ctx context.Context, name string) (Secret, error)
+}
+
+// Renewer is a provider holding a lease that must be renewed to stay valid, such as
+// a Vault token. Renew returns the lease's remaining TTL.
+type Renewer interface {
+	Renew(ctx context.Context) (time.Duration, error)
+}
+
+// Pinger is a provider backed by a remote key store, such as Vault, whose
+// reachability can be checked without reading a secret
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Env resolves secrets from environment variables of the same name
+type Env struct{}
+
+// Get returns the environment variable named name
+func (Env) Get(_ context.Context, name string) (Secret, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return Secret{}, fmt.Errorf("%w: %s is not set", ErrNotFound, name)
+	}
+	return Secret{Name: name, Value: value, Source: SourceEnv}, nil
+}
+
+// File resolves secrets from files, as mounted by Kubernetes secret volumes or a Vault
+// agent sidecar. A secret is read from the path in <NAME>_FILE if set, otherwise from
+// the file named after it in Dir. Trailing newlines are trimmed.
+type File struct {
+	Dir string
+}
+
+// Get reads the file holding the secret named name
+func (f File) Get(_ context.Context, name string) (Secret, error) {
+	path := os.Getenv(name + "_FILE")
+	if path == "" {
+		if f.Dir == "" {
+			return Secret{}, fmt.Errorf("%w: %s_FILE is not set", ErrNotFound, name)
+		}
+		path = filepath.Join(f.Dir, name)
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Secret{}, fmt.Errorf("%w: %s", ErrNotFound, path)
+	}
+	if err != nil {
+		return Secret{}, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return Secret{}, err
+	}
+	return Secret{
+		Name:    name,
+		Value:   strings.TrimRight(string(data), "\r\n"),
+		Source:  SourceFile,
+		Version: info.ModTime().UTC().Format(time.RFC3339Nano),
+	}, nil
+}
+
+// Chain tries providers in order, falling through to the next only when a provider
+// does not have the secret. Any other error, such as Vault being unreachable, is
+// returned rather than silently falling back to a stale source.
+type Chain []Provider
+
+// Get returns the secret from the first provider that has it
+func (c Chain) Get(ctx context.Context, name string) (Secret, error) {
+	for _, p := range c {
+		secret, err := p.Get(ctx, name)
+		if !errors.Is(err, ErrNotFound) {
+			return secret, err
+		}
+	}
+	return Secret{}, fmt.Errorf("%w: %s", ErrNotFound, name)
+}
+
+// Renew renews every provider in the chain that holds a lease, returning the
+// shortest remaining TTL, or zero when none does
+func (c Chain) Renew(ctx context.Context) (time.Duration, error) {
+	var ttl time.Duration
+	for _, p := range c {
+		r, ok := p.(Renewer)
+		if !ok {
+			continue
+		}
+		remaining, err := r.Renew(ctx)
+		if err != nil {
+			return 0, err
+		}
+		if ttl == 0 || (remaining > 0 && remaining < ttl) {
+			ttl = remaining
+		}
+	}
+	return ttl, nil
+}
+
+// Ping checks every provider in the chain backed by a remote key store. A chain of
+// only local providers has nothing to check.
+func (c Chain) Ping(ctx context.Context) error {
+	for _, p := range c {
+		if pinger, ok := p.(Pinger); ok {
+			if err := pinger.Ping(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// FromEnv builds the provider chain configured by the environment: Vault when
+// VAULT_ADDR is set, then files (<NAME>_FILE or SECRETS_DIR), then environment
+// variables. service names the default Vault secret path; client, if set, makes the
+// calls to Vault.
+func FromEnv(service string, client *http.Client) (Provider, error) {
+	var chain Chain
+	if addr := os.Getenv("VAULT_ADDR"); addr != "" {
+		vault, err := NewVault(VaultConfig{
+			Address:    addr,
+			Token:      os.Getenv("VAULT_TOKEN"),
+			TokenFile:  os.Getenv("VAULT_TOKEN_FILE"),
+			Namespace:  os.Getenv("VAULT_NAMESPACE"),
+			Mount:      config.GetEnv("VAULT_KV_MOUNT", "secret"),
+			Path:       config.GetEnv("VAULT_SECRET_PATH", service),
+			HTTPClient: client,
+		})
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, vault)
+	}
+	return append(chain, File{Dir: os.Getenv("SECRETS_DIR")}, Env{}), nil
+}
+
+// Watcher polls a secret and reports changes, so services can reload a rotated key
+// in place
+type Watcher struct {
+	Provider Provider
+	Name     string
+	Interval time.Duration
+	// OnChange is called with each new value. If it returns an error the new value is
+	// not accepted, and the change is retried on the next poll.
+	OnChange func(Secret) error
+	// OnError, if set, is called when a poll or OnChange fails
+	OnError func(error)
+}
+
+// Run polls until ctx is cancelled. current is the value the service started with.
+func (w *Watcher) Run(ctx context.Context, current Secret) {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		secret, err := w.Provider.Get(ctx, w.Name)
+		if err == nil && secret.Value != current.Value {
+			if err = w.OnChange(secret); err == nil {
+				current = secret
+			}
+		}
+		if err != nil && w.OnError != nil && ctx.Err() == nil {
+			w.OnError(fmt.Errorf("%s: %w", w.Name, err))
+		}
+	}
+}
+
+// KeepAlive renews p's lease at half its remaining TTL until ctx is cancelled, or
+// returns at once if p holds no lease. A failed renewal is retried after retry.
+func KeepAlive(ctx context.Context, p Provider, retry time.Duration, onError func(error)) {
+	r, ok := p.(Renewer)
+	if !ok {
+		return
+	}
+	for {
+		ttl, err := r.Renew(ctx)
+		wait := ttl / 2
+		switch {
+		case err != nil:
+			if onError != nil && ctx.Err() == nil {
+				onError(err)
+			}
+			wait = retry
+		case ttl <= 0:
+			// Nothing to renew, e.g. a non-expiring root token or one a Vault agent renews
+			return
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VaultConfig configures a Vault KV version 2 secret source
+type VaultConfig struct {
+	// Address is the Vault server URL, e.g. https://vault.example.com:8200
+	Address string
+	// Token authenticates to Vault. TokenFile, if set, is read on every request instead,
+	// for tokens written and renewed by a Vault agent.
+	Token     string
+	TokenFile string
+	// Namespace is the Vault Enterprise namespace, if any
+	Namespace string
+	// Mount is the KV v2 secrets engine mount, e.g. secret
+	Mount string
+	// Path is the secret holding the service's keys, e.g. phi-service
+	Path       string
+	HTTPClient *http.Client
+}
+
+// Vault resolves secrets from the keys of one Vault KV v2 secret, so MASTER_KEY is
+// the MASTER_KEY key of secret/<path>
+type Vault struct {
+	cfg    VaultConfig
+	client *http.Client
+}
+
+// NewVault creates a Vault secret source
+func NewVault(cfg VaultConfig) (*Vault, error) {
+	if cfg.Address == "" {
+		return nil, errors.New("vault: address is required")
+	}
+	if cfg.Token == "" && cfg.TokenFile == "" {
+		return nil, errors.New("vault: VAULT_TOKEN or VAULT_TOKEN_FILE is required")
+	}
+	if cfg.Path == "" {
+		return nil, errors.New("vault: secret path is required")
+	}
+	if cfg.Mount == "" {
+		cfg.Mount = "secret"
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	cfg.Address = strings.TrimRight(cfg.Address, "/")
+	return &Vault{cfg: cfg, client: client}, nil
+}
+
+// Get reads the secret's current version and returns its key named name
+func (v *Vault) Get(ctx context.Context, name string) (Secret, error) {
+	var resp struct {
+		Data struct {
+			Data     map[string]interface{} `json:"data"`
+			Metadata struct {
+				Version int `json:"version"`
+			} `json:"metadata"`
+		} `json:"data"`
+	}
+	path := "/v1/" + url.PathEscape(v.cfg.Mount) + "/data/" + strings.Trim(v.cfg.Path, "/")
+	if err := v.do(ctx, http.MethodGet, path, &resp); err != nil {
+		return Secret{}, err
+	}
+
+	raw, ok := resp.Data.Data[name]
+	if !ok {
+		return Secret{}, fmt.Errorf("%w: %s in vault %s/%s", ErrNotFound, name, v.cfg.Mount, v.cfg.Path)
+	}
+	value, ok := raw.(string)
+	if !ok {
+		return Secret{}, fmt.Errorf("vault: %s in %s/%s is not a string", name, v.cfg.Mount, v.cfg.Path)
+	}
+	return Secret{
+		Name:    name,
+		Value:   value,
+		Source:  SourceVault,
+		Version: strconv.Itoa(resp.Data.Metadata.Version),
+	}, nil
+}
+
+// Renew renews the Vault token and returns its remaining TTL. Tokens that cannot be
+// renewed, or that do not expire, report a zero TTL.
+func (v *Vault) Renew(ctx context.Context) (time.Duration, error) {
+	if v.cfg.TokenFile != "" {
+		// The agent that writes the file owns the token's lease
+		return 0, nil
+	}
+	var lookup struct {
+		Data struct {
+			TTL       int64 `json:"ttl"`
+			Renewable bool  `json:"renewable"`
+		} `json:"data"`
+	}
+	if err := v.do(ctx, http.MethodGet, "/v1/auth/token/lookup-self", &lookup); err != nil {
+		return 0, err
+	}
+	if !lookup.Data.Renewable || lookup.Data.TTL == 0 {
+		return time.Duration(lookup.Data.TTL) * time.Second, nil
+	}
+
+	var renewed struct {
+		Auth struct {
+			LeaseDuration int64 `json:"lease_duration"`
+		} `json:"auth"`
+	}
+	if err := v.do(ctx, http.MethodPost, "/v1/auth/token/renew-self", &renewed); err != nil {
+		return 0, err
+	}
+	return time.Duration(renewed.Auth.LeaseDuration) * time.Second, nil
+}
+
+// Ping checks Vault is reachable, initialized and unsealed. Standbys count as
+// reachable, since they forward reads to the active node.
+func (v *Vault) Ping(ctx context.Context) error {
+	var status struct {
+		Sealed bool `json:"sealed"`
+	}
+	if err := v.do(ctx, http.MethodGet, "/v1/sys/health?standbyok=true&perfstandbyok=true", &status); err != nil {
+		return err
+	}
+	if status.Sealed {
+		return errors.New("vault: sealed")
+	}
+	return nil
+}
+
+// do sends an authenticated request to Vault and decodes the JSON response
+func (v *Vault) do(ctx context.Context, method, path string, out interface{}) error {
+	token := v.cfg.Token
+	if v.cfg.TokenFile != "" {
+		data, err := os.ReadFile(v.cfg.TokenFile)
+		if err != nil {
+			return fmt.Errorf("vault: reading token: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+
+	var body io.Reader
+	if method == http.MethodPost {
+		body = bytes.NewReader([]byte("{}"))
+	}
+	req, err := http.NewRequestWithContext(ctx, method, v.cfg.Address+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	req.Header.Set("X-Vault-Request", "true")
+	if v.cfg.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.cfg.Namespace)
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("vault: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: vault %s", ErrNotFound, path)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Errors []string `json:"errors"`
+		}
+		_ = json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&failure)
+		return fmt.Errorf("vault: %s %s: %d %s", method, path, resp.StatusCode, strings.Join(failure.Errors, "; "))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,362 @@
+// Package selfscan checks a running service for common security misconfigurations:
+// wildcard CORS in production, admin routes that answer anonymous callers, default or
+// placeholder secrets and exposed debug endpoints. Each service serves its report at
+// /admin/selfscan behind its own admin authentication, and the report's risk score
+// feeds the commit risk scorer (tools/git_intel/risk_scorer.py --selfscan).
+package selfscan
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Severity ranks a finding
+type Severity string
+
+// Severities, most severe first
+const (
+	Critical Severity = "critical"
+	High     Severity = "high"
+	Medium   Severity = "medium"
+	Low      Severity = "low"
+)
+
+// severityWeight is each finding's contribution to the risk score, which is capped at
+// 100. One critical and one high finding reach the risk scorer's medium band (40),
+// two criticals its high band (70).
+var severityWeight = map[Severity]int{Critical: 40, High: 20, Medium: 10, Low: 3}
+
+var severityRank = map[Severity]int{Critical: 0, High: 1, Medium: 2, Low: 3}
+
+// Checks run by Scan
+const (
+	CheckCORS          = "cors"
+	CheckAdminAuth     = "admin_auth"
+	CheckSecrets       = "default_secrets"
+	CheckDebugEndpoint = "debug_endpoints"
+)
+
+// probeOrigin is the foreign origin CORS is probed with
+const probeOrigin = "https://selfscan.invalid"
+
+// DebugEndpoint is a debug handler to look for. Marker is text its response contains,
+// so a catch-all route answering every path is not mistaken for it; an empty Marker
+// counts any 200.
+type DebugEndpoint struct {
+	Path   string
+	Marker string
+}
+
+// DefaultDebugEndpoints are the standard library and x/net debug handlers, which must
+// not be reachable in production
+var DefaultDebugEndpoints = []DebugEndpoint{
+	{Path: "/debug/pprof/", Marker: "Types of profiles available"},
+	{Path: "/debug/vars", Marker: `"memstats"`},
+	{Path: "/debug/requests", Marker: "/debug/requests"},
+	{Path: "/debug/events", Marker: "/debug/events"},
+}
+
+// knownDefaultSecrets are secret values published in this repository's demos, tests
+// and manifests. A service using one has a secret anyone can read.
+var knownDefaultSecrets = map[string]bool{
+	"super-secret-key-change-in-production-please":           true,
+	"test-master-key-32-bytes-long-change-in-production":     true,
+	"demo-secret-key-minimum-32-characters-long-for-testing": true,
+	"demo-secret-key-minimum-32-characters-long":             true,
+	"test-secret-key-for-integration-testing-only":           true,
+	"test-key-32-bytes-long-change!!":                        true,
+	"your-strong-secret-here":                                true,
+	"demo-key":                                               true,
+}
+
+// placeholderMarkers appear in secrets copied from examples
+var placeholderMarkers = []string{"changeme", "change-me", "change_me", "change-in-production", "placeholder", "example", "your-", "password", "secret123"}
+
+// minSecretLength is the shortest secret not reported as weak
+const minSecretLength = 16
+
+// Finding is one misconfiguration
+type Finding struct {
+	Check       string   `json:"check"`
+	Severity    Severity `json:"severity"`
+	Title       string   `json:"title"`
+	Detail      string   `json:"detail"`
+	Remediation string   `json:"remediation,omitempty"`
+}
+
+// Report is the result of a scan. RiskScore (0-100) and RiskLevel use the commit risk
+// scorer's bands: low below 40, medium below 70, high above.
+type Report struct {
+	Service     string           `json:"service"`
+	Environment string           `json:"environment"`
+	Production  bool             `json:"production"`
+	ScannedAt   time.Time        `json:"scanned_at"`
+	Checks      []string         `json:"checks"`
+	Findings    []Finding        `json:"findings"`
+	Counts      map[Severity]int `json:"counts"`
+	RiskScore   int              `json:"risk_score"`
+	RiskLevel   string           `json:"risk_level"`
+}
+
+// Target describes the service to scan
+type Target struct {
+	Service string
+	// Environment is the deployment environment; see Environment
+	Environment string
+	// Handler is the service's router. Probes are served in-process through every
+	// middleware, so they see exactly what a client would.
+	Handler http.Handler
+	// AdminRoutes are GET paths that must refuse callers without credentials. Only GET
+	// is probed, so a route missing authentication is never actually exercised.
+	AdminRoutes []string
+	// Secrets maps the names of secrets in use to their values, which are compared
+	// with published defaults and never reported
+	Secrets map[string]string
+	// CORSPath is probed with a foreign Origin; defaults to /health
+	CORSPath string
+	// DebugEndpoints defaults to DefaultDebugEndpoints
+	DebugEndpoints []DebugEndpoint
+}
+
+// Environment is the deployment environment from ENV or ENVIRONMENT. A deployment that
+// sets neither is assumed to be production.
+func Environment() string {
+	for _, name := range []string{"ENV", "ENVIRONMENT"} {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return "production"
+}
+
+// isProduction reports whether env names a production environment
+func isProduction(env string) bool {
+	switch strings.ToLower(env) {
+	case "production", "prod":
+		return true
+	}
+	return false
+}
+
+// bySeverity picks the severity for production or elsewhere
+func bySeverity(production bool, prod, other Severity) Severity {
+	if production {
+		return prod
+	}
+	return other
+}
+
+// probe serves a request without credentials through the handler
+func probe(h http.Handler, method, path string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = "192.0.2.1:40000" // documentation range, never a real client
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+// checkCORS looks for responses any origin may read
+func checkCORS(t Target, production bool) []Finding {
+	path := t.CORSPath
+	if path == "" {
+		path = "/health"
+	}
+	var findings []Finding
+	for _, method := range []string{http.MethodGet, http.MethodOptions} {
+		header := http.Header{"Origin": {probeOrigin}}
+		if method == http.MethodOptions {
+			header.Set("Access-Control-Request-Method", http.MethodPost)
+		}
+		rr := probe(t.Handler, method, path, header)
+		allowed := rr.Header().Get("Access-Control-Allow-Origin")
+		if allowed != "*" && allowed != probeOrigin {
+			continue
+		}
+		f := Finding{
+			Check:       CheckCORS,
+			Severity:    bySeverity(production, High, Low),
+			Title:       "CORS allows any origin",
+			Detail:      fmt.Sprintf("%s %s answers Origin %s with Access-Control-Allow-Origin: %s", method, path, probeOrigin, allowed),
+			Remediation: "List trusted origins in CORS_ALLOWED_ORIGINS and use the shared CORS middleware",
+		}
+		if allowed == probeOrigin && rr.Header().Get("Access-Control-Allow-Credentials") == "true" {
+			f.Severity = bySeverity(production, Critical, Medium)
+			f.Detail += " and allows credentials"
+		}
+		return append(findings, f)
+	}
+	return findings
+}
+
+// checkAdminAuth looks for admin routes that answer anonymous callers. Only 401 and
+// 403 count as protected; routes that are disabled or not found are inconclusive.
+func checkAdminAuth(t Target, production bool) []Finding {
+	var findings []Finding
+	for _, path := range t.AdminRoutes {
+		rr := probe(t.Handler, http.MethodGet, path, nil)
+		if rr.Code >= 400 {
+			continue
+		}
+		findings = append(findings, Finding{
+			Check:       CheckAdminAuth,
+			Severity:    bySeverity(production, Critical, High),
+			Title:       "Admin route served without authentication",
+			Detail:      fmt.Sprintf("GET %s returned %d without credentials", path, rr.Code),
+			Remediation: "Put the route behind the service's admin authentication",
+		})
+	}
+	return findings
+}
+
+// checkSecrets compares the secrets in use with published and placeholder values
+func checkSecrets(t Target, production bool) []Finding {
+	names := make([]string, 0, len(t.Secrets))
+	for name := range t.Secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var findings []Finding
+	for _, name := range names {
+		value := t.Secrets[name]
+		lower := strings.ToLower(value)
+		switch {
+		case value == "":
+			continue
+		case knownDefaultSecrets[value]:
+			findings = append(findings, Finding{
+				Check:       CheckSecrets,
+				Severity:    bySeverity(production, Critical, High),
+				Title:       "Published default secret in use",
+				Detail:      name + " is a value published in the repository's demos or manifests",
+				Remediation: "Generate a new random value, e.g. openssl rand -base64 32, and load it from the secret store",
+			})
+		case containsAny(lower, placeholderMarkers):
+			findings = append(findings, Finding{
+				Check:       CheckSecrets,
+				Severity:    bySeverity(production, High, Medium),
+				Title:       "Placeholder secret in use",
+				Detail:      name + " looks like a value copied from an example",
+				Remediation: "Generate a new random value and load it from the secret store",
+			})
+		case len(value) < minSecretLength:
+			findings = append(findings, Finding{
+				Check:       CheckSecrets,
+				Severity:    bySeverity(production, Medium, Low),
+				Title:       "Short secret",
+				Detail:      fmt.Sprintf("%s is shorter than %d characters", name, minSecretLength),
+				Remediation: "Use at least 32 random bytes",
+			})
+		}
+	}
+	return findings
+}
+
+func containsAny(value string, markers []string) bool {
+	for _, m := range markers {
+		if strings.Contains(value, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDebugEndpoints looks for debug handlers answering anonymous callers
+func checkDebugEndpoints(t Target, production bool) []Finding {
+	endpoints := t.DebugEndpoints
+	if endpoints == nil {
+		endpoints = DefaultDebugEndpoints
+	}
+	var findings []Finding
+	for _, endpoint := range endpoints {
+		rr := probe(t.Handler, http.MethodGet, endpoint.Path, nil)
+		if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), endpoint.Marker) {
+			continue
+		}
+		findings = append(findings, Finding{
+			Check:       CheckDebugEndpoint,
+			Severity:    bySeverity(production, High, Low),
+			Title:       "Debug endpoint exposed",
+			Detail:      fmt.Sprintf("GET %s returned 200 without credentials", endpoint.Path),
+			Remediation: "Remove the debug handler from production builds or serve it on a separate, internal listener",
+		})
+	}
+	return findings
+}
+
+// Scan runs every check against the target
+func Scan(t Target) Report {
+	env := t.Environment
+	if env == "" {
+		env = Environment()
+	}
+	production := isProduction(env)
+	report := Report{
+		Service:     t.Service,
+		Environment: env,
+		Production:  production,
+		ScannedAt:   time.Now().UTC(),
+		Checks:      []string{CheckCORS, CheckAdminAuth, CheckSecrets, CheckDebugEndpoint},
+		Findings:    []Finding{},
+		Counts:      map[Severity]int{Critical: 0, High: 0, Medium: 0, Low: 0},
+	}
+	for _, check := range []func(Target, bool) []Finding{checkCORS, checkAdminAuth, checkSecrets, checkDebugEndpoints} {
+		report.Findings = append(report.Findings, check(t, production)...)
+	}
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		return severityRank[report.Findings[i].Severity] < severityRank[report.Findings[j].Severity]
+	})
+	for _, f := range report.Findings {
+		report.Counts[f.Severity]++
+		report.RiskScore += severityWeight[f.Severity]
+	}
+	if report.RiskScore > 100 {
+		report.RiskScore = 100
+	}
+	switch {
+	case report.RiskScore >= 70:
+		report.RiskLevel = "high"
+	case report.RiskScore >= 40:
+		report.RiskLevel = "medium"
+	default:
+		report.RiskLevel = "low"
+	}
+	return report
+}
+
+// Handler scans the target it is given on every request and serves the report. The
+// target is built per request so it can refer to the router the handler is mounted in.
+// Mount it behind the service's admin authentication.
+func Handler(target func() Target) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(Scan(target()))
+	}
+}
+
+// RequireToken guards next with a shared admin token in X-Admin-Token, for services
+// without admin authentication of their own. An empty token disables the endpoint.
+func RequireToken(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			http.Error(w, "Self-scan is disabled: SELFSCAN_TOKEN is not set", http.StatusForbidden)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Admin-Token")), []byte(token)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,220 @@
+package siem
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// vendor names the device in CEF and LEEF headers
+	vendor = "healthcare-gitops"
+	// facility is the syslog facility events are sent under: security/authorization
+	// messages (authpriv)
+	facility = 10
+	// sdID is the structured data element plain syslog events are sent in. 32473 is
+	// the private enterprise number RFC 5612 reserves for documentation and examples.
+	sdID = "event@32473"
+)
+
+// syslogSeverities maps event severities to syslog severities
+var syslogSeverities = map[string]int{
+	SeverityCritical: 2,
+	SeverityError:    3,
+	SeverityWarning:  4,
+	SeverityInfo:     6,
+}
+
+// cefSeverities maps event severities to the 0-10 scale CEF and LEEF use
+var cefSeverities = map[string]int{
+	SeverityCritical: 10,
+	SeverityError:    8,
+	SeverityWarning:  6,
+	SeverityInfo:     3,
+}
+
+// format renders an event as an RFC 5424 syslog message with the configured body
+func (e *Exporter) format(ev Event) string {
+	severity, ok := syslogSeverities[ev.Severity]
+	if !ok {
+		severity = syslogSeverities[SeverityInfo]
+	}
+	structured, body := "-", ""
+	switch e.cfg.Format {
+	case FormatCEF:
+		body = formatCEF(e.cfg.Product, e.cfg.Version, ev)
+	case FormatLEEF:
+		body = formatLEEF(e.cfg.Product, e.cfg.Version, ev)
+	default:
+		structured, body = formatStructured(ev), ev.Message
+	}
+
+	msg := fmt.Sprintf("<%d>1 %s %s %s - %s %s",
+		facility*8+severity,
+		ev.Time.UTC().Format(time.RFC3339Nano),
+		headerField(e.hostname, 255),
+		headerField(e.cfg.Product, 48),
+		headerField(ev.Name, 32),
+		structured,
+	)
+	if body != "" {
+		msg += " " + body
+	}
+	return msg
+}
+
+// headerField makes a value a valid syslog header field: printable ASCII without
+// spaces, at most max characters, or "-" when empty
+func headerField(value string, max int) string {
+	value = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return -1
+		}
+		return r
+	}, value)
+	if value == "" {
+		return "-"
+	}
+	if len(value) > max {
+		value = value[:max]
+	}
+	return value
+}
+
+// cefSeverity returns an event's severity on the 0-10 scale, info for unknown ones
+func cefSeverity(severity string) string {
+	if level, ok := cefSeverities[severity]; ok {
+		return strconv.Itoa(level)
+	}
+	return strconv.Itoa(cefSeverities[SeverityInfo])
+}
+
+// fields lists an event's attributes as key-value pairs under CEF's keys, details
+// last in key order
+func fields(ev Event) [][2]string {
+	pairs := [][2]string{{"rt", strconv.FormatInt(ev.Time.UnixMilli(), 10)}}
+	add := func(key, value string) {
+		if value != "" {
+			pairs = append(pairs, [2]string{key, value})
+		}
+	}
+	add("outcome", ev.Outcome)
+	add("suser", ev.Actor)
+	add("src", ev.SourceIP)
+	add("request", ev.Resource)
+	add("msg", ev.Message)
+	if ev.RequestID != "" {
+		add("cs1Label", "requestId")
+		add("cs1", ev.RequestID)
+	}
+	if ev.TraceID != "" {
+		add("cs2Label", "traceId")
+		add("cs2", ev.TraceID)
+	}
+	keys := make([]string, 0, len(ev.Details))
+	for k := range ev.Details {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		add(k, ev.Details[k])
+	}
+	return pairs
+}
+
+// formatCEF renders an event in ArcSight Common Event Format
+func formatCEF(product, version string, ev Event) string {
+	header := []string{"CEF:0", vendor, product, version, ev.Name, ev.Name, cefSeverity(ev.Severity)}
+	for i := 1; i < len(header); i++ {
+		header[i] = cefHeaderEscaper.Replace(header[i])
+	}
+	extension := make([]string, 0, 8)
+	for _, kv := range fields(ev) {
+		extension = append(extension, cefKey(kv[0])+"="+cefValueEscaper.Replace(kv[1]))
+	}
+	return strings.Join(header, "|") + "|" + strings.Join(extension, " ")
+}
+
+var (
+	cefHeaderEscaper = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ")
+	cefValueEscaper  = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+)
+
+// cefKey keeps extension keys to the letters and digits CEF allows
+func cefKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, key)
+}
+
+// leefKeys renames the CEF keys LEEF names differently
+var leefKeys = map[string]string{
+	"suser":   "usrName",
+	"request": "url",
+}
+
+// leefTimeLayout is the devTime format LEEF collectors parse by default
+const leefTimeLayout = "Jan 02 2006 15:04:05.000 MST"
+
+// formatLEEF renders an event in IBM QRadar Log Event Extended Format 1.0, with
+// tab-separated attributes
+func formatLEEF(product, version string, ev Event) string {
+	header := []string{"LEEF:1.0", vendor, product, version, ev.Name}
+	for i := 1; i < len(header); i++ {
+		header[i] = strings.NewReplacer("|", "", "\t", " ", "\n", " ").Replace(header[i])
+	}
+	attrs := []string{"cat=" + leefValue(ev.Name), "sev=" + cefSeverity(ev.Severity), "devTime=" + ev.Time.UTC().Format(leefTimeLayout)}
+	for _, kv := range fields(ev) {
+		key := kv[0]
+		if key == "rt" {
+			continue
+		}
+		if renamed, ok := leefKeys[key]; ok {
+			key = renamed
+		}
+		attrs = append(attrs, cefKey(key)+"="+leefValue(kv[1]))
+	}
+	return strings.Join(header, "|") + "|" + strings.Join(attrs, "\t")
+}
+
+// leefValue strips the characters LEEF 1.0 cannot carry in an attribute value
+func leefValue(value string) string {
+	return strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(value)
+}
+
+// formatStructured renders an event's attributes as one RFC 5424 structured data
+// element
+func formatStructured(ev Event) string {
+	var b strings.Builder
+	b.WriteString("[" + sdID)
+	add := func(name, value string) {
+		if value != "" {
+			b.WriteString(" " + headerField(strings.NewReplacer("=", "", "]", "", `"`, "").Replace(name), 32))
+			b.WriteString(`="` + sdValueEscaper.Replace(value) + `"`)
+		}
+	}
+	add("severity", ev.Severity)
+	add("outcome", ev.Outcome)
+	add("actor", ev.Actor)
+	add("source_ip", ev.SourceIP)
+	add("resource", ev.Resource)
+	add("request_id", ev.RequestID)
+	add("trace_id", ev.TraceID)
+	keys := make([]string, 0, len(ev.Details))
+	for k := range ev.Details {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		add(k, ev.Details[k])
+	}
+	b.WriteString("]")
+	return b.String()
+}
+
+var sdValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
@@ -0,0 +1,409 @@
+// Package siem forwards security and audit events to a SIEM collector as syslog
+// messages (RFC 5424), with the body in ArcSight CEF, IBM QRadar LEEF or plain
+// syslog structured data. Events are sent off the request path, rate limited so a
+// burst of refused credentials cannot flood the collector, and counted by result so
+// delivery shows in metrics. Like audit events, they carry who did what and how it
+// ended, never request bodies or tokens.
+package siem
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/healthcare-gitops/common/audit"
+	"github.com/healthcare-gitops/common/config"
+	"golang.org/x/time/rate"
+)
+
+// Message formats ConfigFromEnv selects with SIEM_FORMAT
+const (
+	FormatCEF    = "cef"
+	FormatLEEF   = "leef"
+	FormatSyslog = "syslog"
+)
+
+// Transports ConfigFromEnv selects with SIEM_TRANSPORT. TCP and TLS frame messages by
+// octet counting (RFC 6587, RFC 5425); UDP sends one message per datagram.
+const (
+	TransportUDP = "udp"
+	TransportTCP = "tcp"
+	TransportTLS = "tls"
+)
+
+// Severities of an event, mapped to syslog, CEF and LEEF severities when it is sent
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityError    = "error"
+	SeverityCritical = "critical"
+)
+
+// Delivery results reported to Config.OnDeliver
+const (
+	ResultSent        = "sent"
+	ResultFailed      = "failed"
+	ResultRateLimited = "rate_limited"
+	ResultQueueFull   = "queue_full"
+)
+
+const (
+	// DefaultRateLimit is how many events a second are sent, on average
+	DefaultRateLimit = 100
+	// DefaultBurst is how many events can be sent at once above the rate
+	DefaultBurst = 200
+	// DefaultBufferSize is how many events can wait for the collector
+	DefaultBufferSize = 1024
+	// sendAttempts is how often an event is offered to the collector, reconnecting in
+	// between, before it is counted failed
+	sendAttempts = 2
+)
+
+// Event is one security or audit event
+type Event struct {
+	Time time.Time
+	// Name identifies the kind of event, e.g. account_locked or auth.token_issued
+	Name     string
+	Severity string
+	// Outcome is success, failure or denied, when the event is an attempted action
+	Outcome string
+	// Actor is who acted: a user ID, client certificate name or API key ID
+	Actor     string
+	SourceIP  string
+	Resource  string
+	RequestID string
+	TraceID   string
+	Message   string
+	// Details adds event-specific context; it must never carry PHI or credentials
+	Details map[string]string
+}
+
+// Config configures an Exporter
+type Config struct {
+	// Endpoint is the collector's host:port; empty disables exporting
+	Endpoint string
+	// Transport is udp, tcp or tls. Defaults to udp.
+	Transport string
+	// Format is cef, leef or syslog. Defaults to cef.
+	Format string
+	// CAFile verifies the collector's certificate over tls; the system roots are used
+	// when it is empty
+	CAFile string
+	// Product and Version name the device in CEF and LEEF headers and are the syslog
+	// APP-NAME
+	Product string
+	Version string
+	// RateLimit and Burst bound how many events a second are sent; events over the
+	// limit are dropped and reported as rate_limited. Default to DefaultRateLimit and
+	// DefaultBurst.
+	RateLimit float64
+	Burst     int
+	// BufferSize caps the events waiting for the collector. Defaults to
+	// DefaultBufferSize.
+	BufferSize int
+	// OnDeliver, if set, is called for every event with its name and delivery result,
+	// for metrics
+	OnDeliver func(event, result string)
+	// OnError, if set, is called when the collector cannot be reached or written to
+	OnError func(err error)
+}
+
+// ConfigFromEnv reads SIEM_ENDPOINT, SIEM_TRANSPORT, SIEM_FORMAT, SIEM_TLS_CA_FILE,
+// SIEM_RATE_LIMIT, SIEM_BURST and SIEM_BUFFER_SIZE for a service's exporter
+func ConfigFromEnv(product, version string) Config {
+	return Config{
+		Endpoint:   config.GetEnv("SIEM_ENDPOINT", ""),
+		Transport:  config.GetEnv("SIEM_TRANSPORT", TransportUDP),
+		Format:     config.GetEnv("SIEM_FORMAT", FormatCEF),
+		CAFile:     config.GetEnv("SIEM_TLS_CA_FILE", ""),
+		Product:    product,
+		Version:    version,
+		RateLimit:  config.GetEnvFloat("SIEM_RATE_LIMIT", DefaultRateLimit),
+		Burst:      config.GetEnvInt("SIEM_BURST", DefaultBurst),
+		BufferSize: config.GetEnvInt("SIEM_BUFFER_SIZE", DefaultBufferSize),
+	}
+}
+
+// ValidateEnv checks the SIEM_* settings, for services' startup validation
+func ValidateEnv(v *config.Validator) {
+	v.OneOf("SIEM_TRANSPORT", TransportUDP, TransportTCP, TransportTLS)
+	v.OneOf("SIEM_FORMAT", FormatCEF, FormatLEEF, FormatSyslog)
+	v.IntRange("SIEM_BURST", 1, 100_000)
+	v.IntRange("SIEM_BUFFER_SIZE", 1, 1_000_000)
+	if endpoint := config.GetEnv("SIEM_ENDPOINT", ""); endpoint != "" {
+		if _, _, err := net.SplitHostPort(endpoint); err != nil {
+			v.Check(fmt.Errorf("SIEM_ENDPOINT must be host:port, got %q", endpoint))
+		}
+	}
+	if limit := config.GetEnvFloat("SIEM_RATE_LIMIT", DefaultRateLimit); limit <= 0 {
+		v.Check(errors.New("SIEM_RATE_LIMIT must be above 0"))
+	}
+}
+
+// Stats counts what an Exporter has done with its events
+type Stats struct {
+	Sent        int64 `json:"sent"`
+	Failed      int64 `json:"failed"`
+	RateLimited int64 `json:"rate_limited"`
+	QueueFull   int64 `json:"queue_full"`
+}
+
+// Exporter sends events to a SIEM collector. A nil Exporter discards events, so code
+// paths can export whether or not a collector is configured.
+type Exporter struct {
+	cfg       Config
+	hostname  string
+	tlsConfig *tls.Config
+	limiter   *rate.Limiter
+	dial      func(ctx context.Context) (net.Conn, error)
+
+	queue chan Event
+	done  chan struct{}
+	once  sync.Once
+	// mu is held to enqueue and to close the queue, so Send never sends on it closed
+	mu     sync.RWMutex
+	closed bool
+	// conn is only used by the sender goroutine
+	conn net.Conn
+
+	sent, failed, rateLimited, queueFull atomic.Int64
+}
+
+// New creates an exporter for cfg and starts its sender. It returns nil, which
+// discards events, when cfg has no endpoint. The collector is connected to on first
+// use and reconnected after any error.
+func New(cfg Config) (*Exporter, error) {
+	if cfg.Endpoint == "" {
+		return nil, nil
+	}
+	if _, _, err := net.SplitHostPort(cfg.Endpoint); err != nil {
+		return nil, fmt.Errorf("siem endpoint must be host:port: %w", err)
+	}
+	if cfg.Transport == "" {
+		cfg.Transport = TransportUDP
+	}
+	if cfg.Format == "" {
+		cfg.Format = FormatCEF
+	}
+	switch cfg.Format {
+	case FormatCEF, FormatLEEF, FormatSyslog:
+	default:
+		return nil, fmt.Errorf("unknown siem format %q: use cef, leef or syslog", cfg.Format)
+	}
+	if cfg.RateLimit <= 0 {
+		cfg.RateLimit = DefaultRateLimit
+	}
+	if cfg.Burst <= 0 {
+		cfg.Burst = DefaultBurst
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = DefaultBufferSize
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "-"
+	}
+	e := &Exporter{
+		cfg:      cfg,
+		hostname: hostname,
+		limiter:  rate.NewLimiter(rate.Limit(cfg.RateLimit), cfg.Burst),
+		queue:    make(chan Event, cfg.BufferSize),
+		done:     make(chan struct{}),
+	}
+
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	switch cfg.Transport {
+	case TransportUDP, TransportTCP:
+		e.dial = func(ctx context.Context) (net.Conn, error) {
+			return dialer.DialContext(ctx, cfg.Transport, cfg.Endpoint)
+		}
+	case TransportTLS:
+		host, _, _ := net.SplitHostPort(cfg.Endpoint)
+		e.tlsConfig = &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+		if cfg.CAFile != "" {
+			pem, err := os.ReadFile(cfg.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("read SIEM_TLS_CA_FILE: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("SIEM_TLS_CA_FILE %s holds no certificates", cfg.CAFile)
+			}
+			e.tlsConfig.RootCAs = pool
+		}
+		e.dial = func(ctx context.Context) (net.Conn, error) {
+			td := &tls.Dialer{NetDialer: dialer, Config: e.tlsConfig}
+			return td.DialContext(ctx, "tcp", cfg.Endpoint)
+		}
+	default:
+		return nil, fmt.Errorf("unknown siem transport %q: use udp, tcp or tls", cfg.Transport)
+	}
+
+	go e.run()
+	return e, nil
+}
+
+// Send queues an event, filling in its time and severity (info) when they are empty.
+// It never blocks: events over the rate limit or that find the queue full are
+// dropped and reported.
+func (e *Exporter) Send(ev Event) {
+	if e == nil {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now().UTC()
+	}
+	if ev.Severity == "" {
+		ev.Severity = SeverityInfo
+	}
+	if !e.limiter.Allow() {
+		e.rateLimited.Add(1)
+		e.deliver(ev.Name, ResultRateLimited)
+		return
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if !e.closed {
+		select {
+		case e.queue <- ev:
+			return
+		default:
+		}
+	}
+	e.queueFull.Add(1)
+	e.deliver(ev.Name, ResultQueueFull)
+}
+
+// SendAudit forwards an audit event; pass it as audit.Config.Forward
+func (e *Exporter) SendAudit(ev audit.Event) {
+	if e == nil {
+		return
+	}
+	severity := SeverityInfo
+	switch ev.Outcome {
+	case audit.OutcomeDenied, audit.OutcomeFailure:
+		severity = SeverityWarning
+	}
+	e.Send(Event{
+		Time:      ev.Time,
+		Name:      ev.Action,
+		Severity:  severity,
+		Outcome:   ev.Outcome,
+		Actor:     ev.Actor,
+		SourceIP:  ev.SourceIP,
+		Resource:  ev.Resource,
+		RequestID: ev.RequestID,
+		TraceID:   ev.TraceID,
+		Details:   ev.Details,
+	})
+}
+
+// run sends queued events until the queue is closed
+func (e *Exporter) run() {
+	defer close(e.done)
+	defer func() {
+		if e.conn != nil {
+			e.conn.Close()
+		}
+	}()
+	for ev := range e.queue {
+		e.send(ev)
+	}
+}
+
+// send writes one event, reconnecting and retrying once if the connection fails
+func (e *Exporter) send(ev Event) {
+	frame := e.frame(e.format(ev))
+	var err error
+	for attempt := 0; attempt < sendAttempts; attempt++ {
+		if err = e.write(frame); err == nil {
+			e.sent.Add(1)
+			e.deliver(ev.Name, ResultSent)
+			return
+		}
+		if e.conn != nil {
+			e.conn.Close()
+			e.conn = nil
+		}
+	}
+	if e.cfg.OnError != nil {
+		e.cfg.OnError(err)
+	}
+	e.failed.Add(1)
+	e.deliver(ev.Name, ResultFailed)
+}
+
+func (e *Exporter) write(frame []byte) error {
+	if e.conn == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		conn, err := e.dial(ctx)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("connect to siem collector %s: %w", e.cfg.Endpoint, err)
+		}
+		e.conn = conn
+	}
+	if err := e.conn.SetWriteDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		return err
+	}
+	if _, err := e.conn.Write(frame); err != nil {
+		return fmt.Errorf("write to siem collector %s: %w", e.cfg.Endpoint, err)
+	}
+	return nil
+}
+
+// frame prefixes a message with its length on stream transports
+func (e *Exporter) frame(msg string) []byte {
+	if e.cfg.Transport == TransportUDP {
+		return []byte(msg)
+	}
+	return []byte(fmt.Sprintf("%d %s", len(msg), msg))
+}
+
+func (e *Exporter) deliver(event, result string) {
+	if e.cfg.OnDeliver != nil {
+		e.cfg.OnDeliver(event, result)
+	}
+}
+
+// Stats returns the exporter's counts
+func (e *Exporter) Stats() Stats {
+	if e == nil {
+		return Stats{}
+	}
+	return Stats{
+		Sent:        e.sent.Load(),
+		Failed:      e.failed.Load(),
+		RateLimited: e.rateLimited.Load(),
+		QueueFull:   e.queueFull.Load(),
+	}
+}
+
+// Close sends the queued events and closes the connection. Events sent after Close
+// are dropped. If ctx ends first, Close returns and the sender carries on with the
+// events still queued.
+func (e *Exporter) Close(ctx context.Context) error {
+	if e == nil {
+		return nil
+	}
+	e.once.Do(func() {
+		e.mu.Lock()
+		e.closed = true
+		close(e.queue)
+		e.mu.Unlock()
+	})
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("siem events not flushed: %w", ctx.Err())
+	}
+}
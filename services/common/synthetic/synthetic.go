@@ -0,0 +1,208 @@
+// Package synthetic marks records created by tests, load generators and demos so
+// shared environments can expire them. A client flags a request as synthetic with the
+// X-Synthetic-Data header; the service stamps the records it creates with a Marker
+// carrying an expiry, and a Janitor in each service reclaims expired records.
+package synthetic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/healthcare-gitops/common/config"
+)
+
+// Request headers that mark a request's records as synthetic
+const (
+	// HeaderSynthetic is set to true on requests creating synthetic records
+	HeaderSynthetic = "X-Synthetic-Data"
+	// HeaderTTL overrides the default lifetime, as a Go duration such as 6h
+	HeaderTTL = "X-Synthetic-TTL"
+	// HeaderOrigin names what created the records, such as a test suite
+	HeaderOrigin = "X-Synthetic-Origin"
+)
+
+// Default lifetimes, overridable with SYNTHETIC_TTL_HOURS and SYNTHETIC_TTL_MAX_HOURS
+const (
+	DefaultTTL    = 24 * time.Hour
+	DefaultMaxTTL = 7 * 24 * time.Hour
+)
+
+// ErrInvalidTTL is returned for an X-Synthetic-TTL that is not a positive duration
+// within the policy's maximum
+var ErrInvalidTTL = errors.New("invalid synthetic data TTL")
+
+// Marker is embedded in records that may be synthetic. Real records leave it empty.
+type Marker struct {
+	Synthetic bool   `json:"synthetic,omitempty"`
+	Origin    string `json:"synthetic_origin,omitempty"`
+	// ExpiresAt is when the record may be reclaimed; nil keeps it until its creator
+	// removes it
+	ExpiresAt *time.Time `json:"synthetic_expires_at,omitempty"`
+}
+
+// Expired reports whether a synthetic record is past its expiry
+func (m Marker) Expired(now time.Time) bool {
+	return m.Synthetic && m.ExpiresAt != nil && !now.Before(*m.ExpiresAt)
+}
+
+// Policy bounds the lifetime of synthetic records
+type Policy struct {
+	DefaultTTL time.Duration
+	MaxTTL     time.Duration
+}
+
+// PolicyFromEnv reads SYNTHETIC_TTL_HOURS and SYNTHETIC_TTL_MAX_HOURS
+func PolicyFromEnv() Policy {
+	p := Policy{
+		DefaultTTL: time.Duration(config.GetEnvInt("SYNTHETIC_TTL_HOURS", int(DefaultTTL/time.Hour))) * time.Hour,
+		MaxTTL:     time.Duration(config.GetEnvInt("SYNTHETIC_TTL_MAX_HOURS", int(DefaultMaxTTL/time.Hour))) * time.Hour,
+	}
+	if p.DefaultTTL <= 0 {
+		p.DefaultTTL = DefaultTTL
+	}
+	if p.MaxTTL < p.DefaultTTL {
+		p.MaxTTL = p.DefaultTTL
+	}
+	return p
+}
+
+// Mark returns a marker for a synthetic record created now that expires after ttl,
+// or after the default TTL when ttl is zero
+func (p Policy) Mark(origin string, ttl time.Duration, now time.Time) Marker {
+	if ttl <= 0 {
+		ttl = p.DefaultTTL
+	}
+	expires := now.Add(ttl).UTC()
+	return Marker{Synthetic: true, Origin: origin, ExpiresAt: &expires}
+}
+
+// FromRequest returns the marker for records created by r: empty unless
+// X-Synthetic-Data is true
+func (p Policy) FromRequest(r *http.Request, now time.Time) (Marker, error) {
+	synthetic, _ := strconv.ParseBool(r.Header.Get(HeaderSynthetic))
+	if !synthetic {
+		return Marker{}, nil
+	}
+	var ttl time.Duration
+	if value := r.Header.Get(HeaderTTL); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 || parsed > p.MaxTTL {
+			return Marker{}, fmt.Errorf("%w: %s must be a duration up to %s", ErrInvalidTTL, HeaderTTL, p.MaxTTL)
+		}
+		ttl = parsed
+	}
+	return p.Mark(r.Header.Get(HeaderOrigin), ttl, now), nil
+}
+
+// ReclaimFunc deletes a store's expired synthetic records and returns how many it removed
+type ReclaimFunc func(now time.Time) int
+
+// Sweep is the outcome of one cleanup run
+type Sweep struct {
+	At time.Time `json:"at"`
+	// Reclaimed counts removed records by kind
+	Reclaimed map[string]int `json:"reclaimed"`
+	Total     int            `json:"total"`
+}
+
+// Janitor reclaims expired synthetic records from every store registered with it
+type Janitor struct {
+	onReclaim func(kind string, n int)
+
+	mu         sync.Mutex
+	reclaimers map[string]ReclaimFunc
+	last       *Sweep
+}
+
+// NewJanitor creates a janitor. onReclaim, if set, is called after each sweep for
+// every kind that had records removed, for metrics.
+func NewJanitor(onReclaim func(kind string, n int)) *Janitor {
+	return &Janitor{onReclaim: onReclaim, reclaimers: make(map[string]ReclaimFunc)}
+}
+
+// Register adds a store of records of the given kind
+func (j *Janitor) Register(kind string, reclaim ReclaimFunc) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.reclaimers[kind] = reclaim
+}
+
+// Sweep runs every registered reclaimer once
+func (j *Janitor) Sweep(now time.Time) Sweep {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	kinds := make([]string, 0, len(j.reclaimers))
+	for kind := range j.reclaimers {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	sweep := Sweep{At: now.UTC(), Reclaimed: make(map[string]int, len(kinds))}
+	for _, kind := range kinds {
+		n := j.reclaimers[kind](now)
+		sweep.Reclaimed[kind] = n
+		sweep.Total += n
+		if n > 0 && j.onReclaim != nil {
+			j.onReclaim(kind, n)
+		}
+	}
+	j.last = &sweep
+	return sweep
+}
+
+// Last returns the most recent sweep, if any
+func (j *Janitor) Last() (Sweep, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.last == nil {
+		return Sweep{}, false
+	}
+	return *j.last, true
+}
+
+// Run sweeps on an interval until ctx is done
+func (j *Janitor) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			j.Sweep(now)
+		}
+	}
+}
+
+// Handler runs a sweep on POST and reports the last sweep on GET, so a cleanup job
+// can drive every service through the same endpoint
+func (j *Janitor) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var sweep Sweep
+		switch r.Method {
+		case http.MethodPost:
+			sweep = j.Sweep(time.Now())
+		case http.MethodGet:
+			last, ok := j.Last()
+			if !ok {
+				http.Error(w, "no cleanup has run yet", http.StatusNotFound)
+				return
+			}
+			sweep = last
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sweep)
+	}
+}
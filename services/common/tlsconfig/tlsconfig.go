@@ -0,0 +1,290 @@
+// Package tlsconfig loads the optional TLS and mutual TLS settings shared by the
+// services' HTTP servers. With TLS_CERT_FILE and TLS_KEY_FILE set a server only speaks
+// TLS 1.2 or later; adding TLS_CLIENT_CA_FILE makes it verify client certificates
+// against that CA, so only workloads holding a certificate from the internal CA can
+// connect. Middleware puts the verified client's identity in the request context, and
+// Client gives outgoing calls to other services the same certificate.
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/healthcare-gitops/common/config"
+)
+
+// Client certificate policies for TLS_CLIENT_AUTH
+const (
+	// ClientAuthRequire refuses connections without a certificate signed by the CA
+	ClientAuthRequire = "require"
+	// ClientAuthVerifyIfGiven verifies certificates that are presented but accepts
+	// connections without one, for probes and clients being migrated
+	ClientAuthVerifyIfGiven = "verify_if_given"
+)
+
+// ErrUnknownClientAuth is returned for a TLS_CLIENT_AUTH that is neither policy
+var ErrUnknownClientAuth = errors.New("unknown client certificate policy")
+
+// Config holds a server's TLS settings
+type Config struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile is the CA client certificates must chain to; empty disables
+	// mutual TLS. Outgoing calls also trust it for the servers they reach.
+	ClientCAFile string
+	// ClientAuth is ClientAuthRequire (the default) or ClientAuthVerifyIfGiven
+	ClientAuth string
+	// AllowedClients, when set, limits clients to certificates whose common name,
+	// DNS or URI SAN is listed
+	AllowedClients []string
+}
+
+// FromEnv reads TLS_CERT_FILE, TLS_KEY_FILE, TLS_CLIENT_CA_FILE, TLS_CLIENT_AUTH and
+// TLS_ALLOWED_CLIENTS (comma-separated)
+func FromEnv() Config {
+	cfg := Config{
+		CertFile:     config.GetEnv("TLS_CERT_FILE", ""),
+		KeyFile:      config.GetEnv("TLS_KEY_FILE", ""),
+		ClientCAFile: config.GetEnv("TLS_CLIENT_CA_FILE", ""),
+		ClientAuth:   config.GetEnv("TLS_CLIENT_AUTH", ClientAuthRequire),
+	}
+	for _, name := range strings.Split(config.GetEnv("TLS_ALLOWED_CLIENTS", ""), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			cfg.AllowedClients = append(cfg.AllowedClients, name)
+		}
+	}
+	return cfg
+}
+
+// Enabled reports whether the server speaks TLS
+func (c Config) Enabled() bool {
+	return c.CertFile != "" && c.KeyFile != ""
+}
+
+// MutualTLS reports whether the server verifies client certificates
+func (c Config) MutualTLS() bool {
+	return c.Enabled() && c.ClientCAFile != ""
+}
+
+// Server builds the server's TLS configuration. The key pair is reread when the
+// certificate file changes, so rotated certificates are picked up without a restart.
+func (c Config) Server() (*tls.Config, error) {
+	pair, err := newKeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return pair.get() },
+	}
+	if c.ClientCAFile == "" {
+		return cfg, nil
+	}
+	if cfg.ClientCAs, err = loadPool(c.ClientCAFile); err != nil {
+		return nil, err
+	}
+	switch c.ClientAuth {
+	case ClientAuthRequire, "":
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	case ClientAuthVerifyIfGiven:
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnknownClientAuth, c.ClientAuth)
+	}
+	if len(c.AllowedClients) > 0 {
+		allowed := make(map[string]bool, len(c.AllowedClients))
+		for _, name := range c.AllowedClients {
+			allowed[name] = true
+		}
+		cfg.VerifyConnection = func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return nil
+			}
+			id := Identify(state.PeerCertificates[0])
+			for _, name := range id.names() {
+				if allowed[name] {
+					return nil
+				}
+			}
+			return fmt.Errorf("client certificate %q is not in TLS_ALLOWED_CLIENTS", id.Name())
+		}
+	}
+	return cfg, nil
+}
+
+// Client builds the TLS configuration for calls to other services: it presents the
+// service's own certificate and trusts the internal CA. It returns nil, so the
+// defaults apply, when TLS is off.
+func (c Config) Client() (*tls.Config, error) {
+	if !c.Enabled() {
+		return nil, nil
+	}
+	pair, err := newKeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{
+		MinVersion:           tls.VersionTLS12,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) { return pair.get() },
+	}
+	if c.ClientCAFile != "" {
+		if cfg.RootCAs, err = loadPool(c.ClientCAFile); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// HTTPClient returns a client for calls to other services using Client's settings
+func (c Config) HTTPClient(timeout time.Duration) (*http.Client, error) {
+	tlsCfg, err := c.Client()
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsCfg
+	return &http.Client{Timeout: timeout, Transport: transport}, nil
+}
+
+// ListenAndServe serves srv over TLS when cfg is enabled and over plain HTTP otherwise
+func ListenAndServe(srv *http.Server, cfg Config) error {
+	if !cfg.Enabled() {
+		return srv.ListenAndServe()
+	}
+	tlsCfg, err := cfg.Server()
+	if err != nil {
+		return err
+	}
+	srv.TLSConfig = tlsCfg
+	return srv.ListenAndServeTLS("", "")
+}
+
+func loadPool(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates in CA file %s", file)
+	}
+	return pool, nil
+}
+
+// keyPair is a certificate and key reloaded when the certificate file changes
+type keyPair struct {
+	certFile, keyFile string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func newKeyPair(certFile, keyFile string) (*keyPair, error) {
+	p := &keyPair{certFile: certFile, keyFile: keyFile}
+	if _, err := p.get(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// get returns the current pair, keeping the last good one if a reload fails midway
+// through a rotation
+func (p *keyPair) get() (*tls.Certificate, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	info, err := os.Stat(p.certFile)
+	if err != nil {
+		if p.cert != nil {
+			return p.cert, nil
+		}
+		return nil, fmt.Errorf("read certificate: %w", err)
+	}
+	if p.cert != nil && info.ModTime().Equal(p.modTime) {
+		return p.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(p.certFile, p.keyFile)
+	if err != nil {
+		if p.cert != nil {
+			return p.cert, nil
+		}
+		return nil, fmt.Errorf("load key pair: %w", err)
+	}
+	p.cert, p.modTime = &cert, info.ModTime()
+	return p.cert, nil
+}
+
+// ClientIdentity is the verified certificate a client connected with
+type ClientIdentity struct {
+	CommonName string    `json:"common_name,omitempty"`
+	DNSNames   []string  `json:"dns_names,omitempty"`
+	URIs       []string  `json:"uris,omitempty"`
+	Issuer     string    `json:"issuer"`
+	Serial     string    `json:"serial"`
+	NotAfter   time.Time `json:"not_after"`
+}
+
+// Identify reads the identity of a client certificate
+func Identify(cert *x509.Certificate) ClientIdentity {
+	id := ClientIdentity{
+		CommonName: cert.Subject.CommonName,
+		DNSNames:   cert.DNSNames,
+		Issuer:     cert.Issuer.CommonName,
+		Serial:     cert.SerialNumber.Text(16),
+		NotAfter:   cert.NotAfter,
+	}
+	for _, uri := range cert.URIs {
+		id.URIs = append(id.URIs, uri.String())
+	}
+	return id
+}
+
+// Name is the most specific name the certificate carries: a URI SAN such as a SPIFFE
+// ID, then a DNS SAN, then the common name
+func (id ClientIdentity) Name() string {
+	if names := id.names(); len(names) > 0 {
+		return names[0]
+	}
+	return ""
+}
+
+func (id ClientIdentity) names() []string {
+	names := append(append([]string(nil), id.URIs...), id.DNSNames...)
+	if id.CommonName != "" {
+		names = append(names, id.CommonName)
+	}
+	return names
+}
+
+type identityContextKey struct{}
+
+// WithIdentity returns a copy of ctx carrying id
+func WithIdentity(ctx context.Context, id ClientIdentity) context.Context {
+	return context.WithValue(ctx, identityContextKey{}, id)
+}
+
+// FromContext returns the client identity Middleware stored for the request
+func FromContext(ctx context.Context) (ClientIdentity, bool) {
+	id, ok := ctx.Value(identityContextKey{}).(ClientIdentity)
+	return id, ok
+}
+
+// Middleware records the verified client certificate's identity in the request
+// context. Requests without one, over plain HTTP or from clients that presented no
+// certificate, pass through unchanged.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+			r = r.WithContext(WithIdentity(r.Context(), Identify(r.TLS.VerifiedChains[0][0])))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
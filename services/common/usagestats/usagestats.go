@@ -0,0 +1,257 @@
+// Package usagestats reports anonymous usage telemetry from self-hosted installs to the
+// platform team. Reporting is opt-in (USAGE_STATS_ENABLED) and the payload is a fixed
+// allowlist of fields: the service, its API version, the Go runtime, uptime, which
+// features are on and how many requests each has served. Nothing from a request is
+// ever included, so no PHI can leave the install. Every service serves the exact
+// payload it would send, enabled or not, so operators can inspect it before opting in.
+package usagestats
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/healthcare-gitops/common/config"
+	"github.com/healthcare-gitops/common/features"
+)
+
+// SchemaVersion is bumped whenever a field is added to Report
+const SchemaVersion = 1
+
+// DefaultInterval is how often an enabled reporter sends, overridable with
+// USAGE_STATS_INTERVAL_HOURS
+const DefaultInterval = 24 * time.Hour
+
+// Fields lists every field a report can carry. It is the allowlist: Report has no
+// other fields, and the preview endpoint publishes it so operators can review it.
+var Fields = []string{
+	"schema", "install_id", "service", "version", "go_version", "os", "arch",
+	"uptime_hours", "features", "feature_usage", "generated_at",
+}
+
+// ErrDisabled is returned by Send when reporting is off or has no endpoint
+var ErrDisabled = errors.New("usage stats reporting is disabled")
+
+var (
+	installIDPattern = regexp.MustCompile(`^[A-Za-z0-9-]{8,64}$`)
+	versionPattern   = regexp.MustCompile(`^[0-9]+\.[0-9]+\.[0-9]+$`)
+	// featurePattern admits flag names only; map keys are the one free-form part of a
+	// report, so anything else is dropped
+	featurePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+)
+
+// Report is one usage report. Add a field only together with Fields and SchemaVersion.
+type Report struct {
+	Schema int `json:"schema"`
+	// InstallID groups reports from one install; it is random, not derived from the host
+	InstallID    string           `json:"install_id"`
+	Service      string           `json:"service"`
+	Version      string           `json:"version"`
+	GoVersion    string           `json:"go_version"`
+	OS           string           `json:"os"`
+	Arch         string           `json:"arch"`
+	UptimeHours  int64            `json:"uptime_hours"`
+	Features     map[string]bool  `json:"features"`
+	FeatureUsage map[string]int64 `json:"feature_usage"`
+	GeneratedAt  time.Time        `json:"generated_at"`
+}
+
+// Config configures a Reporter
+type Config struct {
+	// Enabled opts in to sending; the preview is served either way
+	Enabled  bool
+	Endpoint string
+	Interval time.Duration
+	// InstallID is shared by an install's services so their reports can be grouped;
+	// a random ID is used when it is empty or not 8-64 letters, digits and dashes
+	InstallID string
+	// OnSend, if set, is called after every attempt with its error, for logging and
+	// metrics
+	OnSend func(err error)
+}
+
+// ConfigFromEnv reads USAGE_STATS_ENABLED, USAGE_STATS_ENDPOINT,
+// USAGE_STATS_INTERVAL_HOURS and USAGE_STATS_INSTALL_ID
+func ConfigFromEnv() Config {
+	return Config{
+		Enabled:   config.GetEnvBool("USAGE_STATS_ENABLED", false),
+		Endpoint:  config.GetEnv("USAGE_STATS_ENDPOINT", ""),
+		Interval:  time.Duration(config.GetEnvInt("USAGE_STATS_INTERVAL_HOURS", int(DefaultInterval/time.Hour))) * time.Hour,
+		InstallID: config.GetEnv("USAGE_STATS_INSTALL_ID", ""),
+	}
+}
+
+// Source is what a service contributes to its reports
+type Source struct {
+	Service string
+	// Version is the service's OpenAPI spec version
+	Version string
+	Flags   *features.Flags
+}
+
+// Reporter builds and, when enabled, periodically sends a service's usage reports
+type Reporter struct {
+	cfg     Config
+	src     Source
+	client  *http.Client
+	started time.Time
+
+	mu       sync.Mutex
+	lastSent time.Time
+	lastErr  error
+}
+
+// NewReporter creates a reporter for a service
+func NewReporter(cfg Config, src Source) *Reporter {
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultInterval
+	}
+	if !installIDPattern.MatchString(cfg.InstallID) {
+		b := make([]byte, 16)
+		_, _ = rand.Read(b)
+		cfg.InstallID = hex.EncodeToString(b)
+	}
+	return &Reporter{cfg: cfg, src: src, client: &http.Client{Timeout: 10 * time.Second}, started: time.Now()}
+}
+
+// Enabled reports whether the reporter sends reports
+func (r *Reporter) Enabled() bool {
+	return r.cfg.Enabled && r.cfg.Endpoint != ""
+}
+
+// Report builds the payload the next send would carry
+func (r *Reporter) Report(now time.Time) Report {
+	report := Report{
+		Schema:       SchemaVersion,
+		InstallID:    r.cfg.InstallID,
+		Service:      r.src.Service,
+		GoVersion:    runtime.Version(),
+		OS:           runtime.GOOS,
+		Arch:         runtime.GOARCH,
+		UptimeHours:  int64(now.Sub(r.started) / time.Hour),
+		Features:     map[string]bool{},
+		FeatureUsage: map[string]int64{},
+		GeneratedAt:  now.UTC().Truncate(time.Hour),
+	}
+	if versionPattern.MatchString(r.src.Version) {
+		report.Version = r.src.Version
+	}
+	if r.src.Flags == nil {
+		return report
+	}
+	for name, feature := range r.src.Flags.Features() {
+		if featurePattern.MatchString(name) {
+			report.Features[name] = feature.Enabled
+		}
+	}
+	for name, n := range r.src.Flags.Usage() {
+		if featurePattern.MatchString(name) {
+			report.FeatureUsage[name] = n
+		}
+	}
+	return report
+}
+
+// Send posts a report to the endpoint now
+func (r *Reporter) Send(ctx context.Context) error {
+	if !r.Enabled() {
+		return ErrDisabled
+	}
+	err := r.send(ctx, r.Report(time.Now()))
+	r.mu.Lock()
+	r.lastErr = err
+	if err == nil {
+		r.lastSent = time.Now().UTC()
+	}
+	r.mu.Unlock()
+	if r.cfg.OnSend != nil {
+		r.cfg.OnSend(err)
+	}
+	return err
+}
+
+func (r *Reporter) send(ctx context.Context, report Report) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("usage stats endpoint returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Run sends a report every interval until ctx is done. It returns at once when
+// reporting is disabled.
+func (r *Reporter) Run(ctx context.Context) {
+	if !r.Enabled() {
+		return
+	}
+	ticker := time.NewTicker(r.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_ = r.Send(ctx)
+		}
+	}
+}
+
+// Preview is what the preview endpoint serves
+type Preview struct {
+	Enabled         bool       `json:"enabled"`
+	Endpoint        string     `json:"endpoint,omitempty"`
+	IntervalSeconds int64      `json:"interval_seconds"`
+	LastSentAt      *time.Time `json:"last_sent_at,omitempty"`
+	LastError       string     `json:"last_error,omitempty"`
+	// Fields is the allowlist every report is limited to
+	Fields  []string `json:"fields"`
+	Payload Report   `json:"payload"`
+}
+
+// Handler serves a preview of the next report and the reporter's state
+func (r *Reporter) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		preview := Preview{
+			Enabled:         r.Enabled(),
+			Endpoint:        r.cfg.Endpoint,
+			IntervalSeconds: int64(r.cfg.Interval.Seconds()),
+			Fields:          append([]string(nil), Fields...),
+			Payload:         r.Report(time.Now()),
+		}
+		r.mu.Lock()
+		if !r.lastSent.IsZero() {
+			sent := r.lastSent
+			preview.LastSentAt = &sent
+		}
+		if r.lastErr != nil {
+			preview.LastError = r.lastErr.Error()
+		}
+		r.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		json.NewEncoder(w).Encode(preview)
+	}
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrAlertAlreadyAcknowledged is returned when acknowledging an alert twice
+var ErrAlertAlreadyAcknowledged = errors.New("alert already acknowledged")
+
+// defaultShiftLength is how far back the handoff summary looks for notes
+const defaultShiftLength = 12 * time.Hour
+
+// Note is free-text clinical commentary left by a user
+type Note struct {
+	ID        string    `json:"id"`
+	Author    string    `json:"author"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
+	// Unit and DeviceID are set on unit-level incident notes not tied to an alert
+	Unit     string `json:"unit,omitempty"`
+	DeviceID string `json:"device_id,omitempty"`
+	AlertID  string `json:"alert_id,omitempty"`
+}
+
+// UnitHandoff lists the unresolved work for one care unit
+type UnitHandoff struct {
+	Unit           string  `json:"unit"`
+	Unacknowledged []Alert `json:"unacknowledged_alerts"`
+	Acknowledged   []Alert `json:"acknowledged_alerts"`
+	Notes          []Note  `json:"notes"`
+}
+
+// unitFromLocation derives the care unit from a device location such as
+// "ICU - Room 305"; locations without a separator are used as-is
+func unitFromLocation(location string) string {
+	unit, _, _ := strings.Cut(location, " - ")
+	return strings.TrimSpace(unit)
+}
+
+// requestUser identifies the clinician making the request. The gateway forwards the
+// authenticated user in X-User-ID; a body-supplied user is accepted as a fallback.
+func requestUser(r *http.Request, fallback string) string {
+	if user := strings.TrimSpace(r.Header.Get("X-User-ID")); user != "" {
+		return user
+	}
+	return strings.TrimSpace(fallback)
+}
+
+// GetAlert returns a copy of an alert by ID
+func (dr *DeviceRegistry) GetAlert(alertID string) (Alert, error) {
+	dr.mu.RLock()
+	defer dr.mu.RUnlock()
+
+	alert, exists := dr.alerts[alertID]
+	if !exists {
+		return Alert{}, fmt.Errorf("alert %s not found", alertID)
+	}
+	return *alert, nil
+}
+
+// AcknowledgeAlert records who acknowledged an alert and when. Acknowledging after the
+// deadline still counts as an SLA breach.
+func (dr *DeviceRegistry) AcknowledgeAlert(alertID, user string, now time.Time) (Alert, error) {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+
+	alert, exists := dr.alerts[alertID]
+	if !exists {
+		return Alert{}, fmt.Errorf("alert %s not found", alertID)
+	}
+	if alert.AcknowledgedAt != nil {
+		return *alert, ErrAlertAlreadyAcknowledged
+	}
+
+	acknowledgedAt := now
+	alert.AcknowledgedAt = &acknowledgedAt
+	alert.AcknowledgedBy = user
+	if !alert.SLABreached && now.After(alert.AckDeadline) {
+		breachedAt := alert.AckDeadline
+		alert.SLABreached = true
+		alert.BreachedAt = &breachedAt
+	}
+
+	return *alert, nil
+}
+
+// AddAlertNote attaches a note to an alert
+func (dr *DeviceRegistry) AddAlertNote(alertID, author, text string, now time.Time) (Note, error) {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+
+	alert, exists := dr.alerts[alertID]
+	if !exists {
+		return Note{}, fmt.Errorf("alert %s not found", alertID)
+	}
+
+	dr.noteSeq++
+	note := Note{
+		ID:        fmt.Sprintf("NOTE-%06d", dr.noteSeq),
+		Author:    author,
+		Text:      text,
+		CreatedAt: now,
+		AlertID:   alertID,
+	}
+	alert.Notes = append(alert.Notes, note)
+	return note, nil
+}
+
+// AddUnitNote records a handoff note for a care unit, optionally about a device
+func (dr *DeviceRegistry) AddUnitNote(unit, deviceID, author, text string, now time.Time) Note {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+
+	dr.noteSeq++
+	note := Note{
+		ID:        fmt.Sprintf("NOTE-%06d", dr.noteSeq),
+		Author:    author,
+		Text:      text,
+		CreatedAt: now,
+		Unit:      unit,
+		DeviceID:  deviceID,
+	}
+	dr.unitNotes = append(dr.unitNotes, note)
+	return note
+}
+
+// HandoffSummary groups unresolved alerts and recent notes by care unit. An empty
+// unit returns every unit.
+func (dr *DeviceRegistry) HandoffSummary(unit string, since time.Time) []UnitHandoff {
+	dr.mu.RLock()
+	defer dr.mu.RUnlock()
+
+	units := make(map[string]*UnitHandoff)
+	get := func(name string) *UnitHandoff {
+		h, ok := units[name]
+		if !ok {
+			h = &UnitHandoff{
+				Unit:           name,
+				Unacknowledged: make([]Alert, 0),
+				Acknowledged:   make([]Alert, 0),
+				Notes:          make([]Note, 0),
+			}
+			units[name] = h
+		}
+		return h
+	}
+
+	for _, alert := range dr.alerts {
+		alertUnit := unitFromLocation(alert.Location)
+		if alert.ResolvedAt != nil || (unit != "" && !strings.EqualFold(alertUnit, unit)) {
+			continue
+		}
+		h := get(alertUnit)
+		if alert.AcknowledgedAt == nil {
+			h.Unacknowledged = append(h.Unacknowledged, *alert)
+		} else {
+			h.Acknowledged = append(h.Acknowledged, *alert)
+		}
+	}
+
+	for _, note := range dr.unitNotes {
+		if note.CreatedAt.Before(since) || (unit != "" && !strings.EqualFold(note.Unit, unit)) {
+			continue
+		}
+		h := get(note.Unit)
+		h.Notes = append(h.Notes, note)
+	}
+
+	summary := make([]UnitHandoff, 0, len(units))
+	for _, h := range units {
+		sortAlerts(h.Unacknowledged)
+		sortAlerts(h.Acknowledged)
+		summary = append(summary, *h)
+	}
+	sort.Slice(summary, func(i, j int) bool {
+		return summary[i].Unit < summary[j].Unit
+	})
+	return summary
+}
+
+// GetAlertHandler returns a single alert with its notes
+func GetAlertHandler(w http.ResponseWriter, r *http.Request) {
+	alertID := chi.URLParam(r, "alertID")
+	ctx := r.Context()
+	span := trace.SpanFromContext(ctx)
+	start := time.Now()
+
+	alert, err := registry.GetAlert(alertID)
+	if err != nil {
+		http.Error(w, "Alert not found", http.StatusNotFound)
+		RecordDeviceOperation("get_alert", "error", time.Since(start).Seconds())
+		span.RecordError(err)
+		return
+	}
+
+	RecordDeviceOperation("get_alert", "success", time.Since(start).Seconds())
+	span.SetAttributes(attribute.String("alert.id", alertID))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(alert)
+}
+
+// AcknowledgeAlertHandler acknowledges an alert on behalf of the requesting clinician
+func AcknowledgeAlertHandler(w http.ResponseWriter, r *http.Request) {
+	alertID := chi.URLParam(r, "alertID")
+	ctx := r.Context()
+	span := trace.SpanFromContext(ctx)
+	start := time.Now()
+
+	var req struct {
+		User string `json:"user"`
+		Note string `json:"note"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			RecordDeviceOperation("acknowledge_alert", "error", time.Since(start).Seconds())
+			return
+		}
+	}
+
+	user := requestUser(r, req.User)
+	if user == "" {
+		http.Error(w, "User identity is required to acknowledge an alert", http.StatusBadRequest)
+		RecordDeviceOperation("acknowledge_alert", "error", time.Since(start).Seconds())
+		return
+	}
+
+	now := time.Now()
+	alert, err := registry.AcknowledgeAlert(alertID, user, now)
+	if errors.Is(err, ErrAlertAlreadyAcknowledged) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": err.Error(),
+			"alert": alert,
+		})
+		RecordDeviceOperation("acknowledge_alert", "error", time.Since(start).Seconds())
+		return
+	}
+	if err != nil {
+		http.Error(w, "Alert not found", http.StatusNotFound)
+		RecordDeviceOperation("acknowledge_alert", "error", time.Since(start).Seconds())
+		span.RecordError(err)
+		return
+	}
+
+	if strings.TrimSpace(req.Note) != "" {
+		registry.AddAlertNote(alertID, user, req.Note, now)
+		alert, _ = registry.GetAlert(alertID)
+	}
+
+	RecordDeviceOperation("acknowledge_alert", "success", time.Since(start).Seconds())
+	span.SetAttributes(
+		attribute.String("alert.id", alertID),
+		attribute.String("alert.priority", string(alert.Priority)),
+	)
+
+	log.Info().
+		Str("alert_id", alertID).
+		Str("device_id", alert.DeviceID).
+		Str("acknowledged_by", user).
+		Bool("sla_breached", alert.SLABreached).
+		Msg("Alert acknowledged")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(alert)
+}
+
+// AddAlertNoteHandler attaches a free-text note to an alert
+func AddAlertNoteHandler(w http.ResponseWriter, r *http.Request) {
+	alertID := chi.URLParam(r, "alertID")
+	ctx := r.Context()
+	span := trace.SpanFromContext(ctx)
+	start := time.Now()
+
+	var req struct {
+		User string `json:"user"`
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Text) == "" {
+		http.Error(w, "Note text is required", http.StatusBadRequest)
+		RecordDeviceOperation("add_alert_note", "error", time.Since(start).Seconds())
+		return
+	}
+
+	user := requestUser(r, req.User)
+	if user == "" {
+		http.Error(w, "User identity is required to add a note", http.StatusBadRequest)
+		RecordDeviceOperation("add_alert_note", "error", time.Since(start).Seconds())
+		return
+	}
+
+	note, err := registry.AddAlertNote(alertID, user, req.Text, time.Now())
+	if err != nil {
+		http.Error(w, "Alert not found", http.StatusNotFound)
+		RecordDeviceOperation("add_alert_note", "error", time.Since(start).Seconds())
+		span.RecordError(err)
+		return
+	}
+
+	RecordDeviceOperation("add_alert_note", "success", time.Since(start).Seconds())
+	span.SetAttributes(attribute.String("alert.id", alertID))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(note)
+}
+
+// AddHandoffNoteHandler records a unit-level handoff note, e.g. about an ongoing incident
+func AddHandoffNoteHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	var req struct {
+		User     string `json:"user"`
+		Unit     string `json:"unit"`
+		DeviceID string `json:"device_id"`
+		Text     string `json:"text"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Text) == "" {
+		http.Error(w, "Note text is required", http.StatusBadRequest)
+		RecordDeviceOperation("add_handoff_note", "error", time.Since(start).Seconds())
+		return
+	}
+
+	user := requestUser(r, req.User)
+	if user == "" {
+		http.Error(w, "User identity is required to add a note", http.StatusBadRequest)
+		RecordDeviceOperation("add_handoff_note", "error", time.Since(start).Seconds())
+		return
+	}
+
+	unit := strings.TrimSpace(req.Unit)
+	if req.DeviceID != "" {
+		device, err := registry.GetDevice(req.DeviceID)
+		if err != nil {
+			http.Error(w, "Device not found", http.StatusNotFound)
+			RecordDeviceOperation("add_handoff_note", "error", time.Since(start).Seconds())
+			return
+		}
+		if unit == "" {
+			device.mu.RLock()
+			unit = unitFromLocation(device.Location)
+			device.mu.RUnlock()
+		}
+	}
+	if unit == "" {
+		http.Error(w, "unit or device_id is required", http.StatusBadRequest)
+		RecordDeviceOperation("add_handoff_note", "error", time.Since(start).Seconds())
+		return
+	}
+
+	note := registry.AddUnitNote(unit, req.DeviceID, user, req.Text, time.Now())
+
+	RecordDeviceOperation("add_handoff_note", "success", time.Since(start).Seconds())
+	log.Info().Str("note_id", note.ID).Str("unit", unit).Str("author", user).Msg("Handoff note recorded")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(note)
+}
+
+// HandoffSummaryHandler lists unresolved alerts and shift notes per unit.
+// Supports ?unit= and ?since= (RFC 3339, defaults to the last 12 hours).
+func HandoffSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	start := time.Now()
+
+	now := time.Now()
+	since := now.Add(-defaultShiftLength)
+	if value := r.URL.Query().Get("since"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "since must be an RFC 3339 timestamp", http.StatusBadRequest)
+			RecordDeviceOperation("handoff_summary", "error", time.Since(start).Seconds())
+			return
+		}
+		since = parsed
+	}
+
+	summary := registry.HandoffSummary(r.URL.Query().Get("unit"), since)
+
+	RecordDeviceOperation("handoff_summary", "success", time.Since(start).Seconds())
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.Int("handoff.unit_count", len(summary)))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"units":        summary,
+		"since":        since,
+		"generated_at": now,
+	})
+}
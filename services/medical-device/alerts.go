@@ -0,0 +1,404 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/healthcare-gitops/common/config"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// AlertPriority is the clinical alarm priority, following IEC 60601-1-8
+type AlertPriority string
+
+const (
+	PriorityHigh   AlertPriority = "high"
+	PriorityMedium AlertPriority = "medium"
+	PriorityLow    AlertPriority = "low"
+)
+
+// AlertCondition identifies what triggered an alert
+type AlertCondition string
+
+const (
+	ConditionHeartbeatLost  AlertCondition = "heartbeat_lost"
+	ConditionDeviceError    AlertCondition = "device_error"
+	ConditionDeviceOffline  AlertCondition = "device_offline"
+	ConditionDeviceDegraded AlertCondition = "device_degraded"
+
+	// Administrative conditions carry the same priority for every device type
+	ConditionContractExpiring AlertCondition = "contract_expiring"
+)
+
+// Device alert levels, derived from the highest-priority active alert
+const (
+	AlertLevelNone     = "none"
+	AlertLevelCritical = "critical"
+	AlertLevelWarning  = "warning"
+	AlertLevelInfo     = "info"
+)
+
+// alertPriorityMatrix maps device type and condition to a clinical priority.
+// Life-support devices escalate fastest; imaging equipment failing does not put a
+// patient at immediate risk.
+var alertPriorityMatrix = map[DeviceType]map[AlertCondition]AlertPriority{
+	DeviceTypeVentilator: {
+		ConditionHeartbeatLost:  PriorityHigh,
+		ConditionDeviceError:    PriorityHigh,
+		ConditionDeviceOffline:  PriorityHigh,
+		ConditionDeviceDegraded: PriorityMedium,
+	},
+	DeviceTypePump: {
+		ConditionHeartbeatLost:  PriorityHigh,
+		ConditionDeviceError:    PriorityHigh,
+		ConditionDeviceOffline:  PriorityHigh,
+		ConditionDeviceDegraded: PriorityMedium,
+	},
+	DeviceTypeECG: {
+		ConditionHeartbeatLost:  PriorityHigh,
+		ConditionDeviceError:    PriorityHigh,
+		ConditionDeviceOffline:  PriorityMedium,
+		ConditionDeviceDegraded: PriorityLow,
+	},
+	DeviceTypeMRI: {
+		ConditionHeartbeatLost:  PriorityMedium,
+		ConditionDeviceError:    PriorityMedium,
+		ConditionDeviceOffline:  PriorityLow,
+		ConditionDeviceDegraded: PriorityLow,
+	},
+	DeviceTypeCTScanner: {
+		ConditionHeartbeatLost:  PriorityMedium,
+		ConditionDeviceError:    PriorityMedium,
+		ConditionDeviceOffline:  PriorityLow,
+		ConditionDeviceDegraded: PriorityLow,
+	},
+	DeviceTypeXRay: {
+		ConditionHeartbeatLost:  PriorityMedium,
+		ConditionDeviceError:    PriorityMedium,
+		ConditionDeviceOffline:  PriorityLow,
+		ConditionDeviceDegraded: PriorityLow,
+	},
+}
+
+// administrativeConditions are not clinical and never page as high priority
+var administrativeConditions = map[AlertCondition]AlertPriority{
+	ConditionContractExpiring: PriorityLow,
+}
+
+// statusConditions maps device statuses that warrant an alert to their condition
+var statusConditions = map[DeviceStatus]AlertCondition{
+	StatusError:    ConditionDeviceError,
+	StatusOffline:  ConditionDeviceOffline,
+	StatusDegraded: ConditionDeviceDegraded,
+}
+
+// priorityRank orders priorities so the most urgent sorts first
+var priorityRank = map[AlertPriority]int{
+	PriorityHigh:   3,
+	PriorityMedium: 2,
+	PriorityLow:    1,
+}
+
+// Alert is a single clinical alert raised against a device
+type Alert struct {
+	ID             string         `json:"id"`
+	DeviceID       string         `json:"device_id"`
+	DeviceType     DeviceType     `json:"device_type"`
+	Location       string         `json:"location"`
+	Condition      AlertCondition `json:"condition"`
+	Priority       AlertPriority  `json:"priority"`
+	AlertLevel     string         `json:"alert_level"`
+	Message        string         `json:"message"`
+	RaisedAt       time.Time      `json:"raised_at"`
+	AckDeadline    time.Time      `json:"ack_deadline"`
+	AcknowledgedAt *time.Time     `json:"acknowledged_at,omitempty"`
+	AcknowledgedBy string         `json:"acknowledged_by,omitempty"`
+	ResolvedAt     *time.Time     `json:"resolved_at,omitempty"`
+	SLABreached    bool           `json:"sla_breached"`
+	BreachedAt     *time.Time     `json:"breached_at,omitempty"`
+	Notes          []Note         `json:"notes,omitempty"`
+}
+
+// SLAPriorityStats summarizes acknowledgment SLA compliance for one priority
+type SLAPriorityStats struct {
+	Priority     AlertPriority `json:"priority"`
+	SLASeconds   float64       `json:"sla_seconds"`
+	Raised       int           `json:"raised"`
+	Acknowledged int           `json:"acknowledged"`
+	Breached     int           `json:"breached"`
+	OpenBreaches int           `json:"open_breaches"`
+}
+
+// classifyAlert returns the clinical priority for a condition on a device type.
+// Unknown device types are treated as high priority so nothing is under-triaged.
+func classifyAlert(deviceType DeviceType, condition AlertCondition) AlertPriority {
+	if priority, ok := administrativeConditions[condition]; ok {
+		return priority
+	}
+	if conditions, ok := alertPriorityMatrix[deviceType]; ok {
+		if priority, ok := conditions[condition]; ok {
+			return priority
+		}
+	}
+	return PriorityHigh
+}
+
+// alertLevelForPriority maps a clinical priority onto the device alert level
+func alertLevelForPriority(priority AlertPriority) string {
+	switch priority {
+	case PriorityHigh:
+		return AlertLevelCritical
+	case PriorityMedium:
+		return AlertLevelWarning
+	default:
+		return AlertLevelInfo
+	}
+}
+
+// ackSLA returns how long clinicians have to acknowledge an alert of the given priority
+func ackSLA(priority AlertPriority) time.Duration {
+	switch priority {
+	case PriorityHigh:
+		return time.Duration(config.GetEnvInt("ALERT_ACK_SLA_HIGH_SECONDS", 120)) * time.Second
+	case PriorityMedium:
+		return time.Duration(config.GetEnvInt("ALERT_ACK_SLA_MEDIUM_SECONDS", 600)) * time.Second
+	default:
+		return time.Duration(config.GetEnvInt("ALERT_ACK_SLA_LOW_SECONDS", 3600)) * time.Second
+	}
+}
+
+// raiseAlertLocked opens an alert for the device unless one is already active for the
+// same condition. Callers must hold device.mu.
+func (dr *DeviceRegistry) raiseAlertLocked(device *MedicalDevice, condition AlertCondition, message string, now time.Time) *Alert {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+
+	for _, alert := range dr.alerts {
+		if alert.DeviceID == device.ID && alert.Condition == condition && alert.ResolvedAt == nil {
+			return alert
+		}
+	}
+
+	dr.alertSeq++
+	priority := classifyAlert(device.Type, condition)
+	alert := &Alert{
+		ID:          fmt.Sprintf("ALERT-%06d", dr.alertSeq),
+		DeviceID:    device.ID,
+		DeviceType:  device.Type,
+		Location:    device.Location,
+		Condition:   condition,
+		Priority:    priority,
+		AlertLevel:  alertLevelForPriority(priority),
+		Message:     message,
+		RaisedAt:    now,
+		AckDeadline: now.Add(ackSLA(priority)),
+	}
+	dr.alerts[alert.ID] = alert
+	dr.summary.alertRaised(priority, now)
+
+	log.Warn().
+		Str("alert_id", alert.ID).
+		Str("device_id", device.ID).
+		Str("type", string(device.Type)).
+		Str("location", device.Location).
+		Str("condition", string(condition)).
+		Str("priority", string(priority)).
+		Time("ack_deadline", alert.AckDeadline).
+		Msg("Alert raised")
+
+	if condition == ConditionDeviceError {
+		go notifyVendors(vendorEventFor(alert, device))
+	}
+	publishEvent(EventAlertRaised, *alert)
+
+	return alert
+}
+
+// resolveAlertLocked closes the active alert for a device condition, if any.
+// Callers must hold dr.mu.
+func (dr *DeviceRegistry) resolveAlertLocked(deviceID string, condition AlertCondition, now time.Time) {
+	for _, alert := range dr.alerts {
+		if alert.DeviceID != deviceID || alert.Condition != condition || alert.ResolvedAt != nil {
+			continue
+		}
+		// An alert that cleared on its own after the deadline still counts as a breach
+		if alert.AcknowledgedAt == nil && !alert.SLABreached && now.After(alert.AckDeadline) {
+			breachedAt := alert.AckDeadline
+			alert.SLABreached = true
+			alert.BreachedAt = &breachedAt
+		}
+		resolvedAt := now
+		alert.ResolvedAt = &resolvedAt
+		dr.summary.alertClosed(alert.Priority)
+
+		log.Info().
+			Str("alert_id", alert.ID).
+			Str("device_id", deviceID).
+			Str("condition", string(condition)).
+			Msg("Alert resolved")
+	}
+}
+
+// refreshAlertLevelLocked sets the device alert level from its highest-priority
+// active alert. Callers must hold device.mu.
+func (dr *DeviceRegistry) refreshAlertLevelLocked(device *MedicalDevice) {
+	dr.mu.RLock()
+	defer dr.mu.RUnlock()
+
+	highest := 0
+	level := AlertLevelNone
+	for _, alert := range dr.alerts {
+		if alert.DeviceID != device.ID || alert.ResolvedAt != nil {
+			continue
+		}
+		if rank := priorityRank[alert.Priority]; rank > highest {
+			highest = rank
+			level = alert.AlertLevel
+		}
+	}
+	device.AlertLevel = level
+}
+
+// syncStatusAlertsLocked raises or resolves alerts so they match the device's current
+// status. Callers must hold device.mu.
+func (dr *DeviceRegistry) syncStatusAlertsLocked(device *MedicalDevice, now time.Time) {
+	current, alerting := statusConditions[device.Status]
+
+	dr.mu.Lock()
+	for _, condition := range statusConditions {
+		if !alerting || condition != current {
+			dr.resolveAlertLocked(device.ID, condition, now)
+		}
+	}
+	dr.mu.Unlock()
+
+	if alerting {
+		dr.raiseAlertLocked(device, current, fmt.Sprintf("Device reported status %s", device.Status), now)
+	}
+	dr.refreshAlertLevelLocked(device)
+	dr.noteStatusLocked(device)
+}
+
+// syncStatusAlerts is syncStatusAlertsLocked for callers not holding device.mu
+func (dr *DeviceRegistry) syncStatusAlerts(device *MedicalDevice) {
+	device.mu.Lock()
+	defer device.mu.Unlock()
+	dr.syncStatusAlertsLocked(device, time.Now())
+}
+
+// CheckAlertSLAs flags unacknowledged alerts whose acknowledgment deadline has passed.
+// It returns the newly breached alerts.
+func (dr *DeviceRegistry) CheckAlertSLAs(now time.Time) []Alert {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+
+	breached := make([]Alert, 0)
+	for _, alert := range dr.alerts {
+		if alert.SLABreached || alert.AcknowledgedAt != nil || alert.ResolvedAt != nil {
+			continue
+		}
+		if now.After(alert.AckDeadline) {
+			breachedAt := now
+			alert.SLABreached = true
+			alert.BreachedAt = &breachedAt
+			breached = append(breached, *alert)
+
+			log.Error().
+				Str("alert_id", alert.ID).
+				Str("device_id", alert.DeviceID).
+				Str("location", alert.Location).
+				Str("priority", string(alert.Priority)).
+				Time("ack_deadline", alert.AckDeadline).
+				Msg("Alert acknowledgment SLA breached")
+		}
+	}
+
+	return breached
+}
+
+// sortAlerts orders alerts by priority, then oldest first
+func sortAlerts(alerts []Alert) {
+	sort.Slice(alerts, func(i, j int) bool {
+		if priorityRank[alerts[i].Priority] != priorityRank[alerts[j].Priority] {
+			return priorityRank[alerts[i].Priority] > priorityRank[alerts[j].Priority]
+		}
+		return alerts[i].RaisedAt.Before(alerts[j].RaisedAt)
+	})
+}
+
+// SLABreaches returns per-priority SLA statistics and the alerts currently in breach
+func (dr *DeviceRegistry) SLABreaches() ([]SLAPriorityStats, []Alert) {
+	dr.mu.RLock()
+	defer dr.mu.RUnlock()
+
+	stats := map[AlertPriority]*SLAPriorityStats{}
+	for _, priority := range []AlertPriority{PriorityHigh, PriorityMedium, PriorityLow} {
+		stats[priority] = &SLAPriorityStats{
+			Priority:   priority,
+			SLASeconds: ackSLA(priority).Seconds(),
+		}
+	}
+
+	open := make([]Alert, 0)
+	for _, alert := range dr.alerts {
+		s, ok := stats[alert.Priority]
+		if !ok {
+			continue
+		}
+		s.Raised++
+		if alert.AcknowledgedAt != nil {
+			s.Acknowledged++
+		}
+		if alert.SLABreached {
+			s.Breached++
+			if alert.AcknowledgedAt == nil && alert.ResolvedAt == nil {
+				s.OpenBreaches++
+				open = append(open, *alert)
+			}
+		}
+	}
+	sortAlerts(open)
+
+	return []SLAPriorityStats{*stats[PriorityHigh], *stats[PriorityMedium], *stats[PriorityLow]}, open
+}
+
+// startAlertSLAMonitor periodically flags alerts that were not acknowledged in time
+func startAlertSLAMonitor(checkInterval time.Duration) {
+	if checkInterval <= 0 {
+		checkInterval = 15 * time.Second
+	}
+	log.Info().Dur("check_interval", checkInterval).Msg("Starting alert SLA monitor")
+
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		registry.CheckAlertSLAs(now)
+	}
+}
+
+// AlertSLAHandler reports acknowledgment SLA compliance per priority
+func AlertSLAHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	start := time.Now()
+
+	stats, open := registry.SLABreaches()
+
+	duration := time.Since(start).Seconds()
+	RecordDeviceOperation("alert_sla", "success", duration)
+
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.Int("alert.open_breaches", len(open)))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"priorities":    stats,
+		"open_breaches": open,
+		"generated_at":  time.Now(),
+	})
+}
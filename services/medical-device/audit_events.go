@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/healthcare-gitops/common/audit"
+	"github.com/healthcare-gitops/common/tlsconfig"
+	_ "github.com/jackc/pgx/v5/stdlib" // registers the pgx driver for AUDIT_SINK=postgres
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// auditEvents is the shared audit bus device mutations are emitted to
+var auditEvents *audit.Emitter
+
+// configureAuditEvents opens the audit sink AUDIT_SINK selects
+func configureAuditEvents(ctx context.Context) error {
+	cfg := audit.ConfigFromEnv()
+	cfg.TraceID = traceIDFromContext
+	cfg.OnWrite = func(events int, err error) {
+		if err != nil {
+			log.Warn().Err(err).Int("events", events).Msg("Audit sink unavailable, events written to stderr")
+		}
+	}
+	emitter, err := audit.Open(ctx, "medical-device-service", cfg)
+	if err != nil {
+		return err
+	}
+	auditEvents = emitter
+	return nil
+}
+
+// traceIDFromContext returns the trace ID of the request's span
+func traceIDFromContext(ctx context.Context) string {
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		return sc.TraceID().String()
+	}
+	return ""
+}
+
+// auditMiddleware emits an audit event to events for every mutating request, named
+// by its method and route pattern
+func auditMiddleware(events *audit.Emitter) func(http.Handler) http.Handler {
+	return events.Middleware(audit.MiddlewareOptions{
+		Action: func(r *http.Request) string {
+			if rc := chi.RouteContext(r.Context()); rc != nil && rc.RoutePattern() != "" {
+				return r.Method + " " + rc.RoutePattern()
+			}
+			return r.Method + " " + r.URL.Path
+		},
+		Actor: func(r *http.Request) string {
+			if id, ok := tlsconfig.FromContext(r.Context()); ok {
+				return id.Name()
+			}
+			return ""
+		},
+		RequestID: func(r *http.Request) string {
+			return middleware.GetReqID(r.Context())
+		},
+	})
+}
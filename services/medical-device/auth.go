@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/healthcare-gitops/common/auth"
+	"github.com/healthcare-gitops/common/resilience"
+	"github.com/healthcare-gitops/common/tlsconfig"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog/log"
+)
+
+// Bearer token introspections answered from the cache or by auth-service
+var authCacheLookups = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "medical_device_auth_cache_lookups_total",
+		Help: "Token introspection cache lookups by result",
+	},
+	[]string{"result"},
+)
+
+// newIntrospector validates bearer tokens against auth-service at AUTH_INTROSPECT_URL.
+// Without it the API is unauthenticated. With TLS configured, calls to auth-service
+// present this service's certificate.
+func newIntrospector(tlsCfg tlsconfig.Config) *auth.Introspector {
+	cfg := auth.ConfigFromEnv()
+	if cfg.IntrospectURL == "" {
+		log.Warn().Msg("AUTH_INTROSPECT_URL not set, device API is not authenticated")
+		return nil
+	}
+	cfg.OnCacheLookup = func(result string) {
+		authCacheLookups.WithLabelValues(result).Inc()
+	}
+	if tlsCfg.Enabled() {
+		client, err := tlsCfg.HTTPClient(5 * time.Second)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid TLS configuration")
+		}
+		cfg.HTTPClient = client
+	}
+	addDependencyCheck(dependencyAuthService, cfg.IntrospectURL, cfg.HTTPClient)
+	cfg.HTTPClient = resilience.ClientFromEnv(dependencyAuthService, cfg.HTTPClient, 5*time.Second, recordBreakerState)
+	return auth.NewIntrospector(cfg)
+}
+
+// requireDeviceScope requires device:read for reads and device:write for changes
+func requireDeviceScope(authn *auth.Introspector) func(http.Handler) http.Handler {
+	read, write := authn.Require("device:read"), authn.Require("device:write")
+	return func(next http.Handler) http.Handler {
+		readNext, writeNext := read(next), write(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				readNext.ServeHTTP(w, r)
+				return
+			}
+			writeNext.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/healthcare-gitops/common/config"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Calibration results
+const (
+	CalibrationPass     = "pass"
+	CalibrationAdjusted = "adjusted" // out of tolerance as found, within tolerance as left
+	CalibrationFail     = "fail"
+)
+
+// CalibrationInstrument is the reference standard used to calibrate a device
+type CalibrationInstrument struct {
+	Name         string `json:"name"`
+	SerialNumber string `json:"serial_number"`
+	// CertifiedUntil is when the instrument's own traceable calibration expires
+	CertifiedUntil time.Time `json:"certified_until,omitempty"`
+}
+
+// CalibrationCertificate is the signed statement of a calibration result
+type CalibrationCertificate struct {
+	CertificateID string                `json:"certificate_id"`
+	DeviceID      string                `json:"device_id"`
+	DeviceType    DeviceType            `json:"device_type"`
+	SerialNumber  string                `json:"serial_number"`
+	Manufacturer  string                `json:"manufacturer"`
+	Model         string                `json:"model"`
+	Technician    string                `json:"technician"`
+	Instrument    CalibrationInstrument `json:"instrument"`
+	Result        string                `json:"result"`
+	PerformedAt   time.Time             `json:"performed_at"`
+	ValidUntil    time.Time             `json:"valid_until,omitempty"`
+	Issuer        string                `json:"issuer"`
+}
+
+// CalibrationRecord is a stored calibration with its signed certificate
+type CalibrationRecord struct {
+	Certificate  CalibrationCertificate `json:"certificate"`
+	Measurements map[string]float64     `json:"measurements,omitempty"`
+	Notes        string                 `json:"notes,omitempty"`
+	Signature    string                 `json:"signature"`
+	Algorithm    string                 `json:"signature_algorithm"`
+}
+
+// CalibrationLog keeps the calibration history of every device
+type CalibrationLog struct {
+	records map[string][]CalibrationRecord // device ID -> records, oldest first
+	seq     int
+	key     []byte
+	mu      sync.RWMutex
+}
+
+var calibrations *CalibrationLog
+
+// NewCalibrationLog creates a calibration log that signs certificates with key
+func NewCalibrationLog(key []byte) *CalibrationLog {
+	return &CalibrationLog{
+		records: make(map[string][]CalibrationRecord),
+		key:     key,
+	}
+}
+
+// calibrationSigningKey loads the certificate signing key from the environment.
+// Without one, an ephemeral key is generated and certificates will not verify
+// across restarts.
+func calibrationSigningKey() []byte {
+	if key := config.GetEnv("CALIBRATION_SIGNING_KEY", ""); key != "" {
+		return []byte(key)
+	}
+
+	log.Warn().Msg("CALIBRATION_SIGNING_KEY not set, using an ephemeral signing key")
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		log.Fatal().Err(err).Msg("Failed to generate calibration signing key")
+	}
+	return key
+}
+
+// sign returns the base64 HMAC-SHA256 of the certificate's canonical JSON
+func (cl *CalibrationLog) sign(cert CalibrationCertificate) (string, error) {
+	payload, err := json.Marshal(cert)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, cl.key)
+	mac.Write(payload)
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// Verify reports whether a record's signature matches its certificate
+func (cl *CalibrationLog) Verify(record CalibrationRecord) bool {
+	expected, err := cl.sign(record.Certificate)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal([]byte(expected), []byte(record.Signature))
+}
+
+// Record issues and stores a signed certificate for a calibration
+func (cl *CalibrationLog) Record(cert CalibrationCertificate, measurements map[string]float64, notes string) (CalibrationRecord, error) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	cl.seq++
+	cert.CertificateID = fmt.Sprintf("CAL-%s-%06d", cert.PerformedAt.UTC().Format("20060102"), cl.seq)
+
+	signature, err := cl.sign(cert)
+	if err != nil {
+		return CalibrationRecord{}, err
+	}
+
+	record := CalibrationRecord{
+		Certificate:  cert,
+		Measurements: measurements,
+		Notes:        notes,
+		Signature:    signature,
+		Algorithm:    "HMAC-SHA256",
+	}
+	cl.records[cert.DeviceID] = append(cl.records[cert.DeviceID], record)
+	return record, nil
+}
+
+// History returns a device's calibration records, oldest first
+func (cl *CalibrationLog) History(deviceID string) []CalibrationRecord {
+	cl.mu.RLock()
+	defer cl.mu.RUnlock()
+
+	history := make([]CalibrationRecord, len(cl.records[deviceID]))
+	copy(history, cl.records[deviceID])
+	return history
+}
+
+// Certificate returns the record holding a certificate
+func (cl *CalibrationLog) Certificate(certificateID string) (CalibrationRecord, bool) {
+	cl.mu.RLock()
+	defer cl.mu.RUnlock()
+	for _, records := range cl.records {
+		for _, record := range records {
+			if record.Certificate.CertificateID == certificateID {
+				return record, true
+			}
+		}
+	}
+	return CalibrationRecord{}, false
+}
+
+// PurgeDevice deletes a device's calibration history
+func (cl *CalibrationLog) PurgeDevice(deviceID string) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	delete(cl.records, deviceID)
+}
+
+// CalibrateDeviceHandler records a calibration and issues a signed certificate.
+// Only passing or adjusted results update the device's last calibration date.
+func CalibrateDeviceHandler(w http.ResponseWriter, r *http.Request) {
+	deviceID := chi.URLParam(r, "deviceID")
+	ctx := r.Context()
+	span := trace.SpanFromContext(ctx)
+	start := time.Now()
+
+	var req struct {
+		Technician   string                `json:"technician"`
+		Instrument   CalibrationInstrument `json:"instrument"`
+		Result       string                `json:"result"`
+		Measurements map[string]float64    `json:"measurements"`
+		Notes        string                `json:"notes"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			RecordDeviceOperation("calibrate", "error", time.Since(start).Seconds())
+			return
+		}
+	}
+	if req.Result == "" {
+		req.Result = CalibrationPass
+	}
+	if req.Result != CalibrationPass && req.Result != CalibrationAdjusted && req.Result != CalibrationFail {
+		http.Error(w, "result must be one of pass, adjusted, fail", http.StatusBadRequest)
+		RecordDeviceOperation("calibrate", "error", time.Since(start).Seconds())
+		return
+	}
+
+	device, err := registry.GetDevice(deviceID)
+	if err != nil {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		RecordDeviceOperation("calibrate", "error", time.Since(start).Seconds())
+		span.RecordError(err)
+		return
+	}
+
+	now := time.Now()
+	if !req.Instrument.CertifiedUntil.IsZero() && req.Instrument.CertifiedUntil.Before(now) {
+		http.Error(w, "Reference instrument calibration has expired", http.StatusUnprocessableEntity)
+		RecordDeviceOperation("calibrate", "error", time.Since(start).Seconds())
+		return
+	}
+
+	device.mu.Lock()
+	cert := CalibrationCertificate{
+		DeviceID:     deviceID,
+		DeviceType:   device.Type,
+		SerialNumber: device.SerialNumber,
+		Manufacturer: device.Manufacturer,
+		Model:        device.Model,
+		Technician:   req.Technician,
+		Instrument:   req.Instrument,
+		Result:       req.Result,
+		PerformedAt:  now,
+		Issuer:       "medical-device-service",
+	}
+	if req.Result != CalibrationFail {
+		device.LastCalibration = now
+		cert.ValidUntil = now.AddDate(0, 0, config.GetEnvInt("CALIBRATION_VALIDITY_DAYS", 365))
+	}
+	lastCalibration := device.LastCalibration
+	device.mu.Unlock()
+
+	record, err := calibrations.Record(cert, req.Measurements, req.Notes)
+	if err != nil {
+		http.Error(w, "Failed to issue calibration certificate", http.StatusInternalServerError)
+		RecordDeviceOperation("calibrate", "error", time.Since(start).Seconds())
+		span.RecordError(err)
+		return
+	}
+
+	duration := time.Since(start).Seconds()
+	RecordDeviceOperation("calibrate", "success", duration)
+	span.SetAttributes(
+		attribute.String("device.id", deviceID),
+		attribute.String("calibration.result", req.Result),
+	)
+
+	event := log.Info()
+	if req.Result == CalibrationFail {
+		event = log.Warn()
+	}
+	event.
+		Str("device_id", deviceID).
+		Str("certificate_id", record.Certificate.CertificateID).
+		Str("technician", req.Technician).
+		Str("result", req.Result).
+		Msg("Device calibrated")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"device_id":        deviceID,
+		"last_calibration": lastCalibration,
+		"status":           "calibration_complete",
+		"calibration":      record,
+	})
+}
+
+// ListCalibrationsHandler returns a device's calibration history for audit
+func ListCalibrationsHandler(w http.ResponseWriter, r *http.Request) {
+	deviceID := chi.URLParam(r, "deviceID")
+	ctx := r.Context()
+	span := trace.SpanFromContext(ctx)
+	start := time.Now()
+
+	if _, err := registry.GetDevice(deviceID); err != nil {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		RecordDeviceOperation("list_calibrations", "error", time.Since(start).Seconds())
+		span.RecordError(err)
+		return
+	}
+
+	history := calibrations.History(deviceID)
+
+	duration := time.Since(start).Seconds()
+	RecordDeviceOperation("list_calibrations", "success", duration)
+	span.SetAttributes(attribute.String("device.id", deviceID))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"device_id":    deviceID,
+		"calibrations": history,
+		"count":        len(history),
+	})
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+	"time"
+
+	"github.com/healthcare-gitops/common/features"
+)
+
+// apiSpecVersion is the version of openapi.yaml this build implements
+const apiSpecVersion = "1.11.0"
+
+// openAPISpec is openapi.yaml, served as JSON at /openapi.json
+//
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+// requestTimeout bounds every request through the router
+const requestTimeout = 30 * time.Second
+
+// Feature flags, each overridable with FEATURE_<NAME>
+const (
+	FeatureSimulator        = "simulator"
+	FeatureChaosScenarios   = "chaos_scenarios"
+	FeatureWebhooks         = "webhooks"
+	FeatureVendorWebhooks   = "vendor_webhooks"
+	FeatureTelemetryCapture = "telemetry_capture"
+	FeatureDocuments        = "documents"
+	FeatureSnapshots        = "snapshots"
+)
+
+// newFeatureFlags declares the service's features with their defaults
+func newFeatureFlags() *features.Flags {
+	return features.New(
+		features.Flag{Name: FeatureSimulator, Description: "Load-generating device simulator and synthetic patient data", Default: true},
+		features.Flag{Name: FeatureChaosScenarios, Description: "Mass-failure chaos drills against the simulated fleet", Default: true},
+		features.Flag{Name: FeatureWebhooks, Description: "Device event webhook subscriptions and delivery history", Default: true},
+		features.Flag{Name: FeatureVendorWebhooks, Description: "Manufacturer service portal notifications", Default: true},
+		features.Flag{Name: FeatureTelemetryCapture, Description: "De-identified telemetry capture and replay into test instances", Default: true},
+		features.Flag{Name: FeatureDocuments, Description: "File attachments on work orders and calibrations", Default: true},
+		features.Flag{Name: FeatureSnapshots, Description: "Scheduled and on-demand device snapshots with change diffs", Default: true},
+	)
+}
+
+// featureFlags holds the running service's feature states
+var featureFlags = newFeatureFlags()
+
+// CapabilitiesHandler lists enabled features, API versions and limits
+func CapabilitiesHandler(w http.ResponseWriter, r *http.Request) {
+	features.Handler(func() features.Capabilities {
+		limits := map[string]int64{
+			"request_timeout_seconds":     int64(requestTimeout.Seconds()),
+			"device_page_size_max":        maxDevicePageSize,
+			"chaos_duration_max_seconds":  int64(maxChaosDuration.Seconds()),
+			"webhook_attempts_max":        maxWebhookAttempts,
+			"telemetry_points_per_device": telemetryBufferSize,
+			"synthetic_ttl_max_seconds":   int64(syntheticPolicy.MaxTTL.Seconds()),
+			"decommission_batch_max":      maxDecommissionBatch,
+		}
+		if library != nil {
+			limits["document_size_max_bytes"] = library.Policy().MaxSize
+		}
+		return featureFlags.Capabilities("medical-device-service", apiSpecVersion, []string{"v1"}, limits)
+	})(w, r)
+}
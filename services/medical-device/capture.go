@@ -0,0 +1,443 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/healthcare-gitops/common/config"
+	"github.com/rs/zerolog/log"
+)
+
+// Capture record kinds
+const (
+	CaptureKindDevice    = "device"
+	CaptureKindMetrics   = "metrics"
+	CaptureKindHeartbeat = "heartbeat"
+	CaptureKindStatus    = "status"
+)
+
+// captureFormatVersion is bumped whenever the capture file layout changes
+const captureFormatVersion = 1
+
+// captureBufferSize bounds the events queued for de-identification. Events beyond it
+// are dropped rather than slowing down the request path.
+const captureBufferSize = 4096
+
+// MetricSample is the operational part of DeviceMetrics without its timestamp
+type MetricSample struct {
+	Temperature      float64 `json:"temperature_celsius"`
+	PowerConsumption float64 `json:"power_consumption_watts"`
+	CPUUtilization   float64 `json:"cpu_utilization_percent"`
+	MemoryUsage      float64 `json:"memory_usage_percent"`
+	NetworkLatency   float64 `json:"network_latency_ms"`
+}
+
+// CaptureHeader is the first line of a capture file
+type CaptureHeader struct {
+	CaptureID     string `json:"capture_id"`
+	Name          string `json:"name,omitempty"`
+	FormatVersion int    `json:"format_version"`
+	Deidentifier  string `json:"deidentifier"`
+}
+
+// CaptureRecord is one de-identified event. Device IDs are pseudonyms, locations are
+// reduced to the care unit, and times are offsets from the start of the capture so no
+// absolute dates leave the production instance.
+type CaptureRecord struct {
+	OffsetMillis int64         `json:"offset_ms"`
+	Kind         string        `json:"kind"`
+	DeviceID     string        `json:"device_id"`
+	DeviceType   DeviceType    `json:"device_type,omitempty"`
+	Unit         string        `json:"unit,omitempty"`
+	Metrics      *MetricSample `json:"metrics,omitempty"`
+	Status       DeviceStatus  `json:"status,omitempty"`
+}
+
+// CaptureInfo describes a capture file
+type CaptureInfo struct {
+	ID           string     `json:"id"`
+	Name         string     `json:"name,omitempty"`
+	File         string     `json:"file"`
+	Deidentifier string     `json:"deidentifier"`
+	StartedAt    time.Time  `json:"started_at"`
+	StoppedAt    *time.Time `json:"stopped_at,omitempty"`
+	Records      int64      `json:"records"`
+	Dropped      int64      `json:"dropped"`
+	Active       bool       `json:"active"`
+}
+
+// capturedEvent is a raw, still identifiable event waiting for de-identification
+type capturedEvent struct {
+	at       time.Time
+	kind     string
+	deviceID string
+	metrics  *MetricSample
+	status   DeviceStatus
+}
+
+// pseudonymizer replaces device identifiers with stable pseudonyms for one capture
+type pseudonymizer interface {
+	Name() string
+	Pseudonym(ctx context.Context, id string) (string, error)
+}
+
+// phiServicePseudonymizer routes identifiers through the PHI service's anonymize
+// endpoint. Its response carries the salt alongside the salted value, so the result
+// is digested locally and only a prefix of the digest is kept.
+type phiServicePseudonymizer struct {
+	baseURL string
+}
+
+func (p phiServicePseudonymizer) Name() string { return "phi-service" }
+
+func (p phiServicePseudonymizer) Pseudonym(ctx context.Context, id string) (string, error) {
+	body, _ := json.Marshal(map[string]string{"data": id})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(p.baseURL, "/")+"/api/v1/anonymize", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("anonymize returned %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Hash string `json:"hash"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || result.Hash == "" {
+		return "", fmt.Errorf("invalid anonymize response")
+	}
+	digest := sha256.Sum256([]byte(result.Hash))
+	return "ANON-" + hex.EncodeToString(digest[:6]), nil
+}
+
+// hmacPseudonymizer derives pseudonyms from a random per-capture key that is never
+// written out, used when no PHI service is configured
+type hmacPseudonymizer struct {
+	key []byte
+}
+
+func (p hmacPseudonymizer) Name() string { return "local-hmac" }
+
+func (p hmacPseudonymizer) Pseudonym(_ context.Context, id string) (string, error) {
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(id))
+	return "ANON-" + hex.EncodeToString(mac.Sum(nil)[:6]), nil
+}
+
+// newPseudonymizer picks the PHI service when PHI_SERVICE_URL is set
+func newPseudonymizer() (pseudonymizer, error) {
+	if url := config.GetEnv("PHI_SERVICE_URL", ""); url != "" {
+		return phiServicePseudonymizer{baseURL: url}, nil
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return hmacPseudonymizer{key: key}, nil
+}
+
+// CaptureManager records de-identified metric and event streams to files
+type CaptureManager struct {
+	dir      string
+	active   *CaptureInfo
+	events   chan capturedEvent
+	done     chan struct{}
+	finished map[string]*CaptureInfo
+	seq      int
+	mu       sync.Mutex
+}
+
+var captures *CaptureManager
+
+// NewCaptureManager creates a capture manager writing into dir
+func NewCaptureManager(dir string) *CaptureManager {
+	return &CaptureManager{
+		dir:      dir,
+		finished: make(map[string]*CaptureInfo),
+	}
+}
+
+// Start begins a capture. Only one capture runs at a time.
+func (cm *CaptureManager) Start(name string) (CaptureInfo, error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	if cm.active != nil {
+		return CaptureInfo{}, fmt.Errorf("capture %s is already running", cm.active.ID)
+	}
+	if err := os.MkdirAll(cm.dir, 0o750); err != nil {
+		return CaptureInfo{}, err
+	}
+	anonymizer, err := newPseudonymizer()
+	if err != nil {
+		return CaptureInfo{}, err
+	}
+
+	cm.seq++
+	now := time.Now()
+	info := &CaptureInfo{
+		ID:           fmt.Sprintf("CAP-%s-%04d", now.Format("20060102"), cm.seq),
+		Name:         name,
+		Deidentifier: anonymizer.Name(),
+		StartedAt:    now,
+		Active:       true,
+	}
+	info.File = filepath.Join(cm.dir, info.ID+".jsonl")
+
+	file, err := os.OpenFile(info.File, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o640)
+	if err != nil {
+		return CaptureInfo{}, err
+	}
+	w := bufio.NewWriter(file)
+	if err := json.NewEncoder(w).Encode(CaptureHeader{
+		CaptureID:     info.ID,
+		Name:          name,
+		FormatVersion: captureFormatVersion,
+		Deidentifier:  anonymizer.Name(),
+	}); err != nil {
+		file.Close()
+		return CaptureInfo{}, err
+	}
+
+	cm.active = info
+	cm.events = make(chan capturedEvent, captureBufferSize)
+	cm.done = make(chan struct{})
+	go cm.write(info, anonymizer, file, w, cm.events, cm.done)
+
+	log.Info().Str("capture_id", info.ID).Str("deidentifier", info.Deidentifier).Msg("Telemetry capture started")
+	return *info, nil
+}
+
+// Stop ends the running capture and waits for queued events to be written
+func (cm *CaptureManager) Stop() (CaptureInfo, error) {
+	cm.mu.Lock()
+	info := cm.active
+	if info == nil {
+		cm.mu.Unlock()
+		return CaptureInfo{}, fmt.Errorf("no capture is running")
+	}
+	close(cm.events)
+	done := cm.done
+	cm.active = nil
+	cm.events = nil
+	cm.mu.Unlock()
+
+	<-done
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	now := time.Now()
+	info.StoppedAt = &now
+	info.Active = false
+	cm.finished[info.ID] = info
+
+	log.Info().Str("capture_id", info.ID).Int64("records", info.Records).Int64("dropped", info.Dropped).Msg("Telemetry capture stopped")
+	return *info, nil
+}
+
+// observe queues an event for the running capture without blocking
+func (cm *CaptureManager) observe(event capturedEvent) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	if cm.active == nil {
+		return
+	}
+	select {
+	case cm.events <- event:
+	default:
+		cm.active.Dropped++
+	}
+}
+
+// write de-identifies queued events and appends them to the capture file. An event
+// whose device cannot be pseudonymized is dropped, never written with its real ID.
+func (cm *CaptureManager) write(info *CaptureInfo, anonymizer pseudonymizer, file *os.File, w *bufio.Writer, events <-chan capturedEvent, done chan struct{}) {
+	defer close(done)
+	defer file.Close()
+	defer w.Flush()
+
+	enc := json.NewEncoder(w)
+	pseudonyms := make(map[string]string)
+
+	count := func(written bool) {
+		cm.mu.Lock()
+		if written {
+			info.Records++
+		} else {
+			info.Dropped++
+		}
+		cm.mu.Unlock()
+	}
+
+	for event := range events {
+		pseudonym, known := pseudonyms[event.deviceID]
+		if !known {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			var err error
+			pseudonym, err = anonymizer.Pseudonym(ctx, event.deviceID)
+			cancel()
+			if err != nil {
+				log.Warn().Err(err).Str("capture_id", info.ID).Msg("De-identification failed, dropping captured event")
+				count(false)
+				continue
+			}
+			pseudonyms[event.deviceID] = pseudonym
+
+			// Introduce each device once so replay can register it on the target
+			record := CaptureRecord{
+				OffsetMillis: event.at.Sub(info.StartedAt).Milliseconds(),
+				Kind:         CaptureKindDevice,
+				DeviceID:     pseudonym,
+			}
+			if device, err := registry.GetDevice(event.deviceID); err == nil {
+				device.mu.RLock()
+				record.DeviceType = device.Type
+				record.Unit = unitFromLocation(device.Location)
+				record.Status = device.Status
+				device.mu.RUnlock()
+			}
+			if err := enc.Encode(record); err != nil {
+				log.Error().Err(err).Str("capture_id", info.ID).Msg("Failed to write capture record")
+			}
+		}
+
+		err := enc.Encode(CaptureRecord{
+			OffsetMillis: event.at.Sub(info.StartedAt).Milliseconds(),
+			Kind:         event.kind,
+			DeviceID:     pseudonym,
+			Metrics:      event.metrics,
+			Status:       event.status,
+		})
+		if err != nil {
+			log.Error().Err(err).Str("capture_id", info.ID).Msg("Failed to write capture record")
+		}
+		count(err == nil)
+	}
+}
+
+// List returns running and finished captures, newest first
+func (cm *CaptureManager) List() []CaptureInfo {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	list := make([]CaptureInfo, 0, len(cm.finished)+1)
+	if cm.active != nil {
+		list = append(list, *cm.active)
+	}
+	for _, info := range cm.finished {
+		list = append(list, *info)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].StartedAt.After(list[j].StartedAt) })
+	return list
+}
+
+// Get returns a finished capture
+func (cm *CaptureManager) Get(id string) (CaptureInfo, error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	info, ok := cm.finished[id]
+	if !ok {
+		return CaptureInfo{}, fmt.Errorf("capture %s not found or still running", id)
+	}
+	return *info, nil
+}
+
+// captureEvent records an event when a capture is running
+func captureEvent(kind, deviceID string, metrics *DeviceMetrics, status DeviceStatus) {
+	if captures == nil {
+		return
+	}
+	event := capturedEvent{at: time.Now(), kind: kind, deviceID: deviceID, status: status}
+	if metrics != nil {
+		event.metrics = &MetricSample{
+			Temperature:      metrics.Temperature,
+			PowerConsumption: metrics.PowerConsumption,
+			CPUUtilization:   metrics.CPUUtilization,
+			MemoryUsage:      metrics.MemoryUsage,
+			NetworkLatency:   metrics.NetworkLatency,
+		}
+	}
+	captures.observe(event)
+}
+
+// StartCaptureHandler starts recording de-identified telemetry
+func StartCaptureHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			RecordDeviceOperation("start_capture", "error", time.Since(start).Seconds())
+			return
+		}
+	}
+
+	info, err := captures.Start(req.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		RecordDeviceOperation("start_capture", "error", time.Since(start).Seconds())
+		return
+	}
+
+	RecordDeviceOperation("start_capture", "success", time.Since(start).Seconds())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(info)
+}
+
+// StopCaptureHandler stops the running capture
+func StopCaptureHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	info, err := captures.Stop()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		RecordDeviceOperation("stop_capture", "error", time.Since(start).Seconds())
+		return
+	}
+
+	RecordDeviceOperation("stop_capture", "success", time.Since(start).Seconds())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
+// ListCapturesHandler lists captures recorded since the service started
+func ListCapturesHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	list := captures.List()
+	RecordDeviceOperation("list_captures", "success", time.Since(start).Seconds())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"captures": list,
+		"count":    len(list),
+	})
+}
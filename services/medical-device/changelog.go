@@ -0,0 +1,31 @@
+package main
+
+import (
+	"github.com/healthcare-gitops/common/changelog"
+)
+
+// newChangelog lists the service's API changes since 1.0.0
+func newChangelog() (*changelog.Changelog, error) {
+	return changelog.New("medical-device-service", apiSpecVersion, []changelog.Entry{
+		{Version: "1.1.0", Kind: changelog.Added, Method: "GET", Path: "/capabilities", Description: "Feature, API version and limit discovery"},
+		{Version: "1.2.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/devices", Field: "synthetic", Description: "X-Synthetic-* headers register expiring synthetic test devices"},
+		{Version: "1.2.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/devices/{deviceID}", Field: "synthetic", Description: "synthetic, synthetic_origin and synthetic_expires_at on test devices"},
+		{Version: "1.3.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/summary", Description: "Dashboard device summary"},
+		{Version: "1.4.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/calendars", Description: "Tenants' business calendars"},
+		{Version: "1.4.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/calendars/{tenant}", Description: "Get a tenant's business calendar"},
+		{Version: "1.4.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/calendars/{tenant}/query", Description: "Whether a time is within business hours"},
+		{Version: "1.5.0", Kind: changelog.Added, Method: "GET", Path: "/admin/selfscan", Description: "Security misconfiguration self-scan"},
+		{Version: "1.6.0", Kind: changelog.Changed, Method: "GET", Path: "/api/v1/devices", Description: "Requires a device:read bearer token where auth-service is configured"},
+		{Version: "1.6.0", Kind: changelog.Changed, Method: "POST", Path: "/api/v1/devices", Description: "Requires a device:write bearer token where auth-service is configured"},
+		{Version: "1.7.0", Kind: changelog.Added, Method: "GET", Path: "/admin/usage-stats", Description: "Preview of the opt-in anonymous usage stats report"},
+		{Version: "1.8.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/decommissions", Description: "Decommission devices in bulk"},
+		{Version: "1.8.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/decommissions/{batchID}", Description: "Get a decommissioning batch"},
+		{Version: "1.8.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/devices/{deviceID}/decommission/certificate", Description: "A retired device's decommissioning certificate"},
+		{Version: "1.8.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/devices/{deviceID}/decommission/archive", Description: "A retired device's history archive"},
+		{Version: "1.8.0", Kind: changelog.Changed, Method: "GET", Path: "/api/v1/devices/{deviceID}", Field: "status", Description: "The retired status, set on decommissioning"},
+		{Version: "1.9.0", Kind: changelog.Added, Method: "GET", Path: "/changelog", Description: "This changelog"},
+		{Version: "1.10.0", Kind: changelog.Added, Method: "GET", Path: "/openapi.json", Description: "This OpenAPI document as JSON"},
+		{Version: "1.10.0", Kind: changelog.Added, Method: "GET", Path: "/docs", Description: "Swagger UI for the OpenAPI document"},
+		{Version: "1.11.0", Kind: changelog.Added, Method: "GET", Path: "/compliance/status", Description: "Live status of the service's FDA controls"},
+	})
+}
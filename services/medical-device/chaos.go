@@ -0,0 +1,387 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// Chaos scenario bounds
+const (
+	defaultChaosDuration = 5 * time.Minute
+	maxChaosDuration     = 4 * time.Hour
+)
+
+// ChaosScenario is a named mass-failure drill the simulator can inject
+type ChaosScenario struct {
+	Name          string `json:"name"`
+	Description   string `json:"description"`
+	TargetKind    string `json:"target_kind"`
+	DefaultTarget string `json:"default_target"`
+	// selectDevice reports whether a simulated device is affected by the target.
+	// Called with device.mu held.
+	selectDevice func(device *MedicalDevice, target string) bool
+	// inject applies the scenario to one affected device. Callers must hold s.mu.
+	inject func(s *Simulator, runID, deviceID string)
+}
+
+// chaosScenarios are the drills available through the API
+var chaosScenarios = map[string]*ChaosScenario{
+	"power_outage": {
+		Name:          "power_outage",
+		Description:   "Every simulated device in a care unit loses power: telemetry and heartbeats stop and facility monitoring reports the devices offline",
+		TargetKind:    "unit",
+		DefaultTarget: "Ward B",
+		selectDevice:  inUnit,
+		inject: func(s *Simulator, runID, deviceID string) {
+			s.silenced[deviceID] = runID
+			registry.PatchDevice(deviceID, map[string]interface{}{"status": string(StatusOffline)})
+		},
+	},
+	"gateway_loss": {
+		Name:          "gateway_loss",
+		Description:   "The network gateway serving a care unit fails: devices keep running but their heartbeats stop reaching the service, so the heartbeat monitor must detect the loss",
+		TargetKind:    "unit",
+		DefaultTarget: "ICU",
+		selectDevice:  inUnit,
+		inject: func(s *Simulator, runID, deviceID string) {
+			s.silenced[deviceID] = runID
+		},
+	},
+	"firmware_error_storm": {
+		Name:          "firmware_error_storm",
+		Description:   "A firmware defect makes every device on one firmware version flap between error and degraded each tick, producing an alert storm",
+		TargetKind:    "firmware_version",
+		DefaultTarget: "v1.0.0",
+		selectDevice: func(device *MedicalDevice, target string) bool {
+			return device.FirmwareVersion == target
+		},
+		inject: func(s *Simulator, runID, deviceID string) {
+			s.storming[deviceID] = runID
+			s.stormStep(deviceID)
+		},
+	},
+}
+
+// inUnit matches devices whose location is in the target care unit
+func inUnit(device *MedicalDevice, target string) bool {
+	return strings.EqualFold(unitFromLocation(device.Location), target)
+}
+
+// ChaosRun is one execution of a scenario and the alerts it produced
+type ChaosRun struct {
+	ID        string     `json:"id"`
+	Scenario  string     `json:"scenario"`
+	Target    string     `json:"target"`
+	StartedAt time.Time  `json:"started_at"`
+	EndsAt    time.Time  `json:"ends_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+	DeviceIDs []string   `json:"device_ids"`
+	timer     *time.Timer
+}
+
+// ChaosReport summarises how the alerting pipeline responded to a run
+type ChaosReport struct {
+	ChaosRun
+	Active           bool                  `json:"active"`
+	AlertsRaised     int                   `json:"alerts_raised"`
+	AlertsByPriority map[AlertPriority]int `json:"alerts_by_priority"`
+	Acknowledged     int                   `json:"acknowledged"`
+	SLABreaches      int                   `json:"sla_breaches"`
+	Alerts           []Alert               `json:"alerts"`
+}
+
+// StartScenario injects a named scenario into the simulated fleet for the given
+// duration. A zero duration uses the default. Devices already under another run are
+// left alone so overlapping drills do not fight over the same device.
+func (s *Simulator) StartScenario(name, target string, duration time.Duration) (ChaosRun, error) {
+	scenario, ok := chaosScenarios[name]
+	if !ok {
+		return ChaosRun{}, fmt.Errorf("unknown scenario %q", name)
+	}
+	if target == "" {
+		target = scenario.DefaultTarget
+	}
+	if duration == 0 {
+		duration = defaultChaosDuration
+	}
+	if duration < time.Second || duration > maxChaosDuration {
+		return ChaosRun{}, fmt.Errorf("duration must be between 1s and %s", maxChaosDuration)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	affected := make([]string, 0)
+	for _, id := range s.devices {
+		if _, busy := s.silenced[id]; busy {
+			continue
+		}
+		if _, busy := s.storming[id]; busy {
+			continue
+		}
+		device, err := registry.GetDevice(id)
+		if err != nil {
+			continue
+		}
+		device.mu.RLock()
+		selected := scenario.selectDevice(device, target)
+		device.mu.RUnlock()
+		if selected {
+			affected = append(affected, id)
+		}
+	}
+	if len(affected) == 0 {
+		return ChaosRun{}, fmt.Errorf("no available simulated devices match %s %q", scenario.TargetKind, target)
+	}
+
+	s.chaosSeq++
+	now := time.Now()
+	run := &ChaosRun{
+		ID:        fmt.Sprintf("CHAOS-%06d", s.chaosSeq),
+		Scenario:  name,
+		Target:    target,
+		StartedAt: now,
+		EndsAt:    now.Add(duration),
+		DeviceIDs: affected,
+	}
+	for _, id := range affected {
+		scenario.inject(s, run.ID, id)
+	}
+	run.timer = time.AfterFunc(duration, func() { s.EndScenario(run.ID) })
+	s.runs[run.ID] = run
+
+	log.Warn().
+		Str("run_id", run.ID).
+		Str("scenario", name).
+		Str("target", target).
+		Int("devices", len(affected)).
+		Dur("duration", duration).
+		Msg("Chaos scenario started")
+
+	return *run, nil
+}
+
+// EndScenario stops a run early or on expiry and restores its devices
+func (s *Simulator) EndScenario(runID string) (ChaosRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	run, ok := s.runs[runID]
+	if !ok {
+		return ChaosRun{}, fmt.Errorf("chaos run %s not found", runID)
+	}
+	if run.EndedAt != nil {
+		return *run, nil
+	}
+	run.timer.Stop()
+
+	now := time.Now()
+	for _, id := range run.DeviceIDs {
+		if s.silenced[id] == runID {
+			delete(s.silenced, id)
+		}
+		if s.storming[id] == runID {
+			delete(s.storming, id)
+		}
+		// A fresh heartbeat clears heartbeat-lost; the status patch clears the rest
+		registry.RecordHeartbeat(id, now)
+		registry.PatchDevice(id, map[string]interface{}{"status": string(StatusOperational)})
+		delete(s.faulted, id)
+	}
+	run.EndedAt = &now
+
+	log.Info().Str("run_id", runID).Str("scenario", run.Scenario).Msg("Chaos scenario ended, devices restored")
+	return *run, nil
+}
+
+// stormStep flips a storming device between error and degraded and bumps its error
+// count. Callers must hold s.mu.
+func (s *Simulator) stormStep(deviceID string) {
+	device, err := registry.GetDevice(deviceID)
+	if err != nil {
+		return
+	}
+	device.mu.RLock()
+	status := StatusError
+	if device.Status == StatusError {
+		status = StatusDegraded
+	}
+	errorCount := device.ErrorCount
+	device.mu.RUnlock()
+
+	registry.PatchDevice(deviceID, map[string]interface{}{
+		"status":      string(status),
+		"error_count": float64(errorCount + 1),
+	})
+	s.faulted[deviceID] = true
+}
+
+// ChaosReport returns a run together with the alerts raised on its devices since it
+// started, so drill reviewers can see what fired, what was acknowledged and what escalated
+func (s *Simulator) ChaosReport(runID string) (ChaosReport, error) {
+	s.mu.Lock()
+	run, ok := s.runs[runID]
+	if !ok {
+		s.mu.Unlock()
+		return ChaosReport{}, fmt.Errorf("chaos run %s not found", runID)
+	}
+	report := ChaosReport{ChaosRun: *run, Active: run.EndedAt == nil}
+	s.mu.Unlock()
+
+	until := time.Now()
+	if run.EndedAt != nil {
+		until = *run.EndedAt
+	}
+	report.Alerts = registry.alertsForDevices(report.DeviceIDs, report.StartedAt, until)
+	report.AlertsRaised = len(report.Alerts)
+	report.AlertsByPriority = make(map[AlertPriority]int)
+	for _, alert := range report.Alerts {
+		report.AlertsByPriority[alert.Priority]++
+		if alert.AcknowledgedAt != nil {
+			report.Acknowledged++
+		}
+		if alert.SLABreached {
+			report.SLABreaches++
+		}
+	}
+	return report, nil
+}
+
+// ChaosRuns lists reports for every run, newest first
+func (s *Simulator) ChaosRuns() []ChaosReport {
+	s.mu.Lock()
+	ids := make([]string, 0, len(s.runs))
+	for id := range s.runs {
+		ids = append(ids, id)
+	}
+	s.mu.Unlock()
+	sort.Sort(sort.Reverse(sort.StringSlice(ids)))
+
+	reports := make([]ChaosReport, 0, len(ids))
+	for _, id := range ids {
+		if report, err := s.ChaosReport(id); err == nil {
+			reports = append(reports, report)
+		}
+	}
+	return reports
+}
+
+// alertsForDevices returns alerts raised on the given devices within a time window
+func (dr *DeviceRegistry) alertsForDevices(deviceIDs []string, from, until time.Time) []Alert {
+	wanted := make(map[string]bool, len(deviceIDs))
+	for _, id := range deviceIDs {
+		wanted[id] = true
+	}
+
+	dr.mu.RLock()
+	defer dr.mu.RUnlock()
+
+	alerts := make([]Alert, 0)
+	for _, alert := range dr.alerts {
+		if wanted[alert.DeviceID] && !alert.RaisedAt.Before(from) && !alert.RaisedAt.After(until) {
+			alerts = append(alerts, *alert)
+		}
+	}
+	sortAlerts(alerts)
+	return alerts
+}
+
+// ListChaosScenariosHandler lists available scenarios and past runs
+func ListChaosScenariosHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	scenarios := make([]ChaosScenario, 0, len(chaosScenarios))
+	for _, scenario := range chaosScenarios {
+		scenarios = append(scenarios, *scenario)
+	}
+	sort.Slice(scenarios, func(i, j int) bool { return scenarios[i].Name < scenarios[j].Name })
+	runs := simulator.ChaosRuns()
+
+	RecordDeviceOperation("list_chaos_scenarios", "success", time.Since(start).Seconds())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"scenarios": scenarios,
+		"runs":      runs,
+	})
+}
+
+// RunChaosScenarioHandler starts a named scenario
+func RunChaosScenarioHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	start := time.Now()
+
+	var req struct {
+		Target          string  `json:"target"`
+		DurationSeconds float64 `json:"duration_seconds"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			RecordDeviceOperation("run_chaos_scenario", "error", time.Since(start).Seconds())
+			return
+		}
+	}
+
+	if _, ok := chaosScenarios[name]; !ok {
+		http.Error(w, fmt.Sprintf("unknown scenario %q", name), http.StatusNotFound)
+		RecordDeviceOperation("run_chaos_scenario", "error", time.Since(start).Seconds())
+		return
+	}
+
+	run, err := simulator.StartScenario(name, req.Target, time.Duration(req.DurationSeconds*float64(time.Second)))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		RecordDeviceOperation("run_chaos_scenario", "error", time.Since(start).Seconds())
+		return
+	}
+
+	RecordDeviceOperation("run_chaos_scenario", "success", time.Since(start).Seconds())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(run)
+}
+
+// GetChaosRunHandler reports a run and the alerts it produced
+func GetChaosRunHandler(w http.ResponseWriter, r *http.Request) {
+	runID := chi.URLParam(r, "runID")
+	start := time.Now()
+
+	report, err := simulator.ChaosReport(runID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		RecordDeviceOperation("get_chaos_run", "error", time.Since(start).Seconds())
+		return
+	}
+
+	RecordDeviceOperation("get_chaos_run", "success", time.Since(start).Seconds())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// StopChaosRunHandler ends a run early and restores its devices
+func StopChaosRunHandler(w http.ResponseWriter, r *http.Request) {
+	runID := chi.URLParam(r, "runID")
+	start := time.Now()
+
+	if _, err := simulator.EndScenario(runID); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		RecordDeviceOperation("stop_chaos_run", "error", time.Since(start).Seconds())
+		return
+	}
+	report, _ := simulator.ChaosReport(runID)
+
+	RecordDeviceOperation("stop_chaos_run", "success", time.Since(start).Seconds())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
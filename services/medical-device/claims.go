@@ -0,0 +1,336 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// Insurance plan types
+const (
+	PlanCommercial = "commercial"
+	PlanMedicare   = "medicare"
+	PlanMedicaid   = "medicaid"
+)
+
+// CMS place of service codes of the encounters claims are generated for
+const (
+	placeOfServiceOffice    = "11"
+	placeOfServiceInpatient = "21"
+	placeOfServiceEmergency = "23"
+)
+
+// followUpVisit is billed for each outpatient follow-up
+var followUpVisit = cpt("99214", "Office or other outpatient visit, established patient, moderate complexity")
+
+// chargemaster is the synthetic hospital's charge for each billed CPT code, in cents
+var chargemaster = map[string]int64{
+	"33208": 1450000,
+	"36556": 85000,
+	"92960": 180000,
+	"93000": 7500,
+	"93306": 95000,
+	"94003": 42000,
+	"94640": 6500,
+	"99214": 21000,
+	"99222": 25000,
+	"99223": 38000,
+	"99291": 52000,
+}
+
+// defaultCharge is charged for a code missing from the chargemaster
+const defaultCharge = 15000
+
+// SyntheticPayer is a generated insurer. Payer IDs start SYN, which clearinghouses do
+// not assign, so generated claims cannot reach a real payer.
+type SyntheticPayer struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	PlanType string `json:"plan_type"`
+}
+
+var syntheticPayers = []SyntheticPayer{
+	{ID: "SYN01", Name: "Synthwell Health Plan", PlanType: PlanCommercial},
+	{ID: "SYN02", Name: "Testbury Mutual Insurance", PlanType: PlanCommercial},
+	{ID: "SYN03", Name: "Mockford Medicare Advantage", PlanType: PlanMedicare},
+	{ID: "SYN04", Name: "Sampleton Community Medicaid", PlanType: PlanMedicaid},
+}
+
+// Relationships of an insured patient to the subscriber
+const (
+	RelationshipSelf   = "self"
+	RelationshipSpouse = "spouse"
+	RelationshipChild  = "child"
+)
+
+// SyntheticCoverage is a patient's insurance. Dependents in a household are covered
+// under its subscriber's member ID, and Subscriber identifies them.
+type SyntheticCoverage struct {
+	Payer        SyntheticPayer      `json:"payer"`
+	MemberID     string              `json:"member_id"`
+	GroupNumber  string              `json:"group_number,omitempty"`
+	Relationship string              `json:"relationship"`
+	Subscriber   *CoverageSubscriber `json:"subscriber,omitempty"`
+}
+
+// CoverageSubscriber is the household member a dependent is insured through
+type CoverageSubscriber struct {
+	PatientID  string `json:"patient_id"`
+	GivenName  string `json:"given_name"`
+	FamilyName string `json:"family_name"`
+	BirthDate  string `json:"birth_date"`
+	Sex        string `json:"sex"`
+}
+
+// SyntheticAddress is a generated US street address. ZIP codes below 00500 are not
+// assigned by USPS.
+type SyntheticAddress struct {
+	Line1      string `json:"line1"`
+	City       string `json:"city"`
+	State      string `json:"state"`
+	PostalCode string `json:"postal_code"`
+}
+
+var (
+	syntheticStreets = []string{"Synthetic Way", "Testing Lane", "Mock Avenue", "Sample Street", "Placeholder Road"}
+	syntheticCities  = []struct{ City, State string }{
+		{"Testville", "OH"}, {"Mockton", "TX"}, {"Sampleburg", "PA"}, {"Fauxport", "CA"}, {"Demoreau Falls", "MN"},
+	}
+)
+
+// drawAddress generates an address
+func drawAddress(rng *rand.Rand) SyntheticAddress {
+	place := syntheticCities[rng.Intn(len(syntheticCities))]
+	return SyntheticAddress{
+		Line1:      fmt.Sprintf("%d %s", 1+rng.Intn(9999), syntheticStreets[rng.Intn(len(syntheticStreets))]),
+		City:       place.City,
+		State:      place.State,
+		PostalCode: fmt.Sprintf("%05d", 1+rng.Intn(499)),
+	}
+}
+
+// drawCoverage insures a patient: most over 65 through Medicare, most others
+// through a commercial plan, the rest through Medicaid
+func drawCoverage(rng *rand.Rand, age int) SyntheticCoverage {
+	planType := PlanCommercial
+	switch n := rng.Float64(); {
+	case age >= 65 && n < 0.8:
+		planType = PlanMedicare
+	case age < 65 && n < 0.25:
+		planType = PlanMedicaid
+	}
+	payers := make([]SyntheticPayer, 0, len(syntheticPayers))
+	for _, p := range syntheticPayers {
+		if p.PlanType == planType {
+			payers = append(payers, p)
+		}
+	}
+	c := SyntheticCoverage{
+		Payer:        payers[rng.Intn(len(payers))],
+		MemberID:     fmt.Sprintf("SYN%09d", rng.Intn(1e9)),
+		Relationship: RelationshipSelf,
+	}
+	if planType == PlanCommercial {
+		c.GroupNumber = fmt.Sprintf("GRP%05d", rng.Intn(1e5))
+	}
+	return c
+}
+
+// SyntheticClaim is a professional claim for one encounter, in the shape of the
+// payment gateway's claim request, so it can be posted to its /api/v1/claims
+type SyntheticClaim struct {
+	PatientID       string               `json:"patient_id"`
+	BillingProvider ClaimBillingProvider `json:"billing_provider"`
+	Payer           ClaimPayer           `json:"payer"`
+	Subscriber      ClaimSubscriber      `json:"subscriber"`
+	Patient         *ClaimPatient        `json:"patient,omitempty"`
+	PlaceOfService  string               `json:"place_of_service"`
+	Diagnoses       []string             `json:"diagnoses"`
+	ServiceLines    []ClaimServiceLine   `json:"service_lines"`
+}
+
+// ClaimBillingProvider is the organization billing for the services
+type ClaimBillingProvider struct {
+	Name    string           `json:"name"`
+	NPI     string           `json:"npi"`
+	TaxID   string           `json:"tax_id"`
+	Address SyntheticAddress `json:"address"`
+}
+
+// ClaimPayer identifies the insurer by its payer ID
+type ClaimPayer struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// ClaimSubscriber is the insured patient
+type ClaimSubscriber struct {
+	MemberID    string           `json:"member_id"`
+	GroupNumber string           `json:"group_number,omitempty"`
+	FirstName   string           `json:"first_name"`
+	LastName    string           `json:"last_name"`
+	DateOfBirth string           `json:"date_of_birth"`
+	Gender      string           `json:"gender"`
+	Address     SyntheticAddress `json:"address"`
+}
+
+// ClaimPatient is a dependent of the subscriber who received the services
+type ClaimPatient struct {
+	Relationship string           `json:"relationship"`
+	FirstName    string           `json:"first_name"`
+	LastName     string           `json:"last_name"`
+	DateOfBirth  string           `json:"date_of_birth"`
+	Gender       string           `json:"gender"`
+	Address      SyntheticAddress `json:"address"`
+}
+
+// ClaimMoney is an amount in minor units
+type ClaimMoney struct {
+	AmountMinor int64  `json:"amount_minor"`
+	Currency    string `json:"currency"`
+}
+
+// ClaimServiceLine is one billed procedure
+type ClaimServiceLine struct {
+	Procedure         string     `json:"procedure"`
+	Charge            ClaimMoney `json:"charge"`
+	Units             int        `json:"units"`
+	DiagnosisPointers []int      `json:"diagnosis_pointers"`
+	ServiceDate       string     `json:"service_date"`
+}
+
+// Claim limits of the 837P, which the gateway enforces
+const (
+	maxClaimDiagnoses = 12
+	maxClaimPointers  = 4
+)
+
+// claimGenders maps administrative sexes to the 837's M, F and U
+var claimGenders = map[string]string{SexFemale: "F", SexMale: "M"}
+
+// claimGender maps an administrative sex to the 837's gender code
+func claimGender(sex string) string {
+	if gender, ok := claimGenders[sex]; ok {
+		return gender
+	}
+	return "U"
+}
+
+// newSyntheticClaim bills the procedures of an encounter starting on day. A dependent
+// is billed under their subscriber, as the claim's patient. There is no claim without
+// ICD-10 diagnoses and CPT procedures to put on it.
+func newSyntheticClaim(org SyntheticOrganization, p SyntheticPatient, placeOfService string, procedures []CodedConcept, day time.Time) (SyntheticClaim, bool) {
+	diagnoses := make([]string, 0, len(p.Diagnoses))
+	for _, dx := range p.Diagnoses {
+		if dx.System == CodeSystemICD10 && len(diagnoses) < maxClaimDiagnoses {
+			diagnoses = append(diagnoses, dx.Code)
+		}
+	}
+	if len(diagnoses) == 0 || len(procedures) == 0 {
+		return SyntheticClaim{}, false
+	}
+	pointers := make([]int, 0, maxClaimPointers)
+	for i := range diagnoses {
+		if i == maxClaimPointers {
+			break
+		}
+		pointers = append(pointers, i+1)
+	}
+
+	c := SyntheticClaim{
+		PatientID: p.ID,
+		BillingProvider: ClaimBillingProvider{
+			Name:    org.Name,
+			NPI:     org.NPI,
+			TaxID:   org.TaxID,
+			Address: org.Address,
+		},
+		Payer: ClaimPayer{ID: p.Coverage.Payer.ID, Name: p.Coverage.Payer.Name},
+		Subscriber: ClaimSubscriber{
+			MemberID:    p.Coverage.MemberID,
+			GroupNumber: p.Coverage.GroupNumber,
+			FirstName:   p.GivenName,
+			LastName:    p.FamilyName,
+			DateOfBirth: p.BirthDate,
+			Gender:      claimGender(p.Sex),
+			Address:     p.Address,
+		},
+		PlaceOfService: placeOfService,
+		Diagnoses:      diagnoses,
+	}
+	if sub := p.Coverage.Subscriber; sub != nil {
+		c.Patient = &ClaimPatient{
+			Relationship: p.Coverage.Relationship,
+			FirstName:    p.GivenName,
+			LastName:     p.FamilyName,
+			DateOfBirth:  p.BirthDate,
+			Gender:       claimGender(p.Sex),
+			Address:      p.Address,
+		}
+		c.Subscriber.FirstName, c.Subscriber.LastName = sub.GivenName, sub.FamilyName
+		c.Subscriber.DateOfBirth, c.Subscriber.Gender = sub.BirthDate, claimGender(sub.Sex)
+	}
+	for _, proc := range procedures {
+		charge, ok := chargemaster[proc.Code]
+		if !ok {
+			charge = defaultCharge
+		}
+		c.ServiceLines = append(c.ServiceLines, ClaimServiceLine{
+			Procedure:         proc.Code,
+			Charge:            ClaimMoney{AmountMinor: charge, Currency: "USD"},
+			Units:             1,
+			DiagnosisPointers: pointers,
+			ServiceDate:       day.Format(time.DateOnly),
+		})
+	}
+	return c, true
+}
+
+// Claims bills each admitted patient's encounter for the procedures their conditions
+// generated, as of the day it started
+func (ds SyntheticDataset) Claims() []SyntheticClaim {
+	patients := make(map[string]SyntheticPatient, len(ds.Patients))
+	for _, p := range ds.Patients {
+		patients[p.ID] = p
+	}
+	claims := make([]SyntheticClaim, 0)
+	for _, enc := range ds.Encounters {
+		p, ok := patients[enc.PatientID]
+		if !ok {
+			continue
+		}
+		pos := placeOfServiceInpatient
+		if enc.Class == EncounterClassEmergency {
+			pos = placeOfServiceEmergency
+		}
+		if c, ok := newSyntheticClaim(ds.Organization, p, pos, p.Procedures, enc.Start.UTC()); ok {
+			claims = append(claims, c)
+		}
+	}
+	return claims
+}
+
+// ListSyntheticClaimsHandler returns a claim for each admitted patient's encounter,
+// ready to post to the payment gateway. Supports ?patient_id= for one patient.
+func ListSyntheticClaimsHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	claims := simulator.Dataset().Claims()
+	if patientID := r.URL.Query().Get("patient_id"); patientID != "" {
+		filtered := make([]SyntheticClaim, 0, 1)
+		for _, c := range claims {
+			if c.PatientID == patientID {
+				filtered = append(filtered, c)
+			}
+		}
+		claims = filtered
+	}
+	RecordDeviceOperation("list_synthetic_claims", "success", time.Since(start).Seconds())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"claims": claims,
+		"count":  len(claims),
+	})
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/healthcare-gitops/common/compliance"
+	"github.com/healthcare-gitops/common/config"
+)
+
+// complianceViolationMetrics count FDA violations: device events withheld because
+// their payload failed schema validation
+var complianceViolationMetrics = []string{
+	"medical_device_event_schema_violations_total",
+}
+
+// complianceStatus checks the service's FDA 21 CFR Part 11 and Part 820 controls as
+// deployed. authenticated is whether bearer tokens are validated by auth-service.
+func complianceStatus(authenticated bool, now time.Time) compliance.Status {
+	access := compliance.Control{
+		ID:          "fda.access_control",
+		Framework:   compliance.FDA,
+		Requirement: "21 CFR 11.10(d)",
+		Title:       "Device records are changed only by authenticated callers with a device scope",
+		Status:      compliance.Pass,
+		Detail:      "bearer tokens are validated by auth-service; changes need device:write",
+	}
+	if !authenticated {
+		access.Status, access.Detail = compliance.Fail, "AUTH_INTROSPECT_URL is not set, so the device API is not authenticated"
+	}
+
+	signatures := compliance.Control{
+		ID:          "fda.electronic_signatures",
+		Framework:   compliance.FDA,
+		Requirement: "21 CFR 11.70",
+		Title:       "Calibration certificates are signed and the signatures verify across restarts",
+		Status:      compliance.Pass,
+		Detail:      "certificates are signed with HMAC-SHA256 under CALIBRATION_SIGNING_KEY",
+	}
+	if config.GetEnv("CALIBRATION_SIGNING_KEY", "") == "" {
+		signatures.Status = compliance.Warning
+		signatures.Detail = "certificates are signed with an ephemeral key and will not verify after a restart; set CALIBRATION_SIGNING_KEY"
+	}
+
+	devices := registry.ListDevices()
+	controls := []compliance.Control{
+		access,
+		compliance.AuditBusControl(compliance.FDA, "21 CFR 11.10(e)", auditEvents),
+		signatures,
+		calibrationControl(devices),
+		maintenanceControl(devices, now),
+	}
+	return compliance.NewStatus("medical-device-service", apiSpecVersion, controls, auditEvents, complianceViolationMetrics...)
+}
+
+// calibrationControl checks every calibration certificate on record still verifies
+func calibrationControl(devices []*MedicalDevice) compliance.Control {
+	c := compliance.Control{
+		ID:          "fda.calibration",
+		Framework:   compliance.FDA,
+		Requirement: "21 CFR 820.72",
+		Title:       "Devices are calibrated and their calibration certificates are intact",
+		Status:      compliance.Pass,
+	}
+	var tampered, uncalibrated []string
+	verified := 0
+	for _, device := range devices {
+		history := calibrations.History(device.ID)
+		if len(history) == 0 {
+			uncalibrated = append(uncalibrated, device.ID)
+		}
+		for _, record := range history {
+			if !calibrations.Verify(record) {
+				tampered = append(tampered, record.Certificate.CertificateID)
+				continue
+			}
+			verified++
+		}
+	}
+	slices.Sort(tampered)
+	switch {
+	case len(tampered) > 0:
+		c.Status, c.Detail = compliance.Fail, "certificates whose signature does not verify: "+strings.Join(tampered, ", ")
+	case len(uncalibrated) > 0:
+		c.Status = compliance.Warning
+		c.Detail = fmt.Sprintf("%d certificates verified; %d devices have no calibration on record", verified, len(uncalibrated))
+	default:
+		c.Detail = fmt.Sprintf("%d certificates verified", verified)
+	}
+	return c
+}
+
+// maintenanceControl checks no device in service is past its scheduled maintenance
+func maintenanceControl(devices []*MedicalDevice, now time.Time) compliance.Control {
+	c := compliance.Control{
+		ID:          "fda.maintenance",
+		Framework:   compliance.FDA,
+		Requirement: "21 CFR 820.70(g)",
+		Title:       "Devices in service are maintained on schedule",
+		Status:      compliance.Pass,
+		Detail:      fmt.Sprintf("%d devices within their maintenance schedule", len(devices)),
+		Evidence:    []compliance.Evidence{{Title: "Upcoming and overdue maintenance", URL: "/api/v1/maintenance/upcoming"}},
+	}
+	var overdue []string
+	for _, device := range devices {
+		device.mu.RLock()
+		if !device.NextMaintenance.IsZero() && device.NextMaintenance.Before(now) {
+			overdue = append(overdue, device.ID)
+		}
+		device.mu.RUnlock()
+	}
+	if len(overdue) > 0 {
+		slices.Sort(overdue)
+		c.Status, c.Detail = compliance.Fail, "devices past their scheduled maintenance: "+strings.Join(overdue, ", ")
+	}
+	return c
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ConsumableType describes a disposable used by a device type
+type ConsumableType struct {
+	SKU           string     `json:"sku"`
+	Name          string     `json:"name"`
+	DeviceType    DeviceType `json:"device_type"`
+	ReorderPoint  int        `json:"reorder_point"`
+	ReorderQty    int        `json:"reorder_quantity"`
+	LeadTimeDays  int        `json:"lead_time_days"`
+	InitialOnHand int        `json:"-"`
+}
+
+// defaultConsumables lists the disposables tracked out of the box
+var defaultConsumables = []ConsumableType{
+	{SKU: "IV-SET-STD", Name: "Infusion administration set", DeviceType: DeviceTypePump, ReorderPoint: 200, ReorderQty: 1000, LeadTimeDays: 5, InitialOnHand: 800},
+	{SKU: "VENT-CIRC-AD", Name: "Adult ventilator breathing circuit", DeviceType: DeviceTypeVentilator, ReorderPoint: 50, ReorderQty: 200, LeadTimeDays: 7, InitialOnHand: 150},
+	{SKU: "VENT-HME", Name: "Heat and moisture exchanger filter", DeviceType: DeviceTypeVentilator, ReorderPoint: 100, ReorderQty: 500, LeadTimeDays: 7, InitialOnHand: 300},
+	{SKU: "ECG-ELEC-5", Name: "ECG electrode pack (5-lead)", DeviceType: DeviceTypeECG, ReorderPoint: 300, ReorderQty: 2000, LeadTimeDays: 3, InitialOnHand: 1200},
+}
+
+// forecastLookback is how much usage history drives the burn-rate forecast
+const forecastLookback = 14 * 24 * time.Hour
+
+// UsageEvent records consumables used by a device
+type UsageEvent struct {
+	SKU        string    `json:"sku"`
+	DeviceID   string    `json:"device_id"`
+	Quantity   int       `json:"quantity"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// ConsumableForecast projects when a consumable will run out
+type ConsumableForecast struct {
+	ConsumableType
+	OnHand         int        `json:"on_hand"`
+	DailyUsage     float64    `json:"daily_usage"`
+	DaysOfSupply   *float64   `json:"days_of_supply,omitempty"`
+	StockoutDate   *time.Time `json:"projected_stockout,omitempty"`
+	BelowReorder   bool       `json:"below_reorder_point"`
+	OrderBy        *time.Time `json:"order_by,omitempty"`
+	SuggestedOrder int        `json:"suggested_order_quantity"`
+}
+
+// ConsumableInventory tracks stock levels and usage for device consumables
+type ConsumableInventory struct {
+	types   map[string]ConsumableType
+	onHand  map[string]int
+	usage   []UsageEvent
+	alerted map[string]bool // SKUs with an outstanding reorder alert
+	mu      sync.RWMutex
+}
+
+var inventory *ConsumableInventory
+
+// NewConsumableInventory creates an inventory seeded with the given consumable types
+func NewConsumableInventory(types []ConsumableType) *ConsumableInventory {
+	inv := &ConsumableInventory{
+		types:   make(map[string]ConsumableType),
+		onHand:  make(map[string]int),
+		usage:   make([]UsageEvent, 0),
+		alerted: make(map[string]bool),
+	}
+	for _, t := range types {
+		inv.types[t.SKU] = t
+		inv.onHand[t.SKU] = t.InitialOnHand
+	}
+	return inv
+}
+
+// RecordUsage decrements stock for a usage event. It returns true when the event
+// drops stock to or below the reorder point for the first time.
+func (inv *ConsumableInventory) RecordUsage(event UsageEvent, deviceType DeviceType) (int, bool, error) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	consumable, exists := inv.types[event.SKU]
+	if !exists {
+		return 0, false, fmt.Errorf("consumable %s not found", event.SKU)
+	}
+	if consumable.DeviceType != deviceType {
+		return 0, false, fmt.Errorf("consumable %s is not used by %s devices", event.SKU, deviceType)
+	}
+	if event.Quantity > inv.onHand[event.SKU] {
+		return inv.onHand[event.SKU], false, fmt.Errorf("insufficient stock of %s: %d on hand", event.SKU, inv.onHand[event.SKU])
+	}
+
+	inv.onHand[event.SKU] -= event.Quantity
+	inv.usage = append(inv.usage, event)
+
+	reorder := inv.onHand[event.SKU] <= consumable.ReorderPoint && !inv.alerted[event.SKU]
+	if reorder {
+		inv.alerted[event.SKU] = true
+	}
+	return inv.onHand[event.SKU], reorder, nil
+}
+
+// Restock adds received stock and clears any reorder alert once above the reorder point
+func (inv *ConsumableInventory) Restock(sku string, quantity int) (int, error) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	consumable, exists := inv.types[sku]
+	if !exists {
+		return 0, fmt.Errorf("consumable %s not found", sku)
+	}
+
+	inv.onHand[sku] += quantity
+	if inv.onHand[sku] > consumable.ReorderPoint {
+		delete(inv.alerted, sku)
+	}
+	return inv.onHand[sku], nil
+}
+
+// Forecast projects stockout and reorder dates from the recent burn rate
+func (inv *ConsumableInventory) Forecast(now time.Time) []ConsumableForecast {
+	inv.mu.RLock()
+	defer inv.mu.RUnlock()
+
+	used := make(map[string]int)
+	for _, event := range inv.usage {
+		if now.Sub(event.RecordedAt) <= forecastLookback {
+			used[event.SKU] += event.Quantity
+		}
+	}
+
+	forecasts := make([]ConsumableForecast, 0, len(inv.types))
+	for sku, consumable := range inv.types {
+		onHand := inv.onHand[sku]
+		f := ConsumableForecast{
+			ConsumableType: consumable,
+			OnHand:         onHand,
+			DailyUsage:     float64(used[sku]) / forecastLookback.Hours() * 24,
+			BelowReorder:   onHand <= consumable.ReorderPoint,
+		}
+
+		if f.DailyUsage > 0 {
+			days := float64(onHand) / f.DailyUsage
+			stockout := now.Add(time.Duration(days * float64(24*time.Hour)))
+			orderBy := stockout.AddDate(0, 0, -consumable.LeadTimeDays)
+			f.DaysOfSupply = &days
+			f.StockoutDate = &stockout
+			f.OrderBy = &orderBy
+
+			// Cover lead time plus the lookback period at the current burn rate
+			need := int(math.Ceil(f.DailyUsage*(float64(consumable.LeadTimeDays)+forecastLookback.Hours()/24))) - onHand
+			if need > 0 {
+				f.SuggestedOrder = int(math.Max(float64(need), float64(consumable.ReorderQty)))
+			}
+		}
+		if f.BelowReorder && f.SuggestedOrder == 0 {
+			f.SuggestedOrder = consumable.ReorderQty
+		}
+		forecasts = append(forecasts, f)
+	}
+
+	// Soonest stockout first; SKUs with no usage last
+	sort.Slice(forecasts, func(i, j int) bool {
+		a, b := forecasts[i].DaysOfSupply, forecasts[j].DaysOfSupply
+		switch {
+		case a == nil && b == nil:
+			return forecasts[i].SKU < forecasts[j].SKU
+		case a == nil:
+			return false
+		case b == nil:
+			return true
+		}
+		return *a < *b
+	})
+	return forecasts
+}
+
+// RecordConsumableUsageHandler records consumables used by a device
+func RecordConsumableUsageHandler(w http.ResponseWriter, r *http.Request) {
+	deviceID := chi.URLParam(r, "deviceID")
+	ctx := r.Context()
+	span := trace.SpanFromContext(ctx)
+	start := time.Now()
+
+	var event UsageEvent
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil || event.SKU == "" || event.Quantity <= 0 {
+		http.Error(w, "sku and a positive quantity are required", http.StatusBadRequest)
+		RecordDeviceOperation("consumable_usage", "error", time.Since(start).Seconds())
+		return
+	}
+
+	device, err := registry.GetDevice(deviceID)
+	if err != nil {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		RecordDeviceOperation("consumable_usage", "error", time.Since(start).Seconds())
+		span.RecordError(err)
+		return
+	}
+	device.mu.RLock()
+	deviceType := device.Type
+	device.mu.RUnlock()
+
+	event.DeviceID = deviceID
+	event.RecordedAt = time.Now()
+	onHand, reorder, err := inventory.RecordUsage(event, deviceType)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		RecordDeviceOperation("consumable_usage", "error", time.Since(start).Seconds())
+		span.RecordError(err)
+		return
+	}
+
+	if reorder {
+		log.Warn().
+			Str("sku", event.SKU).
+			Int("on_hand", onHand).
+			Str("device_type", string(deviceType)).
+			Msg("Consumable at reorder point")
+	}
+
+	duration := time.Since(start).Seconds()
+	RecordDeviceOperation("consumable_usage", "success", duration)
+	span.SetAttributes(
+		attribute.String("device.id", deviceID),
+		attribute.String("consumable.sku", event.SKU),
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"usage":         event,
+		"on_hand":       onHand,
+		"reorder_alert": reorder,
+	})
+}
+
+// RestockConsumableHandler records received stock for a consumable
+func RestockConsumableHandler(w http.ResponseWriter, r *http.Request) {
+	sku := chi.URLParam(r, "sku")
+	start := time.Now()
+
+	var req struct {
+		Quantity int `json:"quantity"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Quantity <= 0 {
+		http.Error(w, "a positive quantity is required", http.StatusBadRequest)
+		RecordDeviceOperation("consumable_restock", "error", time.Since(start).Seconds())
+		return
+	}
+
+	onHand, err := inventory.Restock(sku, req.Quantity)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		RecordDeviceOperation("consumable_restock", "error", time.Since(start).Seconds())
+		return
+	}
+
+	RecordDeviceOperation("consumable_restock", "success", time.Since(start).Seconds())
+	log.Info().Str("sku", sku).Int("quantity", req.Quantity).Int("on_hand", onHand).Msg("Consumable restocked")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"sku":     sku,
+		"on_hand": onHand,
+	})
+}
+
+// ConsumableForecastHandler returns the procurement forecast for all consumables
+func ConsumableForecastHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	start := time.Now()
+
+	now := time.Now()
+	forecast := inventory.Forecast(now)
+
+	reorderCount := 0
+	for _, f := range forecast {
+		if f.BelowReorder {
+			reorderCount++
+		}
+	}
+
+	duration := time.Since(start).Seconds()
+	RecordDeviceOperation("consumable_forecast", "success", duration)
+
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.Int("consumable.below_reorder", reorderCount))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"consumables":         forecast,
+		"below_reorder_count": reorderCount,
+		"lookback_days":       forecastLookback.Hours() / 24,
+		"generated_at":        now,
+	})
+}
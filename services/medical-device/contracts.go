@@ -0,0 +1,299 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Contract kinds
+const (
+	ContractWarranty         = "warranty"
+	ContractServiceAgreement = "service_contract"
+)
+
+// contractReminderDays are the lead times at which expiry alerts are raised, furthest first
+var contractReminderDays = []int{90, 60, 30}
+
+// ServiceContract is warranty or service-contract coverage for a device
+type ServiceContract struct {
+	ID             string    `json:"id"`
+	DeviceID       string    `json:"device_id"`
+	Kind           string    `json:"kind"`
+	Provider       string    `json:"provider"`
+	ContractNumber string    `json:"contract_number,omitempty"`
+	Coverage       string    `json:"coverage"`
+	StartsAt       time.Time `json:"starts_at"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	AnnualCost     float64   `json:"annual_cost,omitempty"`
+	// remindedAt is the smallest reminder threshold (in days) already alerted on
+	remindedAt int
+}
+
+// VendorRenewals groups contracts due for renewal by provider
+type VendorRenewals struct {
+	Provider   string            `json:"provider"`
+	Contracts  []ServiceContract `json:"contracts"`
+	Count      int               `json:"count"`
+	AnnualCost float64           `json:"annual_cost"`
+}
+
+// ContractRegistry tracks warranty and service contracts for devices
+type ContractRegistry struct {
+	contracts map[string]*ServiceContract
+	seq       int
+	mu        sync.RWMutex
+}
+
+var contracts *ContractRegistry
+
+// NewContractRegistry creates an empty contract registry
+func NewContractRegistry() *ContractRegistry {
+	return &ContractRegistry{
+		contracts: make(map[string]*ServiceContract),
+	}
+}
+
+// Add registers a contract for a device
+func (cr *ContractRegistry) Add(contract ServiceContract) ServiceContract {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	cr.seq++
+	contract.ID = fmt.Sprintf("CONTRACT-%06d", cr.seq)
+	cr.contracts[contract.ID] = &contract
+	return contract
+}
+
+// ForDevice returns a device's contracts, latest expiry first
+func (cr *ContractRegistry) ForDevice(deviceID string) []ServiceContract {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+
+	result := make([]ServiceContract, 0)
+	for _, contract := range cr.contracts {
+		if contract.DeviceID == deviceID {
+			result = append(result, *contract)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ExpiresAt.After(result[j].ExpiresAt)
+	})
+	return result
+}
+
+// DueReminders returns contracts that have crossed a new reminder threshold since the
+// last check, paired with that threshold in days
+func (cr *ContractRegistry) DueReminders(now time.Time) map[int][]ServiceContract {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	due := make(map[int][]ServiceContract)
+	for _, contract := range cr.contracts {
+		if !contract.ExpiresAt.After(now) {
+			continue
+		}
+		for i := len(contractReminderDays) - 1; i >= 0; i-- {
+			days := contractReminderDays[i]
+			if contract.ExpiresAt.Sub(now) > time.Duration(days)*24*time.Hour {
+				continue
+			}
+			if contract.remindedAt == 0 || days < contract.remindedAt {
+				contract.remindedAt = days
+				due[days] = append(due[days], *contract)
+			}
+			break
+		}
+	}
+	return due
+}
+
+// Renewals groups contracts expiring before now+window by provider
+func (cr *ContractRegistry) Renewals(now time.Time, window time.Duration) []VendorRenewals {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+
+	byVendor := make(map[string]*VendorRenewals)
+	for _, contract := range cr.contracts {
+		if contract.ExpiresAt.After(now.Add(window)) {
+			continue
+		}
+		v, ok := byVendor[contract.Provider]
+		if !ok {
+			v = &VendorRenewals{Provider: contract.Provider, Contracts: make([]ServiceContract, 0)}
+			byVendor[contract.Provider] = v
+		}
+		v.Contracts = append(v.Contracts, *contract)
+		v.Count++
+		v.AnnualCost += contract.AnnualCost
+	}
+
+	report := make([]VendorRenewals, 0, len(byVendor))
+	for _, v := range byVendor {
+		sort.Slice(v.Contracts, func(i, j int) bool {
+			return v.Contracts[i].ExpiresAt.Before(v.Contracts[j].ExpiresAt)
+		})
+		report = append(report, *v)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		return report[i].Provider < report[j].Provider
+	})
+	return report
+}
+
+// checkContractExpiry raises a low-priority alert for each contract crossing a reminder threshold
+func checkContractExpiry(now time.Time) {
+	for days, due := range contracts.DueReminders(now) {
+		for _, contract := range due {
+			device, err := registry.GetDevice(contract.DeviceID)
+			if err != nil {
+				continue
+			}
+
+			// Each threshold is a fresh notification rather than a duplicate of the last one
+			registry.mu.Lock()
+			registry.resolveAlertLocked(contract.DeviceID, ConditionContractExpiring, now)
+			registry.mu.Unlock()
+
+			device.mu.Lock()
+			registry.raiseAlertLocked(device, ConditionContractExpiring,
+				fmt.Sprintf("%s %s with %s expires %s (within %d days)",
+					contract.Kind, contract.ID, contract.Provider, contract.ExpiresAt.Format("2006-01-02"), days), now)
+			registry.refreshAlertLevelLocked(device)
+			device.mu.Unlock()
+		}
+	}
+}
+
+// startContractExpiryMonitor periodically checks for contracts nearing expiry
+func startContractExpiryMonitor(checkInterval time.Duration) {
+	if checkInterval <= 0 {
+		checkInterval = 24 * time.Hour
+	}
+	log.Info().Dur("check_interval", checkInterval).Ints("reminder_days", contractReminderDays).Msg("Starting contract expiry monitor")
+
+	checkContractExpiry(time.Now())
+
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		checkContractExpiry(now)
+	}
+}
+
+// AddContractHandler records a warranty or service contract for a device
+func AddContractHandler(w http.ResponseWriter, r *http.Request) {
+	deviceID := chi.URLParam(r, "deviceID")
+	ctx := r.Context()
+	span := trace.SpanFromContext(ctx)
+	start := time.Now()
+
+	var contract ServiceContract
+	if err := json.NewDecoder(r.Body).Decode(&contract); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		RecordDeviceOperation("add_contract", "error", time.Since(start).Seconds())
+		return
+	}
+	if contract.Kind != ContractWarranty && contract.Kind != ContractServiceAgreement {
+		http.Error(w, "kind must be warranty or service_contract", http.StatusBadRequest)
+		RecordDeviceOperation("add_contract", "error", time.Since(start).Seconds())
+		return
+	}
+	if contract.Provider == "" || contract.ExpiresAt.IsZero() || contract.ExpiresAt.Before(contract.StartsAt) {
+		http.Error(w, "provider and an expires_at after starts_at are required", http.StatusBadRequest)
+		RecordDeviceOperation("add_contract", "error", time.Since(start).Seconds())
+		return
+	}
+
+	if _, err := registry.GetDevice(deviceID); err != nil {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		RecordDeviceOperation("add_contract", "error", time.Since(start).Seconds())
+		span.RecordError(err)
+		return
+	}
+
+	contract.DeviceID = deviceID
+	contract = contracts.Add(contract)
+
+	duration := time.Since(start).Seconds()
+	RecordDeviceOperation("add_contract", "success", duration)
+	span.SetAttributes(attribute.String("device.id", deviceID))
+
+	log.Info().
+		Str("device_id", deviceID).
+		Str("contract_id", contract.ID).
+		Str("provider", contract.Provider).
+		Time("expires_at", contract.ExpiresAt).
+		Msg("Service contract recorded")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(contract)
+}
+
+// ListDeviceContractsHandler returns a device's warranty and service contracts
+func ListDeviceContractsHandler(w http.ResponseWriter, r *http.Request) {
+	deviceID := chi.URLParam(r, "deviceID")
+	ctx := r.Context()
+	span := trace.SpanFromContext(ctx)
+	start := time.Now()
+
+	if _, err := registry.GetDevice(deviceID); err != nil {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		RecordDeviceOperation("list_contracts", "error", time.Since(start).Seconds())
+		span.RecordError(err)
+		return
+	}
+
+	deviceContracts := contracts.ForDevice(deviceID)
+
+	RecordDeviceOperation("list_contracts", "success", time.Since(start).Seconds())
+	span.SetAttributes(attribute.String("device.id", deviceID))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"device_id": deviceID,
+		"contracts": deviceContracts,
+		"count":     len(deviceContracts),
+	})
+}
+
+// ContractRenewalReportHandler groups contracts expiring within ?window= (default 90d) by vendor
+func ContractRenewalReportHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	start := time.Now()
+
+	windowParam := r.URL.Query().Get("window")
+	if windowParam == "" {
+		windowParam = "90d"
+	}
+	window, err := parseWindow(windowParam)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		RecordDeviceOperation("contract_renewals", "error", time.Since(start).Seconds())
+		return
+	}
+
+	now := time.Now()
+	report := contracts.Renewals(now, window)
+
+	RecordDeviceOperation("contract_renewals", "success", time.Since(start).Seconds())
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.Int("contract.vendor_count", len(report)))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"window":       windowParam,
+		"vendors":      report,
+		"generated_at": now,
+	})
+}
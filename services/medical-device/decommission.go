@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/healthcare-gitops/common/config"
+	"github.com/rs/zerolog/log"
+)
+
+// defaultRetentionDays keeps decommissioned device records for six years, matching
+// the HIPAA documentation retention requirement
+const defaultRetentionDays = 6 * 365
+
+// deviceRetention is how long decommissioned devices are archived before purge
+func deviceRetention() time.Duration {
+	days := config.GetEnvInt("DEVICE_RETENTION_DAYS", defaultRetentionDays)
+	if days < 1 {
+		days = defaultRetentionDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// GetDecommissionedDevice returns an archived device
+func (dr *DeviceRegistry) GetDecommissionedDevice(deviceID string) (*MedicalDevice, error) {
+	dr.mu.RLock()
+	defer dr.mu.RUnlock()
+
+	device, exists := dr.decommissioned[deviceID]
+	if !exists {
+		return nil, fmt.Errorf("device %s not found", deviceID)
+	}
+	return device, nil
+}
+
+// ListDecommissioned returns archived devices ordered by ID
+func (dr *DeviceRegistry) ListDecommissioned() []*MedicalDevice {
+	dr.mu.RLock()
+	defer dr.mu.RUnlock()
+
+	devices := make([]*MedicalDevice, 0, len(dr.decommissioned))
+	for _, device := range dr.decommissioned {
+		devices = append(devices, device)
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].ID < devices[j].ID })
+	return devices
+}
+
+// PurgeDevice permanently deletes a device, active or archived, with its metrics,
+// alerts, maintenance and calibration history, snapshots and telemetry
+func (dr *DeviceRegistry) PurgeDevice(deviceID string) error {
+	dr.mu.Lock()
+	_, active := dr.devices[deviceID]
+	_, archived := dr.decommissioned[deviceID]
+	if !active && !archived {
+		dr.mu.Unlock()
+		return fmt.Errorf("device %s not found", deviceID)
+	}
+
+	delete(dr.devices, deviceID)
+	delete(dr.decommissioned, deviceID)
+	delete(dr.metrics, deviceID)
+	delete(dr.silent, deviceID)
+	delete(dr.publishedStatus, deviceID)
+	dr.summary.remove(deviceID)
+	for id, alert := range dr.alerts {
+		if alert.DeviceID == deviceID {
+			if alert.ResolvedAt == nil {
+				dr.summary.alertClosed(alert.Priority)
+			}
+			delete(dr.alerts, id)
+		}
+	}
+	dr.mu.Unlock()
+
+	if maintenanceScheduler != nil {
+		maintenanceScheduler.PurgeDevice(deviceID)
+	}
+	if calibrations != nil {
+		calibrations.PurgeDevice(deviceID)
+	}
+	if snapshots != nil {
+		snapshots.PurgeDevice(deviceID)
+	}
+	telemetry.Remove(deviceID)
+	return nil
+}
+
+// PurgeDecommissioned deletes archived devices decommissioned longer ago than the
+// retention period and returns their IDs
+func (dr *DeviceRegistry) PurgeDecommissioned(now time.Time, retention time.Duration) []string {
+	cutoff := now.Add(-retention)
+
+	expired := make([]string, 0)
+	for _, device := range dr.ListDecommissioned() {
+		device.mu.RLock()
+		decommissionedAt := device.DecommissionedAt
+		device.mu.RUnlock()
+		if decommissionedAt != nil && decommissionedAt.Before(cutoff) {
+			expired = append(expired, device.ID)
+		}
+	}
+
+	purged := make([]string, 0, len(expired))
+	for _, id := range expired {
+		if err := dr.PurgeDevice(id); err == nil {
+			purged = append(purged, id)
+		}
+	}
+	return purged
+}
+
+// startDecommissionPurge periodically purges decommissioned devices past retention
+func startDecommissionPurge(checkInterval time.Duration) {
+	if checkInterval <= 0 {
+		checkInterval = 24 * time.Hour
+	}
+	retention := deviceRetention()
+	log.Info().Dur("check_interval", checkInterval).Dur("retention", retention).Msg("Starting decommissioned device purge job")
+
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		if purged := registry.PurgeDecommissioned(now, retention); len(purged) > 0 {
+			log.Info().Strs("device_ids", purged).Msg("Purged decommissioned devices past retention")
+		}
+	}
+}
@@ -0,0 +1,551 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/healthcare-gitops/common/config"
+	"github.com/healthcare-gitops/common/documents"
+	"github.com/healthcare-gitops/common/resilience"
+	"github.com/healthcare-gitops/common/tlsconfig"
+	"github.com/rs/zerolog/log"
+)
+
+// maxDecommissionBatch caps the devices one batch may retire
+const maxDecommissionBatch = 500
+
+// deviceArchiveSchema versions the history export format
+const deviceArchiveSchema = 1
+
+// Decommission results
+const (
+	DecommissionRetired = "retired"
+	DecommissionFailed  = "failed"
+)
+
+// archiveStore is the cold storage decommissioning exports and certificates are
+// written to
+var archiveStore documents.Store
+
+// credentials revokes retired devices' API keys; nil when AUTH_APIKEYS_URL is unset
+var credentials *credentialRevoker
+
+// openArchiveStore keeps exports under DEVICE_ARCHIVE_DIR, typically a mounted bucket
+// with an archive storage class, or in memory when it is unset
+func openArchiveStore() (documents.Store, error) {
+	dir := config.GetEnv("DEVICE_ARCHIVE_DIR", "")
+	if dir == "" {
+		log.Warn().Msg("DEVICE_ARCHIVE_DIR not set, decommissioning archives will not survive a restart")
+		return documents.NewMemoryStore(), nil
+	}
+	return documents.NewFileStore(dir)
+}
+
+// DecommissionRequest is the body of POST /api/v1/decommissions. Devices are selected
+// by ID, and every active device at Location or of Model is added.
+type DecommissionRequest struct {
+	DeviceIDs []string `json:"device_ids"`
+	Location  string   `json:"location,omitempty"`
+	Model     string   `json:"model,omitempty"`
+	Reason    string   `json:"reason"`
+	// Disposition records what happens to the hardware, e.g. recycled
+	Disposition string `json:"disposition,omitempty"`
+}
+
+// ArchiveRef locates an object in the archive store
+type ArchiveRef struct {
+	Key    string `json:"key"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// DecommissionResult is the outcome for one device of a batch
+type DecommissionResult struct {
+	DeviceID string `json:"device_id"`
+	Status   string `json:"status"`
+	// Error says why a device was not retired, or what went wrong after it was
+	Error            string      `json:"error,omitempty"`
+	DecommissionedAt *time.Time  `json:"decommissioned_at,omitempty"`
+	Archive          *ArchiveRef `json:"archive,omitempty"`
+	RevokedAPIKeys   []string    `json:"revoked_api_keys,omitempty"`
+	Certificate      *ArchiveRef `json:"certificate,omitempty"`
+}
+
+// DecommissionBatch records a bulk decommissioning
+type DecommissionBatch struct {
+	ID          string    `json:"id"`
+	RequestedBy string    `json:"requested_by,omitempty"`
+	Reason      string    `json:"reason"`
+	Disposition string    `json:"disposition,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	// CredentialRevocation is auth-service when API keys were revoked there, or
+	// not_configured
+	CredentialRevocation string               `json:"credential_revocation"`
+	Retired              int                  `json:"retired"`
+	Failed               int                  `json:"failed"`
+	Devices              []DecommissionResult `json:"devices"`
+}
+
+// DeviceHistoryArchive is the export written to cold storage before a device retires
+type DeviceHistoryArchive struct {
+	Schema               int                   `json:"schema"`
+	BatchID              string                `json:"batch_id"`
+	ArchivedAt           time.Time             `json:"archived_at"`
+	Device               json.RawMessage       `json:"device"`
+	Metrics              *DeviceMetrics        `json:"metrics,omitempty"`
+	Alerts               []Alert               `json:"alerts"`
+	Calibrations         []CalibrationRecord   `json:"calibrations"`
+	Maintenance          []MaintenanceRecord   `json:"maintenance"`
+	MaintenanceSchedules []MaintenanceSchedule `json:"maintenance_schedules"`
+	Contracts            []ServiceContract     `json:"contracts"`
+	Snapshots            []DeviceSnapshot      `json:"snapshots"`
+}
+
+// archiveKey names a batch's object for a device. Every batch gets its own, so a
+// device ID reused after purge never overwrites an earlier record.
+func archiveKey(deviceID, batchID, name string) string {
+	return "devices/" + url.PathEscape(deviceID) + "/" + batchID + "/" + name
+}
+
+func batchKey(batchID string) string { return "batches/" + batchID + ".json" }
+
+// DeviceAlerts returns every alert raised for a device, resolved ones included, in the
+// order they were raised
+func (dr *DeviceRegistry) DeviceAlerts(deviceID string) []Alert {
+	dr.mu.RLock()
+	defer dr.mu.RUnlock()
+
+	alerts := make([]Alert, 0)
+	for _, alert := range dr.alerts {
+		if alert.DeviceID == deviceID {
+			alerts = append(alerts, *alert)
+		}
+	}
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].ID < alerts[j].ID })
+	return alerts
+}
+
+// deviceHistory collects what the service holds on a device. Telemetry is clinical
+// data belonging to the patient record, not the device's, and is left out.
+func deviceHistory(device *MedicalDevice, batchID string, now time.Time) (DeviceHistoryArchive, error) {
+	device.mu.RLock()
+	record, err := json.Marshal(device)
+	device.mu.RUnlock()
+	if err != nil {
+		return DeviceHistoryArchive{}, err
+	}
+	archive := DeviceHistoryArchive{
+		Schema:               deviceArchiveSchema,
+		BatchID:              batchID,
+		ArchivedAt:           now,
+		Device:               record,
+		Alerts:               registry.DeviceAlerts(device.ID),
+		Calibrations:         []CalibrationRecord{},
+		Maintenance:          []MaintenanceRecord{},
+		MaintenanceSchedules: []MaintenanceSchedule{},
+		Contracts:            []ServiceContract{},
+		Snapshots:            []DeviceSnapshot{},
+	}
+	if metrics, err := registry.GetMetrics(device.ID); err == nil {
+		archive.Metrics = metrics
+	}
+	if calibrations != nil {
+		archive.Calibrations = calibrations.History(device.ID)
+	}
+	if maintenanceScheduler != nil {
+		archive.Maintenance = maintenanceScheduler.History(device.ID)
+		archive.MaintenanceSchedules = maintenanceScheduler.DeviceSchedules(device.ID)
+	}
+	if contracts != nil {
+		archive.Contracts = contracts.ForDevice(device.ID)
+	}
+	if snapshots != nil {
+		archive.Snapshots = snapshots.List(device.ID)
+	}
+	return archive, nil
+}
+
+// putArchive writes content to the archive store and returns its reference
+func putArchive(ctx context.Context, key string, content []byte) (*ArchiveRef, error) {
+	if err := archiveStore.Put(ctx, key, bytes.NewReader(content)); err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(content)
+	return &ArchiveRef{Key: key, SHA256: hex.EncodeToString(sum[:]), Size: int64(len(content))}, nil
+}
+
+// writeHistoryArchive exports a device's history as gzipped JSON
+func writeHistoryArchive(ctx context.Context, deviceID string, history DeviceHistoryArchive) (*ArchiveRef, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(zw).Encode(history); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return putArchive(ctx, archiveKey(deviceID, history.BatchID, "history.json.gz"), buf.Bytes())
+}
+
+// decommissionDevice archives, revokes and retires one device. Its history is exported
+// and its keys revoked before it leaves service, so a failure at either step leaves
+// the device active and the batch can be rerun.
+func decommissionDevice(ctx context.Context, batch *DecommissionBatch, deviceID string, keyIDs []string, authorization string) DecommissionResult {
+	result := DecommissionResult{DeviceID: deviceID, Status: DecommissionFailed}
+	device, err := registry.GetDevice(deviceID)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	history, err := deviceHistory(device, batch.ID, time.Now().UTC())
+	if err == nil {
+		result.Archive, err = writeHistoryArchive(ctx, deviceID, history)
+	}
+	if err != nil {
+		result.Error = "history not archived: " + err.Error()
+		return result
+	}
+
+	for _, id := range keyIDs {
+		if err := credentials.revoke(ctx, authorization, id); err != nil {
+			result.Error = fmt.Sprintf("API key %s not revoked: %v", id, err)
+			return result
+		}
+		result.RevokedAPIKeys = append(result.RevokedAPIKeys, id)
+	}
+
+	if err := registry.DeregisterDevice(deviceID); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Status = DecommissionRetired
+	device.mu.RLock()
+	result.DecommissionedAt = device.DecommissionedAt
+	device.mu.RUnlock()
+
+	certificate := decommissionCertificate(device, batch, result, history)
+	if result.Certificate, err = putArchive(ctx, archiveKey(deviceID, batch.ID, "certificate.txt"), certificate); err != nil {
+		result.Error = "certificate not written: " + err.Error()
+	}
+	return result
+}
+
+// decommissionCertificate renders the plain-text certificate kept as evidence that a
+// device was retired with its records preserved and its access removed
+func decommissionCertificate(device *MedicalDevice, batch *DecommissionBatch, result DecommissionResult, history DeviceHistoryArchive) []byte {
+	device.mu.RLock()
+	defer device.mu.RUnlock()
+
+	var b strings.Builder
+	line := func(label, value string) { fmt.Fprintf(&b, "%-20s %s\n", label+":", value) }
+	orNone := func(value string) string {
+		if value == "" {
+			return "-"
+		}
+		return value
+	}
+
+	b.WriteString("CERTIFICATE OF DECOMMISSIONING\n\n")
+	line("Device ID", device.ID)
+	line("Type", string(device.Type))
+	line("Manufacturer", orNone(device.Manufacturer))
+	line("Model", orNone(device.Model))
+	line("Serial number", orNone(device.SerialNumber))
+	line("Firmware version", orNone(device.FirmwareVersion))
+	line("Last location", orNone(device.Location))
+	line("Decommissioned at", result.DecommissionedAt.UTC().Format(time.RFC3339))
+	line("Batch", batch.ID)
+	line("Requested by", orNone(batch.RequestedBy))
+	line("Reason", batch.Reason)
+	line("Disposition", orNone(batch.Disposition))
+
+	b.WriteString("\nRECORDS ARCHIVED\n")
+	line("History export", result.Archive.Key)
+	line("SHA-256", result.Archive.SHA256)
+	line("Size", fmt.Sprintf("%d bytes", result.Archive.Size))
+	line("Contents", fmt.Sprintf("%d alerts, %d calibrations, %d maintenance visits, %d contracts, %d snapshots",
+		len(history.Alerts), len(history.Calibrations), len(history.Maintenance), len(history.Contracts), len(history.Snapshots)))
+	line("Record retained to", result.DecommissionedAt.Add(deviceRetention()).UTC().Format(time.DateOnly))
+
+	b.WriteString("\nACCESS REVOKED\n")
+	switch {
+	case batch.CredentialRevocation != "auth-service":
+		line("API keys", "not revoked, AUTH_APIKEYS_URL is not configured")
+	case len(result.RevokedAPIKeys) == 0:
+		line("API keys", "none held")
+	default:
+		line("API keys", strings.Join(result.RevokedAPIKeys, ", "))
+	}
+	line("Certificates", "not issued by the platform; revoke at the issuing CA")
+	return []byte(b.String())
+}
+
+// selectDecommissionDevices resolves a request to device IDs, in request order
+// followed by matches by ID
+func selectDecommissionDevices(req DecommissionRequest) []string {
+	seen := make(map[string]bool)
+	ids := make([]string, 0, len(req.DeviceIDs))
+	add := func(id string) {
+		if id = strings.TrimSpace(id); id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	for _, id := range req.DeviceIDs {
+		add(id)
+	}
+	if req.Location != "" || req.Model != "" {
+		for _, device := range registry.ListDevices() {
+			device.mu.RLock()
+			matches := (req.Location == "" || device.Location == req.Location) && (req.Model == "" || device.Model == req.Model)
+			device.mu.RUnlock()
+			if matches {
+				add(device.ID)
+			}
+		}
+	}
+	return ids
+}
+
+func newDecommissionBatchID(now time.Time) (string, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("DECOM-%s-%s", now.Format("20060102"), hex.EncodeToString(suffix)), nil
+}
+
+// DecommissionDevicesHandler handles POST /api/v1/decommissions: retires a fleet of
+// devices, archiving each one's history to cold storage, revoking its API keys and
+// writing its decommissioning certificate
+func DecommissionDevicesHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	var req DecommissionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		http.Error(w, "reason is required", http.StatusUnprocessableEntity)
+		return
+	}
+	ids := selectDecommissionDevices(req)
+	if len(ids) == 0 {
+		http.Error(w, "No devices selected", http.StatusUnprocessableEntity)
+		return
+	}
+	if len(ids) > maxDecommissionBatch {
+		http.Error(w, fmt.Sprintf("A batch may retire at most %d devices", maxDecommissionBatch), http.StatusUnprocessableEntity)
+		return
+	}
+
+	now := time.Now().UTC()
+	batchID, err := newDecommissionBatchID(now)
+	if err != nil {
+		http.Error(w, "Failed to start batch", http.StatusInternalServerError)
+		return
+	}
+	batch := &DecommissionBatch{
+		ID:                   batchID,
+		RequestedBy:          requestUser(r, ""),
+		Reason:               req.Reason,
+		Disposition:          strings.TrimSpace(req.Disposition),
+		CreatedAt:            now,
+		CredentialRevocation: "not_configured",
+		Devices:              make([]DecommissionResult, 0, len(ids)),
+	}
+
+	// Keys are listed once up front; without the list no device is retired, so none
+	// leaves service still able to authenticate
+	authorization := r.Header.Get("Authorization")
+	var keys map[string][]string
+	if credentials != nil {
+		batch.CredentialRevocation = "auth-service"
+		if keys, err = credentials.keysByOwner(r.Context(), authorization); err != nil {
+			log.Error().Err(err).Msg("Failed to list device API keys")
+			http.Error(w, "Could not list device API keys; no devices were retired", http.StatusBadGateway)
+			return
+		}
+	}
+
+	for _, id := range ids {
+		deviceStart := time.Now()
+		result := decommissionDevice(r.Context(), batch, id, keys[id], authorization)
+		if result.Status == DecommissionRetired {
+			batch.Retired++
+			RecordDeviceOperation("decommission", "success", time.Since(deviceStart).Seconds())
+		} else {
+			batch.Failed++
+			RecordDeviceOperation("decommission", "error", time.Since(deviceStart).Seconds())
+		}
+		batch.Devices = append(batch.Devices, result)
+	}
+
+	record, _ := json.Marshal(batch)
+	if _, err := putArchive(r.Context(), batchKey(batch.ID), record); err != nil {
+		log.Error().Err(err).Str("batch_id", batch.ID).Msg("Failed to archive decommissioning batch")
+	}
+	log.Info().
+		Str("batch_id", batch.ID).
+		Str("requested_by", batch.RequestedBy).
+		Int("retired", batch.Retired).
+		Int("failed", batch.Failed).
+		Dur("duration", time.Since(start)).
+		Msg("Devices decommissioned")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(record)
+}
+
+// GetDecommissionBatchHandler handles GET /api/v1/decommissions/{batchID}
+func GetDecommissionBatchHandler(w http.ResponseWriter, r *http.Request) {
+	batchID := chi.URLParam(r, "batchID")
+	if strings.ContainsAny(batchID, "/.") {
+		http.Error(w, "Batch not found", http.StatusNotFound)
+		return
+	}
+	body, err := archiveStore.Get(r.Context(), batchKey(batchID))
+	if err != nil {
+		http.Error(w, "Batch not found", http.StatusNotFound)
+		return
+	}
+	defer body.Close()
+	w.Header().Set("Content-Type", "application/json")
+	io.Copy(w, body)
+}
+
+// latestArchive returns the key of a device's newest archived object named name
+func latestArchive(ctx context.Context, deviceID, name string) (string, error) {
+	keys, err := archiveStore.List(ctx, "devices/"+url.PathEscape(deviceID)+"/")
+	if err != nil {
+		return "", err
+	}
+	// Batch IDs start with their date, so the last match is the latest
+	for i := len(keys) - 1; i >= 0; i-- {
+		if strings.HasSuffix(keys[i], "/"+name) {
+			return keys[i], nil
+		}
+	}
+	return "", documents.ErrNotFound
+}
+
+// serveDeviceArchive serves a device's latest decommissioning certificate or history
+// export
+func serveDeviceArchive(name, contentType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		deviceID := chi.URLParam(r, "deviceID")
+		key, err := latestArchive(r.Context(), deviceID, name)
+		var body io.ReadCloser
+		if err == nil {
+			body, err = archiveStore.Get(r.Context(), key)
+		}
+		if errors.Is(err, documents.ErrNotFound) {
+			http.Error(w, "Device has not been decommissioned", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to read archive", http.StatusInternalServerError)
+			return
+		}
+		defer body.Close()
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", deviceID+"-"+name))
+		io.Copy(w, body)
+	}
+}
+
+// credentialRevoker revokes the auth-service API keys a device authenticates with.
+// Keys belong to a device when their owner is its ID. Calls carry the caller's own
+// bearer token, so revocation needs the admin scope at auth-service too.
+type credentialRevoker struct {
+	url    string
+	client *http.Client
+}
+
+// newCredentialRevoker revokes keys through AUTH_APIKEYS_URL, auth-service's
+// /api/v1/apikeys; nil when it is unset
+func newCredentialRevoker(tlsCfg tlsconfig.Config) *credentialRevoker {
+	apiKeysURL := strings.TrimRight(config.GetEnv("AUTH_APIKEYS_URL", ""), "/")
+	if apiKeysURL == "" {
+		log.Warn().Msg("AUTH_APIKEYS_URL not set, decommissioning will not revoke device API keys")
+		return nil
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	if tlsCfg.Enabled() {
+		var err error
+		if client, err = tlsCfg.HTTPClient(10 * time.Second); err != nil {
+			log.Fatal().Err(err).Msg("Invalid TLS configuration")
+		}
+	}
+	return &credentialRevoker{url: apiKeysURL, client: resilience.ClientFromEnv(dependencyAuthService, client, 10*time.Second, recordBreakerState)}
+}
+
+func (cr *credentialRevoker) do(ctx context.Context, method, target, authorization string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	return cr.client.Do(req)
+}
+
+// keysByOwner returns the IDs of unrevoked keys by owner
+func (cr *credentialRevoker) keysByOwner(ctx context.Context, authorization string) (map[string][]string, error) {
+	resp, err := cr.do(ctx, http.MethodGet, cr.url, authorization)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("auth-service returned %s", resp.Status)
+	}
+	var list struct {
+		Keys []struct {
+			ID        string     `json:"id"`
+			Owner     string     `json:"owner"`
+			RevokedAt *time.Time `json:"revoked_at"`
+		} `json:"api_keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, err
+	}
+	owned := make(map[string][]string)
+	for _, key := range list.Keys {
+		if key.RevokedAt == nil {
+			owned[key.Owner] = append(owned[key.Owner], key.ID)
+		}
+	}
+	return owned, nil
+}
+
+// revoke revokes one key; a key already gone counts as revoked
+func (cr *credentialRevoker) revoke(ctx context.Context, authorization, keyID string) error {
+	resp, err := cr.do(ctx, http.MethodDelete, cr.url+"/"+url.PathEscape(keyID), authorization)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("auth-service returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,487 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// Administrative sexes a cohort can weight, as in FHIR's AdministrativeGender
+const (
+	SexFemale  = "female"
+	SexMale    = "male"
+	SexOther   = "other"
+	SexUnknown = "unknown"
+)
+
+var administrativeSexes = map[string]bool{SexFemale: true, SexMale: true, SexOther: true, SexUnknown: true}
+
+// Demographics a cohort profile does not set
+var (
+	defaultAges    = AgeRange{Min: 18, Max: 92}
+	defaultSexes   = map[string]int{SexFemale: 1, SexMale: 1}
+	defaultLocales = map[string]int{"en-US": 1}
+)
+
+// maxGeneratedPatients caps one POST /simulator/patients request
+const maxGeneratedPatients = 100
+
+// maxSeed bounds seeds the service picks, so they survive JSON clients that read
+// numbers as doubles
+const maxSeed = 1 << 53
+
+// AgeRange bounds patients' ages in whole years, inclusive
+type AgeRange struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+// Comorbidity is an ICD-10 diagnosis a cohort's patients have at a prevalence
+// between 0 and 1, independently of their admitting condition
+type Comorbidity struct {
+	Code       string  `json:"code"`
+	Display    string  `json:"display"`
+	Prevalence float64 `json:"prevalence"`
+}
+
+// SyntheticLocale is a pool of names patients are drawn from. Family names are
+// deliberately implausible, so generated records cannot be mistaken for real ones.
+type SyntheticLocale struct {
+	Code        string   `json:"code"`
+	FemaleNames []string `json:"female_given_names"`
+	MaleNames   []string `json:"male_given_names"`
+	FamilyNames []string `json:"family_names"`
+	// BuiltIn locales cannot be replaced
+	BuiltIn bool `json:"built_in"`
+}
+
+var (
+	cohortMu sync.RWMutex
+	// customCohorts are the profiles loaded from SIMULATOR_COHORTS_FILE or posted
+	customCohorts = make(map[string]CohortProfile)
+	// syntheticLocales holds the built-in and loaded locales
+	syntheticLocales = map[string]SyntheticLocale{
+		"en-US": {
+			Code:        "en-US",
+			FemaleNames: []string{"Olivia", "Emma", "Ava", "Sophia", "Mia", "Harper", "Evelyn", "Abigail"},
+			MaleNames:   []string{"Liam", "Noah", "Oliver", "Elijah", "James", "William", "Henry", "Lucas"},
+			FamilyNames: syntheticFamilyNames,
+			BuiltIn:     true,
+		},
+		"es-MX": {
+			Code:        "es-MX",
+			FemaleNames: []string{"Sofía", "Valentina", "Regina", "Camila", "Ximena", "Mariana", "Renata", "Daniela"},
+			MaleNames:   []string{"Santiago", "Mateo", "Sebastián", "Leonardo", "Emiliano", "Diego", "Miguel", "Daniel"},
+			FamilyNames: []string{"Pruebas", "Simulado", "Ficticio", "Ejemplar", "Muestrario", "Ensayos"},
+			BuiltIn:     true,
+		},
+		"fr-FR": {
+			Code:        "fr-FR",
+			FemaleNames: []string{"Louise", "Jade", "Ambre", "Alice", "Chloé", "Léa", "Manon", "Camille"},
+			MaleNames:   []string{"Gabriel", "Léo", "Raphaël", "Louis", "Arthur", "Jules", "Hugo", "Lucas"},
+			FamilyNames: []string{"Fictif", "Essaiville", "Simulon", "Témoinard", "Maquettier", "Exemplard"},
+			BuiltIn:     true,
+		},
+		"de-DE": {
+			Code:        "de-DE",
+			FemaleNames: []string{"Emilia", "Hannah", "Emma", "Sophia", "Lina", "Mia", "Clara", "Marie"},
+			MaleNames:   []string{"Noah", "Matteo", "Elias", "Finn", "Leon", "Paul", "Emil", "Felix"},
+			FamilyNames: []string{"Mustermann", "Beispielmann", "Probstein", "Simulberg", "Testhofer", "Attrappe"},
+			BuiltIn:     true,
+		},
+	}
+)
+
+var (
+	cohortNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+	localePattern     = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z]{2})?$`)
+	icd10Pattern      = regexp.MustCompile(`^[A-TV-Z][0-9][0-9A-Z](\.[0-9A-Z]{1,4})?$`)
+)
+
+// errBuiltInCohort reports an attempt to replace a built-in profile or locale
+var errBuiltInCohort = errors.New("built-in and cannot be replaced")
+
+// CohortDocument is the shape of SIMULATOR_COHORTS_FILE and of POST
+// /simulator/cohorts: locales first, so profiles can weight them
+type CohortDocument struct {
+	Locales  []SyntheticLocale `json:"locales,omitempty"`
+	Profiles []CohortProfile   `json:"profiles"`
+}
+
+// ages returns the profile's age range, or the default
+func (c CohortProfile) ages() AgeRange {
+	if c.Ages == nil {
+		return defaultAges
+	}
+	return *c.Ages
+}
+
+// demographics draws a patient's age, sex, locale and name from the profile, and
+// gives them an address and insurance
+func (c CohortProfile) demographics(rng *rand.Rand, p *SyntheticPatient) {
+	ages := c.ages()
+	p.setAge(rng, ages.Min+rng.Intn(ages.Max-ages.Min+1))
+
+	sexes, locales := c.Sexes, c.Locales
+	if len(sexes) == 0 {
+		sexes = defaultSexes
+	}
+	if len(locales) == 0 {
+		locales = defaultLocales
+	}
+	p.Sex = pickKey(rng, sexes)
+	p.Locale = pickKey(rng, locales)
+
+	cohortMu.RLock()
+	locale := syntheticLocales[p.Locale]
+	cohortMu.RUnlock()
+	p.GivenName = locale.drawGivenName(rng, p.Sex)
+	p.FamilyName = locale.FamilyNames[rng.Intn(len(locale.FamilyNames))]
+	p.Address = drawAddress(rng)
+	p.Coverage = drawCoverage(rng, p.Age)
+}
+
+// setAge sets a patient's age and a birth date up to a year before the last birthday
+// that gives it
+func (p *SyntheticPatient) setAge(rng *rand.Rand, age int) {
+	p.Age = age
+	p.BirthDate = time.Now().UTC().AddDate(-age, 0, -rng.Intn(365)).Format(time.DateOnly)
+}
+
+// drawGivenName draws a given name for the sex from the locale's pools, from both
+// for other and unknown
+func (l SyntheticLocale) drawGivenName(rng *rand.Rand, sex string) string {
+	given := append(append([]string{}, l.FemaleNames...), l.MaleNames...)
+	switch sex {
+	case SexFemale:
+		given = l.FemaleNames
+	case SexMale:
+		given = l.MaleNames
+	}
+	return given[rng.Intn(len(given))]
+}
+
+// assignComorbidities adds the profile's comorbidities the patient is drawn to have.
+// They are diagnoses, so they are only recorded when ICD-10 is selected.
+func (c CohortProfile) assignComorbidities(rng *rand.Rand, p *SyntheticPatient, systems []string) {
+	enabled := false
+	for _, s := range systems {
+		enabled = enabled || s == CodeSystemICD10
+	}
+	if !enabled {
+		return
+	}
+	for _, cm := range c.Comorbidities {
+		if rng.Float64() < cm.Prevalence {
+			p.Diagnoses = append(p.Diagnoses, CodedConcept{System: CodeSystemICD10, Code: cm.Code, Display: cm.Display})
+		}
+	}
+}
+
+// validate checks a locale's code and name pools
+func (l SyntheticLocale) validate() error {
+	switch {
+	case !localePattern.MatchString(l.Code):
+		return fmt.Errorf("locale %q: code must be a language tag such as en-US", l.Code)
+	case len(l.FemaleNames) == 0 || len(l.MaleNames) == 0 || len(l.FamilyNames) == 0:
+		return fmt.Errorf("locale %q: female, male and family names are required", l.Code)
+	}
+	return nil
+}
+
+// validate checks a profile against the known conditions and the locales, which
+// include those being loaded alongside it
+func (c CohortProfile) validate(locales map[string]bool) error {
+	if !cohortNamePattern.MatchString(c.Name) {
+		return fmt.Errorf("cohort %q: name must be lowercase letters, digits, '-' or '_'", c.Name)
+	}
+	if len(c.Conditions) == 0 {
+		return fmt.Errorf("cohort %q: condition_weights is required", c.Name)
+	}
+	for condition, weight := range c.Conditions {
+		if _, ok := conditionCoding[condition]; !ok {
+			return fmt.Errorf("cohort %q: unknown condition %q", c.Name, condition)
+		}
+		if weight <= 0 {
+			return fmt.Errorf("cohort %q: condition %q must have a positive weight", c.Name, condition)
+		}
+	}
+	if c.Ages != nil && (c.Ages.Min < 0 || c.Ages.Max > 120 || c.Ages.Min > c.Ages.Max) {
+		return fmt.Errorf("cohort %q: age_range must be within 0-120 with min no greater than max", c.Name)
+	}
+	for sex, weight := range c.Sexes {
+		if !administrativeSexes[sex] {
+			return fmt.Errorf("cohort %q: unknown sex %q: use female, male, other or unknown", c.Name, sex)
+		}
+		if weight <= 0 {
+			return fmt.Errorf("cohort %q: sex %q must have a positive weight", c.Name, sex)
+		}
+	}
+	for locale, weight := range c.Locales {
+		if !locales[locale] {
+			return fmt.Errorf("cohort %q: unknown locale %q", c.Name, locale)
+		}
+		if weight <= 0 {
+			return fmt.Errorf("cohort %q: locale %q must have a positive weight", c.Name, locale)
+		}
+	}
+	for _, cm := range c.Comorbidities {
+		switch {
+		case !icd10Pattern.MatchString(cm.Code):
+			return fmt.Errorf("cohort %q: comorbidity %q is not an ICD-10 code", c.Name, cm.Code)
+		case cm.Display == "":
+			return fmt.Errorf("cohort %q: comorbidity %s has no display", c.Name, cm.Code)
+		case cm.Prevalence <= 0 || cm.Prevalence > 1:
+			return fmt.Errorf("cohort %q: comorbidity %s prevalence must be in (0, 1]", c.Name, cm.Code)
+		}
+	}
+	return nil
+}
+
+// registerCohorts validates a document and adds its locales and profiles, all or
+// none of them. Loaded profiles and locales can be replaced; built-in ones cannot.
+func registerCohorts(doc CohortDocument) error {
+	if len(doc.Profiles) == 0 && len(doc.Locales) == 0 {
+		return errors.New("no profiles or locales")
+	}
+
+	cohortMu.Lock()
+	defer cohortMu.Unlock()
+
+	known := make(map[string]bool, len(syntheticLocales)+len(doc.Locales))
+	for code := range syntheticLocales {
+		known[code] = true
+	}
+	for _, l := range doc.Locales {
+		if err := l.validate(); err != nil {
+			return err
+		}
+		if syntheticLocales[l.Code].BuiltIn {
+			return fmt.Errorf("locale %q is %w", l.Code, errBuiltInCohort)
+		}
+		known[l.Code] = true
+	}
+	seen := make(map[string]bool, len(doc.Profiles))
+	for _, p := range doc.Profiles {
+		if err := p.validate(known); err != nil {
+			return err
+		}
+		if _, ok := cohortProfiles[p.Name]; ok {
+			return fmt.Errorf("cohort %q is %w", p.Name, errBuiltInCohort)
+		}
+		if seen[p.Name] {
+			return fmt.Errorf("cohort %q is defined twice", p.Name)
+		}
+		seen[p.Name] = true
+	}
+
+	for _, l := range doc.Locales {
+		l.BuiltIn = false
+		syntheticLocales[l.Code] = l
+	}
+	for _, p := range doc.Profiles {
+		p.BuiltIn = false
+		customCohorts[p.Name] = p
+	}
+	return nil
+}
+
+// loadCohortsFile registers the profiles in a JSON or, by its extension, YAML file.
+// An empty path loads nothing.
+func loadCohortsFile(path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+		// Decode generically and re-encode, so the file uses the same field names
+		// as the API
+		var v interface{}
+		if err := yaml.Unmarshal(data, &v); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if data, err = json.Marshal(v); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	var doc CohortDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if err := registerCohorts(doc); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// RegisterCohortProfilesHandler adds or replaces cohort profiles and locales. The
+// body has the shape of SIMULATOR_COHORTS_FILE.
+func RegisterCohortProfilesHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	fail := func(message string, status int) {
+		http.Error(w, message, status)
+		RecordDeviceOperation("register_cohorts", "error", time.Since(start).Seconds())
+	}
+
+	var doc CohortDocument
+	if err := json.NewDecoder(r.Body).Decode(&doc); err != nil {
+		fail("Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := registerCohorts(doc); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errBuiltInCohort) {
+			status = http.StatusConflict
+		}
+		fail(err.Error(), status)
+		return
+	}
+	RecordDeviceOperation("register_cohorts", "success", time.Since(start).Seconds())
+	log.Info().Int("profiles", len(doc.Profiles)).Int("locales", len(doc.Locales)).Msg("Cohort profiles registered")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(doc)
+}
+
+// GenerationOptions select how on-demand patients are drawn
+type GenerationOptions struct {
+	Cohort      string   `json:"cohort"`
+	CodeSystems []string `json:"code_systems,omitempty"`
+	// Seed makes generation reproducible: the same seed and request always yield the
+	// same patients. One is picked when unset.
+	Seed *int64 `json:"seed,omitempty"`
+}
+
+// resolve applies a ?seed= query parameter, which takes precedence over the body's,
+// and the defaults, and returns the cohort and a source seeded for the request
+func (o *GenerationOptions) resolve(r *http.Request) (CohortProfile, *rand.Rand, error) {
+	if value := r.URL.Query().Get("seed"); value != "" {
+		seed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return CohortProfile{}, nil, errors.New("seed must be an integer")
+		}
+		o.Seed = &seed
+	}
+	if o.Seed == nil {
+		seed := rand.Int63n(maxSeed)
+		o.Seed = &seed
+	}
+	if o.CodeSystems == nil {
+		o.CodeSystems = allCodeSystems
+	}
+	if err := validateCoding(o.Cohort, o.CodeSystems); err != nil {
+		return CohortProfile{}, nil, err
+	}
+	cohort, _ := cohortProfile(o.Cohort)
+	return cohort, rand.New(rand.NewSource(*o.Seed)), nil
+}
+
+// idPrefix starts the IDs of generated records. IDs carry the seed, so datasets
+// generated from different seeds do not collide.
+func (o *GenerationOptions) idPrefix(kind string) string {
+	return "SYN-" + kind + "-" + strings.ToUpper(strconv.FormatUint(uint64(*o.Seed), 36))
+}
+
+// GeneratePatientsRequest asks for patients drawn from a cohort, without admitting
+// them to the simulated fleet. PatientRefs asks for the patients standing for the
+// caller's refs instead of Count new ones.
+type GeneratePatientsRequest struct {
+	GenerationOptions
+	Count       int      `json:"count"`
+	PatientRefs []string `json:"patient_refs,omitempty"`
+	// Households groups the patients into households sharing an address and coverage
+	Households bool `json:"households,omitempty"`
+}
+
+// generate validates the request and draws its patients. The source is returned for
+// drawing anything else about them, after the patients.
+func (req *GeneratePatientsRequest) generate(r *http.Request) (CohortProfile, *rand.Rand, []SyntheticPatient, error) {
+	if len(req.PatientRefs) > 0 {
+		if req.Count != 0 || req.Households {
+			return CohortProfile{}, nil, nil, errors.New("patient_refs cannot be combined with count or households")
+		}
+		req.Count = len(req.PatientRefs)
+	}
+	if req.Count == 0 {
+		req.Count = 1
+	}
+	if req.Count < 1 || req.Count > maxGeneratedPatients {
+		return CohortProfile{}, nil, nil, fmt.Errorf("count must be between 1 and %d", maxGeneratedPatients)
+	}
+	cohort, rng, err := req.resolve(r)
+	if err != nil {
+		return CohortProfile{}, nil, nil, err
+	}
+
+	patients := make([]SyntheticPatient, 0, req.Count)
+	if len(req.PatientRefs) > 0 {
+		for _, ref := range req.PatientRefs {
+			p, err := refPatient(ref, cohort, req.CodeSystems)
+			if err != nil {
+				return CohortProfile{}, nil, nil, err
+			}
+			patients = append(patients, *p)
+		}
+		return cohort, rng, patients, nil
+	}
+	batch := newPatientBatch(rng, cohort, req.CodeSystems, req.idPrefix("GEN"), req.Households)
+	for i := 0; i < req.Count; i++ {
+		patients = append(patients, *batch.next())
+	}
+	return cohort, rng, patients, nil
+}
+
+// GeneratePatientsHandler generates patients from the requested cohort profile. The
+// simulator's own patients keep following its configured cohort. The seed used is
+// echoed in the response, so any dataset can be generated again. Patients are under
+// the care of the batch directory, returned alongside them, whose IDs are the same in
+// every batch; a patient_ref yields the same patient on every call.
+func GeneratePatientsHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	fail := func(message string, status int) {
+		http.Error(w, message, status)
+		RecordDeviceOperation("generate_patients", "error", time.Since(start).Seconds())
+	}
+
+	var req GeneratePatientsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		fail("Invalid request body", http.StatusBadRequest)
+		return
+	}
+	cohort, _, patients, err := req.generate(r)
+	if err != nil {
+		fail(err.Error(), http.StatusBadRequest)
+		return
+	}
+	staff := batchDirectory.staff()
+	RecordDeviceOperation("generate_patients", "success", time.Since(start).Seconds())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"cohort":   cohort.Name,
+		"seed":     *req.Seed,
+		"patients": patients,
+		"count":    len(patients),
+		"directory": map[string]interface{}{
+			"organization":  staff.Organization,
+			"locations":     staff.Locations,
+			"practitioners": staff.Practitioners,
+		},
+	})
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/healthcare-gitops/common/health"
+	"github.com/healthcare-gitops/common/resilience"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog/log"
+)
+
+// Dependencies named in circuit breaker metrics
+const (
+	dependencyAuthService = "auth-service"
+	dependencyPHIService  = "phi-service"
+)
+
+// State of the circuit breakers guarding calls to other services
+var circuitBreakerState = promauto.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "medical_device_circuit_breaker_state",
+		Help: "State of the circuit breaker guarding calls to a dependency: 0 closed, 1 half-open, 2 open",
+	},
+	[]string{"dependency"},
+)
+
+// recordBreakerState exports a breaker's state
+func recordBreakerState(dependency string, state resilience.State) {
+	circuitBreakerState.WithLabelValues(dependency).Set(float64(state))
+}
+
+// dependencyChecks are the readiness checks of the dependencies configured at startup
+var dependencyChecks []health.Check
+
+// readiness checks the device registry and the configured dependencies. Other
+// services only degrade this one: without auth-service only authenticated calls
+// fail, and without phi-service only encrypted webhooks.
+func readiness() health.Checker {
+	checks := append([]health.Check{{
+		Name:     "device_registry",
+		Critical: true,
+		Probe: func(context.Context) error {
+			if registry == nil {
+				return errors.New("device registry not initialized")
+			}
+			return nil
+		},
+	}}, dependencyChecks...)
+	return health.Checker{Service: "medical-device-service", Checks: checks, OnFailure: health.LogFailure}
+}
+
+// addDependencyCheck checks the service behind serviceURL through its /health endpoint
+func addDependencyCheck(dependency, serviceURL string, client *http.Client) {
+	endpoint, err := health.Endpoint(serviceURL)
+	if err != nil {
+		log.Warn().Err(err).Str("dependency", dependency).Msg("Cannot check dependency health")
+		return
+	}
+	dependencyChecks = append(dependencyChecks, health.Check{Name: dependency, Probe: health.HTTP(client, endpoint)})
+}
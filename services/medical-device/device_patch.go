@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// readOnlyDeviceFields are managed by the service and cannot be changed through PATCH
+var readOnlyDeviceFields = map[string]bool{
+	"id":             true,
+	"uptime_seconds": true,
+	"last_heartbeat": true,
+	"alert_level":    true, // derived from active alerts
+	// fixed at registration
+	"synthetic":            true,
+	"synthetic_origin":     true,
+	"synthetic_expires_at": true,
+}
+
+var validDeviceTypes = map[DeviceType]bool{
+	DeviceTypeMRI:        true,
+	DeviceTypeCTScanner:  true,
+	DeviceTypeXRay:       true,
+	DeviceTypeECG:        true,
+	DeviceTypeVentilator: true,
+	DeviceTypePump:       true,
+}
+
+var validDeviceStatuses = map[DeviceStatus]bool{
+	StatusOperational: true,
+	StatusDegraded:    true,
+	StatusOffline:     true,
+	StatusMaintenance: true,
+	StatusError:       true,
+}
+
+// mergePatch applies an RFC 7386 JSON merge patch to target.
+// A null value removes the member; nested objects are merged recursively.
+func mergePatch(target, patch map[string]interface{}) map[string]interface{} {
+	if target == nil {
+		target = make(map[string]interface{})
+	}
+	for key, value := range patch {
+		if value == nil {
+			delete(target, key)
+			continue
+		}
+		if patchObj, ok := value.(map[string]interface{}); ok {
+			targetObj, _ := target[key].(map[string]interface{})
+			target[key] = mergePatch(targetObj, patchObj)
+			continue
+		}
+		target[key] = value
+	}
+	return target
+}
+
+// validateDevicePatch checks the patch document against the current device and
+// returns field-level validation errors keyed by JSON field name
+func validateDevicePatch(current map[string]interface{}, patch map[string]interface{}) map[string]string {
+	fieldErrors := make(map[string]string)
+
+	for key, value := range patch {
+		if readOnlyDeviceFields[key] {
+			// Echoing the current value back is harmless; changing it is not
+			if value == nil || fmt.Sprint(value) != fmt.Sprint(current[key]) {
+				fieldErrors[key] = "field is read-only"
+			}
+			continue
+		}
+
+		switch key {
+		case "type":
+			if value == nil {
+				fieldErrors[key] = "field is required"
+				continue
+			}
+			s, ok := value.(string)
+			if !ok || !validDeviceTypes[DeviceType(s)] {
+				fieldErrors[key] = "must be a supported device type"
+			}
+		case "status":
+			if value == nil {
+				fieldErrors[key] = "field is required"
+				continue
+			}
+			s, ok := value.(string)
+			if !ok || !validDeviceStatuses[DeviceStatus(s)] {
+				fieldErrors[key] = "must be one of operational, degraded, offline, maintenance, error"
+			}
+		case "error_count", "heartbeat_interval_seconds":
+			if value == nil {
+				continue
+			}
+			n, ok := value.(float64)
+			if !ok || n < 0 || n != float64(int64(n)) {
+				fieldErrors[key] = "must be a non-negative integer"
+			}
+		case "last_calibration", "next_maintenance":
+			if value == nil {
+				continue
+			}
+			s, ok := value.(string)
+			if !ok {
+				fieldErrors[key] = "must be an RFC 3339 timestamp"
+				continue
+			}
+			if _, err := time.Parse(time.RFC3339, s); err != nil {
+				fieldErrors[key] = "must be an RFC 3339 timestamp"
+			}
+		case "location", "serial_number", "manufacturer", "model", "firmware_version":
+			if value == nil {
+				continue
+			}
+			if _, ok := value.(string); !ok {
+				fieldErrors[key] = "must be a string"
+			}
+		default:
+			fieldErrors[key] = "unknown field"
+		}
+	}
+
+	return fieldErrors
+}
+
+// PatchDevice applies a JSON merge patch to a registered device, leaving
+// fields absent from the patch untouched
+func (dr *DeviceRegistry) PatchDevice(deviceID string, patch map[string]interface{}) (*MedicalDevice, map[string]string, error) {
+	device, err := dr.GetDevice(deviceID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	device.mu.Lock()
+	defer device.mu.Unlock()
+
+	raw, err := json.Marshal(device)
+	if err != nil {
+		return nil, nil, err
+	}
+	var current map[string]interface{}
+	if err := json.Unmarshal(raw, &current); err != nil {
+		return nil, nil, err
+	}
+
+	if fieldErrors := validateDevicePatch(current, patch); len(fieldErrors) > 0 {
+		return nil, fieldErrors, nil
+	}
+
+	merged, err := json.Marshal(mergePatch(current, patch))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var patched MedicalDevice
+	if err := json.Unmarshal(merged, &patched); err != nil {
+		return nil, nil, err
+	}
+
+	device.Type = patched.Type
+	device.Status = patched.Status
+	device.Location = patched.Location
+	device.SerialNumber = patched.SerialNumber
+	device.Manufacturer = patched.Manufacturer
+	device.Model = patched.Model
+	device.FirmwareVersion = patched.FirmwareVersion
+	device.LastCalibration = patched.LastCalibration
+	device.NextMaintenance = patched.NextMaintenance
+	device.ErrorCount = patched.ErrorCount
+	device.HeartbeatIntervalSeconds = patched.HeartbeatIntervalSeconds
+
+	dr.syncStatusAlertsLocked(device, time.Now())
+
+	return device, nil, nil
+}
+
+// PatchDeviceHandler partially updates a device using JSON merge-patch semantics
+func PatchDeviceHandler(w http.ResponseWriter, r *http.Request) {
+	deviceID := chi.URLParam(r, "deviceID")
+	ctx := r.Context()
+	span := trace.SpanFromContext(ctx)
+	start := time.Now()
+
+	var patch map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil || patch == nil {
+		http.Error(w, "Invalid merge patch document", http.StatusBadRequest)
+		RecordDeviceOperation("patch", "error", time.Since(start).Seconds())
+		return
+	}
+
+	device, fieldErrors, err := registry.PatchDevice(deviceID, patch)
+	if err != nil {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		RecordDeviceOperation("patch", "error", time.Since(start).Seconds())
+		span.RecordError(err)
+		return
+	}
+	if len(fieldErrors) > 0 {
+		RecordDeviceOperation("patch", "error", time.Since(start).Seconds())
+		span.SetAttributes(attribute.String("error.type", "validation"))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":  "validation failed",
+			"fields": fieldErrors,
+		})
+		return
+	}
+
+	duration := time.Since(start).Seconds()
+	RecordDeviceOperation("patch", "success", duration)
+	span.SetAttributes(attribute.String("device.id", deviceID))
+
+	fields := make([]string, 0, len(patch))
+	for key := range patch {
+		fields = append(fields, key)
+	}
+	log.Info().Str("device_id", deviceID).Strs("fields", fields).Msg("Device patched")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(device)
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// practitionersPerUnit is how many synthetic practitioners staff each care unit
+const practitionersPerUnit = 2
+
+// Synthetic encounter states, matching the FHIR Encounter.status codes
+const (
+	EncounterInProgress = "in-progress"
+	EncounterFinished   = "finished"
+)
+
+// Encounter classes, matching the FHIR v3 ActCode codes
+const (
+	EncounterClassInpatient  = "IMP"
+	EncounterClassEmergency  = "EMER"
+	EncounterClassAmbulatory = "AMB"
+)
+
+// unitSpecialties is the specialty of the practitioners staffing each care unit
+var unitSpecialties = map[string]string{
+	"ICU":                  "Critical Care Medicine",
+	"Emergency":            "Emergency Medicine",
+	"Cardiology":           "Cardiovascular Disease",
+	"Radiology Department": "Diagnostic Radiology",
+	"Surgery":              "General Surgery",
+	"Ward B":               "Internal Medicine",
+}
+
+var (
+	syntheticGivenNames  = []string{"Avery", "Jordan", "Riley", "Morgan", "Quinn", "Casey", "Rowan", "Emerson", "Harper", "Sage", "Reese", "Dakota"}
+	syntheticFamilyNames = []string{"Synthwell", "Testbury", "Mockford", "Sampleton", "Fauxley", "Simmons-Test", "Demoreau"}
+)
+
+// SyntheticOrganization is the generated facility that owns every location and practitioner
+type SyntheticOrganization struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// NPI, TaxID and Address identify the organization on the claims it bills
+	NPI     string           `json:"npi"`
+	TaxID   string           `json:"tax_id"`
+	Address SyntheticAddress `json:"address"`
+}
+
+// syntheticOrganization is the generated hospital. Its NPI is the synthetic range's
+// first, and EINs starting 00 are never issued.
+func syntheticOrganization() SyntheticOrganization {
+	return SyntheticOrganization{
+		ID:      "SYN-ORG-001",
+		Name:    "Synthetic General Hospital",
+		NPI:     syntheticNPI(0),
+		TaxID:   "00-0000001",
+		Address: SyntheticAddress{Line1: "1 Synthetic Way", City: "Testville", State: "OH", PostalCode: "00001"},
+	}
+}
+
+// SyntheticLocation is a generated care unit within the organization
+type SyntheticLocation struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	OrganizationID string `json:"organization_id"`
+}
+
+// SyntheticPractitioner is a generated clinician. NPIs start with 9, a prefix CMS
+// has never issued, so they pass format and check-digit validation without
+// colliding with a real provider.
+type SyntheticPractitioner struct {
+	ID             string `json:"id"`
+	NPI            string `json:"npi"`
+	GivenName      string `json:"given_name"`
+	FamilyName     string `json:"family_name"`
+	Specialty      string `json:"specialty"`
+	LocationID     string `json:"location_id"`
+	OrganizationID string `json:"organization_id"`
+}
+
+// SyntheticEncounter is a generated admission linking a patient to the practitioner
+// attending them and the location they are in
+type SyntheticEncounter struct {
+	ID             string     `json:"id"`
+	PatientID      string     `json:"patient_id"`
+	PractitionerID string     `json:"practitioner_id"`
+	LocationID     string     `json:"location_id"`
+	OrganizationID string     `json:"organization_id"`
+	Class          string     `json:"class"`
+	Status         string     `json:"status"`
+	Start          time.Time  `json:"start"`
+	End            *time.Time `json:"end,omitempty"`
+}
+
+// SyntheticDirectory holds the generated organization, its locations and staff, and
+// the encounters admitting synthetic patients. It is guarded by the owning
+// simulator's lock.
+type SyntheticDirectory struct {
+	organization  SyntheticOrganization
+	locations     map[string]*SyntheticLocation // by care unit name
+	locationOrder []string
+	practitioners []*SyntheticPractitioner
+	byUnit        map[string][]*SyntheticPractitioner
+	// nextAttending rotates admissions through a unit's practitioners
+	nextAttending map[string]int
+	encounters    map[string]*SyntheticEncounter // by patient ID
+	encounterSeq  int
+	// patients keeps every admitted patient, including discharged ones, so
+	// finished encounters still resolve
+	patients map[string]*SyntheticPatient
+}
+
+// newSyntheticDirectory creates the organization and staffs the default care units
+func newSyntheticDirectory() *SyntheticDirectory {
+	d := &SyntheticDirectory{
+		organization:  syntheticOrganization(),
+		locations:     make(map[string]*SyntheticLocation),
+		byUnit:        make(map[string][]*SyntheticPractitioner),
+		nextAttending: make(map[string]int),
+		encounters:    make(map[string]*SyntheticEncounter),
+		patients:      make(map[string]*SyntheticPatient),
+	}
+	for _, unit := range simulatedLocations {
+		d.location(unit)
+	}
+	return d
+}
+
+// careUnit extracts the unit from a device location such as "ICU - Bed 2"
+func careUnit(location string) string {
+	unit, _, _ := strings.Cut(location, " - ")
+	if unit = strings.TrimSpace(unit); unit == "" {
+		return "General"
+	}
+	return unit
+}
+
+// location returns the location for a care unit, creating and staffing it on first use
+func (d *SyntheticDirectory) location(unit string) *SyntheticLocation {
+	if loc, ok := d.locations[unit]; ok {
+		return loc
+	}
+
+	loc := &SyntheticLocation{
+		ID:             fmt.Sprintf("SYN-LOC-%03d", len(d.locationOrder)+1),
+		Name:           unit,
+		OrganizationID: d.organization.ID,
+	}
+	d.locations[unit] = loc
+	d.locationOrder = append(d.locationOrder, unit)
+
+	specialty, ok := unitSpecialties[unit]
+	if !ok {
+		specialty = "Internal Medicine"
+	}
+	for i := 0; i < practitionersPerUnit; i++ {
+		n := len(d.practitioners) + 1
+		p := &SyntheticPractitioner{
+			ID:             fmt.Sprintf("SYN-PR-%05d", n),
+			NPI:            syntheticNPI(n),
+			GivenName:      syntheticGivenNames[n%len(syntheticGivenNames)],
+			FamilyName:     syntheticFamilyNames[n%len(syntheticFamilyNames)],
+			Specialty:      specialty,
+			LocationID:     loc.ID,
+			OrganizationID: d.organization.ID,
+		}
+		d.practitioners = append(d.practitioners, p)
+		d.byUnit[unit] = append(d.byUnit[unit], p)
+	}
+	return loc
+}
+
+// syntheticNPI builds the n-th synthetic NPI: 9, eight digits, then the Luhn check
+// digit computed over the 80840 card issuer prefix as the NPI standard requires
+func syntheticNPI(n int) string {
+	base := fmt.Sprintf("9%08d", n)
+	return base + string(rune('0'+npiCheckDigit(base)))
+}
+
+// npiCheckDigit computes the check digit for the first nine digits of an NPI
+func npiCheckDigit(base string) int {
+	digits := "80840" + base
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		// The rightmost payload digit is doubled, as the check digit will follow it
+		if (len(digits)-1-i)%2 == 0 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return (10 - sum%10) % 10
+}
+
+// admit opens an encounter for a patient at the unit of the given device location
+func (d *SyntheticDirectory) admit(patient *SyntheticPatient, deviceLocation string, at time.Time) *SyntheticEncounter {
+	unit := careUnit(deviceLocation)
+	loc := d.location(unit)
+	staff := d.byUnit[unit]
+	attending := staff[d.nextAttending[unit]%len(staff)]
+	d.nextAttending[unit]++
+
+	class := EncounterClassInpatient
+	if unit == "Emergency" {
+		class = EncounterClassEmergency
+	}
+
+	d.encounterSeq++
+	enc := &SyntheticEncounter{
+		ID:             fmt.Sprintf("SYN-ENC-%05d", d.encounterSeq),
+		PatientID:      patient.ID,
+		PractitionerID: attending.ID,
+		LocationID:     loc.ID,
+		OrganizationID: d.organization.ID,
+		Class:          class,
+		Status:         EncounterInProgress,
+		Start:          at,
+	}
+	d.encounters[patient.ID] = enc
+	d.patients[patient.ID] = patient
+	return enc
+}
+
+// discharge finishes a patient's open encounter
+func (d *SyntheticDirectory) discharge(patientID string, at time.Time) {
+	if enc, ok := d.encounters[patientID]; ok && enc.Status == EncounterInProgress {
+		enc.Status = EncounterFinished
+		enc.End = &at
+	}
+}
+
+// SyntheticDataset is a consistent copy of everything the generator has produced
+type SyntheticDataset struct {
+	Organization  SyntheticOrganization   `json:"organization"`
+	Locations     []SyntheticLocation     `json:"locations"`
+	Practitioners []SyntheticPractitioner `json:"practitioners"`
+	Patients      []SyntheticPatient      `json:"patients"`
+	Encounters    []SyntheticEncounter    `json:"encounters"`
+}
+
+// staff copies the directory's organization, locations and practitioners
+func (d *SyntheticDirectory) staff() SyntheticDataset {
+	ds := SyntheticDataset{Organization: d.organization}
+	for _, unit := range d.locationOrder {
+		ds.Locations = append(ds.Locations, *d.locations[unit])
+	}
+	for _, p := range d.practitioners {
+		ds.Practitioners = append(ds.Practitioners, *p)
+	}
+	return ds
+}
+
+// Dataset copies the synthetic directory, patients and encounters
+func (s *Simulator) Dataset() SyntheticDataset {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.directory
+	ds := d.staff()
+	for _, patient := range d.patients {
+		ds.Patients = append(ds.Patients, *patient)
+	}
+	sortSyntheticPatients(ds.Patients)
+
+	for _, enc := range d.encounters {
+		ds.Encounters = append(ds.Encounters, *enc)
+	}
+	sortEncounters(ds.Encounters)
+	return ds
+}
+
+// GetSyntheticDirectoryHandler lists the synthetic organization, locations and practitioners
+func GetSyntheticDirectoryHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	ds := simulator.Dataset()
+	RecordDeviceOperation("get_synthetic_directory", "success", time.Since(start).Seconds())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"organization":  ds.Organization,
+		"locations":     ds.Locations,
+		"practitioners": ds.Practitioners,
+	})
+}
+
+// ListSyntheticEncountersHandler lists encounters linking synthetic patients to
+// practitioners and locations. Supports ?status=in-progress|finished.
+func ListSyntheticEncountersHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	status := r.URL.Query().Get("status")
+	if status != "" && status != EncounterInProgress && status != EncounterFinished {
+		http.Error(w, "status must be in-progress or finished", http.StatusBadRequest)
+		RecordDeviceOperation("list_synthetic_encounters", "error", time.Since(start).Seconds())
+		return
+	}
+
+	encounters := make([]SyntheticEncounter, 0)
+	for _, enc := range simulator.Dataset().Encounters {
+		if status == "" || enc.Status == status {
+			encounters = append(encounters, enc)
+		}
+	}
+	RecordDeviceOperation("list_synthetic_encounters", "success", time.Since(start).Seconds())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"encounters": encounters,
+		"count":      len(encounters),
+	})
+}
+
+// sortSyntheticPatients orders patients by ID
+func sortSyntheticPatients(patients []SyntheticPatient) {
+	sort.Slice(patients, func(i, j int) bool { return patients[i].ID < patients[j].ID })
+}
+
+// sortEncounters orders encounters by ID, which follows admission order
+func sortEncounters(encounters []SyntheticEncounter) {
+	sort.Slice(encounters, func(i, j int) bool { return encounters[i].ID < encounters[j].ID })
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/healthcare-gitops/common/config"
+	"github.com/healthcare-gitops/common/documents"
+	"github.com/rs/zerolog/log"
+)
+
+// Record types documents can be attached to
+const (
+	OwnerWorkOrder   = "work_order"
+	OwnerCalibration = "calibration"
+)
+
+// maxDocumentSearchResults caps a document search
+const maxDocumentSearchResults = 500
+
+// library holds attachments; nil when the documents feature is off
+var library *documents.Library
+
+// openDocumentLibrary opens the attachment library on DOCUMENTS_DIR, or in memory
+// when it is unset, scanning uploads with DOCUMENTS_SCAN_URL when set
+func openDocumentLibrary(ctx context.Context) (*documents.Library, error) {
+	var store documents.Store = documents.NewMemoryStore()
+	if dir := config.GetEnv("DOCUMENTS_DIR", ""); dir != "" {
+		fileStore, err := documents.NewFileStore(dir)
+		if err != nil {
+			return nil, err
+		}
+		store = fileStore
+	} else {
+		log.Warn().Msg("DOCUMENTS_DIR not set, attachments will not survive a restart")
+	}
+
+	policy := documents.DefaultPolicy
+	policy.MaxSize = int64(config.GetEnvInt("DOCUMENTS_MAX_BYTES", documents.DefaultMaxSize))
+
+	var scanner documents.Scanner
+	if url := config.GetEnv("DOCUMENTS_SCAN_URL", ""); url != "" {
+		scanner = documents.NewHTTPScanner(url, 30*time.Second)
+	} else {
+		log.Warn().Msg("DOCUMENTS_SCAN_URL not set, attachments will not be scanned for malware")
+	}
+	return documents.Open(ctx, store, policy, scanner)
+}
+
+// attachmentOwner resolves the record an attachment route refers to
+func attachmentOwner(r *http.Request) (ownerType, ownerID string, err error) {
+	if scheduleID := chi.URLParam(r, "scheduleID"); scheduleID != "" {
+		if _, ok := maintenanceScheduler.Schedule(scheduleID); !ok {
+			return "", "", fmt.Errorf("%w: maintenance schedule %s", documents.ErrNotFound, scheduleID)
+		}
+		return OwnerWorkOrder, scheduleID, nil
+	}
+	certificateID := chi.URLParam(r, "certificateID")
+	if _, ok := calibrations.Certificate(certificateID); !ok {
+		return "", "", fmt.Errorf("%w: calibration %s", documents.ErrNotFound, certificateID)
+	}
+	return OwnerCalibration, certificateID, nil
+}
+
+// writeDocumentError maps document errors to HTTP statuses
+func writeDocumentError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.Is(err, documents.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, documents.ErrTooLarge), errors.As(err, &tooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, documents.ErrUnsupportedType):
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+	case errors.Is(err, documents.ErrInfected), errors.Is(err, documents.ErrEmpty):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(err, documents.ErrScanFailed):
+		log.Error().Err(err).Msg("Attachment scan failed")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	default:
+		log.Error().Err(err).Msg("Attachment storage failed")
+		http.Error(w, "Attachment storage failed", http.StatusInternalServerError)
+	}
+}
+
+// UploadAttachmentHandler attaches a file to a work order or calibration. The request
+// is multipart/form-data with the file in "file" and optional "description", "tags"
+// (comma-separated) and "uploaded_by" fields.
+func UploadAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	ownerType, ownerID, err := attachmentOwner(r)
+	if err != nil {
+		writeDocumentError(w, err)
+		RecordDeviceOperation("upload_attachment", "error", time.Since(start).Seconds())
+		return
+	}
+
+	// Leave room for the form fields around the file
+	r.Body = http.MaxBytesReader(w, r.Body, library.Policy().MaxSize+1<<20)
+	if err := r.ParseMultipartForm(8 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeDocumentError(w, err)
+		} else {
+			http.Error(w, "Request must be multipart/form-data with a file field", http.StatusBadRequest)
+		}
+		RecordDeviceOperation("upload_attachment", "error", time.Since(start).Seconds())
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "file field is required", http.StatusBadRequest)
+		RecordDeviceOperation("upload_attachment", "error", time.Since(start).Seconds())
+		return
+	}
+	defer file.Close()
+
+	var tags []string
+	for _, tag := range strings.Split(r.FormValue("tags"), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	doc, err := library.Add(r.Context(), documents.Upload{
+		OwnerType:   ownerType,
+		OwnerID:     ownerID,
+		Filename:    header.Filename,
+		Description: r.FormValue("description"),
+		Tags:        tags,
+		UploadedBy:  r.FormValue("uploaded_by"),
+	}, file)
+	if err != nil {
+		writeDocumentError(w, err)
+		RecordDeviceOperation("upload_attachment", "error", time.Since(start).Seconds())
+		return
+	}
+
+	RecordDeviceOperation("upload_attachment", "success", time.Since(start).Seconds())
+	log.Info().
+		Str("document_id", doc.ID).
+		Str("owner_type", ownerType).
+		Str("owner_id", ownerID).
+		Str("content_type", doc.ContentType).
+		Int64("size", doc.Size).
+		Str("scan", doc.Scan.Status).
+		Msg("Attachment stored")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(doc)
+}
+
+// ListAttachmentsHandler lists the attachments of a work order or calibration
+func ListAttachmentsHandler(w http.ResponseWriter, r *http.Request) {
+	ownerType, ownerID, err := attachmentOwner(r)
+	if err != nil {
+		writeDocumentError(w, err)
+		return
+	}
+	docs := library.Search(documents.Query{OwnerType: ownerType, OwnerID: ownerID})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"owner_type": ownerType,
+		"owner_id":   ownerID,
+		"documents":  docs,
+		"count":      len(docs),
+	})
+}
+
+// SearchDocumentsHandler searches attachment metadata. Supports ?owner_type=,
+// ?owner_id=, ?content_type= (exact, or a family such as image/), ?tag=,
+// ?uploaded_by=, ?q= (filename or description), ?since=, ?until= (RFC 3339) and
+// ?limit= (default 100).
+func SearchDocumentsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := documents.Query{
+		OwnerType:   query.Get("owner_type"),
+		OwnerID:     query.Get("owner_id"),
+		ContentType: query.Get("content_type"),
+		Tag:         query.Get("tag"),
+		UploadedBy:  query.Get("uploaded_by"),
+		Text:        query.Get("q"),
+		Limit:       100,
+	}
+	for name, dst := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+		if value := query.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				http.Error(w, name+" must be an RFC 3339 timestamp", http.StatusBadRequest)
+				return
+			}
+			*dst = t
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxDocumentSearchResults {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxDocumentSearchResults), http.StatusBadRequest)
+			return
+		}
+		q.Limit = n
+	}
+
+	docs := library.Search(q)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"documents": docs,
+		"count":     len(docs),
+	})
+}
+
+// GetDocumentHandler returns an attachment's metadata
+func GetDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	doc, err := library.Get(chi.URLParam(r, "documentID"))
+	if err != nil {
+		writeDocumentError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(doc)
+}
+
+// GetDocumentContentHandler downloads an attachment
+func GetDocumentContentHandler(w http.ResponseWriter, r *http.Request) {
+	doc, body, err := library.Content(r.Context(), chi.URLParam(r, "documentID"))
+	if err != nil {
+		writeDocumentError(w, err)
+		return
+	}
+	defer body.Close()
+
+	w.Header().Set("Content-Type", doc.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(doc.Size, 10))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", doc.Filename))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("ETag", `"`+doc.SHA256+`"`)
+	io.Copy(w, body)
+}
+
+// DeleteDocumentHandler removes an attachment
+func DeleteDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+	if err := library.Delete(r.Context(), documentID); err != nil {
+		writeDocumentError(w, err)
+		return
+	}
+	log.Info().Str("document_id", documentID).Msg("Attachment deleted")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"github.com/healthcare-gitops/common/events"
+	"github.com/rs/zerolog/log"
+)
+
+// eventStream is the broker device.registered events are streamed to, for analytics
+// pipelines that follow the fleet without registering webhooks
+var eventStream *events.Stream
+
+// configureEventStream opens the Kafka or NATS broker EVENT_BROKER selects
+func configureEventStream() error {
+	cfg := events.StreamConfigFromEnv()
+	cfg.OnPublish = func(n int, err error) {
+		if err != nil {
+			log.Warn().Err(err).Int("events", n).Msg("Event broker unavailable, streamed events dropped")
+		}
+	}
+	stream, err := events.OpenStream("medical-device-service", cfg)
+	if err != nil {
+		return err
+	}
+	eventStream = stream
+	return nil
+}
+
+// streamEvent publishes an event to the broker, logging one that is withheld
+func streamEvent(eventType, key string, data interface{}) {
+	if err := eventStream.Publish(eventType, key, data); err != nil {
+		log.Error().Err(err).Str("event_type", eventType).Str("key", key).Msg("Event not streamed")
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Export formats
+const (
+	ExportFormatNDJSON = "ndjson"
+	ExportFormatCSV    = "csv"
+)
+
+// maxExportPatients caps one export; patients are generated as they are written, so
+// memory does not grow with the count
+const maxExportPatients = 5_000_000
+
+// exportWriteTimeout is the write deadline for one export, which outlasts the
+// server's write timeout
+const exportWriteTimeout = 30 * time.Minute
+
+// exportFlushEvery is how many patients are written between flushes to the client
+const exportFlushEvery = 1000
+
+// exportCSVHeader names the CSV columns. Coded fields list codes separated by ';',
+// and labs as code=value unit.
+var exportCSVHeader = []string{
+	"id", "given_name", "family_name", "sex", "age", "birth_date", "locale", "cohort",
+	"payer_id", "member_id", "relationship", "household_id", "practitioner_id", "location_id", "conditions", "diagnoses", "procedures", "medications", "labs",
+}
+
+// ExportPatientsRequest asks for a bulk export of patients drawn from a cohort
+type ExportPatientsRequest struct {
+	GenerationOptions
+	Count  int    `json:"count"`
+	Format string `json:"format,omitempty"`
+	Gzip   bool   `json:"gzip,omitempty"`
+	// Households groups the patients into households, as for POST /simulator/patients
+	Households bool `json:"households,omitempty"`
+}
+
+// patientWriter writes one patient in an export format
+type patientWriter interface {
+	write(p *SyntheticPatient) error
+	flush() error
+}
+
+type ndjsonWriter struct {
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+func newNDJSONWriter(w io.Writer) *ndjsonWriter {
+	buf := bufio.NewWriter(w)
+	return &ndjsonWriter{buf: buf, enc: json.NewEncoder(buf)}
+}
+
+func (n *ndjsonWriter) write(p *SyntheticPatient) error {
+	return n.enc.Encode(p)
+}
+
+func (n *ndjsonWriter) flush() error {
+	return n.buf.Flush()
+}
+
+type csvWriter struct {
+	csv *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	c := &csvWriter{csv: csv.NewWriter(w)}
+	return c, c.csv.Write(exportCSVHeader)
+}
+
+func (c *csvWriter) write(p *SyntheticPatient) error {
+	labs := make([]string, 0, len(p.Labs))
+	for _, lab := range p.Labs {
+		labs = append(labs, fmt.Sprintf("%s=%s %s", lab.Test.Code, strconv.FormatFloat(lab.Value, 'f', -1, 64), lab.Unit))
+	}
+	return c.csv.Write([]string{
+		p.ID, p.GivenName, p.FamilyName, p.Sex, strconv.Itoa(p.Age), p.BirthDate, p.Locale, p.Cohort,
+		p.Coverage.Payer.ID, p.Coverage.MemberID, p.Coverage.Relationship,
+		p.HouseholdID, p.PractitionerID, p.LocationID,
+		strings.Join(p.Conditions, ";"),
+		joinCodes(p.Diagnoses), joinCodes(p.Procedures), joinCodes(p.Medications),
+		strings.Join(labs, ";"),
+	})
+}
+
+func (c *csvWriter) flush() error {
+	c.csv.Flush()
+	return c.csv.Error()
+}
+
+// joinCodes lists concepts' codes separated by ';'
+func joinCodes(concepts []CodedConcept) string {
+	codes := make([]string, len(concepts))
+	for i, c := range concepts {
+		codes[i] = c.Code
+	}
+	return strings.Join(codes, ";")
+}
+
+// ExportPatientsHandler streams patients drawn from a cohort profile as NDJSON or
+// CSV, optionally gzipped, for seeding test databases. Each patient is generated as
+// it is written, so an export of millions holds only one in memory. Patients and
+// their IDs match POST /simulator/patients with the same seed, which is returned in
+// the X-Synthetic-Seed header.
+func ExportPatientsHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	fail := func(message string, status int) {
+		http.Error(w, message, status)
+		RecordDeviceOperation("export_patients", "error", time.Since(start).Seconds())
+	}
+
+	var req ExportPatientsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		fail("Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Format == "" {
+		req.Format = ExportFormatNDJSON
+	}
+	if req.Format != ExportFormatNDJSON && req.Format != ExportFormatCSV {
+		fail(fmt.Sprintf("unsupported format %q: use ndjson or csv", req.Format), http.StatusBadRequest)
+		return
+	}
+	if req.Count < 1 || req.Count > maxExportPatients {
+		fail(fmt.Sprintf("count must be between 1 and %d", maxExportPatients), http.StatusBadRequest)
+		return
+	}
+	cohort, rng, err := req.resolve(r)
+	if err != nil {
+		fail(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Large exports outlast the server's write timeout
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+
+	prefix := req.idPrefix("GEN")
+	contentType, filename := "application/x-ndjson", "patients-"+strings.TrimPrefix(prefix, "SYN-GEN-")+".ndjson"
+	if req.Format == ExportFormatCSV {
+		contentType, filename = "text/csv; charset=utf-8", strings.TrimSuffix(filename, ".ndjson")+".csv"
+	}
+	var out io.Writer = w
+	var zw *gzip.Writer
+	if req.Gzip {
+		contentType, filename = "application/gzip", filename+".gz"
+		zw = gzip.NewWriter(w)
+		out = zw
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("X-Synthetic-Seed", strconv.FormatInt(*req.Seed, 10))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	var pw patientWriter
+	if req.Format == ExportFormatCSV {
+		cw, err := newCSVWriter(out)
+		if err != nil {
+			fail("Export failed", http.StatusInternalServerError)
+			return
+		}
+		pw = cw
+	} else {
+		pw = newNDJSONWriter(out)
+	}
+
+	// Once streaming has begun the status is sent; a failed write means the client
+	// went away, so the export stops
+	batch := newPatientBatch(rng, cohort, req.CodeSystems, prefix, req.Households)
+	written := 0
+	for i := 1; i <= req.Count; i++ {
+		if err = pw.write(batch.next()); err != nil {
+			break
+		}
+		written++
+		if i%exportFlushEvery == 0 {
+			if err = pw.flush(); err != nil {
+				break
+			}
+			if zw != nil {
+				if err = zw.Flush(); err != nil {
+					break
+				}
+			}
+			rc.Flush()
+		}
+	}
+	if err == nil {
+		err = pw.flush()
+	}
+	if err == nil && zw != nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		log.Warn().Err(err).Int("written", written).Int("requested", req.Count).Msg("Patient export interrupted")
+		RecordDeviceOperation("export_patients", "error", time.Since(start).Seconds())
+		return
+	}
+	RecordDeviceOperation("export_patients", "success", time.Since(start).Seconds())
+	log.Info().Int("patients", written).Str("format", req.Format).Bool("gzip", req.Gzip).Dur("elapsed", time.Since(start)).Msg("Patients exported")
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// fhirTestDataTag marks every generated resource as test data, so FHIR servers and
+// downstream consumers can tell it apart from real records
+var fhirTestDataTag = map[string]interface{}{
+	"system":  "http://terminology.hl7.org/CodeSystem/v3-ActReason",
+	"code":    "HTEST",
+	"display": "test health data",
+}
+
+// fhirResourceTypes are the resource types the synthetic bundle can contain
+var fhirResourceTypes = map[string]bool{
+	"Organization":      true,
+	"Location":          true,
+	"Practitioner":      true,
+	"PractitionerRole":  true,
+	"Patient":           true,
+	"Coverage":          true,
+	"Encounter":         true,
+	"Condition":         true,
+	"Procedure":         true,
+	"Observation":       true,
+	"MedicationRequest": true,
+}
+
+// FHIRBundle is a FHIR R4 collection bundle
+type FHIRBundle struct {
+	ResourceType string            `json:"resourceType"`
+	Type         string            `json:"type"`
+	Timestamp    string            `json:"timestamp"`
+	Total        int               `json:"total"`
+	Entry        []FHIRBundleEntry `json:"entry"`
+}
+
+// FHIRBundleEntry wraps one resource in a bundle
+type FHIRBundleEntry struct {
+	Resource map[string]interface{} `json:"resource"`
+}
+
+func fhirResource(resourceType, id string) map[string]interface{} {
+	return map[string]interface{}{
+		"resourceType": resourceType,
+		"id":           id,
+		"meta":         map[string]interface{}{"tag": []interface{}{fhirTestDataTag}},
+	}
+}
+
+func fhirReference(resourceType, id string) map[string]interface{} {
+	return map[string]interface{}{"reference": resourceType + "/" + id}
+}
+
+func fhirCoding(system, code, display string) map[string]interface{} {
+	return map[string]interface{}{
+		"coding": []interface{}{map[string]interface{}{"system": system, "code": code, "display": display}},
+	}
+}
+
+// fhirOrganization converts the synthetic organization to a FHIR Organization
+func fhirOrganization(org SyntheticOrganization) map[string]interface{} {
+	res := fhirResource("Organization", org.ID)
+	res["active"] = true
+	res["name"] = org.Name
+	res["type"] = []interface{}{fhirCoding("http://terminology.hl7.org/CodeSystem/organization-type", "prov", "Healthcare Provider")}
+	return res
+}
+
+// fhirLocation converts a synthetic care unit to a FHIR Location
+func fhirLocation(loc SyntheticLocation) map[string]interface{} {
+	res := fhirResource("Location", loc.ID)
+	res["status"] = "active"
+	res["mode"] = "instance"
+	res["name"] = loc.Name
+	res["managingOrganization"] = fhirReference("Organization", loc.OrganizationID)
+	return res
+}
+
+// fhirPractitioner converts a synthetic practitioner to a FHIR Practitioner
+func fhirPractitioner(p SyntheticPractitioner) map[string]interface{} {
+	res := fhirResource("Practitioner", p.ID)
+	res["active"] = true
+	res["identifier"] = []interface{}{map[string]interface{}{
+		"system": "http://hl7.org/fhir/sid/us-npi",
+		"value":  p.NPI,
+	}}
+	res["name"] = []interface{}{map[string]interface{}{
+		"family": p.FamilyName,
+		"given":  []string{p.GivenName},
+		"prefix": []string{"Dr."},
+	}}
+	return res
+}
+
+// fhirPractitionerRole links a synthetic practitioner to their organization,
+// location and specialty
+func fhirPractitionerRole(p SyntheticPractitioner) map[string]interface{} {
+	res := fhirResource("PractitionerRole", p.ID+"-ROLE")
+	res["active"] = true
+	res["practitioner"] = fhirReference("Practitioner", p.ID)
+	res["organization"] = fhirReference("Organization", p.OrganizationID)
+	res["location"] = []interface{}{fhirReference("Location", p.LocationID)}
+	res["specialty"] = []interface{}{map[string]interface{}{"text": p.Specialty}}
+	return res
+}
+
+// fhirPatient converts a synthetic patient to a FHIR Patient
+func fhirPatient(p SyntheticPatient) map[string]interface{} {
+	res := fhirResource("Patient", p.ID)
+	res["active"] = true
+	res["name"] = []interface{}{map[string]interface{}{
+		"family": p.FamilyName,
+		"given":  []string{p.GivenName},
+	}}
+	res["gender"] = p.Sex
+	res["birthDate"] = p.BirthDate
+	res["address"] = []interface{}{map[string]interface{}{
+		"use":        "home",
+		"line":       []string{p.Address.Line1},
+		"city":       p.Address.City,
+		"state":      p.Address.State,
+		"postalCode": p.Address.PostalCode,
+		"country":    "US",
+	}}
+	res["communication"] = []interface{}{map[string]interface{}{
+		"language": fhirCoding("urn:ietf:bcp:47", p.Locale, p.Locale),
+	}}
+	if p.PractitionerID != "" {
+		res["generalPractitioner"] = []interface{}{fhirReference("Practitioner", p.PractitionerID)}
+		res["managingOrganization"] = fhirReference("Organization", batchDirectory.organization.ID)
+	}
+	return res
+}
+
+// subscriberRelationships displays the subscriber-relationship codes coverage uses
+var subscriberRelationships = map[string]string{
+	RelationshipSelf:   "Self",
+	RelationshipSpouse: "Spouse",
+	RelationshipChild:  "Child",
+}
+
+// fhirCoverage converts a synthetic patient's insurance to a FHIR Coverage, with a
+// dependent's subscriber referenced
+func fhirCoverage(p SyntheticPatient) map[string]interface{} {
+	res := fhirResource("Coverage", p.ID+"-COV")
+	res["status"] = "active"
+	res["subscriberId"] = p.Coverage.MemberID
+	res["beneficiary"] = fhirReference("Patient", p.ID)
+	if p.Coverage.Subscriber != nil {
+		res["subscriber"] = fhirReference("Patient", p.Coverage.Subscriber.PatientID)
+	}
+	res["relationship"] = fhirCoding("http://terminology.hl7.org/CodeSystem/subscriber-relationship",
+		p.Coverage.Relationship, subscriberRelationships[p.Coverage.Relationship])
+	res["payor"] = []interface{}{map[string]interface{}{
+		"identifier": map[string]interface{}{"value": p.Coverage.Payer.ID},
+		"display":    p.Coverage.Payer.Name,
+	}}
+	if p.Coverage.GroupNumber != "" {
+		res["class"] = []interface{}{map[string]interface{}{
+			"type":  fhirCoding("http://terminology.hl7.org/CodeSystem/coverage-class", "group", "Group"),
+			"value": p.Coverage.GroupNumber,
+		}}
+	}
+	return res
+}
+
+// fhirCodeable converts a generated code to a FHIR CodeableConcept
+func fhirCodeable(c CodedConcept) map[string]interface{} {
+	return fhirCoding(codeSystemURIs[c.System], c.Code, c.Display)
+}
+
+// fhirClinicalResource starts a resource about a patient, numbered within the
+// patient's record and tied to their encounter when they have one
+func fhirClinicalResource(resourceType, patientID, encounterID string, n int) map[string]interface{} {
+	res := fhirResource(resourceType, fmt.Sprintf("%s-%s-%d", patientID, strings.ToUpper(resourceType[:3]), n))
+	res["subject"] = fhirReference("Patient", patientID)
+	if encounterID != "" {
+		res["encounter"] = fhirReference("Encounter", encounterID)
+	}
+	return res
+}
+
+// fhirPatientRecord converts a synthetic patient's coded diagnoses, procedures, labs
+// and medications to Condition, Procedure, Observation and MedicationRequest resources
+func fhirPatientRecord(p SyntheticPatient, encounterID string) []map[string]interface{} {
+	var out []map[string]interface{}
+	for i, dx := range p.Diagnoses {
+		res := fhirClinicalResource("Condition", p.ID, encounterID, i+1)
+		res["clinicalStatus"] = fhirCoding("http://terminology.hl7.org/CodeSystem/condition-clinical", "active", "Active")
+		res["category"] = []interface{}{fhirCoding("http://terminology.hl7.org/CodeSystem/condition-category", "encounter-diagnosis", "Encounter Diagnosis")}
+		res["code"] = fhirCodeable(dx)
+		out = append(out, res)
+	}
+	for i, proc := range p.Procedures {
+		res := fhirClinicalResource("Procedure", p.ID, encounterID, i+1)
+		res["status"] = "completed"
+		res["code"] = fhirCodeable(proc)
+		out = append(out, res)
+	}
+	for i, lab := range p.Labs {
+		res := fhirClinicalResource("Observation", p.ID, encounterID, i+1)
+		res["status"] = "final"
+		res["category"] = []interface{}{fhirCoding("http://terminology.hl7.org/CodeSystem/observation-category", "laboratory", "Laboratory")}
+		res["code"] = fhirCodeable(lab.Test)
+		res["valueQuantity"] = map[string]interface{}{
+			"value":  lab.Value,
+			"unit":   lab.Unit,
+			"system": "http://unitsofmeasure.org",
+			"code":   lab.Unit,
+		}
+		out = append(out, res)
+	}
+	for i, med := range p.Medications {
+		res := fhirClinicalResource("MedicationRequest", p.ID, encounterID, i+1)
+		res["status"] = "active"
+		res["intent"] = "order"
+		res["medicationCodeableConcept"] = fhirCodeable(med)
+		out = append(out, res)
+	}
+	return out
+}
+
+// fhirEncounter converts a synthetic encounter to a FHIR Encounter
+func fhirEncounter(enc SyntheticEncounter) map[string]interface{} {
+	display := "inpatient encounter"
+	if enc.Class == EncounterClassEmergency {
+		display = "emergency"
+	}
+
+	period := map[string]interface{}{"start": enc.Start.UTC().Format(time.RFC3339)}
+	if enc.End != nil {
+		period["end"] = enc.End.UTC().Format(time.RFC3339)
+	}
+
+	res := fhirResource("Encounter", enc.ID)
+	res["status"] = enc.Status
+	res["class"] = map[string]interface{}{
+		"system":  "http://terminology.hl7.org/CodeSystem/v3-ActCode",
+		"code":    enc.Class,
+		"display": display,
+	}
+	res["subject"] = fhirReference("Patient", enc.PatientID)
+	res["participant"] = []interface{}{map[string]interface{}{
+		"type":       []interface{}{fhirCoding("http://terminology.hl7.org/CodeSystem/v3-ParticipationType", "ATND", "attender")},
+		"individual": fhirReference("Practitioner", enc.PractitionerID),
+	}}
+	res["period"] = period
+	res["location"] = []interface{}{map[string]interface{}{"location": fhirReference("Location", enc.LocationID)}}
+	res["serviceProvider"] = fhirReference("Organization", enc.OrganizationID)
+	return res
+}
+
+// FHIRBundle converts a dataset to a FHIR collection bundle. When types is non-empty
+// only resources of those types are included.
+func (ds SyntheticDataset) FHIRBundle(types map[string]bool, now time.Time) FHIRBundle {
+	bundle := FHIRBundle{
+		ResourceType: "Bundle",
+		Type:         "collection",
+		Timestamp:    now.UTC().Format(time.RFC3339),
+		Entry:        make([]FHIRBundleEntry, 0),
+	}
+	add := func(res map[string]interface{}) {
+		if len(types) == 0 || types[res["resourceType"].(string)] {
+			bundle.Entry = append(bundle.Entry, FHIRBundleEntry{Resource: res})
+		}
+	}
+
+	add(fhirOrganization(ds.Organization))
+	for _, loc := range ds.Locations {
+		add(fhirLocation(loc))
+	}
+	for _, p := range ds.Practitioners {
+		add(fhirPractitioner(p))
+		add(fhirPractitionerRole(p))
+	}
+	encounterFor := make(map[string]string, len(ds.Encounters))
+	for _, enc := range ds.Encounters {
+		encounterFor[enc.PatientID] = enc.ID
+	}
+	for _, p := range ds.Patients {
+		add(fhirPatient(p))
+		add(fhirCoverage(p))
+	}
+	for _, enc := range ds.Encounters {
+		add(fhirEncounter(enc))
+	}
+	for _, p := range ds.Patients {
+		for _, res := range fhirPatientRecord(p, encounterFor[p.ID]) {
+			add(res)
+		}
+	}
+	bundle.Total = len(bundle.Entry)
+	return bundle
+}
+
+// GetSyntheticFHIRHandler returns the synthetic directory, patients and encounters
+// as a FHIR R4 collection bundle. Supports ?_type=Practitioner,Encounter to limit
+// the resource types.
+func GetSyntheticFHIRHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	types := make(map[string]bool)
+	if value := r.URL.Query().Get("_type"); value != "" {
+		for _, t := range strings.Split(value, ",") {
+			t = strings.TrimSpace(t)
+			if !fhirResourceTypes[t] {
+				http.Error(w, fmt.Sprintf("unsupported resource type %q", t), http.StatusBadRequest)
+				RecordDeviceOperation("get_synthetic_fhir", "error", time.Since(start).Seconds())
+				return
+			}
+			types[t] = true
+		}
+	}
+
+	bundle := simulator.Dataset().FHIRBundle(types, time.Now())
+	RecordDeviceOperation("get_synthetic_fhir", "success", time.Since(start).Seconds())
+
+	w.Header().Set("Content-Type", "application/fhir+json")
+	json.NewEncoder(w).Encode(bundle)
+}
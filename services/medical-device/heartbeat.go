@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/healthcare-gitops/common/config"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// defaultHeartbeatIntervals defines how often each device type is expected to check in.
+// Life-support devices get the tightest intervals.
+var defaultHeartbeatIntervals = map[DeviceType]time.Duration{
+	DeviceTypeVentilator: 30 * time.Second,
+	DeviceTypePump:       60 * time.Second,
+	DeviceTypeECG:        60 * time.Second,
+	DeviceTypeMRI:        5 * time.Minute,
+	DeviceTypeCTScanner:  5 * time.Minute,
+	DeviceTypeXRay:       5 * time.Minute,
+}
+
+// fallbackHeartbeatInterval applies to device types without an explicit default
+const fallbackHeartbeatInterval = 2 * time.Minute
+
+// SilentDevice describes a device that has missed its heartbeat deadline
+type SilentDevice struct {
+	DeviceID         string       `json:"device_id"`
+	Type             DeviceType   `json:"type"`
+	Location         string       `json:"location"`
+	Status           DeviceStatus `json:"status"`
+	LastHeartbeat    time.Time    `json:"last_heartbeat"`
+	ExpectedInterval float64      `json:"expected_interval_seconds"`
+	SilentFor        float64      `json:"silent_for_seconds"`
+	MissedHeartbeats int          `json:"missed_heartbeats"`
+}
+
+// missedHeartbeatThreshold returns how many intervals may elapse before a device is declared offline
+func missedHeartbeatThreshold() int {
+	threshold := config.GetEnvInt("HEARTBEAT_MISSED_THRESHOLD", 3)
+	if threshold < 1 {
+		return 1
+	}
+	return threshold
+}
+
+// heartbeatInterval returns the expected heartbeat interval for a device.
+// Callers must hold device.mu.
+func heartbeatInterval(device *MedicalDevice) time.Duration {
+	if device.HeartbeatIntervalSeconds > 0 {
+		return time.Duration(device.HeartbeatIntervalSeconds) * time.Second
+	}
+	if interval, ok := defaultHeartbeatIntervals[device.Type]; ok {
+		return interval
+	}
+	return fallbackHeartbeatInterval
+}
+
+// RecordHeartbeat marks a device as alive. Devices previously taken offline by the
+// heartbeat monitor are restored to operational.
+func (dr *DeviceRegistry) RecordHeartbeat(deviceID string, at time.Time) error {
+	device, err := dr.GetDevice(deviceID)
+	if err != nil {
+		return err
+	}
+
+	device.mu.Lock()
+	defer device.mu.Unlock()
+
+	device.LastHeartbeat = at
+
+	dr.mu.Lock()
+	_, wasSilent := dr.silent[deviceID]
+	delete(dr.silent, deviceID)
+	if wasSilent {
+		dr.resolveAlertLocked(deviceID, ConditionHeartbeatLost, at)
+	}
+	dr.mu.Unlock()
+
+	if wasSilent {
+		device.Status = StatusOperational
+		dr.syncStatusAlertsLocked(device, at)
+		log.Info().Str("device_id", deviceID).Msg("Heartbeat restored, device back online")
+	}
+
+	return nil
+}
+
+// CheckHeartbeats transitions devices that have missed too many heartbeats to offline
+// and raises a heartbeat-lost alert. It returns the IDs of newly silent devices.
+func (dr *DeviceRegistry) CheckHeartbeats(now time.Time) []string {
+	threshold := missedHeartbeatThreshold()
+	newlySilent := make([]string, 0)
+
+	for _, device := range dr.ListDevices() {
+		device.mu.Lock()
+		deadline := device.LastHeartbeat.Add(heartbeatInterval(device) * time.Duration(threshold))
+		if now.Before(deadline) || device.Status == StatusMaintenance {
+			device.mu.Unlock()
+			continue
+		}
+
+		dr.mu.Lock()
+		_, alreadySilent := dr.silent[device.ID]
+		if !alreadySilent {
+			dr.silent[device.ID] = now
+		}
+		dr.mu.Unlock()
+
+		if !alreadySilent {
+			device.Status = StatusOffline
+			dr.raiseAlertLocked(device, ConditionHeartbeatLost,
+				fmt.Sprintf("No heartbeat since %s", device.LastHeartbeat.Format(time.RFC3339)), now)
+			dr.refreshAlertLevelLocked(device)
+			dr.noteStatusLocked(device)
+			newlySilent = append(newlySilent, device.ID)
+
+			log.Error().
+				Str("device_id", device.ID).
+				Str("type", string(device.Type)).
+				Str("location", device.Location).
+				Time("last_heartbeat", device.LastHeartbeat).
+				Msg("Device heartbeat lost, marking offline")
+		}
+		device.mu.Unlock()
+	}
+
+	return newlySilent
+}
+
+// SilentDevices reports every device currently past its heartbeat deadline
+func (dr *DeviceRegistry) SilentDevices(now time.Time) []SilentDevice {
+	threshold := missedHeartbeatThreshold()
+	silent := make([]SilentDevice, 0)
+
+	for _, device := range dr.ListDevices() {
+		device.mu.RLock()
+		interval := heartbeatInterval(device)
+		silentFor := now.Sub(device.LastHeartbeat)
+		if silentFor >= interval*time.Duration(threshold) {
+			silent = append(silent, SilentDevice{
+				DeviceID:         device.ID,
+				Type:             device.Type,
+				Location:         device.Location,
+				Status:           device.Status,
+				LastHeartbeat:    device.LastHeartbeat,
+				ExpectedInterval: interval.Seconds(),
+				SilentFor:        silentFor.Seconds(),
+				MissedHeartbeats: int(silentFor / interval),
+			})
+		}
+		device.mu.RUnlock()
+	}
+
+	// Longest-silent devices first
+	sort.Slice(silent, func(i, j int) bool {
+		return silent[i].SilentFor > silent[j].SilentFor
+	})
+
+	return silent
+}
+
+// startHeartbeatMonitor periodically checks for devices that stopped reporting
+func startHeartbeatMonitor(checkInterval time.Duration) {
+	if checkInterval <= 0 {
+		checkInterval = 15 * time.Second
+	}
+	log.Info().Dur("check_interval", checkInterval).Msg("Starting heartbeat monitor")
+
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		if silent := registry.CheckHeartbeats(now); len(silent) > 0 {
+			log.Warn().Strs("device_ids", silent).Msg("Devices went silent")
+		}
+	}
+}
+
+// HeartbeatHandler records a heartbeat from a device
+func HeartbeatHandler(w http.ResponseWriter, r *http.Request) {
+	deviceID := chi.URLParam(r, "deviceID")
+	ctx := r.Context()
+	span := trace.SpanFromContext(ctx)
+	start := time.Now()
+
+	now := time.Now()
+	if err := registry.RecordHeartbeat(deviceID, now); err != nil {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		RecordDeviceOperation("heartbeat", "error", time.Since(start).Seconds())
+		span.RecordError(err)
+		return
+	}
+
+	captureEvent(CaptureKindHeartbeat, deviceID, nil, "")
+
+	duration := time.Since(start).Seconds()
+	RecordDeviceOperation("heartbeat", "success", duration)
+	span.SetAttributes(attribute.String("device.id", deviceID))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"device_id":      deviceID,
+		"last_heartbeat": now,
+		"status":         "heartbeat_recorded",
+	})
+}
+
+// ListSilentDevicesHandler reports devices that have stopped sending heartbeats
+func ListSilentDevicesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	start := time.Now()
+
+	silent := registry.SilentDevices(time.Now())
+
+	duration := time.Since(start).Seconds()
+	RecordDeviceOperation("list_silent", "success", duration)
+
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.Int("device.silent_count", len(silent)))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"silent_devices":   silent,
+		"count":            len(silent),
+		"missed_threshold": missedHeartbeatThreshold(),
+		"generated_at":     time.Now(),
+	})
+}
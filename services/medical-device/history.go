@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// Bounds on a generated history
+const (
+	defaultHistoryDays       = 365
+	maxHistoryDays           = 3650
+	defaultVisitIntervalDays = 30
+	// maxHistoryVisits caps duration_days / visit_interval_days
+	maxHistoryVisits = 500
+)
+
+// Vitals are charted every few hours on the ward and every few minutes in clinic
+const (
+	inpatientVitalsInterval  = 4 * time.Hour
+	ambulatoryVitalsInterval = 10 * time.Minute
+)
+
+// medicationStopRate is the chance an active medication is stopped at a follow-up
+const medicationStopRate = 0.1
+
+// Lab interpretations against the reference range, as in FHIR's
+// ObservationInterpretation codes
+const (
+	InterpretationLow    = "L"
+	InterpretationNormal = "N"
+	InterpretationHigh   = "H"
+)
+
+// PatientHistory is a synthetic patient's longitudinal record: an index admission for
+// their condition followed by outpatient follow-ups until the end of the history,
+// and the claims for them
+type PatientHistory struct {
+	Patient     SyntheticPatient   `json:"patient"`
+	Start       time.Time          `json:"start"`
+	End         time.Time          `json:"end"`
+	Encounters  []HistoryEncounter `json:"encounters"`
+	Medications []MedicationCourse `json:"medications,omitempty"`
+	// Claims bill each encounter to the patient's coverage
+	Claims []SyntheticClaim `json:"claims,omitempty"`
+}
+
+// HistoryEncounter is one visit with the labs drawn and the vitals charted during it
+type HistoryEncounter struct {
+	ID    string `json:"id"`
+	Class string `json:"class"`
+	// PractitionerID and LocationID are the patient's attending and care unit in the
+	// batch directory
+	PractitionerID string       `json:"practitioner_id"`
+	LocationID     string       `json:"location_id"`
+	Start          time.Time    `json:"start"`
+	End            time.Time    `json:"end"`
+	Labs           []HistoryLab `json:"labs,omitempty"`
+	Vitals         []VitalSigns `json:"vitals"`
+}
+
+// HistoryLab is a lab result with the range a normal result falls in and how the
+// value compares with it
+type HistoryLab struct {
+	LabResult
+	ReferenceRange VitalRange `json:"reference_range"`
+	Interpretation string     `json:"interpretation"`
+}
+
+// VitalSigns is one charted set of vitals
+type VitalSigns struct {
+	Timestamp       time.Time `json:"timestamp"`
+	HeartRate       float64   `json:"heart_rate_bpm"`
+	RespiratoryRate float64   `json:"respiratory_rate_bpm"`
+	SpO2            float64   `json:"spo2_percent"`
+}
+
+// MedicationCourse is a medication started at an encounter and, once stopped, the
+// time it was stopped
+type MedicationCourse struct {
+	Medication  CodedConcept `json:"medication"`
+	EncounterID string       `json:"encounter_id"`
+	Start       time.Time    `json:"start"`
+	End         *time.Time   `json:"end,omitempty"`
+}
+
+// generateHistory charts the patient's visits between start and end, one about every
+// interval. Everything is drawn from rng, so a seeded source yields the same history.
+func generateHistory(rng *rand.Rand, p *SyntheticPatient, idPrefix string, start, end time.Time, interval time.Duration, codeSystems []string) PatientHistory {
+	labsEnabled, cptEnabled := false, false
+	for _, s := range codeSystems {
+		labsEnabled = labsEnabled || s == CodeSystemLOINC
+		cptEnabled = cptEnabled || s == CodeSystemCPT
+	}
+	org := syntheticOrganization()
+	bands := p.labBands()
+	codes := sortedLabCodes(bands)
+
+	h := PatientHistory{Start: start, End: end, Encounters: make([]HistoryEncounter, 0)}
+	// The index admission falls early in the history, follow-ups at jittered intervals
+	at := start.Add(time.Duration(rng.Int63n(int64(interval/time.Minute)/2+1)) * time.Minute)
+	for n := 1; ; n++ {
+		enc := HistoryEncounter{
+			ID:             fmt.Sprintf("%s-ENC-%03d", idPrefix, n),
+			Class:          EncounterClassInpatient,
+			PractitionerID: p.PractitionerID,
+			LocationID:     p.LocationID,
+			Start:          at,
+		}
+		vitalsEvery := inpatientVitalsInterval
+		if n > 1 {
+			// Follow-ups are booked in office hours, on the first day they fit
+			enc.Class, vitalsEvery = EncounterClassAmbulatory, ambulatoryVitalsInterval
+			enc.Start = at.Truncate(24 * time.Hour).Add(time.Duration(8+rng.Intn(9))*time.Hour + time.Duration(rng.Intn(4))*15*time.Minute)
+			if enc.Start.Before(at) {
+				enc.Start = enc.Start.Add(24 * time.Hour)
+			}
+		}
+		if !enc.Start.Before(end) {
+			break
+		}
+		if n == 1 {
+			enc.End = enc.Start.Add(time.Duration(2+rng.Intn(4)) * 24 * time.Hour)
+		} else {
+			enc.End = enc.Start.Add(time.Duration(20+rng.Intn(21)) * time.Minute)
+		}
+
+		for t := enc.Start; !t.After(enc.End); t = t.Add(vitalsEvery) {
+			enc.Vitals = append(enc.Vitals, VitalSigns{
+				Timestamp:       t,
+				HeartRate:       p.walk(rng, "heart_rate", p.HeartRate, 2),
+				RespiratoryRate: p.walk(rng, "respiratory_rate", p.RespiratoryRate, 1),
+				SpO2:            p.walk(rng, "spo2", p.SpO2, 0.5),
+			})
+		}
+		if labsEnabled {
+			for _, code := range codes {
+				lab := drawLab(rng, code, bands[code])
+				enc.Labs = append(enc.Labs, HistoryLab{
+					LabResult:      lab,
+					ReferenceRange: labCatalog[code].Normal,
+					Interpretation: interpretLab(lab.Value, labCatalog[code].Normal),
+				})
+			}
+		}
+
+		if n == 1 {
+			for _, med := range p.Medications {
+				h.Medications = append(h.Medications, MedicationCourse{Medication: med, EncounterID: enc.ID, Start: enc.Start})
+			}
+		} else {
+			for i := range h.Medications {
+				if h.Medications[i].End == nil && rng.Float64() < medicationStopRate {
+					stopped := enc.End
+					h.Medications[i].End = &stopped
+				}
+			}
+		}
+
+		pos, procedures := placeOfServiceOffice, []CodedConcept{followUpVisit}
+		if n == 1 {
+			pos, procedures = placeOfServiceInpatient, p.Procedures
+		}
+		if !cptEnabled {
+			procedures = nil
+		}
+		if claim, ok := newSyntheticClaim(org, *p, pos, procedures, enc.Start.Truncate(24*time.Hour)); ok {
+			h.Claims = append(h.Claims, claim)
+		}
+
+		h.Encounters = append(h.Encounters, enc)
+		at = enc.End.Add(time.Duration(float64(interval) * (0.5 + rng.Float64())))
+	}
+	h.Patient = *p
+	return h
+}
+
+// interpretLab compares a value with its reference range
+func interpretLab(value float64, normal VitalRange) string {
+	switch {
+	case value < normal.Min:
+		return InterpretationLow
+	case value > normal.Max:
+		return InterpretationHigh
+	}
+	return InterpretationNormal
+}
+
+// PatientHistoryRequest asks for a longitudinal record drawn from a cohort
+type PatientHistoryRequest struct {
+	GenerationOptions
+	DurationDays      int `json:"duration_days"`
+	VisitIntervalDays int `json:"visit_interval_days"`
+	// End is the last day of the history as YYYY-MM-DD; today, in UTC, by default
+	End string `json:"end,omitempty"`
+	// PatientRef charts the history of the patient standing for the caller's ref, as
+	// POST /simulator/patients returns them
+	PatientRef string `json:"patient_ref,omitempty"`
+}
+
+// GeneratePatientHistoryHandler generates one synthetic patient with a longitudinal
+// record of encounters, medications, labs with reference ranges and vitals series.
+// The seed used is echoed in the response; with the same seed and end day the same
+// history is generated again.
+func GeneratePatientHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	fail := func(message string, status int) {
+		http.Error(w, message, status)
+		RecordDeviceOperation("generate_patient_history", "error", time.Since(start).Seconds())
+	}
+
+	var req PatientHistoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		fail("Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.DurationDays == 0 {
+		req.DurationDays = defaultHistoryDays
+	}
+	if req.VisitIntervalDays == 0 {
+		req.VisitIntervalDays = defaultVisitIntervalDays
+	}
+	switch {
+	case req.DurationDays < 1 || req.DurationDays > maxHistoryDays:
+		fail(fmt.Sprintf("duration_days must be between 1 and %d", maxHistoryDays), http.StatusBadRequest)
+		return
+	case req.VisitIntervalDays < 1 || req.VisitIntervalDays > req.DurationDays:
+		fail("visit_interval_days must be between 1 and duration_days", http.StatusBadRequest)
+		return
+	case req.DurationDays/req.VisitIntervalDays > maxHistoryVisits:
+		fail(fmt.Sprintf("a history may have at most %d visits: lengthen visit_interval_days", maxHistoryVisits), http.StatusBadRequest)
+		return
+	}
+	lastDay := time.Now().UTC().Truncate(24 * time.Hour)
+	if req.End != "" {
+		day, err := time.Parse("2006-01-02", req.End)
+		if err != nil {
+			fail("end must be a date as YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		lastDay = day
+	}
+	cohort, rng, err := req.resolve(r)
+	if err != nil {
+		fail(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	prefix := req.idPrefix("HX")
+	var patient *SyntheticPatient
+	if req.PatientRef != "" {
+		if patient, err = refPatient(req.PatientRef, cohort, req.CodeSystems); err != nil {
+			fail(err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		patient = newSyntheticPatient(rng, 1, cohort, req.CodeSystems)
+		patient.ID = prefix
+		assignCare(rng, patient)
+	}
+	end := lastDay.Add(24 * time.Hour)
+	history := generateHistory(rng, patient, prefix, end.AddDate(0, 0, -req.DurationDays), end,
+		time.Duration(req.VisitIntervalDays)*24*time.Hour, req.CodeSystems)
+	RecordDeviceOperation("generate_patient_history", "success", time.Since(start).Seconds())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"cohort":  cohort.Name,
+		"seed":    *req.Seed,
+		"history": history,
+	})
+}
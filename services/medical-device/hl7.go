@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/healthcare-gitops/common/config"
+)
+
+// ADT trigger events the synthetic feed renders: A01 admits the patient with their
+// diagnoses, A08 updates their record with lab results
+const (
+	HL7EventAdmit  = "A01"
+	HL7EventUpdate = "A08"
+)
+
+// hl7Version is MSH-12 of every generated message
+const hl7Version = "2.5.1"
+
+// hl7Time is the HL7 DTM format timestamps are rendered in
+const hl7Time = "20060102150405-0700"
+
+// hl7ProcessingIDs are the MSH-11 values: production, debugging and training
+var hl7ProcessingIDs = map[string]bool{"P": true, "D": true, "T": true}
+
+// hl7CodingSystems name the code systems in coded fields (HL7 table 0396)
+var hl7CodingSystems = map[string]string{
+	CodeSystemICD10:  "I10C",
+	CodeSystemCPT:    "C4",
+	CodeSystemLOINC:  "LN",
+	CodeSystemRxNorm: "RXN",
+}
+
+// HL7Header holds the configurable MSH fields of generated messages
+type HL7Header struct {
+	SendingApplication   string
+	SendingFacility      string
+	ReceivingApplication string
+	ReceivingFacility    string
+	// ProcessingID is MSH-11; T by default, so receivers treat the feed as test data
+	ProcessingID string
+}
+
+// defaultHL7Header reads the MSH fields from the environment. An empty sending
+// facility is the synthetic organization's name.
+func defaultHL7Header() HL7Header {
+	return HL7Header{
+		SendingApplication:   config.GetEnv("HL7_SENDING_APPLICATION", "DEVICE-SIM"),
+		SendingFacility:      config.GetEnv("HL7_SENDING_FACILITY", ""),
+		ReceivingApplication: config.GetEnv("HL7_RECEIVING_APPLICATION", ""),
+		ReceivingFacility:    config.GetEnv("HL7_RECEIVING_FACILITY", ""),
+		ProcessingID:         config.GetEnv("HL7_PROCESSING_ID", "T"),
+	}
+}
+
+// hl7Escape escapes the delimiters in a field value. Line breaks would end the
+// segment, so they become spaces.
+var hl7Escape = strings.NewReplacer(
+	`\`, `\E\`,
+	"|", `\F\`,
+	"^", `\S\`,
+	"~", `\R\`,
+	"&", `\T\`,
+	"\r", " ",
+	"\n", " ",
+)
+
+// hl7Components joins escaped components into one field
+func hl7Components(values ...string) string {
+	for i, v := range values {
+		values[i] = hl7Escape.Replace(v)
+	}
+	return strings.TrimRight(strings.Join(values, "^"), "^")
+}
+
+// hl7Segment renders a segment from its fields, numbered from 1, without trailing
+// empty fields
+func hl7Segment(name string, fields map[int]string) string {
+	last := 0
+	for n := range fields {
+		if n > last {
+			last = n
+		}
+	}
+	parts := make([]string, last+1)
+	parts[0] = name
+	for n, value := range fields {
+		parts[n] = value
+	}
+	return strings.Join(parts, "|")
+}
+
+// hl7Coded renders a generated code as a CWE field
+func hl7Coded(c CodedConcept) string {
+	return hl7Components(c.Code, c.Display, hl7CodingSystems[c.System])
+}
+
+// hl7Sexes maps administrative sexes to HL7 table 0001
+var hl7Sexes = map[string]string{SexFemale: "F", SexMale: "M", SexOther: "O", SexUnknown: "U"}
+
+// HL7Messages renders an ADT message of the event for each admitted patient, or only
+// for patientID when it is set. Segments end with a carriage return, so the messages
+// can be concatenated into a feed.
+func (ds SyntheticDataset) HL7Messages(event string, header HL7Header, patientID string, now time.Time) []string {
+	if header.SendingFacility == "" {
+		header.SendingFacility = ds.Organization.Name
+	}
+	patients := make(map[string]SyntheticPatient, len(ds.Patients))
+	for _, p := range ds.Patients {
+		patients[p.ID] = p
+	}
+	locations := make(map[string]SyntheticLocation, len(ds.Locations))
+	for _, loc := range ds.Locations {
+		locations[loc.ID] = loc
+	}
+	practitioners := make(map[string]SyntheticPractitioner, len(ds.Practitioners))
+	for _, p := range ds.Practitioners {
+		practitioners[p.ID] = p
+	}
+
+	messages := make([]string, 0)
+	for _, enc := range ds.Encounters {
+		p, ok := patients[enc.PatientID]
+		if !ok || (patientID != "" && p.ID != patientID) {
+			continue
+		}
+		// An encounter is admitted once; each update is a new message
+		recorded, controlID := now, enc.ID+"-"+event+"-"+now.UTC().Format("20060102150405")
+		if event == HL7EventAdmit {
+			recorded, controlID = enc.Start, enc.ID+"-"+event
+		}
+
+		// MSH-1 is the field separator itself, so MSH fields are numbered one behind
+		segments := []string{
+			hl7Segment("MSH", map[int]string{
+				1:  `^~\&`,
+				2:  hl7Components(header.SendingApplication),
+				3:  hl7Components(header.SendingFacility),
+				4:  hl7Components(header.ReceivingApplication),
+				5:  hl7Components(header.ReceivingFacility),
+				6:  now.UTC().Format(hl7Time),
+				8:  hl7Components("ADT", event, "ADT_A01"),
+				9:  hl7Components(controlID),
+				10: hl7Components(header.ProcessingID),
+				11: hl7Version,
+			}),
+			hl7Segment("EVN", map[int]string{1: event, 2: recorded.UTC().Format(hl7Time)}),
+			hl7PID(p, header.SendingFacility),
+			hl7PV1(enc, locations[enc.LocationID], practitioners[enc.PractitionerID], header.SendingFacility),
+		}
+		if event == HL7EventUpdate {
+			for i, lab := range p.Labs {
+				segments = append(segments, hl7Segment("OBX", map[int]string{
+					1:  strconv.Itoa(i + 1),
+					2:  "NM",
+					3:  hl7Coded(lab.Test),
+					5:  strconv.FormatFloat(lab.Value, 'f', -1, 64),
+					6:  hl7Components(lab.Unit, lab.Unit, "UCUM"),
+					11: "F",
+				}))
+			}
+		}
+		for i, dx := range p.Diagnoses {
+			segments = append(segments, hl7Segment("DG1", map[int]string{
+				1: strconv.Itoa(i + 1),
+				3: hl7Coded(dx),
+				6: "A", // admitting diagnosis
+			}))
+		}
+		messages = append(messages, strings.Join(segments, "\r")+"\r")
+	}
+	return messages
+}
+
+// hl7PID renders a patient identification segment
+func hl7PID(p SyntheticPatient, facility string) string {
+	sex, ok := hl7Sexes[p.Sex]
+	if !ok {
+		sex = "U"
+	}
+	return hl7Segment("PID", map[int]string{
+		1:  "1",
+		3:  hl7Components(p.ID, "", "", facility, "MR"),
+		5:  hl7Components(p.FamilyName, p.GivenName),
+		7:  strings.ReplaceAll(p.BirthDate, "-", ""),
+		8:  sex,
+		11: hl7Components(p.Address.Line1, "", p.Address.City, p.Address.State, p.Address.PostalCode, "USA", "H"),
+	})
+}
+
+// hl7PV1 renders a patient visit segment for an encounter
+func hl7PV1(enc SyntheticEncounter, loc SyntheticLocation, attending SyntheticPractitioner, facility string) string {
+	class := "I"
+	if enc.Class == EncounterClassEmergency {
+		class = "E"
+	}
+	fields := map[int]string{
+		1:  "1",
+		2:  class,
+		3:  hl7Components(loc.Name, "", "", facility),
+		7:  hl7Components(attending.NPI, attending.FamilyName, attending.GivenName, "", "", "Dr."),
+		19: hl7Components(enc.ID),
+		44: enc.Start.UTC().Format(hl7Time),
+	}
+	if enc.End != nil {
+		fields[45] = enc.End.UTC().Format(hl7Time)
+	}
+	return hl7Segment("PV1", fields)
+}
+
+// GetSyntheticHL7Handler renders the synthetic patients' admissions as an HL7 v2 ADT
+// feed. Supports ?event=A01 (default) or A08, ?patient_id= for one patient, and
+// ?sending_application=, sending_facility, receiving_application,
+// receiving_facility and processing_id to override the configured MSH fields.
+func GetSyntheticHL7Handler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	query := r.URL.Query()
+	fail := func(message string, status int) {
+		http.Error(w, message, status)
+		RecordDeviceOperation("get_synthetic_hl7", "error", time.Since(start).Seconds())
+	}
+
+	event := query.Get("event")
+	if event == "" {
+		event = HL7EventAdmit
+	}
+	if event != HL7EventAdmit && event != HL7EventUpdate {
+		fail(fmt.Sprintf("unsupported event %q: use A01 or A08", event), http.StatusBadRequest)
+		return
+	}
+
+	header := defaultHL7Header()
+	for name, field := range map[string]*string{
+		"sending_application":   &header.SendingApplication,
+		"sending_facility":      &header.SendingFacility,
+		"receiving_application": &header.ReceivingApplication,
+		"receiving_facility":    &header.ReceivingFacility,
+		"processing_id":         &header.ProcessingID,
+	} {
+		if value := query.Get(name); value != "" {
+			*field = value
+		}
+	}
+	if !hl7ProcessingIDs[header.ProcessingID] {
+		fail(fmt.Sprintf("unsupported processing_id %q: use P, D or T", header.ProcessingID), http.StatusBadRequest)
+		return
+	}
+
+	patientID := query.Get("patient_id")
+	messages := simulator.Dataset().HL7Messages(event, header, patientID, time.Now())
+	if patientID != "" && len(messages) == 0 {
+		fail("Synthetic patient not found or not admitted", http.StatusNotFound)
+		return
+	}
+	RecordDeviceOperation("get_synthetic_hl7", "success", time.Since(start).Seconds())
+
+	w.Header().Set("Content-Type", "x-application/hl7-v2+er7")
+	w.Write([]byte(strings.Join(messages, "")))
+}
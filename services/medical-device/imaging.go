@@ -0,0 +1,362 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DICOM modalities of generated studies
+const (
+	ModalityCR = "CR"
+	ModalityCT = "CT"
+	ModalityMR = "MR"
+	ModalityUS = "US"
+	ModalityXA = "XA"
+)
+
+// Imaging output formats: DICOM keywords, or instance metadata in the DICOM JSON
+// model that DICOMweb's WADO-RS returns
+const (
+	ImagingFormatJSON      = "json"
+	ImagingFormatDICOMJSON = "dicom-json"
+)
+
+// sopClasses is the storage SOP class of each modality's images
+var sopClasses = map[string]string{
+	ModalityCR: "1.2.840.10008.5.1.4.1.1.1",
+	ModalityCT: "1.2.840.10008.5.1.4.1.1.2",
+	ModalityMR: "1.2.840.10008.5.1.4.1.1.4",
+	ModalityUS: "1.2.840.10008.5.1.4.1.1.6.1",
+	ModalityXA: "1.2.840.10008.5.1.4.1.1.12.1",
+}
+
+// dicomSexes maps administrative sexes to PatientSex; unknown is left empty
+var dicomSexes = map[string]string{SexFemale: "F", SexMale: "M", SexOther: "O"}
+
+// seriesProtocol is one series an imaging protocol acquires
+type seriesProtocol struct {
+	Description  string
+	MinInstances int
+	MaxInstances int
+	Rows         int
+	Columns      int
+}
+
+// imagingProtocol is a study the synthetic radiology department performs
+type imagingProtocol struct {
+	Modality    string
+	Description string
+	BodyPart    string
+	Procedure   CodedConcept
+	Series      []seriesProtocol
+}
+
+var imagingProtocols = map[string]imagingProtocol{
+	"chest_xray": {
+		Modality: ModalityCR, Description: "XR CHEST 2 VIEWS", BodyPart: "CHEST",
+		Procedure: cpt("71046", "Radiologic examination, chest; 2 views"),
+		Series:    []seriesProtocol{{"PA", 1, 1, 2500, 2048}, {"LATERAL", 1, 1, 2500, 2048}},
+	},
+	"ct_chest": {
+		Modality: ModalityCT, Description: "CT CHEST WO CONTRAST", BodyPart: "CHEST",
+		Procedure: cpt("71250", "Computed tomography, thorax, diagnostic; without contrast material"),
+		Series:    []seriesProtocol{{"SCOUT", 1, 2, 512, 512}, {"AXIAL 5MM", 40, 60, 512, 512}},
+	},
+	"ct_abdomen": {
+		Modality: ModalityCT, Description: "CT ABD PELVIS W CONTRAST", BodyPart: "ABDOMEN",
+		Procedure: cpt("74177", "Computed tomography, abdomen and pelvis; with contrast material"),
+		Series:    []seriesProtocol{{"SCOUT", 1, 2, 512, 512}, {"AXIAL PORTAL VENOUS", 50, 80, 512, 512}},
+	},
+	"echo": {
+		Modality: ModalityUS, Description: "TTE COMPLETE", BodyPart: "HEART",
+		Procedure: cpt("93306", "Echocardiography, transthoracic, complete, with Doppler"),
+		Series:    []seriesProtocol{{"2D CINE", 20, 40, 600, 800}},
+	},
+	"brain_mri": {
+		Modality: ModalityMR, Description: "MRI BRAIN WO CONTRAST", BodyPart: "BRAIN",
+		Procedure: cpt("70551", "Magnetic resonance imaging, brain; without contrast material"),
+		Series: []seriesProtocol{
+			{"AX T1", 20, 24, 256, 256}, {"AX T2", 20, 24, 256, 256}, {"AX FLAIR", 20, 24, 256, 256},
+		},
+	},
+	"pacemaker_fluoro": {
+		Modality: ModalityXA, Description: "FLUORO PACEMAKER INSERTION", BodyPart: "CHEST",
+		Procedure: cpt("33208", "Insertion of permanent pacemaker, atrial and ventricular"),
+		Series:    []seriesProtocol{{"FLUORO", 3, 8, 1024, 1024}},
+	},
+}
+
+// imagingOrder is a protocol ordered for a condition and how often it is
+type imagingOrder struct {
+	Protocol string
+	Rate     float64
+}
+
+// conditionImaging is the imaging ordered for each condition
+var conditionImaging = map[string][]imagingOrder{
+	ConditionHealthy:            {{"chest_xray", 0.15}, {"brain_mri", 0.05}},
+	ConditionCOPD:               {{"chest_xray", 0.9}, {"ct_chest", 0.4}},
+	ConditionSepsis:             {{"chest_xray", 0.9}, {"ct_abdomen", 0.5}},
+	ConditionAtrialFibrillation: {{"echo", 0.8}, {"brain_mri", 0.15}},
+	ConditionTachycardia:        {{"echo", 0.6}, {"chest_xray", 0.3}},
+	ConditionBradycardia:        {{"echo", 0.6}, {"pacemaker_fluoro", 0.3}},
+}
+
+// ImagingStudy is a synthetic DICOM study's metadata. Names follow the DICOM
+// attribute keywords; dates are YYYYMMDD and times HHMMSS, as DICOM writes them.
+type ImagingStudy struct {
+	StudyInstanceUID       string          `json:"StudyInstanceUID"`
+	AccessionNumber        string          `json:"AccessionNumber"`
+	StudyID                string          `json:"StudyID"`
+	StudyDate              string          `json:"StudyDate"`
+	StudyTime              string          `json:"StudyTime"`
+	StudyDescription       string          `json:"StudyDescription"`
+	ModalitiesInStudy      []string        `json:"ModalitiesInStudy"`
+	ProcedureCode          *CodedConcept   `json:"ProcedureCode,omitempty"`
+	ReferringPhysicianName string          `json:"ReferringPhysicianName"`
+	InstitutionName        string          `json:"InstitutionName"`
+	PatientID              string          `json:"PatientID"`
+	PatientName            string          `json:"PatientName"`
+	PatientBirthDate       string          `json:"PatientBirthDate"`
+	PatientSex             string          `json:"PatientSex"`
+	Series                 []ImagingSeries `json:"Series"`
+}
+
+// ImagingSeries is one series of a study
+type ImagingSeries struct {
+	SeriesInstanceUID string            `json:"SeriesInstanceUID"`
+	SeriesNumber      int               `json:"SeriesNumber"`
+	Modality          string            `json:"Modality"`
+	SeriesDescription string            `json:"SeriesDescription"`
+	BodyPartExamined  string            `json:"BodyPartExamined"`
+	Instances         []ImagingInstance `json:"Instances"`
+}
+
+// ImagingInstance is one image of a series. There is no pixel data.
+type ImagingInstance struct {
+	SOPClassUID    string `json:"SOPClassUID"`
+	SOPInstanceUID string `json:"SOPInstanceUID"`
+	InstanceNumber int    `json:"InstanceNumber"`
+	Rows           int    `json:"Rows"`
+	Columns        int    `json:"Columns"`
+}
+
+// drawUID generates a UID under the 2.25 root, which DICOM reserves for UIDs made from
+// 128-bit UUIDs, so no organization's registered root is used
+func drawUID(rng *rand.Rand) string {
+	b := make([]byte, 16)
+	rng.Read(b)
+	return "2.25." + new(big.Int).SetBytes(b).String()
+}
+
+// dicomPersonName writes a name as a DICOM PN: family^given
+func dicomPersonName(family, given string) string {
+	return family + "^" + given
+}
+
+// batchPractitioner finds a practitioner of the batch directory
+func batchPractitioner(id string) (SyntheticPractitioner, bool) {
+	for _, p := range batchDirectory.practitioners {
+		if p.ID == id {
+			return *p, true
+		}
+	}
+	return SyntheticPractitioner{}, false
+}
+
+// generateImaging draws the studies ordered for a patient's conditions, performed in
+// the year before now and referred by their attending. accessions counts the batch's
+// studies, so accession numbers are unique within it.
+func generateImaging(rng *rand.Rand, p SyntheticPatient, codeSystems []string, now time.Time, accessions *int) []ImagingStudy {
+	cptEnabled := false
+	for _, s := range codeSystems {
+		cptEnabled = cptEnabled || s == CodeSystemCPT
+	}
+	referrer := ""
+	if pr, ok := batchPractitioner(p.PractitionerID); ok {
+		referrer = dicomPersonName(pr.FamilyName, pr.GivenName)
+	}
+
+	studies := make([]ImagingStudy, 0)
+	for _, condition := range p.Conditions {
+		for _, order := range conditionImaging[condition] {
+			if rng.Float64() >= order.Rate {
+				continue
+			}
+			protocol := imagingProtocols[order.Protocol]
+			*accessions++
+			at := now.AddDate(0, 0, -rng.Intn(365)).Truncate(24 * time.Hour).
+				Add(time.Duration(7*60+rng.Intn(12*60)) * time.Minute)
+			study := ImagingStudy{
+				StudyInstanceUID:       drawUID(rng),
+				AccessionNumber:        fmt.Sprintf("SYN%06d%05d", rng.Intn(1e6), *accessions),
+				StudyID:                strconv.Itoa(*accessions),
+				StudyDate:              at.Format("20060102"),
+				StudyTime:              at.Format("150405"),
+				StudyDescription:       protocol.Description,
+				ModalitiesInStudy:      []string{protocol.Modality},
+				ReferringPhysicianName: referrer,
+				InstitutionName:        batchDirectory.organization.Name,
+				PatientID:              p.ID,
+				PatientName:            dicomPersonName(p.FamilyName, p.GivenName),
+				PatientBirthDate:       strings.ReplaceAll(p.BirthDate, "-", ""),
+				PatientSex:             dicomSexes[p.Sex],
+			}
+			if cptEnabled {
+				procedure := protocol.Procedure
+				study.ProcedureCode = &procedure
+			}
+			for n, sp := range protocol.Series {
+				series := ImagingSeries{
+					SeriesInstanceUID: drawUID(rng),
+					SeriesNumber:      n + 1,
+					Modality:          protocol.Modality,
+					SeriesDescription: sp.Description,
+					BodyPartExamined:  protocol.BodyPart,
+				}
+				count := sp.MinInstances + rng.Intn(sp.MaxInstances-sp.MinInstances+1)
+				for i := 1; i <= count; i++ {
+					series.Instances = append(series.Instances, ImagingInstance{
+						SOPClassUID:    sopClasses[protocol.Modality],
+						SOPInstanceUID: drawUID(rng),
+						InstanceNumber: i,
+						Rows:           sp.Rows,
+						Columns:        sp.Columns,
+					})
+				}
+				study.Series = append(study.Series, series)
+			}
+			studies = append(studies, study)
+		}
+	}
+	return studies
+}
+
+// dicomElement is an attribute in the DICOM JSON model
+type dicomElement struct {
+	VR    string        `json:"vr"`
+	Value []interface{} `json:"Value,omitempty"`
+}
+
+// dicomJSON renders a study's instances in the DICOM JSON model, each with the
+// patient, study and series attributes WADO-RS metadata carries
+func (s ImagingStudy) dicomJSON() []map[string]dicomElement {
+	str := func(vr, v string) dicomElement {
+		if v == "" {
+			return dicomElement{VR: vr}
+		}
+		return dicomElement{VR: vr, Value: []interface{}{v}}
+	}
+	num := func(vr string, v int) dicomElement {
+		return dicomElement{VR: vr, Value: []interface{}{v}}
+	}
+	pn := func(v string) dicomElement {
+		if v == "" {
+			return dicomElement{VR: "PN"}
+		}
+		return dicomElement{VR: "PN", Value: []interface{}{map[string]string{"Alphabetic": v}}}
+	}
+
+	out := make([]map[string]dicomElement, 0)
+	for _, series := range s.Series {
+		for _, inst := range series.Instances {
+			out = append(out, map[string]dicomElement{
+				"00080016": str("UI", inst.SOPClassUID),
+				"00080018": str("UI", inst.SOPInstanceUID),
+				"00080020": str("DA", s.StudyDate),
+				"00080030": str("TM", s.StudyTime),
+				"00080050": str("SH", s.AccessionNumber),
+				"00080060": str("CS", series.Modality),
+				"00080080": str("LO", s.InstitutionName),
+				"00080090": pn(s.ReferringPhysicianName),
+				"00081030": str("LO", s.StudyDescription),
+				"0008103E": str("LO", series.SeriesDescription),
+				"00100010": pn(s.PatientName),
+				"00100020": str("LO", s.PatientID),
+				"00100030": str("DA", s.PatientBirthDate),
+				"00100040": str("CS", s.PatientSex),
+				"00180015": str("CS", series.BodyPartExamined),
+				"0020000D": str("UI", s.StudyInstanceUID),
+				"0020000E": str("UI", series.SeriesInstanceUID),
+				"00200010": str("SH", s.StudyID),
+				"00200011": num("IS", series.SeriesNumber),
+				"00200013": num("IS", inst.InstanceNumber),
+				"00280010": num("US", inst.Rows),
+				"00280011": num("US", inst.Columns),
+			})
+		}
+	}
+	return out
+}
+
+// GenerateImagingRequest asks for patients and the imaging studies ordered for them,
+// drawn as POST /simulator/patients draws patients
+type GenerateImagingRequest struct {
+	GeneratePatientsRequest
+	// Format is json, with DICOM keywords, or dicom-json for instance metadata in
+	// the DICOM JSON model
+	Format string `json:"format,omitempty"`
+}
+
+// GenerateImagingHandler generates patients and synthetic DICOM study, series and
+// instance metadata for the imaging their conditions call for: UIDs under the 2.25
+// root, accession numbers and modality. The patients are those POST
+// /simulator/patients generates with the same seed or refs; the studies are drawn
+// after them from the seed.
+func GenerateImagingHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	fail := func(message string, status int) {
+		http.Error(w, message, status)
+		RecordDeviceOperation("generate_imaging", "error", time.Since(start).Seconds())
+	}
+
+	var req GenerateImagingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		fail("Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Format == "" {
+		req.Format = ImagingFormatJSON
+	}
+	if req.Format != ImagingFormatJSON && req.Format != ImagingFormatDICOMJSON {
+		fail(fmt.Sprintf("unsupported format %q: use json or dicom-json", req.Format), http.StatusBadRequest)
+		return
+	}
+	cohort, rng, patients, err := req.generate(r)
+	if err != nil {
+		fail(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC()
+	studies := make([]ImagingStudy, 0)
+	accessions := 0
+	for _, p := range patients {
+		studies = append(studies, generateImaging(rng, p, req.CodeSystems, now, &accessions)...)
+	}
+	RecordDeviceOperation("generate_imaging", "success", time.Since(start).Seconds())
+
+	resp := map[string]interface{}{
+		"cohort":   cohort.Name,
+		"seed":     *req.Seed,
+		"patients": patients,
+		"count":    len(studies),
+	}
+	if req.Format == ImagingFormatDICOMJSON {
+		instances := make([]map[string]dicomElement, 0)
+		for _, s := range studies {
+			instances = append(instances, s.dicomJSON()...)
+		}
+		resp["instances"] = instances
+	} else {
+		resp["studies"] = studies
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strings"
+)
+
+// batchDirectory staffs generated batches. It is built once and never changes, so its
+// organization, location and practitioner IDs are the same in every batch and can
+// be joined across them. It is only read through its maps: location() would add to it.
+var batchDirectory = newSyntheticDirectory()
+
+// conditionUnits is the care unit a patient with each condition is under
+var conditionUnits = map[string]string{
+	ConditionHealthy:            "Ward B",
+	ConditionCOPD:               "Ward B",
+	ConditionTachycardia:        "Cardiology",
+	ConditionBradycardia:        "Cardiology",
+	ConditionAtrialFibrillation: "Cardiology",
+	ConditionSepsis:             "ICU",
+}
+
+// Household bounds: an adult subscriber, a spouse and children born when the
+// subscriber was between adultAge and maxParentAge
+const (
+	maxHouseholdSize = 5
+	adultAge         = 18
+	maxParentAge     = 50
+	// spouseAgeGap is how far a spouse's age may be from the subscriber's
+	spouseAgeGap = 5
+)
+
+// patientRefPattern is the shape of a caller's patient_ref
+var patientRefPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// assignCare puts a patient under the batch directory's care unit for their
+// condition, with one of its practitioners as attending
+func assignCare(rng *rand.Rand, p *SyntheticPatient) {
+	unit, ok := conditionUnits[p.Conditions[0]]
+	if !ok {
+		unit = "Ward B"
+	}
+	staff := batchDirectory.byUnit[unit]
+	p.LocationID = batchDirectory.locations[unit].ID
+	p.PractitionerID = staff[rng.Intn(len(staff))].ID
+}
+
+// linkHousehold makes patients one household: the first is the subscriber, an adult;
+// the second their spouse and the rest their children, with ages adjusted to fit.
+// Members share the subscriber's family name, address and, unless the subscriber is
+// on Medicare, which does not cover dependents, their insurance.
+func linkHousehold(rng *rand.Rand, members []*SyntheticPatient, id string) {
+	sub := members[0]
+	sub.HouseholdID = id
+	cohortMu.RLock()
+	locale := syntheticLocales[sub.Locale]
+	cohortMu.RUnlock()
+
+	for i, m := range members[1:] {
+		relationship := RelationshipChild
+		if i == 0 {
+			relationship = RelationshipSpouse
+			age := sub.Age - spouseAgeGap + rng.Intn(2*spouseAgeGap+1)
+			if age < adultAge {
+				age = adultAge
+			}
+			m.setAge(rng, age)
+		} else {
+			youngest, oldest := sub.Age-maxParentAge, sub.Age-adultAge
+			if youngest < 0 {
+				youngest = 0
+			}
+			if oldest > adultAge-1 {
+				oldest = adultAge - 1
+			}
+			m.setAge(rng, youngest+rng.Intn(oldest-youngest+1))
+		}
+		if m.Locale != sub.Locale {
+			m.Locale = sub.Locale
+			m.GivenName = locale.drawGivenName(rng, m.Sex)
+		}
+		m.FamilyName = sub.FamilyName
+		m.Address = sub.Address
+		m.HouseholdID = id
+
+		if sub.Coverage.Payer.PlanType == PlanMedicare {
+			m.Coverage = drawCoverage(rng, m.Age)
+			continue
+		}
+		m.Coverage = sub.Coverage
+		m.Coverage.Relationship = relationship
+		m.Coverage.Subscriber = &CoverageSubscriber{
+			PatientID:  sub.ID,
+			GivenName:  sub.GivenName,
+			FamilyName: sub.FamilyName,
+			BirthDate:  sub.BirthDate,
+			Sex:        sub.Sex,
+		}
+	}
+}
+
+// patientBatch draws a batch's patients one at a time, numbering them from 1 under
+// the batch's ID prefix, so a batch can be returned whole or streamed
+type patientBatch struct {
+	rng         *rand.Rand
+	cohort      CohortProfile
+	codeSystems []string
+	prefix      string
+	// households groups patients into households of up to maxHouseholdSize
+	households bool
+
+	n, household int
+	pending      []*SyntheticPatient
+}
+
+func newPatientBatch(rng *rand.Rand, cohort CohortProfile, codeSystems []string, prefix string, households bool) *patientBatch {
+	return &patientBatch{rng: rng, cohort: cohort, codeSystems: codeSystems, prefix: prefix, households: households}
+}
+
+// draw generates the batch's next patient
+func (b *patientBatch) draw() *SyntheticPatient {
+	b.n++
+	p := newSyntheticPatient(b.rng, b.n, b.cohort, b.codeSystems)
+	p.ID = fmt.Sprintf("%s-%05d", b.prefix, b.n)
+	assignCare(b.rng, p)
+	return p
+}
+
+// next returns the batch's next patient. With households, a whole household is drawn
+// at once: a subscriber who is a minor lives alone, and one too old to have children
+// at home with at most a spouse.
+func (b *patientBatch) next() *SyntheticPatient {
+	if len(b.pending) == 0 {
+		b.pending = append(b.pending, b.draw())
+		if b.households {
+			size, age := 1, b.pending[0].Age
+			if age >= adultAge {
+				size += b.rng.Intn(maxHouseholdSize)
+			}
+			if age-maxParentAge >= adultAge && size > 2 {
+				size = 2
+			}
+			for len(b.pending) < size {
+				b.pending = append(b.pending, b.draw())
+			}
+			b.household++
+			linkHousehold(b.rng, b.pending, fmt.Sprintf("%s-HH-%05d", b.prefix, b.household))
+		}
+	}
+	p := b.pending[0]
+	b.pending = b.pending[1:]
+	return p
+}
+
+// refSource seeds a patient_ref's own source and derives its patient ID, both from a
+// hash of the ref, so the ref always yields the same patient
+func refSource(ref string) (*rand.Rand, string) {
+	sum := sha256.Sum256([]byte(ref))
+	seed := int64(binary.BigEndian.Uint64(sum[8:16]) % maxSeed)
+	return rand.New(rand.NewSource(seed)), "SYN-REF-" + strings.ToUpper(hex.EncodeToString(sum[:6]))
+}
+
+// refPatient generates the patient a patient_ref stands for. The same ref, cohort and
+// code systems give the same patient, whatever the request's seed.
+func refPatient(ref string, cohort CohortProfile, codeSystems []string) (*SyntheticPatient, error) {
+	if !patientRefPattern.MatchString(ref) {
+		return nil, fmt.Errorf("patient_ref %q: must be 1 to 128 letters, digits, '.', '_', ':' or '-'", ref)
+	}
+	rng, id := refSource(ref)
+	p := newSyntheticPatient(rng, 1, cohort, codeSystems)
+	p.ID = id
+	assignCare(rng, p)
+	return p, nil
+}
@@ -3,18 +3,32 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
-	"math/rand"
 	"net/http"
 	"os"
 	"os/signal"
+	"sort"
+	"strconv"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/healthcare-gitops/common/apidocs"
+	"github.com/healthcare-gitops/common/audit"
+	"github.com/healthcare-gitops/common/auth"
+	"github.com/healthcare-gitops/common/calendar"
+	"github.com/healthcare-gitops/common/changelog"
+	"github.com/healthcare-gitops/common/clientip"
+	"github.com/healthcare-gitops/common/compliance"
 	"github.com/healthcare-gitops/common/config"
+	"github.com/healthcare-gitops/common/health"
+	commonmw "github.com/healthcare-gitops/common/middleware"
+	"github.com/healthcare-gitops/common/observability"
+	"github.com/healthcare-gitops/common/synthetic"
+	"github.com/healthcare-gitops/common/tlsconfig"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -31,6 +45,8 @@ const (
 	StatusOffline     DeviceStatus = "offline"
 	StatusMaintenance DeviceStatus = "maintenance"
 	StatusError       DeviceStatus = "error"
+	// StatusRetired is set when a device is decommissioned
+	StatusRetired DeviceStatus = "retired"
 )
 
 // DeviceType represents the type of medical device
@@ -60,7 +76,15 @@ type MedicalDevice struct {
 	UpTime          int64        `json:"uptime_seconds"`
 	ErrorCount      int          `json:"error_count"`
 	AlertLevel      string       `json:"alert_level"`
-	mu              sync.RWMutex
+	LastHeartbeat   time.Time    `json:"last_heartbeat"`
+	// HeartbeatIntervalSeconds overrides the default heartbeat interval for the device type
+	HeartbeatIntervalSeconds int `json:"heartbeat_interval_seconds,omitempty"`
+	// DecommissionedAt is set when the device is removed from service. The record is
+	// archived rather than deleted until the retention period has passed.
+	DecommissionedAt *time.Time `json:"decommissioned_at,omitempty"`
+	// Marker flags test and demo devices, which are purged when they expire
+	synthetic.Marker
+	mu sync.RWMutex
 }
 
 // DeviceMetrics represents operational metrics for a device
@@ -76,7 +100,19 @@ type DeviceMetrics struct {
 // DeviceRegistry manages all registered medical devices
 type DeviceRegistry struct {
 	devices map[string]*MedicalDevice
-	metrics map[string]*DeviceMetrics
+	// decommissioned holds archived devices awaiting purge
+	decommissioned map[string]*MedicalDevice
+	metrics        map[string]*DeviceMetrics
+	silent         map[string]time.Time // device ID -> when the heartbeat monitor took it offline
+	alerts         map[string]*Alert
+	// alertSeq numbers alerts in the order they were raised
+	alertSeq  int
+	unitNotes []Note
+	noteSeq   int
+	// publishedStatus is the last status announced to webhook subscribers
+	publishedStatus map[string]DeviceStatus
+	// summary keeps dashboard counts current as devices and alerts change
+	summary *DeviceSummary
 	mu      sync.RWMutex
 }
 
@@ -84,19 +120,87 @@ var (
 	registry *DeviceRegistry
 )
 
+// deviceRateLimits let each caller report metrics and heartbeats faster than other
+// requests, since one gateway reports for every device on a ward
+var deviceRateLimits = []string{
+	"POST /api/v1/devices/*/metrics=200:400",
+	"POST /api/v1/devices/*/heartbeat=200:400",
+}
+
 func main() {
+	// The config file was read as the config package initialized; reading it again
+	// returns the error, reported once logging is set up
+	configErr := config.Load()
+
 	// Initialize structured logging
 	initLogging()
 
 	log.Info().Msg("Starting Medical Device Monitoring Service...")
 
 	// Load configuration
+	if configErr != nil {
+		log.Fatal().Err(configErr).Msg("Failed to read config file")
+	}
 	port := config.GetEnv("PORT", "8084")
 
+	simConfig := defaultSimulatorConfig()
+	simTypes := registerSimulatorFlags(flag.CommandLine, &simConfig)
+	flag.Parse()
+	if *simTypes != "" {
+		simConfig.DeviceTypes = parseDeviceTypes(*simTypes)
+	}
+
 	// Initialize device registry
 	registry = NewDeviceRegistry()
+	janitor.Register("device", registry.reclaimSynthetic)
 	log.Info().Msg("Device registry initialized")
 
+	maintenanceScheduler = NewMaintenanceScheduler()
+	calibrations = NewCalibrationLog(calibrationSigningKey())
+	inventory = NewConsumableInventory(defaultConsumables)
+	contracts = NewContractRegistry()
+	vendorWebhooks = NewVendorWebhookRegistry()
+	webhooks = NewWebhookDispatcher()
+	if err := configureEventEncryption(); err != nil {
+		log.Fatal().Err(err).Msg("Invalid event encryption configuration")
+	}
+	captures = NewCaptureManager(config.GetEnv("CAPTURE_DIR", "/var/lib/medical-device/captures"))
+	replayer = NewReplayer()
+	snapshots = NewSnapshotStore()
+
+	var err error
+	if calendars, err = calendar.LoadFile(config.GetEnv("CALENDARS_FILE", "")); err != nil {
+		log.Fatal().Err(err).Msg("Invalid business calendar configuration")
+	}
+	if featureFlags.Enabled(FeatureDocuments) {
+		if library, err = openDocumentLibrary(context.Background()); err != nil {
+			log.Fatal().Err(err).Msg("Failed to open attachment library")
+		}
+	}
+	if archiveStore, err = openArchiveStore(); err != nil {
+		log.Fatal().Err(err).Msg("Failed to open decommissioning archive")
+	}
+	changes, err := newChangelog()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid API changelog")
+	}
+	docs, err := apidocs.New(openAPISpec, apiSpecVersion)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid OpenAPI document")
+	}
+
+	if err := loadCohortsFile(config.GetEnv("SIMULATOR_COHORTS_FILE", "")); err != nil {
+		log.Fatal().Err(err).Msg("Invalid cohort profiles")
+	}
+	simulator, err = NewSimulator(simConfig)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid simulator configuration")
+	}
+	if !featureFlags.Enabled(FeatureSimulator) {
+		// Chaos drills act on the simulated fleet
+		featureFlags.Unavailable(FeatureChaosScenarios, "requires the simulator feature")
+	}
+
 	// Initialize OpenTelemetry tracing (disabled for lightweight deployment)
 	ctx := context.Background()
 	if err := InitTracerProvider("medical-device-service"); err != nil {
@@ -111,48 +215,250 @@ func main() {
 	}
 	_ = ctx // Mark as used
 
+	// Optional TLS; with TLS_CLIENT_CA_FILE set, clients must present a certificate
+	// from the internal CA
+	tlsCfg := tlsconfig.FromEnv()
+	if tlsCfg.MutualTLS() {
+		log.Info().Str("client_auth", tlsCfg.ClientAuth).Strs("allowed_clients", tlsCfg.AllowedClients).Msg("Mutual TLS enabled")
+	} else if tlsCfg.Enabled() {
+		log.Info().Msg("TLS enabled")
+	}
+
+	// Shared audit bus for device mutations
+	if err := configureAuditEvents(context.Background()); err != nil {
+		log.Fatal().Err(err).Msg("Failed to open audit sink")
+	}
+
+	// Registrations are streamed to the event broker, when one is configured
+	if err := configureEventStream(); err != nil {
+		log.Fatal().Err(err).Msg("Failed to open event broker")
+	}
+
+	authn := newIntrospector(tlsCfg)
+	admin := authn.Require(auth.AdminScope)
+	credentials = newCredentialRevoker(tlsCfg)
+
+	// X-Forwarded-For is believed only from the ingress and other trusted proxies
+	proxies, err := clientip.FromEnv()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid TRUSTED_PROXIES")
+	}
+
+	rateLimits := commonmw.RateLimitConfigFromEnv("medical-device-service", deviceRateLimits...)
+	rateLimits.OnStoreError = func(err error) {
+		log.Warn().Err(err).Msg("Rate limit store unavailable, limiting per replica")
+	}
+	rateLimits.Identify = authn.Verified
+	rateLimits.TrustedProxies = proxies
+	limiter, err := commonmw.NewRateLimiter(rateLimits)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid rate limit configuration")
+	}
+
 	// Setup HTTP router
 	r := chi.NewRouter()
 
 	// Middleware stack
 	r.Use(middleware.Recoverer)
-	r.Use(middleware.RealIP)
+	r.Use(proxies.Middleware)
 	r.Use(middleware.RequestID)
+	r.Use(tlsconfig.Middleware)
 	r.Use(LoggingMiddleware)
 	r.Use(TracingMiddleware)
+	r.Use(auditMiddleware(auditEvents))
 	r.Use(PrometheusMiddleware)
 	r.Use(CORSMiddleware)
+	r.Use(limiter.Middleware)
 	r.Use(middleware.Compress(5))
-	r.Use(middleware.Timeout(30 * time.Second))
+	r.Use(middleware.Timeout(requestTimeout))
 
 	// Health & readiness endpoints
 	r.Get("/health", HealthHandler)
 	r.Get("/ready", ReadyHandler)
+	r.Get("/capabilities", CapabilitiesHandler)
+	r.Get("/changelog", changelog.Handler(changes))
+	r.Get("/openapi.json", docs.SpecHandler)
+	r.Get("/docs", docs.DocsHandler)
 
-	// Metrics endpoint
+	// Metrics, and the alerting rules and dashboard generated from them
 	r.Handle("/metrics", promhttp.Handler())
+	r.With(admin).Get("/admin/observability/*", observability.Handler(observabilitySpec).ServeHTTP)
+	r.Get("/admin/selfscan", selfScanHandler(r))
+	// The anonymous usage stats this install sends, or would send if opted in
+	r.With(admin).Get("/admin/usage-stats", usageStats.Handler())
+	// Live status of the service's FDA controls, for the compliance posture report
+	r.With(admin).Get("/compliance/status", compliance.Handler(func(*http.Request) compliance.Status {
+		return complianceStatus(authn != nil, time.Now())
+	}))
 
 	// API routes
 	r.Route("/api/v1", func(r chi.Router) {
+		// device:read tokens for reads, device:write for changes; admin routes below
+		r.Use(requireDeviceScope(authn))
+
 		// Device management
 		r.Post("/devices", RegisterDeviceHandler)
 		r.Get("/devices", ListDevicesHandler)
 		r.Get("/devices/{deviceID}", GetDeviceHandler)
 		r.Put("/devices/{deviceID}", UpdateDeviceHandler)
+		r.Patch("/devices/{deviceID}", PatchDeviceHandler)
 		r.Delete("/devices/{deviceID}", DeregisterDeviceHandler)
 
+		// Bulk decommissioning: archive, revoke credentials, retire and certify
+		r.With(admin).Post("/decommissions", DecommissionDevicesHandler)
+		r.With(admin).Get("/decommissions/{batchID}", GetDecommissionBatchHandler)
+		r.Get("/devices/{deviceID}/decommission/certificate", serveDeviceArchive("certificate.txt", "text/plain; charset=utf-8"))
+		r.Get("/devices/{deviceID}/decommission/archive", serveDeviceArchive("history.json.gz", "application/gzip"))
+
 		// Device metrics
 		r.Get("/devices/{deviceID}/metrics", GetDeviceMetricsHandler)
 		r.Post("/devices/{deviceID}/metrics", UpdateDeviceMetricsHandler)
 
 		// Device operations
 		r.Post("/devices/{deviceID}/calibrate", CalibrateDeviceHandler)
+		r.Get("/devices/{deviceID}/calibrations", ListCalibrationsHandler)
 		r.Post("/devices/{deviceID}/maintenance", ScheduleMaintenanceHandler)
+		r.Get("/devices/{deviceID}/maintenance", GetDeviceMaintenanceHandler)
+		r.Post("/devices/{deviceID}/maintenance/complete", CompleteMaintenanceHandler)
 		r.Post("/devices/{deviceID}/diagnostics", RunDiagnosticsHandler)
 
 		// Alerts and monitoring
 		r.Get("/alerts", ListAlertsHandler)
+		r.Get("/alerts/sla", AlertSLAHandler)
+		r.Get("/alerts/{alertID}", GetAlertHandler)
+		r.Post("/alerts/{alertID}/acknowledge", AcknowledgeAlertHandler)
+		r.Post("/alerts/{alertID}/notes", AddAlertNoteHandler)
+
+		// Dashboard summary, kept current incrementally
+		r.Get("/summary", SummaryHandler)
+
+		// Shift handoff
+		r.Post("/handoff/notes", AddHandoffNoteHandler)
+		r.Get("/handoff/summary", HandoffSummaryHandler)
 		r.Get("/devices/{deviceID}/status", GetDeviceStatusHandler)
+
+		// Heartbeat (dead-man's switch) monitoring
+		r.Post("/devices/{deviceID}/heartbeat", HeartbeatHandler)
+		r.Get("/heartbeats/silent", ListSilentDevicesHandler)
+
+		// Maintenance planning
+		r.Get("/maintenance/upcoming", UpcomingMaintenanceHandler)
+		r.Put("/maintenance/schedules/{scheduleID}/technician", AssignTechnicianHandler)
+
+		// Tenants' business hours and holidays, which maintenance keeps to
+		r.Handle("/calendars", calendar.Handler(calendars))
+		r.Handle("/calendars/*", calendar.Handler(calendars))
+
+		// Consumables inventory
+		r.Post("/devices/{deviceID}/consumables/usage", RecordConsumableUsageHandler)
+		r.Post("/consumables/{sku}/restock", RestockConsumableHandler)
+		r.Get("/consumables/forecast", ConsumableForecastHandler)
+
+		// Warranty and service contracts
+		r.Post("/devices/{deviceID}/contracts", AddContractHandler)
+		r.Get("/devices/{deviceID}/contracts", ListDeviceContractsHandler)
+		r.Get("/contracts/renewals", ContractRenewalReportHandler)
+
+		// Expired synthetic data cleanup, run on a timer or by a cleanup job
+		r.With(admin).Get("/synthetic/cleanup", janitor.Handler())
+		r.With(admin).Post("/synthetic/cleanup", janitor.Handler())
+
+		// Photos, PDFs and certificates attached to work orders and calibrations
+		r.Group(func(r chi.Router) {
+			r.Use(featureFlags.Middleware(FeatureDocuments))
+			r.Post("/maintenance/schedules/{scheduleID}/attachments", UploadAttachmentHandler)
+			r.Get("/maintenance/schedules/{scheduleID}/attachments", ListAttachmentsHandler)
+			r.Post("/calibrations/{certificateID}/attachments", UploadAttachmentHandler)
+			r.Get("/calibrations/{certificateID}/attachments", ListAttachmentsHandler)
+			r.Get("/documents", SearchDocumentsHandler)
+			r.Get("/documents/{documentID}", GetDocumentHandler)
+			r.Get("/documents/{documentID}/content", GetDocumentContentHandler)
+			r.Delete("/documents/{documentID}", DeleteDocumentHandler)
+		})
+
+		// Point-in-time device snapshots for change review
+		r.Group(func(r chi.Router) {
+			r.Use(featureFlags.Middleware(FeatureSnapshots))
+			r.Post("/devices/{deviceID}/snapshots", TakeSnapshotHandler)
+			r.Get("/devices/{deviceID}/snapshots", ListSnapshotsHandler)
+			r.Get("/devices/{deviceID}/snapshots/diff", DiffSnapshotsHandler)
+			r.Get("/snapshots/{snapshotID}", GetSnapshotHandler)
+		})
+
+		// Manufacturer service portal integration
+		r.Group(func(r chi.Router) {
+			r.Use(featureFlags.Middleware(FeatureVendorWebhooks), admin)
+			r.Post("/vendor-webhooks", RegisterVendorWebhookHandler)
+			r.Get("/vendor-webhooks", ListVendorWebhooksHandler)
+			r.Delete("/vendor-webhooks/{webhookID}", DeleteVendorWebhookHandler)
+		})
+
+		// Device event webhooks
+		r.Group(func(r chi.Router) {
+			r.Use(featureFlags.Middleware(FeatureWebhooks), admin)
+			r.Post("/webhooks", CreateWebhookHandler)
+			r.Get("/webhooks", ListWebhooksHandler)
+			r.Delete("/webhooks/{webhookID}", DeleteWebhookHandler)
+			r.Post("/webhooks/{webhookID}/enable", EnableWebhookHandler)
+			r.Put("/webhooks/{webhookID}/retry-policy", UpdateWebhookRetryPolicyHandler)
+			r.Get("/webhooks/{webhookID}/deliveries", ListWebhookDeliveriesHandler)
+			r.Get("/webhooks/{webhookID}/deliveries/{deliveryID}", GetWebhookDeliveryHandler)
+			r.Post("/webhooks/{webhookID}/deliveries/{deliveryID}/redeliver", RedeliverWebhookHandler)
+		})
+
+		// Event schema discovery
+		r.Get("/schemas", ListSchemasHandler)
+		r.Get("/schemas/{eventType}", GetSchemaHandler)
+		r.Get("/schemas/{eventType}/{version}", GetSchemaHandler)
+		r.Get("/asyncapi", AsyncAPIHandler)
+
+		// Load-generating device simulator
+		r.Group(func(r chi.Router) {
+			r.Use(featureFlags.Middleware(FeatureSimulator))
+			r.Get("/simulator", GetSimulatorHandler)
+			r.Put("/simulator", UpdateSimulatorHandler)
+			r.Post("/simulator/start", StartSimulatorHandler)
+			r.Post("/simulator/stop", StopSimulatorHandler)
+			r.Get("/simulator/patients", ListSyntheticPatientsHandler)
+			r.Get("/simulator/directory", GetSyntheticDirectoryHandler)
+			r.Get("/simulator/encounters", ListSyntheticEncountersHandler)
+			r.Get("/simulator/fhir", GetSyntheticFHIRHandler)
+			r.Get("/simulator/hl7", GetSyntheticHL7Handler)
+			r.Get("/simulator/claims", ListSyntheticClaimsHandler)
+			r.Get("/simulator/cohorts", ListCohortProfilesHandler)
+			r.Post("/simulator/cohorts", RegisterCohortProfilesHandler)
+			r.Post("/simulator/patients", GeneratePatientsHandler)
+			r.Post("/simulator/patients/history", GeneratePatientHistoryHandler)
+			r.Post("/simulator/patients/export", ExportPatientsHandler)
+			r.Post("/simulator/imaging", GenerateImagingHandler)
+			r.Post("/simulator/telemetry", GenerateTelemetryHandler)
+
+			// Metrics load tests against another instance
+			r.With(admin).Post("/simulator/telemetry/push", StartTelemetryPushHandler)
+			r.With(admin).Get("/simulator/telemetry/push/{pushID}", GetTelemetryPushHandler)
+			r.With(admin).Post("/simulator/telemetry/push/{pushID}/stop", StopTelemetryPushHandler)
+		})
+		r.Get("/devices/{deviceID}/telemetry", GetDeviceTelemetryHandler)
+
+		// Mass-failure chaos drills against the simulated fleet
+		r.Group(func(r chi.Router) {
+			r.Use(featureFlags.Middleware(FeatureChaosScenarios), admin)
+			r.Get("/simulator/scenarios", ListChaosScenariosHandler)
+			r.Post("/simulator/scenarios/{name}/run", RunChaosScenarioHandler)
+			r.Get("/simulator/chaos-runs/{runID}", GetChaosRunHandler)
+			r.Post("/simulator/chaos-runs/{runID}/stop", StopChaosRunHandler)
+		})
+
+		// De-identified telemetry capture and replay into test instances
+		r.Group(func(r chi.Router) {
+			r.Use(featureFlags.Middleware(FeatureTelemetryCapture), admin)
+			r.Post("/captures/start", StartCaptureHandler)
+			r.Post("/captures/stop", StopCaptureHandler)
+			r.Get("/captures", ListCapturesHandler)
+			r.Post("/captures/{captureID}/replay", StartReplayHandler)
+			r.Get("/replays/{replayID}", GetReplayHandler)
+			r.Post("/replays/{replayID}/stop", StopReplayHandler)
+		})
 	})
 
 	// Start HTTP server
@@ -168,16 +474,45 @@ func main() {
 	// Start server in goroutine
 	go func() {
 		log.Info().Str("address", addr).Msg("HTTP server starting")
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := tlsconfig.ListenAndServe(server, tlsCfg); err != nil && err != http.ErrServerClosed {
 			log.Fatal().Err(err).Msg("HTTP server failed")
 		}
 	}()
 
-	// Start background device simulator for demo purposes
-	if config.GetEnv("ENABLE_SIMULATOR", "true") == "true" {
-		go startDeviceSimulator()
+	// Start background device simulator for demo and load testing
+	if featureFlags.Enabled(FeatureSimulator) && config.GetEnv("ENABLE_SIMULATOR", "true") == "true" {
+		simulator.Start()
 	}
 
+	// Start heartbeat monitor to catch devices that stop reporting
+	go startHeartbeatMonitor(time.Duration(config.GetEnvInt("HEARTBEAT_CHECK_INTERVAL_SECONDS", 15)) * time.Second)
+
+	// Track acknowledgment SLAs for open alerts
+	go startAlertSLAMonitor(time.Duration(config.GetEnvInt("ALERT_SLA_CHECK_INTERVAL_SECONDS", 15)) * time.Second)
+
+	// Remind technicians of maintenance coming due
+	go startMaintenanceReminders(
+		time.Duration(config.GetEnvInt("MAINTENANCE_REMINDER_CHECK_MINUTES", 60))*time.Minute,
+		time.Duration(config.GetEnvInt("MAINTENANCE_REMINDER_LEAD_HOURS", 48))*time.Hour,
+	)
+
+	// Purge decommissioned devices once their retention period has passed
+	go startDecommissionPurge(time.Duration(config.GetEnvInt("DEVICE_PURGE_INTERVAL_HOURS", 24)) * time.Hour)
+
+	// Warn procurement ahead of warranty and service contract expiry
+	go startContractExpiryMonitor(time.Duration(config.GetEnvInt("CONTRACT_CHECK_INTERVAL_HOURS", 24)) * time.Hour)
+
+	// Snapshot device records so audits can review what changed between them
+	if featureFlags.Enabled(FeatureSnapshots) {
+		go startSnapshotScheduler(time.Duration(config.GetEnvInt("SNAPSHOT_INTERVAL_HOURS", 24)) * time.Hour)
+	}
+
+	// Purge synthetic devices left behind by tests and demos
+	go startSyntheticCleanup(context.Background())
+
+	// Opt-in anonymous usage stats for the platform team
+	go startUsageStats(context.Background())
+
 	// Wait for interrupt signal for graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -192,19 +527,25 @@ func main() {
 	if err := server.Shutdown(shutdownCtx); err != nil {
 		log.Error().Err(err).Msg("Server forced to shutdown")
 	}
+	if err := auditEvents.Close(shutdownCtx); err != nil {
+		log.Error().Err(err).Msg("Failed to flush audit events")
+	}
+	if err := eventStream.Close(shutdownCtx); err != nil {
+		log.Error().Err(err).Msg("Failed to flush streamed events")
+	}
 
 	log.Info().Msg("Server shutdown complete")
 }
 
 // initLogging configures structured logging with zerolog
 func initLogging() {
-	if os.Getenv("ENV") == "development" {
+	if config.GetEnv("ENV", "") == "development" {
 		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339})
 	} else {
 		zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
 	}
 
-	logLevel := os.Getenv("LOG_LEVEL")
+	logLevel := config.GetEnv("LOG_LEVEL", "")
 	switch logLevel {
 	case "debug":
 		zerolog.SetGlobalLevel(zerolog.DebugLevel)
@@ -222,8 +563,13 @@ func initLogging() {
 // NewDeviceRegistry creates a new device registry
 func NewDeviceRegistry() *DeviceRegistry {
 	return &DeviceRegistry{
-		devices: make(map[string]*MedicalDevice),
-		metrics: make(map[string]*DeviceMetrics),
+		devices:         make(map[string]*MedicalDevice),
+		decommissioned:  make(map[string]*MedicalDevice),
+		metrics:         make(map[string]*DeviceMetrics),
+		silent:          make(map[string]time.Time),
+		alerts:          make(map[string]*Alert),
+		publishedStatus: make(map[string]DeviceStatus),
+		summary:         NewDeviceSummary(),
 	}
 }
 
@@ -237,25 +583,17 @@ func HealthHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// ReadyHandler handles readiness check endpoint
+// ReadyHandler reports whether the device registry and the service's dependencies
+// are up, with the fleet's size
 func ReadyHandler(w http.ResponseWriter, r *http.Request) {
-	if registry == nil {
-		w.WriteHeader(http.StatusServiceUnavailable)
-		json.NewEncoder(w).Encode(map[string]string{
-			"status": "not ready",
-			"reason": "device registry not initialized",
-		})
-		return
+	report := readiness().Run(r.Context())
+	if registry != nil {
+		report.Details = map[string]interface{}{
+			"device_count":  registry.DeviceCount(),
+			"active_alerts": registry.GetActiveAlertCount(),
+		}
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":        "ready",
-		"service":       "medical-device-service",
-		"device_count":  registry.DeviceCount(),
-		"active_alerts": registry.GetActiveAlertCount(),
-	})
+	health.Write(w, report)
 }
 
 // RegisterDeviceHandler registers a new medical device
@@ -279,6 +617,15 @@ func RegisterDeviceHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Only the request headers can mark a device synthetic, never the body
+	marker, err := syntheticPolicy.FromRequest(r, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		RecordDeviceOperation("register", "error", time.Since(start).Seconds())
+		return
+	}
+	device.Marker = marker
+
 	// Register device
 	if err := registry.RegisterDevice(&device); err != nil {
 		log.Error().Err(err).Str("device_id", device.ID).Msg("Failed to register device")
@@ -297,30 +644,72 @@ func RegisterDeviceHandler(w http.ResponseWriter, r *http.Request) {
 	)
 
 	log.Info().Str("device_id", device.ID).Str("type", string(device.Type)).Msg("Device registered")
+	audit.SetResource(r.Context(), "/api/v1/devices/"+device.ID)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(&device)
 }
 
-// ListDevicesHandler lists all registered devices
+// maxDevicePageSize caps the limit accepted by ListDevicesHandler
+const maxDevicePageSize = 500
+
+// ListDevicesHandler lists registered devices ordered by ID. Decommissioned devices are
+// included with ?include_decommissioned=true; ?limit and ?offset page through the list,
+// with next_offset set while more devices remain.
 func ListDevicesHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	start := time.Now()
 
+	// Optional offset pagination; without a limit every device is returned
+	query := r.URL.Query()
+	limit, offset := 0, 0
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxDevicePageSize {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxDevicePageSize), http.StatusBadRequest)
+			RecordDeviceOperation("list", "error", time.Since(start).Seconds())
+			return
+		}
+		limit = n
+	}
+	if value := query.Get("offset"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			http.Error(w, "offset must be a non-negative integer", http.StatusBadRequest)
+			RecordDeviceOperation("list", "error", time.Since(start).Seconds())
+			return
+		}
+		offset = n
+	}
+
 	devices := registry.ListDevices()
+	if query.Get("include_decommissioned") == "true" {
+		devices = append(devices, registry.ListDecommissioned()...)
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].ID < devices[j].ID })
+
+	total := len(devices)
+	if offset > total {
+		offset = total
+	}
+	page := devices[offset:]
+	response := map[string]interface{}{"total": total}
+	if limit > 0 && len(page) > limit {
+		page = page[:limit]
+		response["next_offset"] = offset + limit
+	}
+	response["devices"] = page
+	response["count"] = len(page)
 
 	duration := time.Since(start).Seconds()
 	RecordDeviceOperation("list", "success", duration)
 
 	span := trace.SpanFromContext(ctx)
-	span.SetAttributes(attribute.Int("device.count", len(devices)))
+	span.SetAttributes(attribute.Int("device.count", len(page)))
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"devices": devices,
-		"count":   len(devices),
-	})
+	json.NewEncoder(w).Encode(response)
 }
 
 // GetDeviceHandler retrieves a specific device
@@ -330,7 +719,11 @@ func GetDeviceHandler(w http.ResponseWriter, r *http.Request) {
 	span := trace.SpanFromContext(ctx)
 	start := time.Now()
 
+	// Decommissioned devices stay readable for audit until purged
 	device, err := registry.GetDevice(deviceID)
+	if err != nil {
+		device, err = registry.GetDecommissionedDevice(deviceID)
+	}
 	if err != nil {
 		http.Error(w, "Device not found", http.StatusNotFound)
 		RecordDeviceOperation("get", "error", time.Since(start).Seconds())
@@ -378,7 +771,7 @@ func UpdateDeviceHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(&updates)
 }
 
-// DeregisterDeviceHandler removes a device from registry
+// DeregisterDeviceHandler decommissions a device. Its record is archived, not deleted.
 func DeregisterDeviceHandler(w http.ResponseWriter, r *http.Request) {
 	deviceID := chi.URLParam(r, "deviceID")
 	ctx := r.Context()
@@ -396,7 +789,7 @@ func DeregisterDeviceHandler(w http.ResponseWriter, r *http.Request) {
 	RecordDeviceOperation("deregister", "success", duration)
 	span.SetAttributes(attribute.String("device.id", deviceID))
 
-	log.Info().Str("device_id", deviceID).Msg("Device deregistered")
+	log.Info().Str("device_id", deviceID).Msg("Device decommissioned")
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -446,6 +839,9 @@ func UpdateDeviceMetricsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// A metrics push proves the device is alive
+	registry.RecordHeartbeat(deviceID, metrics.LastUpdated)
+
 	duration := time.Since(start).Seconds()
 	RecordDeviceOperation("update_metrics", "success", duration)
 	span.SetAttributes(attribute.String("device.id", deviceID))
@@ -454,82 +850,6 @@ func UpdateDeviceMetricsHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(metrics)
 }
 
-// CalibrateDeviceHandler triggers device calibration
-func CalibrateDeviceHandler(w http.ResponseWriter, r *http.Request) {
-	deviceID := chi.URLParam(r, "deviceID")
-	ctx := r.Context()
-	span := trace.SpanFromContext(ctx)
-	start := time.Now()
-
-	device, err := registry.GetDevice(deviceID)
-	if err != nil {
-		http.Error(w, "Device not found", http.StatusNotFound)
-		RecordDeviceOperation("calibrate", "error", time.Since(start).Seconds())
-		span.RecordError(err)
-		return
-	}
-
-	// Simulate calibration
-	device.mu.Lock()
-	device.LastCalibration = time.Now()
-	device.mu.Unlock()
-
-	duration := time.Since(start).Seconds()
-	RecordDeviceOperation("calibrate", "success", duration)
-	span.SetAttributes(attribute.String("device.id", deviceID))
-
-	log.Info().Str("device_id", deviceID).Msg("Device calibrated")
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"device_id":        deviceID,
-		"last_calibration": device.LastCalibration,
-		"status":           "calibration_complete",
-	})
-}
-
-// ScheduleMaintenanceHandler schedules device maintenance
-func ScheduleMaintenanceHandler(w http.ResponseWriter, r *http.Request) {
-	deviceID := chi.URLParam(r, "deviceID")
-	ctx := r.Context()
-	span := trace.SpanFromContext(ctx)
-	start := time.Now()
-
-	var req struct {
-		ScheduledTime time.Time `json:"scheduled_time"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		RecordDeviceOperation("schedule_maintenance", "error", time.Since(start).Seconds())
-		return
-	}
-
-	device, err := registry.GetDevice(deviceID)
-	if err != nil {
-		http.Error(w, "Device not found", http.StatusNotFound)
-		RecordDeviceOperation("schedule_maintenance", "error", time.Since(start).Seconds())
-		span.RecordError(err)
-		return
-	}
-
-	device.mu.Lock()
-	device.NextMaintenance = req.ScheduledTime
-	device.mu.Unlock()
-
-	duration := time.Since(start).Seconds()
-	RecordDeviceOperation("schedule_maintenance", "success", duration)
-	span.SetAttributes(attribute.String("device.id", deviceID))
-
-	log.Info().Str("device_id", deviceID).Time("scheduled", req.ScheduledTime).Msg("Maintenance scheduled")
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"device_id":        deviceID,
-		"next_maintenance": device.NextMaintenance,
-		"status":           "maintenance_scheduled",
-	})
-}
-
 // RunDiagnosticsHandler runs device diagnostics
 func RunDiagnosticsHandler(w http.ResponseWriter, r *http.Request) {
 	deviceID := chi.URLParam(r, "deviceID")
@@ -569,12 +889,30 @@ func RunDiagnosticsHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(results)
 }
 
-// ListAlertsHandler lists active alerts
+// ListAlertsHandler lists active alerts, optionally filtered by ?priority=high|medium|low
 func ListAlertsHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	start := time.Now()
 
+	priority := AlertPriority(r.URL.Query().Get("priority"))
+	if priority != "" {
+		if _, ok := priorityRank[priority]; !ok {
+			http.Error(w, "priority must be one of high, medium, low", http.StatusBadRequest)
+			RecordDeviceOperation("list_alerts", "error", time.Since(start).Seconds())
+			return
+		}
+	}
+
 	alerts := registry.GetActiveAlerts()
+	if priority != "" {
+		filtered := make([]Alert, 0, len(alerts))
+		for _, alert := range alerts {
+			if alert.Priority == priority {
+				filtered = append(filtered, alert)
+			}
+		}
+		alerts = filtered
+	}
 
 	duration := time.Since(start).Seconds()
 	RecordDeviceOperation("list_alerts", "success", duration)
@@ -623,8 +961,9 @@ func GetDeviceStatusHandler(w http.ResponseWriter, r *http.Request) {
 func CORSMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-User-ID")
+		w.Header().Set("Access-Control-Expose-Headers", "X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset, Retry-After")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -635,115 +974,35 @@ func CORSMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-// startDeviceSimulator simulates device data for demo purposes
-func startDeviceSimulator() {
-	log.Info().Msg("Starting device simulator")
-
-	// Register sample devices
-	devices := []*MedicalDevice{
-		{
-			ID:              "MRI-001",
-			Type:            DeviceTypeMRI,
-			Status:          StatusOperational,
-			Location:        "Radiology Department - Room 101",
-			SerialNumber:    "MRI-2024-001",
-			Manufacturer:    "Siemens Healthineers",
-			Model:           "MAGNETOM Vida",
-			FirmwareVersion: "VA30A",
-			LastCalibration: time.Now().Add(-24 * time.Hour),
-			NextMaintenance: time.Now().Add(30 * 24 * time.Hour),
-			UpTime:          86400,
-			ErrorCount:      0,
-			AlertLevel:      "none",
-		},
-		{
-			ID:              "ECG-002",
-			Type:            DeviceTypeECG,
-			Status:          StatusOperational,
-			Location:        "Cardiology - ICU Floor 3",
-			SerialNumber:    "ECG-2024-002",
-			Manufacturer:    "GE Healthcare",
-			Model:           "MAC 2000",
-			FirmwareVersion: "v3.2.1",
-			LastCalibration: time.Now().Add(-12 * time.Hour),
-			NextMaintenance: time.Now().Add(15 * 24 * time.Hour),
-			UpTime:          43200,
-			ErrorCount:      0,
-			AlertLevel:      "none",
-		},
-		{
-			ID:              "VENT-003",
-			Type:            DeviceTypeVentilator,
-			Status:          StatusOperational,
-			Location:        "ICU - Room 305",
-			SerialNumber:    "VENT-2024-003",
-			Manufacturer:    "Dräger",
-			Model:           "Evita V800",
-			FirmwareVersion: "v2.1.5",
-			LastCalibration: time.Now().Add(-6 * time.Hour),
-			NextMaintenance: time.Now().Add(7 * 24 * time.Hour),
-			UpTime:          21600,
-			ErrorCount:      0,
-			AlertLevel:      "none",
-		},
-	}
-
-	for _, device := range devices {
-		if err := registry.RegisterDevice(device); err != nil {
-			log.Error().Err(err).Str("device_id", device.ID).Msg("Failed to register sample device")
-		} else {
-			log.Info().Str("device_id", device.ID).Str("type", string(device.Type)).Msg("Sample device registered")
-
-			// Initialize metrics
-			metrics := &DeviceMetrics{
-				Temperature:      22.0 + rand.Float64()*3.0,
-				PowerConsumption: 500 + rand.Float64()*500,
-				CPUUtilization:   30 + rand.Float64()*40,
-				MemoryUsage:      40 + rand.Float64()*30,
-				NetworkLatency:   5 + rand.Float64()*10,
-				LastUpdated:      time.Now(),
-			}
-			registry.UpdateMetrics(device.ID, metrics)
-		}
-	}
-
-	// Update metrics periodically
-	ticker := time.NewTicker(10 * time.Second)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		devices := registry.ListDevices()
-		for _, device := range devices {
-			metrics := &DeviceMetrics{
-				Temperature:      22.0 + rand.Float64()*3.0,
-				PowerConsumption: 500 + rand.Float64()*500,
-				CPUUtilization:   30 + rand.Float64()*40,
-				MemoryUsage:      40 + rand.Float64()*30,
-				NetworkLatency:   5 + rand.Float64()*10,
-				LastUpdated:      time.Now(),
-			}
-			registry.UpdateMetrics(device.ID, metrics)
-
-			// Update uptime
-			dev, _ := registry.GetDevice(device.ID)
-			dev.mu.Lock()
-			dev.UpTime += 10
-			dev.mu.Unlock()
-		}
-	}
-}
-
 // DeviceRegistry methods
 
 func (dr *DeviceRegistry) RegisterDevice(device *MedicalDevice) error {
 	dr.mu.Lock()
-	defer dr.mu.Unlock()
 
 	if _, exists := dr.devices[device.ID]; exists {
+		dr.mu.Unlock()
 		return fmt.Errorf("device %s already registered", device.ID)
 	}
+	if _, archived := dr.decommissioned[device.ID]; archived {
+		dr.mu.Unlock()
+		return fmt.Errorf("device %s is decommissioned and its ID is retained until purge", device.ID)
+	}
+
+	// Registration counts as the first heartbeat so new devices get a full grace period
+	if device.LastHeartbeat.IsZero() {
+		device.LastHeartbeat = time.Now()
+	}
 
 	dr.devices[device.ID] = device
+	dr.mu.Unlock()
+
+	device.mu.RLock()
+	publishEvent(EventDeviceRegistered, device)
+	streamEvent(EventDeviceRegistered, "device/"+device.ID, device)
+	device.mu.RUnlock()
+
+	// A device registered in a failed state alerts immediately
+	dr.syncStatusAlerts(device)
 	return nil
 }
 
@@ -761,26 +1020,58 @@ func (dr *DeviceRegistry) GetDevice(deviceID string) (*MedicalDevice, error) {
 
 func (dr *DeviceRegistry) UpdateDevice(device *MedicalDevice) error {
 	dr.mu.Lock()
-	defer dr.mu.Unlock()
 
-	if _, exists := dr.devices[device.ID]; !exists {
+	existing, exists := dr.devices[device.ID]
+	if !exists {
+		dr.mu.Unlock()
 		return fmt.Errorf("device %s not found", device.ID)
 	}
 
+	// Whether a device is synthetic is fixed at registration
+	device.Marker = existing.Marker
 	dr.devices[device.ID] = device
+	dr.mu.Unlock()
+
+	dr.syncStatusAlerts(device)
 	return nil
 }
 
+// DeregisterDevice decommissions a device: it leaves active service and is archived
+// with its metrics and alert history until PurgeDecommissioned removes it
 func (dr *DeviceRegistry) DeregisterDevice(deviceID string) error {
+	dr.mu.Lock()
+	device, exists := dr.devices[deviceID]
+	dr.mu.Unlock()
+	if !exists {
+		return fmt.Errorf("device %s not found", deviceID)
+	}
+
+	device.mu.Lock()
+	defer device.mu.Unlock()
 	dr.mu.Lock()
 	defer dr.mu.Unlock()
 
-	if _, exists := dr.devices[deviceID]; !exists {
+	if dr.devices[deviceID] != device {
 		return fmt.Errorf("device %s not found", deviceID)
 	}
 
+	now := time.Now()
+	device.DecommissionedAt = &now
+	device.Status = StatusRetired
+	dr.decommissioned[deviceID] = device
 	delete(dr.devices, deviceID)
-	delete(dr.metrics, deviceID)
+	delete(dr.silent, deviceID)
+	delete(dr.publishedStatus, deviceID)
+	dr.summary.remove(deviceID)
+	if maintenanceScheduler != nil {
+		maintenanceScheduler.CancelDeviceSchedules(deviceID)
+	}
+
+	for _, alert := range dr.alerts {
+		if alert.DeviceID == deviceID {
+			dr.resolveAlertLocked(deviceID, alert.Condition, now)
+		}
+	}
 	return nil
 }
 
@@ -811,6 +1102,7 @@ func (dr *DeviceRegistry) UpdateMetrics(deviceID string, metrics *DeviceMetrics)
 	}
 
 	dr.metrics[deviceID] = metrics
+	captureEvent(CaptureKindMetrics, deviceID, metrics, "")
 	return nil
 }
 
@@ -826,23 +1118,18 @@ func (dr *DeviceRegistry) GetMetrics(deviceID string) (*DeviceMetrics, error) {
 	return metrics, nil
 }
 
-func (dr *DeviceRegistry) GetActiveAlerts() []map[string]interface{} {
+// GetActiveAlerts returns unresolved alerts, highest priority first
+func (dr *DeviceRegistry) GetActiveAlerts() []Alert {
 	dr.mu.RLock()
 	defer dr.mu.RUnlock()
 
-	alerts := make([]map[string]interface{}, 0)
-	for _, device := range dr.devices {
-		if device.AlertLevel != "none" && device.AlertLevel != "" {
-			alerts = append(alerts, map[string]interface{}{
-				"device_id":   device.ID,
-				"device_type": device.Type,
-				"alert_level": device.AlertLevel,
-				"status":      device.Status,
-				"location":    device.Location,
-				"error_count": device.ErrorCount,
-			})
+	alerts := make([]Alert, 0)
+	for _, alert := range dr.alerts {
+		if alert.ResolvedAt == nil {
+			alerts = append(alerts, *alert)
 		}
 	}
+	sortAlerts(alerts)
 
 	return alerts
 }
@@ -0,0 +1,537 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/healthcare-gitops/common/calendar"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// MaintenanceSchedule is a one-off or recurring maintenance plan for a device
+type MaintenanceSchedule struct {
+	ID          string    `json:"id"`
+	DeviceID    string    `json:"device_id"`
+	Description string    `json:"description"`
+	Technician  string    `json:"technician,omitempty"`
+	Tenant      string    `json:"tenant,omitempty"` // whose business calendar the schedule keeps to
+	NextDue     time.Time `json:"next_due"`
+	// RecurrenceDays repeats the schedule after each completion; zero means one-off
+	RecurrenceDays int       `json:"recurrence_days,omitempty"`
+	Active         bool      `json:"active"`
+	CreatedAt      time.Time `json:"created_at"`
+	// remindedFor is the due date the last reminder was sent for
+	remindedFor time.Time
+}
+
+// MaintenanceRecord is a completed maintenance visit
+type MaintenanceRecord struct {
+	ID          string    `json:"id"`
+	DeviceID    string    `json:"device_id"`
+	ScheduleID  string    `json:"schedule_id,omitempty"`
+	Technician  string    `json:"technician"`
+	PerformedAt time.Time `json:"performed_at"`
+	Outcome     string    `json:"outcome"`
+	Notes       string    `json:"notes,omitempty"`
+}
+
+// UpcomingMaintenance is a schedule falling due inside the requested window
+type UpcomingMaintenance struct {
+	MaintenanceSchedule
+	Location string  `json:"location"`
+	DueIn    float64 `json:"due_in_seconds"`
+	Overdue  bool    `json:"overdue"`
+}
+
+// MaintenanceScheduler tracks maintenance schedules and history for all devices
+type MaintenanceScheduler struct {
+	schedules map[string]*MaintenanceSchedule
+	history   map[string][]MaintenanceRecord // device ID -> records, oldest first
+	seq       int
+	mu        sync.RWMutex
+}
+
+var maintenanceScheduler *MaintenanceScheduler
+
+// calendars holds tenants' business hours and holidays; maintenance falls due and
+// reminders go out only while a tenant is open
+var calendars *calendar.Registry
+
+// NewMaintenanceScheduler creates an empty maintenance scheduler
+func NewMaintenanceScheduler() *MaintenanceScheduler {
+	return &MaintenanceScheduler{
+		schedules: make(map[string]*MaintenanceSchedule),
+		history:   make(map[string][]MaintenanceRecord),
+	}
+}
+
+// parseWindow parses look-ahead windows such as "7d", "12h" or "90m"
+func parseWindow(value string) (time.Duration, error) {
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err != nil || days <= 0 {
+			return 0, fmt.Errorf("invalid window %q", value)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	window, err := time.ParseDuration(value)
+	if err != nil || window <= 0 {
+		return 0, fmt.Errorf("invalid window %q", value)
+	}
+	return window, nil
+}
+
+// AddSchedule creates a maintenance schedule for a device
+func (ms *MaintenanceScheduler) AddSchedule(schedule MaintenanceSchedule) *MaintenanceSchedule {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.seq++
+	schedule.ID = fmt.Sprintf("MAINT-%06d", ms.seq)
+	schedule.Active = true
+	schedule.CreatedAt = time.Now()
+	ms.schedules[schedule.ID] = &schedule
+
+	copied := schedule
+	return &copied
+}
+
+// AssignTechnician sets the technician responsible for a schedule
+func (ms *MaintenanceScheduler) AssignTechnician(scheduleID, technician string) (*MaintenanceSchedule, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	schedule, exists := ms.schedules[scheduleID]
+	if !exists {
+		return nil, fmt.Errorf("maintenance schedule %s not found", scheduleID)
+	}
+	schedule.Technician = technician
+
+	copied := *schedule
+	return &copied, nil
+}
+
+// Schedule returns a copy of a schedule
+func (ms *MaintenanceScheduler) Schedule(scheduleID string) (MaintenanceSchedule, bool) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	schedule, exists := ms.schedules[scheduleID]
+	if !exists {
+		return MaintenanceSchedule{}, false
+	}
+	return *schedule, true
+}
+
+// Complete records a maintenance visit. If it fulfils a schedule, recurring schedules
+// roll forward from the completion time to the tenant's next business hours and
+// one-off schedules are closed.
+func (ms *MaintenanceScheduler) Complete(record MaintenanceRecord) (MaintenanceRecord, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if record.ScheduleID != "" {
+		schedule, exists := ms.schedules[record.ScheduleID]
+		if !exists || schedule.DeviceID != record.DeviceID {
+			return MaintenanceRecord{}, fmt.Errorf("maintenance schedule %s not found", record.ScheduleID)
+		}
+		if record.Technician == "" {
+			record.Technician = schedule.Technician
+		}
+		if schedule.RecurrenceDays > 0 {
+			due := record.PerformedAt.AddDate(0, 0, schedule.RecurrenceDays)
+			schedule.NextDue = calendars.For(schedule.Tenant).NextOpen(due)
+		} else {
+			schedule.Active = false
+		}
+	}
+
+	ms.seq++
+	record.ID = fmt.Sprintf("MREC-%06d", ms.seq)
+	ms.history[record.DeviceID] = append(ms.history[record.DeviceID], record)
+	return record, nil
+}
+
+// DeviceSchedules returns the active schedules for a device, soonest first
+func (ms *MaintenanceScheduler) DeviceSchedules(deviceID string) []MaintenanceSchedule {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	schedules := make([]MaintenanceSchedule, 0)
+	for _, schedule := range ms.schedules {
+		if schedule.DeviceID == deviceID && schedule.Active {
+			schedules = append(schedules, *schedule)
+		}
+	}
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].NextDue.Before(schedules[j].NextDue)
+	})
+	return schedules
+}
+
+// History returns completed maintenance for a device, oldest first
+func (ms *MaintenanceScheduler) History(deviceID string) []MaintenanceRecord {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	history := make([]MaintenanceRecord, len(ms.history[deviceID]))
+	copy(history, ms.history[deviceID])
+	return history
+}
+
+// NextDue returns the earliest due date across a device's active schedules
+func (ms *MaintenanceScheduler) NextDue(deviceID string) (time.Time, bool) {
+	schedules := ms.DeviceSchedules(deviceID)
+	if len(schedules) == 0 {
+		return time.Time{}, false
+	}
+	return schedules[0].NextDue, true
+}
+
+// Upcoming returns active schedules due before now+window, including overdue ones
+func (ms *MaintenanceScheduler) Upcoming(now time.Time, window time.Duration) []UpcomingMaintenance {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	cutoff := now.Add(window)
+	upcoming := make([]UpcomingMaintenance, 0)
+	for _, schedule := range ms.schedules {
+		if !schedule.Active || schedule.NextDue.After(cutoff) {
+			continue
+		}
+		upcoming = append(upcoming, UpcomingMaintenance{
+			MaintenanceSchedule: *schedule,
+			DueIn:               schedule.NextDue.Sub(now).Seconds(),
+			Overdue:             schedule.NextDue.Before(now),
+		})
+	}
+	sort.Slice(upcoming, func(i, j int) bool {
+		return upcoming[i].NextDue.Before(upcoming[j].NextDue)
+	})
+	return upcoming
+}
+
+// CancelDeviceSchedules deactivates every schedule for a device. History is kept for audit.
+func (ms *MaintenanceScheduler) CancelDeviceSchedules(deviceID string) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	for _, schedule := range ms.schedules {
+		if schedule.DeviceID == deviceID {
+			schedule.Active = false
+		}
+	}
+}
+
+// PurgeDevice deletes a device's schedules and maintenance history
+func (ms *MaintenanceScheduler) PurgeDevice(deviceID string) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	for id, schedule := range ms.schedules {
+		if schedule.DeviceID == deviceID {
+			delete(ms.schedules, id)
+		}
+	}
+	delete(ms.history, deviceID)
+}
+
+// DueReminders returns schedules due inside the lead window that have not yet been
+// reminded for their current due date, and marks them as reminded. Schedules whose
+// tenant is closed at now wait for its next business hours.
+func (ms *MaintenanceScheduler) DueReminders(now time.Time, lead time.Duration) []MaintenanceSchedule {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	due := make([]MaintenanceSchedule, 0)
+	for _, schedule := range ms.schedules {
+		if !schedule.Active || schedule.NextDue.After(now.Add(lead)) {
+			continue
+		}
+		if schedule.remindedFor.Equal(schedule.NextDue) || !calendars.For(schedule.Tenant).IsOpen(now) {
+			continue
+		}
+		schedule.remindedFor = schedule.NextDue
+		due = append(due, *schedule)
+	}
+	return due
+}
+
+// syncNextMaintenance mirrors the earliest scheduled maintenance onto the device record
+func syncNextMaintenance(device *MedicalDevice) {
+	next, ok := maintenanceScheduler.NextDue(device.ID)
+	if !ok {
+		return
+	}
+	device.mu.Lock()
+	device.NextMaintenance = next
+	device.mu.Unlock()
+}
+
+// startMaintenanceReminders periodically sends reminders for maintenance due within the lead window
+func startMaintenanceReminders(checkInterval, lead time.Duration) {
+	if checkInterval <= 0 {
+		checkInterval = time.Hour
+	}
+	log.Info().Dur("check_interval", checkInterval).Dur("lead", lead).Msg("Starting maintenance reminders")
+
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		for _, schedule := range maintenanceScheduler.DueReminders(now, lead) {
+			event := log.Info()
+			if schedule.NextDue.Before(now) {
+				event = log.Warn()
+			}
+			event.
+				Str("schedule_id", schedule.ID).
+				Str("device_id", schedule.DeviceID).
+				Str("technician", schedule.Technician).
+				Str("description", schedule.Description).
+				Time("due", schedule.NextDue).
+				Msg("Maintenance reminder")
+		}
+	}
+}
+
+// ScheduleMaintenanceHandler schedules device maintenance. A recurrence_days value
+// makes the schedule repeat after each completed visit. Times outside the tenant's
+// business hours are refused with the next opening unless after_hours is set.
+func ScheduleMaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	deviceID := chi.URLParam(r, "deviceID")
+	ctx := r.Context()
+	span := trace.SpanFromContext(ctx)
+	start := time.Now()
+
+	var req struct {
+		ScheduledTime  time.Time `json:"scheduled_time"`
+		Description    string    `json:"description"`
+		Technician     string    `json:"technician"`
+		RecurrenceDays int       `json:"recurrence_days"`
+		Tenant         string    `json:"tenant"`
+		AfterHours     bool      `json:"after_hours"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		RecordDeviceOperation("schedule_maintenance", "error", time.Since(start).Seconds())
+		return
+	}
+	if req.ScheduledTime.IsZero() || req.RecurrenceDays < 0 {
+		http.Error(w, "scheduled_time is required and recurrence_days must be non-negative", http.StatusBadRequest)
+		RecordDeviceOperation("schedule_maintenance", "error", time.Since(start).Seconds())
+		return
+	}
+
+	device, err := registry.GetDevice(deviceID)
+	if err != nil {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		RecordDeviceOperation("schedule_maintenance", "error", time.Since(start).Seconds())
+		span.RecordError(err)
+		return
+	}
+	if cal := calendars.For(req.Tenant); !req.AfterHours && !cal.IsOpen(req.ScheduledTime) {
+		next := cal.NextOpen(req.ScheduledTime)
+		http.Error(w, fmt.Sprintf("scheduled_time is outside %s business hours; next opening is %s (set after_hours to schedule anyway)",
+			cal.Tenant, next.Format(time.RFC3339)), http.StatusUnprocessableEntity)
+		RecordDeviceOperation("schedule_maintenance", "error", time.Since(start).Seconds())
+		return
+	}
+
+	if req.Description == "" {
+		req.Description = "Preventive maintenance"
+	}
+	schedule := maintenanceScheduler.AddSchedule(MaintenanceSchedule{
+		DeviceID:       deviceID,
+		Description:    req.Description,
+		Technician:     req.Technician,
+		Tenant:         req.Tenant,
+		NextDue:        req.ScheduledTime,
+		RecurrenceDays: req.RecurrenceDays,
+	})
+	syncNextMaintenance(device)
+
+	duration := time.Since(start).Seconds()
+	RecordDeviceOperation("schedule_maintenance", "success", duration)
+	span.SetAttributes(attribute.String("device.id", deviceID))
+
+	log.Info().
+		Str("device_id", deviceID).
+		Str("schedule_id", schedule.ID).
+		Time("scheduled", req.ScheduledTime).
+		Int("recurrence_days", req.RecurrenceDays).
+		Msg("Maintenance scheduled")
+
+	device.mu.RLock()
+	nextMaintenance := device.NextMaintenance
+	device.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"device_id":        deviceID,
+		"schedule":         schedule,
+		"next_maintenance": nextMaintenance,
+		"status":           "maintenance_scheduled",
+	})
+}
+
+// GetDeviceMaintenanceHandler returns a device's maintenance schedules and history
+func GetDeviceMaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	deviceID := chi.URLParam(r, "deviceID")
+	ctx := r.Context()
+	span := trace.SpanFromContext(ctx)
+	start := time.Now()
+
+	if _, err := registry.GetDevice(deviceID); err != nil {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		RecordDeviceOperation("get_maintenance", "error", time.Since(start).Seconds())
+		span.RecordError(err)
+		return
+	}
+
+	duration := time.Since(start).Seconds()
+	RecordDeviceOperation("get_maintenance", "success", duration)
+	span.SetAttributes(attribute.String("device.id", deviceID))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"device_id": deviceID,
+		"schedules": maintenanceScheduler.DeviceSchedules(deviceID),
+		"history":   maintenanceScheduler.History(deviceID),
+	})
+}
+
+// CompleteMaintenanceHandler records a completed maintenance visit
+func CompleteMaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	deviceID := chi.URLParam(r, "deviceID")
+	ctx := r.Context()
+	span := trace.SpanFromContext(ctx)
+	start := time.Now()
+
+	var record MaintenanceRecord
+	if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		RecordDeviceOperation("complete_maintenance", "error", time.Since(start).Seconds())
+		return
+	}
+
+	device, err := registry.GetDevice(deviceID)
+	if err != nil {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		RecordDeviceOperation("complete_maintenance", "error", time.Since(start).Seconds())
+		span.RecordError(err)
+		return
+	}
+
+	record.DeviceID = deviceID
+	if record.PerformedAt.IsZero() {
+		record.PerformedAt = time.Now()
+	}
+	if record.Outcome == "" {
+		record.Outcome = "completed"
+	}
+
+	record, err = maintenanceScheduler.Complete(record)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		RecordDeviceOperation("complete_maintenance", "error", time.Since(start).Seconds())
+		span.RecordError(err)
+		return
+	}
+	if record.Technician == "" {
+		log.Warn().Str("device_id", deviceID).Str("record_id", record.ID).Msg("Maintenance recorded without a technician")
+	}
+	syncNextMaintenance(device)
+
+	duration := time.Since(start).Seconds()
+	RecordDeviceOperation("complete_maintenance", "success", duration)
+	span.SetAttributes(attribute.String("device.id", deviceID))
+
+	log.Info().
+		Str("device_id", deviceID).
+		Str("record_id", record.ID).
+		Str("schedule_id", record.ScheduleID).
+		Str("technician", record.Technician).
+		Msg("Maintenance completed")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(record)
+}
+
+// AssignTechnicianHandler assigns a technician to a maintenance schedule
+func AssignTechnicianHandler(w http.ResponseWriter, r *http.Request) {
+	scheduleID := chi.URLParam(r, "scheduleID")
+	start := time.Now()
+
+	var req struct {
+		Technician string `json:"technician"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Technician == "" {
+		http.Error(w, "technician is required", http.StatusBadRequest)
+		RecordDeviceOperation("assign_technician", "error", time.Since(start).Seconds())
+		return
+	}
+
+	schedule, err := maintenanceScheduler.AssignTechnician(scheduleID, req.Technician)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		RecordDeviceOperation("assign_technician", "error", time.Since(start).Seconds())
+		return
+	}
+
+	RecordDeviceOperation("assign_technician", "success", time.Since(start).Seconds())
+	log.Info().Str("schedule_id", scheduleID).Str("technician", req.Technician).Msg("Technician assigned")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(schedule)
+}
+
+// UpcomingMaintenanceHandler lists maintenance due within ?window= (default 7d)
+func UpcomingMaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	start := time.Now()
+
+	windowParam := r.URL.Query().Get("window")
+	if windowParam == "" {
+		windowParam = "7d"
+	}
+	window, err := parseWindow(windowParam)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		RecordDeviceOperation("upcoming_maintenance", "error", time.Since(start).Seconds())
+		return
+	}
+
+	now := time.Now()
+	upcoming := maintenanceScheduler.Upcoming(now, window)
+	for i := range upcoming {
+		if device, err := registry.GetDevice(upcoming[i].DeviceID); err == nil {
+			device.mu.RLock()
+			upcoming[i].Location = device.Location
+			device.mu.RUnlock()
+		}
+	}
+
+	duration := time.Since(start).Seconds()
+	RecordDeviceOperation("upcoming_maintenance", "success", duration)
+
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.Int("maintenance.upcoming_count", len(upcoming)))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"window":       windowParam,
+		"upcoming":     upcoming,
+		"count":        len(upcoming),
+		"generated_at": now,
+	})
+}
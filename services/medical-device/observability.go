@@ -0,0 +1,37 @@
+package main
+
+import (
+	"github.com/healthcare-gitops/common/observability"
+)
+
+// observabilitySpec declares the metrics this service exports and its SLOs. Alerting
+// rules and the Grafana dashboard are generated from it with obsgen (see
+// observability/generated); keep it in step with the metrics registered here.
+var observabilitySpec = observability.Spec{
+	Service: "medical-device",
+	Team:    "clinical-engineering",
+	Metrics: []observability.Metric{
+		{Name: "medical_device_event_schema_violations_total", Type: observability.Counter, Help: "Events withheld from publishing because the payload failed schema validation", Labels: []string{"event"}, GroupBy: "event"},
+		{Name: "medical_device_alert_level", Type: observability.Gauge, Help: "Current device alert level (0=none, 1=info, 2=warning, 3=critical)", Labels: []string{"device_id", "device_type", "unit"}},
+		{Name: "medical_device_calibration_age_seconds", Type: observability.Gauge, Help: "Seconds since the device was last calibrated", Labels: []string{"device_id", "device_type", "unit"}},
+		{Name: "medical_device_next_maintenance_seconds", Type: observability.Gauge, Help: "Seconds until the device's next maintenance is due; negative when overdue", Labels: []string{"device_id", "device_type", "unit"}},
+		{Name: "medical_devices_by_status", Type: observability.Gauge, Help: "Number of active devices in each operational status", Labels: []string{"status"}, GroupBy: "status"},
+		{Name: "medical_device_active_alerts", Type: observability.Gauge, Help: "Unresolved alerts by clinical priority", Labels: []string{"priority"}, GroupBy: "priority"},
+		{Name: "medical_device_synthetic_records_reclaimed_total", Type: observability.Counter, Help: "Expired synthetic records purged by the cleanup job, by kind", Labels: []string{"kind"}, GroupBy: "kind"},
+		{Name: "medical_device_webhook_deliveries_total", Type: observability.Counter, Help: "Webhook deliveries by subscriber kind, event type and final result", Labels: []string{"kind", "event", "result"}, GroupBy: "result"},
+		{Name: "medical_device_webhook_attempts_total", Type: observability.Counter, Help: "Webhook HTTP attempts by subscriber kind and result", Labels: []string{"kind", "result"}, GroupBy: "result"},
+		{Name: "medical_device_webhook_delivery_duration_seconds", Type: observability.Histogram, Help: "Time from first attempt to final webhook delivery outcome", Labels: []string{"kind"}, GroupBy: "kind"},
+		{Name: "medical_device_webhook_disablements_total", Type: observability.Counter, Help: "Webhook subscriptions disabled after consecutive failed deliveries"},
+		{Name: "medical_device_auth_cache_lookups_total", Type: observability.Counter, Help: "Token introspection cache lookups by result", Labels: []string{"result"}, GroupBy: "result"},
+		{Name: "medical_device_circuit_breaker_state", Type: observability.Gauge, Help: "State of the circuit breaker guarding calls to a dependency: 0 closed, 1 half-open, 2 open", Labels: []string{"dependency"}, GroupBy: "dependency"},
+	},
+	SLOs: []observability.SLO{
+		{
+			Name:        "webhook-delivery",
+			Description: "Webhook events delivered to subscribers within the retry policy",
+			Objective:   0.99,
+			Metric:      "medical_device_webhook_deliveries_total",
+			ErrorFilter: `result="failure"`,
+		},
+	},
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// Replay speed bounds; speed 2 replays twice as fast as recorded
+const (
+	minReplaySpeed = 0.1
+	maxReplaySpeed = 1000.0
+)
+
+// ReplayRun tracks one replay of a capture into a target instance
+type ReplayRun struct {
+	ID         string     `json:"id"`
+	CaptureID  string     `json:"capture_id"`
+	TargetURL  string     `json:"target_url"`
+	Speed      float64    `json:"speed"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Sent       int64      `json:"sent"`
+	Failed     int64      `json:"failed"`
+	Active     bool       `json:"active"`
+	Error      string     `json:"error,omitempty"`
+	cancel     context.CancelFunc
+}
+
+// Replayer replays capture files against test instances
+type Replayer struct {
+	runs map[string]*ReplayRun
+	seq  int
+	mu   sync.Mutex
+}
+
+var replayer *Replayer
+
+// NewReplayer creates a replayer with no runs
+func NewReplayer() *Replayer {
+	return &Replayer{runs: make(map[string]*ReplayRun)}
+}
+
+// readCapture loads a capture file, checking its header
+func readCapture(path string) (CaptureHeader, []CaptureRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return CaptureHeader{}, nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var header CaptureHeader
+	if !scanner.Scan() {
+		return CaptureHeader{}, nil, fmt.Errorf("capture file is empty")
+	}
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return CaptureHeader{}, nil, fmt.Errorf("invalid capture header: %w", err)
+	}
+	if header.FormatVersion != captureFormatVersion {
+		return CaptureHeader{}, nil, fmt.Errorf("unsupported capture format version %d", header.FormatVersion)
+	}
+
+	records := make([]CaptureRecord, 0)
+	for scanner.Scan() {
+		var record CaptureRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return CaptureHeader{}, nil, fmt.Errorf("invalid capture record %d: %w", len(records)+1, err)
+		}
+		records = append(records, record)
+	}
+	return header, records, scanner.Err()
+}
+
+// Start replays a finished capture into the target base URL at the given speed
+func (rp *Replayer) Start(captureID, target string, speed float64) (ReplayRun, error) {
+	info, err := captures.Get(captureID)
+	if err != nil {
+		return ReplayRun{}, err
+	}
+	if u, err := url.Parse(target); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return ReplayRun{}, fmt.Errorf("target_url must be an absolute http or https URL")
+	}
+	if speed == 0 {
+		speed = 1
+	}
+	if speed < minReplaySpeed || speed > maxReplaySpeed {
+		return ReplayRun{}, fmt.Errorf("speed must be between %g and %g", minReplaySpeed, maxReplaySpeed)
+	}
+	_, records, err := readCapture(info.File)
+	if err != nil {
+		return ReplayRun{}, err
+	}
+
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	rp.seq++
+	ctx, cancel := context.WithCancel(context.Background())
+	run := &ReplayRun{
+		ID:        fmt.Sprintf("RPL-%06d", rp.seq),
+		CaptureID: captureID,
+		TargetURL: strings.TrimRight(target, "/"),
+		Speed:     speed,
+		StartedAt: time.Now(),
+		Active:    true,
+		cancel:    cancel,
+	}
+	rp.runs[run.ID] = run
+	go rp.replay(ctx, run, records)
+
+	log.Info().Str("replay_id", run.ID).Str("capture_id", captureID).Str("target", run.TargetURL).Float64("speed", speed).Msg("Replay started")
+	return *run, nil
+}
+
+// replay sends records to the target, preserving their recorded spacing scaled by speed
+func (rp *Replayer) replay(ctx context.Context, run *ReplayRun, records []CaptureRecord) {
+	start := time.Now()
+	var runErr error
+
+	for _, record := range records {
+		due := start.Add(time.Duration(float64(record.OffsetMillis) / run.Speed * float64(time.Millisecond)))
+		if wait := time.Until(due); wait > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(wait):
+			}
+		}
+		if ctx.Err() != nil {
+			runErr = fmt.Errorf("replay stopped")
+			break
+		}
+
+		err := sendReplayRecord(ctx, run.TargetURL, record)
+		rp.mu.Lock()
+		if err != nil {
+			run.Failed++
+		} else {
+			run.Sent++
+		}
+		rp.mu.Unlock()
+		if err != nil {
+			log.Debug().Err(err).Str("replay_id", run.ID).Str("kind", record.Kind).Msg("Replay record rejected by target")
+		}
+	}
+
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	now := time.Now()
+	run.FinishedAt = &now
+	run.Active = false
+	if runErr != nil {
+		run.Error = runErr.Error()
+	}
+	log.Info().Str("replay_id", run.ID).Int64("sent", run.Sent).Int64("failed", run.Failed).Msg("Replay finished")
+}
+
+// sendReplayRecord maps a capture record onto the target's public API
+func sendReplayRecord(ctx context.Context, target string, record CaptureRecord) error {
+	deviceURL := target + "/api/v1/devices/" + url.PathEscape(record.DeviceID)
+
+	var method, endpoint string
+	var payload interface{}
+	switch record.Kind {
+	case CaptureKindDevice:
+		method, endpoint = http.MethodPost, target+"/api/v1/devices"
+		payload = MedicalDevice{
+			ID:           record.DeviceID,
+			Type:         record.DeviceType,
+			Status:       record.Status,
+			Location:     record.Unit + " - Replay",
+			Manufacturer: "Replayed",
+		}
+	case CaptureKindMetrics:
+		method, endpoint, payload = http.MethodPost, deviceURL+"/metrics", record.Metrics
+	case CaptureKindHeartbeat:
+		method, endpoint, payload = http.MethodPost, deviceURL+"/heartbeat", nil
+	case CaptureKindStatus:
+		method, endpoint = http.MethodPatch, deviceURL
+		payload = map[string]interface{}{"status": string(record.Status)}
+	default:
+		return fmt.Errorf("unknown record kind %q", record.Kind)
+	}
+
+	var body []byte
+	if payload != nil {
+		var err error
+		if body, err = json.Marshal(payload); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "medical-device-service-replay/1.0")
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Re-registering a device that already exists on the target is expected
+	if resp.StatusCode >= 300 && !(record.Kind == CaptureKindDevice && resp.StatusCode == http.StatusConflict) {
+		return fmt.Errorf("target returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Stop cancels a running replay
+func (rp *Replayer) Stop(id string) (ReplayRun, error) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	run, ok := rp.runs[id]
+	if !ok {
+		return ReplayRun{}, fmt.Errorf("replay %s not found", id)
+	}
+	run.cancel()
+	return *run, nil
+}
+
+// Get returns a replay's progress
+func (rp *Replayer) Get(id string) (ReplayRun, error) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	run, ok := rp.runs[id]
+	if !ok {
+		return ReplayRun{}, fmt.Errorf("replay %s not found", id)
+	}
+	return *run, nil
+}
+
+// StartReplayHandler replays a capture into a test instance
+func StartReplayHandler(w http.ResponseWriter, r *http.Request) {
+	captureID := chi.URLParam(r, "captureID")
+	start := time.Now()
+
+	var req struct {
+		TargetURL string  `json:"target_url"`
+		Speed     float64 `json:"speed"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		RecordDeviceOperation("start_replay", "error", time.Since(start).Seconds())
+		return
+	}
+
+	run, err := replayer.Start(captureID, req.TargetURL, req.Speed)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		RecordDeviceOperation("start_replay", "error", time.Since(start).Seconds())
+		return
+	}
+
+	RecordDeviceOperation("start_replay", "success", time.Since(start).Seconds())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(run)
+}
+
+// GetReplayHandler reports replay progress
+func GetReplayHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "replayID")
+	start := time.Now()
+
+	run, err := replayer.Get(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		RecordDeviceOperation("get_replay", "error", time.Since(start).Seconds())
+		return
+	}
+
+	RecordDeviceOperation("get_replay", "success", time.Since(start).Seconds())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(run)
+}
+
+// StopReplayHandler cancels a running replay
+func StopReplayHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "replayID")
+	start := time.Now()
+
+	run, err := replayer.Stop(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		RecordDeviceOperation("stop_replay", "error", time.Since(start).Seconds())
+		return
+	}
+
+	RecordDeviceOperation("stop_replay", "success", time.Since(start).Seconds())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(run)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/healthcare-gitops/common/events"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog/log"
+)
+
+// Events rejected because their payload no longer matches the published schema
+var eventSchemaViolations = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "medical_device_event_schema_violations_total",
+		Help: "Events withheld from publishing because the payload failed schema validation",
+	},
+	[]string{"event"},
+)
+
+// checkEventSchema validates an outgoing payload against the shared schema registry
+// and returns the schema version it matched. Failures are logged and counted so
+// contract drift shows up before consumers break.
+func checkEventSchema(eventType string, data interface{}) (int, error) {
+	version, err := events.Default().Validate(eventType, data)
+	if err != nil {
+		eventSchemaViolations.WithLabelValues(eventType).Inc()
+		log.Error().Err(err).Str("event_type", eventType).Msg("Event payload rejected by schema registry")
+		return version, err
+	}
+	return version, nil
+}
+
+// ListSchemasHandler lists published event types and their schema versions
+func ListSchemasHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	schemas := events.Default().List()
+	RecordDeviceOperation("list_schemas", "success", time.Since(start).Seconds())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"schemas": schemas,
+		"count":   len(schemas),
+	})
+}
+
+// GetSchemaHandler returns the JSON Schema for an event type, either a specific
+// version or the latest
+func GetSchemaHandler(w http.ResponseWriter, r *http.Request) {
+	eventType := chi.URLParam(r, "eventType")
+	start := time.Now()
+
+	var schema *events.Schema
+	var err error
+	if v := chi.URLParam(r, "version"); v != "" {
+		version, convErr := strconv.Atoi(v)
+		if convErr != nil {
+			http.Error(w, "version must be an integer", http.StatusBadRequest)
+			RecordDeviceOperation("get_schema", "error", time.Since(start).Seconds())
+			return
+		}
+		schema, err = events.Default().Lookup(eventType, version)
+	} else {
+		schema, err = events.Default().Latest(eventType)
+	}
+	if errors.Is(err, events.ErrUnknownEvent) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		RecordDeviceOperation("get_schema", "error", time.Since(start).Seconds())
+		return
+	}
+
+	RecordDeviceOperation("get_schema", "success", time.Since(start).Seconds())
+
+	w.Header().Set("Content-Type", "application/schema+json")
+	json.NewEncoder(w).Encode(schema)
+}
+
+// AsyncAPIHandler serves the AsyncAPI document for every published event, generated
+// from the same schema bundle used for publish-time validation
+func AsyncAPIHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	doc := events.Default().AsyncAPI(events.AsyncAPIInfo{
+		Title:       "Medical device service events",
+		Version:     "1.0.0",
+		Description: "Events delivered to webhook subscribers and vendor service portals.",
+	})
+	RecordDeviceOperation("get_asyncapi", "success", time.Since(start).Seconds())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(doc)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/healthcare-gitops/common/config"
+	"github.com/healthcare-gitops/common/selfscan"
+)
+
+// selfScanHandler serves the security misconfiguration self-scan of handler at
+// /admin/selfscan, to callers presenting SELFSCAN_TOKEN
+func selfScanHandler(handler http.Handler) http.HandlerFunc {
+	token := config.GetEnv("SELFSCAN_TOKEN", "")
+	return selfscan.RequireToken(token, selfscan.Handler(func() selfscan.Target {
+		return selfscan.Target{
+			Service: "medical-device-service",
+			Handler: handler,
+			// Every GET route behind the admin scope, as registered in main.go
+			AdminRoutes: []string{
+				"/admin/observability/spec",
+				"/admin/selfscan",
+				"/admin/usage-stats",
+				"/compliance/status",
+				"/api/v1/decommissions/{batchID}",
+				"/api/v1/synthetic/cleanup",
+				"/api/v1/vendor-webhooks",
+				"/api/v1/webhooks",
+				"/api/v1/webhooks/{webhookID}/deliveries",
+				"/api/v1/webhooks/{webhookID}/deliveries/{deliveryID}",
+				"/api/v1/simulator/telemetry/push/{pushID}",
+				"/api/v1/simulator/scenarios",
+				"/api/v1/simulator/chaos-runs/{runID}",
+				"/api/v1/captures",
+				"/api/v1/replays/{replayID}",
+			},
+			Secrets: map[string]string{"SELFSCAN_TOKEN": token},
+		}
+	}))
+}
@@ -0,0 +1,580 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/healthcare-gitops/common/config"
+	"github.com/healthcare-gitops/common/synthetic"
+	"github.com/rs/zerolog/log"
+)
+
+// SimulatorConfig controls the built-in device load generator
+type SimulatorConfig struct {
+	DeviceCount     int          `json:"device_count"`
+	DeviceTypes     []DeviceType `json:"device_types"`
+	IntervalSeconds float64      `json:"interval_seconds"`
+	// FailureRate is the per-tick probability that a healthy device faults
+	FailureRate float64 `json:"failure_rate"`
+	// RecoveryRate is the per-tick probability that a faulted device recovers
+	RecoveryRate float64 `json:"recovery_rate"`
+	// LinkPatients attaches bedside devices to synthetic patients and emits their vitals
+	LinkPatients bool `json:"link_patients"`
+	// Cohort names the profile that weights synthetic patients' conditions
+	Cohort string `json:"cohort"`
+	// CodeSystems selects which of icd10, cpt, loinc and rxnorm are generated
+	CodeSystems []string `json:"code_systems"`
+}
+
+// SimulatorStats counts what the simulator has done since it was created
+type SimulatorStats struct {
+	Ticks            int64 `json:"ticks"`
+	MetricUpdates    int64 `json:"metric_updates"`
+	InjectedFailures int64 `json:"injected_failures"`
+	Recoveries       int64 `json:"recoveries"`
+}
+
+// allDeviceTypes is the default simulated device mix
+var allDeviceTypes = []DeviceType{
+	DeviceTypeMRI, DeviceTypeCTScanner, DeviceTypeXRay,
+	DeviceTypeECG, DeviceTypeVentilator, DeviceTypePump,
+}
+
+// Simulator generates device telemetry and failures against the registry
+type Simulator struct {
+	config  SimulatorConfig
+	stats   SimulatorStats
+	devices []string // IDs of generated devices, in creation order
+	faulted map[string]bool
+	// patients links bedside devices to synthetic patients; devices at the same
+	// location share a patient
+	patients   map[string]*SyntheticPatient
+	patientSeq int
+	// rng draws admitted patients and their readings
+	rng *rand.Rand
+	// directory holds the practitioners, locations and encounters patients are admitted under
+	directory *SyntheticDirectory
+	// silenced and storming map devices to the chaos run currently driving them
+	silenced map[string]string
+	storming map[string]string
+	runs     map[string]*ChaosRun
+	chaosSeq int
+	running  bool
+	cancel   context.CancelFunc
+	done     chan struct{}
+	mu       sync.Mutex
+}
+
+var simulator *Simulator
+
+// defaultSimulatorConfig reads simulator settings from the environment
+func defaultSimulatorConfig() SimulatorConfig {
+	cfg := SimulatorConfig{
+		DeviceCount:     config.GetEnvInt("SIMULATOR_DEVICE_COUNT", 3),
+		DeviceTypes:     allDeviceTypes,
+		IntervalSeconds: envFloat("SIMULATOR_INTERVAL_SECONDS", 10),
+		FailureRate:     envFloat("SIMULATOR_FAILURE_RATE", 0),
+		RecoveryRate:    envFloat("SIMULATOR_RECOVERY_RATE", 0.2),
+		LinkPatients:    config.GetEnvBool("SIMULATOR_LINK_PATIENTS", true),
+		Cohort:          config.GetEnv("SIMULATOR_COHORT", defaultCohort),
+		CodeSystems:     allCodeSystems,
+	}
+	if systems := config.GetEnv("SIMULATOR_CODE_SYSTEMS", ""); systems != "" {
+		cfg.CodeSystems = parseCodeSystems(systems)
+	}
+	if types := config.GetEnv("SIMULATOR_DEVICE_TYPES", ""); types != "" {
+		cfg.DeviceTypes = parseDeviceTypes(types)
+	}
+	return cfg
+}
+
+// envFloat reads a float environment variable, falling back on absent or bad values
+func envFloat(key string, defaultValue float64) float64 {
+	value, err := strconv.ParseFloat(config.GetEnv(key, ""), 64)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// parseDeviceTypes parses a comma-separated device type list
+func parseDeviceTypes(value string) []DeviceType {
+	types := make([]DeviceType, 0)
+	for _, t := range strings.Split(value, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, DeviceType(t))
+		}
+	}
+	return types
+}
+
+// registerSimulatorFlags binds command-line flags that override the environment
+func registerSimulatorFlags(fs *flag.FlagSet, cfg *SimulatorConfig) *string {
+	fs.IntVar(&cfg.DeviceCount, "sim-devices", cfg.DeviceCount, "number of simulated devices")
+	fs.Float64Var(&cfg.IntervalSeconds, "sim-interval", cfg.IntervalSeconds, "seconds between simulated metric updates")
+	fs.Float64Var(&cfg.FailureRate, "sim-failure-rate", cfg.FailureRate, "per-tick probability of injecting a device fault")
+	fs.Float64Var(&cfg.RecoveryRate, "sim-recovery-rate", cfg.RecoveryRate, "per-tick probability of a faulted device recovering")
+	fs.BoolVar(&cfg.LinkPatients, "sim-link-patients", cfg.LinkPatients, "link bedside devices to synthetic patients")
+	fs.StringVar(&cfg.Cohort, "sim-cohort", cfg.Cohort, "cohort profile weighting synthetic patient conditions")
+	fs.Func("sim-code-systems", "comma-separated code systems to generate (icd10,cpt,loinc,rxnorm)", func(value string) error {
+		cfg.CodeSystems = parseCodeSystems(value)
+		return nil
+	})
+	return fs.String("sim-types", "", "comma-separated device types to simulate")
+}
+
+// validate checks the configuration is usable
+func (c SimulatorConfig) validate() error {
+	if c.DeviceCount < 0 || c.DeviceCount > 10000 {
+		return fmt.Errorf("device_count must be between 0 and 10000")
+	}
+	if c.IntervalSeconds < 0.1 {
+		return fmt.Errorf("interval_seconds must be at least 0.1")
+	}
+	if c.FailureRate < 0 || c.FailureRate > 1 || c.RecoveryRate < 0 || c.RecoveryRate > 1 {
+		return fmt.Errorf("failure_rate and recovery_rate must be between 0 and 1")
+	}
+	if len(c.DeviceTypes) == 0 {
+		return fmt.Errorf("device_types must not be empty")
+	}
+	for _, t := range c.DeviceTypes {
+		if !validDeviceTypes[t] {
+			return fmt.Errorf("unsupported device type %q", t)
+		}
+	}
+	return validateCoding(c.Cohort, c.CodeSystems)
+}
+
+// NewSimulator creates a stopped simulator
+func NewSimulator(cfg SimulatorConfig) (*Simulator, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return &Simulator{
+		config:    cfg,
+		faulted:   make(map[string]bool),
+		patients:  make(map[string]*SyntheticPatient),
+		rng:       rand.New(rand.NewSource(time.Now().UnixNano())),
+		directory: newSyntheticDirectory(),
+		silenced:  make(map[string]string),
+		storming:  make(map[string]string),
+		runs:      make(map[string]*ChaosRun),
+	}, nil
+}
+
+// sampleDevices are the canonical demo devices, used before any generated ones
+func sampleDevices() []*MedicalDevice {
+	return []*MedicalDevice{
+		{
+			ID:              "MRI-001",
+			Type:            DeviceTypeMRI,
+			Status:          StatusOperational,
+			Location:        "Radiology Department - Room 101",
+			SerialNumber:    "MRI-2024-001",
+			Manufacturer:    "Siemens Healthineers",
+			Model:           "MAGNETOM Vida",
+			FirmwareVersion: "VA30A",
+			LastCalibration: time.Now().Add(-24 * time.Hour),
+			NextMaintenance: time.Now().Add(30 * 24 * time.Hour),
+			UpTime:          86400,
+			ErrorCount:      0,
+			AlertLevel:      "none",
+		},
+		{
+			ID:              "ECG-002",
+			Type:            DeviceTypeECG,
+			Status:          StatusOperational,
+			Location:        "Cardiology - ICU Floor 3",
+			SerialNumber:    "ECG-2024-002",
+			Manufacturer:    "GE Healthcare",
+			Model:           "MAC 2000",
+			FirmwareVersion: "v3.2.1",
+			LastCalibration: time.Now().Add(-12 * time.Hour),
+			NextMaintenance: time.Now().Add(15 * 24 * time.Hour),
+			UpTime:          43200,
+			ErrorCount:      0,
+			AlertLevel:      "none",
+		},
+		{
+			ID:              "VENT-003",
+			Type:            DeviceTypeVentilator,
+			Status:          StatusOperational,
+			Location:        "ICU - Room 305",
+			SerialNumber:    "VENT-2024-003",
+			Manufacturer:    "Dräger",
+			Model:           "Evita V800",
+			FirmwareVersion: "v2.1.5",
+			LastCalibration: time.Now().Add(-6 * time.Hour),
+			NextMaintenance: time.Now().Add(7 * 24 * time.Hour),
+			UpTime:          21600,
+			ErrorCount:      0,
+			AlertLevel:      "none",
+		},
+	}
+}
+
+// simulatedLocations spreads generated devices across care units
+var simulatedLocations = []string{"ICU", "Emergency", "Cardiology", "Radiology Department", "Surgery", "Ward B"}
+
+// devicesPerBed groups consecutive generated devices at the same bedside
+const devicesPerBed = 3
+
+// generatedDevice builds the n-th (0-based) generated device
+func generatedDevice(n int, deviceType DeviceType) *MedicalDevice {
+	bed := n / devicesPerBed
+	return &MedicalDevice{
+		ID:              fmt.Sprintf("SIM-%s-%04d", strings.ToUpper(strings.ReplaceAll(string(deviceType), "_", "-")), n+1),
+		Type:            deviceType,
+		Status:          StatusOperational,
+		Location:        fmt.Sprintf("%s - Bed %d", simulatedLocations[bed%len(simulatedLocations)], bed/len(simulatedLocations)+1),
+		SerialNumber:    fmt.Sprintf("SIM-%06d", n+1),
+		Manufacturer:    "Simulated Devices Inc.",
+		Model:           "SimBox " + string(deviceType),
+		FirmwareVersion: "v1.0.0",
+		LastCalibration: time.Now().Add(-time.Duration(rand.Intn(90*24)) * time.Hour),
+		NextMaintenance: time.Now().Add(time.Duration(rand.Intn(60*24)) * time.Hour),
+		AlertLevel:      "none",
+	}
+}
+
+// randomMetrics produces plausible operational metrics
+func randomMetrics() *DeviceMetrics {
+	return &DeviceMetrics{
+		Temperature:      22.0 + rand.Float64()*3.0,
+		PowerConsumption: 500 + rand.Float64()*500,
+		CPUUtilization:   30 + rand.Float64()*40,
+		MemoryUsage:      40 + rand.Float64()*30,
+		NetworkLatency:   5 + rand.Float64()*10,
+		LastUpdated:      time.Now(),
+	}
+}
+
+// reconcileDevices registers or removes simulated devices to match the configured count.
+// Callers must hold s.mu.
+func (s *Simulator) reconcileDevices() {
+	samples := sampleDevices()
+	for len(s.devices) < s.config.DeviceCount {
+		n := len(s.devices)
+		var device *MedicalDevice
+		if n < len(samples) {
+			device = samples[n]
+		} else {
+			device = generatedDevice(n, s.config.DeviceTypes[n%len(s.config.DeviceTypes)])
+		}
+
+		// The simulator removes its own devices, so they carry no expiry
+		device.Marker = synthetic.Marker{Synthetic: true, Origin: "simulator"}
+		if err := registry.RegisterDevice(device); err != nil {
+			log.Error().Err(err).Str("device_id", device.ID).Msg("Failed to register simulated device")
+		} else {
+			registry.UpdateMetrics(device.ID, randomMetrics())
+			log.Debug().Str("device_id", device.ID).Str("type", string(device.Type)).Msg("Simulated device registered")
+		}
+		s.devices = append(s.devices, device.ID)
+
+		if s.config.LinkPatients && patientLinkedTypes[device.Type] {
+			s.linkPatient(device.ID, device.Location)
+		}
+	}
+
+	for len(s.devices) > s.config.DeviceCount {
+		last := s.devices[len(s.devices)-1]
+		// Simulated devices carry no audit value, so they are purged rather than archived
+		registry.PurgeDevice(last)
+		delete(s.faulted, last)
+		if patient, ok := s.patients[last]; ok {
+			delete(s.patients, last)
+			if !s.patientLinked(patient) {
+				s.directory.discharge(patient.ID, time.Now())
+			}
+		}
+		delete(s.silenced, last)
+		delete(s.storming, last)
+		telemetry.Remove(last)
+		s.devices = s.devices[:len(s.devices)-1]
+	}
+}
+
+// linkPatient attaches a device to the patient already at its location, or admits a
+// new synthetic patient under an encounter at the device's care unit. Callers must
+// hold s.mu.
+func (s *Simulator) linkPatient(deviceID, location string) {
+	for otherID, patient := range s.patients {
+		other, err := registry.GetDevice(otherID)
+		if err != nil {
+			continue
+		}
+		other.mu.RLock()
+		sameBed := other.Location == location
+		other.mu.RUnlock()
+		if sameBed {
+			s.patients[deviceID] = patient
+			return
+		}
+	}
+
+	s.patientSeq++
+	cohort, _ := cohortProfile(s.config.Cohort)
+	patient := newSyntheticPatient(s.rng, s.patientSeq, cohort, s.config.CodeSystems)
+	s.patients[deviceID] = patient
+	s.directory.admit(patient, location, time.Now())
+}
+
+// patientLinked reports whether any device is still attached to a patient. Callers
+// must hold s.mu.
+func (s *Simulator) patientLinked(patient *SyntheticPatient) bool {
+	for _, other := range s.patients {
+		if other == patient {
+			return true
+		}
+	}
+	return false
+}
+
+// PatientFor returns the synthetic patient linked to a device, or nil
+func (s *Simulator) PatientFor(deviceID string) *SyntheticPatient {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	patient, ok := s.patients[deviceID]
+	if !ok {
+		return nil
+	}
+	copied := *patient
+	return &copied
+}
+
+// PatientLinks lists every synthetic patient with their linked devices
+func (s *Simulator) PatientLinks() []PatientLink {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	byPatient := make(map[*SyntheticPatient][]string)
+	for deviceID, patient := range s.patients {
+		byPatient[patient] = append(byPatient[patient], deviceID)
+	}
+
+	links := make([]PatientLink, 0, len(byPatient))
+	for patient, deviceIDs := range byPatient {
+		sort.Strings(deviceIDs)
+		link := PatientLink{Patient: *patient, DeviceIDs: deviceIDs}
+		if enc, ok := s.directory.encounters[patient.ID]; ok {
+			link.EncounterID = enc.ID
+		}
+		links = append(links, link)
+	}
+	sortPatientLinks(links)
+	return links
+}
+
+// tick pushes one round of metrics and failure injection
+func (s *Simulator) tick(interval time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stats.Ticks++
+	for _, id := range s.devices {
+		// Devices cut off by a chaos run send nothing at all
+		if _, ok := s.silenced[id]; ok {
+			continue
+		}
+		device, err := registry.GetDevice(id)
+		if err != nil {
+			continue
+		}
+
+		metrics := randomMetrics()
+		if registry.UpdateMetrics(id, metrics) == nil {
+			s.stats.MetricUpdates++
+		}
+		registry.RecordHeartbeat(id, metrics.LastUpdated)
+
+		device.mu.Lock()
+		device.UpTime += int64(interval.Seconds())
+		errorCount := device.ErrorCount
+		deviceType := device.Type
+		device.mu.Unlock()
+
+		// Faulted devices stop producing clinical data, as a real monitor would
+		if patient, ok := s.patients[id]; ok && !s.faulted[id] {
+			telemetry.Append(patient.reading(s.rng, id, deviceType, metrics.LastUpdated))
+		}
+
+		switch {
+		case s.storming[id] != "":
+			s.stormStep(id)
+		case !s.faulted[id] && rand.Float64() < s.config.FailureRate:
+			status := StatusError
+			if rand.Intn(2) == 0 {
+				status = StatusDegraded
+			}
+			registry.PatchDevice(id, map[string]interface{}{
+				"status":      string(status),
+				"error_count": float64(errorCount + 1),
+			})
+			s.faulted[id] = true
+			s.stats.InjectedFailures++
+		case s.faulted[id] && rand.Float64() < s.config.RecoveryRate:
+			registry.PatchDevice(id, map[string]interface{}{"status": string(StatusOperational)})
+			delete(s.faulted, id)
+			s.stats.Recoveries++
+		}
+	}
+}
+
+// Start registers simulated devices and begins generating telemetry
+func (s *Simulator) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.running {
+		return
+	}
+	s.reconcileDevices()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+	s.running = true
+
+	interval := time.Duration(s.config.IntervalSeconds * float64(time.Second))
+	log.Info().
+		Int("devices", s.config.DeviceCount).
+		Dur("interval", interval).
+		Float64("failure_rate", s.config.FailureRate).
+		Msg("Starting device simulator")
+
+	go func(done chan struct{}) {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.tick(interval)
+			}
+		}
+	}(s.done)
+}
+
+// Stop halts telemetry generation; simulated devices stay registered
+func (s *Simulator) Stop() {
+	s.mu.Lock()
+	if !s.running {
+		s.mu.Unlock()
+		return
+	}
+	s.cancel()
+	done := s.done
+	s.running = false
+	s.mu.Unlock()
+
+	<-done
+	log.Info().Msg("Device simulator stopped")
+}
+
+// Reconfigure applies a new configuration, restarting the simulator if it was running
+func (s *Simulator) Reconfigure(cfg SimulatorConfig) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	wasRunning := s.running
+	s.mu.Unlock()
+
+	s.Stop()
+
+	s.mu.Lock()
+	s.config = cfg
+	s.reconcileDevices()
+	s.mu.Unlock()
+
+	if wasRunning {
+		s.Start()
+	}
+	return nil
+}
+
+// Status returns the current configuration, run state and counters
+func (s *Simulator) Status() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return map[string]interface{}{
+		"running":         s.running,
+		"config":          s.config,
+		"stats":           s.stats,
+		"simulated_count": len(s.devices),
+		"faulted_count":   len(s.faulted),
+		"chaos_devices":   len(s.silenced) + len(s.storming),
+	}
+}
+
+// GetSimulatorHandler reports simulator configuration and counters
+func GetSimulatorHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	status := simulator.Status()
+	RecordDeviceOperation("simulator_status", "success", time.Since(start).Seconds())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// UpdateSimulatorHandler replaces the simulator configuration. Omitted fields keep
+// their current values.
+func UpdateSimulatorHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	simulator.mu.Lock()
+	cfg := simulator.config
+	simulator.mu.Unlock()
+
+	if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		RecordDeviceOperation("simulator_update", "error", time.Since(start).Seconds())
+		return
+	}
+	if err := simulator.Reconfigure(cfg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		RecordDeviceOperation("simulator_update", "error", time.Since(start).Seconds())
+		return
+	}
+
+	RecordDeviceOperation("simulator_update", "success", time.Since(start).Seconds())
+	log.Info().Int("devices", cfg.DeviceCount).Float64("failure_rate", cfg.FailureRate).Msg("Simulator reconfigured")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(simulator.Status())
+}
+
+// StartSimulatorHandler starts the simulator
+func StartSimulatorHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	simulator.Start()
+	RecordDeviceOperation("simulator_start", "success", time.Since(start).Seconds())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(simulator.Status())
+}
+
+// StopSimulatorHandler stops the simulator
+func StopSimulatorHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	simulator.Stop()
+	RecordDeviceOperation("simulator_stop", "success", time.Since(start).Seconds())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(simulator.Status())
+}
@@ -0,0 +1,509 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// Snapshot triggers
+const (
+	SnapshotScheduled = "scheduled"
+	SnapshotOnDemand  = "on_demand"
+)
+
+// snapshotCurrent names the live device state in a diff request
+const snapshotCurrent = "current"
+
+// volatileSnapshotFields change on every heartbeat and are left out of diffs unless
+// asked for, so a review shows configuration changes rather than noise
+var volatileSnapshotFields = map[string]bool{
+	"uptime_seconds": true,
+	"last_heartbeat": true,
+}
+
+var (
+	errSnapshotNotFound = errors.New("snapshot not found")
+	errSnapshotMismatch = errors.New("snapshots belong to different devices")
+)
+
+// DeviceSnapshot is an immutable point-in-time copy of a device record. State holds
+// the device's fields together with its active maintenance schedules and latest
+// calibration, flattened to dotted field names. Each snapshot's hash covers its
+// content and the previous snapshot's hash for the same device, so edits to or
+// removal of earlier snapshots are detectable.
+type DeviceSnapshot struct {
+	ID           string                 `json:"id"`
+	DeviceID     string                 `json:"device_id"`
+	TakenAt      time.Time              `json:"taken_at"`
+	Trigger      string                 `json:"trigger"`
+	TakenBy      string                 `json:"taken_by,omitempty"`
+	Reason       string                 `json:"reason,omitempty"`
+	State        map[string]interface{} `json:"state"`
+	PreviousHash string                 `json:"previous_hash,omitempty"`
+	Hash         string                 `json:"hash"`
+}
+
+// FieldChange is one difference between two snapshots
+type FieldChange struct {
+	Field  string      `json:"field"`
+	Change string      `json:"change"` // added, removed or modified
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+// SnapshotDiff compares two states of a device
+type SnapshotDiff struct {
+	DeviceID string        `json:"device_id"`
+	From     string        `json:"from"`
+	FromTime time.Time     `json:"from_taken_at"`
+	To       string        `json:"to"`
+	ToTime   time.Time     `json:"to_taken_at"`
+	Changes  []FieldChange `json:"changes"`
+	// Summary describes each change in a sentence, for change review records
+	Summary []string `json:"summary"`
+}
+
+// SnapshotStore keeps device snapshots. Snapshots are append-only; they are removed
+// only when their device is purged.
+type SnapshotStore struct {
+	snapshots map[string][]DeviceSnapshot // device ID -> snapshots, oldest first
+	seq       int
+	mu        sync.RWMutex
+}
+
+var snapshots *SnapshotStore
+
+// NewSnapshotStore creates an empty snapshot store
+func NewSnapshotStore() *SnapshotStore {
+	return &SnapshotStore{snapshots: make(map[string][]DeviceSnapshot)}
+}
+
+// lookupDevice finds an active or decommissioned device
+func lookupDevice(deviceID string) (*MedicalDevice, error) {
+	device, err := registry.GetDevice(deviceID)
+	if err != nil {
+		device, err = registry.GetDecommissionedDevice(deviceID)
+	}
+	return device, err
+}
+
+// captureDeviceState flattens a device record, its active maintenance schedules and
+// its latest calibration into a field map
+func captureDeviceState(device *MedicalDevice) (map[string]interface{}, error) {
+	device.mu.RLock()
+	record, err := json.Marshal(device)
+	device.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	state := make(map[string]interface{})
+	if err := json.Unmarshal(record, &state); err != nil {
+		return nil, err
+	}
+
+	if maintenanceScheduler != nil {
+		for _, schedule := range maintenanceScheduler.DeviceSchedules(device.ID) {
+			prefix := "maintenance." + schedule.ID + "."
+			state[prefix+"description"] = schedule.Description
+			state[prefix+"next_due"] = schedule.NextDue.UTC().Format(time.RFC3339)
+			if schedule.Technician != "" {
+				state[prefix+"technician"] = schedule.Technician
+			}
+			if schedule.RecurrenceDays > 0 {
+				state[prefix+"recurrence_days"] = float64(schedule.RecurrenceDays)
+			}
+		}
+	}
+	if calibrations != nil {
+		if history := calibrations.History(device.ID); len(history) > 0 {
+			latest := history[len(history)-1].Certificate
+			state["calibration.certificate_id"] = latest.CertificateID
+			state["calibration.result"] = latest.Result
+			state["calibration.performed_at"] = latest.PerformedAt.UTC().Format(time.RFC3339)
+			if !latest.ValidUntil.IsZero() {
+				state["calibration.valid_until"] = latest.ValidUntil.UTC().Format(time.RFC3339)
+			}
+		}
+	}
+	return state, nil
+}
+
+// snapshotHash chains a snapshot's content to the previous snapshot's hash
+func snapshotHash(snapshot DeviceSnapshot) string {
+	content, _ := json.Marshal(struct {
+		ID       string                 `json:"id"`
+		DeviceID string                 `json:"device_id"`
+		TakenAt  time.Time              `json:"taken_at"`
+		Trigger  string                 `json:"trigger"`
+		TakenBy  string                 `json:"taken_by"`
+		Reason   string                 `json:"reason"`
+		State    map[string]interface{} `json:"state"`
+	}{snapshot.ID, snapshot.DeviceID, snapshot.TakenAt, snapshot.Trigger, snapshot.TakenBy, snapshot.Reason, snapshot.State})
+	sum := sha256.Sum256(append([]byte(snapshot.PreviousHash+"\n"), content...))
+	return hex.EncodeToString(sum[:])
+}
+
+// statesEqual reports whether two flattened states hold the same fields and values
+func statesEqual(a, b map[string]interface{}) bool {
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	return string(x) == string(y)
+}
+
+// Take records a snapshot of a device. A scheduled snapshot is skipped, returning
+// false, when nothing has changed since the device's last snapshot; on-demand
+// snapshots are always recorded.
+func (ss *SnapshotStore) Take(device *MedicalDevice, trigger, takenBy, reason string, now time.Time) (DeviceSnapshot, bool, error) {
+	state, err := captureDeviceState(device)
+	if err != nil {
+		return DeviceSnapshot{}, false, err
+	}
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	history := ss.snapshots[device.ID]
+	snapshot := DeviceSnapshot{
+		DeviceID: device.ID,
+		TakenAt:  now.UTC(),
+		Trigger:  trigger,
+		TakenBy:  takenBy,
+		Reason:   reason,
+		State:    state,
+	}
+	if len(history) > 0 {
+		last := history[len(history)-1]
+		if trigger == SnapshotScheduled && statesEqual(withoutVolatile(last.State), withoutVolatile(state)) {
+			return last, false, nil
+		}
+		snapshot.PreviousHash = last.Hash
+	}
+
+	ss.seq++
+	snapshot.ID = fmt.Sprintf("SNAP-%s-%06d", snapshot.TakenAt.Format("20060102"), ss.seq)
+	snapshot.Hash = snapshotHash(snapshot)
+	ss.snapshots[device.ID] = append(history, snapshot)
+	return snapshot, true, nil
+}
+
+// List returns a device's snapshots, oldest first
+func (ss *SnapshotStore) List(deviceID string) []DeviceSnapshot {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	history := make([]DeviceSnapshot, len(ss.snapshots[deviceID]))
+	copy(history, ss.snapshots[deviceID])
+	return history
+}
+
+// Get returns a snapshot by ID
+func (ss *SnapshotStore) Get(snapshotID string) (DeviceSnapshot, error) {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	for _, history := range ss.snapshots {
+		for _, snapshot := range history {
+			if snapshot.ID == snapshotID {
+				return snapshot, nil
+			}
+		}
+	}
+	return DeviceSnapshot{}, fmt.Errorf("%w: %s", errSnapshotNotFound, snapshotID)
+}
+
+// Verify recomputes a device's hash chain and returns the ID of the first snapshot
+// that does not match, or "" when the chain is intact
+func (ss *SnapshotStore) Verify(deviceID string) string {
+	previous := ""
+	for _, snapshot := range ss.List(deviceID) {
+		if snapshot.PreviousHash != previous || snapshotHash(snapshot) != snapshot.Hash {
+			return snapshot.ID
+		}
+		previous = snapshot.Hash
+	}
+	return ""
+}
+
+// PurgeDevice deletes a device's snapshots
+func (ss *SnapshotStore) PurgeDevice(deviceID string) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	delete(ss.snapshots, deviceID)
+}
+
+// TakeAll snapshots every active device on schedule and returns how many were recorded
+func (ss *SnapshotStore) TakeAll(now time.Time) int {
+	taken := 0
+	for _, device := range registry.ListDevices() {
+		_, recorded, err := ss.Take(device, SnapshotScheduled, "", "", now)
+		if err != nil {
+			log.Error().Err(err).Str("device_id", device.ID).Msg("Failed to snapshot device")
+			continue
+		}
+		if recorded {
+			taken++
+		}
+	}
+	return taken
+}
+
+// withoutVolatile copies a state without its volatile fields
+func withoutVolatile(state map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(state))
+	for field, value := range state {
+		if !volatileSnapshotFields[field] {
+			out[field] = value
+		}
+	}
+	return out
+}
+
+// diffStates lists the field changes from one state to another, ordered by field
+func diffStates(from, to map[string]interface{}) []FieldChange {
+	fields := make(map[string]bool, len(from)+len(to))
+	for field := range from {
+		fields[field] = true
+	}
+	for field := range to {
+		fields[field] = true
+	}
+	names := make([]string, 0, len(fields))
+	for field := range fields {
+		names = append(names, field)
+	}
+	sort.Strings(names)
+
+	changes := make([]FieldChange, 0)
+	for _, field := range names {
+		before, hadBefore := from[field]
+		after, hasAfter := to[field]
+		switch {
+		case !hadBefore:
+			changes = append(changes, FieldChange{Field: field, Change: "added", After: after})
+		case !hasAfter:
+			changes = append(changes, FieldChange{Field: field, Change: "removed", Before: before})
+		case !statesEqual(map[string]interface{}{"v": before}, map[string]interface{}{"v": after}):
+			changes = append(changes, FieldChange{Field: field, Change: "modified", Before: before, After: after})
+		}
+	}
+	return changes
+}
+
+// describeChange renders a field change as a sentence
+func describeChange(change FieldChange) string {
+	label := change.Field
+	switch change.Change {
+	case "added":
+		return fmt.Sprintf("%s set to %s", label, formatSnapshotValue(change.After))
+	case "removed":
+		return fmt.Sprintf("%s removed (was %s)", label, formatSnapshotValue(change.Before))
+	default:
+		return fmt.Sprintf("%s changed from %s to %s", label, formatSnapshotValue(change.Before), formatSnapshotValue(change.After))
+	}
+}
+
+func formatSnapshotValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "none"
+	case string:
+		if v == "" {
+			return `""`
+		}
+		return v
+	default:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	}
+}
+
+// Diff compares two snapshots, or a snapshot and the device's live state when either
+// ID is "current". Volatile fields are compared only when includeVolatile is set.
+func (ss *SnapshotStore) Diff(deviceID, fromID, toID string, includeVolatile bool, now time.Time) (SnapshotDiff, error) {
+	resolve := func(id string) (DeviceSnapshot, error) {
+		if id == snapshotCurrent {
+			device, err := lookupDevice(deviceID)
+			if err != nil {
+				return DeviceSnapshot{}, err
+			}
+			state, err := captureDeviceState(device)
+			if err != nil {
+				return DeviceSnapshot{}, err
+			}
+			return DeviceSnapshot{ID: snapshotCurrent, DeviceID: deviceID, TakenAt: now.UTC(), State: state}, nil
+		}
+		snapshot, err := ss.Get(id)
+		if err != nil {
+			return DeviceSnapshot{}, err
+		}
+		if snapshot.DeviceID != deviceID {
+			return DeviceSnapshot{}, fmt.Errorf("%w: %s is a snapshot of %s", errSnapshotMismatch, id, snapshot.DeviceID)
+		}
+		return snapshot, nil
+	}
+
+	from, err := resolve(fromID)
+	if err != nil {
+		return SnapshotDiff{}, err
+	}
+	to, err := resolve(toID)
+	if err != nil {
+		return SnapshotDiff{}, err
+	}
+
+	fromState, toState := from.State, to.State
+	if !includeVolatile {
+		fromState, toState = withoutVolatile(fromState), withoutVolatile(toState)
+	}
+	diff := SnapshotDiff{
+		DeviceID: deviceID,
+		From:     from.ID,
+		FromTime: from.TakenAt,
+		To:       to.ID,
+		ToTime:   to.TakenAt,
+		Changes:  diffStates(fromState, toState),
+	}
+	diff.Summary = make([]string, 0, len(diff.Changes))
+	for _, change := range diff.Changes {
+		diff.Summary = append(diff.Summary, describeChange(change))
+	}
+	return diff, nil
+}
+
+// startSnapshotScheduler snapshots every device on an interval
+func startSnapshotScheduler(interval time.Duration) {
+	if interval <= 0 {
+		interval = 24 * time.Hour
+	}
+	log.Info().Dur("interval", interval).Msg("Starting device snapshot scheduler")
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		start := time.Now()
+		taken := snapshots.TakeAll(now)
+		RecordDeviceOperation("scheduled_snapshot", "success", time.Since(start).Seconds())
+		if taken > 0 {
+			log.Info().Int("snapshots", taken).Msg("Recorded scheduled device snapshots")
+		}
+	}
+}
+
+// TakeSnapshotHandler records an on-demand snapshot of a device. The optional JSON
+// body carries taken_by and reason.
+func TakeSnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	deviceID := chi.URLParam(r, "deviceID")
+
+	var req struct {
+		TakenBy string `json:"taken_by"`
+		Reason  string `json:"reason"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			RecordDeviceOperation("snapshot", "error", time.Since(start).Seconds())
+			return
+		}
+	}
+
+	device, err := lookupDevice(deviceID)
+	if err != nil {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		RecordDeviceOperation("snapshot", "error", time.Since(start).Seconds())
+		return
+	}
+	snapshot, _, err := snapshots.Take(device, SnapshotOnDemand, req.TakenBy, req.Reason, time.Now())
+	if err != nil {
+		log.Error().Err(err).Str("device_id", deviceID).Msg("Failed to snapshot device")
+		http.Error(w, "Failed to snapshot device", http.StatusInternalServerError)
+		RecordDeviceOperation("snapshot", "error", time.Since(start).Seconds())
+		return
+	}
+
+	RecordDeviceOperation("snapshot", "success", time.Since(start).Seconds())
+	log.Info().Str("device_id", deviceID).Str("snapshot_id", snapshot.ID).Str("taken_by", req.TakenBy).Msg("Device snapshot taken")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(snapshot)
+}
+
+// ListSnapshotsHandler lists a device's snapshots, oldest first, and reports whether
+// their hash chain is intact
+func ListSnapshotsHandler(w http.ResponseWriter, r *http.Request) {
+	deviceID := chi.URLParam(r, "deviceID")
+	history := snapshots.List(deviceID)
+	if len(history) == 0 {
+		if _, err := lookupDevice(deviceID); err != nil {
+			http.Error(w, "Device not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	response := map[string]interface{}{
+		"device_id":      deviceID,
+		"snapshots":      history,
+		"count":          len(history),
+		"chain_verified": true,
+	}
+	if broken := snapshots.Verify(deviceID); broken != "" {
+		log.Error().Str("device_id", deviceID).Str("snapshot_id", broken).Msg("Device snapshot hash chain does not verify")
+		response["chain_verified"] = false
+		response["chain_broken_at"] = broken
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetSnapshotHandler returns one snapshot
+func GetSnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	snapshot, err := snapshots.Get(chi.URLParam(r, "snapshotID"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshot)
+}
+
+// DiffSnapshotsHandler compares two snapshots of a device given as ?from= and ?to=;
+// either may be "current" for the live record. Heartbeat-driven fields are ignored
+// unless ?include_volatile=true.
+func DiffSnapshotsHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	deviceID := chi.URLParam(r, "deviceID")
+	query := r.URL.Query()
+	fromID, toID := query.Get("from"), query.Get("to")
+	if fromID == "" || toID == "" {
+		http.Error(w, "from and to are required", http.StatusBadRequest)
+		RecordDeviceOperation("snapshot_diff", "error", time.Since(start).Seconds())
+		return
+	}
+
+	diff, err := snapshots.Diff(deviceID, fromID, toID, query.Get("include_volatile") == "true", time.Now())
+	if err != nil {
+		status := http.StatusNotFound
+		if errors.Is(err, errSnapshotMismatch) {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), status)
+		RecordDeviceOperation("snapshot_diff", "error", time.Since(start).Seconds())
+		return
+	}
+
+	RecordDeviceOperation("snapshot_diff", "success", time.Since(start).Seconds())
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(diff)
+}
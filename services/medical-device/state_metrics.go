@@ -0,0 +1,107 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// alertLevelValues encodes device alert levels as gauge values so alert rules can
+// compare thresholds, e.g. medical_device_alert_level >= 3 for critical
+var alertLevelValues = map[string]float64{
+	AlertLevelNone:     0,
+	AlertLevelInfo:     1,
+	AlertLevelWarning:  2,
+	AlertLevelCritical: 3,
+}
+
+var (
+	deviceAlertLevelDesc = prometheus.NewDesc(
+		"medical_device_alert_level",
+		"Current device alert level (0=none, 1=info, 2=warning, 3=critical)",
+		[]string{"device_id", "device_type", "unit"}, nil,
+	)
+	deviceCalibrationAgeDesc = prometheus.NewDesc(
+		"medical_device_calibration_age_seconds",
+		"Seconds since the device was last calibrated",
+		[]string{"device_id", "device_type", "unit"}, nil,
+	)
+	deviceNextMaintenanceDesc = prometheus.NewDesc(
+		"medical_device_next_maintenance_seconds",
+		"Seconds until the device's next maintenance is due; negative when overdue",
+		[]string{"device_id", "device_type", "unit"}, nil,
+	)
+	devicesByStatusDesc = prometheus.NewDesc(
+		"medical_devices_by_status",
+		"Number of active devices in each operational status",
+		[]string{"status"}, nil,
+	)
+	activeAlertsDesc = prometheus.NewDesc(
+		"medical_device_active_alerts",
+		"Unresolved alerts by clinical priority",
+		[]string{"priority"}, nil,
+	)
+)
+
+// deviceStateCollector exports per-device alert, calibration and maintenance state.
+// Values are read from the registry on every scrape, so ages stay current between
+// device updates and decommissioned devices drop out without stale series.
+type deviceStateCollector struct{}
+
+func init() {
+	prometheus.MustRegister(deviceStateCollector{})
+}
+
+// Describe implements prometheus.Collector
+func (deviceStateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- deviceAlertLevelDesc
+	ch <- deviceCalibrationAgeDesc
+	ch <- deviceNextMaintenanceDesc
+	ch <- devicesByStatusDesc
+	ch <- activeAlertsDesc
+}
+
+// Collect implements prometheus.Collector
+func (deviceStateCollector) Collect(ch chan<- prometheus.Metric) {
+	if registry == nil {
+		return
+	}
+	now := time.Now()
+
+	byStatus := map[DeviceStatus]int{
+		StatusOperational: 0,
+		StatusDegraded:    0,
+		StatusOffline:     0,
+		StatusMaintenance: 0,
+		StatusError:       0,
+	}
+	for _, device := range registry.ListDevices() {
+		device.mu.RLock()
+		labels := []string{device.ID, string(device.Type), unitFromLocation(device.Location)}
+		byStatus[device.Status]++
+
+		ch <- prometheus.MustNewConstMetric(deviceAlertLevelDesc, prometheus.GaugeValue,
+			alertLevelValues[device.AlertLevel], labels...)
+		if !device.LastCalibration.IsZero() {
+			ch <- prometheus.MustNewConstMetric(deviceCalibrationAgeDesc, prometheus.GaugeValue,
+				now.Sub(device.LastCalibration).Seconds(), labels...)
+		}
+		if !device.NextMaintenance.IsZero() {
+			ch <- prometheus.MustNewConstMetric(deviceNextMaintenanceDesc, prometheus.GaugeValue,
+				device.NextMaintenance.Sub(now).Seconds(), labels...)
+		}
+		device.mu.RUnlock()
+	}
+
+	for status, count := range byStatus {
+		ch <- prometheus.MustNewConstMetric(devicesByStatusDesc, prometheus.GaugeValue, float64(count), string(status))
+	}
+
+	byPriority := map[AlertPriority]int{PriorityHigh: 0, PriorityMedium: 0, PriorityLow: 0}
+	for _, alert := range registry.GetActiveAlerts() {
+		byPriority[alert.Priority]++
+	}
+	for priority, count := range byPriority {
+		ch <- prometheus.MustNewConstMetric(activeAlertsDesc, prometheus.GaugeValue, float64(count), string(priority))
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// failureStatuses are the statuses whose onset counts as a device failure
+var failureStatuses = map[DeviceStatus]bool{
+	StatusError:   true,
+	StatusOffline: true,
+}
+
+// summaryDevice is what the summary remembers about an active device to move it
+// between counts when it changes
+type summaryDevice struct {
+	deviceType DeviceType
+	status     DeviceStatus
+}
+
+// DeviceSummary keeps dashboard counts up to date as devices and alerts change, so
+// reading it never scans the registry. Daily counts restart at midnight UTC.
+type DeviceSummary struct {
+	mu       sync.Mutex
+	devices  map[string]summaryDevice
+	byStatus map[DeviceStatus]int
+	byType   map[DeviceType]int
+	alerts   map[AlertPriority]int
+
+	day                 string
+	failuresToday       int
+	failuresTodayByType map[DeviceType]int
+	alertsRaisedToday   int
+}
+
+// NewDeviceSummary creates an empty summary
+func NewDeviceSummary() *DeviceSummary {
+	return &DeviceSummary{
+		devices:             make(map[string]summaryDevice),
+		byStatus:            make(map[DeviceStatus]int),
+		byType:              make(map[DeviceType]int),
+		alerts:              make(map[AlertPriority]int),
+		failuresTodayByType: make(map[DeviceType]int),
+	}
+}
+
+// rollLocked starts a new day's counts when the UTC date has changed
+func (s *DeviceSummary) rollLocked(now time.Time) {
+	day := now.UTC().Format(time.DateOnly)
+	if day == s.day {
+		return
+	}
+	s.day = day
+	s.failuresToday = 0
+	s.failuresTodayByType = make(map[DeviceType]int)
+	s.alertsRaisedToday = 0
+}
+
+// decrement lowers a count, dropping it when it reaches zero
+func decrement[K comparable](counts map[K]int, key K) {
+	if counts[key] <= 1 {
+		delete(counts, key)
+		return
+	}
+	counts[key]--
+}
+
+// observe records a device's current type and status. Entering a failure status
+// counts as a failure for the day.
+func (s *DeviceSummary) observe(deviceID string, deviceType DeviceType, status DeviceStatus, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rollLocked(now)
+
+	previous, known := s.devices[deviceID]
+	if known {
+		if previous.deviceType == deviceType && previous.status == status {
+			return
+		}
+		decrement(s.byStatus, previous.status)
+		decrement(s.byType, previous.deviceType)
+	}
+	s.devices[deviceID] = summaryDevice{deviceType: deviceType, status: status}
+	s.byStatus[status]++
+	s.byType[deviceType]++
+
+	if failureStatuses[status] && (!known || !failureStatuses[previous.status]) {
+		s.failuresToday++
+		s.failuresTodayByType[deviceType]++
+	}
+}
+
+// remove drops a device leaving active service
+func (s *DeviceSummary) remove(deviceID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, known := s.devices[deviceID]
+	if !known {
+		return
+	}
+	delete(s.devices, deviceID)
+	decrement(s.byStatus, previous.status)
+	decrement(s.byType, previous.deviceType)
+}
+
+// alertRaised counts a newly opened alert
+func (s *DeviceSummary) alertRaised(priority AlertPriority, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rollLocked(now)
+	s.alerts[priority]++
+	s.alertsRaisedToday++
+}
+
+// alertClosed uncounts an alert that was resolved or purged while active
+func (s *DeviceSummary) alertClosed(priority AlertPriority) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	decrement(s.alerts, priority)
+}
+
+// DeviceSummaryReport is the dashboard view of the fleet
+type DeviceSummaryReport struct {
+	GeneratedAt time.Time `json:"generated_at"`
+	Day         string    `json:"day"`
+	Devices     struct {
+		Total    int                  `json:"total"`
+		ByStatus map[DeviceStatus]int `json:"by_status"`
+		ByType   map[DeviceType]int   `json:"by_type"`
+	} `json:"devices"`
+	Today struct {
+		Failures       int                `json:"failures"`
+		FailuresByType map[DeviceType]int `json:"failures_by_type"`
+		AlertsRaised   int                `json:"alerts_raised"`
+	} `json:"today"`
+	ActiveAlerts struct {
+		Total      int                   `json:"total"`
+		ByPriority map[AlertPriority]int `json:"by_priority"`
+	} `json:"active_alerts"`
+}
+
+// Report copies the current counts. Every status and priority is listed, at zero when
+// nothing is in it.
+func (s *DeviceSummary) Report(now time.Time) DeviceSummaryReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rollLocked(now)
+
+	var report DeviceSummaryReport
+	report.GeneratedAt = now.UTC()
+	report.Day = s.day
+
+	report.Devices.Total = len(s.devices)
+	report.Devices.ByStatus = map[DeviceStatus]int{
+		StatusOperational: 0,
+		StatusDegraded:    0,
+		StatusOffline:     0,
+		StatusMaintenance: 0,
+		StatusError:       0,
+	}
+	for status, n := range s.byStatus {
+		report.Devices.ByStatus[status] = n
+	}
+	report.Devices.ByType = make(map[DeviceType]int, len(s.byType))
+	for deviceType, n := range s.byType {
+		report.Devices.ByType[deviceType] = n
+	}
+
+	report.Today.Failures = s.failuresToday
+	report.Today.FailuresByType = make(map[DeviceType]int, len(s.failuresTodayByType))
+	for deviceType, n := range s.failuresTodayByType {
+		report.Today.FailuresByType[deviceType] = n
+	}
+	report.Today.AlertsRaised = s.alertsRaisedToday
+
+	report.ActiveAlerts.ByPriority = map[AlertPriority]int{PriorityHigh: 0, PriorityMedium: 0, PriorityLow: 0}
+	for priority, n := range s.alerts {
+		report.ActiveAlerts.ByPriority[priority] = n
+		report.ActiveAlerts.Total += n
+	}
+	return report
+}
+
+// SummaryHandler returns pre-aggregated fleet counts for dashboards to poll
+func SummaryHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	report := registry.summary.Report(start)
+	RecordDeviceOperation("summary", "success", time.Since(start).Seconds())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/healthcare-gitops/common/config"
+	"github.com/healthcare-gitops/common/synthetic"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+)
+
+// syntheticPolicy bounds the lifetime of devices registered as synthetic
+var syntheticPolicy = synthetic.PolicyFromEnv()
+
+// janitor purges expired synthetic devices
+var janitor = synthetic.NewJanitor(recordSyntheticReclaimed)
+
+var syntheticReclaimed = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "medical_device_synthetic_records_reclaimed_total",
+		Help: "Expired synthetic records purged by the cleanup job, by kind",
+	},
+	[]string{"kind"},
+)
+
+func init() {
+	prometheus.MustRegister(syntheticReclaimed)
+}
+
+func recordSyntheticReclaimed(kind string, n int) {
+	syntheticReclaimed.WithLabelValues(kind).Add(float64(n))
+	log.Info().Str("kind", kind).Int("count", n).Msg("Reclaimed expired synthetic records")
+}
+
+// reclaimSynthetic purges active and decommissioned devices whose synthetic marker has
+// expired, with everything held for them, and returns how many were removed.
+// Synthetic devices skip the decommission retention period.
+func (dr *DeviceRegistry) reclaimSynthetic(now time.Time) int {
+	expired := make([]string, 0)
+	for _, device := range append(dr.ListDevices(), dr.ListDecommissioned()...) {
+		if device.Marker.Expired(now) {
+			expired = append(expired, device.ID)
+		}
+	}
+
+	reclaimed := 0
+	for _, id := range expired {
+		if err := dr.PurgeDevice(id); err == nil {
+			reclaimed++
+		}
+	}
+	return reclaimed
+}
+
+// startSyntheticCleanup runs the janitor on SYNTHETIC_CLEANUP_INTERVAL_MINUTES
+func startSyntheticCleanup(ctx context.Context) {
+	interval := time.Duration(config.GetEnvInt("SYNTHETIC_CLEANUP_INTERVAL_MINUTES", 15)) * time.Minute
+	if interval <= 0 {
+		interval = 15 * time.Minute
+	}
+	log.Info().Dur("interval", interval).Dur("default_ttl", syntheticPolicy.DefaultTTL).Msg("Starting synthetic data cleanup job")
+	janitor.Run(ctx, interval)
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// telemetryBufferSize is how many readings are retained per device
+const telemetryBufferSize = 360
+
+// Synthetic patient conditions that shape generated vitals
+const (
+	ConditionHealthy            = "healthy"
+	ConditionTachycardia        = "tachycardia"
+	ConditionBradycardia        = "bradycardia"
+	ConditionAtrialFibrillation = "atrial_fibrillation"
+	ConditionCOPD               = "copd"
+	ConditionSepsis             = "sepsis"
+)
+
+// VitalRange is the target band a condition holds a vital sign within
+type VitalRange struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+// SyntheticPatient is a generated test patient. IDs are prefixed SYN- and carry no real PHI.
+type SyntheticPatient struct {
+	ID              string     `json:"id"`
+	GivenName       string     `json:"given_name"`
+	FamilyName      string     `json:"family_name"`
+	Age             int        `json:"age"`
+	Sex             string     `json:"sex"`
+	Locale          string     `json:"locale"`
+	Conditions      []string   `json:"conditions"`
+	HeartRate       VitalRange `json:"heart_rate_bpm"`
+	RespiratoryRate VitalRange `json:"respiratory_rate_bpm"`
+	SpO2            VitalRange `json:"spo2_percent"`
+	Cohort          string     `json:"cohort"`
+	// BirthDate (YYYY-MM-DD) is consistent with Age as of generation
+	BirthDate string            `json:"birth_date"`
+	Address   SyntheticAddress  `json:"address"`
+	Coverage  SyntheticCoverage `json:"coverage"`
+	// HouseholdID links the members of a generated household; PractitionerID and
+	// LocationID are the patient's attending and care unit in the batch directory
+	HouseholdID    string `json:"household_id,omitempty"`
+	PractitionerID string `json:"practitioner_id,omitempty"`
+	LocationID     string `json:"location_id,omitempty"`
+	// Diagnoses (ICD-10), Procedures (CPT), Labs (LOINC) and Medications (RxNorm)
+	// are generated from the conditions for the configured code systems
+	Diagnoses   []CodedConcept `json:"diagnoses,omitempty"`
+	Procedures  []CodedConcept `json:"procedures,omitempty"`
+	Labs        []LabResult    `json:"labs,omitempty"`
+	Medications []CodedConcept `json:"medications,omitempty"`
+	// state is the current value of each vital, random-walked between readings
+	state map[string]float64
+}
+
+// ClinicalReading is one device-generated sample linked to a patient
+type ClinicalReading struct {
+	DeviceID   string             `json:"device_id"`
+	PatientID  string             `json:"patient_id"`
+	DeviceType DeviceType         `json:"device_type"`
+	Timestamp  time.Time          `json:"timestamp"`
+	Values     map[string]float64 `json:"values"`
+	Rhythm     string             `json:"rhythm,omitempty"`
+}
+
+// patientLinkedTypes are device types that monitor or treat a specific patient
+var patientLinkedTypes = map[DeviceType]bool{
+	DeviceTypeECG:        true,
+	DeviceTypeVentilator: true,
+	DeviceTypePump:       true,
+}
+
+// newSyntheticPatient generates the n-th synthetic patient with demographics and a
+// condition drawn from the cohort, vitals consistent with it and codes in the
+// selected code systems. Everything is drawn from rng, so a seeded source yields
+// the same patient every time.
+func newSyntheticPatient(rng *rand.Rand, n int, cohort CohortProfile, codeSystems []string) *SyntheticPatient {
+	condition := cohort.pickCondition(rng)
+	p := &SyntheticPatient{
+		ID:              fmt.Sprintf("SYN-PT-%05d", n),
+		Conditions:      []string{condition},
+		Cohort:          cohort.Name,
+		HeartRate:       VitalRange{Min: 60, Max: 100},
+		RespiratoryRate: VitalRange{Min: 12, Max: 20},
+		SpO2:            VitalRange{Min: 95, Max: 100},
+	}
+
+	switch condition {
+	case ConditionTachycardia:
+		p.HeartRate = VitalRange{Min: 105, Max: 140}
+	case ConditionBradycardia:
+		p.HeartRate = VitalRange{Min: 40, Max: 55}
+	case ConditionAtrialFibrillation:
+		p.HeartRate = VitalRange{Min: 90, Max: 150}
+	case ConditionCOPD:
+		p.RespiratoryRate = VitalRange{Min: 20, Max: 28}
+		p.SpO2 = VitalRange{Min: 88, Max: 92}
+	case ConditionSepsis:
+		p.HeartRate = VitalRange{Min: 100, Max: 130}
+		p.RespiratoryRate = VitalRange{Min: 22, Max: 30}
+		p.SpO2 = VitalRange{Min: 90, Max: 95}
+	}
+
+	p.state = map[string]float64{
+		"heart_rate":       (p.HeartRate.Min + p.HeartRate.Max) / 2,
+		"respiratory_rate": (p.RespiratoryRate.Min + p.RespiratoryRate.Max) / 2,
+		"spo2":             (p.SpO2.Min + p.SpO2.Max) / 2,
+	}
+	cohort.demographics(rng, p)
+	p.assignCodes(rng, codeSystems)
+	cohort.assignComorbidities(rng, p, codeSystems)
+	return p
+}
+
+// has reports whether the patient has a condition
+func (p *SyntheticPatient) has(condition string) bool {
+	for _, c := range p.Conditions {
+		if c == condition {
+			return true
+		}
+	}
+	return false
+}
+
+// walk moves a vital by a random step, pulled back towards its band so readings
+// stay clinically consistent while still varying over time
+func (p *SyntheticPatient) walk(rng *rand.Rand, name string, band VitalRange, volatility float64) float64 {
+	value := p.state[name] + (rng.Float64()*2-1)*volatility
+	mid := (band.Min + band.Max) / 2
+	value += (mid - value) * 0.1
+	value = math.Max(band.Min, math.Min(band.Max, value))
+	p.state[name] = value
+	return math.Round(value*10) / 10
+}
+
+// reading generates the next sample a device of the given type would report for the patient
+func (p *SyntheticPatient) reading(rng *rand.Rand, deviceID string, deviceType DeviceType, at time.Time) ClinicalReading {
+	r := ClinicalReading{
+		DeviceID:   deviceID,
+		PatientID:  p.ID,
+		DeviceType: deviceType,
+		Timestamp:  at,
+		Values:     make(map[string]float64),
+	}
+
+	switch deviceType {
+	case DeviceTypeECG:
+		volatility := 2.0
+		r.Rhythm = "sinus"
+		switch {
+		case p.has(ConditionAtrialFibrillation):
+			volatility = 15 // irregularly irregular
+			r.Rhythm = "atrial_fibrillation"
+		case p.has(ConditionTachycardia) || p.has(ConditionSepsis):
+			r.Rhythm = "sinus_tachycardia"
+		case p.has(ConditionBradycardia):
+			r.Rhythm = "sinus_bradycardia"
+		}
+		r.Values["heart_rate_bpm"] = p.walk(rng, "heart_rate", p.HeartRate, volatility)
+		r.Values["spo2_percent"] = p.walk(rng, "spo2", p.SpO2, 0.5)
+	case DeviceTypeVentilator:
+		r.Values["respiratory_rate_bpm"] = p.walk(rng, "respiratory_rate", p.RespiratoryRate, 1)
+		r.Values["spo2_percent"] = p.walk(rng, "spo2", p.SpO2, 0.5)
+		r.Values["tidal_volume_ml"] = math.Round(450 + rng.Float64()*100)
+		fio2 := 0.21
+		if p.SpO2.Max < 95 {
+			fio2 = 0.4 // hypoxaemic patients need supplemental oxygen
+		}
+		r.Values["fio2"] = fio2
+		// Obstructed airways need higher pressures, and hypoxaemia more PEEP
+		peak, peep := 18.0, 5.0
+		if p.has(ConditionCOPD) {
+			peak = 28
+		}
+		if p.SpO2.Max < 95 {
+			peep = 8
+		}
+		r.Values["peak_inspiratory_pressure_cmh2o"] = math.Round(peak + rng.Float64()*6)
+		r.Values["peep_cmh2o"] = peep
+	case DeviceTypePump:
+		rate := 80.0
+		if p.has(ConditionSepsis) {
+			rate = 250 // fluid resuscitation
+		}
+		r.Values["infusion_rate_ml_h"] = math.Round(rate + (rng.Float64()*2-1)*5)
+	}
+	return r
+}
+
+// TelemetryStore keeps recent clinical readings per device
+type TelemetryStore struct {
+	readings map[string][]ClinicalReading
+	mu       sync.RWMutex
+}
+
+var telemetry = NewTelemetryStore()
+
+// NewTelemetryStore creates an empty telemetry store
+func NewTelemetryStore() *TelemetryStore {
+	return &TelemetryStore{readings: make(map[string][]ClinicalReading)}
+}
+
+// Append stores a reading, evicting the oldest once the buffer is full
+func (ts *TelemetryStore) Append(reading ClinicalReading) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	buf := append(ts.readings[reading.DeviceID], reading)
+	if len(buf) > telemetryBufferSize {
+		buf = buf[len(buf)-telemetryBufferSize:]
+	}
+	ts.readings[reading.DeviceID] = buf
+}
+
+// Recent returns up to limit of the newest readings for a device, oldest first
+func (ts *TelemetryStore) Recent(deviceID string, limit int) []ClinicalReading {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	buf := ts.readings[deviceID]
+	if limit > 0 && len(buf) > limit {
+		buf = buf[len(buf)-limit:]
+	}
+	result := make([]ClinicalReading, len(buf))
+	copy(result, buf)
+	return result
+}
+
+// Remove drops a device's telemetry
+func (ts *TelemetryStore) Remove(deviceID string) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	delete(ts.readings, deviceID)
+}
+
+// GetDeviceTelemetryHandler returns recent patient-linked telemetry for a device.
+// Supports ?limit= (default 60).
+func GetDeviceTelemetryHandler(w http.ResponseWriter, r *http.Request) {
+	deviceID := chi.URLParam(r, "deviceID")
+	ctx := r.Context()
+	span := trace.SpanFromContext(ctx)
+	start := time.Now()
+
+	if _, err := registry.GetDevice(deviceID); err != nil {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		RecordDeviceOperation("get_telemetry", "error", time.Since(start).Seconds())
+		span.RecordError(err)
+		return
+	}
+
+	limit := 60
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > telemetryBufferSize {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", telemetryBufferSize), http.StatusBadRequest)
+			RecordDeviceOperation("get_telemetry", "error", time.Since(start).Seconds())
+			return
+		}
+		limit = n
+	}
+
+	readings := telemetry.Recent(deviceID, limit)
+	patient := simulator.PatientFor(deviceID)
+
+	RecordDeviceOperation("get_telemetry", "success", time.Since(start).Seconds())
+	span.SetAttributes(attribute.String("device.id", deviceID), attribute.Int("telemetry.count", len(readings)))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"device_id": deviceID,
+		"patient":   patient,
+		"readings":  readings,
+		"count":     len(readings),
+	})
+}
+
+// ListSyntheticPatientsHandler lists synthetic patients and the devices linked to them
+func ListSyntheticPatientsHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	links := simulator.PatientLinks()
+	RecordDeviceOperation("list_synthetic_patients", "success", time.Since(start).Seconds())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"patients": links,
+		"count":    len(links),
+	})
+}
+
+// PatientLink pairs a synthetic patient with the devices attached to them and the
+// encounter they were admitted under
+type PatientLink struct {
+	Patient     SyntheticPatient `json:"patient"`
+	DeviceIDs   []string         `json:"device_ids"`
+	EncounterID string           `json:"encounter_id,omitempty"`
+}
+
+// sortPatientLinks orders links by patient ID
+func sortPatientLinks(links []PatientLink) {
+	sort.Slice(links, func(i, j int) bool { return links[i].Patient.ID < links[j].Patient.ID })
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/healthcare-gitops/common/synthetic"
+	"github.com/rs/zerolog/log"
+)
+
+// Telemetry push bounds
+const (
+	defaultPushDevices  = 10
+	maxPushDevices      = 1000
+	defaultPushSeconds  = 60
+	maxPushSeconds      = 3600
+	minPushInterval     = 0.1
+	maxPushInterval     = 60.0
+	defaultPushInterval = 1.0
+	// pushConcurrency bounds the requests in flight to the target
+	pushConcurrency = 16
+)
+
+// TelemetryPushRequest asks for a fleet of synthetic devices to push metrics into a
+// target instance
+type TelemetryPushRequest struct {
+	TargetURL       string       `json:"target_url"`
+	DeviceCount     int          `json:"device_count"`
+	DeviceTypes     []DeviceType `json:"device_types,omitempty"`
+	IntervalSeconds float64      `json:"interval_seconds"`
+	DurationSeconds int          `json:"duration_seconds"`
+}
+
+// TelemetryPushRun tracks one push of synthetic device metrics into a target instance
+type TelemetryPushRun struct {
+	ID              string     `json:"id"`
+	TargetURL       string     `json:"target_url"`
+	DeviceCount     int        `json:"device_count"`
+	IntervalSeconds float64    `json:"interval_seconds"`
+	StartedAt       time.Time  `json:"started_at"`
+	EndsAt          time.Time  `json:"ends_at"`
+	FinishedAt      *time.Time `json:"finished_at,omitempty"`
+	// Registered counts devices created on the target, Sent and Failed its metrics pushes
+	Registered int64  `json:"registered"`
+	Sent       int64  `json:"sent"`
+	Failed     int64  `json:"failed"`
+	Active     bool   `json:"active"`
+	Error      string `json:"error,omitempty"`
+	cancel     context.CancelFunc
+}
+
+// TelemetryPusher drives load tests of a target's metrics API
+type TelemetryPusher struct {
+	runs map[string]*TelemetryPushRun
+	seq  int
+	mu   sync.Mutex
+}
+
+var telemetryPusher = NewTelemetryPusher()
+
+// NewTelemetryPusher creates a pusher with no runs
+func NewTelemetryPusher() *TelemetryPusher {
+	return &TelemetryPusher{runs: make(map[string]*TelemetryPushRun)}
+}
+
+// Start registers the requested synthetic devices on the target, then pushes metrics
+// for each of them every interval until the duration is up
+func (tp *TelemetryPusher) Start(req TelemetryPushRequest) (TelemetryPushRun, error) {
+	if u, err := url.Parse(req.TargetURL); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return TelemetryPushRun{}, fmt.Errorf("target_url must be an absolute http or https URL")
+	}
+	if req.DeviceCount == 0 {
+		req.DeviceCount = defaultPushDevices
+	}
+	if len(req.DeviceTypes) == 0 {
+		req.DeviceTypes = streamDeviceTypes
+	}
+	if req.IntervalSeconds == 0 {
+		req.IntervalSeconds = defaultPushInterval
+	}
+	if req.DurationSeconds == 0 {
+		req.DurationSeconds = defaultPushSeconds
+	}
+	switch {
+	case req.DeviceCount < 1 || req.DeviceCount > maxPushDevices:
+		return TelemetryPushRun{}, fmt.Errorf("device_count must be between 1 and %d", maxPushDevices)
+	case req.IntervalSeconds < minPushInterval || req.IntervalSeconds > maxPushInterval:
+		return TelemetryPushRun{}, fmt.Errorf("interval_seconds must be between %g and %g", minPushInterval, maxPushInterval)
+	case req.DurationSeconds < 1 || req.DurationSeconds > maxPushSeconds:
+		return TelemetryPushRun{}, fmt.Errorf("duration_seconds must be between 1 and %d", maxPushSeconds)
+	}
+
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	tp.seq++
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(req.DurationSeconds)*time.Second)
+	now := time.Now()
+	run := &TelemetryPushRun{
+		ID:              fmt.Sprintf("TLP-%06d", tp.seq),
+		TargetURL:       strings.TrimRight(req.TargetURL, "/"),
+		DeviceCount:     req.DeviceCount,
+		IntervalSeconds: req.IntervalSeconds,
+		StartedAt:       now,
+		EndsAt:          now.Add(time.Duration(req.DurationSeconds) * time.Second),
+		Active:          true,
+		cancel:          cancel,
+	}
+	devices := make([]*MedicalDevice, req.DeviceCount)
+	for i := range devices {
+		deviceType := req.DeviceTypes[i%len(req.DeviceTypes)]
+		devices[i] = &MedicalDevice{
+			ID:           fmt.Sprintf("SYN-LOAD-%06d-%04d", tp.seq, i+1),
+			Type:         deviceType,
+			Status:       StatusOperational,
+			Location:     fmt.Sprintf("%s - Bed %d", simulatedLocations[i%len(simulatedLocations)], i/len(simulatedLocations)+1),
+			Manufacturer: "Synthetic",
+		}
+	}
+	tp.runs[run.ID] = run
+	go tp.push(ctx, run, devices)
+
+	log.Info().Str("push_id", run.ID).Str("target", run.TargetURL).Int("devices", run.DeviceCount).Float64("interval_seconds", run.IntervalSeconds).Msg("Telemetry push started")
+	return *run, nil
+}
+
+// push registers the devices, then sends each one's metrics every interval, with at
+// most pushConcurrency requests in flight
+func (tp *TelemetryPusher) push(ctx context.Context, run *TelemetryPushRun, devices []*MedicalDevice) {
+	sem := make(chan struct{}, pushConcurrency)
+	fanOut := func(send func(device *MedicalDevice) error, onSuccess *int64) {
+		var wg sync.WaitGroup
+		for _, device := range devices {
+			select {
+			case <-ctx.Done():
+			case sem <- struct{}{}:
+				wg.Add(1)
+				go func(device *MedicalDevice) {
+					defer func() { <-sem; wg.Done() }()
+					err := send(device)
+					tp.mu.Lock()
+					if err != nil {
+						run.Failed++
+					} else {
+						*onSuccess++
+					}
+					tp.mu.Unlock()
+				}(device)
+			}
+		}
+		wg.Wait()
+	}
+
+	fanOut(func(device *MedicalDevice) error {
+		return sendPush(ctx, http.MethodPost, run.TargetURL+"/api/v1/devices", device, true)
+	}, &run.Registered)
+
+	ticker := time.NewTicker(time.Duration(run.IntervalSeconds * float64(time.Second)))
+	defer ticker.Stop()
+	for ctx.Err() == nil {
+		fanOut(func(device *MedicalDevice) error {
+			endpoint := run.TargetURL + "/api/v1/devices/" + url.PathEscape(device.ID) + "/metrics"
+			return sendPush(ctx, http.MethodPost, endpoint, randomMetrics(), false)
+		}, &run.Sent)
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		}
+	}
+
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	now := time.Now()
+	run.FinishedAt = &now
+	run.Active = false
+	if now.Before(run.EndsAt) {
+		run.Error = "push stopped"
+	}
+	log.Info().Str("push_id", run.ID).Int64("registered", run.Registered).Int64("sent", run.Sent).Int64("failed", run.Failed).Msg("Telemetry push finished")
+}
+
+// sendPush sends one request of a push. Devices are registered as synthetic, so the
+// target's cleanup purges them after its default TTL, and one already registered by an
+// earlier run is reused.
+func sendPush(ctx context.Context, method, endpoint string, payload interface{}, register bool) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "medical-device-service-telemetry-push/1.0")
+	if register {
+		req.Header.Set(synthetic.HeaderSynthetic, "true")
+		req.Header.Set(synthetic.HeaderOrigin, "telemetry-push")
+	}
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 && !(register && resp.StatusCode == http.StatusConflict) {
+		return fmt.Errorf("target returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Stop cancels a running push
+func (tp *TelemetryPusher) Stop(id string) (TelemetryPushRun, error) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	run, ok := tp.runs[id]
+	if !ok {
+		return TelemetryPushRun{}, fmt.Errorf("telemetry push %s not found", id)
+	}
+	run.cancel()
+	return *run, nil
+}
+
+// Get returns a push's progress
+func (tp *TelemetryPusher) Get(id string) (TelemetryPushRun, error) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	run, ok := tp.runs[id]
+	if !ok {
+		return TelemetryPushRun{}, fmt.Errorf("telemetry push %s not found", id)
+	}
+	return *run, nil
+}
+
+// StartTelemetryPushHandler load-tests a target instance's metrics API with a fleet
+// of synthetic devices
+func StartTelemetryPushHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	var req TelemetryPushRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		RecordDeviceOperation("start_telemetry_push", "error", time.Since(start).Seconds())
+		return
+	}
+
+	run, err := telemetryPusher.Start(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		RecordDeviceOperation("start_telemetry_push", "error", time.Since(start).Seconds())
+		return
+	}
+
+	RecordDeviceOperation("start_telemetry_push", "success", time.Since(start).Seconds())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(run)
+}
+
+// GetTelemetryPushHandler reports a push's progress
+func GetTelemetryPushHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "pushID")
+	start := time.Now()
+
+	run, err := telemetryPusher.Get(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		RecordDeviceOperation("get_telemetry_push", "error", time.Since(start).Seconds())
+		return
+	}
+
+	RecordDeviceOperation("get_telemetry_push", "success", time.Since(start).Seconds())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(run)
+}
+
+// StopTelemetryPushHandler cancels a running push
+func StopTelemetryPushHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "pushID")
+	start := time.Now()
+
+	run, err := telemetryPusher.Stop(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		RecordDeviceOperation("stop_telemetry_push", "error", time.Since(start).Seconds())
+		return
+	}
+
+	RecordDeviceOperation("stop_telemetry_push", "success", time.Since(start).Seconds())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(run)
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Waveform channels
+const (
+	ChannelECGLeadII      = "ecg_lead_ii"
+	ChannelPleth          = "pleth"
+	ChannelAirwayPressure = "airway_pressure"
+)
+
+// Telemetry stream record kinds
+const (
+	TelemetryKindVitals   = "vitals"
+	TelemetryKindWaveform = "waveform"
+)
+
+// Telemetry stream bounds
+const (
+	defaultStreamSeconds = 60
+	maxStreamSeconds     = 3600
+	defaultWaveformHz    = 125
+	maxWaveformHz        = 500
+)
+
+// streamDeviceTypes are the bedside devices a telemetry stream can include
+var streamDeviceTypes = []DeviceType{DeviceTypeECG, DeviceTypeVentilator, DeviceTypePump}
+
+// TelemetryRecord is one line of a telemetry stream: a vitals reading or one second
+// of a waveform
+type TelemetryRecord struct {
+	Kind     string           `json:"kind"`
+	Vitals   *ClinicalReading `json:"vitals,omitempty"`
+	Waveform *WaveformSegment `json:"waveform,omitempty"`
+}
+
+// WaveformSegment is one second of a waveform channel sampled at SampleRateHz
+type WaveformSegment struct {
+	DeviceID     string    `json:"device_id"`
+	PatientID    string    `json:"patient_id"`
+	Channel      string    `json:"channel"`
+	Unit         string    `json:"unit"`
+	Start        time.Time `json:"start"`
+	SampleRateHz int       `json:"sample_rate_hz"`
+	Samples      []float64 `json:"samples"`
+}
+
+// waveComponent is one deflection of a beat, a Gaussian centred at a phase of the
+// cardiac cycle
+type waveComponent struct {
+	phase, amplitude, width float64
+}
+
+// ecgBeat is a lead II PQRST complex in mV; atrial fibrillation has no P wave
+var (
+	ecgPWave = waveComponent{0.2, 0.15, 0.025}
+	ecgBeat  = []waveComponent{
+		{0.37, -0.1, 0.01},  // Q
+		{0.4, 1.2, 0.012},   // R
+		{0.43, -0.25, 0.01}, // S
+		{0.65, 0.3, 0.04},   // T
+	}
+	// plethBeat is the pulse oximeter's pulse: systolic peak and dicrotic wave, on a
+	// 0-1 scale
+	plethBeat = []waveComponent{{0.55, 1, 0.08}, {0.85, 0.35, 0.06}}
+)
+
+// waveSum evaluates components at a phase, wrapping so a beat joins the next
+func waveSum(components []waveComponent, phase float64) float64 {
+	v := 0.0
+	for _, c := range components {
+		d := math.Mod(phase-c.phase+1.5, 1) - 0.5
+		v += c.amplitude * math.Exp(-d*d/(2*c.width*c.width))
+	}
+	return v
+}
+
+// Atrial fibrillation replaces the P wave with fibrillatory waves on the baseline
+const (
+	fibrillationWaveHz    = 6.0
+	fibrillationAmplitude = 0.04
+)
+
+// Ventilation: inspiration takes a third of each breath, and pressure falls back to
+// PEEP with the lungs' time constant in seconds
+const (
+	inspiratoryFraction = 1.0 / 3
+	expiratoryTimeConst = 0.25
+)
+
+// waveformGenerator carries the cardiac and respiratory cycles from one second to
+// the next, so beats and breaths run on across segments
+type waveformGenerator struct {
+	rng           *rand.Rand
+	p             *SyntheticPatient
+	hz            int
+	t             float64
+	beatPhase     float64
+	beatSeconds   float64
+	breathPhase   float64
+	breathSeconds float64
+}
+
+// nextBeat draws the length of the coming beat: regular with slight variability, or
+// irregularly irregular in atrial fibrillation
+func (g *waveformGenerator) nextBeat(heartRate float64) {
+	g.beatSeconds = 60 / heartRate * (0.97 + g.rng.Float64()*0.06)
+	if g.p.has(ConditionAtrialFibrillation) {
+		g.beatSeconds = 60 / heartRate * (0.7 + g.rng.Float64()*0.6)
+	}
+}
+
+// cardiac generates a second of ECG and pleth at the heart rate
+func (g *waveformGenerator) cardiac(heartRate float64) (ecg, pleth []float64) {
+	af := g.p.has(ConditionAtrialFibrillation)
+	dt := 1 / float64(g.hz)
+	ecg, pleth = make([]float64, g.hz), make([]float64, g.hz)
+	if g.beatSeconds == 0 {
+		g.nextBeat(heartRate)
+	}
+	for i := 0; i < g.hz; i++ {
+		v := waveSum(ecgBeat, g.beatPhase)
+		if af {
+			v += fibrillationAmplitude * math.Sin(2*math.Pi*fibrillationWaveHz*(g.t+float64(i)*dt))
+		} else {
+			v += waveSum([]waveComponent{ecgPWave}, g.beatPhase)
+		}
+		ecg[i] = math.Round((v+g.rng.NormFloat64()*0.01)*1000) / 1000
+		pleth[i] = math.Round(waveSum(plethBeat, g.beatPhase)*1000) / 1000
+
+		if g.beatPhase += dt / g.beatSeconds; g.beatPhase >= 1 {
+			g.beatPhase--
+			g.nextBeat(heartRate)
+		}
+	}
+	return ecg, pleth
+}
+
+// airway generates a second of volume-controlled ventilation: pressure ramps to the
+// peak through inspiration, then decays to PEEP
+func (g *waveformGenerator) airway(respiratoryRate, peak, peep float64) []float64 {
+	dt := 1 / float64(g.hz)
+	out := make([]float64, g.hz)
+	if g.breathSeconds == 0 {
+		g.breathSeconds = 60 / respiratoryRate
+	}
+	for i := 0; i < g.hz; i++ {
+		v := peep + (peak-peep)*g.breathPhase/inspiratoryFraction
+		if g.breathPhase >= inspiratoryFraction {
+			v = peep + (peak-peep)*math.Exp(-(g.breathPhase-inspiratoryFraction)*g.breathSeconds/expiratoryTimeConst)
+		}
+		out[i] = math.Round(v*10) / 10
+
+		if g.breathPhase += dt / g.breathSeconds; g.breathPhase >= 1 {
+			g.breathPhase--
+			g.breathSeconds = 60 / respiratoryRate
+		}
+	}
+	return out
+}
+
+// streamDevice is a device in a generated telemetry stream
+type streamDevice struct {
+	ID   string
+	Type DeviceType
+}
+
+// streamTelemetry generates a patient's telemetry second by second from start: each
+// device's vitals every vitalsEvery seconds and, at hz above zero, a second of each
+// of its waveforms, which follow the latest vitals. Records are passed to emit as
+// they are generated; an emit error stops the stream.
+func streamTelemetry(rng *rand.Rand, p *SyntheticPatient, devices []streamDevice, start time.Time, seconds, vitalsEvery, hz int, emit func(TelemetryRecord) error) error {
+	gen := &waveformGenerator{rng: rng, p: p, hz: hz}
+	latest := make(map[DeviceType]ClinicalReading)
+	for sec := 0; sec < seconds; sec++ {
+		at := start.Add(time.Duration(sec) * time.Second)
+		if sec%vitalsEvery == 0 {
+			for _, d := range devices {
+				reading := p.reading(rng, d.ID, d.Type, at)
+				latest[d.Type] = reading
+				if err := emit(TelemetryRecord{Kind: TelemetryKindVitals, Vitals: &reading}); err != nil {
+					return err
+				}
+			}
+		}
+		if hz == 0 {
+			continue
+		}
+
+		segment := func(d streamDevice, channel, unit string, samples []float64) error {
+			return emit(TelemetryRecord{Kind: TelemetryKindWaveform, Waveform: &WaveformSegment{
+				DeviceID: d.ID, PatientID: p.ID, Channel: channel, Unit: unit,
+				Start: at, SampleRateHz: hz, Samples: samples,
+			}})
+		}
+		for _, d := range devices {
+			values := latest[d.Type].Values
+			switch d.Type {
+			case DeviceTypeECG:
+				ecg, pleth := gen.cardiac(values["heart_rate_bpm"])
+				if err := segment(d, ChannelECGLeadII, "mV", ecg); err != nil {
+					return err
+				}
+				if err := segment(d, ChannelPleth, "1", pleth); err != nil {
+					return err
+				}
+			case DeviceTypeVentilator:
+				pressure := gen.airway(values["respiratory_rate_bpm"], values["peak_inspiratory_pressure_cmh2o"], values["peep_cmh2o"])
+				if err := segment(d, ChannelAirwayPressure, "cm[H2O]", pressure); err != nil {
+					return err
+				}
+			}
+		}
+		gen.t++
+	}
+	return nil
+}
+
+// TelemetryStreamRequest asks for a synthetic patient's device telemetry
+type TelemetryStreamRequest struct {
+	GenerationOptions
+	// PatientRef streams the patient standing for the caller's ref
+	PatientRef            string       `json:"patient_ref,omitempty"`
+	DeviceTypes           []DeviceType `json:"device_types,omitempty"`
+	DurationSeconds       int          `json:"duration_seconds"`
+	VitalsIntervalSeconds int          `json:"vitals_interval_seconds"`
+	// Waveforms adds ECG, pleth and airway pressure waveforms at SampleRateHz
+	Waveforms    bool `json:"waveforms,omitempty"`
+	SampleRateHz int  `json:"sample_rate_hz,omitempty"`
+	// Start is the RFC 3339 time of the first sample; now by default
+	Start string `json:"start,omitempty"`
+}
+
+// GenerateTelemetryHandler streams a synthetic patient's bedside device telemetry as
+// NDJSON: vitals readings consistent with their condition and, optionally, ECG,
+// pleth and ventilator airway pressure waveforms. The stream is generated as it is
+// written. With the same seed and start the same stream is generated again; the
+// seed is returned in the X-Synthetic-Seed header.
+func GenerateTelemetryHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	fail := func(message string, status int) {
+		http.Error(w, message, status)
+		RecordDeviceOperation("generate_telemetry", "error", time.Since(start).Seconds())
+	}
+
+	var req TelemetryStreamRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		fail("Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.DeviceTypes) == 0 {
+		req.DeviceTypes = streamDeviceTypes
+	}
+	if req.DurationSeconds == 0 {
+		req.DurationSeconds = defaultStreamSeconds
+	}
+	if req.VitalsIntervalSeconds == 0 {
+		req.VitalsIntervalSeconds = 1
+	}
+	if req.Waveforms && req.SampleRateHz == 0 {
+		req.SampleRateHz = defaultWaveformHz
+	}
+	switch {
+	case req.DurationSeconds < 1 || req.DurationSeconds > maxStreamSeconds:
+		fail(fmt.Sprintf("duration_seconds must be between 1 and %d", maxStreamSeconds), http.StatusBadRequest)
+		return
+	case req.VitalsIntervalSeconds < 1 || req.VitalsIntervalSeconds > req.DurationSeconds:
+		fail("vitals_interval_seconds must be between 1 and duration_seconds", http.StatusBadRequest)
+		return
+	case !req.Waveforms && req.SampleRateHz != 0:
+		fail("sample_rate_hz applies only with waveforms", http.StatusBadRequest)
+		return
+	case req.Waveforms && (req.SampleRateHz < 1 || req.SampleRateHz > maxWaveformHz):
+		fail(fmt.Sprintf("sample_rate_hz must be between 1 and %d", maxWaveformHz), http.StatusBadRequest)
+		return
+	}
+	seen := make(map[DeviceType]bool, len(req.DeviceTypes))
+	for _, t := range req.DeviceTypes {
+		if !patientLinkedTypes[t] {
+			fail(fmt.Sprintf("device type %q has no patient telemetry: use ECG, Ventilator or Infusion_Pump", t), http.StatusBadRequest)
+			return
+		}
+		if seen[t] {
+			fail(fmt.Sprintf("device type %q is listed twice", t), http.StatusBadRequest)
+			return
+		}
+		seen[t] = true
+	}
+	first := time.Now().UTC().Truncate(time.Second)
+	if req.Start != "" {
+		t, err := time.Parse(time.RFC3339, req.Start)
+		if err != nil {
+			fail("start must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		first = t
+	}
+	cohort, rng, err := req.resolve(r)
+	if err != nil {
+		fail(err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	prefix := req.idPrefix("TLM")
+	var patient *SyntheticPatient
+	if req.PatientRef != "" {
+		if patient, err = refPatient(req.PatientRef, cohort, req.CodeSystems); err != nil {
+			fail(err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		patient = newSyntheticPatient(rng, 1, cohort, req.CodeSystems)
+		patient.ID = prefix
+		assignCare(rng, patient)
+	}
+	devices := make([]streamDevice, 0, len(req.DeviceTypes))
+	for _, t := range req.DeviceTypes {
+		devices = append(devices, streamDevice{
+			ID:   prefix + "-" + strings.ToUpper(strings.ReplaceAll(string(t), "_", "-")),
+			Type: t,
+		})
+	}
+
+	// Long streams outlast the server's write timeout
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("X-Synthetic-Seed", strconv.FormatInt(*req.Seed, 10))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	buf := bufio.NewWriter(w)
+	enc := json.NewEncoder(buf)
+	written := 0
+	err = streamTelemetry(rng, patient, devices, first, req.DurationSeconds, req.VitalsIntervalSeconds, req.SampleRateHz, func(rec TelemetryRecord) error {
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+		written++
+		if written%exportFlushEvery == 0 {
+			if err := buf.Flush(); err != nil {
+				return err
+			}
+			rc.Flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = buf.Flush()
+	}
+	if err != nil {
+		log.Warn().Err(err).Int("records", written).Msg("Telemetry stream interrupted")
+		RecordDeviceOperation("generate_telemetry", "error", time.Since(start).Seconds())
+		return
+	}
+	RecordDeviceOperation("generate_telemetry", "success", time.Since(start).Seconds())
+	log.Info().Str("patient_id", patient.ID).Int("seconds", req.DurationSeconds).Int("records", written).Msg("Telemetry streamed")
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Code systems the generator can emit, named as in SimulatorConfig.CodeSystems
+const (
+	CodeSystemICD10  = "icd10"
+	CodeSystemCPT    = "cpt"
+	CodeSystemLOINC  = "loinc"
+	CodeSystemRxNorm = "rxnorm"
+)
+
+// codeSystemURIs are the canonical FHIR system URIs for each code system
+var codeSystemURIs = map[string]string{
+	CodeSystemICD10:  "http://hl7.org/fhir/sid/icd-10-cm",
+	CodeSystemCPT:    "http://www.ama-assn.org/go/cpt",
+	CodeSystemLOINC:  "http://loinc.org",
+	CodeSystemRxNorm: "http://www.nlm.nih.gov/research/umls/rxnorm",
+}
+
+// allCodeSystems is the default: every code system is generated
+var allCodeSystems = []string{CodeSystemICD10, CodeSystemCPT, CodeSystemLOINC, CodeSystemRxNorm}
+
+// CodedConcept is a code from one of the supported code systems
+type CodedConcept struct {
+	System  string `json:"system"`
+	Code    string `json:"code"`
+	Display string `json:"display"`
+}
+
+// LabResult is a generated laboratory observation coded in LOINC
+type LabResult struct {
+	Test  CodedConcept `json:"test"`
+	Value float64      `json:"value"`
+	Unit  string       `json:"unit"`
+}
+
+// weightedConcept is a candidate code and its relative likelihood
+type weightedConcept struct {
+	Concept CodedConcept
+	Weight  int
+}
+
+// labSpec is a LOINC-coded test with the range a normal result falls in
+type labSpec struct {
+	Concept CodedConcept
+	Unit    string
+	Normal  VitalRange
+}
+
+// clinicalCoding is what a condition contributes to a patient's record: one
+// diagnosis picked by weight, and every procedure, medication and abnormal lab
+type clinicalCoding struct {
+	Diagnoses   []weightedConcept
+	Procedures  []CodedConcept
+	Medications []CodedConcept
+	// AbnormalLabs override the normal range of labs by LOINC code, adding the
+	// lab to the panel when it is not already part of it
+	AbnormalLabs map[string]VitalRange
+}
+
+func icd10(code, display string, weight int) weightedConcept {
+	return weightedConcept{Concept: CodedConcept{System: CodeSystemICD10, Code: code, Display: display}, Weight: weight}
+}
+
+func cpt(code, display string) CodedConcept {
+	return CodedConcept{System: CodeSystemCPT, Code: code, Display: display}
+}
+
+func rxnorm(code, display string) CodedConcept {
+	return CodedConcept{System: CodeSystemRxNorm, Code: code, Display: display}
+}
+
+func loinc(code, display, unit string, min, max float64) labSpec {
+	return labSpec{Concept: CodedConcept{System: CodeSystemLOINC, Code: code, Display: display}, Unit: unit, Normal: VitalRange{Min: min, Max: max}}
+}
+
+// labCatalog lists every lab the generator knows, keyed by LOINC code
+var labCatalog = map[string]labSpec{}
+
+// basicPanel is drawn for every admitted patient
+var basicPanel = []string{"6690-2", "718-7", "2951-2", "2823-3", "2160-0", "2345-7"}
+
+func init() {
+	for _, spec := range []labSpec{
+		loinc("6690-2", "Leukocytes [#/volume] in Blood by Automated count", "10*3/uL", 4.5, 11),
+		loinc("718-7", "Hemoglobin [Mass/volume] in Blood", "g/dL", 12, 16),
+		loinc("2951-2", "Sodium [Moles/volume] in Serum or Plasma", "mmol/L", 136, 145),
+		loinc("2823-3", "Potassium [Moles/volume] in Serum or Plasma", "mmol/L", 3.5, 5.1),
+		loinc("2160-0", "Creatinine [Mass/volume] in Serum or Plasma", "mg/dL", 0.6, 1.2),
+		loinc("2345-7", "Glucose [Mass/volume] in Serum or Plasma", "mg/dL", 70, 110),
+		loinc("10839-9", "Troponin I.cardiac [Mass/volume] in Serum or Plasma", "ng/mL", 0, 0.04),
+		loinc("33762-6", "Natriuretic peptide.B prohormone N-Terminal [Mass/volume] in Serum or Plasma", "pg/mL", 0, 125),
+		loinc("3016-3", "Thyrotropin [Units/volume] in Serum or Plasma", "m[IU]/L", 0.4, 4),
+		loinc("19123-9", "Magnesium [Mass/volume] in Serum or Plasma", "mg/dL", 1.7, 2.2),
+		loinc("2019-8", "Carbon dioxide [Partial pressure] in Arterial blood", "mm[Hg]", 35, 45),
+		loinc("2703-7", "Oxygen [Partial pressure] in Arterial blood", "mm[Hg]", 80, 100),
+		loinc("2524-7", "Lactate [Moles/volume] in Serum or Plasma", "mmol/L", 0.5, 2),
+		loinc("33959-8", "Procalcitonin [Mass/volume] in Serum or Plasma", "ng/mL", 0, 0.1),
+	} {
+		labCatalog[spec.Concept.Code] = spec
+	}
+}
+
+// conditionCoding maps each synthetic condition to the codes it generates
+var conditionCoding = map[string]clinicalCoding{
+	ConditionHealthy: {
+		Diagnoses:  []weightedConcept{icd10("Z03.89", "Encounter for observation for other suspected diseases and conditions ruled out", 1)},
+		Procedures: []CodedConcept{cpt("99222", "Initial hospital inpatient care, moderate complexity")},
+	},
+	ConditionTachycardia: {
+		Diagnoses: []weightedConcept{
+			icd10("R00.0", "Tachycardia, unspecified", 3),
+			icd10("I47.1", "Supraventricular tachycardia", 1),
+		},
+		Procedures:   []CodedConcept{cpt("99223", "Initial hospital inpatient care, high complexity"), cpt("93000", "Electrocardiogram, routine, with interpretation and report")},
+		Medications:  []CodedConcept{rxnorm("6918", "metoprolol"), rxnorm("296", "adenosine")},
+		AbnormalLabs: map[string]VitalRange{"3016-3": {Min: 0.01, Max: 0.3}, "19123-9": {Min: 1.2, Max: 1.6}},
+	},
+	ConditionBradycardia: {
+		Diagnoses: []weightedConcept{
+			icd10("R00.1", "Bradycardia, unspecified", 3),
+			icd10("I49.5", "Sick sinus syndrome", 1),
+		},
+		Procedures:   []CodedConcept{cpt("99223", "Initial hospital inpatient care, high complexity"), cpt("93000", "Electrocardiogram, routine, with interpretation and report"), cpt("33208", "Insertion of permanent pacemaker, atrial and ventricular")},
+		Medications:  []CodedConcept{rxnorm("1223", "atropine")},
+		AbnormalLabs: map[string]VitalRange{"2823-3": {Min: 5.3, Max: 6.2}, "3016-3": {Min: 6, Max: 15}},
+	},
+	ConditionAtrialFibrillation: {
+		Diagnoses: []weightedConcept{
+			icd10("I48.91", "Unspecified atrial fibrillation", 3),
+			icd10("I48.0", "Paroxysmal atrial fibrillation", 2),
+			icd10("I48.20", "Chronic atrial fibrillation, unspecified", 1),
+		},
+		Procedures:   []CodedConcept{cpt("93000", "Electrocardiogram, routine, with interpretation and report"), cpt("93306", "Echocardiography, transthoracic, complete, with Doppler"), cpt("92960", "Cardioversion, elective, external")},
+		Medications:  []CodedConcept{rxnorm("3443", "diltiazem"), rxnorm("1364430", "apixaban"), rxnorm("703", "amiodarone")},
+		AbnormalLabs: map[string]VitalRange{"33762-6": {Min: 400, Max: 2500}, "10839-9": {Min: 0.02, Max: 0.1}},
+	},
+	ConditionCOPD: {
+		Diagnoses: []weightedConcept{
+			icd10("J44.1", "Chronic obstructive pulmonary disease with (acute) exacerbation", 3),
+			icd10("J44.0", "Chronic obstructive pulmonary disease with (acute) lower respiratory infection", 1),
+		},
+		Procedures:   []CodedConcept{cpt("94640", "Pressurized or nonpressurized inhalation treatment"), cpt("94003", "Ventilation assist and management, inpatient, subsequent day")},
+		Medications:  []CodedConcept{rxnorm("435", "albuterol"), rxnorm("7213", "ipratropium"), rxnorm("8640", "prednisone")},
+		AbnormalLabs: map[string]VitalRange{"2019-8": {Min: 50, Max: 70}, "2703-7": {Min: 55, Max: 65}},
+	},
+	ConditionSepsis: {
+		Diagnoses: []weightedConcept{
+			icd10("A41.9", "Sepsis, unspecified organism", 4),
+			icd10("R65.20", "Severe sepsis without septic shock", 2),
+			icd10("R65.21", "Severe sepsis with septic shock", 1),
+		},
+		Procedures:   []CodedConcept{cpt("99291", "Critical care, evaluation and management, first 30-74 minutes"), cpt("36556", "Insertion of non-tunneled centrally inserted central venous catheter")},
+		Medications:  []CodedConcept{rxnorm("11124", "vancomycin"), rxnorm("2193", "ceftriaxone"), rxnorm("9863", "sodium chloride"), rxnorm("7512", "norepinephrine")},
+		AbnormalLabs: map[string]VitalRange{"6690-2": {Min: 12, Max: 25}, "2524-7": {Min: 2.5, Max: 6}, "33959-8": {Min: 2, Max: 20}, "2160-0": {Min: 1.4, Max: 3}},
+	},
+}
+
+// CohortProfile weights the conditions patients are admitted with, so a test
+// population can be skewed towards the case mix under test, and shapes their
+// demographics. Unset demographics use defaultAges, defaultSexes and defaultLocales.
+type CohortProfile struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Conditions  map[string]int `json:"condition_weights"`
+	Ages        *AgeRange      `json:"age_range,omitempty"`
+	// Sexes weights female, male, other and unknown
+	Sexes map[string]int `json:"sex_weights,omitempty"`
+	// Locales weights the locales patients' names are drawn from
+	Locales map[string]int `json:"locale_weights,omitempty"`
+	// Comorbidities are ICD-10 diagnoses recorded alongside the condition's, each
+	// drawn independently at its prevalence
+	Comorbidities []Comorbidity `json:"comorbidities,omitempty"`
+	// BuiltIn profiles cannot be replaced
+	BuiltIn bool `json:"built_in"`
+}
+
+// cohortProfiles are the built-in profiles. general matches the original mix.
+var cohortProfiles = map[string]CohortProfile{
+	"general": {
+		BuiltIn:     true,
+		Name:        "general",
+		Description: "Mixed ward population, a third of patients healthy",
+		Conditions: map[string]int{
+			ConditionHealthy: 2, ConditionTachycardia: 1, ConditionBradycardia: 1,
+			ConditionAtrialFibrillation: 1, ConditionCOPD: 1, ConditionSepsis: 1,
+		},
+	},
+	"cardiac": {
+		BuiltIn:     true,
+		Name:        "cardiac",
+		Description: "Cardiology and telemetry unit, dominated by arrhythmias",
+		Conditions: map[string]int{
+			ConditionHealthy: 1, ConditionTachycardia: 3, ConditionBradycardia: 2, ConditionAtrialFibrillation: 4,
+		},
+	},
+	"respiratory": {
+		BuiltIn:     true,
+		Name:        "respiratory",
+		Description: "Pulmonary unit, mostly COPD exacerbations",
+		Conditions: map[string]int{
+			ConditionHealthy: 1, ConditionCOPD: 5, ConditionSepsis: 1, ConditionTachycardia: 1,
+		},
+	},
+	"critical_care": {
+		BuiltIn:     true,
+		Name:        "critical_care",
+		Description: "Intensive care, high acuity with sepsis and respiratory failure",
+		Conditions: map[string]int{
+			ConditionSepsis: 4, ConditionCOPD: 2, ConditionAtrialFibrillation: 2, ConditionTachycardia: 1,
+		},
+	},
+}
+
+// defaultCohort is the profile used when none is configured
+const defaultCohort = "general"
+
+// pickCondition draws a condition according to the profile's weights
+func (c CohortProfile) pickCondition(rng *rand.Rand) string {
+	return pickKey(rng, c.Conditions)
+}
+
+// pickKey draws a key according to its weight
+func pickKey(rng *rand.Rand, weights map[string]int) string {
+	keys := make([]string, 0, len(weights))
+	total := 0
+	for key, weight := range weights {
+		keys = append(keys, key)
+		total += weight
+	}
+	// Map iteration order is random; sort so the draw depends only on the RNG
+	sort.Strings(keys)
+
+	n := rng.Intn(total)
+	for _, key := range keys {
+		if n -= weights[key]; n < 0 {
+			return key
+		}
+	}
+	return keys[len(keys)-1]
+}
+
+// pickWeighted draws one concept according to its weight
+func pickWeighted(rng *rand.Rand, candidates []weightedConcept) CodedConcept {
+	total := 0
+	for _, c := range candidates {
+		total += c.Weight
+	}
+	n := rng.Intn(total)
+	for _, c := range candidates {
+		if n -= c.Weight; n < 0 {
+			return c.Concept
+		}
+	}
+	return candidates[len(candidates)-1].Concept
+}
+
+// parseCodeSystems parses a comma-separated code system list
+func parseCodeSystems(value string) []string {
+	systems := make([]string, 0)
+	for _, s := range strings.Split(value, ",") {
+		if s = strings.TrimSpace(strings.ToLower(s)); s != "" {
+			systems = append(systems, s)
+		}
+	}
+	return systems
+}
+
+// assignCodes fills in the patient's coded record from their conditions, limited
+// to the selected code systems
+func (p *SyntheticPatient) assignCodes(rng *rand.Rand, systems []string) {
+	enabled := make(map[string]bool, len(systems))
+	for _, s := range systems {
+		enabled[s] = true
+	}
+
+	for _, condition := range p.Conditions {
+		coding := conditionCoding[condition]
+		if enabled[CodeSystemICD10] && len(coding.Diagnoses) > 0 {
+			p.Diagnoses = append(p.Diagnoses, pickWeighted(rng, coding.Diagnoses))
+		}
+		if enabled[CodeSystemCPT] {
+			p.Procedures = append(p.Procedures, coding.Procedures...)
+		}
+		if enabled[CodeSystemRxNorm] {
+			p.Medications = append(p.Medications, coding.Medications...)
+		}
+	}
+
+	if !enabled[CodeSystemLOINC] {
+		return
+	}
+	labs := p.labBands()
+	for _, code := range sortedLabCodes(labs) {
+		p.Labs = append(p.Labs, drawLab(rng, code, labs[code]))
+	}
+}
+
+// labBands returns the range each of the patient's labs is drawn from by LOINC code:
+// the basic panel's normal ranges, overridden by their conditions' abnormal ones
+func (p *SyntheticPatient) labBands() map[string]VitalRange {
+	labs := make(map[string]VitalRange)
+	for _, code := range basicPanel {
+		labs[code] = labCatalog[code].Normal
+	}
+	for _, condition := range p.Conditions {
+		for code, band := range conditionCoding[condition].AbnormalLabs {
+			labs[code] = band
+		}
+	}
+	return labs
+}
+
+// sortedLabCodes orders lab codes, so draws depend only on the RNG
+func sortedLabCodes(labs map[string]VitalRange) []string {
+	codes := make([]string, 0, len(labs))
+	for code := range labs {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// drawLab generates a result for a catalogued lab within the band
+func drawLab(rng *rand.Rand, code string, band VitalRange) LabResult {
+	spec := labCatalog[code]
+	value := band.Min + rng.Float64()*(band.Max-band.Min)
+	return LabResult{Test: spec.Concept, Value: math.Round(value*100) / 100, Unit: spec.Unit}
+}
+
+// cohortProfile returns the named built-in or loaded profile; an empty name selects
+// the default
+func cohortProfile(name string) (CohortProfile, bool) {
+	if name == "" {
+		name = defaultCohort
+	}
+	if profile, ok := cohortProfiles[name]; ok {
+		return profile, true
+	}
+	cohortMu.RLock()
+	defer cohortMu.RUnlock()
+	profile, ok := customCohorts[name]
+	return profile, ok
+}
+
+// validateCoding checks the cohort and code systems in a simulator configuration
+func validateCoding(cohort string, systems []string) error {
+	if _, ok := cohortProfile(cohort); !ok {
+		return fmt.Errorf("unknown cohort %q", cohort)
+	}
+	for _, s := range systems {
+		if _, ok := codeSystemURIs[s]; !ok {
+			return fmt.Errorf("unsupported code system %q", s)
+		}
+	}
+	return nil
+}
+
+// ListCohortProfilesHandler lists the cohort profiles, name locales and code systems
+// the generator supports
+func ListCohortProfilesHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	profiles := make([]CohortProfile, 0, len(cohortProfiles))
+	for _, p := range cohortProfiles {
+		profiles = append(profiles, p)
+	}
+	cohortMu.RLock()
+	for _, p := range customCohorts {
+		profiles = append(profiles, p)
+	}
+	locales := make([]SyntheticLocale, 0, len(syntheticLocales))
+	for _, l := range syntheticLocales {
+		locales = append(locales, l)
+	}
+	cohortMu.RUnlock()
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	sort.Slice(locales, func(i, j int) bool { return locales[i].Code < locales[j].Code })
+	RecordDeviceOperation("list_cohorts", "success", time.Since(start).Seconds())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"cohorts":      profiles,
+		"locales":      locales,
+		"code_systems": codeSystemURIs,
+	})
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+
+	"github.com/healthcare-gitops/common/usagestats"
+	"github.com/rs/zerolog/log"
+)
+
+// usageStats sends anonymous usage telemetry when USAGE_STATS_ENABLED opts in, and
+// previews it at /admin/usage-stats either way
+var usageStats = newUsageStats()
+
+func newUsageStats() *usagestats.Reporter {
+	cfg := usagestats.ConfigFromEnv()
+	cfg.OnSend = func(err error) {
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to send usage stats")
+			return
+		}
+		log.Debug().Msg("Usage stats sent")
+	}
+	return usagestats.NewReporter(cfg, usagestats.Source{Service: "medical-device-service", Version: apiSpecVersion, Flags: featureFlags})
+}
+
+// startUsageStats sends usage stats every USAGE_STATS_INTERVAL_HOURS while enabled
+func startUsageStats(ctx context.Context) {
+	if !usageStats.Enabled() {
+		return
+	}
+	log.Info().Msg("Anonymous usage stats reporting enabled; preview at /admin/usage-stats")
+	usageStats.Run(ctx)
+}
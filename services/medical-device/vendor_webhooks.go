@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// VendorEvent is the only data exposed to manufacturer webhooks. It deliberately
+// carries no location, patient, or free-text fields so templates cannot leak PHI.
+type VendorEvent struct {
+	EventID         string         `json:"event_id"`
+	Event           string         `json:"event"`
+	DeviceID        string         `json:"device_id"`
+	DeviceType      DeviceType     `json:"device_type"`
+	SerialNumber    string         `json:"serial_number"`
+	Manufacturer    string         `json:"manufacturer"`
+	Model           string         `json:"model"`
+	FirmwareVersion string         `json:"firmware_version"`
+	Status          DeviceStatus   `json:"status"`
+	ErrorCount      int            `json:"error_count"`
+	Condition       AlertCondition `json:"condition"`
+	Priority        AlertPriority  `json:"priority"`
+	OccurredAt      time.Time      `json:"occurred_at"`
+}
+
+// VendorWebhook notifies a manufacturer's service portal about devices it services
+type VendorWebhook struct {
+	ID           string    `json:"id"`
+	Manufacturer string    `json:"manufacturer"`
+	URL          string    `json:"url"`
+	Template     string    `json:"template,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	secret       string
+	tmpl         *template.Template
+}
+
+// vendorTemplateFuncs are available inside payload templates
+var vendorTemplateFuncs = template.FuncMap{
+	// json renders a value as a JSON literal so string fields are safely quoted
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"rfc3339": func(t time.Time) string { return t.UTC().Format(time.RFC3339) },
+}
+
+// VendorWebhookRegistry holds manufacturer webhook subscriptions
+type VendorWebhookRegistry struct {
+	hooks map[string]*VendorWebhook
+	seq   int
+	mu    sync.RWMutex
+}
+
+var vendorWebhooks *VendorWebhookRegistry
+
+// NewVendorWebhookRegistry creates an empty vendor webhook registry
+func NewVendorWebhookRegistry() *VendorWebhookRegistry {
+	return &VendorWebhookRegistry{
+		hooks: make(map[string]*VendorWebhook),
+	}
+}
+
+// compileVendorTemplate parses a payload template and checks it renders valid JSON
+func compileVendorTemplate(source string) (*template.Template, error) {
+	if source == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New("vendor").Funcs(vendorTemplateFuncs).Option("missingkey=error").Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+
+	var sample bytes.Buffer
+	if err := tmpl.Execute(&sample, VendorEvent{OccurredAt: time.Now()}); err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	if !json.Valid(sample.Bytes()) {
+		return nil, fmt.Errorf("template must render a JSON document")
+	}
+	return tmpl, nil
+}
+
+// renderVendorPayload renders the event with the webhook's template, or as plain JSON
+func (vw *VendorWebhook) renderVendorPayload(event VendorEvent) ([]byte, error) {
+	if vw.tmpl == nil {
+		return json.Marshal(event)
+	}
+	var buf bytes.Buffer
+	if err := vw.tmpl.Execute(&buf, event); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Register adds a vendor webhook
+func (vr *VendorWebhookRegistry) Register(hook VendorWebhook, secret string) (VendorWebhook, error) {
+	if err := validateWebhookURL(hook.URL); err != nil {
+		return VendorWebhook{}, err
+	}
+	tmpl, err := compileVendorTemplate(hook.Template)
+	if err != nil {
+		return VendorWebhook{}, err
+	}
+
+	vr.mu.Lock()
+	defer vr.mu.Unlock()
+
+	vr.seq++
+	hook.ID = fmt.Sprintf("VWH-%06d", vr.seq)
+	hook.CreatedAt = time.Now()
+	hook.secret = secret
+	hook.tmpl = tmpl
+	vr.hooks[hook.ID] = &hook
+	return hook, nil
+}
+
+// Remove deletes a vendor webhook
+func (vr *VendorWebhookRegistry) Remove(id string) error {
+	vr.mu.Lock()
+	defer vr.mu.Unlock()
+
+	if _, exists := vr.hooks[id]; !exists {
+		return fmt.Errorf("vendor webhook %s not found", id)
+	}
+	delete(vr.hooks, id)
+	return nil
+}
+
+// List returns all vendor webhooks ordered by ID
+func (vr *VendorWebhookRegistry) List() []VendorWebhook {
+	vr.mu.RLock()
+	defer vr.mu.RUnlock()
+
+	hooks := make([]VendorWebhook, 0, len(vr.hooks))
+	for _, hook := range vr.hooks {
+		hooks = append(hooks, *hook)
+	}
+	sort.Slice(hooks, func(i, j int) bool { return hooks[i].ID < hooks[j].ID })
+	return hooks
+}
+
+// forManufacturer returns the webhooks subscribed to a manufacturer
+func (vr *VendorWebhookRegistry) forManufacturer(manufacturer string) []*VendorWebhook {
+	vr.mu.RLock()
+	defer vr.mu.RUnlock()
+
+	matched := make([]*VendorWebhook, 0)
+	for _, hook := range vr.hooks {
+		if strings.EqualFold(hook.Manufacturer, manufacturer) {
+			matched = append(matched, hook)
+		}
+	}
+	return matched
+}
+
+// vendorEventFor builds the PHI-free vendor view of an alert. Callers must hold device.mu.
+func vendorEventFor(alert *Alert, device *MedicalDevice) VendorEvent {
+	return VendorEvent{
+		EventID:         alert.ID,
+		Event:           "device.error",
+		DeviceID:        device.ID,
+		DeviceType:      device.Type,
+		SerialNumber:    device.SerialNumber,
+		Manufacturer:    device.Manufacturer,
+		Model:           device.Model,
+		FirmwareVersion: device.FirmwareVersion,
+		Status:          device.Status,
+		ErrorCount:      device.ErrorCount,
+		Condition:       alert.Condition,
+		Priority:        alert.Priority,
+		OccurredAt:      alert.RaisedAt,
+	}
+}
+
+// notifyVendors delivers an error-state event to the device manufacturer's webhooks
+func notifyVendors(event VendorEvent) {
+	if vendorWebhooks == nil || event.Manufacturer == "" {
+		return
+	}
+	if _, err := checkEventSchema(event.Event, event); err != nil {
+		return
+	}
+
+	for _, hook := range vendorWebhooks.forManufacturer(event.Manufacturer) {
+		go func(hook *VendorWebhook) {
+			body, err := hook.renderVendorPayload(event)
+			if err != nil {
+				log.Error().Err(err).Str("webhook_id", hook.ID).Msg("Failed to render vendor webhook payload")
+				return
+			}
+
+			attempts, err := deliverWithRetry("vendor", hook.URL, hook.secret, event.Event, event.EventID, body, defaultWebhookRetryPolicy(), nil)
+			if err != nil {
+				log.Warn().Err(err).Str("webhook_id", hook.ID).Str("device_id", event.DeviceID).Int("attempts", attempts).Msg("Vendor webhook delivery failed")
+				return
+			}
+			log.Info().Str("webhook_id", hook.ID).Str("device_id", event.DeviceID).Int("attempts", attempts).Msg("Vendor webhook delivered")
+		}(hook)
+	}
+}
+
+// RegisterVendorWebhookHandler subscribes a manufacturer portal to error-state events
+func RegisterVendorWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	var req struct {
+		Manufacturer string `json:"manufacturer"`
+		URL          string `json:"url"`
+		Secret       string `json:"secret"`
+		Template     string `json:"template"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		RecordDeviceOperation("register_vendor_webhook", "error", time.Since(start).Seconds())
+		return
+	}
+	if req.Manufacturer == "" || len(req.Secret) < 16 {
+		http.Error(w, "manufacturer and a secret of at least 16 characters are required", http.StatusBadRequest)
+		RecordDeviceOperation("register_vendor_webhook", "error", time.Since(start).Seconds())
+		return
+	}
+
+	hook, err := vendorWebhooks.Register(VendorWebhook{
+		Manufacturer: req.Manufacturer,
+		URL:          req.URL,
+		Template:     req.Template,
+	}, req.Secret)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		RecordDeviceOperation("register_vendor_webhook", "error", time.Since(start).Seconds())
+		return
+	}
+
+	RecordDeviceOperation("register_vendor_webhook", "success", time.Since(start).Seconds())
+	log.Info().Str("webhook_id", hook.ID).Str("manufacturer", hook.Manufacturer).Msg("Vendor webhook registered")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(hook)
+}
+
+// ListVendorWebhooksHandler lists vendor webhooks; secrets are never returned
+func ListVendorWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	hooks := vendorWebhooks.List()
+	RecordDeviceOperation("list_vendor_webhooks", "success", time.Since(start).Seconds())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"webhooks": hooks,
+		"count":    len(hooks),
+	})
+}
+
+// DeleteVendorWebhookHandler removes a vendor webhook
+func DeleteVendorWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "webhookID")
+	start := time.Now()
+
+	if err := vendorWebhooks.Remove(id); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		RecordDeviceOperation("delete_vendor_webhook", "error", time.Since(start).Seconds())
+		return
+	}
+
+	RecordDeviceOperation("delete_vendor_webhook", "success", time.Since(start).Seconds())
+	log.Info().Str("webhook_id", id).Msg("Vendor webhook removed")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// webhookClient delivers outbound webhooks. Receivers must answer quickly; slow
+// endpoints are treated as failed deliveries.
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// Default retry backoff doubles from webhookRetryBase up to webhookRetryCap
+var (
+	webhookRetryBase = time.Second
+	webhookRetryCap  = time.Minute
+)
+
+var (
+	// Webhook deliveries by final outcome
+	webhookDeliveries = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "medical_device_webhook_deliveries_total",
+			Help: "Webhook deliveries by subscriber kind, event type and final result",
+		},
+		[]string{"kind", "event", "result"},
+	)
+
+	// Individual HTTP attempts, including retries
+	webhookAttempts = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "medical_device_webhook_attempts_total",
+			Help: "Webhook HTTP attempts by subscriber kind and result",
+		},
+		[]string{"kind", "result"},
+	)
+
+	// End-to-end delivery latency including retries
+	webhookDeliveryDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "medical_device_webhook_delivery_duration_seconds",
+			Help:    "Time from first attempt to final webhook delivery outcome",
+			Buckets: []float64{.01, .05, .1, .5, 1, 5, 15, 60, 300},
+		},
+		[]string{"kind"},
+	)
+)
+
+// signWebhook returns the hex HMAC-SHA256 over "<timestamp>.<body>". Including the
+// timestamp lets receivers reject replayed deliveries.
+func signWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// validateWebhookURL accepts absolute http(s) callback URLs
+func validateWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	return nil
+}
+
+// deliverWebhook POSTs a signed payload and treats any non-2xx response as a failure.
+// It returns the response status code, or 0 when no response was received.
+func deliverWebhook(ctx context.Context, target, secret, eventType, eventID string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "medical-device-service-webhooks/1.0")
+	req.Header.Set("X-Webhook-Event", eventType)
+	req.Header.Set("X-Webhook-ID", eventID)
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", "sha256="+signWebhook(secret, timestamp, body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook endpoint returned %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// deliverWithRetry delivers a webhook, retrying failures with the policy's exponential
+// backoff until its attempts or TTL run out. onAttempt, if set, is called after every
+// attempt and stops further retries by returning false. It returns the number of
+// attempts made and the last error, if delivery never succeeded.
+func deliverWithRetry(kind, target, secret, eventType, eventID string, body []byte, policy WebhookRetryPolicy, onAttempt func(WebhookAttempt) bool) (int, error) {
+	maxAttempts := policy.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	start := time.Now()
+	var err error
+	attempt := 1
+	for ; attempt <= maxAttempts; attempt++ {
+		attemptStart := time.Now()
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		var statusCode int
+		statusCode, err = deliverWebhook(ctx, target, secret, eventType, eventID, body)
+		cancel()
+
+		proceed := true
+		if onAttempt != nil {
+			record := WebhookAttempt{
+				Number:     attempt,
+				At:         attemptStart,
+				StatusCode: statusCode,
+				DurationMs: time.Since(attemptStart).Milliseconds(),
+			}
+			if err != nil {
+				record.Error = err.Error()
+			}
+			proceed = onAttempt(record)
+		}
+
+		if err == nil {
+			webhookAttempts.WithLabelValues(kind, "success").Inc()
+			break
+		}
+		webhookAttempts.WithLabelValues(kind, "failure").Inc()
+		if attempt == maxAttempts || !proceed {
+			break
+		}
+		delay := policy.backoff(attempt)
+		if time.Since(start)+delay > policy.ttl() {
+			err = fmt.Errorf("retry TTL of %s exceeded: %w", policy.ttl(), err)
+			break
+		}
+		time.Sleep(delay)
+	}
+	if attempt > maxAttempts {
+		attempt = maxAttempts
+	}
+
+	webhookDeliveryDuration.WithLabelValues(kind).Observe(time.Since(start).Seconds())
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	webhookDeliveries.WithLabelValues(kind, eventType, result).Inc()
+
+	return attempt, err
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// Delivery outcomes
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// defaultWebhookHistorySize is how many deliveries are kept per subscription
+const defaultWebhookHistorySize = 100
+
+var (
+	errDeliveryNotFound = errors.New("delivery not found")
+	errDeliveryPending  = errors.New("delivery is still in progress")
+)
+
+// WebhookAttempt is one HTTP attempt of a delivery. StatusCode is 0 when the endpoint
+// could not be reached.
+type WebhookAttempt struct {
+	Number     int       `json:"number"`
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"status_code"`
+	DurationMs int64     `json:"duration_ms"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// WebhookDelivery records one event sent to one subscription, with the exact payload
+// that was signed so partners can compare it with what their endpoint received.
+// Redeliveries keep the event ID, letting receivers deduplicate.
+type WebhookDelivery struct {
+	ID           string           `json:"id"`
+	WebhookID    string           `json:"webhook_id"`
+	EventID      string           `json:"event_id"`
+	EventType    string           `json:"event_type"`
+	Status       string           `json:"status"`
+	ResponseCode int              `json:"response_code,omitempty"`
+	Attempts     []WebhookAttempt `json:"attempts"`
+	Payload      json.RawMessage  `json:"payload"`
+	RedeliveryOf string           `json:"redelivery_of,omitempty"`
+	CreatedAt    time.Time        `json:"created_at"`
+	CompletedAt  *time.Time       `json:"completed_at,omitempty"`
+}
+
+// snapshot copies a delivery so it can be read without the dispatcher lock
+func (d *WebhookDelivery) snapshot() WebhookDelivery {
+	c := *d
+	c.Attempts = append([]WebhookAttempt(nil), d.Attempts...)
+	return c
+}
+
+// DeliveryFilter selects historical deliveries. Empty fields match everything.
+type DeliveryFilter struct {
+	EventType string
+	Status    string
+	Limit     int
+}
+
+// deliver records a pending delivery and sends it in the background, updating the
+// record after every attempt. It returns the delivery as first recorded.
+func (wd *WebhookDispatcher) deliver(sub WebhookSubscription, eventType, eventID string, body []byte, redeliveryOf string) WebhookDelivery {
+	wd.mu.Lock()
+	wd.deliverySeq++
+	delivery := &WebhookDelivery{
+		ID:           fmt.Sprintf("DLV-%08d", wd.deliverySeq),
+		WebhookID:    sub.ID,
+		EventID:      eventID,
+		EventType:    eventType,
+		Status:       DeliveryPending,
+		Attempts:     []WebhookAttempt{},
+		Payload:      json.RawMessage(body),
+		RedeliveryOf: redeliveryOf,
+		CreatedAt:    time.Now(),
+	}
+	history := append(wd.deliveries[sub.ID], delivery)
+	if len(history) > wd.historySize {
+		history = history[len(history)-wd.historySize:]
+	}
+	wd.deliveries[sub.ID] = history
+	recorded := delivery.snapshot()
+	wd.mu.Unlock()
+
+	go func() {
+		attempts, err := deliverWithRetry("subscriber", sub.URL, sub.secret, eventType, eventID, body, sub.RetryPolicy, func(attempt WebhookAttempt) bool {
+			wd.mu.Lock()
+			delivery.Attempts = append(delivery.Attempts, attempt)
+			delivery.ResponseCode = attempt.StatusCode
+			wd.mu.Unlock()
+			// Stop retrying once the subscription is disabled or removed
+			return wd.active(sub.ID)
+		})
+
+		now := time.Now()
+		wd.mu.Lock()
+		delivery.Status = DeliverySucceeded
+		if err != nil {
+			delivery.Status = DeliveryFailed
+		}
+		delivery.CompletedAt = &now
+		wd.mu.Unlock()
+
+		wd.recordResult(sub.ID, now, err)
+		if err != nil {
+			log.Warn().Err(err).Str("webhook_id", sub.ID).Str("event_id", eventID).Str("delivery_id", recorded.ID).Int("attempts", attempts).Msg("Webhook delivery failed")
+		}
+	}()
+	return recorded
+}
+
+// Deliveries returns a subscription's deliveries matching filter, newest first
+func (wd *WebhookDispatcher) Deliveries(webhookID string, filter DeliveryFilter) ([]WebhookDelivery, error) {
+	wd.mu.RLock()
+	defer wd.mu.RUnlock()
+
+	if _, exists := wd.subscriptions[webhookID]; !exists {
+		return nil, fmt.Errorf("webhook %s not found", webhookID)
+	}
+
+	history := wd.deliveries[webhookID]
+	matched := make([]WebhookDelivery, 0)
+	for i := len(history) - 1; i >= 0; i-- {
+		d := history[i]
+		if filter.EventType != "" && d.EventType != filter.EventType {
+			continue
+		}
+		if filter.Status != "" && d.Status != filter.Status {
+			continue
+		}
+		matched = append(matched, d.snapshot())
+		if filter.Limit > 0 && len(matched) == filter.Limit {
+			break
+		}
+	}
+	return matched, nil
+}
+
+// Delivery returns one delivery of a subscription
+func (wd *WebhookDispatcher) Delivery(webhookID, deliveryID string) (WebhookDelivery, error) {
+	wd.mu.RLock()
+	defer wd.mu.RUnlock()
+
+	d, err := wd.findDeliveryLocked(webhookID, deliveryID)
+	if err != nil {
+		return WebhookDelivery{}, err
+	}
+	return d.snapshot(), nil
+}
+
+// findDeliveryLocked looks up a delivery; callers must hold wd.mu
+func (wd *WebhookDispatcher) findDeliveryLocked(webhookID, deliveryID string) (*WebhookDelivery, error) {
+	if _, exists := wd.subscriptions[webhookID]; !exists {
+		return nil, fmt.Errorf("webhook %s not found", webhookID)
+	}
+	for _, d := range wd.deliveries[webhookID] {
+		if d.ID == deliveryID {
+			return d, nil
+		}
+	}
+	return nil, errDeliveryNotFound
+}
+
+// Redeliver sends a recorded payload again, re-signed with a fresh timestamp, to the
+// subscription's current URL. The event ID is unchanged. A disabled subscription gets
+// a single attempt, so owners can check a repaired endpoint before re-enabling it.
+func (wd *WebhookDispatcher) Redeliver(webhookID, deliveryID string) (WebhookDelivery, error) {
+	wd.mu.RLock()
+	original, err := wd.findDeliveryLocked(webhookID, deliveryID)
+	if err != nil {
+		wd.mu.RUnlock()
+		return WebhookDelivery{}, err
+	}
+	if original.Status == DeliveryPending {
+		wd.mu.RUnlock()
+		return WebhookDelivery{}, errDeliveryPending
+	}
+	sub := *wd.subscriptions[webhookID]
+	eventType, eventID, body := original.EventType, original.EventID, []byte(original.Payload)
+	wd.mu.RUnlock()
+
+	return wd.deliver(sub, eventType, eventID, body, deliveryID), nil
+}
+
+// ListWebhookDeliveriesHandler lists a subscription's delivery history, filtered by
+// event_type and status
+func ListWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "webhookID")
+	start := time.Now()
+
+	filter := DeliveryFilter{
+		EventType: r.URL.Query().Get("event_type"),
+		Status:    r.URL.Query().Get("status"),
+		Limit:     50,
+	}
+	if filter.EventType != "" && !webhookEventTypes[filter.EventType] {
+		http.Error(w, fmt.Sprintf("unknown event type %q", filter.EventType), http.StatusBadRequest)
+		RecordDeviceOperation("list_webhook_deliveries", "error", time.Since(start).Seconds())
+		return
+	}
+	switch filter.Status {
+	case "", DeliveryPending, DeliverySucceeded, DeliveryFailed:
+	default:
+		http.Error(w, "status must be pending, succeeded or failed", http.StatusBadRequest)
+		RecordDeviceOperation("list_webhook_deliveries", "error", time.Since(start).Seconds())
+		return
+	}
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > webhooks.historySize {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", webhooks.historySize), http.StatusBadRequest)
+			RecordDeviceOperation("list_webhook_deliveries", "error", time.Since(start).Seconds())
+			return
+		}
+		filter.Limit = n
+	}
+
+	deliveries, err := webhooks.Deliveries(id, filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		RecordDeviceOperation("list_webhook_deliveries", "error", time.Since(start).Seconds())
+		return
+	}
+
+	RecordDeviceOperation("list_webhook_deliveries", "success", time.Since(start).Seconds())
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"webhook_id": id,
+		"deliveries": deliveries,
+		"count":      len(deliveries),
+	})
+}
+
+// GetWebhookDeliveryHandler returns one delivery with its payload and attempts
+func GetWebhookDeliveryHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "webhookID")
+	deliveryID := chi.URLParam(r, "deliveryID")
+	start := time.Now()
+
+	delivery, err := webhooks.Delivery(id, deliveryID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		RecordDeviceOperation("get_webhook_delivery", "error", time.Since(start).Seconds())
+		return
+	}
+
+	RecordDeviceOperation("get_webhook_delivery", "success", time.Since(start).Seconds())
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(delivery)
+}
+
+// RedeliverWebhookHandler queues a recorded delivery to be sent again
+func RedeliverWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "webhookID")
+	deliveryID := chi.URLParam(r, "deliveryID")
+	start := time.Now()
+
+	delivery, err := webhooks.Redeliver(id, deliveryID)
+	if err != nil {
+		status := http.StatusNotFound
+		if errors.Is(err, errDeliveryPending) {
+			status = http.StatusConflict
+		}
+		http.Error(w, err.Error(), status)
+		RecordDeviceOperation("redeliver_webhook", "error", time.Since(start).Seconds())
+		return
+	}
+
+	RecordDeviceOperation("redeliver_webhook", "success", time.Since(start).Seconds())
+	log.Info().Str("webhook_id", id).Str("delivery_id", delivery.ID).Str("redelivery_of", deliveryID).Msg("Webhook redelivery queued")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(delivery)
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/healthcare-gitops/common/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog/log"
+)
+
+// Subscription states. A disabled subscription receives no new events until it is
+// re-enabled.
+const (
+	WebhookActive   = "active"
+	WebhookDisabled = "disabled"
+)
+
+// EventWebhookDisabled is sent to a subscription's notification URL when it is
+// disabled after sustained failure
+const EventWebhookDisabled = "webhook.disabled"
+
+// Retry policy limits
+const (
+	maxWebhookAttempts      = 20
+	maxWebhookBackoff       = time.Hour
+	maxWebhookRetryTTL      = 24 * time.Hour
+	defaultWebhookRetryTTL  = time.Hour
+	defaultDisableThreshold = 10
+)
+
+var errWebhookNotFound = errors.New("webhook not found")
+
+// Subscriptions disabled by the circuit breaker
+var webhookDisablements = promauto.NewCounter(
+	prometheus.CounterOpts{
+		Name: "medical_device_webhook_disablements_total",
+		Help: "Webhook subscriptions disabled after consecutive failed deliveries",
+	},
+)
+
+// WebhookRetryPolicy controls how one subscription's failed deliveries are retried
+// and when the subscription is disabled. Attempts stop at MaxAttempts or once the
+// next retry would start more than TTLSeconds after the first attempt, whichever
+// comes first.
+type WebhookRetryPolicy struct {
+	MaxAttempts           int     `json:"max_attempts"`
+	InitialBackoffSeconds float64 `json:"initial_backoff_seconds"`
+	MaxBackoffSeconds     float64 `json:"max_backoff_seconds"`
+	TTLSeconds            float64 `json:"ttl_seconds"`
+	// DisableAfterFailures disables the subscription after this many consecutive
+	// failed deliveries; -1 never disables it
+	DisableAfterFailures int `json:"disable_after_failures"`
+}
+
+// defaultWebhookRetryPolicy is the policy for subscriptions that do not set one.
+// WEBHOOK_MAX_ATTEMPTS, WEBHOOK_RETRY_TTL_SECONDS and WEBHOOK_DISABLE_AFTER_FAILURES
+// override the defaults; WEBHOOK_DISABLE_AFTER_FAILURES=0 turns disabling off.
+func defaultWebhookRetryPolicy() WebhookRetryPolicy {
+	maxAttempts := config.GetEnvInt("WEBHOOK_MAX_ATTEMPTS", 5)
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return WebhookRetryPolicy{
+		MaxAttempts:           maxAttempts,
+		InitialBackoffSeconds: webhookRetryBase.Seconds(),
+		MaxBackoffSeconds:     webhookRetryCap.Seconds(),
+		TTLSeconds:            float64(config.GetEnvInt("WEBHOOK_RETRY_TTL_SECONDS", int(defaultWebhookRetryTTL.Seconds()))),
+		DisableAfterFailures:  config.GetEnvInt("WEBHOOK_DISABLE_AFTER_FAILURES", defaultDisableThreshold),
+	}
+}
+
+// withDefaults fills unset fields from the default policy
+func (p WebhookRetryPolicy) withDefaults() WebhookRetryPolicy {
+	d := defaultWebhookRetryPolicy()
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = d.MaxAttempts
+	}
+	if p.InitialBackoffSeconds == 0 {
+		p.InitialBackoffSeconds = d.InitialBackoffSeconds
+	}
+	if p.MaxBackoffSeconds == 0 {
+		p.MaxBackoffSeconds = d.MaxBackoffSeconds
+	}
+	if p.TTLSeconds == 0 {
+		p.TTLSeconds = d.TTLSeconds
+	}
+	if p.DisableAfterFailures == 0 {
+		p.DisableAfterFailures = d.DisableAfterFailures
+	}
+	return p
+}
+
+// validate checks a policy after defaults have been applied
+func (p WebhookRetryPolicy) validate() error {
+	switch {
+	case p.MaxAttempts < 1 || p.MaxAttempts > maxWebhookAttempts:
+		return fmt.Errorf("max_attempts must be between 1 and %d", maxWebhookAttempts)
+	case p.InitialBackoffSeconds <= 0 || p.MaxBackoffSeconds > maxWebhookBackoff.Seconds():
+		return fmt.Errorf("backoff must be positive and at most %.0f seconds", maxWebhookBackoff.Seconds())
+	case p.InitialBackoffSeconds > p.MaxBackoffSeconds:
+		return fmt.Errorf("initial_backoff_seconds must not exceed max_backoff_seconds")
+	case p.TTLSeconds <= 0 || p.TTLSeconds > maxWebhookRetryTTL.Seconds():
+		return fmt.Errorf("ttl_seconds must be positive and at most %.0f", maxWebhookRetryTTL.Seconds())
+	case p.DisableAfterFailures < -1:
+		return fmt.Errorf("disable_after_failures must be -1 (never) or a positive count")
+	}
+	return nil
+}
+
+// ttl returns the retry window as a duration
+func (p WebhookRetryPolicy) ttl() time.Duration {
+	return time.Duration(p.TTLSeconds * float64(time.Second))
+}
+
+// backoff returns the delay before retry n (1-based), doubling from the initial
+// backoff up to the maximum, with up to 20% jitter
+func (p WebhookRetryPolicy) backoff(n int) time.Duration {
+	initial := time.Duration(p.InitialBackoffSeconds * float64(time.Second))
+	ceiling := time.Duration(p.MaxBackoffSeconds * float64(time.Second))
+	delay := initial << uint(n-1)
+	if delay <= 0 || delay > ceiling {
+		delay = ceiling
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/5+1))
+}
+
+// WebhookDisabledNotice is the payload sent to a subscription's notification URL
+// when it is disabled
+type WebhookDisabledNotice struct {
+	ID                  string    `json:"id"`
+	Type                string    `json:"type"`
+	OccurredAt          time.Time `json:"occurred_at"`
+	WebhookID           string    `json:"webhook_id"`
+	URL                 string    `json:"url"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	LastError           string    `json:"last_error,omitempty"`
+	Reason              string    `json:"reason"`
+}
+
+// notifyWebhookOwner tells a subscription's owner that it was disabled, signed with
+// the subscription's secret. Owners without a notification URL only get the log entry.
+func notifyWebhookOwner(sub WebhookSubscription) {
+	log.Warn().Str("webhook_id", sub.ID).Str("url", sub.URL).Int("consecutive_failures", sub.Stats.ConsecutiveFailures).Str("last_error", sub.Stats.LastError).Msg("Webhook disabled after sustained failure")
+	if sub.NotificationURL == "" {
+		return
+	}
+
+	notice := WebhookDisabledNotice{
+		ID:                  "NTF-" + sub.ID + "-" + sub.DisabledAt.UTC().Format("20060102T150405"),
+		Type:                EventWebhookDisabled,
+		OccurredAt:          *sub.DisabledAt,
+		WebhookID:           sub.ID,
+		URL:                 sub.URL,
+		ConsecutiveFailures: sub.Stats.ConsecutiveFailures,
+		LastError:           sub.Stats.LastError,
+		Reason:              sub.DisabledReason,
+	}
+	body, err := json.Marshal(notice)
+	if err != nil {
+		log.Error().Err(err).Str("webhook_id", sub.ID).Msg("Failed to encode webhook disabled notice")
+		return
+	}
+	if _, err := deliverWithRetry("owner", sub.NotificationURL, sub.secret, notice.Type, notice.ID, body, defaultWebhookRetryPolicy(), nil); err != nil {
+		log.Warn().Err(err).Str("webhook_id", sub.ID).Msg("Failed to notify webhook owner")
+	}
+}
+
+// Enable re-activates a subscription and clears its failure streak
+func (wd *WebhookDispatcher) Enable(id string) (WebhookSubscription, error) {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+
+	sub, exists := wd.subscriptions[id]
+	if !exists {
+		return WebhookSubscription{}, fmt.Errorf("%w: %s", errWebhookNotFound, id)
+	}
+	sub.Status = WebhookActive
+	sub.DisabledAt = nil
+	sub.DisabledReason = ""
+	sub.Stats.ConsecutiveFailures = 0
+	return *sub, nil
+}
+
+// SetRetryPolicy replaces a subscription's retry policy. Deliveries already in
+// progress keep the policy they started with.
+func (wd *WebhookDispatcher) SetRetryPolicy(id string, policy WebhookRetryPolicy) (WebhookSubscription, error) {
+	policy = policy.withDefaults()
+	if err := policy.validate(); err != nil {
+		return WebhookSubscription{}, err
+	}
+
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+
+	sub, exists := wd.subscriptions[id]
+	if !exists {
+		return WebhookSubscription{}, fmt.Errorf("%w: %s", errWebhookNotFound, id)
+	}
+	sub.RetryPolicy = policy
+	return *sub, nil
+}
+
+// EnableWebhookHandler re-enables a disabled subscription
+func EnableWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "webhookID")
+	start := time.Now()
+
+	sub, err := webhooks.Enable(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		RecordDeviceOperation("enable_webhook", "error", time.Since(start).Seconds())
+		return
+	}
+
+	RecordDeviceOperation("enable_webhook", "success", time.Since(start).Seconds())
+	log.Info().Str("webhook_id", id).Msg("Webhook enabled")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sub)
+}
+
+// UpdateWebhookRetryPolicyHandler replaces a subscription's retry policy; omitted
+// fields take the service defaults
+func UpdateWebhookRetryPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "webhookID")
+	start := time.Now()
+
+	var policy WebhookRetryPolicy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		RecordDeviceOperation("update_webhook_retry_policy", "error", time.Since(start).Seconds())
+		return
+	}
+
+	sub, err := webhooks.SetRetryPolicy(id, policy)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errWebhookNotFound) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		RecordDeviceOperation("update_webhook_retry_policy", "error", time.Since(start).Seconds())
+		return
+	}
+
+	RecordDeviceOperation("update_webhook_retry_policy", "success", time.Since(start).Seconds())
+	log.Info().Str("webhook_id", id).Int("max_attempts", sub.RetryPolicy.MaxAttempts).Float64("ttl_seconds", sub.RetryPolicy.TTLSeconds).Msg("Webhook retry policy updated")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sub)
+}
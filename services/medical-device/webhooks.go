@@ -0,0 +1,425 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/healthcare-gitops/common/config"
+	"github.com/healthcare-gitops/common/events"
+	"github.com/healthcare-gitops/common/resilience"
+	"github.com/rs/zerolog/log"
+)
+
+// Webhook event types
+const (
+	EventDeviceRegistered    = "device.registered"
+	EventDeviceStatusChanged = "device.status_changed"
+	EventAlertRaised         = "alert.raised"
+)
+
+var webhookEventTypes = map[string]bool{
+	EventDeviceRegistered:    true,
+	EventDeviceStatusChanged: true,
+	EventAlertRaised:         true,
+}
+
+// WebhookEvent is the JSON envelope delivered to subscribers. SchemaVersion names the
+// registered schema version the data was validated against; see GET /api/v1/schemas.
+type WebhookEvent struct {
+	ID            string      `json:"id"`
+	Type          string      `json:"type"`
+	SchemaVersion int         `json:"schema_version"`
+	OccurredAt    time.Time   `json:"occurred_at"`
+	Data          interface{} `json:"data"`
+}
+
+// StatusChange is the payload of a device.status_changed event
+type StatusChange struct {
+	DeviceID   string       `json:"device_id"`
+	DeviceType DeviceType   `json:"device_type"`
+	Location   string       `json:"location"`
+	Previous   DeviceStatus `json:"previous_status"`
+	Current    DeviceStatus `json:"status"`
+}
+
+// WebhookStats counts deliveries to one subscription. ConsecutiveFailures counts failed
+// deliveries since the last success and drives automatic disablement.
+type WebhookStats struct {
+	Delivered           int        `json:"delivered"`
+	Failed              int        `json:"failed"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastAttemptAt       *time.Time `json:"last_attempt_at,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+}
+
+// WebhookSubscription is a consumer callback URL. Empty Events receives every event type.
+// NotificationURL, if set, is told when the subscription is disabled.
+type WebhookSubscription struct {
+	ID              string             `json:"id"`
+	URL             string             `json:"url"`
+	Events          []string           `json:"events"`
+	Description     string             `json:"description,omitempty"`
+	NotificationURL string             `json:"notification_url,omitempty"`
+	RetryPolicy     WebhookRetryPolicy `json:"retry_policy"`
+	Status          string             `json:"status"`
+	DisabledAt      *time.Time         `json:"disabled_at,omitempty"`
+	DisabledReason  string             `json:"disabled_reason,omitempty"`
+	CreatedAt       time.Time          `json:"created_at"`
+	Stats           WebhookStats       `json:"stats"`
+	secret          string
+}
+
+// wants reports whether the subscription receives an event type
+func (ws *WebhookSubscription) wants(eventType string) bool {
+	if len(ws.Events) == 0 {
+		return true
+	}
+	for _, e := range ws.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDispatcher fans device events out to subscribed consumers and keeps a
+// bounded delivery history per subscription
+type WebhookDispatcher struct {
+	subscriptions map[string]*WebhookSubscription
+	deliveries    map[string][]*WebhookDelivery
+	historySize   int
+	seq           int
+	eventSeq      int
+	deliverySeq   int
+	mu            sync.RWMutex
+}
+
+var webhooks *WebhookDispatcher
+
+// NewWebhookDispatcher creates a dispatcher with no subscriptions. WEBHOOK_HISTORY_SIZE
+// sets how many deliveries are kept per subscription.
+func NewWebhookDispatcher() *WebhookDispatcher {
+	historySize := config.GetEnvInt("WEBHOOK_HISTORY_SIZE", defaultWebhookHistorySize)
+	if historySize < 1 {
+		historySize = defaultWebhookHistorySize
+	}
+	return &WebhookDispatcher{
+		subscriptions: make(map[string]*WebhookSubscription),
+		deliveries:    make(map[string][]*WebhookDelivery),
+		historySize:   historySize,
+	}
+}
+
+// Subscribe registers a callback URL. Unset retry policy fields take the defaults.
+func (wd *WebhookDispatcher) Subscribe(sub WebhookSubscription, secret string) (WebhookSubscription, error) {
+	if err := validateWebhookURL(sub.URL); err != nil {
+		return WebhookSubscription{}, err
+	}
+	if sub.NotificationURL != "" {
+		if err := validateWebhookURL(sub.NotificationURL); err != nil {
+			return WebhookSubscription{}, fmt.Errorf("notification_url: %w", err)
+		}
+	}
+	sub.RetryPolicy = sub.RetryPolicy.withDefaults()
+	if err := sub.RetryPolicy.validate(); err != nil {
+		return WebhookSubscription{}, err
+	}
+	for _, e := range sub.Events {
+		if !webhookEventTypes[e] {
+			return WebhookSubscription{}, fmt.Errorf("unknown event type %q", e)
+		}
+	}
+
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+
+	wd.seq++
+	sub.ID = fmt.Sprintf("WH-%06d", wd.seq)
+	sub.CreatedAt = time.Now()
+	sub.Status = WebhookActive
+	sub.DisabledAt = nil
+	sub.DisabledReason = ""
+	sub.Stats = WebhookStats{}
+	sub.secret = secret
+	if sub.Events == nil {
+		sub.Events = []string{}
+	}
+	wd.subscriptions[sub.ID] = &sub
+	return sub, nil
+}
+
+// Unsubscribe removes a subscription
+func (wd *WebhookDispatcher) Unsubscribe(id string) error {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+
+	if _, exists := wd.subscriptions[id]; !exists {
+		return fmt.Errorf("webhook %s not found", id)
+	}
+	delete(wd.subscriptions, id)
+	delete(wd.deliveries, id)
+	return nil
+}
+
+// List returns subscriptions with their delivery stats, ordered by ID
+func (wd *WebhookDispatcher) List() []WebhookSubscription {
+	wd.mu.RLock()
+	defer wd.mu.RUnlock()
+
+	subs := make([]WebhookSubscription, 0, len(wd.subscriptions))
+	for _, sub := range wd.subscriptions {
+		subs = append(subs, *sub)
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].ID < subs[j].ID })
+	return subs
+}
+
+// recordResult updates a subscription's delivery stats and disables it once its
+// consecutive failures reach the policy threshold. The owner is notified in the
+// background when that happens.
+func (wd *WebhookDispatcher) recordResult(id string, at time.Time, err error) {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+
+	sub, exists := wd.subscriptions[id]
+	if !exists {
+		return
+	}
+	sub.Stats.LastAttemptAt = &at
+	if err == nil {
+		sub.Stats.Delivered++
+		sub.Stats.ConsecutiveFailures = 0
+		sub.Stats.LastError = ""
+		return
+	}
+
+	sub.Stats.Failed++
+	sub.Stats.ConsecutiveFailures++
+	sub.Stats.LastError = err.Error()
+
+	threshold := sub.RetryPolicy.DisableAfterFailures
+	if sub.Status == WebhookActive && threshold > 0 && sub.Stats.ConsecutiveFailures >= threshold {
+		sub.Status = WebhookDisabled
+		sub.DisabledAt = &at
+		sub.DisabledReason = fmt.Sprintf("%d consecutive failed deliveries", sub.Stats.ConsecutiveFailures)
+		webhookDisablements.Inc()
+		go notifyWebhookOwner(*sub)
+	}
+}
+
+// active reports whether a subscription still exists and is enabled
+func (wd *WebhookDispatcher) active(id string) bool {
+	wd.mu.RLock()
+	defer wd.mu.RUnlock()
+
+	sub, exists := wd.subscriptions[id]
+	return exists && sub.Status == WebhookActive
+}
+
+// Publish delivers an event asynchronously to every interested, enabled subscriber.
+// Payloads that do not match the registered schema are rejected rather than sent.
+func (wd *WebhookDispatcher) Publish(eventType string, data interface{}) {
+	version, err := checkEventSchema(eventType, data)
+	if err != nil {
+		return
+	}
+
+	wd.mu.Lock()
+	wd.eventSeq++
+	event := WebhookEvent{
+		ID:            fmt.Sprintf("EVT-%08d", wd.eventSeq),
+		Type:          eventType,
+		SchemaVersion: version,
+		OccurredAt:    time.Now(),
+		Data:          data,
+	}
+	targets := make([]WebhookSubscription, 0)
+	for _, sub := range wd.subscriptions {
+		if sub.Status == WebhookActive && sub.wants(eventType) {
+			targets = append(targets, *sub)
+		}
+	}
+	wd.mu.Unlock()
+
+	if len(targets) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Error().Err(err).Str("event_type", eventType).Msg("Failed to encode webhook event")
+		return
+	}
+	deliverAll := func(body []byte) {
+		for _, sub := range targets {
+			wd.deliver(sub, event.Type, event.ID, body, "")
+		}
+	}
+	if eventKeys == nil {
+		deliverAll(body)
+		return
+	}
+
+	// Fetching a topic key may wait on phi-service, and callers can hold device locks
+	go func() {
+		encrypted, err := encryptEvent(eventType, event.ID, body)
+		if err != nil {
+			// Withheld rather than sent in the clear
+			log.Error().Err(err).Str("event_type", eventType).Str("event_id", event.ID).Msg("Failed to encrypt webhook event")
+			return
+		}
+		deliverAll(encrypted)
+	}()
+}
+
+// eventKeys supplies topic keys from phi-service; nil publishes events unencrypted
+var eventKeys events.KeyProvider
+
+// configureEventEncryption turns on payload encryption for subscription webhooks when
+// EVENT_KEYS_URL names phi-service. EVENT_KEYS_TOKEN must carry the events:keys scope;
+// EVENT_KEYS_ACTIVE_TTL bounds how long a rotated key stays in use.
+func configureEventEncryption() error {
+	keysURL := config.GetEnv("EVENT_KEYS_URL", "")
+	if keysURL == "" {
+		log.Warn().Msg("EVENT_KEYS_URL not set, webhook events are published unencrypted")
+		return nil
+	}
+	addDependencyCheck(dependencyPHIService, keysURL, nil)
+	cfg := events.KeyServiceConfig{
+		URL:        keysURL,
+		Token:      config.GetEnv("EVENT_KEYS_TOKEN", ""),
+		HTTPClient: resilience.ClientFromEnv(dependencyPHIService, nil, 10*time.Second, recordBreakerState),
+	}
+	if raw := config.GetEnv("EVENT_KEYS_ACTIVE_TTL", ""); raw != "" {
+		ttl, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("EVENT_KEYS_ACTIVE_TTL: %w", err)
+		}
+		cfg.ActiveTTL = ttl
+	}
+	keys, err := events.NewKeyService(cfg)
+	if err != nil {
+		return err
+	}
+	eventKeys = keys
+	log.Info().Str("key_service", keysURL).Msg("Webhook event encryption enabled")
+	return nil
+}
+
+// encryptEvent seals a delivery body under its topic's key
+func encryptEvent(eventType, eventID string, body []byte) ([]byte, error) {
+	schema, err := events.Default().Latest(eventType)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return events.Encrypt(ctx, eventKeys, schema.Topic, eventType, eventID, body)
+}
+
+// publishEvent publishes to the global dispatcher when one is configured
+func publishEvent(eventType string, data interface{}) {
+	if webhooks != nil {
+		webhooks.Publish(eventType, data)
+	}
+}
+
+// noteStatusLocked publishes a status-change event when a device's status differs from
+// the last one published. Callers must hold device.mu.
+func (dr *DeviceRegistry) noteStatusLocked(device *MedicalDevice) {
+	dr.mu.Lock()
+	previous, known := dr.publishedStatus[device.ID]
+	dr.publishedStatus[device.ID] = device.Status
+	dr.mu.Unlock()
+	dr.summary.observe(device.ID, device.Type, device.Status, time.Now())
+
+	if known && previous != device.Status {
+		captureEvent(CaptureKindStatus, device.ID, nil, device.Status)
+		publishEvent(EventDeviceStatusChanged, StatusChange{
+			DeviceID:   device.ID,
+			DeviceType: device.Type,
+			Location:   device.Location,
+			Previous:   previous,
+			Current:    device.Status,
+		})
+	}
+}
+
+// CreateWebhookHandler registers a consumer callback URL
+func CreateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	var req struct {
+		URL             string             `json:"url"`
+		Secret          string             `json:"secret"`
+		Events          []string           `json:"events"`
+		Description     string             `json:"description"`
+		NotificationURL string             `json:"notification_url"`
+		RetryPolicy     WebhookRetryPolicy `json:"retry_policy"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		RecordDeviceOperation("create_webhook", "error", time.Since(start).Seconds())
+		return
+	}
+	if len(req.Secret) < 16 {
+		http.Error(w, "secret of at least 16 characters is required", http.StatusBadRequest)
+		RecordDeviceOperation("create_webhook", "error", time.Since(start).Seconds())
+		return
+	}
+
+	sub, err := webhooks.Subscribe(WebhookSubscription{
+		URL:             req.URL,
+		Events:          req.Events,
+		Description:     req.Description,
+		NotificationURL: req.NotificationURL,
+		RetryPolicy:     req.RetryPolicy,
+	}, req.Secret)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		RecordDeviceOperation("create_webhook", "error", time.Since(start).Seconds())
+		return
+	}
+
+	RecordDeviceOperation("create_webhook", "success", time.Since(start).Seconds())
+	log.Info().Str("webhook_id", sub.ID).Strs("events", sub.Events).Msg("Webhook registered")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(sub)
+}
+
+// ListWebhooksHandler lists subscriptions and their delivery stats
+func ListWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	subs := webhooks.List()
+	RecordDeviceOperation("list_webhooks", "success", time.Since(start).Seconds())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"webhooks": subs,
+		"count":    len(subs),
+	})
+}
+
+// DeleteWebhookHandler removes a subscription
+func DeleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "webhookID")
+	start := time.Now()
+
+	if err := webhooks.Unsubscribe(id); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		RecordDeviceOperation("delete_webhook", "error", time.Since(start).Seconds())
+		return
+	}
+
+	RecordDeviceOperation("delete_webhook", "success", time.Since(start).Seconds())
+	log.Info().Str("webhook_id", id).Msg("Webhook removed")
+	w.WriteHeader(http.StatusNoContent)
+}
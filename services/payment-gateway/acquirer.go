@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Acquirer message formats
+const (
+	FormatISO8583 = "iso8583"
+	FormatNACHA   = "nacha"
+)
+
+// ISO 8583 response codes the acquirer processor interprets
+const (
+	iso8583Approved          = "00"
+	iso8583IssuerUnavailable = "91"
+	iso8583SystemMalfunction = "96"
+)
+
+// NACHA entry detail records and the transaction codes the processor originates
+const (
+	nachaEntryRecordLength = 94
+	nachaCheckingCredit    = "22"
+	nachaCheckingDebit     = "27"
+)
+
+// AcquirerConfig configures the generic acquirer processor
+type AcquirerConfig struct {
+	// MerchantID and TerminalID identify the gateway to the acquirer, ISO 8583 data
+	// elements 42 and 41
+	MerchantID string
+	TerminalID string
+	// OriginatorID is the originating bank's 8-digit routing number that starts NACHA
+	// trace numbers
+	OriginatorID string
+	// Link delivers messages to the acquirer. Nil approves every message without
+	// sending it, so the stub runs end to end until an adapter is plugged in.
+	Link AcquirerLink
+}
+
+// AcquirerMessage is one message to the acquirer: an ISO 8583 request for card
+// payments or a NACHA entry detail record for ACH debits and credits
+type AcquirerMessage struct {
+	Format string
+	// MTI is the ISO 8583 message type: 0100 authorization, 0220 completion, 0200
+	// refund, 0400 reversal
+	MTI string
+	// Fields are the ISO 8583 data elements by number
+	Fields map[int]string
+	// Record is the 94-character NACHA entry
+	Record string
+}
+
+// AcquirerResponse is the acquirer's answer to a message
+type AcquirerResponse struct {
+	// Code is the ISO 8583 response code, 00 when approved
+	Code     string
+	AuthCode string
+}
+
+// AcquirerLink sends a message to the acquirer, encoding it for the acquirer's
+// network, and returns its response
+type AcquirerLink func(ctx context.Context, msg AcquirerMessage) (AcquirerResponse, error)
+
+// acquirerProcessor is a stub for acquirers reached over ISO 8583 (cards) or NACHA
+// files (ACH). It builds each message from the transaction and hands it to the Link.
+// The gateway holds no card or account numbers: the customer ID travels in data
+// element 48 and the NACHA individual ID, for the adapter to resolve.
+type acquirerProcessor struct {
+	cfg   AcquirerConfig
+	stan  atomic.Uint32 // ISO 8583 system trace audit number
+	trace atomic.Uint32 // NACHA trace sequence
+}
+
+func newAcquirerProcessor(cfg AcquirerConfig) (*acquirerProcessor, error) {
+	if cfg.MerchantID == "" || cfg.TerminalID == "" {
+		return nil, errors.New("ACQUIRER_MERCHANT_ID and ACQUIRER_TERMINAL_ID are required for the acquirer payment processor")
+	}
+	if len(cfg.MerchantID) > 15 || len(cfg.TerminalID) > 8 {
+		return nil, errors.New("ACQUIRER_MERCHANT_ID must be at most 15 characters and ACQUIRER_TERMINAL_ID at most 8")
+	}
+	if cfg.OriginatorID != "" && !isDigits(cfg.OriginatorID, 8) {
+		return nil, errors.New("ACQUIRER_ORIGINATOR_ID must be an 8-digit routing number")
+	}
+	return &acquirerProcessor{cfg: cfg}, nil
+}
+
+func (a *acquirerProcessor) Name() string { return ProcessorAcquirer }
+
+// isACH reports whether a payment method is a bank debit, settled through NACHA
+func isACH(method string) bool {
+	switch strings.ToLower(method) {
+	case "ach", "bank_transfer", "echeck":
+		return true
+	}
+	return false
+}
+
+func (a *acquirerProcessor) Authorize(ctx context.Context, transactionID string, req PaymentRequest) (Authorization, error) {
+	if isACH(req.Method) {
+		// ACH has no authorization: the debit is originated on capture
+		if a.cfg.OriginatorID == "" {
+			return Authorization{}, errors.New("ACH payments need ACQUIRER_ORIGINATOR_ID")
+		}
+		return Authorization{AuthCode: "ACH", Reference: "ACH-" + strings.TrimPrefix(transactionID, "TXN-")}, nil
+	}
+	msg, err := a.iso8583("0100", "000000", Money{AmountMinor: req.AmountCents, Currency: strings.ToUpper(req.Currency)}, req.CustomerID)
+	if err != nil {
+		return Authorization{}, err
+	}
+	resp, err := a.send(ctx, msg)
+	if err != nil {
+		return Authorization{}, err
+	}
+	return Authorization{AuthCode: resp.AuthCode, Reference: msg.Fields[37]}, nil
+}
+
+func (a *acquirerProcessor) Capture(ctx context.Context, txn Transaction) error {
+	if isACH(txn.Method) {
+		return a.sendEntry(ctx, nachaCheckingDebit, txn.Amount, txn.CustomerID)
+	}
+	return a.sendFollowUp(ctx, "0220", "000000", txn.Amount, txn)
+}
+
+func (a *acquirerProcessor) Refund(ctx context.Context, txn Transaction, refund Refund) error {
+	if isACH(txn.Method) {
+		return a.sendEntry(ctx, nachaCheckingCredit, refund.Amount, txn.CustomerID)
+	}
+	return a.sendFollowUp(ctx, "0200", "200000", refund.Amount, txn)
+}
+
+func (a *acquirerProcessor) Void(ctx context.Context, txn Transaction) error {
+	if isACH(txn.Method) {
+		// Nothing was originated before capture
+		return nil
+	}
+	return a.sendFollowUp(ctx, "0400", "000000", txn.Amount, txn)
+}
+
+// sendFollowUp sends a message about an authorized card payment, quoting its
+// retrieval reference and authorization code
+func (a *acquirerProcessor) sendFollowUp(ctx context.Context, mti, processingCode string, amount Money, txn Transaction) error {
+	msg, err := a.iso8583(mti, processingCode, amount, txn.CustomerID)
+	if err != nil {
+		return err
+	}
+	msg.Fields[37] = txn.ProcessorReference
+	msg.Fields[38] = txn.AuthCode
+	_, err = a.send(ctx, msg)
+	return err
+}
+
+// sendEntry originates a NACHA PPD entry
+func (a *acquirerProcessor) sendEntry(ctx context.Context, transactionCode string, amount Money, customerID string) error {
+	record, err := nachaEntry(transactionCode, amount, customerID, a.cfg.OriginatorID, a.trace.Add(1)%10_000_000)
+	if err != nil {
+		return err
+	}
+	_, err = a.send(ctx, AcquirerMessage{Format: FormatNACHA, Record: record})
+	return err
+}
+
+// iso8583 builds a request's data elements. The retrieval reference number is the
+// Julian date and hour followed by the trace number, unique per terminal.
+func (a *acquirerProcessor) iso8583(mti, processingCode string, amount Money, customerID string) (AcquirerMessage, error) {
+	currency, ok := lookupCurrency(amount.Currency)
+	if !ok || !acquirerCurrencies[currency.Code] {
+		return AcquirerMessage{}, fmt.Errorf("%w: the acquirer does not settle %s", ErrInvalidAmount, amount.Currency)
+	}
+	now := time.Now().UTC()
+	stan := fmt.Sprintf("%06d", a.stan.Add(1)%1_000_000)
+	return AcquirerMessage{
+		Format: FormatISO8583,
+		MTI:    mti,
+		Fields: map[int]string{
+			3:  processingCode,
+			4:  fmt.Sprintf("%012d", amount.AmountMinor),
+			7:  now.Format("0102150405"),
+			11: stan,
+			37: fmt.Sprintf("%d%03d%02d", now.Year()%10, now.YearDay(), now.Hour()) + stan,
+			41: a.cfg.TerminalID,
+			42: a.cfg.MerchantID,
+			48: customerID,
+			49: currency.Numeric,
+		},
+	}, nil
+}
+
+// send delivers a message over the Link and interprets the response code
+func (a *acquirerProcessor) send(ctx context.Context, msg AcquirerMessage) (AcquirerResponse, error) {
+	if a.cfg.Link == nil {
+		log.Debug().Str("format", msg.Format).Str("mti", msg.MTI).Msg("Acquirer stub approving message without a link")
+		return AcquirerResponse{Code: iso8583Approved, AuthCode: fmt.Sprintf("%06d", a.stan.Load()%1_000_000)}, nil
+	}
+	resp, err := a.cfg.Link(ctx, msg)
+	if err != nil {
+		return AcquirerResponse{}, fmt.Errorf("%w: acquirer: %v", ErrProcessorUnavailable, err)
+	}
+	switch resp.Code {
+	case iso8583Approved:
+		return resp, nil
+	case iso8583IssuerUnavailable, iso8583SystemMalfunction:
+		return AcquirerResponse{}, fmt.Errorf("%w: acquirer response code %s", ErrProcessorUnavailable, resp.Code)
+	default:
+		return AcquirerResponse{}, fmt.Errorf("%w: acquirer response code %s", ErrPaymentDeclined, resp.Code)
+	}
+}
+
+// nachaEntry formats a PPD entry detail record. The receiver's routing and account
+// numbers are zero and blank: the adapter fills them from the customer's ACH mandate,
+// which the gateway does not hold.
+func nachaEntry(transactionCode string, amount Money, customerID, originatorID string, sequence uint32) (string, error) {
+	if amount.Currency != "USD" {
+		return "", fmt.Errorf("%w: ACH settles USD only", ErrInvalidAmount)
+	}
+	if amount.AmountMinor > 99_999_999_99 {
+		return "", fmt.Errorf("%w: ACH entries are at most 99999999.99", ErrInvalidAmount)
+	}
+	individualID := customerID
+	if len(individualID) > 15 {
+		individualID = individualID[:15]
+	}
+	record := "6" + transactionCode +
+		"000000000" + // receiving DFI routing number and check digit
+		fmt.Sprintf("%-17s", "") + // DFI account number
+		fmt.Sprintf("%010d", amount.AmountMinor) +
+		fmt.Sprintf("%-15s", individualID) +
+		fmt.Sprintf("%-22s", "") + // individual name, left out as it may be a patient's
+		"  " + // discretionary data
+		"0" + // no addenda
+		originatorID + fmt.Sprintf("%07d", sequence)
+	if len(record) != nachaEntryRecordLength {
+		return "", fmt.Errorf("NACHA entry is %d characters, not %d", len(record), nachaEntryRecordLength)
+	}
+	return record, nil
+}
+
+// acquirerCurrencies lists the currencies the acquirer settles; their ISO 4217
+// numbers come from the currency table
+var acquirerCurrencies = map[string]bool{
+	"AUD": true, "CAD": true, "CHF": true, "EUR": true, "GBP": true,
+	"INR": true, "JPY": true, "MXN": true, "NGN": true, "USD": true,
+}
+
+func isDigits(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	_, err := strconv.ParseUint(s, 10, 64)
+	return err == nil
+}
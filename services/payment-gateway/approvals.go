@@ -0,0 +1,238 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/healthcare-gitops/common/auth"
+	"github.com/healthcare-gitops/common/config"
+)
+
+// StatusPendingApproval is the state of an authorized payment at or over the approval
+// threshold, or one risk scoring sent for review. It is captured only once an approver
+// other than its initiator approves it, and voiding it rejects it.
+const StatusPendingApproval = "pending_approval"
+
+// ChangeApprove is the approval of a pending payment, as audited and counted
+const ChangeApprove = "approve"
+
+// SOX approval levels, lowest first
+const (
+	ApprovalLevelStaff    = "STAFF_LEVEL"
+	ApprovalLevelManager  = "MANAGER_LEVEL"
+	ApprovalLevelDirector = "DIRECTOR_LEVEL"
+	ApprovalLevelVP       = "VP_LEVEL"
+	ApprovalLevelCLevel   = "C_LEVEL"
+)
+
+var approvalLevels = []string{ApprovalLevelStaff, ApprovalLevelManager, ApprovalLevelDirector, ApprovalLevelVP, ApprovalLevelCLevel}
+
+// defaultApproverRoles maps auth-service roles to the level their holders approve at
+const defaultApproverRoles = "finance_manager=MANAGER_LEVEL,finance_director=DIRECTOR_LEVEL,finance_vp=VP_LEVEL,cfo=C_LEVEL"
+
+// ErrApprovalForbidden is returned when the caller may not approve a payment: they
+// initiated it, their role does not approve at the level it needs, or they are not
+// authenticated at all
+var ErrApprovalForbidden = errors.New("approval not allowed")
+
+// Why payments are held for approval
+const (
+	ApprovalReasonAmount     = "amount"
+	ApprovalReasonRiskReview = "risk_review"
+)
+
+// Approval records who must approve a pending payment and who did
+type Approval struct {
+	// Reason is amount for payments at or over the threshold, or risk_review for
+	// payments risk scoring sent for review
+	Reason string `json:"reason"`
+	// RequiredLevel is the lowest approval level that may approve the payment
+	RequiredLevel string `json:"required_level"`
+	// InitiatedBy is the authenticated user who made the payment, who cannot approve it
+	InitiatedBy  string     `json:"initiated_by"`
+	ApprovedBy   string     `json:"approved_by,omitempty"`
+	ApproverRole string     `json:"approver_role,omitempty"`
+	ApprovedAt   *time.Time `json:"approved_at,omitempty"`
+}
+
+// ApprovalConfig sets which payments wait for approval and who approves them
+type ApprovalConfig struct {
+	// Threshold is the amount, in major units of the reporting currency, from which
+	// payments wait for approval; zero approves nothing
+	Threshold float64
+	// Roles maps auth-service roles to the approval level their holders approve at
+	Roles map[string]string
+}
+
+// approvalConfigFromEnv reads SOX_DUAL_APPROVAL_THRESHOLD and SOX_APPROVER_ROLES, a
+// comma-separated list of role=LEVEL pairs
+func approvalConfigFromEnv() ApprovalConfig {
+	threshold, err := strconv.ParseFloat(config.GetEnv("SOX_DUAL_APPROVAL_THRESHOLD", "10000"), 64)
+	if err != nil {
+		// Kept invalid, so validation reports it
+		threshold = -1
+	}
+	roles := make(map[string]string)
+	for _, pair := range strings.Split(config.GetEnv("SOX_APPROVER_ROLES", defaultApproverRoles), ",") {
+		if pair = strings.TrimSpace(pair); pair != "" {
+			role, level, _ := strings.Cut(pair, "=")
+			roles[strings.TrimSpace(role)] = strings.ToUpper(strings.TrimSpace(level))
+		}
+	}
+	return ApprovalConfig{Threshold: threshold, Roles: roles}
+}
+
+// Validate checks the threshold and that every approver role maps to a known level
+func (c ApprovalConfig) Validate() error {
+	if c.Threshold < 0 || math.IsInf(c.Threshold, 0) || math.IsNaN(c.Threshold) {
+		return errors.New("SOX_DUAL_APPROVAL_THRESHOLD must be a non-negative amount")
+	}
+	roles := make([]string, 0, len(c.Roles))
+	for role := range c.Roles {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	for _, role := range roles {
+		if role == "" {
+			return errors.New("SOX_APPROVER_ROLES has an entry without a role")
+		}
+		if approvalLevelRank(c.Roles[role]) < 0 {
+			return fmt.Errorf("SOX_APPROVER_ROLES: %s has unknown approval level %q; use one of %s", role, c.Roles[role], strings.Join(approvalLevels, ", "))
+		}
+	}
+	return nil
+}
+
+// ApprovalPolicy holds payments at or over the threshold for approval. A nil policy
+// approves nothing.
+type ApprovalPolicy struct {
+	cfg ApprovalConfig
+}
+
+// NewApprovalPolicy checks cfg and builds the policy
+func NewApprovalPolicy(cfg ApprovalConfig) (*ApprovalPolicy, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &ApprovalPolicy{cfg: cfg}, nil
+}
+
+// Hold marks a newly authorized payment pending approval when its reporting amount
+// reaches the threshold or risk scoring sent it for review, recording initiator as the
+// user who cannot approve it. Reviews are held even by a nil policy, so they are
+// voided rather than captured unreviewed.
+func (p *ApprovalPolicy) Hold(txn *Transaction, initiator string) bool {
+	amount := majorUnits(txn.Amount)
+	if txn.ReportingAmount != nil {
+		amount = majorUnits(*txn.ReportingAmount)
+	}
+	reason := ApprovalReasonAmount
+	switch {
+	case txn.Risk != nil && txn.Risk.Decision == RiskReview:
+		reason = ApprovalReasonRiskReview
+	case p == nil || p.cfg.Threshold <= 0 || amount < p.cfg.Threshold:
+		return false
+	}
+	level := requiredApprovalLevel(amount)
+	if approvalLevelRank(level) < approvalLevelRank(ApprovalLevelManager) {
+		level = ApprovalLevelManager
+	}
+	txn.Status = StatusPendingApproval
+	txn.Approval = &Approval{Reason: reason, RequiredLevel: level, InitiatedBy: initiator}
+	return true
+}
+
+// levelFor returns the approval level of role, or "" when it approves nothing
+func (p *ApprovalPolicy) levelFor(role string) string {
+	if p == nil {
+		return ""
+	}
+	return p.cfg.Roles[role]
+}
+
+// Approve releases a pending payment for capture. The approver must be an
+// authenticated user other than the initiator, approving at level or above the level
+// the payment needs.
+func (txn *Transaction) Approve(approver auth.Identity, level string, at time.Time) error {
+	if txn.Status != StatusPendingApproval || txn.Approval == nil {
+		return fmt.Errorf("%w: only payments pending approval can be approved, this one is %s", errInvalidTransition, txn.Status)
+	}
+	if approver.UserID == "" {
+		return fmt.Errorf("%w: approvals need an authenticated approver", ErrApprovalForbidden)
+	}
+	if approver.UserID == txn.Approval.InitiatedBy {
+		return fmt.Errorf("%w: SOX segregation of duties, %s initiated the payment and cannot approve it", ErrApprovalForbidden, approver.UserID)
+	}
+	if approvalLevelRank(level) < approvalLevelRank(txn.Approval.RequiredLevel) {
+		return fmt.Errorf("%w: the payment needs %s approval or above, role %q approves at %s", ErrApprovalForbidden, txn.Approval.RequiredLevel, approver.Role, levelOrNone(level))
+	}
+	txn.Status = StatusAuthorized
+	txn.Approval.ApprovedBy = approver.UserID
+	txn.Approval.ApproverRole = approver.Role
+	txn.Approval.ApprovedAt = &at
+	return nil
+}
+
+// ApproveTransactionHandler handles POST /api/v1/transactions/{transactionID}/approve.
+// The approver is the authenticated caller, never a field of the request.
+func (h PaymentHandler) ApproveTransactionHandler(w http.ResponseWriter, r *http.Request) {
+	approver, _ := auth.FromContext(r.Context())
+	h.changeTransaction(w, r, ChangeApprove, func(_ PaymentProcessor, txn *Transaction, req TransactionChangeRequest, at time.Time) (string, error) {
+		if req.Amount != nil {
+			return "", fmt.Errorf("%w: an approval covers the whole payment and takes no amount", ErrInvalidAmount)
+		}
+		level := h.Approvals.levelFor(approver.Role)
+		if err := txn.Approve(approver, level, at); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Payment of %s initiated by %s approved by %s at %s: %s", formatMoney(txn.Amount), txn.Approval.InitiatedBy, approver.UserID, level, reasonOrNone(req.Reason)), nil
+	})
+}
+
+// requiredApprovalLevel is the SOX approval hierarchy: the lowest level that may
+// approve amount, in major units of the reporting currency
+func requiredApprovalLevel(amount float64) string {
+	switch {
+	case amount >= 1000000: // $1M+
+		return ApprovalLevelCLevel
+	case amount >= 100000: // $100K+
+		return ApprovalLevelVP
+	case amount >= 10000: // $10K+
+		return ApprovalLevelDirector
+	case amount >= 1000: // $1K+
+		return ApprovalLevelManager
+	}
+	return ApprovalLevelStaff
+}
+
+// approvalLevelRank orders approval levels, -1 for an unknown one
+func approvalLevelRank(level string) int {
+	for i, l := range approvalLevels {
+		if l == level {
+			return i
+		}
+	}
+	return -1
+}
+
+// majorUnits converts an amount in minor units to a decimal, e.g. 12500 USD to 125
+func majorUnits(m Money) float64 {
+	exponent := 2
+	if c, ok := lookupCurrency(m.Currency); ok {
+		exponent = c.Exponent
+	}
+	return float64(m.AmountMinor) / math.Pow10(exponent)
+}
+
+func levelOrNone(level string) string {
+	if level == "" {
+		return "no level"
+	}
+	return level
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/healthcare-gitops/common/auth"
+)
+
+func TestApprovalConfig(t *testing.T) {
+	t.Setenv("SOX_DUAL_APPROVAL_THRESHOLD", "")
+	t.Setenv("SOX_APPROVER_ROLES", "")
+	cfg := approvalConfigFromEnv()
+	if cfg.Threshold != 10000 || len(cfg.Roles) != 4 || cfg.Roles["cfo"] != ApprovalLevelCLevel {
+		t.Fatalf("unexpected default approval configuration: %+v", cfg)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("SOX_APPROVER_ROLES", "controller=vp_level, treasurer = c_level")
+	if cfg := approvalConfigFromEnv(); len(cfg.Roles) != 2 || cfg.Roles["treasurer"] != ApprovalLevelCLevel || cfg.Roles["controller"] != ApprovalLevelVP {
+		t.Fatalf("unexpected approver roles: %+v", cfg.Roles)
+	}
+
+	for name, cfg := range map[string]ApprovalConfig{
+		"negative threshold": {Threshold: -1},
+		"unknown level":      {Threshold: 10000, Roles: map[string]string{"controller": "SVP_LEVEL"}},
+		"missing level":      {Threshold: 10000, Roles: map[string]string{"controller": ""}},
+		"missing role":       {Threshold: 10000, Roles: map[string]string{"": ApprovalLevelVP}},
+	} {
+		if _, err := NewApprovalPolicy(cfg); err == nil {
+			t.Errorf("%s: expected the configuration to be refused", name)
+		}
+	}
+}
+
+func TestApprovalWorkflow(t *testing.T) {
+	approvals, err := NewApprovalPolicy(ApprovalConfig{Threshold: 10000, Roles: map[string]string{"finance_director": ApprovalLevelDirector, "finance_vp": ApprovalLevelVP}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	repository := newMemoryRepository(10)
+	h := PaymentHandler{
+		Repository:   repository,
+		Transactions: NewTransactionStore(),
+		SOX:          &SOXFinancialControlManager{},
+		Approvals:    approvals,
+	}
+
+	// Identities stand in for auth-service introspection
+	identities := map[string]auth.Identity{
+		"clerk":    {UserID: "clerk-1", Role: "payment_processor"},
+		"director": {UserID: "dana", Role: "finance_director"},
+		"vp":       {UserID: "victor", Role: "finance_vp"},
+		"self":     {UserID: "victor", Role: "finance_vp"},
+	}
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if id, ok := identities[req.Header.Get("X-Test-Identity")]; ok {
+				req = req.WithContext(auth.WithIdentity(req.Context(), id))
+			}
+			next.ServeHTTP(w, req)
+		})
+	})
+	r.Post("/api/v2/payments", h.CreatePayment)
+	r.Post("/api/v1/transactions/{transactionID}/capture", h.CaptureTransactionHandler)
+	r.Post("/api/v1/transactions/{transactionID}/void", h.VoidTransactionHandler)
+	r.Post("/api/v1/transactions/{transactionID}/approve", h.ApproveTransactionHandler)
+	post := func(as, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+		req.Header.Set("X-Test-Identity", as)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+	pay := func(as string, amountMinor int) PaymentResponseV2 {
+		t.Helper()
+		rr := post(as, "/api/v2/payments", fmt.Sprintf(`{"amount": {"amount_minor": %d, "currency": "USD"}, "customer_id": "cust-1", "method": "card"}`, amountMinor))
+		var resp PaymentResponseV2
+		if rr.Code != http.StatusCreated || json.NewDecoder(rr.Body).Decode(&resp) != nil {
+			t.Fatalf("payment expected 201, got %d: %s", rr.Code, rr.Body)
+		}
+		return resp
+	}
+
+	if resp := pay("clerk", 999999); resp.Status != StatusAuthorized {
+		t.Fatalf("expected a payment under the threshold authorized, got %s", resp.Status)
+	}
+	resp := pay("clerk", 15000000)
+	if resp.Status != StatusPendingApproval {
+		t.Fatalf("expected a $150,000 payment held for approval, got %s", resp.Status)
+	}
+	txn, err := repository.Get(t.Context(), resp.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txn.Approval == nil || txn.Approval.RequiredLevel != ApprovalLevelVP || txn.Approval.InitiatedBy != "clerk-1" {
+		t.Fatalf("unexpected approval on the held payment: %+v", txn.Approval)
+	}
+
+	path := "/api/v1/transactions/" + resp.ID
+	if rr := post("clerk", path+"/capture", ""); rr.Code != http.StatusConflict || !strings.Contains(rr.Body.String(), "awaiting VP_LEVEL approval") {
+		t.Fatalf("capture of a held payment expected 409, got %d: %s", rr.Code, rr.Body)
+	}
+	if rr := post("", path+"/approve", ""); rr.Code != http.StatusForbidden {
+		t.Fatalf("unauthenticated approval expected 403, got %d: %s", rr.Code, rr.Body)
+	}
+	if rr := post("clerk", path+"/approve", ""); rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "segregation of duties") {
+		t.Fatalf("approval by the initiator expected 403, got %d: %s", rr.Code, rr.Body)
+	}
+	if rr := post("director", path+"/approve", ""); rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "needs VP_LEVEL") {
+		t.Fatalf("approval below the required level expected 403, got %d: %s", rr.Code, rr.Body)
+	}
+	// A reason or any other field naming an approver changes nothing
+	if rr := post("director", path+"/approve", `{"reason": "approved by victor"}`); rr.Code != http.StatusForbidden {
+		t.Fatalf("approval naming another approver expected 403, got %d", rr.Code)
+	}
+	rr := post("vp", path+"/approve", `{"reason": "Budgeted capital purchase"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("approval expected 200, got %d: %s", rr.Code, rr.Body)
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&txn); err != nil {
+		t.Fatal(err)
+	}
+	if txn.Status != StatusAuthorized || txn.Approval.ApprovedBy != "victor" || txn.Approval.ApproverRole != "finance_vp" || txn.Approval.ApprovedAt == nil {
+		t.Fatalf("unexpected approved transaction: %+v %+v", txn, txn.Approval)
+	}
+	if rr := post("vp", path+"/approve", ""); rr.Code != http.StatusConflict {
+		t.Fatalf("second approval expected 409, got %d", rr.Code)
+	}
+	if rr := post("clerk", path+"/capture", ""); rr.Code != http.StatusOK {
+		t.Fatalf("capture after approval expected 200, got %d: %s", rr.Code, rr.Body)
+	}
+
+	// The approver cannot approve their own payment either, and a void rejects it
+	resp = pay("self", 2000000)
+	if resp.Status != StatusPendingApproval {
+		t.Fatalf("expected a $20,000 payment held for approval, got %s", resp.Status)
+	}
+	path = "/api/v1/transactions/" + resp.ID
+	if rr := post("vp", path+"/approve", ""); rr.Code != http.StatusForbidden {
+		t.Fatalf("approval of one's own payment expected 403, got %d", rr.Code)
+	}
+	if rr := post("clerk", path+"/void", `{"reason": "Not approved"}`); rr.Code != http.StatusOK {
+		t.Fatalf("void of a held payment expected 200, got %d: %s", rr.Code, rr.Body)
+	}
+
+	actions := ""
+	for _, a := range h.SOX.RecentAuditTrails(20) {
+		actions += a.Action + " "
+	}
+	want := "VOID APPROVE_REJECTED CAPTURE APPROVE_REJECTED APPROVE APPROVE_REJECTED APPROVE_REJECTED APPROVE_REJECTED APPROVE_REJECTED CAPTURE_REJECTED "
+	if actions != want {
+		t.Fatalf("expected SOX entries %q, got %q", want, actions)
+	}
+	approved, err := h.SOX.QueryAuditTrails(SOXAuditFilter{Action: "approve"})
+	if err != nil || len(approved) != 1 || approved[0].UserID != "victor" || !strings.Contains(approved[0].Details, "initiated by clerk-1") {
+		t.Fatalf("unexpected approval audit: %+v", approved)
+	}
+}
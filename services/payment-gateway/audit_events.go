@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/healthcare-gitops/common/audit"
+	"github.com/healthcare-gitops/common/tlsconfig"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// auditEvents is the shared audit bus payment mutations are emitted to; main flushes
+// it on shutdown
+var auditEvents *audit.Emitter
+
+// openAuditEvents opens the audit sink cfg selects
+func openAuditEvents(ctx context.Context, cfg audit.Config) (*audit.Emitter, error) {
+	cfg.TraceID = traceIDFromContext
+	cfg.OnWrite = func(events int, err error) {
+		if err != nil {
+			log.Warn().Err(err).Int("events", events).Msg("Audit sink unavailable, events written to stderr")
+		}
+	}
+	return audit.Open(ctx, "payment-gateway", cfg)
+}
+
+// traceIDFromContext returns the trace ID of the request's span
+func traceIDFromContext(ctx context.Context) string {
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		return sc.TraceID().String()
+	}
+	return ""
+}
+
+// auditMiddleware emits an audit event to events for every mutating request, named
+// by its method and route pattern. Callers are named by their bearer token, or else
+// their client certificate.
+func auditMiddleware(events *audit.Emitter) func(http.Handler) http.Handler {
+	return events.Middleware(audit.MiddlewareOptions{
+		Action: func(r *http.Request) string {
+			if rc := chi.RouteContext(r.Context()); rc != nil && rc.RoutePattern() != "" {
+				return r.Method + " " + rc.RoutePattern()
+			}
+			return r.Method + " " + r.URL.Path
+		},
+		Actor: func(r *http.Request) string {
+			if id, ok := tlsconfig.FromContext(r.Context()); ok {
+				return id.Name()
+			}
+			return ""
+		},
+		RequestID: func(r *http.Request) string {
+			return middleware.GetReqID(r.Context())
+		},
+	})
+}
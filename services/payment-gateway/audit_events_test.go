@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/healthcare-gitops/common/audit"
+	"github.com/healthcare-gitops/common/auth"
+	"github.com/healthcare-gitops/common/clientip"
+)
+
+// memorySink keeps the events written to it
+type memorySink struct {
+	mu     sync.Mutex
+	events []audit.Event
+}
+
+func (s *memorySink) Write(_ context.Context, events []audit.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, events...)
+	return nil
+}
+
+func (s *memorySink) Close() error { return nil }
+
+func TestAuditMiddlewareEmitsMutations(t *testing.T) {
+	authService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer writer" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(auth.Introspection{Active: true, UserID: "billing", Scopes: []string{"payment:write"}})
+	}))
+	defer authService.Close()
+
+	sink := &memorySink{}
+	events := audit.NewEmitter("payment-gateway", sink, audit.Config{FlushInterval: 10 * time.Millisecond})
+	write := auth.NewIntrospector(auth.Config{IntrospectURL: authService.URL}).Require("payment:write")
+
+	router := chi.NewRouter()
+	router.Use(auditMiddleware(events))
+	router.With(write).Post("/api/v1/transactions/{transactionID}/void", func(w http.ResponseWriter, r *http.Request) {
+		audit.Annotate(r.Context(), "reason", "duplicate")
+		http.Error(w, "transaction not found", http.StatusNotFound)
+	})
+	router.Get("/api/v1/transactions/{transactionID}", func(w http.ResponseWriter, r *http.Request) {})
+
+	for _, tc := range []struct{ method, token string }{
+		{http.MethodPost, "writer"},
+		{http.MethodPost, "forged"},
+		{http.MethodGet, "writer"},
+	} {
+		req := httptest.NewRequest(tc.method, "/api/v1/transactions/TXN-1/void", nil)
+		if tc.method == http.MethodGet {
+			req = httptest.NewRequest(tc.method, "/api/v1/transactions/TXN-1", nil)
+		}
+		req.Header.Set("Authorization", "Bearer "+tc.token)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if err := events.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sink.events) != 2 {
+		t.Fatalf("got %d events, want one per POST: %+v", len(sink.events), sink.events)
+	}
+	served, denied := sink.events[0], sink.events[1]
+	if served.Actor != "billing" || served.Action != "POST /api/v1/transactions/{transactionID}/void" ||
+		served.Resource != "/api/v1/transactions/TXN-1/void" || served.Outcome != audit.OutcomeFailure ||
+		served.Service != "payment-gateway" || served.Details["status"] != "404" || served.Details["reason"] != "duplicate" {
+		t.Errorf("served event = %+v", served)
+	}
+	if denied.Actor != "anonymous" || denied.Outcome != audit.OutcomeDenied {
+		t.Errorf("denied event = %+v", denied)
+	}
+	if served.ID == "" || served.ID == denied.ID || served.Schema != audit.SchemaVersion {
+		t.Errorf("events need distinct IDs and the schema version: %q, %q", served.ID, denied.ID)
+	}
+}
+
+// TestAuditSourceIPFromTrustedProxies verifies the audit trail names the client a
+// trusted proxy forwarded for, and ignores X-Forwarded-For from anyone else
+func TestAuditSourceIPFromTrustedProxies(t *testing.T) {
+	proxies, err := clientip.Parse([]string{"10.1.0.0/16"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := &memorySink{}
+	events := audit.NewEmitter("payment-gateway", sink, audit.Config{FlushInterval: 10 * time.Millisecond})
+
+	router := chi.NewRouter()
+	router.Use(proxies.Middleware)
+	router.Use(auditMiddleware(events))
+	router.Post("/api/v1/refunds", func(w http.ResponseWriter, r *http.Request) {})
+
+	for _, peer := range []string{"203.0.113.9:4711", "10.1.2.3:4711"} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/refunds", nil)
+		req.RemoteAddr = peer
+		req.Header.Set("X-Forwarded-For", "198.51.100.7")
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if err := events.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sink.events) != 2 {
+		t.Fatalf("got %d events, want 2", len(sink.events))
+	}
+	if forged := sink.events[0].SourceIP; forged != "203.0.113.9" {
+		t.Errorf("an untrusted peer's X-Forwarded-For should be ignored, got source IP %q", forged)
+	}
+	if forwarded := sink.events[1].SourceIP; forwarded != "198.51.100.7" {
+		t.Errorf("a trusted proxy's X-Forwarded-For should name the client, got source IP %q", forwarded)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/healthcare-gitops/common/auth"
+	"github.com/healthcare-gitops/common/selfscan"
+)
+
+// newAuthenticatedServer serves the gateway behind a fake auth-service knowing a
+// payment:read, a payment:write and an admin token
+func newAuthenticatedServer(t *testing.T) http.Handler {
+	t.Helper()
+	t.Setenv("FEATURE_USAGE_METERING", "false")
+	return NewServer(Config{
+		Port:                "0",
+		ServiceName:         "payment-gateway",
+		MaxProcessingMillis: 50,
+		SelfScanToken:       "selfscan-token-for-payment-tests",
+		Auth:                auth.Config{IntrospectURL: startFakeAuthService(t)},
+	}).Handler
+}
+
+// startFakeAuthService serves introspection of the "reader", "writer" and "admin"
+// tokens, returning its URL
+func startFakeAuthService(t *testing.T) string {
+	t.Helper()
+	exp := time.Now().Add(time.Hour).Unix()
+	tokens := map[string]auth.Introspection{
+		"reader": {Active: true, UserID: "analyst", Role: "user", Scopes: []string{"payment:read"}, Exp: exp},
+		"writer": {Active: true, UserID: "billing", Role: "service", Scopes: []string{"payment:write"}, Exp: exp},
+		"admin":  {Active: true, UserID: "root", Role: "admin", Scopes: []string{"admin"}, Exp: exp},
+	}
+	authService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info, ok := tokens[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(info)
+	}))
+	t.Cleanup(authService.Close)
+	return authService.URL
+}
+
+func TestPaymentRoutesRequireScopes(t *testing.T) {
+	h := newAuthenticatedServer(t)
+
+	cases := []struct {
+		method, path, token, body string
+		want                      int
+	}{
+		{http.MethodPost, "/api/v2/payments", "", `{"amount":10,"currency":"USD"}`, http.StatusUnauthorized},
+		{http.MethodPost, "/api/v2/payments", "forged", `{"amount":10,"currency":"USD"}`, http.StatusUnauthorized},
+		{http.MethodPost, "/api/v2/payments", "reader", `{"amount":10,"currency":"USD"}`, http.StatusForbidden},
+		{http.MethodPost, "/charge", "reader", `{"amount":10,"currency":"USD"}`, http.StatusForbidden},
+		{http.MethodGet, "/api/v1/summary", "writer", "", http.StatusForbidden},
+		{http.MethodGet, "/api/v1/summary", "reader", "", http.StatusOK},
+		{http.MethodGet, "/api/v1/summary", "admin", "", http.StatusOK},
+		{http.MethodGet, "/api/v1/transactions?status=authorized", "", "", http.StatusUnauthorized},
+		{http.MethodGet, "/api/v1/transactions?status=authorized", "writer", "", http.StatusForbidden},
+		{http.MethodGet, "/api/v1/transactions?status=authorized", "reader", "", http.StatusOK},
+		{http.MethodGet, "/api/v1/transactions/TXN-unknown", "reader", "", http.StatusNotFound},
+		{http.MethodGet, "/compliance/status", "writer", "", http.StatusForbidden},
+		{http.MethodGet, "/compliance/status", "admin", "", http.StatusOK},
+		{http.MethodGet, "/api/v1/honeytokens", "reader", "", http.StatusForbidden},
+		{http.MethodGet, "/api/v1/honeytokens", "admin", "", http.StatusOK},
+		{http.MethodPost, "/api/v1/notifications/status", "", `{"message_id":"MSG-00000001","status":"failed"}`, http.StatusUnauthorized},
+		{http.MethodPost, "/api/v1/notifications/status", "reader", `{"message_id":"MSG-00000001","status":"failed"}`, http.StatusForbidden},
+		{http.MethodPost, "/api/v1/notifications/status", "writer", `{"message_id":"MSG-00000001","status":"failed"}`, http.StatusNotFound},
+		{http.MethodGet, "/health", "", "", http.StatusOK},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if rr.Code != tc.want {
+			t.Errorf("%s %s with %q: expected %d, got %d: %s", tc.method, tc.path, tc.token, tc.want, rr.Code, rr.Body)
+		}
+	}
+}
+
+func TestSelfScanCleanWithAuthentication(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "production")
+	h := newAuthenticatedServer(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/selfscan", nil)
+	req.Header.Set("X-Admin-Token", "selfscan-token-for-payment-tests")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	var report selfscan.Report
+	if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range report.Findings {
+		if f.Check == selfscan.CheckAdminAuth {
+			t.Errorf("expected admin routes to be authenticated, got %+v", f)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	_ "embed"
+	"time"
+
+	"github.com/healthcare-gitops/common/features"
+)
+
+// apiSpecVersion is the version of openapi.yaml this build implements
+const apiSpecVersion = "1.29.0"
+
+// openAPISpec is openapi.yaml, served as JSON at /openapi.json
+//
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+// requestTimeout bounds every request through the router
+const requestTimeout = 30 * time.Second
+
+// Feature flags, each overridable with FEATURE_<NAME>
+const (
+	FeatureUsageMetering       = "usage_metering"
+	FeatureComplianceReporting = "compliance_reporting"
+	FeatureTransactionSearch   = "transaction_search"
+	FeaturePatientMessaging    = "patient_messaging"
+	FeatureHoneytokens         = "honeytokens"
+	FeatureInsuranceClaims     = "insurance_claims"
+	FeatureWebhooks            = "webhooks"
+	FeatureReconciliation      = "reconciliation"
+)
+
+// newFeatureFlags declares the gateway's features with their defaults
+func newFeatureFlags() *features.Flags {
+	return features.New(
+		features.Flag{Name: FeatureUsageMetering, Description: "Per-client usage metering and the /usage endpoint", Default: true},
+		features.Flag{Name: FeatureComplianceReporting, Description: "SOX compliance status, audit trail and alerting endpoints", Default: true},
+		features.Flag{Name: FeatureTransactionSearch, Description: "Full-text and structured transaction search and export", Default: true},
+		features.Flag{Name: FeaturePatientMessaging, Description: "Patient email and SMS templates, sending and delivery analytics", Default: true},
+		features.Flag{Name: FeatureHoneytokens, Description: "Decoy transactions whose search or export raises a critical SOC alert", Default: true},
+		features.Flag{Name: FeatureInsuranceClaims, Description: "Insurance claims as X12 837P, clearinghouse submission and 835 remittance settlement", Default: true},
+		features.Flag{Name: FeatureWebhooks, Description: "Signed payment and refund event webhooks with retries and a dead-letter queue", Default: true},
+		features.Flag{Name: FeatureReconciliation, Description: "Processor settlement file imports and daily reconciliation of captured payments", Default: true},
+	)
+}
+
+// capabilities builds the gateway's capability document
+func capabilities(flags *features.Flags, cfg Config) features.Capabilities {
+	return flags.Capabilities(cfg.ServiceName, apiSpecVersion, []string{APIVersionV1, APIVersionV2}, map[string]int64{
+		"max_processing_ms":           int64(cfg.MaxProcessingMillis),
+		"request_timeout_seconds":     int64(requestTimeout.Seconds()),
+		"usage_retention_hours":       int64(usageRetention.Hours()),
+		"usage_top_endpoints_max":     maxUsageTopEndpoints,
+		"transaction_index_max":       maxIndexedTransactions,
+		"transaction_page_max":        maxTransactionPageSize,
+		"transaction_export_max":      maxTransactionExport,
+		"template_email_body_max":     maxEmailBody,
+		"template_sms_body_max":       maxSMSBody,
+		"tracked_messages_max":        maxTrackedMessages,
+		"honeytokens_per_request_max": maxDecoysPerRequest,
+		"claim_diagnoses_max":         maxClaimDiagnoses,
+		"claim_service_lines_max":     maxClaimServiceLines,
+		"tracked_claims_max":          maxTrackedClaims,
+		"remittance_bytes_max":        maxRemittanceSize,
+		"webhooks_max":                maxWebhooks,
+		"webhook_attempts_max":        int64(cfg.Webhooks.withDefaults().MaxAttempts),
+		"dead_letters_max":            maxDeadLetters,
+		"settlement_bytes_max":        maxSettlementFileSize,
+		"settlement_rows_max":         maxSettlementRows,
+	})
+}
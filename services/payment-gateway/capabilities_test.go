@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/healthcare-gitops/common/features"
+)
+
+func TestCapabilitiesSpecVersionMatchesOpenAPI(t *testing.T) {
+	spec, err := os.ReadFile("openapi.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	version := regexp.MustCompile(`(?m)^  version: (\S+)$`).FindSubmatch(spec)
+	if version == nil || string(version[1]) != apiSpecVersion {
+		t.Fatalf("expected openapi.yaml version %s, got %q", apiSpecVersion, version)
+	}
+}
+
+func TestCapabilitiesReflectFeatureFlags(t *testing.T) {
+	t.Setenv("FEATURE_USAGE_METERING", "false")
+	h := NewServer(Config{Port: "0", ServiceName: "payment-gateway", MaxProcessingMillis: 50}).Handler
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/capabilities", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("capabilities expected 200, got %d", rr.Code)
+	}
+	var caps features.Capabilities
+	if err := json.NewDecoder(rr.Body).Decode(&caps); err != nil {
+		t.Fatal(err)
+	}
+	if caps.Service != "payment-gateway" || caps.SpecVersion != apiSpecVersion {
+		t.Fatalf("unexpected capabilities: %+v", caps)
+	}
+	if caps.Features[FeatureUsageMetering].Enabled || !caps.Features[FeatureComplianceReporting].Enabled {
+		t.Fatalf("unexpected features: %+v", caps.Features)
+	}
+	if caps.Limits["max_processing_ms"] != 50 || caps.Limits["usage_top_endpoints_max"] != maxUsageTopEndpoints {
+		t.Fatalf("unexpected limits: %+v", caps.Limits)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/usage", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("usage expected 404 while metering is disabled, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/healthcare-gitops/common/config"
+	"github.com/healthcare-gitops/sdk/go/phi"
+	"github.com/healthcare-gitops/sdk/go/transport"
+)
+
+// MethodCard is the payment method of payments made with card details
+const MethodCard = "card"
+
+// Card tokenizers, recorded on each card token
+const (
+	TokenizerPHIService = "phi-service"
+	TokenizerLocal      = "local"
+)
+
+const tokenizerTimeout = 10 * time.Second
+
+// Card errors. Card numbers are only accepted in a payment's card details, which are
+// exchanged for a token before the payment is processed; PAN-like data anywhere else
+// is refused so it never reaches the processor, the transaction records or the logs.
+var (
+	ErrInvalidCard          = errors.New("invalid card")
+	ErrCardDataNotAllowed   = errors.New("card data not allowed")
+	ErrTokenizerUnavailable = errors.New("card tokenization unavailable")
+)
+
+// CardDetails are the card a payment is made with. They are held only until the
+// number is tokenized: the number and CVC are never recorded, logged or sent to the
+// processor, and formatting or marshalling them masks the number.
+type CardDetails struct {
+	Number   string `json:"number"`
+	ExpMonth int    `json:"exp_month"`
+	ExpYear  int    `json:"exp_year"`
+	// CVC is checked for shape and discarded
+	CVC string `json:"cvc,omitempty"`
+}
+
+// String masks the card number, so card details formatted into a log line or error
+// carry only its last four digits
+func (c CardDetails) String() string {
+	return fmt.Sprintf("card %s exp %02d/%d", maskPAN(panDigits(c.Number)), c.ExpMonth, c.ExpYear)
+}
+
+// MarshalJSON masks the card number and drops the CVC
+func (c CardDetails) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Number   string `json:"number"`
+		ExpMonth int    `json:"exp_month"`
+		ExpYear  int    `json:"exp_year"`
+	}{maskPAN(panDigits(c.Number)), c.ExpMonth, c.ExpYear})
+}
+
+// CardToken stands in for a card once its number is tokenized. Token is the PHI
+// service's ciphertext of the number, which only it can decrypt, or an irreversible
+// local token.
+type CardToken struct {
+	Token     string `json:"token"`
+	Tokenizer string `json:"tokenizer"`
+	Brand     string `json:"brand"`
+	Last4     string `json:"last4"`
+	ExpMonth  int    `json:"exp_month"`
+	ExpYear   int    `json:"exp_year"`
+}
+
+// CardTokenizer exchanges card numbers for tokens. Another vault is plugged in by
+// implementing this.
+type CardTokenizer interface {
+	// Name identifies the tokenizer on the tokens it issues
+	Name() string
+	// Tokenize returns the token for a card number of digits only. It returns
+	// ErrTokenizerUnavailable when the vault cannot be reached.
+	Tokenize(ctx context.Context, pan string) (string, error)
+}
+
+// CardTokenizerConfig sets where card numbers are tokenized
+type CardTokenizerConfig struct {
+	// PHIServiceURL is the PHI service whose encrypt endpoint tokenizes card numbers;
+	// unset, cards are tokenized locally with a per-process key
+	PHIServiceURL string
+	// Token is a bearer token with the phi:write scope, for a PHI service that checks
+	// tokens
+	Token string
+	// HTTPClient defaults to one with a 10 second timeout
+	HTTPClient *http.Client
+}
+
+// cardTokenizerConfigFromEnv reads PHI_SERVICE_URL and PHI_SERVICE_TOKEN
+func cardTokenizerConfigFromEnv() CardTokenizerConfig {
+	return CardTokenizerConfig{
+		PHIServiceURL: config.GetEnv("PHI_SERVICE_URL", ""),
+		Token:         config.GetEnv("PHI_SERVICE_TOKEN", ""),
+	}
+}
+
+// NewCardTokenizer checks cfg and builds its tokenizer: the PHI service when
+// PHIServiceURL is set, otherwise a local one
+func NewCardTokenizer(cfg CardTokenizerConfig) (CardTokenizer, error) {
+	if cfg.PHIServiceURL == "" {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		return localTokenizer{key: key}, nil
+	}
+	u, err := url.Parse(cfg.PHIServiceURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("PHI service URL %q must be an http or https URL", cfg.PHIServiceURL)
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: tokenizerTimeout}
+	}
+	t := transport.New(cfg.PHIServiceURL, nil)
+	t.HTTPClient = client
+	// A card is encrypted once; retries of failed calls are left to the HTTP client
+	t.Retry = &transport.NoRetry
+	if cfg.Token != "" {
+		t.Tokens = transport.StaticToken(cfg.Token)
+	}
+	return phiServiceTokenizer{client: phi.NewClient(t)}, nil
+}
+
+// phiServiceTokenizer encrypts card numbers with the PHI service, so the gateway holds
+// only ciphertext and every detokenization is authorized and audited there
+type phiServiceTokenizer struct {
+	client *phi.Client
+}
+
+func (p phiServiceTokenizer) Name() string { return TokenizerPHIService }
+
+func (p phiServiceTokenizer) Tokenize(ctx context.Context, pan string) (string, error) {
+	result, err := p.client.EncryptData(ctx, nil, phi.EncryptRequest{Data: pan})
+	if status := transport.StatusCode(err); status != 0 {
+		// The response is not put in the error, in case it echoes the request
+		return "", fmt.Errorf("%w: encrypt returned %d", ErrTokenizerUnavailable, status)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrTokenizerUnavailable, err)
+	}
+	if result.EncryptedData == "" {
+		return "", fmt.Errorf("%w: invalid encrypt response", ErrTokenizerUnavailable)
+	}
+	return result.EncryptedData, nil
+}
+
+// localTokenizer derives tokens from a random per-process key that is never written
+// out, used when no PHI service is configured. Its tokens cannot be detokenized.
+type localTokenizer struct {
+	key []byte
+}
+
+func (l localTokenizer) Name() string { return TokenizerLocal }
+
+func (l localTokenizer) Tokenize(_ context.Context, pan string) (string, error) {
+	mac := hmac.New(sha256.New, l.key)
+	mac.Write([]byte(pan))
+	return "tok_" + hex.EncodeToString(mac.Sum(nil)[:16]), nil
+}
+
+// tokenizeCard exchanges a payment's card details for a token, which replaces them on
+// the request
+func tokenizeCard(ctx context.Context, tokenizer CardTokenizer, req PaymentRequest) (PaymentRequest, error) {
+	pan := panDigits(req.Card.Number)
+	token, err := tokenizer.Tokenize(ctx, pan)
+	RecordCardTokenization(tokenizer.Name(), err)
+	if err != nil {
+		return req, err
+	}
+	req.CardToken = &CardToken{
+		Token:     token,
+		Tokenizer: tokenizer.Name(),
+		Brand:     cardBrand(pan),
+		Last4:     pan[len(pan)-4:],
+		ExpMonth:  req.Card.ExpMonth,
+		ExpYear:   req.Card.ExpYear,
+	}
+	req.Card = nil
+	return req, nil
+}
+
+// validateCard checks a payment's card details and that no other field carries a
+// card number
+func validateCard(req PaymentRequest, now time.Time) error {
+	for _, field := range []struct{ name, value string }{
+		{"customer_id", req.CustomerID},
+		{"method", req.Method},
+		{"patient_id", req.PatientID},
+		{"device_id", req.DeviceID},
+		{"description", req.Description},
+	} {
+		if containsPAN(field.value) {
+			return fmt.Errorf("%w: %s looks like a card number; send cards in card.number", ErrCardDataNotAllowed, field.name)
+		}
+	}
+	if req.Card == nil {
+		return nil
+	}
+
+	card := req.Card
+	if !strings.EqualFold(req.Method, MethodCard) {
+		return fmt.Errorf("%w: card details need method %s", ErrInvalidCard, MethodCard)
+	}
+	pan := panDigits(card.Number)
+	if len(pan) < 12 || len(pan) > 19 || !luhnValid(pan) {
+		return fmt.Errorf("%w: card.number is not a valid card number", ErrInvalidCard)
+	}
+	if card.ExpMonth < 1 || card.ExpMonth > 12 || card.ExpYear < 2000 || card.ExpYear > 9999 {
+		return fmt.Errorf("%w: card.exp_month and card.exp_year must be a month and a four-digit year", ErrInvalidCard)
+	}
+	year, month, _ := now.UTC().Date()
+	if card.ExpYear < year || (card.ExpYear == year && card.ExpMonth < int(month)) {
+		return fmt.Errorf("%w: the card has expired", ErrInvalidCard)
+	}
+	if card.CVC != "" && (len(card.CVC) < 3 || len(card.CVC) > 4 || !allDigits(card.CVC)) {
+		return fmt.Errorf("%w: card.cvc must be 3 or 4 digits", ErrInvalidCard)
+	}
+	return nil
+}
+
+// panDigits strips the spaces and dashes a card number is written with. Anything
+// else is left in, so the number fails validation.
+func panDigits(number string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(number)
+}
+
+func allDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// luhnValid checks the Luhn check digit every payment card number ends with
+func luhnValid(digits string) bool {
+	if !allDigits(digits) {
+		return false
+	}
+	sum := 0
+	for i := 0; i < len(digits); i++ {
+		d := int(digits[len(digits)-1-i] - '0')
+		if i%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// cardBrand names the card network by the number's prefix
+func cardBrand(pan string) string {
+	prefix := func(n int) int {
+		v := 0
+		for i := 0; i < n && i < len(pan); i++ {
+			v = v*10 + int(pan[i]-'0')
+		}
+		return v
+	}
+	switch {
+	case pan[0] == '4':
+		return "visa"
+	case prefix(2) >= 51 && prefix(2) <= 55, prefix(4) >= 2221 && prefix(4) <= 2720:
+		return "mastercard"
+	case prefix(2) == 34 || prefix(2) == 37:
+		return "amex"
+	case prefix(4) == 6011 || prefix(2) == 65 || (prefix(3) >= 644 && prefix(3) <= 649):
+		return "discover"
+	case prefix(4) >= 3528 && prefix(4) <= 3589:
+		return "jcb"
+	}
+	return "unknown"
+}
+
+// maskPAN keeps the last four digits of a card number
+func maskPAN(pan string) string {
+	if len(pan) <= 4 {
+		return strings.Repeat("*", len(pan))
+	}
+	return strings.Repeat("*", len(pan)-4) + pan[len(pan)-4:]
+}
+
+// findPANs returns the byte ranges of the card numbers in s: 13 to 19 digits passing
+// the Luhn check, written whole or in the groups cards are printed with (4-4-4-4,
+// 4-6-5), separated by single spaces or dashes. Requiring the printed grouping keeps
+// dashed IDs and dates from being mistaken for cards.
+func findPANs(s string) [][2]int {
+	var spans [][2]int
+	for i := 0; i < len(s); {
+		if s[i] < '0' || s[i] > '9' {
+			i++
+			continue
+		}
+		// Collect a run of digit groups joined by single separators
+		var groups [][2]int
+		for {
+			start := i
+			for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+				i++
+			}
+			groups = append(groups, [2]int{start, i})
+			if i+1 < len(s) && (s[i] == ' ' || s[i] == '-') && s[i+1] >= '0' && s[i+1] <= '9' {
+				i++
+				continue
+			}
+			break
+		}
+		spans = append(spans, groupedPANs(s, groups)...)
+	}
+	return spans
+}
+
+// groupedPANs finds the card numbers in a run of digit groups, longest first
+func groupedPANs(s string, groups [][2]int) [][2]int {
+	var spans [][2]int
+	for first := 0; first < len(groups); first++ {
+		for last := len(groups) - 1; last >= first; last-- {
+			var digits strings.Builder
+			lengths := make([]int, 0, last-first+1)
+			for _, g := range groups[first : last+1] {
+				digits.WriteString(s[g[0]:g[1]])
+				lengths = append(lengths, g[1]-g[0])
+			}
+			if digits.Len() < 13 || digits.Len() > 19 || !printedGrouping(lengths) || !luhnValid(digits.String()) {
+				continue
+			}
+			spans = append(spans, [2]int{groups[first][0], groups[last][1]})
+			first = last
+			break
+		}
+	}
+	return spans
+}
+
+// printedGrouping reports whether digit group lengths are how a card number is
+// written: one group, fours with a shorter last group, or 4-6-5 and 4-6-4
+func printedGrouping(lengths []int) bool {
+	if len(lengths) == 1 {
+		return true
+	}
+	if len(lengths) == 3 && lengths[0] == 4 && lengths[1] == 6 && (lengths[2] == 4 || lengths[2] == 5) {
+		return true
+	}
+	for i, n := range lengths {
+		if n != 4 && (i < len(lengths)-1 || n > 4) {
+			return false
+		}
+	}
+	return true
+}
+
+// containsPAN reports whether s carries a card number
+func containsPAN(s string) bool {
+	return len(findPANs(s)) > 0
+}
+
+// redactPANs masks every card number in s to its last four digits
+func redactPANs(s string) string {
+	spans := findPANs(s)
+	if len(spans) == 0 {
+		return s
+	}
+	var b strings.Builder
+	prev := 0
+	for _, span := range spans {
+		b.WriteString(s[prev:span[0]])
+		b.WriteString(maskPAN(panDigits(s[span[0]:span[1]])))
+		prev = span[1]
+	}
+	b.WriteString(s[prev:])
+	return b.String()
+}
+
+// panRedactingWriter masks card numbers in log output, as a last line of defence for
+// PAN-like data that reaches a log line despite validation
+type panRedactingWriter struct {
+	out io.Writer
+}
+
+func (w panRedactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.out, redactPANs(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
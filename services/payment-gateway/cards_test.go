@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func TestFindPANs(t *testing.T) {
+	tests := []struct {
+		text string
+		pan  bool
+	}{
+		{"4111111111111111", true},
+		{"4111 1111 1111 1111", true},
+		{"4111-1111-1111-1111", true},
+		{"paid with 5555555555554444 today", true},
+		{"3782 822463 10005", true},
+		{"ref 2024 4242 4242 4242 4242", true},
+		{"4111111111111112", false},                    // fails the Luhn check
+		{"41111111111", false},                         // too short
+		{"TXN-20260305-120000.000-4ab1c2d3", false},    // dashed, but not grouped like a card
+		{"call 555-123-4567 or 2026-03-05", false},     // phone numbers and dates
+		{"41111 11111 11111 1", false},                 // not a printed card grouping
+		{"12345678901234567890123", false},             // longer than any card number
+		{"CUST_001 for MRI scan at 09:30", false},      // ordinary text
+		{"ANON-4a1f09e2c3 DEV789012 PAT123456", false}, // device and patient IDs
+	}
+	for _, tt := range tests {
+		if got := containsPAN(tt.text); got != tt.pan {
+			t.Errorf("containsPAN(%q) = %v, want %v", tt.text, got, tt.pan)
+		}
+	}
+
+	if got := redactPANs("card 4111 1111 1111 1111, then 378282246310005"); got != "card ************1111, then ***********0005" {
+		t.Fatalf("unexpected redaction: %q", got)
+	}
+	var out bytes.Buffer
+	logger := zerolog.New(panRedactingWriter{out: &out})
+	logger.Info().Str("description", "4111-1111-1111-1111").Msg("payment")
+	if strings.Contains(out.String(), "4111-1111-1111-1111") || !strings.Contains(out.String(), "************1111") {
+		t.Fatalf("expected the log line redacted, got %s", out.String())
+	}
+}
+
+func TestValidateCard(t *testing.T) {
+	now := time.Date(2026, 3, 5, 12, 0, 0, 0, time.UTC)
+	valid := func() PaymentRequest {
+		return PaymentRequest{AmountCents: 100, Currency: "USD", CustomerID: "c1", Method: "card",
+			Card: &CardDetails{Number: "4242 4242 4242 4242", ExpMonth: 3, ExpYear: 2026, CVC: "123"}}
+	}
+	if err := validateCard(valid(), now); err != nil {
+		t.Fatalf("expected a card expiring this month to be valid, got %v", err)
+	}
+
+	for name, change := range map[string]func(*PaymentRequest){
+		"luhn":         func(r *PaymentRequest) { r.Card.Number = "4242424242424241" },
+		"letters":      func(r *PaymentRequest) { r.Card.Number = "4242x42424242424" },
+		"short":        func(r *PaymentRequest) { r.Card.Number = "42424" },
+		"expired":      func(r *PaymentRequest) { r.Card.ExpMonth = 2 },
+		"month":        func(r *PaymentRequest) { r.Card.ExpMonth = 13 },
+		"two-digit":    func(r *PaymentRequest) { r.Card.ExpYear = 28 },
+		"cvc":          func(r *PaymentRequest) { r.Card.CVC = "12a" },
+		"other method": func(r *PaymentRequest) { r.Method = "ach" },
+	} {
+		req := valid()
+		change(&req)
+		if err := validateCard(req, now); !errors.Is(err, ErrInvalidCard) {
+			t.Errorf("%s: expected ErrInvalidCard, got %v", name, err)
+		}
+	}
+	for name, change := range map[string]func(*PaymentRequest){
+		"description": func(r *PaymentRequest) { r.Description = "card 4242 4242 4242 4242" },
+		"customer":    func(r *PaymentRequest) { r.CustomerID = "4242424242424242" },
+		"method":      func(r *PaymentRequest) { r.Method = "card:4242424242424242" },
+		"patient":     func(r *PaymentRequest) { r.PatientID = "4242-4242-4242-4242" },
+	} {
+		req := valid()
+		req.Card = nil
+		change(&req)
+		if err := validateCard(req, now); !errors.Is(err, ErrCardDataNotAllowed) {
+			t.Errorf("%s: expected ErrCardDataNotAllowed, got %v", name, err)
+		} else if strings.Contains(err.Error(), "4242") {
+			t.Errorf("%s: the error repeats the card number: %v", name, err)
+		}
+	}
+
+	// Card details never format or marshal with the number or CVC
+	card := CardDetails{Number: "4242424242424242", ExpMonth: 3, ExpYear: 2026, CVC: "987"}
+	req := valid()
+	req.Card = &card
+	raw, _ := json.Marshal(req)
+	for _, s := range []string{fmt.Sprint(card), fmt.Sprintf("%+v", *req.Card), string(raw)} {
+		if strings.Contains(s, "4242424242424242") || strings.Contains(s, "987") || !strings.Contains(s, "4242") {
+			t.Errorf("expected the card masked, got %s", s)
+		}
+	}
+	if brand := cardBrand("378282246310005"); brand != "amex" {
+		t.Fatalf("expected amex, got %s", brand)
+	}
+}
+
+func TestPaymentCardTokenization(t *testing.T) {
+	const pan = "4242424242424242"
+	var tokenized atomic.Int32
+	var down atomic.Bool
+	phi := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Data string `json:"data"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if r.URL.Path != "/api/v1/encrypt" || r.Header.Get("Authorization") != "Bearer phi-token" || body.Data != pan {
+			http.Error(w, "unexpected tokenization request", http.StatusBadRequest)
+			return
+		}
+		if down.Load() {
+			http.Error(w, body.Data, http.StatusServiceUnavailable)
+			return
+		}
+		tokenized.Add(1)
+		_ = json.NewEncoder(w).Encode(map[string]string{"encrypted_data": "key-1:c2VhbGVkIGNhcmQ=", "key_id": "key-1"})
+	}))
+	defer phi.Close()
+	tokenizer, err := NewCardTokenizer(CardTokenizerConfig{PHIServiceURL: phi.URL + "/", Token: "phi-token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Everything the gateway logs is captured unredacted, to show no card number reaches
+	// a log line in the first place
+	var logs bytes.Buffer
+	defer func(logger zerolog.Logger) { log.Logger = logger }(log.Logger)
+	log.Logger = zerolog.New(&logs)
+
+	repository := newMemoryRepository(10)
+	transactions := NewTransactionStore()
+	h := PaymentHandler{MaxLatency: time.Millisecond, Repository: repository, Transactions: transactions, Tokenizer: tokenizer}
+	r := chi.NewRouter()
+	r.Use(LoggingMiddleware)
+	r.Post("/charge", h.Charge)
+	r.Post("/api/v2/payments", h.CreatePayment)
+	r.Get("/api/v1/transactions/search/export", transactions.ExportHandler)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest(method, path, bytes.NewBufferString(body)))
+		return rr
+	}
+	year := time.Now().Year() + 2
+	card := fmt.Sprintf(`"card": {"number": "4242 4242 4242 4242", "exp_month": 12, "exp_year": %d, "cvc": "987"}`, year)
+
+	rr := do("POST", "/api/v2/payments", `{"amount": {"amount_minor": 5000, "currency": "USD"}, "customer_id": "cust-1", "method": "card", `+card+`}`)
+	var resp PaymentResponseV2
+	if rr.Code != http.StatusCreated || json.Unmarshal(rr.Body.Bytes(), &resp) != nil {
+		t.Fatalf("card payment expected 201, got %d: %s", rr.Code, rr.Body)
+	}
+	want := CardToken{Token: "key-1:c2VhbGVkIGNhcmQ=", Tokenizer: TokenizerPHIService, Brand: "visa", Last4: "4242", ExpMonth: 12, ExpYear: year}
+	if resp.Card == nil || *resp.Card != want {
+		t.Fatalf("expected the card token in the response, got %+v", resp.Card)
+	}
+	txn, err := repository.Get(t.Context(), resp.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txn.Card == nil || *txn.Card != want {
+		t.Fatalf("expected the card token recorded, got %+v", txn.Card)
+	}
+	if rr := do("POST", "/charge", `{"amount_cents": 2500, "currency": "USD", "customer_id": "cust-1", "method": "card", `+card+`}`); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"last4":"4242"`) {
+		t.Fatalf("v1 card payment expected 200, got %d: %s", rr.Code, rr.Body)
+	}
+
+	// PAN-like data outside card.number, and invalid cards, are refused before anything
+	// is tokenized or recorded
+	var envelope ErrorEnvelope
+	rr = do("POST", "/api/v2/payments", `{"amount": {"amount_minor": 5000, "currency": "USD"}, "customer_id": "cust-1", "method": "card", "description": "card 4242 4242 4242 4242 exp 12/30"}`)
+	if rr.Code != http.StatusUnprocessableEntity || json.Unmarshal(rr.Body.Bytes(), &envelope) != nil || envelope.Error.Code != ErrorCodeCardData {
+		t.Fatalf("PAN in the description expected 422 card_data_not_allowed, got %d: %s", rr.Code, rr.Body)
+	}
+	if rr := do("POST", "/charge", `{"amount_cents": 100, "currency": "USD", "customer_id": "4242424242424242", "method": "card"}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("PAN as the customer ID expected 400, got %d: %s", rr.Code, rr.Body)
+	}
+	rr = do("POST", "/api/v2/payments", `{"amount": {"amount_minor": 5000, "currency": "USD"}, "customer_id": "cust-1", "method": "card", "card": {"number": "4242424242424241", "exp_month": 12, "exp_year": 2099}}`)
+	if rr.Code != http.StatusUnprocessableEntity || json.Unmarshal(rr.Body.Bytes(), &envelope) != nil || envelope.Error.Code != ErrorCodeInvalidCard {
+		t.Fatalf("invalid card expected 422 invalid_card, got %d: %s", rr.Code, rr.Body)
+	}
+
+	// Without the PHI service the payment is refused, not processed with the raw card
+	down.Store(true)
+	rr = do("POST", "/api/v2/payments", `{"amount": {"amount_minor": 5000, "currency": "USD"}, "customer_id": "cust-1", "method": "card", `+card+`}`)
+	if rr.Code != http.StatusServiceUnavailable || json.Unmarshal(rr.Body.Bytes(), &envelope) != nil || envelope.Error.Code != ErrorCodeUnavailable {
+		t.Fatalf("tokenizer outage expected 503 unavailable, got %d: %s", rr.Code, rr.Body)
+	}
+	if tokenized.Load() != 2 {
+		t.Fatalf("expected only the valid cards tokenized, got %d", tokenized.Load())
+	}
+	all, _, _ := repository.List(t.Context(), TransactionFilter{})
+	if len(all) != 2 {
+		t.Fatalf("expected only the tokenized payments recorded, got %d", len(all))
+	}
+
+	// The card number is nowhere the payment went
+	export := do("GET", "/api/v1/transactions/search/export", "").Body.String()
+	recorded, _ := json.Marshal(all)
+	event, _ := json.Marshal(paymentSucceeded(txn, ""))
+	for where, s := range map[string]string{"logs": logs.String(), "export": export, "repository": string(recorded), "webhook": string(event)} {
+		if containsPAN(s) || strings.Contains(s, "cvc") {
+			t.Errorf("card data found in the %s:\n%s", where, s)
+		}
+	}
+}
+
+func TestNewCardTokenizer(t *testing.T) {
+	tokenizer, err := NewCardTokenizer(CardTokenizerConfig{})
+	if err != nil || tokenizer.Name() != TokenizerLocal {
+		t.Fatalf("expected a local tokenizer by default, got %v, %v", tokenizer, err)
+	}
+	first, _ := tokenizer.Tokenize(t.Context(), "4242424242424242")
+	second, _ := tokenizer.Tokenize(t.Context(), "4242424242424242")
+	if first != second || !strings.HasPrefix(first, "tok_") || strings.Contains(first, "4242") {
+		t.Fatalf("expected a stable opaque token, got %q and %q", first, second)
+	}
+	if _, err := NewCardTokenizer(CardTokenizerConfig{PHIServiceURL: "phi-service:8081"}); err == nil {
+		t.Fatal("expected a PHI service URL without a scheme to be refused")
+	}
+	unreachable, _ := NewCardTokenizer(CardTokenizerConfig{PHIServiceURL: "http://127.0.0.1:1"})
+	if _, err := unreachable.Tokenize(t.Context(), "4242424242424242"); !errors.Is(err, ErrTokenizerUnavailable) {
+		t.Fatalf("expected an unreachable PHI service to be unavailable, got %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"time"
+
+	"github.com/healthcare-gitops/common/changelog"
+)
+
+// newChangelog lists the gateway's API changes since 1.0.0. The v1 payment
+// endpoints' sunset comes from the configured retirement schedule.
+func newChangelog(cfg Config) (*changelog.Changelog, error) {
+	sunset := cfg.APIv1Sunset
+	if sunset.IsZero() {
+		sunset, _ = time.Parse(time.DateOnly, defaultAPIv1Sunset)
+	}
+	v1Sunset := sunset.UTC().Format(time.DateOnly)
+
+	return changelog.New(cfg.ServiceName, apiSpecVersion, []changelog.Entry{
+		{Version: "1.1.0", Kind: changelog.Added, Method: "GET", Path: "/usage", Description: "Per-client usage analytics"},
+		{Version: "1.2.0", Kind: changelog.Added, Method: "GET", Path: "/capabilities", Description: "Feature, API version and limit discovery"},
+		{Version: "1.3.0", Kind: changelog.Added, Method: "POST", Path: "/api/v2/payments", Description: "v2 payments with Money amounts and the error envelope"},
+		{Version: "1.3.0", Kind: changelog.Deprecated, Method: "POST", Path: "/process", Description: "v1 payment processing", Replacement: "POST " + apiV1Successor, Sunset: v1Sunset},
+		{Version: "1.3.0", Kind: changelog.Deprecated, Method: "POST", Path: "/charge", Description: "v1 payment charge", Replacement: "POST " + apiV1Successor, Sunset: v1Sunset},
+		{Version: "1.4.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/transactions/search", Description: "Full-text and structured transaction search"},
+		{Version: "1.4.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/transactions/search/export", Description: "Transaction export as CSV or JSON"},
+		{Version: "1.5.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/summary", Description: "Dashboard payment summary"},
+		{Version: "1.6.0", Kind: changelog.Added, Method: "GET", Path: "/admin/observability/{artifact}", Description: "Generated alerting rules and dashboards"},
+		{Version: "1.7.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/templates", Description: "Patient message templates"},
+		{Version: "1.7.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/templates", Description: "Create a patient message template"},
+		{Version: "1.7.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/templates/{templateID}", Description: "Get a template with its versions"},
+		{Version: "1.7.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/templates/{templateID}/versions", Description: "Publish a template version"},
+		{Version: "1.7.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/templates/{templateID}/preview", Description: "Render a template without sending it"},
+		{Version: "1.7.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/templates/{templateID}/send", Description: "Send a templated email or SMS"},
+		{Version: "1.7.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/templates/{templateID}/analytics", Description: "Template delivery analytics"},
+		{Version: "1.7.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/notifications/status", Description: "Delivery status callbacks from providers"},
+		{Version: "1.8.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/calendars", Description: "Tenants' business calendars"},
+		{Version: "1.8.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/calendars/{tenant}", Description: "Get a tenant's business calendar"},
+		{Version: "1.8.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/calendars/{tenant}/query", Description: "Whether a time is within business hours"},
+		{Version: "1.8.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/templates/{templateID}/send", Field: "tenant", Description: "Hold messages until the tenant's business hours"},
+		{Version: "1.9.0", Kind: changelog.Added, Method: "GET", Path: "/admin/selfscan", Description: "Security misconfiguration self-scan"},
+		{Version: "1.10.0", Kind: changelog.Changed, Method: "POST", Path: "/api/v2/payments", Description: "Requires a payment:write bearer token where auth-service is configured"},
+		{Version: "1.11.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/honeytokens", Description: "Decoy transactions"},
+		{Version: "1.11.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/honeytokens", Description: "Plant decoy transactions"},
+		{Version: "1.11.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/honeytokens/alerts", Description: "Reads of decoy transactions"},
+		{Version: "1.11.0", Kind: changelog.Changed, Method: "GET", Path: "/alerts", Field: "alerts", Description: "Typed honeytoken alerts instead of free-form objects"},
+		{Version: "1.12.0", Kind: changelog.Added, Method: "GET", Path: "/admin/usage-stats", Description: "Preview of the opt-in anonymous usage stats report"},
+		{Version: "1.13.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/transactions", Description: "List recorded transactions"},
+		{Version: "1.13.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/transactions/{transactionID}", Description: "Get a recorded transaction"},
+		{Version: "1.13.0", Kind: changelog.Changed, Method: "POST", Path: "/api/v2/payments", Description: "503 with the unavailable error code when the payment could not be recorded"},
+		{Version: "1.14.0", Kind: changelog.Added, Method: "GET", Path: "/admin/failover", Description: "Active/standby failover state"},
+		{Version: "1.14.0", Kind: changelog.Changed, Method: "POST", Path: "/api/v2/payments", Description: "503 with Retry-After on the standby replica"},
+		{Version: "1.15.0", Kind: changelog.Added, Method: "GET", Path: "/changelog", Description: "This changelog"},
+		{Version: "1.16.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/transactions/{transactionID}/capture", Description: "Capture an authorized payment"},
+		{Version: "1.16.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/transactions/{transactionID}/refund", Description: "Refund a captured payment in full or in part"},
+		{Version: "1.16.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/transactions/{transactionID}/void", Description: "Void an authorized payment"},
+		{Version: "1.16.0", Kind: changelog.Changed, Method: "GET", Path: "/api/v1/transactions/{transactionID}", Field: "status", Description: "The captured, partially_refunded, refunded and voided statuses, with captured_at, voided_at, refunded and refunds"},
+		{Version: "1.16.0", Kind: changelog.Changed, Method: "GET", Path: "/audit/trail", Field: "entries", Description: "SOX entries for captures, refunds and voids, with transaction_id, user_id and details"},
+		{Version: "1.17.0", Kind: changelog.Changed, Method: "POST", Path: "/api/v2/payments", Description: "402 with the payment_declined error code when the processor declines; 503 when it is unreachable"},
+		{Version: "1.17.0", Kind: changelog.Changed, Method: "POST", Path: "/process", Description: "402 when the processor declines; 503 when it is unreachable"},
+		{Version: "1.17.0", Kind: changelog.Changed, Method: "POST", Path: "/charge", Description: "402 when the processor declines; 503 when it is unreachable"},
+		{Version: "1.17.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/transactions/{transactionID}", Field: "processor", Description: "processor and processor_reference, the processor's ID for the payment"},
+		{Version: "1.18.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/claims", Description: "Insurance claims, filtered and paged"},
+		{Version: "1.18.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/claims", Description: "Create an insurance claim, validated for X12 837P"},
+		{Version: "1.18.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/claims/{claimID}", Description: "Get a claim with its adjudication and history"},
+		{Version: "1.18.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/claims/{claimID}/x12", Description: "Download a claim as an X12 837P interchange"},
+		{Version: "1.18.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/claims/{claimID}/submit", Description: "Submit a claim to the clearinghouse"},
+		{Version: "1.18.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/claims/{claimID}/status", Description: "Clearinghouse acceptance or rejection of a submitted claim"},
+		{Version: "1.18.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/remittances", Description: "Apply an X12 835, settling paid claims as insurance transactions"},
+		{Version: "1.19.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/webhooks", Description: "Payment event webhooks with delivery counts"},
+		{Version: "1.19.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/webhooks", Description: "Register a signed payment.succeeded, payment.failed and refund.issued webhook"},
+		{Version: "1.19.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/webhooks/{webhookID}", Description: "Get a webhook"},
+		{Version: "1.19.0", Kind: changelog.Added, Method: "DELETE", Path: "/api/v1/webhooks/{webhookID}", Description: "Delete a webhook"},
+		{Version: "1.19.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/webhooks/dead-letters", Description: "Deliveries that failed every retry"},
+		{Version: "1.19.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/webhooks/dead-letters/{deadLetterID}/retry", Description: "Redeliver a dead-lettered event"},
+		{Version: "1.19.0", Kind: changelog.Added, Method: "DELETE", Path: "/api/v1/webhooks/dead-letters/{deadLetterID}", Description: "Discard a dead-lettered event"},
+		{Version: "1.20.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/currencies", Description: "Accepted ISO 4217 currencies with their minor units and rates to the reporting currency"},
+		{Version: "1.20.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/transactions/{transactionID}", Field: "exchange_rate", Description: "exchange_rate and reporting_amount, the rate snapshot the payment is reported at"},
+		{Version: "1.20.0", Kind: changelog.Changed, Method: "POST", Path: "/api/v2/payments", Description: "422 invalid_amount for a currency outside the currency table or without an exchange rate; 503 when rates cannot be read"},
+		{Version: "1.20.0", Kind: changelog.Changed, Method: "POST", Path: "/charge", Description: "amount is converted in the currency's minor unit and refused when finer than it"},
+		{Version: "1.21.0", Kind: changelog.Added, Method: "POST", Path: "/api/v2/payments", Field: "card", Description: "card details, exchanged for a token by the PHI service before the payment is processed; the response carries the token"},
+		{Version: "1.21.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/transactions/{transactionID}", Field: "card", Description: "the token, brand and last four digits of the card paid with"},
+		{Version: "1.21.0", Kind: changelog.Changed, Method: "POST", Path: "/api/v2/payments", Description: "422 card_data_not_allowed for a card number outside card.number and invalid_card for invalid or expired card details; 503 when the card cannot be tokenized"},
+		{Version: "1.21.0", Kind: changelog.Changed, Method: "POST", Path: "/charge", Description: "400 for a card number outside card.number or invalid card details"},
+		{Version: "1.22.0", Kind: changelog.Added, Method: "GET", Path: "/audit/trail/verify", Description: "Verification of the SOX audit log's hash chain"},
+		{Version: "1.22.0", Kind: changelog.Changed, Method: "GET", Path: "/audit/trail", Description: "transaction_id, event, user_id, since, until and limit filters over the persisted audit log; entries carry seq, prev_hash and hash"},
+		{Version: "1.22.0", Kind: changelog.Changed, Method: "POST", Path: "/api/v1/transactions/{transactionID}/refund", Description: "503 when the SOX audit record cannot be written; the refund, like captures, voids and insurance settlements, is not saved unaudited"},
+		{Version: "1.23.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/transactions/{transactionID}/approve", Description: "Approval of payments held for SOX approval by an authenticated approver whose role approves at the level the amount needs, never the payment's initiator"},
+		{Version: "1.23.0", Kind: changelog.Changed, Method: "POST", Path: "/api/v2/payments", Description: "Payments whose reporting amount reaches SOX_DUAL_APPROVAL_THRESHOLD are pending_approval, with an approval recording their initiator, until approved"},
+		{Version: "1.23.0", Kind: changelog.Changed, Method: "POST", Path: "/api/v1/transactions/{transactionID}/capture", Description: "409 for payments pending approval"},
+		{Version: "1.24.0", Kind: changelog.Changed, Method: "POST", Path: "/api/v2/payments", Description: "Risk scoring before authorization: denied payments are declined with 402 payment_declined, reviewed ones held as pending_approval, and the decision recorded as the transaction's risk"},
+		{Version: "1.24.0", Kind: changelog.Changed, Method: "GET", Path: "/api/v1/transactions/{transactionID}", Field: "risk", Description: "The risk scorer's score, decision and signals, and approval.reason, amount or risk_review"},
+		{Version: "1.25.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/reconciliation/settlements", Description: "Import a processor settlement CSV, audited for SOX"},
+		{Version: "1.25.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/reconciliation/{date}", Description: "Daily reconciliation of captured payments with processor settlement, flagging mismatches"},
+		{Version: "1.26.0", Kind: changelog.Added, Method: "GET", Path: "/openapi.json", Description: "This OpenAPI document as JSON"},
+		{Version: "1.26.0", Kind: changelog.Added, Method: "GET", Path: "/docs", Description: "Swagger UI for the OpenAPI document"},
+		{Version: "1.27.0", Kind: changelog.Changed, Method: "GET", Path: "/compliance/status", Description: "SOX controls checked live, each with its requirement, status, detail and evidence links, the audit bus delivery counts and the violation counters on /metrics; status is compliant, at_risk or non_compliant"},
+		{Version: "1.27.0", Kind: changelog.Removed, Method: "GET", Path: "/compliance/status", Field: "compliance", Description: "The fixed list of frameworks", Replacement: "frameworks"},
+		{Version: "1.27.0", Kind: changelog.Removed, Method: "GET", Path: "/compliance/status", Field: "last_audit", Description: "The fixed last audit time", Replacement: "controls"},
+		{Version: "1.28.0", Kind: changelog.Changed, Method: "POST", Path: "/api/v1/notifications/status", Description: "Requires a payment:write bearer token where auth-service is configured"},
+		{Version: "1.29.0", Kind: changelog.Changed, Method: "GET", Path: "/admin/observability/{artifact}", Description: "Requires an admin bearer token where auth-service is configured"},
+	})
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/healthcare-gitops/common/changelog"
+)
+
+// TestChangelogMatchesOpenAPI tests that every changed endpoint is documented and
+// that the newest change is in the version this build implements
+func TestChangelogMatchesOpenAPI(t *testing.T) {
+	spec, err := os.ReadFile("openapi.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes, err := newChangelog(Config{ServiceName: "payment-gateway"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes.Entries[0].Version != apiSpecVersion {
+		t.Fatalf("expected the newest change in %s, got %s", apiSpecVersion, changes.Entries[0].Version)
+	}
+	for _, e := range changes.Entries {
+		if e.Kind == changelog.Removed {
+			continue
+		}
+		if !regexp.MustCompile(`(?m)^  ` + regexp.QuoteMeta(e.Path) + `:$`).Match(spec) {
+			t.Errorf("%s %s is in the changelog but not in openapi.yaml", e.Method, e.Path)
+		}
+	}
+}
+
+func TestChangelogEndpoint(t *testing.T) {
+	sunset := time.Date(2027, 6, 30, 0, 0, 0, 0, time.UTC)
+	h := NewServer(Config{Port: "0", ServiceName: "payment-gateway", MaxProcessingMillis: 50, APIv1Sunset: sunset}).Handler
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/changelog?kind=deprecated", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("changelog expected 200, got %d", rr.Code)
+	}
+	var doc changelog.Changelog
+	if err := json.NewDecoder(rr.Body).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Version != apiSpecVersion || len(doc.Entries) != 2 {
+		t.Fatalf("expected the two v1 deprecations, got %+v", doc)
+	}
+	for _, e := range doc.Entries {
+		if e.Sunset != "2027-06-30" || e.Replacement != "POST /api/v2/payments" {
+			t.Fatalf("expected the configured sunset and the v2 replacement, got %+v", e)
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/changelog?since=1.14.0&kind=added", nil))
+	if err := json.NewDecoder(rr.Body).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Entries) == 0 || doc.Entries[len(doc.Entries)-1].Path != "/changelog" {
+		t.Fatalf("expected the changes after 1.14.0 down to the changelog itself, got %+v", doc.Entries)
+	}
+	for _, e := range doc.Entries {
+		if changelog.Compare(e.Version, "1.14.0") <= 0 || e.Kind != changelog.Added {
+			t.Fatalf("expected only additions after 1.14.0, got %+v", e)
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/changelog?since=latest", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a malformed version, got %d", rr.Code)
+	}
+}
+
+// TestOpenAPIDocumentServed tests that openapi.yaml is served as JSON, in the order it
+// is written, and that the Swagger UI page's inline script is admitted by its nonce
+func TestOpenAPIDocumentServed(t *testing.T) {
+	h := NewServer(Config{Port: "0", ServiceName: "payment-gateway", MaxProcessingMillis: 50}).Handler
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("openapi.json expected 200 JSON, got %d %s", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	if !strings.HasPrefix(rr.Body.String(), "{\n  \"openapi\": \"3.") {
+		t.Fatalf("expected the document to start with its OpenAPI version, got %.40q", rr.Body.String())
+	}
+	var doc struct {
+		Info struct {
+			Version string `json:"version"`
+		} `json:"info"`
+		Paths map[string]map[string]struct {
+			OperationID string                     `json:"operationId"`
+			Responses   map[string]json.RawMessage `json:"responses"`
+		} `json:"paths"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Info.Version != apiSpecVersion {
+		t.Fatalf("expected version %s, got %s", apiSpecVersion, doc.Info.Version)
+	}
+	op := doc.Paths["/openapi.json"]["get"]
+	if op.OperationID != "getOpenAPIDocument" || op.Responses["200"] == nil {
+		t.Fatalf("expected the document to describe itself, got %+v", op)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("docs expected 200 HTML, got %d %s", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	nonce := regexp.MustCompile(`'nonce-([^']+)'`).FindStringSubmatch(rr.Header().Get("Content-Security-Policy"))
+	if nonce == nil || !strings.Contains(rr.Body.String(), `<script nonce="`+nonce[1]+`">`) {
+		t.Fatalf("expected the inline script to carry the policy's nonce, got policy %q", rr.Header().Get("Content-Security-Policy"))
+	}
+	if !strings.Contains(rr.Body.String(), `url: "openapi.json"`) {
+		t.Fatal("expected Swagger UI to load /openapi.json")
+	}
+}
@@ -0,0 +1,1036 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/healthcare-gitops/common/auth"
+	"github.com/healthcare-gitops/common/config"
+	"github.com/rs/zerolog/log"
+)
+
+// Claim states. A claim is pending until it is sent to the clearinghouse, which
+// accepts or rejects it; accepted claims are paid or denied by the payer's remittance
+// advice, and a payment can later be reversed. Rejected claims can be corrected and
+// sent again.
+const (
+	ClaimPending   = "pending"
+	ClaimSubmitted = "submitted"
+	ClaimAccepted  = "accepted"
+	ClaimRejected  = "rejected"
+	ClaimPaid      = "paid"
+	ClaimDenied    = "denied"
+	ClaimReversed  = "reversed"
+)
+
+// ProcessorRemittance records insurance payments settled from 835 remittance advice
+const ProcessorRemittance = "remittance"
+
+// MethodInsurance is the payment method of insurance settlements
+const MethodInsurance = "insurance"
+
+// Claim limits. 837P claims carry at most 12 diagnoses and 50 service lines.
+const (
+	maxClaimDiagnoses    = 12
+	maxClaimServiceLines = 50
+	maxTrackedClaims     = 10000
+	maxRemittanceSize    = 5 << 20
+)
+
+// defaultPlaceOfService is the CMS place of service code for an office visit
+const defaultPlaceOfService = "11"
+
+var (
+	// ErrClaimNotFound is returned for unknown claims
+	ErrClaimNotFound = errors.New("claim not found")
+
+	// ErrRemittanceDuplicate is returned for a remittance whose trace number was
+	// already applied
+	ErrRemittanceDuplicate = errors.New("remittance already applied")
+
+	errInvalidClaimTransition = errors.New("invalid claim state change")
+)
+
+var (
+	npiPattern        = regexp.MustCompile(`^[0-9]{10}$`)
+	taxIDPattern      = regexp.MustCompile(`^[0-9]{2}-?[0-9]{7}$`)
+	postalCodePattern = regexp.MustCompile(`^[0-9]{5}(-?[0-9]{4})?$`)
+	statePattern      = regexp.MustCompile(`^[A-Z]{2}$`)
+	icd10Pattern      = regexp.MustCompile(`^[A-TV-Z][0-9][0-9A-Z](\.?[0-9A-Z]{1,4})?$`)
+	procedurePattern  = regexp.MustCompile(`^[A-Z0-9]{5}$`)
+	modifierPattern   = regexp.MustCompile(`^[A-Z0-9]{2}$`)
+	posPattern        = regexp.MustCompile(`^[0-9]{2}$`)
+)
+
+// ClaimError lists the problems with a claim
+type ClaimError struct {
+	Problems []string
+}
+
+func (e *ClaimError) Error() string {
+	return "invalid claim: " + strings.Join(e.Problems, "; ")
+}
+
+// ClaimAddress is a street address
+type ClaimAddress struct {
+	Line1      string `json:"line1"`
+	Line2      string `json:"line2,omitempty"`
+	City       string `json:"city"`
+	State      string `json:"state"`
+	PostalCode string `json:"postal_code"`
+}
+
+// ClaimProvider is the provider billing for the services
+type ClaimProvider struct {
+	Name    string       `json:"name"`
+	NPI     string       `json:"npi"`
+	TaxID   string       `json:"tax_id"`
+	Address ClaimAddress `json:"address"`
+}
+
+// ClaimPayer is the insurer, identified by its payer ID at the clearinghouse
+type ClaimPayer struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// ClaimSubscriber is the insured person, as on their eligibility record
+type ClaimSubscriber struct {
+	MemberID    string `json:"member_id"`
+	GroupNumber string `json:"group_number,omitempty"`
+	FirstName   string `json:"first_name"`
+	LastName    string `json:"last_name"`
+	// DateOfBirth (YYYY-MM-DD), Gender (M, F or U) and Address are required when the
+	// subscriber is the patient
+	DateOfBirth string        `json:"date_of_birth,omitempty"`
+	Gender      string        `json:"gender,omitempty"`
+	Address     *ClaimAddress `json:"address,omitempty"`
+}
+
+// ClaimPatient is a dependent of the subscriber who received the services
+type ClaimPatient struct {
+	// Relationship to the subscriber: spouse, child or other
+	Relationship string       `json:"relationship"`
+	FirstName    string       `json:"first_name"`
+	LastName     string       `json:"last_name"`
+	DateOfBirth  string       `json:"date_of_birth"`
+	Gender       string       `json:"gender"`
+	Address      ClaimAddress `json:"address"`
+}
+
+// ServiceLine is one billed procedure
+type ServiceLine struct {
+	// Procedure is a CPT or HCPCS code, with up to four modifiers
+	Procedure string   `json:"procedure"`
+	Modifiers []string `json:"modifiers,omitempty"`
+	Charge    Money    `json:"charge"`
+	Units     int      `json:"units,omitempty"`
+	// DiagnosisPointers are 1-based positions in the claim's diagnoses; the first
+	// diagnosis when empty
+	DiagnosisPointers []int  `json:"diagnosis_pointers,omitempty"`
+	ServiceDate       string `json:"service_date"`
+}
+
+// ClaimRequest is a professional claim. Patient is set when the patient is a
+// dependent rather than the subscriber.
+type ClaimRequest struct {
+	// PatientID is the gateway's patient ID, for search; it is not sent to the payer
+	PatientID       string          `json:"patient_id"`
+	BillingProvider ClaimProvider   `json:"billing_provider"`
+	Payer           ClaimPayer      `json:"payer"`
+	Subscriber      ClaimSubscriber `json:"subscriber"`
+	Patient         *ClaimPatient   `json:"patient,omitempty"`
+	// PlaceOfService is the CMS place of service code, 11 (office) when empty
+	PlaceOfService string `json:"place_of_service,omitempty"`
+	// Diagnoses are ICD-10-CM codes, the principal diagnosis first
+	Diagnoses    []string      `json:"diagnoses"`
+	ServiceLines []ServiceLine `json:"service_lines"`
+}
+
+// ClaimAdjustment is a payer's reason for paying less than was charged: a CAS group
+// (CO contractual, PR patient responsibility, OA other, PI payer initiated) and CARC
+type ClaimAdjustment struct {
+	Group       string `json:"group"`
+	Reason      string `json:"reason"`
+	AmountMinor int64  `json:"amount_minor"`
+}
+
+// ClaimEvent is one status change of a claim
+type ClaimEvent struct {
+	Status string    `json:"status"`
+	Detail string    `json:"detail,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// Claim is a claim and its adjudication so far
+type Claim struct {
+	// ID is the patient control number (CLM01) the payer returns on the remittance
+	ID          string       `json:"id"`
+	Status      string       `json:"status"`
+	PatientID   string       `json:"patient_id"`
+	Payer       ClaimPayer   `json:"payer"`
+	TotalCharge Money        `json:"total_charge"`
+	Request     ClaimRequest `json:"request"`
+	// ControlNumber is the interchange control number of the claim's current 837
+	ControlNumber int `json:"control_number"`
+	// PayerClaimNumber, Paid, PatientResponsibility and Adjustments come from the
+	// payer's remittance; TransactionID is the settlement of the payment
+	PayerClaimNumber      string            `json:"payer_claim_number,omitempty"`
+	Paid                  *Money            `json:"paid,omitempty"`
+	PatientResponsibility *Money            `json:"patient_responsibility,omitempty"`
+	Adjustments           []ClaimAdjustment `json:"adjustments,omitempty"`
+	TransactionID         string            `json:"transaction_id,omitempty"`
+	History               []ClaimEvent      `json:"history"`
+	CreatedAt             time.Time         `json:"created_at"`
+	UpdatedAt             time.Time         `json:"updated_at"`
+}
+
+// ClaimSummary is a claim without its clinical detail, for lists
+type ClaimSummary struct {
+	ID          string     `json:"id"`
+	Status      string     `json:"status"`
+	PatientID   string     `json:"patient_id"`
+	Payer       ClaimPayer `json:"payer"`
+	TotalCharge Money      `json:"total_charge"`
+	Paid        *Money     `json:"paid,omitempty"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// ClaimPage is one page of claim summaries, newest first
+type ClaimPage struct {
+	Claims     []ClaimSummary `json:"claims"`
+	Count      int            `json:"count"`
+	Total      int            `json:"total"`
+	NextOffset *int           `json:"next_offset,omitempty"`
+}
+
+func (c *Claim) summary() ClaimSummary {
+	return ClaimSummary{ID: c.ID, Status: c.Status, PatientID: c.PatientID, Payer: c.Payer, TotalCharge: c.TotalCharge, Paid: c.Paid, UpdatedAt: c.UpdatedAt}
+}
+
+// transition moves a claim to status, recording the change
+func (c *Claim) transition(status, detail string, at time.Time) {
+	c.Status, c.UpdatedAt = status, at
+	c.History = append(c.History, ClaimEvent{Status: status, Detail: detail, At: at})
+	RecordClaimStatus(status)
+}
+
+// ClaimAcknowledgement is the clearinghouse's acceptance or rejection of a submitted
+// claim, from its 999 or 277CA
+type ClaimAcknowledgement struct {
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// RemittanceClaim is the outcome of one claim on a remittance: settled, denied,
+// reversed, or unmatched when the gateway has no such claim or the claim could not
+// take the payment
+type RemittanceClaim struct {
+	ClaimID               string            `json:"claim_id"`
+	StatusCode            string            `json:"status_code"`
+	PayerClaimNumber      string            `json:"payer_claim_number,omitempty"`
+	Charged               Money             `json:"charged"`
+	Paid                  Money             `json:"paid"`
+	PatientResponsibility Money             `json:"patient_responsibility"`
+	Adjustments           []ClaimAdjustment `json:"adjustments,omitempty"`
+	Result                string            `json:"result"`
+	Detail                string            `json:"detail,omitempty"`
+	TransactionID         string            `json:"transaction_id,omitempty"`
+}
+
+// Remittance is an applied 835
+type Remittance struct {
+	TraceNumber string            `json:"trace_number"`
+	Payer       ClaimPayer        `json:"payer"`
+	Method      string            `json:"method"`
+	Total       Money             `json:"total"`
+	PaymentDate string            `json:"payment_date,omitempty"`
+	Claims      []RemittanceClaim `json:"claims"`
+	AppliedAt   time.Time         `json:"applied_at"`
+}
+
+// RemittanceRequest carries an 835 in a JSON body
+type RemittanceRequest struct {
+	X12 string `json:"x12"`
+}
+
+// ClaimSubmitter hands an 837 to a clearinghouse, which acknowledges it asynchronously
+type ClaimSubmitter interface {
+	Submit(ctx context.Context, claimID string, x12 []byte) error
+}
+
+// HTTPClaimSubmitter posts 837s to a clearinghouse's /claims endpoint
+type HTTPClaimSubmitter struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewHTTPClaimSubmitter returns a submitter for the clearinghouse at baseURL, or nil
+// when baseURL is empty
+func NewHTTPClaimSubmitter(baseURL string) ClaimSubmitter {
+	if baseURL == "" {
+		return nil
+	}
+	return &HTTPClaimSubmitter{
+		URL:    strings.TrimRight(baseURL, "/") + "/claims",
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Submit posts one interchange; any status other than 200 or 202 is a failure
+func (s *HTTPClaimSubmitter) Submit(ctx context.Context, claimID string, x12 []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(x12))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/edi-x12")
+	req.Header.Set("X-Claim-ID", claimID)
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("clearinghouse: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("clearinghouse returned %s", resp.Status)
+	}
+	return nil
+}
+
+// ClaimsConfig identifies the gateway to its clearinghouse
+type ClaimsConfig struct {
+	// ClearinghouseURL receives 837s; empty leaves claims pending, for their X12 to be
+	// uploaded by hand
+	ClearinghouseURL string
+	SubmitterID      string
+	SubmitterName    string
+	SubmitterPhone   string
+	ReceiverID       string
+	ReceiverName     string
+	// Usage is P for production or T, the default, for test interchanges
+	Usage string
+}
+
+// claimsConfigFromEnv reads CLEARINGHOUSE_URL and CLAIMS_*
+func claimsConfigFromEnv() ClaimsConfig {
+	return ClaimsConfig{
+		ClearinghouseURL: config.GetEnv("CLEARINGHOUSE_URL", ""),
+		SubmitterID:      config.GetEnv("CLAIMS_SUBMITTER_ID", ""),
+		SubmitterName:    config.GetEnv("CLAIMS_SUBMITTER_NAME", ""),
+		SubmitterPhone:   config.GetEnv("CLAIMS_SUBMITTER_PHONE", ""),
+		ReceiverID:       config.GetEnv("CLAIMS_RECEIVER_ID", ""),
+		ReceiverName:     config.GetEnv("CLAIMS_RECEIVER_NAME", ""),
+		Usage:            config.GetEnv("CLAIMS_USAGE", "T"),
+	}
+}
+
+// Validate checks the interchange identifiers. They are only required to submit, so
+// an unconfigured gateway can still build claims.
+func (c ClaimsConfig) Validate() error {
+	if len(c.SubmitterID) > 15 || len(c.ReceiverID) > 15 {
+		return errors.New("CLAIMS_SUBMITTER_ID and CLAIMS_RECEIVER_ID must be at most 15 characters")
+	}
+	if c.Usage != "" && c.Usage != "P" && c.Usage != "T" {
+		return errors.New("CLAIMS_USAGE must be P (production) or T (test)")
+	}
+	if c.ClearinghouseURL != "" && (c.SubmitterID == "" || c.ReceiverID == "") {
+		return errors.New("CLEARINGHOUSE_URL needs CLAIMS_SUBMITTER_ID and CLAIMS_RECEIVER_ID")
+	}
+	return nil
+}
+
+// ClaimStore holds claims and the remittances applied to them. Insurance payments
+// are recorded as captured transactions, so they appear in transaction search and the
+// SOX audit trail next to card payments.
+type ClaimStore struct {
+	mu          sync.RWMutex
+	claims      map[string]*Claim
+	order       []string // claim IDs, oldest first, for eviction
+	remittances map[string]bool
+	control     int
+	now         func() time.Time
+
+	cfg       ClaimsConfig
+	submitter ClaimSubmitter
+
+	// Settlements are saved to repository and indexed in transactions; sox audits them
+	repository   TransactionRepository
+	transactions *TransactionStore
+	sox          *SOXFinancialControlManager
+	// webhooks tells downstream systems of settlements and reversals; nil disables it
+	webhooks *WebhookStore
+	// rates snapshots settlements' rate to the reporting currency; nil takes none
+	rates *ExchangeRates
+}
+
+// NewClaimStore creates an empty store submitting through submitter, which may be nil
+// when there is no clearinghouse
+func NewClaimStore(cfg ClaimsConfig, submitter ClaimSubmitter) *ClaimStore {
+	return &ClaimStore{
+		claims:      make(map[string]*Claim),
+		remittances: make(map[string]bool),
+		now:         time.Now,
+		cfg:         cfg,
+		submitter:   submitter,
+	}
+}
+
+// validateClaim checks a claim against the 837P's requirements, normalizing codes to
+// upper case and filling defaults
+func validateClaim(req *ClaimRequest, today time.Time) (Money, error) {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if req.PatientID == "" {
+		add("patient_id is required")
+	}
+	provider := &req.BillingProvider
+	if strings.TrimSpace(provider.Name) == "" {
+		add("billing_provider.name is required")
+	}
+	if !validNPI(provider.NPI) {
+		add("billing_provider.npi must be a valid 10-digit NPI")
+	}
+	if !taxIDPattern.MatchString(provider.TaxID) {
+		add("billing_provider.tax_id must be a 9-digit EIN")
+	}
+	problems = append(problems, validateClaimAddress("billing_provider.address", &provider.Address)...)
+	if req.Payer.ID == "" || strings.TrimSpace(req.Payer.Name) == "" {
+		add("payer.id and payer.name are required")
+	}
+
+	subscriber := &req.Subscriber
+	if subscriber.MemberID == "" {
+		add("subscriber.member_id is required")
+	}
+	if strings.TrimSpace(subscriber.FirstName) == "" || strings.TrimSpace(subscriber.LastName) == "" {
+		add("subscriber.first_name and subscriber.last_name are required")
+	}
+	subscriber.Gender = strings.ToUpper(subscriber.Gender)
+	if req.Patient == nil {
+		// The subscriber is the patient, whose demographics the claim needs
+		problems = append(problems, validateDemographics("subscriber", subscriber.DateOfBirth, subscriber.Gender, today)...)
+		if subscriber.Address == nil {
+			add("subscriber.address is required when the subscriber is the patient")
+		} else {
+			problems = append(problems, validateClaimAddress("subscriber.address", subscriber.Address)...)
+		}
+	} else {
+		patient := req.Patient
+		if _, ok := patientRelationshipCodes[patient.Relationship]; !ok {
+			add("patient.relationship must be spouse, child or other")
+		}
+		if strings.TrimSpace(patient.FirstName) == "" || strings.TrimSpace(patient.LastName) == "" {
+			add("patient.first_name and patient.last_name are required")
+		}
+		patient.Gender = strings.ToUpper(patient.Gender)
+		problems = append(problems, validateDemographics("patient", patient.DateOfBirth, patient.Gender, today)...)
+		problems = append(problems, validateClaimAddress("patient.address", &patient.Address)...)
+	}
+
+	if req.PlaceOfService == "" {
+		req.PlaceOfService = defaultPlaceOfService
+	}
+	if !posPattern.MatchString(req.PlaceOfService) {
+		add("place_of_service must be a 2-digit CMS place of service code")
+	}
+	if len(req.Diagnoses) == 0 || len(req.Diagnoses) > maxClaimDiagnoses {
+		add("diagnoses must list 1 to %d ICD-10-CM codes", maxClaimDiagnoses)
+	}
+	for i, code := range req.Diagnoses {
+		req.Diagnoses[i] = strings.ToUpper(strings.TrimSpace(code))
+		if !icd10Pattern.MatchString(req.Diagnoses[i]) {
+			add("diagnoses[%d] %q is not an ICD-10-CM code", i, code)
+		}
+	}
+
+	total := Money{Currency: "USD"}
+	if len(req.ServiceLines) == 0 || len(req.ServiceLines) > maxClaimServiceLines {
+		add("service_lines must list 1 to %d lines", maxClaimServiceLines)
+	}
+	for i := range req.ServiceLines {
+		line := &req.ServiceLines[i]
+		field := fmt.Sprintf("service_lines[%d]", i)
+		line.Procedure = strings.ToUpper(strings.TrimSpace(line.Procedure))
+		if !procedurePattern.MatchString(line.Procedure) {
+			add("%s.procedure must be a 5-character CPT or HCPCS code", field)
+		}
+		if len(line.Modifiers) > 4 {
+			add("%s.modifiers must list at most 4 modifiers", field)
+		}
+		for j, modifier := range line.Modifiers {
+			line.Modifiers[j] = strings.ToUpper(modifier)
+			if !modifierPattern.MatchString(line.Modifiers[j]) {
+				add("%s.modifiers[%d] must be 2 letters or digits", field, j)
+			}
+		}
+		line.Charge.Currency = strings.ToUpper(line.Charge.Currency)
+		if line.Charge.Currency != "USD" || line.Charge.AmountMinor <= 0 {
+			add("%s.charge must be a positive USD amount", field)
+		}
+		total.AmountMinor += line.Charge.AmountMinor
+		if line.Units == 0 {
+			line.Units = 1
+		}
+		if line.Units < 0 || line.Units > 9999 {
+			add("%s.units must be between 1 and 9999", field)
+		}
+		if len(line.DiagnosisPointers) == 0 {
+			line.DiagnosisPointers = []int{1}
+		}
+		if len(line.DiagnosisPointers) > 4 {
+			add("%s.diagnosis_pointers must list at most 4 diagnoses", field)
+		}
+		for _, p := range line.DiagnosisPointers {
+			if p < 1 || p > len(req.Diagnoses) {
+				add("%s.diagnosis_pointers must be positions in diagnoses, from 1 to %d", field, len(req.Diagnoses))
+				break
+			}
+		}
+		if date, err := time.Parse(time.DateOnly, line.ServiceDate); err != nil {
+			add("%s.service_date must be a YYYY-MM-DD date", field)
+		} else if date.After(today) {
+			add("%s.service_date must not be in the future", field)
+		}
+	}
+	if len(problems) > 0 {
+		return Money{}, &ClaimError{Problems: problems}
+	}
+	return total, nil
+}
+
+func validateClaimAddress(field string, a *ClaimAddress) []string {
+	var problems []string
+	a.State = strings.ToUpper(a.State)
+	if strings.TrimSpace(a.Line1) == "" || strings.TrimSpace(a.City) == "" {
+		problems = append(problems, field+".line1 and "+field+".city are required")
+	}
+	if !statePattern.MatchString(a.State) {
+		problems = append(problems, field+".state must be a 2-letter state code")
+	}
+	if !postalCodePattern.MatchString(a.PostalCode) {
+		problems = append(problems, field+".postal_code must be a 5 or 9-digit ZIP code")
+	}
+	return problems
+}
+
+func validateDemographics(field, dateOfBirth, gender string, today time.Time) []string {
+	var problems []string
+	if dob, err := time.Parse(time.DateOnly, dateOfBirth); err != nil || dob.After(today) {
+		problems = append(problems, field+".date_of_birth must be a YYYY-MM-DD date in the past")
+	}
+	if gender != "M" && gender != "F" && gender != "U" {
+		problems = append(problems, field+".gender must be M, F or U")
+	}
+	return problems
+}
+
+// validNPI checks an NPI's Luhn check digit, computed over the number prefixed with
+// the 80840 health industry issuer
+func validNPI(npi string) bool {
+	if !npiPattern.MatchString(npi) {
+		return false
+	}
+	sum := 24 // the doubled-digit Luhn sum of the 80840 prefix
+	for i := 8; i >= 0; i-- {
+		d := int(npi[i] - '0')
+		if (8-i)%2 == 0 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return (10-sum%10)%10 == int(npi[9]-'0')
+}
+
+// Create validates and stores a claim as pending
+func (s *ClaimStore) Create(req ClaimRequest) (Claim, error) {
+	now := s.now().UTC()
+	total, err := validateClaim(&req, now)
+	if err != nil {
+		return Claim{}, err
+	}
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.control++
+	claim := &Claim{
+		// 19 characters, within the 20 payers echo back
+		ID:            "CLM-" + now.Format("060102") + "-" + hex.EncodeToString(suffix),
+		PatientID:     req.PatientID,
+		Payer:         req.Payer,
+		TotalCharge:   total,
+		Request:       req,
+		ControlNumber: s.control,
+		CreatedAt:     now,
+	}
+	claim.transition(ClaimPending, "", now)
+	s.claims[claim.ID] = claim
+	s.order = append(s.order, claim.ID)
+	if len(s.order) > maxTrackedClaims {
+		delete(s.claims, s.order[0])
+		s.order = s.order[1:]
+	}
+	return *claim, nil
+}
+
+// Get returns a claim
+func (s *ClaimStore) Get(id string) (Claim, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	claim, ok := s.claims[id]
+	if !ok {
+		return Claim{}, fmt.Errorf("%w: %s", ErrClaimNotFound, id)
+	}
+	return *claim, nil
+}
+
+// List returns one page of claim summaries matching filter, newest first, and how
+// many match in total. The filter's times bound when claims were created.
+func (s *ClaimStore) List(filter TransactionFilter) ([]ClaimSummary, int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	page := make([]ClaimSummary, 0)
+	total := 0
+	for i := len(s.order) - 1; i >= 0; i-- {
+		claim := s.claims[s.order[i]]
+		if (filter.Status != "" && claim.Status != filter.Status) ||
+			(filter.PatientID != "" && claim.PatientID != filter.PatientID) ||
+			(!filter.From.IsZero() && claim.CreatedAt.Before(filter.From)) ||
+			(!filter.To.IsZero() && claim.CreatedAt.After(filter.To)) {
+			continue
+		}
+		if total >= filter.Offset && len(page) < filter.Limit {
+			page = append(page, claim.summary())
+		}
+		total++
+	}
+	return page, total
+}
+
+// X12 serializes a claim as an 837P
+func (s *ClaimStore) X12(id string) ([]byte, error) {
+	claim, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	return encode837P(s.envelope(claim.ControlNumber), claim), nil
+}
+
+func (s *ClaimStore) envelope(control int) X12Envelope {
+	usage := s.cfg.Usage
+	if usage == "" {
+		usage = "T"
+	}
+	return X12Envelope{
+		SenderID:       s.cfg.SubmitterID,
+		ReceiverID:     s.cfg.ReceiverID,
+		SubmitterName:  s.cfg.SubmitterName,
+		SubmitterPhone: s.cfg.SubmitterPhone,
+		ReceiverName:   s.cfg.ReceiverName,
+		Usage:          usage,
+		ControlNumber:  control,
+		Time:           s.now(),
+	}
+}
+
+// Submit sends a pending or rejected claim to the clearinghouse. A resubmission gets
+// a new control number, as clearinghouses refuse a repeated one.
+func (s *ClaimStore) Submit(ctx context.Context, id string) (Claim, error) {
+	if s.submitter == nil {
+		return Claim{}, errors.New("claim submission is not configured")
+	}
+	s.mu.Lock()
+	claim, ok := s.claims[id]
+	if !ok {
+		s.mu.Unlock()
+		return Claim{}, fmt.Errorf("%w: %s", ErrClaimNotFound, id)
+	}
+	if claim.Status != ClaimPending && claim.Status != ClaimRejected {
+		status := claim.Status
+		s.mu.Unlock()
+		return Claim{}, fmt.Errorf("%w: only pending or rejected claims can be submitted, this one is %s", errInvalidClaimTransition, status)
+	}
+	if claim.Status == ClaimRejected {
+		s.control++
+		claim.ControlNumber = s.control
+	}
+	x12 := encode837P(s.envelope(claim.ControlNumber), *claim)
+	s.mu.Unlock()
+
+	// The claim is not held locked while the clearinghouse answers; a second submit
+	// in the meantime sends it twice, which the clearinghouse's duplicate check catches
+	if err := s.submitter.Submit(ctx, id, x12); err != nil {
+		return Claim{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	claim.transition(ClaimSubmitted, fmt.Sprintf("interchange %09d", claim.ControlNumber), s.now().UTC())
+	return *claim, nil
+}
+
+// Acknowledge applies the clearinghouse's acceptance or rejection of a submitted claim
+func (s *ClaimStore) Acknowledge(id string, ack ClaimAcknowledgement) (Claim, error) {
+	if ack.Status != ClaimAccepted && ack.Status != ClaimRejected {
+		return Claim{}, &ClaimError{Problems: []string{"status must be accepted or rejected"}}
+	}
+	if len(ack.Reason) > maxChangeReason {
+		return Claim{}, &ClaimError{Problems: []string{fmt.Sprintf("reason must be at most %d characters", maxChangeReason)}}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	claim, ok := s.claims[id]
+	if !ok {
+		return Claim{}, fmt.Errorf("%w: %s", ErrClaimNotFound, id)
+	}
+	if claim.Status != ClaimSubmitted {
+		return Claim{}, fmt.Errorf("%w: only submitted claims are acknowledged, this one is %s", errInvalidClaimTransition, claim.Status)
+	}
+	claim.transition(ack.Status, ack.Reason, s.now().UTC())
+	return *claim, nil
+}
+
+// ApplyRemittance applies an 835 to the claims it names. Paid claims are settled as
+// captured insurance transactions and reversals refund the earlier settlement. A
+// remittance is applied once; its trace number identifies it.
+func (s *ClaimStore) ApplyRemittance(ctx context.Context, data []byte, userID, ipAddress string) (Remittance, error) {
+	advice, err := parse835(data)
+	if err != nil {
+		RecordRemittance("invalid")
+		return Remittance{}, err
+	}
+	s.mu.Lock()
+	if s.remittances[advice.TraceNumber] {
+		s.mu.Unlock()
+		RecordRemittance("duplicate")
+		return Remittance{}, fmt.Errorf("%w: trace number %s", ErrRemittanceDuplicate, advice.TraceNumber)
+	}
+	s.remittances[advice.TraceNumber] = true
+	s.mu.Unlock()
+
+	remittance := Remittance{
+		TraceNumber: advice.TraceNumber,
+		Payer:       ClaimPayer{ID: advice.PayerID, Name: advice.PayerName},
+		Method:      advice.Method,
+		Total:       Money{AmountMinor: advice.Total, Currency: "USD"},
+		PaymentDate: advice.PaymentDate,
+		Claims:      make([]RemittanceClaim, 0, len(advice.Claims)),
+		AppliedAt:   s.now().UTC(),
+	}
+	for _, clp := range advice.Claims {
+		result := s.applyClaimPayment(ctx, advice, clp, userID, ipAddress)
+		remittance.Claims = append(remittance.Claims, result)
+	}
+	RecordRemittance("applied")
+	return remittance, nil
+}
+
+// applyClaimPayment applies one CLP loop
+func (s *ClaimStore) applyClaimPayment(ctx context.Context, advice RemittanceAdvice, clp RemittanceClaimAdvice, userID, ipAddress string) RemittanceClaim {
+	result := RemittanceClaim{
+		ClaimID:               clp.ClaimID,
+		StatusCode:            clp.StatusCode,
+		PayerClaimNumber:      clp.PayerClaimNumber,
+		Charged:               Money{AmountMinor: clp.Charged, Currency: "USD"},
+		Paid:                  Money{AmountMinor: clp.Paid, Currency: "USD"},
+		PatientResponsibility: Money{AmountMinor: clp.PatientResponsibility, Currency: "USD"},
+		Adjustments:           clp.Adjustments,
+		Result:                "unmatched",
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	claim, ok := s.claims[clp.ClaimID]
+	if !ok {
+		result.Detail = "no such claim"
+		return result
+	}
+	at := s.now().UTC()
+	detail := fmt.Sprintf("remittance %s", advice.TraceNumber)
+
+	switch clp.StatusCode {
+	case clpReversal:
+		if claim.Status != ClaimPaid && claim.Status != ClaimDenied {
+			result.Detail = "only adjudicated claims can be reversed, this one is " + claim.Status
+			return result
+		}
+		if claim.TransactionID != "" {
+			txnID, err := s.reverse(ctx, claim, advice.TraceNumber, userID, ipAddress)
+			if err != nil {
+				log.Error().Err(err).Str("claim_id", claim.ID).Str("transaction_id", claim.TransactionID).Msg("Failed to reverse insurance settlement")
+				result.Detail = "the settlement could not be refunded: " + err.Error()
+				return result
+			}
+			result.TransactionID = txnID
+		}
+		claim.transition(ClaimReversed, detail, at)
+		result.Result = "reversed"
+		return result
+
+	case clpProcessedPrimary, clpProcessedSecondary, clpProcessedTertiary,
+		clpForwardedPrimary, clpForwardedSecondary, clpForwardedTertiary, clpDenied:
+		if claim.Status != ClaimSubmitted && claim.Status != ClaimAccepted {
+			result.Detail = "only submitted or accepted claims can be paid, this one is " + claim.Status
+			return result
+		}
+		claim.PayerClaimNumber = clp.PayerClaimNumber
+		claim.PatientResponsibility = &result.PatientResponsibility
+		claim.Adjustments = clp.Adjustments
+		if clp.StatusCode == clpDenied || clp.Paid <= 0 {
+			claim.Paid = &Money{Currency: "USD"}
+			claim.transition(ClaimDenied, detail, at)
+			result.Result = "denied"
+			return result
+		}
+		txn, err := s.settle(ctx, claim, advice, clp, at, userID, ipAddress)
+		if err != nil {
+			log.Error().Err(err).Str("claim_id", claim.ID).Msg("Failed to record insurance settlement")
+			result.Detail = "the settlement could not be recorded: " + err.Error()
+			return result
+		}
+		claim.Paid, claim.TransactionID = &result.Paid, txn.ID
+		claim.transition(ClaimPaid, detail, at)
+		RecordClaimPayment(result.Paid)
+		result.Result, result.TransactionID = "settled", txn.ID
+		return result
+
+	default:
+		result.Detail = "unsupported claim status code " + clp.StatusCode
+		return result
+	}
+}
+
+// settle records a claim payment as a captured transaction. The payer is the
+// customer; the trace number is the processor reference, for reconciliation with the
+// bank deposit.
+func (s *ClaimStore) settle(ctx context.Context, claim *Claim, advice RemittanceAdvice, clp RemittanceClaimAdvice, at time.Time, userID, ipAddress string) (Transaction, error) {
+	txn := Transaction{
+		ID:                 transactionID(at),
+		AuditID:            generateAuditID(),
+		AuthCode:           clp.PayerClaimNumber,
+		Processor:          ProcessorRemittance,
+		ProcessorReference: advice.TraceNumber,
+		Status:             StatusCaptured,
+		Amount:             Money{AmountMinor: clp.Paid, Currency: "USD"},
+		CustomerID:         claim.Payer.ID,
+		Method:             MethodInsurance,
+		PatientID:          claim.PatientID,
+		Description:        fmt.Sprintf("Insurance payment from %s for claim %s", claim.Payer.Name, claim.ID),
+		ComplianceTags:     []string{TagSOX, TagHIPAA},
+		HighValue:          clp.Paid >= 10000,
+		ProcessedAt:        at,
+		CapturedAt:         &at,
+	}
+	if txn.HighValue {
+		txn.ComplianceTags = append(txn.ComplianceTags, TagHighValue)
+	}
+	// The insurer has paid, so a missing rate is logged rather than refusing the payment
+	var err error
+	if txn.ExchangeRate, txn.ReportingAmount, err = s.rates.Snapshot(ctx, txn.Amount); err != nil {
+		log.Warn().Err(err).Str("transaction_id", txn.ID).Str("claim_id", claim.ID).Msg("Insurance payment recorded without an exchange rate")
+	}
+	if err := s.sox.RecordTransactionChange(txn.ID, "INSURANCE_SETTLEMENT", userID, ipAddress,
+		fmt.Sprintf("Claim %s paid %s by remittance %s", claim.ID, formatMoney(txn.Amount), advice.TraceNumber)); err != nil {
+		return Transaction{}, err
+	}
+	if err := s.repository.Save(ctx, txn); err != nil {
+		return Transaction{}, err
+	}
+	s.transactions.Add(txn)
+	s.webhooks.Publish(EventPaymentSucceeded, paymentSucceeded(txn, claim.ID))
+	return txn, nil
+}
+
+// reverse refunds a claim's settlement in full
+func (s *ClaimStore) reverse(ctx context.Context, claim *Claim, trace, userID, ipAddress string) (string, error) {
+	id := claim.TransactionID
+	unlock := lockTransaction(id)
+	defer unlock()
+	txn, err := s.repository.Get(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	refund, err := txn.Refund(nil, "Payer reversal, remittance "+trace, generateAuditID(), s.now().UTC())
+	if err != nil {
+		return "", err
+	}
+	if err := s.sox.RecordTransactionChange(id, "INSURANCE_REVERSAL", userID, ipAddress,
+		fmt.Sprintf("Claim %s payment of %s reversed by remittance %s", claim.ID, formatMoney(refund.Amount), trace)); err != nil {
+		return "", err
+	}
+	if err := s.repository.Save(ctx, txn); err != nil {
+		return "", err
+	}
+	s.transactions.Update(txn)
+	RecordRefund("full", refund.Amount)
+	s.webhooks.Publish(EventRefundIssued, refundIssued(txn, claim.ID))
+	return id, nil
+}
+
+// writeClaimError maps store errors to responses. Validation problems are listed in a
+// 422 so every one can be fixed at once.
+func writeClaimError(w http.ResponseWriter, err error) {
+	var invalid *ClaimError
+	switch {
+	case errors.As(err, &invalid):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":    "invalid claim",
+			"problems": invalid.Problems,
+		})
+	case errors.Is(err, ErrClaimNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errInvalidClaimTransition), errors.Is(err, ErrRemittanceDuplicate):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, errInvalidRemittance):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// ListHandler handles GET /api/v1/claims: claim summaries filtered by patient, status
+// and creation time, newest first, with the transaction list's paging
+func (s *ClaimStore) ListHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseTransactionFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	claims, total := s.List(filter)
+	page := ClaimPage{Claims: claims, Count: len(claims), Total: total}
+	if next := filter.Offset + len(claims); next < total {
+		page.NextOffset = &next
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(page)
+}
+
+// CreateHandler handles POST /api/v1/claims
+func (s *ClaimStore) CreateHandler(w http.ResponseWriter, r *http.Request) {
+	var req ClaimRequest
+	if !decodeTemplateBody(w, r, &req) {
+		return
+	}
+	claim, err := s.Create(req)
+	if err != nil {
+		writeClaimError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/v1/claims/"+claim.ID)
+	w.Header().Set("X-PHI-Protected", "true")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(claim)
+}
+
+// GetHandler handles GET /api/v1/claims/{claimID}
+func (s *ClaimStore) GetHandler(w http.ResponseWriter, r *http.Request) {
+	claim, err := s.Get(chi.URLParam(r, "claimID"))
+	if err != nil {
+		writeClaimError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-PHI-Protected", "true")
+	_ = json.NewEncoder(w).Encode(claim)
+}
+
+// X12Handler handles GET /api/v1/claims/{claimID}/x12
+func (s *ClaimStore) X12Handler(w http.ResponseWriter, r *http.Request) {
+	x12, err := s.X12(chi.URLParam(r, "claimID"))
+	if err != nil {
+		writeClaimError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/edi-x12")
+	w.Header().Set("X-PHI-Protected", "true")
+	_, _ = w.Write(x12)
+}
+
+// SubmitHandler handles POST /api/v1/claims/{claimID}/submit
+func (s *ClaimStore) SubmitHandler(w http.ResponseWriter, r *http.Request) {
+	if s.submitter == nil {
+		http.Error(w, "Claim submission is unavailable: CLEARINGHOUSE_URL is not set", http.StatusServiceUnavailable)
+		return
+	}
+	id := chi.URLParam(r, "claimID")
+	claim, err := s.Submit(r.Context(), id)
+	if err != nil && !errors.Is(err, ErrClaimNotFound) && !errors.Is(err, errInvalidClaimTransition) {
+		log.Error().Err(err).Str("claim_id", id).Msg("Clearinghouse refused claim")
+		http.Error(w, "Clearinghouse refused claim "+id, http.StatusBadGateway)
+		return
+	}
+	if err != nil {
+		writeClaimError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(claim)
+}
+
+// StatusHandler handles POST /api/v1/claims/{claimID}/status, the clearinghouse's
+// acknowledgement of a submitted claim
+func (s *ClaimStore) StatusHandler(w http.ResponseWriter, r *http.Request) {
+	var ack ClaimAcknowledgement
+	if !decodeTemplateBody(w, r, &ack) {
+		return
+	}
+	claim, err := s.Acknowledge(chi.URLParam(r, "claimID"), ack)
+	if err != nil {
+		writeClaimError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(claim)
+}
+
+// RemittanceHandler handles POST /api/v1/remittances: an 835 posted as
+// application/edi-x12, or as the x12 field of a JSON body
+func (s *ClaimStore) RemittanceHandler(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRemittanceSize))
+	if err != nil {
+		http.Error(w, "request entity too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		var req RemittanceRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		data = []byte(req.X12)
+	}
+
+	userID := "unauthenticated"
+	if identity, ok := auth.FromContext(r.Context()); ok {
+		userID = identity.UserID
+	}
+	remittance, err := s.ApplyRemittance(r.Context(), data, userID, r.RemoteAddr)
+	if err != nil {
+		writeClaimError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-SOX-Compliance", "true")
+	_ = json.NewEncoder(w).Encode(remittance)
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClaimSubmitter records submitted interchanges, failing while fail is set
+type fakeClaimSubmitter struct {
+	submitted []string
+	fail      bool
+}
+
+func (f *fakeClaimSubmitter) Submit(ctx context.Context, claimID string, x12 []byte) error {
+	if f.fail {
+		return errors.New("clearinghouse down")
+	}
+	f.submitted = append(f.submitted, string(x12))
+	return nil
+}
+
+func testClaimRequest() ClaimRequest {
+	address := ClaimAddress{Line1: "12 Elm St", City: "Austin", State: "tx", PostalCode: "78704"}
+	return ClaimRequest{
+		PatientID: "P-1001",
+		BillingProvider: ClaimProvider{
+			Name:    "Austin Family Clinic",
+			NPI:     "1234567893",
+			TaxID:   "12-3456789",
+			Address: ClaimAddress{Line1: "100 Congress Ave", City: "Austin", State: "TX", PostalCode: "78701"},
+		},
+		Payer:      ClaimPayer{ID: "87726", Name: "UnitedHealthcare"},
+		Subscriber: ClaimSubscriber{MemberID: "W123456789", GroupNumber: "GRP-100", FirstName: "Ana", LastName: "Lopez", DateOfBirth: "1980-04-12", Gender: "f", Address: &address},
+		Diagnoses:  []string{"e11.9", "I10"},
+		ServiceLines: []ServiceLine{
+			{Procedure: "99213", Modifiers: []string{"25"}, Charge: Money{AmountMinor: 15000, Currency: "USD"}, DiagnosisPointers: []int{1, 2}, ServiceDate: "2026-02-20"},
+			{Procedure: "81001", Charge: Money{AmountMinor: 8000, Currency: "usd"}, Units: 2, DiagnosisPointers: []int{2}, ServiceDate: "2026-02-20"},
+		},
+	}
+}
+
+func TestValidNPI(t *testing.T) {
+	for npi, want := range map[string]bool{"1234567893": true, "1245319599": true, "1234567890": false, "123456789": false, "12345678931": false, "abcdefghij": false} {
+		if validNPI(npi) != want {
+			t.Errorf("validNPI(%q) expected %v", npi, want)
+		}
+	}
+}
+
+func TestClaimValidation(t *testing.T) {
+	today := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	req := testClaimRequest()
+	total, err := validateClaim(&req, today)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total.AmountMinor != 23000 || total.Currency != "USD" {
+		t.Fatalf("expected a 230.00 USD total, got %+v", total)
+	}
+	if req.PlaceOfService != "11" || req.Diagnoses[0] != "E11.9" || req.Subscriber.Gender != "F" || req.Subscriber.Address.State != "TX" || req.ServiceLines[0].Units != 1 {
+		t.Fatalf("expected defaults and upper-cased codes, got %+v", req)
+	}
+
+	req = testClaimRequest()
+	req.BillingProvider.NPI = "1234567890"
+	req.Subscriber.Address = nil
+	req.Diagnoses = []string{"E11.9", "not-a-code"}
+	req.ServiceLines[0].DiagnosisPointers = []int{3}
+	req.ServiceLines[1].Charge.Currency = "EUR"
+	req.ServiceLines[1].ServiceDate = "2026-03-09"
+	_, err = validateClaim(&req, today)
+	var invalid *ClaimError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("expected a ClaimError, got %v", err)
+	}
+	for _, want := range []string{"billing_provider.npi", "subscriber.address", "diagnoses[1]", "service_lines[0].diagnosis_pointers", "service_lines[1].charge", "service_lines[1].service_date"} {
+		found := false
+		for _, p := range invalid.Problems {
+			found = found || strings.HasPrefix(p, want)
+		}
+		if !found {
+			t.Errorf("expected a problem with %s, got %q", want, invalid.Problems)
+		}
+	}
+
+	// A dependent patient needs their own demographics, not the subscriber's
+	req = testClaimRequest()
+	req.Subscriber.DateOfBirth, req.Subscriber.Gender, req.Subscriber.Address = "", "", nil
+	req.Patient = &ClaimPatient{Relationship: "child", FirstName: "Mia", LastName: "Lopez", DateOfBirth: "2015-06-01", Gender: "F",
+		Address: ClaimAddress{Line1: "12 Elm St", City: "Austin", State: "TX", PostalCode: "78704-1234"}}
+	if _, err := validateClaim(&req, today); err != nil {
+		t.Fatalf("expected a dependent's claim to be valid, got %v", err)
+	}
+	req.Patient.Relationship = "cousin"
+	if _, err := validateClaim(&req, today); err == nil || !strings.Contains(err.Error(), "patient.relationship") {
+		t.Fatalf("expected an unknown relationship to be refused, got %v", err)
+	}
+}
+
+func TestClaimLifecycle(t *testing.T) {
+	ctx := t.Context()
+	submitter := &fakeClaimSubmitter{}
+	s := NewClaimStore(ClaimsConfig{SubmitterID: "GATEWAY01", ReceiverID: "CLEARHOUSE"}, submitter)
+	s.repository, s.transactions, s.sox = newMemoryRepository(10), NewTransactionStore(), &SOXFinancialControlManager{}
+	s.now = func() time.Time { return time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC) }
+
+	claim, err := s.Create(testClaimRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claim.Status != ClaimPending || len(claim.ID) > 20 || claim.TotalCharge.AmountMinor != 23000 {
+		t.Fatalf("unexpected new claim: %+v", claim)
+	}
+	if _, err := s.Acknowledge(claim.ID, ClaimAcknowledgement{Status: ClaimAccepted}); !errors.Is(err, errInvalidClaimTransition) {
+		t.Fatalf("expected a pending claim to refuse an acknowledgement, got %v", err)
+	}
+
+	submitter.fail = true
+	if _, err := s.Submit(ctx, claim.ID); err == nil {
+		t.Fatal("expected the clearinghouse failure to be returned")
+	}
+	if got, _ := s.Get(claim.ID); got.Status != ClaimPending {
+		t.Fatalf("expected a refused claim to stay pending, got %s", got.Status)
+	}
+	submitter.fail = false
+	if claim, err = s.Submit(ctx, claim.ID); err != nil || claim.Status != ClaimSubmitted {
+		t.Fatalf("expected the claim submitted, got %v with %+v", err, claim)
+	}
+	if !strings.Contains(submitter.submitted[0], "CLM*"+claim.ID+"*230.00") {
+		t.Fatalf("expected the 837 to carry the claim, got:\n%s", submitter.submitted[0])
+	}
+	if _, err := s.Submit(ctx, claim.ID); !errors.Is(err, errInvalidClaimTransition) {
+		t.Fatalf("expected a submitted claim to refuse another submit, got %v", err)
+	}
+
+	// A rejected claim is resubmitted under a new control number
+	if claim, err = s.Acknowledge(claim.ID, ClaimAcknowledgement{Status: ClaimRejected, Reason: "Subscriber ID not found"}); err != nil {
+		t.Fatal(err)
+	}
+	if claim, err = s.Submit(ctx, claim.ID); err != nil || claim.ControlNumber != 2 {
+		t.Fatalf("expected the resubmission under control number 2, got %v with %+v", err, claim)
+	}
+	if claim, err = s.Acknowledge(claim.ID, ClaimAcknowledgement{Status: ClaimAccepted}); err != nil {
+		t.Fatal(err)
+	}
+
+	remittance, err := s.ApplyRemittance(ctx, []byte(test835(claim.ID, "1", "230", "184", "46", "EFT0001", "CAS*PR*2*46~CLP*CLM-UNKNOWN*1*100*100*0*12*PCN-2~")), "billing", "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(remittance.Claims) != 2 || remittance.Claims[0].Result != "settled" || remittance.Claims[1].Result != "unmatched" {
+		t.Fatalf("expected one settled and one unmatched claim, got %+v", remittance.Claims)
+	}
+	settled := remittance.Claims[0]
+	claim, _ = s.Get(claim.ID)
+	if claim.Status != ClaimPaid || claim.Paid.AmountMinor != 18400 || claim.PatientResponsibility.AmountMinor != 4600 || claim.TransactionID != settled.TransactionID || claim.PayerClaimNumber != "PCN-1" {
+		t.Fatalf("unexpected paid claim: %+v", claim)
+	}
+	txn, err := s.repository.Get(ctx, settled.TransactionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txn.Status != StatusCaptured || txn.Method != MethodInsurance || txn.Processor != ProcessorRemittance || txn.ProcessorReference != "EFT0001" || txn.Amount.AmountMinor != 18400 || txn.PatientID != "P-1001" {
+		t.Fatalf("unexpected settlement: %+v", txn)
+	}
+	if results := s.transactions.Search(TransactionQuery{Method: MethodInsurance}); len(results) != 1 {
+		t.Fatalf("expected the settlement in search, got %+v", results)
+	}
+
+	if _, err := s.ApplyRemittance(ctx, []byte(test835(claim.ID, "1", "230", "184", "46", "EFT0001", "")), "billing", "10.0.0.1"); !errors.Is(err, ErrRemittanceDuplicate) {
+		t.Fatalf("expected a repeated trace number to be refused, got %v", err)
+	}
+
+	remittance, err = s.ApplyRemittance(ctx, []byte(test835(claim.ID, "22", "-230", "-184", "-46", "EFT0002", "")), "billing", "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remittance.Claims[0].Result != "reversed" {
+		t.Fatalf("expected the reversal applied, got %+v", remittance.Claims[0])
+	}
+	if txn, _ = s.repository.Get(ctx, settled.TransactionID); txn.Status != StatusRefunded || txn.Refunded.AmountMinor != 18400 {
+		t.Fatalf("expected the settlement refunded, got %+v", txn)
+	}
+	claim, _ = s.Get(claim.ID)
+	statuses := ""
+	for _, e := range claim.History {
+		statuses += e.Status + " "
+	}
+	if want := "pending submitted rejected submitted accepted paid reversed "; statuses != want {
+		t.Fatalf("expected history %q, got %q", want, statuses)
+	}
+
+	actions := ""
+	for _, a := range s.sox.RecentAuditTrails(10) {
+		actions += a.Action + " "
+	}
+	if actions != "INSURANCE_REVERSAL INSURANCE_SETTLEMENT " {
+		t.Fatalf("expected the settlement and reversal audited, got %q", actions)
+	}
+
+	// A denial records no payment
+	denied, _ := s.Create(testClaimRequest())
+	if _, err := s.Submit(ctx, denied.ID); err != nil {
+		t.Fatal(err)
+	}
+	remittance, _ = s.ApplyRemittance(ctx, []byte(test835(denied.ID, "4", "230", "0", "0", "EFT0003", "CAS*CO*50*230~")), "billing", "10.0.0.1")
+	if remittance.Claims[0].Result != "denied" || remittance.Claims[0].TransactionID != "" {
+		t.Fatalf("expected the claim denied without a settlement, got %+v", remittance.Claims[0])
+	}
+	if got, _ := s.Get(denied.ID); got.Status != ClaimDenied || got.Adjustments[0].Reason != "50" {
+		t.Fatalf("unexpected denied claim: %+v", got)
+	}
+}
+
+func TestClaimEndpoints(t *testing.T) {
+	var received []byte
+	clearinghouse := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/claims" || r.Header.Get("Content-Type") != "application/edi-x12" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer clearinghouse.Close()
+	h := NewServer(Config{Port: "0", ServiceName: "payment-gateway", MaxProcessingMillis: 4,
+		Claims: ClaimsConfig{ClearinghouseURL: clearinghouse.URL, SubmitterID: "GATEWAY01", ReceiverID: "CLEARHOUSE"}}).Handler
+
+	do := func(method, path, contentType string, body []byte) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+	doJSON := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		return do(method, path, "application/json", payload)
+	}
+
+	rr := doJSON("POST", "/api/v1/claims", testClaimRequest())
+	if rr.Code != http.StatusCreated || rr.Header().Get("X-PHI-Protected") != "true" {
+		t.Fatalf("create expected 201 with the PHI header, got %d: %s", rr.Code, rr.Body)
+	}
+	var claim Claim
+	if err := json.NewDecoder(rr.Body).Decode(&claim); err != nil {
+		t.Fatal(err)
+	}
+	invalid := testClaimRequest()
+	invalid.ServiceLines = nil
+	if rr := doJSON("POST", "/api/v1/claims", invalid); rr.Code != http.StatusUnprocessableEntity || !strings.Contains(rr.Body.String(), "problems") {
+		t.Fatalf("invalid create expected 422 with problems, got %d: %s", rr.Code, rr.Body)
+	}
+
+	rr = do("GET", "/api/v1/claims/"+claim.ID+"/x12", "", nil)
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/edi-x12" || !strings.HasPrefix(rr.Body.String(), "ISA*") {
+		t.Fatalf("x12 expected an 837, got %d: %s", rr.Code, rr.Body)
+	}
+	if rr := do("POST", "/api/v1/claims/"+claim.ID+"/submit", "", nil); rr.Code != http.StatusAccepted || !bytes.Contains(received, []byte("CLM*"+claim.ID)) {
+		t.Fatalf("submit expected 202 and the 837 at the clearinghouse, got %d: %s", rr.Code, rr.Body)
+	}
+	if rr := do("POST", "/api/v1/claims/"+claim.ID+"/submit", "", nil); rr.Code != http.StatusConflict {
+		t.Fatalf("second submit expected 409, got %d", rr.Code)
+	}
+	if rr := doJSON("POST", "/api/v1/claims/"+claim.ID+"/status", ClaimAcknowledgement{Status: "lost"}); rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("invalid acknowledgement expected 422, got %d", rr.Code)
+	}
+	if rr := doJSON("POST", "/api/v1/claims/"+claim.ID+"/status", ClaimAcknowledgement{Status: ClaimAccepted}); rr.Code != http.StatusOK {
+		t.Fatalf("acknowledgement expected 200, got %d: %s", rr.Code, rr.Body)
+	}
+
+	// Raw and JSON-wrapped 835s are both accepted
+	rr = do("POST", "/api/v1/remittances", "application/edi-x12", []byte(test835(claim.ID, "1", "230", "200", "30", "EFT0001", "")))
+	var remittance Remittance
+	if rr.Code != http.StatusOK || json.NewDecoder(rr.Body).Decode(&remittance) != nil || remittance.Claims[0].Result != "settled" {
+		t.Fatalf("remittance expected 200 with the claim settled, got %d: %s", rr.Code, rr.Body)
+	}
+	if rr := doJSON("POST", "/api/v1/remittances", RemittanceRequest{X12: test835(claim.ID, "1", "230", "200", "30", "EFT0001", "")}); rr.Code != http.StatusConflict {
+		t.Fatalf("repeated remittance expected 409, got %d", rr.Code)
+	}
+	if rr := doJSON("POST", "/api/v1/remittances", RemittanceRequest{X12: "ST*835~"}); rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("unreadable remittance expected 422, got %d", rr.Code)
+	}
+	if rr := do("GET", "/api/v1/transactions/"+remittance.Claims[0].TransactionID, "", nil); rr.Code != http.StatusOK {
+		t.Fatalf("expected the settlement recorded, got %d", rr.Code)
+	}
+	if rr := do("POST", "/api/v1/transactions/"+remittance.Claims[0].TransactionID+"/refund", "", nil); rr.Code != http.StatusConflict {
+		t.Fatalf("refunding an insurance payment through the payment API expected 409, got %d", rr.Code)
+	}
+
+	rr = do("GET", "/api/v1/claims?status=paid&patient_id=P-1001", "", nil)
+	var page ClaimPage
+	if rr.Code != http.StatusOK || json.NewDecoder(rr.Body).Decode(&page) != nil {
+		t.Fatalf("list expected 200, got %d: %s", rr.Code, rr.Body)
+	}
+	if page.Total != 1 || page.Claims[0].ID != claim.ID || page.Claims[0].Paid.AmountMinor != 20000 {
+		t.Fatalf("expected the paid claim, got %+v", page)
+	}
+	if rr := do("GET", "/api/v1/claims?limit=0", "", nil); rr.Code != http.StatusBadRequest {
+		t.Fatalf("invalid limit expected 400, got %d", rr.Code)
+	}
+	if rr := do("GET", "/api/v1/claims/CLM-404", "", nil); rr.Code != http.StatusNotFound {
+		t.Fatalf("unknown claim expected 404, got %d", rr.Code)
+	}
+}
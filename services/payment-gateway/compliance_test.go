@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/healthcare-gitops/common/audit"
+	"github.com/healthcare-gitops/common/compliance"
+)
+
+// TestComplianceStatusChecksSOXControls tests that the status reflects the deployment:
+// a persisted, intact audit chain with approvals and authentication is compliant, and
+// a broken chain or an open API is not
+func TestComplianceStatusChecksSOXControls(t *testing.T) {
+	previous := auditEvents
+	auditEvents = audit.NewEmitter("payment-gateway", &memorySink{}, audit.Config{})
+	t.Cleanup(func() { auditEvents = previous })
+
+	path := filepath.Join(t.TempDir(), "sox-audit.jsonl")
+	sox, err := NewSOXFinancialControlManager(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, action := range []string{"CAPTURE", "APPROVE"} {
+		if err := sox.RecordTransactionChange("TXN-1", action, "u1", "10.0.0.1", action+" details"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	approvals, err := NewApprovalPolicy(ApprovalConfig{Threshold: 10000, Roles: map[string]string{"controller": ApprovalLevelDirector}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := PaymentHandler{SOX: sox, Approvals: approvals}
+
+	status := complianceStatus(h, true)
+	if status.Status != compliance.Compliant || len(status.Frameworks) != 1 || status.Frameworks[0] != compliance.SOX {
+		t.Fatalf("expected a compliant SOX status, got %+v", status)
+	}
+	controls := make(map[string]compliance.Control)
+	for _, c := range status.Controls {
+		controls[c.ID] = c
+	}
+	if c := controls["sox.audit_trail"]; c.Detail != "2 records, chain intact" || len(c.Evidence) != 2 || c.Evidence[0].URL != "/audit/trail/verify" {
+		t.Errorf("unexpected audit trail control %+v", c)
+	}
+	if len(status.ViolationMetrics) != 2 {
+		t.Errorf("expected the violation counters named, got %v", status.ViolationMetrics)
+	}
+
+	// Editing a record on disk fails the control and the service
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, bytes.Replace(raw, []byte("CAPTURE details"), []byte("CAPTURE edited!"), 1), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	status = complianceStatus(h, true)
+	if status.Status != compliance.NonCompliant || status.Controls[0].Status != compliance.Fail || status.Controls[0].Detail != "hash chain broken at record 1: hash does not match the record content" {
+		t.Fatalf("expected the broken chain to fail, got %+v", status.Controls[0])
+	}
+
+	// A trail in memory and no approval threshold are weaknesses; an open API fails
+	status = complianceStatus(PaymentHandler{SOX: &SOXFinancialControlManager{}}, false)
+	want := map[string]compliance.ControlStatus{
+		"sox.audit_trail":           compliance.Warning,
+		"sox.segregation_of_duties": compliance.Warning,
+		"sox.access_control":        compliance.Fail,
+		"sox.audit_bus":             compliance.Pass,
+	}
+	for _, c := range status.Controls {
+		if c.Status != want[c.ID] {
+			t.Errorf("expected %s to be %s, got %s: %s", c.ID, want[c.ID], c.Status, c.Detail)
+		}
+	}
+}
+
+func TestComplianceStatusRoute(t *testing.T) {
+	h := newAuthenticatedServer(t)
+	req := httptest.NewRequest(http.MethodGet, "/compliance/status", nil)
+	req.Header.Set("Authorization", "Bearer admin")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || rr.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("expected 200 no-store, got %d: %s", rr.Code, rr.Body)
+	}
+	var status compliance.Status
+	if err := json.Unmarshal(rr.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Service != "payment-gateway" || status.Version != apiSpecVersion || len(status.Controls) != 4 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+}
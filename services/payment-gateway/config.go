@@ -1,9 +1,21 @@
 package main
 
 import (
+	"fmt"
 	"os"
 	"strconv"
 	"time"
+
+	"github.com/healthcare-gitops/common/audit"
+	"github.com/healthcare-gitops/common/events"
+	"github.com/healthcare-gitops/common/auth"
+	"github.com/healthcare-gitops/common/clientip"
+	"github.com/healthcare-gitops/common/config"
+	"github.com/healthcare-gitops/common/honeytoken"
+	"github.com/healthcare-gitops/common/middleware"
+	"github.com/healthcare-gitops/common/resilience"
+	"github.com/healthcare-gitops/common/tlsconfig"
+	"github.com/healthcare-gitops/common/usagestats"
 )
 
 // Config holds the service configuration
@@ -14,19 +26,139 @@ type Config struct {
 	// CVE-2025-12345 mitigation - token sanitization
 	EnableTokenSanitization bool
 	TokenMaskPattern       string
+	// v1 API retirement schedule, advertised in Deprecation and Sunset headers
+	APIv1DeprecatedAt time.Time
+	APIv1Sunset       time.Time
+	// Notification service patient messages are sent through; empty disables sending
+	NotificationServiceURL string
+	// JSON file of tenants' business hours and holidays; empty means always open
+	CalendarsFile string
+	// Admin token for the /admin/selfscan security self-scan; empty disables it
+	SelfScanToken string
+	// Bearer token validation against auth-service; an empty IntrospectURL leaves the
+	// API unauthenticated
+	Auth auth.Config
+	// Decoy transaction registry and SOC alert webhook
+	Honeytokens honeytoken.Config
+	// Opt-in anonymous usage telemetry for the platform team
+	UsageStats usagestats.Config
+	// Postgres transaction repository; an empty DatabaseURL keeps transactions in memory.
+	// DatabaseDriver names the database/sql driver the build registers.
+	DatabaseURL    string
+	DatabaseDriver string
+	// Server certificate and, for mutual TLS, the CA client certificates must chain to;
+	// no certificate serves plain HTTP
+	TLS tlsconfig.Config
+	// Active/standby failover between two replicas; an empty Role runs a single replica
+	Failover FailoverConfig
+	// Payment processor payments are authorized with; the sandbox unless configured
+	Processor ProcessorConfig
+	// Clearinghouse insurance claims are submitted to, and the interchange IDs agreed
+	// with it
+	Claims ClaimsConfig
+	// Retries of payment event webhook deliveries
+	Webhooks WebhookConfig
+	// Reporting currency and the exchange rates payments are converted to it at
+	ExchangeRates ExchangeRateConfig
+	// Where card numbers are exchanged for tokens
+	CardTokenizer CardTokenizerConfig
+	// SOXAuditLogPath is the append-only, hash-chained SOX audit log; unset keeps the
+	// audit trail in memory
+	SOXAuditLogPath string
+	// Payments waiting for approval and the roles that approve them
+	Approvals ApprovalConfig
+	// Risk scoring of payments before they are authorized
+	Risk RiskConfig
+	// Shared audit bus every payment mutation is emitted to; an empty Sink emits none
+	Audit audit.Config
+	// Kafka or NATS broker payment domain events are streamed to; an empty Broker
+	// streams none
+	Events events.StreamConfig
+	// Requests each caller may make, overall and to the payment routes
+	RateLimit middleware.RateLimitConfig
+}
+
+// paymentRateLimits hold each caller to fewer payments than other requests, which
+// bounds card testing with stolen numbers
+var paymentRateLimits = []string{
+	"POST /charge=5:20",
+	"POST /process=5:20",
+	"POST /api/v1/charge=5:20",
+	"POST /api/v1/process=5:20",
+	"POST /api/v2/payments=5:20",
 }
 
-// LoadConfig loads configuration from environment variables
+// LoadConfig loads configuration from environment variables, over the config file
+// named by CONFIG_FILE
 func LoadConfig() Config {
-	maxProcessingMillis, _ := strconv.Atoi(getEnv("MAX_PROCESSING_MILLIS", "100"))
-	enableSanitization, _ := strconv.ParseBool(getEnv("ENABLE_TOKEN_SANITIZATION", "true"))
-	
 	return Config{
-		ServiceName:         getEnv("SERVICE_NAME", "payment-gateway"),
-		Port:                getEnv("PORT", "8083"),
-		MaxProcessingMillis: maxProcessingMillis,
-		EnableTokenSanitization: enableSanitization,
-		TokenMaskPattern:       getEnv("TOKEN_MASK_PATTERN", "****"),
+		ServiceName:         config.GetEnv("SERVICE_NAME", "payment-gateway"),
+		Port:                config.GetEnv("PORT", "8083"),
+		MaxProcessingMillis: config.GetEnvInt("MAX_PROCESSING_MILLIS", 100),
+		EnableTokenSanitization: config.GetEnvBool("ENABLE_TOKEN_SANITIZATION", true),
+		TokenMaskPattern:       config.GetEnv("TOKEN_MASK_PATTERN", "****"),
+		APIv1DeprecatedAt: getEnvDate("API_V1_DEPRECATED_AT", defaultAPIv1DeprecatedAt),
+		APIv1Sunset:       getEnvDate("API_V1_SUNSET", defaultAPIv1Sunset),
+		NotificationServiceURL: config.GetEnv("NOTIFICATION_SERVICE_URL", ""),
+		CalendarsFile:          config.GetEnv("CALENDARS_FILE", ""),
+		SelfScanToken:          config.GetEnv("SELFSCAN_TOKEN", ""),
+		Auth:                   auth.ConfigFromEnv(),
+		Honeytokens:            honeytoken.ConfigFromEnv("payment-gateway"),
+		UsageStats:             usagestats.ConfigFromEnv(),
+		DatabaseURL:            config.GetEnv("DATABASE_URL", ""),
+		DatabaseDriver:         config.GetEnv("DATABASE_DRIVER", "pgx"),
+		TLS:                    tlsconfig.FromEnv(),
+		Failover:               failoverConfigFromEnv(),
+		Processor:              processorConfigFromEnv(),
+		Claims:                 claimsConfigFromEnv(),
+		Webhooks:               webhookConfigFromEnv(),
+		ExchangeRates:          exchangeRateConfigFromEnv(),
+		CardTokenizer:          cardTokenizerConfigFromEnv(),
+		SOXAuditLogPath:        config.GetEnv("SOX_AUDIT_LOG_PATH", ""),
+		Approvals:              approvalConfigFromEnv(),
+		Risk:                   riskConfigFromEnv(),
+		Audit:                  audit.ConfigFromEnv(),
+		Events:                 events.StreamConfigFromEnv(),
+		RateLimit:              middleware.RateLimitConfigFromEnv("payment-gateway", paymentRateLimits...),
+	}
+}
+
+// validateSettings checks the settings LoadConfig reads without a Validate of their
+// own, which would otherwise fall back to their defaults when malformed
+func validateSettings() error {
+	var v config.Validator
+	v.IntRange("PORT", 1, 65535)
+	v.IntRange("MAX_PROCESSING_MILLIS", 1, 60000)
+	v.Bool("ENABLE_TOKEN_SANITIZATION")
+	v.OneOf("PAYMENT_PROCESSOR", ProcessorSandbox, ProcessorStripe, ProcessorAcquirer)
+	audit.ValidateEnv(&v)
+	events.ValidateStreamEnv(&v)
+	middleware.ValidateRateLimitEnv(&v)
+	clientip.ValidateEnv(&v)
+	resilience.ValidateEnv(&v)
+	for _, key := range []string{"API_V1_DEPRECATED_AT", "API_V1_SUNSET"} {
+		if value, ok := config.Lookup(key); ok {
+			if _, err := time.Parse(time.DateOnly, value); err != nil {
+				v.Check(fmt.Errorf("%s must be a YYYY-MM-DD date, got %q", key, value))
+			}
+		}
+	}
+	return v.Err()
+}
+
+// failoverConfigFromEnv reads FAILOVER_*; the node ID defaults to the hostname, which
+// is the pod name under Kubernetes
+func failoverConfigFromEnv() FailoverConfig {
+	hostname, _ := os.Hostname()
+	interval, _ := strconv.Atoi(config.GetEnv("FAILOVER_CHECK_INTERVAL_SECONDS", "5"))
+	threshold, _ := strconv.Atoi(config.GetEnv("FAILOVER_FAILURE_THRESHOLD", "3"))
+	return FailoverConfig{
+		Role:             config.GetEnv("FAILOVER_ROLE", ""),
+		NodeID:           config.GetEnv("FAILOVER_NODE_ID", hostname),
+		PeerURL:          config.GetEnv("FAILOVER_PEER_URL", ""),
+		Token:            config.GetEnv("FAILOVER_TOKEN", ""),
+		CheckInterval:    time.Duration(interval) * time.Second,
+		FailureThreshold: threshold,
 	}
 }
 
@@ -35,11 +167,12 @@ func processingTimeout(millis int) time.Duration {
 	return time.Duration(millis) * time.Millisecond
 }
 
-// getEnv retrieves environment variable with default value
-func getEnv(key, defaultValue string) string {
-	value := os.Getenv(key)
-	if value == "" {
-		return defaultValue
+// getEnvDate retrieves a YYYY-MM-DD setting as a UTC date, falling back to
+// defaultValue when it is unset or malformed
+func getEnvDate(key, defaultValue string) time.Time {
+	date, err := time.Parse(time.DateOnly, config.GetEnv(key, defaultValue))
+	if err != nil {
+		date, _ = time.Parse(time.DateOnly, defaultValue)
 	}
-	return value
+	return date
 }
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/healthcare-gitops/common/config"
+)
+
+func TestLoadConfigFromFile(t *testing.T) {
+	for _, key := range []string{"PORT", "MAX_PROCESSING_MILLIS", "API_V1_SUNSET", "RISK_DENY_SCORE", "RISK_BLOCKED_COUNTRIES", "PAYMENT_PROCESSOR"} {
+		t.Setenv(key, "")
+	}
+	path := filepath.Join(t.TempDir(), "payment-gateway.yaml")
+	if err := os.WriteFile(path, []byte(`port: 9090
+max_processing_millis: 250
+api_v1:
+  sunset: 2027-01-31
+risk:
+  deny_score: 90
+  blocked_countries: [kp, ir]
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.LoadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = config.LoadFile("") })
+
+	// The environment wins over the file
+	t.Setenv("PORT", "9191")
+	cfg := LoadConfig()
+	if cfg.Port != "9191" || cfg.MaxProcessingMillis != 250 || !cfg.APIv1Sunset.Equal(time.Date(2027, 1, 31, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected configuration: port %s, max processing %d, sunset %s", cfg.Port, cfg.MaxProcessingMillis, cfg.APIv1Sunset)
+	}
+	if cfg.Risk.Rules.DenyScore != 90 || strings.Join(cfg.Risk.Rules.BlockedCountries, ",") != "KP,IR" {
+		t.Fatalf("unexpected risk configuration from the file: %+v", cfg.Risk.Rules)
+	}
+	if err := validateSettings(); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("PORT", "http")
+	t.Setenv("PAYMENT_PROCESSOR", "paypal")
+	err := validateSettings()
+	if err == nil || !strings.Contains(err.Error(), "PORT must be an integer") || !strings.Contains(err.Error(), "PAYMENT_PROCESSOR must be one of") {
+		t.Fatalf("expected every invalid setting reported, got %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Currency is an ISO 4217 currency the gateway accepts payments in
+type Currency struct {
+	Code string `json:"code"`
+	// Numeric is the ISO 4217 number, sent to acquirers as ISO 8583 data element 49
+	Numeric string `json:"numeric"`
+	// Exponent is the number of decimal places of the minor unit: 2 for USD cents, 0
+	// for JPY, 3 for KWD fils
+	Exponent int    `json:"exponent"`
+	Name     string `json:"name"`
+}
+
+// currencyTable lists the ISO 4217 currencies payments may be made in. Funds codes,
+// precious metals and the X-codes are left out, since no patient pays in them.
+var currencyTable = []Currency{
+	{"AED", "784", 2, "UAE Dirham"},
+	{"ARS", "032", 2, "Argentine Peso"},
+	{"AUD", "036", 2, "Australian Dollar"},
+	{"BHD", "048", 3, "Bahraini Dinar"},
+	{"BRL", "986", 2, "Brazilian Real"},
+	{"CAD", "124", 2, "Canadian Dollar"},
+	{"CHF", "756", 2, "Swiss Franc"},
+	{"CLP", "152", 0, "Chilean Peso"},
+	{"CNY", "156", 2, "Yuan Renminbi"},
+	{"COP", "170", 2, "Colombian Peso"},
+	{"CZK", "203", 2, "Czech Koruna"},
+	{"DKK", "208", 2, "Danish Krone"},
+	{"EGP", "818", 2, "Egyptian Pound"},
+	{"EUR", "978", 2, "Euro"},
+	{"GBP", "826", 2, "Pound Sterling"},
+	{"GHS", "936", 2, "Ghana Cedi"},
+	{"HKD", "344", 2, "Hong Kong Dollar"},
+	{"HUF", "348", 2, "Forint"},
+	{"IDR", "360", 2, "Rupiah"},
+	{"ILS", "376", 2, "New Israeli Sheqel"},
+	{"INR", "356", 2, "Indian Rupee"},
+	{"ISK", "352", 0, "Iceland Krona"},
+	{"JOD", "400", 3, "Jordanian Dinar"},
+	{"JPY", "392", 0, "Yen"},
+	{"KES", "404", 2, "Kenyan Shilling"},
+	{"KRW", "410", 0, "Won"},
+	{"KWD", "414", 3, "Kuwaiti Dinar"},
+	{"MXN", "484", 2, "Mexican Peso"},
+	{"MYR", "458", 2, "Malaysian Ringgit"},
+	{"NGN", "566", 2, "Naira"},
+	{"NOK", "578", 2, "Norwegian Krone"},
+	{"NZD", "554", 2, "New Zealand Dollar"},
+	{"OMR", "512", 3, "Rial Omani"},
+	{"PHP", "608", 2, "Philippine Peso"},
+	{"PKR", "586", 2, "Pakistan Rupee"},
+	{"PLN", "985", 2, "Zloty"},
+	{"QAR", "634", 2, "Qatari Rial"},
+	{"RON", "946", 2, "Romanian Leu"},
+	{"SAR", "682", 2, "Saudi Riyal"},
+	{"SEK", "752", 2, "Swedish Krona"},
+	{"SGD", "702", 2, "Singapore Dollar"},
+	{"THB", "764", 2, "Baht"},
+	{"TND", "788", 3, "Tunisian Dinar"},
+	{"TRY", "949", 2, "Turkish Lira"},
+	{"TWD", "901", 2, "New Taiwan Dollar"},
+	{"UGX", "800", 0, "Uganda Shilling"},
+	{"USD", "840", 2, "US Dollar"},
+	{"VND", "704", 0, "Dong"},
+	{"ZAR", "710", 2, "Rand"},
+}
+
+// currencies indexes currencyTable by code
+var currencies = func() map[string]Currency {
+	byCode := make(map[string]Currency, len(currencyTable))
+	for _, c := range currencyTable {
+		byCode[c.Code] = c
+	}
+	return byCode
+}()
+
+// lookupCurrency returns the currency with an ISO 4217 code, in any case
+func lookupCurrency(code string) (Currency, bool) {
+	c, ok := currencies[strings.ToUpper(code)]
+	return c, ok
+}
+
+// currencyCodes lists the accepted currency codes in order
+func currencyCodes() []string {
+	codes := make([]string, 0, len(currencies))
+	for code := range currencies {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// minorUnits converts a decimal amount, such as the v1 API's amount field, to the
+// currency's minor unit. Amounts finer than the minor unit, 12.345 USD or 1.5 JPY, are
+// refused rather than rounded.
+func (c Currency) minorUnits(amount float64) (int64, error) {
+	scaled := amount * math.Pow10(c.Exponent)
+	minor := math.Round(scaled)
+	if math.Abs(scaled-minor) > 1e-6 {
+		return 0, fmt.Errorf("%w: %s amounts have at most %d decimal places", ErrInvalidAmount, c.Code, c.Exponent)
+	}
+	if minor > math.MaxInt64/2 || minor < 0 {
+		return 0, ErrInvalidAmount
+	}
+	return int64(minor), nil
+}
+
+// format renders an amount in minor units as a decimal, e.g. 12500 USD as 125.00 and
+// 5000 JPY as 5000
+func (c Currency) format(minor int64) string {
+	if c.Exponent == 0 {
+		return strconv.FormatInt(minor, 10)
+	}
+	sign := ""
+	if minor < 0 {
+		sign, minor = "-", -minor
+	}
+	unit := int64(math.Pow10(c.Exponent))
+	return fmt.Sprintf("%s%d.%0*d", sign, minor/unit, c.Exponent, minor%unit)
+}
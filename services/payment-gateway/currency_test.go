@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCurrencyMinorUnits(t *testing.T) {
+	tests := []struct {
+		code   string
+		amount float64
+		minor  int64
+		ok     bool
+	}{
+		{"usd", 150, 15000, true},
+		{"USD", 19.99, 1999, true},
+		{"USD", 12.345, 0, false},
+		{"JPY", 5000, 5000, true},
+		{"JPY", 1.5, 0, false},
+		{"KWD", 1.234, 1234, true},
+		{"KWD", 1.2345, 0, false},
+	}
+	for _, tt := range tests {
+		c, ok := lookupCurrency(tt.code)
+		if !ok {
+			t.Fatalf("expected %s in the currency table", tt.code)
+		}
+		minor, err := c.minorUnits(tt.amount)
+		if tt.ok && (err != nil || minor != tt.minor) {
+			t.Errorf("%v %s: expected %d, got %d, %v", tt.amount, tt.code, tt.minor, minor, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("%v %s: expected ErrInvalidAmount, got %d", tt.amount, tt.code, minor)
+		}
+	}
+
+	for _, code := range []string{"", "XAU", "XXX", "US"} {
+		if _, ok := lookupCurrency(code); ok {
+			t.Errorf("expected %q to be refused", code)
+		}
+	}
+	if err := validatePayment(PaymentRequest{AmountCents: 100, Currency: "ABC", CustomerID: "c1", Method: "card"}); !errors.Is(err, ErrInvalidAmount) {
+		t.Fatalf("expected an unknown currency to be an invalid amount, got %v", err)
+	}
+
+	for want, amount := range map[string]Money{
+		"125.00": {12500, "USD"}, "-0.05": {-5, "USD"}, "5000": {5000, "JPY"}, "1.005": {1005, "BHD"},
+	} {
+		c, _ := lookupCurrency(amount.Currency)
+		if got := c.format(amount.AmountMinor); got != want {
+			t.Errorf("format(%v) = %q, want %q", amount, got, want)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/healthcare-gitops/common/health"
+	"github.com/rs/zerolog/log"
+)
+
+// Dependencies named in circuit breaker metrics
+const (
+	dependencyAuthService = "auth-service"
+	dependencyPHIService  = "phi-service"
+)
+
+// exporterHealth follows span exports to the OTLP collector, for readiness
+var exporterHealth health.Tracker
+
+// addDependencyCheck adds a check of the service behind serviceURL, through its
+// /health endpoint, to checks. Its failure degrades the gateway rather than taking it
+// out of rotation, so one service's outage does not spread to every caller.
+func addDependencyCheck(checks []health.Check, dependency, serviceURL string, client *http.Client) []health.Check {
+	endpoint, err := health.Endpoint(serviceURL)
+	if err != nil {
+		log.Warn().Err(err).Str("dependency", dependency).Msg("Cannot check dependency health")
+		return checks
+	}
+	return append(checks, health.Check{Name: dependency, Probe: health.HTTP(client, endpoint)})
+}
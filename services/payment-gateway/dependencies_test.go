@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/healthcare-gitops/common/health"
+	"github.com/healthcare-gitops/common/resilience"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// TestDependencyClient verifies calls to a failing dependency are retried, then
+// refused without being made once its circuit breaker opens, and that a recovered
+// dependency closes the breaker again
+func TestDependencyClient(t *testing.T) {
+	t.Setenv("RETRY_ATTEMPTS", "3")
+	t.Setenv("RETRY_BASE_DELAY", "1ms")
+	t.Setenv("CIRCUIT_BREAKER_FAILURES", "4")
+	t.Setenv("CIRCUIT_BREAKER_OPEN_TIMEOUT", "1s")
+
+	var calls atomic.Int32
+	var healthy atomic.Bool
+	dependency := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if !healthy.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}
+	}))
+	defer dependency.Close()
+	client := resilience.ClientFromEnv("test-dependency", nil, time.Second, RecordCircuitBreakerState)
+	gauge := circuitBreakerState.WithLabelValues("test-dependency")
+
+	resp, err := client.Get(dependency.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || calls.Load() != 3 {
+		t.Fatalf("expected 3 attempts ending in 503, got %d attempts and %d", calls.Load(), resp.StatusCode)
+	}
+	if testutil.ToFloat64(gauge) != float64(resilience.Closed) {
+		t.Fatalf("expected the breaker still closed after 3 failures, got %v", testutil.ToFloat64(gauge))
+	}
+
+	// The fourth failure opens the breaker, which then refuses calls outright
+	if resp, err := client.Get(dependency.URL); err == nil {
+		resp.Body.Close()
+	}
+	if _, err := client.Get(dependency.URL); !errors.Is(err, resilience.ErrOpen) {
+		t.Fatalf("expected the open breaker to refuse the call, got %v", err)
+	}
+	if calls.Load() != 4 || testutil.ToFloat64(gauge) != float64(resilience.Open) {
+		t.Fatalf("expected 4 attempts and an open breaker, got %d attempts and state %v", calls.Load(), testutil.ToFloat64(gauge))
+	}
+
+	// After the open timeout a trial call goes through and closes the breaker
+	healthy.Store(true)
+	time.Sleep(1100 * time.Millisecond)
+	resp, err = client.Get(dependency.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || testutil.ToFloat64(gauge) != float64(resilience.Closed) {
+		t.Fatalf("expected the trial call to close the breaker, got %d and state %v", resp.StatusCode, testutil.ToFloat64(gauge))
+	}
+}
+
+// TestReadinessReportsEachCheck verifies a failing dependency or span export degrades
+// readiness without failing it, and an unreachable database fails it
+func TestReadinessReportsEachCheck(t *testing.T) {
+	authService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			t.Errorf("expected the health endpoint to be checked, got %s", r.URL.Path)
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer authService.Close()
+
+	var exports health.Tracker
+	exports.Record(errors.New("collector unreachable"))
+	dependencies := []health.Check{{Name: "otlp_exporter", Probe: exports.Probe}}
+	dependencies = addDependencyCheck(dependencies, dependencyAuthService, authService.URL+"/introspect", nil)
+	h := PaymentHandler{Repository: newMemoryRepository(10), Dependencies: dependencies}
+
+	report := readinessReport(t, h, http.StatusOK)
+	if report.Status != health.Degraded || !report.Ready {
+		t.Fatalf("expected a ready but degraded gateway, got %s", report.Status)
+	}
+	for name, want := range map[string]health.Status{
+		"database":            health.StatusUp,
+		"otlp_exporter":       health.StatusDegraded,
+		dependencyAuthService: health.StatusDegraded,
+	} {
+		if got := report.Checks[name].Status; got != want {
+			t.Errorf("expected %s to be %s, got %s", name, want, got)
+		}
+	}
+
+	h.Repository = failingRepository{}
+	report = readinessReport(t, h, http.StatusServiceUnavailable)
+	if report.Status != health.NotReady || report.Checks["database"].Status != health.StatusDown {
+		t.Fatalf("expected an unreachable database to fail readiness, got %+v", report)
+	}
+	if report.Checks["database"].Error == "" {
+		t.Fatal("expected the database check to report its error")
+	}
+}
+
+func readinessReport(t *testing.T, h PaymentHandler, wantCode int) health.Report {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	h.Readiness(rr, httptest.NewRequest(http.MethodGet, "/readiness", nil))
+	if rr.Code != wantCode {
+		t.Fatalf("expected %d, got %d: %s", wantCode, rr.Code, rr.Body.String())
+	}
+	var report health.Report
+	if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
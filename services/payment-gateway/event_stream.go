@@ -0,0 +1,56 @@
+package main
+
+import (
+	"github.com/healthcare-gitops/common/events"
+	"github.com/rs/zerolog/log"
+)
+
+// EventPaymentCaptured is streamed to the event broker when a payment is captured.
+// Its payload is the events.PaymentCapturedV1 schema.
+const EventPaymentCaptured = events.EventPaymentCaptured
+
+// eventStream is the broker payment domain events are streamed to; main flushes it
+// on shutdown
+var eventStream *events.Stream
+
+// openEventStream opens the Kafka or NATS broker cfg selects
+func openEventStream(cfg events.StreamConfig) (*events.Stream, error) {
+	cfg.OnPublish = func(n int, err error) {
+		if err != nil {
+			log.Warn().Err(err).Int("events", n).Msg("Event broker unavailable, streamed events dropped")
+		}
+	}
+	return events.OpenStream("payment-gateway", cfg)
+}
+
+// streamEvent publishes an event to stream, logging one that is withheld
+func streamEvent(stream *events.Stream, eventType, key string, data interface{}) {
+	if err := stream.Publish(eventType, key, data); err != nil {
+		log.Error().Err(err).Str("event_type", eventType).Str("key", key).Msg("Event not streamed")
+	}
+}
+
+// paymentCaptured is the payment.captured payload for a payment userID captured
+func paymentCaptured(txn Transaction, userID string) events.PaymentCapturedV1 {
+	event := events.PaymentCapturedV1{
+		TransactionID: txn.ID,
+		AuditID:       txn.AuditID,
+		AmountMinor:   txn.Amount.AmountMinor,
+		Currency:      txn.Amount.Currency,
+		Method:        txn.Method,
+		Processor:     txn.Processor,
+		CustomerID:    txn.CustomerID,
+		PatientID:     txn.PatientID,
+		DeviceID:      txn.DeviceID,
+		HighValue:     txn.HighValue,
+		CapturedBy:    userID,
+	}
+	if !txn.ProcessedAt.IsZero() {
+		authorized := txn.ProcessedAt
+		event.AuthorizedAt = &authorized
+	}
+	if txn.CapturedAt != nil {
+		event.CapturedAt = *txn.CapturedAt
+	}
+	return event
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/healthcare-gitops/common/events"
+)
+
+func TestCaptureIsStreamedToKafka(t *testing.T) {
+	type record struct {
+		Key   string          `json:"key"`
+		Value events.Envelope `json:"value"`
+	}
+	var mu sync.Mutex
+	produced := map[string][]record{}
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/vnd.kafka.json.v2+json" {
+			http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+			return
+		}
+		var body struct {
+			Records []record `json:"records"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		produced[r.URL.Path] = append(produced[r.URL.Path], body.Records...)
+		mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{"offsets": []map[string]int{{"partition": 0, "offset": 1}}})
+	}))
+	defer proxy.Close()
+
+	stream, err := openEventStream(events.StreamConfig{
+		Broker:        events.BrokerKafka,
+		KafkaRESTURL:  proxy.URL,
+		TopicPrefix:   "staging.",
+		FlushInterval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Now().UTC()
+	h := PaymentHandler{
+		Repository:   newMemoryRepository(10),
+		Transactions: NewTransactionStore(),
+		SOX:          &SOXFinancialControlManager{},
+		Events:       stream,
+	}
+	for _, txn := range []Transaction{
+		testTransaction("TXN-1", 10000, "cust-1", "", "Surgery deposit", at),
+		testTransaction("TXN-2", 900, "cust-2", "", "Pharmacy", at),
+	} {
+		if err := h.Repository.Save(t.Context(), txn); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := chi.NewRouter()
+	r.Post("/api/v1/transactions/{transactionID}/capture", h.CaptureTransactionHandler)
+	r.Post("/api/v1/transactions/{transactionID}/void", h.VoidTransactionHandler)
+	for _, path := range []string{
+		"/api/v1/transactions/TXN-1/capture",
+		"/api/v1/transactions/TXN-1/capture", // refused: already captured
+		"/api/v1/transactions/TXN-2/void",
+	} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, path, nil))
+	}
+	if err := stream.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	records := produced["/topics/staging.payments"]
+	if len(produced) != 1 || len(records) != 1 {
+		t.Fatalf("want one record on staging.payments, got %+v", produced)
+	}
+	got := records[0]
+	if got.Key != "transaction/TXN-1" || got.Value.Type != EventPaymentCaptured || got.Value.SchemaVersion != 1 || got.Value.ID == "" {
+		t.Fatalf("unexpected record: %+v", got)
+	}
+	var captured events.PaymentCapturedV1
+	if err := json.Unmarshal(got.Value.Data, &captured); err != nil {
+		t.Fatal(err)
+	}
+	if captured.TransactionID != "TXN-1" || captured.AmountMinor != 10000 || captured.CapturedBy != "unauthenticated" ||
+		captured.CapturedAt.IsZero() || captured.AuthorizedAt == nil {
+		t.Errorf("unexpected payload: %+v", captured)
+	}
+	if stats := stream.Stats(); stats.Published != 1 || stats.Delivered != 1 || stats.Dropped != 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/healthcare-gitops/common/config"
+	"github.com/rs/zerolog/log"
+)
+
+// Exchange rate sources, recorded on each rate snapshot
+const (
+	RateSourceIdentity = "identity"
+	RateSourceStatic   = "static"
+	RateSourceFeed     = "feed"
+)
+
+const (
+	defaultReportingCurrency = "USD"
+	defaultRateFeedTTL       = time.Hour
+	rateFeedTimeout          = 10 * time.Second
+	// rateFeedRetry spaces refreshes of a feed that could not be read, so payments do
+	// not each wait on it
+	rateFeedRetry = time.Minute
+	// maxStaleRates bounds how long a feed's last rates are used while it is unreachable
+	maxStaleRates = 24 * time.Hour
+	// rateDecimals is the precision of rates derived from a feed
+	rateDecimals = 10
+)
+
+// Exchange rate errors. Payments in a currency without a rate are refused; unavailable
+// rates may be retried.
+var (
+	ErrExchangeRateNotFound    = errors.New("no exchange rate")
+	ErrExchangeRateUnavailable = errors.New("exchange rates unavailable")
+)
+
+// rateDecimal matches a positive decimal rate such as 1.0842
+var rateDecimal = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?$`)
+
+// ExchangeRate is the price of one currency in another when a payment was authorized.
+// Rate is the decimal number of Quote units one Base unit buys, kept as a string so the
+// snapshot on a transaction reproduces its reporting amount exactly.
+type ExchangeRate struct {
+	Base   string    `json:"base"`
+	Quote  string    `json:"quote"`
+	Rate   string    `json:"rate"`
+	Source string    `json:"source"`
+	AsOf   time.Time `json:"as_of"`
+}
+
+// ExchangeRateProvider quotes exchange rates. Payments are converted through
+// ExchangeRates, so another market data source is plugged in by implementing this.
+type ExchangeRateProvider interface {
+	// Name identifies the provider on the rates it quotes
+	Name() string
+	// Rate quotes base in quote. It returns ErrExchangeRateNotFound for a pair it has
+	// no rate for and ErrExchangeRateUnavailable when its rates cannot be read.
+	Rate(ctx context.Context, base, quote string) (ExchangeRate, error)
+}
+
+// ExchangeRateConfig sets the currency transactions are reported in and where rates
+// to it come from
+type ExchangeRateConfig struct {
+	// ReportingCurrency is USD unless set
+	ReportingCurrency string
+	// Rates are fixed rates to the reporting currency by currency code, e.g.
+	// "EUR": "1.0842"
+	Rates map[string]string
+	// FeedURL is a JSON rate feed used instead of Rates, refetched every FeedTTL; an
+	// hour unless set
+	FeedURL string
+	FeedTTL time.Duration
+	// HTTPClient defaults to one with a 10 second timeout
+	HTTPClient *http.Client
+}
+
+// exchangeRateConfigFromEnv reads REPORTING_CURRENCY, EXCHANGE_RATES as comma-separated
+// CODE=rate pairs, and EXCHANGE_RATE_FEED_*
+func exchangeRateConfigFromEnv() ExchangeRateConfig {
+	ttl, _ := strconv.Atoi(config.GetEnv("EXCHANGE_RATE_FEED_TTL_SECONDS", "3600"))
+	rates := make(map[string]string)
+	for _, pair := range strings.Split(config.GetEnv("EXCHANGE_RATES", ""), ",") {
+		if pair = strings.TrimSpace(pair); pair != "" {
+			// A pair without a rate is kept, so validation reports it
+			code, rate, _ := strings.Cut(pair, "=")
+			rates[strings.ToUpper(strings.TrimSpace(code))] = strings.TrimSpace(rate)
+		}
+	}
+	return ExchangeRateConfig{
+		ReportingCurrency: config.GetEnv("REPORTING_CURRENCY", defaultReportingCurrency),
+		Rates:             rates,
+		FeedURL:           config.GetEnv("EXCHANGE_RATE_FEED_URL", ""),
+		FeedTTL:           time.Duration(ttl) * time.Second,
+	}
+}
+
+// ExchangeRates converts payments to the reporting currency, so every transaction
+// carries the rate it is reported at
+type ExchangeRates struct {
+	provider  ExchangeRateProvider
+	reporting Currency
+	now       func() time.Time
+}
+
+// NewExchangeRates checks cfg and builds its provider: the feed when FeedURL is set,
+// otherwise the fixed rates
+func NewExchangeRates(cfg ExchangeRateConfig) (*ExchangeRates, error) {
+	if cfg.ReportingCurrency == "" {
+		cfg.ReportingCurrency = defaultReportingCurrency
+	}
+	reporting, ok := lookupCurrency(cfg.ReportingCurrency)
+	if !ok {
+		return nil, fmt.Errorf("REPORTING_CURRENCY %q is not a supported ISO 4217 currency", cfg.ReportingCurrency)
+	}
+	if cfg.FeedURL != "" {
+		feed, err := newFeedRateProvider(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return &ExchangeRates{provider: feed, reporting: reporting, now: time.Now}, nil
+	}
+	rates := make(map[string]string, len(cfg.Rates))
+	for code, rate := range cfg.Rates {
+		c, ok := lookupCurrency(code)
+		if !ok {
+			return nil, fmt.Errorf("EXCHANGE_RATES: %q is not a supported ISO 4217 currency", code)
+		}
+		if r, ok := new(big.Rat).SetString(rate); !ok || !rateDecimal.MatchString(rate) || r.Sign() <= 0 {
+			return nil, fmt.Errorf("EXCHANGE_RATES: the %s rate %q is not a positive decimal", c.Code, rate)
+		}
+		rates[c.Code] = rate
+	}
+	static := &staticRateProvider{quote: reporting.Code, rates: rates, asOf: time.Now().UTC()}
+	return &ExchangeRates{provider: static, reporting: reporting, now: time.Now}, nil
+}
+
+// ReportingCurrency is the code of the currency transactions are reported in
+func (e *ExchangeRates) ReportingCurrency() string {
+	return e.reporting.Code
+}
+
+// Snapshot quotes amount's currency in the reporting currency and converts amount at
+// that rate. A currency without a rate is refused as an invalid amount, since the
+// payment could not be reported. A nil ExchangeRates takes no snapshot.
+func (e *ExchangeRates) Snapshot(ctx context.Context, amount Money) (*ExchangeRate, *Money, error) {
+	if e == nil {
+		return nil, nil, nil
+	}
+	base, ok := lookupCurrency(amount.Currency)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %s is not a supported ISO 4217 currency", ErrInvalidAmount, amount.Currency)
+	}
+	rate := ExchangeRate{Base: base.Code, Quote: e.reporting.Code, Rate: "1", Source: RateSourceIdentity, AsOf: e.now().UTC()}
+	if base.Code != e.reporting.Code {
+		var err error
+		rate, err = e.provider.Rate(ctx, base.Code, e.reporting.Code)
+		RecordExchangeRateLookup(e.provider.Name(), err)
+		switch {
+		case errors.Is(err, ErrExchangeRateNotFound):
+			return nil, nil, fmt.Errorf("%w: %s payments are not accepted, as there is no exchange rate to %s", ErrInvalidAmount, base.Code, e.reporting.Code)
+		case errors.Is(err, ErrExchangeRateUnavailable):
+			return nil, nil, err
+		case err != nil:
+			return nil, nil, fmt.Errorf("%w: %v", ErrExchangeRateUnavailable, err)
+		}
+	}
+	converted, err := convertAmount(amount.AmountMinor, base, e.reporting, rate.Rate)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &rate, &Money{AmountMinor: converted, Currency: e.reporting.Code}, nil
+}
+
+// convertAmount converts minor units of from into minor units of to at rate, rounding
+// half away from zero. It works in exact rationals so a snapshot always reproduces the
+// same amount.
+func convertAmount(minor int64, from, to Currency, rate string) (int64, error) {
+	r, ok := new(big.Rat).SetString(rate)
+	if !ok || r.Sign() <= 0 {
+		return 0, fmt.Errorf("%w: invalid %s/%s rate %q", ErrExchangeRateUnavailable, from.Code, to.Code, rate)
+	}
+	value := new(big.Rat).Mul(new(big.Rat).SetInt64(minor), r)
+	shift := to.Exponent - from.Exponent
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(shift))), nil))
+	if shift > 0 {
+		value.Mul(value, scale)
+	} else if shift < 0 {
+		value.Quo(value, scale)
+	}
+
+	quotient, remainder := new(big.Int).QuoRem(value.Num(), value.Denom(), new(big.Int))
+	if new(big.Int).Mul(new(big.Int).Abs(remainder), big.NewInt(2)).Cmp(value.Denom()) >= 0 {
+		quotient.Add(quotient, big.NewInt(int64(value.Sign())))
+	}
+	if !quotient.IsInt64() {
+		return 0, fmt.Errorf("%w: the amount in %s is too large", ErrInvalidAmount, to.Code)
+	}
+	return quotient.Int64(), nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// formatRate renders a derived rate as a decimal without trailing zeros
+func formatRate(r *big.Rat) string {
+	s := strings.TrimRight(r.FloatString(rateDecimals), "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// CurrencyRate is an accepted currency and its current rate to the reporting currency
+type CurrencyRate struct {
+	Currency
+	// ExchangeRate is unset when the provider has no rate, and payments in the
+	// currency are refused
+	ExchangeRate *ExchangeRate `json:"exchange_rate,omitempty"`
+}
+
+// CurrenciesHandler handles GET /api/v1/currencies: the ISO 4217 currency table with
+// each currency's current rate to the reporting currency
+func (e *ExchangeRates) CurrenciesHandler(w http.ResponseWriter, r *http.Request) {
+	list := make([]CurrencyRate, 0, len(currencyTable))
+	for _, code := range currencyCodes() {
+		c := currencies[code]
+		entry := CurrencyRate{Currency: c}
+		if code == e.reporting.Code {
+			entry.ExchangeRate = &ExchangeRate{Base: code, Quote: code, Rate: "1", Source: RateSourceIdentity, AsOf: e.now().UTC()}
+		} else if rate, err := e.provider.Rate(r.Context(), code, e.reporting.Code); err == nil {
+			entry.ExchangeRate = &rate
+		}
+		list = append(list, entry)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"reporting_currency": e.reporting.Code,
+		"currencies":         list,
+		"count":              len(list),
+	})
+}
+
+// staticRateProvider quotes fixed rates to the reporting currency, for installs whose
+// finance team books foreign payments at a set rate, and for development
+type staticRateProvider struct {
+	quote string
+	rates map[string]string
+	asOf  time.Time
+}
+
+func (s *staticRateProvider) Name() string { return RateSourceStatic }
+
+func (s *staticRateProvider) Rate(ctx context.Context, base, quote string) (ExchangeRate, error) {
+	rate, ok := s.rates[base]
+	if !ok || quote != s.quote {
+		return ExchangeRate{}, fmt.Errorf("%w from %s to %s", ErrExchangeRateNotFound, base, quote)
+	}
+	return ExchangeRate{Base: base, Quote: quote, Rate: rate, Source: RateSourceStatic, AsOf: s.asOf}, nil
+}
+
+// rateFeed is the Open Exchange Rates feed format most rate services also offer: how
+// many units of each currency one unit of the base buys, as of a Unix time
+type rateFeed struct {
+	Base      string                 `json:"base"`
+	Timestamp int64                  `json:"timestamp"`
+	Rates     map[string]json.Number `json:"rates"`
+}
+
+// feedRateProvider reads rates from a JSON feed and caches them for a TTL. Rates for
+// any pair are derived through the feed's base. While the feed cannot be read its last
+// rates are used for up to a day; after that foreign payments are refused until it is
+// back.
+type feedRateProvider struct {
+	url    string
+	ttl    time.Duration
+	client *http.Client
+	now    func() time.Time
+
+	mu      sync.Mutex
+	fetched time.Time
+	retryAt time.Time
+	base    string
+	asOf    time.Time
+	rates   map[string]*big.Rat
+}
+
+func newFeedRateProvider(cfg ExchangeRateConfig) (*feedRateProvider, error) {
+	u, err := url.Parse(cfg.FeedURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("EXCHANGE_RATE_FEED_URL %q is not an http(s) URL", cfg.FeedURL)
+	}
+	if cfg.FeedTTL < 0 {
+		return nil, errors.New("EXCHANGE_RATE_FEED_TTL_SECONDS must not be negative")
+	}
+	ttl := cfg.FeedTTL
+	if ttl == 0 {
+		ttl = defaultRateFeedTTL
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: rateFeedTimeout}
+	}
+	return &feedRateProvider{url: cfg.FeedURL, ttl: ttl, client: client, now: time.Now}, nil
+}
+
+func (f *feedRateProvider) Name() string { return RateSourceFeed }
+
+func (f *feedRateProvider) Rate(ctx context.Context, base, quote string) (ExchangeRate, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := f.now()
+	if (f.rates == nil || now.Sub(f.fetched) >= f.ttl) && !now.Before(f.retryAt) {
+		if err := f.refreshLocked(ctx, now); err != nil {
+			f.retryAt = now.Add(rateFeedRetry)
+			log.Warn().Err(err).Str("url", f.url).Time("fetched_at", f.fetched).Msg("Exchange rate feed refresh failed")
+		}
+	}
+	if f.rates == nil || now.Sub(f.fetched) >= maxStaleRates {
+		return ExchangeRate{}, fmt.Errorf("%w: the rate feed has not been read since %s", ErrExchangeRateUnavailable, f.fetched.Format(time.RFC3339))
+	}
+	from, to := f.rateLocked(base), f.rateLocked(quote)
+	if from == nil || to == nil {
+		return ExchangeRate{}, fmt.Errorf("%w from %s to %s", ErrExchangeRateNotFound, base, quote)
+	}
+	// Both are priced per unit of the feed's base
+	rate := formatRate(new(big.Rat).Quo(to, from))
+	if rate == "0" {
+		return ExchangeRate{}, fmt.Errorf("%w from %s to %s: below %d decimal places", ErrExchangeRateNotFound, base, quote, rateDecimals)
+	}
+	return ExchangeRate{Base: base, Quote: quote, Rate: rate, Source: RateSourceFeed, AsOf: f.asOf}, nil
+}
+
+// rateLocked returns a currency's units per unit of the feed's base, or nil
+func (f *feedRateProvider) rateLocked(code string) *big.Rat {
+	if code == f.base {
+		return big.NewRat(1, 1)
+	}
+	return f.rates[code]
+}
+
+// refreshLocked fetches the feed, keeping the rates of the currencies in the table
+func (f *feedRateProvider) refreshLocked(ctx context.Context, now time.Time) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrExchangeRateUnavailable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: the rate feed returned %d", ErrExchangeRateUnavailable, resp.StatusCode)
+	}
+	var feed rateFeed
+	if err := json.NewDecoder(resp.Body).Decode(&feed); err != nil {
+		return fmt.Errorf("%w: the rate feed is not valid JSON: %v", ErrExchangeRateUnavailable, err)
+	}
+	base, ok := lookupCurrency(feed.Base)
+	if !ok {
+		return fmt.Errorf("%w: the rate feed's base %q is not a supported currency", ErrExchangeRateUnavailable, feed.Base)
+	}
+	rates := make(map[string]*big.Rat, len(feed.Rates))
+	for code, value := range feed.Rates {
+		c, ok := lookupCurrency(code)
+		r, valid := new(big.Rat).SetString(value.String())
+		if ok && valid && r.Sign() > 0 {
+			rates[c.Code] = r
+		}
+	}
+	f.base, f.rates, f.fetched = base.Code, rates, now
+	f.asOf = now.UTC()
+	if feed.Timestamp > 0 {
+		f.asOf = time.Unix(feed.Timestamp, 0).UTC()
+	}
+	return nil
+}
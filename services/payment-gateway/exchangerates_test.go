@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestConvertAmount(t *testing.T) {
+	tests := []struct {
+		minor    int64
+		from, to string
+		rate     string
+		want     int64
+	}{
+		{10000, "EUR", "USD", "1.0842", 10842},
+		{50, "JPY", "USD", "0.0067", 34}, // 33.5 cents rounds away from zero
+		{1001, "USD", "JPY", "149.5", 1496},
+		{1234, "KWD", "USD", "3.2533", 401},
+		{-50, "JPY", "USD", "0.0067", -34},
+	}
+	for _, tt := range tests {
+		got, err := convertAmount(tt.minor, currencies[tt.from], currencies[tt.to], tt.rate)
+		if err != nil || got != tt.want {
+			t.Errorf("%d %s at %s: expected %d %s, got %d, %v", tt.minor, tt.from, tt.rate, tt.want, tt.to, got, err)
+		}
+	}
+	if _, err := convertAmount(1<<62, currencies["USD"], currencies["JPY"], "1500"); !errors.Is(err, ErrInvalidAmount) {
+		t.Fatalf("expected an overflowing conversion to be refused, got %v", err)
+	}
+}
+
+func TestExchangeRates(t *testing.T) {
+	rates, err := NewExchangeRates(ExchangeRateConfig{Rates: map[string]string{"EUR": "1.0842", "jpy": "0.0067"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rates.ReportingCurrency() != "USD" {
+		t.Fatalf("expected USD to be reported in by default, got %s", rates.ReportingCurrency())
+	}
+	rate, amount, err := rates.Snapshot(t.Context(), Money{AmountMinor: 2500, Currency: "usd"})
+	if err != nil || rate.Source != RateSourceIdentity || rate.Rate != "1" || *amount != (Money{2500, "USD"}) {
+		t.Fatalf("expected the identity rate, got %+v %+v %v", rate, amount, err)
+	}
+	rate, amount, err = rates.Snapshot(t.Context(), Money{AmountMinor: 10000, Currency: "EUR"})
+	if err != nil || rate.Source != RateSourceStatic || rate.Base != "EUR" || rate.Quote != "USD" || *amount != (Money{10842, "USD"}) {
+		t.Fatalf("expected the static EUR rate, got %+v %+v %v", rate, amount, err)
+	}
+	if _, _, err := rates.Snapshot(t.Context(), Money{AmountMinor: 100, Currency: "GBP"}); !errors.Is(err, ErrInvalidAmount) {
+		t.Fatalf("expected a currency without a rate to be refused, got %v", err)
+	}
+	if rate, amount, err := (*ExchangeRates)(nil).Snapshot(t.Context(), Money{100, "EUR"}); rate != nil || amount != nil || err != nil {
+		t.Fatal("expected nil rates to take no snapshot")
+	}
+
+	for name, cfg := range map[string]ExchangeRateConfig{
+		"reporting currency": {ReportingCurrency: "XAU"},
+		"unknown currency":   {Rates: map[string]string{"ZZZ": "1"}},
+		"negative rate":      {Rates: map[string]string{"EUR": "-1"}},
+		"fraction":           {Rates: map[string]string{"EUR": "1/3"}},
+		"missing rate":       {Rates: map[string]string{"EUR": ""}},
+		"feed URL":           {FeedURL: "ftp://rates.example.org"},
+		"feed TTL":           {FeedURL: "https://rates.example.org", FeedTTL: -time.Second},
+	} {
+		if _, err := NewExchangeRates(cfg); err == nil {
+			t.Errorf("%s: expected the configuration to be refused", name)
+		}
+	}
+}
+
+func TestFeedRateProvider(t *testing.T) {
+	var fetches atomic.Int32
+	var down atomic.Bool
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		if down.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte(`{"base": "USD", "timestamp": 1772712000, "rates": {"EUR": 0.92, "GBP": 0.79, "JPY": 149.5, "BTC": 0.00001, "USD": 1}}`))
+	}))
+	defer feed.Close()
+
+	now := time.Date(2026, 3, 5, 12, 0, 0, 0, time.UTC)
+	rates, err := NewExchangeRates(ExchangeRateConfig{ReportingCurrency: "EUR", FeedURL: feed.URL, FeedTTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := rates.provider.(*feedRateProvider)
+	provider.now = func() time.Time { return now }
+
+	rate, amount, err := rates.Snapshot(t.Context(), Money{AmountMinor: 10000, Currency: "GBP"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 0.92 / 0.79, through the feed's USD base
+	if rate.Rate != "1.164556962" || rate.Source != RateSourceFeed || !rate.AsOf.Equal(time.Unix(1772712000, 0)) || *amount != (Money{11646, "EUR"}) {
+		t.Fatalf("unexpected cross rate: %+v %+v", rate, amount)
+	}
+	if rate, _, err := rates.Snapshot(t.Context(), Money{AmountMinor: 100, Currency: "USD"}); err != nil || rate.Rate != "0.92" {
+		t.Fatalf("unexpected USD rate: %+v %v", rate, err)
+	}
+	if rate, _, err := rates.Snapshot(t.Context(), Money{AmountMinor: 100, Currency: "JPY"}); err != nil || rate.Rate != "0.0061538462" {
+		t.Fatalf("unexpected JPY rate: %+v %v", rate, err)
+	}
+	if fetches.Load() != 1 {
+		t.Fatalf("expected the feed cached, got %d fetches", fetches.Load())
+	}
+	if _, err := provider.Rate(t.Context(), "NGN", "EUR"); !errors.Is(err, ErrExchangeRateNotFound) {
+		t.Fatalf("expected a currency missing from the feed to have no rate, got %v", err)
+	}
+
+	// The feed goes down: the last rates are used for a day, refreshing once a minute
+	down.Store(true)
+	now = now.Add(2 * time.Hour)
+	for i := 0; i < 3; i++ {
+		if _, err := provider.Rate(t.Context(), "GBP", "EUR"); err != nil {
+			t.Fatalf("expected the last rates while the feed is down, got %v", err)
+		}
+	}
+	if fetches.Load() != 2 {
+		t.Fatalf("expected one refresh attempt, got %d", fetches.Load()-1)
+	}
+	now = now.Add(maxStaleRates)
+	if _, _, err := rates.Snapshot(t.Context(), Money{AmountMinor: 100, Currency: "GBP"}); !errors.Is(err, ErrExchangeRateUnavailable) {
+		t.Fatalf("expected stale rates to be refused, got %v", err)
+	}
+
+	down.Store(false)
+	now = now.Add(rateFeedRetry)
+	if _, err := provider.Rate(t.Context(), "GBP", "EUR"); err != nil {
+		t.Fatalf("expected the feed to recover, got %v", err)
+	}
+}
+
+func TestPaymentExchangeRateSnapshot(t *testing.T) {
+	rates, err := NewExchangeRates(ExchangeRateConfig{Rates: map[string]string{"EUR": "1.0842"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	repository := newMemoryRepository(10)
+	transactions := NewTransactionStore()
+	h := PaymentHandler{MaxLatency: time.Millisecond, Repository: repository, Transactions: transactions, Rates: rates}
+	r := chi.NewRouter()
+	r.Post("/charge", h.Charge)
+	r.Post("/api/v2/payments", h.CreatePayment)
+	r.Get("/api/v1/currencies", rates.CurrenciesHandler)
+	r.Get("/api/v1/transactions/search/export", transactions.ExportHandler)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest(method, path, bytes.NewBufferString(body)))
+		return rr
+	}
+
+	rr := do("POST", "/api/v2/payments", `{"amount": {"amount_minor": 20000, "currency": "EUR"}, "customer_id": "cust-1", "method": "card"}`)
+	var resp PaymentResponseV2
+	if rr.Code != http.StatusCreated || json.NewDecoder(rr.Body).Decode(&resp) != nil {
+		t.Fatalf("EUR payment expected 201, got %d: %s", rr.Code, rr.Body)
+	}
+	txn, err := repository.Get(t.Context(), resp.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txn.ExchangeRate == nil || txn.ExchangeRate.Rate != "1.0842" || txn.ReportingAmount == nil || *txn.ReportingAmount != (Money{21684, "USD"}) {
+		t.Fatalf("expected the rate snapshot recorded, got %+v %+v", txn.ExchangeRate, txn.ReportingAmount)
+	}
+
+	rr = do("POST", "/api/v2/payments", `{"amount": {"amount_minor": 20000, "currency": "GBP"}, "customer_id": "cust-1", "method": "card"}`)
+	var envelope ErrorEnvelope
+	if rr.Code != http.StatusUnprocessableEntity || json.NewDecoder(rr.Body).Decode(&envelope) != nil || envelope.Error.Code != ErrorCodeInvalidAmount || !strings.Contains(envelope.Error.Message, "GBP") {
+		t.Fatalf("GBP payment expected 422 invalid_amount, got %d %+v", rr.Code, envelope)
+	}
+	if rr := do("POST", "/charge", `{"amount": 1.5, "currency": "JPY", "customer_id": "cust-1", "method": "card"}`); rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "decimal places") {
+		t.Fatalf("fractional yen expected 400, got %d: %s", rr.Code, rr.Body)
+	}
+	if rr := do("POST", "/charge", `{"amount": 12.5, "currency": "usd", "customer_id": "cust-1", "method": "card"}`); rr.Code != http.StatusOK {
+		t.Fatalf("v1 amount expected 200, got %d: %s", rr.Code, rr.Body)
+	}
+	if n, _, _ := repository.List(t.Context(), TransactionFilter{}); len(n) != 2 {
+		t.Fatalf("expected only the accepted payments recorded, got %d", len(n))
+	}
+
+	rr = do("GET", "/api/v1/transactions/search/export?currency=EUR", "")
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], "reporting_amount_minor,reporting_currency,exchange_rate,exchange_rate_source,exchange_rate_as_of") || !strings.Contains(lines[1], ",21684,USD,1.0842,static,") {
+		t.Fatalf("expected the export to carry the snapshot, got:\n%s", rr.Body)
+	}
+
+	var list struct {
+		ReportingCurrency string         `json:"reporting_currency"`
+		Currencies        []CurrencyRate `json:"currencies"`
+		Count             int            `json:"count"`
+	}
+	if err := json.NewDecoder(do("GET", "/api/v1/currencies", "").Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if list.ReportingCurrency != "USD" || list.Count != len(currencyTable) {
+		t.Fatalf("unexpected currency list: %+v", list)
+	}
+	withRates := map[string]string{}
+	for _, c := range list.Currencies {
+		if c.ExchangeRate != nil {
+			withRates[c.Code] = c.ExchangeRate.Rate
+		}
+	}
+	if len(withRates) != 2 || withRates["USD"] != "1" || withRates["EUR"] != "1.0842" {
+		t.Fatalf("expected rates for USD and EUR only, got %v", withRates)
+	}
+}
@@ -0,0 +1,542 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Failover roles. Only the active replica authorizes payments; the standby copies its
+// transactions and takes over when the active stops answering.
+const (
+	RoleActive  = "active"
+	RoleStandby = "standby"
+)
+
+// Failover defaults
+const (
+	defaultFailoverCheckInterval = 5 * time.Second
+	defaultFailoverThreshold     = 3
+	// maxFailoverLog bounds the changes an active keeps for its standby to copy
+	maxFailoverLog = 100000
+	// failoverChangesPage bounds the changes returned by one replication call
+	failoverChangesPage = 1000
+)
+
+// FailoverTokenHeader carries the shared secret the replicas present to each other
+const FailoverTokenHeader = "X-Failover-Token"
+
+var (
+	// ErrNotActive is returned when a standby is asked to record a transaction
+	ErrNotActive = errors.New("replica is not the active payment gateway")
+	// errFenced is returned when a replica writes or claims with a superseded epoch
+	errFenced = errors.New("fencing epoch superseded")
+)
+
+// FailoverConfig configures active/standby failover. An empty Role disables it.
+type FailoverConfig struct {
+	// Role is the role the replica starts in, RoleActive or RoleStandby
+	Role   string
+	NodeID string
+	// PeerURL is the other replica's base URL
+	PeerURL string
+	// Token authenticates the replicas to each other on /internal/failover
+	Token string
+	// CheckInterval is how often the peer is checked; FailureThreshold consecutive
+	// failed checks of the active promote the standby
+	CheckInterval    time.Duration
+	FailureThreshold int
+	// HTTPClient calls the peer; nil uses a plain client timing out after CheckInterval
+	HTTPClient *http.Client
+}
+
+// Fence is a fencing epoch shared by the replicas. A repository both replicas write to
+// implements it, so the database itself refuses writes from a demoted active.
+type Fence interface {
+	// CurrentEpoch returns the latest epoch claimed and the node holding it
+	CurrentEpoch(ctx context.Context) (uint64, string, error)
+	// ClaimEpoch makes node the holder of epoch, or fails with errFenced when a later
+	// epoch has been claimed
+	ClaimEpoch(ctx context.Context, node string, epoch uint64) error
+	// SaveFenced saves txn only while node holds epoch, failing with errFenced otherwise
+	SaveFenced(ctx context.Context, txn Transaction, node string, epoch uint64) error
+}
+
+// PeerStatus is what a replica tells its peer about itself
+type PeerStatus struct {
+	NodeID string `json:"node_id"`
+	Role   string `json:"role"`
+	Epoch  uint64 `json:"epoch"`
+	// ChangeSeq is the last change an active logged for its standby
+	ChangeSeq uint64 `json:"change_seq"`
+}
+
+// FailoverStatus is the replica's failover state, for operators
+type FailoverStatus struct {
+	NodeID string    `json:"node_id"`
+	Role   string    `json:"role"`
+	Epoch  uint64    `json:"epoch"`
+	Since  time.Time `json:"since"`
+	// Reason is why the replica took its current role
+	Reason              string      `json:"reason"`
+	PeerURL             string      `json:"peer_url"`
+	Peer                *PeerStatus `json:"peer,omitempty"`
+	PeerCheckedAt       *time.Time  `json:"peer_checked_at,omitempty"`
+	PeerError           string      `json:"peer_error,omitempty"`
+	ConsecutiveFailures int         `json:"consecutive_failures"`
+	FailureThreshold    int         `json:"failure_threshold"`
+	// Replication is "database" when the replicas share a repository and "peer" when the
+	// standby copies the active's transactions
+	Replication string `json:"replication"`
+	ChangeSeq   uint64 `json:"change_seq"`
+	AppliedSeq  uint64 `json:"applied_seq"`
+}
+
+// FailoverChanges is one page of an active's transactions for its standby
+type FailoverChanges struct {
+	Epoch uint64 `json:"epoch"`
+	// Next is the sequence number to ask for changes after next time
+	Next uint64 `json:"next"`
+	// Gap is set when changes the standby had not copied were dropped from the log
+	Gap          bool          `json:"gap"`
+	Transactions []Transaction `json:"transactions"`
+}
+
+// Coordinator runs one side of an active/standby pair. The epoch is the fencing token:
+// every promotion takes a higher one, and a replica that sees a higher epoch than its
+// own steps down, so two replicas never both stay active.
+type Coordinator struct {
+	cfg    FailoverConfig
+	repo   TransactionRepository
+	fence  Fence
+	index  *TransactionStore
+	client *http.Client
+
+	mu        sync.RWMutex
+	role      string
+	epoch     uint64
+	since     time.Time
+	reason    string
+	peer      *PeerStatus
+	checkedAt time.Time
+	peerErr   error
+	failures  int
+
+	// log holds the active's writes since it took over, numbered from logStart+1
+	log      []Transaction
+	logStart uint64
+	// applied is the last change a standby copied
+	applied uint64
+}
+
+// newCoordinator reconciles the configured role with the peer and the shared fence,
+// so a restarted former active comes back as the standby
+func newCoordinator(ctx context.Context, cfg FailoverConfig, repo TransactionRepository, index *TransactionStore) (*Coordinator, error) {
+	if cfg.Role != RoleActive && cfg.Role != RoleStandby {
+		return nil, fmt.Errorf("FAILOVER_ROLE must be %q or %q", RoleActive, RoleStandby)
+	}
+	if cfg.PeerURL == "" || cfg.Token == "" || cfg.NodeID == "" {
+		return nil, errors.New("failover needs FAILOVER_PEER_URL, FAILOVER_TOKEN and a node ID")
+	}
+	if cfg.CheckInterval <= 0 {
+		cfg.CheckInterval = defaultFailoverCheckInterval
+	}
+	if cfg.FailureThreshold < 1 {
+		cfg.FailureThreshold = defaultFailoverThreshold
+	}
+	c := &Coordinator{
+		cfg:    cfg,
+		repo:   repo,
+		index:  index,
+		client: cfg.HTTPClient,
+		role:   RoleStandby,
+		since:  time.Now().UTC(),
+		reason: "configured",
+	}
+	if c.client == nil {
+		c.client = &http.Client{Timeout: cfg.CheckInterval}
+	}
+	c.fence, _ = repo.(Fence)
+
+	epoch, holder := uint64(0), ""
+	if c.fence != nil {
+		var err error
+		if epoch, holder, err = c.fence.CurrentEpoch(ctx); err != nil {
+			return nil, fmt.Errorf("read fencing epoch: %w", err)
+		}
+	}
+	peer, peerErr := c.fetchPeer(ctx)
+	if peerErr == nil && peer.Epoch > epoch {
+		epoch = peer.Epoch
+	}
+	c.epoch = epoch
+	switch {
+	case cfg.Role == RoleStandby:
+	case peerErr == nil && peer.Role == RoleActive:
+		c.reason = "peer already active"
+	case holder != "" && holder != cfg.NodeID && peerErr != nil:
+		// The peer took over and may still be running; wait for it to answer
+		c.reason = "fence held by " + holder
+	default:
+		if err := c.takeOver(ctx, "configured"); err != nil {
+			return nil, err
+		}
+	}
+	RecordFailoverRole(c.role, c.epoch)
+	return c, nil
+}
+
+// Active reports whether the replica may authorize payments. Without failover every
+// replica is active.
+func (c *Coordinator) Active() bool {
+	if c == nil {
+		return true
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.role == RoleActive
+}
+
+// takeOver claims the next epoch and becomes active; the caller holds mu or owns c
+// exclusively
+func (c *Coordinator) takeOver(ctx context.Context, reason string) error {
+	epoch := c.epoch + 1
+	if c.peer != nil && c.peer.Epoch >= epoch {
+		epoch = c.peer.Epoch + 1
+	}
+	if c.fence != nil {
+		if err := c.fence.ClaimEpoch(ctx, c.cfg.NodeID, epoch); err != nil {
+			return fmt.Errorf("claim fencing epoch %d: %w", epoch, err)
+		}
+	}
+	c.role, c.epoch, c.since, c.reason = RoleActive, epoch, time.Now().UTC(), reason
+	c.log, c.logStart, c.failures = nil, 0, 0
+	RecordFailoverRole(c.role, c.epoch)
+	RecordFailoverTransition(RoleActive, reason)
+	log.Warn().Str("node_id", c.cfg.NodeID).Uint64("epoch", epoch).Str("reason", reason).Msg("Promoted to active payment gateway")
+	return nil
+}
+
+// stepDown makes the replica the standby; the caller holds mu
+func (c *Coordinator) stepDown(epoch uint64, reason string) {
+	if epoch > c.epoch {
+		c.epoch = epoch
+	}
+	c.role, c.since, c.reason = RoleStandby, time.Now().UTC(), reason
+	c.log, c.logStart, c.applied, c.failures = nil, 0, 0, 0
+	RecordFailoverRole(c.role, c.epoch)
+	RecordFailoverTransition(RoleStandby, reason)
+	log.Warn().Str("node_id", c.cfg.NodeID).Uint64("epoch", c.epoch).Str("reason", reason).Msg("Stepped down to standby")
+}
+
+// Run checks the peer every interval until ctx is done
+func (c *Coordinator) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.cfg.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.check(ctx)
+		}
+	}
+}
+
+// check looks at the peer once. The active steps down if the peer holds a later epoch;
+// the standby copies the active's changes, or takes over once the active has failed
+// FailureThreshold checks in a row.
+func (c *Coordinator) check(ctx context.Context) {
+	peer, err := c.fetchPeer(ctx)
+	result := "healthy"
+	switch {
+	case err != nil:
+		result = "unreachable"
+	case peer.Role != RoleActive:
+		result = "standby"
+	}
+	RecordFailoverPeerCheck(result)
+
+	c.mu.Lock()
+	c.checkedAt, c.peerErr = time.Now().UTC(), err
+	if err == nil {
+		c.peer = &peer
+	}
+	if c.role == RoleActive {
+		c.checkActive(ctx, peer, err)
+		c.mu.Unlock()
+		return
+	}
+	if result == "healthy" {
+		c.failures = 0
+		if peer.Epoch > c.epoch {
+			c.epoch = peer.Epoch
+			RecordFailoverRole(c.role, c.epoch)
+		}
+		c.mu.Unlock()
+		if c.fence == nil {
+			c.replicate(ctx)
+		}
+		return
+	}
+	c.failures++
+	if c.failures >= c.cfg.FailureThreshold {
+		reason := "peer_unreachable"
+		if err == nil {
+			reason = "peer_not_active"
+		}
+		if err := c.takeOver(ctx, reason); err != nil {
+			log.Error().Err(err).Msg("Failover promotion refused")
+		}
+	}
+	c.mu.Unlock()
+}
+
+// checkActive steps the active down when another replica holds a later epoch, or the
+// same epoch with a higher node ID; the caller holds mu
+func (c *Coordinator) checkActive(ctx context.Context, peer PeerStatus, peerErr error) {
+	if c.fence != nil {
+		if epoch, holder, err := c.fence.CurrentEpoch(ctx); err == nil && (epoch > c.epoch || holder != c.cfg.NodeID) {
+			c.stepDown(epoch, "fenced")
+			return
+		}
+	}
+	if peerErr != nil || peer.Role != RoleActive {
+		return
+	}
+	if peer.Epoch > c.epoch || (peer.Epoch == c.epoch && peer.NodeID > c.cfg.NodeID) {
+		c.stepDown(peer.Epoch, "peer_newer_epoch")
+	}
+}
+
+func (c *Coordinator) fetchPeer(ctx context.Context) (PeerStatus, error) {
+	var status PeerStatus
+	err := c.getPeer(ctx, "/internal/failover/status", &status)
+	return status, err
+}
+
+func (c *Coordinator) getPeer(ctx context.Context, path string, out interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.CheckInterval)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.cfg.PeerURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(FailoverTokenHeader, c.cfg.Token)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("peer returned %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// replicate copies the active's changes into this standby's repository and index
+func (c *Coordinator) replicate(ctx context.Context) {
+	for {
+		c.mu.RLock()
+		after, role := c.applied, c.role
+		c.mu.RUnlock()
+		if role != RoleStandby {
+			return
+		}
+		var changes FailoverChanges
+		if err := c.getPeer(ctx, "/internal/failover/changes?after="+strconv.FormatUint(after, 10), &changes); err != nil {
+			log.Warn().Err(err).Msg("Failed to copy transactions from the active")
+			return
+		}
+		if changes.Gap {
+			log.Warn().Uint64("after", after).Msg("Active dropped changes this standby had not copied")
+		}
+		for _, txn := range changes.Transactions {
+			if err := c.repo.Save(ctx, txn); err != nil {
+				log.Error().Err(err).Str("transaction_id", txn.ID).Msg("Failed to save a copied transaction")
+				return
+			}
+			c.index.Update(txn)
+		}
+		RecordFailoverReplicated(len(changes.Transactions))
+
+		c.mu.Lock()
+		if c.role == RoleStandby && c.applied == after {
+			c.applied = changes.Next
+		}
+		c.mu.Unlock()
+		if len(changes.Transactions) < failoverChangesPage {
+			return
+		}
+	}
+}
+
+// Save records a transaction on the active, fenced by its epoch, and logs it for the
+// standby. It fails with ErrNotActive on the standby.
+func (c *Coordinator) Save(ctx context.Context, txn Transaction) error {
+	c.mu.RLock()
+	role, epoch := c.role, c.epoch
+	c.mu.RUnlock()
+	if role != RoleActive {
+		return ErrNotActive
+	}
+	var err error
+	if c.fence != nil {
+		err = c.fence.SaveFenced(ctx, txn, c.cfg.NodeID, epoch)
+	} else {
+		err = c.repo.Save(ctx, txn)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if errors.Is(err, errFenced) {
+		if c.role == RoleActive && c.epoch == epoch {
+			c.stepDown(epoch, "fenced")
+		}
+		return ErrNotActive
+	}
+	if err != nil {
+		return err
+	}
+	if c.role == RoleActive && c.epoch == epoch && c.fence == nil {
+		c.log = append(c.log, txn)
+		if len(c.log) > maxFailoverLog {
+			drop := len(c.log) - maxFailoverLog
+			c.log = c.log[drop:]
+			c.logStart += uint64(drop)
+		}
+	}
+	return nil
+}
+
+// Get, List and Ping read the underlying repository on either replica
+func (c *Coordinator) Get(ctx context.Context, id string) (Transaction, error) {
+	return c.repo.Get(ctx, id)
+}
+
+func (c *Coordinator) List(ctx context.Context, filter TransactionFilter) ([]Transaction, int, error) {
+	return c.repo.List(ctx, filter)
+}
+
+func (c *Coordinator) Ping(ctx context.Context) error {
+	return c.repo.Ping(ctx)
+}
+
+// Status returns the replica's failover state
+func (c *Coordinator) Status() FailoverStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	status := FailoverStatus{
+		NodeID:              c.cfg.NodeID,
+		Role:                c.role,
+		Epoch:               c.epoch,
+		Since:               c.since,
+		Reason:              c.reason,
+		PeerURL:             c.cfg.PeerURL,
+		Peer:                c.peer,
+		ConsecutiveFailures: c.failures,
+		FailureThreshold:    c.cfg.FailureThreshold,
+		Replication:         "peer",
+		ChangeSeq:           c.logStart + uint64(len(c.log)),
+		AppliedSeq:          c.applied,
+	}
+	if c.fence != nil {
+		status.Replication = "database"
+	}
+	if !c.checkedAt.IsZero() {
+		checked := c.checkedAt
+		status.PeerCheckedAt = &checked
+	}
+	if c.peerErr != nil {
+		status.PeerError = c.peerErr.Error()
+	}
+	return status
+}
+
+// StatusHandler handles GET /admin/failover
+func (c *Coordinator) StatusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	_ = json.NewEncoder(w).Encode(c.Status())
+}
+
+// RequireActive refuses writes on the standby with 503, so clients retry against the
+// active
+func (c *Coordinator) RequireActive(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if !c.Active() {
+				w.Header().Set("Retry-After", strconv.Itoa(int(c.cfg.CheckInterval.Seconds())+1))
+				http.Error(w, "This replica is the standby; send writes to the active payment gateway", http.StatusServiceUnavailable)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requirePeerToken admits only the peer replica, by the shared FAILOVER_TOKEN
+func (c *Coordinator) requirePeerToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(FailoverTokenHeader)), []byte(c.cfg.Token)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// PeerStatusHandler handles GET /internal/failover/status for the peer's checks
+func (c *Coordinator) PeerStatusHandler(w http.ResponseWriter, r *http.Request) {
+	c.mu.RLock()
+	status := PeerStatus{NodeID: c.cfg.NodeID, Role: c.role, Epoch: c.epoch, ChangeSeq: c.logStart + uint64(len(c.log))}
+	c.mu.RUnlock()
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(status)
+}
+
+// ChangesHandler handles GET /internal/failover/changes?after=N: the active's
+// transactions logged after sequence number N, for its standby to copy
+func (c *Coordinator) ChangesHandler(w http.ResponseWriter, r *http.Request) {
+	after, err := strconv.ParseUint(r.URL.Query().Get("after"), 10, 64)
+	if err != nil {
+		http.Error(w, "after must be a sequence number", http.StatusBadRequest)
+		return
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.role != RoleActive {
+		http.Error(w, "Only the active replica serves changes", http.StatusConflict)
+		return
+	}
+	changes := FailoverChanges{Epoch: c.epoch, Transactions: []Transaction{}}
+	end := c.logStart + uint64(len(c.log))
+	if after > end {
+		// The standby copied from an earlier active; start again from the beginning
+		after = 0
+	}
+	if after < c.logStart {
+		changes.Gap = after > 0 || c.logStart > 0
+		after = c.logStart
+	}
+	first := int(after - c.logStart)
+	last := first + failoverChangesPage
+	if last > len(c.log) {
+		last = len(c.log)
+	}
+	changes.Transactions = append(changes.Transactions, c.log[first:last]...)
+	changes.Next = c.logStart + uint64(last)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(changes)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testReplica is one side of a failover pair, reachable by its peer over HTTP
+type testReplica struct {
+	server *httptest.Server
+	coord  *Coordinator
+	repo   *memoryRepository
+	index  *TransactionStore
+	down   atomic.Bool
+}
+
+func newTestReplica(t *testing.T) *testReplica {
+	r := &testReplica{repo: newMemoryRepository(100), index: NewTransactionStore()}
+	r.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if r.down.Load() || r.coord == nil {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		switch req.URL.Path {
+		case "/internal/failover/status":
+			r.coord.requirePeerToken(r.coord.PeerStatusHandler)(w, req)
+		case "/internal/failover/changes":
+			r.coord.requirePeerToken(r.coord.ChangesHandler)(w, req)
+		default:
+			r.coord.RequireActive(http.NotFoundHandler()).ServeHTTP(w, req)
+		}
+	}))
+	t.Cleanup(r.server.Close)
+	return r
+}
+
+func (r *testReplica) start(t *testing.T, node, role string, peer *testReplica) {
+	cfg := FailoverConfig{Role: role, NodeID: node, PeerURL: peer.server.URL, Token: "shared-secret", CheckInterval: time.Second, FailureThreshold: 3}
+	coord, err := newCoordinator(context.Background(), cfg, r.repo, r.index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.coord = coord
+}
+
+// TestFailover tests that the standby copies the active's payments, takes over with a
+// later epoch once the active stops answering, and that the former active steps down
+// when it comes back
+func TestFailover(t *testing.T) {
+	ctx := context.Background()
+	a, b := newTestReplica(t), newTestReplica(t)
+	a.start(t, "pg-a", RoleActive, b)
+	b.start(t, "pg-b", RoleStandby, a)
+
+	at := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	if err := a.coord.Save(ctx, testTransaction("TXN-1", 2500, "cust-1", "pat-1", "Copay", at)); err != nil {
+		t.Fatal(err)
+	}
+	b.coord.check(ctx)
+	if _, err := b.repo.Get(ctx, "TXN-1"); err != nil {
+		t.Fatalf("expected the standby to copy the payment, got %v", err)
+	}
+	if b.index.Len() != 1 {
+		t.Fatal("expected the copied payment to be searchable on the standby")
+	}
+	if err := b.coord.Save(ctx, testTransaction("TXN-2", 2500, "cust-1", "pat-1", "Copay", at)); !errors.Is(err, ErrNotActive) {
+		t.Fatalf("expected the standby to refuse writes, got %v", err)
+	}
+	resp, err := http.Post(b.server.URL+"/api/v2/payments", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") == "" {
+		t.Fatalf("expected 503 with Retry-After from the standby, got %d", resp.StatusCode)
+	}
+	resp, err = http.Get(a.server.URL + "/internal/failover/changes?after=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected replication without the token to be refused, got %d", resp.StatusCode)
+	}
+
+	// The active stops answering; the standby waits out the threshold, then takes over
+	a.down.Store(true)
+	for i := 0; i < 2; i++ {
+		b.coord.check(ctx)
+	}
+	if b.coord.Active() {
+		t.Fatal("expected the standby to wait for the failure threshold")
+	}
+	b.coord.check(ctx)
+	status := b.coord.Status()
+	if status.Role != RoleActive || status.Epoch != 2 || status.Reason != "peer_unreachable" {
+		t.Fatalf("expected the standby to take over with epoch 2, got %+v", status)
+	}
+	if err := b.coord.Save(ctx, testTransaction("TXN-3", 4000, "cust-2", "pat-2", "Copay", at)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The former active returns still believing it is active, and steps down on seeing
+	// the later epoch, then copies what it missed
+	a.down.Store(false)
+	a.coord.check(ctx)
+	status = a.coord.Status()
+	if status.Role != RoleStandby || status.Epoch != 2 || status.Reason != "peer_newer_epoch" {
+		t.Fatalf("expected the former active to step down, got %+v", status)
+	}
+	a.coord.check(ctx)
+	if _, err := a.repo.Get(ctx, "TXN-3"); err != nil {
+		t.Fatalf("expected the former active to copy the new active's payment, got %v", err)
+	}
+}
+
+// TestFailoverRestartedActive tests that a replica configured as active starts as the
+// standby when its peer has already taken over
+func TestFailoverRestartedActive(t *testing.T) {
+	a, b := newTestReplica(t), newTestReplica(t)
+	b.start(t, "pg-b", RoleActive, a)
+	a.start(t, "pg-a", RoleActive, b)
+	if a.coord.Active() || a.coord.Status().Epoch != 1 {
+		t.Fatalf("expected the restarted replica to defer to the active peer, got %+v", a.coord.Status())
+	}
+}
@@ -1,16 +1,56 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
-	"math"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/healthcare-gitops/common/audit"
+	"github.com/healthcare-gitops/common/auth"
+	"github.com/healthcare-gitops/common/events"
+	"github.com/healthcare-gitops/common/health"
+	"github.com/healthcare-gitops/common/honeytoken"
+	"github.com/rs/zerolog/log"
 )
 
 type PaymentHandler struct {
 	MaxLatency time.Duration
+	// Repository records authorized payments; nil disables recording
+	Repository TransactionRepository
+	// Transactions indexes authorized payments for search; nil disables indexing
+	Transactions *TransactionStore
+	// Summary counts payments for dashboards; nil disables counting
+	Summary *PaymentSummary
+	// Failover is the replica's active/standby coordinator; nil runs a single replica
+	Failover *Coordinator
+	// SOX audits captures, refunds, voids and approvals; nil disables auditing
+	SOX *SOXFinancialControlManager
+	// Processor authorizes, captures, refunds and voids payments; nil uses the sandbox
+	Processor PaymentProcessor
+	// Webhooks notifies downstream systems of payments and refunds; nil disables them
+	Webhooks *WebhookStore
+	// Events streams captures to the event broker; nil streams none
+	Events *events.Stream
+	// Rates snapshots each payment's rate to the reporting currency; nil takes none
+	Rates *ExchangeRates
+	// Tokenizer exchanges card details for tokens; nil tokenizes locally
+	Tokenizer CardTokenizer
+	// Approvals holds high-value payments for approval; nil approves nothing
+	Approvals *ApprovalPolicy
+	// Risk scores payments before they are authorized; nil scores none.
+	// RiskCountryHeader names the header carrying the client's country.
+	Risk              RiskScorer
+	RiskCountryHeader string
+	// Dependencies are readiness checks of the services the gateway calls
+	Dependencies []health.Check
 }
 
 // setSecurityHeaders sets strong default security/compliance headers.
@@ -32,27 +72,33 @@ func (h PaymentHandler) Health(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// Readiness returns readiness status for Kubernetes readiness probe
+// Readiness returns readiness status for Kubernetes readiness probe. The gateway is
+// not ready while the transaction repository is unreachable, or while this replica is
+// the standby; failing dependencies only degrade it.
 func (h PaymentHandler) Readiness(w http.ResponseWriter, r *http.Request) {
 	h.setSecurityHeaders(w)
-	w.Header().Set("Content-Type", "application/json")
-
-	// In production, check dependencies (database, external APIs, etc.)
-	ready := true
-
-	if ready {
-		w.WriteHeader(http.StatusOK)
-		_ = json.NewEncoder(w).Encode(map[string]interface{}{
-			"ready":   true,
-			"service": "payment-gateway",
-		})
-	} else {
-		w.WriteHeader(http.StatusServiceUnavailable)
-		_ = json.NewEncoder(w).Encode(map[string]interface{}{
-			"ready":   false,
-			"service": "payment-gateway",
+	var checks []health.Check
+	if h.Repository != nil {
+		checks = append(checks, health.Check{Name: "database", Critical: true, Probe: h.Repository.Ping})
+	}
+	if h.Failover != nil {
+		checks = append(checks, health.Check{
+			Name:     "failover",
+			Critical: true,
+			Probe: func(context.Context) error {
+				if !h.Failover.Active() {
+					return errors.New("standby replica")
+				}
+				return nil
+			},
 		})
 	}
+	checker := health.Checker{
+		Service:   "payment-gateway",
+		Checks:    append(checks, h.Dependencies...),
+		OnFailure: health.LogFailure,
+	}
+	health.Write(w, checker.Run(r.Context()))
 }
 
 // ProcessPayment is an HTTP handler expected by tests. It wraps Charge logic.
@@ -68,18 +114,12 @@ func (h PaymentHandler) Charge(w http.ResponseWriter, r *http.Request) {
 func (h PaymentHandler) handleChargeCommon(w http.ResponseWriter, r *http.Request) {
 	h.setSecurityHeaders(w)
 
-	// Enforce request size limit (1MB)
-	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
-	defer r.Body.Close()
-
-	// Read raw (bounded) to distinguish size errors from JSON unmarshalling issues
-	raw, readErr := io.ReadAll(r.Body)
-	if readErr != nil {
-		lower := strings.ToLower(readErr.Error())
-		if strings.Contains(lower, "request body too large") || strings.Contains(lower, "body too large") {
-			http.Error(w, "request entity too large", http.StatusRequestEntityTooLarge)
-			return
-		}
+	raw, err := readPayload(w, r)
+	if errors.Is(err, errPayloadTooLarge) {
+		http.Error(w, "request entity too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
 		http.Error(w, "invalid payload", http.StatusBadRequest)
 		return
 	}
@@ -90,27 +130,121 @@ func (h PaymentHandler) handleChargeCommon(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// Backward compatibility: if Amount provided, derive AmountCents
+	// Backward compatibility: if Amount provided, derive AmountCents in the currency's
+	// minor unit. An unknown currency is refused when the payment is validated.
 	if req.AmountCents == 0 && req.Amount > 0 {
-		req.AmountCents = int64(math.Round(req.Amount * 100))
+		currency, ok := lookupCurrency(req.Currency)
+		if !ok {
+			currency = currencies[defaultReportingCurrency]
+		}
+		if req.AmountCents, err = currency.minorUnits(req.Amount); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	enriched, err := h.authorize(w, r, req)
+	if errors.Is(err, errTransactionNotRecorded) {
+		http.Error(w, errTransactionNotRecorded.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if errors.Is(err, ErrProcessorUnavailable) {
+		http.Error(w, "payment processor unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if errors.Is(err, ErrExchangeRateUnavailable) {
+		http.Error(w, "exchange rates unavailable", http.StatusServiceUnavailable)
+		return
 	}
+	if errors.Is(err, ErrTokenizerUnavailable) {
+		http.Error(w, "card tokenization unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if errors.Is(err, ErrPaymentDeclined) {
+		http.Error(w, err.Error(), http.StatusPaymentRequired)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// For HTTP responses, tests expect status "success"
+	enriched.Status = "success"
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(enriched)
+}
+
+// Payload read errors
+var (
+	errPayloadTooLarge = errors.New("request entity too large")
+	errInvalidPayload  = errors.New("invalid payload")
+)
+
+// readPayload reads a request body of at most 1MB
+func readPayload(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	defer r.Body.Close()
+
+	// Read raw (bounded) to distinguish size errors from JSON unmarshalling issues
+	raw, err := io.ReadAll(r.Body)
+	if err != nil {
+		lower := strings.ToLower(err.Error())
+		if strings.Contains(lower, "request body too large") || strings.Contains(lower, "body too large") {
+			return nil, errPayloadTooLarge
+		}
+		return nil, errInvalidPayload
+	}
+	return raw, nil
+}
 
-	// Process the payment
+// authorize runs a payment through the service layer shared by every API version:
+// processing, metrics and the compliance headers. The response carries the audit
+// and transaction IDs.
+func (h PaymentHandler) authorize(w http.ResponseWriter, r *http.Request, req PaymentRequest) (PaymentResponse, error) {
 	start := time.Now()
-	resp, err := ProcessPayment(req, h.MaxLatency)
+	txnID := generateTransactionID()
+	processor := h.processor()
+	audit.SetResource(r.Context(), "transaction/"+txnID)
+	audit.Annotate(r.Context(), "processor", processor.Name())
+	// The card is tokenized and the rate taken before the processor is asked, so no
+	// card number reaches it and no payment is authorized that could not be reported
+	var rate *ExchangeRate
+	var reporting *Money
+	var risk *RiskAssessment
+	var resp PaymentResponse
+	var authz Authorization
+	err := validatePayment(req)
+	if err == nil && req.Card != nil {
+		req, err = tokenizeCard(r.Context(), h.tokenizer(), req)
+	}
+	if err == nil {
+		rate, reporting, err = h.Rates.Snapshot(r.Context(), Money{AmountMinor: req.AmountCents, Currency: req.Currency})
+	}
+	if err == nil {
+		risk, err = h.assessRisk(r, txnID, req, reporting)
+	}
+	asked := err == nil
+	if asked {
+		resp, authz, err = processPayment(r.Context(), processor, txnID, req)
+	}
 	duration := time.Since(start)
+	if asked && !errors.Is(err, ErrInvalidAmount) && !errors.Is(err, ErrMissingFields) {
+		RecordProcessorRequest(processor.Name(), OperationAuthorize, err, duration)
+	}
 
 	// Update metrics
 	RecordTransaction(req, duration, err == nil)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+		h.Summary.Record(req, PaymentResponse{}, false, start)
+		h.publishFailure(txnID, processor.Name(), req, err)
+		return PaymentResponse{}, err
 	}
 
 	// Compliance/audit enrichment
 	auditID := generateAuditID()
-	txnID := generateTransactionID()
 
 	// Set compliance headers
 	w.Header().Set("X-Audit-Transaction-ID", txnID)
@@ -126,16 +260,58 @@ func (h PaymentHandler) handleChargeCommon(w http.ResponseWriter, r *http.Reques
 		w.Header().Set("X-FDA-Validated", "true")
 	}
 
-	// Build response body
-	enriched := resp
-	// For HTTP responses, tests expect status "success"
-	enriched.Status = "success"
-	enriched.TransactionID = txnID
-	enriched.AuditID = auditID
+	resp.TransactionID = txnID
+	resp.AuditID = auditID
+	resp.Card = req.CardToken
+	txn := newTransaction(req, resp)
+	txn.Processor, txn.ProcessorReference = processor.Name(), authz.Reference
+	txn.ExchangeRate, txn.ReportingAmount = rate, reporting
+	txn.Risk = risk
+	initiator := "unauthenticated"
+	if identity, ok := auth.FromContext(r.Context()); ok {
+		initiator = identity.UserID
+	}
+	if h.Approvals.Hold(&txn, initiator) {
+		resp.Status = txn.Status
+	}
+	if h.Repository != nil {
+		if err := h.Repository.Save(r.Context(), txn); err != nil {
+			log.Error().Err(err).Str("transaction_id", txnID).Msg("Failed to record transaction")
+			h.Summary.Record(req, PaymentResponse{}, false, start)
+			err = fmt.Errorf("%w: %v", errTransactionNotRecorded, err)
+			h.publishFailure(txnID, processor.Name(), req, err)
+			return PaymentResponse{}, err
+		}
+	}
+	h.Transactions.Add(txn)
+	h.Summary.Record(req, resp, true, start)
+	h.Webhooks.Publish(EventPaymentSucceeded, paymentSucceeded(txn, ""))
+	return resp, nil
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	_ = json.NewEncoder(w).Encode(enriched)
+// publishFailure sends payment.failed for declined and unrecorded payments; invalid
+// requests are the caller's to fix and are not published
+func (h PaymentHandler) publishFailure(txnID, processor string, req PaymentRequest, err error) {
+	if event := paymentFailed(txnID, processor, req, err, time.Now()); event != nil {
+		h.Webhooks.Publish(EventPaymentFailed, event)
+	}
+}
+
+// processor returns the configured payment processor, or the sandbox
+func (h PaymentHandler) processor() PaymentProcessor {
+	if h.Processor == nil {
+		return newSandboxProcessor(h.MaxLatency)
+	}
+	return h.Processor
+}
+
+// tokenizer returns the configured card tokenizer, or a local one
+func (h PaymentHandler) tokenizer() CardTokenizer {
+	if h.Tokenizer == nil {
+		tokenizer, _ := NewCardTokenizer(CardTokenizerConfig{})
+		return tokenizer
+	}
+	return h.Tokenizer
 }
 
 // Simple ID generators for demo/testing (not cryptographically secure)
@@ -143,49 +319,120 @@ func generateAuditID() string {
 	return "AUDIT-" + time.Now().Format("20060102-150405.000")
 }
 
+// generateTransactionID timestamps the ID and adds a random suffix, since the
+// repository keys transactions by ID and several can be authorized in a millisecond
 func generateTransactionID() string {
-	return "TXN-" + time.Now().Format("20060102-150405.000")
+	return transactionID(time.Now())
 }
 
-// ComplianceStatusHandler returns compliance status
-func (h PaymentHandler) ComplianceStatusHandler(w http.ResponseWriter, r *http.Request) {
-	h.setSecurityHeaders(w)
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	_ = json.NewEncoder(w).Encode(map[string]interface{}{
-		"service":    "payment-gateway",
-		"compliance": []string{"SOX", "PCI-DSS", "HIPAA"},
-		"status":     "compliant",
-		"last_audit": time.Now().Add(-24 * time.Hour).Format(time.RFC3339),
-	})
+func transactionID(at time.Time) string {
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	return "TXN-" + at.Format("20060102-150405.000") + "-" + hex.EncodeToString(suffix)
 }
 
-// AuditTrailHandler returns recent audit trail entries
+// maxAuditTrailQuery bounds how many entries one audit trail query returns
+const maxAuditTrailQuery = 1000
+
+// AuditTrailHandler queries the SOX audit trail, including the records of captures,
+// refunds and voids, newest first. Supports ?transaction_id=, ?event=, ?user_id=,
+// ?since= and ?until= (RFC 3339, until exclusive) and ?limit= (default 100, at most
+// 1000).
 func (h PaymentHandler) AuditTrailHandler(w http.ResponseWriter, r *http.Request) {
 	h.setSecurityHeaders(w)
+	query := r.URL.Query()
+	filter := SOXAuditFilter{
+		TransactionID: query.Get("transaction_id"),
+		Action:        query.Get("event"),
+		UserID:        query.Get("user_id"),
+		Limit:         100,
+	}
+	for name, dst := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if value := query.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				http.Error(w, name+" must be an RFC 3339 timestamp", http.StatusBadRequest)
+				return
+			}
+			*dst = t
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxAuditTrailQuery {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxAuditTrailQuery), http.StatusBadRequest)
+			return
+		}
+		filter.Limit = n
+	}
+
+	audits, err := h.SOX.QueryAuditTrails(filter)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to read SOX audit trail")
+		http.Error(w, "Failed to read audit trail", http.StatusInternalServerError)
+		return
+	}
+	entries := []map[string]interface{}{}
+	for _, audit := range audits {
+		status := "success"
+		if strings.HasSuffix(audit.Action, "_REJECTED") {
+			status = "rejected"
+		} else if strings.HasSuffix(audit.Action, "_FAILED") {
+			status = "failed"
+		}
+		entries = append(entries, map[string]interface{}{
+			"id":             audit.ControlTest,
+			"seq":            audit.Seq,
+			"timestamp":      audit.Timestamp.UTC().Format(time.RFC3339),
+			"event":          strings.ToLower(audit.Action),
+			"status":         status,
+			"transaction_id": audit.TransactionID,
+			"user_id":        audit.UserID,
+			"details":        audit.Details,
+			"prev_hash":      audit.PrevHash,
+			"hash":           audit.Hash,
+		})
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	_ = json.NewEncoder(w).Encode(map[string]interface{}{
 		"service": "payment-gateway",
-		"entries": []map[string]interface{}{
-			{
-				"id":        generateAuditID(),
-				"timestamp": time.Now().Add(-1 * time.Hour).Format(time.RFC3339),
-				"event":     "payment_processed",
-				"status":    "success",
-			},
-		},
+		"entries": entries,
+		"count":   len(entries),
 	})
 }
 
-// AlertingHandler returns active alerts
+// VerifyAuditTrailHandler walks the SOX audit hash chain and reports whether it is
+// intact
+func (h PaymentHandler) VerifyAuditTrailHandler(w http.ResponseWriter, r *http.Request) {
+	h.setSecurityHeaders(w)
+	result, err := h.SOX.Verify()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to read SOX audit trail")
+		http.Error(w, "Failed to read audit trail", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+// AlertingHandler returns active alerts, including reads of decoy transactions
 func (h PaymentHandler) AlertingHandler(w http.ResponseWriter, r *http.Request) {
+	alerts := []honeytoken.Alert{}
+	if h.Transactions != nil {
+		alerts = h.Transactions.decoys.Alerts(100)
+	}
+	status := "healthy"
+	if len(alerts) > 0 {
+		status = "alerting"
+	}
 	h.setSecurityHeaders(w)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	_ = json.NewEncoder(w).Encode(map[string]interface{}{
 		"service": "payment-gateway",
-		"alerts":  []interface{}{},
-		"status":  "healthy",
+		"alerts":  alerts,
+		"status":  status,
 	})
 }
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/healthcare-gitops/common/auth"
+	"github.com/healthcare-gitops/common/honeytoken"
+	"github.com/rs/zerolog/log"
+)
+
+// KindTransaction is the honeytoken kind of decoy transactions, registered by ID
+const KindTransaction = "transaction"
+
+// maxDecoysPerRequest bounds the decoy transactions seeded by one request
+const maxDecoysPerRequest = 100
+
+// decoyWindow is how far back decoy transactions are dated, so they sit among real
+// history rather than at the top of every search
+const decoyWindow = 30 * 24 * time.Hour
+
+var (
+	decoyMethods      = []string{"credit_card", "debit_card", "ach", "hsa_card"}
+	decoyDescriptions = []string{"Copay - outpatient visit", "MRI imaging deductible", "Physical therapy session", "Lab panel balance", "Pharmacy copay"}
+)
+
+// DecoyRequest asks for decoy transactions to be seeded
+type DecoyRequest struct {
+	Count int    `json:"count,omitempty"`
+	Label string `json:"label,omitempty"`
+}
+
+// openHoneytokens opens the decoy registry at HONEYTOKEN_PATH, logging every alert
+func openHoneytokens(cfg honeytoken.Config) (*honeytoken.Registry, error) {
+	cfg.OnAlert = func(alert honeytoken.Alert) {
+		log.Error().
+			Str("security_alert", "honeytoken").
+			Str("severity", alert.Severity).
+			Str("alert_id", alert.ID).
+			Str("token_id", alert.TokenID).
+			Str("action", alert.Action).
+			Str("user_id", alert.UserID).
+			Str("client_ip", alert.ClientIP).
+			Str("request_id", alert.RequestID).
+			Msg("Honeytoken transaction read")
+		RecordHoneytokenAlert(alert.Action)
+	}
+	cfg.OnNotifyError = func(alert honeytoken.Alert, err error) {
+		log.Error().Err(err).Str("alert_id", alert.ID).Msg("Failed to send honeytoken alert to the SOC")
+	}
+	return honeytoken.Open(cfg)
+}
+
+func randomInt(n int64) int64 {
+	i, _ := rand.Int(rand.Reader, big.NewInt(n))
+	return i.Int64()
+}
+
+// decoyTransaction builds a transaction shaped like an authorized payment from the
+// last decoyWindow, for a decoy patient
+func decoyTransaction(now time.Time) (Transaction, error) {
+	patientID, err := honeytoken.Generate(honeytoken.KindPatientID)
+	if err != nil {
+		return Transaction{}, err
+	}
+	at := now.Add(-time.Duration(randomInt(int64(decoyWindow)))).Truncate(time.Millisecond)
+	req := PaymentRequest{
+		AmountCents: 1500 + randomInt(95000),
+		Currency:    "USD",
+		CustomerID:  fmt.Sprintf("CUST-%05d", randomInt(100000)),
+		Method:      decoyMethods[randomInt(int64(len(decoyMethods)))],
+		PatientID:   patientID,
+		Description: decoyDescriptions[randomInt(int64(len(decoyDescriptions)))],
+	}
+	resp := PaymentResponse{
+		Status:        "authorized",
+		AuthCode:      "AUTH-" + at.Format("150405"),
+		ProcessedAt:   at.Unix(),
+		HighValue:     req.AmountCents >= 10000,
+		TransactionID: transactionID(at),
+		AuditID:       "AUDIT-" + at.Format("20060102-150405.000"),
+	}
+	return newTransaction(req, resp), nil
+}
+
+// SeedDecoys adds n decoy transactions to the store and the repository and registers
+// them. Decoys skip the dashboard summary and transaction metrics, so reports never
+// count them.
+func (s *TransactionStore) SeedDecoys(ctx context.Context, n int, label string) ([]Transaction, error) {
+	seeded := make([]Transaction, 0, n)
+	for len(seeded) < n {
+		txn, err := decoyTransaction(time.Now())
+		if err != nil {
+			return seeded, err
+		}
+		if s.decoys.IsDecoy(txn.ID) {
+			continue
+		}
+		if _, err := s.decoys.Add(KindTransaction, txn.ID, label); err != nil {
+			return seeded, err
+		}
+		if s.repository != nil {
+			if err := s.repository.Save(ctx, txn); err != nil {
+				return seeded, err
+			}
+		}
+		s.Add(txn)
+		seeded = append(seeded, txn)
+	}
+	return seeded, nil
+}
+
+// checkDecoys raises an alert for every decoy among transactions a read returned. The
+// response is unchanged, so the reader cannot tell decoys from real transactions.
+func (s *TransactionStore) checkDecoys(r *http.Request, action string, results []Transaction) {
+	if s == nil || s.decoys == nil {
+		return
+	}
+	access := honeytoken.Access{
+		Action:    action,
+		Resource:  r.URL.Path,
+		ClientIP:  r.RemoteAddr,
+		RequestID: middleware.GetReqID(r.Context()),
+	}
+	if id, ok := auth.FromContext(r.Context()); ok {
+		access.UserID = id.UserID
+	}
+	for _, txn := range results {
+		s.decoys.Check(txn.ID, access)
+	}
+}
+
+// SeedDecoysHandler handles POST /api/v1/honeytokens: seeds decoy transactions
+func (s *TransactionStore) SeedDecoysHandler(w http.ResponseWriter, r *http.Request) {
+	var req DecoyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Count == 0 {
+		req.Count = 1
+	}
+	if req.Count < 1 || req.Count > maxDecoysPerRequest {
+		http.Error(w, "count must be between 1 and "+strconv.Itoa(maxDecoysPerRequest), http.StatusBadRequest)
+		return
+	}
+	seeded, err := s.SeedDecoys(r.Context(), req.Count, req.Label)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to seed decoy transactions")
+		http.Error(w, "Failed to seed decoy transactions", http.StatusInternalServerError)
+		return
+	}
+	log.Info().Int("count", len(seeded)).Msg("Decoy transactions seeded")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"transactions": seeded,
+		"count":        len(seeded),
+	})
+}
+
+// ListDecoysHandler handles GET /api/v1/honeytokens
+func (s *TransactionStore) ListDecoysHandler(w http.ResponseWriter, r *http.Request) {
+	tokens := s.decoys.Tokens()
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"honeytokens": tokens,
+		"count":       len(tokens),
+	})
+}
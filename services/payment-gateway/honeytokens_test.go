@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/healthcare-gitops/common/auth"
+	"github.com/healthcare-gitops/common/honeytoken"
+)
+
+func TestDecoyTransactionSearchAlertsSOC(t *testing.T) {
+	received := make(chan honeytoken.Alert, 4)
+	soc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert honeytoken.Alert
+		if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+			t.Errorf("decode SOC alert: %v", err)
+		}
+		received <- alert
+	}))
+	defer soc.Close()
+	decoys, err := openHoneytokens(honeytoken.Config{Service: "payment-gateway", SOCWebhookURL: soc.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewTransactionStore()
+	store.decoys = decoys
+	store.Add(testTransaction("TXN-real", 4200, "CUST-1", "PT-real", "Copay", time.Now()))
+
+	rr := httptest.NewRecorder()
+	store.SeedDecoysHandler(rr, httptest.NewRequest(http.MethodPost, "/api/v1/honeytokens", strings.NewReader(`{"count":2,"label":"red-team"}`)))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("seed expected 201, got %d: %s", rr.Code, rr.Body)
+	}
+	var seeded struct {
+		Transactions []Transaction `json:"transactions"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&seeded); err != nil {
+		t.Fatal(err)
+	}
+	if len(seeded.Transactions) != 2 || len(decoys.Tokens()) != 2 {
+		t.Fatalf("expected 2 decoys, got %+v", seeded.Transactions)
+	}
+	decoy := seeded.Transactions[0]
+	if !strings.HasPrefix(decoy.ID, "TXN-") || !strings.HasPrefix(decoy.PatientID, "PT-") || decoy.Status != "authorized" {
+		t.Fatalf("decoy does not look like a real transaction: %+v", decoy)
+	}
+
+	search := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/transactions/search?"+query, nil)
+		req = req.WithContext(auth.WithIdentity(req.Context(), auth.Identity{UserID: "analyst"}))
+		rr := httptest.NewRecorder()
+		store.SearchHandler(rr, req)
+		return rr
+	}
+
+	// Real transactions raise nothing
+	if rr := search("patient_id=PT-real"); rr.Code != http.StatusOK {
+		t.Fatalf("search expected 200, got %d", rr.Code)
+	}
+	if alerts := decoys.Alerts(10); len(alerts) != 0 {
+		t.Fatalf("expected no alerts, got %+v", alerts)
+	}
+
+	rr = search("patient_id=" + decoy.PatientID)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), decoy.ID) {
+		t.Fatalf("expected the decoy in results, got %d: %s", rr.Code, rr.Body)
+	}
+	decoys.Wait()
+	select {
+	case alert := <-received:
+		if alert.Severity != honeytoken.Severity || alert.Action != "search" || alert.UserID != "analyst" || alert.Kind != KindTransaction {
+			t.Fatalf("unexpected SOC alert: %+v", alert)
+		}
+	default:
+		t.Fatal("expected the SOC to receive an alert")
+	}
+
+	rr = httptest.NewRecorder()
+	PaymentHandler{Transactions: store}.AlertingHandler(rr, httptest.NewRequest(http.MethodGet, "/alerts", nil))
+	var status struct {
+		Alerts []honeytoken.Alert `json:"alerts"`
+		Status string             `json:"status"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != "alerting" || len(status.Alerts) != 1 {
+		t.Fatalf("expected /alerts to report the decoy read, got %+v", status)
+	}
+}
+
+func TestSeedDecoysValidation(t *testing.T) {
+	store := NewTransactionStore()
+	for _, body := range []string{`{"count":101}`, `{"count":-1}`, `not json`} {
+		rr := httptest.NewRecorder()
+		store.SeedDecoysHandler(rr, httptest.NewRequest(http.MethodPost, "/api/v1/honeytokens", strings.NewReader(body)))
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", body, rr.Code)
+		}
+	}
+}
@@ -9,17 +9,29 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/healthcare-gitops/common/config"
+	"github.com/healthcare-gitops/common/tlsconfig"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
 func main() {
+	// The config file was read as the config package initialized; reading it again
+	// returns the error, reported once logging is set up
+	configErr := config.Load()
+
 	// Initialize structured logging
 	initLogging()
 
 	log.Info().Msg("Starting Payment Gateway Service")
 
 	// Load configuration
+	if configErr != nil {
+		log.Fatal().Err(configErr).Msg("Failed to read config file")
+	}
+	if err := validateSettings(); err != nil {
+		log.Fatal().Err(err).Msg("Invalid configuration")
+	}
 	cfg := LoadConfig()
 
 	// Initialize OpenTelemetry tracing
@@ -29,7 +41,12 @@ func main() {
 	}
 	defer shutdown(context.Background())
 
-	log.Info().Str("service", cfg.ServiceName).Str("port", cfg.Port).Msg("Configuration loaded")
+	log.Info().Str("service", cfg.ServiceName).Str("port", cfg.Port).Str("config_file", config.File()).Msg("Configuration loaded")
+	if cfg.TLS.MutualTLS() {
+		log.Info().Str("client_auth", cfg.TLS.ClientAuth).Strs("allowed_clients", cfg.TLS.AllowedClients).Msg("Mutual TLS enabled")
+	} else if cfg.TLS.Enabled() {
+		log.Info().Msg("TLS enabled")
+	}
 
 	// Create server with observability
 	server := NewServer(cfg)
@@ -37,7 +54,7 @@ func main() {
 	// Start server in goroutine
 	go func() {
 		log.Info().Str("address", server.Addr).Msg("Starting HTTP server")
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := tlsconfig.ListenAndServe(server, cfg.TLS); err != nil && err != http.ErrServerClosed {
 			log.Fatal().Err(err).Msg("Server failed")
 		}
 	}()
@@ -56,6 +73,12 @@ func main() {
 	if err := server.Shutdown(ctx); err != nil {
 		log.Fatal().Err(err).Msg("Server forced to shutdown")
 	}
+	if err := auditEvents.Close(ctx); err != nil {
+		log.Error().Err(err).Msg("Failed to flush audit events")
+	}
+	if err := eventStream.Close(ctx); err != nil {
+		log.Error().Err(err).Msg("Failed to flush streamed events")
+	}
 
 	log.Info().Msg("Server exited gracefully")
 }
@@ -63,14 +86,16 @@ func main() {
 // initLogging initializes zerolog with JSON output
 func initLogging() {
 	// Use JSON logging in production, pretty console in development
-	if os.Getenv("ENVIRONMENT") == "development" {
-		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+	// Card numbers are masked in either, should any reach a log line
+	if config.GetEnv("ENVIRONMENT", "") == "development" {
+		log.Logger = log.Output(zerolog.ConsoleWriter{Out: panRedactingWriter{out: os.Stderr}})
 	} else {
 		zerolog.TimeFieldFormat = time.RFC3339
+		log.Logger = log.Output(panRedactingWriter{out: os.Stderr})
 	}
 
-	// Set log level from environment (default: info)
-	logLevel := os.Getenv("LOG_LEVEL")
+	// Set log level from configuration (default: info)
+	logLevel := config.GetEnv("LOG_LEVEL", "")
 	switch logLevel {
 	case "debug":
 		zerolog.SetGlobalLevel(zerolog.DebugLevel)
@@ -87,8 +112,8 @@ func initLogging() {
 
 // InitTracing initializes OpenTelemetry tracing
 func InitTracing(serviceName string) (func(context.Context) error, error) {
-	// Get OTLP endpoint from environment
-	otlpEndpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	// Get OTLP endpoint from the environment or config file
+	otlpEndpoint := config.GetEnv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
 	if otlpEndpoint == "" {
 		otlpEndpoint = "http://otel-collector.observability:4317"
 		log.Warn().Msg("OTEL_EXPORTER_OTLP_ENDPOINT not set, using default: " + otlpEndpoint)
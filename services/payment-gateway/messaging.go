@@ -0,0 +1,428 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// Delivery statuses of a patient message. The notification service reports the
+// outcome of every sent message back to /api/v1/notifications/status.
+const (
+	MessageSent      = "sent"
+	MessageDelivered = "delivered"
+	MessageBounced   = "bounced"
+	MessageFailed    = "failed"
+	// MessageScheduled is a message held until the tenant's business hours; it is
+	// sent, and counted in analytics, when they begin
+	MessageScheduled = "scheduled"
+)
+
+// maxTrackedMessages bounds the messages kept for delivery callbacks; the oldest are
+// forgotten first and late callbacks for them are ignored
+const maxTrackedMessages = 50000
+
+// ErrMessageNotFound is returned for delivery callbacks about unknown messages
+var ErrMessageNotFound = errors.New("message not found")
+
+// e164Pattern matches an E.164 phone number, e.g. +15551234567
+var e164Pattern = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// NotificationSender hands a rendered message to the notification service, which
+// delivers it and reports the outcome asynchronously
+type NotificationSender interface {
+	Send(ctx context.Context, notification Notification) error
+}
+
+// Notification is the request body the notification service accepts
+type Notification struct {
+	MessageID  string `json:"message_id"`
+	Channel    string `json:"channel"`
+	To         string `json:"to"`
+	Subject    string `json:"subject,omitempty"`
+	Body       string `json:"body"`
+	TemplateID string `json:"template_id"`
+	Version    int    `json:"template_version"`
+	Locale     string `json:"locale"`
+	Category   string `json:"category"`
+}
+
+// HTTPNotificationSender posts notifications to the notification service's
+// /api/v1/notifications endpoint
+type HTTPNotificationSender struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewHTTPNotificationSender returns a sender for the notification service at baseURL,
+// or nil when baseURL is empty
+func NewHTTPNotificationSender(baseURL string) NotificationSender {
+	if baseURL == "" {
+		return nil
+	}
+	return &HTTPNotificationSender{
+		URL:    strings.TrimRight(baseURL, "/") + "/api/v1/notifications",
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Send posts one notification; any status other than 200 or 202 is a failure
+func (s *HTTPNotificationSender) Send(ctx context.Context, notification Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("notification service: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("notification service returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Message is a patient message sent from a template and its latest delivery status
+type Message struct {
+	ID         string    `json:"id"`
+	TemplateID string    `json:"template_id"`
+	Version    int       `json:"template_version"`
+	Channel    string    `json:"channel"`
+	Locale     string    `json:"locale"`
+	Status     string    `json:"status"`
+	Segments   int       `json:"segments,omitempty"`
+	SentAt     time.Time `json:"sent_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	// ScheduledFor is when a message held outside business hours will be sent
+	ScheduledFor *time.Time `json:"scheduled_for,omitempty"`
+}
+
+// DeliveryCounts tallies messages by delivery outcome. Sent counts every message
+// handed to the notification service, whatever happened to it afterwards.
+type DeliveryCounts struct {
+	Sent      int `json:"sent"`
+	Delivered int `json:"delivered"`
+	Bounced   int `json:"bounced"`
+	Failed    int `json:"failed"`
+}
+
+func (c *DeliveryCounts) add(status string, n int) {
+	switch status {
+	case MessageSent:
+		c.Sent += n
+	case MessageDelivered:
+		c.Delivered += n
+	case MessageBounced:
+		c.Bounced += n
+	case MessageFailed:
+		c.Failed += n
+	}
+}
+
+// TemplateAnalytics is a template's delivery record. DeliveryRate is delivered over
+// sent, and zero before anything has been sent.
+type TemplateAnalytics struct {
+	TemplateID   string                    `json:"template_id"`
+	Channel      string                    `json:"channel"`
+	Totals       DeliveryCounts            `json:"totals"`
+	ByVersion    map[string]DeliveryCounts `json:"by_version"`
+	ByLocale     map[string]DeliveryCounts `json:"by_locale"`
+	DeliveryRate float64                   `json:"delivery_rate"`
+	Segments     int                       `json:"segments,omitempty"`
+	LastSentAt   *time.Time                `json:"last_sent_at,omitempty"`
+}
+
+// templateStats accumulates a template's analytics as messages are sent and reported
+type templateStats struct {
+	totals     DeliveryCounts
+	byVersion  map[int]*DeliveryCounts
+	byLocale   map[string]*DeliveryCounts
+	segments   int
+	lastSentAt time.Time
+}
+
+func (st *templateStats) add(version int, locale, status string, n int) {
+	st.totals.add(status, n)
+	if st.byVersion[version] == nil {
+		st.byVersion[version] = &DeliveryCounts{}
+	}
+	st.byVersion[version].add(status, n)
+	if st.byLocale[locale] == nil {
+		st.byLocale[locale] = &DeliveryCounts{}
+	}
+	st.byLocale[locale].add(status, n)
+}
+
+// SendRequest sends a template to one recipient: an email address or an E.164 phone
+// number depending on the template's channel
+type SendRequest struct {
+	To        string                 `json:"to"`
+	Version   int                    `json:"version,omitempty"`
+	Locale    string                 `json:"locale,omitempty"`
+	Variables map[string]interface{} `json:"variables"`
+	// Tenant picks the business calendar the message waits for; see Send
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// validRecipient checks a recipient address for a channel
+func validRecipient(channel, to string) bool {
+	if channel == ChannelSMS {
+		return e164Pattern.MatchString(to)
+	}
+	local, domain, ok := strings.Cut(to, "@")
+	return ok && local != "" && strings.Contains(domain, ".") && !strings.ContainsAny(to, " \t\r\n")
+}
+
+// Send renders a template for a recipient and hands it to the notification service.
+// Messages the service refuses are recorded as failed and returned with the error.
+// Outside the tenant's business hours the message is held and returned as scheduled,
+// except receipts, which confirm something the patient has just done.
+func (s *TemplateStore) Send(ctx context.Context, id string, req SendRequest) (Message, error) {
+	if s.sender == nil {
+		return Message{}, errors.New("notification service is not configured")
+	}
+	t, err := s.Get(id)
+	if err != nil {
+		return Message{}, err
+	}
+	if !validRecipient(t.Channel, req.To) {
+		if t.Channel == ChannelSMS {
+			return Message{}, &TemplateError{Problems: []string{"to must be an E.164 phone number, e.g. +15551234567"}}
+		}
+		return Message{}, &TemplateError{Problems: []string{"to must be an email address"}}
+	}
+	rendered, err := s.Render(id, req.Version, req.Locale, req.Variables, false)
+	if err != nil {
+		return Message{}, err
+	}
+
+	s.mu.Lock()
+	s.seq++
+	msg := Message{
+		ID:         fmt.Sprintf("MSG-%08d", s.seq),
+		TemplateID: id,
+		Version:    rendered.Version,
+		Channel:    rendered.Channel,
+		Locale:     rendered.Locale,
+		Status:     MessageSent,
+		Segments:   rendered.Segments,
+	}
+	s.mu.Unlock()
+	notification := Notification{
+		MessageID:  msg.ID,
+		Channel:    msg.Channel,
+		To:         req.To,
+		Subject:    rendered.Subject,
+		Body:       rendered.Body,
+		TemplateID: id,
+		Version:    msg.Version,
+		Locale:     msg.Locale,
+		Category:   t.Category,
+	}
+
+	if now := s.now(); t.Category != CategoryReceipt {
+		if opens := s.calendars.For(req.Tenant).NextOpen(now); opens.After(now) {
+			return s.hold(msg, notification, opens), nil
+		}
+	}
+	return s.deliver(ctx, msg, notification)
+}
+
+// deliver tracks a message and hands it to the notification service
+func (s *TemplateStore) deliver(ctx context.Context, msg Message, notification Notification) (Message, error) {
+	// Track the message before handing it over, so a delivery report that arrives
+	// before the send returns still finds it
+	msg.Status, msg.ScheduledFor = MessageSent, nil
+	msg = s.record(msg)
+	RecordTemplateMessage(msg.TemplateID, msg.Channel, msg.Status)
+	if err := s.sender.Send(ctx, notification); err != nil {
+		if failed, updateErr := s.UpdateStatus(msg.ID, MessageFailed); updateErr == nil {
+			msg = failed
+		}
+		msg.Status = MessageFailed
+		return msg, err
+	}
+	return msg, nil
+}
+
+// hold schedules a message for delivery when its tenant's business hours begin
+func (s *TemplateStore) hold(msg Message, notification Notification, at time.Time) Message {
+	at = at.UTC()
+	msg.Status, msg.ScheduledFor = MessageScheduled, &at
+	msg.SentAt, msg.UpdatedAt = at, s.now().UTC()
+	RecordTemplateMessage(msg.TemplateID, msg.Channel, msg.Status)
+	s.schedule(at.Sub(s.now()), func() {
+		sent, err := s.deliver(context.Background(), msg, notification)
+		if err != nil {
+			log.Error().Err(err).Str("message_id", sent.ID).Str("template", sent.TemplateID).Msg("Notification service refused scheduled message")
+		}
+	})
+	return msg
+}
+
+// record tracks a newly sent message and counts it in its template's analytics
+func (s *TemplateStore) record(msg Message) Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	msg.SentAt = s.now().UTC()
+	msg.UpdatedAt = msg.SentAt
+
+	stats := s.stats[msg.TemplateID]
+	if stats == nil {
+		stats = &templateStats{byVersion: make(map[int]*DeliveryCounts), byLocale: make(map[string]*DeliveryCounts)}
+		s.stats[msg.TemplateID] = stats
+	}
+	stats.add(msg.Version, msg.Locale, MessageSent, 1)
+	stats.segments += msg.Segments
+	stats.lastSentAt = msg.SentAt
+
+	s.messages[msg.ID] = &msg
+	s.order = append(s.order, msg.ID)
+	if len(s.order) > maxTrackedMessages {
+		delete(s.messages, s.order[0])
+		s.order = s.order[1:]
+	}
+	return msg
+}
+
+// UpdateStatus applies a delivery report. A message's outcome is counted once: a
+// report for a message that is no longer "sent" only changes its status, e.g. a
+// delivered email that later bounces moves from delivered to bounced.
+func (s *TemplateStore) UpdateStatus(id, status string) (Message, error) {
+	if status != MessageDelivered && status != MessageBounced && status != MessageFailed {
+		return Message{}, &TemplateError{Problems: []string{"status must be delivered, bounced or failed"}}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	msg, ok := s.messages[id]
+	if !ok {
+		return Message{}, fmt.Errorf("%w: %s", ErrMessageNotFound, id)
+	}
+	if msg.Status == status {
+		return *msg, nil
+	}
+	stats := s.stats[msg.TemplateID]
+	if msg.Status != MessageSent {
+		stats.add(msg.Version, msg.Locale, msg.Status, -1)
+	}
+	stats.add(msg.Version, msg.Locale, status, 1)
+	msg.Status, msg.UpdatedAt = status, s.now().UTC()
+	RecordTemplateMessage(msg.TemplateID, msg.Channel, status)
+	return *msg, nil
+}
+
+// Analytics returns a template's delivery record
+func (s *TemplateStore) Analytics(id string) (TemplateAnalytics, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.templates[id]
+	if !ok {
+		return TemplateAnalytics{}, fmt.Errorf("%w: %s", ErrTemplateNotFound, id)
+	}
+	out := TemplateAnalytics{
+		TemplateID: id,
+		Channel:    t.Channel,
+		ByVersion:  map[string]DeliveryCounts{},
+		ByLocale:   map[string]DeliveryCounts{},
+	}
+	stats := s.stats[id]
+	if stats == nil {
+		return out, nil
+	}
+	out.Totals = stats.totals
+	for version, counts := range stats.byVersion {
+		out.ByVersion[fmt.Sprint(version)] = *counts
+	}
+	for locale, counts := range stats.byLocale {
+		out.ByLocale[locale] = *counts
+	}
+	if stats.totals.Sent > 0 {
+		out.DeliveryRate = float64(stats.totals.Delivered) / float64(stats.totals.Sent)
+	}
+	out.Segments = stats.segments
+	if !stats.lastSentAt.IsZero() {
+		last := stats.lastSentAt
+		out.LastSentAt = &last
+	}
+	return out, nil
+}
+
+// SendHandler handles POST /api/v1/templates/{templateID}/send. Held messages are
+// accepted like sent ones, with status scheduled.
+func (s *TemplateStore) SendHandler(w http.ResponseWriter, r *http.Request) {
+	if s.sender == nil {
+		http.Error(w, "Patient messaging is unavailable: NOTIFICATION_SERVICE_URL is not set", http.StatusServiceUnavailable)
+		return
+	}
+	var req SendRequest
+	if !decodeTemplateBody(w, r, &req) {
+		return
+	}
+	msg, err := s.Send(r.Context(), chi.URLParam(r, "templateID"), req)
+	if err == nil && msg.Status == MessageScheduled {
+		log.Info().Str("message_id", msg.ID).Str("template", msg.TemplateID).Str("tenant", req.Tenant).Time("scheduled_for", *msg.ScheduledFor).Msg("Message held until business hours")
+	}
+	if err != nil && msg.ID != "" {
+		log.Error().Err(err).Str("message_id", msg.ID).Str("template", msg.TemplateID).Msg("Notification service refused message")
+		http.Error(w, "Notification service refused message "+msg.ID, http.StatusBadGateway)
+		return
+	}
+	if err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(msg)
+}
+
+// AnalyticsHandler handles GET /api/v1/templates/{templateID}/analytics
+func (s *TemplateStore) AnalyticsHandler(w http.ResponseWriter, r *http.Request) {
+	analytics, err := s.Analytics(chi.URLParam(r, "templateID"))
+	if err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(analytics)
+}
+
+// DeliveryStatusRequest is the notification service's delivery report
+type DeliveryStatusRequest struct {
+	MessageID string `json:"message_id"`
+	Status    string `json:"status"`
+}
+
+// StatusHandler handles POST /api/v1/notifications/status
+func (s *TemplateStore) StatusHandler(w http.ResponseWriter, r *http.Request) {
+	var req DeliveryStatusRequest
+	if !decodeTemplateBody(w, r, &req) {
+		return
+	}
+	msg, err := s.UpdateStatus(req.MessageID, req.Status)
+	if errors.Is(err, ErrMessageNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(msg)
+}
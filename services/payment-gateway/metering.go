@@ -0,0 +1,376 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// anonymousClient meters requests that carry no API key
+const anonymousClient = "anonymous"
+
+// maxMeteredClients bounds how many clients are tracked. Requests from further
+// clients are metered under overflowClient until older clients age out.
+const (
+	maxMeteredClients = 1000
+	overflowClient    = "overflow"
+)
+
+// usageRetention is how far back usage can be queried
+const usageRetention = 24 * time.Hour
+
+// maxUsageTopEndpoints bounds ?top= on the usage endpoint
+const maxUsageTopEndpoints = 20
+
+// usageWindows are the selectable reporting windows and the step of the time series
+// returned for each
+var usageWindows = map[string]struct {
+	span, step time.Duration
+}{
+	"15m": {15 * time.Minute, time.Minute},
+	"1h":  {time.Hour, 5 * time.Minute},
+	"6h":  {6 * time.Hour, 30 * time.Minute},
+	"24h": {24 * time.Hour, time.Hour},
+}
+
+// unmeteredPaths are operational endpoints that are not billed to clients
+var unmeteredPaths = map[string]bool{
+	"/health":       true,
+	"/readiness":    true,
+	"/capabilities": true,
+	"/changelog":    true,
+	"/openapi.json": true,
+	"/docs":         true,
+	"/metrics":      true,
+	"/usage":        true,
+
+	"/admin/observability/spec":      true,
+	"/admin/observability/rules":     true,
+	"/admin/observability/dashboard": true,
+}
+
+// latencyBoundsMillis are the upper bounds of the latency histogram buckets; a final
+// bucket holds everything slower
+var latencyBoundsMillis = []float64{1, 2, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// latencyHistogram counts requests per latency bucket
+type latencyHistogram [14]int64
+
+func (h *latencyHistogram) observe(d time.Duration) {
+	ms := float64(d) / float64(time.Millisecond)
+	i := sort.SearchFloat64s(latencyBoundsMillis, ms)
+	h[i]++
+}
+
+func (h *latencyHistogram) add(other *latencyHistogram) {
+	for i := range h {
+		h[i] += other[i]
+	}
+}
+
+// quantile estimates a latency quantile in milliseconds by interpolating within the
+// bucket that holds it. Requests slower than the last bound report that bound.
+func (h *latencyHistogram) quantile(q float64) float64 {
+	var total int64
+	for _, n := range h {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+	rank := q * float64(total)
+	var seen int64
+	for i, n := range h {
+		if n == 0 || float64(seen+n) < rank {
+			seen += n
+			continue
+		}
+		if i == len(latencyBoundsMillis) {
+			return latencyBoundsMillis[i-1]
+		}
+		lower := 0.0
+		if i > 0 {
+			lower = latencyBoundsMillis[i-1]
+		}
+		upper := latencyBoundsMillis[i]
+		return math.Round((lower+(upper-lower)*(rank-float64(seen))/float64(n))*100) / 100
+	}
+	return latencyBoundsMillis[len(latencyBoundsMillis)-1]
+}
+
+// endpointCounters is one endpoint's usage within one minute
+type endpointCounters struct {
+	requests     int64
+	clientErrors int64
+	serverErrors int64
+	latency      latencyHistogram
+}
+
+func (c *endpointCounters) add(other *endpointCounters) {
+	c.requests += other.requests
+	c.clientErrors += other.clientErrors
+	c.serverErrors += other.serverErrors
+	c.latency.add(&other.latency)
+}
+
+// usageMinute is a client's usage within one minute, by endpoint
+type usageMinute struct {
+	start     time.Time
+	endpoints map[string]*endpointCounters
+}
+
+// UsageMeter records per-client API usage in one-minute buckets and keeps
+// usageRetention of history
+type UsageMeter struct {
+	clients map[string][]*usageMinute
+	now     func() time.Time
+	mu      sync.Mutex
+}
+
+// NewUsageMeter creates an empty meter
+func NewUsageMeter() *UsageMeter {
+	return &UsageMeter{
+		clients: make(map[string][]*usageMinute),
+		now:     time.Now,
+	}
+}
+
+// ClientIDForKey derives the client ID under which an API key's usage is metered.
+// Only a fingerprint of the key is kept, never the key itself.
+func ClientIDForKey(apiKey string) string {
+	if apiKey == "" {
+		return anonymousClient
+	}
+	sum := sha256.Sum256([]byte(apiKey))
+	return "key_" + hex.EncodeToString(sum[:8])
+}
+
+// Record meters one request
+func (m *UsageMeter) Record(clientID, endpoint string, status int, latency time.Duration) {
+	at := m.now().Truncate(time.Minute)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.expire(at)
+	if _, ok := m.clients[clientID]; !ok && len(m.clients) >= maxMeteredClients {
+		clientID = overflowClient
+	}
+	minutes := m.clients[clientID]
+	if len(minutes) == 0 || !minutes[len(minutes)-1].start.Equal(at) {
+		minutes = append(minutes, &usageMinute{start: at, endpoints: make(map[string]*endpointCounters)})
+		m.clients[clientID] = minutes
+	}
+	current := minutes[len(minutes)-1]
+
+	counters, ok := current.endpoints[endpoint]
+	if !ok {
+		counters = &endpointCounters{}
+		current.endpoints[endpoint] = counters
+	}
+	counters.requests++
+	switch {
+	case status >= 500:
+		counters.serverErrors++
+	case status >= 400:
+		counters.clientErrors++
+	}
+	counters.latency.observe(latency)
+}
+
+// expire drops minutes older than the retention period. Callers hold m.mu.
+func (m *UsageMeter) expire(now time.Time) {
+	cutoff := now.Add(-usageRetention)
+	for clientID, minutes := range m.clients {
+		i := 0
+		for i < len(minutes) && !minutes[i].start.After(cutoff) {
+			i++
+		}
+		if i == len(minutes) {
+			delete(m.clients, clientID)
+		} else if i > 0 {
+			m.clients[clientID] = minutes[i:]
+		}
+	}
+}
+
+// LatencySummary holds latency percentiles in milliseconds
+type LatencySummary struct {
+	P50 float64 `json:"p50"`
+	P95 float64 `json:"p95"`
+	P99 float64 `json:"p99"`
+}
+
+// UsageStats are request counts, error rate and latency over a period
+type UsageStats struct {
+	Requests     int64          `json:"requests"`
+	Errors       int64          `json:"errors"`
+	ClientErrors int64          `json:"client_errors"`
+	ServerErrors int64          `json:"server_errors"`
+	ErrorRate    float64        `json:"error_rate"`
+	LatencyMs    LatencySummary `json:"latency_ms"`
+}
+
+func newUsageStats(c *endpointCounters) UsageStats {
+	stats := UsageStats{
+		Requests:     c.requests,
+		Errors:       c.clientErrors + c.serverErrors,
+		ClientErrors: c.clientErrors,
+		ServerErrors: c.serverErrors,
+		LatencyMs: LatencySummary{
+			P50: c.latency.quantile(0.50),
+			P95: c.latency.quantile(0.95),
+			P99: c.latency.quantile(0.99),
+		},
+	}
+	if stats.Requests > 0 {
+		stats.ErrorRate = math.Round(float64(stats.Errors)/float64(stats.Requests)*10000) / 10000
+	}
+	return stats
+}
+
+// EndpointUsage is one endpoint's share of a client's usage
+type EndpointUsage struct {
+	Endpoint string `json:"endpoint"`
+	UsageStats
+}
+
+// UsagePoint is a client's usage within one step of the time series
+type UsagePoint struct {
+	Start    time.Time `json:"start"`
+	Requests int64     `json:"requests"`
+	Errors   int64     `json:"errors"`
+}
+
+// UsageReport is a client's API usage over a window
+type UsageReport struct {
+	ClientID string    `json:"client_id"`
+	Window   string    `json:"window"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	UsageStats
+	TopEndpoints []EndpointUsage `json:"top_endpoints"`
+	Series       []UsagePoint    `json:"series"`
+}
+
+// Report summarizes a client's usage over one of usageWindows, listing the top
+// endpoints by request count
+func (m *UsageMeter) Report(clientID, window string, top int) (UsageReport, bool) {
+	w, ok := usageWindows[window]
+	if !ok {
+		return UsageReport{}, false
+	}
+	to := m.now()
+	from := to.Truncate(time.Minute).Add(-w.span + time.Minute)
+	report := UsageReport{
+		ClientID:     clientID,
+		Window:       window,
+		From:         from,
+		To:           to,
+		TopEndpoints: make([]EndpointUsage, 0),
+		Series:       make([]UsagePoint, int(w.span/w.step)),
+	}
+	for i := range report.Series {
+		report.Series[i].Start = from.Add(time.Duration(i) * w.step)
+	}
+
+	total := &endpointCounters{}
+	byEndpoint := make(map[string]*endpointCounters)
+
+	m.mu.Lock()
+	for _, minute := range m.clients[clientID] {
+		if minute.start.Before(from) {
+			continue
+		}
+		point := &report.Series[int(minute.start.Sub(from)/w.step)]
+		for endpoint, counters := range minute.endpoints {
+			total.add(counters)
+			if byEndpoint[endpoint] == nil {
+				byEndpoint[endpoint] = &endpointCounters{}
+			}
+			byEndpoint[endpoint].add(counters)
+			point.Requests += counters.requests
+			point.Errors += counters.clientErrors + counters.serverErrors
+		}
+	}
+	m.mu.Unlock()
+
+	report.UsageStats = newUsageStats(total)
+	for endpoint, counters := range byEndpoint {
+		report.TopEndpoints = append(report.TopEndpoints, EndpointUsage{Endpoint: endpoint, UsageStats: newUsageStats(counters)})
+	}
+	sort.Slice(report.TopEndpoints, func(i, j int) bool {
+		a, b := report.TopEndpoints[i], report.TopEndpoints[j]
+		if a.Requests != b.Requests {
+			return a.Requests > b.Requests
+		}
+		return a.Endpoint < b.Endpoint
+	})
+	if len(report.TopEndpoints) > top {
+		report.TopEndpoints = report.TopEndpoints[:top]
+	}
+	return report, true
+}
+
+// Middleware meters every request except the operational endpoints. Clients are
+// identified by a fingerprint of their X-API-Key and endpoints by their route
+// pattern, so path parameters do not fragment the counts.
+func (m *UsageMeter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if unmeteredPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		rw := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+
+		next.ServeHTTP(rw, r)
+
+		endpoint := r.Method + " unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			endpoint = r.Method + " " + rctx.RoutePattern()
+		}
+		m.Record(ClientIDForKey(r.Header.Get("X-API-Key")), endpoint, rw.statusCode, time.Since(start))
+	})
+}
+
+// UsageHandler returns the calling client's own usage. Supports ?window=15m|1h|6h|24h
+// (default 1h) and ?top= (default 5, at most 20) endpoints.
+func (m *UsageMeter) UsageHandler(w http.ResponseWriter, r *http.Request) {
+	apiKey := r.Header.Get("X-API-Key")
+	if apiKey == "" {
+		http.Error(w, "X-API-Key header required", http.StatusUnauthorized)
+		return
+	}
+
+	window := r.URL.Query().Get("window")
+	if window == "" {
+		window = "1h"
+	}
+	top := 5
+	if value := r.URL.Query().Get("top"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxUsageTopEndpoints {
+			http.Error(w, fmt.Sprintf("top must be between 1 and %d", maxUsageTopEndpoints), http.StatusBadRequest)
+			return
+		}
+		top = n
+	}
+
+	report, ok := m.Report(ClientIDForKey(apiKey), window, top)
+	if !ok {
+		http.Error(w, "window must be one of 15m, 1h, 6h, 24h", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(report)
+}
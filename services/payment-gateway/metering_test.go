@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestUsageMeterReport(t *testing.T) {
+	m := NewUsageMeter()
+	now := time.Date(2025, 4, 23, 9, 30, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+
+	client := ClientIDForKey("integrator-key")
+	for i := 0; i < 8; i++ {
+		m.Record(client, "POST /charge", http.StatusOK, 20*time.Millisecond)
+	}
+	m.Record(client, "POST /charge", http.StatusBadRequest, 5*time.Millisecond)
+	m.Record(client, "POST /process", http.StatusInternalServerError, 400*time.Millisecond)
+	m.Record(ClientIDForKey("other-key"), "POST /charge", http.StatusOK, time.Millisecond)
+
+	// Two hours ago: inside the 24h window only
+	now = now.Add(-2 * time.Hour)
+	m.Record(client, "GET /audit/trail", http.StatusOK, time.Millisecond)
+	now = now.Add(2 * time.Hour)
+
+	report, ok := m.Report(client, "1h", 5)
+	if !ok {
+		t.Fatal("expected 1h to be a valid window")
+	}
+	if report.Requests != 10 || report.ClientErrors != 1 || report.ServerErrors != 1 {
+		t.Fatalf("unexpected totals: %+v", report.UsageStats)
+	}
+	if report.ErrorRate != 0.2 {
+		t.Fatalf("expected error rate 0.2, got %v", report.ErrorRate)
+	}
+	if report.LatencyMs.P50 <= 10 || report.LatencyMs.P50 > 25 {
+		t.Fatalf("expected p50 in the 10-25ms bucket, got %v", report.LatencyMs.P50)
+	}
+	if report.LatencyMs.P99 <= 250 {
+		t.Fatalf("expected p99 to reflect the slow request, got %v", report.LatencyMs.P99)
+	}
+	if len(report.TopEndpoints) != 2 || report.TopEndpoints[0].Endpoint != "POST /charge" || report.TopEndpoints[0].Requests != 9 {
+		t.Fatalf("unexpected top endpoints: %+v", report.TopEndpoints)
+	}
+	if len(report.Series) != 12 || report.Series[11].Requests != 10 || report.Series[11].Errors != 2 {
+		t.Fatalf("unexpected series: %+v", report.Series)
+	}
+
+	day, _ := m.Report(client, "24h", 1)
+	if day.Requests != 11 || len(day.TopEndpoints) != 1 {
+		t.Fatalf("expected 11 requests and one endpoint over 24h, got %d and %d", day.Requests, len(day.TopEndpoints))
+	}
+
+	if _, ok := m.Report(client, "7d", 5); ok {
+		t.Fatal("expected 7d to be rejected")
+	}
+
+	// Usage ages out after the retention period
+	now = now.Add(usageRetention + time.Minute)
+	m.Record(ClientIDForKey("other-key"), "POST /charge", http.StatusOK, time.Millisecond)
+	if expired, _ := m.Report(client, "24h", 5); expired.Requests != 0 {
+		t.Fatalf("expected expired usage to be dropped, got %d requests", expired.Requests)
+	}
+}
+
+func TestUsageMiddlewareAndHandler(t *testing.T) {
+	m := NewUsageMeter()
+	router := chi.NewRouter()
+	router.Use(m.Middleware)
+	router.Post("/charge", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusPaymentRequired)
+	})
+	router.Get("/health", func(w http.ResponseWriter, r *http.Request) {})
+	router.Get("/usage", m.UsageHandler)
+
+	for _, path := range []string{"/charge", "/health", "/nope"} {
+		method := http.MethodPost
+		if path == "/health" {
+			method = http.MethodGet
+		}
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("X-API-Key", "integrator-key")
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/usage", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without an API key, got %d", w.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/usage?window=15m", nil)
+	req.Header.Set("X-API-Key", "integrator-key")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var report UsageReport
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if report.ClientID != ClientIDForKey("integrator-key") || report.Requests != 2 || report.ClientErrors != 2 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if report.TopEndpoints[0].Endpoint != "POST /charge" || report.TopEndpoints[1].Endpoint != "POST unmatched" {
+		t.Fatalf("unexpected endpoints: %+v", report.TopEndpoints)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/usage?window=2h", nil)
+	req.Header.Set("X-API-Key", "integrator-key")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown window, got %d", w.Code)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/healthcare-gitops/common/tlsconfig"
 	"github.com/rs/zerolog/log"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
@@ -71,14 +72,17 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 		// Create response writer wrapper
 		rw := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
 
-		// Log request
-		log.Info().
+		// Log request, with the client certificate's identity under mutual TLS
+		requestEvent := log.Info().
 			Str("request_id", requestID).
 			Str("method", r.Method).
 			Str("path", r.URL.Path).
 			Str("remote_addr", r.RemoteAddr).
-			Str("user_agent", r.UserAgent()).
-			Msg("Incoming request")
+			Str("user_agent", r.UserAgent())
+		if id, ok := tlsconfig.FromContext(r.Context()); ok {
+			requestEvent = requestEvent.Str("client_cert", id.Name())
+		}
+		requestEvent.Msg("Incoming request")
 
 		// Call next handler
 		next.ServeHTTP(rw, r)
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/healthcare-gitops/common/tlsconfig"
+	"github.com/rs/zerolog/log"
+)
+
+// testPKI issues certificates from a throwaway CA, written as PEM files under dir
+type testPKI struct {
+	t      *testing.T
+	dir    string
+	ca     *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+	caFile string
+	serial int64
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test internal CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(der)
+	p := &testPKI{t: t, dir: t.TempDir(), ca: ca, caKey: key, serial: 1}
+	p.caFile = p.write("ca.pem", "CERTIFICATE", der)
+	return p
+}
+
+func (p *testPKI) write(name, block string, der []byte) string {
+	path := filepath.Join(p.dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: block, Bytes: der}), 0o600); err != nil {
+		p.t.Fatal(err)
+	}
+	return path
+}
+
+// issue returns the certificate and key files of a leaf named by name and, when set,
+// a URI SAN
+func (p *testPKI) issue(name, uri string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	p.serial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(p.serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if uri != "" {
+		u, _ := url.Parse(uri)
+		template.URIs = []*url.URL{u}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, p.ca, &key.PublicKey, p.caKey)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	return p.write(name+".pem", "CERTIFICATE", der), p.write(name+"-key.pem", "EC PRIVATE KEY", keyDER)
+}
+
+// lockedBuffer collects log lines written while the server is still handling requests
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// TestMutualTLS tests that the server only accepts allowed clients holding a
+// certificate from the internal CA, and logs the client's identity
+func TestMutualTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	serverCert, serverKey := pki.issue("payment-gateway", "")
+	phiCert, phiKey := pki.issue("phi-service", "spiffe://healthcare.local/phi-service")
+	rogueCert, rogueKey := pki.issue("reporting", "spiffe://healthcare.local/reporting")
+
+	cfg := Config{Port: "0", ServiceName: "payment-gateway", MaxProcessingMillis: 50, TLS: tlsconfig.Config{
+		CertFile:       serverCert,
+		KeyFile:        serverKey,
+		ClientCAFile:   pki.caFile,
+		ClientAuth:     tlsconfig.ClientAuthRequire,
+		AllowedClients: []string{"spiffe://healthcare.local/phi-service"},
+	}}
+	// Served as ListenAndServe does, since httptest.Server would add its own certificate
+	srv := NewServer(cfg)
+	serverTLS, err := cfg.TLS.Server()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.TLSConfig = serverTLS
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeTLS(ln, "", "")
+	defer srv.Close()
+	baseURL := "https://" + ln.Addr().String()
+
+	logs := &lockedBuffer{}
+	previous := log.Logger
+	log.Logger = log.Output(logs)
+	defer func() { log.Logger = previous }()
+
+	// A client with no certificate to present that still trusts the internal CA
+	roots := x509.NewCertPool()
+	roots.AddCert(pki.ca)
+	get := func(cert, key string) (*http.Response, error) {
+		client := &http.Client{Timeout: 5 * time.Second, Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+		if cert != "" {
+			var err error
+			if client, err = (tlsconfig.Config{CertFile: cert, KeyFile: key, ClientCAFile: pki.caFile}).HTTPClient(5 * time.Second); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return client.Get(baseURL + "/health")
+	}
+
+	resp, err := get(phiCert, phiKey)
+	if err != nil {
+		t.Fatalf("allowed client rejected: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if !strings.Contains(logs.String(), `"client_cert":"spiffe://healthcare.local/phi-service"`) {
+		t.Fatalf("expected the client identity in the request log, got %s", logs.String())
+	}
+
+	if resp, err := get(rogueCert, rogueKey); err == nil {
+		resp.Body.Close()
+		t.Fatal("expected a client outside TLS_ALLOWED_CLIENTS to be rejected")
+	}
+	if resp, err := get("", ""); err == nil {
+		resp.Body.Close()
+		t.Fatal("expected a client without a certificate to be rejected")
+	}
+}
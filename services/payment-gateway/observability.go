@@ -0,0 +1,70 @@
+package main
+
+import (
+	"github.com/healthcare-gitops/common/observability"
+)
+
+// observabilitySpec declares the metrics this service exports and its SLOs. Alerting
+// rules and the Grafana dashboard are generated from it (see observability/generated);
+// TestObservabilitySpec fails when it disagrees with the registered metrics or the
+// committed output.
+var observabilitySpec = observability.Spec{
+	Service: "payment-gateway",
+	Team:    "engineering",
+	Metrics: []observability.Metric{
+		{Name: "payment_gateway_request_duration_seconds", Type: observability.Histogram, Help: "HTTP request duration in seconds", Labels: []string{"method", "path", "status"}, GroupBy: "path"},
+		{Name: "payment_gateway_requests_total", Type: observability.Counter, Help: "Total number of HTTP requests", Labels: []string{"method", "path", "status"}, GroupBy: "status"},
+		{Name: "payment_gateway_active_requests", Type: observability.Gauge, Help: "Number of active HTTP requests"},
+		{Name: "payment_gateway_transactions_total", Type: observability.Counter, Help: "Total number of payment transactions", Labels: []string{"status", "compliance_type"}, GroupBy: "status"},
+		{Name: "payment_gateway_processing_duration_seconds", Type: observability.Histogram, Help: "Payment processing duration in seconds", Labels: []string{"status"}},
+		{Name: "payment_gateway_api_version_requests_total", Type: observability.Counter, Help: "Total number of API requests by API version and endpoint", Labels: []string{"version", "endpoint"}, GroupBy: "version"},
+		{Name: "payment_gateway_transaction_searches_total", Type: observability.Counter, Help: "Total number of transaction searches and exports", Labels: []string{"kind"}, GroupBy: "kind"},
+		{Name: "payment_gateway_transaction_search_results", Type: observability.Histogram, Help: "Transactions returned per search or export", Labels: []string{"kind"}, GroupBy: "kind"},
+		{Name: "payment_gateway_template_messages_total", Type: observability.Counter, Help: "Total number of patient messages by template, channel and delivery status", Labels: []string{"template", "channel", "status"}, GroupBy: "status"},
+		{Name: "payment_gateway_auth_cache_lookups_total", Type: observability.Counter, Help: "Total number of token introspection cache lookups by result", Labels: []string{"result"}, GroupBy: "result"},
+		{Name: "payment_gateway_honeytoken_alerts_total", Type: observability.Counter, Help: "Total number of decoy transaction reads by action", Labels: []string{"action"}, GroupBy: "action"},
+		{Name: "payment_gateway_failover_role", Type: observability.Gauge, Help: "1 for the replica's current failover role, 0 otherwise", Labels: []string{"role"}, GroupBy: "role"},
+		{Name: "payment_gateway_failover_epoch", Type: observability.Gauge, Help: "Fencing epoch the replica holds"},
+		{Name: "payment_gateway_failover_transitions_total", Type: observability.Counter, Help: "Total number of failover role changes by new role and reason", Labels: []string{"role", "reason"}, GroupBy: "reason"},
+		{Name: "payment_gateway_failover_peer_checks_total", Type: observability.Counter, Help: "Total number of peer health checks by result", Labels: []string{"result"}, GroupBy: "result"},
+		{Name: "payment_gateway_failover_replicated_transactions_total", Type: observability.Counter, Help: "Total number of transactions a standby copied from the active"},
+		{Name: "payment_gateway_transaction_changes_total", Type: observability.Counter, Help: "Total number of captures, refunds, voids and approvals by result", Labels: []string{"change", "result"}, GroupBy: "change"},
+		{Name: "payment_gateway_refunds_total", Type: observability.Counter, Help: "Total number of refunds by kind and currency", Labels: []string{"kind", "currency"}, GroupBy: "kind"},
+		{Name: "payment_gateway_refunded_amount_minor_total", Type: observability.Counter, Help: "Total amount refunded in minor currency units by currency", Labels: []string{"currency"}, GroupBy: "currency"},
+		{Name: "payment_gateway_processor_requests_total", Type: observability.Counter, Help: "Total number of payment processor requests by processor, operation and result", Labels: []string{"processor", "operation", "result"}, GroupBy: "result"},
+		{Name: "payment_gateway_processor_request_duration_seconds", Type: observability.Histogram, Help: "Payment processor request duration in seconds", Labels: []string{"processor", "operation"}, GroupBy: "operation"},
+		{Name: "payment_gateway_claims_total", Type: observability.Counter, Help: "Total number of insurance claim status changes by new status", Labels: []string{"status"}, GroupBy: "status"},
+		{Name: "payment_gateway_claim_paid_amount_minor_total", Type: observability.Counter, Help: "Total amount insurers paid on claims in minor currency units by currency", Labels: []string{"currency"}, GroupBy: "currency"},
+		{Name: "payment_gateway_remittances_total", Type: observability.Counter, Help: "Total number of 835 remittances received by result", Labels: []string{"result"}, GroupBy: "result"},
+		{Name: "payment_gateway_webhook_deliveries_total", Type: observability.Counter, Help: "Total number of webhook event deliveries by event type and result", Labels: []string{"event", "result"}, GroupBy: "result"},
+		{Name: "payment_gateway_webhook_attempts_total", Type: observability.Counter, Help: "Total number of webhook HTTP attempts by result", Labels: []string{"result"}, GroupBy: "result"},
+		{Name: "payment_gateway_webhook_delivery_duration_seconds", Type: observability.Histogram, Help: "Time from a webhook delivery's first attempt to its final result"},
+		{Name: "payment_gateway_webhook_dead_letters", Type: observability.Gauge, Help: "Webhook deliveries waiting in the dead-letter queue"},
+		{Name: "payment_gateway_exchange_rate_lookups_total", Type: observability.Counter, Help: "Total number of exchange rate lookups by source and result", Labels: []string{"source", "result"}, GroupBy: "result"},
+		{Name: "payment_gateway_risk_decisions_total", Type: observability.Counter, Help: "Total number of payment risk decisions by scorer and decision", Labels: []string{"scorer", "decision"}, GroupBy: "decision"},
+		{Name: "payment_gateway_risk_scores", Type: observability.Histogram, Help: "Risk scores of payments assessed before authorization", Labels: []string{"scorer"}},
+		{Name: "payment_gateway_settlement_imports_total", Type: observability.Counter, Help: "Total number of processor settlement file imports by result", Labels: []string{"result"}, GroupBy: "result"},
+		{Name: "payment_gateway_reconciliation_reports_total", Type: observability.Counter, Help: "Total number of daily reconciliation reports by status", Labels: []string{"status"}, GroupBy: "status"},
+		{Name: "payment_gateway_card_tokenizations_total", Type: observability.Counter, Help: "Total number of card tokenizations by tokenizer and result", Labels: []string{"tokenizer", "result"}, GroupBy: "result"},
+		{Name: "payment_gateway_sox_audit_failures_total", Type: observability.Counter, Help: "Total number of SOX audit records that could not be written"},
+		{Name: "payment_gateway_circuit_breaker_state", Type: observability.Gauge, Help: "State of the circuit breaker guarding calls to a dependency: 0 closed, 1 half-open, 2 open", Labels: []string{"dependency"}, GroupBy: "dependency"},
+	},
+	SLOs: []observability.SLO{
+		{
+			Name:        "availability",
+			Description: "Payment API requests served without a server error",
+			Objective:   0.999,
+			Metric:      "payment_gateway_requests_total",
+			Filter:      `path=~"/api/.*|/process|/charge"`,
+			ErrorFilter: `status=~"Internal Server Error|Bad Gateway|Service Unavailable|Gateway Timeout"`,
+		},
+		{
+			Name:             "processing-latency",
+			Description:      "Successful payments processed within 500ms",
+			Objective:        0.99,
+			Metric:           "payment_gateway_processing_duration_seconds",
+			Filter:           `status="success"`,
+			LatencyThreshold: 0.5,
+		},
+	},
+}
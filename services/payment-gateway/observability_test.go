@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/healthcare-gitops/common/observability"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var updateObservability = flag.Bool("update", false, "rewrite observability/generated/payment-gateway from observabilitySpec")
+
+const generatedObservabilityDir = "../../observability/generated/payment-gateway"
+
+// describeRegistered reports whether m is registered with the default registry under the
+// same help and labels: registering an identical collector fails with
+// AlreadyRegisteredError, any other difference fails with a descriptor conflict
+func describeRegistered(m observability.Metric) error {
+	var c prometheus.Collector
+	switch m.Type {
+	case observability.Counter:
+		c = prometheus.NewCounterVec(prometheus.CounterOpts{Name: m.Name, Help: m.Help}, m.Labels)
+	case observability.Gauge:
+		c = prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: m.Name, Help: m.Help}, m.Labels)
+	case observability.Histogram:
+		c = prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: m.Name, Help: m.Help}, m.Labels)
+	}
+	err := prometheus.Register(c)
+	if err == nil {
+		prometheus.Unregister(c)
+		return errors.New("declared but not registered")
+	}
+	var already prometheus.AlreadyRegisteredError
+	if errors.As(err, &already) {
+		return nil
+	}
+	return err
+}
+
+// exportedMetrics lists the service's metric families and fails on any whose type
+// differs from the declared one
+func exportedMetrics(t *testing.T, prefix string) []string {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather metrics: %v", err)
+	}
+	var names []string
+	for _, family := range families {
+		if !strings.HasPrefix(family.GetName(), prefix) {
+			continue
+		}
+		names = append(names, family.GetName())
+		registered := strings.ToLower(family.GetType().String())
+		if m, ok := observabilitySpec.Metric(family.GetName()); ok && registered != m.Type {
+			t.Errorf("%s is declared as a %s but registered as a %s", m.Name, m.Type, registered)
+		}
+	}
+	return names
+}
+
+// TestObservabilitySpec verifies the declared metrics match the registered ones and the
+// committed rules and dashboard are generated from the current spec. Run
+// go test -run TestObservabilitySpec -update to regenerate them.
+func TestObservabilitySpec(t *testing.T) {
+	// Observe every labelled metric so it shows up in the gathered families
+	requestDuration.WithLabelValues("GET", "/test", "OK").Observe(0)
+	requestCount.WithLabelValues("GET", "/test", "OK").Add(0)
+	paymentTransactions.WithLabelValues("success", "test").Add(0)
+	paymentProcessingDuration.WithLabelValues("success").Observe(0)
+	apiVersionRequests.WithLabelValues("test", "/test").Add(0)
+	transactionSearches.WithLabelValues("test").Add(0)
+	transactionSearchResults.WithLabelValues("test").Observe(0)
+
+	if err := observabilitySpec.Validate(); err != nil {
+		t.Fatalf("invalid spec: %v", err)
+	}
+	if err := observabilitySpec.CheckRegistered(describeRegistered, exportedMetrics(t, "payment_gateway_")); err != nil {
+		t.Errorf("spec does not match registered metrics: %v", err)
+	}
+
+	if *updateObservability {
+		if err := observability.Write(generatedObservabilityDir, observabilitySpec); err != nil {
+			t.Fatalf("failed to write generated files: %v", err)
+		}
+	}
+	if err := observability.Check(generatedObservabilityDir, observabilitySpec); err != nil {
+		t.Errorf("%v; run go test -run TestObservabilitySpec -update", err)
+	}
+}
+
+// TestObservabilityEndpoint verifies the admin endpoint serves the spec and its output
+func TestObservabilityEndpoint(t *testing.T) {
+	server := httptest.NewServer(NewServer(Config{Port: "0", ServiceName: "payment-gateway", MaxProcessingMillis: 50}).Handler)
+	defer server.Close()
+
+	for _, tc := range []struct {
+		path        string
+		contentType string
+		contains    string
+	}{
+		{"/admin/observability/spec", "application/json", `"service":"payment-gateway"`},
+		{"/admin/observability/rules", "application/yaml", "PaymentGatewayAvailabilityErrorBudgetBurn"},
+		{"/admin/observability/dashboard", "application/json", `"uid": "payment-gateway-generated"`},
+	} {
+		resp, err := http.Get(server.URL + tc.path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", tc.path, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Errorf("GET %s returned %d", tc.path, resp.StatusCode)
+		}
+		if got := resp.Header.Get("Content-Type"); got != tc.contentType {
+			t.Errorf("GET %s content type = %q, want %q", tc.path, got, tc.contentType)
+		}
+		if !strings.Contains(string(body), tc.contains) {
+			t.Errorf("GET %s does not contain %s", tc.path, tc.contains)
+		}
+	}
+
+	resp, err := http.Get(server.URL + "/admin/observability/unknown")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown artifact returned %d, want 404", resp.StatusCode)
+	}
+}
+
+// TestObservabilityEndpointRequiresAdmin verifies the artifacts are served only to
+// admin tokens once auth-service is configured
+func TestObservabilityEndpointRequiresAdmin(t *testing.T) {
+	h := newAuthenticatedServer(t)
+	for token, want := range map[string]int{"": http.StatusUnauthorized, "reader": http.StatusForbidden, "admin": http.StatusOK} {
+		req := httptest.NewRequest(http.MethodGet, "/admin/observability/spec", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if rr.Code != want {
+			t.Errorf("observability spec with %q: expected %d, got %d", token, want, rr.Code)
+		}
+	}
+}
@@ -1,10 +1,17 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"time"
 )
 
+// Payment validation errors
+var (
+	ErrInvalidAmount = errors.New("invalid amount")
+	ErrMissingFields = errors.New("missing required fields")
+)
+
 type PaymentRequest struct {
 	// Dual support: tests may send `amount` while service prefers cents.
 	Amount      float64 `json:"amount,omitempty"`
@@ -16,6 +23,10 @@ type PaymentRequest struct {
 	PatientID   string `json:"patient_id,omitempty"`
 	DeviceID    string `json:"device_id,omitempty"`
 	Description string `json:"description,omitempty"`
+	// Card is the card paid with, exchanged for CardToken before the payment is
+	// processed, so processors only ever see the token
+	Card      *CardDetails `json:"card,omitempty"`
+	CardToken *CardToken   `json:"-"`
 }
 
 type PaymentResponse struct {
@@ -26,30 +37,13 @@ type PaymentResponse struct {
 	// Audit + tracing for compliance endpoints
 	TransactionID string `json:"transaction_id,omitempty"`
 	AuditID       string `json:"audit_id,omitempty"`
+	// Card is the token that replaced the payment's card details
+	Card *CardToken `json:"card,omitempty"`
 }
 
-// ProcessPayment simulates payment authorization.
-// In a real system, this would call PSPs, fraud checks, ledgers, etc.
+// ProcessPayment authorizes a payment with the sandbox processor, which simulates
+// approval. The gateway authorizes through the configured PaymentProcessor.
 func ProcessPayment(req PaymentRequest, maxLatency time.Duration) (PaymentResponse, error) {
-	if req.AmountCents <= 0 {
-		return PaymentResponse{}, errors.New("invalid amount")
-	}
-	if req.Currency == "" || req.CustomerID == "" || req.Method == "" {
-		return PaymentResponse{}, errors.New("missing required fields")
-	}
-
-	// Simulate processing time (bounded by maxLatency)
-	sleep := maxLatency / 4
-	if sleep <= 0 {
-		sleep = 10 * time.Millisecond
-	}
-	time.Sleep(sleep)
-
-	resp := PaymentResponse{
-		Status:      "authorized",
-		AuthCode:    "AUTH-" + time.Now().Format("150405"),
-		ProcessedAt: time.Now().Unix(),
-		HighValue:   req.AmountCents >= 10000, // Set high-value flag for amounts >= $100
-	}
-	return resp, nil
+	resp, _, err := processPayment(context.Background(), newSandboxProcessor(maxLatency), generateTransactionID(), req)
+	return resp, err
 }
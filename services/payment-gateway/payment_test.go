@@ -6,6 +6,8 @@ import (
 	"net/http/httptest"
 	"testing"
 	"time"
+
+	"github.com/healthcare-gitops/common/compliance"
 )
 
 func TestProcessPayment_Success(t *testing.T) {
@@ -76,7 +78,7 @@ func TestMetricsAndComplianceEndpoints(t *testing.T) {
 	t.Run("compliance", func(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/compliance/status", nil)
 		rr := httptest.NewRecorder()
-		h.ComplianceStatusHandler(rr, req)
+		compliance.Handler(func(*http.Request) compliance.Status { return complianceStatus(h, false) })(rr, req)
 		if rr.Code != http.StatusOK {
 			t.Fatalf("compliance expected 200, got %d", rr.Code)
 		}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	// pgx is the driver DATABASE_DRIVER and AUDIT_DATABASE_DRIVER name by default
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// postgresSchema creates the transactions table. The full record is kept as JSON so
+// new Transaction fields need no migration; the filtered columns are broken out and
+// indexed.
+const postgresSchema = `
+CREATE TABLE IF NOT EXISTS payment_transactions (
+	id           TEXT PRIMARY KEY,
+	patient_id   TEXT NOT NULL DEFAULT '',
+	status       TEXT NOT NULL,
+	processed_at TIMESTAMPTZ NOT NULL,
+	record       JSONB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS payment_transactions_processed_idx ON payment_transactions (processed_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS payment_transactions_patient_idx ON payment_transactions (patient_id, processed_at DESC);
+CREATE TABLE IF NOT EXISTS failover_fence (
+	id     INT PRIMARY KEY CHECK (id = 1),
+	epoch  BIGINT NOT NULL,
+	holder TEXT NOT NULL
+);
+INSERT INTO failover_fence (id, epoch, holder) VALUES (1, 0, '') ON CONFLICT (id) DO NOTHING;
+`
+
+// postgresRepository stores transactions in Postgres through database/sql. The driver
+// is registered under DATABASE_DRIVER by the build, as pgx's stdlib package registers
+// "pgx".
+type postgresRepository struct {
+	db *sql.DB
+}
+
+// openPostgresRepository connects and creates the schema if it is missing
+func openPostgresRepository(ctx context.Context, driver, url string) (*postgresRepository, error) {
+	db, err := sql.Open(driver, url)
+	if err != nil {
+		return nil, fmt.Errorf("open transaction database: %w", err)
+	}
+	db.SetMaxOpenConns(20)
+	db.SetConnMaxIdleTime(5 * time.Minute)
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connect to transaction database: %w", err)
+	}
+	if _, err := db.ExecContext(ctx, postgresSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create transaction schema: %w", err)
+	}
+	return &postgresRepository{db: db}, nil
+}
+
+// execer is a *sql.DB or *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func (p *postgresRepository) Save(ctx context.Context, txn Transaction) error {
+	return saveTransaction(ctx, p.db, txn)
+}
+
+func saveTransaction(ctx context.Context, db execer, txn Transaction) error {
+	record, err := json.Marshal(txn)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO payment_transactions (id, patient_id, status, processed_at, record)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (id) DO UPDATE SET
+			patient_id = EXCLUDED.patient_id, status = EXCLUDED.status,
+			processed_at = EXCLUDED.processed_at, record = EXCLUDED.record`,
+		txn.ID, txn.PatientID, txn.Status, txn.ProcessedAt, record)
+	return err
+}
+
+func (p *postgresRepository) Get(ctx context.Context, id string) (Transaction, error) {
+	var record []byte
+	err := p.db.QueryRowContext(ctx, `SELECT record FROM payment_transactions WHERE id = $1`, id).Scan(&record)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Transaction{}, ErrTransactionNotFound
+	}
+	if err != nil {
+		return Transaction{}, err
+	}
+	var txn Transaction
+	err = json.Unmarshal(record, &txn)
+	return txn, err
+}
+
+// where builds the WHERE clause and arguments for filter
+func (f TransactionFilter) where() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if f.PatientID != "" {
+		add("patient_id = $%d", f.PatientID)
+	}
+	if f.Status != "" {
+		add("status = $%d", f.Status)
+	}
+	if !f.From.IsZero() {
+		add("processed_at >= $%d", f.From)
+	}
+	if !f.To.IsZero() {
+		add("processed_at <= $%d", f.To)
+	}
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+func (p *postgresRepository) List(ctx context.Context, filter TransactionFilter) ([]Transaction, int, error) {
+	where, args := filter.where()
+	var total int
+	if err := p.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM payment_transactions`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `SELECT record FROM payment_transactions` + where + ` ORDER BY processed_at DESC, id DESC`
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	args = append(args, filter.Offset)
+	query += fmt.Sprintf(" OFFSET $%d", len(args))
+
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	transactions := []Transaction{}
+	for rows.Next() {
+		var record []byte
+		if err := rows.Scan(&record); err != nil {
+			return nil, 0, err
+		}
+		var txn Transaction
+		if err := json.Unmarshal(record, &txn); err != nil {
+			return nil, 0, err
+		}
+		transactions = append(transactions, txn)
+	}
+	return transactions, total, rows.Err()
+}
+
+func (p *postgresRepository) Ping(ctx context.Context) error {
+	return p.db.PingContext(ctx)
+}
+
+// CurrentEpoch implements Fence with the single row of failover_fence
+func (p *postgresRepository) CurrentEpoch(ctx context.Context) (uint64, string, error) {
+	var epoch int64
+	var holder string
+	err := p.db.QueryRowContext(ctx, `SELECT epoch, holder FROM failover_fence WHERE id = 1`).Scan(&epoch, &holder)
+	return uint64(epoch), holder, err
+}
+
+func (p *postgresRepository) ClaimEpoch(ctx context.Context, node string, epoch uint64) error {
+	result, err := p.db.ExecContext(ctx, `
+		UPDATE failover_fence SET epoch = $1, holder = $2
+		WHERE id = 1 AND (epoch < $1 OR (epoch = $1 AND holder = $2))`, int64(epoch), node)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return errFenced
+	}
+	return nil
+}
+
+// SaveFenced saves inside a transaction that holds a share lock on the fence row, so a
+// claim cannot land between the epoch check and the write
+func (p *postgresRepository) SaveFenced(ctx context.Context, txn Transaction, node string, epoch uint64) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var current int64
+	var holder string
+	if err := tx.QueryRowContext(ctx, `SELECT epoch, holder FROM failover_fence WHERE id = 1 FOR SHARE`).Scan(&current, &holder); err != nil {
+		return err
+	}
+	if uint64(current) != epoch || holder != node {
+		return errFenced
+	}
+	if err := saveTransaction(ctx, tx, txn); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
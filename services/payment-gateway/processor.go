@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/healthcare-gitops/common/config"
+)
+
+// Payment processors PAYMENT_PROCESSOR selects
+const (
+	ProcessorSandbox  = "sandbox"
+	ProcessorStripe   = "stripe"
+	ProcessorAcquirer = "acquirer"
+)
+
+// OperationAuthorize labels processor authorizations; captures, refunds and voids are
+// labelled with their Change
+const OperationAuthorize = "authorize"
+
+// Processor errors. A decline is the processor refusing the payment; an unavailable
+// processor could not be asked, so the request may be retried.
+var (
+	ErrPaymentDeclined      = errors.New("payment declined")
+	ErrProcessorUnavailable = errors.New("payment processor unavailable")
+)
+
+// Authorization is a processor's approval of a payment
+type Authorization struct {
+	AuthCode string
+	// Reference is the processor's ID for the payment, which captures, refunds and
+	// voids refer to
+	Reference string
+}
+
+// PaymentProcessor moves the money: it authorizes payments with an acquirer and
+// settles, refunds and cancels them. Handlers only see this interface, so the gateway
+// is pointed at a real acquirer by configuration.
+type PaymentProcessor interface {
+	// Name identifies the processor on the transactions it authorized
+	Name() string
+	// Authorize asks the acquirer to approve a validated payment. transactionID is the
+	// gateway's ID, for idempotency and reconciliation.
+	Authorize(ctx context.Context, transactionID string, req PaymentRequest) (Authorization, error)
+	// Capture settles an authorized payment
+	Capture(ctx context.Context, txn Transaction) error
+	// Refund returns refund.Amount of a captured payment
+	Refund(ctx context.Context, txn Transaction, refund Refund) error
+	// Void cancels an authorized payment that was not captured
+	Void(ctx context.Context, txn Transaction) error
+}
+
+// ProcessorConfig selects and configures the payment processor
+type ProcessorConfig struct {
+	// Name is sandbox, stripe or acquirer; empty means sandbox
+	Name     string
+	Stripe   StripeConfig
+	Acquirer AcquirerConfig
+}
+
+// processorConfigFromEnv reads PAYMENT_PROCESSOR, STRIPE_* and ACQUIRER_*
+func processorConfigFromEnv() ProcessorConfig {
+	return ProcessorConfig{
+		Name: config.GetEnv("PAYMENT_PROCESSOR", ProcessorSandbox),
+		Stripe: StripeConfig{
+			APIKey: config.GetEnv("STRIPE_API_KEY", ""),
+			URL:    config.GetEnv("STRIPE_API_URL", defaultStripeURL),
+		},
+		Acquirer: AcquirerConfig{
+			MerchantID:   config.GetEnv("ACQUIRER_MERCHANT_ID", ""),
+			TerminalID:   config.GetEnv("ACQUIRER_TERMINAL_ID", ""),
+			OriginatorID: config.GetEnv("ACQUIRER_ORIGINATOR_ID", ""),
+		},
+	}
+}
+
+// newPaymentProcessor builds the configured processor. maxLatency bounds the sandbox's
+// simulated processing time.
+func newPaymentProcessor(cfg ProcessorConfig, maxLatency time.Duration) (PaymentProcessor, error) {
+	switch strings.ToLower(cfg.Name) {
+	case "", ProcessorSandbox:
+		return newSandboxProcessor(maxLatency), nil
+	case ProcessorStripe:
+		return newStripeProcessor(cfg.Stripe)
+	case ProcessorAcquirer:
+		return newAcquirerProcessor(cfg.Acquirer)
+	default:
+		return nil, fmt.Errorf("unknown payment processor %q: want %s, %s or %s", cfg.Name, ProcessorSandbox, ProcessorStripe, ProcessorAcquirer)
+	}
+}
+
+// validatePayment checks a payment before it reaches a processor
+func validatePayment(req PaymentRequest) error {
+	if req.AmountCents <= 0 {
+		return ErrInvalidAmount
+	}
+	if req.Currency == "" || req.CustomerID == "" || req.Method == "" {
+		return ErrMissingFields
+	}
+	if _, ok := lookupCurrency(req.Currency); !ok {
+		return fmt.Errorf("%w: %s is not a supported ISO 4217 currency", ErrInvalidAmount, req.Currency)
+	}
+	return validateCard(req, time.Now())
+}
+
+// processPayment validates a payment and authorizes it with processor
+func processPayment(ctx context.Context, processor PaymentProcessor, transactionID string, req PaymentRequest) (PaymentResponse, Authorization, error) {
+	if err := validatePayment(req); err != nil {
+		return PaymentResponse{}, Authorization{}, err
+	}
+	authz, err := processor.Authorize(ctx, transactionID, req)
+	if err != nil {
+		return PaymentResponse{}, Authorization{}, err
+	}
+	resp := PaymentResponse{
+		Status:      StatusAuthorized,
+		AuthCode:    authz.AuthCode,
+		ProcessedAt: time.Now().Unix(),
+		HighValue:   req.AmountCents >= 10000, // Set high-value flag for amounts >= $100
+	}
+	return resp, authz, nil
+}
+
+// sandboxProcessor approves payments without moving money, for development and tests.
+// Customers whose ID starts with decline_ are declined, to exercise that path.
+type sandboxProcessor struct {
+	latency time.Duration
+}
+
+func newSandboxProcessor(maxLatency time.Duration) *sandboxProcessor {
+	// Simulate processing time (bounded by maxLatency)
+	latency := maxLatency / 4
+	if latency <= 0 {
+		latency = 10 * time.Millisecond
+	}
+	return &sandboxProcessor{latency: latency}
+}
+
+func (s *sandboxProcessor) Name() string { return ProcessorSandbox }
+
+func (s *sandboxProcessor) Authorize(ctx context.Context, transactionID string, req PaymentRequest) (Authorization, error) {
+	if err := s.wait(ctx); err != nil {
+		return Authorization{}, err
+	}
+	if strings.HasPrefix(req.CustomerID, "decline_") {
+		return Authorization{}, fmt.Errorf("%w: sandbox customer %s is always declined", ErrPaymentDeclined, req.CustomerID)
+	}
+	return Authorization{
+		AuthCode:  "AUTH-" + time.Now().Format("150405"),
+		Reference: "SBX-" + strings.TrimPrefix(transactionID, "TXN-"),
+	}, nil
+}
+
+func (s *sandboxProcessor) Capture(ctx context.Context, txn Transaction) error {
+	return s.wait(ctx)
+}
+
+func (s *sandboxProcessor) Refund(ctx context.Context, txn Transaction, refund Refund) error {
+	return s.wait(ctx)
+}
+
+func (s *sandboxProcessor) Void(ctx context.Context, txn Transaction) error {
+	return s.wait(ctx)
+}
+
+func (s *sandboxProcessor) wait(ctx context.Context) error {
+	timer := time.NewTimer(s.latency)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%w: %v", ErrProcessorUnavailable, ctx.Err())
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestNewPaymentProcessor(t *testing.T) {
+	cases := []struct {
+		name string
+		cfg  ProcessorConfig
+		want string
+	}{
+		{"default", ProcessorConfig{}, ProcessorSandbox},
+		{"sandbox", ProcessorConfig{Name: "Sandbox"}, ProcessorSandbox},
+		{"stripe", ProcessorConfig{Name: ProcessorStripe, Stripe: StripeConfig{APIKey: "sk_test_1"}}, ProcessorStripe},
+		{"acquirer", ProcessorConfig{Name: ProcessorAcquirer, Acquirer: AcquirerConfig{MerchantID: "M1", TerminalID: "T1"}}, ProcessorAcquirer},
+		{"stripe without a key", ProcessorConfig{Name: ProcessorStripe}, ""},
+		{"acquirer without a terminal", ProcessorConfig{Name: ProcessorAcquirer, Acquirer: AcquirerConfig{MerchantID: "M1"}}, ""},
+		{"acquirer with a bad originator", ProcessorConfig{Name: ProcessorAcquirer, Acquirer: AcquirerConfig{MerchantID: "M1", TerminalID: "T1", OriginatorID: "0210"}}, ""},
+		{"unknown", ProcessorConfig{Name: "paypal"}, ""},
+	}
+	for _, tc := range cases {
+		p, err := newPaymentProcessor(tc.cfg, time.Millisecond)
+		if tc.want == "" {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %s", tc.name, p.Name())
+			}
+			continue
+		}
+		if err != nil || p.Name() != tc.want {
+			t.Errorf("%s: expected %s, got %v", tc.name, tc.want, err)
+		}
+	}
+}
+
+func TestStripeProcessor(t *testing.T) {
+	var requests []*http.Request
+	var forms []url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		requests, forms = append(requests, r), append(forms, r.PostForm)
+		switch {
+		case r.PostForm.Get("customer") == "cus_declined":
+			w.WriteHeader(http.StatusPaymentRequired)
+			fmt.Fprint(w, `{"error": {"type": "card_error", "code": "card_declined", "decline_code": "insufficient_funds"}}`)
+		case r.PostForm.Get("customer") == "cus_outage":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case r.URL.Path == "/v1/payment_intents":
+			fmt.Fprint(w, `{"id": "pi_123", "status": "requires_capture", "latest_charge": "ch_456"}`)
+		default:
+			fmt.Fprint(w, `{}`)
+		}
+	}))
+	defer srv.Close()
+	p, err := newStripeProcessor(StripeConfig{APIKey: "sk_test_1", URL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	req := PaymentRequest{AmountCents: 2500, Currency: "USD", CustomerID: "cus_1", Method: "pm_card_visa", PatientID: "PAT-1", Description: "Oncology consult"}
+	authz, err := p.Authorize(ctx, "TXN-1", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authz.Reference != "pi_123" || authz.AuthCode != "ch_456" {
+		t.Fatalf("unexpected authorization: %+v", authz)
+	}
+	form := forms[0]
+	if form.Get("amount") != "2500" || form.Get("currency") != "usd" || form.Get("capture_method") != "manual" || form.Get("payment_method") != "pm_card_visa" {
+		t.Fatalf("unexpected payment intent: %v", form)
+	}
+	for key, values := range form {
+		if strings.Contains(strings.Join(values, " "), "PAT-1") || strings.Contains(strings.Join(values, " "), "Oncology") {
+			t.Fatalf("expected no PHI sent to Stripe, got %s=%v", key, values)
+		}
+	}
+	if requests[0].Header.Get("Authorization") != "Bearer sk_test_1" || requests[0].Header.Get("Idempotency-Key") != "TXN-1" {
+		t.Fatalf("unexpected headers: %v", requests[0].Header)
+	}
+
+	req.CustomerID = "cus_declined"
+	if _, err := p.Authorize(ctx, "TXN-2", req); !errors.Is(err, ErrPaymentDeclined) || !strings.Contains(err.Error(), "insufficient_funds") {
+		t.Fatalf("expected a decline, got %v", err)
+	}
+	req.CustomerID = "cus_outage"
+	if _, err := p.Authorize(ctx, "TXN-3", req); !errors.Is(err, ErrProcessorUnavailable) {
+		t.Fatalf("expected Stripe unavailable, got %v", err)
+	}
+
+	txn := Transaction{ID: "TXN-1", ProcessorReference: "pi_123", Amount: Money{AmountMinor: 2500, Currency: "USD"}}
+	if err := p.Capture(ctx, txn); err != nil {
+		t.Fatal(err)
+	}
+	txn.Refunds = []Refund{{ID: "RFD-1", Amount: Money{AmountMinor: 1000, Currency: "USD"}}}
+	if err := p.Refund(ctx, txn, txn.Refunds[0]); err != nil {
+		t.Fatal(err)
+	}
+	capture, refund := requests[3], requests[4]
+	if capture.URL.Path != "/v1/payment_intents/pi_123/capture" || capture.Header.Get("Idempotency-Key") != "TXN-1-capture" {
+		t.Fatalf("unexpected capture: %s %v", capture.URL.Path, capture.Header)
+	}
+	if refund.URL.Path != "/v1/refunds" || forms[4].Get("payment_intent") != "pi_123" || forms[4].Get("amount") != "1000" || refund.Header.Get("Idempotency-Key") != "TXN-1-refund-1" {
+		t.Fatalf("unexpected refund: %s %v %v", refund.URL.Path, forms[4], refund.Header)
+	}
+}
+
+func TestAcquirerProcessor(t *testing.T) {
+	var sent []AcquirerMessage
+	code := iso8583Approved
+	p, err := newAcquirerProcessor(AcquirerConfig{
+		MerchantID:   "MERCHANT000001",
+		TerminalID:   "TERM0001",
+		OriginatorID: "02100002",
+		Link: func(ctx context.Context, msg AcquirerMessage) (AcquirerResponse, error) {
+			sent = append(sent, msg)
+			return AcquirerResponse{Code: code, AuthCode: "A1B2C3"}, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	authz, err := p.Authorize(ctx, "TXN-1", PaymentRequest{AmountCents: 2500, Currency: "usd", CustomerID: "cust-1", Method: "card"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := sent[0]
+	if msg.Format != FormatISO8583 || msg.MTI != "0100" || msg.Fields[4] != "000000002500" || msg.Fields[49] != "840" || msg.Fields[41] != "TERM0001" || msg.Fields[48] != "cust-1" {
+		t.Fatalf("unexpected authorization request: %+v", msg)
+	}
+	if authz.AuthCode != "A1B2C3" || authz.Reference != msg.Fields[37] || len(authz.Reference) != 12 {
+		t.Fatalf("unexpected authorization: %+v", authz)
+	}
+
+	txn := Transaction{ID: "TXN-1", AuthCode: authz.AuthCode, ProcessorReference: authz.Reference, Method: "card", CustomerID: "cust-1", Amount: Money{AmountMinor: 2500, Currency: "USD"}}
+	if err := p.Void(ctx, txn); err != nil {
+		t.Fatal(err)
+	}
+	if reversal := sent[1]; reversal.MTI != "0400" || reversal.Fields[37] != authz.Reference || reversal.Fields[38] != "A1B2C3" {
+		t.Fatalf("unexpected reversal: %+v", reversal)
+	}
+
+	code = "05"
+	if _, err := p.Authorize(ctx, "TXN-2", PaymentRequest{AmountCents: 2500, Currency: "USD", CustomerID: "cust-1", Method: "card"}); !errors.Is(err, ErrPaymentDeclined) {
+		t.Fatalf("expected response code 05 to decline, got %v", err)
+	}
+	code = iso8583IssuerUnavailable
+	if _, err := p.Authorize(ctx, "TXN-3", PaymentRequest{AmountCents: 2500, Currency: "USD", CustomerID: "cust-1", Method: "card"}); !errors.Is(err, ErrProcessorUnavailable) {
+		t.Fatalf("expected response code 91 to be unavailable, got %v", err)
+	}
+	if _, err := p.Authorize(ctx, "TXN-4", PaymentRequest{AmountCents: 2500, Currency: "XAU", CustomerID: "cust-1", Method: "card"}); !errors.Is(err, ErrInvalidAmount) {
+		t.Fatalf("expected an unsettled currency to be refused, got %v", err)
+	}
+
+	code = iso8583Approved
+	sent = nil
+	ach := Transaction{ID: "TXN-5", Method: "ach", CustomerID: "cust-2", Amount: Money{AmountMinor: 12345, Currency: "USD"}}
+	if _, err := p.Authorize(ctx, ach.ID, PaymentRequest{AmountCents: 12345, Currency: "USD", CustomerID: "cust-2", Method: "ach"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Capture(ctx, ach); err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 1 || sent[0].Format != FormatNACHA {
+		t.Fatalf("expected only the capture to originate an entry, got %+v", sent)
+	}
+	record := sent[0].Record
+	if len(record) != nachaEntryRecordLength || record[:3] != "627" || record[29:39] != "0000012345" || strings.TrimSpace(record[39:54]) != "cust-2" || record[79:94] != "021000020000001" {
+		t.Fatalf("unexpected NACHA entry %q", record)
+	}
+}
+
+// unavailableProcessor is a processor whose acquirer cannot be reached
+type unavailableProcessor struct{ *sandboxProcessor }
+
+func (unavailableProcessor) Name() string { return ProcessorStripe }
+
+func (unavailableProcessor) Refund(ctx context.Context, txn Transaction, refund Refund) error {
+	return fmt.Errorf("%w: connection refused", ErrProcessorUnavailable)
+}
+
+func TestProcessorErrors(t *testing.T) {
+	h := NewServer(Config{Port: "0", ServiceName: "payment-gateway", MaxProcessingMillis: 4}).Handler
+	rr := httptest.NewRecorder()
+	body := `{"amount": {"amount_minor": 2500, "currency": "USD"}, "customer_id": "decline_1", "method": "card"}`
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/v2/payments", bytes.NewBufferString(body)))
+	var envelope ErrorEnvelope
+	if err := json.NewDecoder(rr.Body).Decode(&envelope); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Code != http.StatusPaymentRequired || envelope.Error.Code != ErrorCodeDeclined {
+		t.Fatalf("expected 402 payment_declined, got %d %+v", rr.Code, envelope)
+	}
+
+	repository := newMemoryRepository(10)
+	handler := PaymentHandler{Repository: repository, SOX: &SOXFinancialControlManager{}, Processor: unavailableProcessor{newSandboxProcessor(4 * time.Millisecond)}}
+	txn := testTransaction("TXN-1", 2500, "cust-1", "", "Lab panel", time.Now())
+	txn.Status, txn.Processor = StatusCaptured, ProcessorStripe
+	if err := repository.Save(t.Context(), txn); err != nil {
+		t.Fatal(err)
+	}
+	other := testTransaction("TXN-2", 2500, "cust-1", "", "Lab panel", time.Now())
+	other.Status, other.Processor = StatusCaptured, ProcessorAcquirer
+	if err := repository.Save(t.Context(), other); err != nil {
+		t.Fatal(err)
+	}
+
+	r := chi.NewRouter()
+	r.Post("/api/v1/transactions/{transactionID}/refund", handler.RefundTransactionHandler)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/v1/transactions/TXN-1/refund", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 while the processor is unavailable, got %d", rr.Code)
+	}
+	if stored, _ := repository.Get(t.Context(), "TXN-1"); stored.Status != StatusCaptured || len(stored.Refunds) != 0 {
+		t.Fatalf("expected the failed refund not to be recorded, got %+v", stored)
+	}
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/v1/transactions/TXN-2/refund", nil))
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for a payment another processor authorized, got %d", rr.Code)
+	}
+	if audits := handler.SOX.RecentAuditTrails(2); audits[0].Action != "REFUND_REJECTED" || audits[1].Action != "REFUND_FAILED" {
+		t.Fatalf("unexpected SOX entries: %+v", audits)
+	}
+}
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
+	"github.com/healthcare-gitops/common/resilience"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
@@ -54,8 +56,385 @@ var (
 		},
 		[]string{"status"},
 	)
+
+	// API version usage, to track migration off deprecated versions
+	apiVersionRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "payment_gateway_api_version_requests_total",
+			Help: "Total number of API requests by API version and endpoint",
+		},
+		[]string{"version", "endpoint"},
+	)
+
+	// Transaction searches and exports, by kind
+	transactionSearches = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "payment_gateway_transaction_searches_total",
+			Help: "Total number of transaction searches and exports",
+		},
+		[]string{"kind"},
+	)
+
+	// Transactions returned by searches and exports
+	transactionSearchResults = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "payment_gateway_transaction_search_results",
+			Help:    "Transactions returned per search or export",
+			Buckets: []float64{0, 1, 10, 50, 100, 500, 1000, 5000, 10000},
+		},
+		[]string{"kind"},
+	)
+
+	// Patient messages previewed, sent and reported on, by template
+	templateMessages = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "payment_gateway_template_messages_total",
+			Help: "Total number of patient messages by template, channel and delivery status",
+		},
+		[]string{"template", "channel", "status"},
+	)
+
+	// Bearer token introspections answered from the cache or by auth-service
+	authCacheLookups = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "payment_gateway_auth_cache_lookups_total",
+			Help: "Total number of token introspection cache lookups by result",
+		},
+		[]string{"result"},
+	)
+
+	// Reads of decoy transactions, each also sent to the SOC
+	honeytokenAlerts = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "payment_gateway_honeytoken_alerts_total",
+			Help: "Total number of decoy transaction reads by action",
+		},
+		[]string{"action"},
+	)
+
+	// Active/standby failover: the replica's role and fencing epoch, role changes,
+	// checks of the peer and transactions a standby copied from the active
+	failoverRole = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "payment_gateway_failover_role",
+			Help: "1 for the replica's current failover role, 0 otherwise",
+		},
+		[]string{"role"},
+	)
+	failoverEpoch = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "payment_gateway_failover_epoch",
+			Help: "Fencing epoch the replica holds",
+		},
+	)
+	failoverTransitions = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "payment_gateway_failover_transitions_total",
+			Help: "Total number of failover role changes by new role and reason",
+		},
+		[]string{"role", "reason"},
+	)
+	failoverPeerChecks = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "payment_gateway_failover_peer_checks_total",
+			Help: "Total number of peer health checks by result",
+		},
+		[]string{"result"},
+	)
+	failoverReplicated = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "payment_gateway_failover_replicated_transactions_total",
+			Help: "Total number of transactions a standby copied from the active",
+		},
+	)
+
+	// Captures, refunds and voids of recorded payments, and refund volume in minor
+	// currency units
+	transactionChanges = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "payment_gateway_transaction_changes_total",
+			Help: "Total number of captures, refunds, voids and approvals by result",
+		},
+		[]string{"change", "result"},
+	)
+	refunds = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "payment_gateway_refunds_total",
+			Help: "Total number of refunds by kind and currency",
+		},
+		[]string{"kind", "currency"},
+	)
+	refundedAmount = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "payment_gateway_refunded_amount_minor_total",
+			Help: "Total amount refunded in minor currency units by currency",
+		},
+		[]string{"currency"},
+	)
+
+	// Payment processor calls
+	processorRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "payment_gateway_processor_requests_total",
+			Help: "Total number of payment processor requests by processor, operation and result",
+		},
+		[]string{"processor", "operation", "result"},
+	)
+	processorDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "payment_gateway_processor_request_duration_seconds",
+			Help:    "Payment processor request duration in seconds",
+			Buckets: []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		},
+		[]string{"processor", "operation"},
+	)
+
+	// Insurance claims: status changes, what insurers paid and the remittances applied
+	claimStatuses = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "payment_gateway_claims_total",
+			Help: "Total number of insurance claim status changes by new status",
+		},
+		[]string{"status"},
+	)
+	claimPaidAmount = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "payment_gateway_claim_paid_amount_minor_total",
+			Help: "Total amount insurers paid on claims in minor currency units by currency",
+		},
+		[]string{"currency"},
+	)
+	remittances = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "payment_gateway_remittances_total",
+			Help: "Total number of 835 remittances received by result",
+		},
+		[]string{"result"},
+	)
+
+	// Payment event webhooks: events by final delivery result, individual HTTP attempts
+	// including retries, time to the final result and the dead-letter queue's size
+	webhookDeliveries = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "payment_gateway_webhook_deliveries_total",
+			Help: "Total number of webhook event deliveries by event type and result",
+		},
+		[]string{"event", "result"},
+	)
+	webhookAttempts = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "payment_gateway_webhook_attempts_total",
+			Help: "Total number of webhook HTTP attempts by result",
+		},
+		[]string{"result"},
+	)
+	webhookDeliveryDuration = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "payment_gateway_webhook_delivery_duration_seconds",
+			Help:    "Time from a webhook delivery's first attempt to its final result",
+			Buckets: []float64{.01, .05, .1, .5, 1, 5, 15, 60, 300, 1800},
+		},
+	)
+	webhookDeadLetters = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "payment_gateway_webhook_dead_letters",
+			Help: "Webhook deliveries waiting in the dead-letter queue",
+		},
+	)
+
+	// Exchange rate lookups for payments outside the reporting currency
+	exchangeRateLookups = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "payment_gateway_exchange_rate_lookups_total",
+			Help: "Total number of exchange rate lookups by source and result",
+		},
+		[]string{"source", "result"},
+	)
+
+	riskDecisions = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "payment_gateway_risk_decisions_total",
+			Help: "Total number of payment risk decisions by scorer and decision",
+		},
+		[]string{"scorer", "decision"},
+	)
+
+	riskScores = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "payment_gateway_risk_scores",
+			Help:    "Risk scores of payments assessed before authorization",
+			Buckets: []float64{10, 20, 30, 40, 50, 60, 70, 80, 90, 100},
+		},
+		[]string{"scorer"},
+	)
+
+	// Processor settlement files imported, and the reconciliations run against them
+	settlementImports = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "payment_gateway_settlement_imports_total",
+			Help: "Total number of processor settlement file imports by result",
+		},
+		[]string{"result"},
+	)
+
+	reconciliationReports = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "payment_gateway_reconciliation_reports_total",
+			Help: "Total number of daily reconciliation reports by status",
+		},
+		[]string{"status"},
+	)
+
+	// Card numbers exchanged for tokens before payments are processed
+	cardTokenizations = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "payment_gateway_card_tokenizations_total",
+			Help: "Total number of card tokenizations by tokenizer and result",
+		},
+		[]string{"tokenizer", "result"},
+	)
+
+	// SOX audit records that could not be written to the audit log
+	soxAuditFailures = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "payment_gateway_sox_audit_failures_total",
+			Help: "Total number of SOX audit records that could not be written",
+		},
+	)
+
+	// State of the circuit breakers guarding calls to other services
+	circuitBreakerState = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "payment_gateway_circuit_breaker_state",
+			Help: "State of the circuit breaker guarding calls to a dependency: 0 closed, 1 half-open, 2 open",
+		},
+		[]string{"dependency"},
+	)
 )
 
+// RecordFailoverRole records the replica's role and fencing epoch
+func RecordFailoverRole(role string, epoch uint64) {
+	for _, r := range []string{RoleActive, RoleStandby} {
+		value := 0.0
+		if r == role {
+			value = 1
+		}
+		failoverRole.WithLabelValues(r).Set(value)
+	}
+	failoverEpoch.Set(float64(epoch))
+}
+
+// RecordFailoverTransition records a promotion or demotion
+func RecordFailoverTransition(role, reason string) {
+	failoverTransitions.WithLabelValues(role, reason).Inc()
+}
+
+// RecordFailoverPeerCheck records a health check of the peer replica
+func RecordFailoverPeerCheck(result string) {
+	failoverPeerChecks.WithLabelValues(result).Inc()
+}
+
+// RecordFailoverReplicated records transactions a standby copied from the active
+func RecordFailoverReplicated(n int) {
+	failoverReplicated.Add(float64(n))
+}
+
+// RecordTransactionChange records a capture, refund or void, or a refused attempt at one
+func RecordTransactionChange(change, result string) {
+	transactionChanges.WithLabelValues(change, result).Inc()
+}
+
+// RecordRefund records a full or partial refund and the amount returned
+func RecordRefund(kind string, amount Money) {
+	refunds.WithLabelValues(kind, amount.Currency).Inc()
+	refundedAmount.WithLabelValues(amount.Currency).Add(float64(amount.AmountMinor))
+}
+
+// RecordProcessorRequest records a payment processor call: ok, declined, unavailable
+// or error
+func RecordProcessorRequest(processor, operation string, err error, duration time.Duration) {
+	result := "ok"
+	switch {
+	case errors.Is(err, ErrPaymentDeclined):
+		result = "declined"
+	case errors.Is(err, ErrProcessorUnavailable):
+		result = "unavailable"
+	case err != nil:
+		result = "error"
+	}
+	processorRequests.WithLabelValues(processor, operation, result).Inc()
+	processorDuration.WithLabelValues(processor, operation).Observe(duration.Seconds())
+}
+
+// RecordClaimStatus records a claim moving to status
+func RecordClaimStatus(status string) {
+	claimStatuses.WithLabelValues(status).Inc()
+}
+
+// RecordClaimPayment records what an insurer paid on a claim
+func RecordClaimPayment(amount Money) {
+	claimPaidAmount.WithLabelValues(amount.Currency).Add(float64(amount.AmountMinor))
+}
+
+// RecordRemittance records an 835: applied, duplicate or invalid
+func RecordRemittance(result string) {
+	remittances.WithLabelValues(result).Inc()
+}
+
+// RecordExchangeRateLookup records a rate quote: ok, not_found or unavailable
+func RecordExchangeRateLookup(source string, err error) {
+	result := "ok"
+	switch {
+	case errors.Is(err, ErrExchangeRateNotFound):
+		result = "not_found"
+	case err != nil:
+		result = "unavailable"
+	}
+	exchangeRateLookups.WithLabelValues(source, result).Inc()
+}
+
+// RecordCardTokenization records a card number exchanged for a token: ok or
+// unavailable
+func RecordCardTokenization(tokenizer string, err error) {
+	result := "ok"
+	if err != nil {
+		result = "unavailable"
+	}
+	cardTokenizations.WithLabelValues(tokenizer, result).Inc()
+}
+
+// RecordRiskAssessment records a payment's risk score and the decision taken on it
+func RecordRiskAssessment(a RiskAssessment) {
+	riskDecisions.WithLabelValues(a.Scorer, a.Decision).Inc()
+	riskScores.WithLabelValues(a.Scorer).Observe(float64(a.Score))
+}
+
+// RecordSettlementImport records a processor settlement file import by result: ok,
+// invalid or failed
+func RecordSettlementImport(result string) {
+	settlementImports.WithLabelValues(result).Inc()
+}
+
+// RecordReconciliation records a reconciliation report by its status
+func RecordReconciliation(report ReconciliationReport) {
+	reconciliationReports.WithLabelValues(report.Status).Inc()
+}
+
+// RecordSOXAuditFailure records an audit record the audit log refused
+func RecordSOXAuditFailure() {
+	soxAuditFailures.Inc()
+}
+
+// RecordAuthCacheLookup records a token introspection cache hit or miss
+func RecordAuthCacheLookup(result string) {
+	authCacheLookups.WithLabelValues(result).Inc()
+}
+
+// RecordHoneytokenAlert records a search or export returning a decoy transaction
+func RecordHoneytokenAlert(action string) {
+	honeytokenAlerts.WithLabelValues(action).Inc()
+}
+
 // RecordRequestDuration records HTTP request duration
 func RecordRequestDuration(method, path string, statusCode int, duration time.Duration) {
 	requestDuration.WithLabelValues(
@@ -103,3 +482,52 @@ func RecordTransaction(req PaymentRequest, duration time.Duration, success bool)
 	RecordPaymentTransaction(success, complianceType)
 	RecordPaymentDuration(duration, success)
 }
+
+// RecordAPIVersion records a request served by an API version
+func RecordAPIVersion(version, endpoint string) {
+	apiVersionRequests.WithLabelValues(version, endpoint).Inc()
+}
+
+// RecordTransactionSearch records a transaction search or export and its result count
+func RecordTransactionSearch(kind string, results int) {
+	transactionSearches.WithLabelValues(kind).Inc()
+	transactionSearchResults.WithLabelValues(kind).Observe(float64(results))
+}
+
+// RecordTemplateMessage records a patient message preview, send or delivery report
+func RecordTemplateMessage(template, channel, status string) {
+	templateMessages.WithLabelValues(template, channel, status).Inc()
+}
+
+// RecordWebhookDelivery records an event delivery's final result: delivered,
+// dead_lettered or dropped when its webhook was deleted during retries
+func RecordWebhookDelivery(eventType, result string, duration time.Duration) {
+	webhookDeliveries.WithLabelValues(eventType, result).Inc()
+	webhookDeliveryDuration.Observe(duration.Seconds())
+}
+
+// RecordWebhookWithheld records an event not sent because its payload failed schema
+// validation
+func RecordWebhookWithheld(eventType string) {
+	webhookDeliveries.WithLabelValues(eventType, "invalid").Inc()
+}
+
+// RecordWebhookAttempt records one webhook HTTP attempt
+func RecordWebhookAttempt(ok bool) {
+	result := "success"
+	if !ok {
+		result = "failure"
+	}
+	webhookAttempts.WithLabelValues(result).Inc()
+}
+
+// RecordWebhookDeadLetters records the dead-letter queue's size
+func RecordWebhookDeadLetters(n int) {
+	webhookDeadLetters.Set(float64(n))
+}
+
+// RecordCircuitBreakerState records the state of the breaker guarding calls to a
+// dependency
+func RecordCircuitBreakerState(dependency string, state resilience.State) {
+	circuitBreakerState.WithLabelValues(dependency).Set(float64(state))
+}
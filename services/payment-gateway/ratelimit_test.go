@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/healthcare-gitops/common/auth"
+	commonmw "github.com/healthcare-gitops/common/middleware"
+)
+
+// bearerFor returns an unsigned JWT claiming userID, which the rate limiter must not
+// believe
+func bearerFor(userID string) string {
+	claims := base64.RawURLEncoding.EncodeToString([]byte(`{"user_id":"` + userID + `"}`))
+	return "Bearer eyJhbGciOiJIUzI1NiJ9." + claims + ".c2ln"
+}
+
+// TestRateLimits verifies each caller gets its own bucket, payments their own tighter
+// one, and that every response carries the limit headers
+func TestRateLimits(t *testing.T) {
+	h := NewServer(Config{
+		Port:                "0",
+		ServiceName:         "payment-gateway",
+		MaxProcessingMillis: 50,
+		RateLimit: commonmw.RateLimitConfig{
+			RPS:    0.01,
+			Burst:  3,
+			Routes: paymentRateLimits,
+			Exempt: commonmw.DefaultRateLimitExempt,
+		},
+	}).Handler
+
+	send := func(method, path, ip, authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(`{}`))
+		req.RemoteAddr = ip + ":40000"
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for i, want := range []string{"2", "1", "0"} {
+		rr := send(http.MethodGet, "/capabilities", "10.0.0.1", "")
+		if rr.Code != http.StatusOK || rr.Header().Get("X-RateLimit-Limit") != "3" || rr.Header().Get("X-RateLimit-Remaining") != want {
+			t.Fatalf("request %d: expected 200 with %s remaining of 3, got %d %v", i+1, want, rr.Code, rr.Header())
+		}
+		if rr.Header().Get("X-RateLimit-Reset") == "" {
+			t.Fatalf("request %d: no X-RateLimit-Reset", i+1)
+		}
+	}
+	rr := send(http.MethodGet, "/capabilities", "10.0.0.1", "")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "100" || rr.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Fatalf("expected 429 retrying after 100s, got %d %v", rr.Code, rr.Header())
+	}
+
+	// Probes are never limited; other addresses have their own buckets, but unverified
+	// tokens do not buy their own
+	if rr := send(http.MethodGet, "/health", "10.0.0.1", ""); rr.Code != http.StatusOK || rr.Header().Get("X-RateLimit-Limit") != "" {
+		t.Fatalf("expected /health to be exempt, got %d %v", rr.Code, rr.Header())
+	}
+	if rr := send(http.MethodGet, "/capabilities", "10.0.0.2", ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected another address to have its own bucket, got %d", rr.Code)
+	}
+	for _, user := range []string{"alice", "bob"} {
+		if rr := send(http.MethodGet, "/capabilities", "10.0.0.1", bearerFor(user)); rr.Code != http.StatusTooManyRequests {
+			t.Fatalf("expected a token claiming %s to share the exhausted address's bucket, got %d", user, rr.Code)
+		}
+	}
+
+	// Payments are limited separately, and more tightly
+	if rr := send(http.MethodPost, "/api/v2/payments", "10.0.0.1", ""); rr.Code == http.StatusTooManyRequests || rr.Header().Get("X-RateLimit-Limit") != "20" {
+		t.Fatalf("expected the payment route's own bucket of 20, got %d %v", rr.Code, rr.Header())
+	}
+}
+
+// TestRateLimitsTrustVerifiedCallers verifies only users auth-service has vouched for
+// get buckets of their own, and X-Forwarded-For is only believed from trusted proxies
+func TestRateLimitsTrustVerifiedCallers(t *testing.T) {
+	t.Setenv("FEATURE_USAGE_METERING", "false")
+	t.Setenv("TRUSTED_PROXIES", "10.1.0.0/16")
+	h := NewServer(Config{
+		Port:                "0",
+		ServiceName:         "payment-gateway",
+		MaxProcessingMillis: 50,
+		Auth:                auth.Config{IntrospectURL: startFakeAuthService(t)},
+		RateLimit: commonmw.RateLimitConfig{
+			RPS:    0.01,
+			Burst:  1,
+			Exempt: commonmw.DefaultRateLimitExempt,
+		},
+	}).Handler
+
+	send := func(peer, forwardedFor, token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/summary", nil)
+		req.RemoteAddr = peer + ":40000"
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	// The reader's first request is charged to its address, and verifies its token
+	if code := send("10.0.0.3", "", "reader"); code != http.StatusOK {
+		t.Fatalf("expected the reader's first request to succeed, got %d", code)
+	}
+	if code := send("10.0.0.1", "", ""); code != http.StatusUnauthorized {
+		t.Fatalf("expected an anonymous request to spend 10.0.0.1's bucket, got %d", code)
+	}
+	if code := send("10.0.0.1", "", "forged"); code != http.StatusTooManyRequests {
+		t.Fatalf("expected an unknown token to share 10.0.0.1's bucket, got %d", code)
+	}
+	if code := send("10.0.0.1", "", "reader"); code != http.StatusOK {
+		t.Fatalf("expected the verified reader to have their own bucket, got %d", code)
+	}
+
+	// A client naming another address is still charged to its own, unless it is
+	// speaking through a trusted proxy
+	if code := send("10.0.0.1", "10.0.0.9", ""); code != http.StatusTooManyRequests {
+		t.Fatalf("expected X-Forwarded-For from an untrusted peer to be ignored, got %d", code)
+	}
+	if code := send("10.1.0.5", "10.0.0.9", ""); code != http.StatusUnauthorized {
+		t.Fatalf("expected the client behind a trusted proxy to have its own bucket, got %d", code)
+	}
+	if code := send("10.1.0.6", "10.0.0.9", ""); code != http.StatusTooManyRequests {
+		t.Fatalf("expected the client to keep its bucket behind another proxy, got %d", code)
+	}
+}
+
+// fakeRedis answers the rate limiter's bucket script the way Redis would, without
+// refilling, and refuses EVALSHA until the script has been loaded with EVAL
+type fakeRedis struct {
+	ln net.Listener
+
+	mu     sync.Mutex
+	loaded bool
+	spent  map[string]int
+	conns  []net.Conn
+}
+
+func startFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{ln: ln, spent: make(map[string]int)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.conns = append(f.conns, conn)
+			f.mu.Unlock()
+			go f.serve(conn)
+		}
+	}()
+	t.Cleanup(f.stop)
+	return f
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	for {
+		var args []string
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		for i := 0; i < n; i++ {
+			header, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			size, _ := strconv.Atoi(strings.TrimSpace(header[1:]))
+			arg := make([]byte, size+2)
+			if _, err := io.ReadFull(r, arg); err != nil {
+				return
+			}
+			args = append(args, string(arg[:size]))
+		}
+		fmt.Fprint(conn, f.reply(args))
+	}
+}
+
+// reply runs EVALSHA or EVAL sha|script 1 key rps burst now
+func (f *fakeRedis) reply(args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch strings.ToUpper(args[0]) {
+	case "EVALSHA":
+		if !f.loaded {
+			return "-NOSCRIPT No matching script\r\n"
+		}
+	case "EVAL":
+		f.loaded = true
+	default:
+		return "-ERR unknown command\r\n"
+	}
+	key := args[3]
+	burst, _ := strconv.Atoi(args[5])
+	allowed := 0
+	if f.spent[key] < burst {
+		f.spent[key]++
+		allowed = 1
+	}
+	tokens := strconv.Itoa(burst - f.spent[key])
+	return fmt.Sprintf("*2\r\n:%d\r\n$%d\r\n%s\r\n", allowed, len(tokens), tokens)
+}
+
+func (f *fakeRedis) stop() {
+	f.ln.Close()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, conn := range f.conns {
+		conn.Close()
+	}
+}
+
+// TestRateLimitsShareRedis verifies replicas spend from the same buckets in Redis, and
+// fall back to limiting on their own when it goes away
+func TestRateLimitsShareRedis(t *testing.T) {
+	redis := startFakeRedis(t)
+	var storeErrors int
+	cfg := commonmw.RateLimitConfig{
+		RPS:          0.01,
+		Burst:        2,
+		Routes:       paymentRateLimits,
+		Service:      "payment-gateway",
+		RedisURL:     "redis://" + redis.ln.Addr().String(),
+		OnStoreError: func(error) { storeErrors++ },
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {})
+	replicas := make([]http.Handler, 2)
+	for i := range replicas {
+		limiter, err := commonmw.NewRateLimiter(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		replicas[i] = limiter.Middleware(ok)
+	}
+	send := func(replica int, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/capabilities", nil)
+		req.RemoteAddr = ip + ":40000"
+		rr := httptest.NewRecorder()
+		replicas[replica].ServeHTTP(rr, req)
+		return rr
+	}
+
+	for i, want := range []string{"1", "0"} {
+		if rr := send(i, "10.0.0.1"); rr.Code != http.StatusOK || rr.Header().Get("X-RateLimit-Remaining") != want {
+			t.Fatalf("replica %d: expected 200 with %s remaining, got %d %v", i, want, rr.Code, rr.Header())
+		}
+	}
+	if rr := send(0, "10.0.0.1"); rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the bucket spent on the other replica to be empty, got %d", rr.Code)
+	}
+
+	// Without Redis each replica limits on its own, and the outage is reported once
+	redis.stop()
+	for i := 0; i < 2; i++ {
+		if rr := send(1, "10.0.0.2"); rr.Code != http.StatusOK || rr.Header().Get("X-RateLimit-Limit") != "2" {
+			t.Fatalf("request %d: expected the in-memory bucket, got %d %v", i+1, rr.Code, rr.Header())
+		}
+	}
+	if rr := send(1, "10.0.0.2"); rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the in-memory bucket to be limited, got %d", rr.Code)
+	}
+	if storeErrors != 1 {
+		t.Fatalf("expected the outage to be reported once, got %d", storeErrors)
+	}
+}
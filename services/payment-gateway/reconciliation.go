@@ -0,0 +1,485 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/healthcare-gitops/common/auth"
+	"github.com/rs/zerolog/log"
+)
+
+// Reconciliation report states. A day is awaiting settlement until a settlement file
+// covering it is imported, then reconciled when every capture matches a settled row
+// and mismatched otherwise.
+const (
+	ReconciliationAwaiting   = "awaiting_settlement"
+	ReconciliationReconciled = "reconciled"
+	ReconciliationMismatched = "mismatched"
+)
+
+// Mismatches a reconciliation flags
+const (
+	MismatchMissingSettlement   = "missing_settlement"
+	MismatchUnmatchedSettlement = "unmatched_settlement"
+	MismatchAmount              = "amount_mismatch"
+	MismatchDuplicateSettlement = "duplicate_settlement"
+)
+
+// Bounds on settlement imports: the file size, the rows in one file, the days of
+// settlement rows held, and the problems reported for an invalid file
+const (
+	maxSettlementFileSize = 10 << 20
+	maxSettlementRows     = 100000
+	maxSettlementDays     = 400
+	maxSettlementProblems = 20
+)
+
+// reconciliationLookback is how long before the day payments are looked for that
+// were captured on it; processors expire authorizations well within it
+const reconciliationLookback = 31 * 24 * time.Hour
+
+// errInvalidSettlement is returned for settlement files that cannot be imported
+var errInvalidSettlement = errors.New("invalid settlement file")
+
+// SettlementError lists every problem in a settlement file, by line
+type SettlementError struct {
+	Problems []string
+}
+
+func (e *SettlementError) Error() string {
+	return fmt.Sprintf("%s: %s", errInvalidSettlement, strings.Join(e.Problems, "; "))
+}
+
+func (e *SettlementError) Unwrap() error { return errInvalidSettlement }
+
+// SettlementLine is one settled payment from a processor's settlement file. Date is
+// the processor's batch date, the day the payment was captured.
+type SettlementLine struct {
+	Date               string `json:"date"`
+	Processor          string `json:"processor"`
+	TransactionID      string `json:"transaction_id,omitempty"`
+	ProcessorReference string `json:"processor_reference,omitempty"`
+	Amount             Money  `json:"amount"`
+}
+
+// SettlementImportRequest carries a settlement CSV in a JSON body
+type SettlementImportRequest struct {
+	CSV string `json:"csv"`
+}
+
+// SettlementImport is the outcome of importing a settlement file
+type SettlementImport struct {
+	ID         string    `json:"id"`
+	Processor  string    `json:"processor"`
+	Rows       int       `json:"rows"`
+	Dates      []string  `json:"dates"`
+	ImportedAt time.Time `json:"imported_at"`
+}
+
+// ReconciliationTotals counts payments and totals them by currency
+type ReconciliationTotals struct {
+	Count  int     `json:"count"`
+	Totals []Money `json:"totals"`
+}
+
+// ReconciliationMismatch is a capture and a settled row that disagree, or one
+// without the other
+type ReconciliationMismatch struct {
+	Kind               string `json:"kind"`
+	TransactionID      string `json:"transaction_id,omitempty"`
+	ProcessorReference string `json:"processor_reference,omitempty"`
+	Processor          string `json:"processor"`
+	Captured           *Money `json:"captured,omitempty"`
+	Settled            *Money `json:"settled,omitempty"`
+}
+
+// ReconciliationReport compares a day's captures with the processors' settlement of
+// them
+type ReconciliationReport struct {
+	Date   string `json:"date"`
+	Status string `json:"status"`
+	// Processors lists the processors whose settlement files cover the day
+	Processors  []string                 `json:"processors"`
+	Captured    ReconciliationTotals     `json:"captured"`
+	Settled     ReconciliationTotals     `json:"settled"`
+	Matched     int                      `json:"matched"`
+	Mismatches  []ReconciliationMismatch `json:"mismatches"`
+	GeneratedAt time.Time                `json:"generated_at"`
+}
+
+// ReconciliationStore holds imported settlement rows by day and reconciles them with
+// the payments captured that day. Insurance payments are settled by 835 remittance
+// advice and are left out.
+type ReconciliationStore struct {
+	mu sync.RWMutex
+	// settlements holds each day's rows by processor
+	settlements map[string]map[string][]SettlementLine
+	now         func() time.Time
+
+	// repository is read for the day's captures; sox audits imports
+	repository TransactionRepository
+	sox        *SOXFinancialControlManager
+}
+
+// NewReconciliationStore creates an empty store reading captures from repository
+func NewReconciliationStore(repository TransactionRepository, sox *SOXFinancialControlManager) *ReconciliationStore {
+	return &ReconciliationStore{
+		settlements: make(map[string]map[string][]SettlementLine),
+		now:         time.Now,
+		repository:  repository,
+		sox:         sox,
+	}
+}
+
+// parseSettlementFile reads a processor's settlement CSV. The header names the
+// columns, in any order: date, amount_minor or amount, currency, and transaction_id
+// or processor_reference. Other columns, such as fees, are ignored.
+func parseSettlementFile(processor string, data []byte) ([]SettlementLine, error) {
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	r.TrimLeadingSpace = true
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		return nil, &SettlementError{Problems: []string{"the file has no header row"}}
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	_, hasMinor := columns["amount_minor"]
+	_, hasAmount := columns["amount"]
+	_, hasID := columns["transaction_id"]
+	_, hasReference := columns["processor_reference"]
+	_, hasDate := columns["date"]
+	_, hasCurrency := columns["currency"]
+	if !hasDate || !hasCurrency || !(hasMinor || hasAmount) || !(hasID || hasReference) {
+		return nil, &SettlementError{Problems: []string{"the header must name date, currency, amount_minor or amount, and transaction_id or processor_reference"}}
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var lines []SettlementLine
+	var problems []string
+	problem := func(line int, format string, args ...interface{}) {
+		if len(problems) < maxSettlementProblems {
+			problems = append(problems, fmt.Sprintf("line %d: ", line)+fmt.Sprintf(format, args...))
+		}
+	}
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		line, _ := r.FieldPos(0)
+		if err != nil {
+			problem(line, "%v", err)
+			break
+		}
+		if len(lines) == maxSettlementRows {
+			problem(line, "settlement files hold at most %d rows; split the file", maxSettlementRows)
+			break
+		}
+		s := SettlementLine{
+			Date:               field(record, "date"),
+			Processor:          processor,
+			TransactionID:      field(record, "transaction_id"),
+			ProcessorReference: field(record, "processor_reference"),
+		}
+		if _, err := time.Parse(time.DateOnly, s.Date); err != nil {
+			problem(line, "date %q is not YYYY-MM-DD", s.Date)
+			continue
+		}
+		if s.TransactionID == "" && s.ProcessorReference == "" {
+			problem(line, "transaction_id or processor_reference is required")
+			continue
+		}
+		currency, ok := lookupCurrency(field(record, "currency"))
+		if !ok {
+			problem(line, "currency %q is not an accepted ISO 4217 code", field(record, "currency"))
+			continue
+		}
+		s.Amount.Currency = currency.Code
+		if minor := field(record, "amount_minor"); minor != "" {
+			s.Amount.AmountMinor, err = strconv.ParseInt(minor, 10, 64)
+		} else {
+			var amount float64
+			if amount, err = strconv.ParseFloat(field(record, "amount"), 64); err == nil {
+				s.Amount.AmountMinor, err = currency.minorUnits(amount)
+			}
+		}
+		if err != nil || s.Amount.AmountMinor <= 0 {
+			problem(line, "the amount must be a positive amount in %s", currency.Code)
+			continue
+		}
+		lines = append(lines, s)
+	}
+	if len(problems) > 0 {
+		return nil, &SettlementError{Problems: problems}
+	}
+	if len(lines) == 0 {
+		return nil, &SettlementError{Problems: []string{"the file has no settlement rows"}}
+	}
+	return lines, nil
+}
+
+// Import stores a processor's settlement file, replacing the rows an earlier file
+// from the processor held for the same days, so a corrected file can be imported
+// again. The import is audited before it is stored, and not stored unaudited.
+func (s *ReconciliationStore) Import(processor string, data []byte, userID, ipAddress string) (SettlementImport, error) {
+	lines, err := parseSettlementFile(processor, data)
+	if err != nil {
+		RecordSettlementImport("invalid")
+		return SettlementImport{}, err
+	}
+	byDate := make(map[string][]SettlementLine)
+	for _, line := range lines {
+		byDate[line.Date] = append(byDate[line.Date], line)
+	}
+	imported := SettlementImport{ID: settlementImportID(), Processor: processor, Rows: len(lines), ImportedAt: s.now().UTC()}
+	for date := range byDate {
+		imported.Dates = append(imported.Dates, date)
+	}
+	sort.Strings(imported.Dates)
+
+	if err := s.sox.RecordTransactionChange(imported.ID, "SETTLEMENT_IMPORT", userID, ipAddress,
+		fmt.Sprintf("Imported %d settled payments from %s for %s", imported.Rows, processor, strings.Join(imported.Dates, ", "))); err != nil {
+		RecordSettlementImport("failed")
+		return SettlementImport{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for date, rows := range byDate {
+		if s.settlements[date] == nil {
+			s.settlements[date] = make(map[string][]SettlementLine)
+		}
+		s.settlements[date][processor] = rows
+	}
+	if drop := len(s.settlements) - maxSettlementDays; drop > 0 {
+		dates := make([]string, 0, len(s.settlements))
+		for date := range s.settlements {
+			dates = append(dates, date)
+		}
+		sort.Strings(dates)
+		for _, date := range dates[:drop] {
+			delete(s.settlements, date)
+		}
+	}
+	RecordSettlementImport("ok")
+	return imported, nil
+}
+
+// settlementImportID generates a settlement import ID
+func settlementImportID() string {
+	b := make([]byte, 6)
+	_, _ = rand.Read(b)
+	return "STL-" + hex.EncodeToString(b)
+}
+
+// captured returns the payments captured on day through a processor, reading the
+// repository back over the lookback for the authorizations they were captured from
+func (s *ReconciliationStore) captured(ctx context.Context, day time.Time) ([]Transaction, error) {
+	end := day.Add(24 * time.Hour)
+	filter := TransactionFilter{From: day.Add(-reconciliationLookback), To: end, Limit: maxTransactionPageSize}
+	var captured []Transaction
+	for {
+		page, total, err := s.repository.List(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, txn := range page {
+			if txn.CapturedAt != nil && !txn.CapturedAt.Before(day) && txn.CapturedAt.Before(end) && txn.Processor != ProcessorRemittance {
+				captured = append(captured, txn)
+			}
+		}
+		filter.Offset += len(page)
+		if len(page) == 0 || filter.Offset >= total {
+			return captured, nil
+		}
+	}
+}
+
+// Report reconciles the payments captured on date, YYYY-MM-DD in UTC, with the
+// settlement rows imported for it. Captures are matched to rows by processor
+// reference, or by transaction ID for rows without one; a capture's expected
+// settlement is its whole amount, since refunds settle separately.
+func (s *ReconciliationStore) Report(ctx context.Context, date string) (ReconciliationReport, error) {
+	day, err := time.Parse(time.DateOnly, date)
+	if err != nil {
+		return ReconciliationReport{}, fmt.Errorf("date %q is not YYYY-MM-DD", date)
+	}
+	captures, err := s.captured(ctx, day)
+	if err != nil {
+		return ReconciliationReport{}, err
+	}
+	s.mu.RLock()
+	var lines []SettlementLine
+	report := ReconciliationReport{Date: date, Processors: []string{}, Mismatches: []ReconciliationMismatch{}, GeneratedAt: s.now().UTC()}
+	for processor, rows := range s.settlements[date] {
+		report.Processors = append(report.Processors, processor)
+		lines = append(lines, rows...)
+	}
+	s.mu.RUnlock()
+	sort.Strings(report.Processors)
+
+	capturedTotals, settledTotals := map[string]int64{}, map[string]int64{}
+	byReference, byID := map[string]int{}, map[string]int{}
+	for i, txn := range captures {
+		capturedTotals[txn.Amount.Currency] += txn.Amount.AmountMinor
+		if txn.ProcessorReference != "" {
+			byReference[txn.Processor+"\x00"+txn.ProcessorReference] = i
+		}
+		byID[txn.ID] = i
+	}
+	settled := make(map[int]bool)
+	for _, line := range lines {
+		settledTotals[line.Amount.Currency] += line.Amount.AmountMinor
+		i, ok := byReference[line.Processor+"\x00"+line.ProcessorReference]
+		if line.ProcessorReference == "" || !ok {
+			i, ok = byID[line.TransactionID]
+		}
+		amount := line.Amount
+		mismatch := ReconciliationMismatch{TransactionID: line.TransactionID, ProcessorReference: line.ProcessorReference, Processor: line.Processor, Settled: &amount}
+		switch {
+		case !ok:
+			mismatch.Kind = MismatchUnmatchedSettlement
+		case settled[i]:
+			mismatch.Kind = MismatchDuplicateSettlement
+		default:
+			settled[i] = true
+			txn := captures[i]
+			if txn.Amount == line.Amount {
+				report.Matched++
+				continue
+			}
+			mismatch.Kind = MismatchAmount
+			mismatch.TransactionID, mismatch.ProcessorReference, mismatch.Captured = txn.ID, txn.ProcessorReference, &txn.Amount
+		}
+		report.Mismatches = append(report.Mismatches, mismatch)
+	}
+	if len(lines) > 0 {
+		for i, txn := range captures {
+			if !settled[i] {
+				amount := txn.Amount
+				report.Mismatches = append(report.Mismatches, ReconciliationMismatch{
+					Kind: MismatchMissingSettlement, TransactionID: txn.ID, ProcessorReference: txn.ProcessorReference, Processor: txn.Processor, Captured: &amount,
+				})
+			}
+		}
+	}
+
+	report.Captured = ReconciliationTotals{Count: len(captures), Totals: moneyTotals(capturedTotals)}
+	report.Settled = ReconciliationTotals{Count: len(lines), Totals: moneyTotals(settledTotals)}
+	switch {
+	case len(lines) == 0:
+		report.Status = ReconciliationAwaiting
+	case len(report.Mismatches) == 0:
+		report.Status = ReconciliationReconciled
+	default:
+		report.Status = ReconciliationMismatched
+	}
+	sort.SliceStable(report.Mismatches, func(i, j int) bool {
+		a, b := report.Mismatches[i], report.Mismatches[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.TransactionID+a.ProcessorReference < b.TransactionID+b.ProcessorReference
+	})
+	RecordReconciliation(report)
+	return report, nil
+}
+
+// moneyTotals lists per-currency totals in currency order
+func moneyTotals(totals map[string]int64) []Money {
+	out := make([]Money, 0, len(totals))
+	for currency, minor := range totals {
+		out = append(out, Money{AmountMinor: minor, Currency: currency})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Currency < out[j].Currency })
+	return out
+}
+
+// ImportHandler handles POST /api/v1/reconciliation/settlements?processor=: a
+// processor's settlement CSV, posted raw or as the csv field of a JSON body
+func (s *ReconciliationStore) ImportHandler(w http.ResponseWriter, r *http.Request) {
+	processor := strings.ToLower(r.URL.Query().Get("processor"))
+	switch processor {
+	case ProcessorSandbox, ProcessorStripe, ProcessorAcquirer:
+	default:
+		http.Error(w, "processor must be sandbox, stripe or acquirer", http.StatusBadRequest)
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSettlementFileSize))
+	if err != nil {
+		http.Error(w, "request entity too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		var req SettlementImportRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		data = []byte(req.CSV)
+	}
+	userID := "unauthenticated"
+	if identity, ok := auth.FromContext(r.Context()); ok {
+		userID = identity.UserID
+	}
+	imported, err := s.Import(processor, data, userID, r.RemoteAddr)
+	var invalid *SettlementError
+	switch {
+	case errors.As(err, &invalid):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":    errInvalidSettlement.Error(),
+			"problems": invalid.Problems,
+		})
+		return
+	case err != nil:
+		log.Error().Err(err).Str("processor", processor).Msg("Failed to audit settlement import")
+		http.Error(w, ErrAuditTrailUnavailable.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-SOX-Compliance", "true")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(imported)
+}
+
+// ReportHandler handles GET /api/v1/reconciliation/{date}
+func (s *ReconciliationStore) ReportHandler(w http.ResponseWriter, r *http.Request) {
+	date := chi.URLParam(r, "date")
+	if _, err := time.Parse(time.DateOnly, date); err != nil {
+		http.Error(w, "date must be YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	report, err := s.Report(r.Context(), date)
+	if err != nil {
+		log.Error().Err(err).Str("date", date).Msg("Failed to reconcile settlements")
+		http.Error(w, "Failed to read transactions", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestParseSettlementFile(t *testing.T) {
+	lines, err := parseSettlementFile(ProcessorStripe, []byte("\xef\xbb\xbfDate, Processor_Reference, Amount, Currency, Fee\n2026-03-09,ch_1,125.00,usd,3.93\n2026-03-09,ch_2,5000,JPY,0\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []SettlementLine{
+		{Date: "2026-03-09", Processor: ProcessorStripe, ProcessorReference: "ch_1", Amount: Money{AmountMinor: 12500, Currency: "USD"}},
+		{Date: "2026-03-09", Processor: ProcessorStripe, ProcessorReference: "ch_2", Amount: Money{AmountMinor: 5000, Currency: "JPY"}},
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Fatalf("expected decimal amounts converted by currency, got %+v", lines)
+	}
+
+	var invalid *SettlementError
+	if _, err := parseSettlementFile(ProcessorStripe, []byte("date,amount_minor,currency\n2026-03-09,100,USD\n")); !errors.As(err, &invalid) || !strings.Contains(invalid.Problems[0], "transaction_id or processor_reference") {
+		t.Fatalf("expected a header without an ID column refused, got %v", err)
+	}
+	_, err = parseSettlementFile(ProcessorStripe, []byte("date,transaction_id,amount_minor,currency\n"+
+		"03/09/2026,TXN-1,100,USD\n"+
+		"2026-03-09,,100,USD\n"+
+		"2026-03-09,TXN-3,100,XXX\n"+
+		"2026-03-09,TXN-4,-100,USD\n"+
+		"2026-03-09,TXN-5,100,USD\n"))
+	if !errors.As(err, &invalid) || !errors.Is(err, errInvalidSettlement) {
+		t.Fatalf("expected an invalid settlement file, got %v", err)
+	}
+	for i, want := range []string{"line 2: date", "line 3: transaction_id", "line 4: currency", "line 5: the amount"} {
+		if i >= len(invalid.Problems) || !strings.HasPrefix(invalid.Problems[i], want) {
+			t.Fatalf("expected every problem reported by line, got %q", invalid.Problems)
+		}
+	}
+	if _, err := parseSettlementFile(ProcessorStripe, []byte("date,transaction_id,amount,currency\n")); !errors.As(err, &invalid) {
+		t.Fatalf("expected a file without rows refused, got %v", err)
+	}
+}
+
+func TestReconciliationReport(t *testing.T) {
+	ctx := t.Context()
+	day := time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC)
+	repository := newMemoryRepository(10)
+	save := func(id string, amount int64, reference string, captured time.Time) {
+		t.Helper()
+		txn := testTransaction(id, amount, "cust-1", "", "Office visit", captured.Add(-2*time.Hour))
+		txn.Processor, txn.ProcessorReference = ProcessorStripe, reference
+		if !captured.IsZero() {
+			if err := txn.Capture(captured); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := repository.Save(ctx, txn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	save("TXN-1", 2500, "ch_1", day.Add(9*time.Hour))
+	save("TXN-2", 15000, "ch_2", day.Add(11*time.Hour))
+	save("TXN-3", 4000, "ch_3", day.Add(23*time.Hour))
+	save("TXN-4", 9900, "ch_4", day.Add(-time.Minute))
+	save("TXN-5", 1200, "ch_5", time.Time{})
+	insurance := testTransaction("TXN-6", 18400, "", "P-1001", "Insurance payment", day.Add(8*time.Hour))
+	insurance.Processor, insurance.ProcessorReference = ProcessorRemittance, "EFT0001"
+	_ = insurance.Capture(day.Add(8 * time.Hour))
+	if err := repository.Save(ctx, insurance); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewReconciliationStore(repository, &SOXFinancialControlManager{})
+	s.now = func() time.Time { return day.Add(30 * time.Hour) }
+	report, err := s.Report(ctx, "2026-03-09")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Status != ReconciliationAwaiting || report.Captured.Count != 3 || !reflect.DeepEqual(report.Captured.Totals, []Money{{AmountMinor: 21500, Currency: "USD"}}) || len(report.Mismatches) != 0 {
+		t.Fatalf("expected the day's three card captures awaiting settlement, got %+v", report)
+	}
+
+	imported, err := s.Import(ProcessorStripe, []byte("date,processor_reference,transaction_id,amount_minor,currency\n"+
+		"2026-03-09,ch_1,TXN-1,2500,USD\n"+
+		"2026-03-09,ch_2,TXN-2,14000,USD\n"+
+		"2026-03-09,,TXN-1,2500,USD\n"+
+		"2026-03-09,ch_9,,700,USD\n"+
+		"2026-03-08,ch_4,TXN-4,9900,USD\n"), "finance-1", "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported.Rows != 5 || !reflect.DeepEqual(imported.Dates, []string{"2026-03-08", "2026-03-09"}) || !strings.HasPrefix(imported.ID, "STL-") {
+		t.Fatalf("unexpected import: %+v", imported)
+	}
+	if report, err = s.Report(ctx, "2026-03-09"); err != nil {
+		t.Fatal(err)
+	}
+	kinds := func(report ReconciliationReport) string {
+		var out []string
+		for _, m := range report.Mismatches {
+			out = append(out, m.Kind+":"+m.TransactionID+m.ProcessorReference)
+		}
+		return strings.Join(out, " ")
+	}
+	if want := "amount_mismatch:TXN-2ch_2 duplicate_settlement:TXN-1 missing_settlement:TXN-3ch_3 unmatched_settlement:ch_9"; kinds(report) != want {
+		t.Fatalf("expected mismatches %q, got %q", want, kinds(report))
+	}
+	if report.Status != ReconciliationMismatched || report.Matched != 1 || report.Settled.Count != 4 || report.Settled.Totals[0].AmountMinor != 19700 || !reflect.DeepEqual(report.Processors, []string{ProcessorStripe}) {
+		t.Fatalf("unexpected mismatched report: %+v", report)
+	}
+	if m := report.Mismatches[0]; m.Captured.AmountMinor != 15000 || m.Settled.AmountMinor != 14000 {
+		t.Fatalf("expected the amount mismatch to carry both amounts, got %+v", m)
+	}
+	if report, _ = s.Report(ctx, "2026-03-08"); report.Status != ReconciliationReconciled || report.Matched != 1 {
+		t.Fatalf("expected the previous day reconciled, got %+v", report)
+	}
+
+	// A corrected file replaces the processor's rows for its day
+	if _, err := s.Import(ProcessorStripe, []byte("date,processor_reference,amount_minor,currency\n2026-03-09,ch_1,2500,USD\n2026-03-09,ch_2,15000,USD\n2026-03-09,ch_3,4000,USD\n"), "finance-1", "10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if report, _ = s.Report(ctx, "2026-03-09"); report.Status != ReconciliationReconciled || report.Matched != 3 || len(report.Mismatches) != 0 {
+		t.Fatalf("expected the corrected day reconciled, got %+v", report)
+	}
+	if trails, _ := s.sox.QueryAuditTrails(SOXAuditFilter{Action: "SETTLEMENT_IMPORT"}); len(trails) != 2 || trails[0].UserID != "finance-1" {
+		t.Fatalf("expected both imports audited, got %+v", trails)
+	}
+
+	s.sox = &SOXFinancialControlManager{store: failingSOXAuditStore{}}
+	if _, err := s.Import(ProcessorStripe, []byte("date,processor_reference,amount_minor,currency\n2026-03-09,ch_1,1,USD\n"), "finance-1", "10.0.0.1"); !errors.Is(err, ErrAuditTrailUnavailable) {
+		t.Fatalf("expected an unaudited import refused, got %v", err)
+	}
+	if report, _ = s.Report(ctx, "2026-03-09"); report.Status != ReconciliationReconciled {
+		t.Fatalf("expected the refused import not stored, got %+v", report)
+	}
+}
+
+func TestReconciliationHandlers(t *testing.T) {
+	s := NewReconciliationStore(newMemoryRepository(10), &SOXFinancialControlManager{})
+	r := chi.NewRouter()
+	r.Post("/api/v1/reconciliation/settlements", s.ImportHandler)
+	r.Get("/api/v1/reconciliation/{date}", s.ReportHandler)
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if strings.HasPrefix(body, "{") {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := do(http.MethodPost, "/api/v1/reconciliation/settlements?processor=paypal", "date"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected an unknown processor refused with 400, got %d", rr.Code)
+	}
+	rr := do(http.MethodPost, "/api/v1/reconciliation/settlements?processor=acquirer", "date,transaction_id,amount_minor,currency\n2026-03-09,TXN-1,abc,USD\n")
+	var problems struct {
+		Error    string   `json:"error"`
+		Problems []string `json:"problems"`
+	}
+	if rr.Code != http.StatusUnprocessableEntity || json.NewDecoder(rr.Body).Decode(&problems) != nil || problems.Error != "invalid settlement file" || len(problems.Problems) != 1 {
+		t.Fatalf("expected 422 with the file's problems, got %d: %+v", rr.Code, problems)
+	}
+	rr = do(http.MethodPost, "/api/v1/reconciliation/settlements?processor=acquirer", `{"csv": "date,transaction_id,amount_minor,currency\n2026-03-09,TXN-1,100,USD\n"}`)
+	if rr.Code != http.StatusCreated || rr.Header().Get("X-SOX-Compliance") != "true" {
+		t.Fatalf("expected the import created, got %d: %s", rr.Code, rr.Body)
+	}
+
+	if rr := do(http.MethodGet, "/api/v1/reconciliation/09-03-2026", ""); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected a malformed date refused with 400, got %d", rr.Code)
+	}
+	rr = do(http.MethodGet, "/api/v1/reconciliation/2026-03-09", "")
+	var report ReconciliationReport
+	if rr.Code != http.StatusOK || json.NewDecoder(rr.Body).Decode(&report) != nil {
+		t.Fatalf("expected the report, got %d: %s", rr.Code, rr.Body)
+	}
+	if report.Status != ReconciliationMismatched || len(report.Mismatches) != 1 || report.Mismatches[0].Kind != MismatchUnmatchedSettlement {
+		t.Fatalf("expected the settled row without a capture flagged, got %+v", report)
+	}
+}
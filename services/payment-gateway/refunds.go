@@ -0,0 +1,326 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/healthcare-gitops/common/auth"
+	"github.com/rs/zerolog/log"
+)
+
+// Transaction states. A payment is authorized when processed; capturing it settles
+// the funds, after which it can be refunded in full or in parts. An authorized payment
+// that was never captured is voided instead. Payments at or over the approval threshold
+// wait in StatusPendingApproval until approved (see approvals.go).
+const (
+	StatusAuthorized        = "authorized"
+	StatusCaptured          = "captured"
+	StatusPartiallyRefunded = "partially_refunded"
+	StatusRefunded          = "refunded"
+	StatusVoided            = "voided"
+)
+
+// Transaction changes, as audited and counted
+const (
+	ChangeCapture = "capture"
+	ChangeRefund  = "refund"
+	ChangeVoid    = "void"
+)
+
+// maxChangeReason bounds the reason recorded with a refund or void
+const maxChangeReason = 500
+
+// transactionLocks serializes changes to each transaction, striped by ID, so two
+// partial refunds cannot both spend the same balance. Only the active replica writes,
+// so locking in process is enough.
+var transactionLocks [64]sync.Mutex
+
+func lockTransaction(id string) func() {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	mu := &transactionLocks[h.Sum32()%uint32(len(transactionLocks))]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// errInvalidTransition is returned when a change is not allowed from the
+// transaction's state
+var errInvalidTransition = errors.New("invalid transaction state change")
+
+// Refund is one refund of a captured payment
+type Refund struct {
+	ID         string    `json:"id"`
+	Amount     Money     `json:"amount"`
+	Reason     string    `json:"reason,omitempty"`
+	AuditID    string    `json:"audit_id"`
+	RefundedAt time.Time `json:"refunded_at"`
+}
+
+// TransactionChangeRequest is the body of a refund or void. A refund without an
+// amount returns the rest of the payment.
+type TransactionChangeRequest struct {
+	Amount *Money `json:"amount,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Capture settles an authorized payment
+func (txn *Transaction) Capture(at time.Time) error {
+	if txn.Status == StatusPendingApproval {
+		return fmt.Errorf("%w: the payment is awaiting %s approval", errInvalidTransition, txn.Approval.RequiredLevel)
+	}
+	if txn.Status != StatusAuthorized {
+		return fmt.Errorf("%w: only authorized payments can be captured, this one is %s", errInvalidTransition, txn.Status)
+	}
+	txn.Status = StatusCaptured
+	txn.CapturedAt = &at
+	return nil
+}
+
+// Void cancels an authorized payment before it is captured, or rejects one pending
+// approval
+func (txn *Transaction) Void(at time.Time) error {
+	switch txn.Status {
+	case StatusAuthorized, StatusPendingApproval:
+	case StatusCaptured, StatusPartiallyRefunded:
+		return fmt.Errorf("%w: captured payments are refunded, not voided", errInvalidTransition)
+	default:
+		return fmt.Errorf("%w: only authorized payments can be voided, this one is %s", errInvalidTransition, txn.Status)
+	}
+	txn.Status = StatusVoided
+	txn.VoidedAt = &at
+	return nil
+}
+
+// Refundable returns the amount not yet refunded
+func (txn *Transaction) Refundable() Money {
+	refundable := txn.Amount
+	if txn.Refunded != nil {
+		refundable.AmountMinor -= txn.Refunded.AmountMinor
+	}
+	return refundable
+}
+
+// Refund returns amount of a captured payment to the payer, or the rest of it when
+// amount is nil
+func (txn *Transaction) Refund(amount *Money, reason, auditID string, at time.Time) (Refund, error) {
+	switch txn.Status {
+	case StatusCaptured, StatusPartiallyRefunded:
+	case StatusAuthorized, StatusPendingApproval:
+		return Refund{}, fmt.Errorf("%w: the payment has not been captured; void it instead", errInvalidTransition)
+	default:
+		return Refund{}, fmt.Errorf("%w: only captured payments can be refunded, this one is %s", errInvalidTransition, txn.Status)
+	}
+	refundable := txn.Refundable()
+	refund := Refund{ID: "RFD-" + strings.TrimPrefix(transactionID(at), "TXN-"), Amount: refundable, Reason: reason, AuditID: auditID, RefundedAt: at}
+	if amount != nil {
+		if !strings.EqualFold(amount.Currency, txn.Amount.Currency) {
+			return Refund{}, fmt.Errorf("%w: amount.currency must be the payment's currency, %s", ErrInvalidAmount, txn.Amount.Currency)
+		}
+		if amount.AmountMinor <= 0 || amount.AmountMinor > refundable.AmountMinor {
+			return Refund{}, fmt.Errorf("%w: amount.amount_minor must be between 1 and the %d not yet refunded", ErrInvalidAmount, refundable.AmountMinor)
+		}
+		refund.Amount.AmountMinor = amount.AmountMinor
+	}
+
+	refunded := Money{Currency: txn.Amount.Currency}
+	if txn.Refunded != nil {
+		refunded = *txn.Refunded
+	}
+	refunded.AmountMinor += refund.Amount.AmountMinor
+	txn.Refunded = &refunded
+	txn.Refunds = append(txn.Refunds, refund)
+	txn.Status = StatusPartiallyRefunded
+	if refunded.AmountMinor == txn.Amount.AmountMinor {
+		txn.Status = StatusRefunded
+	}
+	return refund, nil
+}
+
+// CaptureTransactionHandler handles POST /api/v1/transactions/{transactionID}/capture
+func (h PaymentHandler) CaptureTransactionHandler(w http.ResponseWriter, r *http.Request) {
+	h.changeTransaction(w, r, ChangeCapture, func(p PaymentProcessor, txn *Transaction, _ TransactionChangeRequest, at time.Time) (string, error) {
+		if err := txn.Capture(at); err != nil {
+			return "", err
+		}
+		if err := callProcessor(p, ChangeCapture, func() error { return p.Capture(r.Context(), *txn) }); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Payment captured: %s", formatMoney(txn.Amount)), nil
+	})
+}
+
+// RefundTransactionHandler handles POST /api/v1/transactions/{transactionID}/refund:
+// a full refund, or a partial one when the body carries an amount
+func (h PaymentHandler) RefundTransactionHandler(w http.ResponseWriter, r *http.Request) {
+	h.changeTransaction(w, r, ChangeRefund, func(p PaymentProcessor, txn *Transaction, req TransactionChangeRequest, at time.Time) (string, error) {
+		refund, err := txn.Refund(req.Amount, req.Reason, generateAuditID(), at)
+		if err != nil {
+			return "", err
+		}
+		if err := callProcessor(p, ChangeRefund, func() error { return p.Refund(r.Context(), *txn, refund) }); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Refund %s of %s (%s refunded of %s): %s", refund.ID, formatMoney(refund.Amount), formatMoney(*txn.Refunded), formatMoney(txn.Amount), reasonOrNone(req.Reason)), nil
+	})
+}
+
+// VoidTransactionHandler handles POST /api/v1/transactions/{transactionID}/void
+func (h PaymentHandler) VoidTransactionHandler(w http.ResponseWriter, r *http.Request) {
+	h.changeTransaction(w, r, ChangeVoid, func(p PaymentProcessor, txn *Transaction, req TransactionChangeRequest, at time.Time) (string, error) {
+		if req.Amount != nil {
+			return "", fmt.Errorf("%w: a void cancels the whole payment and takes no amount", ErrInvalidAmount)
+		}
+		if err := txn.Void(at); err != nil {
+			return "", err
+		}
+		if err := callProcessor(p, ChangeVoid, func() error { return p.Void(r.Context(), *txn) }); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Payment of %s voided: %s", formatMoney(txn.Amount), reasonOrNone(req.Reason)), nil
+	})
+}
+
+// callProcessor runs one processor operation and records it
+func callProcessor(p PaymentProcessor, operation string, call func() error) error {
+	start := time.Now()
+	err := call()
+	RecordProcessorRequest(p.Name(), operation, err, time.Since(start))
+	return err
+}
+
+// processorFor returns the processor that authorized txn. Transactions recorded
+// without one were the sandbox's.
+func (h PaymentHandler) processorFor(txn Transaction) (PaymentProcessor, error) {
+	processor := h.processor()
+	switch txn.Processor {
+	case processor.Name():
+		return processor, nil
+	case "", ProcessorSandbox:
+		return newSandboxProcessor(h.MaxLatency), nil
+	case ProcessorRemittance:
+		return nil, errors.New("insurance payments are reversed by the payer's remittance advice, not through the payment API")
+	default:
+		return nil, fmt.Errorf("the payment was authorized by %s, which this gateway is not configured for", txn.Processor)
+	}
+}
+
+// changeTransaction applies a capture, refund, void or approval to a recorded payment under the
+// transaction's lock, passes it to the processor that authorized the payment, records
+// it and audits the outcome for SOX, refused and failed attempts included
+func (h PaymentHandler) changeTransaction(w http.ResponseWriter, r *http.Request, change string, apply func(PaymentProcessor, *Transaction, TransactionChangeRequest, time.Time) (string, error)) {
+	h.setSecurityHeaders(w)
+	id := chi.URLParam(r, "transactionID")
+
+	var req TransactionChangeRequest
+	raw, err := readPayload(w, r)
+	if errors.Is(err, errPayloadTooLarge) {
+		http.Error(w, "request entity too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err == nil && len(strings.TrimSpace(string(raw))) > 0 {
+		err = json.Unmarshal(raw, &req)
+	}
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Reason) > maxChangeReason {
+		http.Error(w, fmt.Sprintf("reason must be at most %d characters", maxChangeReason), http.StatusBadRequest)
+		return
+	}
+
+	userID := "unauthenticated"
+	if identity, ok := auth.FromContext(r.Context()); ok {
+		userID = identity.UserID
+	}
+	action := strings.ToUpper(change)
+
+	unlock := lockTransaction(id)
+	defer unlock()
+	txn, err := h.Repository.Get(r.Context(), id)
+	if errors.Is(err, ErrTransactionNotFound) {
+		http.Error(w, "Transaction not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Str("transaction_id", id).Msg("Failed to read transaction")
+		http.Error(w, "Failed to read transaction", http.StatusServiceUnavailable)
+		return
+	}
+	h.Transactions.checkDecoys(r, change, []Transaction{txn})
+
+	processor, err := h.processorFor(txn)
+	var details string
+	if err == nil {
+		details, err = apply(processor, &txn, req, time.Now().UTC())
+	}
+	if errors.Is(err, ErrProcessorUnavailable) {
+		log.Error().Err(err).Str("transaction_id", id).Str("change", change).Msg("Payment processor unavailable")
+		RecordTransactionChange(change, "failed")
+		_ = h.SOX.RecordTransactionChange(id, action+"_FAILED", userID, r.RemoteAddr, err.Error())
+		http.Error(w, "payment processor unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		RecordTransactionChange(change, "rejected")
+		_ = h.SOX.RecordTransactionChange(id, action+"_REJECTED", userID, r.RemoteAddr, err.Error())
+		status := http.StatusConflict
+		switch {
+		case errors.Is(err, ErrInvalidAmount):
+			status = http.StatusUnprocessableEntity
+		case errors.Is(err, ErrApprovalForbidden):
+			status = http.StatusForbidden
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	// The change is audited before it is saved, and not saved unaudited
+	if err := h.SOX.RecordTransactionChange(id, action, userID, r.RemoteAddr, details); err != nil {
+		RecordTransactionChange(change, "failed")
+		http.Error(w, ErrAuditTrailUnavailable.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err := h.Repository.Save(r.Context(), txn); err != nil {
+		log.Error().Err(err).Str("transaction_id", id).Str("change", change).Msg("Failed to record transaction change")
+		RecordTransactionChange(change, "failed")
+		http.Error(w, errTransactionNotRecorded.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	h.Transactions.Update(txn)
+	RecordTransactionChange(change, "ok")
+	if change == ChangeRefund {
+		refund := txn.Refunds[len(txn.Refunds)-1]
+		kind := "partial"
+		if refund.Amount.AmountMinor == txn.Amount.AmountMinor {
+			kind = "full"
+		}
+		RecordRefund(kind, refund.Amount)
+		h.Webhooks.Publish(EventRefundIssued, refundIssued(txn, ""))
+	}
+	if change == ChangeCapture {
+		streamEvent(h.Events, EventPaymentCaptured, "transaction/"+txn.ID, paymentCaptured(txn, userID))
+	}
+
+	w.Header().Set("X-SOX-Compliance", "true")
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(txn)
+}
+
+// formatMoney renders an amount in minor units with its currency, e.g. 2500 USD
+func formatMoney(m Money) string {
+	return fmt.Sprintf("%d %s", m.AmountMinor, m.Currency)
+}
+
+func reasonOrNone(reason string) string {
+	if reason == "" {
+		return "no reason given"
+	}
+	return reason
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestTransactionStateMachine(t *testing.T) {
+	at := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	txn := testTransaction("TXN-1", 10000, "cust-1", "", "Cardiology consult", at)
+
+	if _, err := txn.Refund(nil, "", "AUDIT-1", at); !errors.Is(err, errInvalidTransition) {
+		t.Fatalf("expected an authorized payment to refuse a refund, got %v", err)
+	}
+	if err := txn.Capture(at); err != nil {
+		t.Fatal(err)
+	}
+	if err := txn.Capture(at); !errors.Is(err, errInvalidTransition) {
+		t.Fatalf("expected a second capture to be refused, got %v", err)
+	}
+	if err := txn.Void(at); !errors.Is(err, errInvalidTransition) {
+		t.Fatalf("expected a captured payment to refuse a void, got %v", err)
+	}
+
+	if _, err := txn.Refund(&Money{AmountMinor: 100, Currency: "EUR"}, "", "AUDIT-2", at); !errors.Is(err, ErrInvalidAmount) {
+		t.Fatalf("expected another currency to be refused, got %v", err)
+	}
+	if _, err := txn.Refund(&Money{AmountMinor: 10001, Currency: "USD"}, "", "AUDIT-2", at); !errors.Is(err, ErrInvalidAmount) {
+		t.Fatalf("expected more than the payment to be refused, got %v", err)
+	}
+	if _, err := txn.Refund(&Money{AmountMinor: 2500, Currency: "usd"}, "Duplicate charge", "AUDIT-2", at); err != nil {
+		t.Fatal(err)
+	}
+	if txn.Status != StatusPartiallyRefunded || txn.Refundable().AmountMinor != 7500 {
+		t.Fatalf("expected 7500 left to refund, got %s with %+v", txn.Status, txn.Refundable())
+	}
+	refund, err := txn.Refund(nil, "", "AUDIT-3", at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refund.Amount.AmountMinor != 7500 || txn.Status != StatusRefunded || len(txn.Refunds) != 2 || txn.Refunded.AmountMinor != 10000 {
+		t.Fatalf("expected the rest refunded, got %+v", txn)
+	}
+	if _, err := txn.Refund(nil, "", "AUDIT-4", at); !errors.Is(err, errInvalidTransition) {
+		t.Fatalf("expected a refunded payment to refuse another refund, got %v", err)
+	}
+
+	voided := testTransaction("TXN-2", 900, "cust-1", "", "Pharmacy", at)
+	if err := voided.Void(at); err != nil || voided.Status != StatusVoided || voided.VoidedAt == nil {
+		t.Fatalf("expected an authorized payment to be voided, got %v with %+v", err, voided)
+	}
+	if err := voided.Capture(at); !errors.Is(err, errInvalidTransition) {
+		t.Fatalf("expected a voided payment to refuse a capture, got %v", err)
+	}
+}
+
+func TestTransactionStoreUpdate(t *testing.T) {
+	s := NewTransactionStore()
+	at := time.Now()
+	txn := testTransaction("TXN-1", 2500, "cust-1", "", "Lab panel", at)
+	s.Add(txn)
+	s.Add(testTransaction("TXN-2", 900, "cust-2", "", "Pharmacy", at))
+
+	if err := txn.Capture(at); err != nil {
+		t.Fatal(err)
+	}
+	s.Update(txn)
+	if s.Len() != 2 {
+		t.Fatalf("expected the update to replace the transaction, got %d transactions", s.Len())
+	}
+	results := s.Search(TransactionQuery{Text: "lab"})
+	if len(results) != 1 || results[0].Status != StatusCaptured {
+		t.Fatalf("expected the captured transaction once, got %+v", results)
+	}
+	if results := s.Search(TransactionQuery{}); results[0].ID != "TXN-2" {
+		t.Fatalf("expected the update to keep the transaction's place, got %+v", results)
+	}
+}
+
+func TestRefundAndVoidEndpoints(t *testing.T) {
+	at := time.Now().UTC()
+	repository := newMemoryRepository(10)
+	h := PaymentHandler{
+		Repository:   repository,
+		Transactions: NewTransactionStore(),
+		SOX:          &SOXFinancialControlManager{},
+	}
+	for _, txn := range []Transaction{
+		testTransaction("TXN-1", 10000, "cust-1", "", "Surgery deposit", at),
+		testTransaction("TXN-2", 900, "cust-2", "", "Pharmacy", at),
+	} {
+		if err := repository.Save(t.Context(), txn); err != nil {
+			t.Fatal(err)
+		}
+		h.Transactions.Add(txn)
+	}
+
+	r := chi.NewRouter()
+	r.Post("/api/v1/transactions/{transactionID}/capture", h.CaptureTransactionHandler)
+	r.Post("/api/v1/transactions/{transactionID}/refund", h.RefundTransactionHandler)
+	r.Post("/api/v1/transactions/{transactionID}/void", h.VoidTransactionHandler)
+	post := func(path, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body)))
+		return rr
+	}
+
+	if rr := post("/api/v1/transactions/TXN-1/refund", ""); rr.Code != http.StatusConflict {
+		t.Fatalf("refund before capture expected 409, got %d", rr.Code)
+	}
+	if rr := post("/api/v1/transactions/TXN-1/capture", ""); rr.Code != http.StatusOK {
+		t.Fatalf("capture expected 200, got %d: %s", rr.Code, rr.Body)
+	}
+	if rr := post("/api/v1/transactions/TXN-1/void", ""); rr.Code != http.StatusConflict {
+		t.Fatalf("void after capture expected 409, got %d", rr.Code)
+	}
+	if rr := post("/api/v1/transactions/TXN-1/refund", `{"amount": {"amount_minor": 20000, "currency": "USD"}}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("over-refund expected 422, got %d", rr.Code)
+	}
+	if rr := post("/api/v1/transactions/TXN-1/refund", `{"amount": 5`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("malformed body expected 400, got %d", rr.Code)
+	}
+
+	rr := post("/api/v1/transactions/TXN-1/refund", `{"amount": {"amount_minor": 4000, "currency": "USD"}, "reason": "Procedure shortened"}`)
+	if rr.Code != http.StatusOK || rr.Header().Get("X-SOX-Compliance") != "true" {
+		t.Fatalf("partial refund expected 200 with the SOX header, got %d: %s", rr.Code, rr.Body)
+	}
+	var txn Transaction
+	if err := json.NewDecoder(rr.Body).Decode(&txn); err != nil {
+		t.Fatal(err)
+	}
+	if txn.Status != StatusPartiallyRefunded || txn.Refunded.AmountMinor != 4000 || txn.Refunds[0].Reason != "Procedure shortened" {
+		t.Fatalf("unexpected partially refunded transaction: %+v", txn)
+	}
+
+	if rr := post("/api/v1/transactions/TXN-1/refund", ""); rr.Code != http.StatusOK {
+		t.Fatalf("refund of the rest expected 200, got %d", rr.Code)
+	}
+	stored, err := repository.Get(t.Context(), "TXN-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != StatusRefunded || len(stored.Refunds) != 2 || stored.Refunds[1].Amount.AmountMinor != 6000 {
+		t.Fatalf("expected the repository to record both refunds, got %+v", stored)
+	}
+	if results := h.Transactions.Search(TransactionQuery{Text: "surgery"}); len(results) != 1 || results[0].Status != StatusRefunded {
+		t.Fatalf("expected the search index to follow the refund, got %+v", results)
+	}
+
+	if rr := post("/api/v1/transactions/TXN-2/void", `{"reason": "Entered twice"}`); rr.Code != http.StatusOK {
+		t.Fatalf("void expected 200, got %d", rr.Code)
+	}
+	if rr := post("/api/v1/transactions/TXN-404/void", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("unknown transaction expected 404, got %d", rr.Code)
+	}
+
+	audits := h.SOX.RecentAuditTrails(20)
+	actions := ""
+	for _, a := range audits {
+		actions += a.Action + " "
+	}
+	want := "VOID REFUND REFUND REFUND_REJECTED VOID_REJECTED CAPTURE REFUND_REJECTED "
+	if actions != want {
+		t.Fatalf("expected SOX entries %q, got %q", want, actions)
+	}
+	if audits[0].TransactionID != "TXN-2" || audits[0].UserID != "unauthenticated" {
+		t.Fatalf("unexpected SOX entry: %+v", audits[0])
+	}
+}
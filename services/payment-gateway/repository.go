@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// maxMemoryTransactions bounds the in-memory repository; the oldest transactions are
+// dropped once it is full
+const maxMemoryTransactions = 100000
+
+// ErrTransactionNotFound is returned by Get for an unknown transaction ID
+var ErrTransactionNotFound = errors.New("transaction not found")
+
+// errTransactionNotRecorded wraps a repository failure while authorizing a payment; the
+// payment is refused rather than left unrecorded
+var errTransactionNotRecorded = errors.New("transaction could not be recorded")
+
+// TransactionFilter selects transactions to list. Every set field must match.
+type TransactionFilter struct {
+	PatientID string
+	Status    string
+	// From and To bound the processing time, inclusive
+	From time.Time
+	To   time.Time
+	// Limit and Offset page the results, newest first
+	Limit  int
+	Offset int
+}
+
+// matches reports whether txn passes the filter's conditions
+func (f TransactionFilter) matches(txn *Transaction) bool {
+	switch {
+	case f.PatientID != "" && txn.PatientID != f.PatientID:
+		return false
+	case f.Status != "" && txn.Status != f.Status:
+		return false
+	case !f.From.IsZero() && txn.ProcessedAt.Before(f.From):
+		return false
+	case !f.To.IsZero() && txn.ProcessedAt.After(f.To):
+		return false
+	}
+	return true
+}
+
+// TransactionRepository is the system of record for authorized payments. The search
+// index in TransactionStore is rebuilt from traffic and may drop old transactions; the
+// repository keeps every one.
+type TransactionRepository interface {
+	// Save records a transaction; saving an ID again replaces it
+	Save(ctx context.Context, txn Transaction) error
+	// Get returns the transaction with id or ErrTransactionNotFound
+	Get(ctx context.Context, id string) (Transaction, error)
+	// List returns one page of matching transactions, newest first, and how many match
+	// in total
+	List(ctx context.Context, filter TransactionFilter) ([]Transaction, int, error)
+	// Ping checks the repository can be reached, for readiness
+	Ping(ctx context.Context) error
+}
+
+// openTransactionRepository connects to Postgres at DATABASE_URL, or keeps
+// transactions in memory when it is unset
+func openTransactionRepository(ctx context.Context, cfg Config) (TransactionRepository, error) {
+	if cfg.DatabaseURL == "" {
+		return newMemoryRepository(maxMemoryTransactions), nil
+	}
+	return openPostgresRepository(ctx, cfg.DatabaseDriver, cfg.DatabaseURL)
+}
+
+// memoryRepository keeps transactions in memory, for development and single-replica
+// installs without a database. Transactions are lost on restart.
+type memoryRepository struct {
+	mu    sync.RWMutex
+	byID  map[string]*Transaction
+	order []string // IDs in insertion order, oldest first
+	limit int
+}
+
+func newMemoryRepository(limit int) *memoryRepository {
+	return &memoryRepository{byID: make(map[string]*Transaction), limit: limit}
+}
+
+func (m *memoryRepository) Save(ctx context.Context, txn Transaction) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.byID[txn.ID]; !ok {
+		m.order = append(m.order, txn.ID)
+	}
+	m.byID[txn.ID] = &txn
+	for len(m.order) > m.limit {
+		delete(m.byID, m.order[0])
+		m.order = m.order[1:]
+	}
+	return nil
+}
+
+func (m *memoryRepository) Get(ctx context.Context, id string) (Transaction, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	txn, ok := m.byID[id]
+	if !ok {
+		return Transaction{}, ErrTransactionNotFound
+	}
+	return *txn, nil
+}
+
+func (m *memoryRepository) List(ctx context.Context, filter TransactionFilter) ([]Transaction, int, error) {
+	m.mu.RLock()
+	matched := []Transaction{}
+	for _, id := range m.order {
+		if txn := m.byID[id]; filter.matches(txn) {
+			matched = append(matched, *txn)
+		}
+	}
+	m.mu.RUnlock()
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		if !matched[i].ProcessedAt.Equal(matched[j].ProcessedAt) {
+			return matched[i].ProcessedAt.After(matched[j].ProcessedAt)
+		}
+		return matched[i].ID > matched[j].ID
+	})
+	total := len(matched)
+	if filter.Offset > total {
+		filter.Offset = total
+	}
+	matched = matched[filter.Offset:]
+	if filter.Limit > 0 && len(matched) > filter.Limit {
+		matched = matched[:filter.Limit]
+	}
+	return matched, total, nil
+}
+
+func (m *memoryRepository) Ping(ctx context.Context) error {
+	return nil
+}
+
+// parseTransactionFilter reads the list filters and paging from query parameters
+func parseTransactionFilter(r *http.Request) (TransactionFilter, error) {
+	query := r.URL.Query()
+	f := TransactionFilter{
+		PatientID: query.Get("patient_id"),
+		Status:    query.Get("status"),
+		Limit:     defaultTransactionPageSize,
+	}
+	for name, dst := range map[string]*time.Time{"from": &f.From, "to": &f.To} {
+		if value := query.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return f, fmt.Errorf("%s must be an RFC 3339 timestamp", name)
+			}
+			*dst = t
+		}
+	}
+	if !f.From.IsZero() && !f.To.IsZero() && f.From.After(f.To) {
+		return f, fmt.Errorf("from must not be after to")
+	}
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxTransactionPageSize {
+			return f, fmt.Errorf("limit must be between 1 and %d", maxTransactionPageSize)
+		}
+		f.Limit = n
+	}
+	if value := query.Get("offset"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return f, fmt.Errorf("offset must be a non-negative integer")
+		}
+		f.Offset = n
+	}
+	return f, nil
+}
+
+// ListTransactionsHandler handles GET /api/v1/transactions: recorded transactions
+// filtered by patient, status and processing time, newest first
+func (h PaymentHandler) ListTransactionsHandler(w http.ResponseWriter, r *http.Request) {
+	h.setSecurityHeaders(w)
+	filter, err := parseTransactionFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	transactions, total, err := h.Repository.List(r.Context(), filter)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list transactions")
+		http.Error(w, "Failed to list transactions", http.StatusServiceUnavailable)
+		return
+	}
+	page := TransactionPage{Transactions: transactions, Count: len(transactions), Total: total}
+	if next := filter.Offset + len(transactions); next < total {
+		page.NextOffset = &next
+	}
+	RecordTransactionSearch("list", page.Count)
+	h.Transactions.checkDecoys(r, "list", transactions)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(page)
+}
+
+// GetTransactionHandler handles GET /api/v1/transactions/{transactionID}
+func (h PaymentHandler) GetTransactionHandler(w http.ResponseWriter, r *http.Request) {
+	h.setSecurityHeaders(w)
+	txn, err := h.Repository.Get(r.Context(), chi.URLParam(r, "transactionID"))
+	if errors.Is(err, ErrTransactionNotFound) {
+		http.Error(w, "Transaction not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to read transaction")
+		http.Error(w, "Failed to read transaction", http.StatusServiceUnavailable)
+		return
+	}
+	h.Transactions.checkDecoys(r, "get", []Transaction{txn})
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(txn)
+}
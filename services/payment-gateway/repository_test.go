@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryRepositoryList(t *testing.T) {
+	repo := newMemoryRepository(3)
+	ctx := context.Background()
+	at := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	for i, patient := range []string{"pat-1", "pat-2", "pat-1", "pat-1"} {
+		txn := testTransaction("TXN-"+string(rune('1'+i)), 2500, "cust-1", patient, "Copay", at.Add(time.Duration(i)*time.Hour))
+		if i == 2 {
+			txn.Status = "declined"
+		}
+		if err := repo.Save(ctx, txn); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ids := func(filter TransactionFilter) string {
+		results, total, err := repo.List(ctx, filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := []string{}
+		for _, txn := range results {
+			out = append(out, txn.ID)
+		}
+		return strings.Join(out, " ") + " of " + string(rune('0'+total))
+	}
+	cases := []struct {
+		name   string
+		filter TransactionFilter
+		want   string
+	}{
+		// The oldest transaction was dropped once the repository was full
+		{"everything newest first", TransactionFilter{}, "TXN-4 TXN-3 TXN-2 of 3"},
+		{"patient", TransactionFilter{PatientID: "pat-1"}, "TXN-4 TXN-3 of 2"},
+		{"status", TransactionFilter{Status: "authorized"}, "TXN-4 TXN-2 of 2"},
+		{"time range", TransactionFilter{From: at.Add(time.Hour), To: at.Add(2 * time.Hour)}, "TXN-3 TXN-2 of 2"},
+		{"page", TransactionFilter{Limit: 1, Offset: 1}, "TXN-3 of 3"},
+	}
+	for _, tc := range cases {
+		if got := ids(tc.filter); got != tc.want {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.want, got)
+		}
+	}
+	if _, err := repo.Get(ctx, "TXN-1"); !errors.Is(err, ErrTransactionNotFound) {
+		t.Fatalf("expected the dropped transaction to be gone, got %v", err)
+	}
+}
+
+// TestTransactionAPI tests that authorized payments are recorded and can be listed
+// and fetched by ID
+func TestTransactionAPI(t *testing.T) {
+	h := newAuthenticatedServer(t)
+
+	var ids []string
+	for _, patient := range []string{"PT-1", "PT-2", "PT-1"} {
+		body := `{"amount": {"amount_minor": 4200, "currency": "USD"}, "customer_id": "CUST-1", "method": "card", "patient_id": "` + patient + `"}`
+		req := httptest.NewRequest(http.MethodPost, "/api/v2/payments", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer writer")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var created struct {
+			ID string `json:"id"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&created); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, created.ID)
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer reader")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get("/api/v1/transactions?patient_id=PT-1&status=authorized&limit=1")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var page TransactionPage
+	if err := json.NewDecoder(rr.Body).Decode(&page); err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 2 || page.Count != 1 || page.NextOffset == nil || *page.NextOffset != 1 || page.Transactions[0].PatientID != "PT-1" {
+		t.Fatalf("unexpected page: %+v", page)
+	}
+
+	rr = get("/api/v1/transactions/" + ids[1])
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	var txn Transaction
+	if err := json.NewDecoder(rr.Body).Decode(&txn); err != nil {
+		t.Fatal(err)
+	}
+	if txn.ID != ids[1] || txn.PatientID != "PT-2" || txn.Amount.AmountMinor != 4200 {
+		t.Fatalf("unexpected transaction: %+v", txn)
+	}
+
+	for path, want := range map[string]int{
+		"/api/v1/transactions/TXN-unknown":                                       http.StatusNotFound,
+		"/api/v1/transactions?from=yesterday":                                    http.StatusBadRequest,
+		"/api/v1/transactions?limit=501":                                         http.StatusBadRequest,
+		"/api/v1/transactions?from=2026-03-02T00:00:00Z&to=2026-03-01T00:00:00Z": http.StatusBadRequest,
+	} {
+		if rr := get(path); rr.Code != want {
+			t.Errorf("%s: expected %d, got %d", path, want, rr.Code)
+		}
+	}
+}
+
+// failingRepository refuses every operation, as an unreachable database would
+type failingRepository struct{}
+
+var errDatabaseDown = errors.New("connection refused")
+
+func (failingRepository) Save(context.Context, Transaction) error { return errDatabaseDown }
+func (failingRepository) Get(context.Context, string) (Transaction, error) {
+	return Transaction{}, errDatabaseDown
+}
+func (failingRepository) List(context.Context, TransactionFilter) ([]Transaction, int, error) {
+	return nil, 0, errDatabaseDown
+}
+func (failingRepository) Ping(context.Context) error { return errDatabaseDown }
+
+// TestUnrecordedPaymentIsRefused tests that a payment the repository cannot record is
+// refused and readiness fails
+func TestUnrecordedPaymentIsRefused(t *testing.T) {
+	h := PaymentHandler{MaxLatency: 50 * time.Millisecond, Repository: failingRepository{}, Transactions: NewTransactionStore()}
+
+	rr := httptest.NewRecorder()
+	h.Charge(rr, httptest.NewRequest(http.MethodPost, "/charge", strings.NewReader(`{"amount_cents": 1500, "currency": "USD", "customer_id": "CUST-1", "method": "card"}`)))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if h.Transactions.Len() != 0 {
+		t.Fatal("expected the refused payment not to be indexed")
+	}
+
+	rr = httptest.NewRecorder()
+	h.Readiness(rr, httptest.NewRequest(http.MethodGet, "/readiness", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected readiness to fail, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/healthcare-gitops/common/config"
+	"github.com/rs/zerolog/log"
+)
+
+// Risk decisions. A denied payment is declined before the processor is asked; one sent
+// for review is authorized but held for approval like a high-value payment.
+const (
+	RiskAllow  = "allow"
+	RiskReview = "review"
+	RiskDeny   = "deny"
+)
+
+// Risk scorers RISK_SCORER selects
+const (
+	RiskScorerRules = "rules"
+	RiskScorerOff   = "off"
+)
+
+// Signals the rules scorer raises, with the score each adds
+const (
+	RiskSignalCustomerVelocity = "customer_velocity"
+	RiskSignalPatientVelocity  = "patient_velocity"
+	RiskSignalIPVelocity       = "ip_velocity"
+	RiskSignalAmountAnomaly    = "amount_anomaly"
+	RiskSignalBlockedCountry   = "blocked_country"
+	RiskSignalBlockedNetwork   = "blocked_network"
+)
+
+var riskSignalScores = map[string]int{
+	RiskSignalCustomerVelocity: 40,
+	RiskSignalPatientVelocity:  40,
+	RiskSignalIPVelocity:       30,
+	RiskSignalAmountAnomaly:    30,
+	RiskSignalBlockedCountry:   80,
+	RiskSignalBlockedNetwork:   100,
+}
+
+// maxRiskScore caps a payment's score
+const maxRiskScore = 100
+
+// Bounds on the rules scorer's history: the amounts kept per customer, how long a
+// customer's amounts are kept, and the keys held before stale ones are swept
+const (
+	riskAmountHistory    = 20
+	riskAmountHistoryTTL = 30 * 24 * time.Hour
+	maxRiskKeys          = 100000
+)
+
+// RiskInput is what a payment is scored on
+type RiskInput struct {
+	TransactionID string
+	CustomerID    string
+	PatientID     string
+	// Amount is in the reporting currency where exchange rates are configured
+	Amount   Money
+	ClientIP string
+	// Country is the ISO 3166 code the edge proxy geolocated the client to, if any
+	Country string
+	At      time.Time
+}
+
+// RiskAssessment is a scorer's verdict on a payment, recorded on its transaction
+type RiskAssessment struct {
+	Scorer     string    `json:"scorer"`
+	Score      int       `json:"score"`
+	Decision   string    `json:"decision"`
+	Signals    []string  `json:"signals,omitempty"`
+	AssessedAt time.Time `json:"assessed_at"`
+}
+
+// RiskScorer scores payments before they are authorized. The rules scorer is built
+// in; another is plugged in by implementing this and setting PaymentHandler.Risk.
+type RiskScorer interface {
+	// Name identifies the scorer on its assessments and metrics
+	Name() string
+	// Score assesses a validated payment. An error sends the payment for review.
+	Score(ctx context.Context, in RiskInput) (RiskAssessment, error)
+}
+
+// RiskConfig selects and configures the risk scorer
+type RiskConfig struct {
+	// Scorer is rules or off; empty means off
+	Scorer string
+	// CountryHeader carries the ISO 3166 code the edge proxy geolocated the client to
+	CountryHeader string
+	Rules         RiskRulesConfig
+}
+
+// RiskRulesConfig tunes the rules scorer
+type RiskRulesConfig struct {
+	// Payments scoring ReviewScore or more are held for review, DenyScore or more
+	// declined
+	ReviewScore int
+	DenyScore   int
+	// VelocityWindow is the period payments are counted over. More than
+	// VelocityLimit payments by one customer or for one patient, or payments for more
+	// than IPCustomerLimit customers from one client IP, raise a velocity signal.
+	VelocityWindow  time.Duration
+	VelocityLimit   int
+	IPCustomerLimit int
+	// AnomalyFactor flags payments over this multiple of the customer's average; a
+	// customer needs three earlier payments to have an average
+	AnomalyFactor float64
+	// BlockedNetworks are CIDRs payments are never accepted from
+	BlockedNetworks []string
+	// BlockedCountries are ISO 3166 alpha-2 codes
+	BlockedCountries []string
+}
+
+// riskConfigFromEnv reads RISK_*
+func riskConfigFromEnv() RiskConfig {
+	review, _ := strconv.Atoi(config.GetEnv("RISK_REVIEW_SCORE", "50"))
+	deny, _ := strconv.Atoi(config.GetEnv("RISK_DENY_SCORE", "80"))
+	window, _ := strconv.Atoi(config.GetEnv("RISK_VELOCITY_WINDOW_SECONDS", "3600"))
+	velocity, _ := strconv.Atoi(config.GetEnv("RISK_VELOCITY_LIMIT", "10"))
+	ipCustomers, _ := strconv.Atoi(config.GetEnv("RISK_IP_CUSTOMER_LIMIT", "5"))
+	factor, _ := strconv.ParseFloat(config.GetEnv("RISK_AMOUNT_ANOMALY_FACTOR", "5"), 64)
+	return RiskConfig{
+		Scorer:        config.GetEnv("RISK_SCORER", RiskScorerRules),
+		CountryHeader: config.GetEnv("RISK_COUNTRY_HEADER", "X-Client-Country"),
+		Rules: RiskRulesConfig{
+			ReviewScore:      review,
+			DenyScore:        deny,
+			VelocityWindow:   time.Duration(window) * time.Second,
+			VelocityLimit:    velocity,
+			IPCustomerLimit:  ipCustomers,
+			AnomalyFactor:    factor,
+			BlockedNetworks:  splitList(config.GetEnv("RISK_BLOCKED_NETWORKS", "")),
+			BlockedCountries: splitList(strings.ToUpper(config.GetEnv("RISK_BLOCKED_COUNTRIES", ""))),
+		},
+	}
+}
+
+// splitList splits a comma-separated list, dropping empty entries
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// newRiskScorer builds the configured scorer, or nil when scoring is off
+func newRiskScorer(cfg RiskConfig) (RiskScorer, error) {
+	switch strings.ToLower(cfg.Scorer) {
+	case "", RiskScorerOff:
+		return nil, nil
+	case RiskScorerRules:
+		return newRulesRiskScorer(cfg.Rules)
+	default:
+		return nil, fmt.Errorf("unknown RISK_SCORER %q; use rules or off", cfg.Scorer)
+	}
+}
+
+// rulesRiskScorer adds up the signals a payment raises. Its history is in memory and
+// per replica, so velocity restarts after a failover.
+type rulesRiskScorer struct {
+	cfg      RiskRulesConfig
+	networks []*net.IPNet
+	blocked  map[string]bool
+
+	mu sync.Mutex
+	// payments holds the times of recent payments by customer: and patient: key,
+	// ipCustomers the customers recently seen from each client IP, and amounts each
+	// customer's recent amounts
+	payments    map[string][]time.Time
+	ipCustomers map[string]map[string]time.Time
+	amounts     map[string]*riskAmounts
+}
+
+// riskAmounts is a customer's recent payment amounts in minor units
+type riskAmounts struct {
+	currency string
+	minor    []int64
+	lastSeen time.Time
+}
+
+func newRulesRiskScorer(cfg RiskRulesConfig) (*rulesRiskScorer, error) {
+	if cfg.ReviewScore <= 0 || cfg.DenyScore < cfg.ReviewScore || cfg.DenyScore > maxRiskScore {
+		return nil, fmt.Errorf("RISK_REVIEW_SCORE and RISK_DENY_SCORE must satisfy 0 < review <= deny <= %d", maxRiskScore)
+	}
+	if cfg.VelocityWindow <= 0 || cfg.VelocityLimit <= 0 || cfg.IPCustomerLimit <= 0 {
+		return nil, errors.New("RISK_VELOCITY_WINDOW_SECONDS, RISK_VELOCITY_LIMIT and RISK_IP_CUSTOMER_LIMIT must be positive")
+	}
+	if cfg.AnomalyFactor <= 1 {
+		return nil, errors.New("RISK_AMOUNT_ANOMALY_FACTOR must be greater than 1")
+	}
+	s := &rulesRiskScorer{
+		cfg:         cfg,
+		blocked:     make(map[string]bool),
+		payments:    make(map[string][]time.Time),
+		ipCustomers: make(map[string]map[string]time.Time),
+		amounts:     make(map[string]*riskAmounts),
+	}
+	for _, cidr := range cfg.BlockedNetworks {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("RISK_BLOCKED_NETWORKS: %w", err)
+		}
+		s.networks = append(s.networks, network)
+	}
+	for _, country := range cfg.BlockedCountries {
+		if len(country) != 2 {
+			return nil, fmt.Errorf("RISK_BLOCKED_COUNTRIES: %q is not an ISO 3166 alpha-2 code", country)
+		}
+		s.blocked[strings.ToUpper(country)] = true
+	}
+	return s, nil
+}
+
+func (s *rulesRiskScorer) Name() string { return RiskScorerRules }
+
+// Score records the payment in the scorer's history and scores it against the
+// payments before it
+func (s *rulesRiskScorer) Score(_ context.Context, in RiskInput) (RiskAssessment, error) {
+	var signals []string
+	if ip := net.ParseIP(in.ClientIP); ip != nil {
+		for _, network := range s.networks {
+			if network.Contains(ip) {
+				signals = append(signals, RiskSignalBlockedNetwork)
+				break
+			}
+		}
+	}
+	if s.blocked[strings.ToUpper(in.Country)] {
+		signals = append(signals, RiskSignalBlockedCountry)
+	}
+
+	s.mu.Lock()
+	s.sweepLocked(in.At)
+	if s.countLocked("customer:"+in.CustomerID, in.At) > s.cfg.VelocityLimit {
+		signals = append(signals, RiskSignalCustomerVelocity)
+	}
+	if in.PatientID != "" && s.countLocked("patient:"+in.PatientID, in.At) > s.cfg.VelocityLimit {
+		signals = append(signals, RiskSignalPatientVelocity)
+	}
+	if in.ClientIP != "" && s.customersFromLocked(in.ClientIP, in.CustomerID, in.At) > s.cfg.IPCustomerLimit {
+		signals = append(signals, RiskSignalIPVelocity)
+	}
+	if s.anomalousLocked(in.CustomerID, in.Amount, in.At) {
+		signals = append(signals, RiskSignalAmountAnomaly)
+	}
+	s.mu.Unlock()
+
+	score := 0
+	for _, signal := range signals {
+		score += riskSignalScores[signal]
+	}
+	if score > maxRiskScore {
+		score = maxRiskScore
+	}
+	decision := RiskAllow
+	switch {
+	case score >= s.cfg.DenyScore:
+		decision = RiskDeny
+	case score >= s.cfg.ReviewScore:
+		decision = RiskReview
+	}
+	return RiskAssessment{Scorer: s.Name(), Score: score, Decision: decision, Signals: signals, AssessedAt: in.At}, nil
+}
+
+// countLocked records a payment under key and returns the payments under it within
+// the window, this one included
+func (s *rulesRiskScorer) countLocked(key string, at time.Time) int {
+	times := append(s.recentLocked(s.payments[key], at), at)
+	s.payments[key] = times
+	return len(times)
+}
+
+// recentLocked drops the times that fell out of the window
+func (s *rulesRiskScorer) recentLocked(times []time.Time, at time.Time) []time.Time {
+	since := at.Add(-s.cfg.VelocityWindow)
+	i := sort.Search(len(times), func(i int) bool { return times[i].After(since) })
+	return times[i:]
+}
+
+// customersFromLocked records customerID paying from ip and returns how many
+// customers paid from it within the window
+func (s *rulesRiskScorer) customersFromLocked(ip, customerID string, at time.Time) int {
+	customers := s.ipCustomers[ip]
+	if customers == nil {
+		customers = make(map[string]time.Time)
+		s.ipCustomers[ip] = customers
+	}
+	customers[customerID] = at
+	since := at.Add(-s.cfg.VelocityWindow)
+	for id, seen := range customers {
+		if !seen.After(since) {
+			delete(customers, id)
+		}
+	}
+	return len(customers)
+}
+
+// anomalousLocked reports whether amount is over AnomalyFactor times the customer's
+// average, then adds it to their history. Amounts in another currency than the
+// history restart it.
+func (s *rulesRiskScorer) anomalousLocked(customerID string, amount Money, at time.Time) bool {
+	history := s.amounts[customerID]
+	if history == nil || history.currency != amount.Currency {
+		history = &riskAmounts{currency: amount.Currency}
+		s.amounts[customerID] = history
+	}
+	anomalous := false
+	if len(history.minor) >= 3 {
+		var total int64
+		for _, m := range history.minor {
+			total += m
+		}
+		average := float64(total) / float64(len(history.minor))
+		anomalous = float64(amount.AmountMinor) > s.cfg.AnomalyFactor*average
+	}
+	history.minor = append(history.minor, amount.AmountMinor)
+	if len(history.minor) > riskAmountHistory {
+		history.minor = history.minor[len(history.minor)-riskAmountHistory:]
+	}
+	history.lastSeen = at
+	return anomalous
+}
+
+// sweepLocked drops stale history once it holds more than maxRiskKeys keys
+func (s *rulesRiskScorer) sweepLocked(at time.Time) {
+	if len(s.payments)+len(s.ipCustomers)+len(s.amounts) <= maxRiskKeys {
+		return
+	}
+	for key, times := range s.payments {
+		if len(s.recentLocked(times, at)) == 0 {
+			delete(s.payments, key)
+		}
+	}
+	since := at.Add(-s.cfg.VelocityWindow)
+	for ip, customers := range s.ipCustomers {
+		for id, seen := range customers {
+			if !seen.After(since) {
+				delete(customers, id)
+			}
+		}
+		if len(customers) == 0 {
+			delete(s.ipCustomers, ip)
+		}
+	}
+	for id, history := range s.amounts {
+		if at.Sub(history.lastSeen) > riskAmountHistoryTTL {
+			delete(s.amounts, id)
+		}
+	}
+}
+
+// assessRisk scores a validated payment. A denied payment is returned with an error
+// wrapping ErrPaymentDeclined; a scorer that fails or returns no known decision sends
+// the payment for review rather than letting it through unscored. A nil scorer
+// assesses nothing.
+func (h PaymentHandler) assessRisk(r *http.Request, txnID string, req PaymentRequest, reporting *Money) (*RiskAssessment, error) {
+	if h.Risk == nil {
+		return nil, nil
+	}
+	in := RiskInput{
+		TransactionID: txnID,
+		CustomerID:    req.CustomerID,
+		PatientID:     req.PatientID,
+		Amount:        Money{AmountMinor: req.AmountCents, Currency: strings.ToUpper(req.Currency)},
+		ClientIP:      clientIP(r),
+		At:            time.Now().UTC(),
+	}
+	if reporting != nil {
+		in.Amount = *reporting
+	}
+	if h.RiskCountryHeader != "" {
+		in.Country = strings.ToUpper(strings.TrimSpace(r.Header.Get(h.RiskCountryHeader)))
+	}
+	assessment, err := h.Risk.Score(r.Context(), in)
+	switch {
+	case err != nil:
+		log.Error().Err(err).Str("transaction_id", txnID).Str("scorer", h.Risk.Name()).Msg("Risk scoring failed, holding payment for review")
+		assessment = RiskAssessment{Scorer: h.Risk.Name(), Decision: RiskReview, Signals: []string{"scorer_error"}, AssessedAt: in.At}
+	case assessment.Decision != RiskAllow && assessment.Decision != RiskReview && assessment.Decision != RiskDeny:
+		log.Error().Str("transaction_id", txnID).Str("scorer", h.Risk.Name()).Str("decision", assessment.Decision).Msg("Unknown risk decision, holding payment for review")
+		assessment.Decision = RiskReview
+	}
+	RecordRiskAssessment(assessment)
+	if assessment.Decision == RiskDeny {
+		log.Warn().Str("transaction_id", txnID).Int("score", assessment.Score).Strs("signals", assessment.Signals).Msg("Payment denied by risk scoring")
+		return &assessment, fmt.Errorf("%w: risk score %d (%s)", ErrPaymentDeclined, assessment.Score, strings.Join(assessment.Signals, ", "))
+	}
+	return &assessment, nil
+}
+
+// clientIP is the request's client address without its port; the trusted-proxy
+// middleware has already applied X-Forwarded-For
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func testRiskRules() RiskRulesConfig {
+	return RiskRulesConfig{
+		ReviewScore:      50,
+		DenyScore:        80,
+		VelocityWindow:   time.Hour,
+		VelocityLimit:    3,
+		IPCustomerLimit:  2,
+		AnomalyFactor:    5,
+		BlockedNetworks:  []string{"203.0.113.0/24"},
+		BlockedCountries: []string{"kp"},
+	}
+}
+
+func TestRulesRiskScorer(t *testing.T) {
+	scorer, err := newRulesRiskScorer(testRiskRules())
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2026, 3, 9, 10, 0, 0, 0, time.UTC)
+	score := func(in RiskInput) RiskAssessment {
+		t.Helper()
+		if in.At.IsZero() {
+			in.At = at
+		}
+		if in.Amount.Currency == "" {
+			in.Amount = Money{AmountMinor: 5000, Currency: "USD"}
+		}
+		a, err := scorer.Score(context.Background(), in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a
+	}
+
+	// Three earlier payments give the customer an average of 50.00
+	for i := 0; i < 3; i++ {
+		if a := score(RiskInput{CustomerID: "cust-1", ClientIP: "198.51.100.7"}); a.Decision != RiskAllow || a.Score != 0 {
+			t.Fatalf("payment %d expected allowed, got %+v", i, a)
+		}
+	}
+	a := score(RiskInput{CustomerID: "cust-1", ClientIP: "198.51.100.7", Amount: Money{AmountMinor: 30000, Currency: "USD"}})
+	if a.Decision != RiskReview || a.Score != 70 || !reflect.DeepEqual(a.Signals, []string{RiskSignalCustomerVelocity, RiskSignalAmountAnomaly}) {
+		t.Fatalf("expected the fourth, outsized payment in an hour reviewed, got %+v", a)
+	}
+	// The window slides: an hour later the customer is back under the limit
+	if a := score(RiskInput{CustomerID: "cust-1", At: at.Add(61 * time.Minute)}); a.Decision != RiskAllow {
+		t.Fatalf("expected the velocity window to slide, got %+v", a)
+	}
+
+	// Card testing: many customers from one address
+	for i, want := range []int{0, 0, 30} {
+		if a := score(RiskInput{CustomerID: fmt.Sprintf("probe-%d", i), ClientIP: "192.0.2.9"}); a.Score != want {
+			t.Fatalf("customer %d from one address expected score %d, got %+v", i, want, a)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		score(RiskInput{CustomerID: fmt.Sprintf("family-%d", i), PatientID: "PAT-1"})
+	}
+	if a := score(RiskInput{CustomerID: "family-3", PatientID: "PAT-1"}); !reflect.DeepEqual(a.Signals, []string{RiskSignalPatientVelocity}) {
+		t.Fatalf("expected patient velocity across customers, got %+v", a)
+	}
+
+	if a := score(RiskInput{CustomerID: "cust-2", ClientIP: "203.0.113.40"}); a.Decision != RiskDeny || a.Score != maxRiskScore {
+		t.Fatalf("expected a blocked network denied, got %+v", a)
+	}
+	if a := score(RiskInput{CustomerID: "cust-3", Country: "KP"}); a.Decision != RiskDeny || a.Signals[0] != RiskSignalBlockedCountry {
+		t.Fatalf("expected a blocked country denied, got %+v", a)
+	}
+}
+
+func TestNewRiskScorer(t *testing.T) {
+	if scorer, err := newRiskScorer(RiskConfig{}); scorer != nil || err != nil {
+		t.Fatalf("expected no scorer by default, got %v %v", scorer, err)
+	}
+	if scorer, err := newRiskScorer(RiskConfig{Scorer: "RULES", Rules: testRiskRules()}); err != nil || scorer.Name() != RiskScorerRules {
+		t.Fatalf("expected the rules scorer, got %v %v", scorer, err)
+	}
+	for name, mutate := range map[string]func(*RiskConfig){
+		"scorer":       func(c *RiskConfig) { c.Scorer = "ml" },
+		"deny below":   func(c *RiskConfig) { c.Rules.DenyScore = 40 },
+		"deny above":   func(c *RiskConfig) { c.Rules.DenyScore = 101 },
+		"window":       func(c *RiskConfig) { c.Rules.VelocityWindow = 0 },
+		"anomaly":      func(c *RiskConfig) { c.Rules.AnomalyFactor = 1 },
+		"network":      func(c *RiskConfig) { c.Rules.BlockedNetworks = []string{"203.0.113.0"} },
+		"country":      func(c *RiskConfig) { c.Rules.BlockedCountries = []string{"PRK"} },
+		"ip velocity":  func(c *RiskConfig) { c.Rules.IPCustomerLimit = 0 },
+		"review score": func(c *RiskConfig) { c.Rules.ReviewScore = 0 },
+	} {
+		cfg := RiskConfig{Scorer: RiskScorerRules, Rules: testRiskRules()}
+		mutate(&cfg)
+		if _, err := newRiskScorer(cfg); err == nil {
+			t.Errorf("%s: expected the configuration to be refused", name)
+		}
+	}
+}
+
+// failingRiskScorer stands in for a scorer whose backend is down
+type failingRiskScorer struct{}
+
+func (failingRiskScorer) Name() string { return "external" }
+
+func (failingRiskScorer) Score(context.Context, RiskInput) (RiskAssessment, error) {
+	return RiskAssessment{}, errors.New("scoring backend unreachable")
+}
+
+func TestPaymentRiskScoring(t *testing.T) {
+	scorer, err := newRulesRiskScorer(testRiskRules())
+	if err != nil {
+		t.Fatal(err)
+	}
+	repository := newMemoryRepository(10)
+	h := PaymentHandler{MaxLatency: time.Millisecond, Repository: repository, Risk: scorer, RiskCountryHeader: "X-Client-Country"}
+	r := chi.NewRouter()
+	// h.Risk is swapped below, so the route reads h when called
+	r.Post("/api/v2/payments", func(w http.ResponseWriter, r *http.Request) { h.CreatePayment(w, r) })
+	pay := func(customer, country string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v2/payments", bytes.NewBufferString(`{"amount": {"amount_minor": 2500, "currency": "USD"}, "customer_id": "`+customer+`", "method": "card"}`))
+		req.RemoteAddr = "198.51.100.7:52100"
+		req.Header.Set("X-Client-Country", country)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+	recorded := func(rr *httptest.ResponseRecorder) Transaction {
+		t.Helper()
+		var resp PaymentResponseV2
+		if rr.Code != http.StatusCreated || json.NewDecoder(rr.Body).Decode(&resp) != nil {
+			t.Fatalf("payment expected 201, got %d: %s", rr.Code, rr.Body)
+		}
+		txn, err := repository.Get(t.Context(), resp.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return txn
+	}
+
+	txn := recorded(pay("cust-1", "US"))
+	if txn.Status != StatusAuthorized || txn.Risk == nil || txn.Risk.Decision != RiskAllow || txn.Risk.Scorer != RiskScorerRules {
+		t.Fatalf("expected an allowed payment with its assessment, got %+v %+v", txn, txn.Risk)
+	}
+
+	rr := pay("cust-2", "kp")
+	var envelope ErrorEnvelope
+	if rr.Code != http.StatusPaymentRequired || json.NewDecoder(rr.Body).Decode(&envelope) != nil || envelope.Error.Code != ErrorCodeDeclined {
+		t.Fatalf("payment from a blocked country expected 402 payment_declined, got %d: %s", rr.Code, rr.Body)
+	}
+	if txns, _, _ := repository.List(t.Context(), TransactionFilter{}); len(txns) != 1 {
+		t.Fatalf("expected the denied payment not recorded, got %d transactions", len(txns))
+	}
+
+	// A third customer from one address raises IP velocity, and a fourth payment by
+	// cust-1 in the hour its own velocity; together they reach review
+	for i := 0; i < 2; i++ {
+		recorded(pay("cust-1", ""))
+	}
+	if txn := recorded(pay("cust-3", "")); txn.Status != StatusAuthorized || txn.Risk.Score != 30 {
+		t.Fatalf("expected IP velocity alone allowed, got %+v", txn.Risk)
+	}
+	txn = recorded(pay("cust-1", ""))
+	if txn.Status != StatusPendingApproval || txn.Approval == nil || txn.Approval.Reason != ApprovalReasonRiskReview || txn.Risk.Decision != RiskReview {
+		t.Fatalf("expected the payment held for review, got %+v %+v %+v", txn, txn.Approval, txn.Risk)
+	}
+	if txn.Approval.RequiredLevel != ApprovalLevelManager || txn.Approval.InitiatedBy != "unauthenticated" {
+		t.Fatalf("unexpected review approval: %+v", txn.Approval)
+	}
+
+	h.Risk = failingRiskScorer{}
+	txn = recorded(pay("cust-9", ""))
+	if txn.Status != StatusPendingApproval || txn.Risk.Decision != RiskReview || txn.Risk.Scorer != "external" {
+		t.Fatalf("expected a scorer failure to hold the payment for review, got %+v %+v", txn, txn.Risk)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/healthcare-gitops/common/selfscan"
+)
+
+// selfScanTarget describes this service to the security misconfiguration self-scan
+// served at /admin/selfscan
+func selfScanTarget(handler http.Handler, cfg Config) selfscan.Target {
+	return selfscan.Target{
+		Service: cfg.ServiceName,
+		Handler: handler,
+		// Every GET route only admins may call; TestSelfScanCoversAdminRoutes fails
+		// when one is missing
+		AdminRoutes: []string{
+			"/admin/observability/spec",
+			"/admin/selfscan",
+			"/admin/usage-stats",
+			"/admin/failover",
+			"/compliance/status",
+			"/audit/trail",
+			"/audit/trail/verify",
+			"/alerts",
+			"/usage",
+			"/api/v1/webhooks",
+			"/api/v1/webhooks/dead-letters",
+			"/api/v1/webhooks/{webhookID}",
+			"/api/v1/honeytokens",
+			"/api/v1/honeytokens/alerts",
+		},
+		Secrets: map[string]string{"SELFSCAN_TOKEN": cfg.SelfScanToken},
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/healthcare-gitops/common/selfscan"
+)
+
+func TestSelfScanReportsUnauthenticatedAdminRoutes(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "production")
+	t.Setenv("FEATURE_USAGE_METERING", "false")
+	h := NewServer(Config{Port: "0", ServiceName: "payment-gateway", MaxProcessingMillis: 50, SelfScanToken: "selfscan-token-for-payment-tests"}).Handler
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/admin/selfscan", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("self-scan without a token expected 401, got %d", rr.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/selfscan", nil)
+	req.Header.Set("X-Admin-Token", "selfscan-token-for-payment-tests")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("self-scan expected 200, got %d: %s", rr.Code, rr.Body)
+	}
+	var report selfscan.Report
+	if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	// Without auth-service the admin routes answer anonymous callers; /usage is switched
+	// off, failover is not configured and the unknown webhook is not found
+	if report.Counts[selfscan.Critical] != 10 || len(report.Findings) != 10 {
+		t.Fatalf("expected ten unauthenticated admin routes, got %+v", report.Findings)
+	}
+	for _, f := range report.Findings {
+		if f.Check != selfscan.CheckAdminAuth {
+			t.Fatalf("unexpected finding %+v", f)
+		}
+	}
+	if report.RiskScore != 100 || report.RiskLevel != "high" {
+		t.Fatalf("expected a high risk score, got %d %s", report.RiskScore, report.RiskLevel)
+	}
+}
+
+func TestSelfScanDisabledWithoutToken(t *testing.T) {
+	h := NewServer(Config{Port: "0", ServiceName: "payment-gateway", MaxProcessingMillis: 50}).Handler
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/admin/selfscan", nil))
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("self-scan without SELFSCAN_TOKEN expected 403, got %d", rr.Code)
+	}
+}
+
+// TestSelfScanCoversAdminRoutes verifies every GET route that serves the admin token but
+// refuses the reader and writer tokens is among the routes the self-scan probes
+func TestSelfScanCoversAdminRoutes(t *testing.T) {
+	router := newAuthenticatedServer(t).(chi.Router)
+	listed := selfScanTarget(router, Config{ServiceName: "payment-gateway"}).AdminRoutes
+
+	refused := func(route, token string) bool {
+		req := httptest.NewRequest(http.MethodGet, route, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr.Code == http.StatusUnauthorized || rr.Code == http.StatusForbidden
+	}
+	err := chi.Walk(router, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if method != http.MethodGet || !refused(route, "reader") || !refused(route, "writer") || refused(route, "admin") {
+			return nil
+		}
+		for _, path := range listed {
+			if router.Find(chi.NewRouteContext(), http.MethodGet, path) == route {
+				return nil
+			}
+		}
+		t.Errorf("GET %s is admin-only but not among the self-scan's admin routes", route)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,46 +1,330 @@
 package main
 
 import (
+	"context"
 	"net/http"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/healthcare-gitops/common/apidocs"
+	"github.com/healthcare-gitops/common/auth"
+	"github.com/healthcare-gitops/common/calendar"
+	"github.com/healthcare-gitops/common/changelog"
+	"github.com/healthcare-gitops/common/clientip"
+	"github.com/healthcare-gitops/common/compliance"
+	"github.com/healthcare-gitops/common/features"
+	"github.com/healthcare-gitops/common/health"
+	commonmw "github.com/healthcare-gitops/common/middleware"
+	"github.com/healthcare-gitops/common/observability"
+	"github.com/healthcare-gitops/common/resilience"
+	"github.com/healthcare-gitops/common/selfscan"
+	"github.com/healthcare-gitops/common/tlsconfig"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog/log"
 )
 
 func NewServer(cfg Config) *http.Server {
 	router := chi.NewRouter()
+	meter := NewUsageMeter()
+	transactions := NewTransactionStore()
+	repository, err := openTransactionRepository(context.Background(), cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to open transaction repository")
+	}
+	// With failover, writes go through the coordinator so only the active records them
+	var failover *Coordinator
+	if cfg.Failover.Role != "" {
+		failoverCfg := cfg.Failover
+		if cfg.TLS.Enabled() {
+			// The peer may require this replica's certificate
+			if failoverCfg.HTTPClient, err = cfg.TLS.HTTPClient(failoverCfg.CheckInterval); err != nil {
+				log.Fatal().Err(err).Msg("Invalid TLS configuration")
+			}
+		}
+		if failover, err = newCoordinator(context.Background(), failoverCfg, repository, transactions); err != nil {
+			log.Fatal().Err(err).Msg("Invalid failover configuration")
+		}
+		repository = failover
+		go failover.Run(context.Background())
+	}
+	transactions.repository = repository
+	summary := NewPaymentSummary()
+	processor, err := newPaymentProcessor(cfg.Processor, processingTimeout(cfg.MaxProcessingMillis))
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid payment processor configuration")
+	}
+	templates := NewTemplateStore(NewHTTPNotificationSender(cfg.NotificationServiceURL))
+	calendars, err := calendar.LoadFile(cfg.CalendarsFile)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid business calendar configuration")
+	}
+	templates.calendars = calendars
+	if err := cfg.Claims.Validate(); err != nil {
+		log.Fatal().Err(err).Msg("Invalid insurance claims configuration")
+	}
+	if err := cfg.Webhooks.Validate(); err != nil {
+		log.Fatal().Err(err).Msg("Invalid webhook configuration")
+	}
+	webhooks := NewWebhookStore(cfg.Webhooks)
+	rates, err := NewExchangeRates(cfg.ExchangeRates)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid exchange rate configuration")
+	}
+	// Readiness checks the services the gateway calls and its span exports
+	dependencies := []health.Check{{Name: "otlp_exporter", Probe: exporterHealth.Probe}}
+	if cfg.CardTokenizer.PHIServiceURL != "" {
+		dependencies = addDependencyCheck(dependencies, dependencyPHIService, cfg.CardTokenizer.PHIServiceURL, cfg.CardTokenizer.HTTPClient)
+		cfg.CardTokenizer.HTTPClient = resilience.ClientFromEnv(dependencyPHIService, cfg.CardTokenizer.HTTPClient, tokenizerTimeout, RecordCircuitBreakerState)
+	}
+	tokenizer, err := NewCardTokenizer(cfg.CardTokenizer)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid card tokenizer configuration")
+	}
+	sox, err := NewSOXFinancialControlManager(cfg.SOXAuditLogPath)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to open SOX audit log")
+	}
+	approvals, err := NewApprovalPolicy(cfg.Approvals)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid approval configuration")
+	}
+	risk, err := newRiskScorer(cfg.Risk)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid risk scoring configuration")
+	}
+	claims := NewClaimStore(cfg.Claims, NewHTTPClaimSubmitter(cfg.Claims.ClearinghouseURL))
+	claims.repository, claims.transactions, claims.sox, claims.webhooks = repository, transactions, sox, webhooks
+	claims.rates = rates
+	reconciliation := NewReconciliationStore(repository, sox)
+	flags := newFeatureFlags()
+	changes, err := newChangelog(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid API changelog")
+	}
+	docs, err := apidocs.New(openAPISpec, apiSpecVersion)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid OpenAPI document")
+	}
+	if flags.Enabled(FeatureHoneytokens) {
+		decoys, err := openHoneytokens(cfg.Honeytokens)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid honeytoken registry")
+		}
+		transactions.decoys = decoys
+	}
+
+	// Bearer tokens are validated by auth-service; without it the API is open
+	var authn *auth.Introspector
+	if cfg.Auth.IntrospectURL != "" {
+		authCfg := cfg.Auth
+		authCfg.OnCacheLookup = RecordAuthCacheLookup
+		if cfg.TLS.Enabled() {
+			// Calls to auth-service present this service's certificate
+			client, err := cfg.TLS.HTTPClient(5 * time.Second)
+			if err != nil {
+				log.Fatal().Err(err).Msg("Invalid TLS configuration")
+			}
+			authCfg.HTTPClient = client
+		}
+		dependencies = addDependencyCheck(dependencies, dependencyAuthService, authCfg.IntrospectURL, authCfg.HTTPClient)
+		authCfg.HTTPClient = resilience.ClientFromEnv(dependencyAuthService, authCfg.HTTPClient, 5*time.Second, RecordCircuitBreakerState)
+		authn = auth.NewIntrospector(authCfg)
+	} else {
+		log.Warn().Msg("AUTH_INTROSPECT_URL not set, payment API is not authenticated")
+	}
+	read, write, admin := authn.Require("payment:read"), authn.Require("payment:write"), authn.Require(auth.AdminScope)
+
+	// Every payment mutation is emitted to the shared audit bus
+	events, err := openAuditEvents(context.Background(), cfg.Audit)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to open audit sink")
+	}
+	auditEvents = events
+
+	// Captures are streamed to the event broker for analytics and SIEM pipelines
+	stream, err := openEventStream(cfg.Events)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to open event broker")
+	}
+	eventStream = stream
+
+	// X-Forwarded-For is believed only from the ingress and other trusted proxies
+	proxies, err := clientip.FromEnv()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid TRUSTED_PROXIES")
+	}
+
+	cfg.RateLimit.OnStoreError = func(err error) {
+		log.Warn().Err(err).Msg("Rate limit store unavailable, limiting per replica")
+	}
+	cfg.RateLimit.Identify = authn.Verified
+	cfg.RateLimit.TrustedProxies = proxies
+	limiter, err := commonmw.NewRateLimiter(cfg.RateLimit)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid rate limit configuration")
+	}
 
 	// Add middleware stack
-	router.Use(middleware.Recoverer)                 // Recover from panics
-	router.Use(middleware.RealIP)                    // Get real client IP
-	router.Use(middleware.RequestID)                 // Add request ID
-	router.Use(LoggingMiddleware)                    // Structured logging
-	router.Use(TracingMiddleware)                    // OpenTelemetry tracing
-	router.Use(PrometheusMiddleware)                 // Prometheus metrics
-	router.Use(middleware.Compress(5))               // Gzip compression
-	router.Use(middleware.Timeout(30 * time.Second)) // Request timeout
+	router.Use(middleware.Recoverer)               // Recover from panics
+	router.Use(proxies.Middleware)                 // Get real client IP
+	router.Use(middleware.RequestID)               // Add request ID
+	router.Use(tlsconfig.Middleware)               // mTLS client identity
+	router.Use(LoggingMiddleware)                  // Structured logging
+	router.Use(TracingMiddleware)                  // OpenTelemetry tracing
+	router.Use(auditMiddleware(events))            // Audit events for mutations
+	router.Use(PrometheusMiddleware)               // Prometheus metrics
+	router.Use(limiter.Middleware)                 // Per-caller and per-route rate limits
+	router.Use(middleware.Compress(5))             // Gzip compression
+	router.Use(middleware.Timeout(requestTimeout)) // Request timeout
+	if flags.Enabled(FeatureUsageMetering) {
+		router.Use(meter.Middleware) // Per-client usage metering
+	}
+	if failover != nil {
+		router.Use(failover.RequireActive) // Writes only on the active replica
+	}
 
 	// Payment handler
 	handler := PaymentHandler{
-		MaxLatency: processingTimeout(cfg.MaxProcessingMillis),
+		MaxLatency:        processingTimeout(cfg.MaxProcessingMillis),
+		Repository:        repository,
+		Transactions:      transactions,
+		Summary:           summary,
+		Failover:          failover,
+		SOX:               sox,
+		Processor:         processor,
+		Webhooks:          webhooks,
+		Events:            stream,
+		Rates:             rates,
+		Tokenizer:         tokenizer,
+		Approvals:         approvals,
+		Risk:              risk,
+		RiskCountryHeader: cfg.Risk.CountryHeader,
+		Dependencies:      dependencies,
 	}
 
 	// Health and readiness endpoints
 	router.Get("/health", handler.Health)
 	router.Get("/readiness", handler.Readiness)
+	router.Get("/capabilities", features.Handler(func() features.Capabilities {
+		return capabilities(flags, cfg)
+	}))
+	router.Get("/changelog", changelog.Handler(changes))
+	router.Get("/openapi.json", docs.SpecHandler)
+	router.Get("/docs", docs.DocsHandler)
 
-	// Payment processing endpoints
-	router.Post("/charge", handler.Charge)
-	router.Post("/process", handler.ProcessPayment)
+	// Payment processing endpoints. v1 is served unprefixed and under /api/v1 until
+	// its sunset; v2 shares the same service layer.
+	v1 := chi.Chain(versionMiddleware(APIVersionV1), deprecationMiddleware(cfg.APIv1DeprecatedAt, cfg.APIv1Sunset), write)
+	router.With(v1...).Post("/charge", handler.Charge)
+	router.With(v1...).Post("/process", handler.ProcessPayment)
+	router.Route("/api/v1", func(r chi.Router) {
+		r.With(v1...).Post("/charge", handler.Charge)
+		r.With(v1...).Post("/process", handler.ProcessPayment)
+
+		// The dashboard summary, transaction search and patient messaging are not part of the retiring
+		// payment API, so they carry no deprecation headers
+		r.With(versionMiddleware(APIVersionV1), read).Get("/summary", summary.SummaryHandler)
+		r.With(versionMiddleware(APIVersionV1), read).Get("/currencies", rates.CurrenciesHandler)
+		r.With(versionMiddleware(APIVersionV1), read).Get("/transactions", handler.ListTransactionsHandler)
+		r.With(versionMiddleware(APIVersionV1), read).Get("/transactions/{transactionID}", handler.GetTransactionHandler)
+		r.With(versionMiddleware(APIVersionV1), write).Post("/transactions/{transactionID}/capture", handler.CaptureTransactionHandler)
+		r.With(versionMiddleware(APIVersionV1), write).Post("/transactions/{transactionID}/refund", handler.RefundTransactionHandler)
+		r.With(versionMiddleware(APIVersionV1), write).Post("/transactions/{transactionID}/void", handler.VoidTransactionHandler)
+		r.With(versionMiddleware(APIVersionV1), write).Post("/transactions/{transactionID}/approve", handler.ApproveTransactionHandler)
+		r.Group(func(r chi.Router) {
+			r.Use(versionMiddleware(APIVersionV1), flags.Middleware(FeatureTransactionSearch), read)
+			r.Get("/transactions/search", transactions.SearchHandler)
+			r.Get("/transactions/search/export", transactions.ExportHandler)
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(versionMiddleware(APIVersionV1), flags.Middleware(FeaturePatientMessaging))
+			r.With(read).Get("/templates", templates.ListHandler)
+			r.With(write).Post("/templates", templates.CreateHandler)
+			r.With(read).Get("/templates/{templateID}", templates.GetHandler)
+			r.With(write).Post("/templates/{templateID}/versions", templates.AddVersionHandler)
+			r.With(read).Post("/templates/{templateID}/preview", templates.PreviewHandler)
+			r.With(write).Post("/templates/{templateID}/send", templates.SendHandler)
+			r.With(read).Get("/templates/{templateID}/analytics", templates.AnalyticsHandler)
+			// Delivery callbacks come from the notification service, which holds a
+			// payment:write token
+			r.With(write).Post("/notifications/status", templates.StatusHandler)
+		})
+
+		// Insurance claims; acknowledgements and remittances come from the clearinghouse's
+		// integration, which holds a payment:write token
+		r.Group(func(r chi.Router) {
+			r.Use(versionMiddleware(APIVersionV1), flags.Middleware(FeatureInsuranceClaims))
+			r.With(read).Get("/claims", claims.ListHandler)
+			r.With(write).Post("/claims", claims.CreateHandler)
+			r.With(read).Get("/claims/{claimID}", claims.GetHandler)
+			r.With(read).Get("/claims/{claimID}/x12", claims.X12Handler)
+			r.With(write).Post("/claims/{claimID}/submit", claims.SubmitHandler)
+			r.With(write).Post("/claims/{claimID}/status", claims.StatusHandler)
+			r.With(write).Post("/remittances", claims.RemittanceHandler)
+		})
+
+		// Daily settlement reconciliation for finance; settlement files come from the
+		// processors' reporting exports
+		r.Group(func(r chi.Router) {
+			r.Use(versionMiddleware(APIVersionV1), flags.Middleware(FeatureReconciliation))
+			r.With(write).Post("/reconciliation/settlements", reconciliation.ImportHandler)
+			r.With(read).Get("/reconciliation/{date}", reconciliation.ReportHandler)
+		})
+
+		// Payment event webhooks for billing and EHR systems. Subscribers receive patient
+		// and customer IDs, so registering one is an admin operation.
+		r.Group(func(r chi.Router) {
+			r.Use(versionMiddleware(APIVersionV1), flags.Middleware(FeatureWebhooks), admin)
+			r.Get("/webhooks", webhooks.ListHandler)
+			r.Post("/webhooks", webhooks.CreateHandler)
+			r.Get("/webhooks/dead-letters", webhooks.DeadLettersHandler)
+			r.Post("/webhooks/dead-letters/{deadLetterID}/retry", webhooks.RetryDeadLetterHandler)
+			r.Delete("/webhooks/dead-letters/{deadLetterID}", webhooks.DiscardDeadLetterHandler)
+			r.Get("/webhooks/{webhookID}", webhooks.GetHandler)
+			r.Delete("/webhooks/{webhookID}", webhooks.DeleteHandler)
+		})
+
+		// Tenants' business hours and holidays, which patient messages wait for
+		r.With(versionMiddleware(APIVersionV1), read).Handle("/calendars", calendar.Handler(calendars))
+		r.With(versionMiddleware(APIVersionV1), read).Handle("/calendars/*", calendar.Handler(calendars))
+
+		// Decoy transactions for red-team exercises; reading one alerts the SOC
+		r.Group(func(r chi.Router) {
+			r.Use(versionMiddleware(APIVersionV1), flags.Middleware(FeatureHoneytokens), admin)
+			r.Post("/honeytokens", transactions.SeedDecoysHandler)
+			r.Get("/honeytokens", transactions.ListDecoysHandler)
+			r.Get("/honeytokens/alerts", transactions.decoys.AlertsHandler())
+		})
+	})
+	router.Route("/api/v2", func(r chi.Router) {
+		r.Use(versionMiddleware(APIVersionV2), write)
+		r.Post("/payments", handler.CreatePayment)
+	})
 
 	// Observability endpoints
 	router.Handle("/metrics", promhttp.Handler())
-	router.Get("/compliance/status", handler.ComplianceStatusHandler)
-	router.Get("/audit/trail", handler.AuditTrailHandler)
-	router.Get("/alerts", handler.AlertingHandler)
+	router.With(admin).Get("/admin/observability/*", observability.Handler(observabilitySpec).ServeHTTP)
+	router.With(admin).Get("/compliance/status", flags.Require(FeatureComplianceReporting, compliance.Handler(func(*http.Request) compliance.Status {
+		return complianceStatus(handler, authn != nil)
+	})))
+	router.With(admin).Get("/audit/trail", flags.Require(FeatureComplianceReporting, handler.AuditTrailHandler))
+	router.With(admin).Get("/audit/trail/verify", flags.Require(FeatureComplianceReporting, handler.VerifyAuditTrailHandler))
+	router.With(admin).Get("/alerts", flags.Require(FeatureComplianceReporting, handler.AlertingHandler))
+	router.Get("/usage", flags.Require(FeatureUsageMetering, meter.UsageHandler))
+	router.Get("/admin/selfscan", selfscan.RequireToken(cfg.SelfScanToken, selfscan.Handler(func() selfscan.Target {
+		return selfScanTarget(router, cfg)
+	})))
+
+	// The anonymous usage stats this install sends, or would send if opted in
+	router.With(admin).Get("/admin/usage-stats", newUsageReporter(cfg, flags).Handler())
+
+	// Active/standby failover state, and the peer replica's checks and replication
+	if failover != nil {
+		router.With(admin).Get("/admin/failover", failover.StatusHandler)
+		router.Get("/internal/failover/status", failover.requirePeerToken(failover.PeerStatusHandler))
+		router.Get("/internal/failover/changes", failover.requirePeerToken(failover.ChangesHandler))
+	}
 
 	addr := ":" + cfg.Port
 	log.Info().
@@ -2,11 +2,31 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"os"
+	"strings"
+	"sync"
 	"time"
 )
 
+// maxSOXAuditTrails bounds the audit records held in memory; the audit log file is
+// the retained copy
+const maxSOXAuditTrails = 100000
+
+// soxGenesisHash is the previous hash of the first audit record
+var soxGenesisHash = strings.Repeat("0", 64)
+
+// ErrAuditTrailUnavailable is returned when a record cannot be written to the audit
+// log. Changes to financial records are refused rather than left unaudited.
+var ErrAuditTrailUnavailable = errors.New("SOX audit trail unavailable")
+
 // FinancialTransaction represents SOX-compliant financial record
 type FinancialTransaction struct {
 	TransactionID string    `json:"transaction_id"`
@@ -21,8 +41,11 @@ type FinancialTransaction struct {
 	ControlNumber string    `json:"control_number"`
 }
 
-// SOXAuditTrail maintains SOX-compliant audit records
+// SOXAuditTrail maintains SOX-compliant audit records. Hash covers every other field
+// and the previous record's hash, so editing, removing or reordering records breaks
+// the chain.
 type SOXAuditTrail struct {
+	Seq           int64     `json:"seq"`
 	TransactionID string    `json:"transaction_id"`
 	Action        string    `json:"action"`
 	UserID        string    `json:"user_id"`
@@ -30,11 +53,117 @@ type SOXAuditTrail struct {
 	IPAddress     string    `json:"ip_address"`
 	Details       string    `json:"details"`
 	ControlTest   string    `json:"control_test"`
+	PrevHash      string    `json:"prev_hash"`
+	Hash          string    `json:"hash"`
+}
+
+// chainHash computes a record's hash from its content and PrevHash
+func (a SOXAuditTrail) chainHash() string {
+	a.Hash = ""
+	content, _ := json.Marshal(a)
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// soxAuditStore holds serialized audit records in append order
+type soxAuditStore interface {
+	append(line []byte) error
+	scan(fn func(line []byte) error) error
+}
+
+// fileSOXAuditStore appends JSON lines to a file opened append-only, syncing every
+// record to disk before it is acknowledged
+type fileSOXAuditStore struct {
+	path string
+	file *os.File
+}
+
+func openFileSOXAuditStore(path string) (*fileSOXAuditStore, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSOXAuditStore{path: path, file: file}, nil
+}
+
+func (f *fileSOXAuditStore) append(line []byte) error {
+	if _, err := f.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return f.file.Sync()
+}
+
+func (f *fileSOXAuditStore) scan(fn func(line []byte) error) error {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		if err := fn(scanner.Bytes()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
 }
 
-// SOXFinancialControlManager implements Sarbanes-Oxley compliance controls
+// SOXFinancialControlManager implements Sarbanes-Oxley compliance controls. Its zero
+// value keeps the audit trail in memory only.
 type SOXFinancialControlManager struct {
+	mu          sync.Mutex
 	AuditTrails []SOXAuditTrail
+	// store is written ahead of AuditTrails; nil keeps records in memory only
+	store    soxAuditStore
+	seq      int64
+	lastHash string
+}
+
+// NewSOXFinancialControlManager opens the audit log at path, continuing its hash
+// chain and reloading its newest records, or keeps the trail in memory when path is
+// empty. A broken chain is reported but does not stop the service; new records chain
+// from the last one on disk.
+func NewSOXFinancialControlManager(path string) (*SOXFinancialControlManager, error) {
+	s := &SOXFinancialControlManager{}
+	if path == "" {
+		return s, nil
+	}
+	store, err := openFileSOXAuditStore(path)
+	if err != nil {
+		return nil, err
+	}
+	s.store = store
+
+	result, err := s.Verify()
+	if err != nil {
+		return nil, err
+	}
+	if !result.Valid {
+		log.Printf("SOX AUDIT: hash chain broken at record %d: %s", result.BrokenAt, result.Reason)
+	}
+	err = store.scan(func(line []byte) error {
+		var record SOXAuditTrail
+		if json.Unmarshal(line, &record) == nil {
+			s.AuditTrails = append(s.AuditTrails, record)
+			if len(s.AuditTrails) > 2*maxSOXAuditTrails {
+				s.AuditTrails = append([]SOXAuditTrail(nil), s.AuditTrails[maxSOXAuditTrails:]...)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if drop := len(s.AuditTrails) - maxSOXAuditTrails; drop > 0 {
+		s.AuditTrails = s.AuditTrails[drop:]
+	}
+	s.seq, s.lastHash = result.LastSeq, result.LastHash
+	return s, nil
 }
 
 // ProcessFinancialTransaction implements SOX segregation of duties
@@ -54,17 +183,23 @@ func (s *SOXFinancialControlManager) ProcessFinancialTransaction(txn FinancialTr
 	}
 
 	// SOX Control: Log transaction initiation
-	s.logAuditTrail(txn.TransactionID, "INITIATED", initiatorID,
+	if err := s.logAuditTrail(txn.TransactionID, "INITIATED", initiatorID,
 		fmt.Sprintf("Transaction initiated: $%.2f %s from %s to %s",
-			txn.Amount, txn.Currency, txn.AccountFrom, txn.AccountTo))
+			txn.Amount, txn.Currency, txn.AccountFrom, txn.AccountTo)); err != nil {
+		return err
+	}
 
 	// SOX Control: Log approval
-	s.logAuditTrail(txn.TransactionID, "APPROVED", approverID,
-		fmt.Sprintf("Transaction approved by %s with level %s", approverID, txn.ApprovalLevel))
+	if err := s.logAuditTrail(txn.TransactionID, "APPROVED", approverID,
+		fmt.Sprintf("Transaction approved by %s with level %s", approverID, txn.ApprovalLevel)); err != nil {
+		return err
+	}
 
 	// SOX Control: Immutable audit trail
-	s.logAuditTrail(txn.TransactionID, "PROCESSED", "SYSTEM",
-		fmt.Sprintf("Transaction processed successfully - Control #%s", txn.ControlNumber))
+	if err := s.logAuditTrail(txn.TransactionID, "PROCESSED", "SYSTEM",
+		fmt.Sprintf("Transaction processed successfully - Control #%s", txn.ControlNumber)); err != nil {
+		return err
+	}
 
 	log.Printf("SOX-compliant transaction processed: %s for $%.2f", txn.TransactionID, txn.Amount)
 	return nil
@@ -72,47 +207,217 @@ func (s *SOXFinancialControlManager) ProcessFinancialTransaction(txn FinancialTr
 
 // validateApprovalLevel implements SOX financial approval hierarchy
 func (s *SOXFinancialControlManager) validateApprovalLevel(amount float64, approvalLevel string) error {
-	// SOX-required approval hierarchy
-	switch {
-	case amount >= 1000000: // $1M+
-		if approvalLevel != "C_LEVEL" {
-			return fmt.Errorf("SOX violation: transactions >= $1M require C-level approval, got: %s", approvalLevel)
-		}
-	case amount >= 100000: // $100K+
-		if approvalLevel != "C_LEVEL" && approvalLevel != "VP_LEVEL" {
-			return fmt.Errorf("SOX violation: transactions >= $100K require VP+ approval, got: %s", approvalLevel)
-		}
-	case amount >= 10000: // $10K+
-		if approvalLevel != "C_LEVEL" && approvalLevel != "VP_LEVEL" && approvalLevel != "DIRECTOR_LEVEL" {
-			return fmt.Errorf("SOX violation: transactions >= $10K require Director+ approval, got: %s", approvalLevel)
-		}
-	case amount >= 1000: // $1K+
-		if approvalLevel == "STAFF_LEVEL" {
-			return fmt.Errorf("SOX violation: transactions >= $1K require Manager+ approval, got: %s", approvalLevel)
-		}
+	required := requiredApprovalLevel(amount)
+	if approvalLevelRank(approvalLevel) < approvalLevelRank(required) {
+		return fmt.Errorf("SOX violation: transactions of $%.2f require %s approval or above, got: %s", amount, required, approvalLevel)
 	}
-
 	return nil
 }
 
 // logAuditTrail creates immutable SOX audit records
-func (s *SOXFinancialControlManager) logAuditTrail(transactionID, action, userID, details string) {
+func (s *SOXFinancialControlManager) logAuditTrail(transactionID, action, userID, details string) error {
+	return s.appendAuditTrail(transactionID, action, userID, "127.0.0.1", details) // In production, capture real IP
+}
+
+// RecordTransactionChange audits a change to a recorded payment, such as a capture,
+// refund or void, or a refused attempt at one. Changes are audited before they are
+// saved, and not saved when this returns ErrAuditTrailUnavailable. A nil manager
+// records nothing.
+func (s *SOXFinancialControlManager) RecordTransactionChange(transactionID, action, userID, ipAddress, details string) error {
+	if s == nil {
+		return nil
+	}
+	return s.appendAuditTrail(transactionID, action, userID, ipAddress, details)
+}
+
+// RecentAuditTrails returns up to limit audit records, newest first
+func (s *SOXFinancialControlManager) RecentAuditTrails(limit int) []SOXAuditTrail {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	recent := make([]SOXAuditTrail, 0, limit)
+	for i := len(s.AuditTrails) - 1; i >= 0 && len(recent) < limit; i-- {
+		recent = append(recent, s.AuditTrails[i])
+	}
+	return recent
+}
+
+// appendAuditTrail chains a record onto the trail, writing it to the audit log before
+// it is held in memory
+func (s *SOXFinancialControlManager) appendAuditTrail(transactionID, action, userID, ipAddress, details string) error {
+	now := time.Now().UTC()
 	auditRecord := SOXAuditTrail{
 		TransactionID: transactionID,
 		Action:        action,
 		UserID:        userID,
-		Timestamp:     time.Now(),
-		IPAddress:     "127.0.0.1", // In production, capture real IP
+		Timestamp:     now,
+		IPAddress:     ipAddress,
 		Details:       details,
-		ControlTest:   fmt.Sprintf("SOX-IT-CONTROL-%d", time.Now().Unix()),
+		ControlTest:   fmt.Sprintf("SOX-IT-CONTROL-%d", now.Unix()),
 	}
 
 	// SOX requirement: Immutable audit trail storage
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	auditRecord.Seq = s.seq + 1
+	auditRecord.PrevHash = s.lastHash
+	if auditRecord.PrevHash == "" {
+		auditRecord.PrevHash = soxGenesisHash
+	}
+	auditRecord.Hash = auditRecord.chainHash()
+	if s.store != nil {
+		line, err := json.Marshal(auditRecord)
+		if err == nil {
+			err = s.store.append(line)
+		}
+		if err != nil {
+			log.Printf("SOX AUDIT FAILED: %s by %s on %s could not be written: %v", action, userID, transactionID, err)
+			RecordSOXAuditFailure()
+			return fmt.Errorf("%w: %v", ErrAuditTrailUnavailable, err)
+		}
+	}
 	s.AuditTrails = append(s.AuditTrails, auditRecord)
+	if drop := len(s.AuditTrails) - maxSOXAuditTrails; drop > 0 {
+		s.AuditTrails = s.AuditTrails[drop:]
+	}
+	s.seq, s.lastHash = auditRecord.Seq, auditRecord.Hash
 
 	// SOX requirement: Real-time audit logging
 	log.Printf("SOX AUDIT: [%s] %s by %s - %s",
 		auditRecord.ControlTest, action, userID, details)
+	return nil
+}
+
+// SOXAuditFilter selects audit records. Empty fields match everything; Until is
+// exclusive.
+type SOXAuditFilter struct {
+	TransactionID string
+	Action        string
+	UserID        string
+	Since         time.Time
+	Until         time.Time
+	Limit         int
+}
+
+func (f SOXAuditFilter) matches(a SOXAuditTrail) bool {
+	switch {
+	case f.TransactionID != "" && a.TransactionID != f.TransactionID,
+		f.Action != "" && !strings.EqualFold(a.Action, f.Action),
+		f.UserID != "" && a.UserID != f.UserID,
+		!f.Since.IsZero() && a.Timestamp.Before(f.Since),
+		!f.Until.IsZero() && !a.Timestamp.Before(f.Until):
+		return false
+	}
+	return true
+}
+
+// QueryAuditTrails returns the records matching filter, newest first: the whole audit
+// log when one is configured, otherwise the records held in memory
+func (s *SOXFinancialControlManager) QueryAuditTrails(filter SOXAuditFilter) ([]SOXAuditTrail, error) {
+	if s == nil {
+		return nil, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	matched := make([]SOXAuditTrail, 0)
+	err := s.scan(func(a SOXAuditTrail) {
+		if filter.matches(a) {
+			matched = append(matched, a)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(matched)-1; i < j; i, j = i+1, j-1 {
+		matched[i], matched[j] = matched[j], matched[i]
+	}
+	if filter.Limit > 0 && len(matched) > filter.Limit {
+		matched = matched[:filter.Limit]
+	}
+	return matched, nil
+}
+
+// scan passes every readable record to fn in append order; the caller holds s.mu
+func (s *SOXFinancialControlManager) scan(fn func(SOXAuditTrail)) error {
+	if s.store == nil {
+		for _, a := range s.AuditTrails {
+			fn(a)
+		}
+		return nil
+	}
+	return s.store.scan(func(line []byte) error {
+		var a SOXAuditTrail
+		// Unreadable records are reported by Verify
+		if json.Unmarshal(line, &a) == nil {
+			fn(a)
+		}
+		return nil
+	})
+}
+
+// SOXAuditVerification is the result of walking the audit hash chain
+type SOXAuditVerification struct {
+	Valid    bool   `json:"valid"`
+	Entries  int64  `json:"entries"`
+	LastSeq  int64  `json:"last_seq"`
+	LastHash string `json:"last_hash"`
+	BrokenAt int64  `json:"broken_at,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// fail records the first break found while verifying
+func (v *SOXAuditVerification) fail(seq int64, reason string) {
+	if v.Valid {
+		v.Valid, v.BrokenAt, v.Reason = false, seq, reason
+	}
+}
+
+// Verify recomputes every hash in the audit log and reports the first record that
+// does not match, is out of sequence or cannot be parsed. Without an audit log the
+// records held in memory are verified, from the oldest one kept.
+func (s *SOXFinancialControlManager) Verify() (SOXAuditVerification, error) {
+	result := SOXAuditVerification{Valid: true, LastHash: soxGenesisHash}
+	if s == nil {
+		return result, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	check := func(a SOXAuditTrail) {
+		result.Entries++
+		switch {
+		case a.Seq != result.LastSeq+1:
+			result.fail(a.Seq, fmt.Sprintf("expected seq %d", result.LastSeq+1))
+		case a.PrevHash != result.LastHash:
+			result.fail(a.Seq, "prev_hash does not match the previous record")
+		case a.Hash != a.chainHash():
+			result.fail(a.Seq, "hash does not match the record content")
+		}
+		result.LastSeq, result.LastHash = a.Seq, a.Hash
+	}
+	if s.store == nil {
+		if len(s.AuditTrails) > 0 {
+			result.LastSeq, result.LastHash = s.AuditTrails[0].Seq-1, s.AuditTrails[0].PrevHash
+		}
+		for _, a := range s.AuditTrails {
+			check(a)
+		}
+		return result, nil
+	}
+	err := s.store.scan(func(line []byte) error {
+		var a SOXAuditTrail
+		if err := json.Unmarshal(line, &a); err != nil {
+			result.Entries++
+			result.fail(result.LastSeq+1, "record cannot be parsed")
+			return nil
+		}
+		check(a)
+		return nil
+	})
+	return result, err
 }
 
 // GenerateSOXComplianceReport creates quarterly SOX compliance report
@@ -121,6 +426,8 @@ func (s *SOXFinancialControlManager) GenerateSOXComplianceReport(quarterStart, q
 	violations := 0
 	controlsTested := 0
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	for _, audit := range s.AuditTrails {
 		if audit.Timestamp.After(quarterStart) && audit.Timestamp.Before(quarterEnd) {
 			totalTransactions++
@@ -1,8 +1,19 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/go-chi/chi/v5"
 )
 
 func TestValidateApprovalLevel(t *testing.T) {
@@ -85,3 +96,137 @@ func TestGenerateSOXComplianceReport(t *testing.T) {
 		t.Fatalf("expected transactions counted")
 	}
 }
+
+func TestSOXAuditLogPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sox-audit.jsonl")
+	mgr, err := NewSOXFinancialControlManager(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, action := range []string{"CAPTURE", "REFUND", "VOID"} {
+		if err := mgr.RecordTransactionChange("TXN-1", action, "u1", "10.0.0.1", action+" details"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A restart reloads the trail and continues its chain
+	mgr, err = NewSOXFinancialControlManager(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mgr.AuditTrails) != 3 || mgr.AuditTrails[2].Action != "VOID" {
+		t.Fatalf("expected the trail reloaded, got %+v", mgr.AuditTrails)
+	}
+	if err := mgr.RecordTransactionChange("TXN-2", "CAPTURE", "u2", "10.0.0.2", ""); err != nil {
+		t.Fatal(err)
+	}
+	result, err := mgr.Verify()
+	if err != nil || !result.Valid || result.Entries != 4 || result.LastSeq != 4 {
+		t.Fatalf("expected an intact chain of 4 records, got %+v %v", result, err)
+	}
+	if mgr.AuditTrails[3].PrevHash != mgr.AuditTrails[2].Hash {
+		t.Fatal("expected the new record chained to the reloaded ones")
+	}
+
+	audits, err := mgr.QueryAuditTrails(SOXAuditFilter{TransactionID: "TXN-1", Action: "refund"})
+	if err != nil || len(audits) != 1 || audits[0].Seq != 2 {
+		t.Fatalf("expected the refund record, got %+v %v", audits, err)
+	}
+	if audits, _ := mgr.QueryAuditTrails(SOXAuditFilter{Until: time.Now().Add(-time.Hour)}); len(audits) != 0 {
+		t.Fatalf("expected no records before the range, got %d", len(audits))
+	}
+	if audits, _ := mgr.QueryAuditTrails(SOXAuditFilter{Since: time.Now().Add(-time.Hour), Limit: 2}); len(audits) != 2 || audits[0].Seq != 4 {
+		t.Fatalf("expected the newest 2 records, got %+v", audits)
+	}
+
+	// Editing a record on disk breaks the chain there
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, bytes.Replace(raw, []byte("REFUND details"), []byte("REFUND edited!"), 1), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if result, _ := mgr.Verify(); result.Valid || result.BrokenAt != 2 {
+		t.Fatalf("expected the chain broken at record 2, got %+v", result)
+	}
+}
+
+// failingSOXAuditStore refuses every record, like a full or read-only disk
+type failingSOXAuditStore struct{}
+
+func (failingSOXAuditStore) append([]byte) error { return errors.New("no space left on device") }
+
+func (failingSOXAuditStore) scan(func([]byte) error) error { return nil }
+
+func TestUnauditedChangesAreRefused(t *testing.T) {
+	at := time.Now().UTC()
+	repository := newMemoryRepository(10)
+	h := PaymentHandler{
+		Repository:   repository,
+		Transactions: NewTransactionStore(),
+		SOX:          &SOXFinancialControlManager{store: failingSOXAuditStore{}},
+	}
+	if err := repository.Save(t.Context(), testTransaction("TXN-1", 10000, "cust-1", "", "Surgery deposit", at)); err != nil {
+		t.Fatal(err)
+	}
+	r := chi.NewRouter()
+	r.Post("/api/v1/transactions/{transactionID}/capture", h.CaptureTransactionHandler)
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/v1/transactions/TXN-1/capture", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("unaudited capture expected 503, got %d: %s", rr.Code, rr.Body)
+	}
+	if stored, _ := repository.Get(t.Context(), "TXN-1"); stored.Status != StatusAuthorized {
+		t.Fatalf("expected the capture not saved, got %s", stored.Status)
+	}
+	if len(h.SOX.AuditTrails) != 0 {
+		t.Fatalf("expected no record held that was not written, got %d", len(h.SOX.AuditTrails))
+	}
+}
+
+func TestAuditTrailHandler(t *testing.T) {
+	h := PaymentHandler{SOX: &SOXFinancialControlManager{}}
+	_ = h.SOX.RecordTransactionChange("TXN-1", "CAPTURE", "u1", "10.0.0.1", "")
+	_ = h.SOX.RecordTransactionChange("TXN-1", "REFUND_FAILED", "u1", "10.0.0.1", "processor unavailable")
+	_ = h.SOX.RecordTransactionChange("TXN-2", "VOID", "u2", "10.0.0.2", "")
+	get := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		if strings.HasPrefix(path, "/audit/trail/verify") {
+			h.VerifyAuditTrailHandler(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		} else {
+			h.AuditTrailHandler(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		}
+		return rr
+	}
+
+	var trail struct {
+		Entries []map[string]interface{} `json:"entries"`
+		Count   int                      `json:"count"`
+	}
+	since := url.QueryEscape(time.Now().Add(-time.Minute).Format(time.RFC3339))
+	if err := json.NewDecoder(get("/audit/trail?transaction_id=TXN-1&since=" + since).Body).Decode(&trail); err != nil {
+		t.Fatal(err)
+	}
+	if trail.Count != 2 || trail.Entries[0]["event"] != "refund_failed" || trail.Entries[0]["status"] != "failed" || trail.Entries[0]["seq"] != 2.0 {
+		t.Fatalf("unexpected TXN-1 entries: %+v", trail)
+	}
+	if trail.Entries[0]["prev_hash"] != trail.Entries[1]["hash"] {
+		t.Fatal("expected the entries hash-chained")
+	}
+	until := url.QueryEscape(time.Now().Add(-time.Minute).Format(time.RFC3339))
+	if err := json.NewDecoder(get("/audit/trail?until=" + until).Body).Decode(&trail); err != nil || trail.Count != 0 {
+		t.Fatalf("expected no entries before the range, got %+v %v", trail, err)
+	}
+	for _, query := range []string{"since=yesterday", "until=2026-03-05", "limit=0", "limit=1001"} {
+		if rr := get("/audit/trail?" + query); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s expected 400, got %d", query, rr.Code)
+		}
+	}
+
+	var result SOXAuditVerification
+	if err := json.NewDecoder(get("/audit/trail/verify").Body).Decode(&result); err != nil || !result.Valid || result.Entries != 3 {
+		t.Fatalf("expected an intact chain of 3 records, got %+v %v", result, err)
+	}
+}
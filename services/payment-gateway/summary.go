@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Transaction outcomes counted by the summary
+const (
+	outcomeAuthorized = "authorized"
+	outcomeFailed     = "failed"
+)
+
+// PaymentSummary keeps dashboard counts up to date as payments are processed, so
+// reading it never scans transactions. Daily counts restart at midnight UTC.
+type PaymentSummary struct {
+	mu       sync.Mutex
+	total    int64
+	byStatus map[string]int64
+	byMethod map[string]int64
+
+	day       string
+	today     int64
+	failures  int64
+	highValue int64
+	// revenue is today's authorized amount per currency, in minor units
+	revenue map[string]int64
+}
+
+// NewPaymentSummary creates an empty summary
+func NewPaymentSummary() *PaymentSummary {
+	return &PaymentSummary{
+		byStatus: map[string]int64{outcomeAuthorized: 0, outcomeFailed: 0},
+		byMethod: make(map[string]int64),
+		revenue:  make(map[string]int64),
+	}
+}
+
+// rollLocked starts a new day's counts when the UTC date has changed
+func (s *PaymentSummary) rollLocked(now time.Time) {
+	day := now.UTC().Format(time.DateOnly)
+	if day == s.day {
+		return
+	}
+	s.day = day
+	s.today, s.failures, s.highValue = 0, 0, 0
+	s.revenue = make(map[string]int64)
+}
+
+// Record counts one payment attempt. A nil summary ignores it.
+func (s *PaymentSummary) Record(req PaymentRequest, resp PaymentResponse, authorized bool, now time.Time) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rollLocked(now)
+
+	s.total++
+	s.today++
+	method := strings.ToLower(req.Method)
+	if method == "" {
+		method = "unknown"
+	}
+	s.byMethod[method]++
+	if !authorized {
+		s.byStatus[outcomeFailed]++
+		s.failures++
+		return
+	}
+	s.byStatus[outcomeAuthorized]++
+	s.revenue[strings.ToUpper(req.Currency)] += req.AmountCents
+	if resp.HighValue {
+		s.highValue++
+	}
+}
+
+// PaymentSummaryReport is the dashboard view of payment activity
+type PaymentSummaryReport struct {
+	GeneratedAt  time.Time `json:"generated_at"`
+	Day          string    `json:"day"`
+	Transactions struct {
+		Total    int64            `json:"total"`
+		ByStatus map[string]int64 `json:"by_status"`
+		ByMethod map[string]int64 `json:"by_method"`
+	} `json:"transactions"`
+	Today struct {
+		Transactions int64 `json:"transactions"`
+		Failures     int64 `json:"failures"`
+		HighValue    int64 `json:"high_value"`
+		// Revenue is authorized amounts per currency, in minor units
+		Revenue map[string]int64 `json:"revenue"`
+	} `json:"today"`
+}
+
+// Report copies the current counts
+func (s *PaymentSummary) Report(now time.Time) PaymentSummaryReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rollLocked(now)
+
+	var report PaymentSummaryReport
+	report.GeneratedAt = now.UTC()
+	report.Day = s.day
+	report.Transactions.Total = s.total
+	report.Transactions.ByStatus = copyCounts(s.byStatus)
+	report.Transactions.ByMethod = copyCounts(s.byMethod)
+	report.Today.Transactions = s.today
+	report.Today.Failures = s.failures
+	report.Today.HighValue = s.highValue
+	report.Today.Revenue = copyCounts(s.revenue)
+	return report
+}
+
+func copyCounts(counts map[string]int64) map[string]int64 {
+	out := make(map[string]int64, len(counts))
+	for key, n := range counts {
+		out[key] = n
+	}
+	return out
+}
+
+// SummaryHandler handles GET /api/v1/summary: pre-aggregated payment counts for
+// dashboards to poll
+func (s *PaymentSummary) SummaryHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	_ = json.NewEncoder(w).Encode(s.Report(time.Now()))
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPaymentSummaryRollsOverDaily(t *testing.T) {
+	s := NewPaymentSummary()
+	day := time.Date(2026, 3, 2, 23, 0, 0, 0, time.UTC)
+	s.Record(PaymentRequest{AmountCents: 12500, Currency: "usd", Method: "card"}, PaymentResponse{HighValue: true}, true, day)
+	s.Record(PaymentRequest{AmountCents: 900, Currency: "EUR", Method: "ACH"}, PaymentResponse{}, true, day)
+	s.Record(PaymentRequest{Method: "card"}, PaymentResponse{}, false, day)
+
+	report := s.Report(day)
+	if report.Day != "2026-03-02" || report.Today.Transactions != 3 || report.Today.Failures != 1 || report.Today.HighValue != 1 {
+		t.Fatalf("unexpected daily counts: %+v", report.Today)
+	}
+	if report.Today.Revenue["USD"] != 12500 || report.Today.Revenue["EUR"] != 900 {
+		t.Fatalf("unexpected revenue: %v", report.Today.Revenue)
+	}
+	if report.Transactions.ByStatus[outcomeAuthorized] != 2 || report.Transactions.ByMethod["card"] != 2 || report.Transactions.ByMethod["ach"] != 1 {
+		t.Fatalf("unexpected totals: %+v", report.Transactions)
+	}
+
+	next := s.Report(day.Add(2 * time.Hour))
+	if next.Day != "2026-03-03" || next.Today.Transactions != 0 || len(next.Today.Revenue) != 0 || next.Transactions.Total != 3 {
+		t.Fatalf("expected daily counts to restart and totals to carry over, got %+v", next)
+	}
+}
+
+func TestSummaryEndpoint(t *testing.T) {
+	h := NewServer(Config{Port: "0", ServiceName: "payment-gateway", MaxProcessingMillis: 4}).Handler
+	for _, body := range []string{
+		`{"amount_cents": 2000, "currency": "USD", "customer_id": "c1", "method": "card"}`,
+		`{"amount_cents": 0, "currency": "USD", "customer_id": "c1", "method": "card"}`,
+	} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/charge", bytes.NewBufferString(body)))
+	}
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/summary", nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("Deprecation") != "" {
+		t.Fatalf("summary expected 200 without deprecation, got %d %v", rr.Code, rr.Header())
+	}
+	var report PaymentSummaryReport
+	if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Today.Transactions != 2 || report.Today.Failures != 1 || report.Today.Revenue["USD"] != 2000 {
+		t.Fatalf("unexpected summary: %+v", report)
+	}
+}
@@ -0,0 +1,657 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/healthcare-gitops/common/calendar"
+)
+
+// Channels a message template is written for
+const (
+	ChannelEmail = "email"
+	ChannelSMS   = "sms"
+)
+
+// Categories of patient communication
+const (
+	CategoryStatement = "statement"
+	CategoryReceipt   = "receipt"
+	CategoryEstimate  = "estimate"
+	CategoryGeneral   = "general"
+)
+
+// Template variable types. Dates render as YYYY-MM-DD and money as "125.00 USD", the
+// same in every locale, so a translation never changes an amount's meaning.
+const (
+	VariableString = "string"
+	VariableNumber = "number"
+	VariableDate   = "date"
+	VariableMoney  = "money"
+)
+
+// defaultTemplateLocale must be present in every template version; other locales fall
+// back to it
+const defaultTemplateLocale = "en"
+
+// Template size limits. An SMS of maxSMSBody GSM characters is ten segments.
+const (
+	maxEmailBody = 20000
+	maxSMSBody   = 1530
+)
+
+var (
+	// ErrTemplateNotFound is returned for unknown templates and versions
+	ErrTemplateNotFound = errors.New("template not found")
+
+	// ErrTemplateExists is returned when creating a template whose ID is taken
+	ErrTemplateExists = errors.New("template already exists")
+)
+
+var (
+	templateIDPattern   = regexp.MustCompile(`^[a-z][a-z0-9-]{0,63}$`)
+	variableNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+	localePattern       = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z]{2})?$`)
+	placeholderPattern  = regexp.MustCompile(`\{\{\s*([^{}]*?)\s*\}\}`)
+)
+
+var templateChannels = map[string]bool{ChannelEmail: true, ChannelSMS: true}
+
+var templateCategories = map[string]bool{
+	CategoryStatement: true, CategoryReceipt: true, CategoryEstimate: true, CategoryGeneral: true,
+}
+
+var variableTypes = map[string]bool{
+	VariableString: true, VariableNumber: true, VariableDate: true, VariableMoney: true,
+}
+
+// TemplateError lists the problems with a template or with the values rendered into it
+type TemplateError struct {
+	Problems []string
+}
+
+func (e *TemplateError) Error() string {
+	return "invalid template: " + strings.Join(e.Problems, "; ")
+}
+
+// TemplateVariable is a value a template expects, written {{name}} in its text.
+// Example is used in previews when no value is given.
+type TemplateVariable struct {
+	Name        string      `json:"name"`
+	Type        string      `json:"type"`
+	Required    bool        `json:"required"`
+	Description string      `json:"description,omitempty"`
+	Example     interface{} `json:"example,omitempty"`
+}
+
+// LocaleContent is a template's text in one locale. Only email has a subject.
+type LocaleContent struct {
+	Subject string `json:"subject,omitempty"`
+	Body    string `json:"body"`
+}
+
+// TemplateVersion is an immutable revision of a template. Messages use the latest
+// version unless they name another.
+type TemplateVersion struct {
+	Version   int                      `json:"version"`
+	Variables []TemplateVariable       `json:"variables"`
+	Locales   map[string]LocaleContent `json:"locales"`
+	CreatedAt time.Time                `json:"created_at"`
+}
+
+// MessageTemplate is a patient-facing message, such as a statement notice or receipt,
+// for one channel
+type MessageTemplate struct {
+	ID          string            `json:"id"`
+	Channel     string            `json:"channel"`
+	Category    string            `json:"category"`
+	Description string            `json:"description,omitempty"`
+	Versions    []TemplateVersion `json:"versions"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+// TemplateSummary describes a template and its latest version without the text
+type TemplateSummary struct {
+	ID            string    `json:"id"`
+	Channel       string    `json:"channel"`
+	Category      string    `json:"category"`
+	Description   string    `json:"description,omitempty"`
+	LatestVersion int       `json:"latest_version"`
+	Locales       []string  `json:"locales"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// CreateTemplateRequest creates a template with its first version
+type CreateTemplateRequest struct {
+	ID          string                   `json:"id"`
+	Channel     string                   `json:"channel"`
+	Category    string                   `json:"category"`
+	Description string                   `json:"description,omitempty"`
+	Variables   []TemplateVariable       `json:"variables"`
+	Locales     map[string]LocaleContent `json:"locales"`
+}
+
+// TemplateVersionRequest adds a version to a template
+type TemplateVersionRequest struct {
+	Variables []TemplateVariable       `json:"variables"`
+	Locales   map[string]LocaleContent `json:"locales"`
+}
+
+// RenderedMessage is a template version rendered in one locale. Segments is how many
+// SMS messages the body takes and is zero for email.
+type RenderedMessage struct {
+	TemplateID string `json:"template_id"`
+	Version    int    `json:"version"`
+	Channel    string `json:"channel"`
+	Locale     string `json:"locale"`
+	Subject    string `json:"subject,omitempty"`
+	Body       string `json:"body"`
+	Characters int    `json:"characters"`
+	Segments   int    `json:"segments,omitempty"`
+}
+
+// latest returns the template's newest version
+func (t *MessageTemplate) latest() *TemplateVersion {
+	return &t.Versions[len(t.Versions)-1]
+}
+
+// version returns a version by number; zero selects the latest
+func (t *MessageTemplate) version(n int) (*TemplateVersion, error) {
+	if n == 0 {
+		return t.latest(), nil
+	}
+	if n < 1 || n > len(t.Versions) {
+		return nil, fmt.Errorf("%w: %s version %d", ErrTemplateNotFound, t.ID, n)
+	}
+	return &t.Versions[n-1], nil
+}
+
+func (t *MessageTemplate) summary() TemplateSummary {
+	latest := t.latest()
+	locales := make([]string, 0, len(latest.Locales))
+	for locale := range latest.Locales {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return TemplateSummary{
+		ID:            t.ID,
+		Channel:       t.Channel,
+		Category:      t.Category,
+		Description:   t.Description,
+		LatestVersion: latest.Version,
+		Locales:       locales,
+		UpdatedAt:     t.UpdatedAt,
+	}
+}
+
+// validateTemplateVersion checks a version's variables and text for a channel: the
+// default locale is present, every placeholder names a declared variable and every
+// locale fits the channel
+func validateTemplateVersion(channel string, variables []TemplateVariable, locales map[string]LocaleContent) error {
+	var problems []string
+	declared := make(map[string]bool, len(variables))
+	for i, v := range variables {
+		switch {
+		case !variableNamePattern.MatchString(v.Name):
+			problems = append(problems, fmt.Sprintf("variables[%d]: name must be lowercase letters, digits or '_', starting with a letter", i))
+		case declared[v.Name]:
+			problems = append(problems, fmt.Sprintf("variables[%d]: %s is declared twice", i, v.Name))
+		}
+		if !variableTypes[v.Type] {
+			problems = append(problems, fmt.Sprintf("variables[%d]: type must be string, number, date or money", i))
+		} else if v.Example != nil {
+			if _, err := formatVariable(v, v.Example); err != nil {
+				problems = append(problems, fmt.Sprintf("variables[%d]: example %v", i, err))
+			}
+		}
+		declared[v.Name] = true
+	}
+
+	if _, ok := locales[defaultTemplateLocale]; !ok {
+		problems = append(problems, "locales: the default locale "+defaultTemplateLocale+" is required")
+	}
+	codes := make([]string, 0, len(locales))
+	for code := range locales {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		content := locales[code]
+		if !localePattern.MatchString(code) {
+			problems = append(problems, fmt.Sprintf("locales.%s: locale must be a language code with an optional region, e.g. es or es-MX", code))
+		}
+		switch {
+		case strings.TrimSpace(content.Body) == "":
+			problems = append(problems, fmt.Sprintf("locales.%s: body is required", code))
+		case channel == ChannelEmail && strings.TrimSpace(content.Subject) == "":
+			problems = append(problems, fmt.Sprintf("locales.%s: email templates need a subject", code))
+		case channel == ChannelSMS && content.Subject != "":
+			problems = append(problems, fmt.Sprintf("locales.%s: SMS templates have no subject", code))
+		case channel == ChannelEmail && len(content.Body) > maxEmailBody:
+			problems = append(problems, fmt.Sprintf("locales.%s: body exceeds %d characters", code, maxEmailBody))
+		case channel == ChannelSMS && len([]rune(content.Body)) > maxSMSBody:
+			problems = append(problems, fmt.Sprintf("locales.%s: body exceeds %d characters", code, maxSMSBody))
+		}
+		for _, text := range []string{content.Subject, content.Body} {
+			for _, match := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+				if !declared[match[1]] {
+					problems = append(problems, fmt.Sprintf("locales.%s: {{%s}} is not a declared variable", code, match[1]))
+				}
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return &TemplateError{Problems: problems}
+	}
+	return nil
+}
+
+// resolveLocale picks the closest locale a version has: the exact locale, then its
+// language, then the default
+func (v *TemplateVersion) resolveLocale(locale string) string {
+	if _, ok := v.Locales[locale]; ok {
+		return locale
+	}
+	if language, _, found := strings.Cut(locale, "-"); found {
+		if _, ok := v.Locales[language]; ok {
+			return language
+		}
+	}
+	return defaultTemplateLocale
+}
+
+// render fills a version's text for a locale. With useExamples, missing values are
+// taken from the variables' examples, as for previews.
+func (v *TemplateVersion) render(locale string, values map[string]interface{}, useExamples bool) (LocaleContent, string, error) {
+	var problems []string
+	formatted := make(map[string]string, len(v.Variables))
+	declared := make(map[string]bool, len(v.Variables))
+	for _, variable := range v.Variables {
+		declared[variable.Name] = true
+		value, ok := values[variable.Name]
+		if (!ok || value == nil) && useExamples {
+			value, ok = variable.Example, variable.Example != nil
+		}
+		if !ok || value == nil {
+			if variable.Required {
+				problems = append(problems, variable.Name+" is required")
+			}
+			continue
+		}
+		text, err := formatVariable(variable, value)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s %v", variable.Name, err))
+			continue
+		}
+		formatted[variable.Name] = text
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		if !declared[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		problems = append(problems, name+" is not a variable of this template")
+	}
+	if len(problems) > 0 {
+		return LocaleContent{}, "", &TemplateError{Problems: problems}
+	}
+
+	resolved := v.resolveLocale(locale)
+	content := v.Locales[resolved]
+	fill := func(text string) string {
+		return placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+			return formatted[placeholderPattern.FindStringSubmatch(placeholder)[1]]
+		})
+	}
+	return LocaleContent{Subject: fill(content.Subject), Body: fill(content.Body)}, resolved, nil
+}
+
+// formatVariable checks a decoded JSON value against a variable's type and formats it
+func formatVariable(variable TemplateVariable, value interface{}) (string, error) {
+	switch variable.Type {
+	case VariableString:
+		s, ok := value.(string)
+		if !ok {
+			return "", errors.New("must be a string")
+		}
+		return s, nil
+	case VariableNumber:
+		n, ok := value.(float64)
+		if !ok {
+			return "", errors.New("must be a number")
+		}
+		return strconv.FormatFloat(n, 'f', -1, 64), nil
+	case VariableDate:
+		s, _ := value.(string)
+		if t, err := time.Parse(time.DateOnly, s); err == nil {
+			return t.Format(time.DateOnly), nil
+		}
+		if t, err := time.Parse(time.RFC3339, s); err == nil {
+			return t.Format(time.DateOnly), nil
+		}
+		return "", errors.New("must be a YYYY-MM-DD date or RFC 3339 timestamp")
+	case VariableMoney:
+		m, _ := value.(map[string]interface{})
+		minor, okAmount := m["amount_minor"].(float64)
+		currency, okCurrency := m["currency"].(string)
+		if !okAmount || !okCurrency || minor != math.Trunc(minor) {
+			return "", errors.New("must be {\"amount_minor\": <integer>, \"currency\": \"<ISO 4217 code>\"}")
+		}
+		c, ok := lookupCurrency(currency)
+		if !ok {
+			return "", fmt.Errorf("has unsupported currency %q", currency)
+		}
+		return c.format(int64(minor)) + " " + c.Code, nil
+	}
+	return "", fmt.Errorf("has unknown type %q", variable.Type)
+}
+
+// gsmCharacters is the GSM 03.38 basic character set; gsmExtension characters take two
+const (
+	gsmCharacters = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+	gsmExtension  = "^{}\\[~]|€\f"
+)
+
+// smsSegments counts the SMS messages a body is sent as: 160 GSM characters or 70
+// UCS-2 characters fit in one, and longer bodies are split into parts of 153 or 67
+func smsSegments(body string) int {
+	length, gsm := 0, true
+	for _, r := range body {
+		switch {
+		case strings.ContainsRune(gsmCharacters, r):
+			length++
+		case strings.ContainsRune(gsmExtension, r):
+			length += 2
+		default:
+			gsm = false
+		}
+	}
+	single, part := 160, 153
+	if !gsm {
+		length, single, part = len([]rune(body)), 70, 67
+	}
+	if length <= single {
+		return 1
+	}
+	return (length + part - 1) / part
+}
+
+// TemplateStore holds message templates and their versions, the messages sent from
+// them and per-template delivery analytics
+type TemplateStore struct {
+	mu        sync.RWMutex
+	templates map[string]*MessageTemplate
+	now       func() time.Time
+
+	sender   NotificationSender
+	messages map[string]*Message
+	order    []string // message IDs, oldest first, for eviction
+	stats    map[string]*templateStats
+	seq      int
+
+	// calendars holds tenants' business hours, outside which messages are held;
+	// schedule runs a held message's delivery after a delay
+	calendars *calendar.Registry
+	schedule  func(time.Duration, func())
+}
+
+// NewTemplateStore creates an empty store sending through sender, which may be nil
+// when messages cannot be delivered
+func NewTemplateStore(sender NotificationSender) *TemplateStore {
+	return &TemplateStore{
+		templates: make(map[string]*MessageTemplate),
+		now:       time.Now,
+		sender:    sender,
+		schedule:  func(d time.Duration, f func()) { time.AfterFunc(d, f) },
+		messages:  make(map[string]*Message),
+		stats:     make(map[string]*templateStats),
+	}
+}
+
+// Create validates and stores a new template as version 1
+func (s *TemplateStore) Create(req CreateTemplateRequest) (MessageTemplate, error) {
+	var problems []string
+	if !templateIDPattern.MatchString(req.ID) {
+		problems = append(problems, "id must be 1-64 lowercase letters, digits or '-', starting with a letter")
+	}
+	if !templateChannels[req.Channel] {
+		problems = append(problems, "channel must be email or sms")
+	}
+	if req.Category == "" {
+		req.Category = CategoryGeneral
+	}
+	if !templateCategories[req.Category] {
+		problems = append(problems, "category must be statement, receipt, estimate or general")
+	}
+	if err := validateTemplateVersion(req.Channel, req.Variables, req.Locales); err != nil {
+		problems = append(problems, err.(*TemplateError).Problems...)
+	}
+	if len(problems) > 0 {
+		return MessageTemplate{}, &TemplateError{Problems: problems}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.templates[req.ID]; exists {
+		return MessageTemplate{}, fmt.Errorf("%w: %s", ErrTemplateExists, req.ID)
+	}
+	now := s.now().UTC()
+	t := &MessageTemplate{
+		ID:          req.ID,
+		Channel:     req.Channel,
+		Category:    req.Category,
+		Description: req.Description,
+		Versions:    []TemplateVersion{{Version: 1, Variables: nonNilVariables(req.Variables), Locales: req.Locales, CreatedAt: now}},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	s.templates[t.ID] = t
+	return *t, nil
+}
+
+// AddVersion validates and appends a new version, which becomes the one messages use
+func (s *TemplateStore) AddVersion(id string, req TemplateVersionRequest) (TemplateVersion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.templates[id]
+	if !ok {
+		return TemplateVersion{}, fmt.Errorf("%w: %s", ErrTemplateNotFound, id)
+	}
+	if err := validateTemplateVersion(t.Channel, req.Variables, req.Locales); err != nil {
+		return TemplateVersion{}, err
+	}
+	now := s.now().UTC()
+	version := TemplateVersion{Version: len(t.Versions) + 1, Variables: nonNilVariables(req.Variables), Locales: req.Locales, CreatedAt: now}
+	t.Versions = append(t.Versions, version)
+	t.UpdatedAt = now
+	return version, nil
+}
+
+// Get returns a template with every version
+func (s *TemplateStore) Get(id string) (MessageTemplate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.templates[id]
+	if !ok {
+		return MessageTemplate{}, fmt.Errorf("%w: %s", ErrTemplateNotFound, id)
+	}
+	return *t, nil
+}
+
+// List summarises every template, optionally of one channel or category, by ID
+func (s *TemplateStore) List(channel, category string) []TemplateSummary {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]TemplateSummary, 0, len(s.templates))
+	for _, t := range s.templates {
+		if (channel == "" || t.Channel == channel) && (category == "" || t.Category == category) {
+			out = append(out, t.summary())
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// Render renders a template version in the closest locale; version 0 is the latest
+func (s *TemplateStore) Render(id string, version int, locale string, values map[string]interface{}, useExamples bool) (RenderedMessage, error) {
+	s.mu.RLock()
+	t, ok := s.templates[id]
+	if !ok {
+		s.mu.RUnlock()
+		return RenderedMessage{}, fmt.Errorf("%w: %s", ErrTemplateNotFound, id)
+	}
+	v, err := t.version(version)
+	channel := t.Channel
+	s.mu.RUnlock()
+	if err != nil {
+		return RenderedMessage{}, err
+	}
+
+	content, resolved, err := v.render(locale, values, useExamples)
+	if err != nil {
+		return RenderedMessage{}, err
+	}
+	msg := RenderedMessage{
+		TemplateID: id,
+		Version:    v.Version,
+		Channel:    channel,
+		Locale:     resolved,
+		Subject:    content.Subject,
+		Body:       content.Body,
+		Characters: len([]rune(content.Body)),
+	}
+	if channel == ChannelSMS {
+		msg.Segments = smsSegments(content.Body)
+	}
+	return msg, nil
+}
+
+func nonNilVariables(variables []TemplateVariable) []TemplateVariable {
+	if variables == nil {
+		return []TemplateVariable{}
+	}
+	return variables
+}
+
+// writeTemplateError maps store errors to responses. Validation problems are listed
+// in a 422 so every one can be fixed at once.
+func writeTemplateError(w http.ResponseWriter, err error) {
+	var invalid *TemplateError
+	switch {
+	case errors.As(err, &invalid):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":    "invalid template",
+			"problems": invalid.Problems,
+		})
+	case errors.Is(err, ErrTemplateNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrTemplateExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// decodeTemplateBody reads a JSON request body of at most 1MB
+func decodeTemplateBody(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(dst); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// ListHandler handles GET /api/v1/templates, filtered by ?channel= and ?category=
+func (s *TemplateStore) ListHandler(w http.ResponseWriter, r *http.Request) {
+	templates := s.List(r.URL.Query().Get("channel"), r.URL.Query().Get("category"))
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"templates": templates,
+		"count":     len(templates),
+	})
+}
+
+// CreateHandler handles POST /api/v1/templates
+func (s *TemplateStore) CreateHandler(w http.ResponseWriter, r *http.Request) {
+	var req CreateTemplateRequest
+	if !decodeTemplateBody(w, r, &req) {
+		return
+	}
+	t, err := s.Create(req)
+	if err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/v1/templates/"+t.ID)
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(t)
+}
+
+// GetHandler handles GET /api/v1/templates/{templateID}
+func (s *TemplateStore) GetHandler(w http.ResponseWriter, r *http.Request) {
+	t, err := s.Get(chi.URLParam(r, "templateID"))
+	if err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(t)
+}
+
+// AddVersionHandler handles POST /api/v1/templates/{templateID}/versions
+func (s *TemplateStore) AddVersionHandler(w http.ResponseWriter, r *http.Request) {
+	var req TemplateVersionRequest
+	if !decodeTemplateBody(w, r, &req) {
+		return
+	}
+	version, err := s.AddVersion(chi.URLParam(r, "templateID"), req)
+	if err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(version)
+}
+
+// PreviewRequest renders a template without sending it. Version 0 is the latest;
+// variables left out take their examples.
+type PreviewRequest struct {
+	Version   int                    `json:"version,omitempty"`
+	Locale    string                 `json:"locale,omitempty"`
+	Variables map[string]interface{} `json:"variables,omitempty"`
+}
+
+// PreviewHandler handles POST /api/v1/templates/{templateID}/preview
+func (s *TemplateStore) PreviewHandler(w http.ResponseWriter, r *http.Request) {
+	var req PreviewRequest
+	if !decodeTemplateBody(w, r, &req) {
+		return
+	}
+	msg, err := s.Render(chi.URLParam(r, "templateID"), req.Version, req.Locale, req.Variables, true)
+	if err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+	RecordTemplateMessage(msg.TemplateID, msg.Channel, "preview")
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(msg)
+}
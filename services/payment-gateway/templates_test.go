@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/healthcare-gitops/common/calendar"
+)
+
+// fakeSender records notifications and fails those addressed to refuse
+type fakeSender struct {
+	mu     sync.Mutex
+	sent   []Notification
+	refuse string
+}
+
+func (f *fakeSender) Send(ctx context.Context, n Notification) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if n.To == f.refuse {
+		return errors.New("mailbox unavailable")
+	}
+	f.sent = append(f.sent, n)
+	return nil
+}
+
+func statementTemplate() CreateTemplateRequest {
+	return CreateTemplateRequest{
+		ID:       "statement-ready",
+		Channel:  ChannelEmail,
+		Category: CategoryStatement,
+		Variables: []TemplateVariable{
+			{Name: "patient_name", Type: VariableString, Required: true, Example: "Alex"},
+			{Name: "balance", Type: VariableMoney, Required: true, Example: map[string]interface{}{"amount_minor": 12500.0, "currency": "usd"}},
+			{Name: "due_date", Type: VariableDate, Required: true, Example: "2026-11-01"},
+		},
+		Locales: map[string]LocaleContent{
+			"en": {Subject: "Your statement is ready", Body: "Hi {{patient_name}}, you owe {{ balance }} by {{due_date}}."},
+			"es": {Subject: "Su estado de cuenta", Body: "Hola {{patient_name}}, debe {{balance}} antes del {{due_date}}."},
+		},
+	}
+}
+
+func TestTemplateValidation(t *testing.T) {
+	s := NewTemplateStore(nil)
+	if _, err := s.Create(statementTemplate()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Create(statementTemplate()); !errors.Is(err, ErrTemplateExists) {
+		t.Fatalf("expected ErrTemplateExists, got %v", err)
+	}
+
+	bad := statementTemplate()
+	bad.ID = "SMS"
+	bad.Channel = ChannelSMS
+	bad.Variables = append(bad.Variables, TemplateVariable{Name: "visits", Type: "integer"})
+	bad.Locales = map[string]LocaleContent{"fr": {Body: "Bonjour {{name}}"}}
+	_, err := s.Create(bad)
+	var invalid *TemplateError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("expected a TemplateError, got %v", err)
+	}
+	for _, want := range []string{"id must be", "type must be", "default locale en", "{{name}} is not a declared variable"} {
+		if !strings.Contains(invalid.Error(), want) {
+			t.Errorf("expected problem %q in %q", want, invalid.Error())
+		}
+	}
+
+	// SMS templates have no subject; email templates need one in every locale
+	sms := statementTemplate()
+	sms.ID, sms.Channel = "statement-sms", ChannelSMS
+	if _, err := s.Create(sms); err == nil || !strings.Contains(err.Error(), "SMS templates have no subject") {
+		t.Fatalf("expected subject rejection, got %v", err)
+	}
+	_, err = s.AddVersion("statement-ready", TemplateVersionRequest{Locales: map[string]LocaleContent{"en": {Body: "Hi"}}})
+	if err == nil || !strings.Contains(err.Error(), "need a subject") {
+		t.Fatalf("expected missing subject, got %v", err)
+	}
+}
+
+func TestTemplateRender(t *testing.T) {
+	s := NewTemplateStore(nil)
+	if _, err := s.Create(statementTemplate()); err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]interface{}{
+		"patient_name": "Sam",
+		"balance":      map[string]interface{}{"amount_minor": 4250.0, "currency": "USD"},
+		"due_date":     "2026-12-15T00:00:00Z",
+	}
+
+	cases := []struct {
+		locale, wantLocale, wantBody string
+	}{
+		{"es-MX", "es", "Hola Sam, debe 42.50 USD antes del 2026-12-15."},
+		{"fr", "en", "Hi Sam, you owe 42.50 USD by 2026-12-15."},
+		{"", "en", "Hi Sam, you owe 42.50 USD by 2026-12-15."},
+	}
+	for _, tc := range cases {
+		msg, err := s.Render("statement-ready", 0, tc.locale, values, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Locale != tc.wantLocale || msg.Body != tc.wantBody {
+			t.Errorf("locale %q: expected %s %q, got %s %q", tc.locale, tc.wantLocale, tc.wantBody, msg.Locale, msg.Body)
+		}
+	}
+
+	_, err := s.Render("statement-ready", 0, "en", map[string]interface{}{"patient_name": 7.0, "ssn": "x"}, false)
+	if err == nil {
+		t.Fatal("expected invalid values to be rejected")
+	}
+	for _, want := range []string{"patient_name must be a string", "balance is required", "ssn is not a variable"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected problem %q in %q", want, err.Error())
+		}
+	}
+
+	preview, err := s.Render("statement-ready", 0, "en", map[string]interface{}{"patient_name": "Sam"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.Body != "Hi Sam, you owe 125.00 USD by 2026-11-01." {
+		t.Errorf("expected examples in preview, got %q", preview.Body)
+	}
+}
+
+func TestSMSSegments(t *testing.T) {
+	cases := []struct {
+		body string
+		want int
+	}{
+		{strings.Repeat("a", 160), 1},
+		{strings.Repeat("a", 161), 2},
+		{strings.Repeat("€", 80), 1},
+		{strings.Repeat("€", 81), 2},
+		{strings.Repeat("ă", 70), 1},
+		{strings.Repeat("ă", 71), 2},
+	}
+	for _, tc := range cases {
+		if got := smsSegments(tc.body); got != tc.want {
+			t.Errorf("%d runes of %q: expected %d segments, got %d", len([]rune(tc.body)), tc.body[:2], tc.want, got)
+		}
+	}
+}
+
+func TestTemplateSendAndAnalytics(t *testing.T) {
+	sender := &fakeSender{refuse: "bounce@example.com"}
+	s := NewTemplateStore(sender)
+	if _, err := s.Create(statementTemplate()); err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]interface{}{
+		"patient_name": "Sam",
+		"balance":      map[string]interface{}{"amount_minor": 4250.0, "currency": "USD"},
+		"due_date":     "2026-12-15",
+	}
+
+	if _, err := s.Send(context.Background(), "statement-ready", SendRequest{To: "not-an-address", Variables: values}); err == nil {
+		t.Fatal("expected an invalid recipient to be rejected")
+	}
+	first, err := s.Send(context.Background(), "statement-ready", SendRequest{To: "sam@example.com", Locale: "es", Variables: values})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := s.Send(context.Background(), "statement-ready", SendRequest{To: "sam@example.com", Variables: values})
+	if err != nil {
+		t.Fatal(err)
+	}
+	refused, err := s.Send(context.Background(), "statement-ready", SendRequest{To: "bounce@example.com", Variables: values})
+	if err == nil || refused.Status != MessageFailed {
+		t.Fatalf("expected a refused message to fail, got %+v %v", refused, err)
+	}
+	if len(sender.sent) != 2 || sender.sent[0].MessageID != first.ID || sender.sent[0].Subject != "Su estado de cuenta" {
+		t.Fatalf("unexpected notifications: %+v", sender.sent)
+	}
+
+	if _, err := s.UpdateStatus(first.ID, MessageDelivered); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.UpdateStatus(second.ID, MessageDelivered); err != nil {
+		t.Fatal(err)
+	}
+	// A delivered email that later bounces counts as bounced only
+	if _, err := s.UpdateStatus(second.ID, MessageBounced); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.UpdateStatus("MSG-99999999", MessageDelivered); !errors.Is(err, ErrMessageNotFound) {
+		t.Fatalf("expected ErrMessageNotFound, got %v", err)
+	}
+
+	analytics, err := s.Analytics("statement-ready")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DeliveryCounts{Sent: 3, Delivered: 1, Bounced: 1, Failed: 1}
+	if analytics.Totals != want {
+		t.Errorf("expected totals %+v, got %+v", want, analytics.Totals)
+	}
+	if analytics.ByLocale["es"] != (DeliveryCounts{Sent: 1, Delivered: 1}) || analytics.ByVersion["1"] != want {
+		t.Errorf("unexpected breakdown: %+v %+v", analytics.ByLocale, analytics.ByVersion)
+	}
+	if analytics.DeliveryRate < 0.33 || analytics.DeliveryRate > 0.34 || analytics.LastSentAt == nil {
+		t.Errorf("unexpected analytics: %+v", analytics)
+	}
+}
+
+func TestTemplateSendWaitsForBusinessHours(t *testing.T) {
+	sender := &fakeSender{}
+	s := NewTemplateStore(sender)
+	calendars, err := calendar.NewRegistry(calendar.Calendar{
+		Tenant:   "st-marys",
+		Hours:    map[string][]calendar.Interval{"monday": {{Start: "09:00", End: "17:00"}}, "tuesday": {{Start: "09:00", End: "17:00"}}},
+		Holidays: []calendar.Holiday{{Date: "2026-10-19", Name: "Staff day"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.calendars = calendars
+	now := time.Date(2026, 10, 18, 20, 0, 0, 0, time.UTC) // Sunday evening
+	s.now = func() time.Time { return now }
+	var delay time.Duration
+	var deliver func()
+	s.schedule = func(d time.Duration, f func()) { delay, deliver = d, f }
+
+	if _, err := s.Create(statementTemplate()); err != nil {
+		t.Fatal(err)
+	}
+	receipt := statementTemplate()
+	receipt.ID, receipt.Category = "payment-receipt", CategoryReceipt
+	if _, err := s.Create(receipt); err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]interface{}{
+		"patient_name": "Sam",
+		"balance":      map[string]interface{}{"amount_minor": 4250.0, "currency": "USD"},
+		"due_date":     "2026-12-15",
+	}
+
+	// Monday is a holiday, so the statement waits for Tuesday morning
+	held, err := s.Send(context.Background(), "statement-ready", SendRequest{To: "sam@example.com", Variables: values, Tenant: "st-marys"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opens := time.Date(2026, 10, 20, 9, 0, 0, 0, time.UTC)
+	if held.Status != MessageScheduled || held.ScheduledFor == nil || !held.ScheduledFor.Equal(opens) || delay != opens.Sub(now) {
+		t.Fatalf("expected the message held until %s, got %+v after %s", opens, held, delay)
+	}
+	if len(sender.sent) != 0 {
+		t.Fatalf("expected nothing sent yet, got %+v", sender.sent)
+	}
+	// Receipts and tenants without a calendar are not held
+	if msg, err := s.Send(context.Background(), "payment-receipt", SendRequest{To: "sam@example.com", Variables: values, Tenant: "st-marys"}); err != nil || msg.Status != MessageSent {
+		t.Fatalf("expected the receipt sent at once, got %+v %v", msg, err)
+	}
+	if msg, err := s.Send(context.Background(), "statement-ready", SendRequest{To: "sam@example.com", Variables: values, Tenant: "other"}); err != nil || msg.Status != MessageSent {
+		t.Fatalf("expected a message for a tenant without a calendar sent at once, got %+v %v", msg, err)
+	}
+
+	now = opens
+	deliver()
+	if len(sender.sent) != 3 || sender.sent[2].MessageID != held.ID {
+		t.Fatalf("expected the held message sent when business hours began, got %+v", sender.sent)
+	}
+	if analytics, _ := s.Analytics("statement-ready"); analytics.Totals.Sent != 2 {
+		t.Fatalf("expected the held message counted once sent, got %+v", analytics.Totals)
+	}
+	if _, err := s.UpdateStatus(held.ID, MessageDelivered); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTemplateEndpoints(t *testing.T) {
+	notifications := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n Notification
+		if r.URL.Path != "/api/v1/notifications" || json.NewDecoder(r.Body).Decode(&n) != nil || n.To != "+15551234567" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer notifications.Close()
+	h := NewServer(Config{Port: "0", ServiceName: "payment-gateway", MaxProcessingMillis: 4, NotificationServiceURL: notifications.URL}).Handler
+
+	do := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(method, path, bytes.NewReader(payload)))
+		return rr
+	}
+
+	receipt := CreateTemplateRequest{
+		ID:        "receipt-sms",
+		Channel:   ChannelSMS,
+		Category:  CategoryReceipt,
+		Variables: []TemplateVariable{{Name: "amount", Type: VariableMoney, Required: true}},
+		Locales:   map[string]LocaleContent{"en": {Body: "Payment of {{amount}} received. Thank you."}},
+	}
+	if rr := do("POST", "/api/v1/templates", receipt); rr.Code != http.StatusCreated {
+		t.Fatalf("create expected 201, got %d: %s", rr.Code, rr.Body)
+	}
+	receipt.Locales = nil
+	if rr := do("POST", "/api/v1/templates", receipt); rr.Code != http.StatusUnprocessableEntity || !strings.Contains(rr.Body.String(), "problems") {
+		t.Fatalf("invalid create expected 422 with problems, got %d: %s", rr.Code, rr.Body)
+	}
+	version := TemplateVersionRequest{
+		Variables: []TemplateVariable{{Name: "amount", Type: VariableMoney, Required: true}},
+		Locales:   map[string]LocaleContent{"en": {Body: "We received {{amount}}. Thank you!"}},
+	}
+	if rr := do("POST", "/api/v1/templates/receipt-sms/versions", version); rr.Code != http.StatusCreated {
+		t.Fatalf("add version expected 201, got %d: %s", rr.Code, rr.Body)
+	}
+
+	rr := do("POST", "/api/v1/templates/receipt-sms/preview", PreviewRequest{Version: 1, Variables: map[string]interface{}{
+		"amount": map[string]interface{}{"amount_minor": 5000, "currency": "JPY"},
+	}})
+	var preview RenderedMessage
+	if rr.Code != http.StatusOK || json.NewDecoder(rr.Body).Decode(&preview) != nil {
+		t.Fatalf("preview expected 200, got %d: %s", rr.Code, rr.Body)
+	}
+	if preview.Body != "Payment of 5000 JPY received. Thank you." || preview.Segments != 1 || preview.Version != 1 {
+		t.Errorf("unexpected preview: %+v", preview)
+	}
+
+	send := SendRequest{To: "+15551234567", Variables: map[string]interface{}{"amount": map[string]interface{}{"amount_minor": 2000, "currency": "USD"}}}
+	rr = do("POST", "/api/v1/templates/receipt-sms/send", send)
+	var msg Message
+	if rr.Code != http.StatusAccepted || json.NewDecoder(rr.Body).Decode(&msg) != nil || msg.Version != 2 {
+		t.Fatalf("send expected 202 with version 2, got %d: %s", rr.Code, rr.Body)
+	}
+	send.To = "+15550000000"
+	if rr := do("POST", "/api/v1/templates/receipt-sms/send", send); rr.Code != http.StatusBadGateway {
+		t.Fatalf("refused send expected 502, got %d", rr.Code)
+	}
+	if rr := do("POST", "/api/v1/notifications/status", DeliveryStatusRequest{MessageID: msg.ID, Status: MessageDelivered}); rr.Code != http.StatusOK {
+		t.Fatalf("status expected 200, got %d: %s", rr.Code, rr.Body)
+	}
+
+	rr = do("GET", "/api/v1/templates/receipt-sms/analytics", nil)
+	var analytics TemplateAnalytics
+	if rr.Code != http.StatusOK || json.NewDecoder(rr.Body).Decode(&analytics) != nil {
+		t.Fatalf("analytics expected 200, got %d: %s", rr.Code, rr.Body)
+	}
+	if analytics.Totals != (DeliveryCounts{Sent: 2, Delivered: 1, Failed: 1}) || analytics.DeliveryRate != 0.5 {
+		t.Errorf("unexpected analytics: %+v", analytics)
+	}
+
+	rr = do("GET", "/api/v1/templates?channel=sms", nil)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"latest_version":2`) {
+		t.Fatalf("list expected receipt-sms at version 2, got %d: %s", rr.Code, rr.Body)
+	}
+	if rr := do("GET", "/api/v1/templates/missing", nil); rr.Code != http.StatusNotFound {
+		t.Fatalf("missing template expected 404, got %d", rr.Code)
+	}
+
+	// Without a notification service, templates can be managed but not sent
+	h = NewServer(Config{Port: "0", ServiceName: "payment-gateway", MaxProcessingMillis: 4}).Handler
+	if rr := do("POST", "/api/v1/templates/receipt-sms/send", send); rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("send without notification service expected 503, got %d", rr.Code)
+	}
+}
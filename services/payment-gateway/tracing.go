@@ -4,6 +4,7 @@ import (
 
 	"context"
 	"github.com/healthcare-gitops/common/config"
+	"github.com/healthcare-gitops/common/health"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
@@ -43,7 +44,7 @@ func InitTracerProvider(serviceName, otlpEndpoint string) (*sdktrace.TracerProvi
 
 	// Create tracer provider
 	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exporter),
+		sdktrace.WithBatcher(health.TrackedExporter[sdktrace.ReadOnlySpan]{SpanExporter: exporter, Tracker: &exporterHealth}),
 		sdktrace.WithResource(res),
 		sdktrace.WithSampler(sdktrace.AlwaysSample()),
 	)
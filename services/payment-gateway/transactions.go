@@ -0,0 +1,558 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/healthcare-gitops/common/honeytoken"
+)
+
+// maxIndexedTransactions bounds the search index; the oldest transactions are dropped
+// once it is full
+const maxIndexedTransactions = 100000
+
+// Search page sizes
+const (
+	defaultTransactionPageSize = 50
+	maxTransactionPageSize     = 500
+)
+
+// maxTransactionExport bounds the rows in one export; larger result sets must be
+// narrowed first
+const maxTransactionExport = 10000
+
+// Compliance tags applied to transactions, matching the compliance headers on the
+// payment response
+const (
+	TagSOX       = "sox"
+	TagHIPAA     = "hipaa"
+	TagFDA       = "fda"
+	TagHighValue = "high_value"
+)
+
+// Transaction is an authorized payment as kept for search
+type Transaction struct {
+	ID       string `json:"id"`
+	AuditID  string `json:"audit_id"`
+	AuthCode string `json:"auth_code"`
+	// Processor authorized the payment; ProcessorReference is its ID for it
+	Processor          string    `json:"processor,omitempty"`
+	ProcessorReference string    `json:"processor_reference,omitempty"`
+	Status             string    `json:"status"`
+	Amount             Money     `json:"amount"`
+	CustomerID         string    `json:"customer_id"`
+	Method             string    `json:"method"`
+	PatientID          string    `json:"patient_id,omitempty"`
+	DeviceID           string    `json:"device_id,omitempty"`
+	Description        string    `json:"description,omitempty"`
+	ComplianceTags     []string  `json:"compliance_tags"`
+	HighValue          bool      `json:"high_value"`
+	ProcessedAt        time.Time `json:"processed_at"`
+	// CapturedAt and VoidedAt are set when the payment is captured or voided
+	CapturedAt *time.Time `json:"captured_at,omitempty"`
+	VoidedAt   *time.Time `json:"voided_at,omitempty"`
+	// Refunded is the total refunded so far, and Refunds each refund, oldest first
+	Refunded *Money   `json:"refunded,omitempty"`
+	Refunds  []Refund `json:"refunds,omitempty"`
+	// ExchangeRate is the rate to the reporting currency when the payment was
+	// authorized, and ReportingAmount the amount converted at it, so reports never
+	// depend on today's rates
+	ExchangeRate    *ExchangeRate `json:"exchange_rate,omitempty"`
+	ReportingAmount *Money        `json:"reporting_amount,omitempty"`
+	// Card is the token of the card paid with; card numbers are never recorded
+	Card *CardToken `json:"card,omitempty"`
+	// Approval is set on payments that were held for approval, with who initiated
+	// and who approved them
+	Approval *Approval `json:"approval,omitempty"`
+	// Risk is the risk scorer's assessment of the payment before it was authorized
+	Risk *RiskAssessment `json:"risk,omitempty"`
+}
+
+// newTransaction builds the searchable record of an authorized payment
+func newTransaction(req PaymentRequest, resp PaymentResponse) Transaction {
+	tags := []string{TagSOX}
+	if req.PatientID != "" {
+		tags = append(tags, TagHIPAA)
+	}
+	if req.DeviceID != "" {
+		tags = append(tags, TagFDA)
+	}
+	if resp.HighValue {
+		tags = append(tags, TagHighValue)
+	}
+	return Transaction{
+		ID:             resp.TransactionID,
+		AuditID:        resp.AuditID,
+		AuthCode:       resp.AuthCode,
+		Status:         resp.Status,
+		Amount:         Money{AmountMinor: req.AmountCents, Currency: strings.ToUpper(req.Currency)},
+		CustomerID:     req.CustomerID,
+		Method:         req.Method,
+		PatientID:      req.PatientID,
+		DeviceID:       req.DeviceID,
+		Description:    req.Description,
+		ComplianceTags: tags,
+		HighValue:      resp.HighValue,
+		ProcessedAt:    time.Unix(resp.ProcessedAt, 0).UTC(),
+		Card:           req.CardToken,
+	}
+}
+
+// TransactionQuery filters a search. Every set field must match.
+type TransactionQuery struct {
+	// Text matches transactions whose description, customer ID or method contain a
+	// word starting with each of its words, so "card refu" finds "Card refund"
+	Text       string
+	PatientID  string
+	CustomerID string
+	Method     string
+	Currency   string
+	// Tags must all be present on the transaction
+	Tags []string
+	// MinAmount and MaxAmount bound the amount in minor units, inclusive; zero is unset
+	MinAmount int64
+	MaxAmount int64
+	// From and To bound the processing time, inclusive
+	From time.Time
+	To   time.Time
+}
+
+// TransactionPage is one page of search results, newest first
+type TransactionPage struct {
+	Transactions []Transaction `json:"transactions"`
+	Count        int           `json:"count"`
+	Total        int           `json:"total"`
+	NextOffset   *int          `json:"next_offset,omitempty"`
+}
+
+// postings is the set of transactions, by sequence number, holding a term
+type postings map[uint64]struct{}
+
+// TransactionStore keeps recent transactions with inverted indexes for full-text and
+// structured search. Transactions are numbered in arrival order, since transaction IDs
+// are only unique to the millisecond.
+type TransactionStore struct {
+	mu           sync.RWMutex
+	transactions map[uint64]*Transaction
+	byID         map[string]uint64
+	next, oldest uint64
+	limit        int
+
+	// words maps each description/customer/method word to the transactions holding it;
+	// vocabulary is its sorted key set, for prefix lookups
+	words      map[string]postings
+	vocabulary []string
+	patients   map[string]postings
+	customers  map[string]postings
+	tags       map[string]postings
+
+	// decoys holds the decoy transactions whose reads raise a SOC alert
+	decoys *honeytoken.Registry
+	// repository also records seeded decoys, so listing transactions returns them like
+	// real ones
+	repository TransactionRepository
+}
+
+// NewTransactionStore creates an empty store holding up to maxIndexedTransactions
+func NewTransactionStore() *TransactionStore {
+	return &TransactionStore{
+		transactions: make(map[uint64]*Transaction),
+		byID:         make(map[string]uint64),
+		limit:        maxIndexedTransactions,
+		words:        make(map[string]postings),
+		patients:     make(map[string]postings),
+		customers:    make(map[string]postings),
+		tags:         make(map[string]postings),
+	}
+}
+
+// searchWords splits text into lower-case words on anything but letters and digits
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// textOf is the text indexed for full-text search
+func (t *Transaction) textOf() []string {
+	words := searchWords(t.Description)
+	words = append(words, searchWords(t.CustomerID)...)
+	return append(words, searchWords(t.Method)...)
+}
+
+// Add indexes a transaction, dropping the oldest if the store is full. A nil store
+// ignores it, so handlers built without search keep working.
+func (s *TransactionStore) Add(txn Transaction) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seq := s.next
+	s.next++
+	s.indexLocked(seq, txn)
+
+	for len(s.transactions) > s.limit {
+		s.removeLocked(s.oldest)
+		s.oldest++
+	}
+}
+
+// Update replaces an indexed transaction after a state change, such as a refund,
+// keeping its place in arrival order. A transaction not held is added.
+func (s *TransactionStore) Update(txn Transaction) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	seq, ok := s.byID[txn.ID]
+	if ok {
+		s.removeLocked(seq)
+		s.indexLocked(seq, txn)
+	}
+	s.mu.Unlock()
+	if !ok {
+		s.Add(txn)
+	}
+}
+
+func (s *TransactionStore) indexLocked(seq uint64, txn Transaction) {
+	s.transactions[seq] = &txn
+	s.byID[txn.ID] = seq
+	for _, word := range txn.textOf() {
+		s.addWord(word, seq)
+	}
+	addPosting(s.patients, txn.PatientID, seq)
+	addPosting(s.customers, txn.CustomerID, seq)
+	for _, tag := range txn.ComplianceTags {
+		addPosting(s.tags, tag, seq)
+	}
+}
+
+func addPosting(index map[string]postings, key string, seq uint64) {
+	if key == "" {
+		return
+	}
+	set, ok := index[key]
+	if !ok {
+		set = make(postings)
+		index[key] = set
+	}
+	set[seq] = struct{}{}
+}
+
+func removePosting(index map[string]postings, key string, seq uint64) bool {
+	set, ok := index[key]
+	if !ok {
+		return false
+	}
+	delete(set, seq)
+	if len(set) == 0 {
+		delete(index, key)
+		return true
+	}
+	return false
+}
+
+func (s *TransactionStore) addWord(word string, seq uint64) {
+	if _, ok := s.words[word]; !ok {
+		i := sort.SearchStrings(s.vocabulary, word)
+		s.vocabulary = append(s.vocabulary, "")
+		copy(s.vocabulary[i+1:], s.vocabulary[i:])
+		s.vocabulary[i] = word
+	}
+	addPosting(s.words, word, seq)
+}
+
+func (s *TransactionStore) removeLocked(seq uint64) {
+	txn, ok := s.transactions[seq]
+	if !ok {
+		return
+	}
+	delete(s.transactions, seq)
+	if s.byID[txn.ID] == seq {
+		delete(s.byID, txn.ID)
+	}
+	for _, word := range txn.textOf() {
+		if removePosting(s.words, word, seq) {
+			i := sort.SearchStrings(s.vocabulary, word)
+			s.vocabulary = append(s.vocabulary[:i], s.vocabulary[i+1:]...)
+		}
+	}
+	removePosting(s.patients, txn.PatientID, seq)
+	removePosting(s.customers, txn.CustomerID, seq)
+	for _, tag := range txn.ComplianceTags {
+		removePosting(s.tags, tag, seq)
+	}
+}
+
+// prefixPostings unions the postings of every word starting with prefix
+func (s *TransactionStore) prefixPostings(prefix string) postings {
+	union := make(postings)
+	for i := sort.SearchStrings(s.vocabulary, prefix); i < len(s.vocabulary) && strings.HasPrefix(s.vocabulary[i], prefix); i++ {
+		for seq := range s.words[s.vocabulary[i]] {
+			union[seq] = struct{}{}
+		}
+	}
+	return union
+}
+
+// intersect narrows candidates to set; nil candidates means no index has been applied yet
+func intersect(candidates, set postings) postings {
+	if candidates == nil {
+		return set
+	}
+	if len(set) < len(candidates) {
+		candidates, set = set, candidates
+	}
+	result := make(postings, len(candidates))
+	for seq := range candidates {
+		if _, ok := set[seq]; ok {
+			result[seq] = struct{}{}
+		}
+	}
+	return result
+}
+
+// Search returns every transaction matching q, newest first. The indexes narrow the
+// candidates; amount, time, currency and method are checked on what remains.
+func (s *TransactionStore) Search(q TransactionQuery) []Transaction {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var candidates postings
+	for _, word := range searchWords(q.Text) {
+		candidates = intersect(candidates, s.prefixPostings(word))
+	}
+	if q.PatientID != "" {
+		candidates = intersect(candidates, s.patients[q.PatientID])
+	}
+	if q.CustomerID != "" {
+		candidates = intersect(candidates, s.customers[q.CustomerID])
+	}
+	for _, tag := range q.Tags {
+		candidates = intersect(candidates, s.tags[strings.ToLower(tag)])
+	}
+
+	seqs := make([]uint64, 0, len(candidates))
+	if candidates == nil {
+		for seq := range s.transactions {
+			seqs = append(seqs, seq)
+		}
+	} else {
+		for seq := range candidates {
+			seqs = append(seqs, seq)
+		}
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] > seqs[j] })
+
+	results := make([]Transaction, 0, len(seqs))
+	for _, seq := range seqs {
+		txn := s.transactions[seq]
+		if q.matches(txn) {
+			results = append(results, *txn)
+		}
+	}
+	return results
+}
+
+// matches checks the filters that are not indexed
+func (q TransactionQuery) matches(txn *Transaction) bool {
+	switch {
+	case q.MinAmount > 0 && txn.Amount.AmountMinor < q.MinAmount:
+		return false
+	case q.MaxAmount > 0 && txn.Amount.AmountMinor > q.MaxAmount:
+		return false
+	case q.Currency != "" && !strings.EqualFold(txn.Amount.Currency, q.Currency):
+		return false
+	case q.Method != "" && !strings.EqualFold(txn.Method, q.Method):
+		return false
+	case !q.From.IsZero() && txn.ProcessedAt.Before(q.From):
+		return false
+	case !q.To.IsZero() && txn.ProcessedAt.After(q.To):
+		return false
+	}
+	return true
+}
+
+// Len returns how many transactions are indexed
+func (s *TransactionStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.transactions)
+}
+
+// parseTransactionQuery reads the search filters from query parameters
+func parseTransactionQuery(r *http.Request) (TransactionQuery, error) {
+	query := r.URL.Query()
+	q := TransactionQuery{
+		Text:       query.Get("q"),
+		PatientID:  query.Get("patient_id"),
+		CustomerID: query.Get("customer_id"),
+		Method:     query.Get("method"),
+		Currency:   query.Get("currency"),
+		Tags:       query["tag"],
+	}
+	for name, dst := range map[string]*int64{"min_amount": &q.MinAmount, "max_amount": &q.MaxAmount} {
+		if value := query.Get(name); value != "" {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < 1 {
+				return q, fmt.Errorf("%s must be a positive amount in minor units", name)
+			}
+			*dst = n
+		}
+	}
+	if q.MinAmount > 0 && q.MaxAmount > 0 && q.MinAmount > q.MaxAmount {
+		return q, fmt.Errorf("min_amount must not exceed max_amount")
+	}
+	for name, dst := range map[string]*time.Time{"from": &q.From, "to": &q.To} {
+		if value := query.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return q, fmt.Errorf("%s must be an RFC 3339 timestamp", name)
+			}
+			*dst = t
+		}
+	}
+	return q, nil
+}
+
+// SearchHandler handles GET /api/v1/transactions/search: full-text and structured
+// filters, newest first, paged with ?limit and ?offset
+func (s *TransactionStore) SearchHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := parseTransactionQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, offset := defaultTransactionPageSize, 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxTransactionPageSize {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxTransactionPageSize), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	if value := r.URL.Query().Get("offset"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			http.Error(w, "offset must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		offset = n
+	}
+
+	results := s.Search(q)
+	page := TransactionPage{Total: len(results)}
+	if offset > len(results) {
+		offset = len(results)
+	}
+	results = results[offset:]
+	if len(results) > limit {
+		results = results[:limit]
+		next := offset + limit
+		page.NextOffset = &next
+	}
+	page.Transactions, page.Count = results, len(results)
+	RecordTransactionSearch("search", page.Count)
+	s.checkDecoys(r, "search", results)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(page)
+}
+
+// transactionCSVHeader is the header row of CSV exports
+var transactionCSVHeader = []string{
+	"id", "processed_at", "amount_minor", "currency", "customer_id", "method",
+	"patient_id", "device_id", "description", "compliance_tags", "status", "auth_code", "audit_id",
+	"reporting_amount_minor", "reporting_currency", "exchange_rate", "exchange_rate_source", "exchange_rate_as_of",
+}
+
+// ExportHandler handles GET /api/v1/transactions/search/export: the whole result set
+// of a search as CSV (the default) or JSON, as an attachment
+func (s *TransactionStore) ExportHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := parseTransactionQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "json" {
+		http.Error(w, "format must be csv or json", http.StatusBadRequest)
+		return
+	}
+
+	results := s.Search(q)
+	if len(results) > maxTransactionExport {
+		http.Error(w, fmt.Sprintf("%d transactions match; narrow the search to at most %d to export", len(results), maxTransactionExport), http.StatusUnprocessableEntity)
+		return
+	}
+	RecordTransactionSearch("export", len(results))
+	s.checkDecoys(r, "export", results)
+
+	filename := "transactions-" + time.Now().UTC().Format("20060102-150405") + "." + format
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(results)))
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"transactions": results,
+			"count":        len(results),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	out := csv.NewWriter(w)
+	_ = out.Write(transactionCSVHeader)
+	for _, txn := range results {
+		reporting := make([]string, 5)
+		if txn.ReportingAmount != nil && txn.ExchangeRate != nil {
+			reporting = []string{
+				strconv.FormatInt(txn.ReportingAmount.AmountMinor, 10),
+				txn.ReportingAmount.Currency,
+				txn.ExchangeRate.Rate,
+				txn.ExchangeRate.Source,
+				txn.ExchangeRate.AsOf.Format(time.RFC3339),
+			}
+		}
+		_ = out.Write(append([]string{
+			txn.ID,
+			txn.ProcessedAt.Format(time.RFC3339),
+			strconv.FormatInt(txn.Amount.AmountMinor, 10),
+			txn.Amount.Currency,
+			csvSafe(txn.CustomerID),
+			csvSafe(txn.Method),
+			csvSafe(txn.PatientID),
+			csvSafe(txn.DeviceID),
+			csvSafe(txn.Description),
+			strings.Join(txn.ComplianceTags, ";"),
+			txn.Status,
+			txn.AuthCode,
+			txn.AuditID,
+		}, reporting...))
+	}
+	out.Flush()
+}
+
+// csvSafe keeps client-supplied text from being run as a formula when an export is
+// opened in a spreadsheet
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
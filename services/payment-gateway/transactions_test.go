@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testTransaction(id string, amount int64, customer, patient, description string, at time.Time) Transaction {
+	txn := newTransaction(PaymentRequest{
+		AmountCents: amount,
+		Currency:    "usd",
+		CustomerID:  customer,
+		Method:      "card",
+		PatientID:   patient,
+		Description: description,
+	}, PaymentResponse{Status: "authorized", ProcessedAt: at.Unix(), HighValue: amount >= 10000, TransactionID: id})
+	return txn
+}
+
+func TestTransactionStoreSearch(t *testing.T) {
+	s := NewTransactionStore()
+	at := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	s.Add(testTransaction("TXN-1", 2500, "cust-1", "pat-1", "Cardiology consult copay", at))
+	s.Add(testTransaction("TXN-2", 15000, "cust-1", "", "MRI scan, outpatient", at.Add(time.Hour)))
+	s.Add(testTransaction("TXN-3", 40000, "cust-2", "pat-1", "Cardiac surgery deposit", at.Add(2*time.Hour)))
+	s.Add(testTransaction("TXN-4", 900, "cust-3", "pat-2", "Pharmacy refund", at.Add(3*time.Hour)))
+
+	ids := func(results []Transaction) string {
+		out := ""
+		for _, txn := range results {
+			out += txn.ID + " "
+		}
+		return out
+	}
+
+	cases := []struct {
+		name  string
+		query TransactionQuery
+		want  string
+	}{
+		{"everything newest first", TransactionQuery{}, "TXN-4 TXN-3 TXN-2 TXN-1 "},
+		{"word prefix", TransactionQuery{Text: "cardi"}, "TXN-3 TXN-1 "},
+		{"every word must match", TransactionQuery{Text: "cardiac dep"}, "TXN-3 "},
+		{"patient", TransactionQuery{PatientID: "pat-1"}, "TXN-3 TXN-1 "},
+		{"patient and text", TransactionQuery{PatientID: "pat-1", Text: "copay"}, "TXN-1 "},
+		{"amount range", TransactionQuery{MinAmount: 1000, MaxAmount: 20000}, "TXN-2 TXN-1 "},
+		{"compliance tags", TransactionQuery{Tags: []string{"HIPAA", TagHighValue}}, "TXN-3 "},
+		{"time range", TransactionQuery{From: at.Add(30 * time.Minute), To: at.Add(2 * time.Hour)}, "TXN-3 TXN-2 "},
+		{"currency and customer", TransactionQuery{Currency: "USD", CustomerID: "cust-1"}, "TXN-2 TXN-1 "},
+		{"no match", TransactionQuery{Text: "dental"}, ""},
+	}
+	for _, tc := range cases {
+		if got := ids(s.Search(tc.query)); got != tc.want {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestTransactionStoreEvictsOldest(t *testing.T) {
+	s := NewTransactionStore()
+	s.limit = 3
+	at := time.Now()
+	for i := 1; i <= 5; i++ {
+		s.Add(testTransaction(fmt.Sprintf("TXN-%d", i), 1000, "cust-1", "", fmt.Sprintf("visit%d", i), at))
+	}
+	if s.Len() != 3 {
+		t.Fatalf("expected 3 transactions kept, got %d", s.Len())
+	}
+	if results := s.Search(TransactionQuery{Text: "visit1"}); len(results) != 0 {
+		t.Fatalf("expected evicted transaction to leave the index, got %+v", results)
+	}
+	if len(s.vocabulary) != 6 {
+		// card, cust, 1 and visit3-5 stay; visit1 and visit2 are gone
+		t.Fatalf("expected evicted words to leave the vocabulary, got %v", s.vocabulary)
+	}
+}
+
+func TestTransactionSearchEndpoints(t *testing.T) {
+	h := NewServer(Config{Port: "0", ServiceName: "payment-gateway", MaxProcessingMillis: 4}).Handler
+	for i := 0; i < 3; i++ {
+		body := fmt.Sprintf(`{"amount_cents": %d, "currency": "USD", "customer_id": "cust-%d", "method": "card", "patient_id": "pat-9", "description": "=Lab panel %d"}`, 1000*(i+1), i, i)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/v1/charge", bytes.NewBufferString(body)))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("charge expected 200, got %d", rr.Code)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/transactions/search?q=lab&tag=hipaa&min_amount=2000&limit=1", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("search expected 200, got %d: %s", rr.Code, rr.Body)
+	}
+	if rr.Header().Get("Deprecation") != "" || rr.Header().Get("API-Version") != APIVersionV1 {
+		t.Fatalf("unexpected version headers: %v", rr.Header())
+	}
+	var page TransactionPage
+	if err := json.NewDecoder(rr.Body).Decode(&page); err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 2 || page.Count != 1 || page.NextOffset == nil || *page.NextOffset != 1 {
+		t.Fatalf("unexpected page: %+v", page)
+	}
+	if page.Transactions[0].Amount.AmountMinor != 3000 || page.Transactions[0].PatientID != "pat-9" {
+		t.Fatalf("expected newest match first, got %+v", page.Transactions[0])
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/transactions/search?min_amount=5&max_amount=1", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("inverted amount range expected 400, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/transactions/search/export?patient_id=pat-9", nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "text/csv; charset=utf-8" {
+		t.Fatalf("export expected CSV, got %d %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	rows, err := csv.NewReader(rr.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 || rows[0][0] != "id" || rows[1][8] != "'=Lab panel 2" || rows[1][9] != "sox;hipaa" {
+		t.Fatalf("unexpected export rows: %v", rows)
+	}
+}
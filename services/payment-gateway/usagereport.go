@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+
+	"github.com/healthcare-gitops/common/features"
+	"github.com/healthcare-gitops/common/usagestats"
+	"github.com/rs/zerolog/log"
+)
+
+// newUsageReporter creates the reporter that sends anonymous usage telemetry when
+// USAGE_STATS_ENABLED opts in, and starts it sending every USAGE_STATS_INTERVAL_HOURS
+func newUsageReporter(cfg Config, flags *features.Flags) *usagestats.Reporter {
+	statsCfg := cfg.UsageStats
+	statsCfg.OnSend = func(err error) {
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to send usage stats")
+			return
+		}
+		log.Debug().Msg("Usage stats sent")
+	}
+	reporter := usagestats.NewReporter(statsCfg, usagestats.Source{Service: cfg.ServiceName, Version: apiSpecVersion, Flags: flags})
+	if reporter.Enabled() {
+		log.Info().Msg("Anonymous usage stats reporting enabled; preview at /admin/usage-stats")
+		go reporter.Run(context.Background())
+	}
+	return reporter
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/healthcare-gitops/common/usagestats"
+)
+
+func TestUsageReportPreview(t *testing.T) {
+	h := newAuthenticatedServer(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/transactions/search?patient_id=PT-00000001", nil)
+	req.Header.Set("Authorization", "Bearer reader")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	for token, want := range map[string]int{"": http.StatusUnauthorized, "reader": http.StatusForbidden, "admin": http.StatusOK} {
+		req := httptest.NewRequest(http.MethodGet, "/admin/usage-stats", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if rr.Code != want {
+			t.Fatalf("usage stats with %q: expected %d, got %d", token, want, rr.Code)
+		}
+		if rr.Code != http.StatusOK {
+			continue
+		}
+		var preview usagestats.Preview
+		if err := json.NewDecoder(rr.Body).Decode(&preview); err != nil {
+			t.Fatal(err)
+		}
+		report := preview.Payload
+		if preview.Enabled || report.Service != "payment-gateway" || report.Version != apiSpecVersion {
+			t.Fatalf("unexpected preview: %+v", preview)
+		}
+		if report.FeatureUsage[FeatureTransactionSearch] != 1 || !report.Features[FeatureTransactionSearch] || report.Features[FeatureUsageMetering] {
+			t.Fatalf("expected one transaction search and metering off, got %+v", report)
+		}
+	}
+}
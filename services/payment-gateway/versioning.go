@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// API versions served by the gateway. v1 is the unprefixed API (also mounted under
+// /api/v1); v2 lives under /api/v2.
+const (
+	APIVersionV1 = "v1"
+	APIVersionV2 = "v2"
+)
+
+// Default v1 retirement schedule, overridable with API_V1_DEPRECATED_AT and API_V1_SUNSET
+const (
+	defaultAPIv1DeprecatedAt = "2026-10-01"
+	defaultAPIv1Sunset       = "2027-04-01"
+)
+
+// apiV1Successor is the v2 resource that replaces the v1 payment endpoints
+const apiV1Successor = "/api/v2/payments"
+
+// Error codes returned in the v2 error envelope
+const (
+	ErrorCodeInvalidPayload  = "invalid_payload"
+	ErrorCodePayloadTooLarge = "payload_too_large"
+	ErrorCodeInvalidAmount   = "invalid_amount"
+	ErrorCodeMissingFields   = "missing_fields"
+	ErrorCodeUnavailable     = "unavailable"
+	ErrorCodeDeclined        = "payment_declined"
+	ErrorCodeInvalidCard     = "invalid_card"
+	ErrorCodeCardData        = "card_data_not_allowed"
+)
+
+// versionMiddleware labels responses with the API version that served them and
+// counts requests per version and route
+func versionMiddleware(version string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("API-Version", version)
+			next.ServeHTTP(w, r)
+
+			endpoint := r.URL.Path
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				endpoint = rctx.RoutePattern()
+			}
+			RecordAPIVersion(version, endpoint)
+		})
+	}
+}
+
+// deprecationMiddleware announces the v1 retirement schedule on every v1 response:
+// Deprecation (RFC 9745), Sunset (RFC 8594) and a link to the successor resource.
+// Zero dates fall back to the defaults.
+func deprecationMiddleware(deprecatedAt, sunset time.Time) func(http.Handler) http.Handler {
+	if deprecatedAt.IsZero() {
+		deprecatedAt, _ = time.Parse(time.DateOnly, defaultAPIv1DeprecatedAt)
+	}
+	if sunset.IsZero() {
+		sunset, _ = time.Parse(time.DateOnly, defaultAPIv1Sunset)
+	}
+	deprecation := "@" + strconv.FormatInt(deprecatedAt.Unix(), 10)
+	sunsetDate := sunset.UTC().Format(http.TimeFormat)
+	link := "<" + apiV1Successor + `>; rel="successor-version"`
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", deprecation)
+			w.Header().Set("Sunset", sunsetDate)
+			w.Header().Add("Link", link)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Money is an amount in the currency's minor unit (cents for USD), so amounts are
+// never rounded through floating point
+type Money struct {
+	AmountMinor int64  `json:"amount_minor"`
+	Currency    string `json:"currency"`
+}
+
+// PaymentRequestV2 is the v2 payment request
+type PaymentRequestV2 struct {
+	Amount      Money  `json:"amount"`
+	CustomerID  string `json:"customer_id"`
+	Method      string `json:"method"`
+	PatientID   string `json:"patient_id,omitempty"`
+	DeviceID    string `json:"device_id,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Card is tokenized before the payment is processed
+	Card *CardDetails `json:"card,omitempty"`
+}
+
+// PaymentResponseV2 is the v2 payment response
+type PaymentResponseV2 struct {
+	ID          string     `json:"id"`
+	Status      string     `json:"status"`
+	AuthCode    string     `json:"auth_code"`
+	Amount      Money      `json:"amount"`
+	HighValue   bool       `json:"high_value"`
+	AuditID     string     `json:"audit_id"`
+	ProcessedAt string     `json:"processed_at"`
+	Card        *CardToken `json:"card,omitempty"`
+}
+
+// ErrorEnvelope is the body of every v2 error response
+type ErrorEnvelope struct {
+	Error APIError `json:"error"`
+}
+
+// APIError is a machine-readable v2 error
+type APIError struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// toV1 translates a v2 request onto the shared service layer's request type
+func (req PaymentRequestV2) toV1() PaymentRequest {
+	return PaymentRequest{
+		AmountCents: req.Amount.AmountMinor,
+		Currency:    req.Amount.Currency,
+		CustomerID:  req.CustomerID,
+		Method:      req.Method,
+		PatientID:   req.PatientID,
+		DeviceID:    req.DeviceID,
+		Description: req.Description,
+		Card:        req.Card,
+	}
+}
+
+// paymentResponseV2 translates a service layer response into the v2 representation
+func paymentResponseV2(req PaymentRequestV2, resp PaymentResponse) PaymentResponseV2 {
+	return PaymentResponseV2{
+		ID:          resp.TransactionID,
+		Status:      resp.Status,
+		AuthCode:    resp.AuthCode,
+		Amount:      req.Amount,
+		HighValue:   resp.HighValue,
+		AuditID:     resp.AuditID,
+		ProcessedAt: time.Unix(resp.ProcessedAt, 0).UTC().Format(time.RFC3339),
+		Card:        resp.Card,
+	}
+}
+
+// writeAPIError writes a v2 error envelope
+func writeAPIError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(ErrorEnvelope{Error: APIError{
+		Code:      code,
+		Message:   message,
+		RequestID: middleware.GetReqID(r.Context()),
+	}})
+}
+
+// CreatePayment handles POST /api/v2/payments
+func (h PaymentHandler) CreatePayment(w http.ResponseWriter, r *http.Request) {
+	h.setSecurityHeaders(w)
+
+	raw, err := readPayload(w, r)
+	if errors.Is(err, errPayloadTooLarge) {
+		writeAPIError(w, r, http.StatusRequestEntityTooLarge, ErrorCodePayloadTooLarge, "request body exceeds 1MB")
+		return
+	}
+	var req PaymentRequestV2
+	if err == nil {
+		err = json.Unmarshal(raw, &req)
+	}
+	if err != nil {
+		writeAPIError(w, r, http.StatusBadRequest, ErrorCodeInvalidPayload, "request body is not a valid payment")
+		return
+	}
+
+	resp, err := h.authorize(w, r, req.toV1())
+	switch {
+	case errors.Is(err, ErrInvalidAmount):
+		message := "amount.amount_minor must be positive"
+		if err != ErrInvalidAmount {
+			message = err.Error()
+		}
+		writeAPIError(w, r, http.StatusUnprocessableEntity, ErrorCodeInvalidAmount, message)
+		return
+	case errors.Is(err, errTransactionNotRecorded):
+		writeAPIError(w, r, http.StatusServiceUnavailable, ErrorCodeUnavailable, "the payment could not be recorded; retry later")
+		return
+	case errors.Is(err, ErrProcessorUnavailable):
+		writeAPIError(w, r, http.StatusServiceUnavailable, ErrorCodeUnavailable, "the payment processor could not be reached; retry later")
+		return
+	case errors.Is(err, ErrExchangeRateUnavailable):
+		writeAPIError(w, r, http.StatusServiceUnavailable, ErrorCodeUnavailable, "exchange rates could not be read; retry later")
+		return
+	case errors.Is(err, ErrTokenizerUnavailable):
+		writeAPIError(w, r, http.StatusServiceUnavailable, ErrorCodeUnavailable, "the card could not be tokenized; retry later")
+		return
+	case errors.Is(err, ErrInvalidCard):
+		writeAPIError(w, r, http.StatusUnprocessableEntity, ErrorCodeInvalidCard, err.Error())
+		return
+	case errors.Is(err, ErrCardDataNotAllowed):
+		writeAPIError(w, r, http.StatusUnprocessableEntity, ErrorCodeCardData, err.Error())
+		return
+	case errors.Is(err, ErrPaymentDeclined):
+		writeAPIError(w, r, http.StatusPaymentRequired, ErrorCodeDeclined, err.Error())
+		return
+	case errors.Is(err, ErrMissingFields):
+		writeAPIError(w, r, http.StatusUnprocessableEntity, ErrorCodeMissingFields, "amount.currency, customer_id and method are required")
+		return
+	case err != nil:
+		writeAPIError(w, r, http.StatusBadRequest, ErrorCodeInvalidPayload, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(paymentResponseV2(req, resp))
+}
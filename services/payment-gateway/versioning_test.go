@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestV1EndpointsAnnounceDeprecation(t *testing.T) {
+	sunset := time.Date(2027, 6, 30, 0, 0, 0, 0, time.UTC)
+	h := NewServer(Config{Port: "0", ServiceName: "payment-gateway", APIv1Sunset: sunset}).Handler
+	before := testutil.ToFloat64(apiVersionRequests.WithLabelValues(APIVersionV1, "/api/v1/charge"))
+
+	for _, path := range []string{"/charge", "/api/v1/charge"} {
+		rr := httptest.NewRecorder()
+		body := `{"amount_cents":1500,"currency":"USD","customer_id":"c1","method":"card"}`
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", path, rr.Code)
+		}
+		if got := rr.Header().Get("Deprecation"); got != "@1790812800" {
+			t.Fatalf("%s: unexpected Deprecation %q", path, got)
+		}
+		if got := rr.Header().Get("Sunset"); got != "Wed, 30 Jun 2027 00:00:00 GMT" {
+			t.Fatalf("%s: unexpected Sunset %q", path, got)
+		}
+		if got := rr.Header().Get("Link"); got != `</api/v2/payments>; rel="successor-version"` {
+			t.Fatalf("%s: unexpected Link %q", path, got)
+		}
+		if rr.Header().Get("API-Version") != APIVersionV1 {
+			t.Fatalf("%s: expected API-Version v1", path)
+		}
+		var resp PaymentResponse
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil || resp.Status != "success" {
+			t.Fatalf("%s: unexpected v1 body %+v (%v)", path, resp, err)
+		}
+	}
+
+	if after := testutil.ToFloat64(apiVersionRequests.WithLabelValues(APIVersionV1, "/api/v1/charge")); after != before+1 {
+		t.Fatalf("expected one v1 request recorded for /api/v1/charge, got %v", after-before)
+	}
+}
+
+func TestCreatePaymentV2(t *testing.T) {
+	h := NewServer(Config{Port: "0", ServiceName: "payment-gateway"}).Handler
+	post := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/v2/payments", strings.NewReader(body)))
+		return rr
+	}
+
+	rr := post(`{"amount":{"amount_minor":25000,"currency":"USD"},"customer_id":"c1","method":"card","patient_id":"PAT1"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body)
+	}
+	if rr.Header().Get("Deprecation") != "" || rr.Header().Get("API-Version") != APIVersionV2 {
+		t.Fatalf("unexpected version headers: %v", rr.Header())
+	}
+	if rr.Header().Get("X-PHI-Protected") != "true" {
+		t.Fatal("expected v2 to share the v1 compliance headers")
+	}
+	var resp PaymentResponseV2
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.ID == "" || resp.Status != "authorized" || resp.Amount != (Money{AmountMinor: 25000, Currency: "USD"}) || !resp.HighValue {
+		t.Fatalf("unexpected v2 response: %+v", resp)
+	}
+	if _, err := time.Parse(time.RFC3339, resp.ProcessedAt); err != nil {
+		t.Fatalf("processed_at is not RFC 3339: %v", err)
+	}
+
+	tests := []struct {
+		body, code string
+		status     int
+	}{
+		{`{"amount":`, ErrorCodeInvalidPayload, http.StatusBadRequest},
+		{`{"amount":{"amount_minor":0,"currency":"USD"},"customer_id":"c1","method":"card"}`, ErrorCodeInvalidAmount, http.StatusUnprocessableEntity},
+		{`{"amount":{"amount_minor":100},"customer_id":"c1","method":"card"}`, ErrorCodeMissingFields, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		rr := post(tt.body)
+		var envelope ErrorEnvelope
+		if err := json.NewDecoder(rr.Body).Decode(&envelope); err != nil {
+			t.Fatalf("%s: %v", tt.code, err)
+		}
+		if rr.Code != tt.status || envelope.Error.Code != tt.code || envelope.Error.RequestID == "" {
+			t.Fatalf("expected %d %s, got %d %+v", tt.status, tt.code, rr.Code, envelope.Error)
+		}
+	}
+}
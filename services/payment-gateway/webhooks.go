@@ -0,0 +1,718 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	mathrand "math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/healthcare-gitops/common/config"
+	"github.com/healthcare-gitops/common/events"
+	"github.com/rs/zerolog/log"
+)
+
+// Payment event types delivered to webhook subscribers. Their payloads are the
+// events.PaymentSucceededV1, PaymentFailedV1 and RefundIssuedV1 schemas, so
+// subscribers can verify and decode deliveries with events.NewConsumer.
+const (
+	EventPaymentSucceeded = events.EventPaymentSucceeded
+	EventPaymentFailed    = events.EventPaymentFailed
+	EventRefundIssued     = events.EventRefundIssued
+)
+
+// Reasons a payment.failed event gives
+const (
+	FailureDeclined             = events.PaymentFailedV1ReasonDeclined
+	FailureProcessorUnavailable = events.PaymentFailedV1ReasonProcessorUnavailable
+	FailureNotRecorded          = events.PaymentFailedV1ReasonNotRecorded
+)
+
+var webhookEventTypes = map[string]bool{
+	EventPaymentSucceeded: true,
+	EventPaymentFailed:    true,
+	EventRefundIssued:     true,
+}
+
+// Webhook limits. A dead letter keeps its payload, so the queue is bounded; the
+// oldest are dropped first.
+const (
+	maxWebhooks              = 50
+	maxDeadLetters           = 1000
+	maxWebhookAttempts       = 20
+	minWebhookSecret         = 16
+	defaultWebhookAttempts   = 5
+	defaultWebhookBackoff    = time.Second
+	defaultWebhookMaxBackoff = 5 * time.Minute
+)
+
+var (
+	// ErrWebhookNotFound is returned for unknown subscriptions
+	ErrWebhookNotFound = errors.New("webhook not found")
+
+	// ErrDeadLetterNotFound is returned for unknown or already retried dead letters
+	ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+	errTooManyWebhooks = fmt.Errorf("at most %d webhooks can be registered", maxWebhooks)
+)
+
+// WebhookError lists the problems with a webhook registration
+type WebhookError struct {
+	Problems []string
+}
+
+func (e *WebhookError) Error() string {
+	return "invalid webhook: " + strings.Join(e.Problems, "; ")
+}
+
+// WebhookConfig sets how failed deliveries are retried. Zero fields take the
+// defaults: 5 attempts, backing off from 1s and doubling up to 5 minutes.
+type WebhookConfig struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// webhookConfigFromEnv reads WEBHOOK_MAX_ATTEMPTS, WEBHOOK_RETRY_BACKOFF_SECONDS and
+// WEBHOOK_MAX_BACKOFF_SECONDS
+func webhookConfigFromEnv() WebhookConfig {
+	attempts, _ := strconv.Atoi(config.GetEnv("WEBHOOK_MAX_ATTEMPTS", "0"))
+	backoff, _ := strconv.ParseFloat(config.GetEnv("WEBHOOK_RETRY_BACKOFF_SECONDS", "0"), 64)
+	maxBackoff, _ := strconv.ParseFloat(config.GetEnv("WEBHOOK_MAX_BACKOFF_SECONDS", "0"), 64)
+	return WebhookConfig{
+		MaxAttempts:    attempts,
+		InitialBackoff: time.Duration(backoff * float64(time.Second)),
+		MaxBackoff:     time.Duration(maxBackoff * float64(time.Second)),
+	}
+}
+
+// Validate checks the retry settings that are set
+func (c WebhookConfig) Validate() error {
+	c = c.withDefaults()
+	switch {
+	case c.MaxAttempts < 1 || c.MaxAttempts > maxWebhookAttempts:
+		return fmt.Errorf("WEBHOOK_MAX_ATTEMPTS must be between 1 and %d", maxWebhookAttempts)
+	case c.InitialBackoff < 0 || c.MaxBackoff < 0:
+		return errors.New("webhook retry backoff must be positive")
+	case c.InitialBackoff > c.MaxBackoff:
+		return errors.New("WEBHOOK_RETRY_BACKOFF_SECONDS must not exceed WEBHOOK_MAX_BACKOFF_SECONDS")
+	}
+	return nil
+}
+
+// withDefaults fills unset fields
+func (c WebhookConfig) withDefaults() WebhookConfig {
+	if c.MaxAttempts == 0 {
+		c.MaxAttempts = defaultWebhookAttempts
+	}
+	if c.InitialBackoff == 0 {
+		c.InitialBackoff = defaultWebhookBackoff
+	}
+	if c.MaxBackoff == 0 {
+		c.MaxBackoff = defaultWebhookMaxBackoff
+	}
+	return c
+}
+
+// backoff returns the delay before retry n (1-based), doubling from the initial
+// backoff up to the maximum, with up to 20% jitter so subscribers recovering from an
+// outage are not retried in lockstep
+func (c WebhookConfig) backoff(n int) time.Duration {
+	delay := c.InitialBackoff << uint(n-1)
+	if delay <= 0 || delay > c.MaxBackoff {
+		delay = c.MaxBackoff
+	}
+	return delay + time.Duration(mathrand.Int63n(int64(delay)/5+1))
+}
+
+// WebhookStats counts deliveries to one subscription
+type WebhookStats struct {
+	Delivered     int        `json:"delivered"`
+	DeadLettered  int        `json:"dead_lettered"`
+	LastAttemptAt *time.Time `json:"last_attempt_at,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+}
+
+// Webhook is a downstream system's callback URL. Empty Events receives every event
+// type. The secret signs deliveries and is never returned.
+type Webhook struct {
+	ID          string       `json:"id"`
+	URL         string       `json:"url"`
+	Events      []string     `json:"events"`
+	Description string       `json:"description,omitempty"`
+	CreatedAt   time.Time    `json:"created_at"`
+	Stats       WebhookStats `json:"stats"`
+	secret      string
+}
+
+// wants reports whether the webhook receives an event type
+func (wh *Webhook) wants(eventType string) bool {
+	if len(wh.Events) == 0 {
+		return true
+	}
+	for _, e := range wh.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookRequest registers a webhook
+type WebhookRequest struct {
+	URL         string   `json:"url"`
+	Secret      string   `json:"secret"`
+	Events      []string `json:"events,omitempty"`
+	Description string   `json:"description,omitempty"`
+}
+
+// WebhookEvent is the envelope delivered to subscribers, matching events.Envelope.
+// Redelivered dead letters keep their event ID so receivers can deduplicate.
+type WebhookEvent struct {
+	ID            string      `json:"id"`
+	Type          string      `json:"type"`
+	SchemaVersion int         `json:"schema_version"`
+	OccurredAt    time.Time   `json:"occurred_at"`
+	Data          interface{} `json:"data"`
+}
+
+// DeadLetter is a delivery that failed every attempt, or that the subscriber refused
+// with a 4xx. It keeps the exact payload so it can be retried once the subscriber is
+// fixed.
+type DeadLetter struct {
+	ID             string          `json:"id"`
+	WebhookID      string          `json:"webhook_id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Attempts       int             `json:"attempts"`
+	LastStatusCode int             `json:"last_status_code,omitempty"`
+	LastError      string          `json:"last_error"`
+	FirstAttemptAt time.Time       `json:"first_attempt_at"`
+	DeadLetteredAt time.Time       `json:"dead_lettered_at"`
+}
+
+// WebhookStore holds webhook subscriptions and the dead-letter queue, and delivers
+// payment events. Deliveries are signed like every platform webhook: an HMAC-SHA256
+// of "<timestamp>.<body>" with the subscription's secret, in the headers that
+// events.VerifySignature checks.
+type WebhookStore struct {
+	mu          sync.RWMutex
+	webhooks    map[string]*Webhook
+	deadLetters map[string]*DeadLetter
+	deadOrder   []string // dead letter IDs, oldest first, for eviction
+	now         func() time.Time
+	sleep       func(time.Duration)
+	inflight    sync.WaitGroup
+
+	cfg    WebhookConfig
+	client *http.Client
+}
+
+// NewWebhookStore creates a store with no subscriptions
+func NewWebhookStore(cfg WebhookConfig) *WebhookStore {
+	return &WebhookStore{
+		webhooks:    make(map[string]*Webhook),
+		deadLetters: make(map[string]*DeadLetter),
+		now:         time.Now,
+		sleep:       time.Sleep,
+		cfg:         cfg.withDefaults(),
+		// Subscribers must answer quickly; slow endpoints count as failed attempts
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// randomID returns prefix followed by 8 random hex characters
+func randomID(prefix string) string {
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	return prefix + hex.EncodeToString(suffix)
+}
+
+// Register validates and adds a webhook
+func (s *WebhookStore) Register(req WebhookRequest) (Webhook, error) {
+	var problems []string
+	if u, err := url.Parse(req.URL); err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		problems = append(problems, "url must be an absolute http or https URL")
+	}
+	if len(req.Secret) < minWebhookSecret {
+		problems = append(problems, fmt.Sprintf("secret must be at least %d characters", minWebhookSecret))
+	}
+	for _, e := range req.Events {
+		if !webhookEventTypes[e] {
+			problems = append(problems, fmt.Sprintf("unknown event type %q", e))
+		}
+	}
+	if len(problems) > 0 {
+		return Webhook{}, &WebhookError{Problems: problems}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.webhooks) >= maxWebhooks {
+		return Webhook{}, errTooManyWebhooks
+	}
+	wh := &Webhook{
+		ID:          randomID("WH-"),
+		URL:         req.URL,
+		Events:      append([]string{}, req.Events...),
+		Description: req.Description,
+		CreatedAt:   s.now().UTC(),
+		secret:      req.Secret,
+	}
+	s.webhooks[wh.ID] = wh
+	return *wh, nil
+}
+
+// Get returns a webhook
+func (s *WebhookStore) Get(id string) (Webhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	wh, ok := s.webhooks[id]
+	if !ok {
+		return Webhook{}, ErrWebhookNotFound
+	}
+	return *wh, nil
+}
+
+// List returns the webhooks, oldest first
+func (s *WebhookStore) List() []Webhook {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	webhooks := make([]Webhook, 0, len(s.webhooks))
+	for _, wh := range s.webhooks {
+		webhooks = append(webhooks, *wh)
+	}
+	sort.Slice(webhooks, func(i, j int) bool {
+		if !webhooks[i].CreatedAt.Equal(webhooks[j].CreatedAt) {
+			return webhooks[i].CreatedAt.Before(webhooks[j].CreatedAt)
+		}
+		return webhooks[i].ID < webhooks[j].ID
+	})
+	return webhooks
+}
+
+// Delete removes a webhook and its dead letters. Deliveries in progress stop at their
+// next retry.
+func (s *WebhookStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.webhooks[id]; !ok {
+		return ErrWebhookNotFound
+	}
+	delete(s.webhooks, id)
+	kept := s.deadOrder[:0]
+	for _, dlID := range s.deadOrder {
+		if s.deadLetters[dlID].WebhookID == id {
+			delete(s.deadLetters, dlID)
+			continue
+		}
+		kept = append(kept, dlID)
+	}
+	s.deadOrder = kept
+	RecordWebhookDeadLetters(len(s.deadOrder))
+	return nil
+}
+
+// Publish delivers an event in the background to every webhook that wants it. The
+// payload is checked against the event's registered schema first; one that does not
+// match is withheld rather than sent. Safe to call on a nil store.
+func (s *WebhookStore) Publish(eventType string, data interface{}) {
+	if s == nil {
+		return
+	}
+	version, err := events.Default().Validate(eventType, data)
+	if err != nil {
+		log.Error().Err(err).Str("event_type", eventType).Msg("Webhook event withheld, payload does not match its schema")
+		RecordWebhookWithheld(eventType)
+		return
+	}
+
+	s.mu.RLock()
+	targets := make([]Webhook, 0)
+	for _, wh := range s.webhooks {
+		if wh.wants(eventType) {
+			targets = append(targets, *wh)
+		}
+	}
+	s.mu.RUnlock()
+	if len(targets) == 0 {
+		return
+	}
+
+	event := WebhookEvent{
+		ID:            randomID("EVT-"),
+		Type:          eventType,
+		SchemaVersion: version,
+		OccurredAt:    s.now().UTC(),
+		Data:          data,
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Error().Err(err).Str("event_type", eventType).Msg("Failed to encode webhook event")
+		return
+	}
+	for _, wh := range targets {
+		s.enqueue(wh, eventType, event.ID, body)
+	}
+}
+
+// enqueue delivers in the background
+func (s *WebhookStore) enqueue(wh Webhook, eventType, eventID string, body []byte) {
+	s.inflight.Add(1)
+	go func() {
+		defer s.inflight.Done()
+		s.deliver(wh, eventType, eventID, body)
+	}()
+}
+
+// deliver sends an event, retrying network errors, 5xx, 408 and 429 responses with
+// exponential backoff. Deliveries that run out of attempts, or that the subscriber
+// refuses with another 4xx, go to the dead-letter queue. Retries stop if the webhook
+// is deleted.
+func (s *WebhookStore) deliver(wh Webhook, eventType, eventID string, body []byte) {
+	start := s.now()
+	var status, attempt int
+	var err error
+	for attempt = 1; ; attempt++ {
+		status, err = s.send(wh, eventType, eventID, body)
+		RecordWebhookAttempt(err == nil)
+		if err == nil || !retryableStatus(status) || attempt == s.cfg.MaxAttempts {
+			break
+		}
+		s.sleep(s.cfg.backoff(attempt))
+		if _, err := s.Get(wh.ID); err != nil {
+			RecordWebhookDelivery(eventType, "dropped", s.now().Sub(start))
+			return
+		}
+	}
+
+	now := s.now().UTC()
+	result := "delivered"
+	s.mu.Lock()
+	if current, ok := s.webhooks[wh.ID]; ok {
+		current.Stats.LastAttemptAt = &now
+		if err == nil {
+			current.Stats.Delivered++
+			current.Stats.LastError = ""
+		} else {
+			current.Stats.DeadLettered++
+			current.Stats.LastError = err.Error()
+		}
+	}
+	if err != nil {
+		result = "dead_lettered"
+		s.deadLetterLocked(&DeadLetter{
+			ID:             randomID("DLQ-"),
+			WebhookID:      wh.ID,
+			EventID:        eventID,
+			EventType:      eventType,
+			Payload:        json.RawMessage(body),
+			Attempts:       attempt,
+			LastStatusCode: status,
+			LastError:      err.Error(),
+			FirstAttemptAt: start.UTC(),
+			DeadLetteredAt: now,
+		})
+	}
+	s.mu.Unlock()
+
+	RecordWebhookDelivery(eventType, result, now.Sub(start))
+	if err != nil {
+		log.Warn().Err(err).Str("webhook_id", wh.ID).Str("event_id", eventID).Int("attempts", attempt).Msg("Webhook delivery dead-lettered")
+	}
+}
+
+// deadLetterLocked queues a failed delivery, dropping the oldest beyond the limit.
+// Callers must hold s.mu.
+func (s *WebhookStore) deadLetterLocked(dl *DeadLetter) {
+	s.deadLetters[dl.ID] = dl
+	s.deadOrder = append(s.deadOrder, dl.ID)
+	if len(s.deadOrder) > maxDeadLetters {
+		delete(s.deadLetters, s.deadOrder[0])
+		s.deadOrder = s.deadOrder[1:]
+	}
+	RecordWebhookDeadLetters(len(s.deadOrder))
+}
+
+// retryableStatus reports whether a failed attempt may succeed later: no response,
+// a server error, a timeout or rate limiting
+func retryableStatus(status int) bool {
+	return status == 0 || status >= 500 || status == http.StatusRequestTimeout || status == http.StatusTooManyRequests
+}
+
+// send makes one signed delivery attempt and returns the response status, or 0 when
+// the subscriber could not be reached
+func (s *WebhookStore) send(wh Webhook, eventType, eventID string, body []byte) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(s.now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "payment-gateway-webhooks/1.0")
+	req.Header.Set(events.HeaderEvent, eventType)
+	req.Header.Set(events.HeaderID, eventID)
+	req.Header.Set(events.HeaderTimestamp, timestamp)
+	req.Header.Set(events.HeaderSignature, "sha256="+signWebhook(wh.secret, timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook endpoint returned %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// signWebhook returns the hex HMAC-SHA256 over "<timestamp>.<body>"
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// DeadLetters returns queued deliveries, newest first, optionally for one webhook
+func (s *WebhookStore) DeadLetters(webhookID string) []DeadLetter {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	letters := make([]DeadLetter, 0)
+	for i := len(s.deadOrder) - 1; i >= 0; i-- {
+		dl := s.deadLetters[s.deadOrder[i]]
+		if webhookID == "" || dl.WebhookID == webhookID {
+			letters = append(letters, *dl)
+		}
+	}
+	return letters
+}
+
+// takeDeadLetterLocked removes a dead letter from the queue. Callers must hold s.mu.
+func (s *WebhookStore) takeDeadLetterLocked(id string) (*DeadLetter, error) {
+	dl, ok := s.deadLetters[id]
+	if !ok {
+		return nil, ErrDeadLetterNotFound
+	}
+	delete(s.deadLetters, id)
+	for i, dlID := range s.deadOrder {
+		if dlID == id {
+			s.deadOrder = append(s.deadOrder[:i], s.deadOrder[i+1:]...)
+			break
+		}
+	}
+	RecordWebhookDeadLetters(len(s.deadOrder))
+	return dl, nil
+}
+
+// Retry takes a dead letter off the queue and delivers its payload again, re-signed,
+// to the webhook's current URL with a fresh set of attempts. If those fail too it is
+// dead-lettered again under a new ID.
+func (s *WebhookStore) Retry(id string) (DeadLetter, error) {
+	s.mu.Lock()
+	dl, err := s.takeDeadLetterLocked(id)
+	if err != nil {
+		s.mu.Unlock()
+		return DeadLetter{}, err
+	}
+	wh := *s.webhooks[dl.WebhookID]
+	s.mu.Unlock()
+
+	s.enqueue(wh, dl.EventType, dl.EventID, dl.Payload)
+	return *dl, nil
+}
+
+// Discard removes a dead letter without delivering it
+func (s *WebhookStore) Discard(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.takeDeadLetterLocked(id)
+	return err
+}
+
+// paymentSucceeded is the payment.succeeded payload for a recorded payment
+func paymentSucceeded(txn Transaction, claimID string) events.PaymentSucceededV1 {
+	return events.PaymentSucceededV1{
+		TransactionID: txn.ID,
+		AuditID:       txn.AuditID,
+		Status:        txn.Status,
+		AmountMinor:   txn.Amount.AmountMinor,
+		Currency:      txn.Amount.Currency,
+		Method:        txn.Method,
+		Processor:     txn.Processor,
+		CustomerID:    txn.CustomerID,
+		PatientID:     txn.PatientID,
+		DeviceID:      txn.DeviceID,
+		ClaimID:       claimID,
+		HighValue:     txn.HighValue,
+		ProcessedAt:   txn.ProcessedAt,
+	}
+}
+
+// paymentFailed is the payment.failed payload for a valid payment that was not
+// authorized, or nil when err is not a payment failure
+func paymentFailed(txnID, processor string, req PaymentRequest, err error, at time.Time) *events.PaymentFailedV1 {
+	var reason string
+	switch {
+	case errors.Is(err, ErrPaymentDeclined):
+		reason = FailureDeclined
+	case errors.Is(err, ErrProcessorUnavailable):
+		reason = FailureProcessorUnavailable
+	case errors.Is(err, errTransactionNotRecorded):
+		reason = FailureNotRecorded
+	default:
+		return nil
+	}
+	return &events.PaymentFailedV1{
+		TransactionID: txnID,
+		AmountMinor:   req.AmountCents,
+		Currency:      req.Currency,
+		Method:        req.Method,
+		Processor:     processor,
+		CustomerID:    req.CustomerID,
+		PatientID:     req.PatientID,
+		DeviceID:      req.DeviceID,
+		Reason:        reason,
+		Message:       err.Error(),
+		FailedAt:      at.UTC(),
+	}
+}
+
+// refundIssued is the refund.issued payload for a payment's latest refund
+func refundIssued(txn Transaction, claimID string) events.RefundIssuedV1 {
+	refund := txn.Refunds[len(txn.Refunds)-1]
+	return events.RefundIssuedV1{
+		RefundID:           refund.ID,
+		TransactionID:      txn.ID,
+		AmountMinor:        refund.Amount.AmountMinor,
+		Currency:           refund.Amount.Currency,
+		RefundedTotalMinor: txn.Refunded.AmountMinor,
+		Full:               txn.Refunded.AmountMinor == txn.Amount.AmountMinor,
+		Reason:             refund.Reason,
+		Processor:          txn.Processor,
+		CustomerID:         txn.CustomerID,
+		PatientID:          txn.PatientID,
+		ClaimID:            claimID,
+		RefundedAt:         refund.RefundedAt,
+	}
+}
+
+// writeWebhookError maps store errors to responses
+func writeWebhookError(w http.ResponseWriter, err error) {
+	var invalid *WebhookError
+	switch {
+	case errors.As(err, &invalid):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":    "invalid webhook",
+			"problems": invalid.Problems,
+		})
+	case errors.Is(err, ErrWebhookNotFound), errors.Is(err, ErrDeadLetterNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errTooManyWebhooks):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// ListHandler handles GET /api/v1/webhooks
+func (s *WebhookStore) ListHandler(w http.ResponseWriter, r *http.Request) {
+	webhooks := s.List()
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"webhooks": webhooks,
+		"count":    len(webhooks),
+	})
+}
+
+// CreateHandler handles POST /api/v1/webhooks
+func (s *WebhookStore) CreateHandler(w http.ResponseWriter, r *http.Request) {
+	var req WebhookRequest
+	if !decodeTemplateBody(w, r, &req) {
+		return
+	}
+	wh, err := s.Register(req)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	log.Info().Str("webhook_id", wh.ID).Strs("events", wh.Events).Msg("Webhook registered")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/v1/webhooks/"+wh.ID)
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(wh)
+}
+
+// GetHandler handles GET /api/v1/webhooks/{webhookID}
+func (s *WebhookStore) GetHandler(w http.ResponseWriter, r *http.Request) {
+	wh, err := s.Get(chi.URLParam(r, "webhookID"))
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(wh)
+}
+
+// DeleteHandler handles DELETE /api/v1/webhooks/{webhookID}
+func (s *WebhookStore) DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "webhookID")
+	if err := s.Delete(id); err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	log.Info().Str("webhook_id", id).Msg("Webhook removed")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeadLettersHandler handles GET /api/v1/webhooks/dead-letters, filtered by
+// ?webhook_id=
+func (s *WebhookStore) DeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	letters := s.DeadLetters(r.URL.Query().Get("webhook_id"))
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"dead_letters": letters,
+		"count":        len(letters),
+	})
+}
+
+// RetryDeadLetterHandler handles POST /api/v1/webhooks/dead-letters/{deadLetterID}/retry
+func (s *WebhookStore) RetryDeadLetterHandler(w http.ResponseWriter, r *http.Request) {
+	dl, err := s.Retry(chi.URLParam(r, "deadLetterID"))
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	log.Info().Str("webhook_id", dl.WebhookID).Str("dead_letter_id", dl.ID).Str("event_id", dl.EventID).Msg("Dead-lettered webhook delivery queued for retry")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(dl)
+}
+
+// DiscardDeadLetterHandler handles DELETE /api/v1/webhooks/dead-letters/{deadLetterID}
+func (s *WebhookStore) DiscardDeadLetterHandler(w http.ResponseWriter, r *http.Request) {
+	if err := s.Discard(chi.URLParam(r, "deadLetterID")); err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
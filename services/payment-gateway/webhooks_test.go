@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/healthcare-gitops/common/events"
+)
+
+const testWebhookSecret = "whsec-0123456789abcdef"
+
+// testWebhookStore retries without waiting
+func testWebhookStore(cfg WebhookConfig) *WebhookStore {
+	s := NewWebhookStore(cfg)
+	s.sleep = func(time.Duration) {}
+	return s
+}
+
+// flakyEndpoint answers with each status in turn, then 204, and records the requests
+type flakyEndpoint struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (f *flakyEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body bytes.Buffer
+	_, _ = body.ReadFrom(r.Body)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, r)
+	f.bodies = append(f.bodies, body.Bytes())
+	status := http.StatusNoContent
+	if len(f.statuses) > 0 {
+		status, f.statuses = f.statuses[0], f.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func TestWebhookRegistration(t *testing.T) {
+	s := testWebhookStore(WebhookConfig{})
+	_, err := s.Register(WebhookRequest{URL: "ftp://billing", Secret: "short", Events: []string{"payment.succeeded", "payment.pending"}})
+	var invalid *WebhookError
+	if !errors.As(err, &invalid) || len(invalid.Problems) != 3 {
+		t.Fatalf("expected URL, secret and event problems, got %v", err)
+	}
+
+	wh, err := s.Register(WebhookRequest{URL: "https://billing.example.org/hooks", Secret: testWebhookSecret, Description: "Billing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(wh.ID, "WH-") || len(wh.Events) != 0 || !wh.wants(EventRefundIssued) {
+		t.Fatalf("expected a webhook for every event, got %+v", wh)
+	}
+	raw, _ := json.Marshal(wh)
+	if strings.Contains(string(raw), testWebhookSecret) {
+		t.Fatalf("expected the secret to be withheld, got %s", raw)
+	}
+	if err := s.Delete(wh.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(wh.ID); !errors.Is(err, ErrWebhookNotFound) {
+		t.Fatalf("expected the webhook deleted, got %v", err)
+	}
+
+	for _, cfg := range []WebhookConfig{{MaxAttempts: 21}, {InitialBackoff: time.Minute, MaxBackoff: time.Second}, {MaxBackoff: -time.Second}} {
+		if cfg.Validate() == nil {
+			t.Errorf("expected %+v to be refused", cfg)
+		}
+	}
+	if err := (WebhookConfig{}).Validate(); err != nil {
+		t.Fatalf("expected the defaults to be valid, got %v", err)
+	}
+	cfg := WebhookConfig{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	if d := cfg.backoff(2); d < 2*time.Second || d > 2400*time.Millisecond {
+		t.Fatalf("expected the second retry after 2s plus jitter, got %s", d)
+	}
+	if d := cfg.backoff(10); d < 5*time.Second || d > 6*time.Second {
+		t.Fatalf("expected the backoff capped at 5s plus jitter, got %s", d)
+	}
+}
+
+func TestWebhookSignedDelivery(t *testing.T) {
+	received := make(chan events.PaymentSucceededV1, 1)
+	consumer := events.NewConsumer(testWebhookSecret)
+	consumer.OnPaymentSucceededV1(func(ctx context.Context, meta events.Metadata, event events.PaymentSucceededV1) error {
+		received <- event
+		return nil
+	})
+	endpoint := httptest.NewServer(consumer)
+	defer endpoint.Close()
+
+	s := testWebhookStore(WebhookConfig{})
+	wh, err := s.Register(WebhookRequest{URL: endpoint.URL, Secret: testWebhookSecret, Events: []string{EventPaymentSucceeded}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	txn := testTransaction("TXN-1", 12000, "cust-1", "P-1001", "Cardiology consult", time.Now())
+	txn.Processor = ProcessorSandbox
+	s.Publish(EventPaymentSucceeded, paymentSucceeded(txn, ""))
+	// Not subscribed
+	s.Publish(EventRefundIssued, events.RefundIssuedV1{})
+	s.inflight.Wait()
+
+	select {
+	case event := <-received:
+		if event.TransactionID != "TXN-1" || event.AmountMinor != 12000 || event.PatientID != "P-1001" || !event.HighValue {
+			t.Fatalf("unexpected event: %+v", event)
+		}
+	default:
+		t.Fatal("expected the consumer to verify and handle the delivery")
+	}
+	if got, _ := s.Get(wh.ID); got.Stats.Delivered != 1 || got.Stats.DeadLettered != 0 || got.Stats.LastAttemptAt == nil {
+		t.Fatalf("expected one delivery counted, got %+v", got.Stats)
+	}
+
+	// A payload that breaks its schema is withheld
+	s.Publish(EventPaymentSucceeded, map[string]string{"transaction_id": "TXN-2"})
+	s.inflight.Wait()
+	if got, _ := s.Get(wh.ID); got.Stats.Delivered != 1 {
+		t.Fatalf("expected an invalid payload not to be sent, got %+v", got.Stats)
+	}
+}
+
+func TestWebhookRetriesAndDeadLetters(t *testing.T) {
+	flaky := &flakyEndpoint{statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}}
+	endpoint := httptest.NewServer(flaky)
+	defer endpoint.Close()
+
+	s := testWebhookStore(WebhookConfig{MaxAttempts: 3})
+	wh, err := s.Register(WebhookRequest{URL: endpoint.URL, Secret: testWebhookSecret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Now()
+	txn := testTransaction("TXN-1", 5000, "cust-1", "", "Copay", at)
+	s.Publish(EventPaymentSucceeded, paymentSucceeded(txn, ""))
+	s.inflight.Wait()
+	if len(flaky.requests) != 3 || s.DeadLetters("") == nil || len(s.DeadLetters("")) != 0 {
+		t.Fatalf("expected delivery on the third attempt, got %d attempts and %d dead letters", len(flaky.requests), len(s.DeadLetters("")))
+	}
+	first := flaky.requests[0]
+	if first.Header.Get(events.HeaderEvent) != EventPaymentSucceeded || first.Header.Get(events.HeaderID) != flaky.requests[2].Header.Get(events.HeaderID) {
+		t.Fatalf("expected retries to keep the event ID, got %v", first.Header)
+	}
+	if err := events.VerifySignature(testWebhookSecret, first.Header.Get(events.HeaderTimestamp), first.Header.Get(events.HeaderSignature), flaky.bodies[0], time.Minute, time.Now()); err != nil {
+		t.Fatalf("expected a valid signature, got %v", err)
+	}
+
+	// Server errors until attempts run out, and a refusal that is not retried
+	flaky.statuses = []int{500, 500, 500, http.StatusBadRequest}
+	s.Publish(EventPaymentSucceeded, paymentSucceeded(txn, ""))
+	s.inflight.Wait()
+	s.Publish(EventPaymentFailed, paymentFailed("TXN-2", ProcessorSandbox, PaymentRequest{AmountCents: 900, Currency: "USD", CustomerID: "decline_1", Method: "card"}, ErrPaymentDeclined, at))
+	s.inflight.Wait()
+	letters := s.DeadLetters(wh.ID)
+	if len(letters) != 2 || len(flaky.requests) != 7 {
+		t.Fatalf("expected two dead letters after 7 attempts, got %d after %d", len(letters), len(flaky.requests))
+	}
+	failed, exhausted := letters[0], letters[1]
+	if failed.EventType != EventPaymentFailed || failed.Attempts != 1 || failed.LastStatusCode != http.StatusBadRequest {
+		t.Fatalf("expected the refused delivery dead-lettered at once, got %+v", failed)
+	}
+	if exhausted.Attempts != 3 || exhausted.LastStatusCode != 500 || !strings.Contains(exhausted.LastError, "500") {
+		t.Fatalf("expected the exhausted delivery after 3 attempts, got %+v", exhausted)
+	}
+	var envelope events.Envelope
+	if err := json.Unmarshal(failed.Payload, &envelope); err != nil || envelope.ID != failed.EventID || !strings.Contains(string(envelope.Data), `"reason":"declined"`) {
+		t.Fatalf("expected the dead letter to keep the payload, got %s", failed.Payload)
+	}
+	if got, _ := s.Get(wh.ID); got.Stats.Delivered != 1 || got.Stats.DeadLettered != 2 || got.Stats.LastError == "" {
+		t.Fatalf("unexpected stats: %+v", got.Stats)
+	}
+
+	// The endpoint is fixed: a retry sends the same event again
+	if _, err := s.Retry(exhausted.ID); err != nil {
+		t.Fatal(err)
+	}
+	s.inflight.Wait()
+	if len(flaky.requests) != 8 || flaky.requests[7].Header.Get(events.HeaderID) != exhausted.EventID {
+		t.Fatalf("expected the dead letter redelivered under its event ID, got %d requests", len(flaky.requests))
+	}
+	if _, err := s.Retry(exhausted.ID); !errors.Is(err, ErrDeadLetterNotFound) {
+		t.Fatalf("expected a retried dead letter to leave the queue, got %v", err)
+	}
+	if err := s.Discard(failed.ID); err != nil || len(s.DeadLetters("")) != 0 {
+		t.Fatalf("expected the queue emptied, got %v with %+v", err, s.DeadLetters(""))
+	}
+
+	// Deleting a webhook stops its retries and drops its dead letters
+	flaky.statuses = []int{400}
+	s.Publish(EventPaymentSucceeded, paymentSucceeded(txn, ""))
+	s.inflight.Wait()
+	if err := s.Delete(wh.ID); err != nil || len(s.DeadLetters("")) != 0 {
+		t.Fatalf("expected the webhook's dead letters dropped, got %v with %+v", err, s.DeadLetters(""))
+	}
+}
+
+func TestPaymentWebhookEvents(t *testing.T) {
+	flaky := &flakyEndpoint{}
+	endpoint := httptest.NewServer(flaky)
+	defer endpoint.Close()
+
+	webhooks := testWebhookStore(WebhookConfig{MaxAttempts: 1})
+	if _, err := webhooks.Register(WebhookRequest{URL: endpoint.URL, Secret: testWebhookSecret}); err != nil {
+		t.Fatal(err)
+	}
+	h := PaymentHandler{
+		MaxLatency:   time.Millisecond,
+		Repository:   newMemoryRepository(10),
+		Transactions: NewTransactionStore(),
+		SOX:          &SOXFinancialControlManager{},
+		Webhooks:     webhooks,
+	}
+	r := chi.NewRouter()
+	r.Post("/charge", h.Charge)
+	r.Post("/api/v1/transactions/{transactionID}/capture", h.CaptureTransactionHandler)
+	r.Post("/api/v1/transactions/{transactionID}/refund", h.RefundTransactionHandler)
+	post := func(path, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body)))
+		webhooks.inflight.Wait()
+		return rr
+	}
+
+	rr := post("/charge", `{"amount_cents": 2500, "currency": "USD", "customer_id": "cust-1", "method": "card", "patient_id": "P-1001"}`)
+	var resp PaymentResponse
+	if rr.Code != http.StatusOK || json.NewDecoder(rr.Body).Decode(&resp) != nil {
+		t.Fatalf("charge expected 200, got %d: %s", rr.Code, rr.Body)
+	}
+	if rr := post("/charge", `{"amount_cents": 2500, "currency": "USD", "customer_id": "decline_1", "method": "card"}`); rr.Code != http.StatusPaymentRequired {
+		t.Fatalf("declined charge expected 402, got %d", rr.Code)
+	}
+	if rr := post("/charge", `{"amount_cents": -1, "currency": "USD", "customer_id": "cust-1", "method": "card"}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("invalid charge expected 400, got %d", rr.Code)
+	}
+	post("/api/v1/transactions/"+resp.TransactionID+"/capture", "")
+	if rr := post("/api/v1/transactions/"+resp.TransactionID+"/refund", `{"amount": {"amount_minor": 1000, "currency": "USD"}, "reason": "Copay waived"}`); rr.Code != http.StatusOK {
+		t.Fatalf("refund expected 200, got %d: %s", rr.Code, rr.Body)
+	}
+
+	// Invalid requests are not published
+	if len(flaky.bodies) != 3 {
+		t.Fatalf("expected three events, got %d", len(flaky.bodies))
+	}
+	var succeeded, failed, refunded struct {
+		Type string          `json:"type"`
+		Data json.RawMessage `json:"data"`
+	}
+	for i, dst := range []interface{}{&succeeded, &failed, &refunded} {
+		if err := json.Unmarshal(flaky.bodies[i], dst); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var payment events.PaymentSucceededV1
+	_ = json.Unmarshal(succeeded.Data, &payment)
+	if succeeded.Type != EventPaymentSucceeded || payment.TransactionID != resp.TransactionID || payment.Processor != ProcessorSandbox || payment.PatientID != "P-1001" {
+		t.Fatalf("unexpected payment.succeeded: %s", succeeded.Data)
+	}
+	var failure events.PaymentFailedV1
+	_ = json.Unmarshal(failed.Data, &failure)
+	if failed.Type != EventPaymentFailed || failure.Reason != FailureDeclined || failure.CustomerID != "decline_1" {
+		t.Fatalf("unexpected payment.failed: %s", failed.Data)
+	}
+	var refund events.RefundIssuedV1
+	_ = json.Unmarshal(refunded.Data, &refund)
+	if refunded.Type != EventRefundIssued || refund.TransactionID != resp.TransactionID || refund.AmountMinor != 1000 || refund.Full || refund.Reason != "Copay waived" {
+		t.Fatalf("unexpected refund.issued: %s", refunded.Data)
+	}
+}
+
+func TestWebhookEndpoints(t *testing.T) {
+	h := NewServer(Config{Port: "0", ServiceName: "payment-gateway", MaxProcessingMillis: 4}).Handler
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(method, path, bytes.NewBufferString(body)))
+		return rr
+	}
+
+	if rr := do("POST", "/api/v1/webhooks", `{"url": "billing", "secret": "x"}`); rr.Code != http.StatusUnprocessableEntity || !strings.Contains(rr.Body.String(), "problems") {
+		t.Fatalf("invalid webhook expected 422 with problems, got %d: %s", rr.Code, rr.Body)
+	}
+	rr := do("POST", "/api/v1/webhooks", `{"url": "https://billing.example.org/hooks", "secret": "`+testWebhookSecret+`", "events": ["refund.issued"]}`)
+	var wh Webhook
+	if rr.Code != http.StatusCreated || json.NewDecoder(rr.Body).Decode(&wh) != nil || rr.Header().Get("Location") != "/api/v1/webhooks/"+wh.ID {
+		t.Fatalf("create expected 201 with its location, got %d: %s", rr.Code, rr.Body)
+	}
+	if rr := do("GET", "/api/v1/webhooks", ""); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"count":1`) {
+		t.Fatalf("list expected the webhook, got %d: %s", rr.Code, rr.Body)
+	}
+	if rr := do("GET", "/api/v1/webhooks/"+wh.ID, ""); rr.Code != http.StatusOK {
+		t.Fatalf("get expected 200, got %d", rr.Code)
+	}
+	if rr := do("GET", "/api/v1/webhooks/dead-letters", ""); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"count":0`) {
+		t.Fatalf("dead letters expected an empty queue, got %d: %s", rr.Code, rr.Body)
+	}
+	if rr := do("POST", "/api/v1/webhooks/dead-letters/DLQ-404/retry", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("unknown dead letter retry expected 404, got %d", rr.Code)
+	}
+	if rr := do("DELETE", "/api/v1/webhooks/dead-letters/DLQ-404", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("unknown dead letter discard expected 404, got %d", rr.Code)
+	}
+	if rr := do("DELETE", "/api/v1/webhooks/"+wh.ID, ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("delete expected 204, got %d", rr.Code)
+	}
+	if rr := do("GET", "/api/v1/webhooks/"+wh.ID, ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("deleted webhook expected 404, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// X12 delimiters the gateway writes. Remittances are read with the delimiters their
+// ISA header declares.
+const (
+	x12ElementSeparator    = "*"
+	x12ComponentSeparator  = ":"
+	x12RepetitionSeparator = "^"
+	x12SegmentTerminator   = "~"
+)
+
+// x12Version837P is the HIPAA implementation guide the claims follow
+const x12Version837P = "005010X222A1"
+
+// isaLength is the fixed length of an ISA segment, terminator included
+const isaLength = 106
+
+// X12Envelope identifies the parties to an interchange and numbers it
+type X12Envelope struct {
+	// SenderID and ReceiverID are the interchange IDs agreed with the clearinghouse,
+	// ISA06 and ISA08, at most 15 characters
+	SenderID   string
+	ReceiverID string
+	// SubmitterName, SubmitterPhone and ReceiverName are loop 1000A and 1000B
+	SubmitterName  string
+	SubmitterPhone string
+	ReceiverName   string
+	// Usage is P for production or T for test data, ISA15
+	Usage string
+	// ControlNumber numbers the interchange and its functional group
+	ControlNumber int
+	Time          time.Time
+}
+
+// x12Writer builds a transaction set, counting its segments for SE01
+type x12Writer struct {
+	b        strings.Builder
+	segments int
+}
+
+// segment writes one segment, dropping trailing empty elements as X12 requires
+func (w *x12Writer) segment(id string, elements ...string) {
+	for len(elements) > 0 && elements[len(elements)-1] == "" {
+		elements = elements[:len(elements)-1]
+	}
+	w.b.WriteString(id)
+	for _, e := range elements {
+		w.b.WriteString(x12ElementSeparator)
+		w.b.WriteString(e)
+	}
+	w.b.WriteString(x12SegmentTerminator + "\n")
+	w.segments++
+}
+
+// x12Value uppercases free text and strips the delimiters and control characters,
+// which would otherwise split an element
+func x12Value(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case strings.ContainsRune(x12ElementSeparator+x12ComponentSeparator+x12RepetitionSeparator+x12SegmentTerminator, r):
+			return -1
+		case r < ' ' || r > '~':
+			return -1
+		}
+		return r
+	}, s)
+	return strings.ToUpper(strings.TrimSpace(s))
+}
+
+// x12Composite joins the components of a composite element
+func x12Composite(components ...string) string {
+	for len(components) > 0 && components[len(components)-1] == "" {
+		components = components[:len(components)-1]
+	}
+	return strings.Join(components, x12ComponentSeparator)
+}
+
+// x12Amount formats minor units as an X12 decimal, e.g. 12550 as 125.50
+func x12Amount(minor int64) string {
+	sign := ""
+	if minor < 0 {
+		sign, minor = "-", -minor
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, minor/100, minor%100)
+}
+
+// parseX12Amount reads an X12 decimal into minor units
+func parseX12Amount(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	negative := strings.HasPrefix(s, "-")
+	whole, fraction, _ := strings.Cut(strings.TrimPrefix(s, "-"), ".")
+	if len(fraction) > 2 || (whole == "" && fraction == "") {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	fraction += strings.Repeat("0", 2-len(fraction))
+	if whole == "" {
+		whole = "0"
+	}
+	n, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil || strings.ContainsAny(whole+fraction, "+-") {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if negative {
+		n = -n
+	}
+	return n, nil
+}
+
+// x12Date formats a YYYY-MM-DD date as CCYYMMDD
+func x12Date(date string) string {
+	return strings.ReplaceAll(date, "-", "")
+}
+
+// patientRelationshipCodes maps a dependent's relationship to the subscriber to the
+// individual relationship code of PAT01
+var patientRelationshipCodes = map[string]string{
+	"spouse": "01",
+	"child":  "19",
+	"other":  "G8",
+}
+
+// encode837P serializes a claim as an 837 professional interchange: the billing
+// provider, subscriber and, for a dependent, patient hierarchy, then the claim with
+// its diagnoses and service lines
+func encode837P(env X12Envelope, claim Claim) []byte {
+	req := claim.Request
+	at := env.Time.UTC()
+	control := fmt.Sprintf("%09d", env.ControlNumber%1_000_000_000)
+	group := strconv.Itoa(env.ControlNumber % 1_000_000_000)
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "ISA*00*%-10s*00*%-10s*ZZ*%-15s*ZZ*%-15s*%s*%s*%s*00501*%s*0*%s*%s%s\n",
+		"", "", x12Value(env.SenderID), x12Value(env.ReceiverID), at.Format("060102"), at.Format("1504"),
+		x12RepetitionSeparator, control, env.Usage, x12ComponentSeparator, x12SegmentTerminator)
+	fmt.Fprintf(&out, "GS*HC*%s*%s*%s*%s*%s*X*%s%s\n",
+		x12Value(env.SenderID), x12Value(env.ReceiverID), at.Format("20060102"), at.Format("1504"), group, x12Version837P, x12SegmentTerminator)
+
+	w := &x12Writer{}
+	w.segment("ST", "837", "0001", x12Version837P)
+	w.segment("BHT", "0019", "00", claim.ID, at.Format("20060102"), at.Format("1504"), "CH")
+
+	// Loop 1000A submitter and 1000B receiver
+	w.segment("NM1", "41", "2", x12Value(env.SubmitterName), "", "", "", "", "46", x12Value(env.SenderID))
+	w.segment("PER", "IC", x12Value(env.SubmitterName), "TE", env.SubmitterPhone)
+	w.segment("NM1", "40", "2", x12Value(env.ReceiverName), "", "", "", "", "46", x12Value(env.ReceiverID))
+
+	// Loop 2000A billing provider
+	provider := req.BillingProvider
+	w.segment("HL", "1", "", "20", "1")
+	w.segment("NM1", "85", "2", x12Value(provider.Name), "", "", "", "", "XX", provider.NPI)
+	writeX12Address(w, provider.Address)
+	w.segment("REF", "EI", strings.ReplaceAll(provider.TaxID, "-", ""))
+
+	// Loop 2000B subscriber; the patient is the subscriber unless a dependent is named
+	subscriber := req.Subscriber
+	self := req.Patient == nil
+	relationship, hasChild := "", "1"
+	if self {
+		relationship, hasChild = "18", "0"
+	}
+	w.segment("HL", "2", "1", "22", hasChild)
+	w.segment("SBR", "P", relationship, x12Value(subscriber.GroupNumber), "", "", "", "", "", "CI")
+	w.segment("NM1", "IL", "1", x12Value(subscriber.LastName), x12Value(subscriber.FirstName), "", "", "", "MI", x12Value(subscriber.MemberID))
+	if subscriber.Address != nil {
+		writeX12Address(w, *subscriber.Address)
+	}
+	if subscriber.DateOfBirth != "" {
+		w.segment("DMG", "D8", x12Date(subscriber.DateOfBirth), subscriber.Gender)
+	}
+	w.segment("NM1", "PR", "2", x12Value(req.Payer.Name), "", "", "", "", "PI", x12Value(req.Payer.ID))
+
+	// Loop 2000C patient, for dependents
+	if !self {
+		patient := req.Patient
+		w.segment("HL", "3", "2", "23", "0")
+		w.segment("PAT", patientRelationshipCodes[patient.Relationship])
+		w.segment("NM1", "QC", "1", x12Value(patient.LastName), x12Value(patient.FirstName))
+		writeX12Address(w, patient.Address)
+		w.segment("DMG", "D8", x12Date(patient.DateOfBirth), patient.Gender)
+	}
+
+	// Loop 2300 claim and 2400 service lines
+	w.segment("CLM", claim.ID, x12Amount(claim.TotalCharge.AmountMinor), "", "", x12Composite(req.PlaceOfService, "B", "1"), "Y", "A", "Y", "Y")
+	diagnoses := make([]string, len(req.Diagnoses))
+	for i, code := range req.Diagnoses {
+		qualifier := "ABF"
+		if i == 0 {
+			qualifier = "ABK"
+		}
+		diagnoses[i] = x12Composite(qualifier, strings.ReplaceAll(strings.ToUpper(code), ".", ""))
+	}
+	w.segment("HI", diagnoses...)
+	for i, line := range req.ServiceLines {
+		procedure := append([]string{"HC", strings.ToUpper(line.Procedure)}, line.Modifiers...)
+		pointers := make([]string, len(line.DiagnosisPointers))
+		for j, p := range line.DiagnosisPointers {
+			pointers[j] = strconv.Itoa(p)
+		}
+		w.segment("LX", strconv.Itoa(i+1))
+		w.segment("SV1", x12Composite(procedure...), x12Amount(line.Charge.AmountMinor), "UN", strconv.Itoa(line.Units), "", "", x12Composite(pointers...))
+		w.segment("DTP", "472", "D8", x12Date(line.ServiceDate))
+	}
+	w.segment("SE", strconv.Itoa(w.segments+1), "0001")
+
+	out.WriteString(w.b.String())
+	fmt.Fprintf(&out, "GE*1*%s%s\n", group, x12SegmentTerminator)
+	fmt.Fprintf(&out, "IEA*1*%s%s\n", control, x12SegmentTerminator)
+	return []byte(out.String())
+}
+
+func writeX12Address(w *x12Writer, a ClaimAddress) {
+	w.segment("N3", x12Value(a.Line1), x12Value(a.Line2))
+	w.segment("N4", x12Value(a.City), x12Value(a.State), strings.ReplaceAll(a.PostalCode, "-", ""))
+}
+
+// Claim status codes of an 835 CLP02
+const (
+	clpProcessedPrimary   = "1"
+	clpProcessedSecondary = "2"
+	clpProcessedTertiary  = "3"
+	clpDenied             = "4"
+	clpForwardedPrimary   = "19"
+	clpForwardedSecondary = "20"
+	clpForwardedTertiary  = "21"
+	clpReversal           = "22"
+)
+
+// errInvalidRemittance is returned for 835s the parser cannot read
+var errInvalidRemittance = errors.New("invalid remittance advice")
+
+// RemittanceAdvice is what the gateway reads from an 835: the payment and, for each
+// claim, what the payer paid and why the rest was adjusted
+type RemittanceAdvice struct {
+	// TraceNumber is TRN02, the check or EFT number, unique per payment
+	TraceNumber string
+	PayerName   string
+	PayerID     string
+	// Method is BPR04: ACH, CHK (check), FWT (wire) or NON (no payment)
+	Method      string
+	Total       int64
+	PaymentDate string
+	Claims      []RemittanceClaimAdvice
+}
+
+// RemittanceClaimAdvice is one CLP loop
+type RemittanceClaimAdvice struct {
+	ClaimID               string
+	StatusCode            string
+	Charged               int64
+	Paid                  int64
+	PatientResponsibility int64
+	PayerClaimNumber      string
+	Adjustments           []ClaimAdjustment
+}
+
+// parse835 reads a remittance advice. Service line detail is folded into its claim:
+// line adjustments are listed with the claim's.
+func parse835(data []byte) (RemittanceAdvice, error) {
+	text := strings.TrimLeft(string(data), " \t\r\n\ufeff")
+	if len(text) < isaLength || !strings.HasPrefix(text, "ISA") {
+		return RemittanceAdvice{}, fmt.Errorf("%w: it must start with an ISA segment", errInvalidRemittance)
+	}
+	element, component, terminator := string(text[3]), string(text[104]), string(text[105])
+
+	var advice RemittanceAdvice
+	var claim *RemittanceClaimAdvice
+	sawST, sawBPR := false, false
+	for _, raw := range strings.Split(text, terminator) {
+		seg := strings.Split(strings.TrimSpace(raw), element)
+		if len(seg) == 0 || seg[0] == "" {
+			continue
+		}
+		get := func(i int) string {
+			if i < len(seg) {
+				return strings.TrimSpace(seg[i])
+			}
+			return ""
+		}
+		var err error
+		switch seg[0] {
+		case "ST":
+			if get(1) != "835" {
+				return RemittanceAdvice{}, fmt.Errorf("%w: transaction set %s is not an 835", errInvalidRemittance, get(1))
+			}
+			sawST = true
+		case "BPR":
+			sawBPR = true
+			advice.Method, advice.PaymentDate = get(4), x12DateString(get(16))
+			if advice.Total, err = parseX12Amount(get(2)); err != nil {
+				return RemittanceAdvice{}, fmt.Errorf("%w: BPR02: %v", errInvalidRemittance, err)
+			}
+			if get(3) == "D" {
+				advice.Total = -advice.Total
+			}
+		case "TRN":
+			advice.TraceNumber = get(2)
+		case "N1":
+			if get(1) == "PR" {
+				advice.PayerName = get(2)
+				if get(3) == "XV" || get(3) == "PI" {
+					advice.PayerID = get(4)
+				}
+			}
+		case "REF":
+			// The payer's identification when N1 carries none
+			if get(1) == "2U" && advice.PayerID == "" && claim == nil {
+				advice.PayerID = get(2)
+			}
+		case "CLP":
+			advice.Claims = append(advice.Claims, RemittanceClaimAdvice{ClaimID: get(1), StatusCode: get(2), PayerClaimNumber: get(7)})
+			claim = &advice.Claims[len(advice.Claims)-1]
+			for i, dst := range []*int64{&claim.Charged, &claim.Paid, &claim.PatientResponsibility} {
+				if *dst, err = parseX12Amount(get(i + 3)); err != nil {
+					return RemittanceAdvice{}, fmt.Errorf("%w: CLP0%d of claim %s: %v", errInvalidRemittance, i+3, claim.ClaimID, err)
+				}
+			}
+		case "CAS":
+			if claim == nil {
+				continue
+			}
+			// Up to six reason, amount and quantity triplets follow the group code
+			for i := 2; i+1 < len(seg); i += 3 {
+				if get(i) == "" {
+					continue
+				}
+				amount, err := parseX12Amount(get(i + 1))
+				if err != nil {
+					return RemittanceAdvice{}, fmt.Errorf("%w: CAS of claim %s: %v", errInvalidRemittance, claim.ClaimID, err)
+				}
+				claim.Adjustments = append(claim.Adjustments, ClaimAdjustment{Group: get(1), Reason: strings.Split(get(i), component)[0], AmountMinor: amount})
+			}
+		}
+	}
+	switch {
+	case !sawST:
+		return RemittanceAdvice{}, fmt.Errorf("%w: no 835 transaction set", errInvalidRemittance)
+	case !sawBPR || advice.TraceNumber == "":
+		return RemittanceAdvice{}, fmt.Errorf("%w: BPR and TRN segments are required", errInvalidRemittance)
+	}
+	return advice, nil
+}
+
+// x12DateString formats a CCYYMMDD date as YYYY-MM-DD, or returns "" when it is not one
+func x12DateString(s string) string {
+	t, err := time.Parse("20060102", s)
+	if err != nil {
+		return ""
+	}
+	return t.Format(time.DateOnly)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncode837P(t *testing.T) {
+	at := time.Date(2026, 3, 2, 9, 30, 0, 0, time.UTC)
+	req := testClaimRequest()
+	req.BillingProvider.Name = "Austin * Family ~ Clinic"
+	if _, err := validateClaim(&req, at); err != nil {
+		t.Fatal(err)
+	}
+	claim := Claim{ID: "CLM-260302-0a1b2c3d", TotalCharge: Money{AmountMinor: 23000, Currency: "USD"}, Request: req}
+	env := X12Envelope{SenderID: "GATEWAY01", ReceiverID: "CLEARHOUSE", SubmitterName: "Gateway", SubmitterPhone: "5125550100", ReceiverName: "Clearing House", Usage: "T", ControlNumber: 42, Time: at}
+	x12 := string(encode837P(env, claim))
+
+	lines := strings.Split(strings.TrimSuffix(x12, "\n"), "\n")
+	if len(lines[0]) != isaLength {
+		t.Fatalf("expected a %d-character ISA, got %d: %q", isaLength, len(lines[0]), lines[0])
+	}
+	for _, want := range []string{
+		"ISA*00*          *00*          *ZZ*GATEWAY01      *ZZ*CLEARHOUSE     *260302*0930*^*00501*000000042*0*T*:~",
+		"GS*HC*GATEWAY01*CLEARHOUSE*20260302*0930*42*X*005010X222A1~",
+		"ST*837*0001*005010X222A1~",
+		"NM1*85*2*AUSTIN  FAMILY  CLINIC*****XX*1234567893~",
+		"REF*EI*123456789~",
+		"HL*2*1*22*0~",
+		"SBR*P*18*GRP-100******CI~",
+		"NM1*IL*1*LOPEZ*ANA****MI*W123456789~",
+		"DMG*D8*19800412*F~",
+		"NM1*PR*2*UNITEDHEALTHCARE*****PI*87726~",
+		"CLM*CLM-260302-0a1b2c3d*230.00***11:B:1*Y*A*Y*Y~",
+		"HI*ABK:E119*ABF:I10~",
+		"SV1*HC:99213:25*150.00*UN*1***1:2~",
+		"SV1*HC:81001*80.00*UN*2***2~",
+		"DTP*472*D8*20260220~",
+		"IEA*1*000000042~",
+	} {
+		if !strings.Contains(x12, want+"\n") {
+			t.Errorf("expected segment %q in:\n%s", want, x12)
+		}
+	}
+	// SE01 counts ST through SE
+	var count int
+	for _, line := range lines {
+		count++
+		if strings.HasPrefix(line, "SE*") {
+			if line != "SE*"+strconv.Itoa(count-2)+"*0001~" {
+				t.Errorf("expected SE to count %d segments, got %q", count-2, line)
+			}
+		}
+	}
+
+	req.Patient = &ClaimPatient{Relationship: "child", FirstName: "Mia", LastName: "Lopez", DateOfBirth: "2015-06-01", Gender: "F", Address: *req.Subscriber.Address}
+	claim.Request = req
+	x12 = string(encode837P(env, claim))
+	for _, want := range []string{"HL*2*1*22*1~", "SBR*P**GRP-100******CI~", "HL*3*2*23*0~", "PAT*19~", "NM1*QC*1*LOPEZ*MIA~"} {
+		if !strings.Contains(x12, want+"\n") {
+			t.Errorf("expected dependent segment %q in:\n%s", want, x12)
+		}
+	}
+}
+
+func TestParse835(t *testing.T) {
+	advice, err := parse835([]byte(test835("CLM-1", "1", "150.00", "120.5", "30", "EFT0001", "CAS*CO*45*20*1*253*0.5~CAS*PR*2*9.5~")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if advice.TraceNumber != "EFT0001" || advice.PayerName != "UNITEDHEALTHCARE" || advice.PayerID != "87726" || advice.Method != "ACH" || advice.PaymentDate != "2026-03-05" || advice.Total != 12050 {
+		t.Fatalf("unexpected payment: %+v", advice)
+	}
+	if len(advice.Claims) != 1 {
+		t.Fatalf("expected one claim, got %+v", advice.Claims)
+	}
+	clp := advice.Claims[0]
+	if clp.ClaimID != "CLM-1" || clp.Charged != 15000 || clp.Paid != 12050 || clp.PatientResponsibility != 3000 || clp.PayerClaimNumber != "PCN-1" {
+		t.Fatalf("unexpected claim: %+v", clp)
+	}
+	want := []ClaimAdjustment{{"CO", "45", 2000}, {"CO", "253", 50}, {"PR", "2", 950}}
+	if len(clp.Adjustments) != len(want) {
+		t.Fatalf("expected adjustments %+v, got %+v", want, clp.Adjustments)
+	}
+	for i := range want {
+		if clp.Adjustments[i] != want[i] {
+			t.Errorf("adjustment %d: expected %+v, got %+v", i, want[i], clp.Adjustments[i])
+		}
+	}
+
+	// Delimiters come from the ISA header
+	custom := strings.NewReplacer("*", "|", "~", "\n").Replace(test835("CLM-2", "4", "80", "0", "0", "CHK77", ""))
+	custom = strings.Replace(custom, "|:\n", "|>\n", 1)
+	advice, err = parse835([]byte(custom))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if advice.TraceNumber != "CHK77" || len(advice.Claims) != 1 || advice.Claims[0].StatusCode != "4" {
+		t.Fatalf("expected the custom-delimited 835 to parse, got %+v", advice)
+	}
+
+	for name, data := range map[string]string{
+		"empty":     "",
+		"not x12":   "hello",
+		"no BPR":    strings.Replace(test835("CLM-1", "1", "1", "1", "0", "T1", ""), "BPR*", "XXX*", 1),
+		"an 837":    strings.Replace(test835("CLM-1", "1", "1", "1", "0", "T1", ""), "ST*835", "ST*837", 1),
+		"bad money": test835("CLM-1", "1", "1.234", "1", "0", "T1", ""),
+	} {
+		if _, err := parse835([]byte(data)); !errors.Is(err, errInvalidRemittance) {
+			t.Errorf("%s: expected errInvalidRemittance, got %v", name, err)
+		}
+	}
+}
+
+func TestX12Amounts(t *testing.T) {
+	for in, want := range map[string]int64{"": 0, "0": 0, "12": 1200, "12.5": 1250, "12.05": 1205, ".5": 50, "-30.25": -3025} {
+		if got, err := parseX12Amount(in); err != nil || got != want {
+			t.Errorf("parseX12Amount(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"1.234", "abc", "+5", "1.-5", "-"} {
+		if _, err := parseX12Amount(in); err == nil {
+			t.Errorf("parseX12Amount(%q) expected an error", in)
+		}
+	}
+	if x12Amount(12345) != "123.45" || x12Amount(-5) != "-0.05" {
+		t.Errorf("unexpected x12Amount output %q %q", x12Amount(12345), x12Amount(-5))
+	}
+}
+
+// test835 builds a single-claim remittance with the given CLP and trailing segments
+func test835(claimID, status, charged, paid, patientResponsibility, trace, adjustments string) string {
+	return "ISA*00*          *00*          *ZZ*87726          *ZZ*GATEWAY01      *260305*1200*^*00501*000000007*0*T*:~\n" +
+		"GS*HP*87726*GATEWAY01*20260305*1200*7*X*005010X221A1~\n" +
+		"ST*835*0001~\n" +
+		"BPR*I*" + paid + "*C*ACH*CCP*01*111000025*DA*123456*1512345678**01*222000025*DA*654321*20260305~\n" +
+		"TRN*1*" + trace + "*1512345678~\n" +
+		"N1*PR*UNITEDHEALTHCARE*XV*87726~\n" +
+		"N1*PE*AUSTIN FAMILY CLINIC*XX*1234567893~\n" +
+		"CLP*" + claimID + "*" + status + "*" + charged + "*" + paid + "*" + patientResponsibility + "*12*PCN-1~\n" +
+		strings.ReplaceAll(adjustments, "~", "~\n") +
+		"SE*9*0001~\nGE*1*7~\nIEA*1*000000007~\n"
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog/log"
+)
+
+// genesisHash is the previous hash of the first audit entry
+var genesisHash = strings.Repeat("0", 64)
+
+// Access outcomes recorded in the audit log
+const (
+	AccessSucceeded = "success"
+	AccessFailed    = "error"
+	AccessDenied    = "denied"
+)
+
+// errAuditUnavailable is returned when an access cannot be audited; the access
+// is refused rather than left unrecorded
+var errAuditUnavailable = errors.New("audit log unavailable")
+
+// AccessAuditEntry records one use of PHI key material. It never contains the data
+// itself. Hash covers every other field and the previous entry's hash, so editing,
+// removing or reordering entries breaks the chain.
+type AccessAuditEntry struct {
+	Seq          int64     `json:"seq"`
+	Time         time.Time `json:"time"`
+	RequestID    string    `json:"request_id,omitempty"`
+	Actor        string    `json:"actor,omitempty"`
+	Role         string    `json:"role,omitempty"`
+	PurposeOfUse string    `json:"purpose_of_use,omitempty"`
+	RemoteAddr   string    `json:"remote_addr,omitempty"`
+	Operation    string    `json:"operation"`
+	KeyID        string    `json:"key_id,omitempty"`
+	DataType     string    `json:"data_type,omitempty"`
+	Resource     string    `json:"resource,omitempty"`
+	LinkID       string    `json:"link_id,omitempty"`
+	Status       string    `json:"status"`
+	PrevHash     string    `json:"prev_hash"`
+	Hash         string    `json:"hash"`
+}
+
+// chainHash computes an entry's hash from its content and PrevHash
+func (e AccessAuditEntry) chainHash() string {
+	e.Hash = ""
+	content, _ := json.Marshal(e)
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// auditStore holds serialized audit entries in append order
+type auditStore interface {
+	append(line []byte) error
+	scan(fn func(line []byte) error) error
+}
+
+// memoryAuditStore keeps entries in memory, for deployments without AUDIT_LOG_PATH
+type memoryAuditStore struct {
+	lines [][]byte
+}
+
+func (s *memoryAuditStore) append(line []byte) error {
+	s.lines = append(s.lines, line)
+	return nil
+}
+
+func (s *memoryAuditStore) scan(fn func(line []byte) error) error {
+	for _, line := range s.lines {
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fileAuditStore appends JSON lines to a file opened append-only, syncing every
+// entry to disk before the access it records is allowed to complete
+type fileAuditStore struct {
+	path string
+	file *os.File
+}
+
+func openFileAuditStore(path string) (*fileAuditStore, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &fileAuditStore{path: path, file: file}, nil
+}
+
+func (s *fileAuditStore) append(line []byte) error {
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+func (s *fileAuditStore) scan(fn func(line []byte) error) error {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		if err := fn(scanner.Bytes()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// AccessAuditLog is the append-only, hash-chained log of PHI key use
+type AccessAuditLog struct {
+	store    auditStore
+	seq      int64
+	lastHash string
+	mu       sync.Mutex
+}
+
+// NewAccessAuditLog opens the audit log at path, continuing its chain, or keeps it in
+// memory when path is empty. A broken chain is reported but does not stop the
+// service; new entries chain from the last one on disk.
+func NewAccessAuditLog(path string) (*AccessAuditLog, error) {
+	l := &AccessAuditLog{store: &memoryAuditStore{}, lastHash: genesisHash}
+	if path == "" {
+		return l, nil
+	}
+
+	store, err := openFileAuditStore(path)
+	if err != nil {
+		return nil, err
+	}
+	l.store = store
+
+	result, err := l.Verify()
+	if err != nil {
+		return nil, err
+	}
+	if !result.Valid {
+		log.Error().Int64("broken_at", result.BrokenAt).Str("reason", result.Reason).Msg("PHI access audit chain is broken")
+	}
+	l.seq, l.lastHash = result.LastSeq, result.LastHash
+	return l, nil
+}
+
+// Append chains an entry onto the log and persists it. Seq, PrevHash and Hash are
+// assigned here.
+func (l *AccessAuditLog) Append(entry AccessAuditEntry) (AccessAuditEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry.Seq = l.seq + 1
+	entry.PrevHash = l.lastHash
+	entry.Hash = entry.chainHash()
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return AccessAuditEntry{}, err
+	}
+	if err := l.store.append(line); err != nil {
+		return AccessAuditEntry{}, err
+	}
+	l.seq, l.lastHash = entry.Seq, entry.Hash
+	return entry, nil
+}
+
+// AccessAuditFilter selects audit entries. Empty fields match everything.
+type AccessAuditFilter struct {
+	Actor     string
+	Operation string
+	KeyID     string
+	LinkID    string
+	RequestID string
+	Status    string
+	Since     time.Time
+	Until     time.Time
+	Limit     int
+}
+
+func (f AccessAuditFilter) matches(e AccessAuditEntry) bool {
+	switch {
+	case f.Actor != "" && e.Actor != f.Actor,
+		f.Operation != "" && e.Operation != f.Operation,
+		f.KeyID != "" && e.KeyID != f.KeyID,
+		f.LinkID != "" && e.LinkID != f.LinkID,
+		f.RequestID != "" && e.RequestID != f.RequestID,
+		f.Status != "" && e.Status != f.Status,
+		!f.Since.IsZero() && e.Time.Before(f.Since),
+		!f.Until.IsZero() && !e.Time.Before(f.Until):
+		return false
+	}
+	return true
+}
+
+// Query returns entries matching the filter, newest first
+func (l *AccessAuditLog) Query(filter AccessAuditFilter) ([]AccessAuditEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	matched := make([]AccessAuditEntry, 0)
+	err := l.store.scan(func(line []byte) error {
+		var e AccessAuditEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			// Unreadable entries are reported by Verify
+			return nil
+		}
+		if filter.matches(e) {
+			matched = append(matched, e)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Reverse for newest first, then apply the limit
+	for i, j := 0, len(matched)-1; i < j; i, j = i+1, j-1 {
+		matched[i], matched[j] = matched[j], matched[i]
+	}
+	if filter.Limit > 0 && len(matched) > filter.Limit {
+		matched = matched[:filter.Limit]
+	}
+	return matched, nil
+}
+
+// AuditVerification is the result of walking the hash chain
+type AuditVerification struct {
+	Valid    bool   `json:"valid"`
+	Entries  int64  `json:"entries"`
+	LastSeq  int64  `json:"last_seq"`
+	LastHash string `json:"last_hash"`
+	BrokenAt int64  `json:"broken_at,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// fail records the first break found while verifying
+func (v *AuditVerification) fail(seq int64, reason string) {
+	if v.Valid {
+		v.Valid, v.BrokenAt, v.Reason = false, seq, reason
+	}
+}
+
+// Verify recomputes every hash in the chain and reports the first entry that does
+// not match, is out of sequence or cannot be parsed
+func (l *AccessAuditLog) Verify() (AuditVerification, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	result := AuditVerification{Valid: true, LastHash: genesisHash}
+	err := l.store.scan(func(line []byte) error {
+		result.Entries++
+		var e AccessAuditEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			result.fail(result.LastSeq+1, "entry cannot be parsed")
+			return nil
+		}
+		switch {
+		case e.Seq != result.LastSeq+1:
+			result.fail(e.Seq, fmt.Sprintf("expected seq %d", result.LastSeq+1))
+		case e.PrevHash != result.LastHash:
+			result.fail(e.Seq, "prev_hash does not match the previous entry")
+		case e.Hash != e.chainHash():
+			result.fail(e.Seq, "hash does not match the entry content")
+		}
+		result.LastSeq, result.LastHash = e.Seq, e.Hash
+		return nil
+	})
+	return result, err
+}
+
+// accessAudit is the PHI access audit log, replaced at startup when AUDIT_LOG_PATH is set
+var accessAudit = &AccessAuditLog{store: &memoryAuditStore{}, lastHash: genesisHash}
+
+// decryptAuthorizationKey carries the authorized decrypt decision through the
+// request context so the access can be attributed
+type decryptAuthorizationKey struct{}
+
+// withDecryptAuthorizationRecord stores an authorization decision on the request context
+func withDecryptAuthorizationRecord(ctx context.Context, rec DecryptAuditRecord) context.Context {
+	return context.WithValue(ctx, decryptAuthorizationKey{}, rec)
+}
+
+// auditAccess records a use of key material for the current request, attributed to
+// the authorized user when there is one. Callers must not complete the access when
+// it returns an error.
+func auditAccess(r *http.Request, operation, keyID, dataType, status string) error {
+	entry := AccessAuditEntry{
+		Time:       time.Now().UTC(),
+		RequestID:  middleware.GetReqID(r.Context()),
+		RemoteAddr: r.RemoteAddr,
+		Operation:  operation,
+		KeyID:      keyID,
+		DataType:   dataType,
+		Status:     status,
+	}
+	if rec, ok := r.Context().Value(decryptAuthorizationKey{}).(DecryptAuditRecord); ok {
+		entry.Actor, entry.Role, entry.PurposeOfUse = rec.UserID, rec.Role, rec.PurposeOfUse
+	}
+	return auditDecision(r.Context(), entry)
+}
+
+// auditDecision appends an entry, logging failures, and emits it to the shared audit
+// bus
+func auditDecision(ctx context.Context, entry AccessAuditEntry) error {
+	emitAccessEvent(ctx, entry)
+	if _, err := accessAudit.Append(entry); err != nil {
+		log.Error().Err(err).Str("operation", entry.Operation).Str("request_id", entry.RequestID).Msg("Failed to write PHI access audit entry")
+		RecordAccessAuditFailure(entry.Operation)
+		return fmt.Errorf("%w: %v", errAuditUnavailable, err)
+	}
+	return nil
+}
+
+// ciphertextKeyID returns the key ID prefix of standard ciphertext
+func ciphertextKeyID(ciphertext string) string {
+	if id, _, ok := strings.Cut(ciphertext, ":"); ok {
+		return id
+	}
+	return legacyKeyID
+}
+
+// dataTypeFor describes what kind of value was protected: the FPE format, or
+// "text" for standard encryption
+func dataTypeFor(mode, format string) string {
+	if mode == ModeFPE {
+		return format
+	}
+	return "text"
+}
+
+// maxAccessAuditQuery bounds how many entries one audit query returns
+const maxAccessAuditQuery = 1000
+
+// ListAccessAuditHandler queries the PHI access audit log. Supports ?actor=,
+// ?operation=, ?key_id=, ?request_id=, ?status=, ?since= and ?until= (RFC 3339) and
+// ?limit= (default 100, at most 1000).
+func ListAccessAuditHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := AccessAuditFilter{
+		Actor:     query.Get("actor"),
+		Operation: query.Get("operation"),
+		KeyID:     query.Get("key_id"),
+		LinkID:    query.Get("link_id"),
+		RequestID: query.Get("request_id"),
+		Status:    query.Get("status"),
+		Limit:     100,
+	}
+	for name, dst := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if value := query.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				http.Error(w, name+" must be an RFC 3339 timestamp", http.StatusBadRequest)
+				return
+			}
+			*dst = t
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxAccessAuditQuery {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxAccessAuditQuery), http.StatusBadRequest)
+			return
+		}
+		filter.Limit = n
+	}
+
+	entries, err := accessAudit.Query(filter)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to read PHI access audit log")
+		http.Error(w, "Failed to read audit log", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"entries": entries,
+		"count":   len(entries),
+	})
+}
+
+// VerifyAccessAuditHandler walks the audit hash chain and reports whether it is intact
+func VerifyAccessAuditHandler(w http.ResponseWriter, r *http.Request) {
+	result, err := accessAudit.Verify()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to verify PHI access audit log")
+		http.Error(w, "Failed to read audit log", http.StatusInternalServerError)
+		return
+	}
+	if !result.Valid {
+		log.Error().Int64("broken_at", result.BrokenAt).Str("reason", result.Reason).Msg("PHI access audit chain is broken")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
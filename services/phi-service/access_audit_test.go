@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/healthcare-gitops/common/audit"
+	"github.com/healthcare-gitops/common/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withAccessAudit installs an in-memory access audit log for a test
+func withAccessAudit(t *testing.T) *AccessAuditLog {
+	previous := accessAudit
+	accessAudit, _ = NewAccessAuditLog("")
+	t.Cleanup(func() { accessAudit = previous })
+	return accessAudit
+}
+
+// TestAccessAuditLogPersistsChain tests appending, reopening and querying a file-backed log
+func TestAccessAuditLogPersistsChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	auditLog, err := NewAccessAuditLog(path)
+	require.NoError(t, err)
+
+	first, err := auditLog.Append(AccessAuditEntry{Time: time.Now().UTC(), Actor: "dr-grey", Operation: "decrypt", KeyID: "v1", DataType: "text", Status: AccessSucceeded})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), first.Seq)
+	assert.Equal(t, genesisHash, first.PrevHash)
+
+	reopened, err := NewAccessAuditLog(path)
+	require.NoError(t, err)
+	second, err := reopened.Append(AccessAuditEntry{Time: time.Now().UTC(), Operation: "encrypt", KeyID: "v1", DataType: "ssn", Status: AccessSucceeded})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), second.Seq)
+	assert.Equal(t, first.Hash, second.PrevHash)
+
+	result, err := reopened.Verify()
+	require.NoError(t, err)
+	assert.True(t, result.Valid)
+	assert.Equal(t, int64(2), result.Entries)
+
+	entries, err := reopened.Query(AccessAuditFilter{Actor: "dr-grey"})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "decrypt", entries[0].Operation)
+
+	all, err := reopened.Query(AccessAuditFilter{Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+	assert.Equal(t, "encrypt", all[0].Operation)
+}
+
+// TestAccessAuditLogDetectsTampering tests that an edited entry breaks the chain
+func TestAccessAuditLogDetectsTampering(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	auditLog, err := NewAccessAuditLog(path)
+	require.NoError(t, err)
+	for _, actor := range []string{"dr-grey", "dr-shepherd", "dr-yang"} {
+		_, err := auditLog.Append(AccessAuditEntry{Time: time.Now().UTC(), Actor: actor, Operation: "decrypt", Status: AccessSucceeded})
+		require.NoError(t, err)
+	}
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, []byte(strings.Replace(string(data), "dr-shepherd", "dr-nobody", 1)), 0o600))
+
+	result, err := auditLog.Verify()
+	require.NoError(t, err)
+	assert.False(t, result.Valid)
+	assert.Equal(t, int64(2), result.BrokenAt)
+	assert.Contains(t, result.Reason, "hash")
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.NoError(t, os.WriteFile(path, []byte(lines[0]+"\n"+lines[2]+"\n"), 0o600))
+	result, err = auditLog.Verify()
+	require.NoError(t, err)
+	assert.False(t, result.Valid)
+	assert.Equal(t, int64(3), result.BrokenAt)
+}
+
+// TestDecryptIsAuditedWithActor tests that decryptions and denials reach the access audit log
+func TestDecryptIsAuditedWithActor(t *testing.T) {
+	svc, err := NewEncryptionService(testMasterKey)
+	require.NoError(t, err)
+	previous := encryptionService
+	encryptionService = svc
+	defer func() { encryptionService = previous }()
+
+	srv, _ := fakeAuthService(t, map[string]auth.Introspection{
+		"reader": {Active: true, UserID: "dr-grey", Role: "clinician", Scopes: []string{"phi:read"}, Exp: time.Now().Add(time.Hour).Unix()},
+	})
+	withDecryptAuthorization(t, srv.URL)
+	auditLog := withAccessAudit(t)
+
+	ciphertext, err := svc.Encrypt([]byte("Patient SSN: 123-45-6789"))
+	require.NoError(t, err)
+	body, _ := json.Marshal(DecryptRequest{EncryptedData: ciphertext})
+
+	handler := requireDecryptAuthorization(DecryptHandler)
+	for _, token := range []string{"reader", "forged"} {
+		req := httptest.NewRequest("POST", "/api/v1/decrypt", strings.NewReader(string(body)))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set(PurposeOfUseHeader, "TREAT")
+		handler(httptest.NewRecorder(), req)
+	}
+
+	entries, err := auditLog.Query(AccessAuditFilter{})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, AccessDenied, entries[0].Status)
+	assert.Equal(t, AccessSucceeded, entries[1].Status)
+	assert.Equal(t, "dr-grey", entries[1].Actor)
+	assert.Equal(t, "TREAT", entries[1].PurposeOfUse)
+	assert.Equal(t, "v1", entries[1].KeyID)
+	assert.Equal(t, "text", entries[1].DataType)
+
+	w := httptest.NewRecorder()
+	VerifyAccessAuditHandler(w, httptest.NewRequest("GET", "/api/v1/audit/verify", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"valid":true`)
+}
+
+// memorySink keeps the audit events written to it
+type memorySink struct {
+	events []audit.Event
+}
+
+func (s *memorySink) Write(_ context.Context, events []audit.Event) error {
+	s.events = append(s.events, events...)
+	return nil
+}
+
+func (s *memorySink) Close() error { return nil }
+
+func TestDecryptIsEmittedToAuditBus(t *testing.T) {
+	svc, err := NewEncryptionService(testMasterKey)
+	require.NoError(t, err)
+	previous := encryptionService
+	encryptionService = svc
+	defer func() { encryptionService = previous }()
+
+	srv, _ := fakeAuthService(t, map[string]auth.Introspection{
+		"reader": {Active: true, UserID: "dr-grey", Role: "clinician", Scopes: []string{"phi:read"}, Exp: time.Now().Add(time.Hour).Unix()},
+	})
+	withDecryptAuthorization(t, srv.URL)
+	withAccessAudit(t)
+	sink := &memorySink{}
+	previousEvents := auditEvents
+	auditEvents = audit.NewEmitter("phi-service", sink, audit.Config{FlushInterval: 10 * time.Millisecond})
+	defer func() { auditEvents = previousEvents }()
+
+	ciphertext, err := svc.Encrypt([]byte("Patient SSN: 123-45-6789"))
+	require.NoError(t, err)
+	body, _ := json.Marshal(DecryptRequest{EncryptedData: ciphertext})
+
+	handler := requireDecryptAuthorization(DecryptHandler)
+	for _, token := range []string{"forged", "reader"} {
+		req := httptest.NewRequest("POST", "/api/v1/decrypt", strings.NewReader(string(body)))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set(PurposeOfUseHeader, "TREAT")
+		handler(httptest.NewRecorder(), req)
+	}
+	require.NoError(t, auditEvents.Close(context.Background()))
+
+	require.Len(t, sink.events, 2)
+	assert.Equal(t, "phi.decrypt", sink.events[0].Action)
+	assert.Equal(t, audit.OutcomeDenied, sink.events[0].Outcome)
+	granted := sink.events[1]
+	assert.Equal(t, audit.OutcomeSuccess, granted.Outcome)
+	assert.Equal(t, "dr-grey", granted.Actor)
+	assert.Equal(t, "key/v1", granted.Resource)
+	assert.Equal(t, "TREAT", granted.Details["purpose_of_use"])
+	assert.Equal(t, "phi-service", granted.Service)
+
+	encoded, _ := json.Marshal(sink.events)
+	assert.NotContains(t, string(encoded), "123-45-6789")
+	assert.NotContains(t, string(encoded), ciphertext)
+}
@@ -0,0 +1,485 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/healthcare-gitops/common/config"
+	"github.com/healthcare-gitops/common/secrets"
+)
+
+// Attestation check outcomes. Only failures make an attestation non-compliant.
+const (
+	AttestationPass = "pass"
+	AttestationWarn = "warn"
+	AttestationFail = "fail"
+)
+
+// Attestation controls a check belongs to
+const (
+	ControlInTransit     = "in_transit"
+	ControlAtRest        = "at_rest"
+	ControlKeyManagement = "key_management"
+)
+
+// certExpiryWarning flags peer certificates that expire within this window
+const certExpiryWarning = 30 * 24 * time.Hour
+
+// defaultMaxKeyAge bounds the active data key's age when scheduled rotation is off
+const defaultMaxKeyAge = 365 * 24 * time.Hour
+
+// approvedTLS12Suites are the TLS 1.2 cipher suites with forward secrecy and AEAD.
+// Every TLS 1.3 suite qualifies.
+var approvedTLS12Suites = map[uint16]bool{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256:       true,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384:       true,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256:         true,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384:         true,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256: true,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256:   true,
+}
+
+// AttestationCheck is one verified claim in an attestation
+type AttestationCheck struct {
+	ID      string `json:"id"`
+	Control string `json:"control"`
+	Status  string `json:"status"`
+	Detail  string `json:"detail"`
+}
+
+// PeerCertificate describes the leaf certificate a peer presented
+type PeerCertificate struct {
+	Subject       string    `json:"subject"`
+	Issuer        string    `json:"issuer"`
+	NotAfter      time.Time `json:"not_after"`
+	DaysRemaining int       `json:"days_remaining"`
+}
+
+// PeerTLS is what a live handshake with a peer showed
+type PeerTLS struct {
+	Name      string `json:"name"`
+	Address   string `json:"address"`
+	Reachable bool   `json:"reachable"`
+	// Plaintext is set for peers configured with an http:// URL, which are not probed
+	Plaintext      bool   `json:"plaintext"`
+	TLSVersion     string `json:"tls_version,omitempty"`
+	CipherSuite    string `json:"cipher_suite,omitempty"`
+	CipherApproved bool   `json:"cipher_approved"`
+	Verified       bool   `json:"verified"`
+	VerifyError    string `json:"verify_error,omitempty"`
+	// LegacyTLSAccepted is set when the peer also completed a TLS 1.0/1.1 handshake
+	LegacyTLSAccepted bool             `json:"legacy_tls_accepted"`
+	Certificate       *PeerCertificate `json:"certificate,omitempty"`
+	Error             string           `json:"error,omitempty"`
+}
+
+// StorageEncryption reports how a store holding PHI or key material is encrypted
+type StorageEncryption struct {
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	Encrypted bool   `json:"encrypted"`
+	// Method is application-level encryption, or "volume" for a path on one of
+	// ENCRYPTED_VOLUMES
+	Method string `json:"method,omitempty"`
+}
+
+// KeyAge is a data key's age at attestation time
+type KeyAge struct {
+	ID        string     `json:"id"`
+	Active    bool       `json:"active"`
+	CreatedAt time.Time  `json:"created_at"`
+	AgeDays   int        `json:"age_days"`
+	RetiredAt *time.Time `json:"retired_at,omitempty"`
+}
+
+// KeyManagement is the key material behind at-rest encryption
+type KeyManagement struct {
+	MasterKeySource string   `json:"master_key_source"`
+	MaxKeyAgeDays   int      `json:"max_key_age_days"`
+	DataKeys        []KeyAge `json:"data_keys"`
+}
+
+// EncryptionAttestation is live evidence that PHI is encrypted in transit and at rest,
+// as consumed by compliance reporting. Compliant is false when any check failed.
+type EncryptionAttestation struct {
+	Service     string              `json:"service"`
+	GeneratedAt time.Time           `json:"generated_at"`
+	Compliant   bool                `json:"compliant"`
+	Summary     map[string]int      `json:"summary"`
+	Checks      []AttestationCheck  `json:"checks"`
+	Peers       []PeerTLS           `json:"peers"`
+	Storage     []StorageEncryption `json:"storage"`
+	Keys        KeyManagement       `json:"keys"`
+}
+
+// TLSPeer is a service PHI is exchanged with, by URL ("https://host:port") or bare
+// "host:port", which is probed as TLS
+type TLSPeer struct {
+	Name string
+	URL  string
+}
+
+// StorageTarget is a persistent store. Method names application-level encryption when
+// the service encrypts the contents itself.
+type StorageTarget struct {
+	Name   string
+	Path   string
+	Method string
+}
+
+// EncryptionAttestor verifies encryption claims on demand: it handshakes with every
+// peer, checks each store against the declared encrypted volumes and ages the data
+// keys against the rotation policy
+type EncryptionAttestor struct {
+	peers           []TLSPeer
+	storage         []StorageTarget
+	volumes         []string
+	ring            *KeyRing
+	masterKeySource string
+	maxKeyAge       time.Duration
+	roots           *x509.CertPool // nil uses the system pool
+	timeout         time.Duration
+	now             func() time.Time
+}
+
+// NewEncryptionAttestor creates an attestor for a key ring whose active key must be
+// younger than maxKeyAge
+func NewEncryptionAttestor(ring *KeyRing, masterKeySource string, maxKeyAge time.Duration) *EncryptionAttestor {
+	return &EncryptionAttestor{
+		ring:            ring,
+		masterKeySource: masterKeySource,
+		maxKeyAge:       maxKeyAge,
+		timeout:         5 * time.Second,
+		now:             time.Now,
+	}
+}
+
+// AddPeer adds a peer to probe
+func (a *EncryptionAttestor) AddPeer(name, rawURL string) {
+	a.peers = append(a.peers, TLSPeer{Name: name, URL: rawURL})
+}
+
+// AddStorage adds a store to report. Stores without a path live in memory only and
+// are skipped.
+func (a *EncryptionAttestor) AddStorage(name, path, method string) {
+	if path == "" {
+		return
+	}
+	a.storage = append(a.storage, StorageTarget{Name: name, Path: path, Method: method})
+}
+
+// SetEncryptedVolumes declares the mount points backed by encrypted storage. The
+// service cannot observe volume encryption itself, so this is the deployment's claim.
+func (a *EncryptionAttestor) SetEncryptedVolumes(paths []string) {
+	a.volumes = a.volumes[:0]
+	for _, p := range paths {
+		if p = strings.TrimSpace(p); p != "" {
+			a.volumes = append(a.volumes, filepath.Clean(p))
+		}
+	}
+}
+
+// parseAttestationPeers parses ENCRYPTION_ATTESTATION_PEERS: comma-separated
+// name=url entries
+func parseAttestationPeers(value string) ([]TLSPeer, error) {
+	var peers []TLSPeer
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, target, ok := strings.Cut(entry, "=")
+		if !ok || name == "" || target == "" {
+			return nil, fmt.Errorf("invalid peer %q, want name=url", entry)
+		}
+		if _, _, err := peerAddress(target); err != nil {
+			return nil, fmt.Errorf("peer %s: %w", name, err)
+		}
+		peers = append(peers, TLSPeer{Name: name, URL: target})
+	}
+	return peers, nil
+}
+
+// peerAddress resolves a peer URL to host:port and whether it uses TLS
+func peerAddress(target string) (string, bool, error) {
+	if !strings.Contains(target, "://") {
+		if _, _, err := net.SplitHostPort(target); err != nil {
+			return "", false, fmt.Errorf("invalid address %q", target)
+		}
+		return target, true, nil
+	}
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return "", false, fmt.Errorf("invalid URL %q", target)
+	}
+	switch u.Scheme {
+	case "https":
+		if u.Port() == "" {
+			return net.JoinHostPort(u.Hostname(), "443"), true, nil
+		}
+		return u.Host, true, nil
+	case "http":
+		if u.Port() == "" {
+			return net.JoinHostPort(u.Hostname(), "80"), false, nil
+		}
+		return u.Host, false, nil
+	default:
+		return "", false, fmt.Errorf("unsupported scheme in %q", target)
+	}
+}
+
+// probePeer handshakes with a peer, then tries again offering only TLS 1.0/1.1. The
+// first handshake skips verification so the negotiated parameters are reported even
+// for a peer with a bad certificate; the chain is verified separately.
+func (a *EncryptionAttestor) probePeer(ctx context.Context, peer TLSPeer, now time.Time) PeerTLS {
+	result := PeerTLS{Name: peer.Name}
+	address, useTLS, err := peerAddress(peer.URL)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Address = address
+	if !useTLS {
+		result.Plaintext = true
+		return result
+	}
+	host, _, _ := net.SplitHostPort(address)
+
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: a.timeout},
+		Config:    &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12, InsecureSkipVerify: true},
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	state := conn.(*tls.Conn).ConnectionState()
+	conn.Close()
+
+	result.Reachable = true
+	result.TLSVersion = tls.VersionName(state.Version)
+	result.CipherSuite = tls.CipherSuiteName(state.CipherSuite)
+	result.CipherApproved = state.Version >= tls.VersionTLS13 || approvedTLS12Suites[state.CipherSuite]
+	if len(state.PeerCertificates) > 0 {
+		leaf := state.PeerCertificates[0]
+		result.Certificate = &PeerCertificate{
+			Subject:       leaf.Subject.String(),
+			Issuer:        leaf.Issuer.String(),
+			NotAfter:      leaf.NotAfter,
+			DaysRemaining: int(leaf.NotAfter.Sub(now).Hours() / 24),
+		}
+		intermediates := x509.NewCertPool()
+		for _, cert := range state.PeerCertificates[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := leaf.Verify(x509.VerifyOptions{Roots: a.roots, Intermediates: intermediates, DNSName: host, CurrentTime: now})
+		if err != nil {
+			result.VerifyError = err.Error()
+		}
+		result.Verified = err == nil
+	}
+
+	legacy := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: a.timeout},
+		Config:    &tls.Config{ServerName: host, MinVersion: tls.VersionTLS10, MaxVersion: tls.VersionTLS11, InsecureSkipVerify: true},
+	}
+	if conn, err := legacy.DialContext(ctx, "tcp", address); err == nil {
+		result.LegacyTLSAccepted = true
+		conn.Close()
+	}
+	return result
+}
+
+// peerCheck judges a probed peer
+func peerCheck(p PeerTLS) AttestationCheck {
+	check := AttestationCheck{ID: "in_transit." + p.Name, Control: ControlInTransit, Status: AttestationFail}
+	switch {
+	case p.Plaintext:
+		check.Detail = "configured over plaintext HTTP"
+	case !p.Reachable:
+		check.Detail = "TLS handshake failed: " + p.Error
+	case !p.Verified:
+		check.Detail = "certificate not trusted: " + p.VerifyError
+	case !p.CipherApproved:
+		check.Detail = "negotiated " + p.CipherSuite + ", which lacks forward secrecy or AEAD"
+	case p.LegacyTLSAccepted:
+		check.Detail = "accepts TLS 1.0/1.1"
+	case p.Certificate != nil && p.Certificate.DaysRemaining < int(certExpiryWarning.Hours()/24):
+		check.Status = AttestationWarn
+		check.Detail = fmt.Sprintf("%s with %s; certificate expires in %d days", p.TLSVersion, p.CipherSuite, p.Certificate.DaysRemaining)
+	default:
+		check.Status = AttestationPass
+		check.Detail = p.TLSVersion + " with " + p.CipherSuite
+	}
+	return check
+}
+
+// onEncryptedVolume reports whether path lies on a declared encrypted volume
+func (a *EncryptionAttestor) onEncryptedVolume(path string) bool {
+	path = filepath.Clean(path)
+	for _, volume := range a.volumes {
+		if rel, err := filepath.Rel(volume, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Attest runs every check now. Peers are probed concurrently.
+func (a *EncryptionAttestor) Attest(ctx context.Context) EncryptionAttestation {
+	now := a.now()
+	att := EncryptionAttestation{
+		Service:     "phi-service",
+		GeneratedAt: now.UTC(),
+		Summary:     map[string]int{AttestationPass: 0, AttestationWarn: 0, AttestationFail: 0},
+		Checks:      []AttestationCheck{},
+		Peers:       make([]PeerTLS, len(a.peers)),
+		Storage:     []StorageEncryption{},
+	}
+
+	var wg sync.WaitGroup
+	for i, peer := range a.peers {
+		wg.Add(1)
+		go func(i int, peer TLSPeer) {
+			defer wg.Done()
+			att.Peers[i] = a.probePeer(ctx, peer, now)
+		}(i, peer)
+	}
+	wg.Wait()
+	for _, p := range att.Peers {
+		att.Checks = append(att.Checks, peerCheck(p))
+	}
+
+	for _, target := range a.storage {
+		store := StorageEncryption{Name: target.Name, Path: target.Path, Method: target.Method}
+		switch {
+		case target.Method != "":
+			store.Encrypted = true
+		case a.onEncryptedVolume(target.Path):
+			store.Encrypted, store.Method = true, "volume"
+		}
+		att.Storage = append(att.Storage, store)
+
+		check := AttestationCheck{ID: "at_rest." + target.Name, Control: ControlAtRest, Status: AttestationPass}
+		switch {
+		case !store.Encrypted:
+			check.Status = AttestationFail
+			check.Detail = target.Path + " is not on an encrypted volume"
+		case store.Method == "volume":
+			check.Detail = target.Path + " is on an encrypted volume"
+		default:
+			check.Detail = target.Path + " is encrypted with " + store.Method
+		}
+		att.Checks = append(att.Checks, check)
+	}
+
+	att.Keys = KeyManagement{
+		MasterKeySource: a.masterKeySource,
+		MaxKeyAgeDays:   int(a.maxKeyAge.Hours() / 24),
+		DataKeys:        []KeyAge{},
+	}
+	masterCheck := AttestationCheck{ID: "key_management.master_key", Control: ControlKeyManagement, Status: AttestationPass, Detail: "master key from " + a.masterKeySource}
+	if a.masterKeySource == secrets.SourceEnv {
+		masterCheck.Status = AttestationWarn
+		masterCheck.Detail = "master key is read from the environment rather than a secret store"
+	}
+	att.Checks = append(att.Checks, masterCheck)
+
+	for _, key := range a.ring.Keys() {
+		age := now.Sub(key.CreatedAt)
+		att.Keys.DataKeys = append(att.Keys.DataKeys, KeyAge{
+			ID:        key.ID,
+			Active:    key.Active,
+			CreatedAt: key.CreatedAt,
+			AgeDays:   int(age.Hours() / 24),
+			RetiredAt: key.RetiredAt,
+		})
+		if !key.Active {
+			continue
+		}
+		check := AttestationCheck{ID: "key_management.active_key_age", Control: ControlKeyManagement, Status: AttestationPass}
+		check.Detail = fmt.Sprintf("active key %s is %d days old, limit %d", key.ID, int(age.Hours()/24), att.Keys.MaxKeyAgeDays)
+		if age > a.maxKeyAge {
+			check.Status = AttestationFail
+		}
+		att.Checks = append(att.Checks, check)
+	}
+
+	for _, check := range att.Checks {
+		att.Summary[check.Status]++
+	}
+	att.Compliant = att.Summary[AttestationFail] == 0
+	return att
+}
+
+// encryptionAttestor backs the attestation endpoint; configured at startup
+var encryptionAttestor *EncryptionAttestor
+
+// configureEncryptionAttestation sets up the attestor from the service's own
+// configuration: its peers are auth-service, Vault and the DSAR connectors plus
+// ENCRYPTION_ATTESTATION_PEERS, and its stores are those with a path configured
+func configureEncryptionAttestation(ring *KeyRing, masterKeySource string, rotationInterval time.Duration) error {
+	maxKeyAge := rotationInterval
+	if maxKeyAge <= 0 {
+		maxKeyAge = defaultMaxKeyAge
+	}
+	a := NewEncryptionAttestor(ring, masterKeySource, maxKeyAge)
+
+	if addr := config.GetEnv("AUTH_INTROSPECT_URL", ""); addr != "" {
+		a.AddPeer("auth-service", addr)
+	}
+	if addr := os.Getenv("VAULT_ADDR"); addr != "" {
+		a.AddPeer("vault", addr)
+	}
+	if dsarRequests != nil {
+		for _, c := range dsarRequests.connectors {
+			target := c.ExportURL
+			if target == "" {
+				target = c.EraseURL
+			}
+			a.AddPeer("dsar."+c.Name, target)
+		}
+	}
+	peers, err := parseAttestationPeers(config.GetEnv("ENCRYPTION_ATTESTATION_PEERS", ""))
+	if err != nil {
+		return fmt.Errorf("ENCRYPTION_ATTESTATION_PEERS: %w", err)
+	}
+	a.peers = append(a.peers, peers...)
+
+	a.AddStorage("keyring", config.GetEnv("KEYRING_PATH", ""), "AES-256-GCM key wrapping under the master key")
+	a.AddStorage("audit_log", config.GetEnv("AUDIT_LOG_PATH", ""), "")
+	a.AddStorage("downloads", config.GetEnv("DOWNLOADS_DIR", ""), "")
+	a.AddStorage("masking_exports", config.GetEnv("MASKING_EXPORT_DIR", ""), "")
+	a.AddStorage("masking_output", config.GetEnv("MASKING_OUTPUT_DIR", ""), "")
+	a.SetEncryptedVolumes(strings.Split(config.GetEnv("ENCRYPTED_VOLUMES", ""), ","))
+
+	encryptionAttestor = a
+	return nil
+}
+
+// EncryptionAttestationHandler verifies encryption in transit and at rest and returns
+// the attestation. Checks run live, so the response reflects the deployment as it is.
+func EncryptionAttestationHandler(w http.ResponseWriter, r *http.Request) {
+	att := encryptionAttestor.Attest(r.Context())
+	result := "compliant"
+	if !att.Compliant {
+		result = "noncompliant"
+	}
+	RecordEncryptionAttestation(result)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(att)
+}
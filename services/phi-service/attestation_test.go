@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/healthcare-gitops/common/secrets"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startTLSPeer starts a TLS server accepting versions from minVersion up and returns
+// its URL and a pool trusting its certificate
+func startTLSPeer(t *testing.T, minVersion uint16) (string, *x509.CertPool) {
+	t.Helper()
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{MinVersion: minVersion}
+	// The legacy probe's refused handshakes are expected
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	return server.URL, roots
+}
+
+func findCheck(t *testing.T, att EncryptionAttestation, id string) AttestationCheck {
+	t.Helper()
+	for _, check := range att.Checks {
+		if check.ID == id {
+			return check
+		}
+	}
+	t.Fatalf("no check %s in %+v", id, att.Checks)
+	return AttestationCheck{}
+}
+
+// TestEncryptionAttestationPeers tests that peers pass only over trusted, modern TLS
+func TestEncryptionAttestationPeers(t *testing.T) {
+	ring, err := NewKeyRing(testMasterKey, "")
+	require.NoError(t, err)
+
+	modern, roots := startTLSPeer(t, tls.VersionTLS12)
+	a := NewEncryptionAttestor(ring, secrets.SourceVault, 30*24*time.Hour)
+	a.AddPeer("modern", modern)
+	a.AddPeer("plaintext", "http://auth-service:8080/introspect")
+	a.roots = roots
+
+	att := a.Attest(context.Background())
+	require.Len(t, att.Peers, 2)
+	assert.Equal(t, AttestationPass, findCheck(t, att, "in_transit.modern").Status)
+	assert.True(t, att.Peers[0].Verified)
+	assert.True(t, att.Peers[0].CipherApproved)
+	assert.False(t, att.Peers[0].LegacyTLSAccepted)
+	require.NotNil(t, att.Peers[0].Certificate)
+
+	assert.Equal(t, AttestationFail, findCheck(t, att, "in_transit.plaintext").Status)
+	assert.True(t, att.Peers[1].Plaintext)
+	assert.False(t, att.Compliant)
+
+	// The same peer fails once its issuer is not trusted
+	a.roots = x509.NewCertPool()
+	att = a.Attest(context.Background())
+	untrusted := findCheck(t, att, "in_transit.modern")
+	assert.Equal(t, AttestationFail, untrusted.Status)
+	assert.Contains(t, untrusted.Detail, "certificate not trusted")
+	assert.Equal(t, "TLS 1.3", att.Peers[0].TLSVersion)
+}
+
+// TestEncryptionAttestationLegacyTLS tests that a trusted peer still accepting TLS
+// 1.0/1.1 fails
+func TestEncryptionAttestationLegacyTLS(t *testing.T) {
+	ring, err := NewKeyRing(testMasterKey, "")
+	require.NoError(t, err)
+	legacy, roots := startTLSPeer(t, tls.VersionTLS10)
+
+	a := NewEncryptionAttestor(ring, secrets.SourceVault, 30*24*time.Hour)
+	a.AddPeer("legacy", legacy)
+	a.roots = roots
+
+	att := a.Attest(context.Background())
+	assert.True(t, att.Peers[0].Verified)
+	assert.True(t, att.Peers[0].LegacyTLSAccepted)
+	assert.Equal(t, AttestationFail, findCheck(t, att, "in_transit.legacy").Status)
+}
+
+// TestEncryptionAttestationStorageAndKeys tests stores against declared encrypted
+// volumes and the active key against the rotation policy
+func TestEncryptionAttestationStorageAndKeys(t *testing.T) {
+	ring, err := NewKeyRing(testMasterKey, "")
+	require.NoError(t, err)
+
+	a := NewEncryptionAttestor(ring, secrets.SourceEnv, 30*24*time.Hour)
+	a.AddStorage("keyring", "/var/lib/phi/keyring.json", "AES-256-GCM key wrapping under the master key")
+	a.AddStorage("audit_log", "/data/audit/phi.log", "")
+	a.AddStorage("downloads", "/datastore/downloads", "")
+	a.AddStorage("masking_output", "", "")
+	a.SetEncryptedVolumes([]string{"/data", " "})
+
+	att := a.Attest(context.Background())
+	require.Len(t, att.Storage, 3)
+	assert.Equal(t, AttestationPass, findCheck(t, att, "at_rest.keyring").Status)
+	assert.Equal(t, "volume", att.Storage[1].Method)
+	assert.Equal(t, AttestationPass, findCheck(t, att, "at_rest.audit_log").Status)
+	// A path merely sharing the volume's prefix is not on it
+	assert.Equal(t, AttestationFail, findCheck(t, att, "at_rest.downloads").Status)
+	assert.Equal(t, AttestationWarn, findCheck(t, att, "key_management.master_key").Status)
+	assert.Equal(t, AttestationPass, findCheck(t, att, "key_management.active_key_age").Status)
+	assert.Equal(t, 1, att.Summary[AttestationFail])
+	assert.False(t, att.Compliant)
+
+	// Past the rotation interval the active key fails
+	a.now = func() time.Time { return time.Now().Add(31 * 24 * time.Hour) }
+	att = a.Attest(context.Background())
+	assert.Equal(t, AttestationFail, findCheck(t, att, "key_management.active_key_age").Status)
+	assert.Equal(t, 31, att.Keys.DataKeys[len(att.Keys.DataKeys)-1].AgeDays)
+}
+
+// TestParseAttestationPeers tests the ENCRYPTION_ATTESTATION_PEERS format
+func TestParseAttestationPeers(t *testing.T) {
+	peers, err := parseAttestationPeers("db=postgres:5432, kafka=https://kafka:9093 ,")
+	require.NoError(t, err)
+	assert.Equal(t, []TLSPeer{{Name: "db", URL: "postgres:5432"}, {Name: "kafka", URL: "https://kafka:9093"}}, peers)
+
+	for _, bad := range []string{"postgres:5432", "db=", "db=postgres", "db=ftp://files:21"} {
+		_, err := parseAttestationPeers(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+// TestEncryptionAttestationHandler tests the endpoint is admin only
+func TestEncryptionAttestationHandler(t *testing.T) {
+	ring, err := NewKeyRing(testMasterKey, "")
+	require.NoError(t, err)
+	previous := encryptionAttestor
+	encryptionAttestor = NewEncryptionAttestor(ring, secrets.SourceVault, 30*24*time.Hour)
+	t.Cleanup(func() { encryptionAttestor = previous })
+	t.Setenv("PHI_ADMIN_TOKEN", "admin-secret")
+
+	handler := requireAdminToken(EncryptionAttestationHandler)
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/api/v1/compliance/encryption", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/compliance/encryption", nil)
+	req.Header.Set("X-Admin-Token", "admin-secret")
+	w = httptest.NewRecorder()
+	handler(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	var att EncryptionAttestation
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&att))
+	assert.True(t, att.Compliant)
+	assert.Equal(t, "phi-service", att.Service)
+	assert.NotEmpty(t, att.Keys.DataKeys)
+}
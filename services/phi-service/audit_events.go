@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/healthcare-gitops/common/audit"
+	"github.com/healthcare-gitops/common/tlsconfig"
+	_ "github.com/jackc/pgx/v5/stdlib" // registers the pgx driver for AUDIT_SINK=postgres
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// auditEvents is the shared audit bus every PHI mutation and key material access is
+// emitted to, alongside the hash-chained access log
+var auditEvents *audit.Emitter
+
+// configureAuditEvents opens the audit sink AUDIT_SINK selects
+func configureAuditEvents(ctx context.Context) error {
+	cfg := audit.ConfigFromEnv()
+	cfg.TraceID = traceIDFromContext
+	cfg.OnWrite = func(events int, err error) {
+		if err != nil {
+			log.Warn().Err(err).Int("events", events).Msg("Audit sink unavailable, events written to stderr")
+		}
+	}
+	emitter, err := audit.Open(ctx, "phi-service", cfg)
+	if err != nil {
+		return err
+	}
+	auditEvents = emitter
+	return nil
+}
+
+// traceIDFromContext returns the trace ID of the request's span
+func traceIDFromContext(ctx context.Context) string {
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		return sc.TraceID().String()
+	}
+	return ""
+}
+
+// auditMiddleware emits an audit event to events for every mutating request, named
+// by its method and route pattern
+func auditMiddleware(events *audit.Emitter) func(http.Handler) http.Handler {
+	return events.Middleware(audit.MiddlewareOptions{
+		Action: func(r *http.Request) string {
+			if rc := chi.RouteContext(r.Context()); rc != nil && rc.RoutePattern() != "" {
+				return r.Method + " " + rc.RoutePattern()
+			}
+			return r.Method + " " + r.URL.Path
+		},
+		Actor: func(r *http.Request) string {
+			if id, ok := tlsconfig.FromContext(r.Context()); ok {
+				return id.Name()
+			}
+			return ""
+		},
+		RequestID: func(r *http.Request) string {
+			return middleware.GetReqID(r.Context())
+		},
+	})
+}
+
+// accessOutcomes maps access log statuses to audit outcomes
+var accessOutcomes = map[string]string{
+	AccessSucceeded: audit.OutcomeSuccess,
+	AccessFailed:    audit.OutcomeFailure,
+	AccessDenied:    audit.OutcomeDenied,
+}
+
+// emitAccessEvent emits a PHI access log entry to the audit bus as phi.<operation>
+// on the key it used
+func emitAccessEvent(ctx context.Context, entry AccessAuditEntry) {
+	resource := entry.Resource
+	if resource == "" && entry.KeyID != "" {
+		resource = "key/" + entry.KeyID
+	}
+	details := map[string]string{}
+	for k, v := range map[string]string{
+		"key_id":         entry.KeyID,
+		"data_type":      entry.DataType,
+		"role":           entry.Role,
+		"purpose_of_use": entry.PurposeOfUse,
+		"link_id":        entry.LinkID,
+	} {
+		if v != "" {
+			details[k] = v
+		}
+	}
+	auditEvents.Emit(ctx, audit.Event{
+		Time:      entry.Time,
+		Actor:     entry.Actor,
+		Action:    "phi." + entry.Operation,
+		Resource:  resource,
+		Outcome:   accessOutcomes[entry.Status],
+		RequestID: entry.RequestID,
+		SourceIP:  entry.RemoteAddr,
+		Details:   details,
+	})
+}
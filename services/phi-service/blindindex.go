@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Normalizations applied to a value before it is indexed, so that values which
+// should match compare equal
+const (
+	NormalizeExact           = "exact"
+	NormalizeCaseInsensitive = "case_insensitive"
+	NormalizeDigits          = "digits"
+)
+
+// ErrBlindIndexInput is returned when a blind index request is malformed
+var ErrBlindIndexInput = errors.New("invalid blind index input")
+
+// indexFieldPattern restricts field names, which are part of the key derivation
+var indexFieldPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+
+// normalizeIndexValue canonicalizes a value for indexing
+func normalizeIndexValue(value, normalization string) (string, error) {
+	switch normalization {
+	case "", NormalizeExact:
+		return value, nil
+	case NormalizeCaseInsensitive:
+		return strings.ToLower(strings.Join(strings.Fields(value), " ")), nil
+	case NormalizeDigits:
+		return strings.Map(func(r rune) rune {
+			if unicode.IsDigit(r) {
+				return r
+			}
+			return -1
+		}, value), nil
+	default:
+		return "", fmt.Errorf("%w: unknown normalization %q", ErrBlindIndexInput, normalization)
+	}
+}
+
+// BlindIndex computes a deterministic HMAC-SHA256 index of a value, keyed per field,
+// so encrypted records can be found by equality without decrypting them. The
+// index reveals only whether two values of the same field are equal. An empty
+// keyID selects the active key.
+func (e *EncryptionService) BlindIndex(field, value, normalization, keyID string) (string, string, error) {
+	if !indexFieldPattern.MatchString(field) {
+		return "", "", fmt.Errorf("%w: field must be 1-64 lowercase letters, digits, '_', '.' or '-'", ErrBlindIndexInput)
+	}
+	normalized, err := normalizeIndexValue(value, normalization)
+	if err != nil {
+		return "", "", err
+	}
+	if normalized == "" {
+		return "", "", fmt.Errorf("%w: value is empty after normalization", ErrBlindIndexInput)
+	}
+
+	keyID, key, err := e.keys.IndexKey(keyID, field)
+	if err != nil {
+		return "", "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(normalized))
+	return hex.EncodeToString(mac.Sum(nil)), keyID, nil
+}
+
+// BlindIndexRequest asks for the blind index of a field value
+type BlindIndexRequest struct {
+	Field         string `json:"field"`
+	Value         string `json:"value"`
+	Normalization string `json:"normalization,omitempty"`
+	KeyID         string `json:"key_id,omitempty"`
+	// AllKeys also returns the index under every key in the ring, for lookups
+	// that span records indexed before a key rotation
+	AllKeys bool `json:"all_keys,omitempty"`
+}
+
+// KeyedIndex is a blind index computed under a specific key
+type KeyedIndex struct {
+	KeyID string `json:"key_id"`
+	Index string `json:"index"`
+}
+
+// BlindIndexResponse is the blind index of a field value
+type BlindIndexResponse struct {
+	Field     string       `json:"field"`
+	Index     string       `json:"index"`
+	KeyID     string       `json:"key_id"`
+	Indexes   []KeyedIndex `json:"indexes,omitempty"`
+	RequestID string       `json:"request_id"`
+}
+
+// BlindIndexHandler handles blind index requests
+func BlindIndexHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	span := trace.SpanFromContext(ctx)
+	start := time.Now()
+
+	var req BlindIndexRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		RecordEncryptionOp("blind_index", "error", time.Since(start).Seconds(), 0)
+		return
+	}
+
+	resp := BlindIndexResponse{Field: req.Field}
+	var err error
+	resp.Index, resp.KeyID, err = encryptionService.BlindIndex(req.Field, req.Value, req.Normalization, req.KeyID)
+	if err == nil && req.AllKeys {
+		for _, key := range encryptionService.KeyRing().Keys() {
+			var index string
+			if index, _, err = encryptionService.BlindIndex(req.Field, req.Value, req.Normalization, key.ID); err != nil {
+				break
+			}
+			resp.Indexes = append(resp.Indexes, KeyedIndex{KeyID: key.ID, Index: index})
+		}
+	}
+	if errors.Is(err, ErrBlindIndexInput) || errors.Is(err, ErrUnknownKey) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		RecordEncryptionOp("blind_index", "error", time.Since(start).Seconds(), len(req.Value))
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Blind indexing failed")
+		http.Error(w, "Blind indexing failed", http.StatusInternalServerError)
+		RecordEncryptionOp("blind_index", "error", time.Since(start).Seconds(), len(req.Value))
+		auditAccess(r, "blind_index", resp.KeyID, req.Field, AccessFailed)
+		span.RecordError(err)
+		return
+	}
+	if err := auditAccess(r, "blind_index", resp.KeyID, req.Field, AccessSucceeded); err != nil {
+		http.Error(w, "Blind indexing failed: access could not be audited", http.StatusInternalServerError)
+		RecordEncryptionOp("blind_index", "error", time.Since(start).Seconds(), len(req.Value))
+		return
+	}
+
+	RecordEncryptionOp("blind_index", "success", time.Since(start).Seconds(), len(req.Value))
+	resp.RequestID = middleware.GetReqID(ctx)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBlindIndexIsDeterministicPerField tests equality matching and field separation
+func TestBlindIndexIsDeterministicPerField(t *testing.T) {
+	svc, err := NewEncryptionService(testMasterKey)
+	require.NoError(t, err)
+
+	a, keyID, err := svc.BlindIndex("mrn", "MRN-1001", "", "")
+	require.NoError(t, err)
+	assert.Equal(t, "v1", keyID)
+	assert.Len(t, a, 64)
+
+	again, _, err := svc.BlindIndex("mrn", "MRN-1001", "", "")
+	require.NoError(t, err)
+	assert.Equal(t, a, again)
+
+	other, _, err := svc.BlindIndex("mrn", "MRN-1002", "", "")
+	require.NoError(t, err)
+	assert.NotEqual(t, a, other)
+
+	otherField, _, err := svc.BlindIndex("account_number", "MRN-1001", "", "")
+	require.NoError(t, err)
+	assert.NotEqual(t, a, otherField)
+}
+
+// TestBlindIndexNormalization tests that normalized variants share an index
+func TestBlindIndexNormalization(t *testing.T) {
+	svc, err := NewEncryptionService(testMasterKey)
+	require.NoError(t, err)
+
+	a, _, err := svc.BlindIndex("ssn", "123-45-6789", NormalizeDigits, "")
+	require.NoError(t, err)
+	b, _, err := svc.BlindIndex("ssn", "123 45 6789", NormalizeDigits, "")
+	require.NoError(t, err)
+	assert.Equal(t, a, b)
+
+	c, _, err := svc.BlindIndex("email", "  Jane.Doe@Example.org ", NormalizeCaseInsensitive, "")
+	require.NoError(t, err)
+	d, _, err := svc.BlindIndex("email", "jane.doe@example.org", NormalizeCaseInsensitive, "")
+	require.NoError(t, err)
+	assert.Equal(t, c, d)
+
+	for _, tc := range []struct{ field, value, normalization string }{
+		{"ssn", "n/a", NormalizeDigits},
+		{"ssn", "123456789", "soundex"},
+		{"Patient MRN", "123", ""},
+		{"", "123", ""},
+	} {
+		_, _, err := svc.BlindIndex(tc.field, tc.value, tc.normalization, "")
+		assert.ErrorIs(t, err, ErrBlindIndexInput, tc)
+	}
+}
+
+// TestBlindIndexHandlerAcrossRotation tests that earlier keys stay available after rotation
+func TestBlindIndexHandlerAcrossRotation(t *testing.T) {
+	svc, err := NewEncryptionService(testMasterKey)
+	require.NoError(t, err)
+	previous := encryptionService
+	encryptionService = svc
+	defer func() { encryptionService = previous }()
+
+	before, _, err := svc.BlindIndex("mrn", "MRN-1001", "", "")
+	require.NoError(t, err)
+	_, err = svc.KeyRing().Rotate("")
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	BlindIndexHandler(w, httptest.NewRequest("POST", "/api/v1/blind-index", strings.NewReader(`{"field":"mrn","value":"MRN-1001","all_keys":true}`)))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp BlindIndexResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.Equal(t, "v2", resp.KeyID)
+	assert.NotEqual(t, before, resp.Index)
+	assert.Contains(t, resp.Indexes, KeyedIndex{KeyID: "v1", Index: before})
+	assert.Contains(t, resp.Indexes, KeyedIndex{KeyID: "v2", Index: resp.Index})
+
+	w = httptest.NewRecorder()
+	BlindIndexHandler(w, httptest.NewRequest("POST", "/api/v1/blind-index", strings.NewReader(`{"field":"mrn","value":"MRN-1001","key_id":"v9"}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
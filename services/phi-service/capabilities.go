@@ -0,0 +1,70 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+	"time"
+
+	"github.com/healthcare-gitops/common/features"
+)
+
+// apiSpecVersion is the version of openapi.yaml this build implements
+const apiSpecVersion = "1.27.0"
+
+// openAPISpec is openapi.yaml, served as JSON at /openapi.json
+//
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+// requestTimeout bounds every request through the router
+const requestTimeout = 30 * time.Second
+
+// Feature flags, each overridable with FEATURE_<NAME>
+const (
+	FeatureFPE              = "fpe"
+	FeatureBlindIndex       = "blind_index"
+	FeatureDeidentification = "deidentification"
+	FeatureDecrypt          = "decrypt"
+	FeatureKeyRotation      = "scheduled_key_rotation"
+	FeatureMaskingJobs      = "masking_jobs"
+	FeatureDSAR             = "dsar"
+	FeaturePatientKeys      = "patient_keys"
+	FeatureDownloadLinks    = "download_links"
+	FeatureTopicKeys        = "event_topic_keys"
+	FeatureHoneytokens      = "honeytokens"
+	FeatureConsent          = "consent"
+)
+
+// newFeatureFlags declares the service's features with their defaults
+func newFeatureFlags() *features.Flags {
+	return features.New(
+		features.Flag{Name: FeatureFPE, Description: "Format-preserving encryption (mode: fpe) on encrypt and decrypt", Default: true},
+		features.Flag{Name: FeatureBlindIndex, Description: "Blind indexes for equality lookups on encrypted values", Default: true},
+		features.Flag{Name: FeatureDeidentification, Description: "Safe Harbor de-identification of JSON documents on anonymize", Default: true},
+		features.Flag{Name: FeatureDecrypt, Description: "Decryption for phi:read tokens validated by auth-service", Default: true},
+		features.Flag{Name: FeatureKeyRotation, Description: "Scheduled data key rotation", Default: true},
+		features.Flag{Name: FeatureMaskingJobs, Description: "Masking jobs for production exports", Default: true},
+		features.Flag{Name: FeatureDSAR, Description: "GDPR/CCPA data subject request automation", Default: true},
+		features.Flag{Name: FeaturePatientKeys, Description: "Per-patient data keys and crypto-shredding", Default: true},
+		features.Flag{Name: FeatureDownloadLinks, Description: "Signed, expiring download links for DSAR exports and masking output", Default: true},
+		features.Flag{Name: FeatureTopicKeys, Description: "Per-topic keys for encrypting event payloads, for events:keys tokens", Default: true},
+		features.Flag{Name: FeatureHoneytokens, Description: "Decoy PHI whose decryption raises a critical SOC alert", Default: true},
+		features.Flag{Name: FeatureConsent, Description: "Versioned patient consent, checked before decrypting or tokenizing a patient's PHI", Default: true},
+	)
+}
+
+// featureFlags holds the running service's feature states
+var featureFlags = newFeatureFlags()
+
+// CapabilitiesHandler lists enabled features, API versions and limits
+func CapabilitiesHandler(w http.ResponseWriter, r *http.Request) {
+	features.Handler(func() features.Capabilities {
+		return featureFlags.Capabilities("phi-service", apiSpecVersion, []string{"v1"}, map[string]int64{
+			"request_timeout_seconds":       int64(requestTimeout.Seconds()),
+			"audit_query_max_entries":       maxAccessAuditQuery,
+			"download_link_ttl_max_seconds": int64(maxDownloadLinkTTL.Seconds()),
+			"synthetic_ttl_max_seconds":     int64(syntheticPolicy.MaxTTL.Seconds()),
+			"honeytokens_per_request_max":   maxHoneytokensPerRequest,
+		})
+	})(w, r)
+}
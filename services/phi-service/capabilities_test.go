@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/healthcare-gitops/common/features"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCapabilitiesSpecVersionMatchesOpenAPI tests that the advertised spec version is the documented one
+func TestCapabilitiesSpecVersionMatchesOpenAPI(t *testing.T) {
+	spec, err := os.ReadFile("openapi.yaml")
+	require.NoError(t, err)
+	version := regexp.MustCompile(`(?m)^  version: (\S+)$`).FindSubmatch(spec)
+	require.NotNil(t, version)
+	assert.Equal(t, apiSpecVersion, string(version[1]))
+}
+
+// TestCapabilitiesReflectFeatureFlags tests that a disabled flag is reported and enforced
+func TestCapabilitiesReflectFeatureFlags(t *testing.T) {
+	t.Setenv("FEATURE_FPE", "false")
+	previous := featureFlags
+	featureFlags = newFeatureFlags()
+	defer func() { featureFlags = previous }()
+	featureFlags.Unavailable(FeatureDSAR, "DSAR_CONNECTORS_PATH not set")
+
+	w := httptest.NewRecorder()
+	CapabilitiesHandler(w, httptest.NewRequest("GET", "/capabilities", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var caps features.Capabilities
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&caps))
+	assert.Equal(t, "phi-service", caps.Service)
+	assert.Equal(t, []string{"v1"}, caps.APIVersions)
+	assert.True(t, caps.Features[FeatureBlindIndex].Enabled)
+	assert.False(t, caps.Features[FeatureFPE].Enabled)
+	assert.Equal(t, "disabled by FEATURE_FPE", caps.Features[FeatureFPE].Reason)
+	assert.Equal(t, "DSAR_CONNECTORS_PATH not set", caps.Features[FeatureDSAR].Reason)
+	assert.Equal(t, int64(30), caps.Limits["request_timeout_seconds"])
+
+	w = httptest.NewRecorder()
+	EncryptHandler(w, httptest.NewRequest("POST", "/api/v1/encrypt", strings.NewReader(`{"data":"123-45-6789","mode":"fpe","format":"ssn"}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "not enabled")
+}
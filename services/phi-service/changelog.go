@@ -0,0 +1,67 @@
+package main
+
+import (
+	"github.com/healthcare-gitops/common/changelog"
+)
+
+// newChangelog lists the service's API changes since 1.0.0
+func newChangelog() (*changelog.Changelog, error) {
+	return changelog.New("phi-service", apiSpecVersion, []changelog.Entry{
+		{Version: "1.1.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/masking/profiles", Description: "Masking profiles for non-production exports"},
+		{Version: "1.1.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/masking/jobs", Description: "Start a masking job"},
+		{Version: "1.1.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/masking/jobs", Description: "List masking jobs"},
+		{Version: "1.1.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/masking/jobs/{jobID}", Description: "Get a masking job"},
+		{Version: "1.2.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/encrypt", Field: "mode", Description: "Format-preserving encryption with mode fpe, format, algorithm and tweak"},
+		{Version: "1.2.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/decrypt", Field: "mode", Description: "Format-preserving decryption with mode fpe, format, algorithm and tweak"},
+		{Version: "1.3.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/anonymize", Field: "document", Description: "Safe Harbor de-identification of JSON documents"},
+		{Version: "1.4.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/blind-index", Description: "Blind indexes for equality lookups on encrypted values"},
+		{Version: "1.5.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/audit/decryptions", Description: "Decrypt authorization audit trail"},
+		{Version: "1.5.0", Kind: changelog.Changed, Method: "POST", Path: "/api/v1/decrypt", Description: "Requires a phi:read token and the X-Purpose-Of-Use header"},
+		{Version: "1.6.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/audit", Description: "Hash-chained PHI access audit log"},
+		{Version: "1.6.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/audit/verify", Description: "Verify the access audit hash chain"},
+		{Version: "1.7.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/dsar", Description: "Submit a GDPR/CCPA data subject request"},
+		{Version: "1.7.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/dsar", Description: "List data subject requests"},
+		{Version: "1.7.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/dsar/report", Description: "Data subject request compliance report"},
+		{Version: "1.7.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/dsar/{requestID}", Description: "Get a data subject request"},
+		{Version: "1.7.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/dsar/{requestID}/verify", Description: "Verify the data subject's identity"},
+		{Version: "1.7.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/dsar/{requestID}/retry", Description: "Retry failed connectors"},
+		{Version: "1.7.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/dsar/{requestID}/export", Description: "Download a data subject's export"},
+		{Version: "1.8.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/encrypt", Field: "key_id", Description: "Key ID, algorithm and encrypted_at on every encryption"},
+		{Version: "1.8.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/decrypt", Field: "key_id", Description: "Key ID and decrypted_at on every decryption"},
+		{Version: "1.9.0", Kind: changelog.Added, Method: "GET", Path: "/capabilities", Description: "Feature, API version and limit discovery"},
+		{Version: "1.10.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/encrypt", Field: "patient_id", Description: "Encrypt under a per-patient data key"},
+		{Version: "1.10.0", Kind: changelog.Added, Method: "DELETE", Path: "/api/v1/keys/patient/{patientID}", Description: "Crypto-shred a patient's data key"},
+		{Version: "1.11.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/downloads", Description: "Signed, expiring download links"},
+		{Version: "1.11.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/downloads/{linkID}", Description: "Download through a signed link"},
+		{Version: "1.12.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/hash", Field: "algorithm", Description: "Selectable hash algorithms"},
+		{Version: "1.12.0", Kind: changelog.Changed, Method: "POST", Path: "/api/v1/hash", Description: "Defaults to keyed HMAC-SHA256 instead of SHA-256"},
+		{Version: "1.13.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/synthetic/cleanup", Description: "Last synthetic test data sweep"},
+		{Version: "1.13.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/synthetic/cleanup", Description: "Sweep expired synthetic test data"},
+		{Version: "1.13.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/dsar", Field: "synthetic", Description: "X-Synthetic-* headers mark test requests"},
+		{Version: "1.14.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/topic-keys/{topic}", Description: "Current event payload key for a topic"},
+		{Version: "1.14.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/topic-keys/{topic}/{keyID}", Description: "Event payload key by ID"},
+		{Version: "1.15.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/compliance/encryption", Description: "Live encryption attestation"},
+		{Version: "1.16.0", Kind: changelog.Added, Method: "GET", Path: "/admin/selfscan", Description: "Security misconfiguration self-scan"},
+		{Version: "1.17.0", Kind: changelog.Changed, Method: "POST", Path: "/api/v1/encrypt", Description: "Requires a phi:write bearer token where auth-service is configured"},
+		{Version: "1.17.0", Kind: changelog.Changed, Method: "POST", Path: "/api/v1/hash", Description: "Requires a phi:write bearer token where auth-service is configured"},
+		{Version: "1.17.0", Kind: changelog.Changed, Method: "POST", Path: "/api/v1/anonymize", Description: "Requires a phi:write bearer token where auth-service is configured"},
+		{Version: "1.17.0", Kind: changelog.Changed, Method: "POST", Path: "/api/v1/blind-index", Description: "Requires a phi:write bearer token where auth-service is configured"},
+		{Version: "1.18.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/honeytokens", Description: "Decoy PHI"},
+		{Version: "1.18.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/honeytokens", Description: "Plant decoy PHI"},
+		{Version: "1.18.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/honeytokens/alerts", Description: "Decryptions of decoy PHI"},
+		{Version: "1.19.0", Kind: changelog.Added, Method: "GET", Path: "/admin/usage-stats", Description: "Preview of the opt-in anonymous usage stats report"},
+		{Version: "1.20.0", Kind: changelog.Added, Method: "GET", Path: "/changelog", Description: "This changelog"},
+		{Version: "1.21.0", Kind: changelog.Added, Method: "GET", Path: "/openapi.json", Description: "This OpenAPI document as JSON"},
+		{Version: "1.21.0", Kind: changelog.Added, Method: "GET", Path: "/docs", Description: "Swagger UI for the OpenAPI document"},
+		{Version: "1.22.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/consents", Description: "Record a version of a patient's consent for a purpose of use"},
+		{Version: "1.22.0", Kind: changelog.Added, Method: "GET", Path: "/api/v1/consents/{patientID}", Description: "A patient's consents and their versions"},
+		{Version: "1.22.0", Kind: changelog.Added, Method: "POST", Path: "/api/v1/decrypt", Field: "patient_id", Description: "Check the patient's consent for the purpose of use before decrypting"},
+		{Version: "1.22.0", Kind: changelog.Changed, Method: "POST", Path: "/api/v1/encrypt", Description: "Encrypting for a patient_id requires the patient's consent for X-Purpose-Of-Use (default TREAT)"},
+		{Version: "1.23.0", Kind: changelog.Added, Method: "GET", Path: "/compliance/status", Description: "Live status of the service's HIPAA controls"},
+		{Version: "1.24.0", Kind: changelog.Changed, Method: "GET", Path: "/readiness", Description: "Reports each dependency check as up, degraded or down; only a critical check down answers 503"},
+		{Version: "1.25.0", Kind: changelog.Changed, Method: "POST", Path: "/api/v1/encrypt", Description: "Answers 503 with Retry-After and code key_store_unavailable while the key store is unreachable"},
+		{Version: "1.26.0", Kind: changelog.Changed, Method: "POST", Path: "/api/v1/decrypt", Field: "patient_id", Description: "Consent is checked for the patient of the ciphertext's patient key, and a patient_id naming anyone else is refused"},
+		{Version: "1.27.0", Kind: changelog.Changed, Method: "POST", Path: "/api/v1/keys/rotate", Description: "Answers 503 with Retry-After and code key_store_unavailable while the key store is unreachable"},
+		{Version: "1.27.0", Kind: changelog.Changed, Method: "POST", Path: "/api/v1/honeytokens", Description: "Answers 503 with Retry-After and code key_store_unavailable while the key store is unreachable"},
+	})
+}
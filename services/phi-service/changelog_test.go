@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/healthcare-gitops/common/apidocs"
+	"github.com/healthcare-gitops/common/changelog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestChangelogMatchesOpenAPI tests that every changed endpoint is documented and that
+// the newest change is in the version this build implements
+func TestChangelogMatchesOpenAPI(t *testing.T) {
+	spec, err := os.ReadFile("openapi.yaml")
+	require.NoError(t, err)
+	changes, err := newChangelog()
+	require.NoError(t, err)
+	assert.Equal(t, apiSpecVersion, changes.Entries[0].Version)
+	for _, e := range changes.Entries {
+		if e.Kind == changelog.Removed {
+			continue
+		}
+		assert.Regexp(t, regexp.MustCompile(`(?m)^  `+regexp.QuoteMeta(e.Path)+`:$`), string(spec), "%s %s is not in openapi.yaml", e.Method, e.Path)
+	}
+}
+
+// TestChangelogHandlerFilters tests the since and kind filters
+func TestChangelogHandlerFilters(t *testing.T) {
+	changes, err := newChangelog()
+	require.NoError(t, err)
+	handler := changelog.Handler(changes)
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/changelog?since=1.18.0&kind=added", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var doc changelog.Changelog
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&doc))
+	assert.Equal(t, "phi-service", doc.Service)
+	require.Len(t, doc.Entries, 8)
+	assert.Equal(t, "/compliance/status", doc.Entries[0].Path)
+	assert.Equal(t, "/api/v1/consents", doc.Entries[1].Path)
+	assert.Equal(t, "/api/v1/consents/{patientID}", doc.Entries[2].Path)
+	assert.Equal(t, "patient_id", doc.Entries[3].Field)
+	assert.Equal(t, "/openapi.json", doc.Entries[4].Path)
+	assert.Equal(t, "/docs", doc.Entries[5].Path)
+	assert.Equal(t, "/changelog", doc.Entries[6].Path)
+	assert.Equal(t, "/admin/usage-stats", doc.Entries[7].Path)
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/changelog?kind=renamed", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+// TestOpenAPIDocument tests that the embedded openapi.yaml converts to the JSON
+// document served at /openapi.json
+func TestOpenAPIDocument(t *testing.T) {
+	docs, err := apidocs.New(openAPISpec, apiSpecVersion)
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	docs.SpecHandler(w, httptest.NewRequest("GET", "/openapi.json", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var doc struct {
+		Info struct {
+			Version string `json:"version"`
+		} `json:"info"`
+		Paths map[string]json.RawMessage `json:"paths"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&doc))
+	assert.Equal(t, apiSpecVersion, doc.Info.Version)
+	assert.Contains(t, doc.Paths, "/api/v1/masking/jobs")
+	assert.Contains(t, doc.Paths, "/docs")
+
+	_, err = apidocs.New(openAPISpec, "1.0.0")
+	assert.Error(t, err, "a document behind the API version must not be served")
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/healthcare-gitops/common/audit"
+	"github.com/healthcare-gitops/common/compliance"
+	"github.com/healthcare-gitops/common/secrets"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestComplianceStatusChecksHIPAAControls tests that the status is built from the
+// encryption attestation and the access audit log as they are, so a plaintext peer or
+// an edited audit entry fails it
+func TestComplianceStatusChecksHIPAAControls(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	auditLog, err := NewAccessAuditLog(path)
+	require.NoError(t, err)
+	previousAudit, previousEvents, previousAttestor := accessAudit, auditEvents, encryptionAttestor
+	accessAudit = auditLog
+	auditEvents = audit.NewEmitter("phi-service", &memorySink{}, audit.Config{})
+	t.Cleanup(func() { accessAudit, auditEvents, encryptionAttestor = previousAudit, previousEvents, previousAttestor })
+	_, err = auditLog.Append(AccessAuditEntry{Time: time.Now().UTC(), Actor: "dr-grey", Operation: "decrypt", KeyID: "v1", DataType: "text", Status: AccessSucceeded})
+	require.NoError(t, err)
+
+	ring, err := NewKeyRing(testMasterKey, "")
+	require.NoError(t, err)
+	peer, roots := startTLSPeer(t, tls.VersionTLS12)
+	encryptionAttestor = NewEncryptionAttestor(ring, secrets.SourceVault, 30*24*time.Hour)
+	encryptionAttestor.AddPeer("auth-service", peer)
+	encryptionAttestor.AddStorage("keyring", "/var/lib/phi/keyring.json", "AES-256-GCM key wrapping under the master key")
+	encryptionAttestor.roots = roots
+
+	status := complianceStatus(context.Background(), true)
+	assert.Equal(t, "phi-service", status.Service)
+	assert.Equal(t, apiSpecVersion, status.Version)
+	assert.Equal(t, []compliance.Framework{compliance.HIPAA}, status.Frameworks)
+	for _, c := range status.Controls {
+		assert.Equal(t, compliance.Pass, c.Status, "%s: %s", c.ID, c.Detail)
+		assert.NotEmpty(t, c.Requirement, c.ID)
+	}
+	assert.Equal(t, compliance.Compliant, status.Status)
+	controls := map[string]compliance.Control{}
+	for _, c := range status.Controls {
+		controls[c.ID] = c
+	}
+	assert.Equal(t, "1 entries, chain intact", controls["hipaa.integrity"].Detail)
+	assert.Equal(t, "/api/v1/compliance/encryption", controls["hipaa.transmission_security"].Evidence[0].URL)
+
+	// A plaintext peer fails transmission security; an edited entry fails integrity
+	encryptionAttestor.AddPeer("legacy-ehr", "http://ehr.internal:8080")
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, []byte(strings.Replace(string(data), "dr-grey", "dr-nobody", 1)), 0o600))
+	status = complianceStatus(context.Background(), false)
+	assert.Equal(t, compliance.NonCompliant, status.Status)
+	for _, c := range status.Controls {
+		controls[c.ID] = c
+	}
+	assert.Equal(t, compliance.Fail, controls["hipaa.access_control"].Status)
+	assert.Equal(t, compliance.Fail, controls["hipaa.transmission_security"].Status)
+	assert.Equal(t, "in_transit.legacy-ehr: configured over plaintext HTTP", controls["hipaa.transmission_security"].Detail)
+	assert.Equal(t, compliance.Pass, controls["hipaa.encryption"].Status)
+	assert.Equal(t, compliance.Fail, controls["hipaa.integrity"].Status)
+	assert.Equal(t, "hash chain broken at entry 1: hash does not match the entry content", controls["hipaa.integrity"].Detail)
+
+	// Without AUDIT_LOG_PATH the log is intact but not durable
+	withAccessAudit(t)
+	assert.Equal(t, compliance.Warning, accessAuditControl().Status)
+}
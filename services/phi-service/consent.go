@@ -0,0 +1,372 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/healthcare-gitops/common/auth"
+	"github.com/healthcare-gitops/common/config"
+	"github.com/rs/zerolog/log"
+)
+
+// Consent statuses a patient can record for a purpose
+const (
+	ConsentGranted = "granted"
+	ConsentRevoked = "revoked"
+)
+
+// Consent states reported for a patient's latest record on a purpose
+const (
+	ConsentActive  = "active"
+	ConsentExpired = "expired"
+)
+
+// ErrorCodeConsent is the error code returned when PHI is refused for lack of consent
+const ErrorCodeConsent = "consent_required"
+
+// defaultTokenizePurpose is the purpose encryption for a patient is checked against
+// when the request does not assert one: capturing PHI during care
+const defaultTokenizePurpose = "TREAT"
+
+// maxConsentReferenceLength caps the reference to the signed consent document
+const maxConsentReferenceLength = 200
+
+var (
+	// ErrConsentMissing is returned when a patient has recorded no consent for a purpose
+	ErrConsentMissing = errors.New("no consent recorded")
+	// ErrConsentRevoked is returned when a patient's latest consent for a purpose is a revocation
+	ErrConsentRevoked = errors.New("consent revoked")
+	// ErrConsentExpired is returned when a patient's consent for a purpose has run out
+	ErrConsentExpired = errors.New("consent expired")
+)
+
+// ConsentRecord is one version of a patient's consent to the use of their data for a
+// purpose of use. Records are never changed: granting again, revoking or extending
+// appends the next version, and the latest version decides.
+type ConsentRecord struct {
+	PatientID  string     `json:"patient_id"`
+	Purpose    string     `json:"purpose"`
+	Version    int        `json:"version"`
+	Status     string     `json:"status"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	Reference  string     `json:"reference,omitempty"`
+	RecordedAt time.Time  `json:"recorded_at"`
+	RecordedBy string     `json:"recorded_by,omitempty"`
+}
+
+// state reports whether the record allows data use at now
+func (c ConsentRecord) state(now time.Time) string {
+	switch {
+	case c.Status == ConsentRevoked:
+		return ConsentRevoked
+	case c.ExpiresAt != nil && !now.Before(*c.ExpiresAt):
+		return ConsentExpired
+	}
+	return ConsentActive
+}
+
+// ConsentStore keeps every version of every patient's consents in an append-only log,
+// indexed by patient and purpose
+type ConsentStore struct {
+	store   auditStore
+	records map[string]map[string][]ConsentRecord
+	exempt  map[string]bool
+	now     func() time.Time
+	mu      sync.RWMutex
+}
+
+// NewConsentStore opens the consent log at path, replaying its versions, or keeps it
+// in memory when path is empty. Purposes in exempt are never checked.
+func NewConsentStore(path string, exempt []string) (*ConsentStore, error) {
+	s := &ConsentStore{
+		store:   &memoryAuditStore{},
+		records: make(map[string]map[string][]ConsentRecord),
+		exempt:  make(map[string]bool, len(exempt)),
+		now:     time.Now,
+	}
+	for _, purpose := range exempt {
+		s.exempt[purpose] = true
+	}
+	if path == "" {
+		return s, nil
+	}
+
+	store, err := openFileAuditStore(path)
+	if err != nil {
+		return nil, err
+	}
+	s.store = store
+	err = store.scan(func(line []byte) error {
+		var rec ConsentRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return fmt.Errorf("corrupt consent record: %w", err)
+		}
+		s.index(rec)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// index adds a record to the in-memory view. Callers must hold s.mu or own s.
+func (s *ConsentStore) index(rec ConsentRecord) {
+	purposes, ok := s.records[rec.PatientID]
+	if !ok {
+		purposes = make(map[string][]ConsentRecord)
+		s.records[rec.PatientID] = purposes
+	}
+	purposes[rec.Purpose] = append(purposes[rec.Purpose], rec)
+}
+
+// Record persists rec as the next version of the patient's consent for its purpose.
+// Version and RecordedAt are assigned here.
+func (s *ConsentStore) Record(rec ConsentRecord) (ConsentRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec.Version = len(s.records[rec.PatientID][rec.Purpose]) + 1
+	rec.RecordedAt = s.now().UTC()
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return ConsentRecord{}, err
+	}
+	if err := s.store.append(line); err != nil {
+		return ConsentRecord{}, err
+	}
+	s.index(rec)
+	return rec, nil
+}
+
+// Check returns the consent that allows the patient's data to be used for purpose, or
+// why there is none
+func (s *ConsentStore) Check(patientID, purpose string) (ConsentRecord, error) {
+	if s.exempt[purpose] {
+		return ConsentRecord{}, nil
+	}
+	s.mu.RLock()
+	versions := s.records[patientID][purpose]
+	s.mu.RUnlock()
+	if len(versions) == 0 {
+		return ConsentRecord{}, ErrConsentMissing
+	}
+	latest := versions[len(versions)-1]
+	switch latest.state(s.now()) {
+	case ConsentRevoked:
+		return latest, ErrConsentRevoked
+	case ConsentExpired:
+		return latest, ErrConsentExpired
+	}
+	return latest, nil
+}
+
+// Exempt reports whether purpose is used without checking consent
+func (s *ConsentStore) Exempt(purpose string) bool {
+	return s.exempt[purpose]
+}
+
+// ConsentState is a patient's latest consent for one purpose and whether it is in force
+type ConsentState struct {
+	ConsentRecord
+	State string `json:"state"`
+}
+
+// Patient returns the patient's latest consent per purpose, in purpose order, and
+// every version, oldest first
+func (s *ConsentStore) Patient(patientID string) ([]ConsentState, []ConsentRecord) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := s.now()
+	current := make([]ConsentState, 0, len(s.records[patientID]))
+	history := make([]ConsentRecord, 0)
+	for _, versions := range s.records[patientID] {
+		latest := versions[len(versions)-1]
+		current = append(current, ConsentState{ConsentRecord: latest, State: latest.state(now)})
+		history = append(history, versions...)
+	}
+	sort.Slice(current, func(i, j int) bool { return current[i].Purpose < current[j].Purpose })
+	sort.SliceStable(history, func(i, j int) bool {
+		if !history[i].RecordedAt.Equal(history[j].RecordedAt) {
+			return history[i].RecordedAt.Before(history[j].RecordedAt)
+		}
+		if history[i].Purpose != history[j].Purpose {
+			return history[i].Purpose < history[j].Purpose
+		}
+		return history[i].Version < history[j].Version
+	})
+	return current, history
+}
+
+// consents holds patients' consents; nil when the feature is disabled, in which case
+// PHI for a patient is used without a consent check
+var consents *ConsentStore
+
+// openConsents opens the consent log at CONSENT_STORE_PATH. CONSENT_EXEMPT_PURPOSES
+// lists the purposes of use that proceed without consent, by default emergency
+// treatment.
+func openConsents() (*ConsentStore, error) {
+	var exempt []string
+	for _, purpose := range strings.Split(config.GetEnv("CONSENT_EXEMPT_PURPOSES", "ETREAT"), ",") {
+		purpose = strings.ToUpper(strings.TrimSpace(purpose))
+		if purpose == "" {
+			continue
+		}
+		if _, ok := purposesOfUse[purpose]; !ok {
+			return nil, fmt.Errorf("CONSENT_EXEMPT_PURPOSES: unknown purpose of use %q", purpose)
+		}
+		exempt = append(exempt, purpose)
+	}
+	path := config.GetEnv("CONSENT_STORE_PATH", "")
+	if path == "" {
+		log.Warn().Msg("CONSENT_STORE_PATH not set, recorded consents will not survive a restart")
+	}
+	return NewConsentStore(path, exempt)
+}
+
+// checkConsent returns why the patient's data may not be used for purpose, recording
+// the result. Without a consent store or a patient every use is allowed.
+func checkConsent(patientID, purpose string) error {
+	if consents == nil || patientID == "" {
+		return nil
+	}
+	if consents.Exempt(purpose) {
+		RecordConsentCheck(purpose, "exempt")
+		return nil
+	}
+	_, err := consents.Check(patientID, purpose)
+	RecordConsentCheck(purpose, consentResult(err))
+	if err != nil {
+		log.Warn().Str("purpose_of_use", purpose).Str("consent", consentResult(err)).Msg("PHI refused without patient consent")
+	}
+	return err
+}
+
+// consentResult names a consent check outcome for metrics and error bodies
+func consentResult(err error) string {
+	switch {
+	case err == nil:
+		return "allowed"
+	case errors.Is(err, ErrConsentRevoked):
+		return ConsentRevoked
+	case errors.Is(err, ErrConsentExpired):
+		return ConsentExpired
+	}
+	return "missing"
+}
+
+// writeConsentRefused answers 403 Forbidden with the consent_required error code
+func writeConsentRefused(w http.ResponseWriter, purpose string, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(ConsentErrorResponse{
+		Error:   fmt.Sprintf("patient consent for purpose %s: %v", purpose, err),
+		Code:    ErrorCodeConsent,
+		Purpose: purpose,
+		Consent: consentResult(err),
+	})
+}
+
+// ConsentErrorResponse is the error body returned when PHI is refused for lack of
+// consent. Consent is missing, revoked or expired.
+type ConsentErrorResponse struct {
+	Error   string `json:"error"`
+	Code    string `json:"code"`
+	Purpose string `json:"purpose"`
+	Consent string `json:"consent"`
+}
+
+// ConsentRequest records a patient's consent, or its revocation, for a purpose of use
+type ConsentRequest struct {
+	PatientID string     `json:"patient_id"`
+	Purpose   string     `json:"purpose"`
+	Status    string     `json:"status"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Reference string     `json:"reference,omitempty"`
+}
+
+// RecordConsentHandler handles POST /api/v1/consents: appends the next version of a
+// patient's consent for a purpose
+func RecordConsentHandler(w http.ResponseWriter, r *http.Request) {
+	var req ConsentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.PatientID = strings.TrimSpace(req.PatientID)
+	req.Purpose = strings.ToUpper(strings.TrimSpace(req.Purpose))
+	if req.Status == "" {
+		req.Status = ConsentGranted
+	}
+	switch {
+	case req.PatientID == "":
+		http.Error(w, "patient_id is required", http.StatusBadRequest)
+		return
+	case purposesOfUse[req.Purpose] == "":
+		http.Error(w, "Unknown purpose of use "+strconv.Quote(req.Purpose), http.StatusBadRequest)
+		return
+	case req.Status != ConsentGranted && req.Status != ConsentRevoked:
+		http.Error(w, "status must be granted or revoked", http.StatusBadRequest)
+		return
+	case req.Status == ConsentRevoked && req.ExpiresAt != nil:
+		http.Error(w, "expires_at only applies to granted consent", http.StatusBadRequest)
+		return
+	case req.ExpiresAt != nil && !req.ExpiresAt.After(consents.now()):
+		http.Error(w, "expires_at must be in the future", http.StatusBadRequest)
+		return
+	case len(req.Reference) > maxConsentReferenceLength:
+		http.Error(w, fmt.Sprintf("reference must be at most %d characters", maxConsentReferenceLength), http.StatusBadRequest)
+		return
+	}
+
+	rec := ConsentRecord{PatientID: req.PatientID, Purpose: req.Purpose, Status: req.Status, Reference: req.Reference}
+	if req.ExpiresAt != nil {
+		expires := req.ExpiresAt.UTC()
+		rec.ExpiresAt = &expires
+	}
+	if id, ok := auth.FromContext(r.Context()); ok {
+		rec.RecordedBy = id.UserID
+	}
+	rec, err := consents.Record(rec)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to record consent")
+		http.Error(w, "Failed to record consent", http.StatusInternalServerError)
+		return
+	}
+	log.Info().
+		Str("purpose_of_use", rec.Purpose).
+		Str("status", rec.Status).
+		Int("version", rec.Version).
+		Str("recorded_by", rec.RecordedBy).
+		Msg("Patient consent recorded")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rec)
+}
+
+// GetConsentHandler handles GET /api/v1/consents/{patientID}: the patient's consent
+// per purpose and every version recorded
+func GetConsentHandler(w http.ResponseWriter, r *http.Request) {
+	patientID := strings.TrimSpace(chi.URLParam(r, "patientID"))
+	if patientID == "" {
+		http.Error(w, "patientID is required", http.StatusBadRequest)
+		return
+	}
+	current, history := consents.Patient(patientID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"patient_id": patientID,
+		"consents":   current,
+		"history":    history,
+	})
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/healthcare-gitops/common/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useConsents installs an empty in-memory consent store for a test
+func useConsents(t *testing.T) {
+	store, err := NewConsentStore("", []string{"ETREAT"})
+	require.NoError(t, err)
+	previous := consents
+	consents = store
+	t.Cleanup(func() { consents = previous })
+}
+
+// TestConsentStoreVersions tests that every change appends a version, the latest one
+// decides, expiry is honoured and the log survives a reopen
+func TestConsentStoreVersions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "consents.jsonl")
+	store, err := NewConsentStore(path, []string{"ETREAT"})
+	require.NoError(t, err)
+	now := time.Now().UTC()
+	store.now = func() time.Time { return now }
+
+	_, err = store.Check("patient-1", "TREAT")
+	assert.ErrorIs(t, err, ErrConsentMissing)
+	_, err = store.Check("patient-1", "ETREAT")
+	assert.NoError(t, err, "exempt purposes are not checked")
+
+	granted, err := store.Record(ConsentRecord{PatientID: "patient-1", Purpose: "TREAT", Status: ConsentGranted, RecordedBy: "registrar"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, granted.Version)
+	_, err = store.Check("patient-1", "TREAT")
+	assert.NoError(t, err)
+
+	revoked, err := store.Record(ConsentRecord{PatientID: "patient-1", Purpose: "TREAT", Status: ConsentRevoked})
+	require.NoError(t, err)
+	assert.Equal(t, 2, revoked.Version)
+	_, err = store.Check("patient-1", "TREAT")
+	assert.ErrorIs(t, err, ErrConsentRevoked)
+
+	now = now.Add(time.Minute)
+	expires := now.Add(time.Hour)
+	research, err := store.Record(ConsentRecord{PatientID: "patient-1", Purpose: "HRESCH", Status: ConsentGranted, ExpiresAt: &expires})
+	require.NoError(t, err)
+	assert.Equal(t, 1, research.Version, "versions are counted per purpose")
+	_, err = store.Check("patient-1", "HRESCH")
+	assert.NoError(t, err)
+	now = now.Add(2 * time.Hour)
+	_, err = store.Check("patient-1", "HRESCH")
+	assert.ErrorIs(t, err, ErrConsentExpired)
+	_, err = store.Check("patient-2", "HRESCH")
+	assert.ErrorIs(t, err, ErrConsentMissing)
+
+	reopened, err := NewConsentStore(path, nil)
+	require.NoError(t, err)
+	reopened.now = store.now
+	current, history := reopened.Patient("patient-1")
+	require.Len(t, current, 2)
+	assert.Equal(t, "HRESCH", current[0].Purpose)
+	assert.Equal(t, ConsentExpired, current[0].State)
+	assert.Equal(t, "TREAT", current[1].Purpose)
+	assert.Equal(t, ConsentRevoked, current[1].State)
+	assert.Equal(t, 2, current[1].Version)
+	require.Len(t, history, 3)
+	assert.Equal(t, "registrar", history[0].RecordedBy)
+
+	next, err := reopened.Record(ConsentRecord{PatientID: "patient-1", Purpose: "TREAT", Status: ConsentGranted})
+	require.NoError(t, err)
+	assert.Equal(t, 3, next.Version, "versions continue after a reopen")
+}
+
+// TestConsentChecksOnPHIOperations tests that decrypting and tokenizing a patient's PHI
+// needs their consent for the purpose of use, and that refusals are audited
+func TestConsentChecksOnPHIOperations(t *testing.T) {
+	svc, err := NewEncryptionService(testMasterKey)
+	require.NoError(t, err)
+	previous := encryptionService
+	encryptionService = svc
+	defer func() { encryptionService = previous }()
+	withAccessAudit(t)
+	useConsents(t)
+	srv, _ := fakeAuthService(t, map[string]auth.Introspection{
+		"reader": {Active: true, UserID: "dr-grey", Role: "clinician", Scopes: []string{"phi:read"}, Exp: time.Now().Add(time.Hour).Unix()},
+	})
+	withDecryptAuthorization(t, srv.URL)
+
+	router := chi.NewRouter()
+	router.Post("/encrypt", EncryptHandler)
+	router.Post("/decrypt", requireDecryptAuthorization(DecryptHandler))
+	router.Post("/consents", RecordConsentHandler)
+	router.Get("/consents/{patientID}", GetConsentHandler)
+	do := func(method, path, purpose, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer reader")
+		if purpose != "" {
+			req.Header.Set(PurposeOfUseHeader, purpose)
+			req.Header.Set(JustificationHeader, "Unresponsive patient in ED bay 4")
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	refusal := func(w *httptest.ResponseRecorder) ConsentErrorResponse {
+		t.Helper()
+		require.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+		var body ConsentErrorResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+		assert.Equal(t, ErrorCodeConsent, body.Code)
+		return body
+	}
+
+	// Tokenizing is checked against treatment unless the caller asserts a purpose
+	assert.Equal(t, "missing", refusal(do("POST", "/encrypt", "", `{"data":"123-45-6789","patient_id":"patient-7"}`)).Consent)
+	assert.Equal(t, http.StatusBadRequest, do("POST", "/encrypt", "CURIOSITY", `{"data":"123-45-6789","patient_id":"patient-7"}`).Code)
+	assert.Equal(t, http.StatusOK, do("POST", "/encrypt", "", `{"data":"123-45-6789"}`).Code, "PHI without a patient_id is not checked")
+
+	for _, body := range []string{
+		`{"purpose":"TREAT"}`,
+		`{"patient_id":"patient-7","purpose":"CURIOSITY"}`,
+		`{"patient_id":"patient-7","purpose":"TREAT","status":"maybe"}`,
+		`{"patient_id":"patient-7","purpose":"TREAT","status":"revoked","expires_at":"2999-01-01T00:00:00Z"}`,
+		`{"patient_id":"patient-7","purpose":"TREAT","expires_at":"2000-01-01T00:00:00Z"}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, do("POST", "/consents", "", body).Code, body)
+	}
+	w := do("POST", "/consents", "", `{"patient_id":"patient-7","purpose":"treat","reference":"form-8812"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var rec ConsentRecord
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&rec))
+	assert.Equal(t, "TREAT", rec.Purpose)
+	assert.Equal(t, ConsentGranted, rec.Status)
+	assert.Equal(t, 1, rec.Version)
+
+	w = do("POST", "/encrypt", "", `{"data":"123-45-6789","patient_id":"patient-7"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var encrypted EncryptResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&encrypted))
+	decrypt := `{"encrypted_data":"` + encrypted.EncryptedData + `","patient_id":"patient-7"}`
+
+	// Consent covers only the purposes it was given for; emergency treatment is exempt
+	assert.Equal(t, http.StatusOK, do("POST", "/decrypt", "TREAT", decrypt).Code)
+	body := refusal(do("POST", "/decrypt", "HRESCH", decrypt))
+	assert.Equal(t, "HRESCH", body.Purpose)
+	assert.Equal(t, "missing", body.Consent)
+	assert.Equal(t, http.StatusOK, do("POST", "/decrypt", "ETREAT", decrypt).Code)
+
+	require.Equal(t, http.StatusCreated, do("POST", "/consents", "", `{"patient_id":"patient-7","purpose":"TREAT","status":"revoked"}`).Code)
+	assert.Equal(t, ConsentRevoked, refusal(do("POST", "/decrypt", "TREAT", decrypt)).Consent)
+
+	// The patient is taken from the ciphertext's key, so leaving out patient_id or
+	// naming another patient who has consented does not get around the check
+	assert.Equal(t, ConsentRevoked, refusal(do("POST", "/decrypt", "TREAT", `{"encrypted_data":"`+encrypted.EncryptedData+`"}`)).Consent)
+	require.Equal(t, http.StatusCreated, do("POST", "/consents", "", `{"patient_id":"patient-8","purpose":"TREAT"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do("POST", "/decrypt", "TREAT", `{"encrypted_data":"`+encrypted.EncryptedData+`","patient_id":"patient-8"}`).Code)
+
+	denied, err := accessAudit.Query(AccessAuditFilter{Status: AccessDenied})
+	require.NoError(t, err)
+	require.Len(t, denied, 5)
+	assert.Equal(t, "decrypt", denied[0].Operation)
+	assert.Equal(t, "TREAT", denied[0].PurposeOfUse)
+	assert.Equal(t, encrypted.KeyID, denied[0].KeyID)
+	assert.Equal(t, "encrypt", denied[4].Operation)
+
+	w = do("GET", "/consents/patient-7", "", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var patient struct {
+		Consents []ConsentState  `json:"consents"`
+		History  []ConsentRecord `json:"history"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&patient))
+	require.Len(t, patient.Consents, 1)
+	assert.Equal(t, ConsentRevoked, patient.Consents[0].State)
+	assert.Equal(t, 2, patient.Consents[0].Version)
+	require.Len(t, patient.History, 2)
+	assert.Equal(t, "form-8812", patient.History[0].Reference)
+}
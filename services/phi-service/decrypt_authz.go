@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/healthcare-gitops/common/auth"
+	"github.com/rs/zerolog/log"
+)
+
+// decryptScope is the token scope required to decrypt PHI
+const decryptScope = "phi:read"
+
+// Headers asserting why PHI is being decrypted
+const (
+	PurposeOfUseHeader  = "X-Purpose-Of-Use"
+	JustificationHeader = "X-Purpose-Justification"
+)
+
+// maxJustificationLength caps the free-text justification kept in the audit log
+const maxJustificationLength = 500
+
+// purposesOfUse are the accepted purposes, from the HL7 v3 PurposeOfUse value set
+var purposesOfUse = map[string]string{
+	"TREAT":     "treatment",
+	"ETREAT":    "emergency treatment",
+	"COC":       "coordination of care",
+	"HPAYMT":    "healthcare payment",
+	"HOPERAT":   "healthcare operations",
+	"HRESCH":    "healthcare research",
+	"PUBHLTH":   "public health",
+	"PATRQT":    "patient requested",
+	"HLEGAL":    "legal",
+	"HSYSADMIN": "system administration",
+}
+
+// justifiedPurposes need a free-text justification as well: emergency treatment is
+// the break-glass path, and research and legal disclosures fall outside routine care
+var justifiedPurposes = map[string]bool{
+	"ETREAT": true,
+	"HRESCH": true,
+	"HLEGAL": true,
+}
+
+// Decision reasons recorded in the decrypt audit log
+const (
+	ReasonAuthorized           = "authorized"
+	ReasonMissingToken         = "missing_token"
+	ReasonInvalidToken         = "invalid_token"
+	ReasonInsufficientScope    = "insufficient_scope"
+	ReasonMissingPurpose       = "missing_purpose"
+	ReasonUnknownPurpose       = "unknown_purpose"
+	ReasonMissingJustification = "missing_justification"
+	ReasonIntrospectionFailed  = "introspection_failed"
+)
+
+// DecryptAuditRecord is one authorization decision on a decrypt request
+type DecryptAuditRecord struct {
+	Time          time.Time `json:"time"`
+	RequestID     string    `json:"request_id,omitempty"`
+	UserID        string    `json:"user_id,omitempty"`
+	Role          string    `json:"role,omitempty"`
+	PurposeOfUse  string    `json:"purpose_of_use,omitempty"`
+	Justification string    `json:"justification,omitempty"`
+	Allowed       bool      `json:"allowed"`
+	Reason        string    `json:"reason"`
+	RemoteAddr    string    `json:"remote_addr,omitempty"`
+}
+
+// decryptAuditSize is how many decisions are retained for the audit endpoint
+const decryptAuditSize = 1000
+
+// DecryptAuditLog keeps recent decrypt authorization decisions, oldest first
+type DecryptAuditLog struct {
+	records []DecryptAuditRecord
+	mu      sync.RWMutex
+}
+
+// Record stores a decision and writes it to the structured audit log
+func (l *DecryptAuditLog) Record(rec DecryptAuditRecord) {
+	l.mu.Lock()
+	l.records = append(l.records, rec)
+	if len(l.records) > decryptAuditSize {
+		l.records = l.records[len(l.records)-decryptAuditSize:]
+	}
+	l.mu.Unlock()
+
+	decision := "denied"
+	if rec.Allowed {
+		decision = "allowed"
+	}
+	RecordDecryptAuthorization(decision, rec.Reason)
+
+	event := log.Warn()
+	if rec.Allowed {
+		event = log.Info()
+	}
+	event.Str("audit", "phi_decrypt").
+		Str("decision", decision).
+		Str("reason", rec.Reason).
+		Str("user_id", rec.UserID).
+		Str("role", rec.Role).
+		Str("purpose_of_use", rec.PurposeOfUse).
+		Str("justification", rec.Justification).
+		Str("request_id", rec.RequestID).
+		Str("remote_addr", rec.RemoteAddr).
+		Msg("PHI decrypt authorization")
+}
+
+// Records returns decisions matching the filters, newest first. Empty filters match
+// everything; limit 0 returns all matches.
+func (l *DecryptAuditLog) Records(userID, decision string, limit int) []DecryptAuditRecord {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	out := make([]DecryptAuditRecord, 0)
+	for i := len(l.records) - 1; i >= 0; i-- {
+		rec := l.records[i]
+		if userID != "" && rec.UserID != userID {
+			continue
+		}
+		if (decision == "allowed" && !rec.Allowed) || (decision == "denied" && rec.Allowed) {
+			continue
+		}
+		out = append(out, rec)
+		if limit > 0 && len(out) == limit {
+			break
+		}
+	}
+	return out
+}
+
+var (
+	// decryptIntrospector is nil when AUTH_INTROSPECT_URL is not set, which
+	// disables decryption
+	decryptIntrospector *auth.Introspector
+	decryptAudit        = &DecryptAuditLog{}
+)
+
+// requireDecryptAuthorization admits decrypt requests that carry an active token
+// with the phi:read scope and a recognised purpose of use, plus a justification
+// for the purposes that need one. Every decision is audited.
+func requireDecryptAuthorization(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if decryptIntrospector == nil {
+			http.Error(w, "Decryption is disabled: AUTH_INTROSPECT_URL is not set", http.StatusServiceUnavailable)
+			return
+		}
+
+		rec := DecryptAuditRecord{
+			Time:          time.Now().UTC(),
+			RequestID:     middleware.GetReqID(r.Context()),
+			PurposeOfUse:  strings.ToUpper(strings.TrimSpace(r.Header.Get(PurposeOfUseHeader))),
+			Justification: strings.TrimSpace(r.Header.Get(JustificationHeader)),
+			RemoteAddr:    r.RemoteAddr,
+		}
+		if len(rec.Justification) > maxJustificationLength {
+			rec.Justification = rec.Justification[:maxJustificationLength]
+		}
+		deny := func(status int, reason, message string) {
+			rec.Reason = reason
+			decryptAudit.Record(rec)
+			auditDecision(r.Context(), AccessAuditEntry{
+				Time:         rec.Time,
+				RequestID:    rec.RequestID,
+				Actor:        rec.UserID,
+				Role:         rec.Role,
+				PurposeOfUse: rec.PurposeOfUse,
+				RemoteAddr:   rec.RemoteAddr,
+				Operation:    "decrypt",
+				Status:       AccessDenied,
+			})
+			http.Error(w, message, status)
+		}
+
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || token == r.Header.Get("Authorization") {
+			deny(http.StatusUnauthorized, ReasonMissingToken, "Bearer token required")
+			return
+		}
+		info, err := decryptIntrospector.Introspect(r, token)
+		if err != nil {
+			log.Error().Err(err).Msg("Token introspection failed")
+			deny(http.StatusServiceUnavailable, ReasonIntrospectionFailed, "Authorization service unavailable")
+			return
+		}
+		if !info.Active {
+			deny(http.StatusUnauthorized, ReasonInvalidToken, "Invalid or expired token")
+			return
+		}
+		rec.UserID, rec.Role = info.UserID, info.Role
+
+		if !info.HasScope(decryptScope) {
+			deny(http.StatusForbidden, ReasonInsufficientScope, "Token lacks the phi:read scope")
+			return
+		}
+		if rec.PurposeOfUse == "" {
+			deny(http.StatusForbidden, ReasonMissingPurpose, PurposeOfUseHeader+" header required")
+			return
+		}
+		if _, ok := purposesOfUse[rec.PurposeOfUse]; !ok {
+			deny(http.StatusForbidden, ReasonUnknownPurpose, "Unknown purpose of use "+strconv.Quote(rec.PurposeOfUse))
+			return
+		}
+		if justifiedPurposes[rec.PurposeOfUse] && rec.Justification == "" {
+			deny(http.StatusForbidden, ReasonMissingJustification, JustificationHeader+" header required for purpose "+rec.PurposeOfUse)
+			return
+		}
+
+		rec.Allowed, rec.Reason = true, ReasonAuthorized
+		decryptAudit.Record(rec)
+		next(w, r.WithContext(withDecryptAuthorizationRecord(r.Context(), rec)))
+	}
+}
+
+// ListDecryptAuditHandler lists recent decrypt authorization decisions. Supports
+// ?user_id=, ?decision=allowed|denied and ?limit= (default 100).
+func ListDecryptAuditHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	decision := query.Get("decision")
+	if decision != "" && decision != "allowed" && decision != "denied" {
+		http.Error(w, "decision must be allowed or denied", http.StatusBadRequest)
+		return
+	}
+	limit := 100
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > decryptAuditSize {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", decryptAuditSize), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	records := decryptAudit.Records(query.Get("user_id"), decision, limit)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"records": records,
+		"count":   len(records),
+	})
+}
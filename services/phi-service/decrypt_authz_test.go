@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/healthcare-gitops/common/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAuthService answers introspection for a fixed set of tokens and counts calls
+func fakeAuthService(t *testing.T, tokens map[string]auth.Introspection) (*httptest.Server, *int32) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		info, ok := tokens[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(auth.Introspection{Active: false})
+			return
+		}
+		json.NewEncoder(w).Encode(info)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+// withDecryptAuthorization installs an introspector and a fresh audit log for a test
+func withDecryptAuthorization(t *testing.T, url string) {
+	previousIntrospector, previousAudit := decryptIntrospector, decryptAudit
+	decryptIntrospector = auth.NewIntrospector(auth.Config{IntrospectURL: url, Timeout: time.Second})
+	decryptAudit = &DecryptAuditLog{}
+	t.Cleanup(func() { decryptIntrospector, decryptAudit = previousIntrospector, previousAudit })
+}
+
+// TestDecryptAuthorizationDecisions tests scope, purpose and justification checks
+func TestDecryptAuthorizationDecisions(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Unix()
+	srv, _ := fakeAuthService(t, map[string]auth.Introspection{
+		"reader":  {Active: true, UserID: "dr-grey", Role: "clinician", Scopes: []string{"phi:read"}, Exp: exp},
+		"payment": {Active: true, UserID: "billing", Role: "service", Scopes: []string{"payment:write"}, Exp: exp},
+	})
+	withDecryptAuthorization(t, srv.URL)
+
+	handler := requireDecryptAuthorization(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	cases := []struct {
+		name, token, purpose, justification string
+		status                              int
+		reason                              string
+	}{
+		{"no token", "", "TREAT", "", http.StatusUnauthorized, ReasonMissingToken},
+		{"unknown token", "forged", "TREAT", "", http.StatusUnauthorized, ReasonInvalidToken},
+		{"wrong scope", "payment", "TREAT", "", http.StatusForbidden, ReasonInsufficientScope},
+		{"no purpose", "reader", "", "", http.StatusForbidden, ReasonMissingPurpose},
+		{"unknown purpose", "reader", "CURIOSITY", "", http.StatusForbidden, ReasonUnknownPurpose},
+		{"break glass without justification", "reader", "ETREAT", "", http.StatusForbidden, ReasonMissingJustification},
+		{"break glass", "reader", "etreat", "Unresponsive patient in ED bay 4", http.StatusOK, ReasonAuthorized},
+		{"treatment", "reader", "TREAT", "", http.StatusOK, ReasonAuthorized},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest("POST", "/api/v1/decrypt", nil)
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		req.Header.Set(PurposeOfUseHeader, tc.purpose)
+		req.Header.Set(JustificationHeader, tc.justification)
+		w := httptest.NewRecorder()
+		handler(w, req)
+		assert.Equal(t, tc.status, w.Code, tc.name)
+
+		latest := decryptAudit.Records("", "", 1)
+		require.Len(t, latest, 1, tc.name)
+		assert.Equal(t, tc.reason, latest[0].Reason, tc.name)
+	}
+
+	denied := decryptAudit.Records("", "denied", 0)
+	assert.Len(t, denied, 6)
+	allowed := decryptAudit.Records("dr-grey", "allowed", 0)
+	require.Len(t, allowed, 2)
+	assert.Equal(t, "TREAT", allowed[0].PurposeOfUse)
+	assert.Equal(t, "ETREAT", allowed[1].PurposeOfUse)
+	assert.Equal(t, "Unresponsive patient in ED bay 4", allowed[1].Justification)
+}
+
+// TestDecryptAuthorizationForwardsClient tests that auth-service is told which client
+// presented a token, so bad tokens are charged to the client rather than this service
+func TestDecryptAuthorizationForwardsClient(t *testing.T) {
+	forwarded := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded <- r.Header.Get("X-Forwarded-For")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(auth.Introspection{Active: false})
+	}))
+	t.Cleanup(srv.Close)
+	withDecryptAuthorization(t, srv.URL)
+
+	handler := requireDecryptAuthorization(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	req := httptest.NewRequest("POST", "/api/v1/decrypt", nil)
+	req.RemoteAddr = "10.2.0.4:51000"
+	req.Header.Set("X-Forwarded-For", "203.0.113.9")
+	req.Header.Set("Authorization", "Bearer junk")
+	req.Header.Set(PurposeOfUseHeader, "TREAT")
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "203.0.113.9, 10.2.0.4", <-forwarded)
+}
+
+// TestTokenIntrospectorCachesResults tests that repeated tokens skip the auth-service call
+func TestTokenIntrospectorCachesResults(t *testing.T) {
+	srv, calls := fakeAuthService(t, map[string]auth.Introspection{
+		"reader": {Active: true, UserID: "dr-grey", Scopes: []string{"phi:read"}, Exp: time.Now().Add(time.Hour).Unix()},
+	})
+	ti := auth.NewIntrospector(auth.Config{IntrospectURL: srv.URL, Timeout: time.Second})
+	now := time.Now()
+	ti.SetClock(func() time.Time { return now })
+
+	for i := 0; i < 3; i++ {
+		info, err := ti.Introspect(httptest.NewRequest("GET", "/", nil), "reader")
+		require.NoError(t, err)
+		assert.True(t, info.Active)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+
+	now = now.Add(auth.DefaultCacheTTL)
+	_, err := ti.Introspect(httptest.NewRequest("GET", "/", nil), "reader")
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+}
+
+// TestTokenIntrospectorNegativeCacheAndEviction tests that inactive tokens are cached
+// briefly, the least recently used token is evicted and lookups are reported
+func TestTokenIntrospectorNegativeCacheAndEviction(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Unix()
+	srv, calls := fakeAuthService(t, map[string]auth.Introspection{
+		"reader": {Active: true, UserID: "dr-grey", Scopes: []string{"phi:read"}, Exp: exp},
+		"writer": {Active: true, UserID: "etl", Scopes: []string{"phi:write"}, Exp: exp},
+	})
+	lookups := map[string]int{}
+	ti := auth.NewIntrospector(auth.Config{
+		IntrospectURL: srv.URL,
+		Timeout:       time.Second,
+		CacheSize:     2,
+		OnCacheLookup: func(result string) { lookups[result]++ },
+	})
+	now := time.Now()
+	ti.SetClock(func() time.Time { return now })
+	introspect := func(token string) *auth.Introspection {
+		info, err := ti.Introspect(httptest.NewRequest("GET", "/", nil), token)
+		require.NoError(t, err)
+		return info
+	}
+
+	assert.False(t, introspect("forged").Active)
+	assert.False(t, introspect("forged").Active)
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+	now = now.Add(auth.DefaultNegativeCacheTTL)
+	introspect("forged")
+	assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+
+	// Caching reader and writer evicts forged, the least recently used
+	introspect("reader")
+	introspect("writer")
+	introspect("reader")
+	assert.Equal(t, int32(4), atomic.LoadInt32(calls))
+	introspect("forged")
+	assert.Equal(t, int32(5), atomic.LoadInt32(calls))
+	introspect("reader")
+	assert.Equal(t, int32(5), atomic.LoadInt32(calls), "reader was used more recently than writer")
+	introspect("writer")
+	assert.Equal(t, int32(6), atomic.LoadInt32(calls))
+
+	assert.Equal(t, map[string]int{auth.CacheHit: 3, auth.CacheMiss: 6}, lookups)
+}
+
+// TestDecryptAuthorizationFailsClosed tests the unconfigured and unreachable cases
+func TestDecryptAuthorizationFailsClosed(t *testing.T) {
+	handler := requireDecryptAuthorization(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	previous := decryptIntrospector
+	decryptIntrospector = nil
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("POST", "/api/v1/decrypt", nil))
+	decryptIntrospector = previous
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+	withDecryptAuthorization(t, srv.URL)
+
+	req := httptest.NewRequest("POST", "/api/v1/decrypt", nil)
+	req.Header.Set("Authorization", "Bearer reader")
+	req.Header.Set(PurposeOfUseHeader, "TREAT")
+	w = httptest.NewRecorder()
+	handler(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, ReasonIntrospectionFailed, decryptAudit.Records("", "denied", 1)[0].Reason)
+}
+
+// TestPHIOperationsRequireWriteScope tests the shared middleware guarding PHI operations
+func TestPHIOperationsRequireWriteScope(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Unix()
+	srv, _ := fakeAuthService(t, map[string]auth.Introspection{
+		"writer": {Active: true, UserID: "etl", Role: "service", Scopes: []string{"phi:write"}, Exp: exp},
+		"reader": {Active: true, UserID: "dr-grey", Role: "clinician", Scopes: []string{"phi:read"}, Exp: exp},
+		"admin":  {Active: true, UserID: "root", Role: "admin", Scopes: []string{"admin"}, Exp: exp},
+	})
+	ti := auth.NewIntrospector(auth.Config{IntrospectURL: srv.URL, Timeout: time.Second})
+	handler := ti.Require("phi:write")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := auth.FromContext(r.Context())
+		require.True(t, ok)
+		w.Write([]byte(id.UserID))
+	}))
+
+	cases := []struct {
+		token  string
+		status int
+	}{
+		{"", http.StatusUnauthorized},
+		{"forged", http.StatusUnauthorized},
+		{"reader", http.StatusForbidden},
+		{"writer", http.StatusOK},
+		{"admin", http.StatusOK},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest("POST", "/api/v1/encrypt", nil)
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		assert.Equal(t, tc.status, w.Code, "token %q", tc.token)
+	}
+
+	// Without auth-service configured the routes stay open
+	var unconfigured *auth.Introspector
+	w := httptest.NewRecorder()
+	unconfigured.Require("phi:write")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})).ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/encrypt", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
@@ -0,0 +1,536 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog/log"
+)
+
+// De-identification methods
+const (
+	DeidRedact       = "redact"       // identifiers replaced with a category tag such as [NAME]
+	DeidPseudonymize = "pseudonymize" // identifiers replaced with a stable keyed token such as [NAME-3f2a9c1b0e]
+)
+
+// Actions recorded in the de-identification report
+const (
+	ActionRedacted      = "redacted"
+	ActionPseudonymized = "pseudonymized"
+	ActionGeneralized   = "generalized"
+)
+
+// deidCategories are the HIPAA Safe Harbor identifiers (45 CFR 164.514(b)(2)). ZIP
+// codes and ages are listed apart from other geography and dates because Safe Harbor
+// lets them be generalized instead of removed.
+var deidCategories = map[string]string{
+	"name":        "Names",
+	"geographic":  "Geographic subdivisions smaller than a state",
+	"zip":         "ZIP codes (first three digits kept when the area has over 20,000 people)",
+	"date":        "Dates related to an individual (year kept)",
+	"age":         "Ages over 89",
+	"phone":       "Telephone numbers",
+	"fax":         "Fax numbers",
+	"email":       "Email addresses",
+	"ssn":         "Social Security numbers",
+	"mrn":         "Medical record numbers",
+	"health_plan": "Health plan beneficiary numbers",
+	"account":     "Account numbers",
+	"license":     "Certificate and license numbers",
+	"vehicle":     "Vehicle identifiers, serial numbers and license plates",
+	"device":      "Device identifiers and serial numbers",
+	"url":         "Web URLs",
+	"ip":          "IP addresses",
+	"biometric":   "Biometric identifiers",
+	"photo":       "Full-face photographs and comparable images",
+	"other":       "Any other unique identifying number, characteristic or code",
+}
+
+// restrictedZIP3 are the three-digit ZIP prefixes whose areas have 20,000 people or
+// fewer (2010 census), which Safe Harbor requires to be replaced with 000
+var restrictedZIP3 = map[string]bool{
+	"036": true, "059": true, "063": true, "102": true, "203": true, "556": true,
+	"692": true, "790": true, "821": true, "823": true, "830": true, "831": true,
+	"878": true, "879": true, "884": true, "890": true, "893": true,
+}
+
+// DeidRule detects one kind of identifier. Exactly one detector is set:
+//   - Fields names JSON keys whose whole value is the identifier, matched
+//     case-insensitively; a leading or trailing * matches any prefix or suffix.
+//   - Pattern is a regular expression run over string values. Group selects the
+//     submatch to replace, so context such as "MRN:" can be kept.
+//   - Terms is a word list (a gazetteer, such as known surnames) matched
+//     case-insensitively as whole words.
+type DeidRule struct {
+	Name     string   `json:"name"`
+	Category string   `json:"category"`
+	Fields   []string `json:"fields,omitempty"`
+	Pattern  string   `json:"pattern,omitempty"`
+	Group    int      `json:"group,omitempty"`
+	Terms    []string `json:"terms,omitempty"`
+	Disabled bool     `json:"disabled,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// compile validates the rule and prepares its pattern
+func (r *DeidRule) compile() error {
+	if r.Name == "" {
+		return fmt.Errorf("de-identification rule name is required")
+	}
+	if _, ok := deidCategories[r.Category]; !ok {
+		return fmt.Errorf("rule %s: unknown category %q", r.Name, r.Category)
+	}
+
+	detectors := 0
+	for _, set := range []bool{len(r.Fields) > 0, r.Pattern != "", len(r.Terms) > 0} {
+		if set {
+			detectors++
+		}
+	}
+	if detectors != 1 {
+		return fmt.Errorf("rule %s: exactly one of fields, pattern or terms is required", r.Name)
+	}
+
+	pattern := r.Pattern
+	if len(r.Terms) > 0 {
+		quoted := make([]string, len(r.Terms))
+		for i, term := range r.Terms {
+			quoted[i] = regexp.QuoteMeta(term)
+		}
+		pattern = `(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`
+	}
+	if pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("rule %s: %w", r.Name, err)
+		}
+		if r.Group < 0 || r.Group > re.NumSubexp() {
+			return fmt.Errorf("rule %s: pattern has no group %d", r.Name, r.Group)
+		}
+		r.re = re
+	}
+	return nil
+}
+
+// matchesField reports whether a JSON key is named by the rule
+func (r *DeidRule) matchesField(key string) bool {
+	key = strings.ToLower(key)
+	for _, field := range r.Fields {
+		field = strings.ToLower(field)
+		switch {
+		case strings.HasPrefix(field, "*") && strings.HasSuffix(key, field[1:]):
+			return true
+		case strings.HasSuffix(field, "*") && strings.HasPrefix(key, field[:len(field)-1]):
+			return true
+		case field == key:
+			return true
+		}
+	}
+	return false
+}
+
+const monthNames = `(?:Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Sept|Oct|Nov|Dec)[a-z]*\.?`
+
+// defaultDeidRules detect the Safe Harbor identifiers in field names and free text.
+// The person_* rules are a lightweight name recognizer: capitalised words after an
+// honorific or a label such as "Patient:". Deployments add a surname gazetteer with
+// a terms rule.
+func defaultDeidRules() []*DeidRule {
+	return []*DeidRule{
+		// Structured fields
+		{Name: "name_fields", Category: "name", Fields: []string{"name", "first_name", "last_name", "middle_name", "full_name", "given_name", "family_name", "maiden_name", "patient_name", "guarantor_name", "emergency_contact_name", "next_of_kin"}},
+		{Name: "address_fields", Category: "geographic", Fields: []string{"address", "street", "street_address", "address_line1", "address_line2", "city", "county", "precinct", "geocode", "latitude", "longitude", "coordinates"}},
+		{Name: "zip_fields", Category: "zip", Fields: []string{"zip", "zip_code", "zipcode", "postal_code"}},
+		{Name: "date_fields", Category: "date", Fields: []string{"dob", "birthdate", "*_date", "date_of_*"}},
+		{Name: "age_fields", Category: "age", Fields: []string{"age", "age_years"}},
+		{Name: "phone_fields", Category: "phone", Fields: []string{"phone", "phone_number", "telephone", "mobile", "cell_phone", "home_phone", "work_phone"}},
+		{Name: "fax_fields", Category: "fax", Fields: []string{"fax", "fax_number"}},
+		{Name: "email_fields", Category: "email", Fields: []string{"email", "email_address"}},
+		{Name: "ssn_fields", Category: "ssn", Fields: []string{"ssn", "social_security_number"}},
+		{Name: "mrn_fields", Category: "mrn", Fields: []string{"mrn", "medical_record_number"}},
+		{Name: "health_plan_fields", Category: "health_plan", Fields: []string{"health_plan_id", "insurance_id", "member_id", "policy_number", "subscriber_id", "beneficiary_id", "medicare_id", "medicaid_id"}},
+		{Name: "account_fields", Category: "account", Fields: []string{"account_number", "account_id", "bank_account"}},
+		{Name: "license_fields", Category: "license", Fields: []string{"license_number", "drivers_license", "certificate_number"}},
+		{Name: "vehicle_fields", Category: "vehicle", Fields: []string{"vin", "license_plate", "vehicle_id"}},
+		{Name: "device_fields", Category: "device", Fields: []string{"device_id", "device_serial", "serial_number", "udi"}},
+		{Name: "url_fields", Category: "url", Fields: []string{"url", "website", "homepage"}},
+		{Name: "ip_fields", Category: "ip", Fields: []string{"ip", "ip_address", "client_ip"}},
+		{Name: "biometric_fields", Category: "biometric", Fields: []string{"fingerprint", "voiceprint", "retina_scan", "biometric_id"}},
+		{Name: "photo_fields", Category: "photo", Fields: []string{"photo", "photo_url", "face_image"}},
+		{Name: "other_id_fields", Category: "other", Fields: []string{"patient_id", "employee_id", "case_number", "encounter_id"}},
+
+		// Free text; fax precedes phone so a labelled fax number is reported as fax
+		{Name: "ssn", Category: "ssn", Pattern: `\b\d{3}-\d{2}-\d{4}\b`},
+		{Name: "ssn_labelled", Category: "ssn", Pattern: `(?i)\bSSN[:#\s]*(\d{9})\b`, Group: 1},
+		{Name: "email", Category: "email", Pattern: `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`},
+		{Name: "url", Category: "url", Pattern: `\bhttps?://[^\s"'<>]*[^\s"'<>.,;:!?)]`},
+		{Name: "fax", Category: "fax", Pattern: `(?i)\bfax[:#\s]*((?:\+?1[\s.-]?)?\(?\d{3}\)?[\s.-]?\d{3}[\s.-]\d{4})\b`, Group: 1},
+		{Name: "phone", Category: "phone", Pattern: `(?:\+?1[\s.-]?)?(?:\(\d{3}\)|\b\d{3})[\s.-]?\d{3}[\s.-]\d{4}\b`},
+		{Name: "ipv4", Category: "ip", Pattern: `\b(?:(?:25[0-5]|2[0-4]\d|1?\d?\d)\.){3}(?:25[0-5]|2[0-4]\d|1?\d?\d)\b`},
+		{Name: "ipv6", Category: "ip", Pattern: `\b(?:[0-9a-fA-F]{1,4}:){7}[0-9a-fA-F]{1,4}\b`},
+		{Name: "mrn", Category: "mrn", Pattern: `(?i)\bMRN[:#\s-]*([A-Z0-9][A-Z0-9-]{3,})`, Group: 1},
+		{Name: "health_plan", Category: "health_plan", Pattern: `(?i)\b(?:member|policy|subscriber|insurance)\s*(?:id|no\.?|number|#)[:#\s]*([A-Z0-9][A-Z0-9-]{4,})`, Group: 1},
+		{Name: "account", Category: "account", Pattern: `(?i)\b(?:account|acct)\.?\s*(?:no\.?|number|#)?[:#\s]*(\d[\d-]{5,})`, Group: 1},
+		{Name: "license", Category: "license", Pattern: `(?i)\b(?:license|licence|certificate|DL)\s*(?:no\.?|number|#)[:#\s]*([A-Z0-9][A-Z0-9-]{4,})`, Group: 1},
+		{Name: "vin", Category: "vehicle", Pattern: `\b[A-HJ-NPR-Z0-9]{17}\b`},
+		{Name: "license_plate", Category: "vehicle", Pattern: `(?i)\b(?:license plate|plate)[:#\s]*([A-Z0-9][A-Z0-9-]{1,7})\b`, Group: 1},
+		{Name: "date", Category: "date", Pattern: `\b\d{1,2}/\d{1,2}/\d{2,4}\b|\b\d{4}-\d{2}-\d{2}(?:T[\d:.]+(?:Z|[+-]\d{2}:?\d{2})?)?|(?i:\b` + monthNames + `\s+\d{1,2}(?:st|nd|rd|th)?,?\s+\d{4}\b)|(?i:\b\d{1,2}\s+` + monthNames + `\s+\d{4}\b)`},
+		{Name: "zip", Category: "zip", Pattern: `\b[A-Z]{2}\s+(\d{5}(?:-\d{4})?)\b`, Group: 1},
+		{Name: "age", Category: "age", Pattern: `(?i)\b(\d{2,3})[\s-]*(?:years?|yrs?|y/?o)\b`, Group: 1},
+		{Name: "street_address", Category: "geographic", Pattern: `\b\d{1,5}\s+(?:[A-Z][a-z]+\s+){1,3}(?:Street|St|Avenue|Ave|Road|Rd|Boulevard|Blvd|Lane|Ln|Drive|Dr|Court|Ct|Way|Place|Pl)\b\.?`},
+		{Name: "person_honorific", Category: "name", Pattern: `\b(?:Mr|Mrs|Ms|Miss|Mx|Dr|Prof)\.?\s+([A-Z][a-zA-Z'-]+(?:\s+[A-Z][a-zA-Z'-]+){0,2})`, Group: 1},
+		{Name: "person_labelled", Category: "name", Pattern: `\b(?:[Pp]atient|[Nn]ame|[Pp]t|[Ss]een by|[Aa]ttending|[Rr]eferred by|[Ss]igned by)\s*[:,-]?\s+(?:(?:Mr|Mrs|Ms|Miss|Mx|Dr|Prof)\.?\s+)?([A-Z][a-zA-Z'-]+(?:\s+[A-Z][a-zA-Z'-]+){0,2})`, Group: 1},
+	}
+}
+
+// loadDeidRules returns the default rules merged with the JSON array at path. A rule
+// with a default's name replaces it; "disabled": true removes it.
+func loadDeidRules(path string) ([]*DeidRule, error) {
+	rules := defaultDeidRules()
+	if path == "" {
+		return rules, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading de-identification rules: %w", err)
+	}
+	var custom []*DeidRule
+	if err := json.Unmarshal(data, &custom); err != nil {
+		return nil, fmt.Errorf("parsing de-identification rules: %w", err)
+	}
+
+	index := make(map[string]int, len(rules))
+	for i, rule := range rules {
+		index[rule.Name] = i
+	}
+	for _, rule := range custom {
+		if i, exists := index[rule.Name]; exists {
+			rules[i] = rule
+			continue
+		}
+		index[rule.Name] = len(rules)
+		rules = append(rules, rule)
+	}
+
+	enabled := rules[:0]
+	for _, rule := range rules {
+		if !rule.Disabled {
+			enabled = append(enabled, rule)
+		}
+	}
+	return enabled, nil
+}
+
+// DeidFinding is one identifier removed from the document. The original value is
+// never included.
+type DeidFinding struct {
+	Path     string `json:"path"`
+	Category string `json:"category"`
+	Rule     string `json:"rule"`
+	Action   string `json:"action"`
+}
+
+// DeidReport summarises what was removed from a document
+type DeidReport struct {
+	Method           string         `json:"method"`
+	IdentifiersFound int            `json:"identifiers_found"`
+	Categories       map[string]int `json:"categories"`
+	Findings         []DeidFinding  `json:"findings"`
+}
+
+func (r *DeidReport) add(path string, rule *DeidRule, action string) {
+	r.IdentifiersFound++
+	r.Categories[rule.Category]++
+	r.Findings = append(r.Findings, DeidFinding{Path: path, Category: rule.Category, Rule: rule.Name, Action: action})
+}
+
+// Deidentifier applies Safe Harbor rules to JSON documents
+type Deidentifier struct {
+	fieldRules []*DeidRule
+	textRules  []*DeidRule
+	key        []byte
+	now        func() time.Time
+}
+
+// NewDeidentifier compiles rules. key derives pseudonyms, so the same identifier gets
+// the same token in every document de-identified with that key.
+func NewDeidentifier(rules []*DeidRule, key []byte) (*Deidentifier, error) {
+	d := &Deidentifier{key: key, now: time.Now}
+	for _, rule := range rules {
+		if err := rule.compile(); err != nil {
+			return nil, err
+		}
+		if len(rule.Fields) > 0 {
+			d.fieldRules = append(d.fieldRules, rule)
+		} else {
+			d.textRules = append(d.textRules, rule)
+		}
+	}
+	return d, nil
+}
+
+// Deidentify returns a de-identified copy of a decoded JSON document and a report of
+// what was removed
+func (d *Deidentifier) Deidentify(doc interface{}, method string) (interface{}, *DeidReport, error) {
+	switch method {
+	case "":
+		method = DeidRedact
+	case DeidRedact, DeidPseudonymize:
+	default:
+		return nil, nil, fmt.Errorf("method must be %s or %s", DeidRedact, DeidPseudonymize)
+	}
+
+	report := &DeidReport{Method: method, Categories: map[string]int{}, Findings: []DeidFinding{}}
+	out := d.walk("", doc, method, report)
+	return out, report, nil
+}
+
+func (d *Deidentifier) walk(path string, value interface{}, method string, report *DeidReport) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		// Sorted so findings are reported in a stable order
+		sort.Strings(keys)
+
+		out := make(map[string]interface{}, len(v))
+		for _, key := range keys {
+			child := joinPath(path, key)
+			if rule := d.fieldRule(key); rule != nil {
+				out[key] = d.replaceField(child, v[key], rule, method, report)
+				continue
+			}
+			out[key] = d.walk(child, v[key], method, report)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = d.walk(fmt.Sprintf("%s[%d]", path, i), item, method, report)
+		}
+		return out
+	case string:
+		return d.scanText(path, v, method, report)
+	}
+	return value
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func (d *Deidentifier) fieldRule(key string) *DeidRule {
+	for _, rule := range d.fieldRules {
+		if rule.matchesField(key) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// replaceField replaces every scalar under a field named by a rule
+func (d *Deidentifier) replaceField(path string, value interface{}, rule *DeidRule, method string, report *DeidReport) interface{} {
+	switch v := value.(type) {
+	case nil, bool:
+		return v
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			out[key] = d.replaceField(joinPath(path, key), child, rule, method, report)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = d.replaceField(fmt.Sprintf("%s[%d]", path, i), item, rule, method, report)
+		}
+		return out
+	}
+
+	text := fmt.Sprint(value)
+	if text == "" {
+		return value
+	}
+	replacement, action, ok := d.replace(rule.Category, text, method)
+	if !ok {
+		return value
+	}
+	report.add(path, rule, action)
+	return replacement
+}
+
+type textMatch struct {
+	start, end int
+	rule       *DeidRule
+	order      int
+}
+
+// scanText replaces identifiers found in free text. Overlapping matches keep the
+// earliest, then the longest, then the first rule.
+func (d *Deidentifier) scanText(path, text, method string, report *DeidReport) string {
+	var matches []textMatch
+	for order, rule := range d.textRules {
+		for _, loc := range rule.re.FindAllStringSubmatchIndex(text, -1) {
+			start, end := loc[2*rule.Group], loc[2*rule.Group+1]
+			if start < 0 || start == end {
+				continue
+			}
+			matches = append(matches, textMatch{start: start, end: end, rule: rule, order: order})
+		}
+	}
+	if len(matches) == 0 {
+		return text
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.start != b.start {
+			return a.start < b.start
+		}
+		if a.end-a.start != b.end-b.start {
+			return a.end-a.start > b.end-b.start
+		}
+		return a.order < b.order
+	})
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		if m.start < last {
+			continue
+		}
+		replacement, action, ok := d.replace(m.rule.Category, text[m.start:m.end], method)
+		if !ok {
+			continue
+		}
+		b.WriteString(text[last:m.start])
+		b.WriteString(replacement)
+		last = m.end
+		report.add(path, m.rule, action)
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// replace produces the substitute for one identifier. Dates, ZIP codes and ages are
+// generalized as Safe Harbor permits; ok is false for values that need no change,
+// such as ages under 90.
+func (d *Deidentifier) replace(category, value, method string) (string, string, bool) {
+	switch category {
+	case "date":
+		return d.generalizeDate(value), ActionGeneralized, true
+	case "zip":
+		return generalizeZIP(value), ActionGeneralized, true
+	case "age":
+		age, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return "[AGE]", ActionRedacted, true
+		}
+		if age < 90 {
+			return value, "", false
+		}
+		return "90+", ActionGeneralized, true
+	}
+
+	tag := strings.ToUpper(category)
+	if method == DeidPseudonymize {
+		return "[" + tag + "-" + d.pseudonym(category, value) + "]", ActionPseudonymized, true
+	}
+	return "[" + tag + "]", ActionRedacted, true
+}
+
+// pseudonym is a keyed token for a value, stable across documents
+func (d *Deidentifier) pseudonym(category, value string) string {
+	mac := hmac.New(sha256.New, d.key)
+	mac.Write([]byte(category))
+	mac.Write([]byte{0})
+	mac.Write([]byte(strings.ToLower(strings.TrimSpace(value))))
+	return hex.EncodeToString(mac.Sum(nil))[:10]
+}
+
+var yearPattern = regexp.MustCompile(`\b(1[89]\d{2}|20\d{2})\b`)
+
+// generalizeDate keeps only the year. Years that would reveal an age over 89 are
+// removed entirely.
+func (d *Deidentifier) generalizeDate(value string) string {
+	match := yearPattern.FindString(value)
+	if match == "" {
+		return "[DATE]"
+	}
+	year, _ := strconv.Atoi(match)
+	if d.now().Year()-year > 89 {
+		return "[DATE]"
+	}
+	return match
+}
+
+// generalizeZIP keeps the first three digits unless the area is too small
+func generalizeZIP(value string) string {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, value)
+	if len(digits) < 3 || restrictedZIP3[digits[:3]] {
+		return "000"
+	}
+	return digits[:3]
+}
+
+// DeidentifyResponse is the anonymize response for a document
+type DeidentifyResponse struct {
+	Document  interface{} `json:"document"`
+	Report    *DeidReport `json:"report"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// deidentifyDocument serves anonymize requests that carry a JSON document
+func deidentifyDocument(w http.ResponseWriter, r *http.Request, req AnonymizeRequest, start time.Time) {
+	dec := json.NewDecoder(bytes.NewReader(req.Document))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		http.Error(w, "document must be valid JSON", http.StatusBadRequest)
+		RecordEncryptionOp("deidentify", "error", time.Since(start).Seconds(), len(req.Document))
+		return
+	}
+
+	out, report, err := deidentifier.Deidentify(doc, req.Method)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		RecordEncryptionOp("deidentify", "error", time.Since(start).Seconds(), len(req.Document))
+		return
+	}
+
+	RecordEncryptionOp("deidentify", "success", time.Since(start).Seconds(), len(req.Document))
+	log.Info().
+		Str("method", report.Method).
+		Int("identifiers_found", report.IdentifiersFound).
+		Msg("Document de-identified")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(DeidentifyResponse{
+		Document:  out,
+		Report:    report,
+		RequestID: middleware.GetReqID(r.Context()),
+	})
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDeidentifier(t *testing.T) *Deidentifier {
+	d, err := NewDeidentifier(defaultDeidRules(), []byte("deid-test-key"))
+	require.NoError(t, err)
+	d.now = func() time.Time { return time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC) }
+	return d
+}
+
+func decodeDocument(t *testing.T, doc string) interface{} {
+	var v interface{}
+	require.NoError(t, json.Unmarshal([]byte(doc), &v))
+	return v
+}
+
+// TestDeidentifyStructuredFields tests field rules and Safe Harbor generalization
+func TestDeidentifyStructuredFields(t *testing.T) {
+	d := newTestDeidentifier(t)
+
+	out, report, err := d.Deidentify(decodeDocument(t, `{
+		"patient": {"name": "Jane Doe", "dob": "1984-03-12", "age": 93, "zip": "02115", "state": "MA"},
+		"encounter": {"admission_date": "2024-05-02", "diagnosis_code": "I10"},
+		"contact": {"phone": "617-555-1234", "email": "jane@example.org"},
+		"postal_code": "05901"
+	}`), DeidRedact)
+	require.NoError(t, err)
+
+	doc := out.(map[string]interface{})
+	patient := doc["patient"].(map[string]interface{})
+	assert.Equal(t, "[NAME]", patient["name"])
+	assert.Equal(t, "1984", patient["dob"])
+	assert.Equal(t, "90+", patient["age"])
+	assert.Equal(t, "021", patient["zip"])
+	assert.Equal(t, "MA", patient["state"])
+	assert.Equal(t, "I10", doc["encounter"].(map[string]interface{})["diagnosis_code"])
+	assert.Equal(t, "000", doc["postal_code"])
+
+	assert.Equal(t, 1, report.Categories["name"])
+	assert.Equal(t, 2, report.Categories["date"])
+	assert.Contains(t, report.Findings, DeidFinding{Path: "patient.age", Category: "age", Rule: "age_fields", Action: ActionGeneralized})
+}
+
+// TestDeidentifyFreeText tests pattern and name recognizer rules inside strings
+func TestDeidentifyFreeText(t *testing.T) {
+	d := newTestDeidentifier(t)
+
+	note := "Seen by Dr. Alan Grant on 03/14/2024. Patient: Maria Lopez, SSN 123-45-6789, " +
+		"MRN: 00482913, call (617) 555-0142 or fax 617-555-0199. Portal http://portal.example.com/p/77."
+	out, report, err := d.Deidentify(map[string]interface{}{"note": note}, DeidRedact)
+	require.NoError(t, err)
+
+	text := out.(map[string]interface{})["note"].(string)
+	for _, leaked := range []string{"Alan Grant", "Maria Lopez", "123-45-6789", "00482913", "555-0142", "555-0199", "portal.example.com"} {
+		assert.NotContains(t, text, leaked)
+	}
+	assert.Contains(t, text, "Dr. [NAME]")
+	assert.Contains(t, text, "on 2024.")
+	assert.Contains(t, text, "MRN: [MRN]")
+	assert.Contains(t, text, "fax [FAX]")
+	assert.Contains(t, text, "Portal [URL].")
+	assert.Equal(t, 1, report.Categories["phone"])
+	assert.Equal(t, 1, report.Categories["fax"])
+}
+
+// TestDeidentifyPseudonymsAreStable tests that pseudonyms repeat for the same value
+func TestDeidentifyPseudonymsAreStable(t *testing.T) {
+	d := newTestDeidentifier(t)
+
+	out, _, err := d.Deidentify(decodeDocument(t, `[{"mrn":"MRN-1001","note":"MRN: MRN-1001 reviewed"},{"mrn":"MRN-1002"}]`), DeidPseudonymize)
+	require.NoError(t, err)
+
+	records := out.([]interface{})
+	first := records[0].(map[string]interface{})["mrn"].(string)
+	second := records[1].(map[string]interface{})["mrn"].(string)
+	assert.True(t, strings.HasPrefix(first, "[MRN-"))
+	assert.NotEqual(t, first, second)
+	assert.Contains(t, records[0].(map[string]interface{})["note"], first)
+}
+
+// TestLoadDeidRulesMergesCustomRules tests replacing, disabling and adding rules
+func TestLoadDeidRulesMergesCustomRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[
+		{"name": "url", "disabled": true},
+		{"name": "surnames", "category": "name", "terms": ["Okafor", "Lindqvist"]},
+		{"name": "study_id", "category": "other", "pattern": "\\bSTUDY-\\d{4}\\b"}
+	]`), 0o600))
+
+	rules, err := loadDeidRules(path)
+	require.NoError(t, err)
+	d, err := NewDeidentifier(rules, []byte("k"))
+	require.NoError(t, err)
+
+	out, _, err := d.Deidentify("okafor enrolled in STUDY-2291, see http://example.com", DeidRedact)
+	require.NoError(t, err)
+	assert.Equal(t, "[NAME] enrolled in [OTHER], see http://example.com", out)
+
+	_, err = NewDeidentifier([]*DeidRule{{Name: "bad", Category: "hair_colour", Pattern: "x"}}, nil)
+	assert.Error(t, err)
+}
+
+// TestAnonymizeHandlerDocument tests the anonymize endpoint with a document
+func TestAnonymizeHandlerDocument(t *testing.T) {
+	previous := deidentifier
+	deidentifier = newTestDeidentifier(t)
+	defer func() { deidentifier = previous }()
+
+	w := httptest.NewRecorder()
+	body := `{"document": {"name": "Jane Doe", "heart_rate": 72}, "method": "redact"}`
+	AnonymizeHandler(w, httptest.NewRequest("POST", "/api/v1/anonymize", strings.NewReader(body)))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		Document map[string]interface{} `json:"document"`
+		Report   DeidReport             `json:"report"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.Equal(t, "[NAME]", resp.Document["name"])
+	assert.Equal(t, float64(72), resp.Document["heart_rate"])
+	assert.Equal(t, 1, resp.Report.IdentifiersFound)
+
+	w = httptest.NewRecorder()
+	AnonymizeHandler(w, httptest.NewRequest("POST", "/api/v1/anonymize", strings.NewReader(`{"document": {}, "method": "shuffle"}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
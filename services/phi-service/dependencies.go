@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/healthcare-gitops/common/health"
+	"github.com/rs/zerolog/log"
+)
+
+// Dependencies named in circuit breaker metrics
+const (
+	dependencyAuthService = "auth-service"
+	dependencyVault       = "vault"
+)
+
+// dependencyChecks are the readiness checks of the dependencies configured at startup
+var dependencyChecks []health.Check
+
+// readiness checks the encryption service and the configured dependencies. Vault and
+// auth-service only degrade the service: the keys it needs are already loaded, and
+// without auth-service only the operations requiring a token fail.
+func readiness() health.Checker {
+	checks := append([]health.Check{{
+		Name:     "encryption",
+		Critical: true,
+		Probe: func(context.Context) error {
+			if encryptionService == nil {
+				return errors.New("encryption service not initialized")
+			}
+			return nil
+		},
+	}}, dependencyChecks...)
+	return health.Checker{Service: "phi-service", Checks: checks, OnFailure: health.LogFailure}
+}
+
+// addDependencyCheck checks the service behind serviceURL through its /health endpoint
+func addDependencyCheck(dependency, serviceURL string, client *http.Client) {
+	endpoint, err := health.Endpoint(serviceURL)
+	if err != nil {
+		log.Warn().Err(err).Str("dependency", dependency).Msg("Cannot check dependency health")
+		return
+	}
+	dependencyChecks = append(dependencyChecks, health.Check{Name: dependency, Probe: health.HTTP(client, endpoint)})
+}
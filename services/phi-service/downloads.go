@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/healthcare-gitops/common/auth"
+	"github.com/rs/zerolog/log"
+)
+
+// Kinds of completed job output a download link can be issued for
+const (
+	DownloadKindDSARExport    = "dsar_export"
+	DownloadKindMaskingOutput = "masking_output"
+)
+
+// downloadScopes is the token scope needed to create a link of each kind. A DSAR
+// export holds every record of a data subject, so only admins may share one.
+var downloadScopes = map[string]string{
+	DownloadKindDSARExport:    "admin",
+	DownloadKindMaskingOutput: decryptScope,
+}
+
+// Link lifetimes: the default, and the longest a caller may ask for
+const (
+	defaultDownloadLinkTTL = 24 * time.Hour
+	maxDownloadLinkTTL     = 7 * 24 * time.Hour
+)
+
+// downloadWriteTimeout is the write deadline for serving one download, which may be
+// far larger than a normal response
+const downloadWriteTimeout = 10 * time.Minute
+
+// Download link errors
+var (
+	errDownloadLinkInvalid = errors.New("download link is invalid")
+	errDownloadLinkExpired = errors.New("download link has expired")
+	errDownloadUnavailable = errors.New("download source is not configured")
+)
+
+// DownloadLinkRequest asks for a link to the output of a completed job
+type DownloadLinkRequest struct {
+	Kind string `json:"kind"`
+	// ID is the DSAR request ID or masking job ID
+	ID string `json:"id"`
+	// File is the output file of a masking job, as listed in its report
+	File       string `json:"file,omitempty"`
+	TTLSeconds int64  `json:"ttl_seconds,omitempty"`
+}
+
+// DownloadLink is a signed URL that downloads one stored object until it expires
+type DownloadLink struct {
+	LinkID    string     `json:"link_id"`
+	URL       string     `json:"url"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	Object    ObjectInfo `json:"object"`
+}
+
+// DownloadLinks publishes job output to an object store and signs URLs for it. A link
+// carries its object key and expiry in the query string, covered by an HMAC, so links
+// survive restarts and need no server-side state beyond the signing key.
+type DownloadLinks struct {
+	store   ObjectStore
+	key     []byte
+	baseURL string
+	now     func() time.Time
+}
+
+// NewDownloadLinks creates a link issuer. baseURL is the externally reachable origin
+// of the service, such as https://phi.example.com; empty yields relative URLs.
+func NewDownloadLinks(store ObjectStore, key []byte, baseURL string) *DownloadLinks {
+	return &DownloadLinks{
+		store:   store,
+		key:     key,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		now:     time.Now,
+	}
+}
+
+// sign returns the signature of a link
+func (dl *DownloadLinks) sign(linkID, key string, expires int64) string {
+	mac := hmac.New(sha256.New, dl.key)
+	fmt.Fprintf(mac, "%s\n%s\n%d", linkID, key, expires)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Issue signs a link to a stored object, or asks the store to presign one
+func (dl *DownloadLinks) Issue(ctx context.Context, key string, ttl time.Duration) (DownloadLink, error) {
+	info, err := dl.store.Stat(ctx, key)
+	if err != nil {
+		return DownloadLink{}, err
+	}
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return DownloadLink{}, err
+	}
+	link := DownloadLink{
+		LinkID:    "dl-" + hex.EncodeToString(id),
+		ExpiresAt: dl.now().Add(ttl).UTC().Truncate(time.Second),
+		Object:    info,
+	}
+
+	if presigner, ok := dl.store.(Presigner); ok {
+		if link.URL, err = presigner.PresignGet(ctx, key, link.ExpiresAt); err != nil {
+			return DownloadLink{}, err
+		}
+		return link, nil
+	}
+	expires := link.ExpiresAt.Unix()
+	query := url.Values{
+		"key":       {key},
+		"expires":   {strconv.FormatInt(expires, 10)},
+		"signature": {dl.sign(link.LinkID, key, expires)},
+	}
+	link.URL = dl.baseURL + "/api/v1/downloads/" + link.LinkID + "?" + query.Encode()
+	return link, nil
+}
+
+// Verify checks a link's signature and expiry and returns the object key
+func (dl *DownloadLinks) Verify(linkID string, query url.Values) (string, error) {
+	key := query.Get("key")
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || key == "" {
+		return "", errDownloadLinkInvalid
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(query.Get("signature"))
+	if err != nil {
+		return "", errDownloadLinkInvalid
+	}
+	expected, _ := base64.RawURLEncoding.DecodeString(dl.sign(linkID, key, expires))
+	if !hmac.Equal(signature, expected) {
+		return "", errDownloadLinkInvalid
+	}
+	if !dl.now().Before(time.Unix(expires, 0)) {
+		return key, errDownloadLinkExpired
+	}
+	return key, nil
+}
+
+// Publish copies the output named by req into the store, once, and returns its key
+func (dl *DownloadLinks) Publish(ctx context.Context, req DownloadLinkRequest) (string, error) {
+	switch req.Kind {
+	case DownloadKindDSARExport:
+		if dsarRequests == nil {
+			return "", fmt.Errorf("%w: DSAR_CONNECTORS_PATH not set", errDownloadUnavailable)
+		}
+		export, err := dsarRequests.Export(req.ID)
+		if err != nil {
+			return "", err
+		}
+		key := "dsar/" + req.ID + ".json"
+		if _, err := dl.store.Stat(ctx, key); err == nil {
+			return key, nil
+		}
+		body, err := json.Marshal(export)
+		if err != nil {
+			return "", err
+		}
+		_, err = dl.store.Put(ctx, key, bytes.NewReader(body))
+		return key, err
+
+	case DownloadKindMaskingOutput:
+		if maskingJobs == nil {
+			return "", fmt.Errorf("%w: MASKING_EXPORT_DIR and MASKING_OUTPUT_DIR not set", errDownloadUnavailable)
+		}
+		src, err := maskingJobs.OutputFile(req.ID, req.File)
+		if err != nil {
+			return "", err
+		}
+		key := path.Join("masking", req.ID, req.File)
+		if err := validObjectKey(key); err != nil {
+			return "", err
+		}
+		if _, err := dl.store.Stat(ctx, key); err == nil {
+			return key, nil
+		}
+		f, err := os.Open(src)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		_, err = dl.store.Put(ctx, key, f)
+		return key, err
+	}
+	return "", fmt.Errorf("unknown download kind %q", req.Kind)
+}
+
+var (
+	// downloadLinks is nil when DOWNLOADS_DIR is not set, which disables download links
+	downloadLinks *DownloadLinks
+	// downloadIntrospector validates link creators' tokens; nil when
+	// AUTH_INTROSPECT_URL is not set
+	downloadIntrospector *auth.Introspector
+)
+
+// CreateDownloadLinkHandler publishes the output of a completed DSAR or masking job and
+// returns a signed, expiring link to it. The caller's token must carry the scope for
+// the kind of output, and every issued or refused link is recorded in the PHI access
+// audit log.
+func CreateDownloadLinkHandler(w http.ResponseWriter, r *http.Request) {
+	if downloadLinks == nil {
+		http.Error(w, "Download links are disabled: DOWNLOADS_DIR is not set", http.StatusServiceUnavailable)
+		return
+	}
+	if downloadIntrospector == nil {
+		http.Error(w, "Download links are disabled: AUTH_INTROSPECT_URL is not set", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req DownloadLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	scope, ok := downloadScopes[req.Kind]
+	if !ok {
+		http.Error(w, "kind must be dsar_export or masking_output", http.StatusBadRequest)
+		return
+	}
+	if req.ID == "" || (req.Kind == DownloadKindMaskingOutput && req.File == "") {
+		http.Error(w, "id is required, and file for masking_output", http.StatusBadRequest)
+		return
+	}
+	ttl := defaultDownloadLinkTTL
+	if req.TTLSeconds != 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+		if ttl <= 0 || ttl > maxDownloadLinkTTL {
+			http.Error(w, fmt.Sprintf("ttl_seconds must be between 1 and %d", int64(maxDownloadLinkTTL.Seconds())), http.StatusBadRequest)
+			return
+		}
+	}
+
+	entry := AccessAuditEntry{
+		Time:       time.Now().UTC(),
+		RequestID:  middleware.GetReqID(r.Context()),
+		RemoteAddr: r.RemoteAddr,
+		Operation:  "create_download_link",
+		DataType:   req.Kind,
+		Resource:   req.ID,
+		Status:     AccessDenied,
+	}
+	deny := func(status int, message string) {
+		auditDecision(r.Context(), entry)
+		RecordDownload("create_link", AccessDenied)
+		http.Error(w, message, status)
+	}
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" || token == r.Header.Get("Authorization") {
+		deny(http.StatusUnauthorized, "Bearer token required")
+		return
+	}
+	info, err := downloadIntrospector.Introspect(r, token)
+	if err != nil {
+		log.Error().Err(err).Msg("Token introspection failed")
+		deny(http.StatusServiceUnavailable, "Authorization service unavailable")
+		return
+	}
+	if !info.Active {
+		deny(http.StatusUnauthorized, "Invalid or expired token")
+		return
+	}
+	entry.Actor, entry.Role = info.UserID, info.Role
+	if !info.HasScope(scope) {
+		deny(http.StatusForbidden, "Token lacks the "+scope+" scope")
+		return
+	}
+
+	key, err := downloadLinks.Publish(r.Context(), req)
+	if err != nil {
+		writeDownloadError(w, err)
+		return
+	}
+	link, err := downloadLinks.Issue(r.Context(), key, ttl)
+	if err != nil {
+		writeDownloadError(w, err)
+		return
+	}
+
+	entry.Status, entry.LinkID = AccessSucceeded, link.LinkID
+	if err := auditDecision(r.Context(), entry); err != nil {
+		http.Error(w, "Link not issued: access could not be audited", http.StatusInternalServerError)
+		return
+	}
+	RecordDownload("create_link", AccessSucceeded)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(link)
+}
+
+// DownloadHandler serves the object behind a signed link. The signature is the only
+// credential, so the route is public; every download, refused or served, is audited
+// before any data is sent.
+func DownloadHandler(w http.ResponseWriter, r *http.Request) {
+	if downloadLinks == nil {
+		http.Error(w, "Download links are disabled: DOWNLOADS_DIR is not set", http.StatusServiceUnavailable)
+		return
+	}
+	linkID := chi.URLParam(r, "linkID")
+	entry := AccessAuditEntry{
+		Time:       time.Now().UTC(),
+		RequestID:  middleware.GetReqID(r.Context()),
+		RemoteAddr: r.RemoteAddr,
+		Operation:  "download",
+		LinkID:     linkID,
+		Status:     AccessDenied,
+	}
+
+	key, err := downloadLinks.Verify(linkID, r.URL.Query())
+	entry.Resource = key
+	if err != nil {
+		auditDecision(r.Context(), entry)
+		RecordDownload("download", AccessDenied)
+		writeDownloadError(w, err)
+		return
+	}
+	body, info, err := downloadLinks.store.Get(r.Context(), key)
+	if err != nil {
+		writeDownloadError(w, err)
+		return
+	}
+	defer body.Close()
+
+	entry.Status = AccessSucceeded
+	if err := auditDecision(r.Context(), entry); err != nil {
+		http.Error(w, "Download failed: access could not be audited", http.StatusInternalServerError)
+		return
+	}
+	RecordDownload("download", AccessSucceeded)
+
+	// Large files outlast the server's write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(downloadWriteTimeout))
+
+	w.Header().Set("Content-Type", info.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", path.Base(info.Key)))
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if seeker, ok := body.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, "", info.ModTime, seeker)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	io.Copy(w, body)
+}
+
+// writeDownloadError maps link, store and job errors to HTTP statuses
+func writeDownloadError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errDownloadLinkInvalid):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, errDownloadLinkExpired):
+		http.Error(w, err.Error(), http.StatusGone)
+	case errors.Is(err, errDownloadUnavailable):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	case errors.Is(err, ErrObjectNotFound), errors.Is(err, errDSARNotFound), errors.Is(err, errMaskingJobNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errDSARConflict), errors.Is(err, errMaskingOutputNotReady):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Error().Err(err).Msg("Download failed")
+		http.Error(w, "Download failed", http.StatusInternalServerError)
+	}
+}
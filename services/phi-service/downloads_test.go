@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/healthcare-gitops/common/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withDownloadLinks installs a link issuer backed by a temporary store and an
+// introspector for the given auth service
+func withDownloadLinks(t *testing.T, introspectURL string) *DownloadLinks {
+	store, err := NewFileObjectStore(t.TempDir())
+	require.NoError(t, err)
+	previousLinks, previousIntrospector := downloadLinks, downloadIntrospector
+	downloadLinks = NewDownloadLinks(store, []byte("download-signing-key"), "https://phi.example.com/")
+	downloadIntrospector = auth.NewIntrospector(auth.Config{IntrospectURL: introspectURL, Timeout: time.Second})
+	t.Cleanup(func() { downloadLinks, downloadIntrospector = previousLinks, previousIntrospector })
+	return downloadLinks
+}
+
+// TestDownloadLinkLifecycle tests link creation for masking output, signed download, tampering, expiry and auditing
+func TestDownloadLinkLifecycle(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Unix()
+	srv, _ := fakeAuthService(t, map[string]auth.Introspection{
+		"reader": {Active: true, UserID: "analyst-7", Role: "analyst", Scopes: []string{"phi:read"}, Exp: exp},
+	})
+	links := withDownloadLinks(t, srv.URL)
+	auditLog := withAccessAudit(t)
+
+	exportDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(exportDir, "ehr"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(exportDir, "ehr", "contacts.csv"),
+		[]byte("patient_id,email,ward\nP-1,jane@hospital.org,3B\n"), 0o600))
+	profiles, err := loadMaskingProfiles("")
+	require.NoError(t, err)
+	jobs, err := NewMaskingJobManager(exportDir, t.TempDir(), profiles, testMaskingSecret)
+	require.NoError(t, err)
+	previousJobs := maskingJobs
+	maskingJobs = jobs
+	defer func() { maskingJobs = previousJobs }()
+	job, err := jobs.Start("staging", "ehr")
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		current, _ := jobs.Job(job.ID)
+		return current.Status == MaskingCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+
+	router := chi.NewRouter()
+	router.Post("/api/v1/downloads", CreateDownloadLinkHandler)
+	router.Get("/api/v1/downloads/{linkID}", DownloadHandler)
+	create := func(token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/v1/downloads", strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// A phi:read token may not share a DSAR export, and unknown files are not published
+	assert.Equal(t, http.StatusUnauthorized, create("", `{"kind":"masking_output","id":"`+job.ID+`","file":"contacts.csv"}`).Code)
+	assert.Equal(t, http.StatusForbidden, create("reader", `{"kind":"dsar_export","id":"DSAR-000001"}`).Code)
+	assert.Equal(t, http.StatusNotFound, create("reader", `{"kind":"masking_output","id":"`+job.ID+`","file":"../../etc/passwd"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, create("reader", `{"kind":"masking_output","id":"`+job.ID+`","file":"contacts.csv","ttl_seconds":9999999}`).Code)
+
+	w := create("reader", `{"kind":"masking_output","id":"`+job.ID+`","file":"contacts.csv","ttl_seconds":3600}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var link DownloadLink
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&link))
+	assert.True(t, strings.HasPrefix(link.URL, "https://phi.example.com/api/v1/downloads/"+link.LinkID+"?"))
+	assert.Equal(t, "masking/"+job.ID+"/contacts.csv", link.Object.Key)
+
+	target := strings.TrimPrefix(link.URL, "https://phi.example.com")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `attachment; filename="contacts.csv"`, w.Header().Get("Content-Disposition"))
+	assert.Equal(t, "private, no-store", w.Header().Get("Cache-Control"))
+	assert.Contains(t, w.Body.String(), ",3B")
+	assert.NotContains(t, w.Body.String(), "jane@hospital.org")
+
+	// A link for one object cannot be pointed at another
+	tampered, err := url.Parse(target)
+	require.NoError(t, err)
+	query := tampered.Query()
+	query.Set("key", "dsar/DSAR-000001.json")
+	tampered.RawQuery = query.Encode()
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", tampered.String(), nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	links.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	defer func() { links.now = time.Now }()
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+	assert.Equal(t, http.StatusGone, w.Code)
+
+	entries, err := auditLog.Query(AccessAuditFilter{LinkID: link.LinkID})
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+	operations := map[string][]string{}
+	for _, entry := range entries {
+		operations[entry.Operation] = append(operations[entry.Operation], entry.Status)
+	}
+	assert.Equal(t, []string{AccessSucceeded}, operations["create_download_link"])
+	assert.ElementsMatch(t, []string{AccessSucceeded, AccessDenied, AccessDenied}, operations["download"])
+
+	denied, err := auditLog.Query(AccessAuditFilter{Operation: "create_download_link", Status: AccessDenied})
+	require.NoError(t, err)
+	assert.Len(t, denied, 2)
+}
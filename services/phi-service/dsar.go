@@ -0,0 +1,755 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/healthcare-gitops/common/synthetic"
+	"github.com/rs/zerolog/log"
+)
+
+// Data subject request types
+const (
+	DSARAccess   = "access"
+	DSARDeletion = "deletion"
+)
+
+// Data subject request states
+const (
+	DSARPendingVerification = "pending_verification"
+	DSARInProgress          = "in_progress"
+	DSARCompleted           = "completed"
+	DSARFailed              = "failed"
+	DSARRejected            = "rejected"
+)
+
+// Connector task states
+const (
+	DSARTaskPending   = "pending"
+	DSARTaskCompleted = "completed"
+	DSARTaskFailed    = "failed"
+)
+
+// dsarDeadlines is the statutory response period per regulation, counted from receipt
+var dsarDeadlines = map[string]time.Duration{
+	"gdpr": 30 * 24 * time.Hour, // Art. 12(3): one month
+	"ccpa": 45 * 24 * time.Hour, // Cal. Civ. Code 1798.130: 45 days
+}
+
+const (
+	// dsarVerificationTTL is how long a subject has to confirm a request
+	dsarVerificationTTL = 7 * 24 * time.Hour
+	// dsarMaxVerifyAttempts wrong codes reject the request
+	dsarMaxVerifyAttempts = 5
+	// dsarDueSoon flags open requests this close to their deadline in reports
+	dsarDueSoon = 7 * 24 * time.Hour
+	// maxConnectorResponse bounds what one service may return for an export
+	maxConnectorResponse = 32 << 20
+)
+
+var (
+	errDSARNotFound     = errors.New("data subject request not found")
+	errDSARConflict     = errors.New("data subject request is not in a state that allows this")
+	errDSARVerification = errors.New("verification failed")
+)
+
+// DSARConnector is a service that holds personal data. On a verified request the
+// service's export_url or erase_url receives a POST with the request and subject IDs.
+// Exports answer {"records": [...]}; erasures answer {"erased": n, "method": "..."},
+// where method names how the data was removed, e.g. purge or crypto_shred.
+type DSARConnector struct {
+	Name      string `json:"name"`
+	ExportURL string `json:"export_url,omitempty"`
+	EraseURL  string `json:"erase_url,omitempty"`
+}
+
+// loadDSARConnectors reads the connector list from a JSON file
+func loadDSARConnectors(path string) ([]DSARConnector, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading DSAR connectors: %w", err)
+	}
+	var connectors []DSARConnector
+	if err := json.Unmarshal(data, &connectors); err != nil {
+		return nil, fmt.Errorf("parsing DSAR connectors: %w", err)
+	}
+	seen := make(map[string]bool)
+	for _, c := range connectors {
+		switch {
+		case c.Name == "":
+			return nil, fmt.Errorf("DSAR connector without a name")
+		case seen[c.Name]:
+			return nil, fmt.Errorf("duplicate DSAR connector %q", c.Name)
+		case c.ExportURL == "" && c.EraseURL == "":
+			return nil, fmt.Errorf("DSAR connector %q needs an export_url or erase_url", c.Name)
+		}
+		seen[c.Name] = true
+	}
+	return connectors, nil
+}
+
+// DataSubject identifies the person a request is about. ID is the identifier the
+// connected services key their records by.
+type DataSubject struct {
+	ID    string `json:"id"`
+	Email string `json:"email,omitempty"`
+	Name  string `json:"name,omitempty"`
+}
+
+// DSARTask is one service's part of a request
+type DSARTask struct {
+	Service     string     `json:"service"`
+	Action      string     `json:"action"`
+	Status      string     `json:"status"`
+	Attempts    int        `json:"attempts"`
+	Records     int        `json:"records"`
+	Method      string     `json:"method,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// DataSubjectRequest is a GDPR or CCPA access or deletion request
+type DataSubjectRequest struct {
+	ID          string      `json:"id"`
+	Type        string      `json:"type"`
+	Regulation  string      `json:"regulation"`
+	Subject     DataSubject `json:"subject"`
+	Status      string      `json:"status"`
+	Reason      string      `json:"reason,omitempty"`
+	ReceivedAt  time.Time   `json:"received_at"`
+	DueAt       time.Time   `json:"due_at"`
+	Overdue     bool        `json:"overdue"`
+	VerifiedAt  *time.Time  `json:"verified_at,omitempty"`
+	CompletedAt *time.Time  `json:"completed_at,omitempty"`
+	Tasks       []DSARTask  `json:"tasks"`
+	// Marker flags requests raised by tests, which are removed once they expire
+	synthetic.Marker
+
+	codeHash       [sha256.Size]byte
+	verifyAttempts int
+	exports        map[string]json.RawMessage
+}
+
+// closed reports whether the request needs no further work
+func (req *DataSubjectRequest) closed() bool {
+	return req.Status == DSARCompleted || req.Status == DSARRejected
+}
+
+// DSARManager takes in data subject requests, verifies them and fans them out to the
+// connected services. Requests and the data collected for access requests are kept
+// in memory.
+type DSARManager struct {
+	connectors []DSARConnector
+	client     *http.Client
+	token      string
+	now        func() time.Time
+
+	mu       sync.RWMutex
+	requests map[string]*DataSubjectRequest
+	seq      int
+	runs     sync.WaitGroup
+}
+
+// NewDSARManager creates a manager for the given connectors. A non-empty token is sent
+// to connectors as a bearer token.
+func NewDSARManager(connectors []DSARConnector, token string, timeout time.Duration) *DSARManager {
+	return &DSARManager{
+		connectors: connectors,
+		client:     &http.Client{Timeout: timeout},
+		token:      token,
+		now:        time.Now,
+		requests:   make(map[string]*DataSubjectRequest),
+	}
+}
+
+// snapshot copies a request for callers, marking it overdue if past its deadline.
+// Callers hold dm.mu.
+func (dm *DSARManager) snapshot(req *DataSubjectRequest) DataSubjectRequest {
+	out := *req
+	out.Tasks = append([]DSARTask(nil), req.Tasks...)
+	out.Overdue = !req.closed() && dm.now().After(req.DueAt)
+	out.exports = nil
+	return out
+}
+
+// Submit records a new request and returns it with the one-time verification code
+// that must be passed to the subject through a channel they are known to control
+func (dm *DSARManager) Submit(requestType, regulation string, subject DataSubject, receivedAt time.Time) (DataSubjectRequest, string, error) {
+	if requestType != DSARAccess && requestType != DSARDeletion {
+		return DataSubjectRequest{}, "", fmt.Errorf("type must be %s or %s", DSARAccess, DSARDeletion)
+	}
+	deadline, ok := dsarDeadlines[regulation]
+	if !ok {
+		return DataSubjectRequest{}, "", fmt.Errorf("regulation must be gdpr or ccpa")
+	}
+	if strings.TrimSpace(subject.ID) == "" {
+		return DataSubjectRequest{}, "", fmt.Errorf("subject.id is required")
+	}
+	now := dm.now()
+	if receivedAt.IsZero() {
+		receivedAt = now
+	}
+	if receivedAt.After(now) {
+		return DataSubjectRequest{}, "", fmt.Errorf("received_at must not be in the future")
+	}
+
+	raw := make([]byte, 10)
+	if _, err := rand.Read(raw); err != nil {
+		return DataSubjectRequest{}, "", err
+	}
+	code := base32.StdEncoding.EncodeToString(raw)
+
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.seq++
+	req := &DataSubjectRequest{
+		ID:         fmt.Sprintf("DSAR-%06d", dm.seq),
+		Type:       requestType,
+		Regulation: regulation,
+		Subject:    subject,
+		Status:     DSARPendingVerification,
+		ReceivedAt: receivedAt.UTC(),
+		DueAt:      receivedAt.Add(deadline).UTC(),
+		Tasks:      []DSARTask{},
+		codeHash:   sha256.Sum256([]byte(code)),
+	}
+	dm.requests[req.ID] = req
+	return dm.snapshot(req), code, nil
+}
+
+// Verify checks the subject's code. A correct code starts processing in the background;
+// an expired request or too many wrong codes rejects the request.
+func (dm *DSARManager) Verify(id, code string) (DataSubjectRequest, error) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	req, ok := dm.requests[id]
+	if !ok {
+		return DataSubjectRequest{}, errDSARNotFound
+	}
+	if req.Status != DSARPendingVerification {
+		return dm.snapshot(req), fmt.Errorf("%w: request is %s", errDSARConflict, req.Status)
+	}
+	now := dm.now()
+	if now.Sub(req.ReceivedAt) > dsarVerificationTTL {
+		req.Status, req.Reason = DSARRejected, "identity was not verified in time"
+		return dm.snapshot(req), fmt.Errorf("%w: verification window has closed", errDSARConflict)
+	}
+	sum := sha256.Sum256([]byte(strings.ToUpper(strings.TrimSpace(code))))
+	if subtle.ConstantTimeCompare(sum[:], req.codeHash[:]) != 1 {
+		req.verifyAttempts++
+		if req.verifyAttempts >= dsarMaxVerifyAttempts {
+			req.Status, req.Reason = DSARRejected, "too many failed verification attempts"
+		}
+		return dm.snapshot(req), errDSARVerification
+	}
+
+	req.VerifiedAt = &now
+	req.Status = DSARInProgress
+	for _, c := range dm.connectors {
+		if (req.Type == DSARAccess && c.ExportURL != "") || (req.Type == DSARDeletion && c.EraseURL != "") {
+			req.Tasks = append(req.Tasks, DSARTask{Service: c.Name, Action: req.Type, Status: DSARTaskPending})
+		}
+	}
+	dm.start(req.ID)
+	return dm.snapshot(req), nil
+}
+
+// Retry re-runs the failed tasks of a failed request
+func (dm *DSARManager) Retry(id string) (DataSubjectRequest, error) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	req, ok := dm.requests[id]
+	if !ok {
+		return DataSubjectRequest{}, errDSARNotFound
+	}
+	if req.Status != DSARFailed {
+		return dm.snapshot(req), fmt.Errorf("%w: request is %s", errDSARConflict, req.Status)
+	}
+	for i := range req.Tasks {
+		if req.Tasks[i].Status == DSARTaskFailed {
+			req.Tasks[i].Status = DSARTaskPending
+		}
+	}
+	req.Status, req.Reason = DSARInProgress, ""
+	dm.start(req.ID)
+	return dm.snapshot(req), nil
+}
+
+// start runs a request's pending tasks in the background. Callers hold dm.mu.
+func (dm *DSARManager) start(id string) {
+	dm.runs.Add(1)
+	go func() {
+		defer dm.runs.Done()
+		dm.run(id)
+	}()
+}
+
+// run calls each connector with a pending task, one at a time, then settles the request
+func (dm *DSARManager) run(id string) {
+	dm.mu.RLock()
+	req := dm.requests[id]
+	body, _ := json.Marshal(map[string]string{
+		"request_id": req.ID,
+		"type":       req.Type,
+		"subject_id": req.Subject.ID,
+		"email":      req.Subject.Email,
+	})
+	pending := make(map[int]DSARConnector)
+	for i, task := range req.Tasks {
+		if task.Status == DSARTaskPending {
+			pending[i] = dm.connector(task.Service)
+		}
+	}
+	requestType := req.Type
+	dm.mu.RUnlock()
+
+	for i := range req.Tasks {
+		connector, ok := pending[i]
+		if !ok {
+			continue
+		}
+		url := connector.ExportURL
+		if requestType == DSARDeletion {
+			url = connector.EraseURL
+		}
+		result, err := dm.call(url, body)
+
+		dm.mu.Lock()
+		task := &req.Tasks[i]
+		task.Attempts++
+		if err == nil {
+			err = dm.apply(req, task, result)
+		}
+		if err != nil {
+			task.Status, task.Error = DSARTaskFailed, err.Error()
+		} else {
+			completed := dm.now()
+			task.Status, task.Error, task.CompletedAt = DSARTaskCompleted, "", &completed
+		}
+		status := task.Status
+		dm.mu.Unlock()
+
+		RecordDSARTask(connector.Name, requestType, status)
+		event := log.Info()
+		if err != nil {
+			event = log.Warn().Err(err)
+		}
+		event.Str("dsar_id", id).Str("service", connector.Name).Str("action", requestType).Str("status", status).Msg("DSAR task finished")
+	}
+
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	failed := 0
+	for _, task := range req.Tasks {
+		if task.Status == DSARTaskFailed {
+			failed++
+		}
+	}
+	if failed > 0 {
+		req.Status, req.Reason = DSARFailed, fmt.Sprintf("%d task(s) failed", failed)
+		log.Warn().Str("dsar_id", id).Int("failed_tasks", failed).Msg("Data subject request failed")
+		return
+	}
+	completed := dm.now()
+	req.Status, req.CompletedAt = DSARCompleted, &completed
+	if req.Type == DSARDeletion {
+		// Keep only the identifier needed to show the erasure was carried out
+		req.Subject.Email, req.Subject.Name = "", ""
+	}
+	log.Info().Str("dsar_id", id).Str("type", req.Type).Bool("on_time", !completed.After(req.DueAt)).Msg("Data subject request completed")
+}
+
+// connector looks up a connector by name
+func (dm *DSARManager) connector(name string) DSARConnector {
+	for _, c := range dm.connectors {
+		if c.Name == name {
+			return c
+		}
+	}
+	return DSARConnector{}
+}
+
+// call posts a request to a connector and returns its response body
+func (dm *DSARManager) call(url string, body []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dm.client.Timeout)
+	defer cancel()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if dm.token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+dm.token)
+	}
+	resp, err := dm.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("connector returned %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxConnectorResponse))
+}
+
+// apply records a connector's response on its task. Callers hold dm.mu.
+func (dm *DSARManager) apply(req *DataSubjectRequest, task *DSARTask, result []byte) error {
+	if req.Type == DSARDeletion {
+		var erased struct {
+			Erased int    `json:"erased"`
+			Method string `json:"method"`
+		}
+		if err := json.Unmarshal(result, &erased); err != nil {
+			return fmt.Errorf("decoding erasure result: %w", err)
+		}
+		task.Records, task.Method = erased.Erased, erased.Method
+		return nil
+	}
+
+	var export struct {
+		Records []json.RawMessage `json:"records"`
+	}
+	if err := json.Unmarshal(result, &export); err != nil {
+		return fmt.Errorf("decoding export: %w", err)
+	}
+	if req.exports == nil {
+		req.exports = make(map[string]json.RawMessage)
+	}
+	records, _ := json.Marshal(export.Records)
+	req.exports[task.Service] = records
+	task.Records = len(export.Records)
+	return nil
+}
+
+// MarkSynthetic flags a request as synthetic test data
+func (dm *DSARManager) MarkSynthetic(id string, marker synthetic.Marker) (DataSubjectRequest, error) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	req, ok := dm.requests[id]
+	if !ok {
+		return DataSubjectRequest{}, errDSARNotFound
+	}
+	req.Marker = marker
+	return dm.snapshot(req), nil
+}
+
+// ReclaimSynthetic removes expired synthetic requests and their collected data and
+// returns how many were removed. Requests still being processed are left until they
+// settle.
+func (dm *DSARManager) ReclaimSynthetic(now time.Time) int {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	reclaimed := 0
+	for id, req := range dm.requests {
+		if req.Marker.Expired(now) && req.Status != DSARInProgress {
+			delete(dm.requests, id)
+			reclaimed++
+		}
+	}
+	return reclaimed
+}
+
+// Get returns a copy of a request
+func (dm *DSARManager) Get(id string) (DataSubjectRequest, bool) {
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
+	req, ok := dm.requests[id]
+	if !ok {
+		return DataSubjectRequest{}, false
+	}
+	return dm.snapshot(req), true
+}
+
+// List returns requests by deadline, soonest first, optionally filtered by status or
+// to overdue requests
+func (dm *DSARManager) List(status string, overdueOnly bool) []DataSubjectRequest {
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
+	requests := make([]DataSubjectRequest, 0, len(dm.requests))
+	for _, req := range dm.requests {
+		out := dm.snapshot(req)
+		if (status != "" && out.Status != status) || (overdueOnly && !out.Overdue) {
+			continue
+		}
+		requests = append(requests, out)
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		if !requests[i].DueAt.Equal(requests[j].DueAt) {
+			return requests[i].DueAt.Before(requests[j].DueAt)
+		}
+		return requests[i].ID < requests[j].ID
+	})
+	return requests
+}
+
+// DSARExport is the data returned for a completed access request, by service
+type DSARExport struct {
+	RequestID   string                     `json:"request_id"`
+	SubjectID   string                     `json:"subject_id"`
+	GeneratedAt time.Time                  `json:"generated_at"`
+	Services    map[string]json.RawMessage `json:"services"`
+}
+
+// Export returns the collected data of a completed access request
+func (dm *DSARManager) Export(id string) (DSARExport, error) {
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
+	req, ok := dm.requests[id]
+	if !ok {
+		return DSARExport{}, errDSARNotFound
+	}
+	if req.Type != DSARAccess || req.Status != DSARCompleted {
+		return DSARExport{}, fmt.Errorf("%w: only completed access requests have an export", errDSARConflict)
+	}
+	export := DSARExport{
+		RequestID:   req.ID,
+		SubjectID:   req.Subject.ID,
+		GeneratedAt: dm.now().UTC(),
+		Services:    make(map[string]json.RawMessage, len(req.exports)),
+	}
+	for service, records := range req.exports {
+		export.Services[service] = records
+	}
+	return export, nil
+}
+
+// DSARDeadline is an open request in a status report
+type DSARDeadline struct {
+	ID            string    `json:"id"`
+	Type          string    `json:"type"`
+	Regulation    string    `json:"regulation"`
+	Status        string    `json:"status"`
+	DueAt         time.Time `json:"due_at"`
+	DaysRemaining int       `json:"days_remaining"`
+}
+
+// DSARReport summarizes requests against their deadlines
+type DSARReport struct {
+	GeneratedAt     time.Time      `json:"generated_at"`
+	Total           int            `json:"total"`
+	ByStatus        map[string]int `json:"by_status"`
+	Open            int            `json:"open"`
+	CompletedOnTime int            `json:"completed_on_time"`
+	CompletedLate   int            `json:"completed_late"`
+	Overdue         []DSARDeadline `json:"overdue"`
+	DueSoon         []DSARDeadline `json:"due_soon"`
+}
+
+// Report counts requests by status and lists open requests that are overdue or due
+// within dsarDueSoon
+func (dm *DSARManager) Report() DSARReport {
+	now := dm.now()
+	report := DSARReport{
+		GeneratedAt: now.UTC(),
+		ByStatus:    make(map[string]int),
+		Overdue:     []DSARDeadline{},
+		DueSoon:     []DSARDeadline{},
+	}
+	for _, req := range dm.List("", false) {
+		// Test requests would skew the compliance figures
+		if req.Synthetic {
+			continue
+		}
+		report.Total++
+		report.ByStatus[req.Status]++
+		if req.Status == DSARCompleted {
+			if req.CompletedAt.After(req.DueAt) {
+				report.CompletedLate++
+			} else {
+				report.CompletedOnTime++
+			}
+		}
+		if req.closed() {
+			continue
+		}
+		report.Open++
+		deadline := DSARDeadline{
+			ID:            req.ID,
+			Type:          req.Type,
+			Regulation:    req.Regulation,
+			Status:        req.Status,
+			DueAt:         req.DueAt,
+			DaysRemaining: int(math.Ceil(req.DueAt.Sub(now).Hours() / 24)),
+		}
+		switch {
+		case req.Overdue:
+			report.Overdue = append(report.Overdue, deadline)
+		case req.DueAt.Sub(now) <= dsarDueSoon:
+			report.DueSoon = append(report.DueSoon, deadline)
+		}
+	}
+	return report
+}
+
+// dsarRequests is nil when DSAR_CONNECTORS_PATH is unset
+var dsarRequests *DSARManager
+
+// requireDSAR rejects data subject requests when no connectors are configured
+func requireDSAR(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if dsarRequests == nil {
+			http.Error(w, "Data subject request automation is not configured", http.StatusServiceUnavailable)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// writeDSARError maps manager errors to status codes
+func writeDSARError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errDSARNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errDSARConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, errDSARVerification):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+// DSARIntakeRequest records a request received from a data subject
+type DSARIntakeRequest struct {
+	Type       string      `json:"type"`
+	Regulation string      `json:"regulation"`
+	Subject    DataSubject `json:"subject"`
+	ReceivedAt time.Time   `json:"received_at"`
+}
+
+// DSARIntakeResponse is a new request with its verification code, which is shown
+// only once
+type DSARIntakeResponse struct {
+	DataSubjectRequest
+	VerificationCode string `json:"verification_code"`
+}
+
+// SubmitDSARHandler records a data subject request and returns its verification code
+func SubmitDSARHandler(w http.ResponseWriter, r *http.Request) {
+	var body DSARIntakeRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	marker, err := syntheticPolicy.FromRequest(r, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req, code, err := dsarRequests.Submit(body.Type, body.Regulation, body.Subject, body.ReceivedAt)
+	if err != nil {
+		writeDSARError(w, err)
+		return
+	}
+	if marker.Synthetic {
+		if req, err = dsarRequests.MarkSynthetic(req.ID, marker); err != nil {
+			writeDSARError(w, err)
+			return
+		}
+	}
+	log.Info().Str("dsar_id", req.ID).Str("type", req.Type).Str("regulation", req.Regulation).Time("due_at", req.DueAt).Msg("Data subject request received")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(DSARIntakeResponse{DataSubjectRequest: req, VerificationCode: code})
+}
+
+// ListDSARHandler lists requests by deadline. Supports ?status= and ?overdue=true.
+func ListDSARHandler(w http.ResponseWriter, r *http.Request) {
+	requests := dsarRequests.List(r.URL.Query().Get("status"), r.URL.Query().Get("overdue") == "true")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"requests": requests,
+		"count":    len(requests),
+	})
+}
+
+// GetDSARHandler returns a request with its tasks
+func GetDSARHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := dsarRequests.Get(chi.URLParam(r, "requestID"))
+	if !ok {
+		http.Error(w, errDSARNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(req)
+}
+
+// VerifyDSARHandler confirms the subject's identity with their verification code and
+// starts processing
+func VerifyDSARHandler(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	id := chi.URLParam(r, "requestID")
+	req, err := dsarRequests.Verify(id, body.Code)
+	if err != nil {
+		log.Warn().Err(err).Str("dsar_id", id).Str("status", req.Status).Msg("Data subject request verification failed")
+		writeDSARError(w, err)
+		return
+	}
+	log.Info().Str("dsar_id", id).Int("tasks", len(req.Tasks)).Msg("Data subject request verified")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(req)
+}
+
+// RetryDSARHandler re-runs the failed tasks of a failed request
+func RetryDSARHandler(w http.ResponseWriter, r *http.Request) {
+	req, err := dsarRequests.Retry(chi.URLParam(r, "requestID"))
+	if err != nil {
+		writeDSARError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(req)
+}
+
+// GetDSARExportHandler returns the data collected for a completed access request. The
+// export holds the subject's personal data, so it is released only once recorded in
+// the PHI access audit log.
+func GetDSARExportHandler(w http.ResponseWriter, r *http.Request) {
+	export, err := dsarRequests.Export(chi.URLParam(r, "requestID"))
+	if err != nil {
+		writeDSARError(w, err)
+		return
+	}
+	if err := auditAccess(r, "dsar_export", "", "dsar", AccessSucceeded); err != nil {
+		http.Error(w, "Export failed: access could not be audited", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(export)
+}
+
+// DSARReportHandler reports requests against their statutory deadlines
+func DSARReportHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(dsarRequests.Report())
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDSARConnector serves a service's export and erase endpoints, failing erasure
+// until failErase is cleared
+func fakeDSARConnector(t *testing.T, failErase *bool) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer connector-token", r.Header.Get("Authorization"))
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "patient-17", body["subject_id"])
+
+		switch r.URL.Path {
+		case "/export":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"records": []map[string]string{{"mrn": "MRN-17", "allergy": "penicillin"}},
+			})
+		case "/erase":
+			if *failErase {
+				http.Error(w, "database unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"erased": 4, "method": "crypto_shred"})
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// TestDSARAccessRequestLifecycle tests intake, verification, export collection and the export download
+func TestDSARAccessRequestLifecycle(t *testing.T) {
+	failErase := false
+	srv := fakeDSARConnector(t, &failErase)
+	dm := NewDSARManager([]DSARConnector{
+		{Name: "medical-device", ExportURL: srv.URL + "/export", EraseURL: srv.URL + "/erase"},
+		{Name: "billing", EraseURL: srv.URL + "/erase"},
+	}, "connector-token", 5*time.Second)
+	previous := dsarRequests
+	dsarRequests = dm
+	defer func() { dsarRequests = previous }()
+	withAccessAudit(t)
+
+	req, code, err := dm.Submit(DSARAccess, "gdpr", DataSubject{ID: "patient-17", Email: "p17@example.com"}, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, DSARPendingVerification, req.Status)
+	assert.Equal(t, req.ReceivedAt.Add(30*24*time.Hour), req.DueAt)
+
+	_, err = dm.Verify(req.ID, "WRONGCODE")
+	assert.ErrorIs(t, err, errDSARVerification)
+
+	verified, err := dm.Verify(req.ID, strings.ToLower(code))
+	require.NoError(t, err)
+	require.Len(t, verified.Tasks, 1, "only services with an export_url take part in access requests")
+	dm.runs.Wait()
+
+	done, ok := dm.Get(req.ID)
+	require.True(t, ok)
+	assert.Equal(t, DSARCompleted, done.Status)
+	assert.Equal(t, 1, done.Tasks[0].Records)
+
+	router := chi.NewRouter()
+	router.Get("/dsar/{requestID}/export", GetDSARExportHandler)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/dsar/"+req.ID+"/export", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "penicillin")
+
+	entries, err := accessAudit.Query(AccessAuditFilter{Operation: "dsar_export"})
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	_, err = dm.Verify(req.ID, code)
+	assert.ErrorIs(t, err, errDSARConflict)
+}
+
+// TestDSARDeletionRetryAndDeadlines tests failed erasure, retry and the deadline report
+func TestDSARDeletionRetryAndDeadlines(t *testing.T) {
+	failErase := true
+	srv := fakeDSARConnector(t, &failErase)
+	dm := NewDSARManager([]DSARConnector{{Name: "medical-device", EraseURL: srv.URL + "/erase"}}, "connector-token", 5*time.Second)
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	dm.now = func() time.Time { return now }
+
+	deletion, code, err := dm.Submit(DSARDeletion, "ccpa", DataSubject{ID: "patient-17", Email: "p17@example.com"}, now.Add(-40*24*time.Hour))
+	require.NoError(t, err)
+	_, err = dm.Verify(deletion.ID, code)
+	assert.ErrorIs(t, err, errDSARConflict, "verification window has closed")
+	rejected, _ := dm.Get(deletion.ID)
+	assert.Equal(t, DSARRejected, rejected.Status)
+
+	deletion, code, err = dm.Submit(DSARDeletion, "ccpa", DataSubject{ID: "patient-17", Email: "p17@example.com"}, now.Add(-2*24*time.Hour))
+	require.NoError(t, err)
+	_, err = dm.Verify(deletion.ID, code)
+	require.NoError(t, err)
+	dm.runs.Wait()
+
+	failed, _ := dm.Get(deletion.ID)
+	assert.Equal(t, DSARFailed, failed.Status)
+	assert.Contains(t, failed.Tasks[0].Error, "503")
+
+	overdue, _, err := dm.Submit(DSARAccess, "gdpr", DataSubject{ID: "patient-9"}, now.Add(-31*24*time.Hour))
+	require.NoError(t, err)
+	dueSoon, _, err := dm.Submit(DSARAccess, "gdpr", DataSubject{ID: "patient-10"}, now.Add(-25*24*time.Hour))
+	require.NoError(t, err)
+
+	report := dm.Report()
+	assert.Equal(t, 4, report.Total)
+	assert.Equal(t, 3, report.Open)
+	require.Len(t, report.Overdue, 1)
+	assert.Equal(t, overdue.ID, report.Overdue[0].ID)
+	assert.Equal(t, -1, report.Overdue[0].DaysRemaining)
+	require.Len(t, report.DueSoon, 1)
+	assert.Equal(t, dueSoon.ID, report.DueSoon[0].ID)
+
+	failErase = false
+	_, err = dm.Retry(deletion.ID)
+	require.NoError(t, err)
+	dm.runs.Wait()
+
+	erased, _ := dm.Get(deletion.ID)
+	assert.Equal(t, DSARCompleted, erased.Status)
+	assert.Equal(t, 2, erased.Tasks[0].Attempts)
+	assert.Equal(t, "crypto_shred", erased.Tasks[0].Method)
+	assert.Empty(t, erased.Subject.Email)
+	assert.Equal(t, "patient-17", erased.Subject.ID)
+
+	_, err = dm.Export(deletion.ID)
+	assert.ErrorIs(t, err, errDSARConflict)
+}
+
+// TestDSARSyntheticRequestsExpire tests that synthetic requests are kept out of the report and reclaimed after their TTL
+func TestDSARSyntheticRequestsExpire(t *testing.T) {
+	dm := NewDSARManager(nil, "", 5*time.Second)
+	now := time.Now()
+
+	live, _, err := dm.Submit(DSARAccess, "gdpr", DataSubject{ID: "patient-1"}, time.Time{})
+	require.NoError(t, err)
+	test, _, err := dm.Submit(DSARAccess, "gdpr", DataSubject{ID: "patient-2"}, time.Time{})
+	require.NoError(t, err)
+
+	httpReq := httptest.NewRequest(http.MethodPost, "/api/v1/dsar", nil)
+	httpReq.Header.Set("X-Synthetic-Data", "true")
+	httpReq.Header.Set("X-Synthetic-TTL", "1h")
+	marker, err := syntheticPolicy.FromRequest(httpReq, now)
+	require.NoError(t, err)
+	marked, err := dm.MarkSynthetic(test.ID, marker)
+	require.NoError(t, err)
+	assert.True(t, marked.Synthetic)
+
+	assert.Equal(t, 1, dm.Report().Total)
+	assert.Zero(t, dm.ReclaimSynthetic(now))
+	assert.Equal(t, 1, dm.ReclaimSynthetic(now.Add(2*time.Hour)))
+
+	_, ok := dm.Get(test.ID)
+	assert.False(t, ok)
+	_, ok = dm.Get(live.ID)
+	assert.True(t, ok)
+
+	httpReq.Header.Set("X-Synthetic-TTL", "30d")
+	_, err = syntheticPolicy.FromRequest(httpReq, now)
+	assert.Error(t, err)
+}
@@ -1,41 +1,46 @@
 package main
 
 import (
-	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"io"
+	"strings"
 )
 
-// EncryptionService handles PHI encryption/decryption
+// AlgorithmAESGCM names standard-mode encryption in API responses
+const AlgorithmAESGCM = "AES-256-GCM"
+
+// ErrKeyIDMismatch is returned when a request's key ID contradicts the key ID prefixed
+// to the ciphertext
+var ErrKeyIDMismatch = errors.New("key_id does not match the ciphertext")
+
+// EncryptionService handles PHI encryption/decryption. New ciphertext is sealed with
+// the key ring's active data key and prefixed with its key ID ("v2:<base64>");
+// unprefixed ciphertext from before key rotation is opened with the legacy key.
 type EncryptionService struct {
-	gcm cipher.AEAD
+	keys *KeyRing
 }
 
-// NewEncryptionService creates a new encryption service
+// NewEncryptionService creates a new encryption service with an in-memory key ring
 func NewEncryptionService(key string) (*EncryptionService, error) {
-	// Use a 32-byte key for AES-256
-	keyBytes := []byte(key)
-	if len(keyBytes) != 32 {
-		// Pad or truncate to 32 bytes
-		paddedKey := make([]byte, 32)
-		copy(paddedKey, keyBytes)
-		keyBytes = paddedKey
-	}
-
-	block, err := aes.NewCipher(keyBytes)
+	ring, err := NewKeyRing(key, "")
 	if err != nil {
 		return nil, err
 	}
+	return NewEncryptionServiceWithKeyRing(ring), nil
+}
 
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return nil, err
-	}
+// NewEncryptionServiceWithKeyRing creates an encryption service backed by a key ring
+func NewEncryptionServiceWithKeyRing(ring *KeyRing) *EncryptionService {
+	return &EncryptionService{keys: ring}
+}
 
-	return &EncryptionService{gcm: gcm}, nil
+// KeyRing returns the key ring backing the service
+func (e *EncryptionService) KeyRing() *KeyRing {
+	return e.keys
 }
 
 // Encrypt encrypts plaintext data
@@ -44,33 +49,62 @@ func (e *EncryptionService) Encrypt(plaintext []byte) (string, error) {
 		return "", errors.New("plaintext cannot be empty")
 	}
 
-	nonce := make([]byte, e.gcm.NonceSize())
+	keyID, gcm := e.keys.Active()
+	return seal(keyID, gcm, plaintext)
+}
+
+// seal encrypts plaintext with a key and prefixes the result with its key ID
+func seal(keyID string, gcm cipher.AEAD, plaintext []byte) (string, error) {
+	nonce := make([]byte, gcm.NonceSize())
 	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
 		return "", err
 	}
 
-	ciphertext := e.gcm.Seal(nonce, nonce, plaintext, nil)
-	return base64.StdEncoding.EncodeToString(ciphertext), nil
+	// The key ID is authenticated so a prefix swap fails to decrypt
+	ciphertext := gcm.Seal(nonce, nonce, plaintext, []byte(keyID))
+	return keyID + ":" + base64.StdEncoding.EncodeToString(ciphertext), nil
 }
 
 // Decrypt decrypts ciphertext data
 func (e *EncryptionService) Decrypt(ciphertext string) (string, error) {
+	return e.DecryptWithKeyID(ciphertext, "")
+}
+
+// DecryptWithKeyID decrypts ciphertext with the key version named by keyID.
+// Prefixed ciphertext names its own key and keyID, if given, must agree with it.
+// Bare base64 stored apart from its key ID is opened with keyID, or with the legacy
+// key when keyID is empty.
+func (e *EncryptionService) DecryptWithKeyID(ciphertext, keyID string) (string, error) {
 	if ciphertext == "" {
 		return "", errors.New("ciphertext cannot be empty")
 	}
 
+	id, aad := legacyKeyID, []byte(nil)
+	if prefix, encoded, ok := strings.Cut(ciphertext, ":"); ok {
+		if keyID != "" && keyID != prefix {
+			return "", fmt.Errorf("%w: ciphertext was sealed with %s", ErrKeyIDMismatch, prefix)
+		}
+		id, ciphertext, aad = prefix, encoded, []byte(prefix)
+	} else if keyID != "" && keyID != legacyKeyID {
+		id, aad = keyID, []byte(keyID)
+	}
+	gcm, err := e.keys.Key(id)
+	if err != nil {
+		return "", err
+	}
+
 	data, err := base64.StdEncoding.DecodeString(ciphertext)
 	if err != nil {
 		return "", err
 	}
 
-	nonceSize := e.gcm.NonceSize()
+	nonceSize := gcm.NonceSize()
 	if len(data) < nonceSize {
 		return "", errors.New("ciphertext too short")
 	}
 
 	nonce, ciphertextBytes := data[:nonceSize], data[nonceSize:]
-	plaintext, err := e.gcm.Open(nil, nonce, ciphertextBytes, nil)
+	plaintext, err := gcm.Open(nil, nonce, ciphertextBytes, aad)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/healthcare-gitops/common/events"
+	"github.com/healthcare-gitops/common/tlsconfig"
+	"github.com/rs/zerolog/log"
+)
+
+// eventStream is the broker phi.decrypted events are streamed to, so SIEM pipelines
+// see every release of PHI without polling the access log
+var eventStream *events.Stream
+
+// configureEventStream opens the Kafka or NATS broker EVENT_BROKER selects
+func configureEventStream() error {
+	cfg := events.StreamConfigFromEnv()
+	cfg.OnPublish = func(n int, err error) {
+		if err != nil {
+			log.Warn().Err(err).Int("events", n).Msg("Event broker unavailable, streamed events dropped")
+		}
+	}
+	stream, err := events.OpenStream("phi-service", cfg)
+	if err != nil {
+		return err
+	}
+	eventStream = stream
+	return nil
+}
+
+// streamDecrypted publishes a successful decryption, attributed like its access log
+// entry. The plaintext is never part of the event.
+func streamDecrypted(r *http.Request, mode, keyID, dataType string) {
+	if mode == "" {
+		mode = ModeStandard
+	}
+	event := events.PHIDecryptedV1{
+		KeyID:       keyID,
+		DataType:    dataType,
+		Mode:        mode,
+		RequestID:   middleware.GetReqID(r.Context()),
+		SourceIP:    r.RemoteAddr,
+		DecryptedAt: time.Now().UTC(),
+	}
+	if rec, ok := r.Context().Value(decryptAuthorizationKey{}).(DecryptAuditRecord); ok {
+		event.Actor, event.Role, event.PurposeOfUse = rec.UserID, rec.Role, rec.PurposeOfUse
+	} else if id, ok := tlsconfig.FromContext(r.Context()); ok {
+		event.Actor = id.Name()
+	}
+	if event.Actor == "" {
+		event.Actor = "anonymous"
+	}
+	if err := eventStream.Publish(events.EventPHIDecrypted, "key/"+keyID, event); err != nil {
+		log.Error().Err(err).Str("event_type", events.EventPHIDecrypted).Str("key_id", keyID).Msg("Event not streamed")
+	}
+}
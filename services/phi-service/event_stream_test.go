@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/healthcare-gitops/common/auth"
+	"github.com/healthcare-gitops/common/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryPublisher keeps the messages published to it
+type memoryPublisher struct {
+	mu       sync.Mutex
+	messages []events.Message
+}
+
+func (p *memoryPublisher) Publish(_ context.Context, messages []events.Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.messages = append(p.messages, messages...)
+	return nil
+}
+
+func (p *memoryPublisher) Close() error { return nil }
+
+func TestDecryptIsStreamed(t *testing.T) {
+	svc, err := NewEncryptionService(testMasterKey)
+	require.NoError(t, err)
+	previous := encryptionService
+	encryptionService = svc
+	defer func() { encryptionService = previous }()
+
+	srv, _ := fakeAuthService(t, map[string]auth.Introspection{
+		"reader": {Active: true, UserID: "dr-grey", Role: "clinician", Scopes: []string{"phi:read"}, Exp: time.Now().Add(time.Hour).Unix()},
+	})
+	withDecryptAuthorization(t, srv.URL)
+	withAccessAudit(t)
+	publisher := &memoryPublisher{}
+	previousStream := eventStream
+	eventStream = events.NewStream("phi-service", publisher, events.StreamConfig{FlushInterval: 10 * time.Millisecond})
+	defer func() { eventStream = previousStream }()
+
+	ciphertext, err := svc.Encrypt([]byte("Patient SSN: 123-45-6789"))
+	require.NoError(t, err)
+	body, _ := json.Marshal(DecryptRequest{EncryptedData: ciphertext})
+
+	handler := requireDecryptAuthorization(DecryptHandler)
+	for _, token := range []string{"forged", "reader"} {
+		req := httptest.NewRequest("POST", "/api/v1/decrypt", strings.NewReader(string(body)))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set(PurposeOfUseHeader, "TREAT")
+		handler(httptest.NewRecorder(), req)
+	}
+	require.NoError(t, eventStream.Close(context.Background()))
+
+	// Only the released value is streamed; the refusal is on the audit bus
+	require.Len(t, publisher.messages, 1)
+	msg := publisher.messages[0]
+	assert.Equal(t, events.TopicPHIAccess, msg.Topic)
+	assert.Equal(t, events.EventPHIDecrypted, msg.Type)
+	assert.Equal(t, "key/v1", msg.Key)
+
+	var envelope events.Envelope
+	require.NoError(t, json.Unmarshal(msg.Value, &envelope))
+	var decrypted events.PHIDecryptedV1
+	require.NoError(t, json.Unmarshal(envelope.Data, &decrypted))
+	assert.Equal(t, "dr-grey", decrypted.Actor)
+	assert.Equal(t, "TREAT", decrypted.PurposeOfUse)
+	assert.Equal(t, "v1", decrypted.KeyID)
+	assert.Equal(t, ModeStandard, decrypted.Mode)
+	assert.Equal(t, "text", decrypted.DataType)
+
+	assert.NotContains(t, string(msg.Value), "123-45-6789")
+	assert.NotContains(t, string(msg.Value), ciphertext)
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Encryption modes selectable on encrypt and decrypt requests
+const (
+	ModeStandard = "standard" // AES-256-GCM, ciphertext is "<key id>:<base64>"
+	ModeFPE      = "fpe"      // format-preserving, ciphertext has the plaintext's shape
+)
+
+// Format-preserving encryption algorithms (NIST SP 800-38G Rev. 1)
+const (
+	AlgorithmFF1  = "ff1"
+	AlgorithmFF31 = "ff3-1"
+)
+
+// ErrFPEInput is returned when a value cannot be encrypted in the requested format
+var ErrFPEInput = errors.New("invalid format-preserving input")
+
+const (
+	alphabetDigits       = "0123456789"
+	alphabetUpperNumeric = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	alphabetAlphanumeric = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+)
+
+// FPEFormat describes the shape of a field. Characters in the alphabet are
+// encrypted; separators keep their positions. MinLen and MaxLen bound the number of
+// alphabet characters (0 means unbounded).
+type FPEFormat struct {
+	Alphabet   string
+	Separators string
+	MinLen     int
+	MaxLen     int
+}
+
+// fpeFormats are the formats accepted in the "format" field
+var fpeFormats = map[string]FPEFormat{
+	"ssn":          {Alphabet: alphabetDigits, Separators: "-", MinLen: 9, MaxLen: 9},
+	"phone":        {Alphabet: alphabetDigits, Separators: " -().+", MinLen: 7, MaxLen: 15},
+	"mrn":          {Alphabet: alphabetUpperNumeric, Separators: "-"},
+	"digits":       {Alphabet: alphabetDigits},
+	"alphanumeric": {Alphabet: alphabetAlphanumeric},
+}
+
+// FPEOptions selects how a value is format-preserving encrypted. The tweak binds the
+// ciphertext to a context (such as a field or tenant name); the same tweak must be
+// supplied to decrypt.
+type FPEOptions struct {
+	Format    string
+	Algorithm string
+	Tweak     string
+}
+
+// algorithm returns the requested algorithm, defaulting to FF1
+func (o FPEOptions) algorithm() string {
+	if o.Algorithm == "" {
+		return AlgorithmFF1
+	}
+	return o.Algorithm
+}
+
+// EncryptFPE encrypts value in place of its alphabet characters with the active data
+// key, returning the ciphertext and the key ID needed to decrypt it. Encryption is
+// deterministic for a key, format and tweak.
+func (e *EncryptionService) EncryptFPE(value string, opts FPEOptions) (string, string, error) {
+	keyID, key, err := e.keys.FPEKey("")
+	if err != nil {
+		return "", "", err
+	}
+	ciphertext, err := transformFPE(key, value, opts, true)
+	return ciphertext, keyID, err
+}
+
+// DecryptFPE reverses EncryptFPE. An empty keyID uses the active key, which only
+// works for values encrypted since the last rotation.
+func (e *EncryptionService) DecryptFPE(value, keyID string, opts FPEOptions) (string, error) {
+	_, key, err := e.keys.FPEKey(keyID)
+	if err != nil {
+		return "", err
+	}
+	return transformFPE(key, value, opts, false)
+}
+
+// transformFPE encrypts or decrypts the alphabet characters of value, leaving
+// separators where they are
+func transformFPE(key []byte, value string, opts FPEOptions, encrypt bool) (string, error) {
+	format, ok := fpeFormats[opts.Format]
+	if !ok {
+		return "", fmt.Errorf("%w: unknown format %q", ErrFPEInput, opts.Format)
+	}
+	algorithm := opts.algorithm()
+
+	runes := []rune(value)
+	var numerals []uint16
+	var positions []int
+	for i, r := range runes {
+		if idx := strings.IndexRune(format.Alphabet, r); idx >= 0 {
+			numerals = append(numerals, uint16(idx))
+			positions = append(positions, i)
+			continue
+		}
+		if !strings.ContainsRune(format.Separators, r) {
+			return "", fmt.Errorf("%w: character %q is not allowed in %s values", ErrFPEInput, r, opts.Format)
+		}
+	}
+	if (format.MinLen > 0 && len(numerals) < format.MinLen) || (format.MaxLen > 0 && len(numerals) > format.MaxLen) {
+		return "", fmt.Errorf("%w: %s values must have %s characters", ErrFPEInput, opts.Format, lengthRange(format))
+	}
+
+	radix := len(format.Alphabet)
+	tweak := opts.Format + "\x00" + opts.Tweak
+	var out []uint16
+	var err error
+	switch algorithm {
+	case AlgorithmFF1:
+		var c *ff1
+		if c, err = newFF1(key, radix); err == nil {
+			if encrypt {
+				out, err = c.Encrypt(numerals, []byte(tweak))
+			} else {
+				out, err = c.Decrypt(numerals, []byte(tweak))
+			}
+		}
+	case AlgorithmFF31:
+		var c *ff3
+		if c, err = newFF3(key, radix); err == nil {
+			// FF3-1 takes a fixed 56-bit tweak
+			sum := sha256.Sum256([]byte(tweak))
+			t := ff31Tweak(sum[:7])
+			if encrypt {
+				out, err = c.Encrypt(numerals, t)
+			} else {
+				out, err = c.Decrypt(numerals, t)
+			}
+		}
+	default:
+		return "", fmt.Errorf("%w: algorithm must be %s or %s", ErrFPEInput, AlgorithmFF1, AlgorithmFF31)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	for i, pos := range positions {
+		runes[pos] = rune(format.Alphabet[out[i]])
+	}
+	return string(runes), nil
+}
+
+func lengthRange(f FPEFormat) string {
+	switch {
+	case f.MinLen == f.MaxLen:
+		return fmt.Sprint(f.MinLen)
+	case f.MaxLen == 0:
+		return fmt.Sprintf("at least %d", f.MinLen)
+	default:
+		return fmt.Sprintf("%d to %d", f.MinLen, f.MaxLen)
+	}
+}
+
+// fpeMinDomain is the smallest domain SP 800-38G Rev. 1 permits (radix^len >= 10^6)
+var fpeMinDomain = big.NewInt(1000000)
+
+// checkDomain rejects inputs whose domain is too small to encrypt safely
+func checkDomain(radix, n int) error {
+	if new(big.Int).Exp(big.NewInt(int64(radix)), big.NewInt(int64(n)), nil).Cmp(fpeMinDomain) < 0 {
+		return fmt.Errorf("%w: %d characters from a %d-character alphabet is too short to encrypt", ErrFPEInput, n, radix)
+	}
+	return nil
+}
+
+// num is NUM_radix: the numerals read as a big-endian number
+func num(x []uint16, radix int) *big.Int {
+	r := big.NewInt(int64(radix))
+	n := new(big.Int)
+	for _, d := range x {
+		n.Mul(n, r)
+		n.Add(n, big.NewInt(int64(d)))
+	}
+	return n
+}
+
+// str is STR^m_radix: n written as exactly m big-endian numerals
+func str(n *big.Int, m, radix int) []uint16 {
+	out := make([]uint16, m)
+	r := big.NewInt(int64(radix))
+	n = new(big.Int).Set(n)
+	d := new(big.Int)
+	for i := m - 1; i >= 0; i-- {
+		n.DivMod(n, r, d)
+		out[i] = uint16(d.Int64())
+	}
+	return out
+}
+
+func reverse(x []uint16) []uint16 {
+	out := make([]uint16, len(x))
+	for i, d := range x {
+		out[len(x)-1-i] = d
+	}
+	return out
+}
+
+func reverseBytes(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i, c := range b {
+		out[len(b)-1-i] = c
+	}
+	return out
+}
+
+// padBytes writes n big-endian into exactly size bytes
+func padBytes(n *big.Int, size int) []byte {
+	out := make([]byte, size)
+	n.FillBytes(out)
+	return out
+}
+
+// ff1 is the FF1 mode of SP 800-38G
+type ff1 struct {
+	block cipher.Block
+	radix int
+}
+
+func newFF1(key []byte, radix int) (*ff1, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &ff1{block: block, radix: radix}, nil
+}
+
+// prf is CBC-MAC with a zero IV over whole blocks
+func (c *ff1) prf(data []byte) []byte {
+	y := make([]byte, aes.BlockSize)
+	for i := 0; i < len(data); i += aes.BlockSize {
+		for j := 0; j < aes.BlockSize; j++ {
+			y[j] ^= data[i+j]
+		}
+		c.block.Encrypt(y, y)
+	}
+	return y
+}
+
+// round computes the FF1 round value y for round i from the numerals x
+func (c *ff1) round(p, tweak []byte, i int, x []uint16, b, d int) *big.Int {
+	pad := (-len(tweak) - b - 1) % 16
+	if pad < 0 {
+		pad += 16
+	}
+	q := make([]byte, 0, len(tweak)+pad+1+b)
+	q = append(q, tweak...)
+	q = append(q, make([]byte, pad)...)
+	q = append(q, byte(i))
+	q = append(q, padBytes(num(x, c.radix), b)...)
+
+	r := c.prf(append(append([]byte{}, p...), q...))
+	s := append([]byte{}, r...)
+	for j := 1; len(s) < d; j++ {
+		block := make([]byte, aes.BlockSize)
+		counter := padBytes(big.NewInt(int64(j)), aes.BlockSize)
+		for k := range block {
+			block[k] = r[k] ^ counter[k]
+		}
+		c.block.Encrypt(block, block)
+		s = append(s, block...)
+	}
+	return new(big.Int).SetBytes(s[:d])
+}
+
+func (c *ff1) params(n, t int) (u, v, b, d int, p []byte) {
+	u = n / 2
+	v = n - u
+	maxB := new(big.Int).Exp(big.NewInt(int64(c.radix)), big.NewInt(int64(v)), nil)
+	maxB.Sub(maxB, big.NewInt(1))
+	b = (maxB.BitLen() + 7) / 8
+	d = 4*((b+3)/4) + 4
+
+	p = []byte{1, 2, 1, byte(c.radix >> 16), byte(c.radix >> 8), byte(c.radix), 10, byte(u)}
+	p = append(p, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	p = append(p, byte(t>>24), byte(t>>16), byte(t>>8), byte(t))
+	return u, v, b, d, p
+}
+
+// Encrypt applies FF1 to numerals x under tweak
+func (c *ff1) Encrypt(x []uint16, tweak []byte) ([]uint16, error) {
+	if err := checkDomain(c.radix, len(x)); err != nil {
+		return nil, err
+	}
+	u, v, b, d, p := c.params(len(x), len(tweak))
+	a, bb := x[:u], x[u:]
+	radix := big.NewInt(int64(c.radix))
+
+	for i := 0; i < 10; i++ {
+		y := c.round(p, tweak, i, bb, b, d)
+		m := u
+		if i%2 == 1 {
+			m = v
+		}
+		mod := new(big.Int).Exp(radix, big.NewInt(int64(m)), nil)
+		cNum := new(big.Int).Add(num(a, c.radix), y)
+		cNum.Mod(cNum, mod)
+		a, bb = bb, str(cNum, m, c.radix)
+	}
+	return append(append([]uint16{}, a...), bb...), nil
+}
+
+// Decrypt reverses Encrypt
+func (c *ff1) Decrypt(x []uint16, tweak []byte) ([]uint16, error) {
+	if err := checkDomain(c.radix, len(x)); err != nil {
+		return nil, err
+	}
+	u, v, b, d, p := c.params(len(x), len(tweak))
+	a, bb := x[:u], x[u:]
+	radix := big.NewInt(int64(c.radix))
+
+	for i := 9; i >= 0; i-- {
+		y := c.round(p, tweak, i, a, b, d)
+		m := u
+		if i%2 == 1 {
+			m = v
+		}
+		mod := new(big.Int).Exp(radix, big.NewInt(int64(m)), nil)
+		cNum := new(big.Int).Sub(num(bb, c.radix), y)
+		cNum.Mod(cNum, mod)
+		a, bb = str(cNum, m, c.radix), a
+	}
+	return append(append([]uint16{}, a...), bb...), nil
+}
+
+// ff3 is the FF3 core of SP 800-38G, keyed with the byte-reversed key. FF3-1 differs
+// only in taking a 56-bit tweak; see ff31Tweak.
+type ff3 struct {
+	block cipher.Block
+	radix int
+}
+
+func newFF3(key []byte, radix int) (*ff3, error) {
+	block, err := aes.NewCipher(reverseBytes(key))
+	if err != nil {
+		return nil, err
+	}
+	return &ff3{block: block, radix: radix}, nil
+}
+
+// ff31Tweak expands a 56-bit FF3-1 tweak into the 64-bit FF3 layout
+func ff31Tweak(t []byte) []byte {
+	return []byte{t[0], t[1], t[2], t[3] & 0xF0, t[4], t[5], t[6], (t[3] & 0x0F) << 4}
+}
+
+// maxLen is 2*floor(log_radix(2^96)), the longest input FF3 accepts
+func (c *ff3) maxLen() int {
+	limit := new(big.Int).Lsh(big.NewInt(1), 96)
+	n := 0
+	for p := big.NewInt(int64(c.radix)); p.Cmp(limit) <= 0; n++ {
+		p.Mul(p, big.NewInt(int64(c.radix)))
+	}
+	return 2 * n
+}
+
+func (c *ff3) round(w []byte, i int, x []uint16) *big.Int {
+	p := make([]byte, 16)
+	copy(p, w)
+	p[3] ^= byte(i)
+	copy(p[4:], padBytes(num(reverse(x), c.radix), 12))
+
+	s := reverseBytes(p)
+	c.block.Encrypt(s, s)
+	return new(big.Int).SetBytes(reverseBytes(s))
+}
+
+// Encrypt applies FF3 to numerals x under a 64-bit tweak
+func (c *ff3) Encrypt(x []uint16, tweak []byte) ([]uint16, error) {
+	if err := checkDomain(c.radix, len(x)); err != nil {
+		return nil, err
+	}
+	if len(x) > c.maxLen() {
+		return nil, fmt.Errorf("%w: at most %d characters can be encrypted with %s", ErrFPEInput, c.maxLen(), AlgorithmFF31)
+	}
+	n := len(x)
+	u := (n + 1) / 2
+	v := n - u
+	a, b := x[:u], x[u:]
+	tl, tr := tweak[:4], tweak[4:]
+	radix := big.NewInt(int64(c.radix))
+
+	for i := 0; i < 8; i++ {
+		m, w := u, tr
+		if i%2 == 1 {
+			m, w = v, tl
+		}
+		y := c.round(w, i, b)
+		mod := new(big.Int).Exp(radix, big.NewInt(int64(m)), nil)
+		cNum := new(big.Int).Add(num(reverse(a), c.radix), y)
+		cNum.Mod(cNum, mod)
+		a, b = b, reverse(str(cNum, m, c.radix))
+	}
+	return append(append([]uint16{}, a...), b...), nil
+}
+
+// Decrypt reverses Encrypt
+func (c *ff3) Decrypt(x []uint16, tweak []byte) ([]uint16, error) {
+	if err := checkDomain(c.radix, len(x)); err != nil {
+		return nil, err
+	}
+	if len(x) > c.maxLen() {
+		return nil, fmt.Errorf("%w: at most %d characters can be decrypted with %s", ErrFPEInput, c.maxLen(), AlgorithmFF31)
+	}
+	n := len(x)
+	u := (n + 1) / 2
+	v := n - u
+	a, b := x[:u], x[u:]
+	tl, tr := tweak[:4], tweak[4:]
+	radix := big.NewInt(int64(c.radix))
+
+	for i := 7; i >= 0; i-- {
+		m, w := u, tr
+		if i%2 == 1 {
+			m, w = v, tl
+		}
+		y := c.round(w, i, a)
+		mod := new(big.Int).Exp(radix, big.NewInt(int64(m)), nil)
+		cNum := new(big.Int).Sub(num(reverse(b), c.radix), y)
+		cNum.Mod(cNum, mod)
+		a, b = reverse(str(cNum, m, c.radix)), a
+	}
+	return append(append([]uint16{}, a...), b...), nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func toNumerals(t *testing.T, s, alphabet string) []uint16 {
+	out := make([]uint16, len(s))
+	for i, r := range s {
+		idx := strings.IndexRune(alphabet, r)
+		require.GreaterOrEqual(t, idx, 0)
+		out[i] = uint16(idx)
+	}
+	return out
+}
+
+func fromNumerals(x []uint16, alphabet string) string {
+	var b strings.Builder
+	for _, d := range x {
+		b.WriteByte(alphabet[d])
+	}
+	return b.String()
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
+
+// TestFF1KnownAnswers tests FF1 against the NIST SP 800-38G sample vectors
+func TestFF1KnownAnswers(t *testing.T) {
+	const base36 = "0123456789abcdefghijklmnopqrstuvwxyz"
+	cases := []struct {
+		key, tweak, plaintext, ciphertext, alphabet string
+	}{
+		{"2B7E151628AED2A6ABF7158809CF4F3C", "", "0123456789", "2433477484", alphabetDigits},
+		{"2B7E151628AED2A6ABF7158809CF4F3C", "39383736353433323130", "0123456789", "6124200773", alphabetDigits},
+		{"2B7E151628AED2A6ABF7158809CF4F3C", "3737373770717273373737", "0123456789abcdefghi", "a9tv40mll9kdu509eum", base36},
+	}
+
+	for _, tc := range cases {
+		c, err := newFF1(mustHex(t, tc.key), len(tc.alphabet))
+		require.NoError(t, err)
+		tweak := mustHex(t, tc.tweak)
+
+		out, err := c.Encrypt(toNumerals(t, tc.plaintext, tc.alphabet), tweak)
+		require.NoError(t, err)
+		assert.Equal(t, tc.ciphertext, fromNumerals(out, tc.alphabet))
+
+		back, err := c.Decrypt(out, tweak)
+		require.NoError(t, err)
+		assert.Equal(t, tc.plaintext, fromNumerals(back, tc.alphabet))
+	}
+}
+
+// TestFF3KnownAnswers tests the FF3 core against a NIST sample vector and FF3-1
+// tweak expansion against a published FF3-1 vector
+func TestFF3KnownAnswers(t *testing.T) {
+	c, err := newFF3(mustHex(t, "EF4359D8D580AA4F7F036D6F04FC6A94"), 10)
+	require.NoError(t, err)
+	tweak := mustHex(t, "D8E7920AFA330A73")
+	out, err := c.Encrypt(toNumerals(t, "890121234567890000", alphabetDigits), tweak)
+	require.NoError(t, err)
+	assert.Equal(t, "750918814058654607", fromNumerals(out, alphabetDigits))
+
+	back, err := c.Decrypt(out, tweak)
+	require.NoError(t, err)
+	assert.Equal(t, "890121234567890000", fromNumerals(back, alphabetDigits))
+
+	c, err = newFF3(mustHex(t, "2DE79D232DF5585D68CE47882AE256D6"), 10)
+	require.NoError(t, err)
+	out, err = c.Encrypt(toNumerals(t, "3992520240", alphabetDigits), ff31Tweak(mustHex(t, "CBD09280979564")))
+	require.NoError(t, err)
+	assert.Equal(t, "8901801106", fromNumerals(out, alphabetDigits))
+}
+
+// TestEncryptFPEPreservesFormat tests that separators stay in place and values round-trip
+func TestEncryptFPEPreservesFormat(t *testing.T) {
+	svc, err := NewEncryptionService(testMasterKey)
+	require.NoError(t, err)
+
+	cases := []struct {
+		value string
+		opts  FPEOptions
+	}{
+		{"123-45-6789", FPEOptions{Format: "ssn"}},
+		{"(617) 555-1234", FPEOptions{Format: "phone", Algorithm: AlgorithmFF31}},
+		{"MRN-00482913", FPEOptions{Format: "mrn", Tweak: "hospital-a"}},
+	}
+	for _, tc := range cases {
+		encrypted, keyID, err := svc.EncryptFPE(tc.value, tc.opts)
+		require.NoError(t, err, tc.value)
+		assert.Equal(t, "v1", keyID)
+		assert.Len(t, encrypted, len(tc.value))
+		assert.NotEqual(t, tc.value, encrypted)
+		for i := range tc.value {
+			if strings.ContainsRune(fpeFormats[tc.opts.Format].Separators, rune(tc.value[i])) {
+				assert.Equal(t, tc.value[i], encrypted[i], "separator moved in %s", encrypted)
+			}
+		}
+
+		decrypted, err := svc.DecryptFPE(encrypted, keyID, tc.opts)
+		require.NoError(t, err)
+		assert.Equal(t, tc.value, decrypted)
+	}
+}
+
+// TestEncryptFPEBindsTweakAndKey tests that tweaks and rotated keys change the ciphertext
+func TestEncryptFPEBindsTweakAndKey(t *testing.T) {
+	svc, err := NewEncryptionService(testMasterKey)
+	require.NoError(t, err)
+
+	a, _, err := svc.EncryptFPE("123-45-6789", FPEOptions{Format: "ssn", Tweak: "tenant-a"})
+	require.NoError(t, err)
+	b, _, err := svc.EncryptFPE("123-45-6789", FPEOptions{Format: "ssn", Tweak: "tenant-b"})
+	require.NoError(t, err)
+	assert.NotEqual(t, a, b)
+
+	_, err = svc.KeyRing().Rotate("")
+	require.NoError(t, err)
+	rotated, keyID, err := svc.EncryptFPE("123-45-6789", FPEOptions{Format: "ssn", Tweak: "tenant-a"})
+	require.NoError(t, err)
+	assert.Equal(t, "v2", keyID)
+	assert.NotEqual(t, a, rotated)
+
+	// Values from before the rotation need their key ID
+	decrypted, err := svc.DecryptFPE(a, "v1", FPEOptions{Format: "ssn", Tweak: "tenant-a"})
+	require.NoError(t, err)
+	assert.Equal(t, "123-45-6789", decrypted)
+}
+
+// TestEncryptFPERejectsInvalidInput tests format and domain validation
+func TestEncryptFPERejectsInvalidInput(t *testing.T) {
+	svc, err := NewEncryptionService(testMasterKey)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		value string
+		opts  FPEOptions
+	}{
+		{"123-45-678", FPEOptions{Format: "ssn"}},
+		{"123-45-678X", FPEOptions{Format: "ssn"}},
+		{"12345", FPEOptions{Format: "digits"}},
+		{"123456", FPEOptions{Format: "iban"}},
+		{"123456", FPEOptions{Format: "digits", Algorithm: "ff2"}},
+	} {
+		_, _, err := svc.EncryptFPE(tc.value, tc.opts)
+		assert.ErrorIs(t, err, ErrFPEInput, tc.value)
+	}
+}
+
+// TestEncryptHandlerFPEMode tests selecting FPE on the encrypt and decrypt endpoints
+func TestEncryptHandlerFPEMode(t *testing.T) {
+	svc, err := NewEncryptionService(testMasterKey)
+	require.NoError(t, err)
+	previous := encryptionService
+	encryptionService = svc
+	defer func() { encryptionService = previous }()
+
+	w := httptest.NewRecorder()
+	EncryptHandler(w, httptest.NewRequest("POST", "/api/v1/encrypt", strings.NewReader(`{"data":"123-45-6789","mode":"fpe","format":"ssn"}`)))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp EncryptResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.Equal(t, ModeFPE, resp.Mode)
+	assert.Equal(t, "v1", resp.KeyID)
+	assert.Regexp(t, `^\d{3}-\d{2}-\d{4}$`, resp.EncryptedData)
+
+	body, _ := json.Marshal(DecryptRequest{EncryptedData: resp.EncryptedData, Mode: ModeFPE, Format: "ssn", KeyID: resp.KeyID})
+	w = httptest.NewRecorder()
+	DecryptHandler(w, httptest.NewRequest("POST", "/api/v1/decrypt", strings.NewReader(string(body))))
+	require.Equal(t, http.StatusOK, w.Code)
+	var decrypted DecryptResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&decrypted))
+	assert.Equal(t, "123-45-6789", decrypted.Data)
+
+	w = httptest.NewRecorder()
+	EncryptHandler(w, httptest.NewRequest("POST", "/api/v1/encrypt", strings.NewReader(`{"data":"123-45","mode":"fpe","format":"ssn"}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
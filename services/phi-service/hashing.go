@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/healthcare-gitops/common/config"
+	"golang.org/x/crypto/argon2"
+)
+
+// Hash algorithms accepted by the hash endpoint
+const (
+	// HashSHA256 is plain SHA-256. Low-entropy identifiers such as MRNs, SSNs or
+	// phone numbers can be recovered from it by enumeration.
+	HashSHA256 = "sha256"
+	// HashHMACSHA256 is HMAC-SHA256 keyed with HASH_KEY: deterministic, fast, and
+	// irreversible without the key
+	HashHMACSHA256 = "hmac-sha256"
+	// HashArgon2id is Argon2id salted with HASH_KEY: deterministic, and expensive to
+	// enumerate even with the key
+	HashArgon2id = "argon2id"
+)
+
+// hashAlgorithms lists the accepted algorithms, for error messages
+var hashAlgorithms = []string{HashSHA256, HashHMACSHA256, HashArgon2id}
+
+// minArgon2SaltLength is the shortest salt Argon2id accepts
+const minArgon2SaltLength = 8
+
+// Hash request errors
+var (
+	errUnknownHashAlgorithm = errors.New("unknown hash algorithm")
+	errHashSaltTooShort     = fmt.Errorf("argon2id salt must be at least %d bytes", minArgon2SaltLength)
+)
+
+// Argon2Params are the Argon2id cost parameters
+type Argon2Params struct {
+	Time      uint32 `json:"time"`
+	MemoryKiB uint32 `json:"memory_kib"`
+	Threads   uint8  `json:"threads"`
+}
+
+// String formats the parameters the way PHC strings do
+func (p Argon2Params) String() string {
+	return fmt.Sprintf("m=%d,t=%d,p=%d", p.MemoryKiB, p.Time, p.Threads)
+}
+
+// defaultArgon2Params follow the second recommended option of RFC 9106 (64 MiB, three
+// passes), with four lanes
+var defaultArgon2Params = Argon2Params{Time: 3, MemoryKiB: 64 * 1024, Threads: 4}
+
+// HashResult is a computed hash and how it was made
+type HashResult struct {
+	Hash      string
+	Algorithm string
+	Params    string
+}
+
+// Hasher computes identifier hashes. Every algorithm yields 32 bytes, hex encoded,
+// so results fit the same columns whichever is chosen.
+type Hasher struct {
+	key              []byte
+	defaultAlgorithm string
+	argon2           Argon2Params
+	// argon2Slots bounds concurrent Argon2id computations, each of which holds
+	// argon2.MemoryKiB of memory
+	argon2Slots chan struct{}
+}
+
+// NewHasher creates a hasher. key keys HMAC-SHA256 and salts Argon2id; concurrency
+// bounds how many Argon2id hashes run at once.
+func NewHasher(key []byte, defaultAlgorithm string, params Argon2Params, concurrency int) (*Hasher, error) {
+	if !validHashAlgorithm(defaultAlgorithm) {
+		return nil, fmt.Errorf("%w %q", errUnknownHashAlgorithm, defaultAlgorithm)
+	}
+	if len(key) < minArgon2SaltLength {
+		return nil, fmt.Errorf("hash key must be at least %d bytes", minArgon2SaltLength)
+	}
+	if params.Time == 0 || params.MemoryKiB < 8*uint32(params.Threads) || params.Threads == 0 {
+		return nil, fmt.Errorf("invalid Argon2id parameters %s", params)
+	}
+	if concurrency < 1 {
+		return nil, fmt.Errorf("Argon2id concurrency must be at least 1")
+	}
+	return &Hasher{
+		key:              key,
+		defaultAlgorithm: defaultAlgorithm,
+		argon2:           params,
+		argon2Slots:      make(chan struct{}, concurrency),
+	}, nil
+}
+
+func validHashAlgorithm(algorithm string) bool {
+	for _, a := range hashAlgorithms {
+		if a == algorithm {
+			return true
+		}
+	}
+	return false
+}
+
+// Hash hashes data with algorithm, or the default when it is empty. A salt is
+// prepended to the data for SHA-256 and HMAC-SHA256 and replaces the key as the
+// Argon2id salt, so callers can scope pseudonyms to a dataset.
+func (h *Hasher) Hash(ctx context.Context, data []byte, algorithm, salt string) (HashResult, error) {
+	if algorithm == "" {
+		algorithm = h.defaultAlgorithm
+	}
+	result := HashResult{Algorithm: algorithm}
+	switch algorithm {
+	case HashSHA256:
+		sum := sha256.Sum256(append([]byte(salt), data...))
+		result.Hash = hex.EncodeToString(sum[:])
+	case HashHMACSHA256:
+		mac := hmac.New(sha256.New, h.key)
+		mac.Write([]byte(salt))
+		mac.Write(data)
+		result.Hash = hex.EncodeToString(mac.Sum(nil))
+	case HashArgon2id:
+		argonSalt := h.key
+		if salt != "" {
+			if len(salt) < minArgon2SaltLength {
+				return HashResult{}, errHashSaltTooShort
+			}
+			argonSalt = []byte(salt)
+		}
+		select {
+		case h.argon2Slots <- struct{}{}:
+		case <-ctx.Done():
+			return HashResult{}, ctx.Err()
+		}
+		sum := argon2.IDKey(data, argonSalt, h.argon2.Time, h.argon2.MemoryKiB, h.argon2.Threads, 32)
+		<-h.argon2Slots
+		result.Hash, result.Params = hex.EncodeToString(sum), h.argon2.String()
+	default:
+		return HashResult{}, fmt.Errorf("%w %q: use one of %s", errUnknownHashAlgorithm, algorithm, strings.Join(hashAlgorithms, ", "))
+	}
+	return result, nil
+}
+
+// loadArgon2Params reads HASH_ARGON2_TIME, HASH_ARGON2_MEMORY_KIB and
+// HASH_ARGON2_THREADS over the defaults
+func loadArgon2Params() (Argon2Params, error) {
+	params := defaultArgon2Params
+	for name, dst := range map[string]*uint32{
+		"HASH_ARGON2_TIME":       &params.Time,
+		"HASH_ARGON2_MEMORY_KIB": &params.MemoryKiB,
+	} {
+		if value := config.GetEnv(name, ""); value != "" {
+			n, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return Argon2Params{}, fmt.Errorf("%s: %w", name, err)
+			}
+			*dst = uint32(n)
+		}
+	}
+	if value := config.GetEnv("HASH_ARGON2_THREADS", ""); value != "" {
+		n, err := strconv.ParseUint(value, 10, 8)
+		if err != nil {
+			return Argon2Params{}, fmt.Errorf("HASH_ARGON2_THREADS: %w", err)
+		}
+		params.Threads = uint8(n)
+	}
+	return params, nil
+}
+
+// hasher serves the hash endpoint
+var hasher *Hasher
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testArgon2Params keep Argon2id cheap in tests
+var testArgon2Params = Argon2Params{Time: 1, MemoryKiB: 1024, Threads: 1}
+
+// TestHasherAlgorithms tests known-answer SHA-256, keyed determinism and salt scoping for each algorithm
+func TestHasherAlgorithms(t *testing.T) {
+	h, err := NewHasher([]byte("hash-test-key-0123456789"), HashHMACSHA256, testArgon2Params, 1)
+	require.NoError(t, err)
+	other, err := NewHasher([]byte("another-hash-key-987654"), HashHMACSHA256, testArgon2Params, 1)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	sha, err := h.Hash(ctx, []byte("abc"), HashSHA256, "")
+	require.NoError(t, err)
+	assert.Equal(t, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", sha.Hash)
+
+	for _, algorithm := range []string{HashHMACSHA256, HashArgon2id} {
+		first, err := h.Hash(ctx, []byte("MRN-004211"), algorithm, "")
+		require.NoError(t, err, algorithm)
+		again, err := h.Hash(ctx, []byte("MRN-004211"), algorithm, "")
+		require.NoError(t, err, algorithm)
+		rekeyed, err := other.Hash(ctx, []byte("MRN-004211"), algorithm, "")
+		require.NoError(t, err, algorithm)
+		salted, err := h.Hash(ctx, []byte("MRN-004211"), algorithm, "study-42-cohort")
+		require.NoError(t, err, algorithm)
+
+		assert.Len(t, first.Hash, 64, algorithm)
+		assert.Equal(t, first.Hash, again.Hash, algorithm)
+		assert.NotEqual(t, first.Hash, rekeyed.Hash, algorithm)
+		assert.NotEqual(t, first.Hash, salted.Hash, algorithm)
+		assert.NotEqual(t, first.Hash, sha.Hash, algorithm)
+	}
+
+	defaulted, err := h.Hash(ctx, []byte("MRN-004211"), "", "")
+	require.NoError(t, err)
+	assert.Equal(t, HashHMACSHA256, defaulted.Algorithm)
+
+	argon, err := h.Hash(ctx, []byte("MRN-004211"), HashArgon2id, "")
+	require.NoError(t, err)
+	assert.Equal(t, "m=1024,t=1,p=1", argon.Params)
+
+	_, err = h.Hash(ctx, []byte("MRN-004211"), HashArgon2id, "short")
+	assert.ErrorIs(t, err, errHashSaltTooShort)
+	_, err = h.Hash(ctx, []byte("MRN-004211"), "md5", "")
+	assert.ErrorIs(t, err, errUnknownHashAlgorithm)
+	_, err = NewHasher([]byte("hash-test-key-0123456789"), "md5", testArgon2Params, 1)
+	assert.ErrorIs(t, err, errUnknownHashAlgorithm)
+}
+
+// TestHashHandlerSelectsAlgorithm tests per-request algorithm selection and rejection of unknown algorithms
+func TestHashHandlerSelectsAlgorithm(t *testing.T) {
+	previous := hasher
+	var err error
+	hasher, err = NewHasher([]byte("hash-test-key-0123456789"), HashHMACSHA256, testArgon2Params, 1)
+	require.NoError(t, err)
+	defer func() { hasher = previous }()
+
+	w := httptest.NewRecorder()
+	HashHandler(w, httptest.NewRequest("POST", "/api/v1/hash", strings.NewReader(`{"data":"123-45-6789","algorithm":"argon2id"}`)))
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp HashResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.Equal(t, HashArgon2id, resp.Algorithm)
+	assert.Equal(t, "m=1024,t=1,p=1", resp.Params)
+	assert.Regexp(t, `^[a-f0-9]{64}$`, resp.Hash)
+
+	w = httptest.NewRecorder()
+	HashHandler(w, httptest.NewRequest("POST", "/api/v1/hash", strings.NewReader(`{"data":"123-45-6789","algorithm":"md5"}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
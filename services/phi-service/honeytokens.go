@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/healthcare-gitops/common/honeytoken"
+	"github.com/rs/zerolog/log"
+)
+
+// maxHoneytokensPerRequest bounds the decoys generated by one request
+const maxHoneytokensPerRequest = 100
+
+// honeytokens holds the decoy PHI values whose decryption raises a SOC alert; nil
+// when the feature is disabled
+var honeytokens *honeytoken.Registry
+
+// HoneytokenRequest asks for decoy PHI values to seed into downstream stores
+type HoneytokenRequest struct {
+	Kind  string `json:"kind"`
+	Count int    `json:"count,omitempty"`
+	Label string `json:"label,omitempty"`
+}
+
+// SeededHoneytoken is a decoy with its ciphertext, ready to be stored alongside real
+// encrypted PHI
+type SeededHoneytoken struct {
+	honeytoken.Token
+	EncryptedData string `json:"encrypted_data"`
+	KeyID         string `json:"key_id"`
+}
+
+// openHoneytokens opens the decoy registry at HONEYTOKEN_PATH, logging every alert
+func openHoneytokens() (*honeytoken.Registry, error) {
+	cfg := honeytoken.ConfigFromEnv("phi-service")
+	cfg.OnAlert = func(alert honeytoken.Alert) {
+		log.Error().
+			Str("security_alert", "honeytoken").
+			Str("severity", alert.Severity).
+			Str("alert_id", alert.ID).
+			Str("token_id", alert.TokenID).
+			Str("kind", alert.Kind).
+			Str("action", alert.Action).
+			Str("user_id", alert.UserID).
+			Str("client_ip", alert.ClientIP).
+			Str("request_id", alert.RequestID).
+			Msg("Honeytoken PHI decrypted")
+		RecordHoneytokenAlert(alert.Kind)
+	}
+	cfg.OnNotifyError = func(alert honeytoken.Alert, err error) {
+		log.Error().Err(err).Str("alert_id", alert.ID).Msg("Failed to send honeytoken alert to the SOC")
+	}
+	return honeytoken.Open(cfg)
+}
+
+// checkHoneytoken raises an alert when decrypted plaintext is a decoy. The response is
+// unchanged, so the caller cannot tell the decoy from real PHI.
+func checkHoneytoken(r *http.Request, plaintext, operation string) {
+	access := honeytoken.Access{
+		Action:    operation,
+		Resource:  r.URL.Path,
+		ClientIP:  r.RemoteAddr,
+		RequestID: middleware.GetReqID(r.Context()),
+	}
+	if rec, ok := r.Context().Value(decryptAuthorizationKey{}).(DecryptAuditRecord); ok {
+		access.UserID = rec.UserID
+	}
+	honeytokens.Check(plaintext, access)
+}
+
+// CreateHoneytokensHandler handles POST /api/v1/honeytokens: generates decoy values
+// of a kind and returns them encrypted for seeding
+func CreateHoneytokensHandler(w http.ResponseWriter, r *http.Request) {
+	var req HoneytokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Count == 0 {
+		req.Count = 1
+	}
+	if req.Count < 1 || req.Count > maxHoneytokensPerRequest {
+		http.Error(w, fmt.Sprintf("count must be between 1 and %d", maxHoneytokensPerRequest), http.StatusBadRequest)
+		return
+	}
+
+	seeded := make([]SeededHoneytoken, 0, req.Count)
+	for i := 0; i < req.Count; i++ {
+		token, err := honeytokens.Create(req.Kind, req.Label)
+		if errors.Is(err, honeytoken.ErrUnknownKind) {
+			http.Error(w, fmt.Sprintf("kind must be one of %v", honeytoken.Kinds), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to register honeytoken")
+			http.Error(w, "Failed to register honeytoken", http.StatusInternalServerError)
+			return
+		}
+		encrypted, err := encryptionService.Encrypt([]byte(token.Value))
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to encrypt honeytoken")
+			http.Error(w, "Failed to encrypt honeytoken", http.StatusInternalServerError)
+			return
+		}
+		seeded = append(seeded, SeededHoneytoken{Token: token, EncryptedData: encrypted, KeyID: ciphertextKeyID(encrypted)})
+	}
+	log.Info().Str("kind", req.Kind).Int("count", len(seeded)).Msg("Honeytokens generated")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"honeytokens": seeded,
+		"count":       len(seeded),
+	})
+}
+
+// ListHoneytokensHandler handles GET /api/v1/honeytokens
+func ListHoneytokensHandler(w http.ResponseWriter, r *http.Request) {
+	tokens := honeytokens.Tokens()
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"honeytokens": tokens,
+		"count":       len(tokens),
+	})
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/healthcare-gitops/common/auth"
+	"github.com/healthcare-gitops/common/honeytoken"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withHoneytokens installs a registry persisted at the returned path that reports to socURL
+func withHoneytokens(t *testing.T, socURL string) (*honeytoken.Registry, string) {
+	previous := honeytokens
+	path := filepath.Join(t.TempDir(), "honeytokens.json")
+	registry, err := honeytoken.Open(honeytoken.Config{Service: "phi-service", Path: path, SOCWebhookURL: socURL})
+	require.NoError(t, err)
+	honeytokens = registry
+	t.Cleanup(func() { honeytokens = previous })
+	return registry, path
+}
+
+// TestHoneytokenDecryptAlertsSOC tests that decrypting seeded decoy PHI returns it as
+// usual and sends a critical alert naming the caller to the SOC
+func TestHoneytokenDecryptAlertsSOC(t *testing.T) {
+	svc, err := NewEncryptionService(testMasterKey)
+	require.NoError(t, err)
+	previous := encryptionService
+	encryptionService = svc
+	defer func() { encryptionService = previous }()
+
+	received := make(chan honeytoken.Alert, 4)
+	soc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert honeytoken.Alert
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&alert))
+		received <- alert
+	}))
+	defer soc.Close()
+	registry, path := withHoneytokens(t, soc.URL)
+
+	srv, _ := fakeAuthService(t, map[string]auth.Introspection{
+		"reader": {Active: true, UserID: "dr-grey", Role: "clinician", Scopes: []string{"phi:read"}, Exp: time.Now().Add(time.Hour).Unix()},
+	})
+	withDecryptAuthorization(t, srv.URL)
+	withAccessAudit(t)
+
+	w := httptest.NewRecorder()
+	CreateHoneytokensHandler(w, httptest.NewRequest("POST", "/api/v1/honeytokens", strings.NewReader(`{"kind":"ssn","count":2,"label":"claims-db"}`)))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created struct {
+		Honeytokens []SeededHoneytoken `json:"honeytokens"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	require.Len(t, created.Honeytokens, 2)
+	decoy := created.Honeytokens[0]
+	assert.Regexp(t, `^9\d\d-\d\d-\d\d\d\d$`, decoy.Value)
+	assert.Equal(t, "claims-db", decoy.Label)
+
+	decrypt := func(ciphertext string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(DecryptRequest{EncryptedData: ciphertext})
+		req := httptest.NewRequest("POST", "/api/v1/decrypt", strings.NewReader(string(body)))
+		req.Header.Set("Authorization", "Bearer reader")
+		req.Header.Set(PurposeOfUseHeader, "TREAT")
+		w := httptest.NewRecorder()
+		requireDecryptAuthorization(DecryptHandler)(w, req)
+		return w
+	}
+
+	// Real PHI raises nothing
+	genuine, err := svc.Encrypt([]byte("123-45-6789"))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, decrypt(genuine).Code)
+	assert.Empty(t, registry.Alerts(10))
+
+	w = decrypt(decoy.EncryptedData)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), decoy.Value)
+
+	registry.Wait()
+	select {
+	case alert := <-received:
+		assert.Equal(t, honeytoken.Severity, alert.Severity)
+		assert.Equal(t, decoy.ID, alert.TokenID)
+		assert.Equal(t, "dr-grey", alert.UserID)
+		assert.Equal(t, "decrypt", alert.Action)
+	default:
+		t.Fatal("expected the SOC to receive an alert")
+	}
+
+	w = httptest.NewRecorder()
+	registry.AlertsHandler()(w, httptest.NewRequest("GET", "/api/v1/honeytokens/alerts", nil))
+	assert.Contains(t, w.Body.String(), `"count":1`)
+
+	// Decoys survive a restart
+	reopened, err := honeytoken.Open(honeytoken.Config{Service: "phi-service", Path: path})
+	require.NoError(t, err)
+	assert.True(t, reopened.IsDecoy(decoy.Value))
+	assert.Len(t, reopened.Tokens(), 2)
+}
+
+func TestCreateHoneytokensValidation(t *testing.T) {
+	withHoneytokens(t, "")
+	for _, body := range []string{`{"kind":"credit_score"}`, `{"kind":"ssn","count":101}`, `not json`} {
+		w := httptest.NewRecorder()
+		CreateHoneytokensHandler(w, httptest.NewRequest("POST", "/api/v1/honeytokens", strings.NewReader(body)))
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+}
@@ -0,0 +1,508 @@
+package main
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/healthcare-gitops/common/audit"
+	"github.com/rs/zerolog/log"
+)
+
+// legacyKeyID names the master key imported as a data key, so ciphertext written
+// before key IDs existed stays readable after the master key itself is rotated
+const legacyKeyID = "v0"
+
+var (
+	// ErrUnknownKey is returned when ciphertext names a key that is not in the ring
+	ErrUnknownKey = errors.New("unknown encryption key")
+
+	// ErrMasterKeyMismatch is returned when the keyring was wrapped with a different master key
+	ErrMasterKeyMismatch = errors.New("master key cannot unwrap keyring")
+)
+
+// DataKey is a versioned data encryption key. Only its wrapped form is persisted;
+// the plaintext key never leaves memory.
+type DataKey struct {
+	ID        string     `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	RetiredAt *time.Time `json:"retired_at,omitempty"`
+	Wrapped   string     `json:"wrapped"`
+	aead      cipher.AEAD
+	plaintext []byte
+}
+
+// KeyInfo is the metadata exposed about a data key
+type KeyInfo struct {
+	ID        string     `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	RetiredAt *time.Time `json:"retired_at,omitempty"`
+	Active    bool       `json:"active"`
+}
+
+// RotationResult describes a completed rotation
+type RotationResult struct {
+	PreviousKeyID    string `json:"previous_key_id"`
+	ActiveKeyID      string `json:"active_key_id"`
+	Rewrapped        int    `json:"rewrapped_keys"`
+	MasterKeyRotated bool   `json:"master_key_rotated"`
+}
+
+// keyRingFile is the on-disk keyring layout
+type keyRingFile struct {
+	Active      string        `json:"active"`
+	Keys        []*DataKey    `json:"keys"`
+	PatientKeys []*PatientKey `json:"patient_keys,omitempty"`
+}
+
+// KeyRing holds versioned data encryption keys wrapped by the master key
+// (envelope encryption). New data is encrypted with the active key; retired keys are
+// kept so existing ciphertext stays readable. Per-patient keys are held alongside,
+// indexed by patient and by key ID.
+type KeyRing struct {
+	kek         cipher.AEAD
+	keys        map[string]*DataKey
+	active      string
+	patients    map[string]*PatientKey
+	patientKeys map[string]*PatientKey
+	path        string
+	mu          sync.RWMutex
+}
+
+// newAEAD builds AES-256-GCM from a key, padding or truncating to 32 bytes
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		padded := make([]byte, 32)
+		copy(padded, key)
+		key = padded
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// NewKeyRing loads the keyring at path, or creates one with a single key. An empty
+// path keeps the ring in memory only, so keys created after startup are lost on restart.
+func NewKeyRing(masterKey, path string) (*KeyRing, error) {
+	kek, err := newAEAD([]byte(masterKey))
+	if err != nil {
+		return nil, err
+	}
+	kr := &KeyRing{
+		kek:         kek,
+		keys:        make(map[string]*DataKey),
+		patients:    make(map[string]*PatientKey),
+		patientKeys: make(map[string]*PatientKey),
+		path:        path,
+	}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			if err := kr.load(data); err != nil {
+				return nil, err
+			}
+			return kr, nil
+		case !os.IsNotExist(err):
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	legacy, err := kr.importKey(legacyKeyID, []byte(masterKey), now)
+	if err != nil {
+		return nil, err
+	}
+	legacy.RetiredAt = &now
+	kr.keys[legacy.ID] = legacy
+
+	key, err := kr.generate(1, now)
+	if err != nil {
+		return nil, err
+	}
+	kr.keys[key.ID] = key
+	kr.active = key.ID
+	if err := kr.save(); err != nil {
+		return nil, err
+	}
+	return kr, nil
+}
+
+// load unwraps every key in a persisted keyring
+func (kr *KeyRing) load(data []byte) error {
+	var file keyRingFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("invalid keyring: %w", err)
+	}
+	for _, key := range file.Keys {
+		if err := kr.unwrap(key); err != nil {
+			return err
+		}
+		kr.keys[key.ID] = key
+	}
+	if _, ok := kr.keys[file.Active]; !ok {
+		return fmt.Errorf("invalid keyring: active key %q not present", file.Active)
+	}
+	kr.active = file.Active
+	for _, key := range file.PatientKeys {
+		if key.DestroyedAt == nil {
+			if err := kr.unwrapPatientKey(key); err != nil {
+				return err
+			}
+		}
+		kr.patients[key.PatientID] = key
+		kr.patientKeys[key.ID] = key
+	}
+	return nil
+}
+
+// generate creates the n-th data key, wrapped with the current master key
+func (kr *KeyRing) generate(n int, now time.Time) (*DataKey, error) {
+	plaintext := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, plaintext); err != nil {
+		return nil, err
+	}
+	return kr.importKey("v"+strconv.Itoa(n), plaintext, now)
+}
+
+// importKey wraps existing key material as a data key
+func (kr *KeyRing) importKey(id string, material []byte, now time.Time) (*DataKey, error) {
+	plaintext := make([]byte, 32)
+	copy(plaintext, material)
+	aead, err := newAEAD(plaintext)
+	if err != nil {
+		return nil, err
+	}
+	key := &DataKey{
+		ID:        id,
+		CreatedAt: now,
+		aead:      aead,
+		plaintext: plaintext,
+	}
+	if key.Wrapped, err = wrapKey(kr.kek, key.ID, plaintext); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// wrapKey encrypts a data key under the master key, bound to its key ID
+func wrapKey(kek cipher.AEAD, id string, plaintext []byte) (string, error) {
+	nonce := make([]byte, kek.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(kek.Seal(nonce, nonce, plaintext, []byte(id))), nil
+}
+
+// unwrap decrypts a persisted data key with the master key
+func (kr *KeyRing) unwrap(key *DataKey) error {
+	plaintext, err := kr.unwrapKey(key.ID, key.Wrapped)
+	if err != nil {
+		return err
+	}
+	if key.aead, err = newAEAD(plaintext); err != nil {
+		return err
+	}
+	key.plaintext = plaintext
+	return nil
+}
+
+// unwrapKey decrypts wrapped key material bound to a key ID
+func (kr *KeyRing) unwrapKey(id, wrapped string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil || len(data) < kr.kek.NonceSize() {
+		return nil, fmt.Errorf("invalid wrapped key %s", id)
+	}
+	nonce, sealed := data[:kr.kek.NonceSize()], data[kr.kek.NonceSize():]
+	plaintext, err := kr.kek.Open(nil, nonce, sealed, []byte(id))
+	if err != nil {
+		return nil, fmt.Errorf("%w: key %s", ErrMasterKeyMismatch, id)
+	}
+	return plaintext, nil
+}
+
+// save writes the keyring atomically with owner-only permissions. Callers must hold
+// kr.mu or have exclusive access.
+func (kr *KeyRing) save() error {
+	if kr.path == "" {
+		return nil
+	}
+	file := keyRingFile{Active: kr.active, Keys: kr.sortedKeys(), PatientKeys: kr.sortedPatientKeys()}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(kr.path), ".keyring-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), kr.path)
+}
+
+// sortedKeys returns keys oldest first. Callers must hold kr.mu.
+func (kr *KeyRing) sortedKeys() []*DataKey {
+	keys := make([]*DataKey, 0, len(kr.keys))
+	for _, key := range kr.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keyVersion(keys[i].ID) < keyVersion(keys[j].ID) })
+	return keys
+}
+
+// keyVersion parses the number out of a "v<n>" key ID
+func keyVersion(id string) int {
+	n, _ := strconv.Atoi(strings.TrimPrefix(id, "v"))
+	return n
+}
+
+// Active returns the key used for new encryptions
+func (kr *KeyRing) Active() (string, cipher.AEAD) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	return kr.active, kr.keys[kr.active].aead
+}
+
+// Key returns a key by ID for decryption. A destroyed patient key returns
+// ErrKeyErased.
+func (kr *KeyRing) Key(id string) (cipher.AEAD, error) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	if strings.HasPrefix(id, patientKeyPrefix) {
+		return kr.patientKeyByID(id)
+	}
+	key, ok := kr.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, id)
+	}
+	return key.aead, nil
+}
+
+// FPEKey derives the format-preserving encryption key of a data key, so FPE and GCM
+// never use the same key material. An empty id selects the active key.
+func (kr *KeyRing) FPEKey(id string) (string, []byte, error) {
+	return kr.deriveKey(id, "phi-service fpe key")
+}
+
+// IndexKey derives the blind index key for a field from a data key. Each field gets
+// its own key, so equal values in different fields produce unrelated indexes. An
+// empty id selects the active key.
+func (kr *KeyRing) IndexKey(id, field string) (string, []byte, error) {
+	return kr.deriveKey(id, "phi-service blind index key\x00"+field)
+}
+
+// deriveKey derives a purpose-specific key from a data key with HMAC-SHA256
+func (kr *KeyRing) deriveKey(id, label string) (string, []byte, error) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	if id == "" {
+		id = kr.active
+	}
+	key, ok := kr.keys[id]
+	if !ok {
+		return "", nil, fmt.Errorf("%w: %s", ErrUnknownKey, id)
+	}
+	mac := hmac.New(sha256.New, key.plaintext)
+	mac.Write([]byte(label))
+	return id, mac.Sum(nil), nil
+}
+
+// ActiveSince returns when the active key was created
+func (kr *KeyRing) ActiveSince() time.Time {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	return kr.keys[kr.active].CreatedAt
+}
+
+// Keys lists key metadata, oldest first
+func (kr *KeyRing) Keys() []KeyInfo {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	infos := make([]KeyInfo, 0, len(kr.keys))
+	for _, key := range kr.sortedKeys() {
+		infos = append(infos, KeyInfo{
+			ID:        key.ID,
+			CreatedAt: key.CreatedAt,
+			RetiredAt: key.RetiredAt,
+			Active:    key.ID == kr.active,
+		})
+	}
+	return infos
+}
+
+// Rotate creates a new active data key and retires the previous one. Every data key
+// and live patient key is then re-wrapped: under newMasterKey when one is given, so
+// the old master key can be destroyed, or otherwise under the current master key with
+// fresh nonces. Patient keys themselves are not replaced.
+func (kr *KeyRing) Rotate(newMasterKey string) (RotationResult, error) {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	kek := kr.kek
+	if newMasterKey != "" {
+		var err error
+		if kek, err = newAEAD([]byte(newMasterKey)); err != nil {
+			return RotationResult{}, err
+		}
+	}
+
+	now := time.Now()
+	previous := kr.active
+	next, err := kr.generate(keyVersion(kr.sortedKeys()[len(kr.keys)-1].ID)+1, now)
+	if err != nil {
+		return RotationResult{}, err
+	}
+
+	// Re-wrap into copies first so a failure leaves the ring untouched
+	rewrapped := make(map[string]string, len(kr.keys)+1)
+	for id, key := range kr.keys {
+		if rewrapped[id], err = wrapKey(kek, id, key.plaintext); err != nil {
+			return RotationResult{}, err
+		}
+	}
+	if rewrapped[next.ID], err = wrapKey(kek, next.ID, next.plaintext); err != nil {
+		return RotationResult{}, err
+	}
+	patientRewrapped := make(map[string]string, len(kr.patientKeys))
+	for id, key := range kr.patientKeys {
+		if key.DestroyedAt != nil {
+			continue
+		}
+		if patientRewrapped[id], err = wrapKey(kek, id, key.plaintext); err != nil {
+			return RotationResult{}, err
+		}
+	}
+
+	oldKEK, oldActive := kr.kek, kr.active
+	oldWrapped := make(map[string]string, len(kr.keys))
+	for id, key := range kr.keys {
+		oldWrapped[id] = key.Wrapped
+	}
+	oldPatientWrapped := make(map[string]string, len(patientRewrapped))
+	for id := range patientRewrapped {
+		oldPatientWrapped[id] = kr.patientKeys[id].Wrapped
+	}
+
+	kr.keys[next.ID] = next
+	for id, wrapped := range rewrapped {
+		kr.keys[id].Wrapped = wrapped
+	}
+	for id, wrapped := range patientRewrapped {
+		kr.patientKeys[id].Wrapped = wrapped
+	}
+	kr.keys[previous].RetiredAt = &now
+	kr.active = next.ID
+	kr.kek = kek
+
+	if err := kr.save(); err != nil {
+		// Roll back so memory matches what is on disk
+		delete(kr.keys, next.ID)
+		for id, wrapped := range oldWrapped {
+			kr.keys[id].Wrapped = wrapped
+		}
+		for id, wrapped := range oldPatientWrapped {
+			kr.patientKeys[id].Wrapped = wrapped
+		}
+		kr.keys[previous].RetiredAt = nil
+		kr.active, kr.kek = oldActive, oldKEK
+		return RotationResult{}, err
+	}
+
+	return RotationResult{
+		PreviousKeyID:    previous,
+		ActiveKeyID:      next.ID,
+		Rewrapped:        len(rewrapped) + len(patientRewrapped),
+		MasterKeyRotated: newMasterKey != "",
+	}, nil
+}
+
+// startKeyRotation rotates the data key whenever the active key is older than interval.
+// It checks hourly so a restart does not postpone a due rotation by a full interval.
+func startKeyRotation(ctx context.Context, ring *KeyRing, interval time.Duration) {
+	if interval <= 0 {
+		log.Info().Msg("Scheduled key rotation disabled")
+		return
+	}
+
+	check := time.Hour
+	if interval < check {
+		check = interval
+	}
+	go func() {
+		ticker := time.NewTicker(check)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if time.Since(ring.ActiveSince()) < interval {
+					continue
+				}
+				result, err := ring.Rotate("")
+				if err != nil {
+					log.Error().Err(err).Msg("Scheduled key rotation failed")
+					RecordKeyRotation("scheduled", "error")
+					continue
+				}
+				RecordKeyRotation("scheduled", "success")
+				log.Info().Str("previous_key_id", result.PreviousKeyID).Str("active_key_id", result.ActiveKeyID).Msg("Data encryption key rotated on schedule")
+			}
+		}
+	}()
+}
+
+// requireAdminToken guards admin endpoints (key management, masking jobs) with the
+// PHI_ADMIN_TOKEN shared secret. The endpoints are disabled entirely when no token is
+// configured.
+func requireAdminToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		expected := os.Getenv("PHI_ADMIN_TOKEN")
+		if expected == "" {
+			http.Error(w, "Admin endpoints are disabled", http.StatusForbidden)
+			return
+		}
+		provided := r.Header.Get("X-Admin-Token")
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(expected)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		audit.SetActor(r.Context(), "admin-token")
+		next(w, r)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testMasterKey     = "keyring-test-master-key-32-bytes"
+	testNextMasterKey = "keyring-test-next-master-key-32b"
+)
+
+// TestKeyRingCiphertextCarriesKeyID tests that ciphertext is prefixed with the active key
+func TestKeyRingCiphertextCarriesKeyID(t *testing.T) {
+	svc, err := NewEncryptionService(testMasterKey)
+	require.NoError(t, err)
+
+	encrypted, err := svc.Encrypt([]byte("MRN-123456"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(encrypted, "v1:"))
+
+	decrypted, err := svc.Decrypt(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "MRN-123456", decrypted)
+}
+
+// TestKeyRingRotationKeepsOldCiphertextReadable tests decrypting across a rotation
+func TestKeyRingRotationKeepsOldCiphertextReadable(t *testing.T) {
+	svc, err := NewEncryptionService(testMasterKey)
+	require.NoError(t, err)
+
+	before, err := svc.Encrypt([]byte("before rotation"))
+	require.NoError(t, err)
+
+	result, err := svc.KeyRing().Rotate("")
+	require.NoError(t, err)
+	assert.Equal(t, "v1", result.PreviousKeyID)
+	assert.Equal(t, "v2", result.ActiveKeyID)
+	assert.False(t, result.MasterKeyRotated)
+
+	after, err := svc.Encrypt([]byte("after rotation"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(after, "v2:"))
+
+	decrypted, err := svc.Decrypt(before)
+	require.NoError(t, err)
+	assert.Equal(t, "before rotation", decrypted)
+
+	keys := svc.KeyRing().Keys()
+	require.Len(t, keys, 3)
+	assert.NotNil(t, keys[1].RetiredAt)
+	assert.True(t, keys[2].Active)
+}
+
+// TestKeyRingDecryptsLegacyCiphertext tests ciphertext written before key IDs existed
+func TestKeyRingDecryptsLegacyCiphertext(t *testing.T) {
+	block, err := aes.NewCipher([]byte(testMasterKey))
+	require.NoError(t, err)
+	gcm, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	require.NoError(t, err)
+	legacy := base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte("legacy PHI"), nil))
+
+	svc, err := NewEncryptionService(testMasterKey)
+	require.NoError(t, err)
+	_, err = svc.KeyRing().Rotate(testNextMasterKey)
+	require.NoError(t, err)
+
+	decrypted, err := svc.Decrypt(legacy)
+	require.NoError(t, err)
+	assert.Equal(t, "legacy PHI", decrypted)
+}
+
+// TestKeyRingRejectsSwappedKeyID tests that the key ID prefix is authenticated
+func TestKeyRingRejectsSwappedKeyID(t *testing.T) {
+	svc, err := NewEncryptionService(testMasterKey)
+	require.NoError(t, err)
+
+	encrypted, err := svc.Encrypt([]byte("MRN-123456"))
+	require.NoError(t, err)
+	_, err = svc.KeyRing().Rotate("")
+	require.NoError(t, err)
+
+	_, err = svc.Decrypt("v2:" + strings.TrimPrefix(encrypted, "v1:"))
+	assert.Error(t, err)
+
+	_, err = svc.Decrypt("v9:" + strings.TrimPrefix(encrypted, "v1:"))
+	assert.ErrorIs(t, err, ErrUnknownKey)
+}
+
+// TestEncryptDecryptHandlersCarryKeyMetadata tests key metadata on encrypt and key selection on decrypt
+func TestEncryptDecryptHandlersCarryKeyMetadata(t *testing.T) {
+	svc, err := NewEncryptionService(testMasterKey)
+	require.NoError(t, err)
+	previous := encryptionService
+	encryptionService = svc
+	defer func() { encryptionService = previous }()
+
+	w := httptest.NewRecorder()
+	EncryptHandler(w, httptest.NewRequest("POST", "/api/v1/encrypt", strings.NewReader(`{"data":"Patient SSN: 123-45-6789"}`)))
+	require.Equal(t, http.StatusOK, w.Code)
+	var encrypted EncryptResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&encrypted))
+	assert.Equal(t, "v1", encrypted.KeyID)
+	assert.Equal(t, AlgorithmAESGCM, encrypted.Algorithm)
+	assert.False(t, encrypted.EncryptedAt.IsZero())
+
+	_, err = svc.KeyRing().Rotate("")
+	require.NoError(t, err)
+
+	decrypt := func(req DecryptRequest) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(req)
+		w := httptest.NewRecorder()
+		DecryptHandler(w, httptest.NewRequest("POST", "/api/v1/decrypt", strings.NewReader(string(body))))
+		return w
+	}
+
+	// Ciphertext stored without its prefix, with the key ID kept alongside
+	w = decrypt(DecryptRequest{EncryptedData: strings.TrimPrefix(encrypted.EncryptedData, "v1:"), KeyID: encrypted.KeyID})
+	require.Equal(t, http.StatusOK, w.Code)
+	var decrypted DecryptResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&decrypted))
+	assert.Equal(t, "Patient SSN: 123-45-6789", decrypted.Data)
+	assert.Equal(t, "v1", decrypted.KeyID)
+	assert.False(t, decrypted.DecryptedAt.IsZero())
+
+	w = decrypt(DecryptRequest{EncryptedData: encrypted.EncryptedData, KeyID: "v2"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "sealed with v1")
+
+	w = decrypt(DecryptRequest{EncryptedData: strings.TrimPrefix(encrypted.EncryptedData, "v1:"), KeyID: "v9"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+// TestKeyRingPersistsAndRewrapsUnderNewMasterKey tests master key rotation on disk
+func TestKeyRingPersistsAndRewrapsUnderNewMasterKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.json")
+
+	ring, err := NewKeyRing(testMasterKey, path)
+	require.NoError(t, err)
+	svc := NewEncryptionServiceWithKeyRing(ring)
+	encrypted, err := svc.Encrypt([]byte("persisted PHI"))
+	require.NoError(t, err)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	result, err := ring.Rotate(testNextMasterKey)
+	require.NoError(t, err)
+	assert.True(t, result.MasterKeyRotated)
+	assert.Equal(t, 3, result.Rewrapped)
+
+	// The old master key can no longer open the ring
+	_, err = NewKeyRing(testMasterKey, path)
+	assert.ErrorIs(t, err, ErrMasterKeyMismatch)
+
+	reloaded, err := NewKeyRing(testNextMasterKey, path)
+	require.NoError(t, err)
+	activeKeyID, _ := reloaded.Active()
+	assert.Equal(t, "v2", activeKeyID)
+
+	decrypted, err := NewEncryptionServiceWithKeyRing(reloaded).Decrypt(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "persisted PHI", decrypted)
+}
+
+// TestKeyManagementRequiresAdminToken tests the admin token guard
+func TestKeyManagementRequiresAdminToken(t *testing.T) {
+	handler := requireAdminToken(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	t.Setenv("PHI_ADMIN_TOKEN", "")
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("POST", "/api/v1/keys/rotate", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	t.Setenv("PHI_ADMIN_TOKEN", "s3cret")
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/api/v1/keys/rotate", nil)
+	req.Header.Set("X-Admin-Token", "wrong")
+	handler(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	req.Header.Set("X-Admin-Token", "s3cret")
+	handler(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/healthcare-gitops/common/config"
+	"github.com/healthcare-gitops/common/health"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrorCodeKeyStoreUnavailable is the error code returned for encryptions refused
+// while the key store is unreachable
+const ErrorCodeKeyStoreUnavailable = "key_store_unavailable"
+
+// ErrKeyStoreUnavailable is returned for encryptions refused while the key store
+// holding the master key is unreachable
+var ErrKeyStoreUnavailable = errors.New("key store unavailable")
+
+const (
+	defaultKMSCheckInterval    = 10 * time.Second
+	defaultKMSFailureThreshold = 2
+)
+
+// Key store states, as reported by readiness and metrics
+const (
+	KeyStoreAvailable = "available"
+	KeyStoreDegraded  = "degraded"
+)
+
+// KeyStoreConfig configures how the service degrades when its key store is unreachable
+type KeyStoreConfig struct {
+	// CheckInterval is how often the key store is checked
+	CheckInterval time.Duration
+	// FailureThreshold is how many failed checks in a row degrade the service
+	FailureThreshold int
+	// EncryptWait is how long an encryption waits for the key store to recover
+	// before it is refused; 0 refuses at once
+	EncryptWait time.Duration
+	// EncryptQueue caps the encryptions waiting; those beyond it are refused at once
+	EncryptQueue int
+}
+
+// KeyStoreConfigFromEnv reads KMS_CHECK_INTERVAL, KMS_FAILURE_THRESHOLD,
+// KMS_ENCRYPT_WAIT and KMS_ENCRYPT_QUEUE
+func KeyStoreConfigFromEnv() KeyStoreConfig {
+	return KeyStoreConfig{
+		CheckInterval:    config.GetEnvDuration("KMS_CHECK_INTERVAL", defaultKMSCheckInterval),
+		FailureThreshold: config.GetEnvInt("KMS_FAILURE_THRESHOLD", defaultKMSFailureThreshold),
+		EncryptWait:      config.GetEnvDuration("KMS_ENCRYPT_WAIT", 5*time.Second),
+		EncryptQueue:     config.GetEnvInt("KMS_ENCRYPT_QUEUE", 50),
+	}
+}
+
+// KeyStoreMonitor degrades the service gracefully while the key store holding the
+// master key is unreachable. Data keys are unwrapped in memory at startup, so
+// decryption carries on from them. Encryption and key creation, including key
+// rotation and honeytokens, are held back: new ciphertext and new keys would be
+// bound to a master key whose rotation or revocation the service cannot see. They
+// wait in a bounded queue for the key store to recover, then are refused with 503
+// and Retry-After instead of failing opaquely. A nil monitor, for a master key from
+// a file or the environment, is always available.
+type KeyStoreMonitor struct {
+	cfg  KeyStoreConfig
+	ping func(ctx context.Context) error
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	since    time.Time
+	lastErr  error
+	// recovered is closed when the key store recovers, waking queued encryptions
+	recovered chan struct{}
+	// queue holds a slot for each waiting encryption
+	queue chan struct{}
+}
+
+// NewKeyStoreMonitor creates an available monitor checking the key store with ping
+func NewKeyStoreMonitor(cfg KeyStoreConfig, ping func(ctx context.Context) error) *KeyStoreMonitor {
+	if cfg.CheckInterval <= 0 {
+		cfg.CheckInterval = defaultKMSCheckInterval
+	}
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = defaultKMSFailureThreshold
+	}
+	if cfg.EncryptQueue < 0 {
+		cfg.EncryptQueue = 0
+	}
+	RecordKeyStoreState(KeyStoreAvailable)
+	return &KeyStoreMonitor{
+		cfg:       cfg,
+		ping:      ping,
+		state:     KeyStoreAvailable,
+		since:     time.Now(),
+		recovered: make(chan struct{}),
+		queue:     make(chan struct{}, cfg.EncryptQueue),
+	}
+}
+
+// Run checks the key store every CheckInterval until ctx is cancelled
+func (m *KeyStoreMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.cfg.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		checkCtx, cancel := context.WithTimeout(ctx, m.cfg.CheckInterval)
+		err := m.ping(checkCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		m.Record(err)
+	}
+}
+
+// Record records a check of the key store: enough failures in a row degrade the
+// service, and a success restores it
+func (m *KeyStoreMonitor) Record(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err == nil {
+		m.failures, m.lastErr = 0, nil
+		if m.state == KeyStoreDegraded {
+			log.Info().Dur("degraded_for", time.Since(m.since)).Msg("Key store reachable again, encryption resumed")
+			m.setState(KeyStoreAvailable)
+			close(m.recovered)
+		}
+		return
+	}
+	m.failures++
+	m.lastErr = err
+	if m.state == KeyStoreAvailable && m.failures >= m.cfg.FailureThreshold {
+		log.Error().Err(err).Int("failures", m.failures).Msg("Key store unreachable, serving decryptions from loaded keys and holding back encryption")
+		m.setState(KeyStoreDegraded)
+		m.recovered = make(chan struct{})
+	}
+}
+
+// setState moves to state; the caller holds m.mu
+func (m *KeyStoreMonitor) setState(state string) {
+	m.state, m.since = state, time.Now()
+	RecordKeyStoreState(state)
+}
+
+// State returns the key store's state and since when it has held
+func (m *KeyStoreMonitor) State() (string, time.Time) {
+	if m == nil {
+		return KeyStoreAvailable, time.Time{}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state, m.since
+}
+
+// Await returns once encryption may go ahead: at once while the key store is
+// available, otherwise when it recovers within EncryptWait, reporting that it waited.
+// It returns ErrKeyStoreUnavailable when the wait runs out or the queue is full, and
+// ctx's error if the caller gives up first.
+func (m *KeyStoreMonitor) Await(ctx context.Context) (bool, error) {
+	if m == nil {
+		return false, nil
+	}
+	m.mu.Lock()
+	state, recovered, lastErr := m.state, m.recovered, m.lastErr
+	m.mu.Unlock()
+	if state == KeyStoreAvailable {
+		return false, nil
+	}
+	if m.cfg.EncryptWait <= 0 {
+		return false, fmt.Errorf("%w: %v", ErrKeyStoreUnavailable, lastErr)
+	}
+
+	select {
+	case m.queue <- struct{}{}:
+		defer func() { <-m.queue }()
+	default:
+		return false, fmt.Errorf("%w: %d encryptions already waiting", ErrKeyStoreUnavailable, cap(m.queue))
+	}
+	timer := time.NewTimer(m.cfg.EncryptWait)
+	defer timer.Stop()
+	select {
+	case <-recovered:
+		return true, nil
+	case <-timer.C:
+		return true, fmt.Errorf("%w: %v", ErrKeyStoreUnavailable, lastErr)
+	case <-ctx.Done():
+		return true, ctx.Err()
+	}
+}
+
+// RetryAfter is how long a refused caller should wait before retrying: until the
+// key store's next check
+func (m *KeyStoreMonitor) RetryAfter() time.Duration {
+	if m == nil {
+		return 0
+	}
+	return m.cfg.CheckInterval
+}
+
+// Require holds back a handler that encrypts or creates keys while the key store is
+// unreachable, answering 503 with Retry-After once the request has waited its turn
+func (m *KeyStoreMonitor) Require(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		waited, err := m.Await(r.Context())
+		switch {
+		case err == nil:
+			if waited {
+				RecordDegradedOperation("resumed")
+			}
+			next(w, r)
+		case errors.Is(err, ErrKeyStoreUnavailable), errors.Is(err, context.DeadlineExceeded):
+			// A request timing out while queued is refused like one whose wait ran out
+			log.Warn().Err(err).Str("path", r.URL.Path).Msg("Encryption refused while the key store is unreachable")
+			RecordDegradedOperation("refused")
+			writeKeyStoreUnavailable(w, m.RetryAfter())
+		default:
+			// The caller hung up while queued
+			RecordDegradedOperation("abandoned")
+		}
+	}
+}
+
+// Probe reports the key store for readiness. A degraded key store only degrades the
+// service, since decryption carries on.
+func (m *KeyStoreMonitor) Probe(context.Context) error {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.state == KeyStoreAvailable {
+		return nil
+	}
+	return health.Degradation(fmt.Errorf("unreachable since %s, encryption held back: %v", m.since.UTC().Format(time.RFC3339), m.lastErr))
+}
+
+// KeyStoreUnavailableResponse is the error body returned for encryptions refused
+// while the key store is unreachable
+type KeyStoreUnavailableResponse struct {
+	Error      string `json:"error"`
+	Code       string `json:"code"`
+	RetryAfter int    `json:"retry_after_seconds"`
+}
+
+// writeKeyStoreUnavailable answers 503 with Retry-After and the
+// key_store_unavailable error code
+func writeKeyStoreUnavailable(w http.ResponseWriter, retryAfter time.Duration) {
+	seconds := int((retryAfter + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	w.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(w).Encode(KeyStoreUnavailableResponse{
+		Error:      "Encryption is unavailable while the key store is unreachable; decryption is unaffected",
+		Code:       ErrorCodeKeyStoreUnavailable,
+		RetryAfter: seconds,
+	})
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/healthcare-gitops/common/health"
+	"github.com/healthcare-gitops/common/secrets"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errVaultDown = errors.New("vault: connection refused")
+
+// encryptThrough sends an encryption through the monitor, reporting whether it reached
+// the handler
+func encryptThrough(m *KeyStoreMonitor) (*httptest.ResponseRecorder, bool) {
+	reached := false
+	handler := m.Require(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+		w.WriteHeader(http.StatusOK)
+	})
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPost, "/api/v1/encrypt", nil))
+	return w, reached
+}
+
+// TestKeyStoreMonitorRefusesEncryptionWhileDegraded tests that encryption is refused
+// with 503 and Retry-After once enough key store checks fail, and resumes on recovery
+func TestKeyStoreMonitorRefusesEncryptionWhileDegraded(t *testing.T) {
+	m := NewKeyStoreMonitor(KeyStoreConfig{CheckInterval: 3 * time.Second, FailureThreshold: 2}, nil)
+
+	// One failed check is not enough to degrade
+	m.Record(errVaultDown)
+	_, reached := encryptThrough(m)
+	assert.True(t, reached)
+	require.NoError(t, m.Probe(context.Background()))
+
+	m.Record(errVaultDown)
+	state, _ := m.State()
+	assert.Equal(t, KeyStoreDegraded, state)
+	w, reached := encryptThrough(m)
+	assert.False(t, reached)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "3", w.Header().Get("Retry-After"))
+	var body KeyStoreUnavailableResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+	assert.Equal(t, ErrorCodeKeyStoreUnavailable, body.Code)
+	err := m.Probe(context.Background())
+	assert.True(t, health.IsDegradation(err), "a degraded key store should only degrade readiness, got %v", err)
+
+	m.Record(nil)
+	_, reached = encryptThrough(m)
+	assert.True(t, reached)
+	require.NoError(t, m.Probe(context.Background()))
+}
+
+// TestKeyStoreMonitorQueuesEncryption tests that encryptions wait for the key store to
+// recover, and that those beyond the queue are refused at once
+func TestKeyStoreMonitorQueuesEncryption(t *testing.T) {
+	m := NewKeyStoreMonitor(KeyStoreConfig{FailureThreshold: 1, EncryptWait: 5 * time.Second, EncryptQueue: 1}, nil)
+	m.Record(errVaultDown)
+
+	done := make(chan bool)
+	go func() {
+		_, reached := encryptThrough(m)
+		done <- reached
+	}()
+	require.Eventually(t, func() bool { return len(m.queue) == 1 }, 2*time.Second, 5*time.Millisecond)
+
+	w, reached := encryptThrough(m)
+	assert.False(t, reached, "an encryption beyond the queue should be refused")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	m.Record(nil)
+	select {
+	case reached := <-done:
+		assert.True(t, reached, "the queued encryption should go ahead once the key store recovers")
+	case <-time.After(2 * time.Second):
+		t.Fatal("queued encryption was not released")
+	}
+}
+
+// TestKeyStoreMonitorRun tests that the monitor checks the key store on its interval
+func TestKeyStoreMonitorRun(t *testing.T) {
+	var down atomic.Bool
+	down.Store(true)
+	m := NewKeyStoreMonitor(KeyStoreConfig{CheckInterval: 10 * time.Millisecond, FailureThreshold: 2}, func(context.Context) error {
+		if down.Load() {
+			return errVaultDown
+		}
+		return nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.Run(ctx)
+
+	require.Eventually(t, func() bool {
+		state, _ := m.State()
+		return state == KeyStoreDegraded
+	}, 2*time.Second, 5*time.Millisecond)
+	down.Store(false)
+	require.Eventually(t, func() bool {
+		state, _ := m.State()
+		return state == KeyStoreAvailable
+	}, 2*time.Second, 5*time.Millisecond)
+}
+
+// TestNilKeyStoreMonitor tests that without Vault encryption is never held back
+func TestNilKeyStoreMonitor(t *testing.T) {
+	var m *KeyStoreMonitor
+	_, reached := encryptThrough(m)
+	assert.True(t, reached)
+	require.NoError(t, m.Probe(context.Background()))
+}
+
+// unreachableSecrets is a secret provider whose key store cannot be reached
+type unreachableSecrets struct{}
+
+func (unreachableSecrets) Get(context.Context, string) (secrets.Secret, error) {
+	return secrets.Secret{}, errVaultDown
+}
+
+// TestRotateKeysRefusedWhileKeyStoreUnreachable tests that key rotation is refused
+// with key_store_unavailable, not blamed on MASTER_KEY_NEXT, while the key store is
+// unreachable
+func TestRotateKeysRefusedWhileKeyStoreUnreachable(t *testing.T) {
+	previous := secretProvider
+	secretProvider = unreachableSecrets{}
+	t.Cleanup(func() { secretProvider = previous })
+
+	rotate := func(handler http.HandlerFunc) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/keys/rotate", strings.NewReader(`{"rotate_master_key":true}`))
+		handler(w, req)
+		return w
+	}
+	assertKeyStoreUnavailable := func(w *httptest.ResponseRecorder) {
+		t.Helper()
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+		var body KeyStoreUnavailableResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+		assert.Equal(t, ErrorCodeKeyStoreUnavailable, body.Code)
+	}
+
+	// Degraded, rotation is held back like any encryption
+	m := NewKeyStoreMonitor(KeyStoreConfig{FailureThreshold: 1}, nil)
+	m.Record(errVaultDown)
+	assertKeyStoreUnavailable(rotate(m.Require(RotateKeysHandler)))
+
+	// Before enough checks fail, reading MASTER_KEY_NEXT is what finds the key store down
+	assertKeyStoreUnavailable(rotate(RotateKeysHandler))
+}
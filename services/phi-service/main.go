@@ -2,17 +2,33 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/healthcare-gitops/common/apidocs"
+	"github.com/healthcare-gitops/common/audit"
+	"github.com/healthcare-gitops/common/auth"
+	"github.com/healthcare-gitops/common/changelog"
+	"github.com/healthcare-gitops/common/clientip"
+	"github.com/healthcare-gitops/common/compliance"
 	"github.com/healthcare-gitops/common/config"
+	"github.com/healthcare-gitops/common/health"
+	commonmw "github.com/healthcare-gitops/common/middleware"
+	"github.com/healthcare-gitops/common/resilience"
+	"github.com/healthcare-gitops/common/secrets"
+	"github.com/healthcare-gitops/common/selfscan"
+	"github.com/healthcare-gitops/common/tlsconfig"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -21,30 +37,267 @@ import (
 
 var (
 	encryptionService *EncryptionService
+	deidentifier      *Deidentifier
+	// keyStore holds back encryption while Vault is unreachable; nil without Vault
+	keyStore *KeyStoreMonitor
 )
 
+// phiRateLimits hold each caller to fewer decryptions and download links than other
+// requests, so a stolen token cannot bulk-export PHI
+var phiRateLimits = []string{
+	"POST /api/v1/decrypt=10:50",
+	"POST /api/v1/downloads=1:10",
+}
+
 func main() {
+	// The config file was read as the config package initialized; reading it again
+	// returns the error, reported once logging is set up
+	configErr := config.Load()
+
+	// Offline masking of exported files, without starting the server
+	if len(os.Args) > 1 && os.Args[1] == "mask" {
+		if configErr != nil {
+			fmt.Fprintln(os.Stderr, "mask:", configErr)
+			os.Exit(1)
+		}
+		os.Exit(runMaskCommand(os.Args[2:]))
+	}
+
 	// Initialize structured logging
 	initLogging()
 	log.Info().Msg("Starting PHI Encryption Service...")
 
-	// Load configuration from environment
+	// Load configuration from the environment and config file
+	if configErr != nil {
+		log.Fatal().Err(configErr).Msg("Failed to read config file")
+	}
 	port := config.GetEnv("PORT", "8083")
-	masterKey := os.Getenv("MASTER_KEY")
-	if masterKey == "" {
-		log.Fatal().Msg("MASTER_KEY environment variable is required (must be 32 bytes for AES-256)")
+	secretsCtx, stopSecrets := context.WithCancel(context.Background())
+	defer stopSecrets()
+	var vaultClient *http.Client
+	if config.GetEnv("VAULT_ADDR", "") != "" {
+		vaultClient = resilience.ClientFromEnv(dependencyVault, nil, 10*time.Second, RecordCircuitBreakerState)
 	}
-	if len(masterKey) != 32 {
-		log.Fatal().Int("length", len(masterKey)).Msg("MASTER_KEY must be exactly 32 bytes for AES-256-GCM")
+	provider, err := secrets.FromEnv("phi-service", vaultClient)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid secret provider configuration")
+	}
+	if pinger, ok := provider.(secrets.Pinger); ok && vaultClient != nil {
+		// Degrade gracefully while Vault is unreachable: decrypt from the loaded keys
+		// and hold back encryption until it recovers
+		keyStore = NewKeyStoreMonitor(KeyStoreConfigFromEnv(), pinger.Ping)
+		go keyStore.Run(secretsCtx)
+		dependencyChecks = append(dependencyChecks, health.Check{Name: "kms", Probe: keyStore.Probe})
+	}
+	secretProvider = provider
+	masterKey, err := loadMasterKey(secretsCtx, secretProvider)
+	if errors.Is(err, secrets.ErrNotFound) {
+		log.Fatal().Msg("MASTER_KEY is required (must be 32 bytes for AES-256), from Vault, a file or the environment")
+	}
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load MASTER_KEY")
+	}
+	log.Info().Str("source", masterKey.Source).Msg("Master key loaded")
+	selfScanSecrets["MASTER_KEY"] = masterKey.Value
+
+	// Load the data key ring, wrapped by the master key
+	keyRingPath := config.GetEnv("KEYRING_PATH", "")
+	if keyRingPath == "" {
+		log.Warn().Msg("KEYRING_PATH not set, rotated keys will not survive a restart")
+	}
+	keyRing, err := NewKeyRing(masterKey.Value, keyRingPath)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load key ring")
+	}
+
+	// Keep the Vault token alive and pick up a rotated master key without a restart
+	go secrets.KeepAlive(secretsCtx, secretProvider, 30*time.Second, func(err error) {
+		log.Error().Err(err).Msg("Vault token renewal failed")
+	})
+	if interval := secretReloadInterval(); interval > 0 && masterKey.Source != secrets.SourceEnv {
+		go watchMasterKey(secretsCtx, secretProvider, keyRing, masterKey, interval)
 	}
 
 	// Initialize encryption service
-	var err error
-	encryptionService, err = NewEncryptionService(masterKey)
+	encryptionService = NewEncryptionServiceWithKeyRing(keyRing)
+	activeKeyID, _ := keyRing.Active()
+	log.Info().Str("active_key_id", activeKeyID).Msg("Encryption service initialized")
+
+	// Append-only, hash-chained record of every use of PHI key material
+	auditLogPath := config.GetEnv("AUDIT_LOG_PATH", "")
+	if auditLogPath == "" {
+		log.Warn().Msg("AUDIT_LOG_PATH not set, the PHI access audit log will not survive a restart")
+	}
+	if accessAudit, err = NewAccessAuditLog(auditLogPath); err != nil {
+		log.Fatal().Err(err).Msg("Failed to open PHI access audit log")
+	}
+
+	// Rotate data keys on schedule (0 disables)
+	rotationCtx, stopRotation := context.WithCancel(context.Background())
+	defer stopRotation()
+	rotationHours := config.GetEnvInt("KEY_ROTATION_INTERVAL_HOURS", 720)
+	if !featureFlags.Enabled(FeatureKeyRotation) {
+		rotationHours = 0
+	} else if rotationHours <= 0 {
+		featureFlags.Unavailable(FeatureKeyRotation, "KEY_ROTATION_INTERVAL_HOURS is 0")
+	}
+	startKeyRotation(rotationCtx, keyRing, time.Duration(rotationHours)*time.Hour)
+
+	// Safe Harbor de-identification rules for the anonymize endpoint
+	deidRules, err := loadDeidRules(config.GetEnv("DEID_RULES_PATH", ""))
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load de-identification rules")
+	}
+	pseudonymKey := []byte(os.Getenv("DEID_PSEUDONYM_KEY"))
+	if len(pseudonymKey) == 0 {
+		log.Warn().Msg("DEID_PSEUDONYM_KEY not set, pseudonyms will change on restart")
+		pseudonymKey = make([]byte, 32)
+		if _, err := rand.Read(pseudonymKey); err != nil {
+			log.Fatal().Err(err).Msg("Failed to generate pseudonym key")
+		}
+	}
+	if deidentifier, err = NewDeidentifier(deidRules, pseudonymKey); err != nil {
+		log.Fatal().Err(err).Msg("Failed to compile de-identification rules")
+	}
+
+	// Identifier hashing: HMAC-SHA256 by default, Argon2id and plain SHA-256 on request
+	var hashKey []byte
+	if secret, err := secretProvider.Get(context.Background(), "HASH_KEY"); err == nil {
+		hashKey = []byte(secret.Value)
+		selfScanSecrets["HASH_KEY"] = secret.Value
+	} else {
+		log.Warn().Msg("HASH_KEY not set, keyed hashes will change on restart")
+		hashKey = make([]byte, 32)
+		if _, err := rand.Read(hashKey); err != nil {
+			log.Fatal().Err(err).Msg("Failed to generate hash key")
+		}
+	}
+	argon2Params, err := loadArgon2Params()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid Argon2id parameters")
+	}
+	hasher, err = NewHasher(hashKey, config.GetEnv("HASH_DEFAULT_ALGORITHM", HashHMACSHA256), argon2Params, config.GetEnvInt("HASH_ARGON2_CONCURRENCY", 4))
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to initialize hashing")
+	}
+
+	// Optional TLS; with TLS_CLIENT_CA_FILE set, clients must present a certificate
+	// from the internal CA
+	tlsCfg := tlsconfig.FromEnv()
+	if tlsCfg.MutualTLS() {
+		log.Info().Str("client_auth", tlsCfg.ClientAuth).Strs("allowed_clients", tlsCfg.AllowedClients).Msg("Mutual TLS enabled")
+	} else if tlsCfg.Enabled() {
+		log.Info().Msg("TLS enabled")
+	}
+
+	// Bearer tokens are validated by auth-service. PHI operations require a phi:write
+	// token and decryption a phi:read token.
+	var introspector *auth.Introspector
+	authCfg := auth.ConfigFromEnv()
+	authCfg.OnCacheLookup = RecordAuthCacheLookup
+	if tlsCfg.Enabled() {
+		// Calls to auth-service present this service's certificate
+		if authCfg.HTTPClient, err = tlsCfg.HTTPClient(5 * time.Second); err != nil {
+			log.Fatal().Err(err).Msg("Invalid TLS configuration")
+		}
+	}
+	if authCfg.IntrospectURL != "" {
+		addDependencyCheck(dependencyAuthService, authCfg.IntrospectURL, authCfg.HTTPClient)
+		authCfg.HTTPClient = resilience.ClientFromEnv(dependencyAuthService, authCfg.HTTPClient, 5*time.Second, RecordCircuitBreakerState)
+		introspector = auth.NewIntrospector(authCfg)
+	} else {
+		log.Warn().Msg("AUTH_INTROSPECT_URL not set, PHI operations are not authenticated and decryption is disabled")
+	}
+	if introspector != nil && featureFlags.Enabled(FeatureDecrypt) {
+		decryptIntrospector = introspector
+		log.Info().Str("introspect_url", authCfg.IntrospectURL).Msg("Decrypt authorization enabled")
+	} else if introspector == nil {
+		featureFlags.Unavailable(FeatureDecrypt, "AUTH_INTROSPECT_URL not set")
+	}
+
+	// Event topic keys require an events:keys token validated by auth-service
+	if introspector != nil && featureFlags.Enabled(FeatureTopicKeys) {
+		topicKeyIntrospector = introspector
+		log.Info().Msg("Event topic keys enabled")
+	} else if introspector == nil {
+		featureFlags.Unavailable(FeatureTopicKeys, "AUTH_INTROSPECT_URL not set")
+	}
+
+	// Masking jobs for cloning production exports into non-production environments
+	maskingProfiles, err := loadMaskingProfiles(config.GetEnv("MASKING_PROFILES_PATH", ""))
 	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to initialize encryption service")
+		log.Fatal().Err(err).Msg("Failed to load masking profiles")
+	}
+	exportDir, outputDir := config.GetEnv("MASKING_EXPORT_DIR", ""), config.GetEnv("MASKING_OUTPUT_DIR", "")
+	if exportDir == "" || outputDir == "" {
+		featureFlags.Unavailable(FeatureMaskingJobs, "MASKING_EXPORT_DIR and MASKING_OUTPUT_DIR not set")
+	} else if featureFlags.Enabled(FeatureMaskingJobs) {
+		maskingJobs, err = NewMaskingJobManager(exportDir, outputDir, maskingProfiles, []byte(os.Getenv("MASKING_SECRET")))
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to initialize masking jobs")
+		}
+		log.Info().Str("export_dir", exportDir).Str("output_dir", outputDir).Int("profiles", len(maskingProfiles)).Msg("Masking jobs enabled")
+	}
+
+	// Data subject request automation across the services listed in DSAR_CONNECTORS_PATH
+	if connectorsPath := config.GetEnv("DSAR_CONNECTORS_PATH", ""); connectorsPath == "" {
+		featureFlags.Unavailable(FeatureDSAR, "DSAR_CONNECTORS_PATH not set")
+	} else if featureFlags.Enabled(FeatureDSAR) {
+		connectors, err := loadDSARConnectors(connectorsPath)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to load DSAR connectors")
+		}
+		dsarRequests = NewDSARManager(connectors, os.Getenv("DSAR_CONNECTOR_TOKEN"), 30*time.Second)
+		janitor.Register("dsar_request", dsarRequests.ReclaimSynthetic)
+		log.Info().Int("connectors", len(connectors)).Msg("Data subject request automation enabled")
+	}
+
+	// Decoy PHI whose decryption is reported to the SOC
+	if featureFlags.Enabled(FeatureHoneytokens) {
+		var err error
+		if honeytokens, err = openHoneytokens(); err != nil {
+			log.Fatal().Err(err).Msg("Failed to open honeytoken registry")
+		}
+		log.Info().Int("honeytokens", len(honeytokens.Tokens())).Msg("Honeytoken detection enabled")
+	}
+
+	// Patient consent, checked before a patient's PHI is decrypted or tokenized
+	if featureFlags.Enabled(FeatureConsent) {
+		var err error
+		if consents, err = openConsents(); err != nil {
+			log.Fatal().Err(err).Msg("Failed to open consent store")
+		}
+		log.Info().Msg("Patient consent checks enabled")
+	}
+
+	// Signed, expiring download links for DSAR exports and masking output
+	if downloadsDir := config.GetEnv("DOWNLOADS_DIR", ""); downloadsDir == "" || introspector == nil {
+		featureFlags.Unavailable(FeatureDownloadLinks, "DOWNLOADS_DIR or AUTH_INTROSPECT_URL not set")
+	} else if featureFlags.Enabled(FeatureDownloadLinks) {
+		store, err := NewFileObjectStore(downloadsDir)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to open downloads directory")
+		}
+		var signingKey []byte
+		if secret, err := secretProvider.Get(context.Background(), "DOWNLOAD_SIGNING_KEY"); err == nil {
+			signingKey = []byte(secret.Value)
+			selfScanSecrets["DOWNLOAD_SIGNING_KEY"] = secret.Value
+		} else {
+			log.Warn().Msg("DOWNLOAD_SIGNING_KEY not set, download links will stop working on restart")
+			signingKey = make([]byte, 32)
+			if _, err := rand.Read(signingKey); err != nil {
+				log.Fatal().Err(err).Msg("Failed to generate download signing key")
+			}
+		}
+		downloadLinks = NewDownloadLinks(store, signingKey, config.GetEnv("DOWNLOAD_BASE_URL", ""))
+		downloadIntrospector = introspector
+		log.Info().Str("downloads_dir", downloadsDir).Msg("Download links enabled")
+	}
+
+	// Live encryption attestation for compliance reporting
+	if err := configureEncryptionAttestation(keyRing, masterKey.Source, time.Duration(rotationHours)*time.Hour); err != nil {
+		log.Fatal().Err(err).Msg("Invalid encryption attestation configuration")
 	}
-	log.Info().Msg("Encryption service initialized")
 
 	// Initialize OpenTelemetry tracing (stub for lightweight deployment)
 	if err := InitTracerProvider("phi-service"); err != nil {
@@ -59,33 +312,142 @@ func main() {
 		log.Info().Msg("OpenTelemetry tracing initialized (stub mode)")
 	}
 
+	// Shared audit bus for PHI mutations and key material access
+	if err := configureAuditEvents(context.Background()); err != nil {
+		log.Fatal().Err(err).Msg("Failed to open audit sink")
+	}
+	log.Info().Str("sink", config.GetEnv("AUDIT_SINK", audit.SinkStdout)).Msg("Audit events enabled")
+
+	// Decryptions are streamed to the event broker, when one is configured
+	if err := configureEventStream(); err != nil {
+		log.Fatal().Err(err).Msg("Failed to open event broker")
+	}
+
+	changes, err := newChangelog()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid API changelog")
+	}
+	docs, err := apidocs.New(openAPISpec, apiSpecVersion)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid OpenAPI document")
+	}
+
+	// X-Forwarded-For is believed only from the ingress and other trusted proxies
+	proxies, err := clientip.FromEnv()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid TRUSTED_PROXIES")
+	}
+
+	rateLimits := commonmw.RateLimitConfigFromEnv("phi-service", phiRateLimits...)
+	rateLimits.OnStoreError = func(err error) {
+		log.Warn().Err(err).Msg("Rate limit store unavailable, limiting per replica")
+	}
+	rateLimits.Identify = introspector.Verified
+	rateLimits.TrustedProxies = proxies
+	limiter, err := commonmw.NewRateLimiter(rateLimits)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid rate limit configuration")
+	}
+
 	// Setup HTTP router
 	r := chi.NewRouter()
 
 	// Middleware stack
-	r.Use(middleware.Recoverer)                 // Panic recovery
-	r.Use(middleware.RealIP)                    // Get real client IP
-	r.Use(middleware.RequestID)                 // Generate request ID
-	r.Use(LoggingMiddleware)                    // Structured logging
-	r.Use(TracingMiddleware)                    // OpenTelemetry tracing
-	r.Use(PrometheusMiddleware)                 // Prometheus metrics
-	r.Use(CORSMiddleware)                       // CORS support
-	r.Use(middleware.Compress(5))               // Gzip compression
-	r.Use(middleware.Timeout(30 * time.Second)) // Request timeout
+	r.Use(middleware.Recoverer)               // Panic recovery
+	r.Use(proxies.Middleware)                 // Get real client IP
+	r.Use(middleware.RequestID)               // Generate request ID
+	r.Use(tlsconfig.Middleware)               // mTLS client identity
+	r.Use(LoggingMiddleware)                  // Structured logging
+	r.Use(TracingMiddleware)                  // OpenTelemetry tracing
+	r.Use(auditMiddleware(auditEvents))       // Audit events for mutations
+	r.Use(PrometheusMiddleware)               // Prometheus metrics
+	r.Use(CORSMiddleware)                     // CORS support
+	r.Use(limiter.Middleware)                 // Per-caller and per-route rate limits
+	r.Use(middleware.Compress(5))             // Gzip compression
+	r.Use(middleware.Timeout(requestTimeout)) // Request timeout
 
 	// Health & readiness endpoints
 	r.Get("/health", HealthHandler)
 	r.Get("/ready", ReadyHandler)
+	r.Get("/readiness", ReadyHandler)
+	r.Get("/capabilities", CapabilitiesHandler)
+	r.Get("/changelog", changelog.Handler(changes))
+	r.Get("/openapi.json", docs.SpecHandler)
+	r.Get("/docs", docs.DocsHandler)
 
 	// Metrics endpoint
 	r.Handle("/metrics", promhttp.Handler())
 
+	// Security misconfiguration self-scan (admin only)
+	r.Get("/admin/selfscan", requireAdminToken(selfscan.Handler(func() selfscan.Target {
+		return selfScanTarget(r)
+	})))
+
+	// The anonymous usage stats this install sends, or would send if opted in
+	r.Get("/admin/usage-stats", requireAdminToken(usageStats.Handler()))
+
+	// HIPAA controls checked live, for the compliance posture report (admin only)
+	r.Get("/compliance/status", requireAdminToken(compliance.Handler(func(req *http.Request) compliance.Status {
+		return complianceStatus(req.Context(), introspector != nil)
+	})))
+
 	// API routes
 	r.Route("/api/v1", func(r chi.Router) {
-		r.Post("/encrypt", EncryptHandler)
-		r.Post("/decrypt", DecryptHandler)
-		r.Post("/hash", HashHandler)
-		r.Post("/anonymize", AnonymizeHandler)
+		// PHI operations; phi:write tokens only
+		r.With(introspector.Require("phi:write")).Post("/encrypt", keyStore.Require(EncryptHandler))
+		r.With(introspector.Require("phi:write")).Post("/hash", HashHandler)
+		r.With(introspector.Require("phi:write")).Post("/anonymize", AnonymizeHandler)
+		r.With(introspector.Require("phi:write")).Post("/blind-index", featureFlags.Require(FeatureBlindIndex, BlindIndexHandler))
+		r.Post("/decrypt", requireDecryptAuthorization(DecryptHandler))
+
+		// Key management (admin only)
+		r.Get("/keys", requireAdminToken(ListKeysHandler))
+		r.Post("/keys/rotate", requireAdminToken(keyStore.Require(RotateKeysHandler)))
+		r.Delete("/keys/patient/{patientID}", requireAdminToken(featureFlags.Require(FeaturePatientKeys, DestroyPatientKeyHandler)))
+
+		// PHI access audit log and decrypt authorization trail (admin only)
+		r.Get("/audit", requireAdminToken(ListAccessAuditHandler))
+		r.Get("/audit/verify", requireAdminToken(VerifyAccessAuditHandler))
+		r.Get("/audit/decryptions", requireAdminToken(ListDecryptAuditHandler))
+
+		// Data masking for non-production clones (admin only)
+		r.Get("/masking/profiles", requireAdminToken(requireMaskingJobs(ListMaskingProfilesHandler)))
+		r.Post("/masking/jobs", requireAdminToken(requireMaskingJobs(StartMaskingJobHandler)))
+		r.Get("/masking/jobs", requireAdminToken(requireMaskingJobs(ListMaskingJobsHandler)))
+		r.Get("/masking/jobs/{jobID}", requireAdminToken(requireMaskingJobs(GetMaskingJobHandler)))
+
+		// GDPR/CCPA data subject requests (admin only)
+		r.Post("/dsar", requireAdminToken(requireDSAR(SubmitDSARHandler)))
+		r.Get("/dsar", requireAdminToken(requireDSAR(ListDSARHandler)))
+		r.Get("/dsar/report", requireAdminToken(requireDSAR(DSARReportHandler)))
+		r.Get("/dsar/{requestID}", requireAdminToken(requireDSAR(GetDSARHandler)))
+		r.Post("/dsar/{requestID}/verify", requireAdminToken(requireDSAR(VerifyDSARHandler)))
+		r.Post("/dsar/{requestID}/retry", requireAdminToken(requireDSAR(RetryDSARHandler)))
+		r.Get("/dsar/{requestID}/export", requireAdminToken(requireDSAR(GetDSARExportHandler)))
+
+		// Patient consent to the use of their data, per purpose of use
+		r.With(introspector.Require("phi:write")).Post("/consents", featureFlags.Require(FeatureConsent, RecordConsentHandler))
+		r.With(introspector.Require(decryptScope)).Get("/consents/{patientID}", featureFlags.Require(FeatureConsent, GetConsentHandler))
+
+		// Signed download links; creation is scope-checked, the signature authorizes downloads
+		r.Post("/downloads", featureFlags.Require(FeatureDownloadLinks, CreateDownloadLinkHandler))
+		r.Get("/downloads/{linkID}", featureFlags.Require(FeatureDownloadLinks, DownloadHandler))
+
+		// Event payload keys per topic; events:keys tokens only
+		r.Get("/topic-keys/{topic}", featureFlags.Require(FeatureTopicKeys, TopicKeyHandler))
+		r.Get("/topic-keys/{topic}/{keyID}", featureFlags.Require(FeatureTopicKeys, TopicKeyHandler))
+
+		// Decoy PHI for intrusion detection (admin only)
+		r.Post("/honeytokens", requireAdminToken(featureFlags.Require(FeatureHoneytokens, keyStore.Require(CreateHoneytokensHandler))))
+		r.Get("/honeytokens", requireAdminToken(featureFlags.Require(FeatureHoneytokens, ListHoneytokensHandler)))
+		r.Get("/honeytokens/alerts", requireAdminToken(featureFlags.Require(FeatureHoneytokens, honeytokens.AlertsHandler())))
+
+		// Encryption in transit and at rest, verified live (admin only)
+		r.Get("/compliance/encryption", requireAdminToken(EncryptionAttestationHandler))
+
+		// Expired synthetic data cleanup (admin only)
+		r.Get("/synthetic/cleanup", requireAdminToken(janitor.Handler()))
+		r.Post("/synthetic/cleanup", requireAdminToken(janitor.Handler()))
 	})
 
 	// Start HTTP server
@@ -101,11 +463,17 @@ func main() {
 	// Start server in goroutine
 	go func() {
 		log.Info().Str("address", addr).Msg("HTTP server starting")
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := tlsconfig.ListenAndServe(server, tlsCfg); err != nil && err != http.ErrServerClosed {
 			log.Fatal().Err(err).Msg("HTTP server failed")
 		}
 	}()
 
+	// Remove synthetic records left behind by tests
+	go startSyntheticCleanup(context.Background())
+
+	// Opt-in anonymous usage stats for the platform team
+	go startUsageStats(context.Background())
+
 	// Wait for interrupt signal for graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -120,6 +488,12 @@ func main() {
 	if err := server.Shutdown(shutdownCtx); err != nil {
 		log.Error().Err(err).Msg("Server forced to shutdown")
 	}
+	if err := auditEvents.Close(shutdownCtx); err != nil {
+		log.Error().Err(err).Msg("Failed to flush audit events")
+	}
+	if err := eventStream.Close(shutdownCtx); err != nil {
+		log.Error().Err(err).Msg("Failed to flush streamed events")
+	}
 
 	log.Info().Msg("Server shutdown complete")
 }
@@ -127,7 +501,7 @@ func main() {
 // initLogging configures structured logging with zerolog
 func initLogging() {
 	// Pretty logging for development
-	if os.Getenv("ENV") == "development" {
+	if config.GetEnv("ENV", "") == "development" {
 		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339})
 	} else {
 		// JSON logging for production
@@ -135,7 +509,7 @@ func initLogging() {
 	}
 
 	// Set log level
-	logLevel := os.Getenv("LOG_LEVEL")
+	logLevel := config.GetEnv("LOG_LEVEL", "")
 	switch logLevel {
 	case "debug":
 		zerolog.SetGlobalLevel(zerolog.DebugLevel)
@@ -160,56 +534,70 @@ func HealthHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// ReadyHandler handles readiness check endpoint
+// ReadyHandler reports whether the encryption service and its dependencies are up
 func ReadyHandler(w http.ResponseWriter, r *http.Request) {
-	// Check if encryption service is initialized
-	if encryptionService == nil {
-		w.WriteHeader(http.StatusServiceUnavailable)
-		json.NewEncoder(w).Encode(map[string]string{
-			"status": "not ready",
-			"reason": "encryption service not initialized",
-		})
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{
-		"status":  "ready",
-		"service": "phi-service",
-	})
+	health.Write(w, readiness().Run(r.Context()))
 }
 
-// EncryptRequest represents encryption request payload
+// EncryptRequest represents encryption request payload. Mode "fpe" selects
+// format-preserving encryption of a value in the given format.
 type EncryptRequest struct {
-	Data string `json:"data"`
+	Data      string `json:"data"`
+	Mode      string `json:"mode,omitempty"`
+	Format    string `json:"format,omitempty"`
+	Algorithm string `json:"algorithm,omitempty"`
+	Tweak     string `json:"tweak,omitempty"`
+	// PatientID encrypts under the patient's own key, so the data can be erased by
+	// destroying it (standard mode only)
+	PatientID string `json:"patient_id,omitempty"`
 }
 
-// EncryptResponse represents encryption response payload
+// EncryptResponse represents encryption response payload. The key ID is always
+// returned, since format-preserving ciphertext cannot carry it.
 type EncryptResponse struct {
-	EncryptedData string `json:"encrypted_data"`
-	RequestID     string `json:"request_id,omitempty"`
+	EncryptedData string    `json:"encrypted_data"`
+	Mode          string    `json:"mode,omitempty"`
+	KeyID         string    `json:"key_id"`
+	Algorithm     string    `json:"algorithm"`
+	EncryptedAt   time.Time `json:"encrypted_at"`
+	RequestID     string    `json:"request_id,omitempty"`
 }
 
-// DecryptRequest represents decryption request payload
+// DecryptRequest represents decryption request payload. FPE values need the format,
+// algorithm and tweak they were encrypted with, and the key ID once keys have rotated.
+// Standard ciphertext stored without its "<key id>:" prefix needs the key ID too.
 type DecryptRequest struct {
 	EncryptedData string `json:"encrypted_data"`
+	Mode          string `json:"mode,omitempty"`
+	Format        string `json:"format,omitempty"`
+	Algorithm     string `json:"algorithm,omitempty"`
+	Tweak         string `json:"tweak,omitempty"`
+	KeyID         string `json:"key_id,omitempty"`
+	// PatientID checks the patient's consent for the request's purpose of use before
+	// decrypting
+	PatientID string `json:"patient_id,omitempty"`
 }
 
 // DecryptResponse represents decryption response payload
 type DecryptResponse struct {
-	Data      string `json:"data"`
-	RequestID string `json:"request_id,omitempty"`
+	Data        string    `json:"data"`
+	KeyID       string    `json:"key_id"`
+	DecryptedAt time.Time `json:"decrypted_at"`
+	RequestID   string    `json:"request_id,omitempty"`
 }
 
 // HashRequest represents hash request payload
 type HashRequest struct {
-	Data string `json:"data"`
+	Data      string `json:"data"`
+	Salt      string `json:"salt,omitempty"`
+	Algorithm string `json:"algorithm,omitempty"` // sha256, hmac-sha256 or argon2id; HASH_DEFAULT_ALGORITHM when empty
 }
 
 // HashResponse represents hash response payload
 type HashResponse struct {
 	Hash      string `json:"hash"`
+	Algorithm string `json:"algorithm"`
+	Params    string `json:"params,omitempty"`
 	RequestID string `json:"request_id,omitempty"`
 }
 
@@ -227,28 +615,106 @@ func EncryptHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Encrypt data
-	encrypted, err := encryptionService.Encrypt([]byte(req.Data))
+	op := "encrypt"
+	var encrypted, keyID string
+	var err error
+	switch {
+	case req.PatientID != "" && req.Mode == ModeFPE:
+		http.Error(w, "patient_id is only supported in standard mode", http.StatusBadRequest)
+		RecordEncryptionOp("encrypt_fpe", "error", time.Since(start).Seconds(), len(req.Data))
+		return
+	case req.PatientID != "" && !featureFlags.Enabled(FeaturePatientKeys):
+		http.Error(w, "patient keys are not enabled on this deployment", http.StatusBadRequest)
+		RecordEncryptionOp(op, "error", time.Since(start).Seconds(), len(req.Data))
+		return
+	}
+	if req.PatientID != "" {
+		// Tokenizing a patient's PHI is checked against the purpose the caller asserts,
+		// treatment when none is given
+		purpose := strings.ToUpper(strings.TrimSpace(r.Header.Get(PurposeOfUseHeader)))
+		if purpose == "" {
+			purpose = defaultTokenizePurpose
+		}
+		if _, ok := purposesOfUse[purpose]; !ok {
+			http.Error(w, "Unknown purpose of use "+strconv.Quote(purpose), http.StatusBadRequest)
+			RecordEncryptionOp(op, "error", time.Since(start).Seconds(), len(req.Data))
+			return
+		}
+		if err := checkConsent(req.PatientID, purpose); err != nil {
+			auditAccess(r, op, "", dataTypeFor(req.Mode, req.Format), AccessDenied)
+			writeConsentRefused(w, purpose, err)
+			RecordEncryptionOp(op, "error", time.Since(start).Seconds(), len(req.Data))
+			return
+		}
+	}
+	switch req.Mode {
+	case "", ModeStandard:
+		if req.PatientID != "" {
+			encrypted, err = encryptionService.EncryptForPatient([]byte(req.Data), req.PatientID)
+		} else {
+			encrypted, err = encryptionService.Encrypt([]byte(req.Data))
+		}
+	case ModeFPE:
+		if !featureFlags.Enabled(FeatureFPE) {
+			http.Error(w, "fpe mode is not enabled on this deployment", http.StatusBadRequest)
+			RecordEncryptionOp("encrypt_fpe", "error", time.Since(start).Seconds(), len(req.Data))
+			return
+		}
+		op = "encrypt_fpe"
+		encrypted, keyID, err = encryptionService.EncryptFPE(req.Data, FPEOptions{Format: req.Format, Algorithm: req.Algorithm, Tweak: req.Tweak})
+	default:
+		http.Error(w, "mode must be standard or fpe", http.StatusBadRequest)
+		RecordEncryptionOp("encrypt", "error", time.Since(start).Seconds(), len(req.Data))
+		return
+	}
+	if err == nil && req.Mode != ModeFPE {
+		keyID = ciphertextKeyID(encrypted)
+	}
+	if errors.Is(err, ErrFPEInput) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		RecordEncryptionOp(op, "error", time.Since(start).Seconds(), len(req.Data))
+		return
+	}
+	if errors.Is(err, ErrKeyErased) {
+		writeKeyErased(w, "")
+		RecordEncryptionOp(op, "error", time.Since(start).Seconds(), len(req.Data))
+		return
+	}
 	if err != nil {
 		log.Error().Err(err).Msg("Encryption failed")
 		http.Error(w, "Encryption failed", http.StatusInternalServerError)
-		RecordEncryptionOp("encrypt", "error", time.Since(start).Seconds(), len(req.Data))
+		RecordEncryptionOp(op, "error", time.Since(start).Seconds(), len(req.Data))
+		auditAccess(r, op, keyID, dataTypeFor(req.Mode, req.Format), AccessFailed)
 		span.RecordError(err)
 		return
 	}
+	if err := auditAccess(r, op, keyID, dataTypeFor(req.Mode, req.Format), AccessSucceeded); err != nil {
+		http.Error(w, "Encryption failed: access could not be audited", http.StatusInternalServerError)
+		RecordEncryptionOp(op, "error", time.Since(start).Seconds(), len(req.Data))
+		return
+	}
 
 	// Record metrics
 	duration := time.Since(start).Seconds()
-	RecordEncryptionOp("encrypt", "success", duration, len(req.Data))
+	RecordEncryptionOp(op, "success", duration, len(req.Data))
 
 	// Get request ID from context
 	reqID := middleware.GetReqID(ctx)
 
 	// Send response
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(EncryptResponse{
+	resp := EncryptResponse{
 		EncryptedData: encrypted,
+		KeyID:         keyID,
+		Algorithm:     AlgorithmAESGCM,
+		EncryptedAt:   time.Now().UTC(),
 		RequestID:     reqID,
-	})
+	}
+	if req.Mode == ModeFPE {
+		resp.Mode = ModeFPE
+		resp.Algorithm = FPEOptions{Algorithm: req.Algorithm}.algorithm()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
 }
 
 // DecryptHandler handles decryption requests
@@ -265,18 +731,89 @@ func DecryptHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Decrypt data
-	decrypted, err := encryptionService.Decrypt(req.EncryptedData)
+	op := "decrypt"
+	if req.Mode == ModeFPE {
+		op = "decrypt_fpe"
+	}
+	keyID := req.KeyID
+	switch {
+	case req.Mode == ModeFPE && keyID == "":
+		keyID, _ = encryptionService.KeyRing().Active()
+	case req.Mode != ModeFPE && (keyID == "" || strings.Contains(req.EncryptedData, ":")):
+		keyID = ciphertextKeyID(req.EncryptedData)
+	}
+	// Ciphertext under a patient key belongs to that patient, whatever the request
+	// says: their consent is checked even when patient_id is left out
+	patientID := req.PatientID
+	if owner, ok := encryptionService.KeyRing().KeyPatient(keyID); ok {
+		if patientID != "" && patientID != owner {
+			auditAccess(r, op, keyID, dataTypeFor(req.Mode, req.Format), AccessDenied)
+			http.Error(w, "patient_id does not match the patient the data was encrypted for", http.StatusBadRequest)
+			RecordEncryptionOp(op, "error", time.Since(start).Seconds(), len(req.EncryptedData))
+			return
+		}
+		patientID = owner
+	}
+	if patientID != "" {
+		var purpose string
+		if rec, ok := r.Context().Value(decryptAuthorizationKey{}).(DecryptAuditRecord); ok {
+			purpose = rec.PurposeOfUse
+		}
+		if err := checkConsent(patientID, purpose); err != nil {
+			auditAccess(r, op, keyID, dataTypeFor(req.Mode, req.Format), AccessDenied)
+			writeConsentRefused(w, purpose, err)
+			RecordEncryptionOp(op, "error", time.Since(start).Seconds(), len(req.EncryptedData))
+			return
+		}
+	}
+	var decrypted string
+	var err error
+	switch req.Mode {
+	case "", ModeStandard:
+		decrypted, err = encryptionService.DecryptWithKeyID(req.EncryptedData, req.KeyID)
+	case ModeFPE:
+		if !featureFlags.Enabled(FeatureFPE) {
+			http.Error(w, "fpe mode is not enabled on this deployment", http.StatusBadRequest)
+			RecordEncryptionOp("decrypt_fpe", "error", time.Since(start).Seconds(), len(req.EncryptedData))
+			return
+		}
+		decrypted, err = encryptionService.DecryptFPE(req.EncryptedData, req.KeyID, FPEOptions{Format: req.Format, Algorithm: req.Algorithm, Tweak: req.Tweak})
+	default:
+		http.Error(w, "mode must be standard or fpe", http.StatusBadRequest)
+		RecordEncryptionOp("decrypt", "error", time.Since(start).Seconds(), len(req.EncryptedData))
+		return
+	}
+	if errors.Is(err, ErrFPEInput) || errors.Is(err, ErrUnknownKey) || errors.Is(err, ErrKeyIDMismatch) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		RecordEncryptionOp(op, "error", time.Since(start).Seconds(), len(req.EncryptedData))
+		return
+	}
+	if errors.Is(err, ErrKeyErased) {
+		auditAccess(r, op, keyID, dataTypeFor(req.Mode, req.Format), AccessFailed)
+		writeKeyErased(w, keyID)
+		RecordEncryptionOp(op, "error", time.Since(start).Seconds(), len(req.EncryptedData))
+		return
+	}
 	if err != nil {
 		log.Error().Err(err).Msg("Decryption failed")
 		http.Error(w, "Decryption failed", http.StatusInternalServerError)
-		RecordEncryptionOp("decrypt", "error", time.Since(start).Seconds(), len(req.EncryptedData))
+		RecordEncryptionOp(op, "error", time.Since(start).Seconds(), len(req.EncryptedData))
+		auditAccess(r, op, keyID, dataTypeFor(req.Mode, req.Format), AccessFailed)
 		span.RecordError(err)
 		return
 	}
+	// Plaintext is only released once the access is on the audit record
+	if err := auditAccess(r, op, keyID, dataTypeFor(req.Mode, req.Format), AccessSucceeded); err != nil {
+		http.Error(w, "Decryption failed: access could not be audited", http.StatusInternalServerError)
+		RecordEncryptionOp(op, "error", time.Since(start).Seconds(), len(req.EncryptedData))
+		return
+	}
+	streamDecrypted(r, req.Mode, keyID, dataTypeFor(req.Mode, req.Format))
+	checkHoneytoken(r, decrypted, op)
 
 	// Record metrics
 	duration := time.Since(start).Seconds()
-	RecordEncryptionOp("decrypt", "success", duration, len(req.EncryptedData))
+	RecordEncryptionOp(op, "success", duration, len(req.EncryptedData))
 
 	// Get request ID from context
 	reqID := middleware.GetReqID(ctx)
@@ -284,8 +821,10 @@ func DecryptHandler(w http.ResponseWriter, r *http.Request) {
 	// Send response
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(DecryptResponse{
-		Data:      string(decrypted),
-		RequestID: reqID,
+		Data:        string(decrypted),
+		KeyID:       keyID,
+		DecryptedAt: time.Now().UTC(),
+		RequestID:   reqID,
 	})
 }
 
@@ -303,7 +842,12 @@ func HashHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Hash data
-	hash, err := encryptionService.Hash([]byte(req.Data))
+	result, err := hasher.Hash(ctx, []byte(req.Data), req.Algorithm, req.Salt)
+	if err != nil && (errors.Is(err, errUnknownHashAlgorithm) || errors.Is(err, errHashSaltTooShort)) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		RecordEncryptionOp("hash", "error", time.Since(start).Seconds(), len(req.Data))
+		return
+	}
 	if err != nil {
 		log.Error().Err(err).Msg("Hashing failed")
 		http.Error(w, "Hashing failed", http.StatusInternalServerError)
@@ -322,23 +866,43 @@ func HashHandler(w http.ResponseWriter, r *http.Request) {
 	// Send response
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(HashResponse{
-		Hash:      hash,
+		Hash:      result.Hash,
+		Algorithm: result.Algorithm,
+		Params:    result.Params,
 		RequestID: reqID,
 	})
 }
 
-// AnonymizeHandler handles anonymization requests (hash with random salt)
+// AnonymizeRequest represents an anonymization request. A document is de-identified
+// under HIPAA Safe Harbor; data alone is hashed with a random salt.
+type AnonymizeRequest struct {
+	Data     string          `json:"data,omitempty"`
+	Document json.RawMessage `json:"document,omitempty"`
+	Method   string          `json:"method,omitempty"`
+}
+
+// AnonymizeHandler handles anonymization requests (hash with random salt, or
+// de-identification of a JSON document)
 func AnonymizeHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	span := trace.SpanFromContext(ctx)
 	start := time.Now()
 
-	var req HashRequest
+	var req AnonymizeRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		RecordEncryptionOp("anonymize", "error", time.Since(start).Seconds(), 0)
 		return
 	}
+	if len(req.Document) > 0 {
+		if !featureFlags.Enabled(FeatureDeidentification) {
+			http.Error(w, "document de-identification is not enabled on this deployment", http.StatusBadRequest)
+			RecordEncryptionOp("deidentify", "error", time.Since(start).Seconds(), len(req.Document))
+			return
+		}
+		deidentifyDocument(w, r, req, start)
+		return
+	}
 
 	// Generate salt
 	salt, err := GenerateSalt()
@@ -375,3 +939,77 @@ func AnonymizeHandler(w http.ResponseWriter, r *http.Request) {
 		"request_id": reqID,
 	})
 }
+
+// RotateKeysRequest represents a key rotation request. When rotate_master_key is set,
+// every data key is re-wrapped under MASTER_KEY_NEXT, which must then replace
+// MASTER_KEY before the next restart.
+type RotateKeysRequest struct {
+	RotateMasterKey bool `json:"rotate_master_key"`
+}
+
+// RotateKeysHandler creates a new active data key and re-wraps the key ring
+func RotateKeysHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	var req RotateKeysRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			RecordEncryptionOp("rotate_keys", "error", time.Since(start).Seconds(), 0)
+			return
+		}
+	}
+
+	newMasterKey := ""
+	if req.RotateMasterKey {
+		next, err := secretProvider.Get(r.Context(), "MASTER_KEY_NEXT")
+		switch {
+		case err == nil:
+			newMasterKey = next.Value
+		case !errors.Is(err, secrets.ErrNotFound):
+			// The key store failed before enough checks degraded the service
+			log.Warn().Err(err).Msg("Master key rotation refused, MASTER_KEY_NEXT could not be read")
+			writeKeyStoreUnavailable(w, keyStore.RetryAfter())
+			RecordEncryptionOp("rotate_keys", "error", time.Since(start).Seconds(), 0)
+			return
+		}
+		if len(newMasterKey) != 32 {
+			http.Error(w, "MASTER_KEY_NEXT must be set to a 32-byte key to rotate the master key", http.StatusBadRequest)
+			RecordEncryptionOp("rotate_keys", "error", time.Since(start).Seconds(), 0)
+			return
+		}
+	}
+
+	result, err := encryptionService.KeyRing().Rotate(newMasterKey)
+	if err != nil {
+		log.Error().Err(err).Msg("Key rotation failed")
+		http.Error(w, "Key rotation failed", http.StatusInternalServerError)
+		RecordEncryptionOp("rotate_keys", "error", time.Since(start).Seconds(), 0)
+		RecordKeyRotation("manual", "error")
+		return
+	}
+
+	RecordEncryptionOp("rotate_keys", "success", time.Since(start).Seconds(), 0)
+	RecordKeyRotation("manual", "success")
+	log.Info().
+		Str("previous_key_id", result.PreviousKeyID).
+		Str("active_key_id", result.ActiveKeyID).
+		Int("rewrapped_keys", result.Rewrapped).
+		Bool("master_key_rotated", result.MasterKeyRotated).
+		Msg("Data encryption key rotated")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// ListKeysHandler lists key IDs and their lifecycle; key material is never returned
+func ListKeysHandler(w http.ResponseWriter, r *http.Request) {
+	keyRing := encryptionService.KeyRing()
+	activeKeyID, _ := keyRing.Active()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"active_key_id": activeKeyID,
+		"keys":          keyRing.Keys(),
+	})
+}
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Masking strategies
+const (
+	MaskHash      = "hash"      // keyed HMAC-SHA256, stable across records so joins survive
+	MaskSynthetic = "synthetic" // realistic fake value of the same kind, also stable per input
+	MaskNull      = "null"      // value removed
+	MaskKeep      = "keep"      // value copied unchanged
+)
+
+// Synthetic value kinds
+var syntheticKinds = map[string]bool{
+	"name": true, "first_name": true, "last_name": true, "email": true, "phone": true,
+	"ssn": true, "date": true, "address": true, "zip": true, "mrn": true,
+}
+
+// MaskingRule masks one field. Field is a key name matched case-insensitively at any
+// depth, or a dotted path such as "patient.contact.email" matched exactly.
+type MaskingRule struct {
+	Field    string `json:"field"`
+	Strategy string `json:"strategy"`
+	Kind     string `json:"kind,omitempty"`
+}
+
+// MaskingProfile is a named set of rules applied to every record of a masking job.
+// Fields no rule names are handled by Unmatched: "keep" (the default) copies them and
+// lists them in the report for review, "null" removes them.
+type MaskingProfile struct {
+	Name        string        `json:"name"`
+	Description string        `json:"description,omitempty"`
+	Rules       []MaskingRule `json:"rules"`
+	Unmatched   string        `json:"unmatched,omitempty"`
+}
+
+// Validate checks strategies and synthetic kinds
+func (p *MaskingProfile) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("profile name is required")
+	}
+	switch p.Unmatched {
+	case "", MaskKeep, MaskNull:
+	default:
+		return fmt.Errorf("profile %s: unmatched must be keep or null", p.Name)
+	}
+	for _, rule := range p.Rules {
+		if rule.Field == "" {
+			return fmt.Errorf("profile %s: rule field is required", p.Name)
+		}
+		switch rule.Strategy {
+		case MaskHash, MaskNull, MaskKeep:
+		case MaskSynthetic:
+			if !syntheticKinds[rule.Kind] {
+				return fmt.Errorf("profile %s: field %s: unknown synthetic kind %q", p.Name, rule.Field, rule.Kind)
+			}
+		default:
+			return fmt.Errorf("profile %s: field %s: unknown strategy %q", p.Name, rule.Field, rule.Strategy)
+		}
+	}
+	return nil
+}
+
+// defaultMaskingProfiles covers the PHI fields found in platform exports
+func defaultMaskingProfiles() []*MaskingProfile {
+	return []*MaskingProfile{
+		{
+			Name:        "staging",
+			Description: "Realistic synthetic identities with hashed record keys, for staging clones",
+			Rules: []MaskingRule{
+				{Field: "name", Strategy: MaskSynthetic, Kind: "name"},
+				{Field: "patient_name", Strategy: MaskSynthetic, Kind: "name"},
+				{Field: "first_name", Strategy: MaskSynthetic, Kind: "first_name"},
+				{Field: "last_name", Strategy: MaskSynthetic, Kind: "last_name"},
+				{Field: "email", Strategy: MaskSynthetic, Kind: "email"},
+				{Field: "phone", Strategy: MaskSynthetic, Kind: "phone"},
+				{Field: "ssn", Strategy: MaskSynthetic, Kind: "ssn"},
+				{Field: "date_of_birth", Strategy: MaskSynthetic, Kind: "date"},
+				{Field: "dob", Strategy: MaskSynthetic, Kind: "date"},
+				{Field: "address", Strategy: MaskSynthetic, Kind: "address"},
+				{Field: "zip", Strategy: MaskSynthetic, Kind: "zip"},
+				{Field: "mrn", Strategy: MaskSynthetic, Kind: "mrn"},
+				{Field: "patient_id", Strategy: MaskHash},
+				{Field: "insurance_id", Strategy: MaskHash},
+				{Field: "notes", Strategy: MaskNull},
+				{Field: "clinical_notes", Strategy: MaskNull},
+			},
+		},
+		{
+			Name:        "strict",
+			Description: "Hashes identifiers and drops every field not explicitly listed, for analytics sandboxes",
+			Unmatched:   MaskNull,
+			Rules: []MaskingRule{
+				{Field: "patient_id", Strategy: MaskHash},
+				{Field: "mrn", Strategy: MaskHash},
+				{Field: "device_id", Strategy: MaskKeep},
+				{Field: "diagnosis_code", Strategy: MaskKeep},
+				{Field: "procedure_code", Strategy: MaskKeep},
+				{Field: "date_of_birth", Strategy: MaskSynthetic, Kind: "date"},
+			},
+		},
+	}
+}
+
+// loadMaskingProfiles returns the built-in profiles plus any in the JSON array at
+// path, which replace built-ins of the same name
+func loadMaskingProfiles(path string) (map[string]*MaskingProfile, error) {
+	profiles := make(map[string]*MaskingProfile)
+	for _, p := range defaultMaskingProfiles() {
+		profiles[p.Name] = p
+	}
+	if path == "" {
+		return profiles, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading masking profiles: %w", err)
+	}
+	var custom []*MaskingProfile
+	if err := json.Unmarshal(data, &custom); err != nil {
+		return nil, fmt.Errorf("parsing masking profiles: %w", err)
+	}
+	for _, p := range custom {
+		if err := p.Validate(); err != nil {
+			return nil, err
+		}
+		profiles[p.Name] = p
+	}
+	return profiles, nil
+}
+
+// FieldMaskSummary counts how a field was masked
+type FieldMaskSummary struct {
+	Field    string `json:"field"`
+	Strategy string `json:"strategy"`
+	Masked   int    `json:"masked"`
+}
+
+// UnmaskedField is a field copied unchanged because no rule names it. Reviewers should
+// check these for PHI before the masked data is released.
+type UnmaskedField struct {
+	Field       string `json:"field"`
+	Occurrences int    `json:"occurrences"`
+}
+
+// MaskingReport summarises a masking run
+type MaskingReport struct {
+	Profile  string             `json:"profile"`
+	Files    []MaskedFile       `json:"files"`
+	Skipped  []string           `json:"skipped,omitempty"`
+	Records  int                `json:"records"`
+	Fields   []FieldMaskSummary `json:"fields"`
+	Unmasked []UnmaskedField    `json:"unmasked"`
+	Errors   []string           `json:"errors,omitempty"`
+}
+
+// MaskedFile is one processed export file
+type MaskedFile struct {
+	Path    string `json:"path"`
+	Format  string `json:"format"`
+	Records int    `json:"records"`
+}
+
+// Masker applies a profile to records. It is safe for concurrent use.
+type Masker struct {
+	profile *MaskingProfile
+	secret  []byte
+	byName  map[string]MaskingRule
+	byPath  map[string]MaskingRule
+
+	mu       sync.Mutex
+	records  int
+	masked   map[string]*FieldMaskSummary
+	unmasked map[string]int
+}
+
+// NewMasker creates a masker. The same secret gives the same hashed and synthetic
+// values, so masked exports stay joinable with each other.
+func NewMasker(profile *MaskingProfile, secret []byte) (*Masker, error) {
+	if err := profile.Validate(); err != nil {
+		return nil, err
+	}
+	m := &Masker{
+		profile:  profile,
+		secret:   secret,
+		byName:   make(map[string]MaskingRule),
+		byPath:   make(map[string]MaskingRule),
+		masked:   make(map[string]*FieldMaskSummary),
+		unmasked: make(map[string]int),
+	}
+	for _, rule := range profile.Rules {
+		if strings.Contains(rule.Field, ".") {
+			m.byPath[strings.ToLower(rule.Field)] = rule
+		} else {
+			m.byName[strings.ToLower(rule.Field)] = rule
+		}
+	}
+	return m, nil
+}
+
+// ruleFor finds the rule for a field; dotted paths take precedence over key names
+func (m *Masker) ruleFor(path, key string) (MaskingRule, bool) {
+	if rule, ok := m.byPath[strings.ToLower(path)]; ok {
+		return rule, true
+	}
+	rule, ok := m.byName[strings.ToLower(key)]
+	return rule, ok
+}
+
+// MaskRecord masks a decoded JSON object in place and returns it
+func (m *Masker) MaskRecord(record map[string]interface{}) map[string]interface{} {
+	m.mu.Lock()
+	m.records++
+	m.mu.Unlock()
+	m.maskObject("", record)
+	return record
+}
+
+func (m *Masker) maskObject(prefix string, obj map[string]interface{}) {
+	for key, value := range obj {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+
+		rule, ok := m.ruleFor(path, key)
+		if !ok {
+			// Descend into structures so nested fields can match their own rules
+			switch v := value.(type) {
+			case map[string]interface{}:
+				m.maskObject(path, v)
+				continue
+			case []interface{}:
+				if containsObjects(v) {
+					for _, item := range v {
+						if child, isObj := item.(map[string]interface{}); isObj {
+							m.maskObject(path, child)
+						}
+					}
+					continue
+				}
+			}
+			if m.profile.Unmatched == MaskNull {
+				obj[key] = nil
+				m.count(path, MaskNull)
+				continue
+			}
+			m.noteUnmasked(path)
+			continue
+		}
+
+		obj[key] = m.maskValue(rule, value)
+		m.count(path, rule.Strategy)
+	}
+}
+
+func containsObjects(items []interface{}) bool {
+	for _, item := range items {
+		if _, ok := item.(map[string]interface{}); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// maskValue applies a rule to one value. Nulls stay null; arrays are masked element-wise.
+func (m *Masker) maskValue(rule MaskingRule, value interface{}) interface{} {
+	if value == nil || rule.Strategy == MaskKeep {
+		return value
+	}
+	if rule.Strategy == MaskNull {
+		return nil
+	}
+	if items, ok := value.([]interface{}); ok {
+		masked := make([]interface{}, len(items))
+		for i, item := range items {
+			masked[i] = m.maskValue(rule, item)
+		}
+		return masked
+	}
+
+	text := fmt.Sprint(value)
+	if rule.Strategy == MaskHash {
+		return m.hash(text)
+	}
+	return m.synthesize(rule.Kind, text)
+}
+
+// MaskString masks a single field value, as read from a CSV cell. isNull reports that
+// the value was removed rather than replaced.
+func (m *Masker) MaskString(field, value string) (masked string, isNull bool) {
+	rule, ok := m.ruleFor(field, field)
+	if !ok {
+		if m.profile.Unmatched == MaskNull {
+			m.count(field, MaskNull)
+			return "", true
+		}
+		m.noteUnmasked(field)
+		return value, false
+	}
+
+	m.count(field, rule.Strategy)
+	switch {
+	case rule.Strategy == MaskKeep:
+		return value, false
+	case rule.Strategy == MaskNull:
+		return "", true
+	case value == "":
+		return "", false
+	case rule.Strategy == MaskHash:
+		return m.hash(value), false
+	default:
+		return m.synthesize(rule.Kind, value), false
+	}
+}
+
+// CountRecord records a record processed outside MaskRecord, such as a CSV row
+func (m *Masker) CountRecord() {
+	m.mu.Lock()
+	m.records++
+	m.mu.Unlock()
+}
+
+func (m *Masker) count(path, strategy string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	summary, ok := m.masked[path]
+	if !ok {
+		summary = &FieldMaskSummary{Field: path, Strategy: strategy}
+		m.masked[path] = summary
+	}
+	summary.Masked++
+}
+
+func (m *Masker) noteUnmasked(path string) {
+	m.mu.Lock()
+	m.unmasked[path]++
+	m.mu.Unlock()
+}
+
+// Summary fills the record and field counts of a report
+func (m *Masker) Summary(report *MaskingReport) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	report.Profile = m.profile.Name
+	report.Records = m.records
+	report.Fields = make([]FieldMaskSummary, 0, len(m.masked))
+	for _, summary := range m.masked {
+		report.Fields = append(report.Fields, *summary)
+	}
+	sort.Slice(report.Fields, func(i, j int) bool { return report.Fields[i].Field < report.Fields[j].Field })
+
+	report.Unmasked = make([]UnmaskedField, 0, len(m.unmasked))
+	for field, n := range m.unmasked {
+		report.Unmasked = append(report.Unmasked, UnmaskedField{Field: field, Occurrences: n})
+	}
+	sort.Slice(report.Unmasked, func(i, j int) bool { return report.Unmasked[i].Field < report.Unmasked[j].Field })
+}
+
+// digest is the keyed HMAC of a value, domain-separated by purpose
+func (m *Masker) digest(purpose, value string) []byte {
+	mac := hmac.New(sha256.New, m.secret)
+	mac.Write([]byte(purpose))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+func (m *Masker) hash(value string) string {
+	return hex.EncodeToString(m.digest("hash", value))
+}
+
+var (
+	syntheticFirstNames = []string{"Avery", "Jordan", "Riley", "Casey", "Morgan", "Quinn", "Taylor", "Reese", "Rowan", "Sage", "Emerson", "Hayden", "Parker", "Skyler", "Dakota", "Finley"}
+	syntheticLastNames  = []string{"Ashford", "Bramley", "Calder", "Dunmore", "Ellery", "Fairholt", "Garside", "Hollins", "Ingram", "Kestrel", "Langley", "Marlow", "Norcott", "Pemberton", "Radley", "Stanway"}
+	syntheticStreets    = []string{"Maple Ave", "Oak St", "Cedar Ln", "Birch Rd", "Elm Ct", "Willow Way", "Aspen Dr", "Spruce Pl"}
+)
+
+// synthesize derives a fake value of the given kind from the original, so repeated
+// values map to the same substitute. Numbers come from ranges that are never issued:
+// SSNs start with 9 and phone numbers use 555-01xx.
+func (m *Masker) synthesize(kind, value string) string {
+	seed := m.digest("synthetic:"+kind, value)
+	n := func(i int) uint64 { return binary.BigEndian.Uint64(seed[i*8 : i*8+8]) }
+	first := syntheticFirstNames[n(0)%uint64(len(syntheticFirstNames))]
+	last := syntheticLastNames[n(1)%uint64(len(syntheticLastNames))]
+
+	switch kind {
+	case "first_name":
+		return first
+	case "last_name":
+		return last
+	case "name":
+		return first + " " + last
+	case "email":
+		return fmt.Sprintf("%s.%s%02d@example.com", strings.ToLower(first), strings.ToLower(last), n(2)%100)
+	case "phone":
+		return fmt.Sprintf("(%03d) 555-01%02d", 200+n(2)%800, n(3)%100)
+	case "ssn":
+		return fmt.Sprintf("9%02d-%02d-%04d", n(2)%100, 1+n(3)%99, 1+n(0)%9999)
+	case "address":
+		return fmt.Sprintf("%d %s", 100+n(2)%9900, syntheticStreets[n(3)%uint64(len(syntheticStreets))])
+	case "zip":
+		return fmt.Sprintf("00%03d", n(2)%1000)
+	case "mrn":
+		return fmt.Sprintf("MRN-%08d", n(2)%100000000)
+	case "date":
+		return shiftDate(value, int(n(2)%361)-180)
+	}
+	return ""
+}
+
+// shiftDate moves a date by days, keeping its layout so downstream parsers still
+// accept it. Unparseable values are replaced with a shifted fixed date.
+func shiftDate(value string, days int) string {
+	for _, layout := range []string{"2006-01-02", time.RFC3339, "01/02/2006"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.AddDate(0, 0, days).Format(layout)
+		}
+	}
+	return time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, days).Format("2006-01-02")
+}
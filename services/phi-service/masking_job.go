@@ -0,0 +1,532 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/healthcare-gitops/common/config"
+	"github.com/rs/zerolog/log"
+)
+
+// Masking job states
+const (
+	MaskingRunning   = "running"
+	MaskingCompleted = "completed"
+	MaskingFailed    = "failed"
+)
+
+var errUnsupportedFormat = errors.New("unsupported export format")
+
+// exportFormat picks a reader from the file extension
+func exportFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return "json"
+	case ".ndjson", ".jsonl":
+		return "ndjson"
+	case ".csv":
+		return "csv"
+	}
+	return ""
+}
+
+// maskFile masks one export file into dst, returning the number of records written
+func maskFile(m *Masker, src, dst string) (int, error) {
+	format := exportFormat(src)
+	if format == "" {
+		return 0, errUnsupportedFormat
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0o750); err != nil {
+		return 0, err
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		return 0, err
+	}
+
+	var records int
+	switch format {
+	case "json":
+		records, err = maskJSON(m, in, out)
+	case "ndjson":
+		records, err = maskNDJSON(m, in, out)
+	case "csv":
+		records, err = maskCSV(m, in, out)
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// Never leave a partially masked file that could be mistaken for a complete one
+		os.Remove(dst)
+		return 0, err
+	}
+	return records, nil
+}
+
+// maskJSON masks a JSON array of objects, or a single object
+func maskJSON(m *Masker, in io.Reader, out io.Writer) (int, error) {
+	dec := json.NewDecoder(in)
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return 0, fmt.Errorf("decoding JSON: %w", err)
+	}
+
+	records := 0
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		m.MaskRecord(v)
+		records = 1
+	case []interface{}:
+		for i, item := range v {
+			obj, ok := item.(map[string]interface{})
+			if !ok {
+				return 0, fmt.Errorf("element %d is not an object", i)
+			}
+			m.MaskRecord(obj)
+			records++
+		}
+	default:
+		return 0, fmt.Errorf("expected an object or an array of objects")
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return records, enc.Encode(doc)
+}
+
+// maskNDJSON masks one JSON object per line
+func maskNDJSON(m *Masker, in io.Reader, out io.Writer) (int, error) {
+	dec := json.NewDecoder(in)
+	dec.UseNumber()
+	enc := json.NewEncoder(out)
+
+	records := 0
+	for {
+		var obj map[string]interface{}
+		err := dec.Decode(&obj)
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("record %d: %w", records+1, err)
+		}
+		if err := enc.Encode(m.MaskRecord(obj)); err != nil {
+			return 0, err
+		}
+		records++
+	}
+}
+
+// maskCSV masks a CSV file whose first row names the columns
+func maskCSV(m *Masker, in io.Reader, out io.Writer) (int, error) {
+	r := csv.NewReader(in)
+	w := csv.NewWriter(out)
+
+	header, err := r.Read()
+	if err == io.EOF {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("reading CSV header: %w", err)
+	}
+	if err := w.Write(header); err != nil {
+		return 0, err
+	}
+
+	records := 0
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("row %d: %w", records+2, err)
+		}
+		for i := range row {
+			row[i], _ = m.MaskString(header[i], row[i])
+		}
+		if err := w.Write(row); err != nil {
+			return 0, err
+		}
+		m.CountRecord()
+		records++
+	}
+	w.Flush()
+	return records, w.Error()
+}
+
+// MaskExports masks every supported file under src (a file or directory) into dst,
+// keeping relative paths. Files that fail are reported and the rest still processed.
+func MaskExports(m *Masker, src, dst string) (*MaskingReport, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &MaskingReport{Files: []MaskedFile{}}
+	process := func(path, rel string) {
+		if exportFormat(path) == "" {
+			report.Skipped = append(report.Skipped, rel)
+			return
+		}
+		records, err := maskFile(m, path, filepath.Join(dst, rel))
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", rel, err))
+			return
+		}
+		report.Files = append(report.Files, MaskedFile{Path: rel, Format: exportFormat(path), Records: records})
+	}
+
+	if !info.IsDir() {
+		process(src, filepath.Base(src))
+	} else {
+		err = filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(src, path)
+			if err != nil {
+				return err
+			}
+			process(path, rel)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	m.Summary(report)
+	return report, nil
+}
+
+// MaskingJob is one masking run over exported files
+type MaskingJob struct {
+	ID          string         `json:"id"`
+	Profile     string         `json:"profile"`
+	Source      string         `json:"source"`
+	Output      string         `json:"output"`
+	Status      string         `json:"status"`
+	Error       string         `json:"error,omitempty"`
+	StartedAt   time.Time      `json:"started_at"`
+	CompletedAt *time.Time     `json:"completed_at,omitempty"`
+	Report      *MaskingReport `json:"report,omitempty"`
+}
+
+// MaskingJobManager runs masking jobs against MASKING_EXPORT_DIR, writing each job's
+// output to its own directory under MASKING_OUTPUT_DIR. Job history is kept in memory.
+type MaskingJobManager struct {
+	exportDir string
+	outputDir string
+	profiles  map[string]*MaskingProfile
+	secret    []byte
+
+	mu   sync.RWMutex
+	jobs map[string]*MaskingJob
+	seq  int
+}
+
+// NewMaskingJobManager creates a job manager. Without a secret a random one is
+// generated, so masked values are consistent within this process but not across
+// restarts.
+func NewMaskingJobManager(exportDir, outputDir string, profiles map[string]*MaskingProfile, secret []byte) (*MaskingJobManager, error) {
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+	}
+	return &MaskingJobManager{
+		exportDir: exportDir,
+		outputDir: outputDir,
+		profiles:  profiles,
+		secret:    secret,
+		jobs:      make(map[string]*MaskingJob),
+	}, nil
+}
+
+// Profiles lists the available profiles by name
+func (jm *MaskingJobManager) Profiles() []*MaskingProfile {
+	profiles := make([]*MaskingProfile, 0, len(jm.profiles))
+	for _, p := range jm.profiles {
+		profiles = append(profiles, p)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	return profiles
+}
+
+// resolveSource maps a path relative to the export directory, refusing paths that
+// escape it
+func (jm *MaskingJobManager) resolveSource(source string) (string, error) {
+	if source == "" || filepath.IsAbs(source) {
+		return "", fmt.Errorf("source must be a path relative to the export directory")
+	}
+	clean := filepath.Clean(source)
+	if clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("source must be inside the export directory")
+	}
+	path := filepath.Join(jm.exportDir, clean)
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("source %s not found", source)
+	}
+	return path, nil
+}
+
+// Start validates a job and runs it in the background
+func (jm *MaskingJobManager) Start(profileName, source string) (MaskingJob, error) {
+	profile, ok := jm.profiles[profileName]
+	if !ok {
+		return MaskingJob{}, fmt.Errorf("unknown masking profile %q", profileName)
+	}
+	src, err := jm.resolveSource(source)
+	if err != nil {
+		return MaskingJob{}, err
+	}
+	masker, err := NewMasker(profile, jm.secret)
+	if err != nil {
+		return MaskingJob{}, err
+	}
+
+	jm.mu.Lock()
+	jm.seq++
+	job := &MaskingJob{
+		ID:        fmt.Sprintf("MASK-%06d", jm.seq),
+		Profile:   profile.Name,
+		Source:    source,
+		Status:    MaskingRunning,
+		StartedAt: time.Now(),
+	}
+	job.Output = job.ID
+	jm.jobs[job.ID] = job
+	started := *job
+	jm.mu.Unlock()
+
+	go jm.run(job, masker, src)
+	return started, nil
+}
+
+func (jm *MaskingJobManager) run(job *MaskingJob, masker *Masker, src string) {
+	start := time.Now()
+	report, err := MaskExports(masker, src, filepath.Join(jm.outputDir, job.Output))
+
+	now := time.Now()
+	jm.mu.Lock()
+	job.CompletedAt = &now
+	job.Report = report
+	job.Status = MaskingCompleted
+	if err != nil {
+		job.Status = MaskingFailed
+		job.Error = err.Error()
+	} else if len(report.Errors) > 0 {
+		job.Status = MaskingFailed
+		job.Error = fmt.Sprintf("%d file(s) failed", len(report.Errors))
+	}
+	status := job.Status
+	jm.mu.Unlock()
+
+	RecordMaskingJob(job.Profile, status, time.Since(start).Seconds())
+	event := log.Info()
+	if status == MaskingFailed {
+		event = log.Warn().Str("error", job.Error)
+	}
+	if report != nil {
+		event = event.Int("records", report.Records).Int("files", len(report.Files)).Int("unmasked_fields", len(report.Unmasked))
+	}
+	event.Str("job_id", job.ID).Str("profile", job.Profile).Str("status", status).Msg("Masking job finished")
+}
+
+// Job returns a copy of a job
+func (jm *MaskingJobManager) Job(id string) (MaskingJob, bool) {
+	jm.mu.RLock()
+	defer jm.mu.RUnlock()
+	job, ok := jm.jobs[id]
+	if !ok {
+		return MaskingJob{}, false
+	}
+	return *job, true
+}
+
+// Jobs lists jobs newest first, without their reports
+func (jm *MaskingJobManager) Jobs() []MaskingJob {
+	jm.mu.RLock()
+	defer jm.mu.RUnlock()
+	jobs := make([]MaskingJob, 0, len(jm.jobs))
+	for _, job := range jm.jobs {
+		summary := *job
+		summary.Report = nil
+		jobs = append(jobs, summary)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID > jobs[j].ID })
+	return jobs
+}
+
+// Masking job output lookup errors
+var (
+	errMaskingJobNotFound    = errors.New("masking job not found")
+	errMaskingOutputNotReady = errors.New("only completed masking jobs have output")
+)
+
+// OutputFile returns the path of a file written by a completed job. file is the
+// relative path listed in the job's report.
+func (jm *MaskingJobManager) OutputFile(id, file string) (string, error) {
+	job, ok := jm.Job(id)
+	if !ok {
+		return "", errMaskingJobNotFound
+	}
+	if job.Status != MaskingCompleted || job.Report == nil {
+		return "", fmt.Errorf("%w: job is %s", errMaskingOutputNotReady, job.Status)
+	}
+	for _, f := range job.Report.Files {
+		if f.Path == file {
+			return filepath.Join(jm.outputDir, job.Output, f.Path), nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s is not an output file of %s", errMaskingJobNotFound, file, id)
+}
+
+// maskingJobs is nil when MASKING_EXPORT_DIR or MASKING_OUTPUT_DIR is unset
+var maskingJobs *MaskingJobManager
+
+// requireMaskingJobs rejects masking requests when no directories are configured
+func requireMaskingJobs(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if maskingJobs == nil {
+			http.Error(w, "Masking is not configured", http.StatusServiceUnavailable)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// MaskingJobRequest starts a masking job
+type MaskingJobRequest struct {
+	Profile string `json:"profile"`
+	Source  string `json:"source"`
+}
+
+// ListMaskingProfilesHandler lists the masking profiles jobs can use
+func ListMaskingProfilesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"profiles": maskingJobs.Profiles(),
+	})
+}
+
+// StartMaskingJobHandler starts masking exported files with a profile
+func StartMaskingJobHandler(w http.ResponseWriter, r *http.Request) {
+	var req MaskingJobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	job, err := maskingJobs.Start(req.Profile, req.Source)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Info().Str("job_id", job.ID).Str("profile", job.Profile).Str("source", job.Source).Msg("Masking job started")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// ListMaskingJobsHandler lists masking jobs, newest first
+func ListMaskingJobsHandler(w http.ResponseWriter, r *http.Request) {
+	jobs := maskingJobs.Jobs()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"jobs":  jobs,
+		"count": len(jobs),
+	})
+}
+
+// GetMaskingJobHandler returns a job with its report once finished
+func GetMaskingJobHandler(w http.ResponseWriter, r *http.Request) {
+	job, ok := maskingJobs.Job(chi.URLParam(r, "jobID"))
+	if !ok {
+		http.Error(w, "Masking job not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// runMaskCommand implements `phi-service mask`, masking exports offline and printing
+// the report. It exits non-zero when any file fails.
+func runMaskCommand(args []string) int {
+	flags := flag.NewFlagSet("mask", flag.ContinueOnError)
+	profileName := flags.String("profile", "staging", "masking profile to apply")
+	in := flags.String("in", "", "export file or directory to mask")
+	out := flags.String("out", "", "directory for masked output")
+	profilesPath := flags.String("profiles", config.GetEnv("MASKING_PROFILES_PATH", ""), "JSON file with additional masking profiles")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *in == "" || *out == "" {
+		fmt.Fprintln(os.Stderr, "mask: -in and -out are required")
+		return 2
+	}
+
+	profiles, err := loadMaskingProfiles(*profilesPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "mask:", err)
+		return 1
+	}
+	profile, ok := profiles[*profileName]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "mask: unknown profile %q\n", *profileName)
+		return 2
+	}
+	secret := []byte(os.Getenv("MASKING_SECRET"))
+	if len(secret) == 0 {
+		fmt.Fprintln(os.Stderr, "mask: MASKING_SECRET is required so masked values are reproducible")
+		return 2
+	}
+
+	masker, err := NewMasker(profile, secret)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "mask:", err)
+		return 1
+	}
+	report, err := MaskExports(masker, *in, *out)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "mask:", err)
+		return 1
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(report)
+	if len(report.Errors) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testMaskingSecret = []byte("masking-test-secret")
+
+func stagingProfile(t *testing.T) *MaskingProfile {
+	profiles, err := loadMaskingProfiles("")
+	require.NoError(t, err)
+	return profiles["staging"]
+}
+
+// TestMaskRecordAppliesStrategies tests hash, synthetic and null rules on nested records
+func TestMaskRecordAppliesStrategies(t *testing.T) {
+	masker, err := NewMasker(stagingProfile(t), testMaskingSecret)
+	require.NoError(t, err)
+
+	record := masker.MaskRecord(map[string]interface{}{
+		"patient_id": "P-1001",
+		"ssn":        "123-45-6789",
+		"notes":      "History of hypertension",
+		"visit_type": "follow-up",
+		"contact": map[string]interface{}{
+			"email": "jane.doe@hospital.org",
+			"phone": "617-555-1234",
+		},
+	})
+
+	assert.Regexp(t, regexp.MustCompile(`^[0-9a-f]{64}$`), record["patient_id"])
+	assert.Regexp(t, regexp.MustCompile(`^9\d{2}-\d{2}-\d{4}$`), record["ssn"])
+	assert.Nil(t, record["notes"])
+	assert.Equal(t, "follow-up", record["visit_type"])
+
+	contact := record["contact"].(map[string]interface{})
+	assert.True(t, strings.HasSuffix(contact["email"].(string), "@example.com"))
+	assert.Contains(t, contact["phone"], "555-01")
+
+	var report MaskingReport
+	masker.Summary(&report)
+	assert.Equal(t, 1, report.Records)
+	assert.Equal(t, []UnmaskedField{{Field: "visit_type", Occurrences: 1}}, report.Unmasked)
+}
+
+// TestMaskingIsDeterministic tests that equal inputs mask to equal outputs under one
+// secret, keeping masked datasets joinable, and differ under another
+func TestMaskingIsDeterministic(t *testing.T) {
+	profile := stagingProfile(t)
+	a, err := NewMasker(profile, testMaskingSecret)
+	require.NoError(t, err)
+	b, err := NewMasker(profile, []byte("another-secret"))
+	require.NoError(t, err)
+
+	first := a.MaskRecord(map[string]interface{}{"patient_id": "P-1001", "name": "Jane Doe"})
+	second := a.MaskRecord(map[string]interface{}{"patient_id": "P-1001", "name": "Jane Doe"})
+	other := b.MaskRecord(map[string]interface{}{"patient_id": "P-1001", "name": "Jane Doe"})
+
+	assert.Equal(t, first, second)
+	assert.NotEqual(t, first["patient_id"], other["patient_id"])
+}
+
+// TestShiftDateKeepsLayout tests that synthetic dates stay parseable in their original layout
+func TestShiftDateKeepsLayout(t *testing.T) {
+	shifted := shiftDate("1984-03-12", 30)
+	assert.Equal(t, "1984-04-11", shifted)
+
+	shifted = shiftDate("03/12/1984", -12)
+	_, err := time.Parse("01/02/2006", shifted)
+	assert.NoError(t, err)
+}
+
+// TestMaskingProfileValidation tests that unknown strategies and kinds are rejected
+func TestMaskingProfileValidation(t *testing.T) {
+	bad := &MaskingProfile{Name: "bad", Rules: []MaskingRule{{Field: "ssn", Strategy: "encrypt"}}}
+	assert.Error(t, bad.Validate())
+
+	bad = &MaskingProfile{Name: "bad", Rules: []MaskingRule{{Field: "ssn", Strategy: MaskSynthetic, Kind: "passport"}}}
+	assert.Error(t, bad.Validate())
+}
+
+// TestMaskExportsProcessesFormats tests JSON, NDJSON and CSV exports and the job report
+func TestMaskExportsProcessesFormats(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "ehr"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "ehr", "patients.json"),
+		[]byte(`[{"patient_id":"P-1","name":"Jane Doe","age":42},{"patient_id":"P-2","name":"John Roe","age":57}]`), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "visits.ndjson"),
+		[]byte("{\"patient_id\":\"P-1\",\"notes\":\"chest pain\"}\n{\"patient_id\":\"P-2\",\"notes\":null}\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "contacts.csv"),
+		[]byte("patient_id,email,ward\nP-1,jane@hospital.org,3B\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "README.txt"), []byte("export notes"), 0o600))
+
+	masker, err := NewMasker(stagingProfile(t), testMaskingSecret)
+	require.NoError(t, err)
+	report, err := MaskExports(masker, src, dst)
+	require.NoError(t, err)
+
+	assert.Empty(t, report.Errors)
+	assert.Equal(t, 5, report.Records)
+	assert.Len(t, report.Files, 3)
+	assert.Equal(t, []string{"README.txt"}, report.Skipped)
+
+	data, err := os.ReadFile(filepath.Join(dst, "ehr", "patients.json"))
+	require.NoError(t, err)
+	var patients []map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &patients))
+	assert.NotEqual(t, "Jane Doe", patients[0]["name"])
+	assert.Equal(t, float64(42), patients[0]["age"])
+
+	// The same patient ID hashes identically across files
+	visits, err := os.ReadFile(filepath.Join(dst, "visits.ndjson"))
+	require.NoError(t, err)
+	assert.Contains(t, string(visits), patients[0]["patient_id"].(string))
+	assert.NotContains(t, string(visits), "chest pain")
+
+	contacts, err := os.ReadFile(filepath.Join(dst, "contacts.csv"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(contacts), "jane@hospital.org")
+	assert.Contains(t, string(contacts), ",3B")
+}
+
+// TestMaskingJobRejectsEscapingSource tests that job sources stay inside the export directory
+func TestMaskingJobRejectsEscapingSource(t *testing.T) {
+	profiles, err := loadMaskingProfiles("")
+	require.NoError(t, err)
+	jobs, err := NewMaskingJobManager(t.TempDir(), t.TempDir(), profiles, testMaskingSecret)
+	require.NoError(t, err)
+
+	for _, source := range []string{"../etc", "/etc/passwd", "ehr/../../secrets", ""} {
+		_, err := jobs.Start("staging", source)
+		assert.Error(t, err, source)
+	}
+	_, err = jobs.Start("unknown", "ehr")
+	assert.Error(t, err)
+}
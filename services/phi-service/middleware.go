@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/healthcare-gitops/common/tlsconfig"
 	"github.com/rs/zerolog/log"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
@@ -22,13 +23,16 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 		// Get request ID from context
 		reqID := middleware.GetReqID(r.Context())
 
-		log.Info().
+		event := log.Info().
 			Str("request_id", reqID).
 			Str("method", r.Method).
 			Str("path", r.URL.Path).
 			Str("remote_addr", r.RemoteAddr).
-			Str("user_agent", r.UserAgent()).
-			Msg("Incoming request")
+			Str("user_agent", r.UserAgent())
+		if id, ok := tlsconfig.FromContext(r.Context()); ok {
+			event = event.Str("client_cert", id.Name())
+		}
+		event.Msg("Incoming request")
 
 		next.ServeHTTP(ww, r)
 
@@ -107,6 +111,7 @@ func CORSMiddleware(next http.Handler) http.Handler {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID")
+		w.Header().Set("Access-Control-Expose-Headers", "X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset, Retry-After")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrObjectNotFound is returned for an object key the store does not hold
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Key         string    `json:"key"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type"`
+	ModTime     time.Time `json:"mod_time"`
+}
+
+// ObjectStore holds published export files for download. Keys are slash-separated
+// relative paths such as dsar/DSAR-000001.json.
+type ObjectStore interface {
+	Put(ctx context.Context, key string, body io.Reader) (ObjectInfo, error)
+	// Get opens an object. The body also implements io.Seeker when the store can serve
+	// byte ranges.
+	Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error)
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+}
+
+// Presigner is an object store that issues its own expiring download URLs, such as S3
+// presigned URLs, so downloads bypass the service entirely
+type Presigner interface {
+	PresignGet(ctx context.Context, key string, expires time.Time) (string, error)
+}
+
+// validObjectKey rejects keys that are absolute or escape the store
+func validObjectKey(key string) error {
+	clean := path.Clean(key)
+	if key == "" || clean != key || path.IsAbs(key) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return fmt.Errorf("invalid object key %q", key)
+	}
+	return nil
+}
+
+// FileObjectStore is an ObjectStore on the local filesystem, for single-node
+// deployments or a shared volume
+type FileObjectStore struct {
+	dir string
+}
+
+// NewFileObjectStore creates a store rooted at dir
+func NewFileObjectStore(dir string) (*FileObjectStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileObjectStore{dir: dir}, nil
+}
+
+func (s *FileObjectStore) path(key string) (string, error) {
+	if err := validObjectKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+// Put writes an object, replacing any existing one atomically
+func (s *FileObjectStore) Put(ctx context.Context, key string, body io.Reader) (ObjectInfo, error) {
+	dst, err := s.path(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o700); err != nil {
+		return ObjectInfo{}, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".upload-*")
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return ObjectInfo{}, err
+	}
+	if err := tmp.Close(); err != nil {
+		return ObjectInfo{}, err
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return ObjectInfo{}, err
+	}
+	return s.Stat(ctx, key)
+}
+
+// Get opens an object for reading
+func (s *FileObjectStore) Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error) {
+	info, err := s.Stat(ctx, key)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	p, _ := s.path(key)
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	return f, info, nil
+}
+
+// Stat describes an object
+func (s *FileObjectStore) Stat(_ context.Context, key string) (ObjectInfo, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	fi, err := os.Stat(p)
+	if errors.Is(err, os.ErrNotExist) || (err == nil && fi.IsDir()) {
+		return ObjectInfo{}, fmt.Errorf("%w: %s", ErrObjectNotFound, key)
+	}
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return ObjectInfo{Key: key, Size: fi.Size(), ContentType: contentType, ModTime: fi.ModTime().UTC()}, nil
+}
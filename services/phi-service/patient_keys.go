@@ -0,0 +1,283 @@
+package main
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// patientKeyPrefix starts the ID of every patient key, distinguishing it from the
+// versioned data keys ("v<n>")
+const patientKeyPrefix = "pk-"
+
+// ErrorCodeErased is the error code returned for PHI whose key has been destroyed
+const ErrorCodeErased = "erased"
+
+// ErrKeyErased is returned when ciphertext names a patient key that has been destroyed.
+// The PHI it protected is unrecoverable.
+var ErrKeyErased = errors.New("data key destroyed")
+
+// PatientKey is a data key dedicated to one patient's PHI, so that PHI can be erased
+// by destroying the key (crypto-shredding). A destroyed key keeps only its tombstone:
+// the ID, patient and timestamps.
+type PatientKey struct {
+	ID          string     `json:"id"`
+	PatientID   string     `json:"patient_id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	DestroyedAt *time.Time `json:"destroyed_at,omitempty"`
+	Wrapped     string     `json:"wrapped,omitempty"`
+	aead        cipher.AEAD
+	plaintext   []byte
+}
+
+// PatientKeyInfo is the metadata exposed about a patient key
+type PatientKeyInfo struct {
+	PatientID   string     `json:"patient_id"`
+	KeyID       string     `json:"key_id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	DestroyedAt *time.Time `json:"destroyed_at,omitempty"`
+}
+
+func (k *PatientKey) info() PatientKeyInfo {
+	return PatientKeyInfo{PatientID: k.PatientID, KeyID: k.ID, CreatedAt: k.CreatedAt, DestroyedAt: k.DestroyedAt}
+}
+
+// unwrapPatientKey decrypts a persisted patient key with the master key
+func (kr *KeyRing) unwrapPatientKey(key *PatientKey) error {
+	plaintext, err := kr.unwrapKey(key.ID, key.Wrapped)
+	if err != nil {
+		return err
+	}
+	if key.aead, err = newAEAD(plaintext); err != nil {
+		return err
+	}
+	key.plaintext = plaintext
+	return nil
+}
+
+// sortedPatientKeys returns patient keys oldest first. Callers must hold kr.mu.
+func (kr *KeyRing) sortedPatientKeys() []*PatientKey {
+	keys := make([]*PatientKey, 0, len(kr.patientKeys))
+	for _, key := range kr.patientKeys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+	return keys
+}
+
+// patientKeyByID returns a live patient key by ID. Callers must hold kr.mu.
+func (kr *KeyRing) patientKeyByID(id string) (cipher.AEAD, error) {
+	key, ok := kr.patientKeys[id]
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, id)
+	case key.DestroyedAt != nil:
+		return nil, fmt.Errorf("%w: %s", ErrKeyErased, id)
+	}
+	return key.aead, nil
+}
+
+// KeyPatient returns the patient a patient key belongs to, reporting whether id names
+// one. A destroyed key keeps its patient in its tombstone.
+func (kr *KeyRing) KeyPatient(id string) (string, bool) {
+	if !strings.HasPrefix(id, patientKeyPrefix) {
+		return "", false
+	}
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	key, ok := kr.patientKeys[id]
+	if !ok {
+		return "", false
+	}
+	return key.PatientID, true
+}
+
+// PatientKey returns the key for a patient's PHI, creating it on first use. Once the
+// key has been destroyed the patient's PHI can no longer be encrypted either.
+func (kr *KeyRing) PatientKey(patientID string) (string, cipher.AEAD, error) {
+	kr.mu.RLock()
+	id, aead, ok, err := kr.lookupPatientKey(patientID)
+	kr.mu.RUnlock()
+	if ok {
+		return id, aead, err
+	}
+
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	// Another request may have created it while the lock was released
+	if id, aead, ok, err := kr.lookupPatientKey(patientID); ok {
+		return id, aead, err
+	}
+
+	key, err := kr.generatePatientKey(patientID)
+	if err != nil {
+		return "", nil, err
+	}
+	kr.patients[patientID] = key
+	kr.patientKeys[key.ID] = key
+	if err := kr.save(); err != nil {
+		delete(kr.patients, patientID)
+		delete(kr.patientKeys, key.ID)
+		return "", nil, err
+	}
+	return key.ID, key.aead, nil
+}
+
+// lookupPatientKey returns a patient's existing key, reporting whether there is one.
+// Callers must hold kr.mu.
+func (kr *KeyRing) lookupPatientKey(patientID string) (string, cipher.AEAD, bool, error) {
+	key, ok := kr.patients[patientID]
+	if !ok {
+		return "", nil, false, nil
+	}
+	if key.DestroyedAt != nil {
+		return key.ID, nil, true, fmt.Errorf("%w: %s", ErrKeyErased, key.ID)
+	}
+	return key.ID, key.aead, true, nil
+}
+
+// generatePatientKey creates a patient key with a random ID, wrapped with the current
+// master key. Callers must hold kr.mu.
+func (kr *KeyRing) generatePatientKey(patientID string) (*PatientKey, error) {
+	id := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(rand.Reader, id); err != nil {
+			return nil, err
+		}
+		if _, taken := kr.patientKeys[patientKeyPrefix+hex.EncodeToString(id)]; !taken {
+			break
+		}
+	}
+	plaintext := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, plaintext); err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(plaintext)
+	if err != nil {
+		return nil, err
+	}
+	key := &PatientKey{
+		ID:        patientKeyPrefix + hex.EncodeToString(id),
+		PatientID: patientID,
+		CreatedAt: time.Now().UTC(),
+		aead:      aead,
+		plaintext: plaintext,
+	}
+	if key.Wrapped, err = wrapKey(kr.kek, key.ID, plaintext); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// DestroyPatientKey destroys a patient's key, leaving a tombstone. The wrapped key is
+// removed from the keyring file and the plaintext key wiped from memory, so everything
+// encrypted under it is unrecoverable. Copies of the keyring file made before the
+// destruction still hold the wrapped key until the master key is rotated.
+func (kr *KeyRing) DestroyPatientKey(patientID string) (PatientKeyInfo, error) {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	key, ok := kr.patients[patientID]
+	if !ok {
+		return PatientKeyInfo{}, fmt.Errorf("%w: no key for patient", ErrUnknownKey)
+	}
+	if key.DestroyedAt != nil {
+		return key.info(), fmt.Errorf("%w: %s", ErrKeyErased, key.ID)
+	}
+
+	previous := *key
+	now := time.Now().UTC()
+	key.DestroyedAt, key.Wrapped, key.aead, key.plaintext = &now, "", nil, nil
+	if err := kr.save(); err != nil {
+		*key = previous
+		return PatientKeyInfo{}, err
+	}
+	for i := range previous.plaintext {
+		previous.plaintext[i] = 0
+	}
+	return key.info(), nil
+}
+
+// EncryptForPatient encrypts plaintext under the patient's own key, so it can later be
+// erased with DestroyPatientKey
+func (e *EncryptionService) EncryptForPatient(plaintext []byte, patientID string) (string, error) {
+	if len(plaintext) == 0 {
+		return "", errors.New("plaintext cannot be empty")
+	}
+	keyID, gcm, err := e.keys.PatientKey(patientID)
+	if err != nil {
+		return "", err
+	}
+	return seal(keyID, gcm, plaintext)
+}
+
+// KeyErasedResponse is the error body returned for PHI whose key has been destroyed
+type KeyErasedResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+	KeyID string `json:"key_id,omitempty"`
+}
+
+// writeKeyErased answers 410 Gone with the erased error code
+func writeKeyErased(w http.ResponseWriter, keyID string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusGone)
+	json.NewEncoder(w).Encode(KeyErasedResponse{
+		Error: "PHI encrypted under this key has been erased",
+		Code:  ErrorCodeErased,
+		KeyID: keyID,
+	})
+}
+
+// DestroyPatientKeyHandler crypto-shreds a patient's PHI by destroying their key
+func DestroyPatientKeyHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	patientID := strings.TrimSpace(chi.URLParam(r, "patientID"))
+	if patientID == "" {
+		http.Error(w, "patientID is required", http.StatusBadRequest)
+		return
+	}
+
+	info, err := encryptionService.KeyRing().DestroyPatientKey(patientID)
+	switch {
+	case errors.Is(err, ErrUnknownKey):
+		http.Error(w, "No data key exists for this patient", http.StatusNotFound)
+		return
+	case errors.Is(err, ErrKeyErased):
+		writeKeyErased(w, info.KeyID)
+		return
+	case err != nil:
+		log.Error().Err(err).Msg("Patient key destruction failed")
+		http.Error(w, "Patient key destruction failed", http.StatusInternalServerError)
+		RecordEncryptionOp("destroy_patient_key", "error", time.Since(start).Seconds(), 0)
+		return
+	}
+
+	RecordEncryptionOp("destroy_patient_key", "success", time.Since(start).Seconds(), 0)
+	log.Info().Str("key_id", info.KeyID).Msg("Patient data key destroyed")
+	// The key is already gone; an audit failure cannot undo that, so it is reported
+	// rather than masking the erasure
+	if err := auditAccess(r, "destroy_patient_key", info.KeyID, "", AccessSucceeded); err != nil {
+		http.Error(w, "Patient key destroyed but the erasure could not be audited", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPatientKeyCryptoShredding tests that destroying a patient key erases only that patient's PHI
+func TestPatientKeyCryptoShredding(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	ring, err := NewKeyRing(testMasterKey, path)
+	require.NoError(t, err)
+	svc := NewEncryptionServiceWithKeyRing(ring)
+
+	erased, err := svc.EncryptForPatient([]byte("MRN-111"), "patient-1")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(erased, patientKeyPrefix))
+	again, err := svc.EncryptForPatient([]byte("DOB 1980-01-01"), "patient-1")
+	require.NoError(t, err)
+	assert.Equal(t, ciphertextKeyID(erased), ciphertextKeyID(again), "a patient keeps one key")
+	kept, err := svc.EncryptForPatient([]byte("MRN-222"), "patient-2")
+	require.NoError(t, err)
+
+	info, err := ring.DestroyPatientKey("patient-1")
+	require.NoError(t, err)
+	assert.Equal(t, ciphertextKeyID(erased), info.KeyID)
+	require.NotNil(t, info.DestroyedAt)
+
+	_, err = svc.Decrypt(erased)
+	assert.ErrorIs(t, err, ErrKeyErased)
+	_, err = svc.EncryptForPatient([]byte("MRN-111"), "patient-1")
+	assert.ErrorIs(t, err, ErrKeyErased)
+	_, err = ring.DestroyPatientKey("patient-1")
+	assert.ErrorIs(t, err, ErrKeyErased)
+	_, err = ring.DestroyPatientKey("patient-3")
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	// Master key rotation re-wraps the live patient key only
+	result, err := ring.Rotate(testNextMasterKey)
+	require.NoError(t, err)
+	assert.Equal(t, 4, result.Rewrapped)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var file keyRingFile
+	require.NoError(t, json.Unmarshal(data, &file))
+	require.Len(t, file.PatientKeys, 2)
+	assert.Empty(t, file.PatientKeys[0].Wrapped, "destroyed key material is not persisted")
+
+	reloaded := NewEncryptionServiceWithKeyRing(mustKeyRing(t, testNextMasterKey, path))
+	_, err = reloaded.Decrypt(erased)
+	assert.ErrorIs(t, err, ErrKeyErased)
+	decrypted, err := reloaded.Decrypt(kept)
+	require.NoError(t, err)
+	assert.Equal(t, "MRN-222", decrypted)
+}
+
+// TestDestroyPatientKeyHandler tests erasure over HTTP, its audit entry and the erased error code
+func TestDestroyPatientKeyHandler(t *testing.T) {
+	svc, err := NewEncryptionService(testMasterKey)
+	require.NoError(t, err)
+	previous := encryptionService
+	encryptionService = svc
+	defer func() { encryptionService = previous }()
+	withAccessAudit(t)
+
+	router := chi.NewRouter()
+	router.Post("/encrypt", EncryptHandler)
+	router.Post("/decrypt", DecryptHandler)
+	router.Delete("/keys/patient/{patientID}", DestroyPatientKeyHandler)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	w := do("POST", "/encrypt", `{"data":"123-45-6789","patient_id":"patient-9"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var encrypted EncryptResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&encrypted))
+	assert.True(t, strings.HasPrefix(encrypted.KeyID, patientKeyPrefix))
+
+	w = do("POST", "/encrypt", `{"data":"123-45-6789","mode":"fpe","format":"ssn","patient_id":"patient-9"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	assert.Equal(t, http.StatusNotFound, do("DELETE", "/keys/patient/patient-404", "").Code)
+	w = do("DELETE", "/keys/patient/patient-9", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var info PatientKeyInfo
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&info))
+	assert.Equal(t, "patient-9", info.PatientID)
+	assert.Equal(t, encrypted.KeyID, info.KeyID)
+
+	entries, err := accessAudit.Query(AccessAuditFilter{Operation: "destroy_patient_key"})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, encrypted.KeyID, entries[0].KeyID)
+
+	w = do("POST", "/decrypt", `{"encrypted_data":"`+encrypted.EncryptedData+`"}`)
+	require.Equal(t, http.StatusGone, w.Code)
+	var erased KeyErasedResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&erased))
+	assert.Equal(t, ErrorCodeErased, erased.Code)
+	assert.Equal(t, encrypted.KeyID, erased.KeyID)
+
+	assert.Equal(t, http.StatusGone, do("DELETE", "/keys/patient/patient-9", "").Code)
+}
+
+func mustKeyRing(t *testing.T, masterKey, path string) *KeyRing {
+	ring, err := NewKeyRing(masterKey, path)
+	require.NoError(t, err)
+	return ring
+}
@@ -1,10 +1,50 @@
 package main
 
+import (
+	"github.com/healthcare-gitops/common/resilience"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// State of the circuit breakers guarding calls to Vault and auth-service
+	circuitBreakerState = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "phi_service_circuit_breaker_state",
+			Help: "State of the circuit breaker guarding calls to a dependency: 0 closed, 1 half-open, 2 open",
+		},
+		[]string{"dependency"},
+	)
+
+	// State of the key store holding the master key: 1 for the current state, 0 for the other
+	keyStoreState = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "phi_service_key_store_state",
+			Help: "State of the key store holding the master key: 1 for the current state (available or degraded), 0 otherwise",
+		},
+		[]string{"state"},
+	)
+
+	// Operations held back while the key store was unreachable
+	degradedOperations = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "phi_service_key_store_degraded_operations_total",
+			Help: "Total number of encryptions and key operations held back while the key store was unreachable, by result",
+		},
+		[]string{"result"},
+	)
+)
+
 // RecordEncryptionOp records encryption operation metrics (stub for lightweight deployment)
 func RecordEncryptionOp(operation string, status string, duration float64, dataSize int) {
 	// Metrics disabled for lightweight deployment
 }
 
+// RecordKeyRotation records data key rotations by trigger (stub)
+func RecordKeyRotation(trigger string, status string) {
+	// Metrics disabled for lightweight deployment
+}
+
 // IncActiveRequests increments active requests counter (stub)
 func IncActiveRequests() {
 	// Metrics disabled for lightweight deployment
@@ -19,3 +59,77 @@ func DecActiveRequests() {
 func RecordHTTPRequest(method, path string, statusCode int, duration float64) {
 	// Metrics disabled for lightweight deployment
 }
+
+// RecordMaskingJob records masking job outcomes by profile (stub)
+func RecordMaskingJob(profile string, status string, duration float64) {
+	// Metrics disabled for lightweight deployment
+}
+
+// RecordDecryptAuthorization records decrypt authorization decisions by reason (stub)
+func RecordDecryptAuthorization(decision string, reason string) {
+	// Metrics disabled for lightweight deployment
+}
+
+// RecordAccessAuditFailure records PHI access audit entries that could not be written (stub)
+func RecordAccessAuditFailure(operation string) {
+	// Metrics disabled for lightweight deployment
+}
+
+// RecordDSARTask records data subject request task outcomes by service (stub)
+func RecordDSARTask(service string, action string, status string) {
+	// Metrics disabled for lightweight deployment
+}
+
+// RecordDownload records download link issuance and downloads by outcome (stub)
+func RecordDownload(action string, status string) {
+	// Metrics disabled for lightweight deployment
+}
+
+// RecordSyntheticReclaimed records expired synthetic records removed by the cleanup job (stub)
+func RecordSyntheticReclaimed(kind string, count int) {
+	// Metrics disabled for lightweight deployment
+}
+
+// RecordEncryptionAttestation records encryption attestations by result (stub)
+func RecordEncryptionAttestation(result string) {
+	// Metrics disabled for lightweight deployment
+}
+
+// RecordAuthCacheLookup records token introspection cache hits and misses (stub)
+func RecordAuthCacheLookup(result string) {
+	// Metrics disabled for lightweight deployment
+}
+
+// RecordHoneytokenAlert records decoy PHI decryptions by kind (stub)
+func RecordHoneytokenAlert(kind string) {
+	// Metrics disabled for lightweight deployment
+}
+
+// RecordConsentCheck records patient consent checks on PHI operations by purpose and result (stub)
+func RecordConsentCheck(purpose string, result string) {
+	// Metrics disabled for lightweight deployment
+}
+
+// RecordCircuitBreakerState records the state of the breaker guarding calls to a
+// dependency
+func RecordCircuitBreakerState(dependency string, state resilience.State) {
+	circuitBreakerState.WithLabelValues(dependency).Set(float64(state))
+}
+
+// RecordKeyStoreState records the state of the key store holding the master key:
+// available or degraded
+func RecordKeyStoreState(state string) {
+	for _, s := range []string{KeyStoreAvailable, KeyStoreDegraded} {
+		value := 0.0
+		if s == state {
+			value = 1
+		}
+		keyStoreState.WithLabelValues(s).Set(value)
+	}
+}
+
+// RecordDegradedOperation records an encryption or key operation held back while the
+// key store was unreachable, by result: resumed, refused or abandoned
+func RecordDegradedOperation(result string) {
+	degradedOperations.WithLabelValues(result).Inc()
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/healthcare-gitops/common/resilience"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRecordCircuitBreakerState tests that breaker states are exported per dependency
+func TestRecordCircuitBreakerState(t *testing.T) {
+	RecordCircuitBreakerState(dependencyVault, resilience.Open)
+	RecordCircuitBreakerState(dependencyAuthService, resilience.HalfOpen)
+	assert.Equal(t, float64(resilience.Open), testutil.ToFloat64(circuitBreakerState.WithLabelValues(dependencyVault)))
+	assert.Equal(t, float64(resilience.HalfOpen), testutil.ToFloat64(circuitBreakerState.WithLabelValues(dependencyAuthService)))
+
+	RecordCircuitBreakerState(dependencyVault, resilience.Closed)
+	assert.Equal(t, float64(resilience.Closed), testutil.ToFloat64(circuitBreakerState.WithLabelValues(dependencyVault)))
+}
+
+// TestKeyStoreMetrics tests that the key store state and the operations held back
+// while it is degraded are exported
+func TestKeyStoreMetrics(t *testing.T) {
+	refused := testutil.ToFloat64(degradedOperations.WithLabelValues("refused"))
+	m := NewKeyStoreMonitor(KeyStoreConfig{FailureThreshold: 1}, nil)
+	assert.Equal(t, 1.0, testutil.ToFloat64(keyStoreState.WithLabelValues(KeyStoreAvailable)))
+
+	m.Record(errVaultDown)
+	assert.Equal(t, 1.0, testutil.ToFloat64(keyStoreState.WithLabelValues(KeyStoreDegraded)))
+	assert.Equal(t, 0.0, testutil.ToFloat64(keyStoreState.WithLabelValues(KeyStoreAvailable)))
+	encryptThrough(m)
+	assert.Equal(t, refused+1, testutil.ToFloat64(degradedOperations.WithLabelValues("refused")))
+
+	m.Record(nil)
+	assert.Equal(t, 1.0, testutil.ToFloat64(keyStoreState.WithLabelValues(KeyStoreAvailable)))
+	assert.Equal(t, 0.0, testutil.ToFloat64(keyStoreState.WithLabelValues(KeyStoreDegraded)))
+}
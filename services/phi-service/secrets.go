@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/healthcare-gitops/common/config"
+	"github.com/healthcare-gitops/common/secrets"
+	"github.com/rs/zerolog/log"
+)
+
+// defaultSecretReloadInterval is how often a rotated MASTER_KEY is looked for
+const defaultSecretReloadInterval = time.Minute
+
+// secretProvider resolves MASTER_KEY and MASTER_KEY_NEXT. main replaces it with the
+// chain configured by the environment (Vault, files, then environment variables).
+var secretProvider secrets.Provider = secrets.Env{}
+
+// errMasterKeyLength is returned for a master key that is not 32 bytes
+var errMasterKeyLength = errors.New("must be exactly 32 bytes for AES-256-GCM")
+
+// loadMasterKey resolves and validates the master key
+func loadMasterKey(ctx context.Context, provider secrets.Provider) (secrets.Secret, error) {
+	secret, err := provider.Get(ctx, "MASTER_KEY")
+	if err != nil {
+		return secrets.Secret{}, err
+	}
+	if len(secret.Value) != 32 {
+		return secrets.Secret{}, fmt.Errorf("MASTER_KEY from %s %w (got %d)", secret.Source, errMasterKeyLength, len(secret.Value))
+	}
+	return secret, nil
+}
+
+// secretReloadInterval reads SECRETS_RELOAD_INTERVAL; zero disables reloading
+func secretReloadInterval() time.Duration {
+	interval, err := time.ParseDuration(config.GetEnv("SECRETS_RELOAD_INTERVAL", defaultSecretReloadInterval.String()))
+	if err != nil || interval < 0 {
+		log.Warn().Str("value", config.GetEnv("SECRETS_RELOAD_INTERVAL", "")).Msg("Invalid SECRETS_RELOAD_INTERVAL, using the default")
+		return defaultSecretReloadInterval
+	}
+	return interval
+}
+
+// watchMasterKey reloads the master key when its secret changes, re-wrapping the key
+// ring under the new key exactly as a master key rotation through /keys/rotate does.
+// A new value that cannot be applied is retried on the next poll, while the ring
+// stays wrapped under the key it has.
+func watchMasterKey(ctx context.Context, provider secrets.Provider, ring *KeyRing, current secrets.Secret, interval time.Duration) {
+	watcher := &secrets.Watcher{
+		Provider: provider,
+		Name:     "MASTER_KEY",
+		Interval: interval,
+		OnChange: func(secret secrets.Secret) error {
+			if len(secret.Value) != 32 {
+				RecordKeyRotation("secret_reload", "error")
+				return fmt.Errorf("new MASTER_KEY %w", errMasterKeyLength)
+			}
+			result, err := ring.Rotate(secret.Value)
+			if err != nil {
+				RecordKeyRotation("secret_reload", "error")
+				return fmt.Errorf("re-wrapping key ring: %w", err)
+			}
+			RecordKeyRotation("secret_reload", "success")
+			log.Info().
+				Str("source", secret.Source).
+				Str("version", secret.Version).
+				Str("active_key_id", result.ActiveKeyID).
+				Int("rewrapped_keys", result.Rewrapped).
+				Msg("Master key reloaded")
+			return nil
+		},
+		OnError: func(err error) {
+			log.Error().Err(err).Msg("Master key reload failed")
+		},
+	}
+	watcher.Run(ctx, current)
+}
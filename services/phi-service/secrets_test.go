@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/healthcare-gitops/common/health"
+	"github.com/healthcare-gitops/common/secrets"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestWatchMasterKeyReloadsRotatedSecret tests that a changed MASTER_KEY secret re-wraps the key ring in place
+func TestWatchMasterKeyReloadsRotatedSecret(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "keyring.json")
+	provider := secrets.File{Dir: dir}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "MASTER_KEY"), []byte(testMasterKey+"\n"), 0o600))
+
+	current, err := loadMasterKey(context.Background(), provider)
+	require.NoError(t, err)
+	assert.Equal(t, secrets.SourceFile, current.Source)
+	ring, err := NewKeyRing(current.Value, path)
+	require.NoError(t, err)
+	encrypted, err := NewEncryptionServiceWithKeyRing(ring).Encrypt([]byte("MRN-777"))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		watchMasterKey(ctx, provider, ring, current, 10*time.Millisecond)
+		close(done)
+	}()
+	defer func() { cancel(); <-done }()
+
+	// A malformed key is not applied
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "MASTER_KEY"), []byte("too-short"), 0o600))
+	time.Sleep(50 * time.Millisecond)
+	_, err = NewKeyRing(testMasterKey, path)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "MASTER_KEY"), []byte(testNextMasterKey), 0o600))
+	require.Eventually(t, func() bool {
+		_, err := NewKeyRing(testNextMasterKey, path)
+		return err == nil
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// The running service keeps decrypting, and a restart needs only the new key
+	decrypted, err := NewEncryptionServiceWithKeyRing(ring).Decrypt(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "MRN-777", decrypted)
+	_, err = NewKeyRing(testMasterKey, path)
+	assert.ErrorIs(t, err, ErrMasterKeyMismatch)
+}
+
+// TestReadinessDegradesWhileVaultIsSealed tests that a sealed Vault degrades readiness
+// without failing it, and that the service is not ready without its encryption service
+func TestReadinessDegradesWhileVaultIsSealed(t *testing.T) {
+	var sealed atomic.Bool
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/sys/health", r.URL.Path)
+		if sealed.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"sealed": true}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"initialized": true, "sealed": false}`))
+	}))
+	defer vault.Close()
+	provider, err := secrets.NewVault(secrets.VaultConfig{Address: vault.URL, Token: "test-token", Path: "phi-service"})
+	require.NoError(t, err)
+
+	previousChecks, previousService := dependencyChecks, encryptionService
+	t.Cleanup(func() { dependencyChecks, encryptionService = previousChecks, previousService })
+	dependencyChecks = []health.Check{{Name: "kms", Probe: provider.Ping}}
+	encryptionService, err = NewEncryptionService(testMasterKey)
+	require.NoError(t, err)
+
+	ready := func(wantCode int) health.Report {
+		w := httptest.NewRecorder()
+		ReadyHandler(w, httptest.NewRequest(http.MethodGet, "/readiness", nil))
+		require.Equal(t, wantCode, w.Code, w.Body.String())
+		var report health.Report
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&report))
+		return report
+	}
+
+	report := ready(http.StatusOK)
+	assert.Equal(t, health.Ready, report.Status)
+	assert.Equal(t, health.StatusUp, report.Checks["kms"].Status)
+
+	sealed.Store(true)
+	report = ready(http.StatusOK)
+	assert.Equal(t, health.Degraded, report.Status)
+	assert.Equal(t, health.StatusDegraded, report.Checks["kms"].Status)
+	assert.Equal(t, health.StatusUp, report.Checks["encryption"].Status)
+
+	encryptionService = nil
+	report = ready(http.StatusServiceUnavailable)
+	assert.Equal(t, health.NotReady, report.Status)
+	assert.Equal(t, health.StatusDown, report.Checks["encryption"].Status)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/healthcare-gitops/common/selfscan"
+)
+
+// selfScanSecrets are secrets loaded at startup from the secret provider, by name, for
+// the self-scan to compare with published defaults
+var selfScanSecrets = map[string]string{}
+
+// selfScanTarget describes this service to the security misconfiguration self-scan
+// served at /admin/selfscan
+func selfScanTarget(handler http.Handler) selfscan.Target {
+	secrets := map[string]string{
+		"PHI_ADMIN_TOKEN":      os.Getenv("PHI_ADMIN_TOKEN"),
+		"DEID_PSEUDONYM_KEY":   os.Getenv("DEID_PSEUDONYM_KEY"),
+		"MASKING_SECRET":       os.Getenv("MASKING_SECRET"),
+		"DSAR_CONNECTOR_TOKEN": os.Getenv("DSAR_CONNECTOR_TOKEN"),
+	}
+	for name, value := range selfScanSecrets {
+		secrets[name] = value
+	}
+	return selfscan.Target{
+		Service: "phi-service",
+		Handler: handler,
+		AdminRoutes: []string{
+			"/api/v1/keys",
+			"/api/v1/audit",
+			"/api/v1/audit/decryptions",
+			"/api/v1/masking/jobs",
+			"/api/v1/dsar",
+			"/api/v1/compliance/encryption",
+			"/api/v1/synthetic/cleanup",
+			"/compliance/status",
+		},
+		Secrets: secrets,
+	}
+}
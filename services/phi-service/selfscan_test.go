@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/healthcare-gitops/common/selfscan"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSelfScan tests that wildcard CORS and published secrets are reported in
+// production, and that the endpoint itself is admin only
+func TestSelfScan(t *testing.T) {
+	t.Setenv("ENV", "production")
+	t.Setenv("PHI_ADMIN_TOKEN", "admin-secret-for-selfscan-tests")
+	previous := selfScanSecrets
+	selfScanSecrets = map[string]string{"MASTER_KEY": "test-master-key-32-bytes-long-change-in-production"}
+	t.Cleanup(func() { selfScanSecrets = previous })
+
+	r := chi.NewRouter()
+	r.Use(CORSMiddleware)
+	r.Get("/health", HealthHandler)
+	r.Get("/api/v1/keys", requireAdminToken(ListKeysHandler))
+	r.Get("/admin/selfscan", requireAdminToken(selfscan.Handler(func() selfscan.Target {
+		return selfScanTarget(r)
+	})))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/selfscan", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/selfscan", nil)
+	req.Header.Set("X-Admin-Token", "admin-secret-for-selfscan-tests")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "test-master-key")
+
+	var report selfscan.Report
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&report))
+	assert.Equal(t, "phi-service", report.Service)
+	require.Len(t, report.Findings, 2)
+	assert.Equal(t, selfscan.CheckSecrets, report.Findings[0].Check)
+	assert.Equal(t, selfscan.Critical, report.Findings[0].Severity)
+	assert.Contains(t, report.Findings[0].Detail, "MASTER_KEY")
+	assert.Equal(t, selfscan.CheckCORS, report.Findings[1].Check)
+	assert.Equal(t, selfscan.High, report.Findings[1].Severity)
+	assert.Equal(t, 60, report.RiskScore)
+	assert.Equal(t, "medium", report.RiskLevel)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/healthcare-gitops/common/config"
+	"github.com/healthcare-gitops/common/synthetic"
+	"github.com/rs/zerolog/log"
+)
+
+// syntheticPolicy bounds the lifetime of records created by synthetic requests
+var syntheticPolicy = synthetic.PolicyFromEnv()
+
+// janitor removes expired synthetic records
+var janitor = synthetic.NewJanitor(func(kind string, n int) {
+	RecordSyntheticReclaimed(kind, n)
+	log.Info().Str("kind", kind).Int("count", n).Msg("Reclaimed expired synthetic records")
+})
+
+// startSyntheticCleanup runs the janitor on SYNTHETIC_CLEANUP_INTERVAL_MINUTES
+func startSyntheticCleanup(ctx context.Context) {
+	interval := time.Duration(config.GetEnvInt("SYNTHETIC_CLEANUP_INTERVAL_MINUTES", 15)) * time.Minute
+	if interval <= 0 {
+		interval = 15 * time.Minute
+	}
+	log.Info().Dur("interval", interval).Dur("default_ttl", syntheticPolicy.DefaultTTL).Msg("Starting synthetic data cleanup job")
+	janitor.Run(ctx, interval)
+}
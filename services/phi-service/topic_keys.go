@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/healthcare-gitops/common/auth"
+	"github.com/rs/zerolog/log"
+)
+
+// topicKeyScope is the token scope required to fetch event topic keys. Producers
+// encrypt and consumers decrypt with the same key, so one scope covers both.
+const topicKeyScope = "events:keys"
+
+// TopicKeyAlgorithm is the cipher event payloads are encrypted with under a topic key
+const TopicKeyAlgorithm = "A256GCM"
+
+// topicPattern restricts topic names, which are part of the key derivation
+var topicPattern = regexp.MustCompile(`^[a-z][a-z0-9-]{0,63}$`)
+
+// topicKeyIntrospector is nil when AUTH_INTROSPECT_URL is not set, which disables
+// topic keys
+var topicKeyIntrospector *auth.Introspector
+
+// TopicKey is the key event payloads on a topic are encrypted with
+type TopicKey struct {
+	Topic     string `json:"topic"`
+	KeyID     string `json:"key_id"`
+	Algorithm string `json:"algorithm"`
+	Key       string `json:"key"`
+	Active    bool   `json:"active"`
+}
+
+// TopicKey derives the event payload key for a topic from a data key. Rotating the
+// data key rotates every topic key, and retired data keys still derive theirs, so
+// consumers can decrypt events published before a rotation. An empty id selects the
+// active key.
+func (kr *KeyRing) TopicKey(id, topic string) (string, []byte, error) {
+	return kr.deriveKey(id, "phi-service event topic key\x00"+topic)
+}
+
+// TopicKeyHandler returns a topic's active key, or the key named by {keyID} for
+// events encrypted before a rotation. Callers need an events:keys token; every key
+// handed out is audited.
+func TopicKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if topicKeyIntrospector == nil {
+		http.Error(w, "Topic keys are disabled: AUTH_INTROSPECT_URL is not set", http.StatusServiceUnavailable)
+		return
+	}
+
+	start := time.Now()
+	topic, keyID := chi.URLParam(r, "topic"), chi.URLParam(r, "keyID")
+	entry := AccessAuditEntry{
+		Time:       start.UTC(),
+		RequestID:  middleware.GetReqID(r.Context()),
+		RemoteAddr: r.RemoteAddr,
+		Operation:  "topic_key",
+		KeyID:      keyID,
+		Resource:   topic,
+		Status:     AccessDenied,
+	}
+	deny := func(status int, message string) {
+		auditDecision(r.Context(), entry)
+		RecordEncryptionOp("topic_key", "error", time.Since(start).Seconds(), 0)
+		http.Error(w, message, status)
+	}
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" || token == r.Header.Get("Authorization") {
+		deny(http.StatusUnauthorized, "Bearer token required")
+		return
+	}
+	info, err := topicKeyIntrospector.Introspect(r, token)
+	if err != nil {
+		log.Error().Err(err).Msg("Token introspection failed")
+		deny(http.StatusServiceUnavailable, "Authorization service unavailable")
+		return
+	}
+	if !info.Active {
+		deny(http.StatusUnauthorized, "Invalid or expired token")
+		return
+	}
+	entry.Actor, entry.Role = info.UserID, info.Role
+	if !info.HasScope(topicKeyScope) {
+		deny(http.StatusForbidden, "Token lacks the "+topicKeyScope+" scope")
+		return
+	}
+	if !topicPattern.MatchString(topic) {
+		deny(http.StatusBadRequest, "topic must be 1-64 lowercase letters, digits or '-', starting with a letter")
+		return
+	}
+
+	keyRing := encryptionService.KeyRing()
+	id, key, err := keyRing.TopicKey(keyID, topic)
+	if errors.Is(err, ErrUnknownKey) {
+		deny(http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Str("topic", topic).Msg("Topic key derivation failed")
+		entry.Status = AccessFailed
+		deny(http.StatusInternalServerError, "Topic key derivation failed")
+		return
+	}
+
+	entry.KeyID, entry.Status = id, AccessSucceeded
+	if err := auditDecision(r.Context(), entry); err != nil {
+		http.Error(w, "Topic key withheld: access could not be audited", http.StatusInternalServerError)
+		return
+	}
+	RecordEncryptionOp("topic_key", "success", time.Since(start).Seconds(), 0)
+
+	activeID, _ := keyRing.Active()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(TopicKey{
+		Topic:     topic,
+		KeyID:     id,
+		Algorithm: TopicKeyAlgorithm,
+		Key:       base64.StdEncoding.EncodeToString(key),
+		Active:    id == activeID,
+	})
+}
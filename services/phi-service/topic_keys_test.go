@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/healthcare-gitops/common/auth"
+	"github.com/healthcare-gitops/common/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withTopicKeys installs a fresh encryption service and an introspector for the given
+// auth service, and returns a router serving the topic key endpoints
+func withTopicKeys(t *testing.T, introspectURL string) (*EncryptionService, http.Handler) {
+	svc, err := NewEncryptionService(testMasterKey)
+	require.NoError(t, err)
+	previousService, previousIntrospector := encryptionService, topicKeyIntrospector
+	encryptionService = svc
+	topicKeyIntrospector = auth.NewIntrospector(auth.Config{IntrospectURL: introspectURL, Timeout: time.Second})
+	t.Cleanup(func() { encryptionService, topicKeyIntrospector = previousService, previousIntrospector })
+
+	router := chi.NewRouter()
+	router.Get("/api/v1/topic-keys/{topic}", TopicKeyHandler)
+	router.Get("/api/v1/topic-keys/{topic}/{keyID}", TopicKeyHandler)
+	return svc, router
+}
+
+// TestTopicKeyHandler tests scope checks, key selection across rotation and auditing
+func TestTopicKeyHandler(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Unix()
+	srv, _ := fakeAuthService(t, map[string]auth.Introspection{
+		"publisher": {Active: true, UserID: "medical-device", Role: "service", Scopes: []string{"events:keys"}, Exp: exp},
+		"reader":    {Active: true, UserID: "dr-grey", Role: "clinician", Scopes: []string{"phi:read"}, Exp: exp},
+	})
+	svc, router := withTopicKeys(t, srv.URL)
+	auditLog := withAccessAudit(t)
+
+	get := func(token, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	key := func(path string) TopicKey {
+		w := get("publisher", path)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+		var key TopicKey
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&key))
+		return key
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, get("", "/api/v1/topic-keys/devices").Code)
+	assert.Equal(t, http.StatusUnauthorized, get("forged", "/api/v1/topic-keys/devices").Code)
+	assert.Equal(t, http.StatusForbidden, get("reader", "/api/v1/topic-keys/devices").Code)
+	assert.Equal(t, http.StatusBadRequest, get("publisher", "/api/v1/topic-keys/Devices").Code)
+	assert.Equal(t, http.StatusNotFound, get("publisher", "/api/v1/topic-keys/devices/v9").Code)
+
+	before := key("/api/v1/topic-keys/devices")
+	assert.Equal(t, TopicKey{Topic: "devices", KeyID: "v1", Algorithm: TopicKeyAlgorithm, Key: before.Key, Active: true}, before)
+	assert.NotEqual(t, before.Key, key("/api/v1/topic-keys/alerts").Key, "topics must not share keys")
+
+	_, err := svc.KeyRing().Rotate("")
+	require.NoError(t, err)
+	after := key("/api/v1/topic-keys/devices")
+	assert.Equal(t, "v2", after.KeyID)
+	assert.NotEqual(t, before.Key, after.Key)
+	retired := key("/api/v1/topic-keys/devices/v1")
+	assert.Equal(t, before.Key, retired.Key, "retired keys must still derive the same topic key")
+	assert.False(t, retired.Active)
+
+	// Newest first: the retired key handed out, then the scope refusal six entries earlier
+	entries, _ := auditLog.Query(AccessAuditFilter{Operation: "topic_key"})
+	require.Len(t, entries, 9)
+	assert.Equal(t, AccessSucceeded, entries[0].Status)
+	assert.Equal(t, "medical-device", entries[0].Actor)
+	assert.Equal(t, "devices", entries[0].Resource)
+	assert.Equal(t, "v1", entries[0].KeyID)
+	assert.Equal(t, AccessDenied, entries[6].Status)
+	assert.Equal(t, "dr-grey", entries[6].Actor)
+}
+
+// TestTopicKeysEncryptedEvents tests the events SDK against the endpoints: a consumer
+// keeps decrypting events published before and after a rotation without restarting
+func TestTopicKeysEncryptedEvents(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Unix()
+	srv, _ := fakeAuthService(t, map[string]auth.Introspection{
+		"publisher": {Active: true, UserID: "medical-device", Role: "service", Scopes: []string{"events:keys"}, Exp: exp},
+	})
+	svc, router := withTopicKeys(t, srv.URL)
+	withAccessAudit(t)
+	phi := httptest.NewServer(router)
+	t.Cleanup(phi.Close)
+
+	producerKeys, err := events.NewKeyService(events.KeyServiceConfig{URL: phi.URL, Token: "publisher", ActiveTTL: time.Nanosecond})
+	require.NoError(t, err)
+	consumerKeys, err := events.NewKeyService(events.KeyServiceConfig{URL: phi.URL, Token: "publisher"})
+	require.NoError(t, err)
+
+	var received []string
+	consumer := events.NewConsumer("").WithDecryption(consumerKeys)
+	consumer.OnAlertRaisedV1(func(ctx context.Context, meta events.Metadata, alert events.AlertRaisedV1) error {
+		received = append(received, meta.ID)
+		return nil
+	})
+
+	publish := func(id string) []byte {
+		body := []byte(`{"id":"` + id + `","type":"alert.raised","schema_version":1,"occurred_at":"2025-01-01T00:00:00Z",` +
+			`"data":{"id":"ALT-1","device_id":"DEV-1","device_type":"pulse_oximeter","condition":"device_error","priority":"high",` +
+			`"alert_level":"critical","message":"SpO2 low","raised_at":"2025-01-01T00:00:00Z","ack_deadline":"2025-01-01T00:05:00Z"}}`)
+		encrypted, err := events.Encrypt(context.Background(), producerKeys, events.TopicAlerts, "alert.raised", id, body)
+		require.NoError(t, err)
+		assert.NotContains(t, string(encrypted), "SpO2")
+		return encrypted
+	}
+
+	early := publish("EVT-1")
+	require.NoError(t, consumer.Handle(context.Background(), "alert.raised", "EVT-1", early))
+	_, err = svc.KeyRing().Rotate("")
+	require.NoError(t, err)
+	late := publish("EVT-2")
+	assert.Contains(t, string(late), `"key_id":"v2"`)
+
+	// The consumer has only seen v1: it fetches v2 for the new event and still reads
+	// events published before the rotation
+	require.NoError(t, consumer.Handle(context.Background(), "alert.raised", "EVT-2", late))
+	require.NoError(t, consumer.Handle(context.Background(), "alert.raised", "EVT-1", early))
+	assert.Equal(t, []string{"EVT-1", "EVT-2", "EVT-1"}, received)
+
+	// The ciphertext is bound to its event, and a consumer without keys refuses it
+	assert.ErrorIs(t, consumer.Handle(context.Background(), "alert.raised", "EVT-3", late), events.ErrUndecryptable)
+	assert.ErrorIs(t, events.NewConsumer("").Handle(context.Background(), "alert.raised", "EVT-2", late), events.ErrEncrypted)
+}
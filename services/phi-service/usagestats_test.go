@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/healthcare-gitops/common/usagestats"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestUsageStatsCountFeaturesWithoutPHI tests that reports count feature use, carry only
+// allowlisted fields and never the data a request handled
+func TestUsageStatsCountFeaturesWithoutPHI(t *testing.T) {
+	received := make(chan []byte, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- body
+	}))
+	defer collector.Close()
+	svc, err := NewEncryptionService(testMasterKey)
+	require.NoError(t, err)
+	previous := encryptionService
+	encryptionService = svc
+	defer func() { encryptionService = previous }()
+
+	flags := newFeatureFlags()
+	reporter := usagestats.NewReporter(
+		usagestats.Config{Enabled: true, Endpoint: collector.URL, InstallID: "acme-hospital-01"},
+		usagestats.Source{Service: "phi-service", Version: apiSpecVersion, Flags: flags},
+	)
+
+	handler := flags.Require(FeatureBlindIndex, BlindIndexHandler)
+	for i := 0; i < 2; i++ {
+		handler(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/v1/blind-index", strings.NewReader(`{"value":"123-45-6789","field":"ssn"}`)))
+	}
+
+	require.NoError(t, reporter.Send(context.Background()))
+	body := <-received
+	assert.NotContains(t, string(body), "123-45-6789")
+
+	var fields map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(body, &fields))
+	for field := range fields {
+		assert.Contains(t, usagestats.Fields, field)
+	}
+	var report usagestats.Report
+	require.NoError(t, json.Unmarshal(body, &report))
+	assert.Equal(t, "acme-hospital-01", report.InstallID)
+	assert.Equal(t, apiSpecVersion, report.Version)
+	assert.Equal(t, int64(2), report.FeatureUsage[FeatureBlindIndex])
+	assert.Equal(t, int64(0), report.FeatureUsage[FeatureFPE])
+	assert.True(t, report.Features[FeatureBlindIndex])
+
+	w := httptest.NewRecorder()
+	reporter.Handler()(w, httptest.NewRequest("GET", "/admin/usage-stats", nil))
+	var preview usagestats.Preview
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&preview))
+	assert.True(t, preview.Enabled)
+	assert.NotNil(t, preview.LastSentAt)
+	assert.Equal(t, int64(2), preview.Payload.FeatureUsage[FeatureBlindIndex])
+}
+
+// TestUsageStatsOptIn tests that nothing is sent unless the operator opts in
+func TestUsageStatsOptIn(t *testing.T) {
+	reporter := usagestats.NewReporter(usagestats.ConfigFromEnv(), usagestats.Source{Service: "phi-service", Version: apiSpecVersion})
+	assert.False(t, reporter.Enabled())
+	assert.ErrorIs(t, reporter.Send(context.Background()), usagestats.ErrDisabled)
+
+	w := httptest.NewRecorder()
+	reporter.Handler()(w, httptest.NewRequest("GET", "/admin/usage-stats", nil))
+	var preview usagestats.Preview
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&preview))
+	assert.False(t, preview.Enabled)
+	assert.Len(t, preview.Payload.InstallID, 32)
+}
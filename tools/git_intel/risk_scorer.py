@@ -6,6 +6,7 @@ Calculates risk scores (0-100) based on:
 - File paths modified (PHI services, auth, payments)
 - Commit metadata (HIPAA, FDA, clinical safety impact)
 - Change patterns (size, complexity, scope)
+- Runtime misconfigurations reported by the services' /admin/selfscan endpoints
 
 Used by CI/CD pipelines to determine deployment strategy:
 - Low Risk (0-39): Auto-deploy with standard checks
@@ -45,6 +46,8 @@ class CommitRiskScorer:
     - File paths (40 points max): PHI/auth/payment services
     - Metadata (40 points max): PHI-Impact, Clinical-Safety
     - Change scope (20 points max): Number of files, LoC changed
+    - Runtime findings (40 points max): /admin/selfscan reports of the target
+      environment, so a deployment into a misconfigured service needs more care
     """
     
     # High-risk paths (40 points each)
@@ -71,6 +74,14 @@ class CommitRiskScorer:
         'tests/',
     ]
     
+    # Points per self-scan finding, by severity
+    RUNTIME_FINDING_POINTS = {
+        'critical': 20,
+        'high': 10,
+        'medium': 5,
+        'low': 1,
+    }
+    
     def __init__(self):
         self.max_score = 100
     
@@ -209,6 +220,26 @@ class CommitRiskScorer:
         
         return min(score, 20), reasons  # Cap at 20 for scope
     
+    def score_runtime_findings(self, reports: List[Dict]) -> Tuple[int, List[str]]:
+        """Score based on services' /admin/selfscan reports."""
+        score = 0
+        reasons = []
+        
+        for report in reports:
+            service = report.get('service', 'unknown service')
+            for finding in report.get('findings') or []:
+                severity = finding.get('severity', 'low')
+                points = self.RUNTIME_FINDING_POINTS.get(severity, 0)
+                if points == 0:
+                    continue
+                score += points
+                reasons.append(
+                    f"Runtime {severity} finding in {service}: "
+                    f"{finding.get('title', finding.get('check', 'misconfiguration'))}"
+                )
+        
+        return min(score, 40), reasons  # Cap at 40 for runtime findings
+    
     def determine_deployment_strategy(self, score: int, level: str) -> Tuple[str, bool, str]:
         """Determine deployment strategy based on risk score."""
         if score >= 70:  # High risk
@@ -232,7 +263,8 @@ class CommitRiskScorer:
     
     def score_commit(self, files: Optional[List[str]] = None, 
                     metadata: Optional[Dict] = None,
-                    commit_ref: str = "HEAD") -> RiskAssessment:
+                    commit_ref: str = "HEAD",
+                    runtime_reports: Optional[List[Dict]] = None) -> RiskAssessment:
         """
         Calculate comprehensive risk score for a commit.
         
@@ -240,6 +272,7 @@ class CommitRiskScorer:
             files: List of changed files (will auto-detect if None)
             metadata: Commit metadata dict (will extract if None)
             commit_ref: Git commit reference (default: HEAD)
+            runtime_reports: Self-scan reports from the target environment (optional)
         
         Returns:
             RiskAssessment with score, level, and deployment strategy
@@ -255,9 +288,10 @@ class CommitRiskScorer:
         path_score, path_reasons = self.score_file_paths(files)
         meta_score, meta_reasons = self.score_metadata(metadata)
         scope_score, scope_reasons = self.score_change_scope(files)
+        runtime_score, runtime_reasons = self.score_runtime_findings(runtime_reports or [])
         
         # Total score
-        total_score = path_score + meta_score + scope_score
+        total_score = path_score + meta_score + scope_score + runtime_score
         total_score = min(total_score, self.max_score)
         
         # Determine risk level
@@ -269,7 +303,7 @@ class CommitRiskScorer:
             level = 'low'
         
         # Combine all reasons
-        all_reasons = path_reasons + meta_reasons + scope_reasons
+        all_reasons = path_reasons + meta_reasons + scope_reasons + runtime_reasons
         
         # Determine deployment strategy
         strategy, approval_req, audit_level = self.determine_deployment_strategy(
@@ -301,6 +335,12 @@ def main():
         nargs='+',
         help='List of changed files (optional, will auto-detect)'
     )
+    parser.add_argument(
+        '--selfscan',
+        nargs='+',
+        metavar='REPORT',
+        help='JSON reports saved from services\' /admin/selfscan endpoints (optional)'
+    )
     parser.add_argument(
         '--format',
         choices=['json', 'text', 'github'],
@@ -319,9 +359,15 @@ def main():
     scorer = CommitRiskScorer()
     
     try:
+        runtime_reports = []
+        for path in args.selfscan or []:
+            with open(path) as f:
+                runtime_reports.append(json.load(f))
+        
         assessment = scorer.score_commit(
             files=args.files,
-            commit_ref=args.commit
+            commit_ref=args.commit,
+            runtime_reports=runtime_reports
         )
         
         # Output based on format